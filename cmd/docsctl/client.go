@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/serroba/online-docs/internal/apitypes"
+)
+
+// client calls the server's REST API as one user.
+type client struct {
+	baseURL string
+	userID  string
+	apiKey  string
+	token   string
+	http    *http.Client
+}
+
+// apiError is a failed response, carrying the server's error message.
+type apiError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *apiError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("server returned %d", e.Status)
+	}
+
+	return fmt.Sprintf("%s (%d)", e.Message, e.Status)
+}
+
+// do sends a request with an optional JSON body and returns the response
+// body. Responses outside the 2xx range are returned as an *apiError.
+func (c *client) do(ctx context.Context, method, path string, query url.Values, body any) ([]byte, error) {
+	target := strings.TrimSuffix(c.baseURL, "/") + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("encode request: %w", err)
+		}
+
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	c.authenticate(req)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &apiError{Status: resp.StatusCode}
+
+		var errResp apitypes.ErrorResponse
+		if json.Unmarshal(data, &errResp) == nil {
+			apiErr.Code, apiErr.Message = errResp.Code, errResp.Message
+		}
+
+		return nil, apiErr
+	}
+
+	return data, nil
+}
+
+// authenticate adds the strongest credential configured: an API key, then
+// an access token, then a plain user ID for servers without a login.
+func (c *client) authenticate(req *http.Request) {
+	switch {
+	case c.apiKey != "":
+		req.Header.Set("X-Api-Key", c.apiKey)
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case c.userID != "":
+		req.Header.Set("X-User-Id", c.userID)
+	}
+}
+
+// documentPath returns the path of a document or one of its sub-resources.
+func documentPath(docID string, elems ...string) string {
+	path := "/v1/documents/" + url.PathEscape(docID)
+	for _, elem := range elems {
+		path += "/" + url.PathEscape(elem)
+	}
+
+	return path
+}
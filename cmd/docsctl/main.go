@@ -0,0 +1,364 @@
+// Command docsctl manages an online-docs server through its REST API. It
+// creates, inspects, exports and deletes documents, manages who can access
+// them and, for admins, lists documents and controls editing sessions.
+//
+// Usage:
+//
+//	docsctl [flags] <command> [arguments]
+//
+// Run docsctl -h for the list of commands. Flags default to the
+// DOCSCTL_SERVER, DOCSCTL_USER, DOCSCTL_API_KEY and DOCSCTL_TOKEN
+// environment variables.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/serroba/online-docs/internal/apitypes"
+)
+
+const defaultServer = "http://localhost:8080"
+
+// Exit codes.
+const (
+	exitOK    = 0
+	exitError = 1 // The request failed
+	exitUsage = 2 // The command line was invalid
+)
+
+// errUsage reports a command line that doesn't match the command's synopsis.
+var errUsage = errors.New("invalid arguments")
+
+// command is a docsctl subcommand.
+type command struct {
+	name     string
+	synopsis string // Arguments, for the usage message
+	summary  string
+	run      func(ctx context.Context, c *client, args []string, out io.Writer) error
+}
+
+var commands = []command{
+	{"create", "[-content text] [-slug slug] [id]", "create a document, generating its ID if omitted", runCreate},
+	{"get", "[-revision n] <id>", "print a document, optionally at a historical revision", runGet},
+	{"export", "[-format txt|md|html] <id>", "print a document rendered as a file", runExport},
+	{"delete", "<id>", "delete a document", runDelete},
+	{"perms", "<id>", "list who can access a document", runPerms},
+	{"grant", "<id> <user> <viewer|editor|owner>", "give a user a role on a document", runGrant},
+	{"revoke", "<id> <user>", "remove a user's access to a document", runRevoke},
+	{"list", "", "list every document (admin)", runList},
+	{"summary", "", "print the server summary (admin)", runSummary},
+	{"sessions", "", "list active editing sessions (admin)", runSessions},
+	{"snapshot", "<id>", "snapshot an active session now (admin)", runSnapshot},
+	{"close", "<id>", "snapshot and close a session, disconnecting its clients (admin)", runClose},
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Getenv, os.Stdout, os.Stderr))
+}
+
+// run executes the command line and returns the process exit code.
+func run(ctx context.Context, args []string, getenv func(string) string, stdout, stderr io.Writer) int {
+	c := &client{http: &http.Client{}}
+
+	fs := flag.NewFlagSet("docsctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { usage(fs) }
+
+	fs.StringVar(&c.baseURL, "server", envOr(getenv, "DOCSCTL_SERVER", defaultServer), "server base URL")
+	fs.StringVar(&c.userID, "user", getenv("DOCSCTL_USER"), "user ID to act as, for servers without login")
+	fs.StringVar(&c.apiKey, "api-key", getenv("DOCSCTL_API_KEY"), "service account API key")
+	fs.StringVar(&c.token, "token", getenv("DOCSCTL_TOKEN"), "access token from /auth/login")
+	fs.DurationVar(&c.http.Timeout, "timeout", 30*time.Second, "request timeout")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+
+		return exitUsage
+	}
+
+	if fs.NArg() == 0 {
+		usage(fs)
+
+		return exitUsage
+	}
+
+	name := fs.Arg(0)
+
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+
+		err := cmd.run(ctx, c, fs.Args()[1:], stdout)
+
+		switch {
+		case err == nil:
+			return exitOK
+		case errors.Is(err, errUsage):
+			fmt.Fprintf(stderr, "usage: docsctl %s %s\n", cmd.name, cmd.synopsis)
+
+			return exitUsage
+		default:
+			fmt.Fprintf(stderr, "docsctl %s: %v\n", cmd.name, err)
+
+			return exitError
+		}
+	}
+
+	fmt.Fprintf(stderr, "docsctl: unknown command %q\n", name)
+	usage(fs)
+
+	return exitUsage
+}
+
+// usage prints the global flags and the commands.
+func usage(fs *flag.FlagSet) {
+	out := fs.Output()
+
+	fmt.Fprintln(out, "usage: docsctl [flags] <command> [arguments]")
+	fmt.Fprintln(out, "\ncommands:")
+
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-9s %s\n", cmd.name, cmd.summary)
+	}
+
+	fmt.Fprintln(out, "\nflags:")
+	fs.PrintDefaults()
+}
+
+// envOr returns the environment variable, or fallback when it's unset.
+func envOr(getenv func(string) string, key, fallback string) string {
+	if v := getenv(key); v != "" {
+		return v
+	}
+
+	return fallback
+}
+
+// parseArgs parses a command's flags and checks the number of positional
+// arguments left.
+func parseArgs(fs *flag.FlagSet, args []string, minArgs, maxArgs int) ([]string, error) {
+	fs.SetOutput(io.Discard)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, errUsage
+	}
+
+	if fs.NArg() < minArgs || fs.NArg() > maxArgs {
+		return nil, errUsage
+	}
+
+	return fs.Args(), nil
+}
+
+// printJSON writes a JSON response body indented for reading.
+func printJSON(out io.Writer, data []byte) error {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+
+	buf.WriteByte('\n')
+
+	_, err := buf.WriteTo(out)
+
+	return err
+}
+
+// runCreate implements docsctl create.
+func runCreate(ctx context.Context, c *client, args []string, out io.Writer) error {
+	var req apitypes.CreateDocumentRequest
+
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	fs.StringVar(&req.Content, "content", "", "initial content")
+	fs.StringVar(&req.Slug, "slug", "", "unique human-readable alias")
+
+	rest, err := parseArgs(fs, args, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	if len(rest) == 1 {
+		req.ID = rest[0]
+	}
+
+	data, err := c.do(ctx, http.MethodPost, "/v1/documents", nil, req)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(out, data)
+}
+
+// runGet implements docsctl get.
+func runGet(ctx context.Context, c *client, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	revision := fs.Int("revision", -1, "historical revision to print")
+
+	rest, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	if *revision >= 0 {
+		query.Set("revision", strconv.Itoa(*revision))
+	}
+
+	data, err := c.do(ctx, http.MethodGet, documentPath(rest[0]), query, nil)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(out, data)
+}
+
+// runExport implements docsctl export.
+func runExport(ctx context.Context, c *client, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "txt", "output format: txt, md or html")
+
+	rest, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	data, err := c.do(ctx, http.MethodGet, documentPath(rest[0], "export"), url.Values{"format": {*format}}, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(data)
+
+	return err
+}
+
+// runDelete implements docsctl delete.
+func runDelete(ctx context.Context, c *client, args []string, _ io.Writer) error {
+	rest, err := parseArgs(flag.NewFlagSet("delete", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, http.MethodDelete, documentPath(rest[0]), nil, nil)
+
+	return err
+}
+
+// runPerms implements docsctl perms.
+func runPerms(ctx context.Context, c *client, args []string, out io.Writer) error {
+	rest, err := parseArgs(flag.NewFlagSet("perms", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	data, err := c.do(ctx, http.MethodGet, documentPath(rest[0], "permissions"), nil, nil)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(out, data)
+}
+
+// runGrant implements docsctl grant.
+func runGrant(ctx context.Context, c *client, args []string, out io.Writer) error {
+	rest, err := parseArgs(flag.NewFlagSet("grant", flag.ContinueOnError), args, 3, 3)
+	if err != nil {
+		return err
+	}
+
+	req := apitypes.SetPermissionRequest{Role: rest[2]}
+
+	data, err := c.do(ctx, http.MethodPut, documentPath(rest[0], "permissions", rest[1]), nil, req)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(out, data)
+}
+
+// runRevoke implements docsctl revoke.
+func runRevoke(ctx context.Context, c *client, args []string, _ io.Writer) error {
+	rest, err := parseArgs(flag.NewFlagSet("revoke", flag.ContinueOnError), args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, http.MethodDelete, documentPath(rest[0], "permissions", rest[1]), nil, nil)
+
+	return err
+}
+
+// runList implements docsctl list.
+func runList(ctx context.Context, c *client, args []string, out io.Writer) error {
+	return getAdmin(ctx, c, "list", "/v1/admin/documents", args, out)
+}
+
+// runSummary implements docsctl summary.
+func runSummary(ctx context.Context, c *client, args []string, out io.Writer) error {
+	return getAdmin(ctx, c, "summary", "/v1/admin/summary", args, out)
+}
+
+// runSessions implements docsctl sessions.
+func runSessions(ctx context.Context, c *client, args []string, out io.Writer) error {
+	return getAdmin(ctx, c, "sessions", "/v1/admin/sessions", args, out)
+}
+
+// getAdmin prints an admin resource that takes no arguments.
+func getAdmin(ctx context.Context, c *client, name, path string, args []string, out io.Writer) error {
+	if _, err := parseArgs(flag.NewFlagSet(name, flag.ContinueOnError), args, 0, 0); err != nil {
+		return err
+	}
+
+	data, err := c.do(ctx, http.MethodGet, path, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(out, data)
+}
+
+// runSnapshot implements docsctl snapshot.
+func runSnapshot(ctx context.Context, c *client, args []string, out io.Writer) error {
+	rest, err := parseArgs(flag.NewFlagSet("snapshot", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	data, err := c.do(ctx, http.MethodPost, "/v1/admin/sessions/"+url.PathEscape(rest[0])+"/snapshot", nil, nil)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(out, data)
+}
+
+// runClose implements docsctl close.
+func runClose(ctx context.Context, c *client, args []string, _ io.Writer) error {
+	rest, err := parseArgs(flag.NewFlagSet("close", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, http.MethodDelete, "/v1/admin/sessions/"+url.PathEscape(rest[0]), nil, nil)
+
+	return err
+}
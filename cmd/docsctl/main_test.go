@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer starts a server where root is an admin.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	permStore := acl.NewMemoryStore()
+	hub := ws.NewHub()
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore, Hub: hub})
+
+	server := httptest.NewServer(handler.NewServer(handler.ServerConfig{
+		Manager:   manager,
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+		Admins:    []string{"root"},
+	}).Handler())
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// docsctl runs a command line against the server and returns its exit code
+// and output.
+func docsctl(t *testing.T, server *httptest.Server, user string, args ...string) (int, string, string) {
+	t.Helper()
+
+	env := map[string]string{"DOCSCTL_SERVER": server.URL, "DOCSCTL_USER": user}
+
+	var stdout, stderr bytes.Buffer
+	code := run(t.Context(), args, func(key string) string { return env[key] }, &stdout, &stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+func TestDocsctl_Documents(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+
+	code, out, errOut := docsctl(t, server, "alice", "create", "-content", "hello", "notes")
+	require.Equal(t, exitOK, code, errOut)
+
+	var created apitypes.CreateDocumentResponse
+	require.NoError(t, json.Unmarshal([]byte(out), &created))
+	require.Equal(t, "notes", created.ID)
+
+	code, out, errOut = docsctl(t, server, "alice", "get", "notes")
+	require.Equal(t, exitOK, code, errOut)
+
+	var doc apitypes.GetDocumentResponse
+	require.NoError(t, json.Unmarshal([]byte(out), &doc))
+	require.Equal(t, "hello", doc.Content)
+	require.Zero(t, doc.Revision)
+
+	code, out, errOut = docsctl(t, server, "alice", "export", "-format", "md", "notes")
+	require.Equal(t, exitOK, code, errOut)
+	require.Contains(t, out, "hello")
+
+	code, _, errOut = docsctl(t, server, "alice", "delete", "notes")
+	require.Equal(t, exitOK, code, errOut)
+
+	code, _, errOut = docsctl(t, server, "alice", "get", "notes")
+	require.Equal(t, exitError, code)
+	require.Equal(t, "docsctl get: document not found (404)\n", errOut)
+}
+
+func TestDocsctl_Permissions(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+
+	code, _, errOut := docsctl(t, server, "alice", "create", "plan")
+	require.Equal(t, exitOK, code, errOut)
+
+	code, _, errOut = docsctl(t, server, "bob", "perms", "plan")
+	require.Equal(t, exitError, code, "bob has no access yet")
+	require.Contains(t, errOut, "access denied")
+
+	code, out, errOut := docsctl(t, server, "alice", "grant", "plan", "bob", "editor")
+	require.Equal(t, exitOK, code, errOut)
+	require.JSONEq(t, `{"id": "plan", "permissions": [
+		{"userId": "alice", "role": "owner"},
+		{"userId": "bob", "role": "editor"}
+	]}`, out)
+
+	code, _, errOut = docsctl(t, server, "alice", "revoke", "plan", "bob")
+	require.Equal(t, exitOK, code, errOut)
+
+	code, out, errOut = docsctl(t, server, "alice", "perms", "plan")
+	require.Equal(t, exitOK, code, errOut)
+	require.JSONEq(t, `{"id": "plan", "permissions": [{"userId": "alice", "role": "owner"}]}`, out)
+}
+
+func TestDocsctl_Admin(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+
+	for _, id := range []string{"b", "a"} {
+		code, _, errOut := docsctl(t, server, "alice", "create", id)
+		require.Equal(t, exitOK, code, errOut)
+	}
+
+	code, out, errOut := docsctl(t, server, "root", "list")
+	require.Equal(t, exitOK, code, errOut)
+	require.JSONEq(t, `{"ids": ["a", "b"]}`, out)
+
+	code, out, errOut = docsctl(t, server, "root", "sessions")
+	require.Equal(t, exitOK, code, errOut)
+	require.JSONEq(t, `{"sessions": []}`, out)
+
+	code, out, errOut = docsctl(t, server, "root", "summary")
+	require.Equal(t, exitOK, code, errOut)
+	require.Contains(t, out, `"documents": 2`)
+
+	code, _, errOut = docsctl(t, server, "root", "snapshot", "a")
+	require.Equal(t, exitError, code)
+	require.Contains(t, errOut, "no active session")
+
+	code, _, errOut = docsctl(t, server, "alice", "list")
+	require.Equal(t, exitError, code)
+	require.Contains(t, errOut, "admin access required")
+}
+
+func TestDocsctl_Usage(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		stderr string
+	}{
+		{"no command", nil, exitUsage, "usage: docsctl [flags] <command>"},
+		{"unknown command", []string{"frobnicate"}, exitUsage, `unknown command "frobnicate"`},
+		{"missing argument", []string{"get"}, exitUsage, "usage: docsctl get [-revision n] <id>"},
+		{"extra argument", []string{"list", "x"}, exitUsage, "usage: docsctl list"},
+		{"unknown flag", []string{"export", "-style", "x", "doc"}, exitUsage, "usage: docsctl export"},
+		{"unknown global flag", []string{"-style", "x", "list"}, exitUsage, "flag provided but not defined"},
+		{"create", []string{"create", "a", "b"}, exitUsage, "usage: docsctl create"},
+		{"delete", []string{"delete"}, exitUsage, "usage: docsctl delete <id>"},
+		{"perms", []string{"perms"}, exitUsage, "usage: docsctl perms <id>"},
+		{"grant", []string{"grant", "doc", "bob"}, exitUsage, "usage: docsctl grant"},
+		{"revoke", []string{"revoke", "doc"}, exitUsage, "usage: docsctl revoke <id> <user>"},
+		{"snapshot", []string{"snapshot"}, exitUsage, "usage: docsctl snapshot <id>"},
+		{"close", []string{"close"}, exitUsage, "usage: docsctl close <id>"},
+		{"help", []string{"-h"}, exitOK, "commands:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			code, _, errOut := docsctl(t, server, "alice", tt.args...)
+			require.Equal(t, tt.code, code, errOut)
+
+			if !strings.Contains(errOut, tt.stderr) {
+				t.Errorf("expected stderr to contain %q, got %q", tt.stderr, errOut)
+			}
+		})
+	}
+}
+
+func TestDocsctl_Unreachable(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	for _, args := range [][]string{
+		{"create", "doc"},
+		{"get", "-revision", "0", "doc"},
+		{"export", "doc"},
+		{"delete", "doc"},
+		{"perms", "doc"},
+		{"grant", "doc", "bob", "editor"},
+		{"revoke", "doc", "bob"},
+		{"list"},
+		{"snapshot", "doc"},
+		{"close", "doc"},
+	} {
+		t.Run(args[0], func(t *testing.T) {
+			t.Parallel()
+
+			code, _, errOut := docsctl(t, server, "alice", args...)
+			require.Equal(t, exitError, code)
+			require.Contains(t, errOut, "docsctl "+args[0]+": ")
+		})
+	}
+}
+
+func TestDocsctl_DefaultServer(t *testing.T) {
+	t.Parallel()
+
+	var stderr bytes.Buffer
+
+	code := run(t.Context(), []string{"-h"}, func(string) string { return "" }, io.Discard, &stderr)
+	require.Equal(t, exitOK, code)
+	require.Contains(t, stderr.String(), defaultServer)
+}
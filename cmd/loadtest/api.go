@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+)
+
+// apiClient sets up and tears down a run through the server's REST API.
+type apiClient struct {
+	baseURL string
+	apiKey  string
+	token   string
+	http    *http.Client
+}
+
+// header returns the handshake headers authenticating a client as user.
+// With an API key or token, every client shares its identity instead.
+func (c *apiClient) header(user string) http.Header {
+	header := http.Header{}
+
+	switch {
+	case c.apiKey != "":
+		header.Set("X-Api-Key", c.apiKey)
+	case c.token != "":
+		header.Set("Authorization", "Bearer "+c.token)
+	default:
+		header.Set("X-User-Id", user)
+	}
+
+	return header
+}
+
+// createDocument creates an empty document owned by the first user and lets
+// the others edit it.
+func (c *apiClient) createDocument(ctx context.Context, users []string) (string, error) {
+	var created apitypes.CreateDocumentResponse
+
+	err := c.do(ctx, http.MethodPost, "/v1/documents", users[0], apitypes.CreateDocumentRequest{}, &created)
+	if err != nil {
+		return "", err
+	}
+
+	// A shared identity already owns the document
+	if c.apiKey != "" || c.token != "" {
+		return created.ID, nil
+	}
+
+	for _, user := range users[1:] {
+		path := "/v1/documents/" + url.PathEscape(created.ID) + "/permissions/" + url.PathEscape(user)
+		req := apitypes.SetPermissionRequest{Role: acl.Editor.String()}
+
+		if err := c.do(ctx, http.MethodPut, path, users[0], req, nil); err != nil {
+			_ = c.deleteDocument(ctx, created.ID, users[0])
+
+			return "", fmt.Errorf("grant %s: %w", user, err)
+		}
+	}
+
+	return created.ID, nil
+}
+
+// deleteDocument deletes a document created for the run.
+func (c *apiClient) deleteDocument(ctx context.Context, docID, user string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/documents/"+url.PathEscape(docID), user, nil, nil)
+}
+
+// do sends a request as user with an optional JSON body, decoding the
+// response into out unless it's nil.
+func (c *apiClient) do(ctx context.Context, method, path, user string, body, out any) error {
+	var reader io.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.baseURL, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+
+	req.Header = c.header(user)
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var errResp apitypes.ErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil && errResp.Message != "" {
+			return fmt.Errorf("%s (%d)", errResp.Message, resp.StatusCode)
+		}
+
+		return fmt.Errorf("server returned %d", resp.StatusCode)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIClient_Header(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "key", (&apiClient{apiKey: "key"}).header("alice").Get("X-Api-Key"))
+	require.Equal(t, "Bearer token", (&apiClient{token: "token"}).header("alice").Get("Authorization"))
+	require.Equal(t, "alice", (&apiClient{}).header("alice").Get("X-User-Id"))
+}
+
+func TestAPIClient_CreateDocument(t *testing.T) {
+	t.Parallel()
+
+	// Without permissions there is nothing to grant, so the document is
+	// deleted again
+	store := storage.NewMemoryStore()
+	server := httptest.NewServer(handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store}),
+		Store:   store,
+	}).Handler())
+	t.Cleanup(server.Close)
+
+	api := &apiClient{baseURL: server.URL, http: &http.Client{}}
+
+	_, err := api.createDocument(t.Context(), []string{"alice", "bob"})
+	require.ErrorContains(t, err, "grant bob")
+
+	ids, err := store.ListDocuments(t.Context())
+	require.NoError(t, err)
+	require.Empty(t, ids)
+
+	// A shared identity owns the document already, so nobody is granted it
+	shared := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("X-Api-Key") != "key" {
+			http.Error(w, "unexpected request", http.StatusTeapot)
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"id": "doc1"}`))
+	}))
+	t.Cleanup(shared.Close)
+
+	api = &apiClient{baseURL: shared.URL, apiKey: "key", http: &http.Client{}}
+
+	docID, err := api.createDocument(t.Context(), []string{"alice", "bob"})
+	require.NoError(t, err)
+	require.Equal(t, "doc1", docID)
+}
+
+func TestAPIClient_Do(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bare":
+			w.WriteHeader(http.StatusBadGateway)
+		case "/malformed":
+			_, _ = w.Write([]byte("["))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	api := &apiClient{baseURL: server.URL, http: &http.Client{}}
+
+	var out map[string]any
+
+	require.EqualError(t, api.do(t.Context(), http.MethodGet, "/bare", "alice", nil, &out), "server returned 502")
+	require.ErrorContains(t, api.do(t.Context(), http.MethodGet, "/malformed", "alice", nil, &out), "decode response")
+	require.ErrorContains(t, api.do(t.Context(), http.MethodPost, "/", "alice", make(chan int), nil), "encode request")
+	require.Error(t, api.do(t.Context(), "bad method", "/", "alice", nil, nil))
+
+	server.Close()
+	require.Error(t, api.do(t.Context(), http.MethodGet, "/", "alice", nil, nil))
+}
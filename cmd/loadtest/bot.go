@@ -0,0 +1,429 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/ws"
+)
+
+// errClosed reports a bot whose connection was closed by loadtest itself.
+var errClosed = errors.New("connection closed")
+
+// envelope is a server message with its payload left to decode by type.
+type envelope struct {
+	Type    ws.MessageType  `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// bot is a simulated client editing the document over one WebSocket
+// connection. Like a real editor it applies its edits locally straight away,
+// keeps one in flight and queues the rest, and transforms the server's
+// broadcasts against them.
+type bot struct {
+	docID  string
+	userID string
+	conn   *websocket.Conn
+	out    chan ws.Message // Messages for the writer
+	dead   chan struct{}   // Closed once the connection fails
+	rng    *rand.Rand      // Chooses the edits; only the typing goroutine uses it
+
+	mu       sync.Mutex
+	changed  chan struct{} // Closed and replaced whenever the state below changes
+	err      error         // Why the connection failed
+	synced   bool          // doc holds the server's state; false while resyncing
+	doc      *ot.Document
+	revision int                  // Last server revision applied to doc
+	pending  []ot.Operation       // Local edits not acknowledged yet; the first is in flight
+	sentAt   time.Time            // When the edit in flight was sent
+	early    map[int]ot.Operation // Broadcasts received ahead of revision
+	ackAt    int                  // Revision of an ack received ahead of revision, or 0
+	final    *ws.StatePayload     // The server's state requested by check
+
+	latencies []time.Duration // How long each acknowledged edit was in flight
+	rejected  int             // Edits the server answered with an error
+}
+
+// dial connects a bot to the document and waits for its initial state.
+func dial(ctx context.Context, target string, header http.Header, docID, userID string) (*bot, error) {
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, target, header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("%w (%d)", err, resp.StatusCode)
+		}
+
+		return nil, err
+	}
+
+	b := &bot{
+		docID:   docID,
+		userID:  userID,
+		conn:    conn,
+		out:     make(chan ws.Message, 4),
+		dead:    make(chan struct{}),
+		changed: make(chan struct{}),
+		early:   make(map[int]ot.Operation),
+		rng:     rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())), //nolint:gosec // Edits needn't be unpredictable
+	}
+
+	go b.read()
+	go b.write()
+
+	if err := b.wait(ctx, func() bool { return b.synced }); err != nil {
+		b.close()
+
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// close disconnects the bot.
+func (b *bot) close() {
+	b.mu.Lock()
+	b.fail(errClosed)
+	b.mu.Unlock()
+
+	_ = b.conn.Close()
+}
+
+// fail records why the connection failed, if it's the first failure, and
+// stops the writer. The caller must hold b.mu.
+func (b *bot) fail(err error) {
+	if b.err == nil {
+		b.err = err
+		close(b.dead)
+	}
+
+	b.notify()
+}
+
+// notify wakes everyone waiting for a change. The caller must hold b.mu.
+func (b *bot) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// wait blocks until done reports true, the connection fails or ctx is done.
+// done is called with b.mu held.
+func (b *bot) wait(ctx context.Context, done func() bool) error {
+	for {
+		b.mu.Lock()
+
+		if b.err != nil {
+			err := b.err
+			b.mu.Unlock()
+
+			return err
+		}
+
+		if done() {
+			b.mu.Unlock()
+
+			return nil
+		}
+
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// enqueue hands msg to the writer. The caller must hold b.mu.
+func (b *bot) enqueue(msg ws.Message) {
+	select {
+	case b.out <- msg:
+	case <-b.dead:
+	}
+}
+
+// write sends queued messages until the connection fails.
+func (b *bot) write() {
+	for {
+		select {
+		case msg := <-b.out:
+			if err := b.conn.WriteJSON(msg); err != nil {
+				b.mu.Lock()
+				b.fail(err)
+				b.mu.Unlock()
+
+				// Stops the reader too
+				_ = b.conn.Close()
+
+				return
+			}
+		case <-b.dead:
+			return
+		}
+	}
+}
+
+// read handles server messages until the connection fails.
+func (b *bot) read() {
+	for {
+		var msg envelope
+
+		err := b.conn.ReadJSON(&msg)
+
+		b.mu.Lock()
+
+		if err == nil {
+			err = b.handle(msg)
+		}
+
+		if err != nil {
+			b.fail(err)
+			b.mu.Unlock()
+
+			return
+		}
+
+		b.catchUp()
+		b.notify()
+		b.mu.Unlock()
+	}
+}
+
+// handle records a server message. Broadcasts and acks are applied in
+// revision order by catchUp, as they may arrive out of order. The caller
+// must hold b.mu.
+func (b *bot) handle(msg envelope) error {
+	switch msg.Type {
+	case ws.MessageTypeState:
+		var state ws.StatePayload
+		if err := json.Unmarshal(msg.Payload, &state); err != nil {
+			return fmt.Errorf("decode state: %w", err)
+		}
+
+		b.receiveState(state)
+	case ws.MessageTypeBroadcast:
+		var bc ws.BroadcastPayload
+		if err := json.Unmarshal(msg.Payload, &bc); err != nil {
+			return fmt.Errorf("decode broadcast: %w", err)
+		}
+
+		// Broadcasts up to the revision of the state are already in it
+		if bc.Revision > b.revision {
+			b.early[bc.Revision] = ot.Operation{
+				Type: ot.OpType(bc.OpType), Position: bc.Position, Char: bc.Char, UserID: bc.UserID,
+				Attribute: bc.Attribute, Value: bc.Value,
+			}
+		}
+	case ws.MessageTypeAck:
+		var ack ws.AckPayload
+		if err := json.Unmarshal(msg.Payload, &ack); err != nil {
+			return fmt.Errorf("decode ack: %w", err)
+		}
+
+		b.ackAt = ack.Revision
+	case ws.MessageTypeError:
+		var e ws.ErrorPayload
+		if err := json.Unmarshal(msg.Payload, &e); err != nil {
+			return fmt.Errorf("decode error: %w", err)
+		}
+
+		// Without an edit in flight the error is about the connection itself
+		if len(b.pending) == 0 {
+			return fmt.Errorf("server error: %s (%s)", e.Message, e.Code)
+		}
+
+		// The edit was dropped, so start again from the server's state
+		b.rejected++
+		b.synced = false
+		b.requestState()
+	case ws.MessageTypeOperation, ws.MessageTypeSync:
+		return fmt.Errorf("unexpected %s message", msg.Type)
+	}
+
+	return nil
+}
+
+// receiveState takes the document's state, either to start from or, once
+// synced, to compare against. The caller must hold b.mu.
+func (b *bot) receiveState(state ws.StatePayload) {
+	if b.synced {
+		b.final = &state
+
+		return
+	}
+
+	b.synced = true
+	b.doc = ot.NewDocument(state.Content)
+	b.revision = state.Revision
+	b.pending = nil
+	b.ackAt = 0
+
+	for revision := range b.early {
+		if revision <= b.revision {
+			delete(b.early, revision)
+		}
+	}
+}
+
+// catchUp applies the broadcasts and the ack that follow on from the
+// current revision. The caller must hold b.mu.
+func (b *bot) catchUp() {
+	for b.synced {
+		next := b.revision + 1
+
+		if op, ok := b.early[next]; ok {
+			delete(b.early, next)
+
+			b.revision = next
+			b.applyRemote(op)
+
+			continue
+		}
+
+		if b.ackAt != next {
+			return
+		}
+
+		b.revision = next
+		b.ackAt = 0
+		b.latencies = append(b.latencies, time.Since(b.sentAt))
+		b.pending = b.pending[1:]
+
+		if len(b.pending) > 0 {
+			b.send()
+		}
+	}
+}
+
+// applyRemote applies another client's operation, transforming it and the
+// local edits not acknowledged yet past each other. The caller must hold
+// b.mu.
+func (b *bot) applyRemote(op ot.Operation) {
+	for i := range b.pending {
+		b.pending[i], op = ot.Transform(b.pending[i], op)
+	}
+
+	if err := b.doc.Apply(op); err != nil {
+		b.fail(fmt.Errorf("apply revision %d: %w", b.revision, err))
+	}
+}
+
+// requestState asks the server for the document's state. The caller must
+// hold b.mu.
+func (b *bot) requestState() {
+	b.enqueue(ws.Message{Type: ws.MessageTypeSync, Payload: ws.SyncPayload{DocID: b.docID}})
+}
+
+// send sends the first pending edit, based on the current revision. The
+// caller must hold b.mu.
+func (b *bot) send() {
+	op := b.pending[0]
+	b.sentAt = time.Now()
+
+	b.enqueue(ws.Message{
+		Type: ws.MessageTypeOperation,
+		Payload: ws.OperationPayload{
+			DocID:        b.docID,
+			BaseRevision: b.revision,
+			OpType:       int(op.Type),
+			Position:     op.Position,
+			Char:         op.Char,
+		},
+	})
+}
+
+// typeAt makes an edit every interval until ctx is done or the connection
+// fails. Edits go to random positions, which makes concurrent edits close
+// to each other more likely than real typing does.
+func (b *bot) typeAt(ctx context.Context, interval time.Duration, deleteRatio float64) {
+	// Spread the clients' edits over the interval
+	timer := time.NewTimer(time.Duration(b.rng.Int64N(int64(interval))))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.dead:
+			return
+		case <-timer.C:
+		}
+
+		timer.Reset(interval)
+
+		b.mu.Lock()
+
+		// Edits made while resyncing would be based on a document about to be replaced
+		if b.synced {
+			b.edit(deleteRatio)
+		}
+
+		b.mu.Unlock()
+	}
+}
+
+// edit makes a random edit, applying it locally and sending it unless
+// another is in flight. The caller must hold b.mu.
+func (b *bot) edit(deleteRatio float64) {
+	var op ot.Operation
+
+	length := b.doc.Len()
+	if length > 0 && b.rng.Float64() < deleteRatio {
+		op = ot.NewDelete(b.rng.IntN(length), b.userID)
+	} else {
+		op = ot.NewInsert(string(rune('a'+b.rng.IntN(26))), b.rng.IntN(length+1), b.userID)
+	}
+
+	if err := b.doc.Apply(op); err != nil {
+		b.fail(fmt.Errorf("apply edit: %w", err))
+
+		return
+	}
+
+	b.pending = append(b.pending, op)
+
+	if len(b.pending) == 1 {
+		b.send()
+	}
+}
+
+// idle waits until every edit is acknowledged.
+func (b *bot) idle(ctx context.Context) error {
+	return b.wait(ctx, func() bool { return b.synced && len(b.pending) == 0 })
+}
+
+// check asks for the server's state once every client is idle, and reports
+// whether the bot's document matches it.
+func (b *bot) check(ctx context.Context) (bool, error) {
+	b.mu.Lock()
+	b.final = nil
+	b.requestState()
+	b.mu.Unlock()
+
+	// Broadcasts up to the state's revision may still be on their way
+	err := b.wait(ctx, func() bool { return b.final != nil && b.revision >= b.final.Revision })
+	if err != nil {
+		return false, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.revision == b.final.Revision && b.doc.Content() == b.final.Content, nil
+}
+
+// stats returns the bot's acknowledgement latencies and rejected edits.
+func (b *bot) stats() ([]time.Duration, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.latencies, b.rejected
+}
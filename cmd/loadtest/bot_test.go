@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// syncedBot returns a bot without a connection holding content at revision.
+// What it sends stays queued, as no writer is running.
+func syncedBot(t *testing.T, content string, revision int) *bot {
+	t.Helper()
+
+	b := &bot{
+		docID:   "doc",
+		userID:  "alice",
+		out:     make(chan ws.Message, 4),
+		dead:    make(chan struct{}),
+		changed: make(chan struct{}),
+		early:   make(map[int]ot.Operation),
+	}
+	b.receiveState(ws.StatePayload{DocID: "doc", Content: content, Revision: revision})
+
+	return b
+}
+
+// message returns a server message carrying payload.
+func message(t *testing.T, typ ws.MessageType, payload any) envelope {
+	t.Helper()
+
+	raw, err := json.Marshal(payload)
+	require.NoError(t, err)
+
+	return envelope{Type: typ, Payload: raw}
+}
+
+func TestBot_Handle_Errors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		msg  envelope
+		want string
+	}{
+		{"state", envelope{Type: ws.MessageTypeState, Payload: []byte("[")}, "decode state"},
+		{"broadcast", envelope{Type: ws.MessageTypeBroadcast, Payload: []byte("[")}, "decode broadcast"},
+		{"ack", envelope{Type: ws.MessageTypeAck, Payload: []byte("[")}, "decode ack"},
+		{"error", envelope{Type: ws.MessageTypeError, Payload: []byte("[")}, "decode error"},
+		{
+			"server error",
+			message(t, ws.MessageTypeError, ws.ErrorPayload{Code: ws.ErrorCodeAccessDenied, Message: "denied"}),
+			"server error: denied (access_denied)",
+		},
+		{"operation", envelope{Type: ws.MessageTypeOperation}, "unexpected operation message"},
+		{"sync", envelope{Type: ws.MessageTypeSync}, "unexpected sync message"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			b := syncedBot(t, "ab", 2)
+			require.ErrorContains(t, b.handle(tt.msg), tt.want)
+		})
+	}
+}
+
+func TestBot_Handle_RejectedEdit(t *testing.T) {
+	t.Parallel()
+
+	b := syncedBot(t, "ab", 2)
+	b.rng = rand.New(rand.NewPCG(1, 2)) //nolint:gosec // Edits needn't be unpredictable
+
+	b.edit(0)
+	require.Equal(t, ws.MessageTypeOperation, (<-b.out).Type)
+
+	// The error is about the edit in flight, so the bot resyncs
+	msg := message(t, ws.MessageTypeError, ws.ErrorPayload{Code: ws.ErrorCodeRateLimited, Message: "slow down"})
+	require.NoError(t, b.handle(msg))
+	require.Equal(t, ws.Message{Type: ws.MessageTypeSync, Payload: ws.SyncPayload{DocID: "doc"}}, <-b.out)
+
+	_, rejected := b.stats()
+	require.Equal(t, 1, rejected)
+
+	// The new state drops the edit, along with broadcasts it already holds
+	require.NoError(t, b.handle(message(t, ws.MessageTypeBroadcast, ws.BroadcastPayload{Revision: 3})))
+	require.NoError(t, b.handle(message(t, ws.MessageTypeState, ws.StatePayload{Content: "ab", Revision: 3})))
+	require.Empty(t, b.pending)
+	require.Empty(t, b.early)
+}
+
+func TestBot_ApplyRemote_Fails(t *testing.T) {
+	t.Parallel()
+
+	b := syncedBot(t, "ab", 2)
+
+	b.mu.Lock()
+	require.NoError(t, b.handle(message(t, ws.MessageTypeBroadcast, ws.BroadcastPayload{
+		Revision: 3, OpType: int(ot.Delete), Position: 5, UserID: "bob",
+	})))
+	b.catchUp()
+	b.mu.Unlock()
+
+	require.ErrorContains(t, b.wait(t.Context(), func() bool { return false }), "apply revision 3")
+}
+
+func TestDial_Errors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("refused", func(t *testing.T) {
+		t.Parallel()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+		}))
+		t.Cleanup(server.Close)
+
+		_, err := dial(t.Context(), "ws"+strings.TrimPrefix(server.URL, "http"), nil, "doc", "alice")
+		require.ErrorContains(t, err, "(403)")
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		t.Parallel()
+
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+
+		_, err := dial(t.Context(), "ws"+strings.TrimPrefix(server.URL, "http"), nil, "doc", "alice")
+		require.Error(t, err)
+	})
+
+	t.Run("closed before the state", func(t *testing.T) {
+		t.Parallel()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+
+			_ = conn.Close()
+		}))
+		t.Cleanup(server.Close)
+
+		_, err := dial(t.Context(), "ws"+strings.TrimPrefix(server.URL, "http"), nil, "doc", "alice")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,298 @@
+// Command loadtest simulates users typing into one document on an
+// online-docs server, to size deployments and catch regressions. Each
+// simulated client connects to the WebSocket API and edits at a steady rate,
+// keeping one edit in flight like a real editor. loadtest reports how long
+// edits took to be acknowledged and, once typing stops, checks that every
+// client ended up with the server's content.
+//
+// Usage:
+//
+//	loadtest [flags]
+//
+// Without -doc, loadtest creates a document for the run and deletes it
+// afterwards. It exits with status 1 if the run fails or any client diverged
+// from the server.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const defaultServer = "http://localhost:8080"
+
+// Exit codes.
+const (
+	exitOK    = 0
+	exitError = 1 // The run failed or clients diverged
+	exitUsage = 2 // The command line was invalid
+)
+
+// options configure a run.
+type options struct {
+	server      string
+	docID       string
+	user        string // Prefix of the clients' user IDs
+	apiKey      string
+	token       string
+	clients     int
+	rate        float64 // Edits per second, per client
+	duration    time.Duration
+	deleteRatio float64
+	settle      time.Duration // How long clients may take to catch up once typing stops
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Getenv, os.Stdout, os.Stderr))
+}
+
+// run executes the command line and returns the process exit code.
+func run(ctx context.Context, args []string, getenv func(string) string, stdout, stderr io.Writer) int {
+	var opts options
+
+	fs := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	fs.StringVar(&opts.server, "server", envOr(getenv, "LOADTEST_SERVER", defaultServer), "server base URL")
+	fs.StringVar(&opts.docID, "doc", "", "existing document to edit, instead of a new one")
+	fs.StringVar(&opts.user, "user", "loadtest", "prefix of the clients' user IDs, for servers without login")
+	fs.StringVar(&opts.apiKey, "api-key", getenv("LOADTEST_API_KEY"), "service account API key every client uses")
+	fs.StringVar(&opts.token, "token", getenv("LOADTEST_TOKEN"), "access token every client uses")
+	fs.IntVar(&opts.clients, "clients", 10, "number of simulated clients")
+	fs.Float64Var(&opts.rate, "rate", 5, "edits per second, per client")
+	fs.DurationVar(&opts.duration, "duration", 30*time.Second, "how long the clients type")
+	fs.Float64Var(&opts.deleteRatio, "delete-ratio", 0.2, "fraction of edits that delete a character")
+	fs.DurationVar(&opts.settle, "settle", 10*time.Second, "how long clients may take to catch up after typing")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+
+		return exitUsage
+	}
+
+	if err := opts.validate(fs.NArg()); err != nil {
+		fmt.Fprintf(stderr, "loadtest: %v\n", err)
+		fs.Usage()
+
+		return exitUsage
+	}
+
+	r, err := loadTest(ctx, opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "loadtest: %v\n", err)
+
+		return exitError
+	}
+
+	r.print(stdout)
+
+	if r.diverged > 0 || r.failed > 0 {
+		fmt.Fprintf(stderr, "loadtest: %d of %d clients failed and %d diverged from the server\n",
+			r.failed, r.clients, r.diverged)
+
+		return exitError
+	}
+
+	return exitOK
+}
+
+// validate checks the options, given the number of positional arguments.
+func (o options) validate(nargs int) error {
+	switch {
+	case nargs > 0:
+		return errors.New("unexpected arguments")
+	case o.clients < 1:
+		return errors.New("-clients must be at least 1")
+	case o.rate <= 0:
+		return errors.New("-rate must be positive")
+	case o.duration <= 0:
+		return errors.New("-duration must be positive")
+	case o.deleteRatio < 0 || o.deleteRatio > 1:
+		return errors.New("-delete-ratio must be between 0 and 1")
+	case o.settle <= 0:
+		return errors.New("-settle must be positive")
+	}
+
+	return nil
+}
+
+// envOr returns the environment variable, or fallback when it's unset.
+func envOr(getenv func(string) string, key, fallback string) string {
+	if v := getenv(key); v != "" {
+		return v
+	}
+
+	return fallback
+}
+
+// loadTest runs the clients against the server and reports the results.
+func loadTest(ctx context.Context, opts options) (*report, error) {
+	api := &apiClient{baseURL: opts.server, apiKey: opts.apiKey, token: opts.token, http: &http.Client{}}
+
+	users := make([]string, opts.clients)
+	for i := range users {
+		users[i] = opts.user + "-" + strconv.Itoa(i+1)
+	}
+
+	docID := opts.docID
+	if docID == "" {
+		var err error
+
+		if docID, err = api.createDocument(ctx, users); err != nil {
+			return nil, fmt.Errorf("create document: %w", err)
+		}
+
+		defer func() { _ = api.deleteDocument(context.WithoutCancel(ctx), docID, users[0]) }()
+	}
+
+	target, err := websocketURL(opts.server, docID)
+	if err != nil {
+		return nil, err
+	}
+
+	bots := make([]*bot, 0, opts.clients)
+
+	defer func() {
+		for _, b := range bots {
+			b.close()
+		}
+	}()
+
+	for _, user := range users {
+		b, err := dial(ctx, target, api.header(user), docID, user)
+		if err != nil {
+			return nil, fmt.Errorf("connect %s: %w", user, err)
+		}
+
+		bots = append(bots, b)
+	}
+
+	typing, cancel := context.WithTimeout(ctx, opts.duration)
+	defer cancel()
+
+	var wg sync.WaitGroup
+
+	interval := time.Duration(float64(time.Second) / opts.rate)
+	start := time.Now()
+
+	for _, b := range bots {
+		wg.Go(func() { b.typeAt(typing, interval, opts.deleteRatio) })
+	}
+
+	wg.Wait()
+
+	r := &report{clients: opts.clients, elapsed: time.Since(start)}
+
+	settle, cancel := context.WithTimeout(ctx, opts.settle)
+	defer cancel()
+
+	// Clients that can't catch up count as failed rather than diverged
+	ok := make([]bool, len(bots))
+	for i, b := range bots {
+		ok[i] = b.idle(settle) == nil
+	}
+
+	for i, b := range bots {
+		if ok[i] {
+			converged, err := b.check(settle)
+
+			switch {
+			case err != nil:
+				ok[i] = false
+			case !converged:
+				r.diverged++
+			}
+		}
+
+		latencies, rejected := b.stats()
+		r.latencies = append(r.latencies, latencies...)
+		r.rejected += rejected
+
+		if !ok[i] {
+			r.failed++
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	slices.Sort(r.latencies)
+
+	return r, nil
+}
+
+// websocketURL returns the WebSocket endpoint for a document on the server.
+func websocketURL(server, docID string) (string, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", fmt.Errorf("invalid server URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("invalid server URL %q", server)
+	}
+
+	u = u.JoinPath("v1", "ws")
+	u.RawQuery = url.Values{"docId": {docID}}.Encode()
+
+	return u.String(), nil
+}
+
+// report summarizes a run.
+type report struct {
+	clients  int
+	failed   int // Clients disconnected, or that couldn't catch up in time
+	diverged int // Clients whose document didn't match the server's
+	elapsed  time.Duration
+
+	latencies []time.Duration // Acknowledgement latencies, sorted
+	rejected  int             // Edits the server answered with an error
+}
+
+// print writes the report.
+func (r *report) print(out io.Writer) {
+	acked := len(r.latencies)
+
+	fmt.Fprintf(out, "clients:     %d (%d failed, %d diverged)\n", r.clients, r.failed, r.diverged)
+	fmt.Fprintf(out, "edits:       %d acknowledged (%.1f/s), %d rejected\n",
+		acked, float64(acked)/r.elapsed.Seconds(), r.rejected)
+
+	if acked == 0 {
+		return
+	}
+
+	fmt.Fprintf(out, "ack latency: p50 %v, p90 %v, p99 %v, max %v\n",
+		percentile(r.latencies, 50), percentile(r.latencies, 90), percentile(r.latencies, 99), percentile(r.latencies, 100))
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies,
+// rounded for printing.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+
+	return sorted[max(rank, 1)-1].Round(time.Microsecond)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer starts a server and returns it with its document store.
+func newTestServer(t *testing.T) (*httptest.Server, *storage.MemoryStore) {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	permStore := acl.NewMemoryStore()
+	hub := ws.NewHub()
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore, Hub: hub})
+
+	server := httptest.NewServer(handler.NewServer(handler.ServerConfig{
+		Manager:   manager,
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+	}).Handler())
+	t.Cleanup(server.Close)
+
+	return server, store
+}
+
+// loadtest runs a command line against the server and returns its exit code
+// and output.
+func loadtest(t *testing.T, server *httptest.Server, args ...string) (int, string, string) {
+	t.Helper()
+
+	env := map[string]string{"LOADTEST_SERVER": server.URL}
+
+	var stdout, stderr bytes.Buffer
+	code := run(t.Context(), args, func(key string) string { return env[key] }, &stdout, &stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+func TestLoadtest(t *testing.T) {
+	t.Parallel()
+
+	server, store := newTestServer(t)
+
+	code, out, errOut := loadtest(t, server,
+		"-clients", "5", "-rate", "200", "-duration", "300ms", "-delete-ratio", "0.4")
+	require.Equal(t, exitOK, code, errOut)
+	require.Contains(t, out, "clients:     5 (0 failed, 0 diverged)\n")
+	require.Contains(t, out, "ack latency: p50 ")
+
+	// The document created for the run is gone
+	ids, err := store.ListDocuments(t.Context())
+	require.NoError(t, err)
+	require.Empty(t, ids)
+}
+
+func TestLoadtest_MissingDocument(t *testing.T) {
+	t.Parallel()
+
+	server, _ := newTestServer(t)
+
+	code, _, errOut := loadtest(t, server, "-doc", "missing", "-duration", "10ms")
+	require.Equal(t, exitError, code)
+	require.Equal(t, "loadtest: connect loadtest-1: server error: document not found (invalid_message)\n", errOut)
+}
+
+func TestLoadtest_Usage(t *testing.T) {
+	t.Parallel()
+
+	server, _ := newTestServer(t)
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"positional argument", []string{"doc"}},
+		{"no clients", []string{"-clients", "0"}},
+		{"zero rate", []string{"-rate", "0"}},
+		{"negative duration", []string{"-duration", "-1s"}},
+		{"delete ratio above 1", []string{"-delete-ratio", "1.5"}},
+		{"zero settle", []string{"-settle", "0"}},
+		{"unknown flag", []string{"-bogus"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			code, _, _ := loadtest(t, server, tt.args...)
+			require.Equal(t, exitUsage, code)
+		})
+	}
+}
+
+func TestLoadtest_Help(t *testing.T) {
+	t.Parallel()
+
+	server, _ := newTestServer(t)
+
+	code, _, errOut := loadtest(t, server, "-help")
+	require.Equal(t, exitOK, code)
+	require.Contains(t, errOut, "-clients")
+}
+
+func TestLoadtest_Unreachable(t *testing.T) {
+	t.Parallel()
+
+	server, _ := newTestServer(t)
+	server.Close()
+
+	code, _, errOut := loadtest(t, server, "-duration", "10ms")
+	require.Equal(t, exitError, code)
+	require.Contains(t, errOut, "loadtest: create document: ")
+
+	code, _, errOut = loadtest(t, server, "-doc", "doc1", "-server", "ftp://example.com", "-duration", "10ms")
+	require.Equal(t, exitError, code)
+	require.Equal(t, "loadtest: invalid server URL \"ftp://example.com\"\n", errOut)
+}
+
+func TestWebsocketURL(t *testing.T) {
+	t.Parallel()
+
+	target, err := websocketURL("https://docs.example.com/base", "a b")
+	require.NoError(t, err)
+	require.Equal(t, "wss://docs.example.com/base/v1/ws?docId=a+b", target)
+
+	_, err = websocketURL("http://[::1", "doc")
+	require.ErrorContains(t, err, "invalid server URL")
+}
+
+func TestReport_Print_NoEdits(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+
+	(&report{clients: 2, failed: 2, elapsed: time.Second}).print(&out)
+	require.Equal(t, "clients:     2 (2 failed, 0 diverged)\n"+
+		"edits:       0 acknowledged (0.0/s), 0 rejected\n", out.String())
+}
+
+func TestPercentile(t *testing.T) {
+	t.Parallel()
+
+	latencies := make([]time.Duration, 100)
+	for i := range latencies {
+		latencies[i] = time.Duration(i+1) * time.Millisecond
+	}
+
+	require.Equal(t, time.Millisecond, percentile(latencies, 0))
+	require.Equal(t, 50*time.Millisecond, percentile(latencies, 50))
+	require.Equal(t, 99*time.Millisecond, percentile(latencies, 99))
+	require.Equal(t, 100*time.Millisecond, percentile(latencies, 100))
+}
@@ -0,0 +1,96 @@
+// Command replay replays a session recorded by a server started with
+// -record-dir through a fresh session in memory, and reports the operations
+// and final state that come out differently from the recording. A
+// divergence reported by clients either reproduces, pointing at the server,
+// or doesn't, pointing at the clients.
+//
+// Usage:
+//
+//	replay [-speed N] [-v] RECORDING
+//
+// By default operations are replayed as fast as possible; -speed 1 replays
+// them as far apart as they were recorded, -speed 2 twice as fast.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/serroba/online-docs/internal/collab/recording"
+)
+
+// Exit codes.
+const (
+	exitOK       = 0
+	exitError    = 1 // The recording couldn't be replayed
+	exitUsage    = 2 // The command line was invalid
+	exitDiverged = 3 // The replay came out differently from the recording
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command line and returns the process exit code.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	speed := fs.Float64("speed", 0, "replay speed relative to the recording (0 replays as fast as possible)")
+	verbose := fs.Bool("v", false, "print the final content")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+
+		return exitUsage
+	}
+
+	if fs.NArg() != 1 || *speed < 0 {
+		fmt.Fprintln(stderr, "replay: expected a recording, and a speed that isn't negative")
+		fs.Usage()
+
+		return exitUsage
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "replay: %v\n", err)
+
+		return exitError
+	}
+	defer func() { _ = f.Close() }()
+
+	result, err := recording.Replay(ctx, f, recording.ReplayConfig{Speed: *speed})
+	if err != nil {
+		fmt.Fprintf(stderr, "replay: %v\n", err)
+
+		return exitError
+	}
+
+	for _, d := range result.Divergences {
+		fmt.Fprintf(stdout, "line %d diverged:\n  recorded: %s\n  replayed: %s\n", d.Line, d.Recorded, d.Replayed)
+	}
+
+	fmt.Fprintf(stdout, "%s: replayed %d operations to revision %d, %d divergences\n",
+		result.DocID, result.Operations, result.Revision, len(result.Divergences))
+
+	if *verbose {
+		fmt.Fprintln(stdout, result.Content)
+	}
+
+	if len(result.Divergences) > 0 {
+		return exitDiverged
+	}
+
+	return exitOK
+}
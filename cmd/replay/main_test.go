@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/collab/recording"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/stretchr/testify/require"
+)
+
+// writeRecording writes a recording of alice typing "hi" into an empty
+// document, with the final state the session closed with.
+func writeRecording(t *testing.T, closed string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "doc1.jsonl")
+
+	f, err := os.Create(path)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = f.Close() })
+
+	recorder := recording.NewRecorder(f)
+	recorder.RecordLoad(collab.RecordedState{DocID: "doc1", HistorySize: 100})
+
+	for i, char := range "hi" {
+		op := ot.NewInsert(string(char), i, "alice")
+		recorder.RecordOperation("c1", "alice", op, i, ot.SequencedOperation{Operation: op, Revision: i + 1}, nil)
+	}
+
+	recorder.RecordClose(closed, 2)
+
+	return path
+}
+
+// replay runs a command line and returns its exit code and output.
+func replay(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	code := run(t.Context(), args, &stdout, &stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+func TestReplay(t *testing.T) {
+	t.Parallel()
+
+	code, out, errOut := replay(t, "-v", writeRecording(t, "hi"))
+	require.Equal(t, exitOK, code, errOut)
+	require.Equal(t, "doc1: replayed 2 operations to revision 2, 0 divergences\nhi\n", out)
+}
+
+func TestReplay_Diverged(t *testing.T) {
+	t.Parallel()
+
+	code, out, errOut := replay(t, writeRecording(t, "ih"))
+	require.Equal(t, exitDiverged, code, errOut)
+	require.Equal(t, `line 4 diverged:
+  recorded: revision 2 with content "ih"
+  replayed: revision 2 with content "hi"
+doc1: replayed 2 operations to revision 2, 1 divergences
+`, out)
+}
+
+func TestReplay_Usage(t *testing.T) {
+	t.Parallel()
+
+	code, _, _ := replay(t)
+	require.Equal(t, exitUsage, code)
+
+	code, _, _ = replay(t, "-speed", "-1", "doc1.jsonl")
+	require.Equal(t, exitUsage, code)
+
+	code, _, errOut := replay(t, filepath.Join(t.TempDir(), "missing.jsonl"))
+	require.Equal(t, exitError, code)
+	require.True(t, strings.HasPrefix(errOut, "replay: open "), errOut)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/serroba/online-docs/internal/apitypes"
+)
+
+// errHistoryGone reports edits the server no longer keeps individually,
+// having folded them into a snapshot.
+var errHistoryGone = errors.New("history no longer available")
+
+// apiClient authenticates the editor and fetches the edits it missed while
+// offline through the server's REST API.
+type apiClient struct {
+	baseURL string
+	user    string
+	apiKey  string
+	token   string
+	http    *http.Client
+}
+
+// header returns the headers authenticating the editor.
+func (c *apiClient) header() http.Header {
+	header := http.Header{}
+
+	switch {
+	case c.apiKey != "":
+		header.Set("X-Api-Key", c.apiKey)
+	case c.token != "":
+		header.Set("Authorization", "Bearer "+c.token)
+	default:
+		header.Set("X-User-Id", c.user)
+	}
+
+	return header
+}
+
+// changes returns the document's edits after revision since, without waiting
+// for new ones.
+func (c *apiClient) changes(ctx context.Context, docID string, since int) (*apitypes.ChangesResponse, error) {
+	path := "/v1/documents/" + url.PathEscape(docID) + "/changes?timeout=0s&since=" + strconv.Itoa(since)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.baseURL, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header = c.header()
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusGone:
+		return nil, errHistoryGone
+	case resp.StatusCode != http.StatusOK:
+		var errResp apitypes.ErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil && errResp.Message != "" {
+			return nil, fmt.Errorf("%s (%d)", errResp.Message, resp.StatusCode)
+		}
+
+		return nil, fmt.Errorf("server returned %d", resp.StatusCode)
+	}
+
+	var changes apitypes.ChangesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&changes); err != nil {
+		return nil, fmt.Errorf("decode changes: %w", err)
+	}
+
+	return &changes, nil
+}
@@ -0,0 +1,670 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/ws"
+)
+
+// maxRetry caps the delay between reconnection attempts.
+const maxRetry = 30 * time.Second
+
+// envelope is a server message with its payload left to decode by type.
+type envelope struct {
+	Type    ws.MessageType  `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// serverError is an error the server sent with no edit in flight, as when
+// the document doesn't exist or the user may not open it. Reconnecting
+// doesn't help.
+type serverError struct {
+	ws.ErrorPayload
+}
+
+func (e *serverError) Error() string {
+	return fmt.Sprintf("server error: %s (%s)", e.Message, e.Code)
+}
+
+// connection is one WebSocket connection to the server. Its writer sends
+// queued messages until the connection is closed.
+type connection struct {
+	conn *websocket.Conn
+	out  chan ws.Message
+	dead chan struct{} // Closed by close
+	once sync.Once
+}
+
+func newConnection(conn *websocket.Conn) *connection {
+	c := &connection{conn: conn, out: make(chan ws.Message, 4), dead: make(chan struct{})}
+
+	go c.write()
+
+	return c
+}
+
+// send queues msg for the writer, dropping it once the connection is closed.
+func (c *connection) send(msg ws.Message) {
+	select {
+	case c.out <- msg:
+	case <-c.dead:
+	}
+}
+
+// close closes the connection, which also stops a blocked read.
+func (c *connection) close() {
+	c.once.Do(func() {
+		close(c.dead)
+		_ = c.conn.Close()
+	})
+}
+
+func (c *connection) write() {
+	for {
+		select {
+		case msg := <-c.out:
+			if err := c.conn.WriteJSON(msg); err != nil {
+				c.close()
+
+				return
+			}
+		case <-c.dead:
+			return
+		}
+	}
+}
+
+// editor edits one document. Like the web editor it applies edits locally
+// straight away, keeps one in flight and queues the rest, and transforms the
+// server's broadcasts against them. While the connection is down edits keep
+// queueing; once it's back they're rebased onto the edits made meanwhile,
+// fetched from the REST API, and sent.
+type editor struct {
+	docID  string
+	target string // WebSocket URL
+	api    *apiClient
+	retry  time.Duration // First reconnection delay, doubled up to maxRetry
+
+	mu       sync.Mutex
+	changed  chan struct{} // Closed and replaced whenever the state below changes
+	err      error         // Why the editor stopped
+	conn     *connection   // nil while offline or rebasing
+	synced   bool          // doc holds the server's state; false until the first state, and while resyncing
+	doc      *ot.Document
+	revision int                  // Last server revision applied to doc
+	pending  []ot.Operation       // Local edits not acknowledged yet
+	inFlight bool                 // The first pending edit was sent
+	early    map[int]ot.Operation // Broadcasts received ahead of revision
+	ackAt    int                  // Revision of an ack received ahead of revision, or 0
+	cursors  map[string]int       // Where other users last edited, kept in step with doc
+	notice   string               // Something to tell the user, like why the editor is offline
+}
+
+func newEditor(docID, target string, api *apiClient, retry time.Duration) *editor {
+	return &editor{
+		docID:   docID,
+		target:  target,
+		api:     api,
+		retry:   retry,
+		changed: make(chan struct{}),
+		early:   make(map[int]ot.Operation),
+		cursors: make(map[string]int),
+	}
+}
+
+// view is what the screen shows of an editor.
+type view struct {
+	docID    string
+	content  string
+	revision int
+	online   bool
+	queued   int // Edits not acknowledged yet
+	cursors  map[string]int
+	notice   string
+}
+
+// view returns a copy of the editor's state to draw.
+func (e *editor) view() view {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	v := view{
+		docID:    e.docID,
+		revision: e.revision,
+		online:   e.conn != nil,
+		queued:   len(e.pending),
+		cursors:  make(map[string]int, len(e.cursors)),
+		notice:   e.notice,
+	}
+
+	if e.doc != nil {
+		v.content = e.doc.Content()
+	}
+
+	for user, position := range e.cursors {
+		v.cursors[user] = position
+	}
+
+	return v
+}
+
+// changes returns a channel closed on the editor's next change.
+func (e *editor) changes() <-chan struct{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.changed
+}
+
+// notify wakes everyone waiting for a change. The caller must hold e.mu.
+func (e *editor) notify() {
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+// wait blocks until done reports true, the editor stops or ctx is done.
+// done is called with e.mu held.
+func (e *editor) wait(ctx context.Context, done func() bool) error {
+	for {
+		e.mu.Lock()
+
+		if e.err != nil {
+			err := e.err
+			e.mu.Unlock()
+
+			return err
+		}
+
+		if done() {
+			e.mu.Unlock()
+
+			return nil
+		}
+
+		changed := e.changed
+		e.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ready waits for the document's first state.
+func (e *editor) ready(ctx context.Context) error {
+	return e.wait(ctx, func() bool { return e.doc != nil })
+}
+
+// saved waits until the server has acknowledged every edit.
+func (e *editor) saved(ctx context.Context) error {
+	return e.wait(ctx, func() bool { return e.synced && len(e.pending) == 0 })
+}
+
+// unsaved returns the number of edits the server hasn't acknowledged.
+func (e *editor) unsaved() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return len(e.pending)
+}
+
+// run keeps the editor connected until ctx is done, reconnecting with a
+// growing delay. It returns early if the server refuses the document, or if
+// the first connection fails.
+func (e *editor) run(ctx context.Context) error {
+	delay := e.retry
+
+	for {
+		online, err := e.connect(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		e.mu.Lock()
+		first := e.doc == nil
+
+		var refused *serverError
+		if first || errors.As(err, &refused) {
+			e.err = err
+			e.notify()
+			e.mu.Unlock()
+
+			return err
+		}
+
+		if online {
+			delay = e.retry
+		}
+
+		e.notice = fmt.Sprintf("offline, reconnecting in %v: %v", delay, err)
+		e.notify()
+		e.mu.Unlock()
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil
+		}
+
+		delay = min(2*delay, maxRetry)
+	}
+}
+
+// connect connects to the document, rebases the edits made while offline
+// and then handles server messages until the connection fails. It reports
+// whether the editor got back online.
+func (e *editor) connect(ctx context.Context) (bool, error) {
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, e.target, e.api.header())
+	if err != nil {
+		if resp != nil {
+			return false, fmt.Errorf("%w (%d)", err, resp.StatusCode)
+		}
+
+		return false, err
+	}
+
+	c := newConnection(conn)
+	defer c.close()
+
+	// Stops the reads below once ctx is done
+	stop := context.AfterFunc(ctx, c.close)
+	defer stop()
+
+	var msg envelope
+	if err := conn.ReadJSON(&msg); err != nil {
+		return false, err
+	}
+
+	if msg.Type != ws.MessageTypeState {
+		return false, decodeError(msg)
+	}
+
+	var state ws.StatePayload
+	if err := json.Unmarshal(msg.Payload, &state); err != nil {
+		return false, fmt.Errorf("decode state: %w", err)
+	}
+
+	if err := e.rebase(ctx, state); err != nil {
+		return false, err
+	}
+
+	e.mu.Lock()
+	e.conn = c
+	e.notice = ""
+
+	if len(e.pending) > 0 {
+		e.send()
+	}
+
+	e.notify()
+	e.mu.Unlock()
+
+	defer func() {
+		e.mu.Lock()
+		e.conn = nil
+		e.notify()
+		e.mu.Unlock()
+	}()
+
+	return true, e.read(conn)
+}
+
+// rebase catches up with the server's state. On the first connection the
+// editor simply takes it; after a reconnection it applies the edits it
+// missed, transforming the queued edits past them. The edit that was in
+// flight when the connection dropped counts as acknowledged if the server
+// applied it.
+func (e *editor) rebase(ctx context.Context, state ws.StatePayload) error {
+	e.mu.Lock()
+
+	if e.doc == nil {
+		e.receiveState(state)
+		e.mu.Unlock()
+
+		return nil
+	}
+
+	// What was received ahead of the old connection is fetched again
+	clear(e.early)
+	e.ackAt = 0
+	since := e.revision
+	e.mu.Unlock()
+
+	for since < state.Revision {
+		changes, err := e.api.changes(ctx, e.docID, since)
+		if errors.Is(err, errHistoryGone) {
+			e.mu.Lock()
+			lost := len(e.pending)
+			e.receiveState(state)
+			e.notice = fmt.Sprintf("%d edits made offline were lost: the server no longer has the edits since", lost)
+			e.notify()
+			e.mu.Unlock()
+
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("fetch missed edits: %w", err)
+		}
+
+		if len(changes.Operations) == 0 {
+			return fmt.Errorf("server has no edits after revision %d", since)
+		}
+
+		e.mu.Lock()
+
+		for _, op := range changes.Operations {
+			if op.Revision == e.revision+1 {
+				err = e.applyMissed(op)
+			}
+
+			if err != nil {
+				break
+			}
+		}
+
+		since = e.revision
+		e.notify()
+		e.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	e.inFlight = false
+	e.mu.Unlock()
+
+	return nil
+}
+
+// applyMissed applies an edit made while the editor was offline. The
+// caller must hold e.mu.
+func (e *editor) applyMissed(op apitypes.Operation) error {
+	operation := ot.Operation{Position: op.Position, Char: op.Char, UserID: op.UserID}
+	if op.Type == "delete" {
+		operation.Type = ot.Delete
+	}
+
+	e.revision = op.Revision
+
+	// The server transformed the edit in flight past the same edits, so it
+	// arrives unchanged
+	if e.inFlight && operation == e.pending[0] {
+		e.inFlight = false
+		e.pending = e.pending[1:]
+
+		return nil
+	}
+
+	return e.applyRemote(operation)
+}
+
+// read handles server messages until the connection fails.
+func (e *editor) read(conn *websocket.Conn) error {
+	for {
+		var msg envelope
+		if err := conn.ReadJSON(&msg); err != nil {
+			return err
+		}
+
+		e.mu.Lock()
+
+		err := e.handle(msg)
+		if err == nil {
+			err = e.catchUp()
+		}
+
+		e.notify()
+		e.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handle records a server message. Broadcasts and acks are applied in
+// revision order by catchUp, as they may arrive out of order. The caller
+// must hold e.mu.
+func (e *editor) handle(msg envelope) error {
+	switch msg.Type {
+	case ws.MessageTypeState:
+		var state ws.StatePayload
+		if err := json.Unmarshal(msg.Payload, &state); err != nil {
+			return fmt.Errorf("decode state: %w", err)
+		}
+
+		e.receiveState(state)
+	case ws.MessageTypeBroadcast:
+		var bc ws.BroadcastPayload
+		if err := json.Unmarshal(msg.Payload, &bc); err != nil {
+			return fmt.Errorf("decode broadcast: %w", err)
+		}
+
+		// Broadcasts up to the revision of the state are already in it
+		if bc.Revision > e.revision {
+			e.early[bc.Revision] = ot.Operation{
+				Type: ot.OpType(bc.OpType), Position: bc.Position, Char: bc.Char, UserID: bc.UserID,
+				Attribute: bc.Attribute, Value: bc.Value,
+			}
+		}
+	case ws.MessageTypeAck:
+		var ack ws.AckPayload
+		if err := json.Unmarshal(msg.Payload, &ack); err != nil {
+			return fmt.Errorf("decode ack: %w", err)
+		}
+
+		e.ackAt = ack.Revision
+	case ws.MessageTypeError:
+		err := decodeError(msg)
+
+		// Without an edit in flight the error is about the connection itself
+		if !e.inFlight {
+			return err
+		}
+
+		// The edit was dropped, so start again from the server's state
+		e.notice = fmt.Sprintf("%d edits were rejected: %v", len(e.pending), err)
+		e.synced = false
+		e.conn.send(ws.Message{Type: ws.MessageTypeSync, Payload: ws.SyncPayload{DocID: e.docID}})
+	case ws.MessageTypeClosing:
+		var closing ws.ClosingPayload
+		if err := json.Unmarshal(msg.Payload, &closing); err != nil {
+			return fmt.Errorf("decode closing: %w", err)
+		}
+
+		// Reconnect, resending the pending edits, once the server is back
+		return fmt.Errorf("server closing: %s", closing.Reason)
+	case ws.MessageTypeOperation, ws.MessageTypeSync:
+		return fmt.Errorf("unexpected %s message", msg.Type)
+	}
+
+	return nil
+}
+
+// decodeError returns the server error msg carries.
+func decodeError(msg envelope) error {
+	if msg.Type != ws.MessageTypeError {
+		return fmt.Errorf("unexpected %s message", msg.Type)
+	}
+
+	var refused serverError
+	if err := json.Unmarshal(msg.Payload, &refused.ErrorPayload); err != nil {
+		return fmt.Errorf("decode error: %w", err)
+	}
+
+	return &refused
+}
+
+// receiveState starts again from the server's state, dropping the edits
+// not acknowledged yet. The caller must hold e.mu.
+func (e *editor) receiveState(state ws.StatePayload) {
+	e.synced = true
+	e.doc = ot.NewDocument(state.Content)
+	e.revision = state.Revision
+	e.pending = nil
+	e.inFlight = false
+	e.ackAt = 0
+
+	// Positions in the old content mean nothing in the new one
+	clear(e.cursors)
+
+	for revision := range e.early {
+		if revision <= e.revision {
+			delete(e.early, revision)
+		}
+	}
+}
+
+// catchUp applies the broadcasts and the ack that follow on from the
+// current revision. The caller must hold e.mu.
+func (e *editor) catchUp() error {
+	for e.synced {
+		next := e.revision + 1
+
+		if op, ok := e.early[next]; ok {
+			delete(e.early, next)
+
+			e.revision = next
+			if err := e.applyRemote(op); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if e.ackAt != next || !e.inFlight {
+			return nil
+		}
+
+		e.revision = next
+		e.ackAt = 0
+		e.inFlight = false
+		e.pending = e.pending[1:]
+
+		if len(e.pending) > 0 {
+			e.send()
+		}
+	}
+
+	return nil
+}
+
+// applyRemote applies another client's edit, transforming it and the local
+// edits not acknowledged yet past each other. The caller must hold e.mu.
+func (e *editor) applyRemote(op ot.Operation) error {
+	for i := range e.pending {
+		e.pending[i], op = ot.Transform(e.pending[i], op)
+	}
+
+	if err := e.doc.Apply(op); err != nil {
+		return fmt.Errorf("apply revision %d: %w", e.revision, err)
+	}
+
+	e.moveCursors(op)
+
+	if !op.IsNoop() {
+		e.cursors[op.UserID] = op.Position
+		if op.IsInsert() {
+			e.cursors[op.UserID]++
+		}
+	}
+
+	return nil
+}
+
+// moveCursors keeps the other users' cursors on the same characters after
+// an edit. The caller must hold e.mu.
+func (e *editor) moveCursors(op ot.Operation) {
+	if op.IsNoop() {
+		return
+	}
+
+	for user, position := range e.cursors {
+		switch {
+		case op.IsInsert() && position >= op.Position:
+			e.cursors[user]++
+		case op.IsDelete() && position > op.Position:
+			e.cursors[user]--
+		}
+	}
+}
+
+// send sends the first pending edit, based on the current revision, unless
+// the editor is offline. The caller must hold e.mu.
+func (e *editor) send() {
+	if e.conn == nil {
+		return
+	}
+
+	op := e.pending[0]
+	e.inFlight = true
+
+	e.conn.send(ws.Message{
+		Type: ws.MessageTypeOperation,
+		Payload: ws.OperationPayload{
+			DocID:        e.docID,
+			BaseRevision: e.revision,
+			OpType:       int(op.Type),
+			Position:     op.Position,
+			Char:         op.Char,
+		},
+	})
+}
+
+// edit applies local edits and queues them for the server.
+func (e *editor) edit(ops ...ot.Operation) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Edits made while resyncing would be based on a document about to be replaced
+	if !e.synced {
+		return errors.New("resyncing with the server, try again")
+	}
+
+	for _, op := range ops {
+		if err := e.doc.Apply(op); err != nil {
+			return err
+		}
+
+		e.moveCursors(op)
+		e.pending = append(e.pending, op)
+
+		if len(e.pending) == 1 {
+			e.send()
+		}
+	}
+
+	e.notify()
+
+	return nil
+}
+
+// length returns the number of characters in the document.
+func (e *editor) length() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.doc.Len()
+}
+
+// tell shows the user a notice.
+func (e *editor) tell(notice string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.notice = notice
+	e.notify()
+}
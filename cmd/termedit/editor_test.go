@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// syncedEditor returns an offline editor holding content at revision.
+func syncedEditor(t *testing.T, content string, revision int) *editor {
+	t.Helper()
+
+	e := newEditor("doc", "", &apiClient{user: "alice", http: &http.Client{}}, time.Second)
+	e.receiveState(ws.StatePayload{DocID: "doc", Content: content, Revision: revision})
+
+	return e
+}
+
+// message returns a server message carrying payload.
+func message(t *testing.T, typ ws.MessageType, payload any) envelope {
+	t.Helper()
+
+	raw, err := json.Marshal(payload)
+	require.NoError(t, err)
+
+	return envelope{Type: typ, Payload: raw}
+}
+
+func TestEditor_Handle(t *testing.T) {
+	t.Parallel()
+
+	e := syncedEditor(t, "ab", 2)
+
+	// A new state replaces the document
+	require.NoError(t, e.handle(message(t, ws.MessageTypeState, ws.StatePayload{Content: "xyz", Revision: 5})))
+	require.Equal(t, "xyz", e.view().content)
+	require.Equal(t, 5, e.view().revision)
+
+	// Broadcasts already in the state are dropped, later ones wait for catchUp
+	require.NoError(t, e.handle(message(t, ws.MessageTypeBroadcast, ws.BroadcastPayload{Revision: 5})))
+	require.NoError(t, e.handle(message(t, ws.MessageTypeBroadcast, ws.BroadcastPayload{
+		Revision: 7, OpType: int(ot.Insert), Position: 0, Char: "!", UserID: "bob",
+	})))
+	require.Len(t, e.early, 1)
+	require.Contains(t, e.early, 7)
+
+	require.NoError(t, e.handle(message(t, ws.MessageTypeAck, ws.AckPayload{Revision: 6})))
+	require.Equal(t, 6, e.ackAt)
+
+	// Messages the editor doesn't act on are ignored
+	require.NoError(t, e.handle(message(t, ws.MessageTypePermissionChanged, ws.PermissionChangedPayload{})))
+}
+
+func TestEditor_Handle_Errors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		msg  envelope
+		want string
+	}{
+		{"state", envelope{Type: ws.MessageTypeState, Payload: []byte("[")}, "decode state"},
+		{"broadcast", envelope{Type: ws.MessageTypeBroadcast, Payload: []byte("[")}, "decode broadcast"},
+		{"ack", envelope{Type: ws.MessageTypeAck, Payload: []byte("[")}, "decode ack"},
+		{"closing", envelope{Type: ws.MessageTypeClosing, Payload: []byte("[")}, "decode closing"},
+		{"error", envelope{Type: ws.MessageTypeError, Payload: []byte("[")}, "decode error"},
+		{
+			"server error",
+			message(t, ws.MessageTypeError, ws.ErrorPayload{Code: ws.ErrorCodeAccessDenied, Message: "denied"}),
+			"server error: denied (access_denied)",
+		},
+		{
+			"server closing",
+			message(t, ws.MessageTypeClosing, ws.ClosingPayload{Reason: "restart"}),
+			"server closing: restart",
+		},
+		{"operation", envelope{Type: ws.MessageTypeOperation}, "unexpected operation message"},
+		{"sync", envelope{Type: ws.MessageTypeSync}, "unexpected sync message"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			e := syncedEditor(t, "ab", 2)
+			require.ErrorContains(t, e.handle(tt.msg), tt.want)
+		})
+	}
+}
+
+func TestEditor_Handle_RejectedEdit(t *testing.T) {
+	t.Parallel()
+
+	e := syncedEditor(t, "ab", 2)
+
+	// A connection whose writer isn't running keeps what is sent queued
+	e.conn = &connection{out: make(chan ws.Message, 4), dead: make(chan struct{})}
+
+	require.NoError(t, e.edit(ot.NewInsert("x", 0, "alice"), ot.NewInsert("y", 1, "alice")))
+	require.Equal(t, ws.MessageTypeOperation, (<-e.conn.out).Type)
+
+	// The error is about the edit in flight, so the editor resyncs
+	msg := message(t, ws.MessageTypeError, ws.ErrorPayload{Code: ws.ErrorCodeRateLimited, Message: "slow down"})
+	require.NoError(t, e.handle(msg))
+	require.Equal(t, "2 edits were rejected: server error: slow down (rate_limited)", e.view().notice)
+	require.Equal(t, ws.Message{Type: ws.MessageTypeSync, Payload: ws.SyncPayload{DocID: "doc"}}, <-e.conn.out)
+	require.ErrorContains(t, e.edit(ot.NewInsert("z", 0, "alice")), "resyncing")
+
+	// Edits wait for the new state, which drops them
+	require.Equal(t, 2, e.unsaved())
+	require.NoError(t, e.handle(message(t, ws.MessageTypeState, ws.StatePayload{Content: "ab", Revision: 3})))
+	require.NoError(t, e.catchUp())
+	require.Zero(t, e.unsaved())
+}
+
+func TestDecodeError(t *testing.T) {
+	t.Parallel()
+
+	require.EqualError(t, decodeError(envelope{Type: ws.MessageTypeAck}), "unexpected ack message")
+	require.ErrorContains(t, decodeError(envelope{Type: ws.MessageTypeError, Payload: []byte("1")}), "decode error")
+}
+
+func TestEditor_MoveCursors(t *testing.T) {
+	t.Parallel()
+
+	e := syncedEditor(t, "abcd", 4)
+	e.cursors["bob"] = 1
+	e.cursors["carol"] = 3
+
+	e.moveCursors(ot.NewInsert("x", 2, "alice"))
+	require.Equal(t, map[string]int{"bob": 1, "carol": 4}, e.view().cursors)
+
+	e.moveCursors(ot.NewDelete(0, "alice"))
+	require.Equal(t, map[string]int{"bob": 0, "carol": 3}, e.view().cursors)
+
+	// A cursor at the deleted character stays put
+	e.moveCursors(ot.NewDelete(0, "alice"))
+	require.Equal(t, map[string]int{"bob": 0, "carol": 2}, e.view().cursors)
+
+	e.moveCursors(ot.Operation{Type: ot.Insert, Position: -1, Char: "x", UserID: "alice"})
+	require.Equal(t, map[string]int{"bob": 0, "carol": 2}, e.view().cursors)
+}
+
+func TestEditor_Rebase(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		status int
+		body   any
+		want   string // The error, or the notice if empty
+		notice string
+	}{
+		{"history gone", http.StatusGone, nil, "", "1 edits made offline were lost"},
+		{
+			"server error", http.StatusForbidden, apitypes.ErrorResponse{Code: "forbidden", Message: "no access"},
+			"fetch missed edits: no access (403)", "",
+		},
+		{"bare server error", http.StatusInternalServerError, nil, "fetch missed edits: server returned 500", ""},
+		{"malformed changes", http.StatusOK, "nope", "decode changes", ""},
+		{"no changes", http.StatusOK, apitypes.ChangesResponse{}, "server has no edits after revision 2", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("since") != "2" {
+					http.NotFound(w, r)
+
+					return
+				}
+
+				w.WriteHeader(tt.status)
+
+				if tt.body != nil {
+					_ = json.NewEncoder(w).Encode(tt.body)
+				}
+			}))
+			t.Cleanup(server.Close)
+
+			e := syncedEditor(t, "ab", 2)
+			e.api.baseURL = server.URL
+			require.NoError(t, e.edit(ot.NewInsert("x", 0, "alice")))
+
+			err := e.rebase(t.Context(), ws.StatePayload{Content: "abc", Revision: 3})
+			if tt.want != "" {
+				require.ErrorContains(t, err, tt.want)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, "abc", e.view().content)
+			require.Zero(t, e.unsaved())
+			require.Contains(t, e.view().notice, tt.notice)
+		})
+	}
+}
+
+func TestAPIClient_Header(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "key", (&apiClient{user: "alice", apiKey: "key"}).header().Get("X-Api-Key"))
+	require.Equal(t, "Bearer token", (&apiClient{user: "alice", token: "token"}).header().Get("Authorization"))
+	require.Equal(t, "alice", (&apiClient{user: "alice"}).header().Get("X-User-Id"))
+}
+
+func TestAPIClient_Changes_Unreachable(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	api := &apiClient{baseURL: server.URL, user: "alice", http: &http.Client{}}
+	_, err := api.changes(t.Context(), "doc", 0)
+	require.Error(t, err)
+
+	api.baseURL = "http://bad host"
+	_, err = api.changes(t.Context(), "doc", 0)
+	require.Error(t, err)
+}
+
+func TestWebsocketURL(t *testing.T) {
+	t.Parallel()
+
+	target, err := websocketURL("https://docs.example.com/base", "a b")
+	require.NoError(t, err)
+	require.Equal(t, "wss://docs.example.com/base/v1/ws?docId=a+b", target)
+
+	_, err = websocketURL("ftp://docs.example.com", "doc")
+	require.EqualError(t, err, `invalid server URL "ftp://docs.example.com"`)
+
+	_, err = websocketURL("http://[::1", "doc")
+	require.ErrorContains(t, err, "invalid server URL")
+}
+
+func TestInsert_Empty(t *testing.T) {
+	t.Parallel()
+
+	e := syncedEditor(t, "", 0)
+	require.EqualError(t, insert(e, "alice", 0, ""), "nothing to insert")
+}
+
+func TestIsTerminal(t *testing.T) {
+	t.Parallel()
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+
+	require.False(t, isTerminal(f))
+	require.False(t, isTerminal(&strings.Builder{}))
+}
+
+func TestScreen_Draw_Terminal(t *testing.T) {
+	t.Parallel()
+
+	var out strings.Builder
+
+	screen{out: &out, terminal: true}.draw(view{
+		docID: "doc", content: "hi", revision: 3, queued: 1, cursors: map[string]int{"bob": 1}, notice: "offline",
+	})
+	require.Equal(t, clearScreen+"doc · revision 3 · offline · 1 unsaved\n"+strings.Repeat("─", 40)+"\n"+
+		"h"+reverse+"bob"+reset+"i\n"+strings.Repeat("─", 40)+"\n"+
+		"editing: bob\noffline\n"+help+"\n> ", out.String())
+}
@@ -0,0 +1,332 @@
+// Command termedit is an example terminal editor for online-docs documents.
+// It edits a document over the WebSocket API alongside other clients,
+// showing where the other users are editing, and keeps working while the
+// server is unreachable: edits queue up and are sent once it reconnects.
+// It exercises the whole editing protocol, so it doubles as an integration
+// test of it.
+//
+// Usage:
+//
+//	termedit -doc ID [flags]
+//
+// Edits are typed as commands, one per line:
+//
+//	i POS TEXT      insert TEXT at character POS
+//	a TEXT          append TEXT
+//	d POS [COUNT]   delete COUNT characters, default 1, from POS
+//	q               wait for the edits to be saved and quit
+//
+// A \n in TEXT inserts a line break. termedit exits with status 1 if the
+// document can't be opened or edits are left unsaved.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/serroba/online-docs/internal/ot"
+)
+
+const defaultServer = "http://localhost:8080"
+
+// Exit codes.
+const (
+	exitOK    = 0
+	exitError = 1 // The document couldn't be opened or edits weren't saved
+	exitUsage = 2 // The command line was invalid
+)
+
+const (
+	// saveTimeout is how long quitting waits for queued edits to be saved.
+	saveTimeout = 10 * time.Second
+
+	// redrawInterval limits how often the screen is redrawn.
+	redrawInterval = 50 * time.Millisecond
+)
+
+// options configure the editor.
+type options struct {
+	server string
+	docID  string
+	user   string
+	token  string
+	retry  time.Duration // First reconnection delay
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Getenv, os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command line and returns the process exit code.
+func run(
+	ctx context.Context, args []string, getenv func(string) string, stdin io.Reader, stdout, stderr io.Writer,
+) int {
+	var opts options
+
+	fs := flag.NewFlagSet("termedit", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	fs.StringVar(&opts.server, "server", envOr(getenv, "TERMEDIT_SERVER", defaultServer), "server base URL")
+	fs.StringVar(&opts.docID, "doc", "", "document to edit")
+	fs.StringVar(&opts.user, "user", envOr(getenv, "TERMEDIT_USER", getenv("USER")),
+		"user ID to edit as; with -token, the token's user")
+	fs.StringVar(&opts.token, "token", getenv("TERMEDIT_TOKEN"), "access token")
+	fs.DurationVar(&opts.retry, "retry", time.Second, "delay before reconnecting, doubled on each failure")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+
+		return exitUsage
+	}
+
+	if err := opts.validate(fs.NArg()); err != nil {
+		fmt.Fprintf(stderr, "termedit: %v\n", err)
+		fs.Usage()
+
+		return exitUsage
+	}
+
+	if err := edit(ctx, opts, stdin, screen{out: stdout, terminal: isTerminal(stdout)}); err != nil {
+		fmt.Fprintf(stderr, "termedit: %v\n", err)
+
+		return exitError
+	}
+
+	return exitOK
+}
+
+// validate checks the options, given the number of positional arguments.
+func (o options) validate(nargs int) error {
+	switch {
+	case nargs > 0:
+		return errors.New("unexpected arguments")
+	case o.docID == "":
+		return errors.New("-doc is required")
+	case o.user == "":
+		return errors.New("-user is required")
+	case o.retry <= 0:
+		return errors.New("-retry must be positive")
+	}
+
+	return nil
+}
+
+// envOr returns the environment variable, or fallback when it's unset.
+func envOr(getenv func(string) string, key, fallback string) string {
+	if v := getenv(key); v != "" {
+		return v
+	}
+
+	return fallback
+}
+
+// isTerminal reports whether w writes to a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := f.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// edit runs the editor on commands read from in until they end or the user
+// quits, then waits for the edits to be saved. Once ctx is done it stops
+// reading commands, but still saves the edits.
+func edit(ctx context.Context, opts options, in io.Reader, scr screen) error {
+	target, err := websocketURL(opts.server, opts.docID)
+	if err != nil {
+		return err
+	}
+
+	api := &apiClient{baseURL: opts.server, user: opts.user, token: opts.token, http: &http.Client{}}
+	e := newEditor(opts.docID, target, api, opts.retry)
+
+	// The editor outlives ctx to save the last edits
+	background, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- e.run(background) }()
+
+	if err := e.ready(ctx); err != nil {
+		return err
+	}
+
+	lines := make(chan string)
+
+	go func() {
+		defer close(lines)
+
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-background.Done():
+				return
+			}
+		}
+	}()
+
+	if err := loop(ctx, e, opts.user, lines, stopped, scr); err != nil {
+		return err
+	}
+
+	saving, cancelSave := context.WithTimeout(background, saveTimeout)
+	defer cancelSave()
+
+	err = e.saved(saving)
+	scr.draw(e.view())
+
+	if err != nil {
+		return fmt.Errorf("%d edits not saved: %w", e.unsaved(), err)
+	}
+
+	return nil
+}
+
+// loop handles commands and redraws the screen as the document changes,
+// until the commands end, the user quits or ctx is done. It fails if the
+// editor stops.
+func loop(ctx context.Context, e *editor, user string, lines <-chan string, stopped <-chan error, scr screen) error {
+	ticker := time.NewTicker(redrawInterval)
+	defer ticker.Stop()
+
+	scr.draw(e.view())
+
+	dirty := false
+	changes := e.changes()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-stopped:
+			return err
+		case <-changes:
+			changes = e.changes()
+			dirty = true
+		case <-ticker.C:
+			if dirty {
+				scr.draw(e.view())
+				dirty = false
+			}
+		case line, ok := <-lines:
+			if !ok || strings.TrimSpace(line) == "q" {
+				return nil
+			}
+
+			if err := command(e, user, line); err != nil {
+				e.tell(err.Error())
+			}
+
+			// Show the result of the command straight away
+			scr.draw(e.view())
+			changes = e.changes()
+			dirty = false
+		}
+	}
+}
+
+// command applies one command line to the document.
+func command(e *editor, user, line string) error {
+	name, rest, _ := strings.Cut(strings.TrimLeft(line, " "), " ")
+
+	switch name {
+	case "":
+		return nil
+	case "a":
+		return insert(e, user, e.length(), rest)
+	case "i":
+		raw, text, _ := strings.Cut(rest, " ")
+
+		position, err := strconv.Atoi(raw)
+		if err != nil || position < 0 || position > e.length() {
+			return fmt.Errorf("invalid position %q", raw)
+		}
+
+		return insert(e, user, position, text)
+	case "d":
+		fields := strings.Fields(rest)
+		if len(fields) == 0 || len(fields) > 2 {
+			return errors.New("usage: d POS [COUNT]")
+		}
+
+		position, err := strconv.Atoi(fields[0])
+		if err != nil || position < 0 || position >= e.length() {
+			return fmt.Errorf("invalid position %q", fields[0])
+		}
+
+		count := 1
+		if len(fields) == 2 {
+			if count, err = strconv.Atoi(fields[1]); err != nil || count < 1 || position+count > e.length() {
+				return fmt.Errorf("invalid count %q", fields[1])
+			}
+		}
+
+		ops := make([]ot.Operation, count)
+		for i := range ops {
+			ops[i] = ot.NewDelete(position, user)
+		}
+
+		return e.edit(ops...)
+	default:
+		return fmt.Errorf("unknown command %q; %s", name, help)
+	}
+}
+
+// insert inserts text at position, one character at a time.
+func insert(e *editor, user string, position int, text string) error {
+	runes := []rune(strings.ReplaceAll(text, `\n`, "\n"))
+	if len(runes) == 0 {
+		return errors.New("nothing to insert")
+	}
+
+	ops := make([]ot.Operation, len(runes))
+	for i, r := range runes {
+		ops[i] = ot.NewInsert(string(r), position+i, user)
+	}
+
+	return e.edit(ops...)
+}
+
+// websocketURL returns the WebSocket endpoint for a document on the server.
+func websocketURL(server, docID string) (string, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", fmt.Errorf("invalid server URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("invalid server URL %q", server)
+	}
+
+	u = u.JoinPath("v1", "ws")
+	u.RawQuery = url.Values{"docId": {docID}}.Encode()
+
+	return u.String(), nil
+}
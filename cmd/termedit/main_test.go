@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// testServer is a server with a document "doc" that alice owns and bob
+// may edit.
+type testServer struct {
+	*httptest.Server
+
+	manager *collab.Manager
+	hub     *ws.Hub
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	return newFaultyServer(t, nil)
+}
+
+// newFaultyServer is newTestServer with faults injected into its
+// WebSockets, if not nil.
+func newFaultyServer(t *testing.T, faults *ws.FaultInjector) *testServer {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc", "alice", acl.Owner))
+	require.NoError(t, permStore.Grant("doc", "bob", acl.Editor))
+
+	hub := ws.NewHub()
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore, Hub: hub})
+
+	server := httptest.NewServer(handler.NewServer(handler.ServerConfig{
+		Manager:   manager,
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+		Faults:    faults,
+	}).Handler())
+	t.Cleanup(server.Close)
+
+	return &testServer{Server: server, manager: manager, hub: hub}
+}
+
+// content returns the document's content on the server.
+func (s *testServer) content(t *testing.T) string {
+	t.Helper()
+
+	content, _ := s.state(t)
+
+	return content
+}
+
+// state returns the document's content and revision on the server.
+func (s *testServer) state(t *testing.T) (string, int) {
+	t.Helper()
+
+	session, err := s.manager.GetOrCreateSession(t.Context(), "doc")
+	require.NoError(t, err)
+
+	content, revision, err := session.GetState("alice")
+	require.NoError(t, err)
+
+	return content, revision
+}
+
+// lockedBuffer is a bytes.Buffer safe to write and read concurrently.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+// termedit runs a command line against the server with the given commands
+// and returns its exit code and output.
+func termedit(t *testing.T, server *testServer, stdin io.Reader, args ...string) (int, string, string) {
+	t.Helper()
+
+	env := map[string]string{"TERMEDIT_SERVER": server.URL}
+
+	var stdout, stderr bytes.Buffer
+	code := run(t.Context(), args, func(key string) string { return env[key] }, stdin, &stdout, &stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+func TestTermedit(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+
+	code, out, errOut := termedit(t, server, strings.NewReader("a hello\ni 0 >\nd 1 2\nq\n"),
+		"-doc", "doc", "-user", "alice")
+	require.Equal(t, exitOK, code, errOut)
+	require.Equal(t, ">llo", server.content(t))
+	require.True(t, strings.HasSuffix(out, "doc · revision 8 · online · 0 unsaved\n"+
+		strings.Repeat("─", 40)+"\n>llo\n"+strings.Repeat("─", 40)+"\n"), out)
+}
+
+// runningEditor is a termedit process typing commands into a pipe.
+type runningEditor struct {
+	in   *io.PipeWriter
+	out  lockedBuffer
+	done chan int // Receives the exit code
+}
+
+// startEditor runs termedit for user on the server's document "doc".
+func startEditor(t *testing.T, server *testServer, user string) *runningEditor {
+	t.Helper()
+
+	stdin, in := io.Pipe()
+	e := &runningEditor{in: in, done: make(chan int, 1)}
+
+	go func() {
+		env := map[string]string{"TERMEDIT_SERVER": server.URL}
+		getenv := func(key string) string { return env[key] }
+		e.done <- run(t.Context(), []string{"-doc", "doc", "-user", user, "-retry", "200ms"},
+			getenv, stdin, &e.out, io.Discard)
+	}()
+
+	return e
+}
+
+// send types a command.
+func (e *runningEditor) send(t *testing.T, line string) {
+	t.Helper()
+
+	_, err := io.WriteString(e.in, line+"\n")
+	require.NoError(t, err)
+}
+
+// quit closes the editor's input and waits for it to exit.
+func (e *runningEditor) quit(t *testing.T) {
+	t.Helper()
+
+	require.NoError(t, e.in.Close())
+	require.Equal(t, exitOK, <-e.done, e.out.String())
+}
+
+// shows reports whether the editor last drew content at revision, online
+// with nothing left unsaved.
+func (e *runningEditor) shows(content string, revision int) bool {
+	out := e.out.String()
+
+	start := strings.LastIndex(out, "doc · revision ")
+	if start < 0 {
+		return false
+	}
+
+	// A status line, a rule, then the content with the other users' cursors
+	lines := strings.SplitN(out[start:], "\n", 4)
+	if len(lines) < 4 {
+		return false
+	}
+
+	drawn := strings.NewReplacer("[alice]", "", "[bob]", "").Replace(lines[2])
+
+	return lines[0] == fmt.Sprintf("doc · revision %d · online · 0 unsaved", revision) && drawn == content
+}
+
+func TestTermedit_Offline(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+	alice, bob := startEditor(t, server, "alice"), startEditor(t, server, "bob")
+
+	// Bob sees alice's edit, and where she made it
+	alice.send(t, "a hello")
+	require.Eventually(t, func() bool { return strings.Contains(bob.out.String(), "hello[alice]\n") },
+		5*time.Second, 10*time.Millisecond)
+
+	// Both keep editing while disconnected
+	require.Equal(t, 2, server.hub.Disconnect("doc"))
+	require.Eventually(t, func() bool { return strings.Contains(bob.out.String(), " · offline · ") },
+		5*time.Second, 10*time.Millisecond)
+
+	bob.send(t, "i 0 X")
+	alice.send(t, "a !")
+	alice.quit(t)
+	bob.quit(t)
+	require.Equal(t, "Xhello!", server.content(t))
+}
+
+func TestTermedit_Faults(t *testing.T) {
+	t.Parallel()
+
+	// The seed lets the first connections through, as termedit gives up if
+	// those fail; after them messages are delayed, reordered and lost, and
+	// connections drop
+	server := newFaultyServer(t, ws.NewFaultInjector(ws.FaultProfile{
+		Seed: 1, Latency: 2 * time.Millisecond, Reorder: 0.2, Drop: 0.02, Disconnect: 0.02,
+	}))
+	alice, bob := startEditor(t, server, "alice"), startEditor(t, server, "bob")
+
+	for range 20 {
+		alice.send(t, "a a")
+		bob.send(t, "i 0 b")
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	session, err := server.manager.GetOrCreateSession(t.Context(), "doc")
+	require.NoError(t, err)
+
+	// Both resync and resume until they agree with the server
+	require.Eventually(t, func() bool {
+		content, revision, err := session.GetState("alice")
+
+		return err == nil && revision == 40 && alice.shows(content, revision) && bob.shows(content, revision)
+	}, 20*time.Second, 20*time.Millisecond, "alice:\n%s\nbob:\n%s", &alice.out, &bob.out)
+
+	alice.quit(t)
+	bob.quit(t)
+
+	content := server.content(t)
+	require.Equal(t, 20, strings.Count(content, "a"))
+	require.Equal(t, 20, strings.Count(content, "b"))
+}
+
+func TestTermedit_MissingDocument(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+
+	code, _, errOut := termedit(t, server, strings.NewReader(""), "-doc", "missing", "-user", "alice")
+	require.Equal(t, exitError, code)
+	require.Equal(t, "termedit: server error: document not found (invalid_message)\n", errOut)
+}
+
+func TestTermedit_Usage(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"positional argument", []string{"-doc", "doc", "-user", "alice", "extra"}},
+		{"no document", []string{"-user", "alice"}},
+		{"no user", []string{"-doc", "doc", "-user", ""}},
+		{"zero retry", []string{"-doc", "doc", "-user", "alice", "-retry", "0s"}},
+		{"unknown flag", []string{"-bogus"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			code, _, _ := termedit(t, server, strings.NewReader(""), tt.args...)
+			require.Equal(t, exitUsage, code)
+		})
+	}
+}
+
+func TestCommand_Invalid(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+
+	code, out, errOut := termedit(t, server, strings.NewReader("a hi\ni 9 x\nd 2\nx\na hi\n"),
+		"-doc", "doc", "-user", "alice")
+	require.Equal(t, exitOK, code, errOut)
+	require.Equal(t, "hihi", server.content(t))
+	require.Contains(t, out, `invalid position "9"`)
+	require.Contains(t, out, `invalid position "2"`)
+	require.Contains(t, out, `unknown command "x"`)
+}
+
+func TestScreen_Mark(t *testing.T) {
+	t.Parallel()
+
+	cursors := map[string]int{"bob": 2, "alice": 2, "carol": 9}
+
+	require.Equal(t, "hé[alice][bob]llo[carol]", screen{}.mark("héllo", cursors))
+	require.Equal(t, "hé\x1b[7malice\x1b[0m\x1b[7mbob\x1b[0mllo\x1b[7mcarol\x1b[0m",
+		screen{terminal: true}.mark("héllo", cursors))
+}
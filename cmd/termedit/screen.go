@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// ANSI escape sequences used on terminals.
+const (
+	clearScreen = "\x1b[H\x1b[2J"
+	reverse     = "\x1b[7m"
+	reset       = "\x1b[0m"
+)
+
+const help = "i POS TEXT inserts, a TEXT appends, d POS [COUNT] deletes, q quits; \\n in TEXT is a newline"
+
+// screen draws an editor's view. On a terminal it redraws the whole screen
+// and highlights the other users' cursors; otherwise it writes each view
+// after the previous one.
+type screen struct {
+	out      io.Writer
+	terminal bool
+}
+
+// draw writes the view: a status line, the content with a [user] marker at
+// each of the other users' cursors, who is editing, and any notice.
+func (s screen) draw(v view) {
+	var b strings.Builder
+
+	if s.terminal {
+		b.WriteString(clearScreen)
+	}
+
+	status := "online"
+	if !v.online {
+		status = "offline"
+	}
+
+	fmt.Fprintf(&b, "%s · revision %d · %s · %d unsaved\n", v.docID, v.revision, status, v.queued)
+	b.WriteString(strings.Repeat("─", 40) + "\n")
+	b.WriteString(s.mark(v.content, v.cursors))
+	b.WriteString("\n" + strings.Repeat("─", 40) + "\n")
+
+	if len(v.cursors) > 0 {
+		users := make([]string, 0, len(v.cursors))
+		for user := range v.cursors {
+			users = append(users, user)
+		}
+
+		slices.Sort(users)
+		b.WriteString("editing: " + strings.Join(users, ", ") + "\n")
+	}
+
+	if v.notice != "" {
+		b.WriteString(v.notice + "\n")
+	}
+
+	if s.terminal {
+		b.WriteString(help + "\n> ")
+	}
+
+	_, _ = io.WriteString(s.out, b.String())
+}
+
+// mark inserts a marker for each cursor into content. Cursors at the same
+// position are marked in name order.
+func (s screen) mark(content string, cursors map[string]int) string {
+	users := make([]string, 0, len(cursors))
+	for user := range cursors {
+		users = append(users, user)
+	}
+
+	slices.SortFunc(users, func(a, b string) int {
+		if d := cursors[a] - cursors[b]; d != 0 {
+			return d
+		}
+
+		return strings.Compare(a, b)
+	})
+
+	var b strings.Builder
+
+	runes := []rune(content)
+	next := 0
+
+	for _, user := range users {
+		position := min(max(cursors[user], 0), len(runes))
+
+		b.WriteString(string(runes[next:position]))
+		next = position
+
+		if s.terminal {
+			b.WriteString(reverse + user + reset)
+		} else {
+			b.WriteString("[" + user + "]")
+		}
+	}
+
+	b.WriteString(string(runes[next:]))
+
+	return b.String()
+}
@@ -0,0 +1,48 @@
+/** ProtocolError reports a message from the server that doesn't follow the protocol. */
+export class ProtocolError extends Error {
+  constructor(message: string) {
+    super(message);
+    this.name = "ProtocolError";
+  }
+}
+
+/** encodeMessage serializes a message for the server. */
+export function encodeMessage(msg: ClientMessage): string {
+  return JSON.stringify(msg);
+}
+
+/**
+ * decodeMessage parses a message from the server. It throws a ProtocolError
+ * if the message has an unknown type, or its payload lacks a field or has one
+ * of the wrong kind. Fields it doesn't know are allowed, so older clients keep
+ * working as the protocol grows.
+ */
+export function decodeMessage(data: string): ServerMessage {
+  const msg: unknown = JSON.parse(data);
+  if (typeof msg !== "object" || msg === null) {
+    throw new ProtocolError("message is not an object");
+  }
+
+  const { type, payload } = msg as { type?: unknown; payload?: unknown };
+  if (typeof type !== "string" || !Object.prototype.hasOwnProperty.call(serverFields, type)) {
+    throw new ProtocolError(`unknown message type ${JSON.stringify(type)}`);
+  }
+
+  if (typeof payload !== "object" || payload === null) {
+    throw new ProtocolError(`${type} message has no payload`);
+  }
+
+  const fields = serverFields[type as keyof ServerPayloads];
+  for (const [name, [kind, required]] of Object.entries(fields)) {
+    const value = (payload as Record<string, unknown>)[name];
+    if (value === undefined || value === null) {
+      if (required) {
+        throw new ProtocolError(`${type} payload is missing ${name}`);
+      }
+    } else if (typeof value !== kind) {
+      throw new ProtocolError(`${type} payload field ${name} is a ${typeof value}, not a ${kind}`);
+    }
+  }
+
+  return msg as ServerMessage;
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// modulePath is the import path of the repository's module.
+const modulePath = "github.com/serroba/online-docs"
+
+// docs holds the doc comments of Go types and their fields, keyed by
+// "package.Type" and "package.Type.Field".
+type docs map[string]string
+
+// loadDocs reads the doc comments of the packages' source under root.
+func loadDocs(root string, pkgPaths ...string) (docs, error) {
+	d := make(docs)
+	fset := token.NewFileSet()
+
+	for _, pkgPath := range pkgPaths {
+		dir := filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(pkgPath, modulePath+"/")))
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("read %s source: %w", pkgPath, err)
+		}
+
+		for _, entry := range entries {
+			name := entry.Name()
+			if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+				continue
+			}
+
+			file, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+			if err != nil {
+				return nil, err
+			}
+
+			d.add(pkgPath, file)
+		}
+	}
+
+	return d, nil
+}
+
+// add records the doc comments of a file's type declarations.
+func (d docs) add(pkgPath string, file *ast.File) {
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gen.Specs {
+			ts, ok := spec.(*ast.TypeSpec)
+			if !ok {
+				continue
+			}
+
+			key := pkgPath + "." + ts.Name.Name
+
+			switch {
+			case ts.Doc != nil:
+				d[key] = ts.Doc.Text()
+			case len(gen.Specs) == 1 && gen.Doc != nil:
+				d[key] = gen.Doc.Text()
+			}
+
+			if st, ok := ts.Type.(*ast.StructType); ok {
+				d.addFields(key, st)
+			}
+		}
+	}
+}
+
+// addFields records the comments of a struct's fields, above or beside them.
+func (d docs) addFields(key string, st *ast.StructType) {
+	for _, f := range st.Fields.List {
+		text := ""
+
+		switch {
+		case f.Doc != nil:
+			text = f.Doc.Text()
+		case f.Comment != nil:
+			text = f.Comment.Text()
+		}
+
+		for _, name := range f.Names {
+			d[key+"."+name.Name] = text
+		}
+	}
+}
+
+// typeDoc returns a type's doc comment.
+func (d docs) typeDoc(t reflect.Type) string {
+	return d[t.PkgPath()+"."+t.Name()]
+}
+
+// fieldDoc returns the comment of a struct's field.
+func (d docs) fieldDoc(t reflect.Type, field string) string {
+	return d[t.PkgPath()+"."+t.Name()+"."+field]
+}
@@ -0,0 +1,523 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/ws"
+)
+
+// codec is the hand-written part of the output, decoding WebSocket messages
+// with the generated field table.
+//
+//go:embed codec.ts
+var codec string
+
+// message pairs a WebSocket message type with its payload.
+type message struct {
+	Type    ws.MessageType
+	Payload any
+}
+
+// clientMessages are the messages clients send.
+var clientMessages = []message{
+	{ws.MessageTypeOperation, ws.OperationPayload{}},
+	{ws.MessageTypeOperationBatch, ws.OperationBatchPayload{}},
+	{ws.MessageTypeSync, ws.SyncPayload{}},
+	{ws.MessageTypeCursor, ws.CursorPayload{}},
+}
+
+// serverMessages are the messages the server sends.
+var serverMessages = []message{
+	{ws.MessageTypeAck, ws.AckPayload{}},
+	{ws.MessageTypeBroadcast, ws.BroadcastPayload{}},
+	{ws.MessageTypeState, ws.StatePayload{}},
+	{ws.MessageTypeCatchUp, ws.CatchUpPayload{}},
+	{ws.MessageTypeError, ws.ErrorPayload{}},
+	{ws.MessageTypePresence, ws.PresencePayload{}},
+	{ws.MessageTypePermissionChanged, ws.PermissionChangedPayload{}},
+	{ws.MessageTypeClosing, ws.ClosingPayload{}},
+}
+
+// restTypes are the REST API's request and response bodies, in the order of
+// the OpenAPI spec. Types they refer to are generated too.
+var restTypes = []any{
+	apitypes.CreateDocumentRequest{},
+	apitypes.CreateDocumentResponse{},
+	apitypes.CopyDocumentRequest{},
+	apitypes.SlugResponse{},
+	apitypes.TokenResponse{},
+	apitypes.RefreshTokenRequest{},
+	apitypes.RevokeTokenRequest{},
+	apitypes.GetDocumentResponse{},
+	apitypes.UpdateDocumentRequest{},
+	apitypes.DocumentMetadataResponse{},
+	apitypes.DocumentStatsResponse{},
+	apitypes.Operation{},
+	apitypes.ChangesResponse{},
+	apitypes.HistoryResponse{},
+	apitypes.RevisionResponse{},
+	apitypes.DocumentShare{},
+	apitypes.PermissionsResponse{},
+	apitypes.GrantPermissionRequest{},
+	apitypes.SetPermissionRequest{},
+	apitypes.CreateShareLinkRequest{},
+	apitypes.ShareLink{},
+	apitypes.CreateShareLinkResponse{},
+	apitypes.BatchCreateDocument{},
+	apitypes.BatchCreateRequest{},
+	apitypes.BatchCreateResponse{},
+	apitypes.SetTagsRequest{},
+	apitypes.TagsResponse{},
+	apitypes.ArchiveResponse{},
+	apitypes.RevertResponse{},
+	apitypes.ReplaceContentRequest{},
+	apitypes.ReplaceContentResponse{},
+	apitypes.AttachmentResponse{},
+	apitypes.CreateCommentRequest{},
+	apitypes.Comment{},
+	apitypes.ListCommentsResponse{},
+	apitypes.DocumentSummary{},
+	apitypes.ListUserDocumentsResponse{},
+	apitypes.StarResponse{},
+	apitypes.ListStarredResponse{},
+	apitypes.NotificationSettings{},
+	apitypes.BatchDeleteRequest{},
+	apitypes.BatchResult{},
+	apitypes.BatchDeleteResponse{},
+	apitypes.CreateAPIKeyRequest{},
+	apitypes.APIKey{},
+	apitypes.CreateAPIKeyResponse{},
+	apitypes.ListAPIKeysResponse{},
+	apitypes.CreateWebhookRequest{},
+	apitypes.Webhook{},
+	apitypes.CreateWebhookResponse{},
+	apitypes.ListWebhooksResponse{},
+	apitypes.CreateBotRequest{},
+	apitypes.Bot{},
+	apitypes.ListBotsResponse{},
+	apitypes.CreateGroupRequest{},
+	apitypes.Group{},
+	apitypes.ListGroupsResponse{},
+	apitypes.BotEditRequest{},
+	apitypes.BotEditResponse{},
+	apitypes.DocumentEvent{},
+	apitypes.AdminSession{},
+	apitypes.OperationLatency{},
+	apitypes.StageLatency{},
+	apitypes.ListSessionsResponse{},
+	apitypes.ListDocumentsResponse{},
+	apitypes.AdminSummaryResponse{},
+	apitypes.HotDocument{},
+	apitypes.BroadcastQueue{},
+	apitypes.ChainBucket{},
+	apitypes.HealthResponse{},
+	apitypes.ErrorResponse{},
+}
+
+// enum is a set of string constants, generated as a union type.
+type enum struct {
+	name   string
+	doc    string
+	values []string
+}
+
+var enums = []enum{
+	{
+		name: "MessageErrorCode",
+		doc:  "MessageErrorCode is the code of a WebSocket error message.",
+		values: []string{
+			ws.ErrorCodeAccessDenied,
+			ws.ErrorCodeDocumentArchived,
+			ws.ErrorCodeInvalidMessage,
+			ws.ErrorCodeInternalError,
+			ws.ErrorCodeRateLimited,
+		},
+	},
+	{
+		name: "PresenceEvent",
+		doc:  "PresenceEvent is what a WebSocket presence message reports.",
+		values: []string{
+			string(ws.PresenceJoin),
+			string(ws.PresenceLeave),
+			string(ws.PresenceCursor),
+		},
+	},
+	{
+		name: "ErrorCode",
+		doc:  "ErrorCode is the code of a failed REST request.",
+		values: []string{
+			apitypes.ErrorCodeInvalidRequest,
+			apitypes.ErrorCodeUnauthorized,
+			apitypes.ErrorCodeAccessDenied,
+			apitypes.ErrorCodeNotFound,
+			apitypes.ErrorCodeMethodNotAllowed,
+			apitypes.ErrorCodeConflict,
+			apitypes.ErrorCodeGone,
+			apitypes.ErrorCodePreconditionFailed,
+			apitypes.ErrorCodePayloadTooLarge,
+			apitypes.ErrorCodeUnsupportedMediaType,
+			apitypes.ErrorCodeRateLimited,
+			apitypes.ErrorCodeMisdirectedRequest,
+			apitypes.ErrorCodeBadGateway,
+			apitypes.ErrorCodeTimeout,
+			apitypes.ErrorCodeUnavailable,
+			apitypes.ErrorCodeInternalError,
+		},
+	},
+}
+
+var (
+	timeType       = reflect.TypeFor[time.Time]()
+	rawMessageType = reflect.TypeFor[json.RawMessage]()
+)
+
+// generate returns the TypeScript module, with doc comments read from the
+// Go source under root.
+func generate(root string) (string, error) {
+	d, err := loadDocs(root, reflect.TypeFor[ws.Message]().PkgPath(), reflect.TypeFor[apitypes.Operation]().PkgPath())
+	if err != nil {
+		return "", err
+	}
+
+	g := &generator{docs: d, named: make(map[string]reflect.Type)}
+
+	g.line("// Code generated by cmd/tsgen from internal/ws and internal/apitypes. DO NOT EDIT.")
+	g.line("")
+	g.line("// WebSocket messages")
+	g.line("")
+	g.messages("ClientPayloads", "a client sends", clientMessages)
+	g.messages("ServerPayloads", "the server sends", serverMessages)
+	g.line(`/** ClientMessage is a message a client sends. */`)
+	g.line(`export type ClientMessage = { [T in keyof ClientPayloads]: { type: T; payload: ClientPayloads[T] } }` +
+		`[keyof ClientPayloads];`)
+	g.line("")
+	g.line(`/** ServerMessage is a message the server sends. */`)
+	g.line(`export type ServerMessage = { [T in keyof ServerPayloads]: { type: T; payload: ServerPayloads[T] } }` +
+		`[keyof ServerPayloads];`)
+	g.line("")
+
+	for _, e := range enums {
+		g.enum(e)
+	}
+
+	g.line("// REST API")
+	g.line("")
+
+	for _, v := range restTypes {
+		g.declare(reflect.TypeOf(v))
+	}
+
+	g.flush()
+	g.fields(serverMessages)
+	g.b.WriteString(codec)
+
+	if g.err != nil {
+		return "", g.err
+	}
+
+	return g.b.String(), nil
+}
+
+// generator writes TypeScript declarations for Go types.
+type generator struct {
+	docs  docs
+	b     strings.Builder
+	err   error
+	named map[string]reflect.Type // Struct types declared or queued, by name
+	queue []reflect.Type          // Struct types to declare
+}
+
+func (g *generator) line(s string) {
+	g.b.WriteString(s + "\n")
+}
+
+// fail records the first error.
+func (g *generator) fail(err error) {
+	if g.err == nil {
+		g.err = err
+	}
+}
+
+// comment writes a doc comment, if there is one, at the indentation.
+func (g *generator) comment(indent, text string) {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+
+	switch {
+	case text == "":
+	case len(lines) == 1:
+		g.line(indent + "/** " + lines[0] + " */")
+	default:
+		g.line(indent + "/**")
+
+		for _, l := range lines {
+			g.line(strings.TrimRight(indent+" * "+l, " "))
+		}
+
+		g.line(indent + " */")
+	}
+}
+
+// messages declares the payloads of messages and an interface mapping each
+// message type to its payload.
+func (g *generator) messages(name, sender string, msgs []message) {
+	types := make([]reflect.Type, len(msgs))
+
+	for i, msg := range msgs {
+		types[i] = reflect.TypeOf(msg.Payload)
+		g.declare(types[i])
+	}
+
+	g.flush()
+	g.comment("", fmt.Sprintf("%s maps each message %s to its payload.", name, sender))
+	g.line("export interface " + name + " {")
+
+	for i, msg := range msgs {
+		g.line(fmt.Sprintf("  %s: %s;", msg.Type, types[i].Name()))
+	}
+
+	g.line("}")
+	g.line("")
+}
+
+// enum declares a union of string literals.
+func (g *generator) enum(e enum) {
+	literals := make([]string, len(e.values))
+	for i, v := range e.values {
+		literals[i] = fmt.Sprintf("%q", v)
+	}
+
+	g.comment("", e.doc)
+	g.line("export type " + e.name + " = " + strings.Join(literals, " | ") + ";")
+	g.line("")
+}
+
+// declare queues a named struct type for declaring, unless it already is.
+func (g *generator) declare(t reflect.Type) {
+	if other, ok := g.named[t.Name()]; ok {
+		if other != t {
+			g.fail(fmt.Errorf("%v and %v have the same name", other, t))
+		}
+
+		return
+	}
+
+	g.named[t.Name()] = t
+	g.queue = append(g.queue, t)
+}
+
+// flush declares the queued struct types, and those they refer to.
+func (g *generator) flush() {
+	for len(g.queue) > 0 {
+		t := g.queue[0]
+		g.queue = g.queue[1:]
+
+		g.comment("", g.docs.typeDoc(t))
+		g.line("export interface " + t.Name() + " {")
+
+		for _, f := range jsonFields(t) {
+			g.comment("  ", g.docs.fieldDoc(f.owner, f.goName))
+			g.line("  " + f.declaration(g.fieldType(f)) + ";")
+		}
+
+		g.line("}")
+		g.line("")
+	}
+}
+
+// fieldType returns a field's TypeScript type. A pointer that's always
+// present may be null.
+func (g *generator) fieldType(f field) string {
+	ts := g.typeOf(f.typ)
+
+	if f.typ.Kind() == reflect.Pointer && !f.omitempty {
+		ts += " | null"
+	}
+
+	return ts
+}
+
+// typeOf returns the TypeScript type of values of a Go type, queueing the
+// struct types it refers to.
+func (g *generator) typeOf(t reflect.Type) string {
+	switch t {
+	case timeType:
+		return "string" // RFC 3339
+	case rawMessageType:
+		return "unknown"
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Pointer:
+		return g.typeOf(t.Elem())
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "string" // Base64
+		}
+
+		return g.typeOf(t.Elem()) + "[]"
+	case reflect.Map:
+		return "Record<string, " + g.typeOf(t.Elem()) + ">"
+	case reflect.Interface:
+		return "unknown"
+	case reflect.Struct:
+		if t.Name() == "" {
+			g.fail(fmt.Errorf("anonymous struct %v isn't supported", t))
+
+			return "unknown"
+		}
+
+		g.declare(t)
+
+		return t.Name()
+	default:
+		g.fail(fmt.Errorf("%v isn't supported", t))
+
+		return "unknown"
+	}
+}
+
+// fields writes the table the codec checks server payloads against: each
+// field's JavaScript type, and whether it's always present.
+func (g *generator) fields(msgs []message) {
+	g.line("// Codec")
+	g.line("")
+	g.line(`/** FieldKind is the result of typeof for a payload field. */`)
+	g.line(`type FieldKind = "string" | "number" | "boolean" | "object";`)
+	g.line("")
+	g.line(`/** serverFields describes each server payload's fields: their kind, and whether they're always present. */`)
+	g.line(`const serverFields: { [T in keyof ServerPayloads]: Record<string, [FieldKind, boolean]> } = {`)
+
+	for _, msg := range msgs {
+		fields := jsonFields(reflect.TypeOf(msg.Payload))
+
+		entries := make([]string, 0, len(fields))
+		for _, f := range fields {
+			if kind := fieldKind(f.typ); kind != "" {
+				required := !f.omitempty && f.typ.Kind() != reflect.Pointer
+				entries = append(entries, fmt.Sprintf("%s: [%q, %t]", f.key(), kind, required))
+			}
+		}
+
+		g.line(fmt.Sprintf("  %s: { %s },", msg.Type, strings.Join(entries, ", ")))
+	}
+
+	g.line("};")
+	g.line("")
+}
+
+// fieldKind returns what typeof reports for values of a Go type in decoded
+// JSON, or "" if it varies.
+func fieldKind(t reflect.Type) string {
+	switch {
+	case t == rawMessageType:
+		return ""
+	case t == timeType:
+		return "string"
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Pointer:
+		return fieldKind(t.Elem())
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "string"
+		}
+
+		return "object"
+	case reflect.Array, reflect.Map, reflect.Struct:
+		return "object"
+	default:
+		return ""
+	}
+}
+
+// field is a struct field as encoding/json sees it.
+type field struct {
+	owner     reflect.Type // The struct declaring it, which may be embedded
+	goName    string
+	name      string
+	typ       reflect.Type
+	omitempty bool
+}
+
+// key returns the field's property name, quoted if it isn't an identifier.
+func (f field) key() string {
+	for i, r := range f.name {
+		if r != '_' && r != '$' && (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (i == 0 || r < '0' || r > '9') {
+			return fmt.Sprintf("%q", f.name)
+		}
+	}
+
+	return f.name
+}
+
+// declaration returns the field's property declaration.
+func (f field) declaration(typ string) string {
+	if f.omitempty {
+		return f.key() + "?: " + typ
+	}
+
+	return f.key() + ": " + typ
+}
+
+// jsonFields returns the fields of a struct that encoding/json encodes,
+// with the fields of embedded structs promoted.
+func jsonFields(t reflect.Type) []field {
+	var fields []field
+
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			fields = append(fields, jsonFields(sf.Type)...)
+
+			continue
+		}
+
+		if !sf.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		omit := false
+
+		for opt := range strings.SplitSeq(opts, ",") {
+			omit = omit || opt == "omitempty" || opt == "omitzero"
+		}
+
+		fields = append(fields, field{owner: t, goName: sf.Name, name: name, typ: sf.Type, omitempty: omit})
+	}
+
+	return fields
+}
@@ -0,0 +1,76 @@
+// Command tsgen generates TypeScript definitions for the WebSocket messages
+// and the REST API's request and response bodies from their Go types, with a
+// small codec for WebSocket messages, so browser clients follow changes to
+// the protocol. Doc comments are copied from the Go source.
+//
+// Usage:
+//
+//	tsgen [-root DIR] [-out FILE]
+//
+// Regenerate the definitions after changing internal/ws or
+// internal/apitypes:
+//
+//	go run ./cmd/tsgen -out web/protocol.ts
+//
+// The command's tests fail while web/protocol.ts is out of date.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Exit codes.
+const (
+	exitOK    = 0
+	exitError = 1 // The definitions couldn't be generated or written
+	exitUsage = 2 // The command line was invalid
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command line and returns the process exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("tsgen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	root := fs.String("root", ".", "repository root, to read doc comments from")
+	out := fs.String("out", "", "file to write, instead of standard output")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+
+		return exitUsage
+	}
+
+	if fs.NArg() > 0 {
+		fmt.Fprintln(stderr, "tsgen: unexpected arguments")
+		fs.Usage()
+
+		return exitUsage
+	}
+
+	source, err := generate(*root)
+	if err == nil {
+		if *out == "" {
+			_, err = io.WriteString(stdout, source)
+		} else {
+			err = os.WriteFile(*out, []byte(source), 0o644) //nolint:gosec // Source code is world-readable
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "tsgen: %v\n", err)
+
+		return exitError
+	}
+
+	return exitOK
+}
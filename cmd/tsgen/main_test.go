@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/stretchr/testify/require"
+)
+
+// root is the repository root, relative to the package.
+const root = "../.."
+
+func TestGenerate_UpToDate(t *testing.T) {
+	t.Parallel()
+
+	source, err := generate(root)
+	require.NoError(t, err)
+
+	committed, err := os.ReadFile(filepath.Join(root, "web", "protocol.ts"))
+	require.NoError(t, err)
+
+	if string(committed) != source {
+		t.Error("web/protocol.ts is out of date; run: go run ./cmd/tsgen -out web/protocol.ts")
+	}
+}
+
+func TestGenerate_CoversOpenAPISchemas(t *testing.T) {
+	t.Parallel()
+
+	var spec struct {
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.Unmarshal(apitypes.OpenAPISpec, &spec))
+
+	source, err := generate(root)
+	require.NoError(t, err)
+
+	for name := range spec.Components.Schemas {
+		require.Contains(t, source, "\nexport interface "+name+" {\n")
+	}
+}
+
+// example exercises the mapping of Go types to TypeScript.
+type example struct {
+	embedded
+
+	Name     string            `json:"name"`
+	Count    int64             `json:"count,omitempty"`
+	Ratio    float64           `json:"ratio"`
+	Enabled  bool              `json:"enabled"`
+	At       time.Time         `json:"at"`
+	Maybe    *apitypes.Webhook `json:"maybe"`
+	Data     []byte            `json:"data"`
+	Labels   map[string]int    `json:"labels"`
+	Raw      json.RawMessage   `json:"raw"`
+	Anything any               `json:"anything"`
+	Dashed   string            `json:"x-dashed"`
+	Skipped  string            `json:"-"`
+	Untagged string
+}
+
+type embedded struct {
+	Inner []string `json:"inner,omitzero"`
+}
+
+func TestGenerator_Types(t *testing.T) {
+	t.Parallel()
+
+	g := &generator{docs: docs{}, named: make(map[string]reflect.Type)}
+	g.declare(reflect.TypeFor[example]())
+	g.flush()
+	require.NoError(t, g.err)
+
+	want := `export interface example {
+  inner?: string[];
+  name: string;
+  count?: number;
+  ratio: number;
+  enabled: boolean;
+  at: string;
+  maybe: Webhook | null;
+  data: string;
+  labels: Record<string, number>;
+  raw: unknown;
+  anything: unknown;
+  "x-dashed": string;
+  Untagged: string;
+}
+
+export interface Webhook {
+`
+	require.True(t, strings.HasPrefix(g.b.String(), want), g.b.String())
+}
+
+func TestGenerator_NameClash(t *testing.T) {
+	t.Parallel()
+
+	type Webhook struct{}
+
+	g := &generator{docs: docs{}, named: make(map[string]reflect.Type)}
+	g.declare(reflect.TypeFor[apitypes.Webhook]())
+	g.declare(reflect.TypeFor[Webhook]())
+	require.ErrorContains(t, g.err, "have the same name")
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	out := filepath.Join(t.TempDir(), "protocol.ts")
+
+	var stderr bytes.Buffer
+	require.Equal(t, exitOK, run([]string{"-root", root, "-out", out}, &bytes.Buffer{}, &stderr), stderr.String())
+
+	written, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Contains(t, string(written), "export function decodeMessage(data: string): ServerMessage {")
+
+	require.Equal(t, exitUsage, run([]string{"extra"}, &bytes.Buffer{}, &bytes.Buffer{}))
+	require.Equal(t, exitError, run([]string{"-root", t.TempDir()}, &bytes.Buffer{}, &bytes.Buffer{}))
+}
@@ -28,7 +28,9 @@ func (a Action) String() string {
 	}
 }
 
-// Checker validates user permissions for document operations.
+// Checker validates user permissions for document operations. It takes
+// each user's role from its store; built on a GroupedStore, that is the
+// highest of their own role and those of their groups.
 type Checker struct {
 	store Store
 }
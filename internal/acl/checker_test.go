@@ -204,6 +204,10 @@ func (e *errorStore) ListPermissions(_ string) ([]acl.Permission, error) {
 	return nil, e.err
 }
 
+func (e *errorStore) ListDocuments(_ string) ([]acl.Permission, error) {
+	return nil, e.err
+}
+
 func TestChecker_CanPerform_StoreError(t *testing.T) {
 	t.Parallel()
 
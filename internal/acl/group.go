@@ -0,0 +1,294 @@
+package acl
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GroupPrincipalPrefix marks user IDs that stand for a group's members, so
+// granting a role to a group's principal grants it to all of them.
+const GroupPrincipalPrefix = "group:"
+
+// Group errors.
+var (
+	ErrGroupNotFound  = errors.New("group not found")
+	ErrGroupExists    = errors.New("group already exists")
+	ErrMemberNotFound = errors.New("user is not a member of the group")
+	ErrInvalidMember  = errors.New("groups and share links can't be group members")
+)
+
+// Group is a set of users that roles can be granted to together. Its owner
+// manages its members, and needn't be one.
+type Group struct {
+	ID        string
+	Name      string
+	OwnerID   string
+	Members   []string // Sorted
+	CreatedAt time.Time
+}
+
+// Principal returns the user ID roles are granted to the group's members as.
+func (g Group) Principal() string {
+	return GroupPrincipal(g.ID)
+}
+
+// GroupPrincipal returns the user ID roles are granted to a group's members as.
+func GroupPrincipal(groupID string) string {
+	return GroupPrincipalPrefix + groupID
+}
+
+// GroupStore defines the interface for persisting groups and their members.
+type GroupStore interface {
+	// CreateGroup stores a new group with its members.
+	// Returns ErrGroupExists if a group with its ID exists.
+	CreateGroup(group Group) error
+
+	// GetGroup returns a group with its members.
+	// Returns ErrGroupNotFound if the group doesn't exist.
+	GetGroup(groupID string) (Group, error)
+
+	// DeleteGroup removes a group and its memberships.
+	// Returns ErrGroupNotFound if the group doesn't exist.
+	DeleteGroup(groupID string) error
+
+	// ListGroups returns the groups the user owns or belongs to, with their
+	// members, sorted by ID.
+	ListGroups(userID string) ([]Group, error)
+
+	// AddMember makes the user a member of the group. Adding a member twice
+	// is a no-op.
+	// Returns ErrGroupNotFound if the group doesn't exist.
+	AddMember(groupID, userID string) error
+
+	// RemoveMember removes the user from the group.
+	// Returns ErrGroupNotFound if the group doesn't exist, and
+	// ErrMemberNotFound if the user isn't a member.
+	RemoveMember(groupID, userID string) error
+
+	// GroupsOf returns the IDs of the groups the user is a member of, sorted.
+	GroupsOf(userID string) ([]string, error)
+}
+
+// Groups creates groups and manages their members on behalf of their owners.
+type Groups struct {
+	store GroupStore
+}
+
+// NewGroups creates a group service.
+func NewGroups(store GroupStore) *Groups {
+	return &Groups{store: store}
+}
+
+// Create makes a group owned by ownerID, who is also its first member.
+func (g *Groups) Create(name, ownerID string) (Group, error) {
+	group := Group{
+		ID:        uuid.New().String(),
+		Name:      name,
+		OwnerID:   ownerID,
+		Members:   []string{ownerID},
+		CreatedAt: time.Now(),
+	}
+
+	if err := g.store.CreateGroup(group); err != nil {
+		return Group{}, err
+	}
+
+	return group, nil
+}
+
+// Get returns a group its owner or one of its members asks for.
+// Returns ErrGroupNotFound if the group doesn't exist or the user is neither.
+func (g *Groups) Get(groupID, userID string) (Group, error) {
+	group, err := g.store.GetGroup(groupID)
+	if err != nil {
+		return Group{}, err
+	}
+
+	if group.OwnerID != userID && !slices.Contains(group.Members, userID) {
+		return Group{}, ErrGroupNotFound
+	}
+
+	return group, nil
+}
+
+// Exists reports whether the group exists.
+func (g *Groups) Exists(groupID string) (bool, error) {
+	_, err := g.store.GetGroup(groupID)
+	if errors.Is(err, ErrGroupNotFound) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// List returns the groups the user owns or belongs to, sorted by ID.
+func (g *Groups) List(userID string) ([]Group, error) {
+	return g.store.ListGroups(userID)
+}
+
+// Delete removes a group at its owner's request. Roles granted to the group
+// stop applying to anyone.
+// Returns ErrGroupNotFound if the user can't see the group, and
+// ErrAccessDenied if they can but don't own it.
+func (g *Groups) Delete(groupID, userID string) error {
+	if _, err := g.owned(groupID, userID); err != nil {
+		return err
+	}
+
+	return g.store.DeleteGroup(groupID)
+}
+
+// AddMember adds memberID to a group at its owner's request, and returns
+// the group.
+// Returns ErrInvalidMember if memberID is a group or share link principal.
+func (g *Groups) AddMember(groupID, userID, memberID string) (Group, error) {
+	if strings.HasPrefix(memberID, GroupPrincipalPrefix) || strings.HasPrefix(memberID, LinkPrincipalPrefix) {
+		return Group{}, ErrInvalidMember
+	}
+
+	if _, err := g.owned(groupID, userID); err != nil {
+		return Group{}, err
+	}
+
+	if err := g.store.AddMember(groupID, memberID); err != nil {
+		return Group{}, err
+	}
+
+	return g.store.GetGroup(groupID)
+}
+
+// RemoveMember removes memberID from a group at its owner's request, or at
+// the member's own, and returns the group.
+func (g *Groups) RemoveMember(groupID, userID, memberID string) (Group, error) {
+	if userID == memberID {
+		if _, err := g.Get(groupID, userID); err != nil {
+			return Group{}, err
+		}
+	} else if _, err := g.owned(groupID, userID); err != nil {
+		return Group{}, err
+	}
+
+	if err := g.store.RemoveMember(groupID, memberID); err != nil {
+		return Group{}, err
+	}
+
+	return g.store.GetGroup(groupID)
+}
+
+// owned returns a group the user owns.
+func (g *Groups) owned(groupID, userID string) (Group, error) {
+	group, err := g.Get(groupID, userID)
+	if err != nil {
+		return Group{}, err
+	}
+
+	if group.OwnerID != userID {
+		return Group{}, ErrAccessDenied
+	}
+
+	return group, nil
+}
+
+// GroupedStore wraps a Store so that users also have the roles granted to
+// the groups they belong to, taking the highest of those and their own.
+// Checkers built on it treat group members like users granted the role
+// directly.
+type GroupedStore struct {
+	Store
+
+	groups GroupStore
+}
+
+// NewGroupedStore wraps store so the roles granted to groups in groups apply
+// to their members.
+func NewGroupedStore(store Store, groups GroupStore) *GroupedStore {
+	return &GroupedStore{Store: store, groups: groups}
+}
+
+// GetRole returns the highest of the user's role for a document and the
+// roles of the groups they belong to.
+func (s *GroupedStore) GetRole(docID, userID string) (Role, error) {
+	role, err := s.Store.GetRole(docID, userID)
+	found := err == nil
+
+	if err != nil && !errors.Is(err, ErrPermissionNotFound) {
+		return 0, err
+	}
+
+	groupIDs, err := s.groups.GroupsOf(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, groupID := range groupIDs {
+		groupRole, err := s.Store.GetRole(docID, GroupPrincipal(groupID))
+
+		switch {
+		case errors.Is(err, ErrPermissionNotFound):
+			continue
+		case err != nil:
+			return 0, err
+		case !found || groupRole > role:
+			role, found = groupRole, true
+		}
+	}
+
+	if !found {
+		return 0, ErrPermissionNotFound
+	}
+
+	return role, nil
+}
+
+// ListDocuments returns the user's highest role on every document they have
+// one on, directly or through their groups, sorted by document ID.
+func (s *GroupedStore) ListDocuments(userID string) ([]Permission, error) {
+	perms, err := s.Store.ListDocuments(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	groupIDs, err := s.groups.GroupsOf(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(groupIDs) == 0 {
+		return perms, nil
+	}
+
+	roles := make(map[string]Role, len(perms))
+	for _, perm := range perms {
+		roles[perm.DocID] = perm.Role
+	}
+
+	for _, groupID := range groupIDs {
+		groupPerms, err := s.Store.ListDocuments(GroupPrincipal(groupID))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, perm := range groupPerms {
+			if role, ok := roles[perm.DocID]; !ok || perm.Role > role {
+				roles[perm.DocID] = perm.Role
+			}
+		}
+	}
+
+	result := make([]Permission, 0, len(roles))
+	for docID, role := range roles {
+		result = append(result, Permission{DocID: docID, UserID: userID, Role: role})
+	}
+
+	slices.SortFunc(result, func(a, b Permission) int { return cmp.Compare(a.DocID, b.DocID) })
+
+	return result, nil
+}
+
+// Ensure GroupedStore implements Store.
+var _ Store = (*GroupedStore)(nil)
@@ -0,0 +1,264 @@
+package acl_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroups(t *testing.T) {
+	t.Parallel()
+
+	groups := acl.NewGroups(acl.NewMemoryGroupStore())
+
+	group, err := groups.Create("Engineering", "alice")
+	require.NoError(t, err)
+	require.Equal(t, "group:"+group.ID, group.Principal())
+	require.Equal(t, []string{"alice"}, group.Members)
+
+	// The owner manages the members
+	group, err = groups.AddMember(group.ID, "alice", "bob")
+	require.NoError(t, err)
+	require.Equal(t, []string{"alice", "bob"}, group.Members)
+
+	_, err = groups.AddMember(group.ID, "bob", "carol")
+	require.ErrorIs(t, err, acl.ErrAccessDenied)
+
+	_, err = groups.AddMember(group.ID, "alice", "group:other")
+	require.ErrorIs(t, err, acl.ErrInvalidMember)
+
+	exists, err := groups.Exists(group.ID)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	exists, err = groups.Exists("missing")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// Outsiders can't see the group
+	_, err = groups.Get(group.ID, "carol")
+	require.ErrorIs(t, err, acl.ErrGroupNotFound)
+
+	require.ErrorIs(t, groups.Delete(group.ID, "carol"), acl.ErrGroupNotFound)
+
+	listed, err := groups.List("bob")
+	require.NoError(t, err)
+	require.Equal(t, []acl.Group{group}, listed)
+
+	// Only the owner removes others
+	_, err = groups.RemoveMember(group.ID, "bob", "alice")
+	require.ErrorIs(t, err, acl.ErrAccessDenied)
+
+	_, err = groups.RemoveMember(group.ID, "carol", "carol")
+	require.ErrorIs(t, err, acl.ErrGroupNotFound)
+
+	// Members may leave, and the owner keeps managing the group after leaving
+	group, err = groups.RemoveMember(group.ID, "bob", "bob")
+	require.NoError(t, err)
+	require.Equal(t, []string{"alice"}, group.Members)
+
+	group, err = groups.RemoveMember(group.ID, "alice", "alice")
+	require.NoError(t, err)
+	require.Empty(t, group.Members)
+
+	_, err = groups.RemoveMember(group.ID, "alice", "alice")
+	require.ErrorIs(t, err, acl.ErrMemberNotFound)
+
+	_, err = groups.Get(group.ID, "alice")
+	require.NoError(t, err)
+
+	require.ErrorIs(t, groups.Delete(group.ID, "bob"), acl.ErrGroupNotFound)
+	require.NoError(t, groups.Delete(group.ID, "alice"))
+
+	_, err = groups.Get(group.ID, "alice")
+	require.ErrorIs(t, err, acl.ErrGroupNotFound)
+}
+
+// newGroupedStore returns a grouped store where alice and bob are in
+// Engineering and bob in Leads, and the group service managing them.
+func newGroupedStore(t *testing.T) (*acl.GroupedStore, *acl.Groups, acl.Group) {
+	t.Helper()
+
+	groupStore := acl.NewMemoryGroupStore()
+	groups := acl.NewGroups(groupStore)
+	store := acl.NewGroupedStore(acl.NewMemoryStore(), groupStore)
+
+	eng, err := groups.Create("Engineering", "alice")
+	require.NoError(t, err)
+
+	_, err = groups.AddMember(eng.ID, "alice", "bob")
+	require.NoError(t, err)
+
+	leads, err := groups.Create("Leads", "bob")
+	require.NoError(t, err)
+
+	require.NoError(t, store.Grant("doc1", eng.Principal(), acl.Viewer))
+	require.NoError(t, store.Grant("doc1", leads.Principal(), acl.Editor))
+	require.NoError(t, store.Grant("doc2", eng.Principal(), acl.Editor))
+	require.NoError(t, store.Grant("doc2", "bob", acl.Owner))
+	require.NoError(t, store.Grant("doc3", "alice", acl.Viewer))
+	require.NoError(t, store.Grant("doc3", eng.Principal(), acl.Editor))
+
+	return store, groups, leads
+}
+
+func TestGroupedStore_GetRole(t *testing.T) {
+	t.Parallel()
+
+	store, _, _ := newGroupedStore(t)
+
+	tests := []struct {
+		name   string
+		docID  string
+		userID string
+		want   acl.Role
+		found  bool
+	}{
+		{"through a group", "doc1", "alice", acl.Viewer, true},
+		{"highest of two groups", "doc1", "bob", acl.Editor, true},
+		{"own role above the group's", "doc2", "bob", acl.Owner, true},
+		{"group role above their own", "doc3", "alice", acl.Editor, true},
+		{"not in a group", "doc1", "carol", 0, false},
+		{"no grant", "doc4", "bob", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			role, err := store.GetRole(tt.docID, tt.userID)
+			if !tt.found {
+				require.ErrorIs(t, err, acl.ErrPermissionNotFound)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.want, role)
+
+			allowed, err := acl.NewChecker(store).CanPerform(tt.docID, tt.userID, acl.ActionRead)
+			require.NoError(t, err)
+			require.True(t, allowed)
+		})
+	}
+}
+
+func TestGroupedStore_ListDocuments(t *testing.T) {
+	t.Parallel()
+
+	store, groups, leads := newGroupedStore(t)
+
+	perms, err := store.ListDocuments("bob")
+	require.NoError(t, err)
+	require.Equal(t, []acl.Permission{
+		{DocID: "doc1", UserID: "bob", Role: acl.Editor},
+		{DocID: "doc2", UserID: "bob", Role: acl.Owner},
+		{DocID: "doc3", UserID: "bob", Role: acl.Editor},
+	}, perms)
+
+	// Leaving a group gives up its roles
+	_, err = groups.RemoveMember(leads.ID, "bob", "bob")
+	require.NoError(t, err)
+
+	perms, err = store.ListDocuments("bob")
+	require.NoError(t, err)
+	require.Equal(t, acl.Viewer, perms[0].Role)
+
+	perms, err = store.ListDocuments("carol")
+	require.NoError(t, err)
+	require.Empty(t, perms)
+}
+
+var errGroups = errors.New("groups unavailable")
+
+// failingGroupStore is a MemoryGroupStore whose writes and membership
+// lookups fail, as do reads of the group "broken".
+type failingGroupStore struct {
+	*acl.MemoryGroupStore
+}
+
+func (s failingGroupStore) GetGroup(groupID string) (acl.Group, error) {
+	if groupID == "broken" {
+		return acl.Group{}, errGroups
+	}
+
+	return s.MemoryGroupStore.GetGroup(groupID)
+}
+
+func (failingGroupStore) CreateGroup(acl.Group) error { return errGroups }
+
+func (failingGroupStore) AddMember(string, string) error { return errGroups }
+
+func (failingGroupStore) GroupsOf(string) ([]string, error) { return nil, errGroups }
+
+// failingPrincipalStore is a MemoryStore whose reads fail for one principal.
+type failingPrincipalStore struct {
+	*acl.MemoryStore
+
+	principal string
+}
+
+func (s failingPrincipalStore) GetRole(docID, userID string) (acl.Role, error) {
+	if userID == s.principal {
+		return 0, errGroups
+	}
+
+	return s.MemoryStore.GetRole(docID, userID)
+}
+
+func (s failingPrincipalStore) ListDocuments(userID string) ([]acl.Permission, error) {
+	if userID == s.principal {
+		return nil, errGroups
+	}
+
+	return s.MemoryStore.ListDocuments(userID)
+}
+
+func TestGroups_StoreErrors(t *testing.T) {
+	t.Parallel()
+
+	groupStore := acl.NewMemoryGroupStore()
+	require.NoError(t, groupStore.CreateGroup(acl.Group{ID: "eng", Name: "Engineering", OwnerID: "alice"}))
+
+	groups := acl.NewGroups(failingGroupStore{MemoryGroupStore: groupStore})
+
+	_, err := groups.Create("Leads", "alice")
+	require.ErrorIs(t, err, errGroups)
+
+	_, err = groups.AddMember("eng", "alice", "bob")
+	require.ErrorIs(t, err, errGroups)
+
+	exists, err := groups.Exists("broken")
+	require.Error(t, err)
+	require.False(t, exists)
+}
+
+func TestGroupedStore_StoreErrors(t *testing.T) {
+	t.Parallel()
+
+	failing := acl.NewGroupedStore(acl.NewMemoryStore(), failingGroupStore{MemoryGroupStore: acl.NewMemoryGroupStore()})
+
+	_, err := failing.GetRole("doc1", "alice")
+	require.ErrorIs(t, err, errGroups)
+
+	_, err = failing.ListDocuments("alice")
+	require.ErrorIs(t, err, errGroups)
+
+	// Lookups of the user's own roles, or their group's, fail too
+	groupStore := acl.NewMemoryGroupStore()
+	require.NoError(t, groupStore.CreateGroup(acl.Group{ID: "eng", Name: "Engineering", OwnerID: "alice"}))
+	require.NoError(t, groupStore.AddMember("eng", "alice"))
+
+	for _, principal := range []string{"alice", acl.GroupPrincipal("eng")} {
+		roles := failingPrincipalStore{MemoryStore: acl.NewMemoryStore(), principal: principal}
+		store := acl.NewGroupedStore(roles, groupStore)
+
+		_, err = store.GetRole("doc1", "alice")
+		require.ErrorIs(t, err, errGroups, principal)
+
+		_, err = store.ListDocuments("alice")
+		require.ErrorIs(t, err, errGroups, principal)
+	}
+}
@@ -0,0 +1,151 @@
+package acl
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// MemoryGroupStore is an in-memory implementation of the GroupStore interface.
+type MemoryGroupStore struct {
+	mu      sync.RWMutex
+	groups  map[string]Group               // group ID -> group, without members
+	members map[string]map[string]struct{} // group ID -> member IDs
+}
+
+// NewMemoryGroupStore creates a new in-memory group store.
+func NewMemoryGroupStore() *MemoryGroupStore {
+	return &MemoryGroupStore{
+		groups:  make(map[string]Group),
+		members: make(map[string]map[string]struct{}),
+	}
+}
+
+// CreateGroup stores a new group with its members.
+func (m *MemoryGroupStore) CreateGroup(group Group) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.groups[group.ID]; exists {
+		return ErrGroupExists
+	}
+
+	members := make(map[string]struct{}, len(group.Members))
+	for _, userID := range group.Members {
+		members[userID] = struct{}{}
+	}
+
+	group.Members = nil
+	m.groups[group.ID] = group
+	m.members[group.ID] = members
+
+	return nil
+}
+
+// GetGroup returns a group with its members.
+func (m *MemoryGroupStore) GetGroup(groupID string) (Group, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, exists := m.groups[groupID]; !exists {
+		return Group{}, ErrGroupNotFound
+	}
+
+	return m.withMembers(groupID), nil
+}
+
+// DeleteGroup removes a group and its memberships.
+func (m *MemoryGroupStore) DeleteGroup(groupID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.groups[groupID]; !exists {
+		return ErrGroupNotFound
+	}
+
+	delete(m.groups, groupID)
+	delete(m.members, groupID)
+
+	return nil
+}
+
+// ListGroups returns the groups the user owns or belongs to, sorted by ID.
+func (m *MemoryGroupStore) ListGroups(userID string) ([]Group, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []Group
+
+	for groupID, group := range m.groups {
+		if _, member := m.members[groupID][userID]; member || group.OwnerID == userID {
+			result = append(result, m.withMembers(groupID))
+		}
+	}
+
+	slices.SortFunc(result, func(a, b Group) int { return cmp.Compare(a.ID, b.ID) })
+
+	return result, nil
+}
+
+// AddMember makes the user a member of the group.
+func (m *MemoryGroupStore) AddMember(groupID, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.groups[groupID]; !exists {
+		return ErrGroupNotFound
+	}
+
+	m.members[groupID][userID] = struct{}{}
+
+	return nil
+}
+
+// RemoveMember removes the user from the group.
+func (m *MemoryGroupStore) RemoveMember(groupID, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.groups[groupID]; !exists {
+		return ErrGroupNotFound
+	}
+
+	if _, member := m.members[groupID][userID]; !member {
+		return ErrMemberNotFound
+	}
+
+	delete(m.members[groupID], userID)
+
+	return nil
+}
+
+// GroupsOf returns the IDs of the groups the user is a member of, sorted.
+func (m *MemoryGroupStore) GroupsOf(userID string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []string
+
+	for groupID, members := range m.members {
+		if _, member := members[userID]; member {
+			result = append(result, groupID)
+		}
+	}
+
+	slices.Sort(result)
+
+	return result, nil
+}
+
+// withMembers returns the group with its sorted members. The caller holds
+// the lock.
+func (m *MemoryGroupStore) withMembers(groupID string) Group {
+	group := m.groups[groupID]
+	group.Members = slices.Sorted(maps.Keys(m.members[groupID]))
+
+	return group
+}
+
+// Ensure MemoryGroupStore implements GroupStore.
+var _ GroupStore = (*MemoryGroupStore)(nil)
@@ -0,0 +1,177 @@
+package acl
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LinkPrincipalPrefix marks user IDs that stand for whoever holds a share
+// link's token.
+const LinkPrincipalPrefix = "link:"
+
+// tokenPrefix identifies share link tokens.
+const tokenPrefix = "odl_"
+
+// Share link errors.
+var (
+	ErrLinkNotFound = errors.New("share link not found")
+	ErrInvalidLink  = errors.New("invalid or expired share link")
+)
+
+// ShareLink gives anyone holding its token a role on one document until it
+// expires. The token itself is never stored, only its hash.
+type ShareLink struct {
+	ID        string
+	DocID     string
+	Role      Role
+	CreatedBy string
+	CreatedAt time.Time
+	ExpiresAt time.Time // Zero if the link never expires
+}
+
+// Principal returns the user ID the link's holders act as.
+func (l ShareLink) Principal() string {
+	return LinkPrincipalPrefix + l.ID
+}
+
+// Expired returns true if the link no longer grants its role at now.
+func (l ShareLink) Expired(now time.Time) bool {
+	return !l.ExpiresAt.IsZero() && !now.Before(l.ExpiresAt)
+}
+
+// LinkStore defines the interface for persisting share links.
+type LinkStore interface {
+	// Save stores a link together with the hash of its token.
+	Save(link ShareLink, tokenHash string) error
+
+	// GetByHash returns the link whose token has the given hash.
+	// Returns ErrLinkNotFound if no link matches.
+	GetByHash(tokenHash string) (ShareLink, error)
+
+	// Get returns a link by ID.
+	// Returns ErrLinkNotFound if the link doesn't exist.
+	Get(linkID string) (ShareLink, error)
+}
+
+// Links creates share links and resolves their tokens.
+type Links struct {
+	store LinkStore
+}
+
+// NewLinks creates a share link service.
+func NewLinks(store LinkStore) *Links {
+	return &Links{store: store}
+}
+
+// Create mints a link giving its holders role on the document until
+// expiresAt, or for good if it's zero. It returns the link and its token;
+// the token cannot be recovered later.
+func (l *Links) Create(docID string, role Role, createdBy string, expiresAt time.Time) (ShareLink, string, error) {
+	token, err := generateToken()
+	if err != nil {
+		return ShareLink{}, "", err
+	}
+
+	link := ShareLink{
+		ID:        uuid.New().String(),
+		DocID:     docID,
+		Role:      role,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+
+	if err := l.store.Save(link, hashToken(token)); err != nil {
+		return ShareLink{}, "", err
+	}
+
+	return link, token, nil
+}
+
+// Resolve returns the link a token belongs to.
+// Returns ErrInvalidLink if the token is malformed, unknown or expired.
+func (l *Links) Resolve(token string) (ShareLink, error) {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return ShareLink{}, ErrInvalidLink
+	}
+
+	link, err := l.store.GetByHash(hashToken(token))
+	if err != nil {
+		if errors.Is(err, ErrLinkNotFound) {
+			return ShareLink{}, ErrInvalidLink
+		}
+
+		return ShareLink{}, err
+	}
+
+	if link.Expired(time.Now()) {
+		return ShareLink{}, ErrInvalidLink
+	}
+
+	return link, nil
+}
+
+// LinkedStore wraps a Store so that link principals have their link's role
+// on its document while it lasts, and none elsewhere. Checkers built on it
+// treat link holders like any other user.
+type LinkedStore struct {
+	Store
+
+	links LinkStore
+}
+
+// NewLinkedStore wraps store so the links in links grant roles.
+func NewLinkedStore(store Store, links LinkStore) *LinkedStore {
+	return &LinkedStore{Store: store, links: links}
+}
+
+// GetRole returns the user's role for a document, or the link's role if the
+// user is a link principal.
+func (s *LinkedStore) GetRole(docID, userID string) (Role, error) {
+	linkID, ok := strings.CutPrefix(userID, LinkPrincipalPrefix)
+	if !ok {
+		return s.Store.GetRole(docID, userID)
+	}
+
+	link, err := s.links.Get(linkID)
+	if err != nil {
+		if errors.Is(err, ErrLinkNotFound) {
+			return 0, ErrPermissionNotFound
+		}
+
+		return 0, err
+	}
+
+	if link.DocID != docID || link.Expired(time.Now()) {
+		return 0, ErrPermissionNotFound
+	}
+
+	return link.Role, nil
+}
+
+// generateToken returns a new random link token.
+func generateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return tokenPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken returns the hex SHA-256 hash of a token.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Ensure LinkedStore implements Store.
+var _ Store = (*LinkedStore)(nil)
@@ -0,0 +1,74 @@
+package acl_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinks_Resolve(t *testing.T) {
+	t.Parallel()
+
+	links := acl.NewLinks(acl.NewMemoryLinkStore())
+
+	link, token, err := links.Create("doc1", acl.Editor, "alice", time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, "link:"+link.ID, link.Principal())
+
+	resolved, err := links.Resolve(token)
+	require.NoError(t, err)
+	require.Equal(t, link, resolved)
+
+	_, expired, err := links.Create("doc1", acl.Viewer, "alice", time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+
+	for _, token := range []string{expired, "odl_unknown", "not-a-token"} {
+		_, err := links.Resolve(token)
+		require.ErrorIs(t, err, acl.ErrInvalidLink, token)
+	}
+}
+
+func TestLinkedStore_GetRole(t *testing.T) {
+	t.Parallel()
+
+	linkStore := acl.NewMemoryLinkStore()
+	links := acl.NewLinks(linkStore)
+	store := acl.NewLinkedStore(acl.NewMemoryStore(), linkStore)
+	require.NoError(t, store.Grant("doc1", "alice", acl.Owner))
+
+	editor, _, err := links.Create("doc1", acl.Editor, "alice", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	expired, _, err := links.Create("doc1", acl.Editor, "alice", time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+
+	role, err := store.GetRole("doc1", editor.Principal())
+	require.NoError(t, err)
+	require.Equal(t, acl.Editor, role)
+
+	role, err = store.GetRole("doc1", "alice")
+	require.NoError(t, err)
+	require.Equal(t, acl.Owner, role)
+
+	tests := []struct {
+		name   string
+		docID  string
+		userID string
+	}{
+		{"other document", "doc2", editor.Principal()},
+		{"expired", "doc1", expired.Principal()},
+		{"unknown link", "doc1", "link:unknown"},
+	}
+
+	for _, tt := range tests {
+		_, err := store.GetRole(tt.docID, tt.userID)
+		require.ErrorIs(t, err, acl.ErrPermissionNotFound, tt.name)
+	}
+
+	// The checker treats link holders like other users
+	checker := acl.NewChecker(store)
+	require.NoError(t, checker.RequirePermission("doc1", editor.Principal(), acl.ActionWrite))
+	require.ErrorIs(t, checker.RequirePermission("doc1", editor.Principal(), acl.ActionShare), acl.ErrAccessDenied)
+}
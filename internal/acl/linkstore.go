@@ -0,0 +1,58 @@
+package acl
+
+import "sync"
+
+// MemoryLinkStore is an in-memory implementation of the LinkStore interface.
+type MemoryLinkStore struct {
+	mu     sync.RWMutex
+	links  map[string]ShareLink // link ID -> link
+	hashes map[string]string    // token hash -> link ID
+}
+
+// NewMemoryLinkStore creates a new in-memory share link store.
+func NewMemoryLinkStore() *MemoryLinkStore {
+	return &MemoryLinkStore{
+		links:  make(map[string]ShareLink),
+		hashes: make(map[string]string),
+	}
+}
+
+// Save stores a link together with the hash of its token.
+func (m *MemoryLinkStore) Save(link ShareLink, tokenHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.links[link.ID] = link
+	m.hashes[tokenHash] = link.ID
+
+	return nil
+}
+
+// GetByHash returns the link whose token has the given hash.
+func (m *MemoryLinkStore) GetByHash(tokenHash string) (ShareLink, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	linkID, exists := m.hashes[tokenHash]
+	if !exists {
+		return ShareLink{}, ErrLinkNotFound
+	}
+
+	return m.links[linkID], nil
+}
+
+// Get returns a link by ID.
+func (m *MemoryLinkStore) Get(linkID string) (ShareLink, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	link, exists := m.links[linkID]
+	if !exists {
+		return ShareLink{}, ErrLinkNotFound
+	}
+
+	return link, nil
+}
+
+// Ensure MemoryLinkStore implements LinkStore.
+var _ LinkStore = (*MemoryLinkStore)(nil)
@@ -1,6 +1,10 @@
 package acl
 
-import "sync"
+import (
+	"cmp"
+	"slices"
+	"sync"
+)
 
 // permissionKey uniquely identifies a user-document permission.
 type permissionKey struct {
@@ -83,5 +87,28 @@ func (m *MemoryStore) ListPermissions(docID string) ([]Permission, error) {
 	return result, nil
 }
 
+// ListDocuments returns the user's permissions on every document, sorted by
+// document ID.
+func (m *MemoryStore) ListDocuments(userID string) ([]Permission, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []Permission
+
+	for key, role := range m.permissions {
+		if key.userID == userID {
+			result = append(result, Permission{
+				DocID:  key.docID,
+				UserID: key.userID,
+				Role:   role,
+			})
+		}
+	}
+
+	slices.SortFunc(result, func(a, b Permission) int { return cmp.Compare(a.DocID, b.DocID) })
+
+	return result, nil
+}
+
 // Ensure MemoryStore implements Store.
 var _ Store = (*MemoryStore)(nil)
@@ -114,6 +114,27 @@ func TestMemoryStore_ListPermissions_Empty(t *testing.T) {
 	}
 }
 
+func TestMemoryStore_ListDocuments(t *testing.T) {
+	t.Parallel()
+
+	store := acl.NewMemoryStore()
+
+	require.NoError(t, store.Grant("doc2", "user1", acl.Editor))
+	require.NoError(t, store.Grant("doc1", "user1", acl.Owner))
+	require.NoError(t, store.Grant("doc3", "user2", acl.Viewer)) // Different user
+
+	perms, err := store.ListDocuments("user1")
+	require.NoError(t, err)
+	require.Equal(t, []acl.Permission{
+		{DocID: "doc1", UserID: "user1", Role: acl.Owner},
+		{DocID: "doc2", UserID: "user1", Role: acl.Editor},
+	}, perms)
+
+	perms, err = store.ListDocuments("nobody")
+	require.NoError(t, err)
+	require.Empty(t, perms)
+}
+
 func TestMemoryStore_MultipleDocuments(t *testing.T) {
 	t.Parallel()
 
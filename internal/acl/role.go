@@ -26,6 +26,17 @@ func (r Role) String() string {
 	}
 }
 
+// ParseRole converts a role name, as returned by String, into a Role.
+func ParseRole(name string) (Role, error) {
+	for _, role := range []Role{Viewer, Editor, Owner} {
+		if role.String() == name {
+			return role, nil
+		}
+	}
+
+	return 0, ErrInvalidRole
+}
+
 // CanRead returns true if the role allows reading.
 func (r Role) CanRead() bool {
 	return r >= Viewer
@@ -1,6 +1,7 @@
 package acl_test
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/serroba/online-docs/internal/acl"
@@ -63,3 +64,20 @@ func TestRole_Permissions(t *testing.T) {
 		})
 	}
 }
+
+func TestParseRole(t *testing.T) {
+	t.Parallel()
+
+	for _, role := range []acl.Role{acl.Viewer, acl.Editor, acl.Owner} {
+		got, err := acl.ParseRole(role.String())
+		if err != nil || got != role {
+			t.Errorf("ParseRole(%q) = %v, %v; expected %v", role.String(), got, err, role)
+		}
+	}
+
+	for _, name := range []string{"", "admin", "Owner", "unknown"} {
+		if _, err := acl.ParseRole(name); !errors.Is(err, acl.ErrInvalidRole) {
+			t.Errorf("ParseRole(%q): expected ErrInvalidRole, got %v", name, err)
+		}
+	}
+}
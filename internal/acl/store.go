@@ -6,6 +6,7 @@ import "errors"
 var (
 	ErrPermissionNotFound = errors.New("permission not found")
 	ErrAccessDenied       = errors.New("access denied")
+	ErrInvalidRole        = errors.New("invalid role")
 )
 
 // Store defines the interface for persisting document permissions.
@@ -24,4 +25,8 @@ type Store interface {
 
 	// ListPermissions returns all permissions for a document.
 	ListPermissions(docID string) ([]Permission, error)
+
+	// ListDocuments returns the user's permissions on every document they
+	// have a role on, sorted by document ID.
+	ListDocuments(userID string) ([]Permission, error)
 }
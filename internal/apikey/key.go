@@ -0,0 +1,54 @@
+// Package apikey manages API keys that authenticate service accounts.
+package apikey
+
+import (
+	"slices"
+	"time"
+
+	"github.com/serroba/online-docs/internal/acl"
+)
+
+// PrincipalPrefix marks user IDs that belong to service accounts.
+const PrincipalPrefix = "service:"
+
+// Scope limits which actions a key may perform.
+// Scopes use the same names as acl actions.
+type Scope string
+
+const (
+	ScopeRead   Scope = "read"
+	ScopeWrite  Scope = "write"
+	ScopeShare  Scope = "share"
+	ScopeDelete Scope = "delete"
+)
+
+// ParseScope converts a scope name into a Scope.
+func ParseScope(name string) (Scope, error) {
+	switch scope := Scope(name); scope {
+	case ScopeRead, ScopeWrite, ScopeShare, ScopeDelete:
+		return scope, nil
+	default:
+		return "", ErrInvalidScope
+	}
+}
+
+// Key is an API key bound to a service identity.
+// The secret itself is never stored, only its hash.
+type Key struct {
+	ID          string
+	OwnerID     string // User who created the key
+	ServiceName string
+	Scopes      []Scope
+	CreatedAt   time.Time
+}
+
+// Principal returns the user ID the key authenticates as.
+// It is namespaced by owner so services of different users never collide.
+func (k Key) Principal() string {
+	return PrincipalPrefix + k.OwnerID + "/" + k.ServiceName
+}
+
+// Allows returns true if the key's scopes permit the action.
+func (k Key) Allows(action acl.Action) bool {
+	return slices.Contains(k.Scopes, Scope(action.String()))
+}
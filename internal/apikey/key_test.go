@@ -0,0 +1,61 @@
+package apikey_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apikey"
+)
+
+func TestParseScope(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"read", "write", "share", "delete"} {
+		scope, err := apikey.ParseScope(name)
+		if err != nil {
+			t.Errorf("ParseScope(%q) returned error: %v", name, err)
+		}
+
+		if string(scope) != name {
+			t.Errorf("ParseScope(%q) = %q", name, scope)
+		}
+	}
+
+	_, err := apikey.ParseScope("admin")
+	if !errors.Is(err, apikey.ErrInvalidScope) {
+		t.Errorf("expected ErrInvalidScope, got %v", err)
+	}
+}
+
+func TestKey_Principal(t *testing.T) {
+	t.Parallel()
+
+	key := apikey.Key{OwnerID: "alice", ServiceName: "ci-bot"}
+
+	if got := key.Principal(); got != "service:alice/ci-bot" {
+		t.Errorf("expected 'service:alice/ci-bot', got %q", got)
+	}
+}
+
+func TestKey_Allows(t *testing.T) {
+	t.Parallel()
+
+	key := apikey.Key{Scopes: []apikey.Scope{apikey.ScopeRead, apikey.ScopeWrite}}
+
+	tests := []struct {
+		action acl.Action
+		want   bool
+	}{
+		{acl.ActionRead, true},
+		{acl.ActionWrite, true},
+		{acl.ActionShare, false},
+		{acl.ActionDelete, false},
+	}
+
+	for _, tt := range tests {
+		if got := key.Allows(tt.action); got != tt.want {
+			t.Errorf("Allows(%v) = %v, want %v", tt.action, got, tt.want)
+		}
+	}
+}
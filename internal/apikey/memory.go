@@ -0,0 +1,101 @@
+package apikey
+
+import (
+	"slices"
+	"sync"
+)
+
+// MemoryStore is an in-memory implementation of the Store interface.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	keys   map[string]Key    // key ID -> key
+	hashes map[string]string // secret hash -> key ID
+}
+
+// NewMemoryStore creates a new in-memory API key store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		keys:   make(map[string]Key),
+		hashes: make(map[string]string),
+	}
+}
+
+// Save stores a key together with the hash of its secret.
+func (m *MemoryStore) Save(key Key, secretHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.keys[key.ID] = key
+	m.hashes[secretHash] = key.ID
+
+	return nil
+}
+
+// GetByHash returns the key whose secret has the given hash.
+func (m *MemoryStore) GetByHash(secretHash string) (Key, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keyID, exists := m.hashes[secretHash]
+	if !exists {
+		return Key{}, ErrKeyNotFound
+	}
+
+	return m.keys[keyID], nil
+}
+
+// Get returns a key by ID.
+func (m *MemoryStore) Get(keyID string) (Key, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key, exists := m.keys[keyID]
+	if !exists {
+		return Key{}, ErrKeyNotFound
+	}
+
+	return key, nil
+}
+
+// Delete removes a key.
+func (m *MemoryStore) Delete(keyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.keys[keyID]; !exists {
+		return ErrKeyNotFound
+	}
+
+	delete(m.keys, keyID)
+
+	for hash, id := range m.hashes {
+		if id == keyID {
+			delete(m.hashes, hash)
+		}
+	}
+
+	return nil
+}
+
+// ListByOwner returns all keys created by a user, oldest first.
+func (m *MemoryStore) ListByOwner(ownerID string) ([]Key, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []Key
+
+	for _, key := range m.keys {
+		if key.OwnerID == ownerID {
+			result = append(result, key)
+		}
+	}
+
+	slices.SortFunc(result, func(a, b Key) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return result, nil
+}
+
+// Ensure MemoryStore implements Store.
+var _ Store = (*MemoryStore)(nil)
@@ -0,0 +1,85 @@
+package apikey_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/apikey"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore_SaveAndGet(t *testing.T) {
+	t.Parallel()
+
+	store := apikey.NewMemoryStore()
+	key := apikey.Key{ID: "k1", OwnerID: "alice", ServiceName: "bot"}
+
+	require.NoError(t, store.Save(key, "hash1"))
+
+	got, err := store.Get("k1")
+	require.NoError(t, err)
+
+	if got.ServiceName != "bot" {
+		t.Errorf("expected service 'bot', got %q", got.ServiceName)
+	}
+
+	got, err = store.GetByHash("hash1")
+	require.NoError(t, err)
+
+	if got.ID != "k1" {
+		t.Errorf("expected key 'k1', got %q", got.ID)
+	}
+}
+
+func TestMemoryStore_NotFound(t *testing.T) {
+	t.Parallel()
+
+	store := apikey.NewMemoryStore()
+
+	if _, err := store.Get("missing"); !errors.Is(err, apikey.ErrKeyNotFound) {
+		t.Errorf("Get: expected ErrKeyNotFound, got %v", err)
+	}
+
+	if _, err := store.GetByHash("missing"); !errors.Is(err, apikey.ErrKeyNotFound) {
+		t.Errorf("GetByHash: expected ErrKeyNotFound, got %v", err)
+	}
+
+	if err := store.Delete("missing"); !errors.Is(err, apikey.ErrKeyNotFound) {
+		t.Errorf("Delete: expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestMemoryStore_Delete(t *testing.T) {
+	t.Parallel()
+
+	store := apikey.NewMemoryStore()
+	require.NoError(t, store.Save(apikey.Key{ID: "k1"}, "hash1"))
+	require.NoError(t, store.Delete("k1"))
+
+	if _, err := store.GetByHash("hash1"); !errors.Is(err, apikey.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound after delete, got %v", err)
+	}
+}
+
+func TestMemoryStore_ListByOwner(t *testing.T) {
+	t.Parallel()
+
+	store := apikey.NewMemoryStore()
+	now := time.Now()
+
+	require.NoError(t, store.Save(apikey.Key{ID: "k2", OwnerID: "alice", CreatedAt: now.Add(time.Second)}, "h2"))
+	require.NoError(t, store.Save(apikey.Key{ID: "k1", OwnerID: "alice", CreatedAt: now}, "h1"))
+	require.NoError(t, store.Save(apikey.Key{ID: "k3", OwnerID: "bob", CreatedAt: now}, "h3"))
+
+	keys, err := store.ListByOwner("alice")
+	require.NoError(t, err)
+
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(keys))
+	}
+
+	if keys[0].ID != "k1" || keys[1].ID != "k2" {
+		t.Errorf("expected keys ordered by creation, got %q, %q", keys[0].ID, keys[1].ID)
+	}
+}
@@ -0,0 +1,105 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// secretPrefix identifies API key secrets.
+const secretPrefix = "odk_"
+
+// Service issues, authenticates, and revokes API keys.
+type Service struct {
+	store Store
+}
+
+// NewService creates a new API key service.
+func NewService(store Store) *Service {
+	return &Service{store: store}
+}
+
+// Issue creates a key for a service owned by ownerID.
+// It returns the key and its secret; the secret cannot be recovered later.
+func (s *Service) Issue(ownerID, serviceName string, scopes []Scope) (Key, string, error) {
+	secret, err := generateSecret()
+	if err != nil {
+		return Key{}, "", err
+	}
+
+	key := Key{
+		ID:          uuid.New().String(),
+		OwnerID:     ownerID,
+		ServiceName: serviceName,
+		Scopes:      scopes,
+		CreatedAt:   time.Now(),
+	}
+
+	if err := s.store.Save(key, hashSecret(secret)); err != nil {
+		return Key{}, "", err
+	}
+
+	return key, secret, nil
+}
+
+// Authenticate returns the key matching a secret.
+// Returns ErrInvalidKey if the secret is malformed or unknown.
+func (s *Service) Authenticate(secret string) (Key, error) {
+	if !strings.HasPrefix(secret, secretPrefix) {
+		return Key{}, ErrInvalidKey
+	}
+
+	key, err := s.store.GetByHash(hashSecret(secret))
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return Key{}, ErrInvalidKey
+		}
+
+		return Key{}, err
+	}
+
+	return key, nil
+}
+
+// Revoke deletes a key owned by ownerID.
+// Returns ErrKeyNotFound if the key doesn't exist or belongs to someone else.
+func (s *Service) Revoke(ownerID, keyID string) error {
+	key, err := s.store.Get(keyID)
+	if err != nil {
+		return err
+	}
+
+	if key.OwnerID != ownerID {
+		return ErrKeyNotFound
+	}
+
+	return s.store.Delete(keyID)
+}
+
+// List returns the keys owned by a user.
+func (s *Service) List(ownerID string) ([]Key, error) {
+	return s.store.ListByOwner(ownerID)
+}
+
+// generateSecret returns a new random key secret.
+func generateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return secretPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashSecret returns the hex SHA-256 hash of a secret.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,118 @@
+package apikey_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/apikey"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_IssueAndAuthenticate(t *testing.T) {
+	t.Parallel()
+
+	service := apikey.NewService(apikey.NewMemoryStore())
+
+	key, secret, err := service.Issue("alice", "bot", []apikey.Scope{apikey.ScopeRead})
+	require.NoError(t, err)
+
+	if !strings.HasPrefix(secret, "odk_") {
+		t.Errorf("expected secret with odk_ prefix, got %q", secret)
+	}
+
+	got, err := service.Authenticate(secret)
+	require.NoError(t, err)
+
+	if got.ID != key.ID {
+		t.Errorf("expected key %q, got %q", key.ID, got.ID)
+	}
+}
+
+func TestService_Authenticate_Invalid(t *testing.T) {
+	t.Parallel()
+
+	service := apikey.NewService(apikey.NewMemoryStore())
+
+	for _, secret := range []string{"", "not-a-key", "odk_unknown"} {
+		if _, err := service.Authenticate(secret); !errors.Is(err, apikey.ErrInvalidKey) {
+			t.Errorf("Authenticate(%q): expected ErrInvalidKey, got %v", secret, err)
+		}
+	}
+}
+
+func TestService_Authenticate_StoreError(t *testing.T) {
+	t.Parallel()
+
+	service := apikey.NewService(&errorStore{err: errors.New("store down")})
+
+	_, err := service.Authenticate("odk_anything")
+	if err == nil || errors.Is(err, apikey.ErrInvalidKey) {
+		t.Errorf("expected store error, got %v", err)
+	}
+}
+
+func TestService_Issue_StoreError(t *testing.T) {
+	t.Parallel()
+
+	service := apikey.NewService(&errorStore{err: errors.New("store down")})
+
+	if _, _, err := service.Issue("alice", "bot", nil); err == nil {
+		t.Error("expected error from store")
+	}
+}
+
+func TestService_Revoke(t *testing.T) {
+	t.Parallel()
+
+	service := apikey.NewService(apikey.NewMemoryStore())
+
+	key, secret, err := service.Issue("alice", "bot", nil)
+	require.NoError(t, err)
+
+	// Other users cannot revoke the key
+	if err := service.Revoke("bob", key.ID); !errors.Is(err, apikey.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound for non-owner, got %v", err)
+	}
+
+	require.NoError(t, service.Revoke("alice", key.ID))
+
+	if _, err := service.Authenticate(secret); !errors.Is(err, apikey.ErrInvalidKey) {
+		t.Errorf("expected revoked key to be rejected, got %v", err)
+	}
+
+	if err := service.Revoke("alice", "missing"); !errors.Is(err, apikey.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestService_List(t *testing.T) {
+	t.Parallel()
+
+	service := apikey.NewService(apikey.NewMemoryStore())
+
+	_, _, err := service.Issue("alice", "bot", nil)
+	require.NoError(t, err)
+
+	keys, err := service.List("alice")
+	require.NoError(t, err)
+
+	if len(keys) != 1 {
+		t.Errorf("expected 1 key, got %d", len(keys))
+	}
+}
+
+// errorStore is a Store that fails every call.
+type errorStore struct {
+	err error
+}
+
+func (e *errorStore) Save(_ apikey.Key, _ string) error { return e.err }
+
+func (e *errorStore) GetByHash(_ string) (apikey.Key, error) { return apikey.Key{}, e.err }
+
+func (e *errorStore) Get(_ string) (apikey.Key, error) { return apikey.Key{}, e.err }
+
+func (e *errorStore) Delete(_ string) error { return e.err }
+
+func (e *errorStore) ListByOwner(_ string) ([]apikey.Key, error) { return nil, e.err }
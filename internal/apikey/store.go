@@ -0,0 +1,31 @@
+package apikey
+
+import "errors"
+
+// Common errors.
+var (
+	ErrKeyNotFound  = errors.New("api key not found")
+	ErrInvalidKey   = errors.New("invalid api key")
+	ErrInvalidScope = errors.New("invalid scope")
+)
+
+// Store defines the interface for persisting API keys.
+type Store interface {
+	// Save stores a key together with the hash of its secret.
+	Save(key Key, secretHash string) error
+
+	// GetByHash returns the key whose secret has the given hash.
+	// Returns ErrKeyNotFound if no key matches.
+	GetByHash(secretHash string) (Key, error)
+
+	// Get returns a key by ID.
+	// Returns ErrKeyNotFound if the key doesn't exist.
+	Get(keyID string) (Key, error)
+
+	// Delete removes a key.
+	// Returns ErrKeyNotFound if the key doesn't exist.
+	Delete(keyID string) error
+
+	// ListByOwner returns all keys created by a user.
+	ListByOwner(ownerID string) ([]Key, error)
+}
@@ -0,0 +1,866 @@
+// Package apitypes defines the request and response bodies of the REST API.
+// The types are shared by the HTTP handlers and described by the embedded
+// OpenAPI specification.
+package apitypes
+
+import (
+	_ "embed"
+	"fmt"
+	"maps"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxDocumentIDLength is the maximum length of a document ID.
+const MaxDocumentIDLength = 128
+
+// MaxSlugLength is the maximum length of a document slug.
+const MaxSlugLength = 64
+
+// MaxBatchSize is the maximum number of documents in a batch request.
+const MaxBatchSize = 100
+
+// MaxTags is the maximum number of tags on a document.
+const MaxTags = 20
+
+// MaxTitleLength is the maximum length of a document title.
+const MaxTitleLength = 256
+
+// MaxProperties is the maximum number of properties on a document.
+const MaxProperties = 50
+
+// MaxPropertyValueLength is the maximum length of a document property's value.
+const MaxPropertyValueLength = 1024
+
+// MaxCommentLength is the maximum length of a comment's body.
+const MaxCommentLength = 4096
+
+// reservedDocumentIDs are path segments under /documents/ used by
+// collection endpoints, so no document may take them as its ID.
+var reservedDocumentIDs = []string{"batch", "batch-delete", "import"}
+
+// serviceNamePattern matches valid service account names.
+var serviceNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// tagPattern matches valid document tags.
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,32}$`)
+
+// propertyKeyPattern matches valid document property keys.
+var propertyKeyPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// slugPattern matches lowercase words joined by single hyphens.
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// OpenAPISpec is the OpenAPI 3 document describing the REST API.
+//
+//go:embed openapi.json
+var OpenAPISpec []byte
+
+// ValidationError describes a request field that failed validation.
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidateDocumentID checks that a document ID is usable in URL paths.
+func ValidateDocumentID(field, id string) error {
+	switch {
+	case id == "":
+		return &ValidationError{Field: field, Message: "is required"}
+	case len(id) > MaxDocumentIDLength:
+		return &ValidationError{Field: field, Message: fmt.Sprintf("must be at most %d bytes", MaxDocumentIDLength)}
+	case strings.ContainsAny(id, "/?#"):
+		return &ValidationError{Field: field, Message: "must not contain '/', '?' or '#'"}
+	case slices.Contains(reservedDocumentIDs, id):
+		return &ValidationError{Field: field, Message: "is reserved"}
+	default:
+		return nil
+	}
+}
+
+// ValidateSlug checks that a slug is lowercase words joined by hyphens.
+func ValidateSlug(field, slug string) error {
+	switch {
+	case len(slug) > MaxSlugLength:
+		return &ValidationError{Field: field, Message: fmt.Sprintf("must be at most %d bytes", MaxSlugLength)}
+	case !slugPattern.MatchString(slug):
+		return &ValidationError{Field: field, Message: "must be lowercase letters and digits separated by single '-'"}
+	default:
+		return nil
+	}
+}
+
+// validateTitle checks that a document title is printable text of at most
+// MaxTitleLength bytes. Empty titles are valid.
+func validateTitle(field, title string) error {
+	switch {
+	case len(title) > MaxTitleLength:
+		return &ValidationError{Field: field, Message: fmt.Sprintf("must be at most %d bytes", MaxTitleLength)}
+	case !utf8.ValidString(title):
+		return &ValidationError{Field: field, Message: "must be valid UTF-8"}
+	case strings.ContainsFunc(title, unicode.IsControl):
+		return &ValidationError{Field: field, Message: "must not contain control characters"}
+	default:
+		return nil
+	}
+}
+
+// CreateDocumentRequest is the request body for creating a document.
+type CreateDocumentRequest struct {
+	ID      string `json:"id,omitempty"`      // Generated by the server when empty
+	Content string `json:"content,omitempty"` // Optional initial content
+	Slug    string `json:"slug,omitempty"`    // Optional unique human-readable alias
+}
+
+// Validate checks the request fields.
+func (r CreateDocumentRequest) Validate() error {
+	if r.ID != "" {
+		if err := ValidateDocumentID("id", r.ID); err != nil {
+			return err
+		}
+	}
+
+	if r.Slug != "" {
+		return ValidateSlug("slug", r.Slug)
+	}
+
+	return nil
+}
+
+// CreateDocumentResponse is the response body for creating a document.
+type CreateDocumentResponse struct {
+	ID   string `json:"id"`
+	Slug string `json:"slug,omitempty"`
+}
+
+// CopyDocumentRequest is the request body for copying a document.
+type CopyDocumentRequest struct {
+	ID              string `json:"id,omitempty"`              // Optional: the copy's ID, generated if empty
+	CopyPermissions bool   `json:"copyPermissions,omitempty"` // Share the copy with the document's users, as an owner
+}
+
+// Validate checks the request fields.
+func (r CopyDocumentRequest) Validate() error {
+	if r.ID != "" {
+		return ValidateDocumentID("id", r.ID)
+	}
+
+	return nil
+}
+
+// SlugResponse is the response body for resolving a slug.
+type SlugResponse struct {
+	ID   string `json:"id"`
+	Slug string `json:"slug"`
+}
+
+// GetDocumentResponse is the response body for getting a document.
+type GetDocumentResponse struct {
+	ID         string            `json:"id"`
+	Title      string            `json:"title,omitempty"`
+	Content    string            `json:"content"`
+	Revision   int               `json:"revision"`
+	CreatedAt  time.Time         `json:"createdAt"`
+	UpdatedAt  time.Time         `json:"updatedAt"` // Last edit, or creation if never edited
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// UpdateDocumentRequest is the request body for renaming a document or
+// replacing its properties. Fields left out are unchanged.
+type UpdateDocumentRequest struct {
+	Title      *string           `json:"title,omitempty"`      // An empty title removes the name
+	Properties map[string]string `json:"properties,omitempty"` // Replaces all properties; {} removes them
+}
+
+// Validate checks the request fields.
+func (r UpdateDocumentRequest) Validate() error {
+	if r.Title == nil && r.Properties == nil {
+		return &ValidationError{Field: "title", Message: "is required unless properties are given"}
+	}
+
+	if r.Title != nil {
+		if err := validateTitle("title", *r.Title); err != nil {
+			return err
+		}
+	}
+
+	if len(r.Properties) > MaxProperties {
+		return &ValidationError{
+			Field:   "properties",
+			Message: fmt.Sprintf("must contain at most %d properties", MaxProperties),
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(r.Properties)) {
+		field := fmt.Sprintf("properties[%s]", key)
+
+		switch {
+		case !propertyKeyPattern.MatchString(key):
+			return &ValidationError{Field: field, Message: "key must be 1-64 letters, digits, '.', '_' or '-'"}
+		case len(r.Properties[key]) > MaxPropertyValueLength:
+			return &ValidationError{
+				Field:   field,
+				Message: fmt.Sprintf("must be at most %d bytes", MaxPropertyValueLength),
+			}
+		case !utf8.ValidString(r.Properties[key]):
+			return &ValidationError{Field: field, Message: "must be valid UTF-8"}
+		}
+	}
+
+	return nil
+}
+
+// DocumentMetadataResponse is the response body for updating a document's
+// title or properties.
+type DocumentMetadataResponse struct {
+	ID         string            `json:"id"`
+	Title      string            `json:"title,omitempty"`
+	CreatedAt  time.Time         `json:"createdAt"`
+	UpdatedAt  time.Time         `json:"updatedAt"` // Last edit, or creation if never edited
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// DocumentStatsResponse is the response body for a document's statistics.
+type DocumentStatsResponse struct {
+	ID            string     `json:"id"`
+	Revision      int        `json:"revision"`
+	Characters    int        `json:"characters"`
+	Words         int        `json:"words"`
+	Collaborators int        `json:"collaborators"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	LastEditedAt  *time.Time `json:"lastEditedAt,omitempty"`
+	LastEditedBy  string     `json:"lastEditedBy,omitempty"`
+	ArchivedAt    *time.Time `json:"archivedAt,omitempty"`
+}
+
+// SetTagsRequest is the request body for replacing a document's tags.
+type SetTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// Validate checks the request fields.
+func (r SetTagsRequest) Validate() error {
+	if len(r.Tags) > MaxTags {
+		return &ValidationError{Field: "tags", Message: fmt.Sprintf("must contain at most %d tags", MaxTags)}
+	}
+
+	for i, tag := range r.Tags {
+		if !tagPattern.MatchString(tag) {
+			return &ValidationError{
+				Field:   fmt.Sprintf("tags[%d]", i),
+				Message: "must be 1-32 letters, digits, '.', '_' or '-'",
+			}
+		}
+	}
+
+	return nil
+}
+
+// TagsResponse is the response body for a document's tags.
+type TagsResponse struct {
+	ID   string   `json:"id"`
+	Tags []string `json:"tags"` // Sorted, without duplicates
+}
+
+// ArchiveResponse is the response body for a document's archive state.
+type ArchiveResponse struct {
+	ID         string     `json:"id"`
+	Archived   bool       `json:"archived"`
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
+}
+
+// AttachmentResponse is the response body for an uploaded attachment.
+type AttachmentResponse struct {
+	ID          string `json:"id"`
+	Name        string `json:"name,omitempty"` // Original file name
+	ContentType string `json:"contentType"`
+	Size        int    `json:"size"` // Bytes
+	URL         string `json:"url"`  // Path to download the attachment from
+}
+
+// CreateCommentRequest is the request body for commenting on a document.
+// The comment is anchored to the text from Start up to End, in characters,
+// as of Revision; Start equals End for a comment on a position.
+type CreateCommentRequest struct {
+	Body     string `json:"body"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	Revision int    `json:"revision"`
+}
+
+// Validate checks the request fields.
+func (r CreateCommentRequest) Validate() error {
+	switch {
+	case strings.TrimSpace(r.Body) == "":
+		return &ValidationError{Field: "body", Message: "is required"}
+	case len(r.Body) > MaxCommentLength:
+		return &ValidationError{Field: "body", Message: fmt.Sprintf("must be at most %d bytes", MaxCommentLength)}
+	case !utf8.ValidString(r.Body):
+		return &ValidationError{Field: "body", Message: "must be valid UTF-8"}
+	case r.Start < 0:
+		return &ValidationError{Field: "start", Message: "must not be negative"}
+	case r.End < r.Start:
+		return &ValidationError{Field: "end", Message: "must not be before start"}
+	case r.Revision < 0:
+		return &ValidationError{Field: "revision", Message: "must not be negative"}
+	}
+
+	return nil
+}
+
+// Comment is a comment on a document, anchored to the text from Start up
+// to End as of Revision.
+type Comment struct {
+	ID        string    `json:"id"`
+	Body      string    `json:"body"`
+	AuthorID  string    `json:"authorId"`
+	Start     int       `json:"start"`
+	End       int       `json:"end"`
+	Revision  int       `json:"revision"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"` // Absent until the comment is resolved
+	ResolvedBy string     `json:"resolvedBy,omitempty"`
+}
+
+// ListCommentsResponse is the response body for listing a document's
+// comments, oldest first.
+type ListCommentsResponse struct {
+	Comments []Comment `json:"comments"`
+}
+
+// DocumentSummary is a document in a listing, with the caller's role on it.
+type DocumentSummary struct {
+	ID        string `json:"id"`
+	Role      string `json:"role"` // viewer, editor or owner
+	IsStarred bool   `json:"isStarred"`
+	Archived  bool   `json:"archived,omitempty"` // Only listed with archived=true
+}
+
+// ListUserDocumentsResponse is the response body for listing the caller's
+// documents.
+type ListUserDocumentsResponse struct {
+	Documents  []DocumentSummary `json:"documents"`            // Sorted by ID
+	NextCursor string            `json:"nextCursor,omitempty"` // Passed as cursor for the next page; empty on the last
+}
+
+// StarResponse is the response body for a user's star on a document.
+type StarResponse struct {
+	ID        string `json:"id"`
+	IsStarred bool   `json:"isStarred"`
+}
+
+// ListStarredResponse is the response body for listing starred documents.
+type ListStarredResponse struct {
+	IDs []string `json:"ids"` // Sorted
+}
+
+// NotificationSettings is the request and response body for a user's
+// notification settings.
+type NotificationSettings struct {
+	Email    string `json:"email"` // Where to send notifications; empty disables them
+	Mentions bool   `json:"mentions"`
+	Shares   bool   `json:"shares"`
+	Activity bool   `json:"activity"` // Edits by others while the user isn't connected
+}
+
+// Validate checks the request fields.
+func (r NotificationSettings) Validate() error {
+	if r.Email == "" {
+		return nil
+	}
+
+	if addr, err := mail.ParseAddress(r.Email); err != nil || addr.Address != r.Email {
+		return &ValidationError{Field: "email", Message: "must be an email address"}
+	}
+
+	return nil
+}
+
+// BatchDeleteRequest is the request body for deleting several documents.
+type BatchDeleteRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// Validate checks the request fields.
+func (r BatchDeleteRequest) Validate() error {
+	switch {
+	case len(r.IDs) == 0:
+		return &ValidationError{Field: "ids", Message: "must not be empty"}
+	case len(r.IDs) > MaxBatchSize:
+		return &ValidationError{Field: "ids", Message: fmt.Sprintf("must contain at most %d IDs", MaxBatchSize)}
+	}
+
+	for i, id := range r.IDs {
+		if err := ValidateDocumentID(fmt.Sprintf("ids[%d]", i), id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// BatchResult reports the outcome for one document of a batch request.
+type BatchResult struct {
+	ID     string         `json:"id"`
+	Status int            `json:"status"`          // HTTP status the single-document request would return
+	Error  *ErrorResponse `json:"error,omitempty"` // Set when the operation failed
+}
+
+// BatchDeleteResponse is the response body for deleting several documents.
+type BatchDeleteResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// DocumentShare grants a user a role on a document.
+type DocumentShare struct {
+	UserID string `json:"userId"`
+	Role   string `json:"role"` // viewer, editor or owner
+}
+
+// PermissionsResponse is the response body for a document's permissions.
+type PermissionsResponse struct {
+	ID          string          `json:"id"`
+	Permissions []DocumentShare `json:"permissions"` // Sorted by user ID
+}
+
+// GrantPermissionRequest is the request body for sharing a document with a user.
+type GrantPermissionRequest struct {
+	UserID string `json:"userId"`
+	Role   string `json:"role"` // viewer, editor or owner
+}
+
+// SetPermissionRequest is the request body for granting a user a role.
+type SetPermissionRequest struct {
+	Role string `json:"role"` // viewer, editor or owner
+}
+
+// CreateShareLinkRequest is the request body for creating a share link.
+type CreateShareLinkRequest struct {
+	Role      string     `json:"role"`                // viewer or editor
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"` // Absent for a link that never expires
+}
+
+// Validate checks the request fields.
+func (r CreateShareLinkRequest) Validate() error {
+	if r.Role != "viewer" && r.Role != "editor" {
+		return &ValidationError{Field: "role", Message: "must be viewer or editor"}
+	}
+
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(time.Now()) {
+		return &ValidationError{Field: "expiresAt", Message: "must be in the future"}
+	}
+
+	return nil
+}
+
+// ShareLink is a link giving anyone who holds its token a role on a document.
+type ShareLink struct {
+	ID        string     `json:"id"`
+	Role      string     `json:"role"`
+	CreatedBy string     `json:"createdBy"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// CreateShareLinkResponse is the response body for creating a share link.
+// The token is only returned once.
+type CreateShareLinkResponse struct {
+	Link  ShareLink `json:"link"`
+	Token string    `json:"token"` // Pass as the token query parameter
+}
+
+// BatchCreateDocument describes one document of a batch create request.
+type BatchCreateDocument struct {
+	ID      string          `json:"id"`
+	Content string          `json:"content,omitempty"` // Optional initial content
+	Shares  []DocumentShare `json:"shares,omitempty"`  // Optional initial permissions
+}
+
+// BatchCreateRequest is the request body for creating several documents.
+type BatchCreateRequest struct {
+	Documents []BatchCreateDocument `json:"documents"`
+}
+
+// Validate checks the request fields. Share roles are checked per document
+// when the batch is applied.
+func (r BatchCreateRequest) Validate() error {
+	switch {
+	case len(r.Documents) == 0:
+		return &ValidationError{Field: "documents", Message: "must not be empty"}
+	case len(r.Documents) > MaxBatchSize:
+		return &ValidationError{
+			Field:   "documents",
+			Message: fmt.Sprintf("must contain at most %d documents", MaxBatchSize),
+		}
+	}
+
+	for i, doc := range r.Documents {
+		if err := ValidateDocumentID(fmt.Sprintf("documents[%d].id", i), doc.ID); err != nil {
+			return err
+		}
+
+		for j, share := range doc.Shares {
+			if share.UserID == "" {
+				return &ValidationError{Field: fmt.Sprintf("documents[%d].shares[%d].userId", i, j), Message: "is required"}
+			}
+		}
+	}
+
+	return nil
+}
+
+// BatchCreateResponse is the response body for creating several documents.
+type BatchCreateResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// CreateAPIKeyRequest is the request body for issuing an API key.
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`   // Service account name
+	Scopes []string `json:"scopes"` // Allowed actions: read, write, share, delete
+}
+
+// Validate checks the request fields.
+func (r CreateAPIKeyRequest) Validate() error {
+	if !serviceNamePattern.MatchString(r.Name) {
+		return &ValidationError{
+			Field:   "name",
+			Message: "must be 1-64 letters, digits, '.', '_' or '-'",
+		}
+	}
+
+	if len(r.Scopes) == 0 {
+		return &ValidationError{Field: "scopes", Message: "must not be empty"}
+	}
+
+	return nil
+}
+
+// APIKey describes an API key without its secret.
+type APIKey struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Principal string    `json:"principal"` // User ID the key authenticates as
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CreateAPIKeyResponse is the response body for issuing an API key.
+// The secret is only returned once.
+type CreateAPIKeyResponse struct {
+	APIKey APIKey `json:"apiKey"`
+	Secret string `json:"secret"`
+}
+
+// ListAPIKeysResponse is the response body for listing API keys.
+type ListAPIKeysResponse struct {
+	APIKeys []APIKey `json:"apiKeys"`
+}
+
+// CreateWebhookRequest is the request body for registering a webhook.
+type CreateWebhookRequest struct {
+	URL    string   `json:"url"`              // Endpoint that receives signed POSTs
+	Events []string `json:"events,omitempty"` // Event types to deliver; empty means all
+}
+
+// Validate checks the request fields.
+func (r CreateWebhookRequest) Validate() error {
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &ValidationError{Field: "url", Message: "must be an absolute http or https URL"}
+	}
+
+	return nil
+}
+
+// Webhook describes a registered webhook without its secret.
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CreateWebhookResponse is the response body for registering a webhook.
+// The signing secret is only returned once.
+type CreateWebhookResponse struct {
+	Webhook Webhook `json:"webhook"`
+	Secret  string  `json:"secret"`
+}
+
+// ListWebhooksResponse is the response body for listing webhooks.
+type ListWebhooksResponse struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+// CreateBotRequest is the request body for registering a bot.
+type CreateBotRequest struct {
+	Name string `json:"name"`
+}
+
+// Validate checks the request fields.
+func (r CreateBotRequest) Validate() error {
+	if !serviceNamePattern.MatchString(r.Name) {
+		return &ValidationError{
+			Field:   "name",
+			Message: "must be 1-64 letters, digits, '.', '_' or '-'",
+		}
+	}
+
+	return nil
+}
+
+// Bot describes a registered bot.
+type Bot struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Principal string    `json:"principal"` // User ID the bot edits as
+	Documents []string  `json:"documents"` // Documents the bot has joined
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ListBotsResponse is the response body for listing bots.
+type ListBotsResponse struct {
+	Bots []Bot `json:"bots"`
+}
+
+// CreateGroupRequest is the request body for creating a group.
+type CreateGroupRequest struct {
+	Name string `json:"name"`
+}
+
+// Validate checks the request fields.
+func (r CreateGroupRequest) Validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return &ValidationError{Field: "name", Message: "is required"}
+	}
+
+	return validateTitle("name", r.Name)
+}
+
+// Group describes a group of users that roles can be granted to together.
+type Group struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Principal string    `json:"principal"` // User ID to grant the members' roles to
+	OwnerID   string    `json:"ownerId"`   // Manages the members, and needn't be one
+	Members   []string  `json:"members"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ListGroupsResponse is the response body for listing groups.
+type ListGroupsResponse struct {
+	Groups []Group `json:"groups"`
+}
+
+// BotEditRequest is the request body for a bot's edit, which replaces
+// Delete characters at Position with Text.
+type BotEditRequest struct {
+	Position *int   `json:"position,omitempty"` // Omitted to append at the end
+	Delete   int    `json:"delete,omitempty"`
+	Text     string `json:"text,omitempty"`
+}
+
+// BotEditResponse is the response body for a bot's edit.
+type BotEditResponse struct {
+	Revision int `json:"revision"` // Revision of the edit's last operation
+}
+
+// RevertResponse is the response body for undoing or redoing an edit.
+type RevertResponse struct {
+	Revision int `json:"revision"` // Revision of the operation reverting the edit
+}
+
+// ReplaceContentRequest is the request body for replacing a document's text.
+type ReplaceContentRequest struct {
+	Content string `json:"content"`
+}
+
+// ReplaceContentResponse is the response body for replacing a document's text.
+type ReplaceContentResponse struct {
+	Revision int `json:"revision"` // Revision of the last edit made, or the current one if nothing changed
+}
+
+// Operation is a sequenced edit to a document.
+type Operation struct {
+	Revision  int    `json:"revision"`
+	Type      string `json:"type"` // "insert", "delete" or "format"
+	Position  int    `json:"position"`
+	Char      string `json:"char,omitempty"`      // Set for inserts
+	Attribute string `json:"attribute,omitempty"` // Set for formats
+	Value     string `json:"value,omitempty"`     // Set for formats, absent when they clear the attribute
+	UserID    string `json:"userId"`
+
+	Timestamp *time.Time `json:"timestamp,omitempty"` // When it was applied; absent if that wasn't recorded
+}
+
+// ChangesResponse is the response body for polling a document's changes.
+// Operations is empty when the wait timed out with nothing new.
+type ChangesResponse struct {
+	ID         string      `json:"id"`
+	Revision   int         `json:"revision"`
+	Operations []Operation `json:"operations"`
+}
+
+// HistoryResponse is the response body for a document's history: the
+// operations producing each revision still in its log, newest first.
+type HistoryResponse struct {
+	ID             string      `json:"id"`
+	OldestRevision int         `json:"oldestRevision"` // Earlier revisions were compacted into a snapshot
+	Operations     []Operation `json:"operations"`
+	NextCursor     string      `json:"nextCursor,omitempty"` // Absent on the last page
+}
+
+// RevisionResponse is the response body for a document as of a revision.
+type RevisionResponse struct {
+	ID        string     `json:"id"`
+	Revision  int        `json:"revision"`
+	Content   string     `json:"content"`
+	Operation *Operation `json:"operation,omitempty"` // The edit producing the revision, unless it was compacted
+}
+
+// DocumentEvent is a document event streamed from GET /v1/events. It has the
+// same shape as webhook deliveries.
+type DocumentEvent struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	DocumentID string    `json:"documentId"`
+	Revision   int       `json:"revision,omitempty"`
+	UserID     string    `json:"userId,omitempty"`
+	Role       string    `json:"role,omitempty"`
+	OccurredAt time.Time `json:"occurredAt"`
+}
+
+// HealthResponse is the response body for the liveness and readiness probes.
+type HealthResponse struct {
+	Status  string   `json:"status"`            // ok, ready or starting
+	Pending []string `json:"pending,omitempty"` // Startup tasks still running
+}
+
+// AdminSession describes an active editing session. Sizes are estimates.
+type AdminSession struct {
+	DocumentID   string `json:"documentId"`
+	Revision     int    `json:"revision"`
+	Clients      int    `json:"clients"`
+	HistoryOps   int    `json:"historyOps"`
+	MemoryBytes  int    `json:"memoryBytes"`  // Sum of the sizes below
+	ContentBytes int    `json:"contentBytes"` // The document's content
+	HistoryBytes int    `json:"historyBytes"` // The retained history
+	PendingBytes int    `json:"pendingBytes"` // Operations waiting to be stored
+
+	Latency OperationLatency `json:"latency"` // Of the operations stored since the session opened
+}
+
+// OperationLatency summarizes how long a session's operations took, from
+// reaching the session to being ready to acknowledge.
+type OperationLatency struct {
+	Operations int64        `json:"operations"`
+	MeanMs     StageLatency `json:"meanMs"`
+	MaxMs      StageLatency `json:"maxMs"` // Each stage's slowest, which may be of different operations
+}
+
+// StageLatency breaks operation latency down by stage, in milliseconds.
+type StageLatency struct {
+	Transform float64 `json:"transform"` // Waiting for the session, transforming and applying
+	Persist   float64 `json:"persist"`   // Waiting for the operation's batch to be stored
+	Broadcast float64 `json:"broadcast"` // Queueing for every connected client
+	Total     float64 `json:"total"`
+}
+
+// ListSessionsResponse is the response body for listing active sessions.
+type ListSessionsResponse struct {
+	Sessions []AdminSession `json:"sessions"`
+}
+
+// ListDocumentsResponse is the response body for listing every document.
+type ListDocumentsResponse struct {
+	IDs []string `json:"ids"` // Sorted
+}
+
+// AdminSummaryResponse is the response body for the server-wide summary.
+// Rates are averaged over the last minute.
+type AdminSummaryResponse struct {
+	Documents        int            `json:"documents"`
+	StorageBytes     int64          `json:"storageBytes"` // Approximate
+	ActiveSessions   int            `json:"activeSessions"`
+	SessionBytes     int64          `json:"sessionBytes"` // Estimated memory used by the active sessions
+	ConnectedClients int            `json:"connectedClients"`
+	OpsPerSecond     float64        `json:"opsPerSecond"`
+	HotDocuments     []HotDocument  `json:"hotDocuments"` // Busiest first
+	BroadcastQueue   BroadcastQueue `json:"broadcastQueue"`
+
+	// TransformChains is a histogram, since startup, of how many operations
+	// each edit was transformed against. Buckets are ordered by length.
+	TransformChains []ChainBucket `json:"transformChains"`
+}
+
+// ChainBucket counts the edits whose transform chain was at least MinLength
+// long and shorter than the next bucket's MinLength.
+type ChainBucket struct {
+	MinLength  int   `json:"minLength"`
+	Operations int64 `json:"operations"`
+}
+
+// BroadcastQueue describes the broadcasts waiting to be written to WebSocket
+// clients.
+type BroadcastQueue struct {
+	Queued         int   `json:"queued"`
+	MaxDepth       int   `json:"maxDepth"`       // For the most backed-up client
+	DroppedClients int64 `json:"droppedClients"` // Disconnected for falling behind, since startup
+}
+
+// HotDocument describes one of the busiest active documents.
+type HotDocument struct {
+	DocumentID   string  `json:"documentId"`
+	Clients      int     `json:"clients"`
+	OpsPerSecond float64 `json:"opsPerSecond"`
+}
+
+// TokenResponse is the response body for logging in or refreshing tokens.
+type TokenResponse struct {
+	TokenType        string    `json:"tokenType"` // Always "Bearer"
+	AccessToken      string    `json:"accessToken"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+	RefreshToken     string    `json:"refreshToken"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+}
+
+// RefreshTokenRequest is the request body for refreshing tokens.
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// Validate checks the request fields.
+func (r RefreshTokenRequest) Validate() error {
+	if r.RefreshToken == "" {
+		return &ValidationError{Field: "refreshToken", Message: "is required"}
+	}
+
+	return nil
+}
+
+// RevokeTokenRequest is the request body for revoking tokens.
+type RevokeTokenRequest struct {
+	Token string `json:"token"` // Access or refresh token
+}
+
+// Validate checks the request fields.
+func (r RevokeTokenRequest) Validate() error {
+	if r.Token == "" {
+		return &ValidationError{Field: "token", Message: "is required"}
+	}
+
+	return nil
+}
@@ -0,0 +1,658 @@
+package apitypes_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/apitypes"
+)
+
+func TestCreateDocumentRequest_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		id      string
+		wantErr bool
+	}{
+		{name: "valid id", id: "my-doc", wantErr: false},
+		{name: "id with slash", id: "a/b", wantErr: true},
+		{name: "id with query", id: "a?b", wantErr: true},
+		{name: "id too long", id: strings.Repeat("x", apitypes.MaxDocumentIDLength+1), wantErr: true},
+		{name: "reserved id", id: "batch-delete", wantErr: true},
+		{name: "reserved batch id", id: "batch", wantErr: true},
+		{name: "reserved import id", id: "import", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := apitypes.CreateDocumentRequest{ID: tt.id, Slug: "my-doc"}.Validate()
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err == nil {
+				return
+			}
+
+			var validationErr *apitypes.ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("expected ValidationError, got %T", err)
+			}
+
+			if validationErr.Field != "id" {
+				t.Errorf("expected field 'id', got %q", validationErr.Field)
+			}
+
+			if !strings.HasPrefix(err.Error(), "id: ") {
+				t.Errorf("expected message prefixed with field, got %q", err.Error())
+			}
+		})
+	}
+}
+
+func TestCreateDocumentRequest_ValidateSlug(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		req     apitypes.CreateDocumentRequest
+		wantErr bool
+	}{
+		{name: "generated id", req: apitypes.CreateDocumentRequest{}, wantErr: false},
+		{name: "valid slug", req: apitypes.CreateDocumentRequest{Slug: "q1-plan-2"}, wantErr: false},
+		{name: "uppercase slug", req: apitypes.CreateDocumentRequest{Slug: "Q1-plan"}, wantErr: true},
+		{name: "double hyphen", req: apitypes.CreateDocumentRequest{Slug: "q1--plan"}, wantErr: true},
+		{name: "trailing hyphen", req: apitypes.CreateDocumentRequest{Slug: "q1-"}, wantErr: true},
+		{
+			name:    "slug too long",
+			req:     apitypes.CreateDocumentRequest{Slug: strings.Repeat("x", apitypes.MaxSlugLength+1)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.req.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil && !strings.HasPrefix(err.Error(), "slug: ") {
+				t.Errorf("expected message prefixed with field, got %q", err.Error())
+			}
+		})
+	}
+}
+
+func TestErrorCodeForStatus(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{status: http.StatusBadRequest, want: apitypes.ErrorCodeInvalidRequest},
+		{status: http.StatusUnauthorized, want: apitypes.ErrorCodeUnauthorized},
+		{status: http.StatusForbidden, want: apitypes.ErrorCodeAccessDenied},
+		{status: http.StatusNotFound, want: apitypes.ErrorCodeNotFound},
+		{status: http.StatusMethodNotAllowed, want: apitypes.ErrorCodeMethodNotAllowed},
+		{status: http.StatusConflict, want: apitypes.ErrorCodeConflict},
+		{status: http.StatusGone, want: apitypes.ErrorCodeGone},
+		{status: http.StatusPreconditionFailed, want: apitypes.ErrorCodePreconditionFailed},
+		{status: http.StatusPreconditionRequired, want: apitypes.ErrorCodePreconditionFailed},
+		{status: http.StatusRequestEntityTooLarge, want: apitypes.ErrorCodePayloadTooLarge},
+		{status: http.StatusUnsupportedMediaType, want: apitypes.ErrorCodeUnsupportedMediaType},
+		{status: http.StatusTooManyRequests, want: apitypes.ErrorCodeRateLimited},
+		{status: http.StatusMisdirectedRequest, want: apitypes.ErrorCodeMisdirectedRequest},
+		{status: http.StatusBadGateway, want: apitypes.ErrorCodeBadGateway},
+		{status: http.StatusServiceUnavailable, want: apitypes.ErrorCodeTimeout},
+		{status: http.StatusInternalServerError, want: apitypes.ErrorCodeInternalError},
+	}
+
+	for _, tt := range tests {
+		if got := apitypes.ErrorCodeForStatus(tt.status); got != tt.want {
+			t.Errorf("ErrorCodeForStatus(%d) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestCreateAPIKeyRequest_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		req     apitypes.CreateAPIKeyRequest
+		field   string
+		wantErr bool
+	}{
+		{name: "valid", req: apitypes.CreateAPIKeyRequest{Name: "ci-bot", Scopes: []string{"read"}}},
+		{name: "empty name", req: apitypes.CreateAPIKeyRequest{Scopes: []string{"read"}}, field: "name", wantErr: true},
+		{
+			name: "invalid name", req: apitypes.CreateAPIKeyRequest{Name: "ci bot", Scopes: []string{"read"}},
+			field: "name", wantErr: true,
+		},
+		{name: "no scopes", req: apitypes.CreateAPIKeyRequest{Name: "ci-bot"}, field: "scopes", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.req.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var validationErr *apitypes.ValidationError
+			if tt.wantErr && (!errors.As(err, &validationErr) || validationErr.Field != tt.field) {
+				t.Errorf("expected ValidationError on %q, got %v", tt.field, err)
+			}
+		})
+	}
+}
+
+func TestCreateWebhookRequest_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{name: "https", url: "https://example.com/hooks/docs"},
+		{name: "http with port", url: "http://localhost:9000/hook"},
+		{name: "empty", url: "", wantErr: true},
+		{name: "relative", url: "/hook", wantErr: true},
+		{name: "other scheme", url: "ftp://example.com/hook", wantErr: true},
+		{name: "malformed", url: "https://exa mple.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := apitypes.CreateWebhookRequest{URL: tt.url}.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var validationErr *apitypes.ValidationError
+			if tt.wantErr && (!errors.As(err, &validationErr) || validationErr.Field != "url") {
+				t.Errorf("expected ValidationError on url, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNotificationSettings_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		email   string
+		wantErr bool
+	}{
+		{name: "address", email: "alice@example.com"},
+		{name: "empty", email: ""},
+		{name: "not an address", email: "alice", wantErr: true},
+		{name: "with a name", email: "Alice <alice@example.com>", wantErr: true},
+		{name: "several", email: "alice@example.com, bob@example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := apitypes.NotificationSettings{Email: tt.email}.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var validationErr *apitypes.ValidationError
+			if tt.wantErr && (!errors.As(err, &validationErr) || validationErr.Field != "email") {
+				t.Errorf("expected ValidationError on email, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBatchDeleteRequest_Validate(t *testing.T) {
+	t.Parallel()
+
+	tooMany := make([]string, apitypes.MaxBatchSize+1)
+	for i := range tooMany {
+		tooMany[i] = "doc"
+	}
+
+	tests := []struct {
+		name    string
+		ids     []string
+		field   string
+		wantErr bool
+	}{
+		{name: "valid", ids: []string{"doc1", "doc2"}},
+		{name: "empty", ids: nil, field: "ids", wantErr: true},
+		{name: "too many", ids: tooMany, field: "ids", wantErr: true},
+		{name: "invalid id", ids: []string{"doc1", "a/b"}, field: "ids[1]", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := apitypes.BatchDeleteRequest{IDs: tt.ids}.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var validationErr *apitypes.ValidationError
+			if tt.wantErr && (!errors.As(err, &validationErr) || validationErr.Field != tt.field) {
+				t.Errorf("expected ValidationError on %q, got %v", tt.field, err)
+			}
+		})
+	}
+}
+
+func TestBatchCreateRequest_Validate(t *testing.T) {
+	t.Parallel()
+
+	tooMany := make([]apitypes.BatchCreateDocument, apitypes.MaxBatchSize+1)
+	for i := range tooMany {
+		tooMany[i] = apitypes.BatchCreateDocument{ID: "doc"}
+	}
+
+	tests := []struct {
+		name    string
+		docs    []apitypes.BatchCreateDocument
+		field   string
+		wantErr bool
+	}{
+		{name: "valid", docs: []apitypes.BatchCreateDocument{
+			{ID: "doc1", Content: "hello"},
+			{ID: "doc2", Shares: []apitypes.DocumentShare{{UserID: "bob", Role: "editor"}}},
+		}},
+		{name: "empty", docs: nil, field: "documents", wantErr: true},
+		{name: "too many", docs: tooMany, field: "documents", wantErr: true},
+		{
+			name:    "invalid id",
+			docs:    []apitypes.BatchCreateDocument{{ID: "doc1"}, {ID: "a/b"}},
+			field:   "documents[1].id",
+			wantErr: true,
+		},
+		{
+			name:    "share without user",
+			docs:    []apitypes.BatchCreateDocument{{ID: "doc1", Shares: []apitypes.DocumentShare{{Role: "viewer"}}}},
+			field:   "documents[0].shares[0].userId",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := apitypes.BatchCreateRequest{Documents: tt.docs}.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var validationErr *apitypes.ValidationError
+			if tt.wantErr && (!errors.As(err, &validationErr) || validationErr.Field != tt.field) {
+				t.Errorf("expected ValidationError on %q, got %v", tt.field, err)
+			}
+		})
+	}
+}
+
+func TestSetTagsRequest_Validate(t *testing.T) {
+	t.Parallel()
+
+	tooMany := make([]string, apitypes.MaxTags+1)
+	for i := range tooMany {
+		tooMany[i] = "tag"
+	}
+
+	tests := []struct {
+		name    string
+		tags    []string
+		field   string
+		wantErr bool
+	}{
+		{name: "valid", tags: []string{"finance", "Q1-2026", "v1.2_draft"}},
+		{name: "empty clears tags", tags: nil},
+		{name: "too many", tags: tooMany, field: "tags", wantErr: true},
+		{name: "empty tag", tags: []string{"ok", ""}, field: "tags[1]", wantErr: true},
+		{name: "tag with space", tags: []string{"two words"}, field: "tags[0]", wantErr: true},
+		{name: "tag too long", tags: []string{strings.Repeat("x", 33)}, field: "tags[0]", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := apitypes.SetTagsRequest{Tags: tt.tags}.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var validationErr *apitypes.ValidationError
+			if tt.wantErr && (!errors.As(err, &validationErr) || validationErr.Field != tt.field) {
+				t.Errorf("expected ValidationError on %q, got %v", tt.field, err)
+			}
+		})
+	}
+}
+
+func TestCreateCommentRequest_Validate(t *testing.T) {
+	t.Parallel()
+
+	valid := apitypes.CreateCommentRequest{Body: "typo?", Start: 2, End: 5, Revision: 3}
+
+	tests := []struct {
+		name    string
+		modify  func(r *apitypes.CreateCommentRequest)
+		field   string
+		wantErr bool
+	}{
+		{name: "valid", modify: func(*apitypes.CreateCommentRequest) {}},
+		{name: "on a position", modify: func(r *apitypes.CreateCommentRequest) { r.End = r.Start }},
+		{
+			name:    "blank body",
+			modify:  func(r *apitypes.CreateCommentRequest) { r.Body = " \n" },
+			field:   "body",
+			wantErr: true,
+		},
+		{
+			name:    "body too long",
+			modify:  func(r *apitypes.CreateCommentRequest) { r.Body = strings.Repeat("x", apitypes.MaxCommentLength+1) },
+			field:   "body",
+			wantErr: true,
+		},
+		{
+			name:    "invalid UTF-8",
+			modify:  func(r *apitypes.CreateCommentRequest) { r.Body = "\xff" },
+			field:   "body",
+			wantErr: true,
+		},
+		{
+			name:    "negative start",
+			modify:  func(r *apitypes.CreateCommentRequest) { r.Start = -1 },
+			field:   "start",
+			wantErr: true,
+		},
+		{
+			name:    "end before start",
+			modify:  func(r *apitypes.CreateCommentRequest) { r.End = 1 },
+			field:   "end",
+			wantErr: true,
+		},
+		{
+			name:    "negative revision",
+			modify:  func(r *apitypes.CreateCommentRequest) { r.Revision = -1 },
+			field:   "revision",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := valid
+			tt.modify(&req)
+
+			err := req.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var validationErr *apitypes.ValidationError
+			if tt.wantErr && (!errors.As(err, &validationErr) || validationErr.Field != tt.field) {
+				t.Errorf("expected ValidationError on %q, got %v", tt.field, err)
+			}
+		})
+	}
+}
+
+func TestUpdateDocumentRequest_Validate(t *testing.T) {
+	t.Parallel()
+
+	title := func(s string) *string { return &s }
+
+	tooMany := make(map[string]string, apitypes.MaxProperties+1)
+	for i := range apitypes.MaxProperties + 1 {
+		tooMany[fmt.Sprintf("key%d", i)] = "value"
+	}
+
+	tests := []struct {
+		name    string
+		req     apitypes.UpdateDocumentRequest
+		field   string
+		wantErr bool
+	}{
+		{name: "rename", req: apitypes.UpdateDocumentRequest{Title: title("Q1 Roadmap")}},
+		{name: "remove title", req: apitypes.UpdateDocumentRequest{Title: title("")}},
+		{name: "properties", req: apitypes.UpdateDocumentRequest{Properties: map[string]string{"team": "docs"}}},
+		{name: "remove properties", req: apitypes.UpdateDocumentRequest{Properties: map[string]string{}}},
+		{name: "nothing to update", field: "title", wantErr: true},
+		{
+			name:    "title too long",
+			req:     apitypes.UpdateDocumentRequest{Title: title(strings.Repeat("x", apitypes.MaxTitleLength+1))},
+			field:   "title",
+			wantErr: true,
+		},
+		{
+			name:    "title with newline",
+			req:     apitypes.UpdateDocumentRequest{Title: title("a\nb")},
+			field:   "title",
+			wantErr: true,
+		},
+		{
+			name:    "too many properties",
+			req:     apitypes.UpdateDocumentRequest{Properties: tooMany},
+			field:   "properties",
+			wantErr: true,
+		},
+		{
+			name:    "key with space",
+			req:     apitypes.UpdateDocumentRequest{Properties: map[string]string{"ok": "", "two words": "x"}},
+			field:   "properties[two words]",
+			wantErr: true,
+		},
+		{
+			name: "value too long",
+			req: apitypes.UpdateDocumentRequest{
+				Properties: map[string]string{"notes": strings.Repeat("x", apitypes.MaxPropertyValueLength+1)},
+			},
+			field:   "properties[notes]",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.req.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var validationErr *apitypes.ValidationError
+			if tt.wantErr && (!errors.As(err, &validationErr) || validationErr.Field != tt.field) {
+				t.Errorf("expected ValidationError on %q, got %v", tt.field, err)
+			}
+		})
+	}
+}
+
+func TestTokenRequests_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		validate  func() error
+		wantField string
+	}{
+		{name: "refresh", validate: apitypes.RefreshTokenRequest{RefreshToken: "odr_x"}.Validate},
+		{name: "refresh without token", validate: apitypes.RefreshTokenRequest{}.Validate, wantField: "refreshToken"},
+		{name: "revoke", validate: apitypes.RevokeTokenRequest{Token: "oda_x"}.Validate},
+		{name: "revoke without token", validate: apitypes.RevokeTokenRequest{}.Validate, wantField: "token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.validate()
+			if (err != nil) != (tt.wantField != "") {
+				t.Fatalf("Validate() error = %v, want error on %q", err, tt.wantField)
+			}
+
+			var validationErr *apitypes.ValidationError
+			if err != nil && (!errors.As(err, &validationErr) || validationErr.Field != tt.wantField) {
+				t.Errorf("expected ValidationError on %s, got %v", tt.wantField, err)
+			}
+		})
+	}
+}
+
+func TestCreateGroupRequest_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		req       apitypes.CreateGroupRequest
+		wantField string
+	}{
+		{name: "valid", req: apitypes.CreateGroupRequest{Name: "Engineering"}},
+		{name: "blank", req: apitypes.CreateGroupRequest{Name: "  "}, wantField: "name"},
+		{
+			name:      "too long",
+			req:       apitypes.CreateGroupRequest{Name: strings.Repeat("x", apitypes.MaxTitleLength+1)},
+			wantField: "name",
+		},
+		{name: "invalid UTF-8", req: apitypes.CreateGroupRequest{Name: "a\xffb"}, wantField: "name"},
+		{name: "control characters", req: apitypes.CreateGroupRequest{Name: "a\tb"}, wantField: "name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.req.Validate()
+			if (err != nil) != (tt.wantField != "") {
+				t.Fatalf("Validate() error = %v, want error on %q", err, tt.wantField)
+			}
+
+			var validationErr *apitypes.ValidationError
+			if err != nil && (!errors.As(err, &validationErr) || validationErr.Field != tt.wantField) {
+				t.Errorf("expected ValidationError on %s, got %v", tt.wantField, err)
+			}
+		})
+	}
+}
+
+func TestCreateShareLinkRequest_Validate(t *testing.T) {
+	t.Parallel()
+
+	future, past := time.Now().Add(time.Hour), time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		req       apitypes.CreateShareLinkRequest
+		wantField string
+	}{
+		{name: "viewer", req: apitypes.CreateShareLinkRequest{Role: "viewer"}},
+		{name: "editor until later", req: apitypes.CreateShareLinkRequest{Role: "editor", ExpiresAt: &future}},
+		{name: "owner", req: apitypes.CreateShareLinkRequest{Role: "owner"}, wantField: "role"},
+		{name: "expired", req: apitypes.CreateShareLinkRequest{Role: "viewer", ExpiresAt: &past}, wantField: "expiresAt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.req.Validate()
+			if (err != nil) != (tt.wantField != "") {
+				t.Fatalf("Validate() error = %v, want error on %q", err, tt.wantField)
+			}
+
+			var validationErr *apitypes.ValidationError
+			if err != nil && (!errors.As(err, &validationErr) || validationErr.Field != tt.wantField) {
+				t.Errorf("expected ValidationError on %s, got %v", tt.wantField, err)
+			}
+		})
+	}
+}
+
+func TestCreateBotRequest_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		botName string
+		wantErr bool
+	}{
+		{name: "valid", botName: "summarizer-1.0"},
+		{name: "empty", wantErr: true},
+		{name: "with space", botName: "two words", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := apitypes.CreateBotRequest{Name: tt.botName}.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var validationErr *apitypes.ValidationError
+			if tt.wantErr && (!errors.As(err, &validationErr) || validationErr.Field != "name") {
+				t.Errorf("expected ValidationError on name, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCopyDocumentRequest_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		id      string
+		wantErr bool
+	}{
+		{name: "generated ID"},
+		{name: "chosen ID", id: "plan-copy"},
+		{name: "invalid ID", id: "a/b", wantErr: true},
+		{name: "ID too long", id: strings.Repeat("x", apitypes.MaxDocumentIDLength+1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := apitypes.CopyDocumentRequest{ID: tt.id}.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var validationErr *apitypes.ValidationError
+			if tt.wantErr && (!errors.As(err, &validationErr) || validationErr.Field != "id") {
+				t.Errorf("expected ValidationError on id, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package apitypes
+
+import "net/http"
+
+// Error codes returned in ErrorResponse.
+const (
+	ErrorCodeInvalidRequest       = "invalid_request"
+	ErrorCodeUnauthorized         = "unauthorized"
+	ErrorCodeAccessDenied         = "access_denied"
+	ErrorCodeNotFound             = "not_found"
+	ErrorCodeMethodNotAllowed     = "method_not_allowed"
+	ErrorCodeConflict             = "conflict"
+	ErrorCodeGone                 = "gone"
+	ErrorCodePreconditionFailed   = "precondition_failed"
+	ErrorCodePayloadTooLarge      = "payload_too_large"
+	ErrorCodeUnsupportedMediaType = "unsupported_media_type"
+	ErrorCodeRateLimited          = "rate_limited"
+	ErrorCodeMisdirectedRequest   = "misdirected_request"
+	ErrorCodeBadGateway           = "bad_gateway"
+	ErrorCodeTimeout              = "timeout"
+	ErrorCodeUnavailable          = "unavailable"
+	ErrorCodeInternalError        = "internal_error"
+)
+
+// ErrorResponse is the body returned for all failed requests.
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ErrorCodeForStatus returns the error code matching an HTTP status.
+func ErrorCodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrorCodeInvalidRequest
+	case http.StatusUnauthorized:
+		return ErrorCodeUnauthorized
+	case http.StatusForbidden:
+		return ErrorCodeAccessDenied
+	case http.StatusNotFound:
+		return ErrorCodeNotFound
+	case http.StatusMethodNotAllowed:
+		return ErrorCodeMethodNotAllowed
+	case http.StatusConflict:
+		return ErrorCodeConflict
+	case http.StatusGone:
+		return ErrorCodeGone
+	case http.StatusPreconditionFailed, http.StatusPreconditionRequired:
+		return ErrorCodePreconditionFailed
+	case http.StatusRequestEntityTooLarge:
+		return ErrorCodePayloadTooLarge
+	case http.StatusUnsupportedMediaType:
+		return ErrorCodeUnsupportedMediaType
+	case http.StatusTooManyRequests:
+		return ErrorCodeRateLimited
+	case http.StatusMisdirectedRequest:
+		return ErrorCodeMisdirectedRequest
+	case http.StatusBadGateway:
+		return ErrorCodeBadGateway
+	case http.StatusServiceUnavailable:
+		return ErrorCodeTimeout
+	default:
+		return ErrorCodeInternalError
+	}
+}
@@ -0,0 +1,276 @@
+package apitypes_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/stretchr/testify/require"
+)
+
+type openAPIDocument struct {
+	OpenAPI    string                    `json:"openapi"`
+	Paths      map[string]map[string]any `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]struct {
+				Enum []string `json:"enum"`
+			} `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadSpec(t *testing.T) openAPIDocument {
+	t.Helper()
+
+	var doc openAPIDocument
+	require.NoError(t, json.Unmarshal(apitypes.OpenAPISpec, &doc))
+
+	return doc
+}
+
+// schemaTypes maps OpenAPI schema names to the Go types they describe.
+var schemaTypes = map[string]any{
+	"CreateDocumentRequest":     apitypes.CreateDocumentRequest{},
+	"CreateDocumentResponse":    apitypes.CreateDocumentResponse{},
+	"CopyDocumentRequest":       apitypes.CopyDocumentRequest{},
+	"SlugResponse":              apitypes.SlugResponse{},
+	"TokenResponse":             apitypes.TokenResponse{},
+	"RefreshTokenRequest":       apitypes.RefreshTokenRequest{},
+	"RevokeTokenRequest":        apitypes.RevokeTokenRequest{},
+	"GetDocumentResponse":       apitypes.GetDocumentResponse{},
+	"UpdateDocumentRequest":     apitypes.UpdateDocumentRequest{},
+	"DocumentMetadataResponse":  apitypes.DocumentMetadataResponse{},
+	"DocumentStatsResponse":     apitypes.DocumentStatsResponse{},
+	"Operation":                 apitypes.Operation{},
+	"ChangesResponse":           apitypes.ChangesResponse{},
+	"HistoryResponse":           apitypes.HistoryResponse{},
+	"RevisionResponse":          apitypes.RevisionResponse{},
+	"DocumentShare":             apitypes.DocumentShare{},
+	"PermissionsResponse":       apitypes.PermissionsResponse{},
+	"GrantPermissionRequest":    apitypes.GrantPermissionRequest{},
+	"SetPermissionRequest":      apitypes.SetPermissionRequest{},
+	"CreateShareLinkRequest":    apitypes.CreateShareLinkRequest{},
+	"ShareLink":                 apitypes.ShareLink{},
+	"CreateShareLinkResponse":   apitypes.CreateShareLinkResponse{},
+	"BatchCreateDocument":       apitypes.BatchCreateDocument{},
+	"BatchCreateRequest":        apitypes.BatchCreateRequest{},
+	"BatchCreateResponse":       apitypes.BatchCreateResponse{},
+	"SetTagsRequest":            apitypes.SetTagsRequest{},
+	"TagsResponse":              apitypes.TagsResponse{},
+	"ArchiveResponse":           apitypes.ArchiveResponse{},
+	"RevertResponse":            apitypes.RevertResponse{},
+	"ReplaceContentRequest":     apitypes.ReplaceContentRequest{},
+	"ReplaceContentResponse":    apitypes.ReplaceContentResponse{},
+	"AttachmentResponse":        apitypes.AttachmentResponse{},
+	"CreateCommentRequest":      apitypes.CreateCommentRequest{},
+	"Comment":                   apitypes.Comment{},
+	"ListCommentsResponse":      apitypes.ListCommentsResponse{},
+	"DocumentSummary":           apitypes.DocumentSummary{},
+	"ListUserDocumentsResponse": apitypes.ListUserDocumentsResponse{},
+	"StarResponse":              apitypes.StarResponse{},
+	"ListStarredResponse":       apitypes.ListStarredResponse{},
+	"NotificationSettings":      apitypes.NotificationSettings{},
+	"BatchDeleteRequest":        apitypes.BatchDeleteRequest{},
+	"BatchResult":               apitypes.BatchResult{},
+	"BatchDeleteResponse":       apitypes.BatchDeleteResponse{},
+	"CreateAPIKeyRequest":       apitypes.CreateAPIKeyRequest{},
+	"APIKey":                    apitypes.APIKey{},
+	"CreateAPIKeyResponse":      apitypes.CreateAPIKeyResponse{},
+	"ListAPIKeysResponse":       apitypes.ListAPIKeysResponse{},
+	"CreateWebhookRequest":      apitypes.CreateWebhookRequest{},
+	"Webhook":                   apitypes.Webhook{},
+	"CreateWebhookResponse":     apitypes.CreateWebhookResponse{},
+	"ListWebhooksResponse":      apitypes.ListWebhooksResponse{},
+	"CreateBotRequest":          apitypes.CreateBotRequest{},
+	"Bot":                       apitypes.Bot{},
+	"ListBotsResponse":          apitypes.ListBotsResponse{},
+	"CreateGroupRequest":        apitypes.CreateGroupRequest{},
+	"Group":                     apitypes.Group{},
+	"ListGroupsResponse":        apitypes.ListGroupsResponse{},
+	"BotEditRequest":            apitypes.BotEditRequest{},
+	"BotEditResponse":           apitypes.BotEditResponse{},
+	"DocumentEvent":             apitypes.DocumentEvent{},
+	"AdminSession":              apitypes.AdminSession{},
+	"OperationLatency":          apitypes.OperationLatency{},
+	"StageLatency":              apitypes.StageLatency{},
+	"ListSessionsResponse":      apitypes.ListSessionsResponse{},
+	"ListDocumentsResponse":     apitypes.ListDocumentsResponse{},
+	"AdminSummaryResponse":      apitypes.AdminSummaryResponse{},
+	"HotDocument":               apitypes.HotDocument{},
+	"BroadcastQueue":            apitypes.BroadcastQueue{},
+	"ChainBucket":               apitypes.ChainBucket{},
+	"HealthResponse":            apitypes.HealthResponse{},
+	"ErrorResponse":             apitypes.ErrorResponse{},
+}
+
+func TestOpenAPISpec_IsOpenAPI3(t *testing.T) {
+	t.Parallel()
+
+	doc := loadSpec(t)
+
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("expected OpenAPI 3 document, got version %q", doc.OpenAPI)
+	}
+}
+
+func TestOpenAPISpec_DescribesRoutes(t *testing.T) {
+	t.Parallel()
+
+	doc := loadSpec(t)
+
+	routes := map[string][]string{
+		"/v1/documents":                                   {"get", "post"},
+		"/v1/documents/batch":                             {"post"},
+		"/v1/documents/batch-delete":                      {"post"},
+		"/v1/documents/import":                            {"post"},
+		"/v1/documents/{id}":                              {"get", "head", "patch", "delete"},
+		"/v1/documents/{id}/content":                      {"put"},
+		"/v1/documents/{id}/copy":                         {"post"},
+		"/v1/documents/{id}/export":                       {"get"},
+		"/v1/documents/{id}/stats":                        {"get"},
+		"/v1/documents/{id}/changes":                      {"get"},
+		"/v1/documents/{id}/history":                      {"get"},
+		"/v1/documents/{id}/revisions/{revision}":         {"get"},
+		"/v1/documents/{id}/tags":                         {"get", "put"},
+		"/v1/documents/{id}/archive":                      {"get", "put", "delete"},
+		"/v1/documents/{id}/undo":                         {"post"},
+		"/v1/documents/{id}/redo":                         {"post"},
+		"/v1/documents/{id}/permissions":                  {"get", "post"},
+		"/v1/documents/{id}/permissions/{userId}":         {"put", "delete"},
+		"/v1/documents/{id}/links":                        {"post"},
+		"/v1/documents/{id}/attachments":                  {"post"},
+		"/v1/documents/{id}/attachments/{attachmentId}":   {"get"},
+		"/v1/documents/{id}/comments":                     {"get", "post"},
+		"/v1/documents/{id}/comments/{commentId}/resolve": {"post"},
+		"/v1/documents/{id}/star":                         {"get", "put", "delete"},
+		"/v1/starred":                                     {"get"},
+		"/v1/notifications":                               {"get", "put"},
+		"/v1/slugs/{slug}":                                {"get"},
+		"/v1/apikeys":                                     {"get", "post"},
+		"/v1/apikeys/{keyId}":                             {"delete"},
+		"/v1/bots":                                        {"get", "post"},
+		"/v1/bots/{botId}":                                {"get", "delete"},
+		"/v1/bots/{botId}/documents/{id}":                 {"put", "delete"},
+		"/v1/bots/{botId}/documents/{id}/edits":           {"post"},
+		"/v1/groups":                                      {"get", "post"},
+		"/v1/groups/{groupId}":                            {"get", "delete"},
+		"/v1/groups/{groupId}/members/{userId}":           {"put", "delete"},
+		"/v1/webhooks":                                    {"get", "post"},
+		"/v1/webhooks/{webhookId}":                        {"delete"},
+		"/v1/events":                                      {"get"},
+		"/v1/admin/documents":                             {"get"},
+		"/v1/admin/summary":                               {"get"},
+		"/v1/admin/sessions":                              {"get"},
+		"/v1/admin/sessions/{id}":                         {"delete"},
+		"/v1/admin/sessions/{id}/snapshot":                {"post"},
+		"/auth/oidc/login":                                {"get"},
+		"/auth/oidc/callback":                             {"get"},
+		"/auth/logout":                                    {"post"},
+		"/auth/login":                                     {"post"},
+		"/auth/refresh":                                   {"post"},
+		"/auth/revoke":                                    {"post"},
+		"/v1/ws":                                          {"get"},
+		"/v1/graphql":                                     {"post"},
+		"/healthz":                                        {"get"},
+		"/readyz":                                         {"get"},
+		"/v1/openapi.json":                                {"get"},
+	}
+
+	for path, methods := range routes {
+		item, ok := doc.Paths[path]
+		if !ok {
+			t.Errorf("spec is missing path %s", path)
+
+			continue
+		}
+
+		for _, method := range methods {
+			if _, ok := item[method]; !ok {
+				t.Errorf("spec is missing %s %s", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestOpenAPISpec_SchemasMatchTypes(t *testing.T) {
+	t.Parallel()
+
+	doc := loadSpec(t)
+
+	for name, value := range schemaTypes {
+		schema, ok := doc.Components.Schemas[name]
+		if !ok {
+			t.Errorf("spec is missing schema %s", name)
+
+			continue
+		}
+
+		want := jsonFields(reflect.TypeOf(value))
+
+		got := make([]string, 0, len(schema.Properties))
+		for prop := range schema.Properties {
+			got = append(got, prop)
+		}
+
+		slices.Sort(got)
+
+		if !slices.Equal(got, want) {
+			t.Errorf("schema %s has properties %v, Go type has %v", name, got, want)
+		}
+	}
+}
+
+func TestOpenAPISpec_ErrorCodes(t *testing.T) {
+	t.Parallel()
+
+	doc := loadSpec(t)
+
+	got := doc.Components.Schemas["ErrorResponse"].Properties["code"].Enum
+	want := []string{
+		apitypes.ErrorCodeInvalidRequest,
+		apitypes.ErrorCodeUnauthorized,
+		apitypes.ErrorCodeAccessDenied,
+		apitypes.ErrorCodeNotFound,
+		apitypes.ErrorCodeMethodNotAllowed,
+		apitypes.ErrorCodeConflict,
+		apitypes.ErrorCodeGone,
+		apitypes.ErrorCodePreconditionFailed,
+		apitypes.ErrorCodePayloadTooLarge,
+		apitypes.ErrorCodeUnsupportedMediaType,
+		apitypes.ErrorCodeRateLimited,
+		apitypes.ErrorCodeMisdirectedRequest,
+		apitypes.ErrorCodeBadGateway,
+		apitypes.ErrorCodeTimeout,
+		apitypes.ErrorCodeUnavailable,
+		apitypes.ErrorCodeInternalError,
+	}
+
+	slices.Sort(got)
+	slices.Sort(want)
+
+	if !slices.Equal(got, want) {
+		t.Errorf("error code enum %v does not match constants %v", got, want)
+	}
+}
+
+// jsonFields returns the sorted JSON field names of a struct type.
+func jsonFields(typ reflect.Type) []string {
+	fields := make([]string, 0, typ.NumField())
+
+	for i := range typ.NumField() {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		fields = append(fields, name)
+	}
+
+	slices.Sort(fields)
+
+	return fields
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"slices"
+	"sync"
+)
+
+// MemorySessionStore is an in-memory implementation of the SessionStore interface.
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]Session
+}
+
+// NewMemorySessionStore creates a new in-memory session store.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[string]Session),
+	}
+}
+
+// Save stores a session.
+func (m *MemorySessionStore) Save(session Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[session.ID] = session
+
+	return nil
+}
+
+// Get returns a session by ID.
+func (m *MemorySessionStore) Get(sessionID string) (Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	session, exists := m.sessions[sessionID]
+	if !exists {
+		return Session{}, ErrSessionNotFound
+	}
+
+	return session, nil
+}
+
+// Delete removes a session.
+func (m *MemorySessionStore) Delete(sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.sessions[sessionID]; !exists {
+		return ErrSessionNotFound
+	}
+
+	delete(m.sessions, sessionID)
+
+	return nil
+}
+
+// Ensure MemorySessionStore implements SessionStore.
+var _ SessionStore = (*MemorySessionStore)(nil)
+
+// MemoryTokenStore is an in-memory implementation of the TokenStore interface.
+type MemoryTokenStore struct {
+	mu     sync.RWMutex
+	grants map[string]Grant
+	hashes map[string]string // token hash -> grant ID
+}
+
+// NewMemoryTokenStore creates a new in-memory token store.
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		grants: make(map[string]Grant),
+		hashes: make(map[string]string),
+	}
+}
+
+// Save stores a grant, replacing any grant with the same ID.
+func (m *MemoryTokenStore) Save(grant Grant) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.unindex(grant.ID)
+
+	grant.RetiredRefreshHashes = slices.Clone(grant.RetiredRefreshHashes)
+	m.grants[grant.ID] = grant
+
+	for _, hash := range tokenHashes(grant) {
+		m.hashes[hash] = grant.ID
+	}
+
+	return nil
+}
+
+// GetByTokenHash returns the grant a token hash belongs to.
+func (m *MemoryTokenStore) GetByTokenHash(hash string) (Grant, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	grant, exists := m.grants[m.hashes[hash]]
+	if !exists {
+		return Grant{}, ErrGrantNotFound
+	}
+
+	grant.RetiredRefreshHashes = slices.Clone(grant.RetiredRefreshHashes)
+
+	return grant, nil
+}
+
+// Delete removes a grant.
+func (m *MemoryTokenStore) Delete(grantID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.grants[grantID]; !exists {
+		return ErrGrantNotFound
+	}
+
+	m.unindex(grantID)
+	delete(m.grants, grantID)
+
+	return nil
+}
+
+// unindex removes the token hashes of a stored grant. Callers hold the lock.
+func (m *MemoryTokenStore) unindex(grantID string) {
+	for _, hash := range tokenHashes(m.grants[grantID]) {
+		delete(m.hashes, hash)
+	}
+}
+
+// tokenHashes returns every token hash that identifies a grant.
+func tokenHashes(grant Grant) []string {
+	hashes := append([]string{grant.AccessHash, grant.RefreshHash}, grant.RetiredRefreshHashes...)
+
+	return slices.DeleteFunc(hashes, func(hash string) bool { return hash == "" })
+}
+
+// Ensure MemoryTokenStore implements TokenStore.
+var _ TokenStore = (*MemoryTokenStore)(nil)
@@ -0,0 +1,115 @@
+// Package auth manages server-side login sessions.
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+)
+
+// Common errors.
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionExpired  = errors.New("session expired")
+)
+
+// DefaultSessionTTL is the session lifetime used when none is configured.
+const DefaultSessionTTL = 24 * time.Hour
+
+// Session is an authenticated login session, referenced by a cookie.
+type Session struct {
+	ID        string
+	UserID    string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// SessionStore defines the interface for persisting login sessions.
+type SessionStore interface {
+	// Save stores a session, replacing any session with the same ID.
+	Save(session Session) error
+
+	// Get returns a session by ID.
+	// Returns ErrSessionNotFound if the session doesn't exist.
+	Get(sessionID string) (Session, error)
+
+	// Delete removes a session.
+	// Returns ErrSessionNotFound if the session doesn't exist.
+	Delete(sessionID string) error
+}
+
+// SessionManager creates and resolves login sessions.
+type SessionManager struct {
+	store SessionStore
+	ttl   time.Duration
+}
+
+// NewSessionManager creates a session manager.
+// A zero ttl uses DefaultSessionTTL.
+func NewSessionManager(store SessionStore, ttl time.Duration) *SessionManager {
+	if ttl == 0 {
+		ttl = DefaultSessionTTL
+	}
+
+	return &SessionManager{store: store, ttl: ttl}
+}
+
+// TTL returns the session lifetime.
+func (m *SessionManager) TTL() time.Duration {
+	return m.ttl
+}
+
+// Create starts a new session for a user.
+func (m *SessionManager) Create(userID string) (Session, error) {
+	id, err := RandomToken()
+	if err != nil {
+		return Session{}, err
+	}
+
+	now := time.Now()
+	session := Session{
+		ID:        id,
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(m.ttl),
+	}
+
+	if err := m.store.Save(session); err != nil {
+		return Session{}, err
+	}
+
+	return session, nil
+}
+
+// Resolve returns the session for an ID if it exists and hasn't expired.
+// Expired sessions are removed.
+func (m *SessionManager) Resolve(sessionID string) (Session, error) {
+	session, err := m.store.Get(sessionID)
+	if err != nil {
+		return Session{}, err
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		_ = m.store.Delete(sessionID)
+
+		return Session{}, ErrSessionExpired
+	}
+
+	return session, nil
+}
+
+// Revoke ends a session.
+func (m *SessionManager) Revoke(sessionID string) error {
+	return m.store.Delete(sessionID)
+}
+
+// RandomToken returns a random URL-safe token with 256 bits of entropy.
+func RandomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,110 @@
+package auth_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/auth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionManager_CreateAndResolve(t *testing.T) {
+	t.Parallel()
+
+	manager := auth.NewSessionManager(auth.NewMemorySessionStore(), 0)
+
+	if manager.TTL() != auth.DefaultSessionTTL {
+		t.Errorf("expected default TTL, got %v", manager.TTL())
+	}
+
+	session, err := manager.Create("alice")
+	require.NoError(t, err)
+
+	got, err := manager.Resolve(session.ID)
+	require.NoError(t, err)
+
+	if got.UserID != "alice" {
+		t.Errorf("expected user 'alice', got %q", got.UserID)
+	}
+}
+
+func TestSessionManager_Expired(t *testing.T) {
+	t.Parallel()
+
+	store := auth.NewMemorySessionStore()
+	manager := auth.NewSessionManager(store, time.Hour)
+
+	require.NoError(t, store.Save(auth.Session{
+		ID:        "old",
+		UserID:    "alice",
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}))
+
+	if _, err := manager.Resolve("old"); !errors.Is(err, auth.ErrSessionExpired) {
+		t.Errorf("expected ErrSessionExpired, got %v", err)
+	}
+
+	// Expired sessions are removed
+	if _, err := store.Get("old"); !errors.Is(err, auth.ErrSessionNotFound) {
+		t.Errorf("expected expired session to be deleted, got %v", err)
+	}
+}
+
+func TestSessionManager_Revoke(t *testing.T) {
+	t.Parallel()
+
+	manager := auth.NewSessionManager(auth.NewMemorySessionStore(), time.Hour)
+
+	session, err := manager.Create("alice")
+	require.NoError(t, err)
+
+	require.NoError(t, manager.Revoke(session.ID))
+
+	if _, err := manager.Resolve(session.ID); !errors.Is(err, auth.ErrSessionNotFound) {
+		t.Errorf("expected ErrSessionNotFound, got %v", err)
+	}
+
+	if err := manager.Revoke(session.ID); !errors.Is(err, auth.ErrSessionNotFound) {
+		t.Errorf("expected ErrSessionNotFound on second revoke, got %v", err)
+	}
+}
+
+func TestSessionManager_CreateStoreError(t *testing.T) {
+	t.Parallel()
+
+	manager := auth.NewSessionManager(failingSessionStore{}, time.Hour)
+
+	if _, err := manager.Create("alice"); err == nil {
+		t.Error("expected error from store")
+	}
+}
+
+func TestRandomToken(t *testing.T) {
+	t.Parallel()
+
+	a, err := auth.RandomToken()
+	require.NoError(t, err)
+
+	b, err := auth.RandomToken()
+	require.NoError(t, err)
+
+	if a == b {
+		t.Error("expected distinct tokens")
+	}
+
+	if len(a) != 43 {
+		t.Errorf("expected 43-character token, got %d", len(a))
+	}
+}
+
+// failingSessionStore is a SessionStore that fails every call.
+type failingSessionStore struct{}
+
+func (failingSessionStore) Save(_ auth.Session) error { return errors.New("save failed") }
+
+func (failingSessionStore) Get(_ string) (auth.Session, error) {
+	return auth.Session{}, auth.ErrSessionNotFound
+}
+
+func (failingSessionStore) Delete(_ string) error { return auth.ErrSessionNotFound }
@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Token errors.
+var (
+	ErrGrantNotFound = errors.New("grant not found")
+	ErrInvalidToken  = errors.New("invalid token")
+	ErrTokenExpired  = errors.New("token expired")
+)
+
+// Default token lifetimes, used when none are configured.
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// Token prefixes tell access and refresh tokens apart at a glance.
+const (
+	accessTokenPrefix  = "oda_"
+	refreshTokenPrefix = "odr_"
+)
+
+// maxRetiredRefreshHashes bounds how many rotated refresh tokens a grant
+// remembers for reuse detection.
+const maxRetiredRefreshHashes = 16
+
+// Grant is a login that issued a token pair. Refreshing rotates its tokens
+// but keeps the grant, so revoking it ends every token issued since login.
+// Tokens are stored as SHA-256 hashes.
+type Grant struct {
+	ID               string
+	UserID           string
+	CreatedAt        time.Time
+	AccessHash       string
+	AccessExpiresAt  time.Time
+	RefreshHash      string
+	RefreshExpiresAt time.Time
+
+	// RetiredRefreshHashes are refresh tokens already rotated out. Presenting
+	// one again means the token leaked, so the grant is revoked.
+	RetiredRefreshHashes []string
+}
+
+// TokenStore defines the interface for persisting token grants.
+type TokenStore interface {
+	// Save stores a grant, replacing any grant with the same ID.
+	Save(grant Grant) error
+
+	// GetByTokenHash returns the grant whose access, refresh or retired
+	// refresh token has the given hash.
+	// Returns ErrGrantNotFound if no grant matches.
+	GetByTokenHash(hash string) (Grant, error)
+
+	// Delete removes a grant.
+	// Returns ErrGrantNotFound if the grant doesn't exist.
+	Delete(grantID string) error
+}
+
+// TokenPair is the result of logging in or refreshing: a short-lived access
+// token and the refresh token that replaces it.
+type TokenPair struct {
+	UserID           string
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// TokenManager issues, rotates and revokes access and refresh tokens.
+type TokenManager struct {
+	store      TokenStore
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+
+	// mu serializes refreshes so a refresh token can only be rotated once
+	mu sync.Mutex
+}
+
+// NewTokenManager creates a token manager.
+// Zero TTLs use DefaultAccessTokenTTL and DefaultRefreshTokenTTL.
+func NewTokenManager(store TokenStore, accessTTL, refreshTTL time.Duration) *TokenManager {
+	if accessTTL == 0 {
+		accessTTL = DefaultAccessTokenTTL
+	}
+
+	if refreshTTL == 0 {
+		refreshTTL = DefaultRefreshTokenTTL
+	}
+
+	return &TokenManager{store: store, accessTTL: accessTTL, refreshTTL: refreshTTL}
+}
+
+// Issue starts a new grant for a user and returns its first token pair.
+func (m *TokenManager) Issue(userID string) (TokenPair, error) {
+	return m.rotate(Grant{ID: uuid.New().String(), UserID: userID, CreatedAt: time.Now()})
+}
+
+// Authenticate returns the user an access token was issued to.
+// Returns ErrInvalidToken if the token is unknown or not an access token,
+// and ErrTokenExpired if it has expired.
+func (m *TokenManager) Authenticate(accessToken string) (string, error) {
+	grant, hash, err := m.lookup(accessTokenPrefix, accessToken)
+	if err != nil {
+		return "", err
+	}
+
+	if grant.AccessHash != hash {
+		return "", ErrInvalidToken
+	}
+
+	if time.Now().After(grant.AccessExpiresAt) {
+		return "", ErrTokenExpired
+	}
+
+	return grant.UserID, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair. The old access and
+// refresh tokens stop working. Reusing a rotated refresh token revokes the
+// grant and returns ErrInvalidToken; an expired one returns ErrTokenExpired.
+func (m *TokenManager) Refresh(refreshToken string) (TokenPair, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	grant, hash, err := m.lookup(refreshTokenPrefix, refreshToken)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	if grant.RefreshHash != hash {
+		_ = m.store.Delete(grant.ID)
+
+		return TokenPair{}, ErrInvalidToken
+	}
+
+	if time.Now().After(grant.RefreshExpiresAt) {
+		_ = m.store.Delete(grant.ID)
+
+		return TokenPair{}, ErrTokenExpired
+	}
+
+	return m.rotate(grant)
+}
+
+// Revoke ends the grant an access or refresh token belongs to.
+// Returns ErrInvalidToken if the token is unknown.
+func (m *TokenManager) Revoke(token string) error {
+	prefix := accessTokenPrefix
+	if strings.HasPrefix(token, refreshTokenPrefix) {
+		prefix = refreshTokenPrefix
+	}
+
+	grant, _, err := m.lookup(prefix, token)
+	if err != nil {
+		return err
+	}
+
+	if err := m.store.Delete(grant.ID); err != nil && !errors.Is(err, ErrGrantNotFound) {
+		return err
+	}
+
+	return nil
+}
+
+// lookup returns the grant a token belongs to and the token's hash.
+func (m *TokenManager) lookup(prefix, token string) (Grant, string, error) {
+	if !strings.HasPrefix(token, prefix) {
+		return Grant{}, "", ErrInvalidToken
+	}
+
+	hash := hashToken(token)
+
+	grant, err := m.store.GetByTokenHash(hash)
+	if err != nil {
+		if errors.Is(err, ErrGrantNotFound) {
+			return Grant{}, "", ErrInvalidToken
+		}
+
+		return Grant{}, "", err
+	}
+
+	return grant, hash, nil
+}
+
+// rotate gives the grant a new token pair and saves it.
+func (m *TokenManager) rotate(grant Grant) (TokenPair, error) {
+	access, err := RandomToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	refresh, err := RandomToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	if grant.RefreshHash != "" {
+		grant.RetiredRefreshHashes = append(grant.RetiredRefreshHashes, grant.RefreshHash)
+		if excess := len(grant.RetiredRefreshHashes) - maxRetiredRefreshHashes; excess > 0 {
+			grant.RetiredRefreshHashes = grant.RetiredRefreshHashes[excess:]
+		}
+	}
+
+	now := time.Now()
+	pair := TokenPair{
+		UserID:           grant.UserID,
+		AccessToken:      accessTokenPrefix + access,
+		AccessExpiresAt:  now.Add(m.accessTTL),
+		RefreshToken:     refreshTokenPrefix + refresh,
+		RefreshExpiresAt: now.Add(m.refreshTTL),
+	}
+
+	grant.AccessHash = hashToken(pair.AccessToken)
+	grant.AccessExpiresAt = pair.AccessExpiresAt
+	grant.RefreshHash = hashToken(pair.RefreshToken)
+	grant.RefreshExpiresAt = pair.RefreshExpiresAt
+
+	if err := m.store.Save(grant); err != nil {
+		return TokenPair{}, err
+	}
+
+	return pair, nil
+}
+
+// hashToken returns the hex SHA-256 hash of a token.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,225 @@
+package auth_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/auth"
+	"github.com/stretchr/testify/require"
+)
+
+var errTokenStore = errors.New("token store unavailable")
+
+// failingTokenStore is a MemoryTokenStore whose Save or lookups fail.
+type failingTokenStore struct {
+	*auth.MemoryTokenStore
+
+	failSave bool
+	failGet  bool
+}
+
+func (f failingTokenStore) Save(grant auth.Grant) error {
+	if f.failSave {
+		return errTokenStore
+	}
+
+	return f.MemoryTokenStore.Save(grant)
+}
+
+func (f failingTokenStore) GetByTokenHash(hash string) (auth.Grant, error) {
+	if f.failGet {
+		return auth.Grant{}, errTokenStore
+	}
+
+	return f.MemoryTokenStore.GetByTokenHash(hash)
+}
+
+func TestTokenManager_IssueAndAuthenticate(t *testing.T) {
+	t.Parallel()
+
+	manager := auth.NewTokenManager(auth.NewMemoryTokenStore(), 0, 0)
+
+	pair, err := manager.Issue("alice")
+	require.NoError(t, err)
+	require.Equal(t, "alice", pair.UserID)
+
+	if !strings.HasPrefix(pair.AccessToken, "oda_") || !strings.HasPrefix(pair.RefreshToken, "odr_") {
+		t.Errorf("unexpected token formats %q and %q", pair.AccessToken, pair.RefreshToken)
+	}
+
+	if ttl := time.Until(pair.AccessExpiresAt); ttl <= 0 || ttl > auth.DefaultAccessTokenTTL {
+		t.Errorf("expected access token to expire within the default TTL, got %v", ttl)
+	}
+
+	if ttl := time.Until(pair.RefreshExpiresAt); ttl <= auth.DefaultAccessTokenTTL || ttl > auth.DefaultRefreshTokenTTL {
+		t.Errorf("expected refresh token to expire within the default TTL, got %v", ttl)
+	}
+
+	userID, err := manager.Authenticate(pair.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, "alice", userID)
+
+	// A refresh token is not an access token
+	_, err = manager.Authenticate(pair.RefreshToken)
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	_, err = manager.Authenticate("oda_unknown")
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+}
+
+func TestTokenManager_Refresh(t *testing.T) {
+	t.Parallel()
+
+	manager := auth.NewTokenManager(auth.NewMemoryTokenStore(), time.Minute, time.Hour)
+
+	first, err := manager.Issue("alice")
+	require.NoError(t, err)
+
+	second, err := manager.Refresh(first.RefreshToken)
+	require.NoError(t, err)
+	require.Equal(t, "alice", second.UserID)
+
+	// The rotated pair works and the old access token doesn't
+	_, err = manager.Authenticate(second.AccessToken)
+	require.NoError(t, err)
+
+	_, err = manager.Authenticate(first.AccessToken)
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	// Reusing a rotated refresh token revokes the whole grant
+	_, err = manager.Refresh(first.RefreshToken)
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	_, err = manager.Authenticate(second.AccessToken)
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	_, err = manager.Refresh(second.RefreshToken)
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	// An access token can't be used to refresh
+	third, err := manager.Issue("alice")
+	require.NoError(t, err)
+
+	_, err = manager.Refresh(third.AccessToken)
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+}
+
+func TestTokenManager_RefreshKeepsRecentRetiredTokens(t *testing.T) {
+	t.Parallel()
+
+	store := auth.NewMemoryTokenStore()
+	manager := auth.NewTokenManager(store, time.Minute, time.Hour)
+
+	pair, err := manager.Issue("alice")
+	require.NoError(t, err)
+
+	first := pair.RefreshToken
+
+	for range 20 {
+		pair, err = manager.Refresh(pair.RefreshToken)
+		require.NoError(t, err)
+	}
+
+	// The oldest rotated tokens are forgotten, so they're simply unknown
+	_, err = manager.Refresh(first)
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	_, err = manager.Authenticate(pair.AccessToken)
+	require.NoError(t, err, "forgotten tokens must not revoke the grant")
+}
+
+func TestTokenManager_Expired(t *testing.T) {
+	t.Parallel()
+
+	manager := auth.NewTokenManager(auth.NewMemoryTokenStore(), time.Nanosecond, time.Nanosecond)
+
+	pair, err := manager.Issue("alice")
+	require.NoError(t, err)
+
+	time.Sleep(time.Millisecond)
+
+	_, err = manager.Authenticate(pair.AccessToken)
+	require.ErrorIs(t, err, auth.ErrTokenExpired)
+
+	_, err = manager.Refresh(pair.RefreshToken)
+	require.ErrorIs(t, err, auth.ErrTokenExpired)
+
+	// Expired grants are removed
+	_, err = manager.Refresh(pair.RefreshToken)
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+}
+
+func TestTokenManager_Revoke(t *testing.T) {
+	t.Parallel()
+
+	manager := auth.NewTokenManager(auth.NewMemoryTokenStore(), time.Minute, time.Hour)
+
+	for _, pick := range []func(auth.TokenPair) string{
+		func(p auth.TokenPair) string { return p.AccessToken },
+		func(p auth.TokenPair) string { return p.RefreshToken },
+	} {
+		pair, err := manager.Issue("alice")
+		require.NoError(t, err)
+
+		require.NoError(t, manager.Revoke(pick(pair)))
+
+		_, err = manager.Authenticate(pair.AccessToken)
+		require.ErrorIs(t, err, auth.ErrInvalidToken)
+
+		_, err = manager.Refresh(pair.RefreshToken)
+		require.ErrorIs(t, err, auth.ErrInvalidToken)
+
+		require.ErrorIs(t, manager.Revoke(pick(pair)), auth.ErrInvalidToken)
+	}
+
+	require.ErrorIs(t, manager.Revoke("not-a-token"), auth.ErrInvalidToken)
+}
+
+func TestTokenManager_StoreErrors(t *testing.T) {
+	t.Parallel()
+
+	saving := auth.NewTokenManager(failingTokenStore{MemoryTokenStore: auth.NewMemoryTokenStore(), failSave: true}, 0, 0)
+
+	_, err := saving.Issue("alice")
+	require.ErrorIs(t, err, errTokenStore)
+
+	lookups := auth.NewTokenManager(failingTokenStore{MemoryTokenStore: auth.NewMemoryTokenStore(), failGet: true}, 0, 0)
+
+	_, err = lookups.Authenticate("oda_token")
+	require.ErrorIs(t, err, errTokenStore)
+
+	_, err = lookups.Refresh("odr_token")
+	require.ErrorIs(t, err, errTokenStore)
+
+	require.ErrorIs(t, lookups.Revoke("odr_token"), errTokenStore)
+}
+
+func TestMemoryTokenStore(t *testing.T) {
+	t.Parallel()
+
+	store := auth.NewMemoryTokenStore()
+
+	grant := auth.Grant{ID: "g1", UserID: "alice", AccessHash: "a1", RefreshHash: "r1"}
+	require.NoError(t, store.Save(grant))
+
+	// Saving again replaces the grant's hashes
+	grant.AccessHash, grant.RefreshHash, grant.RetiredRefreshHashes = "a2", "r2", []string{"r1"}
+	require.NoError(t, store.Save(grant))
+
+	for _, hash := range []string{"a2", "r2", "r1"} {
+		got, err := store.GetByTokenHash(hash)
+		require.NoError(t, err)
+		require.Equal(t, grant, got)
+	}
+
+	_, err := store.GetByTokenHash("a1")
+	require.ErrorIs(t, err, auth.ErrGrantNotFound)
+
+	require.NoError(t, store.Delete("g1"))
+	require.ErrorIs(t, store.Delete("g1"), auth.ErrGrantNotFound)
+
+	_, err = store.GetByTokenHash("r2")
+	require.ErrorIs(t, err, auth.ErrGrantNotFound)
+}
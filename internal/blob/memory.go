@@ -0,0 +1,64 @@
+package blob
+
+import (
+	"slices"
+	"sync"
+)
+
+// MemoryStore is an in-memory implementation of the Store interface.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	objects map[string]map[string]Object // document ID -> object ID -> object
+}
+
+// NewMemoryStore creates a new in-memory blob store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		objects: make(map[string]map[string]Object),
+	}
+}
+
+// Put stores an object, keeping its own copy of the data.
+func (m *MemoryStore) Put(obj Object) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	objects, exists := m.objects[obj.DocID]
+	if !exists {
+		objects = make(map[string]Object)
+		m.objects[obj.DocID] = objects
+	}
+
+	obj.Data = slices.Clone(obj.Data)
+	objects[obj.ID] = obj
+
+	return nil
+}
+
+// Get returns a copy of an object.
+func (m *MemoryStore) Get(docID, id string) (Object, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	obj, exists := m.objects[docID][id]
+	if !exists {
+		return Object{}, ErrNotFound
+	}
+
+	obj.Data = slices.Clone(obj.Data)
+
+	return obj, nil
+}
+
+// DeleteAll removes every object belonging to a document.
+func (m *MemoryStore) DeleteAll(docID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.objects, docID)
+
+	return nil
+}
+
+// Ensure MemoryStore implements Store.
+var _ Store = (*MemoryStore)(nil)
@@ -0,0 +1,42 @@
+package blob_test
+
+import (
+	"testing"
+
+	"github.com/serroba/online-docs/internal/blob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+
+	store := blob.NewMemoryStore()
+
+	data := []byte("image bytes")
+	require.NoError(t, store.Put(blob.Object{DocID: "doc1", ID: "a1", ContentType: "image/png", Data: data}))
+	require.NoError(t, store.Put(blob.Object{DocID: "doc1", ID: "a2", Data: []byte("second")}))
+	require.NoError(t, store.Put(blob.Object{DocID: "doc2", ID: "a1", Data: []byte("other")}))
+
+	// The store keeps its own copy of the data
+	data[0] = 'X'
+
+	obj, err := store.Get("doc1", "a1")
+	require.NoError(t, err)
+	require.Equal(t, "image bytes", string(obj.Data))
+	require.Equal(t, "image/png", obj.ContentType)
+
+	_, err = store.Get("doc1", "missing")
+	require.ErrorIs(t, err, blob.ErrNotFound)
+
+	require.NoError(t, store.DeleteAll("doc1"))
+
+	for _, id := range []string{"a1", "a2"} {
+		_, err = store.Get("doc1", id)
+		require.ErrorIs(t, err, blob.ErrNotFound)
+	}
+
+	// Other documents keep their objects
+	obj, err = store.Get("doc2", "a1")
+	require.NoError(t, err)
+	require.Equal(t, "other", string(obj.Data))
+}
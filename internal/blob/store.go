@@ -0,0 +1,33 @@
+// Package blob persists binary objects, such as files attached to documents.
+package blob
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when an object does not exist.
+var ErrNotFound = errors.New("blob not found")
+
+// Object is a stored file and its metadata.
+type Object struct {
+	DocID       string
+	ID          string
+	Name        string // Original file name, as uploaded
+	ContentType string
+	Data        []byte
+	CreatedAt   time.Time
+}
+
+// Store defines the interface for persisting objects, grouped by document.
+type Store interface {
+	// Put stores an object, replacing any object with the same document and ID.
+	Put(obj Object) error
+
+	// Get returns an object.
+	// Returns ErrNotFound if the object doesn't exist.
+	Get(docID, id string) (Object, error)
+
+	// DeleteAll removes every object belonging to a document.
+	DeleteAll(docID string) error
+}
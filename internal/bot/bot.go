@@ -0,0 +1,46 @@
+// Package bot runs server-side bots: participants that join document
+// sessions without a connection of their own and edit through the API on
+// behalf of another system, such as one appending meeting notes. A bot
+// edits as its own user, so it needs a role on each document like anyone
+// else, and its edits are rate limited.
+package bot
+
+import (
+	"errors"
+	"time"
+)
+
+// PrincipalPrefix marks user IDs that belong to bots.
+const PrincipalPrefix = "bot:"
+
+// Common errors.
+var (
+	ErrBotNotFound = errors.New("bot not found")
+	ErrBotExists   = errors.New("bot already exists")
+	ErrNotJoined   = errors.New("bot has not joined the document")
+	ErrRateLimited = errors.New("bot edit rate exceeded")
+	ErrInvalidEdit = errors.New("invalid edit")
+)
+
+// Bot is a server-side participant registered by a user.
+type Bot struct {
+	ID        string
+	OwnerID   string // User who registered the bot
+	Name      string
+	CreatedAt time.Time
+}
+
+// Principal returns the user ID the bot edits as, which documents grant
+// roles to. It is namespaced by owner so bots of different users never
+// collide.
+func (b Bot) Principal() string {
+	return PrincipalPrefix + b.OwnerID + "/" + b.Name
+}
+
+// Edit replaces Delete characters at Position with Text. A nil Position
+// is the end of the document, for appending.
+type Edit struct {
+	Position *int
+	Delete   int
+	Text     string
+}
@@ -0,0 +1,83 @@
+package bot
+
+import (
+	"slices"
+	"sync"
+)
+
+// MemoryStore is an in-memory implementation of the Store interface.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	bots map[string]Bot // bot ID -> bot
+}
+
+// NewMemoryStore creates a new in-memory bot store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{bots: make(map[string]Bot)}
+}
+
+// Save stores a bot.
+func (m *MemoryStore) Save(bot Bot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, other := range m.bots {
+		if other.ID != bot.ID && other.Principal() == bot.Principal() {
+			return ErrBotExists
+		}
+	}
+
+	m.bots[bot.ID] = bot
+
+	return nil
+}
+
+// Get returns a bot by ID.
+func (m *MemoryStore) Get(botID string) (Bot, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	bot, exists := m.bots[botID]
+	if !exists {
+		return Bot{}, ErrBotNotFound
+	}
+
+	return bot, nil
+}
+
+// Delete removes a bot.
+func (m *MemoryStore) Delete(botID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.bots[botID]; !exists {
+		return ErrBotNotFound
+	}
+
+	delete(m.bots, botID)
+
+	return nil
+}
+
+// ListByOwner returns all bots registered by a user, oldest first.
+func (m *MemoryStore) ListByOwner(ownerID string) ([]Bot, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []Bot
+
+	for _, bot := range m.bots {
+		if bot.OwnerID == ownerID {
+			result = append(result, bot)
+		}
+	}
+
+	slices.SortFunc(result, func(a, b Bot) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return result, nil
+}
+
+// Ensure MemoryStore implements Store.
+var _ Store = (*MemoryStore)(nil)
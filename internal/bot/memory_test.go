@@ -0,0 +1,40 @@
+package bot_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/bot"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+
+	store := bot.NewMemoryStore()
+	now := time.Now()
+
+	notes := bot.Bot{ID: "b1", OwnerID: "alice", Name: "notes", CreatedAt: now}
+	require.NoError(t, store.Save(notes))
+	require.NoError(t, store.Save(bot.Bot{ID: "b2", OwnerID: "bob", Name: "notes", CreatedAt: now}))
+	require.NoError(t, store.Save(bot.Bot{ID: "b3", OwnerID: "alice", Name: "digest", CreatedAt: now.Add(time.Second)}))
+
+	// Names are unique per owner
+	require.ErrorIs(t, store.Save(bot.Bot{ID: "b4", OwnerID: "alice", Name: "notes"}), bot.ErrBotExists)
+
+	got, err := store.Get("b1")
+	require.NoError(t, err)
+	require.Equal(t, notes, got)
+
+	bots, err := store.ListByOwner("alice")
+	require.NoError(t, err)
+	require.Len(t, bots, 2)
+	require.Equal(t, "notes", bots[0].Name)
+	require.Equal(t, "digest", bots[1].Name)
+
+	require.NoError(t, store.Delete("b1"))
+	require.ErrorIs(t, store.Delete("b1"), bot.ErrBotNotFound)
+
+	_, err = store.Get("b1")
+	require.ErrorIs(t, err, bot.ErrBotNotFound)
+}
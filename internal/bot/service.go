@@ -0,0 +1,328 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/ws"
+)
+
+// Default rate limits. A bot may make DefaultBurst operations at once, a
+// character each, and DefaultRate operations a second after that.
+const (
+	DefaultRate  = 50
+	DefaultBurst = 2000
+)
+
+// errNoConnection is returned by a bot's connection, which has nothing to
+// read.
+var errNoConnection = errors.New("bot: bots have no connection to read")
+
+// Config holds the dependencies and limits of a Service.
+type Config struct {
+	Store   Store
+	Manager *collab.Manager
+	Hub     *ws.Hub
+
+	Rate  float64 // Operations a second each bot may make; defaults to DefaultRate
+	Burst int     // Operations a bot may make at once, bounding an edit's size; defaults to DefaultBurst
+}
+
+// Service registers bots, joins them to documents and applies their edits.
+// Joined bots are subscribed to the hub like connected clients, so they
+// show in a document's participants, flagged as bots.
+type Service struct {
+	store   Store
+	manager *collab.Manager
+	hub     *ws.Hub
+	rate    float64
+	burst   int
+
+	mu      sync.Mutex
+	clients map[string]map[string]*ws.Client // bot ID -> document ID -> client
+	limits  map[string]*bucket               // bot ID -> its rate limit
+}
+
+// NewService creates a bot service.
+func NewService(cfg Config) *Service {
+	rate := cfg.Rate
+	if rate <= 0 {
+		rate = DefaultRate
+	}
+
+	burst := cfg.Burst
+	if burst <= 0 {
+		burst = DefaultBurst
+	}
+
+	return &Service{
+		store:   cfg.Store,
+		manager: cfg.Manager,
+		hub:     cfg.Hub,
+		rate:    rate,
+		burst:   burst,
+		clients: make(map[string]map[string]*ws.Client),
+		limits:  make(map[string]*bucket),
+	}
+}
+
+// Register creates a bot for ownerID.
+// Returns ErrBotExists if the owner already has a bot with the name.
+func (s *Service) Register(ownerID, name string) (Bot, error) {
+	bot := Bot{
+		ID:        uuid.New().String(),
+		OwnerID:   ownerID,
+		Name:      name,
+		CreatedAt: time.Now(),
+	}
+
+	if err := s.store.Save(bot); err != nil {
+		return Bot{}, err
+	}
+
+	return bot, nil
+}
+
+// Get returns a bot owned by ownerID.
+// Returns ErrBotNotFound if the bot doesn't exist or belongs to someone else.
+func (s *Service) Get(ownerID, botID string) (Bot, error) {
+	bot, err := s.store.Get(botID)
+	if err != nil {
+		return Bot{}, err
+	}
+
+	if bot.OwnerID != ownerID {
+		return Bot{}, ErrBotNotFound
+	}
+
+	return bot, nil
+}
+
+// List returns the bots owned by a user.
+func (s *Service) List(ownerID string) ([]Bot, error) {
+	return s.store.ListByOwner(ownerID)
+}
+
+// Delete removes a bot owned by ownerID, leaving the documents it joined.
+// Returns ErrBotNotFound if the bot doesn't exist or belongs to someone else.
+func (s *Service) Delete(ownerID, botID string) error {
+	if _, err := s.Get(ownerID, botID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+
+	for _, client := range s.clients[botID] {
+		s.hub.Unregister(client)
+	}
+
+	delete(s.clients, botID)
+	delete(s.limits, botID)
+	s.mu.Unlock()
+
+	return s.store.Delete(botID)
+}
+
+// Documents returns the IDs of the documents a bot has joined, sorted.
+func (s *Service) Documents(botID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Sorted(maps.Keys(s.clients[botID]))
+}
+
+// Join makes a bot owned by ownerID a participant of a document. The bot
+// needs read access to it. Joining a document twice is a no-op.
+func (s *Service) Join(ctx context.Context, ownerID, botID, docID string) error {
+	bot, err := s.Get(ownerID, botID)
+	if err != nil {
+		return err
+	}
+
+	session, err := s.manager.GetOrCreateSession(ctx, docID)
+	if err != nil {
+		return err
+	}
+
+	if _, _, err := session.GetState(bot.Principal()); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.clients[botID][docID]; ok {
+		return nil
+	}
+
+	client := ws.NewClient(uuid.New().String(), bot.Principal(), discardConn{})
+	client.Bot = true
+	s.hub.Register(client)
+	s.hub.Subscribe(client, docID)
+	s.hub.Announce(client)
+
+	if s.clients[botID] == nil {
+		s.clients[botID] = make(map[string]*ws.Client)
+	}
+
+	s.clients[botID][docID] = client
+
+	return nil
+}
+
+// Leave removes a bot owned by ownerID from a document's participants.
+// Returns ErrNotJoined if the bot hasn't joined the document.
+func (s *Service) Leave(ownerID, botID, docID string) error {
+	if _, err := s.Get(ownerID, botID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, ok := s.clients[botID][docID]
+	if !ok {
+		return ErrNotJoined
+	}
+
+	s.hub.Unregister(client)
+	delete(s.clients[botID], docID)
+
+	return nil
+}
+
+// Edit applies an edit by a bot owned by ownerID to a document it joined,
+// a character at a time like a client typing, and returns the revision of
+// its last operation. It needs write access to the document.
+// Returns ErrNotJoined if the bot hasn't joined the document, ErrInvalidEdit
+// if the edit doesn't fit the document or is larger than the burst, and
+// ErrRateLimited if the bot is editing too fast.
+func (s *Service) Edit(ctx context.Context, ownerID, botID, docID string, edit Edit) (int, error) {
+	bot, err := s.Get(ownerID, botID)
+	if err != nil {
+		return 0, err
+	}
+
+	ops := edit.Delete + utf8.RuneCountInString(edit.Text)
+
+	switch {
+	case edit.Delete < 0 || (edit.Position != nil && *edit.Position < 0):
+		return 0, fmt.Errorf("%w: position and delete must not be negative", ErrInvalidEdit)
+	case edit.Delete > 0 && edit.Position == nil:
+		return 0, fmt.Errorf("%w: deleting needs a position", ErrInvalidEdit)
+	case ops == 0:
+		return 0, fmt.Errorf("%w: nothing to change", ErrInvalidEdit)
+	case ops > s.burst:
+		return 0, fmt.Errorf("%w: %d operations are more than the limit of %d", ErrInvalidEdit, ops, s.burst)
+	}
+
+	client, err := s.reserve(botID, docID, ops)
+	if err != nil {
+		return 0, err
+	}
+
+	session, err := s.manager.GetOrCreateSession(ctx, docID)
+	if err != nil {
+		return 0, err
+	}
+
+	content, revision, err := session.GetState(bot.Principal())
+	if err != nil {
+		return 0, err
+	}
+
+	length := utf8.RuneCountInString(content)
+
+	position := length
+	if edit.Position != nil {
+		position = *edit.Position
+	}
+
+	if position+edit.Delete > length {
+		return 0, fmt.Errorf("%w: the document has %d characters", ErrInvalidEdit, length)
+	}
+
+	// Each operation is based on the last, and transformed past other
+	// users' edits made meanwhile
+	for range edit.Delete {
+		revision, err = session.ApplyOperation(client.ID, client.UserID, ot.NewDelete(position, client.UserID), revision)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	for i, char := range []rune(edit.Text) {
+		op := ot.NewInsert(string(char), position+i, client.UserID)
+
+		revision, err = session.ApplyOperation(client.ID, client.UserID, op, revision)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return revision, nil
+}
+
+// reserve takes ops operations from a bot's rate limit and returns its
+// client for the document.
+func (s *Service) reserve(botID, docID string, ops int) (*ws.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, ok := s.clients[botID][docID]
+	if !ok {
+		return nil, ErrNotJoined
+	}
+
+	limit, ok := s.limits[botID]
+	if !ok {
+		limit = &bucket{tokens: float64(s.burst), last: time.Now()}
+		s.limits[botID] = limit
+	}
+
+	if !limit.take(ops, time.Now(), s.rate, s.burst) {
+		return nil, ErrRateLimited
+	}
+
+	return client, nil
+}
+
+// bucket is a token bucket limiting how fast a bot edits.
+type bucket struct {
+	tokens float64
+	last   time.Time // When tokens was last topped up
+}
+
+// take tops the bucket up for the time since it was last, then takes n
+// tokens if it holds that many.
+func (b *bucket) take(n int, now time.Time, rate float64, burst int) bool {
+	b.tokens = min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens < float64(n) {
+		return false
+	}
+
+	b.tokens -= float64(n)
+
+	return true
+}
+
+// discardConn is a joined bot's connection. Bots read the document through
+// the session when they edit, so broadcasts to them are discarded.
+type discardConn struct{}
+
+func (discardConn) WriteJSON(_ any) error { return nil }
+
+func (discardConn) ReadJSON(_ any) error { return errNoConnection }
+
+func (discardConn) Close() error { return nil }
@@ -0,0 +1,185 @@
+package bot_test
+
+import (
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/bot"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// testEnv is a bot service over a document "doc" owned by alice.
+type testEnv struct {
+	bots      *bot.Service
+	hub       *ws.Hub
+	manager   *collab.Manager
+	permStore *acl.MemoryStore
+}
+
+func newTestEnv(t *testing.T, cfg bot.Config) *testEnv {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc", "alice", acl.Owner))
+
+	hub := ws.NewHub()
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore, Hub: hub})
+
+	cfg.Store, cfg.Manager, cfg.Hub = bot.NewMemoryStore(), manager, hub
+
+	return &testEnv{bots: bot.NewService(cfg), hub: hub, manager: manager, permStore: permStore}
+}
+
+// content returns the document's content.
+func (e *testEnv) content(t *testing.T) string {
+	t.Helper()
+
+	session, err := e.manager.GetOrCreateSession(t.Context(), "doc")
+	require.NoError(t, err)
+
+	content, _, err := session.GetState("alice")
+	require.NoError(t, err)
+
+	return content
+}
+
+func at(position int) *int {
+	return &position
+}
+
+func TestService_Edit(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, bot.Config{})
+
+	notes, err := env.bots.Register("alice", "notes")
+	require.NoError(t, err)
+	require.Equal(t, "bot:alice/notes", notes.Principal())
+
+	// Bots need a role like anyone else
+	require.ErrorIs(t, env.bots.Join(t.Context(), "alice", notes.ID, "doc"), acl.ErrAccessDenied)
+	require.NoError(t, env.permStore.Grant("doc", notes.Principal(), acl.Editor))
+
+	_, err = env.bots.Edit(t.Context(), "alice", notes.ID, "doc", bot.Edit{Text: "hi"})
+	require.ErrorIs(t, err, bot.ErrNotJoined)
+
+	require.NoError(t, env.bots.Join(t.Context(), "alice", notes.ID, "doc"))
+	require.NoError(t, env.bots.Join(t.Context(), "alice", notes.ID, "doc"))
+	require.Equal(t, []string{"doc"}, env.bots.Documents(notes.ID))
+	require.Equal(t, []ws.Participant{{UserID: "bot:alice/notes", Bot: true}}, env.hub.Participants("doc"))
+
+	revision, err := env.bots.Edit(t.Context(), "alice", notes.ID, "doc", bot.Edit{Text: "Notes: ✓"})
+	require.NoError(t, err)
+	require.Equal(t, 8, revision)
+
+	edit := bot.Edit{Position: at(0), Delete: 6, Text: "Done"}
+
+	revision, err = env.bots.Edit(t.Context(), "alice", notes.ID, "doc", edit)
+	require.NoError(t, err)
+	require.Equal(t, 18, revision)
+	require.Equal(t, "Done ✓", env.content(t))
+
+	require.NoError(t, env.bots.Leave("alice", notes.ID, "doc"))
+	require.ErrorIs(t, env.bots.Leave("alice", notes.ID, "doc"), bot.ErrNotJoined)
+	require.Empty(t, env.hub.Participants("doc"))
+}
+
+func TestService_EditInvalid(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, bot.Config{Burst: 10})
+
+	notes, err := env.bots.Register("alice", "notes")
+	require.NoError(t, err)
+	require.NoError(t, env.permStore.Grant("doc", notes.Principal(), acl.Editor))
+	require.NoError(t, env.bots.Join(t.Context(), "alice", notes.ID, "doc"))
+
+	_, err = env.bots.Edit(t.Context(), "alice", notes.ID, "doc", bot.Edit{Text: "abc"})
+	require.NoError(t, err)
+
+	tests := map[string]bot.Edit{
+		"empty":              {},
+		"negative position":  {Position: at(-1), Text: "x"},
+		"negative delete":    {Position: at(0), Delete: -1},
+		"delete at the end":  {Delete: 1},
+		"past the end":       {Position: at(4), Text: "x"},
+		"deleting too much":  {Position: at(1), Delete: 3},
+		"larger than bursts": {Text: "01234567890"},
+	}
+
+	for name, edit := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := env.bots.Edit(t.Context(), "alice", notes.ID, "doc", edit)
+			require.ErrorIs(t, err, bot.ErrInvalidEdit)
+		})
+	}
+}
+
+func TestService_RateLimit(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, bot.Config{Rate: 0.001, Burst: 5})
+
+	notes, err := env.bots.Register("alice", "notes")
+	require.NoError(t, err)
+	require.NoError(t, env.permStore.Grant("doc", notes.Principal(), acl.Editor))
+	require.NoError(t, env.bots.Join(t.Context(), "alice", notes.ID, "doc"))
+
+	_, err = env.bots.Edit(t.Context(), "alice", notes.ID, "doc", bot.Edit{Text: "abc"})
+	require.NoError(t, err)
+
+	_, err = env.bots.Edit(t.Context(), "alice", notes.ID, "doc", bot.Edit{Text: "def"})
+	require.ErrorIs(t, err, bot.ErrRateLimited)
+	require.Equal(t, "abc", env.content(t))
+}
+
+func TestService_ReadOnly(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, bot.Config{})
+
+	notes, err := env.bots.Register("alice", "notes")
+	require.NoError(t, err)
+	require.NoError(t, env.permStore.Grant("doc", notes.Principal(), acl.Viewer))
+	require.NoError(t, env.bots.Join(t.Context(), "alice", notes.ID, "doc"))
+
+	_, err = env.bots.Edit(t.Context(), "alice", notes.ID, "doc", bot.Edit{Text: "x"})
+	require.ErrorIs(t, err, acl.ErrAccessDenied)
+}
+
+func TestService_Owner(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, bot.Config{})
+
+	notes, err := env.bots.Register("alice", "notes")
+	require.NoError(t, err)
+
+	_, err = env.bots.Register("alice", "notes")
+	require.ErrorIs(t, err, bot.ErrBotExists)
+
+	// Other users can't see or drive alice's bots
+	_, err = env.bots.Get("bob", notes.ID)
+	require.ErrorIs(t, err, bot.ErrBotNotFound)
+	require.ErrorIs(t, env.bots.Join(t.Context(), "bob", notes.ID, "doc"), bot.ErrBotNotFound)
+	require.ErrorIs(t, env.bots.Delete("bob", notes.ID), bot.ErrBotNotFound)
+
+	bots, err := env.bots.List("bob")
+	require.NoError(t, err)
+	require.Empty(t, bots)
+
+	// Deleting a bot makes it leave its documents
+	require.NoError(t, env.permStore.Grant("doc", notes.Principal(), acl.Editor))
+	require.NoError(t, env.bots.Join(t.Context(), "alice", notes.ID, "doc"))
+	require.NoError(t, env.bots.Delete("alice", notes.ID))
+	require.Empty(t, env.hub.Participants("doc"))
+	require.Empty(t, env.bots.Documents(notes.ID))
+}
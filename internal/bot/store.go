@@ -0,0 +1,19 @@
+package bot
+
+// Store defines the interface for persisting bot registrations.
+type Store interface {
+	// Save stores a bot.
+	// Returns ErrBotExists if its owner already has a bot with its name.
+	Save(bot Bot) error
+
+	// Get returns a bot by ID.
+	// Returns ErrBotNotFound if the bot doesn't exist.
+	Get(botID string) (Bot, error)
+
+	// Delete removes a bot.
+	// Returns ErrBotNotFound if the bot doesn't exist.
+	Delete(botID string) error
+
+	// ListByOwner returns all bots registered by a user.
+	ListByOwner(ownerID string) ([]Bot, error)
+}
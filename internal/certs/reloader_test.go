@@ -0,0 +1,90 @@
+package certs_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/certs"
+	"github.com/stretchr/testify/require"
+)
+
+// writePair writes a self-signed certificate for commonName and its key to
+// dir, returning the file paths.
+func writePair(t *testing.T, dir, commonName string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return certFile, keyFile
+}
+
+func commonName(t *testing.T, r *certs.Reloader) string {
+	t.Helper()
+
+	cert, err := r.TLSConfig().GetCertificate(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+
+	return leaf.Subject.CommonName
+}
+
+func TestReloader(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	certFile, keyFile := writePair(t, dir, "first")
+
+	r, err := certs.NewReloader(certFile, keyFile)
+	require.NoError(t, err)
+	require.Equal(t, "first", commonName(t, r))
+
+	// Rotated files are picked up on reload
+	writePair(t, dir, "second")
+	require.NoError(t, r.Reload())
+	require.Equal(t, "second", commonName(t, r))
+
+	// A broken pair keeps the current certificate
+	require.NoError(t, os.WriteFile(keyFile, []byte("garbage"), 0o600))
+	require.ErrorContains(t, r.Reload(), "load certificate")
+	require.Equal(t, "second", commonName(t, r))
+}
+
+func TestNewReloader_MissingFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	_, err := certs.NewReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	require.ErrorContains(t, err, "load certificate")
+}
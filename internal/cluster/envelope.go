@@ -0,0 +1,88 @@
+// Package cluster connects the WebSocket hubs of several server instances,
+// so clients of one document can be spread across instances behind a load
+// balancer.
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/ws"
+)
+
+// peer is the part every bridge shares: the local hub, and the node ID that
+// marks this instance's own broadcasts.
+type peer struct {
+	hub    *ws.Hub
+	node   string
+	logger *slog.Logger
+}
+
+func newPeer(hub *ws.Hub, logger *slog.Logger) peer {
+	return peer{hub: hub, node: uuid.New().String(), logger: logging.Component(logger, "cluster")}
+}
+
+// encode wraps a hub message for other instances.
+func (p peer) encode(docID string, msg ws.Message) ([]byte, error) {
+	return encode(p.node, docID, msg)
+}
+
+// deliver passes a broadcast from another instance to the hub.
+func (p peer) deliver(data []byte) {
+	env, msg, err := decode(data)
+	if err != nil {
+		p.logger.Warn("dropped malformed broadcast", logging.Err(err))
+
+		return
+	}
+
+	if env.Node == p.node {
+		return
+	}
+
+	p.hub.Deliver(env.DocID, msg)
+}
+
+// envelope is a broadcast as sent between instances. Node identifies the
+// sender so instances can ignore their own messages.
+type envelope struct {
+	Node    string          `json:"node"`
+	DocID   string          `json:"docId"`
+	Type    ws.MessageType  `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// encode wraps a hub message for other instances.
+func encode(node, docID string, msg ws.Message) ([]byte, error) {
+	env := envelope{Node: node, DocID: docID, Type: msg.Type}
+
+	if msg.Payload != nil {
+		payload, err := json.Marshal(msg.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("encode %s payload: %w", msg.Type, err)
+		}
+
+		env.Payload = payload
+	}
+
+	return json.Marshal(env)
+}
+
+// decode unwraps a message from another instance. The payload stays raw,
+// since the hub only relays it to clients.
+func decode(data []byte) (envelope, ws.Message, error) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return envelope{}, ws.Message{}, fmt.Errorf("decode broadcast: %w", err)
+	}
+
+	msg := ws.Message{Type: env.Type}
+	if env.Payload != nil {
+		msg.Payload = env.Payload
+	}
+
+	return env, msg, nil
+}
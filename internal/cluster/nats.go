@@ -0,0 +1,117 @@
+package cluster
+
+import (
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+	"github.com/serroba/online-docs/internal/ws"
+)
+
+// DefaultNATSPrefix starts the subject of each document's broadcasts.
+const DefaultNATSPrefix = "docs.broadcast."
+
+// NATSBridge relays hub broadcasts through NATS, with one subject per
+// document. It implements ws.Bridge.
+type NATSBridge struct {
+	peer
+
+	conn   *nats.Conn
+	prefix string
+
+	mu   sync.Mutex
+	subs map[string]*nats.Subscription // Keyed by document ID
+}
+
+// NATSConfig holds configuration for creating a NATS bridge.
+type NATSConfig struct {
+	Conn   *nats.Conn
+	Hub    *ws.Hub      // Receives broadcasts from other instances
+	Prefix string       // Optional: subject prefix, defaults to DefaultNATSPrefix
+	Logger *slog.Logger // Optional: defaults to slog.Default()
+}
+
+// NewNATSBridge creates a bridge for the hub. Connect it with hub.SetBridge,
+// and Close it on shutdown.
+func NewNATSBridge(cfg NATSConfig) *NATSBridge {
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = DefaultNATSPrefix
+	}
+
+	return &NATSBridge{
+		peer:   newPeer(cfg.Hub, cfg.Logger),
+		conn:   cfg.Conn,
+		prefix: prefix,
+		subs:   make(map[string]*nats.Subscription),
+	}
+}
+
+// Publish sends a broadcast to the document's subject.
+func (b *NATSBridge) Publish(docID string, msg ws.Message) error {
+	data, err := b.encode(docID, msg)
+	if err != nil {
+		return err
+	}
+
+	return b.conn.Publish(b.subject(docID), data)
+}
+
+// Subscribe starts receiving the document's broadcasts.
+func (b *NATSBridge) Subscribe(docID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[docID]; ok {
+		return nil
+	}
+
+	sub, err := b.conn.Subscribe(b.subject(docID), func(m *nats.Msg) { b.deliver(m.Data) })
+	if err != nil {
+		return err
+	}
+
+	b.subs[docID] = sub
+
+	return nil
+}
+
+// Unsubscribe stops receiving the document's broadcasts.
+func (b *NATSBridge) Unsubscribe(docID string) error {
+	b.mu.Lock()
+	sub, ok := b.subs[docID]
+	delete(b.subs, docID)
+	b.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	return sub.Unsubscribe()
+}
+
+// Close stops receiving broadcasts. It doesn't close the NATS connection.
+func (b *NATSBridge) Close() error {
+	b.mu.Lock()
+	subs := b.subs
+	b.subs = make(map[string]*nats.Subscription)
+	b.mu.Unlock()
+
+	var errs []error
+
+	for _, sub := range subs {
+		if err := sub.Unsubscribe(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// subject names the document's subject. Document IDs may contain dots and
+// wildcards, which NATS treats specially, so the ID is encoded.
+func (b *NATSBridge) subject(docID string) string {
+	return b.prefix + base64.RawURLEncoding.EncodeToString([]byte(docID))
+}
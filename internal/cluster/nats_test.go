@@ -0,0 +1,137 @@
+package cluster_test
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/serroba/online-docs/internal/cluster"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+func runNATSServer(t *testing.T) *server.Server {
+	t.Helper()
+
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: server.RANDOM_PORT, NoLog: true, NoSigs: true})
+	require.NoError(t, err)
+
+	srv.Start()
+	t.Cleanup(srv.Shutdown)
+	require.True(t, srv.ReadyForConnections(5*time.Second))
+
+	return srv
+}
+
+func connectNATS(t *testing.T, srv *server.Server) *nats.Conn {
+	t.Helper()
+
+	conn, err := nats.Connect(srv.ClientURL())
+	require.NoError(t, err)
+	t.Cleanup(conn.Close)
+
+	return conn
+}
+
+func newNATSNode(t *testing.T, srv *server.Server) (node, *cluster.NATSBridge) {
+	t.Helper()
+
+	hub := ws.NewHub()
+	bridge := cluster.NewNATSBridge(cluster.NATSConfig{Conn: connectNATS(t, srv), Hub: hub})
+	hub.SetBridge(bridge)
+
+	t.Cleanup(func() { require.NoError(t, bridge.Close()) })
+
+	return node{hub: hub}, bridge
+}
+
+// waitForSubscriptions waits until the server has n more subscriptions than
+// it started with, since NATS subscribes asynchronously.
+func waitForSubscriptions(t *testing.T, srv *server.Server, base uint32, n int) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		return int(srv.NumSubscriptions())-int(base) == n
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestNATSBridge(t *testing.T) {
+	t.Parallel()
+
+	srv := runNATSServer(t)
+	base := srv.NumSubscriptions()
+	a, _ := newNATSNode(t, srv)
+	b, _ := newNATSNode(t, srv)
+
+	// Dots and wildcards in document IDs don't leak into other subjects
+	sender := a.connect("alice", "team.notes")
+	local := a.connect("carol", "team.notes")
+	remote := b.connect("bob", "team.notes")
+	elsewhere := b.connect("dave", "team.*")
+
+	waitForSubscriptions(t, srv, base, 3)
+
+	op := ot.SequencedOperation{Operation: ot.NewInsert("x", 0, "alice"), Revision: 1}
+	a.hub.BroadcastOperation("team.notes", op, "alice", "alice")
+
+	want := `{"type":"broadcast","payload":{"docId":"team.notes","revision":1,"opType":0,"position":0,"char":"x",` +
+		`"userId":"alice"}}`
+
+	require.Eventually(t, func() bool {
+		return len(remote.Written()) == 1 && len(local.Written()) == 1
+	}, time.Second, 5*time.Millisecond)
+	require.JSONEq(t, want, remote.Written()[0])
+
+	// The sender's instance doesn't receive its own broadcast a second time
+	time.Sleep(50 * time.Millisecond)
+	require.Empty(t, sender.Written())
+	require.Len(t, local.Written(), 1)
+	require.Empty(t, elsewhere.Written())
+}
+
+func TestNATSBridge_Unsubscribe(t *testing.T) {
+	t.Parallel()
+
+	srv := runNATSServer(t)
+	base := srv.NumSubscriptions()
+	a, bridge := newNATSNode(t, srv)
+
+	client := ws.NewClient("alice", "alice", &recordingConn{})
+	a.hub.Register(client)
+	a.hub.Subscribe(client, "doc1")
+	a.connect("bob", "doc2")
+
+	// Subscribing again and unsubscribing unknown documents are no-ops
+	require.NoError(t, bridge.Subscribe("doc1"))
+	require.NoError(t, bridge.Unsubscribe("doc3"))
+	waitForSubscriptions(t, srv, base, 2)
+
+	a.hub.Unregister(client)
+	waitForSubscriptions(t, srv, base, 1)
+
+	// Close drops the remaining subscriptions
+	require.NoError(t, bridge.Close())
+	waitForSubscriptions(t, srv, base, 0)
+}
+
+func TestNATSBridge_IgnoresMalformedMessages(t *testing.T) {
+	t.Parallel()
+
+	srv := runNATSServer(t)
+	base := srv.NumSubscriptions()
+	a, _ := newNATSNode(t, srv)
+	conn := a.connect("alice", "doc1")
+
+	waitForSubscriptions(t, srv, base, 1)
+
+	subject := cluster.DefaultNATSPrefix + base64.RawURLEncoding.EncodeToString([]byte("doc1"))
+	other := connectNATS(t, srv)
+	require.NoError(t, other.Publish(subject, []byte("not json")))
+	require.NoError(t, other.Publish(subject, []byte(`{"node":"other","docId":"doc1","type":"state"}`)))
+
+	require.Eventually(t, func() bool { return len(conn.Written()) == 1 }, time.Second, 5*time.Millisecond)
+	require.JSONEq(t, `{"type":"state"}`, conn.Written()[0])
+}
@@ -0,0 +1,103 @@
+package cluster
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/serroba/online-docs/internal/ws"
+)
+
+// DefaultRedisPrefix starts the name of each document's Redis channel.
+const DefaultRedisPrefix = "docs:broadcast:"
+
+// redisTimeout bounds each Redis command, so an unreachable server delays
+// broadcasts instead of blocking them.
+const redisTimeout = 2 * time.Second
+
+// RedisBridge relays hub broadcasts through Redis pub/sub, with one channel
+// per document. It implements ws.Bridge.
+type RedisBridge struct {
+	peer
+
+	client redis.UniversalClient
+	pubsub *redis.PubSub
+	prefix string
+	done   chan struct{} // Closed once the receive loop exits
+}
+
+// RedisConfig holds configuration for creating a Redis bridge.
+type RedisConfig struct {
+	Client redis.UniversalClient
+	Hub    *ws.Hub      // Receives broadcasts from other instances
+	Prefix string       // Optional: channel name prefix, defaults to DefaultRedisPrefix
+	Logger *slog.Logger // Optional: defaults to slog.Default()
+}
+
+// NewRedisBridge starts receiving broadcasts for the hub. Connect it with
+// hub.SetBridge, and Close it on shutdown.
+func NewRedisBridge(cfg RedisConfig) *RedisBridge {
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = DefaultRedisPrefix
+	}
+
+	b := &RedisBridge{
+		peer:   newPeer(cfg.Hub, cfg.Logger),
+		client: cfg.Client,
+		pubsub: cfg.Client.Subscribe(context.Background()),
+		prefix: prefix,
+		done:   make(chan struct{}),
+	}
+
+	go b.receive()
+
+	return b
+}
+
+// Publish sends a broadcast to the document's channel.
+func (b *RedisBridge) Publish(docID string, msg ws.Message) error {
+	data, err := b.encode(docID, msg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	return b.client.Publish(ctx, b.prefix+docID, data).Err()
+}
+
+// Subscribe starts receiving the document's broadcasts.
+func (b *RedisBridge) Subscribe(docID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	return b.pubsub.Subscribe(ctx, b.prefix+docID)
+}
+
+// Unsubscribe stops receiving the document's broadcasts.
+func (b *RedisBridge) Unsubscribe(docID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	return b.pubsub.Unsubscribe(ctx, b.prefix+docID)
+}
+
+// Close stops receiving broadcasts. It doesn't close the Redis client.
+func (b *RedisBridge) Close() error {
+	err := b.pubsub.Close()
+	<-b.done
+
+	return err
+}
+
+// receive hands other instances' broadcasts to the hub until Close.
+func (b *RedisBridge) receive() {
+	defer close(b.done)
+
+	for m := range b.pubsub.Channel() {
+		b.deliver([]byte(m.Payload))
+	}
+}
@@ -0,0 +1,145 @@
+package cluster_test
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/serroba/online-docs/internal/cluster"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingConn is a ws.Conn that keeps the JSON written to it.
+type recordingConn struct {
+	mu      sync.Mutex
+	written []string
+}
+
+func (c *recordingConn) WriteJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.written = append(c.written, string(data))
+
+	return nil
+}
+
+func (*recordingConn) ReadJSON(any) error { return nil }
+
+func (*recordingConn) Close() error { return nil }
+
+func (c *recordingConn) Written() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]string(nil), c.written...)
+}
+
+// node is one server instance: a hub bridged to the others.
+type node struct {
+	hub *ws.Hub
+}
+
+func newRedisNode(t *testing.T, server *miniredis.Miniredis) node {
+	t.Helper()
+
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	hub := ws.NewHub()
+	bridge := cluster.NewRedisBridge(cluster.RedisConfig{Client: client, Hub: hub})
+	hub.SetBridge(bridge)
+
+	t.Cleanup(func() { require.NoError(t, bridge.Close()) })
+
+	return node{hub: hub}
+}
+
+// connect subscribes a new client of the node to docID.
+func (n node) connect(clientID, docID string) *recordingConn {
+	conn := &recordingConn{}
+	client := ws.NewClient(clientID, clientID, conn)
+	n.hub.Register(client)
+	n.hub.Subscribe(client, docID)
+
+	return conn
+}
+
+func TestRedisBridge(t *testing.T) {
+	t.Parallel()
+
+	server := miniredis.RunT(t)
+	a, b := newRedisNode(t, server), newRedisNode(t, server)
+
+	sender := a.connect("alice", "doc1")
+	local := a.connect("carol", "doc1")
+	remote := b.connect("bob", "doc1")
+	elsewhere := b.connect("dave", "doc2")
+
+	op := ot.SequencedOperation{Operation: ot.NewInsert("x", 0, "alice"), Revision: 1}
+	a.hub.BroadcastOperation("doc1", op, "alice", "alice")
+
+	want := `{"type":"broadcast","payload":{"docId":"doc1","revision":1,"opType":0,"position":0,"char":"x",` +
+		`"userId":"alice"}}`
+
+	require.Eventually(t, func() bool {
+		return len(remote.Written()) == 1 && len(local.Written()) == 1
+	}, time.Second, 5*time.Millisecond)
+	require.JSONEq(t, want, remote.Written()[0])
+
+	// The sender's instance doesn't receive its own broadcast a second time
+	time.Sleep(50 * time.Millisecond)
+	require.Empty(t, sender.Written())
+	require.Len(t, local.Written(), 1)
+	require.Empty(t, elsewhere.Written())
+}
+
+func TestRedisBridge_Unsubscribe(t *testing.T) {
+	t.Parallel()
+
+	server := miniredis.RunT(t)
+	a := newRedisNode(t, server)
+
+	conn := &recordingConn{}
+	client := ws.NewClient("alice", "alice", conn)
+	a.hub.Register(client)
+	a.hub.Subscribe(client, "doc1")
+
+	require.Eventually(t, func() bool {
+		return len(server.PubSubChannels("docs:broadcast:*")) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	a.hub.Unregister(client)
+
+	require.Eventually(t, func() bool {
+		return len(server.PubSubChannels("docs:broadcast:*")) == 0
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestRedisBridge_IgnoresMalformedMessages(t *testing.T) {
+	t.Parallel()
+
+	server := miniredis.RunT(t)
+	a := newRedisNode(t, server)
+	conn := a.connect("alice", "doc1")
+
+	require.Eventually(t, func() bool {
+		return len(server.PubSubChannels("docs:broadcast:doc1")) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	server.Publish("docs:broadcast:doc1", "not json")
+	server.Publish("docs:broadcast:doc1", `{"node":"other","docId":"doc1","type":"state"}`)
+
+	require.Eventually(t, func() bool { return len(conn.Written()) == 1 }, time.Second, 5*time.Millisecond)
+	require.JSONEq(t, `{"type":"state"}`, conn.Written()[0])
+}
@@ -0,0 +1,80 @@
+package cluster
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"strconv"
+)
+
+// ErrNotOwner is returned for a document that another node of the ring owns.
+var ErrNotOwner = errors.New("document is owned by another node")
+
+// ringReplicas is the number of points each node has on the ring. More points
+// spread documents more evenly between nodes.
+const ringReplicas = 128
+
+// Ring assigns each document to one node by consistent hashing, so adding or
+// removing a node only moves the documents that node gains or loses. Every
+// instance must be given the same nodes to agree on owners.
+type Ring struct {
+	nodes  []string
+	points []ringPoint // Sorted by hash
+}
+
+// ringPoint is one of a node's positions on the ring.
+type ringPoint struct {
+	hash uint64
+	node string
+}
+
+// NewRing creates a ring of the given nodes, ignoring duplicates.
+func NewRing(nodes ...string) *Ring {
+	nodes = slices.Clone(nodes)
+	slices.Sort(nodes)
+	nodes = slices.Compact(nodes)
+
+	r := &Ring{nodes: nodes, points: make([]ringPoint, 0, len(nodes)*ringReplicas)}
+
+	for _, node := range nodes {
+		for i := range ringReplicas {
+			r.points = append(r.points, ringPoint{hash: hashKey(node + "#" + strconv.Itoa(i)), node: node})
+		}
+	}
+
+	slices.SortFunc(r.points, func(a, b ringPoint) int { return cmp.Compare(a.hash, b.hash) })
+
+	return r
+}
+
+// Owner returns the node that owns the document, or "" if the ring is empty.
+func (r *Ring) Owner(docID string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+
+	// The owner is the first point at or after the document's hash
+	i, _ := slices.BinarySearchFunc(r.points, hashKey(docID), func(p ringPoint, hash uint64) int {
+		return cmp.Compare(p.hash, hash)
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+
+	return r.points[i].node
+}
+
+// Nodes returns the ring's nodes in sorted order.
+func (r *Ring) Nodes() []string {
+	return slices.Clone(r.nodes)
+}
+
+// hashKey places a key on the ring. Node points differ only in their last
+// characters, so the hash must mix well for nodes to spread evenly.
+func hashKey(key string) uint64 {
+	sum := sha256.Sum256([]byte(key))
+
+	return binary.BigEndian.Uint64(sum[:8])
+}
@@ -0,0 +1,56 @@
+package cluster_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/cluster"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRing(t *testing.T) {
+	t.Parallel()
+
+	require.Empty(t, cluster.NewRing().Owner("doc1"))
+
+	ring := cluster.NewRing("http://c:8080", "http://a:8080", "http://b:8080", "http://a:8080")
+	require.Equal(t, []string{"http://a:8080", "http://b:8080", "http://c:8080"}, ring.Nodes())
+
+	// Every instance agrees on owners, whatever order it lists the nodes in
+	same := cluster.NewRing("http://a:8080", "http://b:8080", "http://c:8080")
+	owned := map[string]int{}
+
+	for i := range 3000 {
+		docID := "doc" + strconv.Itoa(i)
+		owner := ring.Owner(docID)
+
+		if got := same.Owner(docID); got != owner {
+			t.Errorf("Owner(%q) = %q and %q", docID, owner, got)
+		}
+
+		owned[owner]++
+	}
+
+	// Documents are spread roughly evenly
+	for node, n := range owned {
+		if n < 700 || n > 1300 {
+			t.Errorf("%s owns %d of 3000 documents", node, n)
+		}
+	}
+}
+
+func TestRing_RemoveNode(t *testing.T) {
+	t.Parallel()
+
+	before := cluster.NewRing("http://a:8080", "http://b:8080", "http://c:8080")
+	after := cluster.NewRing("http://a:8080", "http://b:8080")
+
+	// Only the removed node's documents move
+	for i := range 1000 {
+		docID := "doc" + strconv.Itoa(i)
+
+		if owner := before.Owner(docID); owner != "http://c:8080" && after.Owner(docID) != owner {
+			t.Errorf("%q moved from %s to %s", docID, owner, after.Owner(docID))
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package collab
+
+import "github.com/serroba/online-docs/internal/ot"
+
+// Anchors keeps positions in documents, such as where comments are
+// anchored, in step with the operations applied to them. Transform is
+// called once each operation is stored, in revision order, outside the
+// session's lock.
+type Anchors interface {
+	Transform(docID string, op ot.SequencedOperation) error
+}
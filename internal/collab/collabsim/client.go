@@ -0,0 +1,255 @@
+package collabsim
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/ws"
+)
+
+// deliveryTimeout is how long the hub may take to write a broadcast.
+const deliveryTimeout = 10 * time.Second
+
+// errClosed is returned by writes to a closed connection.
+var errClosed = errors.New("connection closed")
+
+// conn is a client's end of a simulated connection. The hub's workers write
+// broadcasts to it, where they wait until the scheduler delivers them.
+type conn struct {
+	mu         sync.Mutex
+	changed    chan struct{} // Closed and replaced whenever broadcasts grows
+	closed     bool
+	broadcasts []ws.BroadcastPayload
+}
+
+func newConn() *conn {
+	return &conn{changed: make(chan struct{})}
+}
+
+// WriteJSON receives a broadcast from the hub.
+func (c *conn) WriteJSON(v any) error {
+	msg, ok := v.(ws.Message)
+	if !ok {
+		return fmt.Errorf("unexpected %T written", v)
+	}
+
+	payload, ok := msg.Payload.(ws.BroadcastPayload)
+	if !ok {
+		return fmt.Errorf("unexpected %s message written", msg.Type)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return errClosed
+	}
+
+	c.broadcasts = append(c.broadcasts, payload)
+	close(c.changed)
+	c.changed = make(chan struct{})
+
+	return nil
+}
+
+// ReadJSON isn't used: the scheduler hands the server its messages.
+func (c *conn) ReadJSON(any) error {
+	return errors.New("simulated connections aren't read")
+}
+
+// Close drops broadcasts written from now on.
+func (c *conn) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+
+	return nil
+}
+
+// wait waits until the hub has written n broadcasts.
+func (c *conn) wait(n int) error {
+	timeout := time.After(deliveryTimeout)
+
+	for {
+		c.mu.Lock()
+		written, changed := len(c.broadcasts), c.changed
+		c.mu.Unlock()
+
+		if written >= n {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-timeout:
+			return fmt.Errorf("hub wrote %d of %d broadcasts", written, n)
+		}
+	}
+}
+
+// take returns the n-th broadcast written.
+func (c *conn) take(n int) ws.BroadcastPayload {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.broadcasts[n]
+}
+
+// client is a simulated editor. It applies its edits locally straight away,
+// keeps one in flight and queues the rest, and transforms the server's
+// broadcasts against them, as the web editor does. Messages between it and
+// the server wait in queues until the scheduler delivers them.
+type client struct {
+	userID string
+
+	// Connection, nil while disconnected
+	ws        *ws.Client
+	conn      *conn
+	expected  int          // Broadcasts the hub should have written to conn
+	delivered int          // Broadcasts from conn delivered to the client
+	outbox    []ws.Message // Sent to the server, not delivered yet
+	inbox     []ws.Message // Acks, errors and states the server sent, not delivered yet
+
+	// Editor state
+	synced   bool // doc holds the server's state; false until a state is delivered
+	doc      *ot.Document
+	revision int                  // Last server revision applied to doc
+	pending  []ot.Operation       // Local edits not acknowledged yet; the first is in flight
+	early    map[int]ot.Operation // Broadcasts delivered ahead of revision
+	ackAt    int                  // Revision of an ack delivered ahead of revision, or 0
+}
+
+// connected reports whether the client has a connection.
+func (c *client) connected() bool {
+	return c.conn != nil
+}
+
+// undelivered reports whether any server message waits for the client.
+func (c *client) undelivered() bool {
+	return len(c.inbox) > 0 || c.delivered < c.expected
+}
+
+// disconnect drops the connection and everything in flight on it.
+func (c *client) disconnect() {
+	_ = c.conn.Close()
+
+	*c = client{userID: c.userID}
+}
+
+// edit makes an edit, applying it locally and sending it unless another is
+// in flight.
+func (c *client) edit(op ot.Operation) error {
+	if err := c.doc.Apply(op); err != nil {
+		return fmt.Errorf("%s: apply own edit: %w", c.ws.ID, err)
+	}
+
+	c.pending = append(c.pending, op)
+
+	if len(c.pending) == 1 {
+		c.send()
+	}
+
+	return nil
+}
+
+// send sends the first pending edit, based on the current revision.
+func (c *client) send() {
+	op := c.pending[0]
+
+	c.outbox = append(c.outbox, ws.Message{
+		Type: ws.MessageTypeOperation,
+		Payload: ws.OperationPayload{
+			BaseRevision: c.revision,
+			OpType:       int(op.Type),
+			Position:     op.Position,
+			Char:         op.Char,
+		},
+	})
+}
+
+// receive handles a message from the server. Broadcasts and acks are
+// applied in revision order, as they may be delivered out of order.
+func (c *client) receive(msg ws.Message) error {
+	switch payload := msg.Payload.(type) {
+	case ws.StatePayload:
+		c.receiveState(payload)
+	case ws.BroadcastPayload:
+		// Broadcasts up to the revision of the state are already in it
+		if payload.Revision > c.revision {
+			c.early[payload.Revision] = ot.Operation{
+				Type: ot.OpType(payload.OpType), Position: payload.Position, Char: payload.Char, UserID: payload.UserID,
+				Attribute: payload.Attribute, Value: payload.Value,
+			}
+		}
+	case ws.AckPayload:
+		if len(c.pending) == 0 {
+			return fmt.Errorf("%s: ack for revision %d without an edit in flight", c.ws.ID, payload.Revision)
+		}
+
+		c.ackAt = payload.Revision
+	case ws.ErrorPayload:
+		// The edit was dropped, so start again from the server's state
+		c.synced = false
+		c.outbox = append(c.outbox, ws.Message{Type: ws.MessageTypeSync})
+	default:
+		return fmt.Errorf("%s: unexpected %s message", c.ws.ID, msg.Type)
+	}
+
+	return c.catchUp()
+}
+
+// receiveState starts again from the server's state.
+func (c *client) receiveState(state ws.StatePayload) {
+	c.synced = true
+	c.doc = ot.NewDocument(state.Content)
+	c.revision = state.Revision
+	c.pending = nil
+	c.ackAt = 0
+
+	for revision := range c.early {
+		if revision <= c.revision {
+			delete(c.early, revision)
+		}
+	}
+}
+
+// catchUp applies the broadcasts and the ack that follow on from the
+// current revision.
+func (c *client) catchUp() error {
+	for c.synced {
+		next := c.revision + 1
+
+		if op, ok := c.early[next]; ok {
+			delete(c.early, next)
+
+			for i := range c.pending {
+				c.pending[i], op = ot.Transform(c.pending[i], op)
+			}
+
+			if err := c.doc.Apply(op); err != nil {
+				return fmt.Errorf("%s: apply revision %d: %w", c.ws.ID, next, err)
+			}
+
+			c.revision = next
+
+			continue
+		}
+
+		if c.ackAt != next {
+			return nil
+		}
+
+		c.revision = next
+		c.ackAt = 0
+		c.pending = c.pending[1:]
+
+		if len(c.pending) > 0 {
+			c.send()
+		}
+	}
+
+	return nil
+}
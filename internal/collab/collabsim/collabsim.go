@@ -0,0 +1,490 @@
+// Package collabsim runs seeded simulations of clients editing a document
+// through a collab.Manager and a ws.Hub. A scheduler driven by the seed
+// decides when each client edits and when its messages reach the server and
+// the server's reach it, in any order a network could deliver them. It also
+// disconnects and reconnects clients and restarts the session from storage.
+//
+// The server's invariants are checked after every step, and at the end every
+// client must have converged on the server's content. The same seed always
+// makes the same choices, so a failure can be replayed and traced step by
+// step.
+package collabsim
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"strconv"
+
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+)
+
+// docID is the document every simulation edits.
+const docID = "sim"
+
+// Config configures a simulation.
+type Config struct {
+	Seed    uint64
+	Clients int // Defaults to 3
+	Steps   int // Defaults to 1000
+
+	// HistorySize is the session's history size. It defaults to 8, so
+	// clients that fall behind are rejected and resync.
+	HistorySize int
+
+	// SnapshotEvery is how many operations the session applies between
+	// snapshots. Defaults to 10.
+	SnapshotEvery int
+
+	Trace io.Writer // Optional: receives a line for each step
+}
+
+// Result summarizes a simulation that kept every invariant.
+type Result struct {
+	Content     string // The document's final content
+	Revision    int    // The document's final revision
+	Rejected    int    // Operations the server refused
+	Disconnects int
+	Restarts    int
+}
+
+// Step weights. Disconnects and restarts are rare, so clients usually get
+// to edit against each other for a while in between.
+const (
+	weightEdit       = 20
+	weightSend       = 20
+	weightReceive    = 30
+	weightDisconnect = 1
+	weightReconnect  = 5
+	weightRestart    = 1
+)
+
+// deleteRatio is the fraction of edits that delete a character.
+const deleteRatio = 0.3
+
+// simulation is the state of one run.
+type simulation struct {
+	cfg     Config
+	ctx     context.Context
+	rng     *rand.Rand
+	store   *storage.MemoryStore
+	hub     *ws.Hub
+	manager *collab.Manager
+	clients []*client
+
+	connections int    // Connections made, to number their client IDs
+	revision    int    // The session's revision after the last step
+	content     string // The session's content after the last step
+	result      Result
+}
+
+// action is a step the scheduler may take.
+type action struct {
+	weight int
+	run    func() error
+}
+
+// Run runs a simulation. It returns an error describing the first invariant
+// broken, with the seed and step to replay it from.
+func Run(cfg Config) (Result, error) {
+	if cfg.Clients == 0 {
+		cfg.Clients = 3
+	}
+
+	if cfg.Steps == 0 {
+		cfg.Steps = 1000
+	}
+
+	if cfg.HistorySize == 0 {
+		cfg.HistorySize = 8
+	}
+
+	if cfg.SnapshotEvery == 0 {
+		cfg.SnapshotEvery = 10
+	}
+
+	s := &simulation{
+		cfg:   cfg,
+		ctx:   context.Background(),
+		rng:   rand.New(rand.NewPCG(cfg.Seed, 0)), //nolint:gosec // Reproducible, not secret
+		store: storage.NewMemoryStore(),
+		hub:   ws.NewHub(),
+	}
+
+	if err := s.store.CreateDocument(s.ctx, docID); err != nil {
+		return Result{}, err
+	}
+
+	s.start()
+
+	for i := range cfg.Clients {
+		c := &client{userID: "user" + strconv.Itoa(i+1)}
+		s.clients = append(s.clients, c)
+
+		if err := s.connect(c); err != nil {
+			return Result{}, fmt.Errorf("seed %d: %w", cfg.Seed, err)
+		}
+	}
+
+	for step := 1; step <= cfg.Steps; step++ {
+		if err := s.step(s.actions()); err != nil {
+			return Result{}, fmt.Errorf("seed %d, step %d: %w", cfg.Seed, step, err)
+		}
+	}
+
+	if err := s.finish(); err != nil {
+		return Result{}, fmt.Errorf("seed %d, finishing: %w", cfg.Seed, err)
+	}
+
+	s.result.Content, s.result.Revision = s.content, s.revision
+
+	return s.result, nil
+}
+
+// start creates the manager, as a server starting up would.
+func (s *simulation) start() {
+	s.manager = collab.NewManager(collab.ManagerConfig{
+		Store:          s.store,
+		Hub:            s.hub,
+		SnapshotPolicy: storage.NewSnapshotPolicy(s.cfg.SnapshotEvery),
+		HistorySize:    s.cfg.HistorySize,
+		Logger:         slog.New(slog.DiscardHandler),
+	})
+}
+
+// tracef writes a line to the trace.
+func (s *simulation) tracef(format string, args ...any) {
+	if s.cfg.Trace != nil {
+		fmt.Fprintf(s.cfg.Trace, format+"\n", args...)
+	}
+}
+
+// actions lists the steps the scheduler may take next, in a fixed order so
+// the seed alone decides which is taken.
+func (s *simulation) actions() []action {
+	actions := []action{{weightRestart, s.restart}}
+
+	for _, c := range s.clients {
+		if !c.connected() {
+			actions = append(actions, action{weightReconnect, func() error { return s.connect(c) }})
+
+			continue
+		}
+
+		actions = append(actions, action{weightDisconnect, func() error { return s.disconnect(c) }})
+
+		if c.synced {
+			actions = append(actions, action{weightEdit, func() error { return s.edit(c) }})
+		}
+
+		actions = append(actions, s.deliveries(c)...)
+	}
+
+	return actions
+}
+
+// deliveries lists the messages to and from the client that may be
+// delivered next. Each direction keeps its order, but the hub writes
+// broadcasts separately from replies, so those two may overtake each other.
+func (s *simulation) deliveries(c *client) []action {
+	var actions []action
+
+	if len(c.outbox) > 0 {
+		actions = append(actions, action{weightSend, func() error { return s.serve(c) }})
+	}
+
+	if len(c.inbox) > 0 {
+		actions = append(actions, action{weightReceive, func() error { return s.reply(c) }})
+	}
+
+	if c.delivered < c.expected {
+		actions = append(actions, action{weightReceive, func() error { return s.broadcast(c) }})
+	}
+
+	return actions
+}
+
+// step takes one of the actions, chosen by weight.
+func (s *simulation) step(actions []action) error {
+	total := 0
+	for _, a := range actions {
+		total += a.weight
+	}
+
+	n := s.rng.IntN(total)
+
+	for _, a := range actions {
+		if n < a.weight {
+			return a.run()
+		}
+
+		n -= a.weight
+	}
+
+	panic("unreachable")
+}
+
+// connect connects a client, which gets the document's state as its first
+// message.
+func (s *simulation) connect(c *client) error {
+	s.connections++
+
+	c.conn = newConn()
+	c.ws = ws.NewClient("c"+strconv.Itoa(s.connections), c.userID, c.conn)
+	c.early = make(map[int]ot.Operation)
+
+	s.hub.Register(c.ws)
+	s.hub.Subscribe(c.ws, docID)
+
+	s.tracef("%s connects as %s", c.ws.ID, c.userID)
+
+	return s.sync(c)
+}
+
+// disconnect drops a client's connection with whatever is in flight on it.
+func (s *simulation) disconnect(c *client) error {
+	s.tracef("%s disconnects", c.ws.ID)
+
+	s.hub.Unregister(c.ws)
+	c.disconnect()
+	s.result.Disconnects++
+
+	return nil
+}
+
+// restart disconnects every client and closes the session, so the next
+// connection loads it from storage. The reloaded session must match the
+// closed one.
+func (s *simulation) restart() error {
+	s.tracef("server restarts")
+
+	for _, c := range s.clients {
+		if c.connected() {
+			s.hub.Unregister(c.ws)
+			c.disconnect()
+		}
+	}
+
+	if err := s.manager.CloseSession(docID); err != nil {
+		return fmt.Errorf("close session: %w", err)
+	}
+
+	s.start()
+	s.result.Restarts++
+
+	session, err := s.manager.GetOrCreateSession(s.ctx, docID)
+	if err != nil {
+		return fmt.Errorf("reload session: %w", err)
+	}
+
+	content, revision, err := session.GetState("")
+	if err != nil {
+		return err
+	}
+
+	if revision != s.revision || content != s.content {
+		return fmt.Errorf("reloaded revision %d %q, closed at revision %d %q", revision, content, s.revision, s.content)
+	}
+
+	return nil
+}
+
+// edit makes a random edit on a client.
+func (s *simulation) edit(c *client) error {
+	var op ot.Operation
+
+	length := c.doc.Len()
+	if length > 0 && s.rng.Float64() < deleteRatio {
+		op = ot.NewDelete(s.rng.IntN(length), c.userID)
+		s.tracef("%s deletes at %d", c.ws.ID, op.Position)
+	} else {
+		op = ot.NewInsert(string(rune('a'+s.rng.IntN(26))), s.rng.IntN(length+1), c.userID)
+		s.tracef("%s inserts %q at %d", c.ws.ID, op.Char, op.Position)
+	}
+
+	return c.edit(op)
+}
+
+// serve delivers the client's next message to the server, as the WebSocket
+// handler would.
+func (s *simulation) serve(c *client) error {
+	msg := c.outbox[0]
+	c.outbox = c.outbox[1:]
+
+	if msg.Type == ws.MessageTypeSync {
+		return s.sync(c)
+	}
+
+	payload, _ := msg.Payload.(ws.OperationPayload)
+
+	op := ot.NewInsert(payload.Char, payload.Position, c.userID)
+	if payload.OpType == int(ot.Delete) {
+		op = ot.NewDelete(payload.Position, c.userID)
+	}
+
+	session, err := s.manager.GetOrCreateSession(s.ctx, docID)
+	if err != nil {
+		return err
+	}
+
+	revision, err := session.ApplyOperation(c.ws.ID, c.userID, op, payload.BaseRevision)
+	if err != nil {
+		s.tracef("server rejects %s's operation based on %d: %v", c.ws.ID, payload.BaseRevision, err)
+
+		c.inbox = append(c.inbox, ws.Message{
+			Type:    ws.MessageTypeError,
+			Payload: ws.ErrorPayload{Code: ws.ErrorCodeInternalError, Message: err.Error()},
+		})
+		s.result.Rejected++
+
+		return nil
+	}
+
+	s.tracef("server applies %s's operation based on %d as revision %d", c.ws.ID, payload.BaseRevision, revision)
+
+	c.inbox = append(c.inbox, ws.Message{Type: ws.MessageTypeAck, Payload: ws.AckPayload{Revision: revision}})
+
+	return s.applied(session, c, revision)
+}
+
+// applied checks the session after it applied an operation from sender, and
+// waits for the hub to write the broadcast to the other clients.
+func (s *simulation) applied(session *collab.Session, sender *client, revision int) error {
+	if revision != s.revision+1 {
+		return fmt.Errorf("applied as revision %d after revision %d", revision, s.revision)
+	}
+
+	content, current, err := session.GetState("")
+	if err != nil {
+		return err
+	}
+
+	if current != revision {
+		return fmt.Errorf("session at revision %d after applying revision %d", current, revision)
+	}
+
+	// Every applied operation is stored before it's acknowledged
+	latest, err := s.store.LatestRevision(s.ctx, docID)
+	if err != nil {
+		return err
+	}
+
+	if latest != revision {
+		return fmt.Errorf("stored revision %d after applying revision %d", latest, revision)
+	}
+
+	s.revision, s.content = revision, content
+
+	for _, c := range s.clients {
+		if c != sender && c.connected() {
+			c.expected++
+
+			if err := c.conn.wait(c.expected); err != nil {
+				return fmt.Errorf("%s: %w", c.ws.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// sync sends the client the document's state.
+func (s *simulation) sync(c *client) error {
+	session, err := s.manager.GetOrCreateSession(s.ctx, docID)
+	if err != nil {
+		return err
+	}
+
+	content, revision, err := session.GetState(c.userID)
+	if err != nil {
+		return err
+	}
+
+	s.tracef("server sends %s the state at revision %d", c.ws.ID, revision)
+
+	c.inbox = append(c.inbox, ws.Message{
+		Type:    ws.MessageTypeState,
+		Payload: ws.StatePayload{DocID: docID, Content: content, Revision: revision},
+	})
+
+	return nil
+}
+
+// reply delivers the server's next reply to the client.
+func (s *simulation) reply(c *client) error {
+	msg := c.inbox[0]
+	c.inbox = c.inbox[1:]
+
+	s.tracef("%s receives %s", c.ws.ID, msg.Type)
+
+	return c.receive(msg)
+}
+
+// broadcast delivers the next broadcast the hub wrote to the client.
+func (s *simulation) broadcast(c *client) error {
+	payload := c.conn.take(c.delivered)
+	c.delivered++
+
+	s.tracef("%s receives broadcast of revision %d", c.ws.ID, payload.Revision)
+
+	return c.receive(ws.Message{Type: ws.MessageTypeBroadcast, Payload: payload})
+}
+
+// finish reconnects every client and delivers everything in flight, then
+// checks that the clients converged and that the document survives a
+// restart.
+func (s *simulation) finish() error {
+	for _, c := range s.clients {
+		if !c.connected() {
+			if err := s.connect(c); err != nil {
+				return err
+			}
+		}
+	}
+
+	for {
+		var actions []action
+		for _, c := range s.clients {
+			actions = append(actions, s.deliveries(c)...)
+		}
+
+		if len(actions) == 0 {
+			break
+		}
+
+		if err := s.step(actions); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range s.clients {
+		if err := s.converged(c); err != nil {
+			return err
+		}
+	}
+
+	return s.restart()
+}
+
+// converged checks a client with nothing in flight against the server.
+func (s *simulation) converged(c *client) error {
+	switch {
+	case !c.synced:
+		return fmt.Errorf("%s: never got the state it asked for", c.ws.ID)
+	case len(c.pending) > 0:
+		return fmt.Errorf("%s: %d edits never acknowledged", c.ws.ID, len(c.pending))
+	case len(c.early) > 0 || c.ackAt != 0:
+		return fmt.Errorf("%s: messages ahead of revision %d never applied", c.ws.ID, c.revision)
+	case c.revision != s.revision:
+		return fmt.Errorf("%s: at revision %d, server at %d", c.ws.ID, c.revision, s.revision)
+	case c.doc.Content() != s.content:
+		return fmt.Errorf("%s: content %q, server has %q", c.ws.ID, c.doc.Content(), s.content)
+	}
+
+	return nil
+}
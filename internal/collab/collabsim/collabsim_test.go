@@ -0,0 +1,78 @@
+package collabsim_test
+
+import (
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/collab/collabsim"
+	"github.com/stretchr/testify/require"
+)
+
+// seed replays a single simulation, for example one a failure reported:
+//
+//	go test ./internal/collab/collabsim -run TestRun -seed 42 -v
+var seed = flag.Uint64("seed", 0, "run only the simulation with this seed, tracing its steps")
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	if *seed != 0 {
+		var trace strings.Builder
+
+		_, err := collabsim.Run(collabsim.Config{Seed: *seed, Trace: &trace})
+		t.Log(trace.String())
+		require.NoError(t, err)
+
+		return
+	}
+
+	tests := []struct {
+		name string
+		cfg  collabsim.Config
+	}{
+		{"defaults", collabsim.Config{}},
+		{"many clients", collabsim.Config{Clients: 8, Steps: 2000}},
+		{"long history", collabsim.Config{HistorySize: 1000, SnapshotEvery: 100}},
+		{"snapshot every operation", collabsim.Config{SnapshotEvery: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			for s := range uint64(20) {
+				cfg := tt.cfg
+				cfg.Seed = s + 1
+
+				_, err := collabsim.Run(cfg)
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRun_Deterministic(t *testing.T) {
+	t.Parallel()
+
+	run := func() (collabsim.Result, string) {
+		var trace strings.Builder
+
+		result, err := collabsim.Run(collabsim.Config{Seed: 7, Trace: &trace})
+		require.NoError(t, err)
+
+		return result, trace.String()
+	}
+
+	first, firstTrace := run()
+	second, secondTrace := run()
+
+	require.Equal(t, first, second)
+	require.Equal(t, firstTrace, secondTrace)
+
+	// The run exercised the interesting paths
+	require.NotZero(t, first.Revision)
+	require.NotZero(t, first.Disconnects)
+	require.NotZero(t, first.Restarts)
+	require.NotZero(t, first.Rejected)
+}
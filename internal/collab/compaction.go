@@ -0,0 +1,185 @@
+package collab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/serroba/online-docs/internal/lease"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// Compact snapshots every stored document the policy says is due, pruning
+// the stored operations the snapshots cover, and returns how many it
+// compacted. Documents with an open session are snapshotted by it. Others
+// are snapshotted from their stored history, while their session is kept
+// from loading and, if the manager has a locker, under their lease;
+// documents leased by another instance are left to it. Quarantined
+// documents are skipped, and so are those owned reports another instance
+// serves, unless owned is nil.
+//
+// Documents that can't be compacted are reported in the returned error, and
+// compaction goes on with the others.
+func (m *Manager) Compact(
+	ctx context.Context, policy storage.CompactionPolicy, owned func(docID string) bool,
+) (int, error) {
+	if !policy.Enabled() {
+		return 0, nil
+	}
+
+	docIDs, err := m.store.ListDocuments(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		compacted int
+		errs      []error
+	)
+
+	for _, docID := range docIDs {
+		if err := ctx.Err(); err != nil {
+			return compacted, err
+		}
+
+		if owned != nil && !owned(docID) {
+			continue
+		}
+
+		done, err := m.compact(ctx, docID, policy)
+
+		switch {
+		case errors.Is(err, storage.ErrDocumentNotFound), errors.Is(err, lease.ErrHeld):
+			// Deleted since it was listed, or served by another instance
+			continue
+		case err != nil:
+			errs = append(errs, fmt.Errorf("compact document %s: %w", docID, err))
+		case done:
+			compacted++
+		}
+	}
+
+	return compacted, errors.Join(errs...)
+}
+
+// RunCompaction compacts documents every interval until ctx is done,
+// logging how many were compacted and any that failed.
+func (m *Manager) RunCompaction(
+	ctx context.Context, policy storage.CompactionPolicy, interval time.Duration, owned func(docID string) bool,
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		start := time.Now()
+
+		compacted, err := m.Compact(ctx, policy, owned)
+		if err != nil && ctx.Err() == nil {
+			m.logger.ErrorContext(ctx, "compaction failed", logging.Err(err))
+		}
+
+		if compacted > 0 {
+			m.logger.InfoContext(ctx, "compacted documents", "documents", compacted, "duration", time.Since(start))
+		}
+	}
+}
+
+// compact snapshots the document if the policy says it's due, and reports
+// whether it did.
+func (m *Manager) compact(ctx context.Context, docID string, policy storage.CompactionPolicy) (bool, error) {
+	due, err := m.compactionDue(ctx, docID, policy)
+	if err != nil || !due {
+		return false, err
+	}
+
+	session, call, leader := m.lookup(docID)
+
+	switch {
+	case session != nil:
+		// The session's snapshot is ordered with its edits
+		err := session.Snapshot(ctx)
+		if errors.Is(err, ErrSessionClosed) {
+			// Closing saved a final snapshot
+			return false, nil
+		}
+
+		return err == nil, err
+	case !leader:
+		// Being loaded, or quarantined
+		return false, nil
+	}
+
+	defer m.vacate(docID, call)
+
+	// A snapshot saved from the store could replace a newer one saved by a
+	// session elsewhere, so the document is leased while it's rebuilt
+	write := ctx
+
+	if m.locker != nil {
+		granted, err := m.locker.Acquire(ctx, docID)
+		if err != nil {
+			return false, err
+		}
+		defer m.release(granted)
+
+		write = storage.WithFencingToken(ctx, granted.Token)
+	}
+
+	result, err := storage.NewDocumentLoader(m.store).Load(ctx, docID, applyOp)
+	if err != nil {
+		return false, err
+	}
+
+	err = m.store.SaveFormattedSnapshot(write, docID, result.Revision, result.Content, result.Formatting)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// compactionDue reports whether the operations stored after the document's
+// latest snapshot make it due for compaction.
+func (m *Manager) compactionDue(ctx context.Context, docID string, policy storage.CompactionPolicy) (bool, error) {
+	var base int
+
+	snapshot, err := m.store.LoadSnapshot(ctx, docID)
+
+	switch {
+	case errors.Is(err, storage.ErrSnapshotNotFound):
+	case err != nil:
+		return false, err
+	default:
+		base = snapshot.Revision
+	}
+
+	ops, err := m.store.LoadOperations(ctx, docID, base)
+	if err != nil {
+		return false, err
+	}
+
+	return policy.Due(ops, time.Now()), nil
+}
+
+// vacate gives up a load slot taken with lookup without loading a session,
+// so callers waiting on it load the session themselves.
+func (m *Manager) vacate(docID string, call *loadCall) {
+	m.mu.Lock()
+
+	if m.loading[docID] == call {
+		delete(m.loading, docID)
+	}
+
+	m.mu.Unlock()
+
+	call.vacated = true
+	close(call.done)
+}
@@ -0,0 +1,265 @@
+package collab_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/lease"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// storeOps stores an operation inserting each of text's characters in turn,
+// all sequenced at timestamp.
+func storeOps(t *testing.T, store storage.Store, docID, text string, timestamp time.Time) {
+	t.Helper()
+
+	ops := make([]ot.SequencedOperation, 0, len(text))
+	for i, char := range text {
+		ops = append(ops, ot.SequencedOperation{
+			Operation: ot.NewInsert(string(char), i, "u1"),
+			Revision:  i + 1,
+			Timestamp: timestamp,
+		})
+	}
+
+	require.NoError(t, store.CreateDocument(t.Context(), docID))
+	require.NoError(t, store.AppendOperations(t.Context(), docID, ops))
+}
+
+func TestManager_Compact(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	storeOps(t, store, "long", "abcd", time.Now())
+	storeOps(t, store, "old", "ab", time.Now().Add(-2*time.Hour))
+	storeOps(t, store, "recent", "ab", time.Now())
+	storeOps(t, store, "elsewhere", "abcd", time.Now())
+
+	manager := collab.NewManager(collab.ManagerConfig{Store: store})
+	policy := storage.CompactionPolicy{MaxOperations: 3, MaxAge: time.Hour}
+
+	compacted, err := manager.Compact(t.Context(), policy, func(docID string) bool { return docID != "elsewhere" })
+	require.NoError(t, err)
+	require.Equal(t, 2, compacted)
+
+	tests := []struct {
+		docID    string
+		snapshot string // Empty if the document wasn't compacted
+		ops      int
+	}{
+		{"long", "abcd", 0},
+		{"old", "ab", 0},
+		{"recent", "", 2},
+		{"elsewhere", "", 4},
+	}
+
+	for _, tt := range tests {
+		snapshot, err := store.LoadSnapshot(t.Context(), tt.docID)
+		if tt.snapshot == "" {
+			require.ErrorIs(t, err, storage.ErrSnapshotNotFound, tt.docID)
+		} else {
+			require.NoError(t, err, tt.docID)
+			require.Equal(t, tt.snapshot, snapshot.Content, tt.docID)
+		}
+
+		ops, err := store.LoadOperations(t.Context(), tt.docID, 0)
+		require.NoError(t, err)
+		require.Len(t, ops, tt.ops, tt.docID)
+	}
+
+	// Compacted documents open as they were
+	session, err := manager.GetOrCreateSession(t.Context(), "long")
+	require.NoError(t, err)
+
+	content, revision, err := session.GetState("u1")
+	require.NoError(t, err)
+	require.Equal(t, "abcd", content)
+	require.Equal(t, 4, revision)
+
+	// Without the filter every document is compacted, and then none is due
+	compacted, err = manager.Compact(t.Context(), policy, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, compacted)
+
+	compacted, err = manager.Compact(t.Context(), policy, nil)
+	require.NoError(t, err)
+	require.Zero(t, compacted)
+
+	compacted, err = manager.Compact(t.Context(), storage.CompactionPolicy{}, nil)
+	require.NoError(t, err)
+	require.Zero(t, compacted)
+}
+
+func TestManager_Compact_OpenSession(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	manager := collab.NewManager(collab.ManagerConfig{Store: store})
+
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	for i, char := range "abc" {
+		_, err := session.ApplyOperation("c1", "u1", ot.NewInsert(string(char), i, "u1"), i)
+		require.NoError(t, err)
+	}
+
+	compacted, err := manager.Compact(t.Context(), storage.CompactionPolicy{MaxOperations: 2}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, compacted)
+
+	// The session saved the snapshot, and keeps accepting edits after it
+	snapshot, err := store.LoadSnapshot(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.Equal(t, 3, snapshot.Revision)
+	require.Equal(t, "abc", snapshot.Content)
+
+	_, err = session.ApplyOperation("c1", "u1", ot.NewInsert("d", 3, "u1"), 3)
+	require.NoError(t, err)
+	require.Same(t, session, manager.GetSession("doc1"))
+}
+
+func TestManager_Compact_Leased(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	storeOps(t, store, "doc1", "abc", time.Now())
+
+	locker := lease.NewMemoryLocker(time.Minute)
+	first := collab.NewManager(collab.ManagerConfig{Store: store, Locker: locker})
+	second := collab.NewManager(collab.ManagerConfig{Store: store, Locker: locker})
+
+	_, err := first.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	policy := storage.CompactionPolicy{MaxOperations: 2}
+
+	// The instance serving the document compacts it
+	compacted, err := second.Compact(t.Context(), policy, nil)
+	require.NoError(t, err)
+	require.Zero(t, compacted)
+
+	require.NoError(t, first.CloseAll())
+	storeOps(t, store, "doc2", "abc", time.Now())
+
+	// Compacting leaves the lease free for whoever opens the document next
+	compacted, err = second.Compact(t.Context(), policy, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, compacted)
+
+	_, err = first.GetOrCreateSession(t.Context(), "doc2")
+	require.NoError(t, err)
+}
+
+// unlistedStore is a MemoryStore whose documents can't be listed.
+type unlistedStore struct {
+	*storage.MemoryStore
+}
+
+func (unlistedStore) ListDocuments(context.Context) ([]string, error) {
+	return nil, errors.New("listing failed")
+}
+
+// unreadableOpsStore is a MemoryStore whose operations can't be loaded.
+type unreadableOpsStore struct {
+	*storage.MemoryStore
+}
+
+func (unreadableOpsStore) LoadOperations(context.Context, string, int) ([]ot.SequencedOperation, error) {
+	return nil, errors.New("operations unreadable")
+}
+
+func TestManager_Compact_Errors(t *testing.T) {
+	t.Parallel()
+
+	policy := storage.CompactionPolicy{MaxOperations: 1}
+
+	unlisted := unlistedStore{MemoryStore: storage.NewMemoryStore()}
+	_, err := collab.NewManager(collab.ManagerConfig{Store: unlisted}).Compact(t.Context(), policy, nil)
+	require.EqualError(t, err, "listing failed")
+
+	unreadable := unreadableOpsStore{MemoryStore: storage.NewMemoryStore()}
+	storeOps(t, unreadable.MemoryStore, "doc1", "ab", time.Now())
+
+	_, err = collab.NewManager(collab.ManagerConfig{Store: unreadable}).Compact(t.Context(), policy, nil)
+	require.EqualError(t, err, "compact document doc1: operations unreadable")
+
+	// Every document is tried, and each failure reported
+	failing := failingSnapshotStore{MemoryStore: storage.NewMemoryStore()}
+	storeOps(t, failing.MemoryStore, "doc1", "ab", time.Now())
+	storeOps(t, failing.MemoryStore, "doc2", "ab", time.Now())
+
+	manager := collab.NewManager(collab.ManagerConfig{Store: failing})
+
+	compacted, err := manager.Compact(t.Context(), policy, nil)
+	require.Zero(t, compacted)
+	require.EqualError(t, err, "compact document doc1: disk full\ncompact document doc2: disk full")
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	_, err = manager.Compact(ctx, policy, nil)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+// brokenDocStore is a MemoryStore that can't save the snapshot of the
+// document "broken".
+type brokenDocStore struct {
+	*storage.MemoryStore
+}
+
+func (s brokenDocStore) SaveFormattedSnapshot(
+	ctx context.Context, docID string, revision int, content string, formatting []ot.Mark,
+) error {
+	if docID == "broken" {
+		return errors.New("disk full")
+	}
+
+	return s.MemoryStore.SaveFormattedSnapshot(ctx, docID, revision, content, formatting)
+}
+
+func TestManager_RunCompaction(t *testing.T) {
+	t.Parallel()
+
+	store := brokenDocStore{MemoryStore: storage.NewMemoryStore()}
+	storeOps(t, store, "broken", "ab", time.Now())
+	storeOps(t, store, "doc1", "ab", time.Now())
+
+	var logs lockedBuffer
+
+	logger, err := logging.New(&logs, logging.FormatText, slog.LevelInfo)
+	require.NoError(t, err)
+
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, Logger: logger})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		manager.RunCompaction(ctx, storage.CompactionPolicy{MaxOperations: 1}, time.Millisecond, nil)
+	}()
+
+	require.Eventually(t, func() bool {
+		return strings.Contains(logs.String(), `msg="compaction failed"`) &&
+			strings.Contains(logs.String(), `msg="compacted documents" component=collab documents=1`)
+	}, time.Second, time.Millisecond)
+
+	snapshot, err := store.LoadSnapshot(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.Equal(t, "ab", snapshot.Content)
+
+	cancel()
+	<-done
+}
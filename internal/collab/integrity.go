@@ -0,0 +1,80 @@
+package collab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// Finding is a document whose history CheckIntegrity couldn't replay.
+type Finding struct {
+	storage.Damage
+
+	Repaired bool // History was reset to Damage.Revision; otherwise the document is quarantined
+}
+
+// CheckIntegrity replays the history of every stored document, so damage is
+// found on startup instead of when someone opens the document. With repair, a
+// damaged document's history is replaced by a snapshot at its last good
+// revision, discarding the operations after it. Otherwise the document is
+// quarantined: GetOrCreateSession returns ErrQuarantined for it until the
+// manager is recreated, so it's never edited with part of its history lost.
+//
+// Documents that can't be read are reported in the returned error, and the
+// check goes on with the others.
+func (m *Manager) CheckIntegrity(ctx context.Context, repair bool) ([]Finding, error) {
+	docIDs, err := m.store.ListDocuments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	loader := storage.NewDocumentLoader(m.store)
+
+	var (
+		findings []Finding
+		errs     []error
+	)
+
+	for _, docID := range docIDs {
+		if err := ctx.Err(); err != nil {
+			return findings, err
+		}
+
+		damage, damaged, err := loader.Verify(ctx, docID, applyOp)
+
+		switch {
+		case errors.Is(err, storage.ErrDocumentNotFound):
+			// Deleted since it was listed
+			continue
+		case err != nil:
+			errs = append(errs, fmt.Errorf("check document %s: %w", docID, err))
+
+			continue
+		case !damaged:
+			continue
+		}
+
+		finding := Finding{Damage: damage}
+
+		if repair {
+			err := m.store.ResetDocument(ctx, docID, damage.Revision, damage.Content)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("repair document %s: %w", docID, err))
+			}
+
+			finding.Repaired = err == nil
+		}
+
+		if !finding.Repaired {
+			m.mu.Lock()
+			m.damaged[docID] = struct{}{}
+			m.mu.Unlock()
+		}
+
+		findings = append(findings, finding)
+	}
+
+	return findings, errors.Join(errs...)
+}
@@ -0,0 +1,165 @@
+package collab_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// damagedStore creates an intact document, one whose log skips revision 3
+// and one with an operation that can't apply at revision 2.
+func damagedStore(t *testing.T) *storage.MemoryStore {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+
+	logs := map[string][]ot.SequencedOperation{
+		"intact": {
+			{Operation: ot.NewInsert("a", 0, "u1"), Revision: 1},
+			{Operation: ot.NewInsert("b", 1, "u1"), Revision: 2},
+		},
+		"gap": {
+			{Operation: ot.NewInsert("a", 0, "u1"), Revision: 1},
+			{Operation: ot.NewInsert("b", 1, "u1"), Revision: 2},
+			{Operation: ot.NewInsert("d", 2, "u1"), Revision: 4},
+		},
+		"broken": {
+			{Operation: ot.NewInsert("a", 0, "u1"), Revision: 1},
+			{Operation: ot.NewDelete(5, "u1"), Revision: 2},
+			{Operation: ot.NewInsert("c", 1, "u1"), Revision: 3},
+		},
+	}
+
+	for docID, ops := range logs {
+		require.NoError(t, store.CreateDocument(t.Context(), docID))
+
+		for _, op := range ops {
+			require.NoError(t, store.AppendOperation(t.Context(), docID, op))
+		}
+	}
+
+	return store
+}
+
+func TestManager_CheckIntegrity_Quarantine(t *testing.T) {
+	t.Parallel()
+
+	manager := collab.NewManager(collab.ManagerConfig{Store: damagedStore(t)})
+
+	findings, err := manager.CheckIntegrity(t.Context(), false)
+	require.NoError(t, err)
+	require.Len(t, findings, 2)
+
+	require.Equal(t, "broken", findings[0].DocID)
+	require.Equal(t, 1, findings[0].Revision)
+	require.ErrorIs(t, findings[0].Err, ot.ErrInvalidPosition)
+	require.False(t, findings[0].Repaired)
+
+	require.Equal(t, "gap", findings[1].DocID)
+	require.ErrorIs(t, findings[1].Err, storage.ErrRevisionGap)
+
+	for _, docID := range []string{"broken", "gap"} {
+		_, err := manager.GetOrCreateSession(t.Context(), docID)
+		require.ErrorIs(t, err, collab.ErrQuarantined)
+	}
+
+	session, err := manager.GetOrCreateSession(t.Context(), "intact")
+	require.NoError(t, err)
+	require.Equal(t, 2, session.Revision())
+}
+
+func TestManager_CheckIntegrity_Repair(t *testing.T) {
+	t.Parallel()
+
+	store := damagedStore(t)
+	manager := collab.NewManager(collab.ManagerConfig{Store: store})
+
+	findings, err := manager.CheckIntegrity(t.Context(), true)
+	require.NoError(t, err)
+	require.Len(t, findings, 2)
+
+	for _, finding := range findings {
+		require.True(t, finding.Repaired, finding.DocID)
+	}
+
+	// Repaired documents open at their last good revision and accept edits
+	session, err := manager.GetOrCreateSession(t.Context(), "gap")
+	require.NoError(t, err)
+
+	content, revision, err := session.GetState("u1")
+	require.NoError(t, err)
+	require.Equal(t, "ab", content)
+	require.Equal(t, 2, revision)
+
+	_, err = session.ApplyOperation("c1", "u1", ot.NewInsert("c", 2, "u1"), 2)
+	require.NoError(t, err)
+
+	// A second check finds nothing
+	findings, err = manager.CheckIntegrity(t.Context(), true)
+	require.NoError(t, err)
+	require.Empty(t, findings)
+}
+
+// unreliableStore is a MemoryStore that fails to read or reset documents.
+type unreliableStore struct {
+	*storage.MemoryStore
+
+	listErr error
+}
+
+func (s unreliableStore) ListDocuments(ctx context.Context) ([]string, error) {
+	if s.listErr != nil {
+		return nil, s.listErr
+	}
+
+	docIDs, err := s.MemoryStore.ListDocuments(ctx)
+
+	// Include a document deleted while the check runs
+	return append(docIDs, "deleted", "unreadable"), err
+}
+
+func (s unreliableStore) LoadSnapshot(ctx context.Context, docID string) (storage.Snapshot, error) {
+	if docID == "unreadable" {
+		return storage.Snapshot{}, errors.New("disk error")
+	}
+
+	return s.MemoryStore.LoadSnapshot(ctx, docID)
+}
+
+func (unreliableStore) ResetDocument(context.Context, string, int, string) error {
+	return errors.New("read-only store")
+}
+
+func TestManager_CheckIntegrity_Errors(t *testing.T) {
+	t.Parallel()
+
+	store := unreliableStore{MemoryStore: damagedStore(t)}
+	manager := collab.NewManager(collab.ManagerConfig{Store: store})
+
+	// Documents that can't be repaired are quarantined instead
+	findings, err := manager.CheckIntegrity(t.Context(), true)
+	require.ErrorContains(t, err, "check document unreadable: disk error")
+	require.ErrorContains(t, err, "repair document gap: read-only store")
+	require.Len(t, findings, 2)
+	require.False(t, findings[1].Repaired)
+
+	_, err = manager.GetOrCreateSession(t.Context(), "gap")
+	require.ErrorIs(t, err, collab.ErrQuarantined)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	_, err = manager.CheckIntegrity(ctx, true)
+	require.ErrorIs(t, err, context.Canceled)
+
+	store.listErr = errors.New("store unavailable")
+	manager = collab.NewManager(collab.ManagerConfig{Store: store})
+
+	_, err = manager.CheckIntegrity(t.Context(), true)
+	require.ErrorIs(t, err, store.listErr)
+}
@@ -0,0 +1,70 @@
+package collab
+
+import (
+	"sync"
+	"time"
+)
+
+// Stages is how long an operation spent in each stage of being applied,
+// from reaching the session to being ready to acknowledge.
+type Stages struct {
+	Transform time.Duration // Waiting for the session, transforming and applying in memory
+	Persist   time.Duration // Waiting for its batch to be stored, see SessionConfig.CommitDelay
+	Broadcast time.Duration // Queueing it, and the operations stored before it, for every client
+}
+
+// Total returns the time taken by all the stages.
+func (s Stages) Total() time.Duration {
+	return s.Transform + s.Persist + s.Broadcast
+}
+
+// Latency summarizes the stages of the operations a session stored.
+type Latency struct {
+	Operations int64
+	Mean       Stages
+	Max        Stages        // Each stage's slowest, which may be of different operations
+	MaxTotal   time.Duration // The slowest operation
+}
+
+// latencies accumulates the stages of a session's operations.
+type latencies struct {
+	mu       sync.Mutex
+	count    int64
+	sum      Stages
+	max      Stages
+	maxTotal time.Duration
+}
+
+// record adds an operation's stages.
+func (l *latencies) record(stages Stages) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.count++
+	l.sum.Transform += stages.Transform
+	l.sum.Persist += stages.Persist
+	l.sum.Broadcast += stages.Broadcast
+	l.max.Transform = max(l.max.Transform, stages.Transform)
+	l.max.Persist = max(l.max.Persist, stages.Persist)
+	l.max.Broadcast = max(l.max.Broadcast, stages.Broadcast)
+	l.maxTotal = max(l.maxTotal, stages.Total())
+}
+
+// summary returns the operations' mean and slowest stages.
+func (l *latencies) summary() Latency {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	summary := Latency{Operations: l.count, Max: l.max, MaxTotal: l.maxTotal}
+
+	if l.count > 0 {
+		n := time.Duration(l.count)
+		summary.Mean = Stages{
+			Transform: l.sum.Transform / n,
+			Persist:   l.sum.Persist / n,
+			Broadcast: l.sum.Broadcast / n,
+		}
+	}
+
+	return summary
+}
@@ -1,10 +1,19 @@
 package collab
 
 import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/lease"
+	"github.com/serroba/online-docs/internal/logging"
 	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/webhook"
 	"github.com/serroba/online-docs/internal/ws"
 )
 
@@ -12,13 +21,41 @@ import (
 type Manager struct {
 	mu       sync.RWMutex
 	sessions map[string]*Session
+	loading  map[string]*loadCall  // Loads in progress, by document ID
+	leases   map[string]*heldLease // Leases of cached sessions, by document ID
+	damaged  map[string]struct{}   // Documents quarantined by CheckIntegrity
+	rate     opRate                // Operations applied across all sessions
+	counters counters
 
 	// Shared dependencies
 	store          storage.Store
 	permStore      acl.Store
 	hub            *ws.Hub
+	webhooks       *webhook.Service
+	anchors        Anchors
 	snapshotPolicy *storage.SnapshotPolicy
+	locker         lease.Locker
 	historySize    int
+	commitDelay    time.Duration
+	slowOperation  time.Duration
+	record         func(docID string) Recorder
+	logger         *slog.Logger
+}
+
+// loadCall is a session load that concurrent callers wait on.
+type loadCall struct {
+	done    chan struct{} // Closed once session and err are set
+	session *Session
+	err     error
+	vacated bool // Set when the slot was held without loading, so waiters load the session themselves
+}
+
+// heldLease is a document lease the manager renews while it keeps the
+// document's session.
+type heldLease struct {
+	lease lease.Lease
+	stop  chan struct{} // Closed to stop renewing
+	done  chan struct{} // Closed once renewing stopped
 }
 
 // ManagerConfig holds configuration for creating a manager.
@@ -26,8 +63,18 @@ type ManagerConfig struct {
 	Store          storage.Store
 	PermStore      acl.Store
 	Hub            *ws.Hub
+	Webhooks       *webhook.Service // Optional: receives document.updated events
+	Anchors        Anchors          // Optional: see SessionConfig.Anchors
 	SnapshotPolicy *storage.SnapshotPolicy
+	Locker         lease.Locker // Optional: leases documents so one instance at a time opens their session
 	HistorySize    int
+	CommitDelay    time.Duration // Optional: see SessionConfig.CommitDelay
+	SlowOperation  time.Duration // Optional: see SessionConfig.SlowOperation
+	Logger         *slog.Logger  // Optional: defaults to slog.Default()
+
+	// Record, when set, returns the recorder for each session opened, or
+	// nil not to record it.
+	Record func(docID string) Recorder
 }
 
 // NewManager creates a new session manager.
@@ -39,57 +86,300 @@ func NewManager(cfg ManagerConfig) *Manager {
 
 	return &Manager{
 		sessions:       make(map[string]*Session),
+		loading:        make(map[string]*loadCall),
+		leases:         make(map[string]*heldLease),
+		damaged:        make(map[string]struct{}),
 		store:          cfg.Store,
 		permStore:      cfg.PermStore,
 		hub:            cfg.Hub,
+		webhooks:       cfg.Webhooks,
+		anchors:        cfg.Anchors,
 		snapshotPolicy: cfg.SnapshotPolicy,
+		locker:         cfg.Locker,
 		historySize:    historySize,
+		commitDelay:    cfg.CommitDelay,
+		slowOperation:  cfg.SlowOperation,
+		record:         cfg.Record,
+		logger:         logging.Component(cfg.Logger, "collab"),
 	}
 }
 
 // GetOrCreateSession returns an existing session or creates a new one.
-func (m *Manager) GetOrCreateSession(docID string) (*Session, error) {
-	// Try read lock first
-	m.mu.RLock()
-	session, exists := m.sessions[docID]
-	m.mu.RUnlock()
+// Sessions for archived documents are read-only and aren't kept, so they
+// don't hold memory once the caller is done with them.
+//
+// Concurrent callers share a single load, but each waits only until its own
+// ctx is done, so a slow document can't pile up blocked requests.
+func (m *Manager) GetOrCreateSession(ctx context.Context, docID string) (*Session, error) {
+	for {
+		session, call, leader := m.lookup(docID)
+		if session != nil {
+			return session, nil
+		}
+
+		if leader {
+			return m.load(ctx, docID, call)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-call.done:
+		}
+
+		// The load was abandoned by its own caller, not by us, or the slot
+		// was held for something else, so try again
+		if call.vacated || (isContextError(call.err) && ctx.Err() == nil) {
+			continue
+		}
 
-	if exists {
-		return session, nil
+		return call.session, call.err
 	}
+}
 
-	// Need to create - acquire write lock
+// lookup returns the cached session for docID, or the load in progress.
+// If there is neither, it registers a new load and reports that the caller
+// must perform it. Quarantined documents have neither, and return
+// ErrQuarantined as the load's result.
+func (m *Manager) lookup(docID string) (*Session, *loadCall, bool) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Double-check after acquiring write lock
-	if session, exists = m.sessions[docID]; exists {
-		return session, nil
+	if _, quarantined := m.damaged[docID]; quarantined {
+		call := &loadCall{done: make(chan struct{}), err: ErrQuarantined}
+		close(call.done)
+
+		return nil, call, false
+	}
+
+	if session, exists := m.sessions[docID]; exists {
+		return session, nil, false
+	}
+
+	if call, loading := m.loading[docID]; loading {
+		return nil, call, false
+	}
+
+	call := &loadCall{done: make(chan struct{})}
+	m.loading[docID] = call
+
+	return nil, call, true
+}
+
+// load creates a session, loads it from storage and hands the result to
+// callers waiting on call. The session is cached unless the document is
+// archived or the session was closed while loading. Only a cached session
+// keeps the document's lease.
+func (m *Manager) load(ctx context.Context, docID string, call *loadCall) (*Session, error) {
+	session, held, err := m.open(ctx, docID)
+
+	cached := false
+
+	m.mu.Lock()
+
+	if m.loading[docID] == call {
+		delete(m.loading, docID)
+
+		if session != nil && !session.Archived() {
+			m.sessions[docID] = session
+			cached = true
+		}
+	}
+
+	if cached && held != nil {
+		m.leases[docID] = held
+	}
+
+	m.mu.Unlock()
+
+	switch {
+	case held == nil:
+	case cached:
+		go m.renew(docID, held)
+	default:
+		m.release(held.lease)
+	}
+
+	call.session, call.err = session, err
+	close(call.done)
+
+	return session, err
+}
+
+// open acquires the document's lease, when the manager has a locker, and
+// loads a session that writes with its fencing token.
+// Returns lease.ErrHeld while another instance holds the lease.
+func (m *Manager) open(ctx context.Context, docID string) (*Session, *heldLease, error) {
+	var held *heldLease
+
+	if m.locker != nil {
+		granted, err := m.locker.Acquire(ctx, docID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		held = &heldLease{lease: granted, stop: make(chan struct{}), done: make(chan struct{})}
 	}
 
-	// Create new session
 	var permChecker *acl.Checker
 	if m.permStore != nil {
 		permChecker = acl.NewChecker(m.permStore)
 	}
 
-	session = NewSession(SessionConfig{
+	session := NewSession(SessionConfig{
 		DocID:          docID,
 		Store:          m.store,
 		PermChecker:    permChecker,
 		Hub:            m.hub,
+		Webhooks:       m.webhooks,
+		Anchors:        m.anchors,
 		SnapshotPolicy: m.snapshotPolicy,
 		HistorySize:    m.historySize,
+		FencingToken:   held.token(),
+		Logger:         m.logger,
+		CommitDelay:    m.commitDelay,
+		SlowOperation:  m.slowOperation,
 	})
+	session.total = &m.rate
+	session.counters = &m.counters
+	session.onFailure = func() { m.discard(docID, session) }
+
+	if err := session.Load(ctx); err != nil {
+		if held != nil {
+			m.release(held.lease)
+		}
+
+		return nil, nil, err
+	}
+
+	// Archived documents are read-only, and their sessions aren't closed
+	if m.record != nil && !session.Archived() {
+		if recorder := m.record(docID); recorder != nil {
+			session.startRecording(recorder)
+		}
+	}
+
+	m.logger.DebugContext(ctx, "session loaded", logging.DocID(docID), logging.Revision(session.Revision()))
 
-	// Load from storage
-	if err := session.Load(); err != nil {
-		return nil, err
+	return session, held, nil
+}
+
+// token returns the lease's fencing token, or zero without a lease.
+func (h *heldLease) token() uint64 {
+	if h == nil {
+		return 0
 	}
 
-	m.sessions[docID] = session
+	return h.lease.Token
+}
 
-	return session, nil
+// leaseInterval is how often leases are renewed, and how long each call to
+// the locker may take, so a lease is renewed well before it expires.
+func (m *Manager) leaseInterval() time.Duration {
+	return m.locker.TTL() / 3
+}
+
+// renew keeps renewing a cached session's lease until it's stopped. If the
+// lease is lost, the session is closed, so the document's next request
+// loads it on whichever instance then holds the lease.
+func (m *Manager) renew(docID string, held *heldLease) {
+	defer close(held.done)
+
+	ticker := time.NewTicker(m.leaseInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-held.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), m.leaseInterval())
+		err := m.locker.Renew(ctx, held.lease)
+
+		cancel()
+
+		if err != nil {
+			m.logger.Warn("document lease lost", logging.DocID(docID), logging.Err(err))
+			m.drop(docID, held)
+
+			return
+		}
+	}
+}
+
+// drop closes the session whose lease was lost, unless it's already being
+// closed.
+func (m *Manager) drop(docID string, held *heldLease) {
+	m.mu.Lock()
+
+	if m.leases[docID] != held {
+		m.mu.Unlock()
+
+		return
+	}
+
+	session := m.sessions[docID]
+	delete(m.sessions, docID)
+	delete(m.leases, docID)
+	m.mu.Unlock()
+
+	// If another instance already took over, the store fences off the
+	// final snapshot
+	if err := session.Close(); err != nil {
+		m.logger.Warn("failed to close session without a lease", logging.DocID(docID), logging.Err(err))
+	}
+
+	m.release(held.lease)
+	m.evict(docID, closingMessage("document moved to another server"))
+}
+
+// discard removes a session that failed to store operations, unless it's
+// already being closed, and disconnects the document's clients so they
+// resync from what storage has.
+func (m *Manager) discard(docID string, session *Session) {
+	m.mu.Lock()
+
+	if m.sessions[docID] == session {
+		held := m.leases[docID]
+		delete(m.sessions, docID)
+		delete(m.leases, docID)
+		m.mu.Unlock()
+
+		m.stopLease(held)
+	} else {
+		m.mu.Unlock()
+	}
+
+	m.evict(docID, closingMessage("document failed to save"))
+}
+
+// stopLease stops renewing held, if any, and releases it.
+func (m *Manager) stopLease(held *heldLease) {
+	if held == nil {
+		return
+	}
+
+	close(held.stop)
+	<-held.done
+	m.release(held.lease)
+}
+
+// release gives up a lease, so another instance can take the document over
+// without waiting for the lease to expire.
+func (m *Manager) release(held lease.Lease) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.leaseInterval())
+	defer cancel()
+
+	if err := m.locker.Release(ctx, held); err != nil {
+		m.logger.Warn("failed to release document lease", logging.DocID(held.DocID), logging.Err(err))
+	}
+}
+
+// isContextError reports whether err means a context was canceled or timed out.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
 }
 
 // GetSession returns an existing session or nil if not found.
@@ -100,9 +390,12 @@ func (m *Manager) GetSession(docID string) *Session {
 	return m.sessions[docID]
 }
 
-// CloseSession closes and removes a session.
+// CloseSession closes and removes a session. A load in progress for the
+// document still completes, but its session isn't kept.
 func (m *Manager) CloseSession(docID string) error {
 	m.mu.Lock()
+	delete(m.loading, docID)
+
 	session, exists := m.sessions[docID]
 
 	if !exists {
@@ -111,14 +404,99 @@ func (m *Manager) CloseSession(docID string) error {
 		return nil
 	}
 
+	held := m.leases[docID]
 	delete(m.sessions, docID)
+	delete(m.leases, docID)
 	m.mu.Unlock()
 
-	return session.Close()
+	m.logger.Debug("session closed", logging.DocID(docID))
+
+	// The final snapshot is written before another instance can take over
+	err := session.Close()
+	m.stopLease(held)
+
+	return err
+}
+
+// SetArchived archives or unarchives a document and closes its session, so
+// the next session loads the new state. The document's clients are told
+// and disconnected, so they reconnect to that session.
+// Returns storage.ErrDocumentNotFound if the document doesn't exist.
+func (m *Manager) SetArchived(ctx context.Context, docID string, archived bool) error {
+	if err := m.store.SetArchived(ctx, docID, archived); err != nil {
+		return err
+	}
+
+	err := m.CloseSession(docID)
+
+	msg := closingMessage("document unarchived")
+	if archived {
+		msg = ws.Message{
+			Type:    ws.MessageTypeError,
+			Payload: ws.ErrorPayload{Code: ws.ErrorCodeDocumentArchived, Message: "document is archived"},
+		}
+	}
+
+	m.evict(docID, msg)
+
+	return err
+}
+
+// DeleteDocument closes the document's session, removes the document from
+// the store and disconnects its clients, telling them why.
+// Returns storage.ErrDocumentNotFound if the document doesn't exist.
+func (m *Manager) DeleteDocument(ctx context.Context, docID string) error {
+	if err := m.CloseSession(docID); err != nil {
+		return err
+	}
+
+	if err := m.store.DeleteDocument(ctx, docID); err != nil {
+		return err
+	}
+
+	m.evict(docID, closingMessage("document deleted"))
+
+	return nil
+}
+
+// evictTimeout is how long clients disconnected from a document are given
+// to receive the reason.
+const evictTimeout = 5 * time.Second
+
+// evict sends msg to the document's clients and disconnects them, so none
+// keeps using a session that was closed.
+func (m *Manager) evict(docID string, msg ws.Message) {
+	if m.hub == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), evictTimeout)
+	defer cancel()
+
+	if n := m.hub.Evict(ctx, docID, msg); n > 0 {
+		m.logger.Info("clients disconnected", logging.DocID(docID), "clients", n)
+	}
+}
+
+// closingMessage tells clients their document's session is closing for
+// reason, so they reconnect and resend unacknowledged edits.
+func closingMessage(reason string) ws.Message {
+	return ws.Message{Type: ws.MessageTypeClosing, Payload: ws.ClosingPayload{Reason: reason}}
 }
 
 // CloseAll closes all sessions.
 func (m *Manager) CloseAll() error {
+	return m.closeAll((*Session).Close)
+}
+
+// HandOffAll closes all sessions, saving their recent history so the
+// process that takes over their documents can transform edits clients made
+// before it started. It's meant for shutting down during a deploy.
+func (m *Manager) HandOffAll() error {
+	return m.closeAll((*Session).HandOff)
+}
+
+func (m *Manager) closeAll(closeSession func(*Session) error) error {
 	m.mu.Lock()
 	sessions := make([]*Session, 0, len(m.sessions))
 
@@ -126,20 +504,64 @@ func (m *Manager) CloseAll() error {
 		sessions = append(sessions, s)
 	}
 
+	leases := m.leases
+
 	m.sessions = make(map[string]*Session)
+	m.loading = make(map[string]*loadCall)
+	m.leases = make(map[string]*heldLease)
 	m.mu.Unlock()
 
 	var lastErr error
 
 	for _, s := range sessions {
-		if err := s.Close(); err != nil {
+		if err := closeSession(s); err != nil {
 			lastErr = err
 		}
 	}
 
+	for _, held := range leases {
+		m.stopLease(held)
+	}
+
 	return lastErr
 }
 
+// Sessions returns the active sessions ordered by document ID.
+func (m *Manager) Sessions() []*Session {
+	m.mu.RLock()
+	sessions := make([]*Session, 0, len(m.sessions))
+
+	for _, s := range m.sessions {
+		sessions = append(sessions, s)
+	}
+
+	m.mu.RUnlock()
+
+	slices.SortFunc(sessions, func(a, b *Session) int {
+		return strings.Compare(a.docID, b.docID)
+	})
+
+	return sessions
+}
+
+// OpsPerSecond returns the operations applied across all sessions, averaged
+// over the last minute.
+func (m *Manager) OpsPerSecond() float64 {
+	return m.rate.perSecond(time.Now())
+}
+
+// MemoryBytes returns the estimated memory used by all open sessions, see
+// SessionStats.
+func (m *Manager) MemoryBytes() int {
+	var total int
+
+	for _, session := range m.Sessions() {
+		total += session.Stats().MemoryBytes
+	}
+
+	return total
+}
+
 // SessionCount returns the number of active sessions.
 func (m *Manager) SessionCount() int {
 	m.mu.RLock()
@@ -1,13 +1,19 @@
 package collab_test
 
 import (
+	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/serroba/online-docs/internal/acl"
 	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/lease"
 	"github.com/serroba/online-docs/internal/ot"
 	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
 	"github.com/stretchr/testify/require"
 )
 
@@ -15,13 +21,13 @@ func TestManager_GetOrCreateSession(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	manager := collab.NewManager(collab.ManagerConfig{
 		Store: store,
 	})
 
-	session, err := manager.GetOrCreateSession("doc1")
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
 	require.NoError(t, err)
 
 	if session == nil {
@@ -33,7 +39,7 @@ func TestManager_GetOrCreateSession(t *testing.T) {
 	}
 
 	// Getting again should return the same session
-	session2, err := manager.GetOrCreateSession("doc1")
+	session2, err := manager.GetOrCreateSession(t.Context(), "doc1")
 	require.NoError(t, err)
 
 	if session != session2 {
@@ -45,7 +51,7 @@ func TestManager_GetSession(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	manager := collab.NewManager(collab.ManagerConfig{
 		Store: store,
@@ -58,7 +64,7 @@ func TestManager_GetSession(t *testing.T) {
 	}
 
 	// Create session
-	_, err := manager.GetOrCreateSession("doc1")
+	_, err := manager.GetOrCreateSession(t.Context(), "doc1")
 	require.NoError(t, err)
 
 	// After creating - should return session
@@ -72,13 +78,13 @@ func TestManager_CloseSession(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	manager := collab.NewManager(collab.ManagerConfig{
 		Store: store,
 	})
 
-	_, err := manager.GetOrCreateSession("doc1")
+	_, err := manager.GetOrCreateSession(t.Context(), "doc1")
 	require.NoError(t, err)
 
 	if manager.SessionCount() != 1 {
@@ -99,21 +105,21 @@ func TestManager_CloseAll(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
-	require.NoError(t, store.CreateDocument("doc2"))
-	require.NoError(t, store.CreateDocument("doc3"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc2"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc3"))
 
 	manager := collab.NewManager(collab.ManagerConfig{
 		Store: store,
 	})
 
-	_, err := manager.GetOrCreateSession("doc1")
+	_, err := manager.GetOrCreateSession(t.Context(), "doc1")
 	require.NoError(t, err)
 
-	_, err = manager.GetOrCreateSession("doc2")
+	_, err = manager.GetOrCreateSession(t.Context(), "doc2")
 	require.NoError(t, err)
 
-	_, err = manager.GetOrCreateSession("doc3")
+	_, err = manager.GetOrCreateSession(t.Context(), "doc3")
 	require.NoError(t, err)
 
 	if manager.SessionCount() != 3 {
@@ -127,6 +133,31 @@ func TestManager_CloseAll(t *testing.T) {
 	}
 }
 
+func TestManager_HandOffAll(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	manager := collab.NewManager(collab.ManagerConfig{Store: store})
+
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	_, err = session.ApplyOperation("c1", "u1", ot.NewInsert("a", 0, "u1"), 0)
+	require.NoError(t, err)
+
+	require.NoError(t, manager.HandOffAll())
+	require.Zero(t, manager.SessionCount())
+
+	// A new process's manager picks the history up
+	successor := collab.NewManager(collab.ManagerConfig{Store: store})
+
+	session, err = successor.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.Equal(t, 1, session.Stats().HistoryOps)
+}
+
 func TestManager_ConcurrentAccess(t *testing.T) {
 	t.Parallel()
 
@@ -134,7 +165,7 @@ func TestManager_ConcurrentAccess(t *testing.T) {
 
 	for i := range 10 {
 		docID := string(rune('a' + i))
-		require.NoError(t, store.CreateDocument(docID))
+		require.NoError(t, store.CreateDocument(t.Context(), docID))
 	}
 
 	manager := collab.NewManager(collab.ManagerConfig{
@@ -152,7 +183,7 @@ func TestManager_ConcurrentAccess(t *testing.T) {
 
 			docID := string(rune('a' + n))
 
-			_, err := manager.GetOrCreateSession(docID)
+			_, err := manager.GetOrCreateSession(t.Context(), docID)
 			if err != nil {
 				t.Errorf("unexpected error: %v", err)
 			}
@@ -170,8 +201,8 @@ func TestManager_SessionCount(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
-	require.NoError(t, store.CreateDocument("doc2"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc2"))
 
 	manager := collab.NewManager(collab.ManagerConfig{
 		Store: store,
@@ -181,14 +212,14 @@ func TestManager_SessionCount(t *testing.T) {
 		t.Errorf("expected 0 sessions initially, got %d", manager.SessionCount())
 	}
 
-	_, err := manager.GetOrCreateSession("doc1")
+	_, err := manager.GetOrCreateSession(t.Context(), "doc1")
 	require.NoError(t, err)
 
 	if manager.SessionCount() != 1 {
 		t.Errorf("expected 1 session, got %d", manager.SessionCount())
 	}
 
-	_, err = manager.GetOrCreateSession("doc2")
+	_, err = manager.GetOrCreateSession(t.Context(), "doc2")
 	require.NoError(t, err)
 
 	if manager.SessionCount() != 2 {
@@ -196,11 +227,39 @@ func TestManager_SessionCount(t *testing.T) {
 	}
 }
 
+func TestManager_Sessions(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc2"))
+
+	manager := collab.NewManager(collab.ManagerConfig{
+		Store: store,
+	})
+
+	if got := manager.Sessions(); len(got) != 0 {
+		t.Errorf("expected no sessions initially, got %d", len(got))
+	}
+
+	for _, docID := range []string{"doc2", "doc1"} {
+		_, err := manager.GetOrCreateSession(t.Context(), docID)
+		require.NoError(t, err)
+	}
+
+	sessions := manager.Sessions()
+	require.Len(t, sessions, 2)
+
+	if sessions[0].DocID() != "doc1" || sessions[1].DocID() != "doc2" {
+		t.Errorf("expected sessions ordered by document ID, got %s, %s", sessions[0].DocID(), sessions[1].DocID())
+	}
+}
+
 func TestManager_WithPermStore(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	permStore := acl.NewMemoryStore()
 	require.NoError(t, permStore.Grant("doc1", "editor", acl.Editor))
@@ -210,7 +269,7 @@ func TestManager_WithPermStore(t *testing.T) {
 		PermStore: permStore,
 	})
 
-	session, err := manager.GetOrCreateSession("doc1")
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
 	require.NoError(t, err)
 
 	// Editor should be able to write
@@ -234,17 +293,92 @@ func TestManager_GetOrCreateSession_LoadError(t *testing.T) {
 		Store: store,
 	})
 
-	_, err := manager.GetOrCreateSession("nonexistent")
+	_, err := manager.GetOrCreateSession(t.Context(), "nonexistent")
 	if err == nil {
 		t.Error("expected error when document doesn't exist")
 	}
 }
 
+// failingMetadataStore is a MemoryStore whose LoadMetadata always fails.
+type failingMetadataStore struct {
+	*storage.MemoryStore
+}
+
+func (failingMetadataStore) LoadMetadata(context.Context, string) (storage.Metadata, error) {
+	return storage.Metadata{}, errors.New("metadata unavailable")
+}
+
+func TestManager_GetOrCreateSession_MetadataError(t *testing.T) {
+	t.Parallel()
+
+	store := failingMetadataStore{MemoryStore: storage.NewMemoryStore()}
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	manager := collab.NewManager(collab.ManagerConfig{Store: store})
+
+	if _, err := manager.GetOrCreateSession(t.Context(), "doc1"); err == nil {
+		t.Error("expected error when metadata can't be loaded")
+	}
+}
+
+func TestManager_SetArchived(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	manager := collab.NewManager(collab.ManagerConfig{Store: store})
+
+	live, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	_, err = live.ApplyOperation("c1", "alice", ot.NewInsert("a", 0, "alice"), 0)
+	require.NoError(t, err)
+
+	require.NoError(t, manager.SetArchived(t.Context(), "doc1", true))
+
+	// Archiving closes the live session
+	_, err = live.ApplyOperation("c1", "alice", ot.NewInsert("b", 1, "alice"), 1)
+	require.ErrorIs(t, err, collab.ErrSessionClosed)
+
+	archived, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.True(t, archived.Archived())
+
+	content, revision, err := archived.GetState("alice")
+	require.NoError(t, err)
+
+	if content != "a" || revision != 1 {
+		t.Errorf("expected archived content %q at revision 1, got %q at %d", "a", content, revision)
+	}
+
+	_, err = archived.ApplyOperation("c1", "alice", ot.NewInsert("b", 1, "alice"), 1)
+	require.ErrorIs(t, err, collab.ErrDocumentArchived)
+
+	if manager.SessionCount() != 0 {
+		t.Errorf("expected archived sessions not to be kept, got %d sessions", manager.SessionCount())
+	}
+
+	require.NoError(t, manager.SetArchived(t.Context(), "doc1", false))
+
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	_, err = session.ApplyOperation("c1", "alice", ot.NewInsert("b", 1, "alice"), 1)
+	require.NoError(t, err)
+
+	if manager.SessionCount() != 1 {
+		t.Errorf("expected the unarchived session to be kept, got %d sessions", manager.SessionCount())
+	}
+
+	require.ErrorIs(t, manager.SetArchived(t.Context(), "missing", true), storage.ErrDocumentNotFound)
+}
+
 func TestManager_GetOrCreateSession_RaceCondition(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	manager := collab.NewManager(collab.ManagerConfig{
 		Store: store,
@@ -261,7 +395,7 @@ func TestManager_GetOrCreateSession_RaceCondition(t *testing.T) {
 		go func(idx int) {
 			defer wg.Done()
 
-			session, err := manager.GetOrCreateSession("doc1")
+			session, err := manager.GetOrCreateSession(t.Context(), "doc1")
 			if err != nil {
 				t.Errorf("unexpected error: %v", err)
 
@@ -292,15 +426,440 @@ func TestManager_CustomHistorySize(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	manager := collab.NewManager(collab.ManagerConfig{
 		Store:       store,
 		HistorySize: 50,
 	})
 
-	_, err := manager.GetOrCreateSession("doc1")
+	_, err := manager.GetOrCreateSession(t.Context(), "doc1")
 	require.NoError(t, err)
 
 	// Just verifying no panic with custom history size
 }
+
+// slowStore is a MemoryStore whose LoadSnapshot blocks until release is
+// closed or the caller's context is done.
+type slowStore struct {
+	*storage.MemoryStore
+
+	entered chan struct{} // Receives a value each time a load starts
+	release chan struct{}
+}
+
+func newSlowStore(t *testing.T) *slowStore {
+	t.Helper()
+
+	store := &slowStore{
+		MemoryStore: storage.NewMemoryStore(),
+		entered:     make(chan struct{}, 10),
+		release:     make(chan struct{}),
+	}
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	return store
+}
+
+func (s *slowStore) LoadSnapshot(ctx context.Context, docID string) (storage.Snapshot, error) {
+	s.entered <- struct{}{}
+
+	select {
+	case <-ctx.Done():
+		return storage.Snapshot{}, ctx.Err()
+	case <-s.release:
+		return s.MemoryStore.LoadSnapshot(ctx, docID)
+	}
+}
+
+func TestManager_GetOrCreateSession_WaiterDeadline(t *testing.T) {
+	t.Parallel()
+
+	store := newSlowStore(t)
+	manager := collab.NewManager(collab.ManagerConfig{Store: store})
+
+	loaded := make(chan error, 1)
+
+	go func() {
+		_, err := manager.GetOrCreateSession(t.Context(), "doc1")
+		loaded <- err
+	}()
+
+	<-store.entered
+
+	// A second caller stops waiting at its own deadline
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := manager.GetOrCreateSession(ctx, "doc1")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(store.release)
+	require.NoError(t, <-loaded)
+
+	if manager.SessionCount() != 1 {
+		t.Errorf("expected 1 session, got %d", manager.SessionCount())
+	}
+}
+
+func TestManager_GetOrCreateSession_LoaderCanceled(t *testing.T) {
+	t.Parallel()
+
+	store := newSlowStore(t)
+	manager := collab.NewManager(collab.ManagerConfig{Store: store})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	loaded := make(chan error, 1)
+
+	go func() {
+		_, err := manager.GetOrCreateSession(ctx, "doc1")
+		loaded <- err
+	}()
+
+	<-store.entered
+
+	waited := make(chan *collab.Session, 1)
+
+	go func() {
+		session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		waited <- session
+	}()
+
+	// The first caller goes away; the second loads the session itself
+	cancel()
+	require.ErrorIs(t, <-loaded, context.Canceled)
+
+	<-store.entered
+	close(store.release)
+
+	if session := <-waited; session == nil || manager.GetSession("doc1") != session {
+		t.Error("expected the waiting caller to load and cache the session")
+	}
+}
+
+func TestManager_CloseSession_WhileLoading(t *testing.T) {
+	t.Parallel()
+
+	store := newSlowStore(t)
+	manager := collab.NewManager(collab.ManagerConfig{Store: store})
+
+	loaded := make(chan *collab.Session, 1)
+
+	go func() {
+		session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		loaded <- session
+	}()
+
+	<-store.entered
+	require.NoError(t, manager.CloseSession("doc1"))
+	close(store.release)
+
+	if session := <-loaded; session == nil {
+		t.Fatal("expected the load to complete")
+	}
+
+	if manager.GetSession("doc1") != nil {
+		t.Error("expected a session closed while loading not to be kept")
+	}
+}
+
+func TestManager_OpsPerSecond(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc2"))
+
+	manager := collab.NewManager(collab.ManagerConfig{Store: store})
+	require.Zero(t, manager.OpsPerSecond())
+
+	for _, docID := range []string{"doc1", "doc2", "doc2"} {
+		session, err := manager.GetOrCreateSession(t.Context(), docID)
+		require.NoError(t, err)
+
+		_, err = session.ApplyOperation("c1", "u1", ot.NewInsert("a", 0, "u1"), session.Revision())
+		require.NoError(t, err)
+	}
+
+	// Closed sessions still count towards the server-wide rate
+	require.NoError(t, manager.CloseSession("doc1"))
+
+	if got := manager.OpsPerSecond(); got != 3.0/60 {
+		t.Errorf("expected three operations averaged over a minute, got %v", got)
+	}
+}
+
+func TestManager_MemoryBytes(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc2"))
+
+	manager := collab.NewManager(collab.ManagerConfig{Store: store})
+	require.Zero(t, manager.MemoryBytes())
+
+	var want int
+
+	for _, docID := range []string{"doc1", "doc2"} {
+		session, err := manager.GetOrCreateSession(t.Context(), docID)
+		require.NoError(t, err)
+
+		_, err = session.ApplyOperation("c1", "u1", ot.NewInsert("a", 0, "u1"), 0)
+		require.NoError(t, err)
+
+		want += session.Stats().MemoryBytes
+	}
+
+	require.Equal(t, want, manager.MemoryBytes())
+
+	// Closed sessions no longer hold memory
+	require.NoError(t, manager.CloseSession("doc1"))
+	require.Less(t, manager.MemoryBytes(), want)
+}
+
+// partitionedLocker is a lease.Locker that can lose contact with the locker
+// it shares with other managers, as an instance cut off from Redis would.
+type partitionedLocker struct {
+	lease.Locker
+
+	cut atomic.Bool
+}
+
+func (l *partitionedLocker) Renew(ctx context.Context, held lease.Lease) error {
+	if l.cut.Load() {
+		return errors.New("connection refused")
+	}
+
+	return l.Locker.Renew(ctx, held)
+}
+
+func TestManager_Lease(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	locker := lease.NewMemoryLocker(time.Minute)
+	first := collab.NewManager(collab.ManagerConfig{Store: store, Locker: locker})
+	second := collab.NewManager(collab.ManagerConfig{Store: store, Locker: locker})
+
+	_, err := first.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	_, err = second.GetOrCreateSession(t.Context(), "doc1")
+	require.ErrorIs(t, err, lease.ErrHeld)
+
+	// Closing the session hands the document over at once
+	require.NoError(t, first.CloseSession("doc1"))
+
+	_, err = second.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	require.NoError(t, second.CloseAll())
+
+	_, err = first.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.NoError(t, first.SetArchived(t.Context(), "doc1", true))
+
+	// Sessions that aren't kept, or fail to load, don't keep the lease
+	_, err = first.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	_, err = first.GetOrCreateSession(t.Context(), "missing")
+	require.ErrorIs(t, err, storage.ErrDocumentNotFound)
+
+	_, err = second.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	require.NoError(t, store.CreateDocument(t.Context(), "missing"))
+
+	_, err = second.GetOrCreateSession(t.Context(), "missing")
+	require.NoError(t, err)
+}
+
+func TestManager_Lease_Failover(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	shared := lease.NewMemoryLocker(60 * time.Millisecond)
+	partitioned := &partitionedLocker{Locker: shared}
+	first := collab.NewManager(collab.ManagerConfig{Store: store, Locker: partitioned})
+	second := collab.NewManager(collab.ManagerConfig{Store: store, Locker: shared})
+
+	stale, err := first.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	// The holder keeps renewing its lease
+	time.Sleep(150 * time.Millisecond)
+
+	_, err = second.GetOrCreateSession(t.Context(), "doc1")
+	require.ErrorIs(t, err, lease.ErrHeld)
+
+	// Once it can't, it stops serving the document and another instance takes over
+	partitioned.cut.Store(true)
+	require.Eventually(t, func() bool { return first.GetSession("doc1") == nil }, time.Second, 10*time.Millisecond)
+
+	_, err = stale.ApplyOperation("c1", "u1", ot.NewInsert("a", 0, "u1"), 0)
+	require.ErrorIs(t, err, collab.ErrSessionClosed)
+
+	require.Eventually(t, func() bool {
+		_, err := second.GetOrCreateSession(t.Context(), "doc1")
+
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+// recordingConn is a ws.Conn that records the messages sent to it.
+type recordingConn struct {
+	mu     sync.Mutex
+	sent   []ws.Message
+	closed bool
+}
+
+func (c *recordingConn) WriteJSON(v any) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sent = append(c.sent, v.(ws.Message)) //nolint:forcetypeassert // Clients only send messages
+
+	return nil
+}
+
+func (c *recordingConn) ReadJSON(any) error {
+	return errors.New("not readable")
+}
+
+func (c *recordingConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+
+	return nil
+}
+
+// evicted returns the message the client was sent before being
+// disconnected, or false if it's still connected.
+func (c *recordingConn) evicted() (ws.Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.closed || len(c.sent) != 1 {
+		return ws.Message{}, false
+	}
+
+	return c.sent[0], true
+}
+
+func TestManager_DisconnectsClients(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		close func(t *testing.T, manager *collab.Manager, locker *partitionedLocker)
+		want  ws.MessageType
+	}{
+		{
+			"archiving",
+			func(t *testing.T, manager *collab.Manager, _ *partitionedLocker) {
+				t.Helper()
+				require.NoError(t, manager.SetArchived(t.Context(), "doc1", true))
+			},
+			ws.MessageTypeError,
+		},
+		{
+			"deleting",
+			func(t *testing.T, manager *collab.Manager, _ *partitionedLocker) {
+				t.Helper()
+				require.NoError(t, manager.DeleteDocument(t.Context(), "doc1"))
+			},
+			ws.MessageTypeClosing,
+		},
+		{
+			"losing the lease",
+			func(t *testing.T, manager *collab.Manager, locker *partitionedLocker) {
+				t.Helper()
+				locker.cut.Store(true)
+				require.Eventually(t, func() bool { return manager.GetSession("doc1") == nil },
+					time.Second, 10*time.Millisecond)
+			},
+			ws.MessageTypeClosing,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := storage.NewMemoryStore()
+			require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+			hub := ws.NewHub()
+			locker := &partitionedLocker{Locker: lease.NewMemoryLocker(60 * time.Millisecond)}
+			manager := collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub, Locker: locker})
+
+			_, err := manager.GetOrCreateSession(t.Context(), "doc1")
+			require.NoError(t, err)
+
+			conn := &recordingConn{}
+			client := ws.NewClient("c1", "alice", conn)
+			hub.Register(client)
+			hub.Subscribe(client, "doc1")
+
+			tt.close(t, manager, locker)
+
+			require.Eventually(t, func() bool {
+				msg, ok := conn.evicted()
+
+				return ok && msg.Type == tt.want
+			}, time.Second, 10*time.Millisecond)
+		})
+	}
+}
+
+func TestManager_DiscardsFailedSession(t *testing.T) {
+	t.Parallel()
+
+	store := failingAppendStore{MemoryStore: storage.NewMemoryStore()}
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	hub := ws.NewHub()
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub})
+
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	conn := &recordingConn{}
+	client := ws.NewClient("c1", "alice", conn)
+	hub.Register(client)
+	hub.Subscribe(client, "doc1")
+
+	_, err = session.ApplyOperation("c1", "alice", ot.NewInsert("x", 0, "alice"), 0)
+	require.Error(t, err)
+
+	// The client is told to reconnect, to a session loaded from storage
+	msg, ok := conn.evicted()
+	require.True(t, ok)
+	require.Equal(t, ws.MessageTypeClosing, msg.Type)
+	require.Nil(t, manager.GetSession("doc1"))
+
+	reloaded, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.NotSame(t, session, reloaded)
+
+	content, revision, err := reloaded.GetState("alice")
+	require.NoError(t, err)
+	require.Empty(t, content)
+	require.Zero(t, revision)
+}
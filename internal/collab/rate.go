@@ -0,0 +1,52 @@
+package collab
+
+import (
+	"sync"
+	"time"
+)
+
+// rateWindow is how many seconds operation rates are averaged over.
+const rateWindow = 60
+
+// opRate counts operations over the last minute in one-second buckets.
+type opRate struct {
+	mu      sync.Mutex
+	counts  [rateWindow]int
+	seconds [rateWindow]int64 // Unix second each bucket is counting
+}
+
+// record counts an operation applied at now.
+func (r *opRate) record(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	second := now.Unix()
+	i := second % rateWindow
+
+	// The bucket last counted a second that has left the window
+	if r.seconds[i] != second {
+		r.seconds[i] = second
+		r.counts[i] = 0
+	}
+
+	r.counts[i]++
+}
+
+// perSecond returns the average number of operations per second over the
+// window ending at now.
+func (r *opRate) perSecond(now time.Time) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	oldest := now.Unix() - rateWindow
+
+	total := 0
+
+	for i, second := range r.seconds {
+		if second > oldest {
+			total += r.counts[i]
+		}
+	}
+
+	return float64(total) / rateWindow
+}
@@ -0,0 +1,31 @@
+package collab
+
+import "github.com/serroba/online-docs/internal/ot"
+
+// Recorder captures what a session does, so it can be replayed through a
+// fresh session later, see package recording. Its methods are called with
+// the session's lock held, in the order the session did things, so they
+// should return quickly.
+type Recorder interface {
+	// RecordLoad records the state the session is recorded from.
+	RecordLoad(state RecordedState)
+
+	// RecordOperation records an operation a client sent, with the revision
+	// it was based on, and what the session made of it: the operation as
+	// transformed and sequenced, or the error it was rejected with.
+	RecordOperation(clientID, userID string, op ot.Operation, baseRevision int, applied ot.SequencedOperation, err error)
+
+	// RecordClose records the state the session closed with. No more calls
+	// follow it.
+	RecordClose(content string, revision int)
+}
+
+// RecordedState is the state a session is recorded from, which a replay
+// starts from.
+type RecordedState struct {
+	DocID       string
+	Content     string
+	Revision    int
+	HistorySize int                     // Operations kept for transforming stale ones
+	History     []ot.SequencedOperation // The operations kept when recording started
+}
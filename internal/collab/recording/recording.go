@@ -0,0 +1,203 @@
+// Package recording records document sessions to files and replays them
+// through a fresh session, to reproduce reports of clients diverging.
+//
+// A recording is a JSON document per line: the state the session was
+// recorded from, then every operation a client sent with what the session
+// made of it, then the state the session closed with. Replaying applies the
+// operations in the order the session did, so they're transformed against
+// the same operations, and reports where the replay's results differ.
+package recording
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/ot"
+)
+
+// Kinds of events.
+const (
+	KindLoad      = "load"
+	KindOperation = "operation"
+	KindClose     = "close"
+)
+
+// ErrMalformed is returned for recordings that can't be replayed.
+var ErrMalformed = errors.New("malformed recording")
+
+// Event is a line of a recording.
+type Event struct {
+	Kind string    `json:"kind"`
+	Time time.Time `json:"time"`
+
+	// Load and close
+	Content  string `json:"content,omitempty"`
+	Revision int    `json:"revision,omitempty"`
+
+	// Load
+	DocID       string      `json:"doc_id,omitempty"`
+	HistorySize int         `json:"history_size,omitempty"`
+	History     []Operation `json:"history,omitempty"`
+
+	// Operation: what the client sent, and the operation as applied or the
+	// error it was rejected with
+	ClientID     string     `json:"client_id,omitempty"`
+	UserID       string     `json:"user_id,omitempty"`
+	Op           *Operation `json:"op,omitempty"`
+	BaseRevision int        `json:"base_revision,omitempty"`
+	Applied      *Operation `json:"applied,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// Operation is an operation in a recording.
+type Operation struct {
+	Type     int    `json:"type"` // 0 inserts, 1 deletes, as in WebSocket messages
+	Position int    `json:"position"`
+	Char     string `json:"char,omitempty"`
+	UserID   string `json:"user_id,omitempty"`
+	Revision int    `json:"revision,omitempty"` // Of applied operations
+}
+
+// fromOT converts an operation to its recorded form.
+func fromOT(op ot.Operation, revision int) *Operation {
+	return &Operation{
+		Type:     int(op.Type),
+		Position: op.Position,
+		Char:     op.Char,
+		UserID:   op.UserID,
+		Revision: revision,
+	}
+}
+
+// OT returns the operation.
+func (o *Operation) OT() ot.Operation {
+	return ot.Operation{Type: ot.OpType(o.Type), Position: o.Position, Char: o.Char, UserID: o.UserID}
+}
+
+// String describes the operation.
+func (o *Operation) String() string {
+	desc := fmt.Sprintf("delete at %d", o.Position)
+	if ot.OpType(o.Type) == ot.Insert {
+		desc = fmt.Sprintf("insert %q at %d", o.Char, o.Position)
+	}
+
+	if o.Revision > 0 {
+		desc += fmt.Sprintf(" as revision %d", o.Revision)
+	}
+
+	return desc
+}
+
+// Recorder writes a session's recording, see collab.Recorder. Each event is
+// written as it happens, so the recording survives the process crashing.
+// If writing fails the error is logged and the rest isn't recorded.
+type Recorder struct {
+	mu     sync.Mutex
+	enc    *json.Encoder
+	closer io.Closer // Closed with the session, if set
+	failed bool
+	logger *slog.Logger
+}
+
+// NewRecorder creates a recorder that writes to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{
+		enc:    json.NewEncoder(w),
+		logger: logging.Component(nil, "recording"),
+	}
+}
+
+// Create creates a file in dir to record a document's session to, named
+// after the document and the current time.
+func Create(dir, docID string) (*Recorder, error) {
+	name := fmt.Sprintf("%s-%s.jsonl", url.PathEscape(docID), time.Now().UTC().Format("20060102T150405.000000000"))
+
+	f, err := os.Create(filepath.Join(dir, name)) //nolint:gosec // The name is escaped
+	if err != nil {
+		return nil, fmt.Errorf("create recording: %w", err)
+	}
+
+	r := NewRecorder(f)
+	r.closer = f
+	r.logger = r.logger.With(logging.DocID(docID), "file", f.Name())
+
+	return r, nil
+}
+
+// RecordLoad implements collab.Recorder.
+func (r *Recorder) RecordLoad(state collab.RecordedState) {
+	history := make([]Operation, len(state.History))
+	for i, op := range state.History {
+		history[i] = *fromOT(op.Operation, op.Revision)
+	}
+
+	r.write(&Event{
+		Kind:        KindLoad,
+		DocID:       state.DocID,
+		Content:     state.Content,
+		Revision:    state.Revision,
+		HistorySize: state.HistorySize,
+		History:     history,
+	})
+}
+
+// RecordOperation implements collab.Recorder.
+func (r *Recorder) RecordOperation(
+	clientID, userID string, op ot.Operation, baseRevision int, applied ot.SequencedOperation, err error,
+) {
+	event := &Event{
+		Kind:         KindOperation,
+		ClientID:     clientID,
+		UserID:       userID,
+		Op:           fromOT(op, 0),
+		BaseRevision: baseRevision,
+	}
+
+	if err != nil {
+		event.Error = err.Error()
+	} else {
+		event.Applied = fromOT(applied.Operation, applied.Revision)
+	}
+
+	r.write(event)
+}
+
+// RecordClose implements collab.Recorder, closing the file being recorded to.
+func (r *Recorder) RecordClose(content string, revision int) {
+	r.write(&Event{Kind: KindClose, Content: content, Revision: revision})
+
+	if r.closer == nil {
+		return
+	}
+
+	if err := r.closer.Close(); err != nil {
+		r.logger.Error("closing recording failed", logging.Err(err))
+	}
+}
+
+// write writes an event, unless a write failed before.
+func (r *Recorder) write(event *Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failed {
+		return
+	}
+
+	event.Time = time.Now()
+
+	if err := r.enc.Encode(event); err != nil {
+		r.failed = true
+		r.logger.Error("recording failed", logging.Err(err))
+	}
+}
@@ -0,0 +1,183 @@
+package recording_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/collab/recording"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// record records a session of doc1, which was handed over with some
+// history, while alice and bob edit it, and returns the recording.
+func record(t *testing.T) []byte {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	before := collab.NewSession(collab.SessionConfig{DocID: "doc1", Store: store})
+	require.NoError(t, before.Load(t.Context()))
+
+	for i, char := range "hi" {
+		_, err := before.ApplyOperation("c1", "alice", ot.NewInsert(string(char), i, "alice"), i)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, before.HandOff())
+
+	var buf bytes.Buffer
+
+	manager := collab.NewManager(collab.ManagerConfig{
+		Store:  store,
+		Record: func(string) collab.Recorder { return recording.NewRecorder(&buf) },
+	})
+
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	_, err = session.ApplyOperation("c1", "alice", ot.NewInsert("!", 2, "alice"), 2)
+	require.NoError(t, err)
+
+	// Bob's edit is transformed against the handed over history
+	_, err = session.ApplyOperation("c2", "bob", ot.NewInsert("o", 0, "bob"), 0)
+	require.NoError(t, err)
+	_, err = session.ApplyOperation("c2", "bob", ot.NewDelete(0, "bob"), 9)
+	require.Error(t, err)
+
+	require.NoError(t, manager.CloseSession("doc1"))
+
+	return buf.Bytes()
+}
+
+func TestReplay(t *testing.T) {
+	t.Parallel()
+
+	data := record(t)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 5)
+
+	var load recording.Event
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &load))
+	require.Equal(t, recording.KindLoad, load.Kind)
+	require.Equal(t, "hi", load.Content)
+	require.Len(t, load.History, 2)
+
+	result, err := recording.Replay(t.Context(), bytes.NewReader(data), recording.ReplayConfig{})
+	require.NoError(t, err)
+	require.Equal(t, recording.Result{
+		DocID:      "doc1",
+		Operations: 3,
+		Content:    "hi!o",
+		Revision:   4,
+	}, result)
+}
+
+func TestReplay_Divergence(t *testing.T) {
+	t.Parallel()
+
+	data := record(t)
+
+	// Pretend the session applied bob's insert somewhere else
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	var event recording.Event
+	require.NoError(t, json.Unmarshal([]byte(lines[2]), &event))
+
+	event.Applied.Position = 1
+
+	line, err := json.Marshal(event)
+	require.NoError(t, err)
+
+	lines[2] = string(line)
+
+	result, err := recording.Replay(t.Context(), strings.NewReader(strings.Join(lines, "\n")), recording.ReplayConfig{})
+	require.NoError(t, err)
+	require.Equal(t, []recording.Divergence{{
+		Line:     3,
+		Recorded: `insert "o" at 1 as revision 4`,
+		Replayed: `insert "o" at 3 as revision 4`,
+	}}, result.Divergences)
+}
+
+func TestReplay_Speed(t *testing.T) {
+	t.Parallel()
+
+	start := time.Now()
+	events := []recording.Event{
+		{Kind: recording.KindLoad, Time: start, DocID: "doc1"},
+		{Kind: recording.KindOperation, Time: start.Add(time.Second), Op: &recording.Operation{Char: "a"}},
+	}
+
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	for _, event := range events {
+		require.NoError(t, enc.Encode(event))
+	}
+
+	began := time.Now()
+
+	result, err := recording.Replay(t.Context(), &buf, recording.ReplayConfig{Speed: 10})
+	require.NoError(t, err)
+	require.Equal(t, "a", result.Content)
+	require.GreaterOrEqual(t, time.Since(began), 100*time.Millisecond)
+}
+
+func TestReplay_Malformed(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"empty":           "",
+		"not json":        "recording",
+		"no load":         `{"kind": "close"}`,
+		"unknown event":   `{"kind": "load", "doc_id": "doc1"}` + "\n" + `{"kind": "other"}`,
+		"missing op":      `{"kind": "load", "doc_id": "doc1"}` + "\n" + `{"kind": "operation"}`,
+		"truncated event": `{"kind": "load", "doc_id": "doc1"}` + "\n" + `{"kind": "oper`,
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := recording.Replay(t.Context(), strings.NewReader(data), recording.ReplayConfig{})
+			require.ErrorIs(t, err, recording.ErrMalformed)
+		})
+	}
+}
+
+func TestCreate(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	recorder, err := recording.Create(dir, "notes/2024")
+	require.NoError(t, err)
+
+	recorder.RecordLoad(collab.RecordedState{DocID: "notes/2024", Content: "hi", Revision: 2})
+	recorder.RecordClose("hi", 2)
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.True(t, strings.HasPrefix(files[0].Name(), "notes%2F2024-"), files[0].Name())
+
+	f, err := os.Open(filepath.Join(dir, files[0].Name()))
+	require.NoError(t, err)
+
+	defer func() { _ = f.Close() }()
+
+	result, err := recording.Replay(t.Context(), f, recording.ReplayConfig{})
+	require.NoError(t, err)
+	require.Empty(t, result.Divergences)
+	require.Equal(t, "hi", result.Content)
+}
@@ -0,0 +1,208 @@
+package recording
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// ReplayConfig holds the settings of a replay.
+type ReplayConfig struct {
+	// Speed scales the time between operations: 1 replays them as far apart
+	// as they were recorded, 2 twice as fast. Zero replays them without
+	// waiting.
+	Speed float64
+}
+
+// Divergence is an event whose replay differs from its recording.
+type Divergence struct {
+	Line     int    // Of the event in the recording
+	Recorded string // What the recorded session made of it
+	Replayed string // What the replay made of it
+}
+
+// Result describes a replay.
+type Result struct {
+	DocID       string
+	Operations  int    // Operations replayed
+	Content     string // The replay's final content
+	Revision    int    // The replay's final revision
+	Divergences []Divergence
+}
+
+// Replay applies the operations in a recording to a fresh session in memory,
+// and reports where the results differ from the recorded ones. It stops
+// with the context's error if ctx is done first, and returns ErrMalformed
+// if the recording can't be read.
+func Replay(ctx context.Context, r io.Reader, cfg ReplayConfig) (Result, error) {
+	dec := json.NewDecoder(r)
+
+	var load Event
+	if err := dec.Decode(&load); err != nil || load.Kind != KindLoad {
+		return Result{}, fmt.Errorf("%w: it doesn't start with the state loaded", ErrMalformed)
+	}
+
+	session, last, err := start(ctx, &load)
+	if err != nil {
+		return Result{}, err
+	}
+	defer func() { _ = session.Close() }()
+
+	result := Result{DocID: load.DocID}
+	prev := load.Time
+
+	for line := 2; ; line++ {
+		var event Event
+		if err := dec.Decode(&event); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return result, fmt.Errorf("%w: line %d: %w", ErrMalformed, line, err)
+		}
+
+		if err := wait(ctx, event.Time.Sub(prev), cfg.Speed); err != nil {
+			return result, err
+		}
+
+		prev = event.Time
+
+		recorded, replayed, err := replayEvent(session, last, &event)
+		if err != nil {
+			return result, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if event.Kind == KindOperation {
+			result.Operations++
+		}
+
+		if recorded != replayed {
+			result.Divergences = append(result.Divergences, Divergence{
+				Line: line, Recorded: recorded, Replayed: replayed,
+			})
+		}
+	}
+
+	result.Content, result.Revision, err = session.GetState("")
+
+	return result, err
+}
+
+// start loads a session with the state a recording starts from. Its
+// recorder keeps what it made of the last operation.
+func start(ctx context.Context, load *Event) (*collab.Session, *lastOperation, error) {
+	store := storage.NewMemoryStore()
+	if err := store.CreateDocument(ctx, load.DocID); err != nil {
+		return nil, nil, err
+	}
+
+	if err := store.SaveSnapshot(ctx, load.DocID, load.Revision, load.Content); err != nil {
+		return nil, nil, err
+	}
+
+	// The history is restored the way a session taken over from another
+	// process restores it
+	if len(load.History) > 0 {
+		handoff := storage.Handoff{DocID: load.DocID, Revision: load.Revision, Content: load.Content}
+		for _, op := range load.History {
+			handoff.History = append(handoff.History, ot.SequencedOperation{Operation: op.OT(), Revision: op.Revision})
+		}
+
+		if err := store.SaveHandoff(ctx, handoff); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	last := &lastOperation{}
+	session := collab.NewSession(collab.SessionConfig{
+		DocID:       load.DocID,
+		Store:       store,
+		HistorySize: load.HistorySize,
+		Recorder:    last,
+	})
+
+	if err := session.Load(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	return session, last, nil
+}
+
+// wait sleeps for d scaled by speed, or not at all if speed is 0.
+func wait(ctx context.Context, d time.Duration, speed float64) error {
+	if speed <= 0 || d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(time.Duration(float64(d) / speed))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// replayEvent replays an event, and describes its recorded and replayed
+// outcome.
+func replayEvent(session *collab.Session, last *lastOperation, event *Event) (string, string, error) {
+	switch event.Kind {
+	case KindOperation:
+		if event.Op == nil {
+			return "", "", fmt.Errorf("%w: operation missing", ErrMalformed)
+		}
+
+		recorded := "rejected: " + event.Error
+		if event.Applied != nil {
+			recorded = event.Applied.String()
+		}
+
+		// The outcome is what the session applied, which is recorded even if
+		// storing it fails
+		last.outcome = ""
+		_, _ = session.ApplyOperation(event.ClientID, event.UserID, event.Op.OT(), event.BaseRevision)
+
+		return recorded, last.outcome, nil
+	case KindClose:
+		content, revision, err := session.GetState("")
+		if err != nil {
+			return "", "", err
+		}
+
+		return describeState(event.Content, event.Revision), describeState(content, revision), nil
+	default:
+		return "", "", fmt.Errorf("%w: unexpected %q event", ErrMalformed, event.Kind)
+	}
+}
+
+// describeState describes a document's state.
+func describeState(content string, revision int) string {
+	return fmt.Sprintf("revision %d with content %q", revision, content)
+}
+
+// lastOperation records what a session made of its latest operation, in the
+// form Divergence reports it.
+type lastOperation struct {
+	outcome string
+}
+
+func (l *lastOperation) RecordLoad(collab.RecordedState) {}
+
+func (l *lastOperation) RecordOperation(
+	_, _ string, _ ot.Operation, _ int, applied ot.SequencedOperation, err error,
+) {
+	if err != nil {
+		l.outcome = "rejected: " + err.Error()
+	} else {
+		l.outcome = fromOT(applied.Operation, applied.Revision).String()
+	}
+}
+
+func (l *lastOperation) RecordClose(string, int) {}
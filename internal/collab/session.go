@@ -1,18 +1,36 @@
 package collab
 
 import (
+	"context"
 	"errors"
+	"log/slog"
+	"maps"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/logging"
 	"github.com/serroba/online-docs/internal/ot"
 	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/webhook"
 	"github.com/serroba/online-docs/internal/ws"
 )
 
 // Common errors.
 var (
-	ErrSessionClosed = errors.New("session is closed")
+	ErrSessionClosed    = errors.New("session is closed")
+	ErrDocumentArchived = errors.New("document is archived")
+	ErrQuarantined      = errors.New("document is quarantined")
+	ErrEmptyBatch       = errors.New("batch has no operations")
+
+	// ErrRevisionMismatch is returned by ApplyIfRevision when the document
+	// is at another revision than the edit expects.
+	ErrRevisionMismatch = errors.New("revision mismatch")
+
+	errNotStored = errors.New("operation was not stored")
 )
 
 // Session coordinates collaborative editing for a single document.
@@ -24,12 +42,38 @@ type Session struct {
 	document *ot.Document
 	queue    *ot.Queue
 	closed   bool
+	view     atomic.Pointer[view] // The state as of the latest operation, for readers that don't take mu
+	archived bool                 // Archived documents are read-only
+	changed  chan struct{}        // Closed and replaced whenever the revision advances
+	rate     opRate               // Operations applied recently
+	total    *opRate              // Server-wide rate, when created by a Manager
+	counters *counters            // Server-wide totals, when created by a Manager
+	token    uint64               // Fencing token of the document's lease, if any
+
+	// Each user's undo and redo stacks, see Undo
+	edits map[string]*editStacks
+
+	// Operations are applied in memory, then stored in batches, see flush
+	pending     []pendingOp // Applied but not yet stored, in revision order
+	storing     []pendingOp // The batch being stored, which comes before pending
+	stored      int         // Latest revision stored
+	flushMu     sync.Mutex  // Held while storing a batch, so batches are stored in order
+	commitDelay time.Duration
+	failed      error  // Why storing a batch failed, which closed the session
+	onFailure   func() // Called once storing a batch fails, when created by a Manager
+
+	latency       latencies     // Stages of the operations stored
+	slowOperation time.Duration // Operations taking longer are logged, unless 0
 
 	// Dependencies
 	store          storage.Store
 	permChecker    *acl.Checker
 	hub            *ws.Hub
+	webhooks       *webhook.Service
+	anchors        Anchors
 	snapshotPolicy *storage.SnapshotPolicy
+	recorder       Recorder
+	logger         *slog.Logger
 }
 
 // SessionConfig holds configuration for creating a session.
@@ -38,8 +82,52 @@ type SessionConfig struct {
 	Store          storage.Store
 	PermChecker    *acl.Checker
 	Hub            *ws.Hub
+	Webhooks       *webhook.Service // Optional: receives document.updated events
+	Anchors        Anchors          // Optional: moved past each operation stored
 	SnapshotPolicy *storage.SnapshotPolicy
 	HistorySize    int
+	FencingToken   uint64       // Optional: lease token sent with every write, see storage.WithFencingToken
+	Logger         *slog.Logger // Optional: defaults to slog.Default()
+	Recorder       Recorder     // Optional: records the session for replaying it
+
+	// CommitDelay is how long an operation waits for others to be stored
+	// with it. Operations applied while a batch is being stored form the
+	// next batch even without a delay.
+	CommitDelay time.Duration
+
+	// SlowOperation is how long an operation may take before it's logged
+	// with its stages, see Stages. Zero disables the log.
+	SlowOperation time.Duration
+}
+
+// view is an immutable copy of a session's state. A new one is published as
+// each operation is applied, so reading the state never waits for writers.
+type view struct {
+	runes    []rune // Shared with the ot.Document that produced it
+	revision int
+	words    int
+	closed   bool
+
+	once    sync.Once
+	content string // Built from runes on first use
+}
+
+// Content returns the document content.
+func (v *view) Content() string {
+	v.once.Do(func() { v.content = string(v.runes) })
+
+	return v.content
+}
+
+// pendingOp is an operation applied in memory and waiting to be stored.
+type pendingOp struct {
+	clientID string
+	userID   string
+	op       ot.SequencedOperation
+	done     chan error     // Receives the result once the operation's batch is stored
+	received time.Time      // When the operation reached the session
+	applied  time.Time      // When it was applied in memory
+	reverts  []ot.Operation // Revert the operation, applied in order, see storedDocument
 }
 
 // NewSession creates a new collaborative editing session.
@@ -49,19 +137,49 @@ func NewSession(cfg SessionConfig) *Session {
 		historySize = 100
 	}
 
-	return &Session{
+	logger := cfg.Logger
+	if logger == nil {
+		logger = logging.Component(nil, "collab")
+	}
+
+	s := &Session{
 		docID:          cfg.DocID,
 		document:       ot.NewDocument(""),
 		queue:          ot.NewQueue(historySize),
+		changed:        make(chan struct{}),
+		edits:          make(map[string]*editStacks),
+		token:          cfg.FencingToken,
+		commitDelay:    cfg.CommitDelay,
+		slowOperation:  cfg.SlowOperation,
 		store:          cfg.Store,
 		permChecker:    cfg.PermChecker,
 		hub:            cfg.Hub,
+		webhooks:       cfg.Webhooks,
+		anchors:        cfg.Anchors,
 		snapshotPolicy: cfg.SnapshotPolicy,
+		recorder:       cfg.Recorder,
+		logger:         logger.With(logging.DocID(cfg.DocID)),
 	}
+	s.updateView()
+
+	return s
+}
+
+// updateView publishes the current state to readers. Must be called with mu
+// held, or before the session is shared.
+func (s *Session) updateView() {
+	s.view.Store(&view{
+		runes:    s.document.Runes(),
+		revision: s.queue.Revision(),
+		words:    s.document.WordCount(),
+		closed:   s.closed,
+	})
 }
 
 // Load initializes the session by loading document state from storage.
-func (s *Session) Load() error {
+// It stops with the context's error if ctx is done before the document's
+// history has been replayed.
+func (s *Session) Load(ctx context.Context) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -71,56 +189,266 @@ func (s *Session) Load() error {
 
 	loader := storage.NewDocumentLoader(s.store)
 
-	result, err := loader.Load(s.docID, s.applyOp)
+	result, err := loader.Load(ctx, s.docID, applyOp)
+	if err != nil {
+		return err
+	}
+
+	meta, err := s.store.LoadMetadata(ctx, s.docID)
+	if err != nil {
+		return err
+	}
+
+	s.archived = !meta.ArchivedAt.IsZero()
+	s.document, err = ot.NewFormattedDocument(result.Content, result.Formatting)
 	if err != nil {
 		return err
 	}
 
-	s.document = ot.NewDocument(result.Content)
 	s.queue = ot.NewQueue(s.queue.HistorySize())
 	s.queue.SetRevision(result.Revision)
+	s.stored = result.Revision
+	s.updateView()
+
+	if err := s.restoreHandoff(ctx, result); err != nil {
+		return err
+	}
+
+	if s.recorder != nil {
+		s.recordLoad()
+	}
 
 	return nil
 }
 
-// applyOp applies a storage operation to content (used by DocumentLoader).
-func (s *Session) applyOp(content string, op storage.Operation) (string, error) {
-	doc := ot.NewDocument(content)
+// startRecording records the session from its current state on.
+func (s *Session) startRecording(recorder Recorder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	otOp := ot.Operation{
-		Type:     ot.OpType(op.Type),
-		Position: op.Position,
-		Char:     op.Char,
-	}
+	s.recorder = recorder
+	s.recordLoad()
+}
 
-	if err := doc.Apply(otOp); err != nil {
-		return "", err
+// recordLoad records the state the recording starts from. Must be called
+// with mu held.
+func (s *Session) recordLoad() {
+	s.recorder.RecordLoad(RecordedState{
+		DocID:       s.docID,
+		Content:     s.document.Content(),
+		Revision:    s.queue.Revision(),
+		HistorySize: s.queue.HistorySize(),
+		History:     s.queue.History(0),
+	})
+}
+
+// restoreHandoff restores the history handed over by the process that had
+// the session open before, so edits its clients based on older revisions
+// are still transformed. A handoff that doesn't match the stored document,
+// because it was edited since, is ignored. Must be called with mu held.
+func (s *Session) restoreHandoff(ctx context.Context, result storage.LoadResult) error {
+	handoff, err := s.store.TakeHandoff(ctx, s.docID)
+
+	switch {
+	case errors.Is(err, storage.ErrHandoffNotFound):
+		return nil
+	case err != nil:
+		return err
+	case handoff.Revision != result.Revision || handoff.Content != result.Content:
+		s.logger.WarnContext(ctx, "stale handoff ignored", logging.Revision(handoff.Revision))
+
+		return nil
 	}
 
-	return doc.Content(), nil
+	s.queue.SetHistory(handoff.History)
+
+	return nil
+}
+
+// applyOp applies a storage operation to a document (used by DocumentLoader).
+func applyOp(doc *ot.Document, op storage.Operation) error {
+	return doc.Apply(ot.Operation{
+		Type:      ot.OpType(op.Type),
+		Position:  op.Position,
+		Char:      op.Char,
+		Attribute: op.Attribute,
+		Value:     op.Value,
+	})
 }
 
 // ApplyOperation processes an operation from a client.
-// It checks permissions, applies OT, persists, and broadcasts.
+// It checks permissions, applies OT, persists, and broadcasts. It returns
+// once the operation is stored, which other operations applied meanwhile
+// share, see SessionConfig.CommitDelay.
+// Returns ErrDocumentArchived if the document was archived when the session loaded.
 func (s *Session) ApplyOperation(clientID, userID string, op ot.Operation, baseRevision int) (int, error) {
+	received := time.Now()
+
+	if err := s.checkWritePermission(userID); err != nil {
+		return 0, err
+	}
+
+	return s.commit(s.apply(clientID, userID, op, baseRevision, received))
+}
+
+// ApplyBatch processes a batch of operations from a client, like
+// ApplyOperation. The first operation is based on baseRevision and each of
+// the others on the one before it. Either all of them are applied, in order
+// and with consecutive revisions, or none is. It returns the revision of the
+// last one once they're stored.
+func (s *Session) ApplyBatch(clientID, userID string, ops []ot.Operation, baseRevision int) (int, error) {
+	received := time.Now()
+
+	if len(ops) == 0 {
+		return 0, ErrEmptyBatch
+	}
+
+	if err := s.checkWritePermission(userID); err != nil {
+		return 0, err
+	}
+
+	return s.commit(s.applyBatch(clientID, userID, ops, baseRevision, received))
+}
+
+// ApplyIfRevision applies the operations edit returns for the document's
+// content, like ApplyBatch, provided the document is at revision base. The
+// check and the edit happen under the session's lock, so no other edit can
+// come between them. If the document is at another revision, it returns
+// that revision with ErrRevisionMismatch. If edit returns no operations,
+// nothing is applied and it returns base.
+func (s *Session) ApplyIfRevision(
+	clientID, userID string, base int, edit func(content string) []ot.Operation,
+) (int, error) {
+	received := time.Now()
+
 	if err := s.checkWritePermission(userID); err != nil {
 		return 0, err
 	}
 
+	s.mu.Lock()
+
+	if err := s.checkWritable(); err != nil {
+		s.mu.Unlock()
+
+		return 0, err
+	}
+
+	if revision := s.queue.Revision(); revision != base {
+		s.mu.Unlock()
+
+		return revision, ErrRevisionMismatch
+	}
+
+	ops := edit(s.document.Content())
+	if len(ops) == 0 {
+		s.mu.Unlock()
+
+		return base, nil
+	}
+
+	seqOp, done, first, err := s.applyBatchLocked(clientID, userID, ops, base, received)
+	s.mu.Unlock()
+
+	return s.commit(seqOp, done, first, err)
+}
+
+// applyBatch transforms the batch and checks it applies before applying any
+// of it. Its operations all join the same batch to store, so the result of
+// storing the last is the result of storing them all.
+func (s *Session) applyBatch(
+	clientID, userID string, ops []ot.Operation, baseRevision int, received time.Time,
+) (ot.SequencedOperation, <-chan error, bool, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if s.closed {
-		return 0, ErrSessionClosed
+	return s.applyBatchLocked(clientID, userID, ops, baseRevision, received)
+}
+
+// applyBatchLocked is applyBatch for callers holding mu.
+func (s *Session) applyBatchLocked(
+	clientID, userID string, ops []ot.Operation, baseRevision int, received time.Time,
+) (ot.SequencedOperation, <-chan error, bool, error) {
+	if err := s.checkWritable(); err != nil {
+		return ot.SequencedOperation{}, nil, false, err
 	}
 
-	seqOp, err := s.applyAndPersist(op, baseRevision)
+	transformed, err := s.queue.TransformBatch(ops, baseRevision)
+	if err != nil {
+		return ot.SequencedOperation{}, nil, false, err
+	}
+
+	if err := checkPositions(s.document.Len(), transformed); err != nil {
+		return ot.SequencedOperation{}, nil, false, err
+	}
+
+	// Every operation was transformed against the ones applied since the base
+	behind := s.queue.Revision() - baseRevision
+
+	var (
+		seqOp ot.SequencedOperation
+		done  <-chan error
+		first bool
+	)
+
+	for i, op := range transformed {
+		var isFirst bool
+
+		// Already transformed, so based on the current revision
+		seqOp, done, isFirst, err = s.applyLocked(clientID, userID, op, s.queue.Revision(), received, editDirect)
+		if err != nil {
+			return ot.SequencedOperation{}, nil, false, err
+		}
+
+		s.recordChain(clientID, userID, behind)
+
+		if i == 0 {
+			first = isFirst
+		}
+	}
+
+	return seqOp, done, first, nil
+}
+
+// checkPositions returns ot.ErrInvalidPosition if any of the operations,
+// applied in order to content of the given length, targets a position
+// outside it.
+func checkPositions(length int, ops []ot.Operation) error {
+	for _, op := range ops {
+		switch {
+		case op.IsNoop():
+		case op.IsInsert() && op.Position <= length:
+			length += utf8.RuneCountInString(op.Char)
+		case op.IsDelete() && op.Position < length:
+			length--
+		case op.IsFormat() && op.Position < length:
+		default:
+			return ot.ErrInvalidPosition
+		}
+	}
+
+	return nil
+}
+
+// commit waits until an operation applied in memory is stored, storing its
+// batch first if the operation is the first of it.
+func (s *Session) commit(seqOp ot.SequencedOperation, done <-chan error, first bool, err error) (int, error) {
 	if err != nil {
 		return 0, err
 	}
 
-	s.maybeSnapshot()
-	s.broadcast(clientID, userID, seqOp)
+	// The first operation of a batch waits for others to join it, then
+	// stores them all
+	if first {
+		if s.commitDelay > 0 {
+			time.Sleep(s.commitDelay)
+		}
+
+		s.flush()
+	}
+
+	if err := <-done; err != nil {
+		return 0, err
+	}
 
 	return seqOp.Revision, nil
 }
@@ -134,22 +462,259 @@ func (s *Session) checkWritePermission(userID string) error {
 	return s.permChecker.RequirePermission(s.docID, userID, acl.ActionWrite)
 }
 
-// applyAndPersist applies OT transformation and persists the operation.
-func (s *Session) applyAndPersist(op ot.Operation, baseRevision int) (ot.SequencedOperation, error) {
+// apply applies OT transformation and queues the operation to be stored. It
+// returns the channel that receives the result of storing it, and whether
+// it's the first operation of its batch.
+func (s *Session) apply(
+	clientID, userID string, op ot.Operation, baseRevision int, received time.Time,
+) (ot.SequencedOperation, <-chan error, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkWritable(); err != nil {
+		return ot.SequencedOperation{}, nil, false, err
+	}
+
+	// The operation is transformed against every one applied since its base
+	behind := s.queue.Revision() - baseRevision
+
+	seqOp, done, first, err := s.applyLocked(clientID, userID, op, baseRevision, received, editDirect)
+	if err != nil {
+		return ot.SequencedOperation{}, nil, false, err
+	}
+
+	s.recordChain(clientID, userID, behind)
+
+	return seqOp, done, first, nil
+}
+
+// checkWritable returns why the session can't take operations, if it can't.
+// Must be called with mu held.
+func (s *Session) checkWritable() error {
+	if s.closed {
+		return ErrSessionClosed
+	}
+
+	if s.archived {
+		return ErrDocumentArchived
+	}
+
+	return nil
+}
+
+// applyLocked is apply for callers holding mu. kind tells which of the
+// user's stacks the operation reverting it goes on, see recordEdit.
+func (s *Session) applyLocked(
+	clientID, userID string, op ot.Operation, baseRevision int, received time.Time, kind editKind,
+) (ot.SequencedOperation, <-chan error, bool, error) {
+	var (
+		inverse    ot.Operation
+		revertible bool
+		reverts    []ot.Operation
+	)
+
 	seqOp, err := s.queue.Apply(op, baseRevision)
+	if err == nil {
+		inverse, revertible = s.invert(seqOp.Operation)
+		reverts = s.reverts(seqOp.Operation, inverse, revertible)
+		err = s.document.Apply(seqOp.Operation)
+	}
+
+	if s.recorder != nil {
+		s.recorder.RecordOperation(clientID, userID, op, baseRevision, seqOp, err)
+	}
+
 	if err != nil {
-		return ot.SequencedOperation{}, err
+		return ot.SequencedOperation{}, nil, false, err
+	}
+
+	s.updateView()
+	s.logger.Debug("operation applied",
+		logging.ClientID(clientID), logging.UserID(userID), logging.Revision(seqOp.Revision),
+		"base_revision", baseRevision)
+
+	if revertible {
+		s.recordEdit(userID, kind, revertEntry{op: inverse, revision: seqOp.Revision})
 	}
 
-	if err := s.document.Apply(seqOp.Operation); err != nil {
-		return ot.SequencedOperation{}, err
+	done := make(chan error, 1)
+	s.pending = append(s.pending, pendingOp{
+		clientID: clientID, userID: userID, op: seqOp, done: done, received: received, applied: time.Now(),
+		reverts: reverts,
+	})
+
+	return seqOp, done, len(s.pending) == 1, nil
+}
+
+// reverts returns the operations reverting op, given the inverse invert
+// found for it. Unlike the inverse, which goes on the user's undo stack, they
+// always exist: a longer insert is reverted by deleting each character, and
+// a deleted character is formatted again once it's reinserted. Must be
+// called with mu held, before op is applied.
+func (s *Session) reverts(op, inverse ot.Operation, revertible bool) []ot.Operation {
+	if revertible && op.IsDelete() {
+		attrs := s.document.AttributesAt(op.Position)
+		reverts := []ot.Operation{inverse}
+
+		for _, name := range slices.Sorted(maps.Keys(attrs)) {
+			reverts = append(reverts, ot.NewFormat(op.Position, name, attrs[name], op.UserID))
+		}
+
+		return reverts
 	}
 
-	if err := s.store.AppendOperation(s.docID, seqOp); err != nil {
-		return ot.SequencedOperation{}, err
+	if revertible {
+		return []ot.Operation{inverse}
 	}
 
-	return seqOp, nil
+	if !op.IsInsert() || op.IsNoop() {
+		return nil
+	}
+
+	reverts := make([]ot.Operation, utf8.RuneCountInString(op.Char))
+	for i := range reverts {
+		reverts[i] = ot.NewDelete(op.Position, op.UserID)
+	}
+
+	return reverts
+}
+
+// flush stores the pending operations in one write. Once they're stored it
+// counts them, snapshots if one is due and broadcasts them, in revision
+// order, before answering their callers. If storing them fails, the session
+// fails, see fail.
+func (s *Session) flush() {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	batch := s.pending
+	s.pending = nil
+	s.storing = batch
+	s.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	// Callers are answered even if the store panics
+	err := errNotStored
+
+	defer func() {
+		for _, p := range batch {
+			p.done <- err
+		}
+	}()
+
+	ops := make([]ot.SequencedOperation, len(batch))
+	for i, p := range batch {
+		ops[i] = p.op
+	}
+
+	// The operations are already applied in memory, so storing them isn't
+	// tied to a caller that may go away
+	if err = s.store.AppendOperations(s.fenced(context.Background()), s.docID, ops); err != nil {
+		s.logger.Error("failed to store operations",
+			logging.Revision(ops[0].Revision), "last_revision", ops[len(ops)-1].Revision, logging.Err(err))
+		s.fail(err)
+
+		return
+	}
+
+	stored := time.Now()
+
+	s.mu.Lock()
+
+	// Snapshots cover the batch, but not operations applied since
+	s.stored = ops[len(ops)-1].Revision
+	s.storing = nil
+
+	for range batch {
+		s.recordOperation()
+		s.maybeSnapshot()
+	}
+
+	s.notifyChanged()
+	s.mu.Unlock()
+
+	for _, p := range batch {
+		s.broadcast(p.clientID, p.userID, p.op)
+		s.publish(p.userID, p.op)
+		s.transformAnchors(p.op)
+		s.recordLatency(p, Stages{
+			Transform: p.applied.Sub(p.received),
+			Persist:   stored.Sub(p.applied),
+			Broadcast: time.Since(stored),
+		})
+	}
+}
+
+// fail closes the session once storing a batch failed with err. Its clients
+// saw the batch applied, but it may never be stored, so rather than carry on
+// from a state storage doesn't have, the session stops taking operations,
+// answers those applied after the batch with err and leaves it to its
+// Manager, if any, to disconnect the clients so they resync from storage.
+func (s *Session) fail(err error) {
+	s.mu.Lock()
+	later := s.pending
+	s.pending = nil
+	s.storing = nil
+	s.failed = err
+	s.closed = true
+	s.updateView()
+	s.notifyChanged()
+	s.mu.Unlock()
+
+	for _, p := range later {
+		p.done <- err
+	}
+
+	if s.onFailure != nil {
+		s.onFailure()
+	}
+}
+
+// recordLatency records how long a stored operation took, logging it if it
+// was slow.
+func (s *Session) recordLatency(p pendingOp, stages Stages) {
+	s.latency.record(stages)
+
+	if s.slowOperation > 0 && stages.Total() >= s.slowOperation {
+		s.logger.Warn("slow operation",
+			logging.ClientID(p.clientID), logging.UserID(p.userID), logging.Revision(p.op.Revision),
+			"transform", stages.Transform, "persist", stages.Persist, "broadcast", stages.Broadcast,
+			"total", stages.Total())
+	}
+}
+
+// recordOperation counts an applied operation towards the session's rate and
+// the server-wide rate.
+func (s *Session) recordOperation() {
+	now := time.Now()
+	s.rate.record(now)
+
+	if s.total != nil {
+		s.total.record(now)
+	}
+
+	if s.counters != nil {
+		s.counters.ops.Add(1)
+	}
+}
+
+// recordChain counts the length of an operation's transform chain, and
+// reports clients that are falling far enough behind to risk their
+// operations being rejected with ot.ErrRevisionTooOld. Must be called with
+// mu held.
+func (s *Session) recordChain(clientID, userID string, length int) {
+	if s.counters != nil {
+		s.counters.recordChain(length)
+	}
+
+	if historySize := s.queue.HistorySize(); length > historySize/2 {
+		s.logger.Warn("client far behind",
+			logging.ClientID(clientID), logging.UserID(userID), "behind", length, "history_size", historySize)
+	}
 }
 
 // maybeSnapshot checks if a snapshot should be created and does so.
@@ -159,31 +724,99 @@ func (s *Session) maybeSnapshot() {
 	}
 
 	if s.snapshotPolicy.RecordOperation(s.docID) {
-		_ = s.saveSnapshot() // Log but don't fail
+		// The operation is already stored, so a failed snapshot only costs replay time
+		if err := s.saveSnapshot(context.Background()); err != nil {
+			s.logger.Error("automatic snapshot failed", logging.Err(err))
+		}
+
 		s.snapshotPolicy.Reset(s.docID)
 	}
 }
 
+// notifyChanged wakes callers waiting in Changes. Must be called with mu held.
+func (s *Session) notifyChanged() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
 // broadcast sends the operation to other connected clients.
 func (s *Session) broadcast(clientID, userID string, seqOp ot.SequencedOperation) {
 	if s.hub == nil {
 		return
 	}
 
-	s.hub.BroadcastOperation(
-		s.docID,
-		seqOp.Revision,
-		int(seqOp.Type),
-		seqOp.Position,
-		seqOp.Char,
-		userID,
-		clientID,
-	)
+	s.hub.BroadcastOperation(s.docID, seqOp, userID, clientID)
+}
+
+// publish notifies webhooks that the document changed.
+func (s *Session) publish(userID string, seqOp ot.SequencedOperation) {
+	if s.webhooks == nil {
+		return
+	}
+
+	s.webhooks.Publish(webhook.Event{
+		Type:     webhook.EventDocumentUpdated,
+		DocID:    s.docID,
+		Revision: seqOp.Revision,
+		UserID:   userID,
+	})
+}
+
+// transformAnchors moves the session's anchors past a stored operation.
+func (s *Session) transformAnchors(seqOp ot.SequencedOperation) {
+	if s.anchors == nil {
+		return
+	}
+
+	if err := s.anchors.Transform(s.docID, seqOp); err != nil {
+		s.logger.Warn("failed to transform anchors", logging.Revision(seqOp.Revision), logging.Err(err))
+	}
+}
+
+// saveSnapshot persists a snapshot of the stored document state. Must be
+// called with mu held.
+func (s *Session) saveSnapshot(ctx context.Context) error {
+	doc, err := s.storedDocument()
+	if err == nil {
+		err = s.store.SaveFormattedSnapshot(s.fenced(ctx), s.docID, s.stored, doc.Content(), doc.Marks())
+	}
+
+	if err != nil && s.counters != nil {
+		s.counters.snapshotFailures.Add(1)
+	}
+
+	return err
+}
+
+// storedDocument returns the document as of the latest revision stored, by
+// reverting the operations that aren't stored yet. Must be called with mu
+// held.
+func (s *Session) storedDocument() (*ot.Document, error) {
+	unstored := slices.Concat(s.storing, s.pending)
+	if len(unstored) == 0 {
+		return s.document, nil
+	}
+
+	doc := s.document.Clone()
+
+	for _, p := range slices.Backward(unstored) {
+		for _, op := range p.reverts {
+			if err := doc.Apply(op); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return doc, nil
 }
 
-// saveSnapshot persists a snapshot of the current document state.
-func (s *Session) saveSnapshot() error {
-	return s.store.SaveSnapshot(s.docID, s.queue.Revision(), s.document.Content())
+// fenced attaches the session's fencing token, if any, to ctx for writes.
+func (s *Session) fenced(ctx context.Context) context.Context {
+	if s.token == 0 {
+		return ctx
+	}
+
+	return storage.WithFencingToken(ctx, s.token)
 }
 
 // GetState returns the current document state.
@@ -196,14 +829,337 @@ func (s *Session) GetState(userID string) (string, int, error) {
 		}
 	}
 
+	v := s.view.Load()
+	if v.closed {
+		return "", 0, ErrSessionClosed
+	}
+
+	return v.Content(), v.revision, nil
+}
+
+// GetFormattedState returns the current document state with the runs of
+// formatted characters in it, nil if it's plain text.
+// It checks read permission before returning.
+func (s *Session) GetFormattedState(userID string) (string, []ot.Mark, int, error) {
+	if s.permChecker != nil {
+		if err := s.permChecker.RequirePermission(s.docID, userID, acl.ActionRead); err != nil {
+			return "", nil, 0, err
+		}
+	}
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	if s.closed {
-		return "", 0, ErrSessionClosed
+		return "", nil, 0, ErrSessionClosed
+	}
+
+	return s.document.Content(), s.document.Marks(), s.queue.Revision(), nil
+}
+
+// DocumentStats holds document counts that are maintained incrementally as
+// operations are applied, so reading them doesn't scan the content.
+type DocumentStats struct {
+	Revision   int
+	Characters int
+	Words      int
+}
+
+// DocumentStats returns the document's current counts.
+// It checks read permission before returning.
+func (s *Session) DocumentStats(userID string) (DocumentStats, error) {
+	if s.permChecker != nil {
+		if err := s.permChecker.RequirePermission(s.docID, userID, acl.ActionRead); err != nil {
+			return DocumentStats{}, err
+		}
+	}
+
+	v := s.view.Load()
+	if v.closed {
+		return DocumentStats{}, ErrSessionClosed
+	}
+
+	return DocumentStats{
+		Revision:   v.revision,
+		Characters: len(v.runes),
+		Words:      v.words,
+	}, nil
+}
+
+// GetStateAt returns the document content as of a past revision.
+// It checks read permission and reconstructs the content from storage.
+func (s *Session) GetStateAt(ctx context.Context, userID string, revision int) (string, error) {
+	if s.permChecker != nil {
+		if err := s.permChecker.RequirePermission(s.docID, userID, acl.ActionRead); err != nil {
+			return "", err
+		}
+	}
+
+	v := s.view.Load()
+	if v.closed {
+		return "", ErrSessionClosed
+	}
+
+	// Serve the head revision from memory
+	if revision == v.revision {
+		return v.Content(), nil
+	}
+
+	loader := storage.NewDocumentLoader(s.store)
+
+	result, err := loader.LoadAt(ctx, s.docID, revision, applyOp)
+	if err != nil {
+		return "", err
+	}
+
+	return result.Content, nil
+}
+
+// Changes returns the operations applied after sinceRevision, together with
+// the current revision. If there are none yet, it waits until an operation
+// is applied or ctx is done, in which case it returns no operations.
+// It checks read permission first. Returns storage.ErrRevisionNotFound if
+// sinceRevision is ahead of the document, storage.ErrRevisionCompacted if
+// operations after it were pruned by a snapshot, and ErrSessionClosed if the
+// session closes while waiting.
+func (s *Session) Changes(ctx context.Context, userID string, sinceRevision int) ([]ot.SequencedOperation, int, error) {
+	if s.permChecker != nil {
+		if err := s.permChecker.RequirePermission(s.docID, userID, acl.ActionRead); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	for {
+		ops, revision, changed, err := s.changesSince(ctx, sinceRevision)
+		if err != nil || len(ops) > 0 {
+			return ops, revision, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, revision, nil
+		case <-changed:
+		}
+	}
+}
+
+// OperationsSince returns the operations applied after sinceRevision and
+// the current revision, without waiting for more. Unlike Changes, it
+// includes operations that aren't stored yet. Recent operations come from
+// memory and older ones from storage.
+// It checks read permission first. Returns storage.ErrRevisionNotFound if
+// sinceRevision is ahead of the document, and storage.ErrRevisionCompacted
+// if the operations after it are neither in memory nor in storage.
+func (s *Session) OperationsSince(
+	ctx context.Context, userID string, sinceRevision int,
+) ([]ot.SequencedOperation, int, error) {
+	if s.permChecker != nil {
+		if err := s.permChecker.RequirePermission(s.docID, userID, acl.ActionRead); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil, 0, ErrSessionClosed
+	}
+
+	revision := s.queue.Revision()
+
+	switch {
+	case sinceRevision < 0 || sinceRevision > revision:
+		return nil, 0, storage.ErrRevisionNotFound
+	case sinceRevision == revision:
+		return nil, revision, nil
+	}
+
+	history := s.queue.History(sinceRevision)
+	if len(history) > 0 && history[0].Revision == sinceRevision+1 {
+		return history, revision, nil
+	}
+
+	// Older operations are read from storage. If the history pruned some
+	// that aren't stored yet, neither has them all
+	ops, err := s.store.LoadOperations(ctx, s.docID, sinceRevision)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(history) > 0 {
+		ops = slices.DeleteFunc(ops, func(op ot.SequencedOperation) bool { return op.Revision >= history[0].Revision })
 	}
 
-	return s.document.Content(), s.queue.Revision(), nil
+	ops = append(ops, history...)
+	if len(ops) != revision-sinceRevision || ops[0].Revision != sinceRevision+1 {
+		return nil, 0, storage.ErrRevisionCompacted
+	}
+
+	return ops, revision, nil
+}
+
+// RebasePositions moves positions in the document as of revision past the
+// operations applied since, and returns them with the revision they now
+// refer to. An insert at a position pushes it only if userID made it, so
+// a user's caret follows what they type.
+// It checks read permission first. Returns storage.ErrRevisionNotFound if
+// revision is ahead of the document and ot.ErrRevisionTooOld if the
+// operations since it are no longer in memory.
+func (s *Session) RebasePositions(userID string, revision int, positions ...int) ([]int, int, error) {
+	if s.permChecker != nil {
+		if err := s.permChecker.RequirePermission(s.docID, userID, acl.ActionRead); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil, 0, ErrSessionClosed
+	}
+
+	current := s.queue.Revision()
+	if revision < 0 || revision > current {
+		return nil, 0, storage.ErrRevisionNotFound
+	}
+
+	if revision == current {
+		return positions, current, nil
+	}
+
+	ops := s.queue.History(revision)
+	if len(ops) == 0 || ops[0].Revision != revision+1 {
+		return nil, 0, ot.ErrRevisionTooOld
+	}
+
+	rebased := slices.Clone(positions)
+
+	for _, op := range ops {
+		for i, position := range rebased {
+			rebased[i] = ot.TransformPosition(position, op.Operation, op.UserID == userID)
+		}
+	}
+
+	return rebased, current, nil
+}
+
+// changesSince returns the operations after sinceRevision, or, when there
+// are none, a channel that is closed once there might be.
+func (s *Session) changesSince(
+	ctx context.Context, sinceRevision int,
+) ([]ot.SequencedOperation, int, <-chan struct{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil, 0, nil, ErrSessionClosed
+	}
+
+	// Operations are only returned once they're stored
+	revision := s.stored
+
+	switch {
+	case sinceRevision < 0 || sinceRevision > s.queue.Revision():
+		return nil, 0, nil, storage.ErrRevisionNotFound
+	case sinceRevision >= revision:
+		return nil, revision, s.changed, nil
+	}
+
+	// Recent operations are still in memory, even if a snapshot pruned them
+	// from storage
+	if ops := s.queue.History(sinceRevision); len(ops) > 0 && ops[0].Revision == sinceRevision+1 {
+		return ops[:revision-sinceRevision], revision, nil, nil
+	}
+
+	ops, err := s.store.LoadOperations(ctx, s.docID, sinceRevision)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	if len(ops) == 0 || ops[0].Revision != sinceRevision+1 {
+		return nil, 0, nil, storage.ErrRevisionCompacted
+	}
+
+	// A batch being stored may already be in the log
+	return ops[:min(len(ops), revision-sinceRevision)], revision, nil, nil
+}
+
+// Sizes on 64-bit platforms, for estimating a session's memory use.
+const (
+	runeSize          = 4  // A character of content, which is held as runes
+	operationOverhead = 56 // An ot.SequencedOperation, excluding its string data
+	pendingOverhead   = 48 // The rest of a pendingOp, excluding its string data
+)
+
+// SessionStats describes the current size of a session.
+type SessionStats struct {
+	DocID        string
+	Revision     int
+	HistoryOps   int     // Operations retained for transforming stale clients
+	MemoryBytes  int     // Estimated size of the content, history and pending operations
+	ContentBytes int     // Estimated size of the content
+	HistoryBytes int     // Estimated size of the retained history
+	PendingBytes int     // Estimated size of the operations waiting to be stored
+	OpsPerSecond float64 // Operations applied, averaged over the last minute
+	Latency      Latency // Stages of the operations stored since the session opened
+}
+
+// Stats returns the session's revision and estimated memory use.
+func (s *Session) Stats() SessionStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	v := s.view.Load()
+	history := s.queue.History(0)
+
+	stats := SessionStats{
+		DocID:        s.docID,
+		Revision:     v.revision,
+		HistoryOps:   len(history),
+		ContentBytes: runeSize * len(v.runes),
+		OpsPerSecond: s.rate.perSecond(time.Now()),
+		Latency:      s.latency.summary(),
+	}
+
+	for _, op := range history {
+		stats.HistoryBytes += operationSize(op)
+	}
+
+	for _, p := range s.pending {
+		stats.PendingBytes += pendingOverhead + operationSize(p.op) + len(p.clientID) + len(p.userID)
+	}
+
+	stats.MemoryBytes = stats.ContentBytes + stats.HistoryBytes + stats.PendingBytes
+
+	return stats
+}
+
+// operationSize estimates the memory held by an operation.
+func operationSize(op ot.SequencedOperation) int {
+	return operationOverhead + len(op.Char) + len(op.UserID)
+}
+
+// Snapshot saves a snapshot of the stored state immediately. Operations that
+// aren't stored yet are left for a later snapshot.
+func (s *Session) Snapshot(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrSessionClosed
+	}
+
+	if err := s.saveSnapshot(ctx); err != nil {
+		return err
+	}
+
+	if s.snapshotPolicy != nil {
+		s.snapshotPolicy.Reset(s.docID)
+	}
+
+	return nil
 }
 
 // DocID returns the document ID for this session.
@@ -211,25 +1167,73 @@ func (s *Session) DocID() string {
 	return s.docID
 }
 
-// Revision returns the current revision number.
-func (s *Session) Revision() int {
+// Archived returns true if the document was archived when the session loaded.
+func (s *Session) Archived() bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	return s.queue.Revision()
+	return s.archived
 }
 
-// Close closes the session and saves a final snapshot.
+// Revision returns the current revision number.
+func (s *Session) Revision() int {
+	return s.view.Load().revision
+}
+
+// Close closes the session and saves a final snapshot. It returns the error
+// storing operations failed with, if it did, in which case no snapshot is
+// saved.
 func (s *Session) Close() error {
+	return s.close(false)
+}
+
+// HandOff closes the session like Close, and also saves its recent history
+// for the next process to open the document, see storage.Handoff.
+func (s *Session) HandOff() error {
+	return s.close(true)
+}
+
+func (s *Session) close(handoff bool) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
 
 	if s.closed {
-		return nil
+		s.mu.Unlock()
+
+		return s.failed
 	}
 
 	s.closed = true
+	s.updateView()
+	s.mu.Unlock()
+
+	// Store the operations applied before closing, so the final snapshot
+	// doesn't get ahead of the log
+	s.flush()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Neither the snapshot nor the handoff may cover operations that weren't
+	// stored
+	if s.failed != nil {
+		return s.failed
+	}
+
+	s.notifyChanged()
+
+	if s.recorder != nil {
+		s.recorder.RecordClose(s.document.Content(), s.queue.Revision())
+	}
 
 	// Save final snapshot
-	return s.saveSnapshot()
+	if err := s.saveSnapshot(context.Background()); err != nil || !handoff {
+		return err
+	}
+
+	return s.store.SaveHandoff(s.fenced(context.Background()), storage.Handoff{
+		DocID:    s.docID,
+		Revision: s.queue.Revision(),
+		Content:  s.document.Content(),
+		History:  s.queue.History(0),
+	})
 }
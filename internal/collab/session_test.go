@@ -1,13 +1,24 @@
 package collab_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/serroba/online-docs/internal/acl"
 	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/comment"
+	"github.com/serroba/online-docs/internal/logging"
 	"github.com/serroba/online-docs/internal/ot"
 	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/webhook"
 	"github.com/serroba/online-docs/internal/ws"
 	"github.com/stretchr/testify/require"
 )
@@ -16,14 +27,14 @@ func TestSession_ApplyOperation(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	session := collab.NewSession(collab.SessionConfig{
 		DocID: "doc1",
 		Store: store,
 	})
 
-	require.NoError(t, session.Load())
+	require.NoError(t, session.Load(t.Context()))
 
 	// Apply an insert operation
 	rev, err := session.ApplyOperation("client1", "user1", ot.NewInsert("H", 0, "user1"), 0)
@@ -45,18 +56,240 @@ func TestSession_ApplyOperation(t *testing.T) {
 	}
 }
 
+// blockingAppendStore is a MemoryStore that records the size of every batch
+// of operations appended, and holds the first until release is closed.
+type blockingAppendStore struct {
+	*storage.MemoryStore
+
+	release chan struct{}
+
+	mu      sync.Mutex
+	batches []int
+}
+
+func (s *blockingAppendStore) AppendOperations(ctx context.Context, docID string, ops []ot.SequencedOperation) error {
+	s.mu.Lock()
+	s.batches = append(s.batches, len(ops))
+	first := len(s.batches) == 1
+	s.mu.Unlock()
+
+	if first {
+		<-s.release
+	}
+
+	return s.MemoryStore.AppendOperations(ctx, docID, ops)
+}
+
+func TestSession_ApplyOperation_GroupCommit(t *testing.T) {
+	t.Parallel()
+
+	store := &blockingAppendStore{MemoryStore: storage.NewMemoryStore(), release: make(chan struct{})}
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	session := collab.NewSession(collab.SessionConfig{DocID: "doc1", Store: store})
+	require.NoError(t, session.Load(t.Context()))
+
+	var wg sync.WaitGroup
+
+	errs := make(chan error, 4)
+
+	for range 4 {
+		wg.Go(func() {
+			_, err := session.ApplyOperation("c1", "u1", ot.NewInsert("a", 0, "u1"), 0)
+			errs <- err
+		})
+	}
+
+	// The operations applied while the first is being stored wait for it
+	require.Eventually(t, func() bool { return session.Revision() == 4 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+
+	ops, revision, err := session.Changes(ctx, "u1", 0)
+	require.NoError(t, err)
+	require.Empty(t, ops, "operations are returned before they're stored")
+	require.Zero(t, revision)
+	require.NotZero(t, session.Stats().PendingBytes)
+
+	close(store.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	// The rest are stored together
+	require.Equal(t, []int{1, 3}, store.batches)
+
+	ops, err = store.LoadOperations(t.Context(), "doc1", 0)
+	require.NoError(t, err)
+	require.Len(t, ops, 4)
+
+	ops, revision, err = session.Changes(t.Context(), "u1", 0)
+	require.NoError(t, err)
+	require.Len(t, ops, 4)
+	require.Equal(t, 4, revision)
+}
+
+func TestSession_ApplyBatch(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	session := collab.NewSession(collab.SessionConfig{DocID: "doc1", Store: store})
+	require.NoError(t, session.Load(t.Context()))
+
+	_, err := session.ApplyOperation("c1", "alice", ot.NewInsert("a", 0, "alice"), 0)
+	require.NoError(t, err)
+
+	// Bob types "xy" and deletes the "x", without having seen Alice's "a"
+	batch := []ot.Operation{ot.NewInsert("x", 0, "bob"), ot.NewInsert("y", 1, "bob"), ot.NewDelete(0, "bob")}
+
+	rev, err := session.ApplyBatch("c2", "bob", batch, 0)
+	require.NoError(t, err)
+	require.Equal(t, 4, rev)
+
+	content, _, err := session.GetState("bob")
+	require.NoError(t, err)
+	require.Equal(t, "ay", content)
+
+	ops, err := store.LoadOperations(t.Context(), "doc1", 1)
+	require.NoError(t, err)
+	require.Len(t, ops, 3)
+
+	// A batch that doesn't apply leaves the document as it was
+	_, err = session.ApplyBatch("c2", "bob", []ot.Operation{ot.NewInsert("z", 2, "bob"), ot.NewDelete(3, "bob")}, 4)
+	require.ErrorIs(t, err, ot.ErrInvalidPosition)
+
+	_, err = session.ApplyBatch("c2", "bob", nil, 4)
+	require.ErrorIs(t, err, collab.ErrEmptyBatch)
+
+	content, revision, err := session.GetState("bob")
+	require.NoError(t, err)
+	require.Equal(t, "ay", content)
+	require.Equal(t, 4, revision)
+}
+
+func TestSession_ApplyBatch_FormatRange(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	session := collab.NewSession(collab.SessionConfig{DocID: "doc1", Store: store})
+	require.NoError(t, session.Load(t.Context()))
+
+	insert := []ot.Operation{ot.NewInsert("a", 0, "alice"), ot.NewInsert("b", 1, "alice")}
+
+	_, err := session.ApplyBatch("c1", "alice", insert, 0)
+	require.NoError(t, err)
+
+	rev, err := session.ApplyBatch("c1", "alice", ot.NewFormatRange(0, 2, "bold", "true", "alice"), 2)
+	require.NoError(t, err)
+	require.Equal(t, 4, rev)
+
+	content, marks, _, err := session.GetFormattedState("alice")
+	require.NoError(t, err)
+	require.Equal(t, "ab", content)
+	require.Equal(t, []ot.Mark{{Start: 0, End: 2, Attributes: ot.Attributes{"bold": "true"}}}, marks)
+
+	// A range past the end of the content is rejected
+	_, err = session.ApplyBatch("c1", "alice", ot.NewFormatRange(1, 2, "italic", "true", "alice"), 4)
+	require.ErrorIs(t, err, ot.ErrInvalidPosition)
+}
+
+func TestSession_ApplyIfRevision(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	session := collab.NewSession(collab.SessionConfig{DocID: "doc1", Store: store})
+	require.NoError(t, session.Load(t.Context()))
+
+	replace := func(content string) func(string) []ot.Operation {
+		return func(current string) []ot.Operation { return ot.Diff(current, content, "alice") }
+	}
+
+	rev, err := session.ApplyIfRevision("", "alice", 0, replace("hi"))
+	require.NoError(t, err)
+	require.Equal(t, 2, rev)
+
+	// An edit based on another revision is refused with the current one
+	rev, err = session.ApplyIfRevision("", "alice", 0, func(string) []ot.Operation {
+		require.Fail(t, "edit called at the wrong revision")
+
+		return nil
+	})
+	require.ErrorIs(t, err, collab.ErrRevisionMismatch)
+	require.Equal(t, 2, rev)
+
+	// No operations, no new revision
+	rev, err = session.ApplyIfRevision("", "alice", 2, replace("hi"))
+	require.NoError(t, err)
+	require.Equal(t, 2, rev)
+
+	// An edit made meanwhile waits for the checked edit, then follows it
+	concurrent := make(chan error, 1)
+
+	rev, err = session.ApplyIfRevision("", "alice", 2, func(current string) []ot.Operation {
+		go func() {
+			_, err := session.ApplyOperation("c2", "bob", ot.NewInsert("!", 2, "bob"), 2)
+			concurrent <- err
+		}()
+
+		return ot.Diff(current, "oh hi", "alice")
+	})
+	require.NoError(t, err)
+	require.Equal(t, 5, rev)
+	require.NoError(t, <-concurrent)
+
+	content, revision, err := session.GetState("alice")
+	require.NoError(t, err)
+	require.Equal(t, "oh hi!", content)
+	require.Equal(t, 6, revision)
+}
+
+func TestSession_FencingToken(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	stale := collab.NewSession(collab.SessionConfig{DocID: "doc1", Store: store, FencingToken: 1})
+	require.NoError(t, stale.Load(t.Context()))
+
+	current := collab.NewSession(collab.SessionConfig{DocID: "doc1", Store: store, FencingToken: 2})
+	require.NoError(t, current.Load(t.Context()))
+
+	_, err := current.ApplyOperation("c1", "u1", ot.NewInsert("a", 0, "u1"), 0)
+	require.NoError(t, err)
+
+	// The session whose lease was taken over can no longer write, and
+	// closes once an edit fails to be stored
+	require.ErrorIs(t, stale.Snapshot(t.Context()), storage.ErrFenced)
+
+	_, err = stale.ApplyOperation("c2", "u1", ot.NewInsert("b", 0, "u1"), 0)
+	require.ErrorIs(t, err, storage.ErrFenced)
+	require.ErrorIs(t, stale.Snapshot(t.Context()), collab.ErrSessionClosed)
+	require.NoError(t, current.Snapshot(t.Context()))
+}
+
 func TestSession_ApplyOperation_MultipleOps(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	session := collab.NewSession(collab.SessionConfig{
 		DocID: "doc1",
 		Store: store,
 	})
 
-	require.NoError(t, session.Load())
+	require.NoError(t, session.Load(t.Context()))
 
 	// Build "HI"
 	_, err := session.ApplyOperation("c1", "u1", ot.NewInsert("H", 0, "u1"), 0)
@@ -81,7 +314,7 @@ func TestSession_ApplyOperation_WithPermissions(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	permStore := acl.NewMemoryStore()
 	require.NoError(t, permStore.Grant("doc1", "editor", acl.Editor))
@@ -93,7 +326,7 @@ func TestSession_ApplyOperation_WithPermissions(t *testing.T) {
 		PermChecker: acl.NewChecker(permStore),
 	})
 
-	require.NoError(t, session.Load())
+	require.NoError(t, session.Load(t.Context()))
 
 	// Editor should succeed
 	_, err := session.ApplyOperation("c1", "editor", ot.NewInsert("A", 0, "editor"), 0)
@@ -106,11 +339,74 @@ func TestSession_ApplyOperation_WithPermissions(t *testing.T) {
 	}
 }
 
+// blockingSnapshotStore is a MemoryStore whose SaveFormattedSnapshot signals
+// started, then waits until release is closed.
+type blockingSnapshotStore struct {
+	*storage.MemoryStore
+
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s blockingSnapshotStore) SaveFormattedSnapshot(
+	ctx context.Context, docID string, revision int, content string, formatting []ot.Mark,
+) error {
+	select {
+	case s.started <- struct{}{}:
+	default:
+	}
+
+	<-s.release
+
+	return s.MemoryStore.SaveFormattedSnapshot(ctx, docID, revision, content, formatting)
+}
+
+func TestSession_GetState_DuringWrite(t *testing.T) {
+	t.Parallel()
+
+	store := blockingSnapshotStore{
+		MemoryStore: storage.NewMemoryStore(),
+		started:     make(chan struct{}, 1),
+		release:     make(chan struct{}),
+	}
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	session := collab.NewSession(collab.SessionConfig{DocID: "doc1", Store: store})
+	require.NoError(t, session.Load(t.Context()))
+
+	_, err := session.ApplyOperation("c1", "u1", ot.NewInsert("a", 0, "u1"), 0)
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+
+	go func() { done <- session.Snapshot(t.Context()) }()
+
+	<-store.started
+
+	// The snapshot holds the session's lock, but reads don't need it
+	content, revision, err := session.GetState("u1")
+	require.NoError(t, err)
+	require.Equal(t, "a", content)
+	require.Equal(t, 1, revision)
+
+	stats, err := session.DocumentStats("u1")
+	require.NoError(t, err)
+	require.Equal(t, collab.DocumentStats{Revision: 1, Characters: 1, Words: 1}, stats)
+
+	close(store.release)
+	require.NoError(t, <-done)
+
+	require.NoError(t, session.Close())
+
+	_, _, err = session.GetState("u1")
+	require.ErrorIs(t, err, collab.ErrSessionClosed)
+}
+
 func TestSession_GetState_WithPermissions(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	permStore := acl.NewMemoryStore()
 	require.NoError(t, permStore.Grant("doc1", "viewer", acl.Viewer))
@@ -121,7 +417,7 @@ func TestSession_GetState_WithPermissions(t *testing.T) {
 		PermChecker: acl.NewChecker(permStore),
 	})
 
-	require.NoError(t, session.Load())
+	require.NoError(t, session.Load(t.Context()))
 
 	// Viewer should be able to read
 	_, _, err := session.GetState("viewer")
@@ -134,19 +430,53 @@ func TestSession_GetState_WithPermissions(t *testing.T) {
 	}
 }
 
+func TestSession_DocumentStats(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.SaveSnapshot(t.Context(), "doc1", 0, "one two"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "editor", acl.Editor))
+
+	session := collab.NewSession(collab.SessionConfig{
+		DocID:       "doc1",
+		Store:       store,
+		PermChecker: acl.NewChecker(permStore),
+	})
+
+	require.NoError(t, session.Load(t.Context()))
+
+	_, err := session.ApplyOperation("c1", "editor", ot.NewInsert(" three", 7, "editor"), 0)
+	require.NoError(t, err)
+
+	stats, err := session.DocumentStats("editor")
+	require.NoError(t, err)
+	require.Equal(t, collab.DocumentStats{Revision: 1, Characters: 13, Words: 3}, stats)
+
+	_, err = session.DocumentStats("unknown")
+	require.ErrorIs(t, err, acl.ErrAccessDenied)
+
+	require.NoError(t, session.Close())
+
+	_, err = session.DocumentStats("editor")
+	require.ErrorIs(t, err, collab.ErrSessionClosed)
+}
+
 func TestSession_Load_WithExistingData(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
-	require.NoError(t, store.SaveSnapshot("doc1", 5, "hello"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.SaveSnapshot(t.Context(), "doc1", 5, "hello"))
 
 	session := collab.NewSession(collab.SessionConfig{
 		DocID: "doc1",
 		Store: store,
 	})
 
-	require.NoError(t, session.Load())
+	require.NoError(t, session.Load(t.Context()))
 
 	content, revision, err := session.GetState("user")
 	require.NoError(t, err)
@@ -164,14 +494,14 @@ func TestSession_Close(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	session := collab.NewSession(collab.SessionConfig{
 		DocID: "doc1",
 		Store: store,
 	})
 
-	require.NoError(t, session.Load())
+	require.NoError(t, session.Load(t.Context()))
 
 	_, err := session.ApplyOperation("c1", "u1", ot.NewInsert("X", 0, "u1"), 0)
 	require.NoError(t, err)
@@ -191,6 +521,68 @@ func TestSession_Close(t *testing.T) {
 	}
 }
 
+func TestSession_HandOff(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	old := collab.NewSession(collab.SessionConfig{DocID: "doc1", Store: store})
+	require.NoError(t, old.Load(t.Context()))
+
+	for i, char := range []string{"a", "b", "c"} {
+		_, err := old.ApplyOperation("c1", "alice", ot.NewInsert(char, i, "alice"), i)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, old.HandOff())
+
+	// The successor transforms an edit bob based on revision 1, before the
+	// final snapshot pruned the operations after it
+	successor := collab.NewSession(collab.SessionConfig{DocID: "doc1", Store: store})
+	require.NoError(t, successor.Load(t.Context()))
+
+	rev, err := successor.ApplyOperation("c2", "bob", ot.NewInsert("x", 1, "bob"), 1)
+	require.NoError(t, err)
+	require.Equal(t, 4, rev)
+
+	content, _, err := successor.GetState("bob")
+	require.NoError(t, err)
+	require.Equal(t, "abcx", content)
+
+	// Clients polling for changes catch up from the handed-over history
+	ops, _, err := successor.Changes(t.Context(), "bob", 2)
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+}
+
+func TestSession_HandOff_Stale(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	old := collab.NewSession(collab.SessionConfig{DocID: "doc1", Store: store})
+	require.NoError(t, old.Load(t.Context()))
+
+	_, err := old.ApplyOperation("c1", "alice", ot.NewInsert("a", 0, "alice"), 0)
+	require.NoError(t, err)
+	require.NoError(t, old.HandOff())
+
+	// Someone else edited the document after the handoff was saved
+	op := ot.SequencedOperation{Operation: ot.NewInsert("b", 1, "bob"), Revision: 2}
+	require.NoError(t, store.AppendOperation(t.Context(), "doc1", op))
+
+	successor := collab.NewSession(collab.SessionConfig{DocID: "doc1", Store: store})
+	require.NoError(t, successor.Load(t.Context()))
+
+	_, _, err = successor.Changes(t.Context(), "alice", 0)
+	require.ErrorIs(t, err, storage.ErrRevisionCompacted, "the stale history isn't restored")
+
+	_, err = store.TakeHandoff(t.Context(), "doc1")
+	require.ErrorIs(t, err, storage.ErrHandoffNotFound, "the handoff is consumed anyway")
+}
+
 func TestSession_DocID(t *testing.T) {
 	t.Parallel()
 
@@ -208,14 +600,14 @@ func TestSession_Revision(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	session := collab.NewSession(collab.SessionConfig{
 		DocID: "doc1",
 		Store: store,
 	})
 
-	require.NoError(t, session.Load())
+	require.NoError(t, session.Load(t.Context()))
 
 	if session.Revision() != 0 {
 		t.Errorf("expected revision 0, got %d", session.Revision())
@@ -233,18 +625,18 @@ func TestSession_Load_WhenClosed(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	session := collab.NewSession(collab.SessionConfig{
 		DocID: "doc1",
 		Store: store,
 	})
 
-	require.NoError(t, session.Load())
+	require.NoError(t, session.Load(t.Context()))
 	require.NoError(t, session.Close())
 
 	// Load after close should fail
-	err := session.Load()
+	err := session.Load(t.Context())
 	if !errors.Is(err, collab.ErrSessionClosed) {
 		t.Errorf("expected ErrSessionClosed, got %v", err)
 	}
@@ -254,14 +646,14 @@ func TestSession_Close_Idempotent(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	session := collab.NewSession(collab.SessionConfig{
 		DocID: "doc1",
 		Store: store,
 	})
 
-	require.NoError(t, session.Load())
+	require.NoError(t, session.Load(t.Context()))
 
 	// Close multiple times should not error
 	require.NoError(t, session.Close())
@@ -272,7 +664,7 @@ func TestSession_WithSnapshotPolicy(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	policy := storage.NewSnapshotPolicy(3) // Snapshot every 3 ops
 
@@ -282,7 +674,7 @@ func TestSession_WithSnapshotPolicy(t *testing.T) {
 		SnapshotPolicy: policy,
 	})
 
-	require.NoError(t, session.Load())
+	require.NoError(t, session.Load(t.Context()))
 
 	// Apply 3 operations to trigger snapshot
 	for i := range 3 {
@@ -291,7 +683,7 @@ func TestSession_WithSnapshotPolicy(t *testing.T) {
 	}
 
 	// Verify snapshot was created
-	snapshot, err := store.LoadSnapshot("doc1")
+	snapshot, err := store.LoadSnapshot(t.Context(), "doc1")
 	require.NoError(t, err)
 
 	if snapshot.Revision != 3 {
@@ -299,11 +691,312 @@ func TestSession_WithSnapshotPolicy(t *testing.T) {
 	}
 }
 
+// failingSnapshotStore is a MemoryStore whose SaveFormattedSnapshot always
+// fails.
+type failingSnapshotStore struct {
+	*storage.MemoryStore
+}
+
+func (failingSnapshotStore) SaveFormattedSnapshot(context.Context, string, int, string, []ot.Mark) error {
+	return errors.New("disk full")
+}
+
+func TestSession_WithSnapshotPolicy_SnapshotFails(t *testing.T) {
+	t.Parallel()
+
+	store := failingSnapshotStore{MemoryStore: storage.NewMemoryStore()}
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	var logs bytes.Buffer
+
+	logger, err := logging.New(&logs, logging.FormatText, slog.LevelInfo)
+	require.NoError(t, err)
+
+	session := collab.NewSession(collab.SessionConfig{
+		DocID:          "doc1",
+		Store:          store,
+		SnapshotPolicy: storage.NewSnapshotPolicy(1),
+		Logger:         logger,
+	})
+	require.NoError(t, session.Load(t.Context()))
+
+	// The operation still succeeds; the failure is only logged
+	_, err = session.ApplyOperation("c1", "u1", ot.NewInsert("x", 0, "u1"), 0)
+	require.NoError(t, err)
+	require.Contains(t, logs.String(), `msg="automatic snapshot failed" doc_id=doc1 error="disk full"`)
+}
+
+// failingAppendStore is a MemoryStore whose AppendOperations always fails.
+type failingAppendStore struct {
+	*storage.MemoryStore
+}
+
+func (failingAppendStore) AppendOperations(context.Context, string, []ot.SequencedOperation) error {
+	return errors.New("disk full")
+}
+
+func TestSession_LogsOperations(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	var logs bytes.Buffer
+
+	logger, err := logging.New(&logs, logging.FormatText, slog.LevelDebug)
+	require.NoError(t, err)
+
+	session := collab.NewSession(collab.SessionConfig{DocID: "doc1", Store: store, Logger: logger})
+	require.NoError(t, session.Load(t.Context()))
+
+	_, err = session.ApplyOperation("c1", "u1", ot.NewInsert("x", 0, "u1"), 0)
+	require.NoError(t, err)
+	require.Contains(t, logs.String(),
+		`msg="operation applied" doc_id=doc1 client_id=c1 user_id=u1 revision=1 base_revision=0`)
+
+	// Operations that fail to be stored are logged with their revisions
+	failing := failingAppendStore{MemoryStore: store}
+	session = collab.NewSession(collab.SessionConfig{DocID: "doc1", Store: failing, Logger: logger})
+	require.NoError(t, session.Load(t.Context()))
+
+	_, err = session.ApplyOperation("c1", "u1", ot.NewInsert("y", 0, "u1"), 1)
+	require.Error(t, err)
+	require.Contains(t, logs.String(),
+		`msg="failed to store operations" doc_id=doc1 revision=2 last_revision=2 error="disk full"`)
+}
+
+func TestSession_StoreFails(t *testing.T) {
+	t.Parallel()
+
+	store := failingAppendStore{MemoryStore: storage.NewMemoryStore()}
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.SaveSnapshot(t.Context(), "doc1", 0, "hello"))
+
+	session := collab.NewSession(collab.SessionConfig{DocID: "doc1", Store: store})
+	require.NoError(t, session.Load(t.Context()))
+
+	_, err := session.ApplyOperation("c1", "u1", ot.NewInsert("!", 5, "u1"), 0)
+	require.EqualError(t, err, "disk full")
+
+	// The edit storage doesn't have is no longer served, nor built on
+	_, _, err = session.GetState("u1")
+	require.ErrorIs(t, err, collab.ErrSessionClosed)
+
+	_, err = session.ApplyOperation("c1", "u1", ot.NewInsert("?", 5, "u1"), 0)
+	require.ErrorIs(t, err, collab.ErrSessionClosed)
+
+	// Nor is it snapshotted on close
+	require.EqualError(t, session.Close(), "disk full")
+
+	snapshot, err := store.LoadSnapshot(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.Zero(t, snapshot.Revision)
+	require.Equal(t, "hello", snapshot.Content)
+}
+
+func TestSession_Snapshot_OnlyStored(t *testing.T) {
+	t.Parallel()
+
+	store := &blockingAppendStore{MemoryStore: storage.NewMemoryStore(), release: make(chan struct{})}
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	italic := []ot.Mark{{Start: 3, End: 4, Attributes: ot.Attributes{"italic": "true"}}}
+	require.NoError(t, store.SaveFormattedSnapshot(t.Context(), "doc1", 0, "hello", italic))
+
+	session := collab.NewSession(collab.SessionConfig{DocID: "doc1", Store: store})
+	require.NoError(t, session.Load(t.Context()))
+
+	var wg sync.WaitGroup
+
+	// The first is held while being stored, and the others wait behind it
+	for i, op := range []ot.Operation{
+		ot.NewInsert("ab", 0, "u1"),
+		ot.NewDelete(5, "u1"),
+		ot.NewFormat(0, "bold", "true", "u1"),
+	} {
+		wg.Go(func() {
+			_, err := session.ApplyOperation("c1", "u1", op, i)
+			require.NoError(t, err)
+		})
+
+		require.Eventually(t, func() bool { return session.Revision() == i+1 }, time.Second, time.Millisecond)
+	}
+
+	require.NoError(t, session.Snapshot(t.Context()))
+
+	snapshot, err := store.LoadSnapshot(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.Zero(t, snapshot.Revision)
+	require.Equal(t, "hello", snapshot.Content)
+	require.Equal(t, italic, snapshot.Formatting, "the deleted character is formatted again")
+
+	close(store.release)
+	wg.Wait()
+
+	require.NoError(t, session.Snapshot(t.Context()))
+
+	snapshot, err = store.LoadSnapshot(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.Equal(t, 3, snapshot.Revision)
+	require.Equal(t, "abhelo", snapshot.Content)
+
+	bold := []ot.Mark{{Start: 0, End: 1, Attributes: ot.Attributes{"bold": "true"}}}
+	require.Equal(t, bold, snapshot.Formatting)
+
+	// A session loading the snapshot has its formatting
+	reloaded := collab.NewSession(collab.SessionConfig{DocID: "doc1", Store: store})
+	require.NoError(t, reloaded.Load(t.Context()))
+
+	content, formatting, revision, err := reloaded.GetFormattedState("u1")
+	require.NoError(t, err)
+	require.Equal(t, "abhelo", content)
+	require.Equal(t, bold, formatting)
+	require.Equal(t, 3, revision)
+}
+
+func TestSession_Snapshot(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	policy := storage.NewSnapshotPolicy(3)
+
+	session := collab.NewSession(collab.SessionConfig{
+		DocID:          "doc1",
+		Store:          store,
+		SnapshotPolicy: policy,
+	})
+
+	require.NoError(t, session.Load(t.Context()))
+
+	for i := range 2 {
+		_, err := session.ApplyOperation("c1", "u1", ot.NewInsert("x", i, "u1"), i)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, session.Snapshot(t.Context()))
+
+	snapshot, err := store.LoadSnapshot(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	if snapshot.Revision != 2 || snapshot.Content != "xx" {
+		t.Errorf("expected snapshot of %q at revision 2, got %q at %d", "xx", snapshot.Content, snapshot.Revision)
+	}
+
+	if got := policy.OperationsSinceSnapshot("doc1"); got != 0 {
+		t.Errorf("expected snapshot policy to be reset, got %d operations", got)
+	}
+
+	require.NoError(t, session.Close())
+	require.ErrorIs(t, session.Snapshot(t.Context()), collab.ErrSessionClosed)
+}
+
+func TestSession_Stats(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	session := collab.NewSession(collab.SessionConfig{
+		DocID: "doc1",
+		Store: store,
+	})
+
+	require.NoError(t, session.Load(t.Context()))
+
+	empty := session.Stats()
+	if empty != (collab.SessionStats{DocID: "doc1"}) {
+		t.Errorf("unexpected stats for empty session: %+v", empty)
+	}
+
+	_, err := session.ApplyOperation("c1", "u1", ot.NewInsert("a", 0, "u1"), 0)
+	require.NoError(t, err)
+
+	stats := session.Stats()
+	if stats.Revision != 1 || stats.HistoryOps != 1 {
+		t.Errorf("expected revision 1 with 1 retained op, got %+v", stats)
+	}
+
+	if stats.ContentBytes != 4 || stats.HistoryBytes == 0 || stats.PendingBytes != 0 {
+		t.Errorf("unexpected memory breakdown: %+v", stats)
+	}
+
+	if stats.MemoryBytes != stats.ContentBytes+stats.HistoryBytes {
+		t.Errorf("expected memory estimate to add up its parts, got %+v", stats)
+	}
+
+	if stats.OpsPerSecond != 1.0/60 {
+		t.Errorf("expected one operation averaged over a minute, got %v", stats.OpsPerSecond)
+	}
+
+	latency := stats.Latency
+	if latency.Operations != 1 || latency.MaxTotal != latency.Max.Total() || latency.Mean != latency.Max {
+		t.Errorf("expected the latency of one operation, got %+v", latency)
+	}
+}
+
+func TestSession_SlowOperation(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	var logs bytes.Buffer
+
+	logger, err := logging.New(&logs, logging.FormatText, slog.LevelInfo)
+	require.NoError(t, err)
+
+	session := collab.NewSession(collab.SessionConfig{
+		DocID:         "doc1",
+		Store:         store,
+		Logger:        logger,
+		SlowOperation: time.Nanosecond,
+	})
+	require.NoError(t, session.Load(t.Context()))
+
+	_, err = session.ApplyOperation("c1", "alice", ot.NewInsert("a", 0, "alice"), 0)
+	require.NoError(t, err)
+	require.Contains(t, logs.String(), `msg="slow operation" doc_id=doc1 client_id=c1 user_id=alice revision=1 transform=`)
+	require.Contains(t, logs.String(), " persist=")
+	require.Contains(t, logs.String(), " total=")
+}
+
+func TestSession_ApplyOperation_ClientFarBehind(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	var logs bytes.Buffer
+
+	logger, err := logging.New(&logs, logging.FormatText, slog.LevelInfo)
+	require.NoError(t, err)
+
+	session := collab.NewSession(collab.SessionConfig{DocID: "doc1", Store: store, HistorySize: 4, Logger: logger})
+	require.NoError(t, session.Load(t.Context()))
+
+	for range 3 {
+		_, err = session.ApplyOperation("c1", "alice", ot.NewInsert("a", 0, "alice"), session.Revision())
+		require.NoError(t, err)
+	}
+
+	// Two operations behind is within half the history
+	_, err = session.ApplyOperation("c2", "bob", ot.NewInsert("b", 0, "bob"), 1)
+	require.NoError(t, err)
+	require.Empty(t, logs.String())
+
+	_, err = session.ApplyOperation("c2", "bob", ot.NewInsert("b", 0, "bob"), 1)
+	require.NoError(t, err)
+	require.Contains(t, logs.String(),
+		`msg="client far behind" doc_id=doc1 client_id=c2 user_id=bob behind=3 history_size=4`)
+}
+
 func TestSession_WithHub(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	hub := ws.NewHub()
 
@@ -313,18 +1006,94 @@ func TestSession_WithHub(t *testing.T) {
 		Hub:   hub,
 	})
 
-	require.NoError(t, session.Load())
+	require.NoError(t, session.Load(t.Context()))
 
 	// Apply operation - should not panic even with hub
 	_, err := session.ApplyOperation("c1", "u1", ot.NewInsert("A", 0, "u1"), 0)
 	require.NoError(t, err)
 }
 
+func TestSession_WithWebhooks(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	events := make(chan webhook.Event, 1)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhook.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err == nil {
+			events <- event
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(endpoint.Close)
+
+	webhooks := webhook.NewService(webhook.Config{Store: webhook.NewMemoryStore()})
+	_, err := webhooks.Register("u1", endpoint.URL, nil)
+	require.NoError(t, err)
+
+	session := collab.NewSession(collab.SessionConfig{
+		DocID:    "doc1",
+		Store:    store,
+		Webhooks: webhooks,
+	})
+
+	require.NoError(t, session.Load(t.Context()))
+
+	_, err = session.ApplyOperation("c1", "u1", ot.NewInsert("A", 0, "u1"), 0)
+	require.NoError(t, err)
+	webhooks.Close()
+
+	event := <-events
+	if event.Type != webhook.EventDocumentUpdated || event.DocID != "doc1" || event.Revision != 1 || event.UserID != "u1" {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
+
+func TestSession_WithAnchors(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	comments := comment.NewService(comment.NewMemoryStore())
+
+	session := collab.NewSession(collab.SessionConfig{
+		DocID:   "doc1",
+		Store:   store,
+		Anchors: comments,
+	})
+
+	require.NoError(t, session.Load(t.Context()))
+
+	history := func(ctx context.Context, sinceRevision int) ([]ot.SequencedOperation, error) {
+		ops, _, err := session.OperationsSince(ctx, "u1", sinceRevision)
+
+		return ops, err
+	}
+
+	_, err := comments.Create(t.Context(), "doc1", "u1", "note", comment.Anchor{Start: 0, End: 0}, 0, history)
+	require.NoError(t, err)
+
+	// Typing at the comment's position moves it along once each operation is stored
+	for i, char := range "ab" {
+		_, err := session.ApplyOperation("c1", "u2", ot.NewInsert(string(char), i, "u2"), i)
+		require.NoError(t, err)
+	}
+
+	list, err := comments.List("doc1")
+	require.NoError(t, err)
+	require.Equal(t, comment.Anchor{Start: 2, End: 2}, list[0].Anchor)
+	require.Equal(t, 2, list[0].Revision)
+}
+
 func TestSession_ApplyOperation_OTError(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	session := collab.NewSession(collab.SessionConfig{
 		DocID:       "doc1",
@@ -332,7 +1101,7 @@ func TestSession_ApplyOperation_OTError(t *testing.T) {
 		HistorySize: 2, // Small history
 	})
 
-	require.NoError(t, session.Load())
+	require.NoError(t, session.Load(t.Context()))
 
 	// Apply several operations
 	for i := range 5 {
@@ -351,14 +1120,14 @@ func TestSession_Load_WithOperations(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	// Pre-store some operations that will be loaded
-	require.NoError(t, store.AppendOperation("doc1", ot.SequencedOperation{
+	require.NoError(t, store.AppendOperation(t.Context(), "doc1", ot.SequencedOperation{
 		Operation: ot.Operation{Type: ot.Insert, Position: 0, Char: "H"},
 		Revision:  1,
 	}))
-	require.NoError(t, store.AppendOperation("doc1", ot.SequencedOperation{
+	require.NoError(t, store.AppendOperation(t.Context(), "doc1", ot.SequencedOperation{
 		Operation: ot.Operation{Type: ot.Insert, Position: 1, Char: "I"},
 		Revision:  2,
 	}))
@@ -368,7 +1137,7 @@ func TestSession_Load_WithOperations(t *testing.T) {
 		Store: store,
 	})
 
-	require.NoError(t, session.Load())
+	require.NoError(t, session.Load(t.Context()))
 
 	content, revision, err := session.GetState("user")
 	require.NoError(t, err)
@@ -381,3 +1150,314 @@ func TestSession_Load_WithOperations(t *testing.T) {
 		t.Errorf("expected revision 2, got %d", revision)
 	}
 }
+
+func TestSession_GetStateAt(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "u1", acl.Editor))
+
+	session := collab.NewSession(collab.SessionConfig{
+		DocID:       "doc1",
+		Store:       store,
+		PermChecker: acl.NewChecker(permStore),
+	})
+
+	require.NoError(t, session.Load(t.Context()))
+
+	_, err := session.ApplyOperation("c1", "u1", ot.NewInsert("H", 0, "u1"), 0)
+	require.NoError(t, err)
+
+	_, err = session.ApplyOperation("c1", "u1", ot.NewInsert("I", 1, "u1"), 1)
+	require.NoError(t, err)
+
+	t.Run("returns past content", func(t *testing.T) {
+		t.Parallel()
+
+		content, err := session.GetStateAt(t.Context(), "u1", 1)
+		require.NoError(t, err)
+
+		if content != "H" {
+			t.Errorf("expected 'H', got %q", content)
+		}
+	})
+
+	t.Run("returns head content", func(t *testing.T) {
+		t.Parallel()
+
+		content, err := session.GetStateAt(t.Context(), "u1", 2)
+		require.NoError(t, err)
+
+		if content != "HI" {
+			t.Errorf("expected 'HI', got %q", content)
+		}
+	})
+
+	t.Run("returns ErrRevisionNotFound for future revision", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := session.GetStateAt(t.Context(), "u1", 3)
+		if !errors.Is(err, storage.ErrRevisionNotFound) {
+			t.Errorf("expected ErrRevisionNotFound, got %v", err)
+		}
+	})
+
+	t.Run("denies users without read access", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := session.GetStateAt(t.Context(), "stranger", 1)
+		if !errors.Is(err, acl.ErrAccessDenied) {
+			t.Errorf("expected ErrAccessDenied, got %v", err)
+		}
+	})
+}
+
+func TestSession_GetStateAt_WhenClosed(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	session := collab.NewSession(collab.SessionConfig{
+		DocID: "doc1",
+		Store: store,
+	})
+
+	require.NoError(t, session.Load(t.Context()))
+	require.NoError(t, session.Close())
+
+	_, err := session.GetStateAt(t.Context(), "u1", 0)
+	if !errors.Is(err, collab.ErrSessionClosed) {
+		t.Errorf("expected ErrSessionClosed, got %v", err)
+	}
+}
+
+func newChangesSession(t *testing.T, historySize int) *collab.Session {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "u1", acl.Editor))
+
+	session := collab.NewSession(collab.SessionConfig{
+		DocID:       "doc1",
+		Store:       store,
+		PermChecker: acl.NewChecker(permStore),
+		HistorySize: historySize,
+	})
+	require.NoError(t, session.Load(t.Context()))
+
+	for i, char := range []string{"a", "b", "c"} {
+		_, err := session.ApplyOperation("c1", "u1", ot.NewInsert(char, i, "u1"), i)
+		require.NoError(t, err)
+	}
+
+	return session
+}
+
+func TestSession_Changes(t *testing.T) {
+	t.Parallel()
+
+	t.Run("returns pending operations right away", func(t *testing.T) {
+		t.Parallel()
+
+		session := newChangesSession(t, 0)
+
+		ops, revision, err := session.Changes(t.Context(), "u1", 1)
+		require.NoError(t, err)
+
+		if revision != 3 || len(ops) != 2 || ops[0].Revision != 2 || ops[1].Char != "c" {
+			t.Errorf("unexpected changes at revision %d: %+v", revision, ops)
+		}
+	})
+
+	t.Run("waits for the next operation", func(t *testing.T) {
+		t.Parallel()
+
+		session := newChangesSession(t, 0)
+
+		type result struct {
+			ops      []ot.SequencedOperation
+			revision int
+			err      error
+		}
+
+		done := make(chan result, 1)
+
+		go func() {
+			ops, revision, err := session.Changes(t.Context(), "u1", 3)
+			done <- result{ops, revision, err}
+		}()
+
+		_, err := session.ApplyOperation("c1", "u1", ot.NewInsert("d", 3, "u1"), 3)
+		require.NoError(t, err)
+
+		got := <-done
+		require.NoError(t, got.err)
+
+		if got.revision != 4 || len(got.ops) != 1 || got.ops[0].Char != "d" {
+			t.Errorf("unexpected changes at revision %d: %+v", got.revision, got.ops)
+		}
+	})
+
+	t.Run("returns nothing when the wait ends", func(t *testing.T) {
+		t.Parallel()
+
+		session := newChangesSession(t, 0)
+
+		ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+		defer cancel()
+
+		ops, revision, err := session.Changes(ctx, "u1", 3)
+		require.NoError(t, err)
+
+		if revision != 3 || len(ops) != 0 {
+			t.Errorf("expected no changes at revision 3, got %+v at %d", ops, revision)
+		}
+	})
+
+	t.Run("falls back to storage beyond the history", func(t *testing.T) {
+		t.Parallel()
+
+		session := newChangesSession(t, 1)
+
+		ops, _, err := session.Changes(t.Context(), "u1", 0)
+		require.NoError(t, err)
+		require.Len(t, ops, 3)
+	})
+
+	t.Run("reads recent operations a snapshot pruned", func(t *testing.T) {
+		t.Parallel()
+
+		session := newChangesSession(t, 0)
+		require.NoError(t, session.Snapshot(t.Context()))
+
+		ops, _, err := session.Changes(t.Context(), "u1", 2)
+		require.NoError(t, err)
+		require.Len(t, ops, 1)
+	})
+
+	t.Run("wakes waiters when the session closes", func(t *testing.T) {
+		t.Parallel()
+
+		session := newChangesSession(t, 0)
+		done := make(chan error, 1)
+
+		go func() {
+			_, _, err := session.Changes(t.Context(), "u1", 3)
+			done <- err
+		}()
+
+		require.NoError(t, session.Close())
+
+		if err := <-done; !errors.Is(err, collab.ErrSessionClosed) {
+			t.Errorf("expected ErrSessionClosed, got %v", err)
+		}
+	})
+
+	t.Run("compacted revision", func(t *testing.T) {
+		t.Parallel()
+
+		session := newChangesSession(t, 1)
+		require.NoError(t, session.Snapshot(t.Context()))
+
+		if _, _, err := session.Changes(t.Context(), "u1", 0); !errors.Is(err, storage.ErrRevisionCompacted) {
+			t.Errorf("expected ErrRevisionCompacted, got %v", err)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		userID string
+		since  int
+		want   error
+	}{
+		{"revision ahead", "u1", 4, storage.ErrRevisionNotFound},
+		{"negative revision", "u1", -1, storage.ErrRevisionNotFound},
+		{"no read access", "mallory", 0, acl.ErrAccessDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			session := newChangesSession(t, 0)
+
+			if _, _, err := session.Changes(t.Context(), tt.userID, tt.since); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestSession_OperationsSince(t *testing.T) {
+	t.Parallel()
+
+	session := newChangesSession(t, 0)
+
+	ops, revision, err := session.OperationsSince(t.Context(), "u1", 1)
+	require.NoError(t, err)
+	require.Equal(t, 3, revision)
+	require.Len(t, ops, 2)
+	require.Equal(t, 2, ops[0].Revision)
+	require.Equal(t, "c", ops[1].Char)
+
+	// An up-to-date client has missed nothing, and doesn't wait
+	ops, revision, err = session.OperationsSince(t.Context(), "u1", 3)
+	require.NoError(t, err)
+	require.Equal(t, 3, revision)
+	require.Empty(t, ops)
+
+	// Operations that left the history are read from storage
+	ops, _, err = newChangesSession(t, 1).OperationsSince(t.Context(), "u1", 0)
+	require.NoError(t, err)
+	require.Len(t, ops, 3)
+
+	for i, op := range ops {
+		require.Equal(t, i+1, op.Revision)
+	}
+
+	compacted := newChangesSession(t, 1)
+	require.NoError(t, compacted.Snapshot(t.Context()))
+
+	_, _, err = compacted.OperationsSince(t.Context(), "u1", 0)
+	require.ErrorIs(t, err, storage.ErrRevisionCompacted)
+
+	_, _, err = session.OperationsSince(t.Context(), "u1", 4)
+	require.ErrorIs(t, err, storage.ErrRevisionNotFound)
+
+	_, _, err = session.OperationsSince(t.Context(), "mallory", 0)
+	require.ErrorIs(t, err, acl.ErrAccessDenied)
+}
+
+func TestSession_RebasePositions(t *testing.T) {
+	t.Parallel()
+
+	session := newChangesSession(t, 0)
+
+	// The caret after "a" follows the rest of what u1 typed
+	positions, revision, err := session.RebasePositions("u1", 1, 1, 0)
+	require.NoError(t, err)
+	require.Equal(t, []int{3, 0}, positions)
+	require.Equal(t, 3, revision)
+
+	positions, revision, err = session.RebasePositions("u1", 3, 2)
+	require.NoError(t, err)
+	require.Equal(t, []int{2}, positions)
+	require.Equal(t, 3, revision)
+
+	_, _, err = session.RebasePositions("u2", 3, 0)
+	require.ErrorIs(t, err, acl.ErrAccessDenied)
+
+	_, _, err = session.RebasePositions("u1", 4, 0)
+	require.ErrorIs(t, err, storage.ErrRevisionNotFound)
+
+	// Only the last operation is kept in memory
+	_, _, err = newChangesSession(t, 1).RebasePositions("u1", 1, 0)
+	require.ErrorIs(t, err, ot.ErrRevisionTooOld)
+}
@@ -0,0 +1,126 @@
+package collab
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/serroba/online-docs/internal/ws"
+)
+
+// chainBuckets are the lower bounds of the transform chain histogram's
+// buckets. Each counts chains shorter than the next bound; the last is open.
+var chainBuckets = [...]int{0, 1, 2, 4, 8, 16, 32, 64, 128}
+
+// counters are running totals kept across all of a manager's sessions.
+type counters struct {
+	ops              atomic.Int64
+	snapshotFailures atomic.Int64
+	chains           [len(chainBuckets)]atomic.Int64
+}
+
+// recordChain counts an operation transformed against length others.
+func (c *counters) recordChain(length int) {
+	c.chains[sort.SearchInts(chainBuckets[:], length+1)-1].Add(1)
+}
+
+// Counters are totals since the manager was created, including sessions
+// that have since closed.
+type Counters struct {
+	OpsApplied       int64
+	SnapshotFailures int64 // Automatic, admin and closing snapshots that failed
+
+	// TransformChains is a histogram of how many operations each applied
+	// operation was transformed against, that is how far behind the document
+	// its client was. Buckets are ordered by length.
+	TransformChains []ChainBucket
+}
+
+// ChainBucket counts the operations whose transform chain was at least
+// MinLength long, and shorter than the next bucket's MinLength.
+type ChainBucket struct {
+	MinLength  int
+	Operations int64
+}
+
+// Counters returns the manager's running totals.
+func (m *Manager) Counters() Counters {
+	chains := make([]ChainBucket, len(chainBuckets))
+	for i, minLength := range chainBuckets {
+		chains[i] = ChainBucket{MinLength: minLength, Operations: m.counters.chains[i].Load()}
+	}
+
+	return Counters{
+		OpsApplied:       m.counters.ops.Load(),
+		SnapshotFailures: m.counters.snapshotFailures.Load(),
+		TransformChains:  chains,
+	}
+}
+
+// LogStats logs a summary of the manager's activity every interval until
+// ctx is done, so operators without a metrics stack can follow the server
+// from its logs. Operations, snapshot failures, transform chains and dropped
+// clients are counted since the previous summary; the other figures are
+// current.
+func (m *Manager) LogStats(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := m.Counters()
+
+	var lastQueue ws.QueueStats
+	if m.hub != nil {
+		lastQueue = m.hub.QueueStats()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := m.Counters()
+
+		var (
+			clients int
+			queue   ws.QueueStats
+		)
+
+		if m.hub != nil {
+			clients = m.hub.TotalClients()
+			queue = m.hub.QueueStats()
+		}
+
+		m.logger.InfoContext(ctx, "stats",
+			"sessions", m.SessionCount(),
+			"clients", clients,
+			"memory_bytes", m.MemoryBytes(),
+			"ops", now.OpsApplied-last.OpsApplied,
+			"snapshot_failures", now.SnapshotFailures-last.SnapshotFailures,
+			chainDeltas(now.TransformChains, last.TransformChains),
+			"queued", queue.Queued,
+			"max_queue_depth", queue.MaxDepth,
+			"dropped_clients", queue.Dropped-lastQueue.Dropped,
+		)
+
+		last, lastQueue = now, queue
+	}
+}
+
+// chainDeltas logs the transform chains counted between two readings, keyed
+// by their buckets' lower bounds. Empty buckets are left out.
+func chainDeltas(now, last []ChainBucket) slog.Attr {
+	var attrs []any
+
+	for i, bucket := range now {
+		if delta := bucket.Operations - last[i].Operations; delta > 0 {
+			attrs = append(attrs, slog.Int64(strconv.Itoa(bucket.MinLength), delta))
+		}
+	}
+
+	return slog.Group("transform_chains", attrs...)
+}
@@ -0,0 +1,125 @@
+package collab_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager_Counters(t *testing.T) {
+	t.Parallel()
+
+	store := failingSnapshotStore{MemoryStore: storage.NewMemoryStore()}
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	manager := collab.NewManager(collab.ManagerConfig{
+		Store:          store,
+		SnapshotPolicy: storage.NewSnapshotPolicy(2),
+	})
+
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	// Each operation is based on the empty document, so it's transformed
+	// against all the ones before it
+	for range 3 {
+		_, err = session.ApplyOperation("c1", "u1", ot.NewInsert("a", 0, "u1"), 0)
+		require.NoError(t, err)
+	}
+
+	// Closing snapshots too, and the totals outlive the session
+	require.Error(t, manager.CloseSession("doc1"))
+
+	require.Equal(t, collab.Counters{
+		OpsApplied:       3,
+		SnapshotFailures: 2,
+		TransformChains: []collab.ChainBucket{
+			{MinLength: 0, Operations: 1},
+			{MinLength: 1, Operations: 1},
+			{MinLength: 2, Operations: 1},
+			{MinLength: 4},
+			{MinLength: 8},
+			{MinLength: 16},
+			{MinLength: 32},
+			{MinLength: 64},
+			{MinLength: 128},
+		},
+	}, manager.Counters())
+}
+
+// lockedBuffer is a bytes.Buffer safe to log to and read concurrently.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+func TestManager_LogStats(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	var logs lockedBuffer
+
+	manager := collab.NewManager(collab.ManagerConfig{
+		Store:  store,
+		Hub:    ws.NewHub(),
+		Logger: slog.New(slog.NewJSONHandler(&logs, nil)),
+	})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		manager.LogStats(ctx, 5*time.Millisecond)
+	}()
+
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	// Wait for a first summary, so the operation falls in a later interval
+	require.Eventually(t, func() bool {
+		return strings.Contains(logs.String(),
+			`"msg":"stats","component":"collab","sessions":1,"clients":0,"memory_bytes":0,"ops":0,`)
+	}, time.Second, time.Millisecond)
+
+	_, err = session.ApplyOperation("c1", "u1", ot.NewInsert("a", 0, "u1"), 0)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return strings.Contains(logs.String(),
+			`"ops":1,"snapshot_failures":0,"transform_chains":{"0":1},"queued":0,"max_queue_depth":0,"dropped_clients":0}`)
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+
+	// The operation lands in exactly one interval
+	require.Equal(t, 1, strings.Count(logs.String(), `"ops":1,`))
+}
@@ -0,0 +1,192 @@
+package collab
+
+import (
+	"errors"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"github.com/serroba/online-docs/internal/ot"
+)
+
+// Errors returned when a user has nothing left to revert.
+var (
+	ErrNothingToUndo = errors.New("nothing to undo")
+	ErrNothingToRedo = errors.New("nothing to redo")
+)
+
+// editKind tells an edit a client sent apart from one reverting another.
+type editKind int
+
+const (
+	editDirect editKind = iota // Sent by a client; clears the user's redo stack
+	editUndo                   // Reverts the user's latest edit
+	editRedo                   // Reverts the user's latest undo
+)
+
+// revertEntry is an operation reverting one of a user's edits, based on the
+// revision the edit produced. Applying it transforms it against everything
+// applied since, so it reverts that edit alone.
+type revertEntry struct {
+	op       ot.Operation
+	revision int
+}
+
+// editStacks holds what a user can undo and redo, most recent last.
+type editStacks struct {
+	undo []revertEntry
+	redo []revertEntry
+}
+
+// Undo reverts the user's latest edit that isn't undone yet, keeping every
+// edit made since, by anyone. It can be redone until the user edits again.
+// Edits older than the session's history can't be undone, and neither can
+// inserts of more than one character. Returns ErrNothingToUndo when none is
+// left, and the assigned revision otherwise, once it's stored.
+func (s *Session) Undo(clientID, userID string) (int, error) {
+	return s.revert(clientID, userID, editUndo)
+}
+
+// Redo reverts the user's latest undo, like Undo. Returns ErrNothingToRedo
+// when none is left.
+func (s *Session) Redo(clientID, userID string) (int, error) {
+	return s.revert(clientID, userID, editRedo)
+}
+
+// revert applies the operation on top of the user's undo or redo stack.
+func (s *Session) revert(clientID, userID string, kind editKind) (int, error) {
+	received := time.Now()
+
+	if err := s.checkWritePermission(userID); err != nil {
+		return 0, err
+	}
+
+	return s.commit(s.applyRevert(clientID, userID, kind, received))
+}
+
+// applyRevert pops the user's stack and applies the operation, like apply.
+func (s *Session) applyRevert(
+	clientID, userID string, kind editKind, received time.Time,
+) (ot.SequencedOperation, <-chan error, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkWritable(); err != nil {
+		return ot.SequencedOperation{}, nil, false, err
+	}
+
+	entry, ok := s.popRevert(userID, kind)
+	if !ok {
+		if kind == editUndo {
+			return ot.SequencedOperation{}, nil, false, ErrNothingToUndo
+		}
+
+		return ot.SequencedOperation{}, nil, false, ErrNothingToRedo
+	}
+
+	behind := s.queue.Revision() - entry.revision
+
+	seqOp, done, first, err := s.applyLocked(clientID, userID, entry.op, entry.revision, received, kind)
+	if err != nil {
+		return ot.SequencedOperation{}, nil, false, err
+	}
+
+	s.recordChain(clientID, userID, behind)
+
+	return seqOp, done, first, nil
+}
+
+// invert returns the operation reverting op, which is about to be applied,
+// and whether there is one. Must be called with mu held.
+func (s *Session) invert(op ot.Operation) (ot.Operation, bool) {
+	if op.IsNoop() {
+		return ot.Operation{}, false
+	}
+
+	switch op.Type {
+	case ot.Insert:
+		// A single delete can't revert a longer insert
+		if utf8.RuneCountInString(op.Char) != 1 {
+			return ot.Operation{}, false
+		}
+
+		return ot.NewDelete(op.Position, op.UserID), true
+	case ot.Delete:
+		content := s.document.Runes()
+		if op.Position >= len(content) {
+			return ot.Operation{}, false
+		}
+
+		return ot.NewInsert(string(content[op.Position]), op.Position, op.UserID), true
+	case ot.Format:
+		if op.Position >= s.document.Len() {
+			return ot.Operation{}, false
+		}
+
+		// Setting the attribute back to its value before reverts the format
+		previous := s.document.AttributesAt(op.Position)[op.Attribute]
+
+		return ot.NewFormat(op.Position, op.Attribute, previous, op.UserID), true
+	default:
+		return ot.Operation{}, false
+	}
+}
+
+// recordEdit pushes the entry reverting an edit of the given kind: edits a
+// client sent and redos can be undone, and undos can be redone. Must be
+// called with mu held.
+func (s *Session) recordEdit(userID string, kind editKind, entry revertEntry) {
+	stacks := s.edits[userID]
+	if stacks == nil {
+		stacks = &editStacks{}
+		s.edits[userID] = stacks
+	}
+
+	switch kind {
+	case editDirect:
+		stacks.undo = append(s.trimReverts(stacks.undo), entry)
+		stacks.redo = nil
+	case editUndo:
+		stacks.redo = append(s.trimReverts(stacks.redo), entry)
+	case editRedo:
+		stacks.undo = append(s.trimReverts(stacks.undo), entry)
+	}
+}
+
+// popRevert removes and returns the top of the user's undo or redo stack.
+// Must be called with mu held.
+func (s *Session) popRevert(userID string, kind editKind) (revertEntry, bool) {
+	stacks := s.edits[userID]
+	if stacks == nil {
+		return revertEntry{}, false
+	}
+
+	stack := &stacks.undo
+	if kind == editRedo {
+		stack = &stacks.redo
+	}
+
+	*stack = s.trimReverts(*stack)
+	if len(*stack) == 0 {
+		return revertEntry{}, false
+	}
+
+	entry := (*stack)[len(*stack)-1]
+	*stack = (*stack)[:len(*stack)-1]
+
+	return entry, true
+}
+
+// trimReverts drops the entries the history no longer holds every operation
+// since, so they can't be transformed. Stacks are in revision order, so
+// they're at the bottom. Must be called with mu held.
+func (s *Session) trimReverts(stack []revertEntry) []revertEntry {
+	oldest := s.queue.Revision() - s.queue.HistorySize()
+
+	i := slices.IndexFunc(stack, func(e revertEntry) bool { return e.revision >= oldest })
+	if i < 0 {
+		return nil
+	}
+
+	return stack[i:]
+}
@@ -0,0 +1,170 @@
+package collab_test
+
+import (
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func newUndoSession(t *testing.T, historySize int) *collab.Session {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Editor))
+	require.NoError(t, permStore.Grant("doc1", "bob", acl.Editor))
+	require.NoError(t, permStore.Grant("doc1", "carol", acl.Viewer))
+
+	session := collab.NewSession(collab.SessionConfig{
+		DocID:       "doc1",
+		Store:       store,
+		PermChecker: acl.NewChecker(permStore),
+		HistorySize: historySize,
+	})
+	require.NoError(t, session.Load(t.Context()))
+
+	return session
+}
+
+func apply(t *testing.T, session *collab.Session, userID string, op ot.Operation) {
+	t.Helper()
+
+	_, err := session.ApplyOperation("c-"+userID, userID, op, session.Revision())
+	require.NoError(t, err)
+}
+
+func requireContent(t *testing.T, session *collab.Session, want string) {
+	t.Helper()
+
+	content, _, err := session.GetState("alice")
+	require.NoError(t, err)
+	require.Equal(t, want, content)
+}
+
+func TestSession_Undo(t *testing.T) {
+	t.Parallel()
+
+	session := newUndoSession(t, 0)
+
+	apply(t, session, "alice", ot.NewInsert("a", 0, "alice"))
+	apply(t, session, "bob", ot.NewInsert("b", 0, "bob"))
+	apply(t, session, "alice", ot.NewInsert("c", 2, "alice"))
+	apply(t, session, "bob", ot.NewInsert("d", 0, "bob"))
+	requireContent(t, session, "dbac")
+
+	// Only alice's edits are reverted, latest first, wherever they moved to
+	rev, err := session.Undo("c-alice", "alice")
+	require.NoError(t, err)
+	require.Equal(t, 5, rev)
+	requireContent(t, session, "dba")
+
+	_, err = session.Undo("c-alice", "alice")
+	require.NoError(t, err)
+	requireContent(t, session, "db")
+
+	_, err = session.Undo("c-alice", "alice")
+	require.ErrorIs(t, err, collab.ErrNothingToUndo)
+
+	// Redoing reapplies them, earliest first
+	_, err = session.Redo("c-alice", "alice")
+	require.NoError(t, err)
+	requireContent(t, session, "dba")
+
+	apply(t, session, "bob", ot.NewDelete(0, "bob"))
+
+	_, err = session.Redo("c-alice", "alice")
+	require.NoError(t, err)
+	requireContent(t, session, "bac")
+
+	_, err = session.Redo("c-alice", "alice")
+	require.ErrorIs(t, err, collab.ErrNothingToRedo)
+
+	// Redos can be undone again
+	_, err = session.Undo("c-alice", "alice")
+	require.NoError(t, err)
+	requireContent(t, session, "ba")
+}
+
+func TestSession_Undo_Delete(t *testing.T) {
+	t.Parallel()
+
+	session := newUndoSession(t, 0)
+
+	apply(t, session, "bob", ot.NewInsert("x", 0, "bob"))
+	apply(t, session, "bob", ot.NewInsert("y", 1, "bob"))
+	apply(t, session, "alice", ot.NewDelete(0, "alice"))
+	apply(t, session, "bob", ot.NewInsert("z", 1, "bob"))
+	requireContent(t, session, "yz")
+
+	// The deleted character comes back where it was
+	_, err := session.Undo("c-alice", "alice")
+	require.NoError(t, err)
+	requireContent(t, session, "xyz")
+}
+
+func TestSession_Undo_EditClearsRedo(t *testing.T) {
+	t.Parallel()
+
+	session := newUndoSession(t, 0)
+
+	apply(t, session, "alice", ot.NewInsert("a", 0, "alice"))
+
+	_, err := session.Undo("c-alice", "alice")
+	require.NoError(t, err)
+
+	// Others' edits keep alice's redo stack
+	apply(t, session, "bob", ot.NewInsert("b", 0, "bob"))
+
+	_, err = session.Redo("c-alice", "alice")
+	require.NoError(t, err)
+
+	_, err = session.Undo("c-alice", "alice")
+	require.NoError(t, err)
+
+	// Alice's own edits clear it
+	apply(t, session, "alice", ot.NewInsert("c", 0, "alice"))
+
+	_, err = session.Redo("c-alice", "alice")
+	require.ErrorIs(t, err, collab.ErrNothingToRedo)
+	requireContent(t, session, "cb")
+}
+
+func TestSession_Undo_NotRevertible(t *testing.T) {
+	t.Parallel()
+
+	session := newUndoSession(t, 3)
+
+	apply(t, session, "alice", ot.NewInsert("a", 0, "alice"))
+	apply(t, session, "alice", ot.NewInsert("long", 1, "alice"))
+
+	for range 3 {
+		apply(t, session, "bob", ot.NewInsert("b", 0, "bob"))
+	}
+
+	// Multi-character inserts aren't recorded, and "a" left the history
+	_, err := session.Undo("c-alice", "alice")
+	require.ErrorIs(t, err, collab.ErrNothingToUndo)
+	requireContent(t, session, "bbbalong")
+}
+
+func TestSession_Undo_Denied(t *testing.T) {
+	t.Parallel()
+
+	session := newUndoSession(t, 0)
+
+	apply(t, session, "alice", ot.NewInsert("a", 0, "alice"))
+
+	_, err := session.Undo("c-carol", "carol")
+	require.ErrorIs(t, err, acl.ErrAccessDenied)
+
+	require.NoError(t, session.Close())
+
+	_, err = session.Undo("c-alice", "alice")
+	require.ErrorIs(t, err, collab.ErrSessionClosed)
+}
@@ -0,0 +1,51 @@
+// Package comment keeps comments on documents. Each comment is anchored to
+// a range of the document's text, which follows the edits made after it so
+// the comment stays on the text it was written about.
+package comment
+
+import (
+	"errors"
+	"time"
+
+	"github.com/serroba/online-docs/internal/ot"
+)
+
+// ErrNotFound is returned when a comment does not exist.
+var ErrNotFound = errors.New("comment not found")
+
+// Anchor is the range of text a comment is about, from Start up to but not
+// including End, in runes. Start equals End for a comment on a position
+// rather than on text.
+type Anchor struct {
+	Start int
+	End   int
+}
+
+// Transform returns where the anchor ends up once op is applied. Text
+// inserted at either end falls outside the range, and a range whose text is
+// all deleted collapses to where it was.
+func (a Anchor) Transform(op ot.Operation) Anchor {
+	start := ot.TransformPosition(a.Start, op, true)
+	end := max(ot.TransformPosition(a.End, op, false), start)
+
+	return Anchor{Start: start, End: end}
+}
+
+// Comment is a comment anchored to a document's text.
+type Comment struct {
+	ID       string
+	DocID    string
+	AuthorID string
+	Body     string
+	Anchor   Anchor
+	Revision int // Document revision the anchor refers to
+
+	CreatedAt  time.Time
+	ResolvedAt time.Time // Zero until the comment is resolved
+	ResolvedBy string
+}
+
+// Resolved reports whether the comment has been resolved.
+func (c Comment) Resolved() bool {
+	return !c.ResolvedAt.IsZero()
+}
@@ -0,0 +1,44 @@
+package comment_test
+
+import (
+	"testing"
+
+	"github.com/serroba/online-docs/internal/comment"
+	"github.com/serroba/online-docs/internal/ot"
+)
+
+func TestAnchor_Transform(t *testing.T) {
+	t.Parallel()
+
+	// The anchor covers "cde" in "abcdefg"
+	anchor := comment.Anchor{Start: 2, End: 5}
+
+	tests := []struct {
+		name   string
+		anchor comment.Anchor
+		op     ot.Operation
+		want   comment.Anchor
+	}{
+		{"insert before", anchor, ot.NewInsert("x", 0, "u1"), comment.Anchor{Start: 3, End: 6}},
+		{"insert at start", anchor, ot.NewInsert("x", 2, "u1"), comment.Anchor{Start: 3, End: 6}},
+		{"insert inside", anchor, ot.NewInsert("x", 3, "u1"), comment.Anchor{Start: 2, End: 6}},
+		{"insert at end", anchor, ot.NewInsert("x", 5, "u1"), comment.Anchor{Start: 2, End: 5}},
+		{"insert after", anchor, ot.NewInsert("x", 6, "u1"), comment.Anchor{Start: 2, End: 5}},
+		{"delete before", anchor, ot.NewDelete(0, "u1"), comment.Anchor{Start: 1, End: 4}},
+		{"delete first", anchor, ot.NewDelete(2, "u1"), comment.Anchor{Start: 2, End: 4}},
+		{"delete last", anchor, ot.NewDelete(4, "u1"), comment.Anchor{Start: 2, End: 4}},
+		{"delete after", anchor, ot.NewDelete(5, "u1"), comment.Anchor{Start: 2, End: 5}},
+		{"delete only", comment.Anchor{Start: 2, End: 3}, ot.NewDelete(2, "u1"), comment.Anchor{Start: 2, End: 2}},
+		{"insert at point", comment.Anchor{Start: 2, End: 2}, ot.NewInsert("x", 2, "u1"), comment.Anchor{Start: 3, End: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.anchor.Transform(tt.op); got != tt.want {
+				t.Errorf("Transform() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
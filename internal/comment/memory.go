@@ -0,0 +1,71 @@
+package comment
+
+import (
+	"slices"
+	"sync"
+)
+
+// MemoryStore is an in-memory implementation of the Store interface.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	comments map[string][]Comment // document ID -> comments, oldest first
+}
+
+// NewMemoryStore creates a new in-memory comment store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		comments: make(map[string][]Comment),
+	}
+}
+
+// Save stores a comment, keeping a new one after the document's others.
+func (m *MemoryStore) Save(c Comment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	comments := m.comments[c.DocID]
+
+	i := slices.IndexFunc(comments, func(other Comment) bool { return other.ID == c.ID })
+	if i < 0 {
+		m.comments[c.DocID] = append(comments, c)
+	} else {
+		comments[i] = c
+	}
+
+	return nil
+}
+
+// Get returns a comment.
+func (m *MemoryStore) Get(docID, id string) (Comment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, c := range m.comments[docID] {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+
+	return Comment{}, ErrNotFound
+}
+
+// List returns a copy of a document's comments, oldest first.
+func (m *MemoryStore) List(docID string) ([]Comment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Clone(m.comments[docID]), nil
+}
+
+// DeleteAll removes every comment on a document.
+func (m *MemoryStore) DeleteAll(docID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.comments, docID)
+
+	return nil
+}
+
+// Ensure MemoryStore implements Store.
+var _ Store = (*MemoryStore)(nil)
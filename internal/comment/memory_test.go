@@ -0,0 +1,44 @@
+package comment_test
+
+import (
+	"testing"
+
+	"github.com/serroba/online-docs/internal/comment"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+
+	store := comment.NewMemoryStore()
+
+	first := comment.Comment{ID: "c1", DocID: "doc1", Body: "first"}
+	second := comment.Comment{ID: "c2", DocID: "doc1", Body: "second"}
+	require.NoError(t, store.Save(first))
+	require.NoError(t, store.Save(second))
+	require.NoError(t, store.Save(comment.Comment{ID: "c3", DocID: "doc2", Body: "elsewhere"}))
+
+	// Saving a comment again replaces it in place
+	first.Body = "edited"
+	require.NoError(t, store.Save(first))
+
+	comments, err := store.List("doc1")
+	require.NoError(t, err)
+	require.Equal(t, []comment.Comment{first, second}, comments)
+
+	got, err := store.Get("doc1", "c2")
+	require.NoError(t, err)
+	require.Equal(t, second, got)
+
+	_, err = store.Get("doc2", "c1")
+	require.ErrorIs(t, err, comment.ErrNotFound)
+
+	require.NoError(t, store.DeleteAll("doc1"))
+
+	comments, err = store.List("doc1")
+	require.NoError(t, err)
+	require.Empty(t, comments)
+
+	_, err = store.Get("doc2", "c3")
+	require.NoError(t, err)
+}
@@ -0,0 +1,125 @@
+package comment
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/serroba/online-docs/internal/ot"
+)
+
+// History returns a document's operations after sinceRevision, up to its
+// current revision, in order.
+type History func(ctx context.Context, sinceRevision int) ([]ot.SequencedOperation, error)
+
+// Service creates and resolves comments, and moves their anchors past the
+// operations applied to their documents. Operations must be passed to
+// Transform in revision order, as sessions do.
+type Service struct {
+	store Store
+
+	// mu orders creating comments with transforming them, so a comment
+	// created while its document is edited misses no operation
+	mu sync.Mutex
+}
+
+// NewService creates a comment service.
+func NewService(store Store) *Service {
+	return &Service{store: store}
+}
+
+// Create adds a comment by authorID anchored to a range of the document as
+// of revision. The anchor is moved past the operations history returns, so
+// the comment is anchored to the document as it is now.
+func (s *Service) Create(
+	ctx context.Context, docID, authorID, body string, anchor Anchor, revision int, history History,
+) (Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ops, err := history(ctx, revision)
+	if err != nil {
+		return Comment{}, err
+	}
+
+	for _, op := range ops {
+		anchor = anchor.Transform(op.Operation)
+		revision = op.Revision
+	}
+
+	c := Comment{
+		ID:        uuid.New().String(),
+		DocID:     docID,
+		AuthorID:  authorID,
+		Body:      body,
+		Anchor:    anchor,
+		Revision:  revision,
+		CreatedAt: time.Now(),
+	}
+
+	if err := s.store.Save(c); err != nil {
+		return Comment{}, err
+	}
+
+	return c, nil
+}
+
+// Resolve marks a comment resolved by userID. Resolving a resolved comment
+// keeps who resolved it first.
+// Returns ErrNotFound if the comment doesn't exist.
+func (s *Service) Resolve(docID, id, userID string) (Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.store.Get(docID, id)
+	if err != nil || c.Resolved() {
+		return c, err
+	}
+
+	c.ResolvedAt = time.Now()
+	c.ResolvedBy = userID
+
+	if err := s.store.Save(c); err != nil {
+		return Comment{}, err
+	}
+
+	return c, nil
+}
+
+// List returns a document's comments, oldest first.
+func (s *Service) List(docID string) ([]Comment, error) {
+	return s.store.List(docID)
+}
+
+// Transform moves the anchors of a document's comments past op. Comments
+// already anchored at or after its revision are left as they are.
+func (s *Service) Transform(docID string, op ot.SequencedOperation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comments, err := s.store.List(docID)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range comments {
+		if c.Revision >= op.Revision {
+			continue
+		}
+
+		c.Anchor = c.Anchor.Transform(op.Operation)
+		c.Revision = op.Revision
+
+		if err := s.store.Save(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteAll removes every comment on a document.
+func (s *Service) DeleteAll(docID string) error {
+	return s.store.DeleteAll(docID)
+}
@@ -0,0 +1,114 @@
+package comment_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/comment"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/stretchr/testify/require"
+)
+
+// historyOf returns a history over ops, which are sequenced from revision 1.
+func historyOf(ops ...ot.Operation) comment.History {
+	return func(_ context.Context, sinceRevision int) ([]ot.SequencedOperation, error) {
+		var result []ot.SequencedOperation
+		for i, op := range ops[sinceRevision:] {
+			result = append(result, ot.SequencedOperation{Operation: op, Revision: sinceRevision + i + 1})
+		}
+
+		return result, nil
+	}
+}
+
+func TestService_Create(t *testing.T) {
+	t.Parallel()
+
+	comments := comment.NewService(comment.NewMemoryStore())
+
+	// "bc" was commented on as of revision 1, when the document was "abc"
+	history := historyOf(ot.NewInsert("x", 0, "u1"), ot.NewInsert("y", 0, "u2"))
+
+	c, err := comments.Create(t.Context(), "doc1", "alice", "typo", comment.Anchor{Start: 1, End: 3}, 1, history)
+	require.NoError(t, err)
+	require.NotEmpty(t, c.ID)
+	require.Equal(t, "alice", c.AuthorID)
+	require.Equal(t, comment.Anchor{Start: 2, End: 4}, c.Anchor)
+	require.Equal(t, 2, c.Revision)
+	require.False(t, c.Resolved())
+
+	// The revision the comment was made at is kept if nothing came since
+	c, err = comments.Create(t.Context(), "doc1", "bob", "ok", comment.Anchor{Start: 0, End: 0}, 2, history)
+	require.NoError(t, err)
+	require.Equal(t, 2, c.Revision)
+
+	list, err := comments.List("doc1")
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, "typo", list[0].Body)
+}
+
+func TestService_Transform(t *testing.T) {
+	t.Parallel()
+
+	comments := comment.NewService(comment.NewMemoryStore())
+
+	// "abc" as of revision 3, then "xabc"
+	ops := []ot.Operation{
+		ot.NewInsert("a", 0, "u1"), ot.NewInsert("b", 1, "u1"), ot.NewInsert("c", 2, "u1"), ot.NewInsert("x", 0, "u2"),
+	}
+
+	old, err := comments.Create(t.Context(), "doc1", "alice", "on b",
+		comment.Anchor{Start: 1, End: 2}, 3, historyOf(ops[:3]...))
+	require.NoError(t, err)
+	require.Equal(t, 3, old.Revision)
+
+	// Created once revision 4 was applied, but before it was transformed
+	recent, err := comments.Create(t.Context(), "doc1", "alice", "on a",
+		comment.Anchor{Start: 0, End: 1}, 3, historyOf(ops...))
+	require.NoError(t, err)
+	require.Equal(t, comment.Anchor{Start: 1, End: 2}, recent.Anchor)
+	require.Equal(t, 4, recent.Revision)
+
+	// Deleting "b" from "xabc" collapses the comment on it
+	for _, op := range []ot.SequencedOperation{
+		{Operation: ops[3], Revision: 4},
+		{Operation: ot.NewDelete(2, "u2"), Revision: 5},
+	} {
+		require.NoError(t, comments.Transform("doc1", op))
+	}
+
+	list, err := comments.List("doc1")
+	require.NoError(t, err)
+	require.Equal(t, comment.Anchor{Start: 2, End: 2}, list[0].Anchor)
+	require.Equal(t, 5, list[0].Revision)
+	require.Equal(t, comment.Anchor{Start: 1, End: 2}, list[1].Anchor)
+	require.Equal(t, 5, list[1].Revision)
+}
+
+func TestService_Resolve(t *testing.T) {
+	t.Parallel()
+
+	comments := comment.NewService(comment.NewMemoryStore())
+
+	c, err := comments.Create(t.Context(), "doc1", "alice", "typo", comment.Anchor{}, 0, historyOf())
+	require.NoError(t, err)
+
+	resolved, err := comments.Resolve("doc1", c.ID, "bob")
+	require.NoError(t, err)
+	require.True(t, resolved.Resolved())
+	require.Equal(t, "bob", resolved.ResolvedBy)
+
+	// Resolving again keeps who resolved it first
+	again, err := comments.Resolve("doc1", c.ID, "carol")
+	require.NoError(t, err)
+	require.Equal(t, resolved, again)
+
+	_, err = comments.Resolve("doc2", c.ID, "bob")
+	require.ErrorIs(t, err, comment.ErrNotFound)
+
+	require.NoError(t, comments.DeleteAll("doc1"))
+
+	_, err = comments.Resolve("doc1", c.ID, "bob")
+	require.ErrorIs(t, err, comment.ErrNotFound)
+}
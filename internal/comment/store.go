@@ -0,0 +1,18 @@
+package comment
+
+// Store defines the interface for persisting comments, grouped by document.
+type Store interface {
+	// Save stores a comment, replacing any comment with the same document
+	// and ID.
+	Save(c Comment) error
+
+	// Get returns a comment.
+	// Returns ErrNotFound if the comment doesn't exist.
+	Get(docID, id string) (Comment, error)
+
+	// List returns a document's comments, oldest first.
+	List(docID string) ([]Comment, error)
+
+	// DeleteAll removes every comment on a document.
+	DeleteAll(docID string) error
+}
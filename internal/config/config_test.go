@@ -0,0 +1,382 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+// env returns a getenv function reading from vars.
+func env(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := config.Load(nil, env(nil))
+	require.NoError(t, err)
+	require.Equal(t, config.Default(), cfg)
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	t.Parallel()
+
+	path := writeFile(t, `
+http_addr: ":7000"
+grpc_addr: ":7001"
+history_size: 50
+snapshot_threshold: 0
+allowed_origins: ["https://file.example.com"]
+request_timeout: 5s
+admins: [root]
+oidc:
+  issuer_url: https://issuer.example.com
+  client_id: docs
+  redirect_url: https://docs.example.com/auth/callback
+`)
+
+	args := []string{"-config", path, "-grpc-addr", ":9000", "-admins", "alice, bob"}
+
+	cfg, err := config.Load(args, env(map[string]string{
+		"HTTP_ADDR":       ":8000",
+		"GRPC_ADDR":       ":8001",
+		"REQUEST_TIMEOUT": "2s",
+	}))
+	require.NoError(t, err)
+
+	want := config.Default()
+	want.HTTPAddr = ":8000"                                    // Environment over file
+	want.GRPCAddr = ":9000"                                    // Flag over environment
+	want.HistorySize = 50                                      // File over default
+	want.SnapshotThreshold = 0                                 // Zero in the file still applies
+	want.AllowedOrigins = []string{"https://file.example.com"} // File lists replace the default
+	want.RequestTimeout = 2 * time.Second                      // Environment durations
+	want.Admins = []string{"alice", "bob"}                     // Flag lists are trimmed
+	want.OIDC = config.OIDC{
+		IssuerURL:   "https://issuer.example.com",
+		ClientID:    "docs",
+		RedirectURL: "https://docs.example.com/auth/callback",
+	}
+	require.Equal(t, want, cfg)
+}
+
+func TestLoad_FileFromEnvironment(t *testing.T) {
+	t.Parallel()
+
+	path := writeFile(t, "history_size: 7\n")
+
+	cfg, err := config.Load(nil, env(map[string]string{
+		"CONFIG_FILE":               path,
+		"SNAPSHOT_THRESHOLD":        "25",
+		"ALLOWED_ORIGINS":           "https://a.example.com,https://b.example.com",
+		"ADMIN_USERS":               "root",
+		"LOG_LEVEL":                 "debug",
+		"REDIS_URL":                 "redis://cache:6379/1",
+		"POSTGRES_URL":              "postgres://docs@db:5432/docs",
+		"AUTOCERT_DOMAINS":          "docs.example.com",
+		"AUTOCERT_CACHE_DIR":        "/var/cache/docs",
+		"CLUSTER_NODES":             "http://docs-1:8080, http://docs-2:8080",
+		"NODE_URL":                  "http://docs-2:8080",
+		"LEASE_TTL":                 "20s",
+		"REPAIR_DOCUMENTS":          "true",
+		"PRELOAD_DOCUMENTS":         "roadmap,handbook",
+		"STATS_INTERVAL":            "5m",
+		"COMMIT_DELAY":              "10ms",
+		"SLOW_OPERATION":            "250ms",
+		"OPERATION_RATE":            "20",
+		"OPERATION_BURST":           "40",
+		"JWT_JWKS_URL":              "https://id.example.com/jwks",
+		"JWT_AUDIENCE":              "docs",
+		"RECORD_DIR":                "/var/lib/docs/recordings",
+		"FAULTS":                    "seed=3,drop=0.01",
+		"SMTP_ADDR":                 "smtp.example.com:587",
+		"SMTP_FROM":                 "docs@example.com",
+		"SMTP_PASSWORD":             "hunter2",
+		"SMTP_BATCH_WINDOW":         "5m",
+		"COMPACTION_INTERVAL":       "1h",
+		"COMPACTION_MAX_OPERATIONS": "500",
+		"COMPACTION_MAX_AGE":        "0s",
+		"READ_HEADER_TIMEOUT":       "2s",
+		"READ_TIMEOUT":              "0s",
+		"WRITE_TIMEOUT":             "1m",
+		"IDLE_TIMEOUT":              "2m",
+	}))
+	require.NoError(t, err)
+	require.Equal(t, 7, cfg.HistorySize)
+	require.Equal(t, 25, cfg.SnapshotThreshold)
+	require.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, cfg.AllowedOrigins)
+	require.Equal(t, []string{"root"}, cfg.Admins)
+	require.Equal(t, "debug", cfg.LogLevel)
+	require.Equal(t, "redis://cache:6379/1", cfg.Cluster.RedisURL)
+	require.Equal(t, "postgres://docs@db:5432/docs", cfg.PostgresURL)
+	require.Equal(t, []string{"docs.example.com"}, cfg.TLS.AutocertDomains)
+	require.Equal(t, "/var/cache/docs", cfg.TLS.AutocertCacheDir)
+	require.Equal(t, []string{"http://docs-1:8080", "http://docs-2:8080"}, cfg.Cluster.Nodes)
+	require.Equal(t, "http://docs-2:8080", cfg.Cluster.NodeURL)
+	require.Equal(t, 20*time.Second, cfg.Cluster.LeaseTTL)
+	require.True(t, cfg.RepairDocuments)
+	require.Equal(t, []string{"roadmap", "handbook"}, cfg.PreloadDocuments)
+	require.Equal(t, 5*time.Minute, cfg.StatsInterval)
+	require.Equal(t, 10*time.Millisecond, cfg.CommitDelay)
+	require.Equal(t, 250*time.Millisecond, cfg.SlowOperation)
+	require.Equal(t, 20, cfg.OperationRate)
+	require.Equal(t, 40, cfg.OperationBurst)
+	require.Equal(t, config.JWT{JWKSURL: "https://id.example.com/jwks", Audience: "docs"}, cfg.JWT)
+	require.Equal(t, "/var/lib/docs/recordings", cfg.RecordDir)
+	require.Equal(t, "seed=3,drop=0.01", cfg.Faults)
+	require.Equal(t, config.SMTP{
+		Addr: "smtp.example.com:587", From: "docs@example.com", Password: "hunter2", BatchWindow: 5 * time.Minute,
+	}, cfg.SMTP)
+	require.Equal(t, config.Compaction{Interval: time.Hour, MaxOperations: 500}, cfg.Compaction)
+	require.Equal(t, 2*time.Second, cfg.ReadHeaderTimeout)
+	require.Zero(t, cfg.ReadTimeout)
+	require.Equal(t, time.Minute, cfg.WriteTimeout)
+	require.Equal(t, 2*time.Minute, cfg.IdleTimeout)
+}
+
+func TestLoad_TLSFlags(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := config.Load([]string{"-tls-cert", "cert.pem", "-tls-key", "key.pem"}, env(nil))
+	require.NoError(t, err)
+	require.Equal(t, config.TLS{CertFile: "cert.pem", KeyFile: "key.pem"}, cfg.TLS)
+	require.True(t, cfg.TLS.Enabled())
+	require.False(t, config.Default().TLS.Enabled())
+}
+
+func TestLoad_NATS(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := config.Load([]string{"-nats-url", "nats://a.example.com:4222,tls://b.example.com:4222"},
+		env(map[string]string{"NATS_URL": "nats://env.example.com:4222"}))
+	require.NoError(t, err)
+	require.Equal(t, "nats://a.example.com:4222,tls://b.example.com:4222", cfg.Cluster.NATSURL)
+	require.NoError(t, cfg.Validate())
+}
+
+func TestLoad_DataFile(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := config.Load([]string{"-data-file", "/var/lib/docs/docs.db"},
+		env(map[string]string{"DATA_FILE": "env.db"}))
+	require.NoError(t, err)
+	require.Equal(t, "/var/lib/docs/docs.db", cfg.DataFile)
+	require.Empty(t, cfg.PostgresURL)
+}
+
+func TestLoad_JournalFile(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := config.Load(nil, env(map[string]string{"JOURNAL_FILE": "/var/lib/docs/docs.journal"}))
+	require.NoError(t, err)
+	require.Equal(t, "/var/lib/docs/docs.journal", cfg.JournalFile)
+	require.NoError(t, cfg.Validate())
+}
+
+func TestValidate_LeaseTTL(t *testing.T) {
+	t.Parallel()
+
+	_, err := config.Load([]string{"-lease-ttl", "10s"}, env(nil))
+	require.ErrorContains(t, err, "cluster: lease_ttl requires redis_url")
+
+	cfg, err := config.Load([]string{"-lease-ttl", "10s", "-redis-url", "redis://cache:6379"}, env(nil))
+	require.NoError(t, err)
+	require.Equal(t, 10*time.Second, cfg.Cluster.LeaseTTL)
+}
+
+func TestValidate_TLS(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		tls  config.TLS
+		want string
+	}{
+		{name: "cert without key", tls: config.TLS{CertFile: "cert.pem"}, want: "set together"},
+		{name: "key without cert", tls: config.TLS{KeyFile: "key.pem"}, want: "set together"},
+		{
+			name: "files and autocert",
+			tls: config.TLS{
+				CertFile: "cert.pem", KeyFile: "key.pem",
+				AutocertDomains: []string{"docs.example.com"}, AutocertCacheDir: "cache",
+			},
+			want: "mutually exclusive",
+		},
+		{
+			name: "autocert without cache",
+			tls:  config.TLS{AutocertDomains: []string{"docs.example.com"}},
+			want: "autocert_cache_dir is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := config.Default()
+			cfg.TLS = tt.tls
+			require.ErrorContains(t, cfg.Validate(), "tls: ")
+			require.ErrorContains(t, cfg.Validate(), tt.want)
+		})
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	t.Parallel()
+
+	badYAML := writeFile(t, "history_size: [1\n")
+
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{name: "unknown flag", args: []string{"-nope"}, want: "flag provided but not defined"},
+		{name: "bad flag value", args: []string{"-history-size", "x"}, want: "invalid value"},
+		{name: "missing file", args: []string{"-config", "/nonexistent.yaml"}, want: "read config file"},
+		{name: "bad file", args: []string{"-config", badYAML}, want: "parse config file"},
+		{
+			name: "bad integer",
+			env:  map[string]string{"HISTORY_SIZE": "lots"},
+			want: "HISTORY_SIZE: invalid integer",
+		},
+		{
+			name: "bad boolean",
+			env:  map[string]string{"REPAIR_DOCUMENTS": "maybe"},
+			want: "REPAIR_DOCUMENTS: invalid boolean",
+		},
+		{
+			name: "bad duration",
+			env:  map[string]string{"REQUEST_TIMEOUT": "10"},
+			want: "REQUEST_TIMEOUT: invalid duration",
+		},
+		{name: "invalid setting", args: []string{"-history-size", "0"}, want: "history_size: must be positive"},
+		{
+			name: "write timeout too short",
+			args: []string{"-request-timeout", "30s", "-write-timeout", "30s"},
+			want: "write_timeout: must be longer than request_timeout",
+		},
+		{name: "bad log format", args: []string{"-log-format", "xml"}, want: `log_format: unknown format "xml"`},
+		{name: "bad faults", args: []string{"-faults", "drop=2"}, want: "faults: fault setting drop"},
+		{name: "smtp without from", args: []string{"-smtp-addr", "smtp.example.com:25"}, want: "smtp.from: invalid"},
+		{name: "bad smtp addr", args: []string{"-smtp-addr", "smtp", "-smtp-from", "a@b.c"}, want: "smtp.addr: invalid"},
+		{
+			name: "bad batch window",
+			args: []string{"-smtp-addr", "smtp.example.com:25", "-smtp-from", "a@b.c", "-smtp-batch-window", "0s"},
+			want: "smtp.batch_window: must be positive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := config.Load(tt.args, env(tt.env))
+			require.ErrorContains(t, err, tt.want)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, config.Default().Validate())
+
+	cfg := config.Config{
+		HTTPAddr:          "8080",
+		GRPCAddr:          "",
+		PostgresURL:       "db:5432/docs?password=hunter2",
+		DataFile:          "docs.db",
+		JournalFile:       "docs.journal",
+		HistorySize:       -1,
+		SnapshotThreshold: -1,
+		AllowedOrigins: []string{
+			"*", "https://ok.example.com", "http://localhost:3000",
+			"docs.example.com", "ftp://docs.example.com", "https://docs.example.com/app", "://bad",
+		},
+		OIDC:              config.OIDC{IssuerURL: "https://issuer.example.com"},
+		LogLevel:          "loud",
+		StatsInterval:     -time.Minute,
+		CommitDelay:       -time.Millisecond,
+		SlowOperation:     -time.Second,
+		ReadHeaderTimeout: -time.Second,
+		ReadTimeout:       -time.Second,
+		WriteTimeout:      -time.Second,
+		IdleTimeout:       -time.Second,
+		OperationRate:     -1,
+		JWT:               config.JWT{Secret: "hunter2", JWKSURL: "id.example.com/jwks"},
+		Compaction:        config.Compaction{Interval: -time.Minute, MaxOperations: -1, MaxAge: -time.Hour},
+		Cluster: config.Cluster{
+			RedisURL: "cache:6379",
+			NATSURL:  "nats://a.example.com:4222, b.example.com:4222",
+			Nodes:    []string{"http://docs-1:8080", "docs-2:8080"},
+			NodeURL:  "http://docs-3:8080",
+			LeaseTTL: -time.Second,
+		},
+	}
+
+	err := cfg.Validate()
+	require.Error(t, err)
+
+	for _, want := range []string{
+		`http_addr: invalid address "8080"`,
+		`grpc_addr: invalid address ""`,
+		"postgres_url: invalid URL",
+		"postgres_url and data_file are mutually exclusive",
+		"postgres_url and journal_file are mutually exclusive",
+		"history_size: must be positive",
+		"snapshot_threshold: must not be negative",
+		`allowed_origins: invalid origin "docs.example.com"`,
+		`allowed_origins: invalid origin "ftp://docs.example.com"`,
+		`allowed_origins: invalid origin "https://docs.example.com/app"`,
+		`allowed_origins: invalid origin "://bad"`,
+		"request_timeout: must be positive",
+		"shutdown_timeout: must be positive",
+		"read_header_timeout: must not be negative",
+		"read_timeout: must not be negative",
+		"write_timeout: must not be negative",
+		"idle_timeout: must not be negative",
+		"oidc: client_id and redirect_url are required with issuer_url",
+		`log_level: unknown log level "loud"`,
+		`log_format: unknown format ""`,
+		"stats_interval: must not be negative",
+		"commit_delay: must not be negative",
+		"slow_operation: must not be negative",
+		"operation_rate: must not be negative",
+		"jwt: secret and jwks_url are mutually exclusive",
+		`jwt.jwks_url: invalid URL "id.example.com/jwks"`,
+		"jwt.secret: must be at least 32 bytes",
+		`cluster.redis_url: invalid URL "cache:6379"`,
+		`cluster.nats_url: invalid URL "b.example.com:4222"`,
+		"cluster: redis_url and nats_url are mutually exclusive",
+		`cluster.nodes: invalid URL "docs-2:8080"`,
+		"cluster: node_url must be one of nodes",
+		"cluster.lease_ttl: must not be negative",
+		"compaction.interval: must not be negative",
+		"compaction.max_operations: must not be negative",
+		"compaction.max_age: must not be negative",
+	} {
+		require.ErrorContains(t, err, want)
+	}
+
+	require.NotContains(t, err.Error(), "ok.example.com")
+	require.NotContains(t, err.Error(), "a.example.com")
+	require.NotContains(t, err.Error(), "docs-1")
+	require.NotContains(t, err.Error(), "localhost")
+	require.NotContains(t, err.Error(), "hunter2")
+}
@@ -0,0 +1,97 @@
+// Package export renders document content into downloadable file formats.
+package export
+
+import (
+	"errors"
+	"html"
+	"strings"
+)
+
+// ErrUnsupportedFormat is returned when an export format is not recognized.
+var ErrUnsupportedFormat = errors.New("unsupported export format")
+
+// Format identifies an export file format.
+type Format string
+
+const (
+	FormatText     Format = "txt"
+	FormatMarkdown Format = "md"
+	FormatHTML     Format = "html"
+)
+
+// ParseFormat converts a format name into a Format.
+// An empty name defaults to plain text.
+func ParseFormat(name string) (Format, error) {
+	switch Format(strings.ToLower(name)) {
+	case "", FormatText:
+		return FormatText, nil
+	case FormatMarkdown:
+		return FormatMarkdown, nil
+	case FormatHTML:
+		return FormatHTML, nil
+	default:
+		return "", ErrUnsupportedFormat
+	}
+}
+
+// ContentType returns the MIME type for the format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatMarkdown:
+		return "text/markdown; charset=utf-8"
+	case FormatHTML:
+		return "text/html; charset=utf-8"
+	case FormatText:
+		return "text/plain; charset=utf-8"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// Filename returns a download filename for the given document name.
+func (f Format) Filename(name string) string {
+	return name + "." + string(f)
+}
+
+// Render converts plain document content into the given format.
+// The title is used where the format supports one (e.g. the HTML <title>).
+func Render(f Format, title, content string) ([]byte, error) {
+	switch f {
+	case FormatText, FormatMarkdown:
+		// Content is plain text, which is already valid Markdown
+		return []byte(content), nil
+	case FormatHTML:
+		return []byte(renderHTML(title, content)), nil
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+// renderHTML wraps content in a standalone HTML page.
+// Blank lines separate paragraphs and single newlines become line breaks.
+func renderHTML(title, content string) string {
+	var b strings.Builder
+
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	b.WriteString("<title>" + html.EscapeString(title) + "</title>\n")
+	b.WriteString("</head>\n<body>\n")
+
+	normalized := strings.ReplaceAll(content, "\r\n", "\n")
+
+	for paragraph := range strings.SplitSeq(normalized, "\n\n") {
+		if strings.TrimSpace(paragraph) == "" {
+			continue
+		}
+
+		lines := strings.Split(paragraph, "\n")
+		for i, line := range lines {
+			lines[i] = html.EscapeString(line)
+		}
+
+		b.WriteString("<p>" + strings.Join(lines, "<br>\n") + "</p>\n")
+	}
+
+	b.WriteString("</body>\n</html>\n")
+
+	return b.String()
+}
@@ -0,0 +1,113 @@
+package export_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/export"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFormat(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		want export.Format
+	}{
+		{name: "", want: export.FormatText},
+		{name: "txt", want: export.FormatText},
+		{name: "md", want: export.FormatMarkdown},
+		{name: "HTML", want: export.FormatHTML},
+	}
+
+	for _, tt := range tests {
+		got, err := export.ParseFormat(tt.name)
+		require.NoError(t, err)
+
+		if got != tt.want {
+			t.Errorf("ParseFormat(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	_, err := export.ParseFormat("pdf")
+	if !errors.Is(err, export.ErrUnsupportedFormat) {
+		t.Errorf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+func TestFormat_ContentType(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		format export.Format
+		want   string
+	}{
+		{format: export.FormatText, want: "text/plain; charset=utf-8"},
+		{format: export.FormatMarkdown, want: "text/markdown; charset=utf-8"},
+		{format: export.FormatHTML, want: "text/html; charset=utf-8"},
+		{format: export.Format("pdf"), want: "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.format.ContentType(); got != tt.want {
+			t.Errorf("%q.ContentType() = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestFormat_Filename(t *testing.T) {
+	t.Parallel()
+
+	if got := export.FormatMarkdown.Filename("notes"); got != "notes.md" {
+		t.Errorf("expected 'notes.md', got %q", got)
+	}
+}
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+
+	t.Run("text and markdown return content unchanged", func(t *testing.T) {
+		t.Parallel()
+
+		for _, f := range []export.Format{export.FormatText, export.FormatMarkdown} {
+			out, err := export.Render(f, "doc", "# hello\nworld")
+			require.NoError(t, err)
+
+			if string(out) != "# hello\nworld" {
+				t.Errorf("%q: unexpected output %q", f, out)
+			}
+		}
+	})
+
+	t.Run("html escapes content and builds paragraphs", func(t *testing.T) {
+		t.Parallel()
+
+		out, err := export.Render(export.FormatHTML, "a<b", "x < y\nz\n\n\n\nnext")
+		require.NoError(t, err)
+
+		html := string(out)
+
+		if !strings.Contains(html, "<title>a&lt;b</title>") {
+			t.Errorf("expected escaped title, got %q", html)
+		}
+
+		if !strings.Contains(html, "<p>x &lt; y<br>\nz</p>") {
+			t.Errorf("expected first paragraph with line break, got %q", html)
+		}
+
+		if !strings.Contains(html, "<p>next</p>") {
+			t.Errorf("expected second paragraph, got %q", html)
+		}
+	})
+
+	t.Run("unsupported format returns error", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := export.Render(export.Format("pdf"), "doc", "x")
+		if !errors.Is(err, export.ErrUnsupportedFormat) {
+			t.Errorf("expected ErrUnsupportedFormat, got %v", err)
+		}
+	})
+}
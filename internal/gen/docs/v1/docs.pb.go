@@ -0,0 +1,1076 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: docs/v1/docs.proto
+
+package docsv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type OperationType int32
+
+const (
+	OperationType_OPERATION_TYPE_INSERT OperationType = 0
+	OperationType_OPERATION_TYPE_DELETE OperationType = 1
+)
+
+// Enum value maps for OperationType.
+var (
+	OperationType_name = map[int32]string{
+		0: "OPERATION_TYPE_INSERT",
+		1: "OPERATION_TYPE_DELETE",
+	}
+	OperationType_value = map[string]int32{
+		"OPERATION_TYPE_INSERT": 0,
+		"OPERATION_TYPE_DELETE": 1,
+	}
+)
+
+func (x OperationType) Enum() *OperationType {
+	p := new(OperationType)
+	*p = x
+	return p
+}
+
+func (x OperationType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (OperationType) Descriptor() protoreflect.EnumDescriptor {
+	return file_docs_v1_docs_proto_enumTypes[0].Descriptor()
+}
+
+func (OperationType) Type() protoreflect.EnumType {
+	return &file_docs_v1_docs_proto_enumTypes[0]
+}
+
+func (x OperationType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use OperationType.Descriptor instead.
+func (OperationType) EnumDescriptor() ([]byte, []int) {
+	return file_docs_v1_docs_proto_rawDescGZIP(), []int{0}
+}
+
+type Document struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Content       string                 `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"`
+	Revision      int64                  `protobuf:"varint,3,opt,name=revision,proto3" json:"revision,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Document) Reset() {
+	*x = Document{}
+	mi := &file_docs_v1_docs_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Document) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Document) ProtoMessage() {}
+
+func (x *Document) ProtoReflect() protoreflect.Message {
+	mi := &file_docs_v1_docs_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Document.ProtoReflect.Descriptor instead.
+func (*Document) Descriptor() ([]byte, []int) {
+	return file_docs_v1_docs_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Document) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Document) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *Document) GetRevision() int64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+type CreateDocumentRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Content       string                 `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateDocumentRequest) Reset() {
+	*x = CreateDocumentRequest{}
+	mi := &file_docs_v1_docs_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateDocumentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateDocumentRequest) ProtoMessage() {}
+
+func (x *CreateDocumentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_docs_v1_docs_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateDocumentRequest.ProtoReflect.Descriptor instead.
+func (*CreateDocumentRequest) Descriptor() ([]byte, []int) {
+	return file_docs_v1_docs_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CreateDocumentRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *CreateDocumentRequest) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+type GetDocumentRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Revision to read. Unset reads the current state.
+	Revision      *int64 `protobuf:"varint,2,opt,name=revision,proto3,oneof" json:"revision,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetDocumentRequest) Reset() {
+	*x = GetDocumentRequest{}
+	mi := &file_docs_v1_docs_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetDocumentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetDocumentRequest) ProtoMessage() {}
+
+func (x *GetDocumentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_docs_v1_docs_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetDocumentRequest.ProtoReflect.Descriptor instead.
+func (*GetDocumentRequest) Descriptor() ([]byte, []int) {
+	return file_docs_v1_docs_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetDocumentRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *GetDocumentRequest) GetRevision() int64 {
+	if x != nil && x.Revision != nil {
+		return *x.Revision
+	}
+	return 0
+}
+
+type DeleteDocumentRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteDocumentRequest) Reset() {
+	*x = DeleteDocumentRequest{}
+	mi := &file_docs_v1_docs_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteDocumentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteDocumentRequest) ProtoMessage() {}
+
+func (x *DeleteDocumentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_docs_v1_docs_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteDocumentRequest.ProtoReflect.Descriptor instead.
+func (*DeleteDocumentRequest) Descriptor() ([]byte, []int) {
+	return file_docs_v1_docs_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *DeleteDocumentRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type DeleteDocumentResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteDocumentResponse) Reset() {
+	*x = DeleteDocumentResponse{}
+	mi := &file_docs_v1_docs_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteDocumentResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteDocumentResponse) ProtoMessage() {}
+
+func (x *DeleteDocumentResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_docs_v1_docs_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteDocumentResponse.ProtoReflect.Descriptor instead.
+func (*DeleteDocumentResponse) Descriptor() ([]byte, []int) {
+	return file_docs_v1_docs_proto_rawDescGZIP(), []int{4}
+}
+
+type CollaborateRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Message:
+	//
+	//	*CollaborateRequest_Join
+	//	*CollaborateRequest_Operation
+	//	*CollaborateRequest_Sync
+	Message       isCollaborateRequest_Message `protobuf_oneof:"message"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CollaborateRequest) Reset() {
+	*x = CollaborateRequest{}
+	mi := &file_docs_v1_docs_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CollaborateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CollaborateRequest) ProtoMessage() {}
+
+func (x *CollaborateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_docs_v1_docs_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CollaborateRequest.ProtoReflect.Descriptor instead.
+func (*CollaborateRequest) Descriptor() ([]byte, []int) {
+	return file_docs_v1_docs_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CollaborateRequest) GetMessage() isCollaborateRequest_Message {
+	if x != nil {
+		return x.Message
+	}
+	return nil
+}
+
+func (x *CollaborateRequest) GetJoin() *Join {
+	if x != nil {
+		if x, ok := x.Message.(*CollaborateRequest_Join); ok {
+			return x.Join
+		}
+	}
+	return nil
+}
+
+func (x *CollaborateRequest) GetOperation() *Operation {
+	if x != nil {
+		if x, ok := x.Message.(*CollaborateRequest_Operation); ok {
+			return x.Operation
+		}
+	}
+	return nil
+}
+
+func (x *CollaborateRequest) GetSync() *Sync {
+	if x != nil {
+		if x, ok := x.Message.(*CollaborateRequest_Sync); ok {
+			return x.Sync
+		}
+	}
+	return nil
+}
+
+type isCollaborateRequest_Message interface {
+	isCollaborateRequest_Message()
+}
+
+type CollaborateRequest_Join struct {
+	Join *Join `protobuf:"bytes,1,opt,name=join,proto3,oneof"`
+}
+
+type CollaborateRequest_Operation struct {
+	Operation *Operation `protobuf:"bytes,2,opt,name=operation,proto3,oneof"`
+}
+
+type CollaborateRequest_Sync struct {
+	Sync *Sync `protobuf:"bytes,3,opt,name=sync,proto3,oneof"`
+}
+
+func (*CollaborateRequest_Join) isCollaborateRequest_Message() {}
+
+func (*CollaborateRequest_Operation) isCollaborateRequest_Message() {}
+
+func (*CollaborateRequest_Sync) isCollaborateRequest_Message() {}
+
+// Join subscribes the stream to a document.
+type Join struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DocumentId    string                 `protobuf:"bytes,1,opt,name=document_id,json=documentId,proto3" json:"document_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Join) Reset() {
+	*x = Join{}
+	mi := &file_docs_v1_docs_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Join) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Join) ProtoMessage() {}
+
+func (x *Join) ProtoReflect() protoreflect.Message {
+	mi := &file_docs_v1_docs_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Join.ProtoReflect.Descriptor instead.
+func (*Join) Descriptor() ([]byte, []int) {
+	return file_docs_v1_docs_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Join) GetDocumentId() string {
+	if x != nil {
+		return x.DocumentId
+	}
+	return ""
+}
+
+// Operation submits an edit based on the given revision.
+type Operation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	BaseRevision  int64                  `protobuf:"varint,1,opt,name=base_revision,json=baseRevision,proto3" json:"base_revision,omitempty"`
+	Type          OperationType          `protobuf:"varint,2,opt,name=type,proto3,enum=docs.v1.OperationType" json:"type,omitempty"`
+	Position      int64                  `protobuf:"varint,3,opt,name=position,proto3" json:"position,omitempty"`
+	Char          string                 `protobuf:"bytes,4,opt,name=char,proto3" json:"char,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Operation) Reset() {
+	*x = Operation{}
+	mi := &file_docs_v1_docs_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Operation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Operation) ProtoMessage() {}
+
+func (x *Operation) ProtoReflect() protoreflect.Message {
+	mi := &file_docs_v1_docs_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Operation.ProtoReflect.Descriptor instead.
+func (*Operation) Descriptor() ([]byte, []int) {
+	return file_docs_v1_docs_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Operation) GetBaseRevision() int64 {
+	if x != nil {
+		return x.BaseRevision
+	}
+	return 0
+}
+
+func (x *Operation) GetType() OperationType {
+	if x != nil {
+		return x.Type
+	}
+	return OperationType_OPERATION_TYPE_INSERT
+}
+
+func (x *Operation) GetPosition() int64 {
+	if x != nil {
+		return x.Position
+	}
+	return 0
+}
+
+func (x *Operation) GetChar() string {
+	if x != nil {
+		return x.Char
+	}
+	return ""
+}
+
+// Sync requests the current document state.
+type Sync struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Sync) Reset() {
+	*x = Sync{}
+	mi := &file_docs_v1_docs_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Sync) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Sync) ProtoMessage() {}
+
+func (x *Sync) ProtoReflect() protoreflect.Message {
+	mi := &file_docs_v1_docs_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Sync.ProtoReflect.Descriptor instead.
+func (*Sync) Descriptor() ([]byte, []int) {
+	return file_docs_v1_docs_proto_rawDescGZIP(), []int{8}
+}
+
+type CollaborateResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Message:
+	//
+	//	*CollaborateResponse_State
+	//	*CollaborateResponse_Ack
+	//	*CollaborateResponse_Broadcast
+	//	*CollaborateResponse_Error
+	Message       isCollaborateResponse_Message `protobuf_oneof:"message"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CollaborateResponse) Reset() {
+	*x = CollaborateResponse{}
+	mi := &file_docs_v1_docs_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CollaborateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CollaborateResponse) ProtoMessage() {}
+
+func (x *CollaborateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_docs_v1_docs_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CollaborateResponse.ProtoReflect.Descriptor instead.
+func (*CollaborateResponse) Descriptor() ([]byte, []int) {
+	return file_docs_v1_docs_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *CollaborateResponse) GetMessage() isCollaborateResponse_Message {
+	if x != nil {
+		return x.Message
+	}
+	return nil
+}
+
+func (x *CollaborateResponse) GetState() *State {
+	if x != nil {
+		if x, ok := x.Message.(*CollaborateResponse_State); ok {
+			return x.State
+		}
+	}
+	return nil
+}
+
+func (x *CollaborateResponse) GetAck() *Ack {
+	if x != nil {
+		if x, ok := x.Message.(*CollaborateResponse_Ack); ok {
+			return x.Ack
+		}
+	}
+	return nil
+}
+
+func (x *CollaborateResponse) GetBroadcast() *Broadcast {
+	if x != nil {
+		if x, ok := x.Message.(*CollaborateResponse_Broadcast); ok {
+			return x.Broadcast
+		}
+	}
+	return nil
+}
+
+func (x *CollaborateResponse) GetError() *Error {
+	if x != nil {
+		if x, ok := x.Message.(*CollaborateResponse_Error); ok {
+			return x.Error
+		}
+	}
+	return nil
+}
+
+type isCollaborateResponse_Message interface {
+	isCollaborateResponse_Message()
+}
+
+type CollaborateResponse_State struct {
+	State *State `protobuf:"bytes,1,opt,name=state,proto3,oneof"`
+}
+
+type CollaborateResponse_Ack struct {
+	Ack *Ack `protobuf:"bytes,2,opt,name=ack,proto3,oneof"`
+}
+
+type CollaborateResponse_Broadcast struct {
+	Broadcast *Broadcast `protobuf:"bytes,3,opt,name=broadcast,proto3,oneof"`
+}
+
+type CollaborateResponse_Error struct {
+	Error *Error `protobuf:"bytes,4,opt,name=error,proto3,oneof"`
+}
+
+func (*CollaborateResponse_State) isCollaborateResponse_Message() {}
+
+func (*CollaborateResponse_Ack) isCollaborateResponse_Message() {}
+
+func (*CollaborateResponse_Broadcast) isCollaborateResponse_Message() {}
+
+func (*CollaborateResponse_Error) isCollaborateResponse_Message() {}
+
+type State struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DocumentId    string                 `protobuf:"bytes,1,opt,name=document_id,json=documentId,proto3" json:"document_id,omitempty"`
+	Content       string                 `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"`
+	Revision      int64                  `protobuf:"varint,3,opt,name=revision,proto3" json:"revision,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *State) Reset() {
+	*x = State{}
+	mi := &file_docs_v1_docs_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *State) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*State) ProtoMessage() {}
+
+func (x *State) ProtoReflect() protoreflect.Message {
+	mi := &file_docs_v1_docs_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use State.ProtoReflect.Descriptor instead.
+func (*State) Descriptor() ([]byte, []int) {
+	return file_docs_v1_docs_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *State) GetDocumentId() string {
+	if x != nil {
+		return x.DocumentId
+	}
+	return ""
+}
+
+func (x *State) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *State) GetRevision() int64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+type Ack struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Revision      int64                  `protobuf:"varint,1,opt,name=revision,proto3" json:"revision,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Ack) Reset() {
+	*x = Ack{}
+	mi := &file_docs_v1_docs_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Ack) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Ack) ProtoMessage() {}
+
+func (x *Ack) ProtoReflect() protoreflect.Message {
+	mi := &file_docs_v1_docs_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Ack.ProtoReflect.Descriptor instead.
+func (*Ack) Descriptor() ([]byte, []int) {
+	return file_docs_v1_docs_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Ack) GetRevision() int64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+type Broadcast struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DocumentId    string                 `protobuf:"bytes,1,opt,name=document_id,json=documentId,proto3" json:"document_id,omitempty"`
+	Revision      int64                  `protobuf:"varint,2,opt,name=revision,proto3" json:"revision,omitempty"`
+	Type          OperationType          `protobuf:"varint,3,opt,name=type,proto3,enum=docs.v1.OperationType" json:"type,omitempty"`
+	Position      int64                  `protobuf:"varint,4,opt,name=position,proto3" json:"position,omitempty"`
+	Char          string                 `protobuf:"bytes,5,opt,name=char,proto3" json:"char,omitempty"`
+	UserId        string                 `protobuf:"bytes,6,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Broadcast) Reset() {
+	*x = Broadcast{}
+	mi := &file_docs_v1_docs_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Broadcast) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Broadcast) ProtoMessage() {}
+
+func (x *Broadcast) ProtoReflect() protoreflect.Message {
+	mi := &file_docs_v1_docs_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Broadcast.ProtoReflect.Descriptor instead.
+func (*Broadcast) Descriptor() ([]byte, []int) {
+	return file_docs_v1_docs_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Broadcast) GetDocumentId() string {
+	if x != nil {
+		return x.DocumentId
+	}
+	return ""
+}
+
+func (x *Broadcast) GetRevision() int64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+func (x *Broadcast) GetType() OperationType {
+	if x != nil {
+		return x.Type
+	}
+	return OperationType_OPERATION_TYPE_INSERT
+}
+
+func (x *Broadcast) GetPosition() int64 {
+	if x != nil {
+		return x.Position
+	}
+	return 0
+}
+
+func (x *Broadcast) GetChar() string {
+	if x != nil {
+		return x.Char
+	}
+	return ""
+}
+
+func (x *Broadcast) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+// Error reports a failed request without ending the stream.
+type Error struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          string                 `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Error) Reset() {
+	*x = Error{}
+	mi := &file_docs_v1_docs_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Error) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Error) ProtoMessage() {}
+
+func (x *Error) ProtoReflect() protoreflect.Message {
+	mi := &file_docs_v1_docs_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Error.ProtoReflect.Descriptor instead.
+func (*Error) Descriptor() ([]byte, []int) {
+	return file_docs_v1_docs_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *Error) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Error) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+var File_docs_v1_docs_proto protoreflect.FileDescriptor
+
+const file_docs_v1_docs_proto_rawDesc = "" +
+	"\n" +
+	"\x12docs/v1/docs.proto\x12\adocs.v1\"P\n" +
+	"\bDocument\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x18\n" +
+	"\acontent\x18\x02 \x01(\tR\acontent\x12\x1a\n" +
+	"\brevision\x18\x03 \x01(\x03R\brevision\"A\n" +
+	"\x15CreateDocumentRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x18\n" +
+	"\acontent\x18\x02 \x01(\tR\acontent\"R\n" +
+	"\x12GetDocumentRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1f\n" +
+	"\brevision\x18\x02 \x01(\x03H\x00R\brevision\x88\x01\x01B\v\n" +
+	"\t_revision\"'\n" +
+	"\x15DeleteDocumentRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x18\n" +
+	"\x16DeleteDocumentResponse\"\x9d\x01\n" +
+	"\x12CollaborateRequest\x12#\n" +
+	"\x04join\x18\x01 \x01(\v2\r.docs.v1.JoinH\x00R\x04join\x122\n" +
+	"\toperation\x18\x02 \x01(\v2\x12.docs.v1.OperationH\x00R\toperation\x12#\n" +
+	"\x04sync\x18\x03 \x01(\v2\r.docs.v1.SyncH\x00R\x04syncB\t\n" +
+	"\amessage\"'\n" +
+	"\x04Join\x12\x1f\n" +
+	"\vdocument_id\x18\x01 \x01(\tR\n" +
+	"documentId\"\x8c\x01\n" +
+	"\tOperation\x12#\n" +
+	"\rbase_revision\x18\x01 \x01(\x03R\fbaseRevision\x12*\n" +
+	"\x04type\x18\x02 \x01(\x0e2\x16.docs.v1.OperationTypeR\x04type\x12\x1a\n" +
+	"\bposition\x18\x03 \x01(\x03R\bposition\x12\x12\n" +
+	"\x04char\x18\x04 \x01(\tR\x04char\"\x06\n" +
+	"\x04Sync\"\xc6\x01\n" +
+	"\x13CollaborateResponse\x12&\n" +
+	"\x05state\x18\x01 \x01(\v2\x0e.docs.v1.StateH\x00R\x05state\x12 \n" +
+	"\x03ack\x18\x02 \x01(\v2\f.docs.v1.AckH\x00R\x03ack\x122\n" +
+	"\tbroadcast\x18\x03 \x01(\v2\x12.docs.v1.BroadcastH\x00R\tbroadcast\x12&\n" +
+	"\x05error\x18\x04 \x01(\v2\x0e.docs.v1.ErrorH\x00R\x05errorB\t\n" +
+	"\amessage\"^\n" +
+	"\x05State\x12\x1f\n" +
+	"\vdocument_id\x18\x01 \x01(\tR\n" +
+	"documentId\x12\x18\n" +
+	"\acontent\x18\x02 \x01(\tR\acontent\x12\x1a\n" +
+	"\brevision\x18\x03 \x01(\x03R\brevision\"!\n" +
+	"\x03Ack\x12\x1a\n" +
+	"\brevision\x18\x01 \x01(\x03R\brevision\"\xbd\x01\n" +
+	"\tBroadcast\x12\x1f\n" +
+	"\vdocument_id\x18\x01 \x01(\tR\n" +
+	"documentId\x12\x1a\n" +
+	"\brevision\x18\x02 \x01(\x03R\brevision\x12*\n" +
+	"\x04type\x18\x03 \x01(\x0e2\x16.docs.v1.OperationTypeR\x04type\x12\x1a\n" +
+	"\bposition\x18\x04 \x01(\x03R\bposition\x12\x12\n" +
+	"\x04char\x18\x05 \x01(\tR\x04char\x12\x17\n" +
+	"\auser_id\x18\x06 \x01(\tR\x06userId\"5\n" +
+	"\x05Error\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage*E\n" +
+	"\rOperationType\x12\x19\n" +
+	"\x15OPERATION_TYPE_INSERT\x10\x00\x12\x19\n" +
+	"\x15OPERATION_TYPE_DELETE\x10\x012\xb6\x02\n" +
+	"\x0fDocumentService\x12C\n" +
+	"\x0eCreateDocument\x12\x1e.docs.v1.CreateDocumentRequest\x1a\x11.docs.v1.Document\x12=\n" +
+	"\vGetDocument\x12\x1b.docs.v1.GetDocumentRequest\x1a\x11.docs.v1.Document\x12Q\n" +
+	"\x0eDeleteDocument\x12\x1e.docs.v1.DeleteDocumentRequest\x1a\x1f.docs.v1.DeleteDocumentResponse\x12L\n" +
+	"\vCollaborate\x12\x1b.docs.v1.CollaborateRequest\x1a\x1c.docs.v1.CollaborateResponse(\x010\x01B<Z:github.com/serroba/online-docs/internal/gen/docs/v1;docsv1b\x06proto3"
+
+var (
+	file_docs_v1_docs_proto_rawDescOnce sync.Once
+	file_docs_v1_docs_proto_rawDescData []byte
+)
+
+func file_docs_v1_docs_proto_rawDescGZIP() []byte {
+	file_docs_v1_docs_proto_rawDescOnce.Do(func() {
+		file_docs_v1_docs_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_docs_v1_docs_proto_rawDesc), len(file_docs_v1_docs_proto_rawDesc)))
+	})
+	return file_docs_v1_docs_proto_rawDescData
+}
+
+var file_docs_v1_docs_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_docs_v1_docs_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_docs_v1_docs_proto_goTypes = []any{
+	(OperationType)(0),             // 0: docs.v1.OperationType
+	(*Document)(nil),               // 1: docs.v1.Document
+	(*CreateDocumentRequest)(nil),  // 2: docs.v1.CreateDocumentRequest
+	(*GetDocumentRequest)(nil),     // 3: docs.v1.GetDocumentRequest
+	(*DeleteDocumentRequest)(nil),  // 4: docs.v1.DeleteDocumentRequest
+	(*DeleteDocumentResponse)(nil), // 5: docs.v1.DeleteDocumentResponse
+	(*CollaborateRequest)(nil),     // 6: docs.v1.CollaborateRequest
+	(*Join)(nil),                   // 7: docs.v1.Join
+	(*Operation)(nil),              // 8: docs.v1.Operation
+	(*Sync)(nil),                   // 9: docs.v1.Sync
+	(*CollaborateResponse)(nil),    // 10: docs.v1.CollaborateResponse
+	(*State)(nil),                  // 11: docs.v1.State
+	(*Ack)(nil),                    // 12: docs.v1.Ack
+	(*Broadcast)(nil),              // 13: docs.v1.Broadcast
+	(*Error)(nil),                  // 14: docs.v1.Error
+}
+var file_docs_v1_docs_proto_depIdxs = []int32{
+	7,  // 0: docs.v1.CollaborateRequest.join:type_name -> docs.v1.Join
+	8,  // 1: docs.v1.CollaborateRequest.operation:type_name -> docs.v1.Operation
+	9,  // 2: docs.v1.CollaborateRequest.sync:type_name -> docs.v1.Sync
+	0,  // 3: docs.v1.Operation.type:type_name -> docs.v1.OperationType
+	11, // 4: docs.v1.CollaborateResponse.state:type_name -> docs.v1.State
+	12, // 5: docs.v1.CollaborateResponse.ack:type_name -> docs.v1.Ack
+	13, // 6: docs.v1.CollaborateResponse.broadcast:type_name -> docs.v1.Broadcast
+	14, // 7: docs.v1.CollaborateResponse.error:type_name -> docs.v1.Error
+	0,  // 8: docs.v1.Broadcast.type:type_name -> docs.v1.OperationType
+	2,  // 9: docs.v1.DocumentService.CreateDocument:input_type -> docs.v1.CreateDocumentRequest
+	3,  // 10: docs.v1.DocumentService.GetDocument:input_type -> docs.v1.GetDocumentRequest
+	4,  // 11: docs.v1.DocumentService.DeleteDocument:input_type -> docs.v1.DeleteDocumentRequest
+	6,  // 12: docs.v1.DocumentService.Collaborate:input_type -> docs.v1.CollaborateRequest
+	1,  // 13: docs.v1.DocumentService.CreateDocument:output_type -> docs.v1.Document
+	1,  // 14: docs.v1.DocumentService.GetDocument:output_type -> docs.v1.Document
+	5,  // 15: docs.v1.DocumentService.DeleteDocument:output_type -> docs.v1.DeleteDocumentResponse
+	10, // 16: docs.v1.DocumentService.Collaborate:output_type -> docs.v1.CollaborateResponse
+	13, // [13:17] is the sub-list for method output_type
+	9,  // [9:13] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_docs_v1_docs_proto_init() }
+func file_docs_v1_docs_proto_init() {
+	if File_docs_v1_docs_proto != nil {
+		return
+	}
+	file_docs_v1_docs_proto_msgTypes[2].OneofWrappers = []any{}
+	file_docs_v1_docs_proto_msgTypes[5].OneofWrappers = []any{
+		(*CollaborateRequest_Join)(nil),
+		(*CollaborateRequest_Operation)(nil),
+		(*CollaborateRequest_Sync)(nil),
+	}
+	file_docs_v1_docs_proto_msgTypes[9].OneofWrappers = []any{
+		(*CollaborateResponse_State)(nil),
+		(*CollaborateResponse_Ack)(nil),
+		(*CollaborateResponse_Broadcast)(nil),
+		(*CollaborateResponse_Error)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_docs_v1_docs_proto_rawDesc), len(file_docs_v1_docs_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   14,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_docs_v1_docs_proto_goTypes,
+		DependencyIndexes: file_docs_v1_docs_proto_depIdxs,
+		EnumInfos:         file_docs_v1_docs_proto_enumTypes,
+		MessageInfos:      file_docs_v1_docs_proto_msgTypes,
+	}.Build()
+	File_docs_v1_docs_proto = out.File
+	file_docs_v1_docs_proto_goTypes = nil
+	file_docs_v1_docs_proto_depIdxs = nil
+}
@@ -0,0 +1,62 @@
+package graphqlapi
+
+import (
+	"errors"
+
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/cluster"
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// queryError is a resolver error carrying an API error code, which the
+// GraphQL executor reports in the error's extensions.
+type queryError struct {
+	code    string
+	message string
+}
+
+func newQueryError(code, message string) *queryError {
+	return &queryError{code: code, message: message}
+}
+
+func (e *queryError) Error() string {
+	return e.message
+}
+
+// Extensions implements the graphql-go extensions interface.
+func (e *queryError) Extensions() map[string]any {
+	return map[string]any{"code": e.code}
+}
+
+// toSubscriptionError converts a resolver error for the subscription
+// executor, which only preserves extensions on *gqlerrors.QueryError.
+func toSubscriptionError(err error) *gqlerrors.QueryError {
+	var qerr *queryError
+	if !errors.As(err, &qerr) {
+		qerr = toQueryError(err)
+	}
+
+	return &gqlerrors.QueryError{Message: qerr.message, Extensions: qerr.Extensions()}
+}
+
+// toQueryError maps domain errors to GraphQL errors.
+func toQueryError(err error) *queryError {
+	switch {
+	case errors.Is(err, storage.ErrDocumentNotFound):
+		return newQueryError(apitypes.ErrorCodeNotFound, "document not found")
+	case errors.Is(err, storage.ErrDocumentExists):
+		return newQueryError(apitypes.ErrorCodeConflict, "document already exists")
+	case errors.Is(err, storage.ErrRevisionNotFound):
+		return newQueryError(apitypes.ErrorCodeNotFound, "revision not found")
+	case errors.Is(err, storage.ErrRevisionCompacted):
+		return newQueryError(apitypes.ErrorCodeGone, "revision no longer available")
+	case errors.Is(err, acl.ErrAccessDenied):
+		return newQueryError(apitypes.ErrorCodeAccessDenied, "access denied")
+	case errors.Is(err, cluster.ErrNotOwner):
+		return newQueryError(apitypes.ErrorCodeMisdirectedRequest, "document is owned by another node")
+	default:
+		return newQueryError(apitypes.ErrorCodeInternalError, "internal server error")
+	}
+}
@@ -0,0 +1,177 @@
+// Package graphqlapi exposes documents, permissions, history, and presence
+// through a GraphQL schema.
+package graphqlapi
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apikey"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/webhook"
+	"github.com/serroba/online-docs/internal/ws"
+)
+
+// Schema is the GraphQL schema definition.
+//
+//go:embed schema.graphql
+var Schema string
+
+// Handler serves GraphQL requests.
+type Handler struct {
+	schema *graphql.Schema
+}
+
+// Config holds configuration for creating a handler.
+type Config struct {
+	Manager   *collab.Manager
+	Store     storage.Store
+	PermStore acl.Store
+	Hub       *ws.Hub
+	Webhooks  *webhook.Service // Optional: receives document.created and document.deleted events
+	Logger    *slog.Logger     // Optional: defaults to slog.Default()
+
+	// Owns reports whether this node serves a document. Documents it
+	// doesn't own are refused, as their sessions run on another node.
+	// Optional: every document is served when nil.
+	Owns func(docID string) bool
+}
+
+// NewHandler creates a new GraphQL handler.
+func NewHandler(cfg Config) *Handler {
+	res := &resolver{
+		manager:   cfg.Manager,
+		store:     cfg.Store,
+		permStore: cfg.PermStore,
+		hub:       cfg.Hub,
+		webhooks:  cfg.Webhooks,
+		owns:      cfg.Owns,
+		logger:    logging.Component(cfg.Logger, "graphql"),
+	}
+
+	return &Handler{schema: graphql.MustParseSchema(Schema, res)}
+}
+
+// Caller identifies the authenticated user of a request.
+type Caller struct {
+	UserID string
+	Key    *apikey.Key // Set when authenticated with an API key
+}
+
+// allows reports whether the caller's credentials permit an action.
+// Document roles are checked separately.
+func (c Caller) allows(action acl.Action) bool {
+	return c.Key == nil || c.Key.Allows(action)
+}
+
+type callerKey struct{}
+
+// WithCaller returns a new context carrying the caller.
+func WithCaller(ctx context.Context, caller Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// callerFromContext returns the caller of the request.
+func callerFromContext(ctx context.Context) Caller {
+	caller, _ := ctx.Value(callerKey{}).(Caller)
+
+	return caller
+}
+
+// request is a GraphQL request body.
+type request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// ServeHTTP executes a GraphQL request sent as a JSON POST body.
+// Clients that accept text/event-stream get subscription results as
+// server-sent events instead.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+
+			return
+		}
+
+		writeError(w, http.StatusBadRequest, "invalid request body")
+
+		return
+	}
+
+	if r.Header.Get("Accept") == "text/event-stream" {
+		h.serveEvents(w, r, req)
+
+		return
+	}
+
+	resp := h.schema.Exec(r.Context(), req.Query, req.OperationName, req.Variables)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// serveEvents streams results as server-sent events until the subscription
+// ends or the client disconnects.
+func (h *Handler) serveEvents(w http.ResponseWriter, r *http.Request, req request) {
+	results, err := h.schema.Subscribe(r.Context(), req.Query, req.OperationName, req.Variables)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	// Send headers right away so clients see the stream open
+	rc := http.NewResponseController(w)
+	_ = rc.Flush()
+
+	for result := range results {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return
+		}
+
+		if _, err := fmt.Fprintf(w, "event: next\ndata: %s\n\n", data); err != nil {
+			return
+		}
+
+		_ = rc.Flush()
+	}
+
+	_, _ = fmt.Fprint(w, "event: complete\ndata:\n\n")
+}
+
+// writeError writes an error in the same format as the REST API.
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(apitypes.ErrorResponse{
+		Code:    apitypes.ErrorCodeForStatus(status),
+		Message: message,
+	})
+}
@@ -0,0 +1,493 @@
+package graphqlapi_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apikey"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/graphqlapi"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/webhook"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+type testEnv struct {
+	store     *storage.MemoryStore
+	permStore *acl.MemoryStore
+	hub       *ws.Hub
+	manager   *collab.Manager
+	handler   *graphqlapi.Handler
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	permStore := acl.NewMemoryStore()
+	hub := ws.NewHub()
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore, Hub: hub})
+
+	return &testEnv{
+		store:     store,
+		permStore: permStore,
+		hub:       hub,
+		manager:   manager,
+		handler: graphqlapi.NewHandler(graphqlapi.Config{
+			Manager:   manager,
+			Store:     store,
+			PermStore: permStore,
+			Hub:       hub,
+		}),
+	}
+}
+
+type response struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+func (e *testEnv) exec(t *testing.T, caller graphqlapi.Caller, query string, vars map[string]any) response {
+	t.Helper()
+
+	body, err := json.Marshal(map[string]any{"query": query, "variables": vars})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+	req = req.WithContext(graphqlapi.WithCaller(req.Context(), caller))
+
+	rec := httptest.NewRecorder()
+	e.handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp response
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+
+	return resp
+}
+
+func errorCode(resp response) string {
+	if len(resp.Errors) == 0 {
+		return ""
+	}
+
+	code, _ := resp.Errors[0].Extensions["code"].(string)
+
+	return code
+}
+
+var alice = graphqlapi.Caller{UserID: "alice"}
+
+func TestCreateDocument_GeneratedID(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t)
+
+	resp := env.exec(t, alice, `mutation { createDocument(id: "") { id } }`, nil)
+	require.Empty(t, resp.Errors)
+
+	var doc struct{ ID string }
+	require.NoError(t, json.Unmarshal(resp.Data["createDocument"], &doc))
+	require.NotEmpty(t, doc.ID)
+}
+
+func TestCreateAndQueryDocument(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t)
+
+	resp := env.exec(t, alice, `mutation { createDocument(id: "doc1", content: "hi") { id content revision } }`, nil)
+	require.Empty(t, resp.Errors)
+	require.JSONEq(t, `{"id": "doc1", "content": "hi", "revision": 0}`, string(resp.Data["createDocument"]))
+
+	session, err := env.manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	_, err = session.ApplyOperation("c1", "alice", ot.NewInsert("!", 2, "alice"), 0)
+	require.NoError(t, err)
+
+	_, err = session.ApplyOperation("c1", "alice", ot.NewDelete(0, "alice"), 1)
+	require.NoError(t, err)
+
+	resp = env.exec(t, alice, `query($id: ID!) {
+		document(id: $id) {
+			content
+			revision
+			permissions { userId role }
+			history { revision type position char userId }
+			recent: history(since: 1) { revision }
+			presence
+		}
+	}`, map[string]any{"id": "doc1"})
+	require.Empty(t, resp.Errors)
+	require.JSONEq(t, `{
+		"content": "i!",
+		"revision": 2,
+		"permissions": [{"userId": "alice", "role": "OWNER"}],
+		"history": [
+			{"revision": 1, "type": "INSERT", "position": 2, "char": "!", "userId": "alice"},
+			{"revision": 2, "type": "DELETE", "position": 0, "char": null, "userId": "alice"}
+		],
+		"recent": [{"revision": 2}],
+		"presence": []
+	}`, string(resp.Data["document"]))
+
+	resp = env.exec(t, alice, `{ document(id: "doc1", revision: 0) { content revision } }`, nil)
+	require.Empty(t, resp.Errors)
+	require.JSONEq(t, `{"content": "hi", "revision": 0}`, string(resp.Data["document"]))
+}
+
+func TestDocumentPresence(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t)
+	require.NoError(t, env.store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, env.permStore.Grant("doc1", "alice", acl.Editor))
+	require.NoError(t, env.permStore.Grant("doc1", "bob", acl.Viewer))
+
+	client := ws.NewClient("c1", "bob", nil)
+	env.hub.Register(client)
+	env.hub.Subscribe(client, "doc1")
+
+	notes := ws.NewClient("c2", "bot:alice/notes", nil)
+	notes.Bot = true
+	env.hub.Register(notes)
+	env.hub.Subscribe(notes, "doc1")
+
+	resp := env.exec(t, alice,
+		`{ document(id: "doc1") { presence participants { userId bot } permissions { userId role } } }`, nil)
+	require.Empty(t, resp.Errors)
+	require.JSONEq(t, `{
+		"presence": ["bob", "bot:alice/notes"],
+		"participants": [{"userId": "bob", "bot": false}, {"userId": "bot:alice/notes", "bot": true}],
+		"permissions": [{"userId": "alice", "role": "EDITOR"}, {"userId": "bob", "role": "VIEWER"}]
+	}`, string(resp.Data["document"]))
+}
+
+func TestDeleteDocument(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t)
+	require.NoError(t, env.store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, env.permStore.Grant("doc1", "alice", acl.Owner))
+	require.NoError(t, env.permStore.Grant("doc1", "bob", acl.Editor))
+
+	resp := env.exec(t, graphqlapi.Caller{UserID: "bob"}, `mutation { deleteDocument(id: "doc1") }`, nil)
+	require.Equal(t, "access_denied", errorCode(resp))
+
+	resp = env.exec(t, alice, `mutation { deleteDocument(id: "doc1") }`, nil)
+	require.Empty(t, resp.Errors)
+	require.JSONEq(t, `true`, string(resp.Data["deleteDocument"]))
+
+	resp = env.exec(t, alice, `{ document(id: "doc1") { id } }`, nil)
+	require.Equal(t, "not_found", errorCode(resp))
+}
+
+func TestDocumentEvents(t *testing.T) {
+	t.Parallel()
+
+	events := make(chan webhook.Event, 2)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		var event webhook.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err == nil {
+			events <- event
+		}
+	}))
+	t.Cleanup(endpoint.Close)
+
+	webhooks := webhook.NewService(webhook.Config{Store: webhook.NewMemoryStore()})
+	t.Cleanup(webhooks.Close)
+
+	_, err := webhooks.Register("alice", endpoint.URL, nil)
+	require.NoError(t, err)
+
+	store := storage.NewMemoryStore()
+	env := &testEnv{
+		handler: graphqlapi.NewHandler(graphqlapi.Config{
+			Manager:  collab.NewManager(collab.ManagerConfig{Store: store}),
+			Store:    store,
+			Webhooks: webhooks,
+		}),
+	}
+
+	resp := env.exec(t, alice, `mutation { createDocument(id: "doc1") { id } }`, nil)
+	require.Empty(t, resp.Errors)
+
+	if event := <-events; event.Type != webhook.EventDocumentCreated || event.UserID != "alice" {
+		t.Errorf("unexpected created event %+v", event)
+	}
+
+	resp = env.exec(t, alice, `mutation { deleteDocument(id: "doc1") }`, nil)
+	require.Empty(t, resp.Errors)
+
+	if event := <-events; event.Type != webhook.EventDocumentDeleted || event.DocID != "doc1" {
+		t.Errorf("unexpected deleted event %+v", event)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t)
+	require.NoError(t, env.store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, env.permStore.Grant("doc1", "alice", acl.Owner))
+	require.NoError(t, env.store.CreateDocument(t.Context(), "compacted"))
+	require.NoError(t, env.store.SaveSnapshot(t.Context(), "compacted", 3, "abc"))
+	require.NoError(t, env.permStore.Grant("compacted", "alice", acl.Owner))
+
+	reader := graphqlapi.Caller{UserID: "service:alice/bot", Key: &apikey.Key{Scopes: []apikey.Scope{apikey.ScopeRead}}}
+
+	tests := []struct {
+		name   string
+		caller graphqlapi.Caller
+		query  string
+		want   string
+	}{
+		{"unauthenticated", graphqlapi.Caller{}, `{ document(id: "doc1") { id } }`, "unauthorized"},
+		{"no access", graphqlapi.Caller{UserID: "bob"}, `{ document(id: "doc1") { id } }`, "access_denied"},
+		{"unknown revision", alice, `{ document(id: "doc1", revision: 5) { id } }`, "not_found"},
+		{"compacted revision", alice, `{ document(id: "compacted", revision: 1) { id } }`, "gone"},
+		{"duplicate", alice, `mutation { createDocument(id: "doc1") { id } }`, "conflict"},
+		{"invalid id", alice, `mutation { createDocument(id: "a/b") { id } }`, "invalid_request"},
+		{"key scope", reader, `mutation { createDocument(id: "doc2") { id } }`, "access_denied"},
+		{"delete scope", reader, `mutation { deleteDocument(id: "doc1") }`, "access_denied"},
+		{"missing document", alice, `mutation { deleteDocument(id: "missing") }`, "access_denied"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp := env.exec(t, tt.caller, tt.query, nil)
+			if got := errorCode(resp); got != tt.want {
+				t.Errorf("expected error code %q, got %q (%+v)", tt.want, got, resp.Errors)
+			}
+		})
+	}
+}
+
+// failingPermStore fails to list permissions.
+type failingPermStore struct {
+	*acl.MemoryStore
+}
+
+func (failingPermStore) ListPermissions(string) ([]acl.Permission, error) {
+	return nil, errors.New("acl unavailable")
+}
+
+func TestInternalErrors(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	permStore := failingPermStore{MemoryStore: acl.NewMemoryStore()}
+	hub := ws.NewHub()
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore, Hub: hub})
+	env := &testEnv{
+		handler: graphqlapi.NewHandler(graphqlapi.Config{
+			Manager:   manager,
+			Store:     store,
+			PermStore: permStore,
+			Hub:       hub,
+		}),
+	}
+
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Owner))
+
+	resp := env.exec(t, alice, `{ document(id: "doc1") { permissions { userId } } }`, nil)
+	if got := errorCode(resp); got != "internal_error" {
+		t.Errorf("expected error code %q, got %q (%+v)", "internal_error", got, resp.Errors)
+	}
+
+	if strings.Contains(resp.Errors[0].Message, "acl unavailable") {
+		t.Errorf("expected internal details to be hidden, got %q", resp.Errors[0].Message)
+	}
+}
+
+func TestDocument_WithoutPermStore(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	hub := ws.NewHub()
+	env := &testEnv{
+		handler: graphqlapi.NewHandler(graphqlapi.Config{
+			Manager: collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub}),
+			Store:   store,
+			Hub:     hub,
+		}),
+	}
+
+	resp := env.exec(t, alice, `mutation { createDocument(id: "doc1") { permissions { userId } } }`, nil)
+	require.Empty(t, resp.Errors)
+	require.JSONEq(t, `{"permissions": []}`, string(resp.Data["createDocument"]))
+}
+
+func TestDocument_OwnedElsewhere(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	hub := ws.NewHub()
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub})
+	env := &testEnv{
+		handler: graphqlapi.NewHandler(graphqlapi.Config{
+			Manager: manager,
+			Store:   store,
+			Hub:     hub,
+			Owns:    func(docID string) bool { return docID != "remote" },
+		}),
+	}
+
+	require.NoError(t, store.CreateDocument(t.Context(), "remote"))
+
+	for _, query := range []string{
+		`{ document(id: "remote") { content } }`,
+		`mutation { deleteDocument(id: "remote") }`,
+	} {
+		resp := env.exec(t, alice, query, nil)
+		require.Equal(t, "misdirected_request", errorCode(resp), query)
+	}
+
+	body := `{"query": "subscription { operations(documentId: \"remote\") { revision } }"}`
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(body))
+	req.Header.Set("Accept", "text/event-stream")
+	req = req.WithContext(graphqlapi.WithCaller(req.Context(), alice))
+
+	rec := httptest.NewRecorder()
+	env.handler.ServeHTTP(rec, req)
+	require.Contains(t, rec.Body.String(), `"code":"misdirected_request"`)
+
+	// The document was neither opened nor deleted here
+	require.Nil(t, manager.GetSession("remote"))
+
+	exists, err := store.DocumentExists(t.Context(), "remote")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// Documents this node owns are served
+	resp := env.exec(t, alice, `mutation { createDocument(id: "local") { id } }`, nil)
+	require.Empty(t, resp.Errors)
+}
+
+func TestServeHTTP_BadRequests(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t)
+
+	rec := httptest.NewRecorder()
+	env.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/graphql", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = httptest.NewRecorder()
+	env.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader("{")))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), `"code":"invalid_request"`)
+}
+
+func TestSubscription(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t)
+	require.NoError(t, env.store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, env.permStore.Grant("doc1", "alice", acl.Owner))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		env.handler.ServeHTTP(w, r.WithContext(graphqlapi.WithCaller(r.Context(), alice)))
+	}))
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	body := `{"query": "subscription { operations(documentId: \"doc1\") { revision type position char userId } }"}`
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// Wait for the subscription to join the hub before editing
+	require.Eventually(t, func() bool { return env.hub.ClientCount("doc1") == 1 }, time.Second, 5*time.Millisecond)
+
+	session, err := env.manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	_, err = session.ApplyOperation("editor", "alice", ot.NewInsert("x", 0, "alice"), 0)
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(resp.Body)
+
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "event: next\n", line)
+
+	line, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	require.JSONEq(t,
+		`{"data": {"operations": {"revision": 1, "type": "INSERT", "position": 0, "char": "x", "userId": "alice"}}}`,
+		strings.TrimPrefix(line, "data: "))
+
+	cancel()
+
+	require.Eventually(t, func() bool { return env.hub.ClientCount("doc1") == 0 }, time.Second, 5*time.Millisecond)
+}
+
+func TestSubscription_Errors(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t)
+	require.NoError(t, env.store.CreateDocument(t.Context(), "doc1"))
+
+	tests := []struct {
+		name   string
+		caller graphqlapi.Caller
+		query  string
+		want   string
+	}{
+		{"missing document", alice, `subscription { operations(documentId: "missing") { revision } }`, "not_found"},
+		{"no access", alice, `subscription { operations(documentId: "doc1") { revision } }`, "access_denied"},
+		{"unauthenticated", graphqlapi.Caller{}, `subscription { operations(documentId: "doc1") { revision } }`,
+			"unauthorized"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			body, err := json.Marshal(map[string]string{"query": tt.query})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+			req.Header.Set("Accept", "text/event-stream")
+			req = req.WithContext(graphqlapi.WithCaller(req.Context(), tt.caller))
+
+			rec := httptest.NewRecorder()
+			env.handler.ServeHTTP(rec, req)
+
+			if !strings.Contains(rec.Body.String(), `"code":"`+tt.want+`"`) {
+				t.Errorf("expected %s error, got %s", tt.want, rec.Body.String())
+			}
+
+			if !strings.HasSuffix(rec.Body.String(), "event: complete\ndata:\n\n") {
+				t.Errorf("expected stream to complete, got %s", rec.Body.String())
+			}
+		})
+	}
+}
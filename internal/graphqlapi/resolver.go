@@ -0,0 +1,431 @@
+package graphqlapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/cluster"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/webhook"
+	"github.com/serroba/online-docs/internal/ws"
+)
+
+// errUnauthenticated is returned when a request carries no caller.
+var errUnauthenticated = newQueryError(apitypes.ErrorCodeUnauthorized, "authentication required")
+
+// resolver is the root resolver for queries, mutations, and subscriptions.
+type resolver struct {
+	manager   *collab.Manager
+	store     storage.Store
+	permStore acl.Store
+	hub       *ws.Hub
+	webhooks  *webhook.Service
+	owns      func(docID string) bool
+	logger    *slog.Logger
+}
+
+// serves returns an error for documents another node owns.
+func (r *resolver) serves(docID string) error {
+	if r.owns != nil && !r.owns(docID) {
+		return cluster.ErrNotOwner
+	}
+
+	return nil
+}
+
+// authorize returns the caller if their credentials permit the action.
+func authorize(ctx context.Context, action acl.Action) (Caller, error) {
+	caller := callerFromContext(ctx)
+	if caller.UserID == "" {
+		return Caller{}, errUnauthenticated
+	}
+
+	if !caller.allows(action) {
+		return Caller{}, newQueryError(apitypes.ErrorCodeAccessDenied, "API key scope does not permit "+action.String())
+	}
+
+	return caller, nil
+}
+
+// Document resolves Query.document.
+func (r *resolver) Document(ctx context.Context, args struct {
+	ID       graphql.ID
+	Revision *int32
+}) (*documentResolver, error) {
+	caller, err := authorize(ctx, acl.ActionRead)
+	if err != nil {
+		return nil, err
+	}
+
+	docID := string(args.ID)
+	if err := r.serves(docID); err != nil {
+		return nil, toQueryError(err)
+	}
+
+	session, err := r.manager.GetOrCreateSession(ctx, docID)
+	if err != nil {
+		return nil, toQueryError(err)
+	}
+
+	if args.Revision == nil {
+		content, revision, err := session.GetState(caller.UserID)
+		if err != nil {
+			return nil, toQueryError(err)
+		}
+
+		return &documentResolver{r: r, id: docID, content: content, revision: revision}, nil
+	}
+
+	revision := int(*args.Revision)
+
+	content, err := session.GetStateAt(ctx, caller.UserID, revision)
+	if err != nil {
+		return nil, toQueryError(err)
+	}
+
+	return &documentResolver{r: r, id: docID, content: content, revision: revision}, nil
+}
+
+// CreateDocument resolves Mutation.createDocument.
+func (r *resolver) CreateDocument(ctx context.Context, args struct {
+	ID      graphql.ID
+	Content *string
+}) (*documentResolver, error) {
+	caller, err := authorize(ctx, acl.ActionWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	req := apitypes.CreateDocumentRequest{ID: string(args.ID)}
+	if args.Content != nil {
+		req.Content = *args.Content
+	}
+
+	if err := req.Validate(); err != nil {
+		return nil, newQueryError(apitypes.ErrorCodeInvalidRequest, err.Error())
+	}
+
+	if req.ID == "" {
+		req.ID = uuid.New().String()
+	}
+
+	if err := r.store.CreateDocument(ctx, req.ID); err != nil {
+		return nil, toQueryError(err)
+	}
+
+	// Seed the initial content as the revision 0 snapshot
+	if req.Content != "" {
+		if err := r.store.SaveSnapshot(ctx, req.ID, 0, req.Content); err != nil {
+			_ = r.store.DeleteDocument(context.WithoutCancel(ctx), req.ID)
+
+			return nil, toQueryError(err)
+		}
+	}
+
+	if r.permStore != nil {
+		if err := r.permStore.Grant(req.ID, caller.UserID, acl.Owner); err != nil {
+			r.logger.ErrorContext(ctx, "failed to grant owner role",
+				logging.DocID(req.ID), logging.UserID(caller.UserID), logging.Err(err))
+		}
+	}
+
+	r.publishEvent(webhook.EventDocumentCreated, req.ID, caller.UserID)
+
+	return &documentResolver{r: r, id: req.ID, content: req.Content}, nil
+}
+
+// DeleteDocument resolves Mutation.deleteDocument.
+func (r *resolver) DeleteDocument(ctx context.Context, args struct{ ID graphql.ID }) (bool, error) {
+	caller, err := authorize(ctx, acl.ActionDelete)
+	if err != nil {
+		return false, err
+	}
+
+	docID := string(args.ID)
+	if err := r.serves(docID); err != nil {
+		return false, toQueryError(err)
+	}
+
+	if r.permStore != nil {
+		checker := acl.NewChecker(r.permStore)
+		if err := checker.RequirePermission(docID, caller.UserID, acl.ActionDelete); err != nil {
+			return false, toQueryError(err)
+		}
+	}
+
+	if err := r.manager.DeleteDocument(ctx, docID); err != nil {
+		return false, toQueryError(err)
+	}
+
+	r.publishEvent(webhook.EventDocumentDeleted, docID, caller.UserID)
+
+	return true, nil
+}
+
+// publishEvent notifies webhooks of a document lifecycle event.
+func (r *resolver) publishEvent(eventType webhook.EventType, docID, userID string) {
+	if r.webhooks == nil {
+		return
+	}
+
+	r.webhooks.Publish(webhook.Event{Type: eventType, DocID: docID, UserID: userID})
+}
+
+// Operations resolves Subscription.operations. The subscription is
+// registered with the hub like a WebSocket client and ends with the context.
+func (r *resolver) Operations(ctx context.Context, args struct{ DocumentID graphql.ID }) (
+	<-chan *operationResolver, error,
+) {
+	caller, err := authorize(ctx, acl.ActionRead)
+	if err != nil {
+		return nil, toSubscriptionError(err)
+	}
+
+	docID := string(args.DocumentID)
+	if err := r.serves(docID); err != nil {
+		return nil, toSubscriptionError(err)
+	}
+
+	// Loading the session checks that the document exists
+	session, err := r.manager.GetOrCreateSession(ctx, docID)
+	if err != nil {
+		return nil, toSubscriptionError(err)
+	}
+
+	if _, _, err := session.GetState(caller.UserID); err != nil {
+		return nil, toSubscriptionError(err)
+	}
+
+	events := make(chan *operationResolver)
+	client := ws.NewClient(uuid.New().String(), caller.UserID, &eventConn{done: ctx.Done(), events: events})
+
+	r.hub.Register(client)
+	r.hub.Subscribe(client, docID)
+
+	go func() {
+		<-ctx.Done()
+		r.hub.Unregister(client)
+	}()
+
+	return events, nil
+}
+
+// documentResolver resolves Document fields.
+type documentResolver struct {
+	r        *resolver
+	id       string
+	content  string
+	revision int
+}
+
+func (d *documentResolver) ID() graphql.ID {
+	return graphql.ID(d.id)
+}
+
+func (d *documentResolver) Content() string {
+	return d.content
+}
+
+func (d *documentResolver) Revision() int32 {
+	return toInt32(d.revision)
+}
+
+// Permissions lists the users with access to the document, ordered by user ID.
+func (d *documentResolver) Permissions() ([]*permissionResolver, error) {
+	if d.r.permStore == nil {
+		return []*permissionResolver{}, nil
+	}
+
+	perms, err := d.r.permStore.ListPermissions(d.id)
+	if err != nil {
+		return nil, toQueryError(err)
+	}
+
+	slices.SortFunc(perms, func(a, b acl.Permission) int {
+		return strings.Compare(a.UserID, b.UserID)
+	})
+
+	resolvers := make([]*permissionResolver, 0, len(perms))
+	for _, p := range perms {
+		resolvers = append(resolvers, &permissionResolver{p: p})
+	}
+
+	return resolvers, nil
+}
+
+// History lists retained operations after a revision.
+func (d *documentResolver) History(ctx context.Context, args struct{ Since *int32 }) ([]*operationResolver, error) {
+	since := 0
+	if args.Since != nil {
+		since = int(*args.Since)
+	}
+
+	ops, err := d.r.store.LoadOperations(ctx, d.id, since)
+	if err != nil {
+		return nil, toQueryError(err)
+	}
+
+	resolvers := make([]*operationResolver, 0, len(ops))
+	for _, op := range ops {
+		resolvers = append(resolvers, &operationResolver{op: op})
+	}
+
+	return resolvers, nil
+}
+
+// Presence lists users currently connected to the document.
+func (d *documentResolver) Presence() []graphql.ID {
+	users := d.r.hub.Presence(d.id)
+
+	ids := make([]graphql.ID, 0, len(users))
+	for _, userID := range users {
+		ids = append(ids, graphql.ID(userID))
+	}
+
+	return ids
+}
+
+// Participants lists users and bots currently connected to the document.
+func (d *documentResolver) Participants() []*participantResolver {
+	participants := d.r.hub.Participants(d.id)
+
+	resolvers := make([]*participantResolver, 0, len(participants))
+	for _, p := range participants {
+		resolvers = append(resolvers, &participantResolver{p: p})
+	}
+
+	return resolvers
+}
+
+// participantResolver resolves Participant fields.
+type participantResolver struct {
+	p ws.Participant
+}
+
+func (p *participantResolver) UserID() graphql.ID {
+	return graphql.ID(p.p.UserID)
+}
+
+func (p *participantResolver) Bot() bool {
+	return p.p.Bot
+}
+
+// permissionResolver resolves Permission fields.
+type permissionResolver struct {
+	p acl.Permission
+}
+
+func (p *permissionResolver) UserID() graphql.ID {
+	return graphql.ID(p.p.UserID)
+}
+
+func (p *permissionResolver) Role() string {
+	switch p.p.Role {
+	case acl.Owner:
+		return "OWNER"
+	case acl.Editor:
+		return "EDITOR"
+	default:
+		return "VIEWER"
+	}
+}
+
+// operationResolver resolves Operation fields.
+type operationResolver struct {
+	op ot.SequencedOperation
+}
+
+func (o *operationResolver) Revision() int32 {
+	return toInt32(o.op.Revision)
+}
+
+func (o *operationResolver) Type() string {
+	if o.op.Type == ot.Delete {
+		return "DELETE"
+	}
+
+	return "INSERT"
+}
+
+func (o *operationResolver) Position() int32 {
+	return toInt32(o.op.Position)
+}
+
+func (o *operationResolver) Char() *string {
+	if o.op.Type == ot.Delete {
+		return nil
+	}
+
+	return &o.op.Char
+}
+
+func (o *operationResolver) UserID() graphql.ID {
+	return graphql.ID(o.op.UserID)
+}
+
+// eventConn adapts a subscription to ws.Conn so the hub can deliver
+// broadcasts to it.
+type eventConn struct {
+	done   <-chan struct{} // Closed when the subscription ends
+	events chan<- *operationResolver
+}
+
+// WriteJSON forwards operation broadcasts to the subscription.
+func (c *eventConn) WriteJSON(v any) error {
+	msg, ok := v.(ws.Message)
+	if !ok {
+		return nil
+	}
+
+	payload, ok := msg.Payload.(ws.BroadcastPayload)
+	if !ok {
+		return nil
+	}
+
+	op := ot.SequencedOperation{
+		Operation: ot.Operation{
+			Type:     ot.OpType(payload.OpType),
+			Position: payload.Position,
+			Char:     payload.Char,
+			UserID:   payload.UserID,
+		},
+		Revision: payload.Revision,
+	}
+
+	select {
+	case c.events <- &operationResolver{op: op}:
+		return nil
+	case <-c.done:
+		return context.Canceled
+	}
+}
+
+// ReadJSON is not supported; subscriptions only receive.
+func (c *eventConn) ReadJSON(_ any) error {
+	return errors.ErrUnsupported
+}
+
+// Close is a no-op; the subscription ends with its context.
+func (c *eventConn) Close() error {
+	return nil
+}
+
+// toInt32 converts a count to a GraphQL Int, saturating on overflow.
+func toInt32(n int) int32 {
+	if n > math.MaxInt32 {
+		return math.MaxInt32
+	}
+
+	return int32(n)
+}
@@ -0,0 +1,79 @@
+package grpcapi
+
+import (
+	"context"
+	"strings"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apikey"
+	"github.com/serroba/online-docs/internal/bot"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata keys used for authentication.
+const (
+	metadataUserID = "x-user-id"
+	metadataAPIKey = "x-api-key"
+)
+
+// caller identifies the authenticated principal of an RPC.
+type caller struct {
+	userID string
+	key    *apikey.Key // Set when authenticated with an API key
+}
+
+// canWrite reports whether the caller's credentials permit edits.
+func (c caller) canWrite() bool {
+	return c.key == nil || c.key.Allows(acl.ActionWrite)
+}
+
+// authenticate resolves the caller from request metadata and checks that
+// API key scopes permit the action. Document roles are checked separately.
+func (s *Server) authenticate(ctx context.Context, action acl.Action) (caller, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if secret := firstValue(md, metadataAPIKey); secret != "" && s.apiKeys != nil {
+		key, err := s.apiKeys.Authenticate(secret)
+		if err != nil {
+			return caller{}, status.Error(codes.Unauthenticated, "invalid API key")
+		}
+
+		if !key.Allows(action) {
+			return caller{}, status.Error(codes.PermissionDenied, "API key scope does not permit "+action.String())
+		}
+
+		return caller{userID: key.Principal(), key: &key}, nil
+	}
+
+	if s.requireAPIKey {
+		return caller{}, status.Error(codes.Unauthenticated, "missing x-api-key metadata")
+	}
+
+	userID := firstValue(md, metadataUserID)
+	if userID == "" {
+		return caller{}, status.Error(codes.Unauthenticated, "missing x-user-id metadata")
+	}
+
+	// Service identities may only be assumed with a valid API key
+	if strings.HasPrefix(userID, apikey.PrincipalPrefix) {
+		return caller{}, status.Error(codes.Unauthenticated, "service accounts must authenticate with an API key")
+	}
+
+	// Bots only edit through the bots API, on behalf of their owner
+	if strings.HasPrefix(userID, bot.PrincipalPrefix) {
+		return caller{}, status.Error(codes.Unauthenticated, "bots cannot authenticate")
+	}
+
+	return caller{userID: userID}, nil
+}
+
+// firstValue returns the first metadata value for a key.
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
@@ -0,0 +1,223 @@
+package grpcapi
+
+import (
+	"errors"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/collab"
+	docsv1 "github.com/serroba/online-docs/internal/gen/docs/v1"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/ws"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errReadNotSupported is returned by streamConn.ReadJSON; the stream is read
+// directly with Recv instead.
+var errReadNotSupported = errors.New("grpcapi: stream connections are read with Recv")
+
+// Collaborate joins a document's editing session over a bidirectional stream.
+// The stream is registered with the hub like a WebSocket client, so it
+// receives the same broadcasts.
+func (s *Server) Collaborate(stream docsv1.DocumentService_CollaborateServer) error {
+	c, err := s.authenticate(stream.Context(), acl.ActionRead)
+	if err != nil {
+		return err
+	}
+
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	docID := first.GetJoin().GetDocumentId()
+	if docID == "" {
+		return status.Error(codes.InvalidArgument, "first message must join a document")
+	}
+
+	if err := s.serves(docID); err != nil {
+		return err
+	}
+
+	doc, err := s.manager.GetOrCreateSession(stream.Context(), docID)
+	if err != nil {
+		return statusFromError(err)
+	}
+
+	var session collabSession = doc
+	if !c.canWrite() {
+		session = readOnlySession{collabSession: doc}
+	}
+
+	client := ws.NewClient(uuid.New().String(), c.userID, streamConn{stream: stream})
+	s.hub.Register(client)
+	s.hub.Subscribe(client, docID)
+
+	defer s.hub.Unregister(client)
+
+	if err := sendState(client, session, docID); err != nil {
+		return err
+	}
+
+	return s.receive(stream, client, session, docID)
+}
+
+// receive processes client messages until the stream ends.
+func (s *Server) receive(
+	stream docsv1.DocumentService_CollaborateServer, client *ws.Client, session collabSession, docID string,
+) error {
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch msg := req.GetMessage().(type) {
+		case *docsv1.CollaborateRequest_Operation:
+			applyOperation(client, session, msg.Operation)
+		case *docsv1.CollaborateRequest_Sync:
+			if err := sendState(client, session, docID); err != nil {
+				return err
+			}
+		default:
+			_ = client.SendError(ws.ErrorCodeInvalidMessage, "unexpected message")
+		}
+	}
+}
+
+// applyOperation applies an edit and acknowledges it to the sender.
+func applyOperation(client *ws.Client, session collabSession, req *docsv1.Operation) {
+	var op ot.Operation
+
+	switch req.GetType() {
+	case docsv1.OperationType_OPERATION_TYPE_INSERT:
+		op = ot.NewInsert(req.GetChar(), int(req.GetPosition()), client.UserID)
+	case docsv1.OperationType_OPERATION_TYPE_DELETE:
+		op = ot.NewDelete(int(req.GetPosition()), client.UserID)
+	default:
+		_ = client.SendError(ws.ErrorCodeInvalidMessage, "invalid operation type")
+
+		return
+	}
+
+	revision, err := session.ApplyOperation(client.ID, client.UserID, op, int(req.GetBaseRevision()))
+	if err != nil {
+		switch {
+		case errors.Is(err, acl.ErrAccessDenied):
+			_ = client.SendError(ws.ErrorCodeAccessDenied, "write access denied")
+		case errors.Is(err, collab.ErrDocumentArchived):
+			_ = client.SendError(ws.ErrorCodeDocumentArchived, "document is archived")
+		default:
+			_ = client.SendError(ws.ErrorCodeInternalError, err.Error())
+		}
+
+		return
+	}
+
+	_ = client.Send(ws.Message{Type: ws.MessageTypeAck, Payload: ws.AckPayload{Revision: revision}})
+}
+
+// sendState sends the current document state. Access errors end the stream.
+func sendState(client *ws.Client, session collabSession, docID string) error {
+	content, revision, err := session.GetState(client.UserID)
+	if err != nil {
+		return statusFromError(err)
+	}
+
+	return client.Send(ws.Message{
+		Type:    ws.MessageTypeState,
+		Payload: ws.StatePayload{DocID: docID, Content: content, Revision: revision},
+	})
+}
+
+// collabSession is the part of collab.Session used by a stream.
+type collabSession interface {
+	ApplyOperation(clientID, userID string, op ot.Operation, baseRevision int) (int, error)
+	GetState(userID string) (string, int, error)
+}
+
+// readOnlySession rejects all operations while allowing state reads.
+type readOnlySession struct {
+	collabSession
+}
+
+// ApplyOperation always denies write access.
+func (readOnlySession) ApplyOperation(_, _ string, _ ot.Operation, _ int) (int, error) {
+	return 0, acl.ErrAccessDenied
+}
+
+// streamConn adapts a Collaborate stream to ws.Conn so the hub can deliver
+// messages to it.
+type streamConn struct {
+	stream docsv1.DocumentService_CollaborateServer
+}
+
+// WriteJSON converts a hub message to its protobuf form and sends it.
+func (c streamConn) WriteJSON(v any) error {
+	msg, ok := v.(ws.Message)
+	if !ok {
+		return nil
+	}
+
+	resp := toResponse(msg)
+	if resp == nil {
+		return nil
+	}
+
+	return c.stream.Send(resp)
+}
+
+// ReadJSON is not supported.
+func (streamConn) ReadJSON(_ any) error {
+	return errReadNotSupported
+}
+
+// Close is a no-op; the stream ends when the handler returns.
+func (streamConn) Close() error {
+	return nil
+}
+
+// toResponse converts a hub message into a stream response.
+// Returns nil for messages with no protobuf counterpart.
+func toResponse(msg ws.Message) *docsv1.CollaborateResponse {
+	switch p := msg.Payload.(type) {
+	case ws.StatePayload:
+		return &docsv1.CollaborateResponse{Message: &docsv1.CollaborateResponse_State{State: &docsv1.State{
+			DocumentId: p.DocID, Content: p.Content, Revision: int64(p.Revision),
+		}}}
+	case ws.AckPayload:
+		return &docsv1.CollaborateResponse{Message: &docsv1.CollaborateResponse_Ack{Ack: &docsv1.Ack{
+			Revision: int64(p.Revision),
+		}}}
+	case ws.BroadcastPayload:
+		return &docsv1.CollaborateResponse{Message: &docsv1.CollaborateResponse_Broadcast{Broadcast: &docsv1.Broadcast{
+			DocumentId: p.DocID,
+			Revision:   int64(p.Revision),
+			Type:       operationType(p.OpType),
+			Position:   int64(p.Position),
+			Char:       p.Char,
+			UserId:     p.UserID,
+		}}}
+	case ws.ErrorPayload:
+		return &docsv1.CollaborateResponse{Message: &docsv1.CollaborateResponse_Error{Error: &docsv1.Error{
+			Code: p.Code, Message: p.Message,
+		}}}
+	default:
+		return nil
+	}
+}
+
+// operationType converts an ot.OpType value to its protobuf enum.
+func operationType(opType int) docsv1.OperationType {
+	if opType == int(ot.Delete) {
+		return docsv1.OperationType_OPERATION_TYPE_DELETE
+	}
+
+	return docsv1.OperationType_OPERATION_TYPE_INSERT
+}
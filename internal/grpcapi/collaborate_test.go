@@ -0,0 +1,229 @@
+package grpcapi_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apikey"
+	docsv1 "github.com/serroba/online-docs/internal/gen/docs/v1"
+	"github.com/serroba/online-docs/internal/grpcapi"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+func join(t *testing.T, env *testEnv, ctx context.Context, docID string) docsv1.DocumentService_CollaborateClient {
+	t.Helper()
+
+	stream, err := env.client.Collaborate(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = stream.CloseSend() })
+
+	require.NoError(t, stream.Send(&docsv1.CollaborateRequest{
+		Message: &docsv1.CollaborateRequest_Join{Join: &docsv1.Join{DocumentId: docID}},
+	}))
+
+	return stream
+}
+
+func sendOperation(t *testing.T, stream docsv1.DocumentService_CollaborateClient, op *docsv1.Operation) {
+	t.Helper()
+
+	require.NoError(t, stream.Send(&docsv1.CollaborateRequest{
+		Message: &docsv1.CollaborateRequest_Operation{Operation: op},
+	}))
+}
+
+func TestCollaborate(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, grpcapi.ServerConfig{})
+
+	_, err := env.client.CreateDocument(asUser(t, "alice"), &docsv1.CreateDocumentRequest{Id: "doc1"})
+	require.NoError(t, err)
+	require.NoError(t, env.permStore.Grant("doc1", "bob", acl.Editor))
+
+	alice := join(t, env, asUser(t, "alice"), "doc1")
+	bob := join(t, env, asUser(t, "bob"), "doc1")
+
+	for _, stream := range []docsv1.DocumentService_CollaborateClient{alice, bob} {
+		resp, err := stream.Recv()
+		require.NoError(t, err)
+
+		if resp.GetState() == nil || resp.GetState().GetDocumentId() != "doc1" {
+			t.Fatalf("expected initial state, got %v", resp)
+		}
+	}
+
+	sendOperation(t, alice, &docsv1.Operation{Type: docsv1.OperationType_OPERATION_TYPE_INSERT, Char: "h"})
+
+	resp, err := alice.Recv()
+	require.NoError(t, err)
+
+	if resp.GetAck().GetRevision() != 1 {
+		t.Errorf("expected ack for revision 1, got %v", resp)
+	}
+
+	resp, err = bob.Recv()
+	require.NoError(t, err)
+
+	broadcast := resp.GetBroadcast()
+	if broadcast == nil || broadcast.GetChar() != "h" || broadcast.GetUserId() != "alice" {
+		t.Errorf("expected broadcast of alice's insert, got %v", resp)
+	}
+
+	sendOperation(t, bob, &docsv1.Operation{BaseRevision: 1, Type: docsv1.OperationType_OPERATION_TYPE_DELETE})
+
+	resp, err = bob.Recv()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), resp.GetAck().GetRevision())
+
+	resp, err = alice.Recv()
+	require.NoError(t, err)
+	require.Equal(t, docsv1.OperationType_OPERATION_TYPE_DELETE, resp.GetBroadcast().GetType())
+
+	require.NoError(t, alice.Send(&docsv1.CollaborateRequest{
+		Message: &docsv1.CollaborateRequest_Sync{Sync: &docsv1.Sync{}},
+	}))
+
+	resp, err = alice.Recv()
+	require.NoError(t, err)
+
+	if resp.GetState().GetRevision() != 2 || resp.GetState().GetContent() != "" {
+		t.Errorf("unexpected state after sync: %v", resp)
+	}
+}
+
+func TestCollaborate_Errors(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, grpcapi.ServerConfig{})
+
+	_, err := env.client.CreateDocument(asUser(t, "alice"), &docsv1.CreateDocumentRequest{Id: "doc1"})
+	require.NoError(t, err)
+	require.NoError(t, env.permStore.Grant("doc1", "viewer", acl.Viewer))
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := join(t, env, t.Context(), "doc1").Recv()
+		requireCode(t, err, codes.Unauthenticated)
+	})
+
+	t.Run("first message must join", func(t *testing.T) {
+		t.Parallel()
+
+		stream, err := env.client.Collaborate(asUser(t, "alice"))
+		require.NoError(t, err)
+
+		sendOperation(t, stream, &docsv1.Operation{})
+
+		_, err = stream.Recv()
+		requireCode(t, err, codes.InvalidArgument)
+	})
+
+	t.Run("missing document", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := join(t, env, asUser(t, "alice"), "missing").Recv()
+		requireCode(t, err, codes.NotFound)
+	})
+
+	t.Run("no read access", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := join(t, env, asUser(t, "stranger"), "doc1").Recv()
+		requireCode(t, err, codes.PermissionDenied)
+	})
+
+	t.Run("viewer cannot edit", func(t *testing.T) {
+		t.Parallel()
+
+		stream := join(t, env, asUser(t, "viewer"), "doc1")
+
+		_, err := stream.Recv()
+		require.NoError(t, err)
+
+		sendOperation(t, stream, &docsv1.Operation{Char: "x"})
+
+		resp, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, "access_denied", resp.GetError().GetCode())
+
+		sendOperation(t, stream, &docsv1.Operation{Type: docsv1.OperationType(7)})
+
+		resp, err = stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, "invalid_message", resp.GetError().GetCode())
+
+		require.NoError(t, stream.Send(&docsv1.CollaborateRequest{
+			Message: &docsv1.CollaborateRequest_Join{Join: &docsv1.Join{DocumentId: "doc1"}},
+		}))
+
+		resp, err = stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, "invalid_message", resp.GetError().GetCode())
+	})
+
+	t.Run("stale operation", func(t *testing.T) {
+		t.Parallel()
+
+		stream := join(t, env, asUser(t, "alice"), "doc1")
+
+		_, err := stream.Recv()
+		require.NoError(t, err)
+
+		sendOperation(t, stream, &docsv1.Operation{BaseRevision: 99, Char: "x"})
+
+		resp, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, "internal_error", resp.GetError().GetCode())
+	})
+}
+
+func TestCollaborate_ReadOnlyKey(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, grpcapi.ServerConfig{})
+
+	key, secret, err := env.apiKeys.Issue("alice", "reader", []apikey.Scope{apikey.ScopeRead})
+	require.NoError(t, err)
+
+	_, err = env.client.CreateDocument(asUser(t, "alice"), &docsv1.CreateDocumentRequest{Id: "doc1"})
+	require.NoError(t, err)
+	require.NoError(t, env.permStore.Grant("doc1", key.Principal(), acl.Editor))
+
+	ctx := metadata.AppendToOutgoingContext(t.Context(), "x-api-key", secret)
+	stream := join(t, env, ctx, "doc1")
+
+	_, err = stream.Recv()
+	require.NoError(t, err)
+
+	sendOperation(t, stream, &docsv1.Operation{Char: "x"})
+
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, "access_denied", resp.GetError().GetCode())
+}
+
+func TestCollaborate_ArchivedDocument(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, grpcapi.ServerConfig{})
+
+	_, err := env.client.CreateDocument(asUser(t, "alice"), &docsv1.CreateDocumentRequest{Id: "doc1"})
+	require.NoError(t, err)
+	require.NoError(t, env.store.SetArchived(t.Context(), "doc1", true))
+
+	stream := join(t, env, asUser(t, "alice"), "doc1")
+
+	_, err = stream.Recv()
+	require.NoError(t, err)
+
+	sendOperation(t, stream, &docsv1.Operation{Char: "x"})
+
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, "document_archived", resp.GetError().GetCode())
+}
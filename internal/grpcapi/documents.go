@@ -0,0 +1,131 @@
+package grpcapi
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	docsv1 "github.com/serroba/online-docs/internal/gen/docs/v1"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/webhook"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CreateDocument creates a document and grants the caller the Owner role.
+// An ID is generated when the request leaves it empty.
+func (s *Server) CreateDocument(ctx context.Context, req *docsv1.CreateDocumentRequest) (*docsv1.Document, error) {
+	c, err := s.authenticate(ctx, acl.ActionWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	create := apitypes.CreateDocumentRequest{ID: req.GetId(), Content: req.GetContent()}
+	if err := create.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if create.ID == "" {
+		create.ID = uuid.New().String()
+	}
+
+	if err := s.store.CreateDocument(ctx, create.ID); err != nil {
+		return nil, statusFromError(err)
+	}
+
+	// Seed the initial content as the revision 0 snapshot
+	if create.Content != "" {
+		if err := s.store.SaveSnapshot(ctx, create.ID, 0, create.Content); err != nil {
+			_ = s.store.DeleteDocument(context.WithoutCancel(ctx), create.ID)
+
+			return nil, statusFromError(err)
+		}
+	}
+
+	if s.permStore != nil {
+		if err := s.permStore.Grant(create.ID, c.userID, acl.Owner); err != nil {
+			s.logger.ErrorContext(ctx, "failed to grant owner role",
+				logging.DocID(create.ID), logging.UserID(c.userID), logging.Err(err))
+		}
+	}
+
+	s.publishEvent(webhook.EventDocumentCreated, create.ID, c.userID)
+
+	return &docsv1.Document{Id: create.ID, Content: create.Content}, nil
+}
+
+// GetDocument returns the current content, or the content at a revision.
+func (s *Server) GetDocument(ctx context.Context, req *docsv1.GetDocumentRequest) (*docsv1.Document, error) {
+	c, err := s.authenticate(ctx, acl.ActionRead)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Revision != nil && req.GetRevision() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid revision")
+	}
+
+	if err := s.serves(req.GetId()); err != nil {
+		return nil, err
+	}
+
+	session, err := s.manager.GetOrCreateSession(ctx, req.GetId())
+	if err != nil {
+		return nil, statusFromError(err)
+	}
+
+	if req.Revision == nil {
+		content, revision, err := session.GetState(c.userID)
+		if err != nil {
+			return nil, statusFromError(err)
+		}
+
+		return &docsv1.Document{Id: req.GetId(), Content: content, Revision: int64(revision)}, nil
+	}
+
+	content, err := session.GetStateAt(ctx, c.userID, int(req.GetRevision()))
+	if err != nil {
+		return nil, statusFromError(err)
+	}
+
+	return &docsv1.Document{Id: req.GetId(), Content: content, Revision: req.GetRevision()}, nil
+}
+
+// DeleteDocument deletes a document and closes its active session.
+func (s *Server) DeleteDocument(
+	ctx context.Context, req *docsv1.DeleteDocumentRequest,
+) (*docsv1.DeleteDocumentResponse, error) {
+	c, err := s.authenticate(ctx, acl.ActionDelete)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.serves(req.GetId()); err != nil {
+		return nil, err
+	}
+
+	if s.permStore != nil {
+		checker := acl.NewChecker(s.permStore)
+		if err := checker.RequirePermission(req.GetId(), c.userID, acl.ActionDelete); err != nil {
+			return nil, statusFromError(err)
+		}
+	}
+
+	if err := s.manager.DeleteDocument(ctx, req.GetId()); err != nil {
+		return nil, statusFromError(err)
+	}
+
+	s.publishEvent(webhook.EventDocumentDeleted, req.GetId(), c.userID)
+
+	return &docsv1.DeleteDocumentResponse{}, nil
+}
+
+// publishEvent notifies webhooks of a document lifecycle event.
+func (s *Server) publishEvent(eventType webhook.EventType, docID, userID string) {
+	if s.webhooks == nil {
+		return
+	}
+
+	s.webhooks.Publish(webhook.Event{Type: eventType, DocID: docID, UserID: userID})
+}
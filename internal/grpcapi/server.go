@@ -0,0 +1,104 @@
+// Package grpcapi exposes the document API over gRPC for backend services.
+package grpcapi
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apikey"
+	"github.com/serroba/online-docs/internal/cluster"
+	"github.com/serroba/online-docs/internal/collab"
+	docsv1 "github.com/serroba/online-docs/internal/gen/docs/v1"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/webhook"
+	"github.com/serroba/online-docs/internal/ws"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements docsv1.DocumentServiceServer.
+type Server struct {
+	docsv1.UnimplementedDocumentServiceServer
+
+	manager       *collab.Manager
+	store         storage.Store
+	permStore     acl.Store
+	hub           *ws.Hub
+	apiKeys       *apikey.Service
+	webhooks      *webhook.Service
+	requireAPIKey bool
+	owns          func(docID string) bool
+	logger        *slog.Logger
+}
+
+// ServerConfig holds configuration for creating a server.
+type ServerConfig struct {
+	Manager   *collab.Manager
+	Store     storage.Store
+	PermStore acl.Store
+	Hub       *ws.Hub
+	APIKeys   *apikey.Service  // Optional: enables x-api-key authentication
+	Webhooks  *webhook.Service // Optional: receives document.created and document.deleted events
+	Logger    *slog.Logger     // Optional: defaults to slog.Default()
+
+	// RequireAPIKey rejects callers identified only by x-user-id metadata.
+	// Set it when the user ID can't be trusted, e.g. with OIDC login enabled.
+	RequireAPIKey bool
+
+	// Owns reports whether this node serves a document. Documents it
+	// doesn't own are refused, as their sessions run on another node.
+	// Optional: every document is served when nil.
+	Owns func(docID string) bool
+}
+
+// NewServer creates a new gRPC API server.
+func NewServer(cfg ServerConfig) *Server {
+	return &Server{
+		manager:       cfg.Manager,
+		store:         cfg.Store,
+		permStore:     cfg.PermStore,
+		hub:           cfg.Hub,
+		apiKeys:       cfg.APIKeys,
+		webhooks:      cfg.Webhooks,
+		requireAPIKey: cfg.RequireAPIKey,
+		owns:          cfg.Owns,
+		logger:        logging.Component(cfg.Logger, "grpc"),
+	}
+}
+
+// Register registers the document service on a gRPC server.
+func (s *Server) Register(registrar grpc.ServiceRegistrar) {
+	docsv1.RegisterDocumentServiceServer(registrar, s)
+}
+
+// serves returns an error for documents another node owns.
+func (s *Server) serves(docID string) error {
+	if s.owns != nil && !s.owns(docID) {
+		return statusFromError(cluster.ErrNotOwner)
+	}
+
+	return nil
+}
+
+// statusFromError maps domain errors to gRPC status errors.
+func statusFromError(err error) error {
+	switch {
+	case errors.Is(err, storage.ErrDocumentNotFound):
+		return status.Error(codes.NotFound, "document not found")
+	case errors.Is(err, storage.ErrDocumentExists):
+		return status.Error(codes.AlreadyExists, "document already exists")
+	case errors.Is(err, storage.ErrRevisionNotFound):
+		return status.Error(codes.NotFound, "revision not found")
+	case errors.Is(err, storage.ErrRevisionCompacted):
+		return status.Error(codes.FailedPrecondition, "revision no longer available")
+	case errors.Is(err, acl.ErrAccessDenied):
+		return status.Error(codes.PermissionDenied, "access denied")
+	case errors.Is(err, cluster.ErrNotOwner):
+		return status.Error(codes.FailedPrecondition, "document is owned by another node")
+	default:
+		return status.Error(codes.Internal, "internal server error")
+	}
+}
@@ -0,0 +1,342 @@
+package grpcapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apikey"
+	"github.com/serroba/online-docs/internal/collab"
+	docsv1 "github.com/serroba/online-docs/internal/gen/docs/v1"
+	"github.com/serroba/online-docs/internal/grpcapi"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/webhook"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testEnv runs a gRPC server over an in-memory listener.
+type testEnv struct {
+	store     *storage.MemoryStore
+	permStore *acl.MemoryStore
+	apiKeys   *apikey.Service
+	client    docsv1.DocumentServiceClient
+}
+
+func newTestEnv(t *testing.T, cfg grpcapi.ServerConfig) *testEnv {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	permStore := acl.NewMemoryStore()
+	hub := ws.NewHub()
+	apiKeys := apikey.NewService(apikey.NewMemoryStore())
+
+	cfg.Manager = collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore, Hub: hub})
+	cfg.Store = store
+	cfg.PermStore = permStore
+	cfg.Hub = hub
+	cfg.APIKeys = apiKeys
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	grpcapi.NewServer(cfg).Register(server)
+
+	go func() { _ = server.Serve(listener) }()
+
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return &testEnv{
+		store:     store,
+		permStore: permStore,
+		apiKeys:   apiKeys,
+		client:    docsv1.NewDocumentServiceClient(conn),
+	}
+}
+
+func asUser(t *testing.T, userID string) context.Context {
+	t.Helper()
+
+	return metadata.AppendToOutgoingContext(t.Context(), "x-user-id", userID)
+}
+
+func requireCode(t *testing.T, err error, want codes.Code) {
+	t.Helper()
+
+	if got := status.Code(err); got != want {
+		t.Errorf("expected code %s, got %s (%v)", want, got, err)
+	}
+}
+
+func TestCreateAndGetDocument(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, grpcapi.ServerConfig{})
+	ctx := asUser(t, "alice")
+
+	doc, err := env.client.CreateDocument(ctx, &docsv1.CreateDocumentRequest{Id: "doc1", Content: "hello"})
+	require.NoError(t, err)
+
+	if doc.GetId() != "doc1" || doc.GetContent() != "hello" {
+		t.Errorf("unexpected document %v", doc)
+	}
+
+	role, err := env.permStore.GetRole("doc1", "alice")
+	require.NoError(t, err)
+
+	if role != acl.Owner {
+		t.Errorf("expected creator to be owner, got %v", role)
+	}
+
+	doc, err = env.client.GetDocument(ctx, &docsv1.GetDocumentRequest{Id: "doc1"})
+	require.NoError(t, err)
+
+	if doc.GetContent() != "hello" || doc.GetRevision() != 0 {
+		t.Errorf("unexpected document %v", doc)
+	}
+
+	revision := int64(0)
+
+	doc, err = env.client.GetDocument(ctx, &docsv1.GetDocumentRequest{Id: "doc1", Revision: &revision})
+	require.NoError(t, err)
+
+	if doc.GetContent() != "hello" {
+		t.Errorf("unexpected content at revision 0: %q", doc.GetContent())
+	}
+}
+
+func TestCreateDocument_GeneratedID(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, grpcapi.ServerConfig{})
+
+	doc, err := env.client.CreateDocument(asUser(t, "alice"), &docsv1.CreateDocumentRequest{})
+	require.NoError(t, err)
+
+	exists, err := env.store.DocumentExists(t.Context(), doc.GetId())
+	require.NoError(t, err)
+
+	if doc.GetId() == "" || !exists {
+		t.Errorf("expected a generated document ID, got %q", doc.GetId())
+	}
+}
+
+func TestCreateDocument_Errors(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, grpcapi.ServerConfig{})
+	ctx := asUser(t, "alice")
+
+	_, err := env.client.CreateDocument(ctx, &docsv1.CreateDocumentRequest{Id: "doc1"})
+	require.NoError(t, err)
+
+	_, err = env.client.CreateDocument(ctx, &docsv1.CreateDocumentRequest{Id: "doc1"})
+	requireCode(t, err, codes.AlreadyExists)
+
+	_, err = env.client.CreateDocument(ctx, &docsv1.CreateDocumentRequest{Id: "a/b"})
+	requireCode(t, err, codes.InvalidArgument)
+}
+
+func TestGetDocument_Errors(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, grpcapi.ServerConfig{})
+
+	_, err := env.client.CreateDocument(asUser(t, "alice"), &docsv1.CreateDocumentRequest{Id: "doc1"})
+	require.NoError(t, err)
+
+	negative, missing := int64(-1), int64(5)
+
+	tests := []struct {
+		name string
+		user string
+		req  *docsv1.GetDocumentRequest
+		want codes.Code
+	}{
+		{"missing document", "alice", &docsv1.GetDocumentRequest{Id: "missing"}, codes.NotFound},
+		{"no access", "bob", &docsv1.GetDocumentRequest{Id: "doc1"}, codes.PermissionDenied},
+		{"negative revision", "alice", &docsv1.GetDocumentRequest{Id: "doc1", Revision: &negative}, codes.InvalidArgument},
+		{"unknown revision", "alice", &docsv1.GetDocumentRequest{Id: "doc1", Revision: &missing}, codes.NotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := env.client.GetDocument(asUser(t, tt.user), tt.req)
+			requireCode(t, err, tt.want)
+		})
+	}
+}
+
+func TestDeleteDocument(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, grpcapi.ServerConfig{})
+
+	_, err := env.client.CreateDocument(asUser(t, "alice"), &docsv1.CreateDocumentRequest{Id: "doc1"})
+	require.NoError(t, err)
+
+	_, err = env.client.DeleteDocument(asUser(t, "bob"), &docsv1.DeleteDocumentRequest{Id: "doc1"})
+	requireCode(t, err, codes.PermissionDenied)
+
+	_, err = env.client.DeleteDocument(asUser(t, "alice"), &docsv1.DeleteDocumentRequest{Id: "doc1"})
+	require.NoError(t, err)
+
+	exists, err := env.store.DocumentExists(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	if exists {
+		t.Error("expected document to be deleted")
+	}
+
+	require.NoError(t, env.permStore.Grant("gone", "alice", acl.Owner))
+
+	_, err = env.client.DeleteDocument(asUser(t, "alice"), &docsv1.DeleteDocumentRequest{Id: "gone"})
+	requireCode(t, err, codes.NotFound)
+}
+
+func TestDocument_OwnedElsewhere(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, grpcapi.ServerConfig{Owns: func(docID string) bool { return docID != "remote" }})
+
+	_, err := env.client.CreateDocument(asUser(t, "alice"), &docsv1.CreateDocumentRequest{Id: "remote"})
+	require.NoError(t, err)
+
+	_, err = env.client.GetDocument(asUser(t, "alice"), &docsv1.GetDocumentRequest{Id: "remote"})
+	requireCode(t, err, codes.FailedPrecondition)
+
+	_, err = env.client.DeleteDocument(asUser(t, "alice"), &docsv1.DeleteDocumentRequest{Id: "remote"})
+	requireCode(t, err, codes.FailedPrecondition)
+
+	_, err = join(t, env, asUser(t, "alice"), "remote").Recv()
+	requireCode(t, err, codes.FailedPrecondition)
+
+	exists, err := env.store.DocumentExists(t.Context(), "remote")
+	require.NoError(t, err)
+
+	if !exists {
+		t.Error("expected document to be kept for its owner")
+	}
+}
+
+func TestDocumentEvents(t *testing.T) {
+	t.Parallel()
+
+	events := make(chan webhook.Event, 2)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		var event webhook.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err == nil {
+			events <- event
+		}
+	}))
+	t.Cleanup(endpoint.Close)
+
+	webhooks := webhook.NewService(webhook.Config{Store: webhook.NewMemoryStore()})
+	t.Cleanup(webhooks.Close)
+
+	_, err := webhooks.Register("alice", endpoint.URL, nil)
+	require.NoError(t, err)
+
+	env := newTestEnv(t, grpcapi.ServerConfig{Webhooks: webhooks})
+	ctx := asUser(t, "alice")
+
+	_, err = env.client.CreateDocument(ctx, &docsv1.CreateDocumentRequest{Id: "doc1"})
+	require.NoError(t, err)
+
+	if event := <-events; event.Type != webhook.EventDocumentCreated || event.UserID != "alice" {
+		t.Errorf("unexpected created event %+v", event)
+	}
+
+	_, err = env.client.DeleteDocument(ctx, &docsv1.DeleteDocumentRequest{Id: "doc1"})
+	require.NoError(t, err)
+
+	if event := <-events; event.Type != webhook.EventDocumentDeleted || event.DocID != "doc1" {
+		t.Errorf("unexpected deleted event %+v", event)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, grpcapi.ServerConfig{})
+
+	_, readSecret, err := env.apiKeys.Issue("alice", "reader", []apikey.Scope{apikey.ScopeRead})
+	require.NoError(t, err)
+
+	key, writeSecret, err := env.apiKeys.Issue("alice", "writer", []apikey.Scope{apikey.ScopeWrite})
+	require.NoError(t, err)
+
+	t.Run("missing credentials", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := env.client.GetDocument(t.Context(), &docsv1.GetDocumentRequest{Id: "doc1"})
+		requireCode(t, err, codes.Unauthenticated)
+	})
+
+	t.Run("service identity without key", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := env.client.GetDocument(asUser(t, key.Principal()), &docsv1.GetDocumentRequest{Id: "doc1"})
+		requireCode(t, err, codes.Unauthenticated)
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := metadata.AppendToOutgoingContext(t.Context(), "x-api-key", "odk_bogus")
+		_, err := env.client.GetDocument(ctx, &docsv1.GetDocumentRequest{Id: "doc1"})
+		requireCode(t, err, codes.Unauthenticated)
+	})
+
+	t.Run("key scope", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := metadata.AppendToOutgoingContext(t.Context(), "x-api-key", readSecret)
+		_, err := env.client.CreateDocument(ctx, &docsv1.CreateDocumentRequest{Id: "bot-doc"})
+		requireCode(t, err, codes.PermissionDenied)
+	})
+
+	t.Run("key acts as service principal", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := metadata.AppendToOutgoingContext(t.Context(), "x-api-key", writeSecret)
+		_, err := env.client.CreateDocument(ctx, &docsv1.CreateDocumentRequest{Id: "svc-doc"})
+		require.NoError(t, err)
+
+		role, err := env.permStore.GetRole("svc-doc", key.Principal())
+		require.NoError(t, err)
+
+		if role != acl.Owner {
+			t.Errorf("expected service principal to own the document, got %v", role)
+		}
+	})
+}
+
+func TestAuthentication_RequireAPIKey(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, grpcapi.ServerConfig{RequireAPIKey: true})
+
+	_, err := env.client.GetDocument(asUser(t, "alice"), &docsv1.GetDocumentRequest{Id: "doc1"})
+	requireCode(t, err, codes.Unauthenticated)
+}
@@ -0,0 +1,241 @@
+package handler
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/logging"
+)
+
+// adminOnly authenticates the request and restricts it to configured admins.
+// API keys are rejected so that service accounts can never act as admins.
+func (s *Server) adminOnly(next http.HandlerFunc) http.Handler {
+	return s.authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := apiKeyFromContext(r.Context()); ok {
+			writeError(w, http.StatusForbidden, "API keys cannot use admin endpoints")
+
+			return
+		}
+
+		if _, ok := s.admins[UserIDFromContext(r.Context())]; !ok {
+			writeError(w, http.StatusForbidden, "admin access required")
+
+			return
+		}
+
+		next(w, r)
+	}))
+}
+
+// handleListSessions handles GET /v1/admin/sessions.
+func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	sessions := s.manager.Sessions()
+	resp := apitypes.ListSessionsResponse{Sessions: make([]apitypes.AdminSession, 0, len(sessions))}
+
+	for _, session := range sessions {
+		resp.Sessions = append(resp.Sessions, s.toAdminSession(session.Stats()))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleListDocuments handles GET /v1/admin/documents.
+func (s *Server) handleListDocuments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	docIDs, err := s.store.ListDocuments(r.Context())
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "failed to list documents", logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	if docIDs == nil {
+		docIDs = []string{}
+	}
+
+	writeJSON(w, http.StatusOK, apitypes.ListDocumentsResponse{IDs: docIDs})
+}
+
+// maxHotDocuments caps the busiest documents listed in the admin summary.
+const maxHotDocuments = 5
+
+// handleSummary handles GET /v1/admin/summary.
+func (s *Server) handleSummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	usage, err := s.store.Usage(r.Context())
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "failed to load storage usage", logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	sessions := s.manager.Sessions()
+	queue := s.hub.QueueStats()
+
+	writeJSON(w, http.StatusOK, apitypes.AdminSummaryResponse{
+		Documents:        usage.Documents,
+		StorageBytes:     usage.Bytes,
+		ActiveSessions:   len(sessions),
+		SessionBytes:     int64(s.manager.MemoryBytes()),
+		ConnectedClients: s.hub.TotalClients(),
+		OpsPerSecond:     s.manager.OpsPerSecond(),
+		HotDocuments:     s.hotDocuments(sessions),
+		BroadcastQueue: apitypes.BroadcastQueue{
+			Queued:         queue.Queued,
+			MaxDepth:       queue.MaxDepth,
+			DroppedClients: queue.Dropped,
+		},
+		TransformChains: transformChains(s.manager.Counters().TransformChains),
+	})
+}
+
+// transformChains converts the transform chain histogram into its API
+// representation.
+func transformChains(buckets []collab.ChainBucket) []apitypes.ChainBucket {
+	chains := make([]apitypes.ChainBucket, len(buckets))
+	for i, bucket := range buckets {
+		chains[i] = apitypes.ChainBucket{MinLength: bucket.MinLength, Operations: bucket.Operations}
+	}
+
+	return chains
+}
+
+// hotDocuments returns the sessions with the most recent operations, then
+// the most clients. Idle sessions without clients are left out.
+func (s *Server) hotDocuments(sessions []*collab.Session) []apitypes.HotDocument {
+	hot := make([]apitypes.HotDocument, 0, len(sessions))
+
+	for _, session := range sessions {
+		stats := session.Stats()
+
+		doc := apitypes.HotDocument{
+			DocumentID:   stats.DocID,
+			Clients:      s.hub.ClientCount(stats.DocID),
+			OpsPerSecond: stats.OpsPerSecond,
+		}
+		if doc.OpsPerSecond > 0 || doc.Clients > 0 {
+			hot = append(hot, doc)
+		}
+	}
+
+	// Sessions are ordered by document ID, which breaks ties
+	slices.SortStableFunc(hot, func(a, b apitypes.HotDocument) int {
+		return cmp.Or(cmp.Compare(b.OpsPerSecond, a.OpsPerSecond), cmp.Compare(b.Clients, a.Clients))
+	})
+
+	return hot[:min(len(hot), maxHotDocuments)]
+}
+
+// handleCloseSession handles DELETE /v1/admin/sessions/{id}.
+// The session is snapshotted and closed, and its WebSocket clients are
+// disconnected so they reconnect to a fresh session.
+func (s *Server) handleCloseSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	docID := r.PathValue("docID")
+	if s.manager.GetSession(docID) == nil {
+		writeError(w, http.StatusNotFound, "no active session")
+
+		return
+	}
+
+	if err := s.manager.CloseSession(docID); err != nil {
+		s.logger.ErrorContext(r.Context(), "failed to close session", logging.DocID(docID), logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	disconnected := s.hub.Disconnect(docID)
+	s.logger.InfoContext(r.Context(), "admin closed session",
+		logging.UserID(UserIDFromContext(r.Context())), logging.DocID(docID), "disconnected", disconnected)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSnapshotSession handles POST /v1/admin/sessions/{id}/snapshot.
+func (s *Server) handleSnapshotSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	docID := r.PathValue("docID")
+
+	session := s.manager.GetSession(docID)
+	if session == nil {
+		writeError(w, http.StatusNotFound, "no active session")
+
+		return
+	}
+
+	if err := session.Snapshot(r.Context()); err != nil {
+		s.logger.ErrorContext(r.Context(), "failed to snapshot session", logging.DocID(docID), logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.toAdminSession(session.Stats()))
+}
+
+// toAdminSession converts session stats into their API representation.
+func (s *Server) toAdminSession(stats collab.SessionStats) apitypes.AdminSession {
+	return apitypes.AdminSession{
+		DocumentID:   stats.DocID,
+		Revision:     stats.Revision,
+		Clients:      s.hub.ClientCount(stats.DocID),
+		HistoryOps:   stats.HistoryOps,
+		MemoryBytes:  stats.MemoryBytes,
+		ContentBytes: stats.ContentBytes,
+		HistoryBytes: stats.HistoryBytes,
+		PendingBytes: stats.PendingBytes,
+		Latency: apitypes.OperationLatency{
+			Operations: stats.Latency.Operations,
+			MeanMs:     stageLatency(stats.Latency.Mean, stats.Latency.Mean.Total()),
+			MaxMs:      stageLatency(stats.Latency.Max, stats.Latency.MaxTotal),
+		},
+	}
+}
+
+// stageLatency converts stage durations and their total into milliseconds.
+func stageLatency(stages collab.Stages, total time.Duration) apitypes.StageLatency {
+	return apitypes.StageLatency{
+		Transform: milliseconds(stages.Transform),
+		Persist:   milliseconds(stages.Persist),
+		Broadcast: milliseconds(stages.Broadcast),
+		Total:     milliseconds(total),
+	}
+}
+
+// milliseconds returns d in fractional milliseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
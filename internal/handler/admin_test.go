@@ -0,0 +1,406 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/apikey"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// closeTrackingConn is a ws.Conn that only records whether it was closed.
+type closeTrackingConn struct {
+	closed atomic.Bool
+}
+
+func (*closeTrackingConn) WriteJSON(any) error { return nil }
+
+func (*closeTrackingConn) ReadJSON(any) error { return nil }
+
+func (c *closeTrackingConn) Close() error {
+	c.closed.Store(true)
+
+	return nil
+}
+
+type adminEnv struct {
+	handler http.Handler
+	store   *storage.MemoryStore
+	manager *collab.Manager
+	hub     *ws.Hub
+	apiKeys *apikey.Service
+}
+
+func newAdminEnv(t *testing.T) adminEnv {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	hub := ws.NewHub()
+	apiKeys := apikey.NewService(apikey.NewMemoryStore())
+	manager := collab.NewManager(collab.ManagerConfig{
+		Store: store,
+		Hub:   hub,
+	})
+
+	server := handler.NewServer(handler.ServerConfig{
+		Manager: manager,
+		Store:   store,
+		Hub:     hub,
+		APIKeys: apiKeys,
+		Admins:  []string{"root"},
+	})
+
+	return adminEnv{handler: server.Handler(), store: store, manager: manager, hub: hub, apiKeys: apiKeys}
+}
+
+func (e adminEnv) serve(userID, method, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("X-User-Id", userID)
+
+	rec := httptest.NewRecorder()
+	e.handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func (e adminEnv) openSession(t *testing.T, docID string) *collab.Session {
+	t.Helper()
+
+	require.NoError(t, e.store.CreateDocument(t.Context(), docID))
+
+	session, err := e.manager.GetOrCreateSession(t.Context(), docID)
+	require.NoError(t, err)
+
+	_, err = session.ApplyOperation("c1", "alice", ot.NewInsert("a", 0, "alice"), 0)
+	require.NoError(t, err)
+
+	return session
+}
+
+func TestAdminSessions(t *testing.T) {
+	t.Parallel()
+
+	t.Run("lists active sessions", func(t *testing.T) {
+		t.Parallel()
+
+		env := newAdminEnv(t)
+		env.openSession(t, "doc1")
+
+		client := ws.NewClient("c1", "alice", &closeTrackingConn{})
+		env.hub.Register(client)
+		env.hub.Subscribe(client, "doc1")
+
+		rec := env.serve("root", http.MethodGet, "/v1/admin/sessions")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var resp apitypes.ListSessionsResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+		require.Len(t, resp.Sessions, 1)
+
+		got := resp.Sessions[0]
+		if got.DocumentID != "doc1" || got.Revision != 1 || got.Clients != 1 || got.HistoryOps != 1 {
+			t.Errorf("unexpected session: %+v", got)
+		}
+
+		if got.MemoryBytes == 0 || got.MemoryBytes != got.ContentBytes+got.HistoryBytes+got.PendingBytes {
+			t.Errorf("expected a memory estimate adding up its parts: %+v", got)
+		}
+
+		if latency := got.Latency; latency.Operations != 1 || latency.MaxMs.Total < latency.MeanMs.Persist {
+			t.Errorf("expected the latency of one operation: %+v", latency)
+		}
+	})
+
+	t.Run("force-closes a session and disconnects clients", func(t *testing.T) {
+		t.Parallel()
+
+		env := newAdminEnv(t)
+		env.openSession(t, "doc1")
+
+		conn := &closeTrackingConn{}
+		client := ws.NewClient("c1", "alice", conn)
+		env.hub.Register(client)
+		env.hub.Subscribe(client, "doc1")
+
+		rec := env.serve("root", http.MethodDelete, "/v1/admin/sessions/doc1")
+		require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+		if env.manager.GetSession("doc1") != nil {
+			t.Error("expected session to be closed")
+		}
+
+		if !conn.closed.Load() {
+			t.Error("expected client connection to be closed")
+		}
+
+		snapshot, err := env.store.LoadSnapshot(t.Context(), "doc1")
+		require.NoError(t, err)
+
+		if snapshot.Content != "a" {
+			t.Errorf("expected final snapshot %q, got %q", "a", snapshot.Content)
+		}
+	})
+
+	t.Run("force-snapshots a session", func(t *testing.T) {
+		t.Parallel()
+
+		env := newAdminEnv(t)
+		env.openSession(t, "doc1")
+
+		rec := env.serve("root", http.MethodPost, "/v1/admin/sessions/doc1/snapshot")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var resp apitypes.AdminSession
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+
+		if resp.DocumentID != "doc1" || resp.Revision != 1 {
+			t.Errorf("unexpected session: %+v", resp)
+		}
+
+		snapshot, err := env.store.LoadSnapshot(t.Context(), "doc1")
+		require.NoError(t, err)
+
+		if snapshot.Revision != 1 {
+			t.Errorf("expected snapshot at revision 1, got %d", snapshot.Revision)
+		}
+	})
+
+	t.Run("rejects API keys", func(t *testing.T) {
+		t.Parallel()
+
+		env := newAdminEnv(t)
+
+		_, secret, err := env.apiKeys.Issue("root", "ops", []apikey.Scope{apikey.ScopeRead})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/admin/sessions", nil)
+		req.Header.Set("X-Api-Key", secret)
+
+		rec := httptest.NewRecorder()
+		env.handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("expected status 403, got %d", rec.Code)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		userID string
+		method string
+		target string
+		status int
+	}{
+		{"requires authentication", "", http.MethodGet, "/v1/admin/sessions", http.StatusUnauthorized},
+		{"rejects non-admins", "alice", http.MethodGet, "/v1/admin/sessions", http.StatusForbidden},
+		{"list method not allowed", "root", http.MethodPost, "/v1/admin/sessions", http.StatusMethodNotAllowed},
+		{"close method not allowed", "root", http.MethodGet, "/v1/admin/sessions/doc1", http.StatusMethodNotAllowed},
+		{"snapshot method not allowed", "root", http.MethodGet, "/v1/admin/sessions/doc1/snapshot", 405},
+		{"close without session", "root", http.MethodDelete, "/v1/admin/sessions/idle", http.StatusNotFound},
+		{"snapshot without session", "root", http.MethodPost, "/v1/admin/sessions/idle/snapshot", 404},
+		{"summary method not allowed", "root", http.MethodPost, "/v1/admin/summary", http.StatusMethodNotAllowed},
+		{"summary rejects non-admins", "alice", http.MethodGet, "/v1/admin/summary", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			env := newAdminEnv(t)
+
+			rec := env.serve(tt.userID, tt.method, tt.target)
+			if rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdminSummary(t *testing.T) {
+	t.Parallel()
+
+	env := newAdminEnv(t)
+	require.NoError(t, env.store.CreateDocument(t.Context(), "stored"))
+
+	busy := env.openSession(t, "busy")
+	_, err := busy.ApplyOperation("c1", "alice", ot.NewInsert("b", 1, "alice"), 1)
+	require.NoError(t, err)
+
+	env.openSession(t, "edited")
+
+	// A session with clients but no recent edits is still listed; one with
+	// neither isn't
+	_, err = env.manager.GetOrCreateSession(t.Context(), "stored")
+	require.NoError(t, err)
+
+	require.NoError(t, env.store.CreateDocument(t.Context(), "watched"))
+	_, err = env.manager.GetOrCreateSession(t.Context(), "watched")
+	require.NoError(t, err)
+
+	for _, docID := range []string{"watched", "edited"} {
+		client := ws.NewClient("viewer-"+docID, "bob", &closeTrackingConn{})
+		env.hub.Register(client)
+		env.hub.Subscribe(client, docID)
+	}
+
+	rec := env.serve("root", http.MethodGet, "/v1/admin/summary")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp apitypes.AdminSummaryResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+
+	if resp.Documents != 4 || resp.ActiveSessions != 4 || resp.ConnectedClients != 2 {
+		t.Errorf("unexpected counts: %+v", resp)
+	}
+
+	if resp.StorageBytes == 0 || resp.SessionBytes == 0 || resp.OpsPerSecond != 3.0/60 {
+		t.Errorf("unexpected storage size, memory or rate: %+v", resp)
+	}
+
+	require.Equal(t, []apitypes.HotDocument{
+		{DocumentID: "busy", OpsPerSecond: 2.0 / 60},
+		{DocumentID: "edited", Clients: 1, OpsPerSecond: 1.0 / 60},
+		{DocumentID: "watched", Clients: 1},
+	}, resp.HotDocuments)
+	require.Equal(t, apitypes.BroadcastQueue{}, resp.BroadcastQueue)
+	require.Equal(t, apitypes.ChainBucket{MinLength: 0, Operations: 3}, resp.TransformChains[0])
+}
+
+func TestAdminDocuments(t *testing.T) {
+	t.Parallel()
+
+	env := newAdminEnv(t)
+
+	rec := env.serve("root", http.MethodGet, "/v1/admin/documents")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.JSONEq(t, `{"ids": []}`, rec.Body.String())
+
+	require.NoError(t, env.store.CreateDocument(t.Context(), "b"))
+	require.NoError(t, env.store.CreateDocument(t.Context(), "a"))
+
+	rec = env.serve("root", http.MethodGet, "/v1/admin/documents")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.JSONEq(t, `{"ids": ["a", "b"]}`, rec.Body.String())
+
+	if rec := env.serve("alice", http.MethodGet, "/v1/admin/documents"); rec.Code != http.StatusForbidden {
+		t.Errorf("expected non-admins to get 403, got %d", rec.Code)
+	}
+
+	if rec := env.serve("root", http.MethodPost, "/v1/admin/documents"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rec.Code)
+	}
+}
+
+// failingUsageStore is a MemoryStore whose Usage always fails.
+type failingUsageStore struct {
+	*storage.MemoryStore
+}
+
+func (failingUsageStore) Usage(context.Context) (storage.Usage, error) {
+	return storage.Usage{}, errors.New("usage unavailable")
+}
+
+func TestAdminSummary_StoreError(t *testing.T) {
+	t.Parallel()
+
+	store := failingUsageStore{MemoryStore: storage.NewMemoryStore()}
+	hub := ws.NewHub()
+	server := handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub}),
+		Store:   store,
+		Hub:     hub,
+		Admins:  []string{"root"},
+	})
+
+	rec := serveAs(server.Handler(), "root", http.MethodGet, "/v1/admin/summary", "")
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", rec.Code)
+	}
+}
+
+func TestAdminSessions_DisabledWithoutAdmins(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	hub := ws.NewHub()
+	server := handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub}),
+		Store:   store,
+		Hub:     hub,
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/admin/sessions", nil)
+	req.Header.Set("X-User-Id", "root")
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestAdminSessions_SnapshotFails(t *testing.T) {
+	t.Parallel()
+
+	store := &failingSnapshotStore{MemoryStore: storage.NewMemoryStore()}
+	hub := ws.NewHub()
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub})
+	server := handler.NewServer(handler.ServerConfig{
+		Manager: manager,
+		Store:   store,
+		Hub:     hub,
+		Admins:  []string{"root"},
+		Logger:  slog.New(slog.DiscardHandler),
+	})
+
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	_, err = session.ApplyOperation("c1", "alice", ot.NewInsert("a", 0, "alice"), 0)
+	require.NoError(t, err)
+
+	rec := serveAs(server.Handler(), "root", http.MethodPost, "/v1/admin/sessions/doc1/snapshot", "")
+	require.Equal(t, http.StatusInternalServerError, rec.Code, rec.Body.String())
+
+	rec = serveAs(server.Handler(), "root", http.MethodDelete, "/v1/admin/sessions/doc1", "")
+	require.Equal(t, http.StatusInternalServerError, rec.Code, rec.Body.String())
+}
+
+// failingListStore is a MemoryStore whose ListDocuments always fails.
+type failingListStore struct {
+	*storage.MemoryStore
+}
+
+func (failingListStore) ListDocuments(context.Context) ([]string, error) {
+	return nil, errors.New("listing unavailable")
+}
+
+func TestAdminDocuments_StoreError(t *testing.T) {
+	t.Parallel()
+
+	store := failingListStore{MemoryStore: storage.NewMemoryStore()}
+	server := handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store}),
+		Store:   store,
+		Admins:  []string{"root"},
+		Logger:  slog.New(slog.DiscardHandler),
+	})
+
+	rec := serveAs(server.Handler(), "root", http.MethodGet, "/v1/admin/documents", "")
+	require.Equal(t, http.StatusInternalServerError, rec.Code, rec.Body.String())
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/serroba/online-docs/internal/apikey"
+	"github.com/serroba/online-docs/internal/apitypes"
+)
+
+// handleAPIKeys routes GET and POST requests for /v1/apikeys.
+func (s *Server) handleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if !s.requireHumanUser(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.handleListAPIKeys(w, r)
+	case http.MethodPost:
+		s.handleCreateAPIKey(w, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleAPIKeyByID handles DELETE /v1/apikeys/{id}.
+func (s *Server) handleAPIKeyByID(w http.ResponseWriter, r *http.Request) {
+	if !s.requireHumanUser(w, r) {
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	if err := s.apiKeys.Revoke(UserIDFromContext(r.Context()), r.PathValue("keyID")); err != nil {
+		if errors.Is(err, apikey.ErrKeyNotFound) {
+			writeError(w, http.StatusNotFound, "API key not found")
+
+			return
+		}
+
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCreateAPIKey handles POST /v1/apikeys.
+func (s *Server) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req apitypes.CreateAPIKeyRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	scopes := make([]apikey.Scope, 0, len(req.Scopes))
+
+	for _, name := range req.Scopes {
+		scope, err := apikey.ParseScope(name)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "unknown scope "+name)
+
+			return
+		}
+
+		scopes = append(scopes, scope)
+	}
+
+	key, secret, err := s.apiKeys.Issue(UserIDFromContext(r.Context()), req.Name, scopes)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, apitypes.CreateAPIKeyResponse{
+		APIKey: toAPIKey(key),
+		Secret: secret,
+	})
+}
+
+// handleListAPIKeys handles GET /v1/apikeys.
+func (s *Server) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.apiKeys.List(UserIDFromContext(r.Context()))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	resp := apitypes.ListAPIKeysResponse{APIKeys: make([]apitypes.APIKey, 0, len(keys))}
+	for _, key := range keys {
+		resp.APIKeys = append(resp.APIKeys, toAPIKey(key))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// requireHumanUser rejects requests authenticated with an API key.
+// Keys cannot be used to mint or revoke other keys.
+func (s *Server) requireHumanUser(w http.ResponseWriter, r *http.Request) bool {
+	if _, ok := apiKeyFromContext(r.Context()); ok {
+		writeError(w, http.StatusForbidden, "API keys cannot manage API keys")
+
+		return false
+	}
+
+	return true
+}
+
+// toAPIKey converts a key into its API representation.
+func toAPIKey(key apikey.Key) apitypes.APIKey {
+	scopes := make([]string, 0, len(key.Scopes))
+	for _, scope := range key.Scopes {
+		scopes = append(scopes, string(scope))
+	}
+
+	return apitypes.APIKey{
+		ID:        key.ID,
+		Name:      key.ServiceName,
+		Principal: key.Principal(),
+		Scopes:    scopes,
+		CreatedAt: key.CreatedAt,
+	}
+}
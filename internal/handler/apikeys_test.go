@@ -0,0 +1,351 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apikey"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// apiKeyTestEnv wires a server with API keys enabled.
+type apiKeyTestEnv struct {
+	store     *storage.MemoryStore
+	permStore *acl.MemoryStore
+	apiKeys   *apikey.Service
+	handler   http.Handler
+}
+
+func newAPIKeyTestEnv(t *testing.T) *apiKeyTestEnv {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	permStore := acl.NewMemoryStore()
+	hub := ws.NewHub()
+	apiKeys := apikey.NewService(apikey.NewMemoryStore())
+
+	manager := collab.NewManager(collab.ManagerConfig{
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+	})
+
+	server := handler.NewServer(handler.ServerConfig{
+		Manager:   manager,
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+		APIKeys:   apiKeys,
+	})
+
+	return &apiKeyTestEnv{
+		store:     store,
+		permStore: permStore,
+		apiKeys:   apiKeys,
+		handler:   server.Handler(),
+	}
+}
+
+func (e *apiKeyTestEnv) serve(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	e.handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestHandleCreateAPIKey(t *testing.T) {
+	t.Parallel()
+
+	t.Run("issues a key", func(t *testing.T) {
+		t.Parallel()
+
+		env := newAPIKeyTestEnv(t)
+
+		body := `{"name": "ci-bot", "scopes": ["read", "write"]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/apikeys", strings.NewReader(body))
+		req.Header.Set("X-User-Id", "alice")
+
+		rec := env.serve(req)
+
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d", rec.Code)
+		}
+
+		var resp apitypes.CreateAPIKeyResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+
+		if resp.Secret == "" {
+			t.Error("expected secret in response")
+		}
+
+		if resp.APIKey.Principal != "service:alice/ci-bot" {
+			t.Errorf("unexpected principal %q", resp.APIKey.Principal)
+		}
+
+		if len(resp.APIKey.Scopes) != 2 {
+			t.Errorf("expected 2 scopes, got %v", resp.APIKey.Scopes)
+		}
+	})
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "invalid JSON", body: "nope"},
+		{name: "missing name", body: `{"scopes": ["read"]}`},
+		{name: "invalid name", body: `{"name": "a b", "scopes": ["read"]}`},
+		{name: "missing scopes", body: `{"name": "bot"}`},
+		{name: "unknown scope", body: `{"name": "bot", "scopes": ["admin"]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run("returns 400 for "+tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			env := newAPIKeyTestEnv(t)
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/apikeys", strings.NewReader(tt.body))
+			req.Header.Set("X-User-Id", "alice")
+
+			if rec := env.serve(req); rec.Code != http.StatusBadRequest {
+				t.Errorf("expected status 400, got %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestHandleListAPIKeys(t *testing.T) {
+	t.Parallel()
+
+	env := newAPIKeyTestEnv(t)
+
+	_, _, err := env.apiKeys.Issue("alice", "bot", []apikey.Scope{apikey.ScopeRead})
+	require.NoError(t, err)
+
+	_, _, err = env.apiKeys.Issue("bob", "other", []apikey.Scope{apikey.ScopeRead})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/apikeys", nil)
+	req.Header.Set("X-User-Id", "alice")
+
+	rec := env.serve(req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	var resp apitypes.ListAPIKeysResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+
+	if len(resp.APIKeys) != 1 || resp.APIKeys[0].Name != "bot" {
+		t.Errorf("expected only alice's key, got %+v", resp.APIKeys)
+	}
+}
+
+func TestHandleRevokeAPIKey(t *testing.T) {
+	t.Parallel()
+
+	env := newAPIKeyTestEnv(t)
+
+	key, _, err := env.apiKeys.Issue("alice", "bot", []apikey.Scope{apikey.ScopeRead})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodDelete, "/v1/apikeys/"+key.ID, nil)
+	req.Header.Set("X-User-Id", "bob")
+
+	if rec := env.serve(req); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another user's key, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/v1/apikeys/"+key.ID, nil)
+	req.Header.Set("X-User-Id", "alice")
+
+	if rec := env.serve(req); rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/apikeys/"+key.ID, nil)
+	req.Header.Set("X-User-Id", "alice")
+
+	if rec := env.serve(req); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/v1/apikeys/", nil)
+	req.Header.Set("X-User-Id", "alice")
+
+	if rec := env.serve(req); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	t.Parallel()
+
+	env := newAPIKeyTestEnv(t)
+	require.NoError(t, env.store.CreateDocument(t.Context(), "doc1"))
+
+	key, secret, err := env.apiKeys.Issue("alice", "reader", []apikey.Scope{apikey.ScopeRead})
+	require.NoError(t, err)
+	require.NoError(t, env.permStore.Grant("doc1", key.Principal(), acl.Owner))
+
+	t.Run("authenticates as the service principal", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/documents/doc1", nil)
+		req.Header.Set("X-Api-Key", secret)
+
+		if rec := env.serve(req); rec.Code != http.StatusOK {
+			t.Errorf("expected 200, got %d", rec.Code)
+		}
+	})
+
+	t.Run("enforces key scopes", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodDelete, "/v1/documents/doc1", nil)
+		req.Header.Set("X-Api-Key", secret)
+
+		if rec := env.serve(req); rec.Code != http.StatusForbidden {
+			t.Errorf("expected 403, got %d", rec.Code)
+		}
+	})
+
+	t.Run("rejects unknown keys", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/documents/doc1", nil)
+		req.Header.Set("X-Api-Key", "odk_bogus")
+
+		if rec := env.serve(req); rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401, got %d", rec.Code)
+		}
+	})
+
+	t.Run("rejects service identities in X-User-Id", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/documents/doc1", nil)
+		req.Header.Set("X-User-Id", key.Principal())
+
+		if rec := env.serve(req); rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401, got %d", rec.Code)
+		}
+	})
+
+	t.Run("keys cannot manage keys", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/apikeys", nil)
+		req.Header.Set("X-Api-Key", secret)
+
+		if rec := env.serve(req); rec.Code != http.StatusForbidden {
+			t.Errorf("expected 403, got %d", rec.Code)
+		}
+
+		req = httptest.NewRequest(http.MethodDelete, "/v1/apikeys/"+key.ID, nil)
+		req.Header.Set("X-Api-Key", secret)
+
+		// Delete scope is checked first
+		if rec := env.serve(req); rec.Code != http.StatusForbidden {
+			t.Errorf("expected 403, got %d", rec.Code)
+		}
+	})
+
+	t.Run("rejects other methods on collection", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodPut, "/v1/apikeys", bytes.NewReader(nil))
+		req.Header.Set("X-User-Id", "alice")
+
+		if rec := env.serve(req); rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("expected 405, got %d", rec.Code)
+		}
+	})
+}
+
+func TestAPIKeyRoutes_DisabledWithoutService(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	hub := ws.NewHub()
+	manager := collab.NewManager(collab.ManagerConfig{
+		Store: store,
+		Hub:   hub,
+	})
+
+	server := handler.NewServer(handler.ServerConfig{
+		Manager: manager,
+		Store:   store,
+		Hub:     hub,
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/apikeys", nil)
+	req.Header.Set("X-User-Id", "alice")
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestAPIKeyRoutes_StoreError(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	server := handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store}),
+		Store:   store,
+		APIKeys: apikey.NewService(failingKeyStore{}),
+	})
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+	}{
+		{http.MethodGet, "/v1/apikeys", ""},
+		{http.MethodPost, "/v1/apikeys", `{"name": "bot", "scopes": ["read"]}`},
+		{http.MethodDelete, "/v1/apikeys/key1", ""},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		req.Header.Set("X-User-Id", "alice")
+
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("%s %s: expected 500, got %d", tt.method, tt.target, rec.Code)
+		}
+	}
+}
+
+// failingKeyStore is an apikey.Store whose operations always fail.
+type failingKeyStore struct{}
+
+var errKeyStore = errors.New("key store unavailable")
+
+func (failingKeyStore) Save(apikey.Key, string) error { return errKeyStore }
+
+func (failingKeyStore) GetByHash(string) (apikey.Key, error) { return apikey.Key{}, errKeyStore }
+
+func (failingKeyStore) Get(string) (apikey.Key, error) { return apikey.Key{}, errKeyStore }
+
+func (failingKeyStore) Delete(string) error { return errKeyStore }
+
+func (failingKeyStore) ListByOwner(string) ([]apikey.Key, error) { return nil, errKeyStore }
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// handleArchive handles GET, PUT and DELETE /v1/documents/{id}/archive.
+// Anyone who can read the document can see its archive state; archiving and
+// unarchiving need the same access as deleting it.
+func (s *Server) handleArchive(w http.ResponseWriter, r *http.Request) {
+	var action acl.Action
+
+	switch r.Method {
+	case http.MethodGet:
+		action = acl.ActionRead
+	case http.MethodPut, http.MethodDelete:
+		action = acl.ActionDelete
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	docID := r.PathValue("docID")
+
+	resp, err := s.updateArchive(r.Context(), r.Method, docID, UserIDFromContext(r.Context()), action)
+	if err != nil {
+		switch {
+		case errors.Is(err, acl.ErrAccessDenied):
+			writeError(w, http.StatusForbidden, "access denied")
+		case errors.Is(err, storage.ErrDocumentNotFound):
+			writeError(w, http.StatusNotFound, "document not found")
+		default:
+			s.logger.ErrorContext(r.Context(), "archive request failed", logging.DocID(docID), logging.Err(err))
+			writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// updateArchive checks the user's access, then applies the request method to
+// the document's archive state and returns the resulting state.
+func (s *Server) updateArchive(
+	ctx context.Context, method, docID, userID string, action acl.Action,
+) (apitypes.ArchiveResponse, error) {
+	if s.permStore != nil {
+		checker := acl.NewChecker(s.permStore)
+		if err := checker.RequirePermission(docID, userID, action); err != nil {
+			return apitypes.ArchiveResponse{}, err
+		}
+	}
+
+	if method != http.MethodGet {
+		if err := s.manager.SetArchived(ctx, docID, method == http.MethodPut); err != nil {
+			return apitypes.ArchiveResponse{}, err
+		}
+	}
+
+	meta, err := s.store.LoadMetadata(ctx, docID)
+	if err != nil {
+		return apitypes.ArchiveResponse{}, err
+	}
+
+	resp := apitypes.ArchiveResponse{ID: docID, Archived: !meta.ArchivedAt.IsZero()}
+	if resp.Archived {
+		resp.ArchivedAt = &meta.ArchivedAt
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,126 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeArchive(t *testing.T, h http.Handler, userID, method string) apitypes.ArchiveResponse {
+	t.Helper()
+
+	rec := serveAs(h, userID, method, "/v1/documents/doc1/archive", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp apitypes.ArchiveResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+
+	return resp
+}
+
+func TestHandleArchive(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Owner))
+	require.NoError(t, permStore.Grant("doc1", "bob", acl.Viewer))
+
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore})
+	h := handler.NewServer(handler.ServerConfig{Manager: manager, Store: store, PermStore: permStore}).Handler()
+
+	if resp := decodeArchive(t, h, "bob", http.MethodGet); resp.Archived || resp.ArchivedAt != nil {
+		t.Errorf("expected a new document not to be archived, got %+v", resp)
+	}
+
+	// An open session is closed so the next one loads the archived state
+	_, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	archived := decodeArchive(t, h, "alice", http.MethodPut)
+	if !archived.Archived || archived.ArchivedAt == nil {
+		t.Fatalf("expected document to be archived, got %+v", archived)
+	}
+
+	require.Zero(t, manager.SessionCount())
+
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.True(t, session.Archived())
+
+	// Archiving again keeps the original time
+	again := decodeArchive(t, h, "alice", http.MethodPut)
+	require.True(t, again.ArchivedAt.Equal(*archived.ArchivedAt))
+
+	rec := serveAs(h, "bob", http.MethodGet, "/v1/documents/doc1/stats", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var stats apitypes.DocumentStatsResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&stats))
+	require.NotNil(t, stats.ArchivedAt)
+
+	if resp := decodeArchive(t, h, "alice", http.MethodDelete); resp.Archived || resp.ArchivedAt != nil {
+		t.Errorf("expected document to be unarchived, got %+v", resp)
+	}
+
+	session, err = manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.False(t, session.Archived())
+}
+
+func TestHandleArchive_Errors(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	acls, _ := newStatsServer(t, store)
+
+	noACL := handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store}),
+		Store:   store,
+	}).Handler()
+
+	brokenMetadata := failingMetadataStore{MemoryStore: storage.NewMemoryStore()}
+	require.NoError(t, brokenMetadata.CreateDocument(t.Context(), "doc1"))
+
+	failing := handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: brokenMetadata}),
+		Store:   brokenMetadata,
+	}).Handler()
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		userID  string
+		method  string
+		target  string
+		status  int
+	}{
+		{"no read access", acls, "mallory", http.MethodGet, "/v1/documents/doc1/archive", http.StatusForbidden},
+		{"editor cannot archive", acls, "alice", http.MethodPut, "/v1/documents/doc1/archive", http.StatusForbidden},
+		{"editor cannot unarchive", acls, "bob", http.MethodDelete, "/v1/documents/doc1/archive", http.StatusForbidden},
+		{"other methods", acls, "alice", http.MethodPost, "/v1/documents/doc1/archive", http.StatusMethodNotAllowed},
+		{"missing document", noACL, "alice", http.MethodPut, "/v1/documents/missing/archive", http.StatusNotFound},
+		{"metadata fails", failing, "alice", http.MethodGet, "/v1/documents/doc1/archive", 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if rec := serveAs(tt.handler, tt.userID, tt.method, tt.target, ""); rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
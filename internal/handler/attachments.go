@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/blob"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// defaultMaxAttachmentBytes caps uploads when ServerConfig.MaxAttachmentBytes is unset.
+const defaultMaxAttachmentBytes = 10 << 20
+
+// multipartOverheadBytes allows for the multipart boundaries and part headers
+// around an attachment of the maximum size.
+const multipartOverheadBytes = 64 << 10
+
+// attachmentFormField is the multipart field carrying the uploaded file.
+const attachmentFormField = "file"
+
+// attachmentTypes are the accepted content types, detected from the file's
+// contents rather than trusted from the client.
+var attachmentTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp", "application/pdf"}
+
+// handleUploadAttachment handles POST /v1/documents/{id}/attachments.
+// The file is sent as the "file" field of a multipart form and needs write
+// access to the document.
+func (s *Server) handleUploadAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	docID := r.PathValue("docID")
+
+	if err := s.requireDocument(r.Context(), docID, UserIDFromContext(r.Context()), acl.ActionWrite); err != nil {
+		s.writeAttachmentError(w, r, err)
+
+		return
+	}
+
+	obj, ok := s.readAttachment(w, r)
+	if !ok {
+		return
+	}
+
+	obj.DocID = docID
+	obj.ID = uuid.New().String()
+	obj.CreatedAt = time.Now()
+
+	if err := s.blobs.Put(obj); err != nil {
+		s.writeAttachmentError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, apitypes.AttachmentResponse{
+		ID:          obj.ID,
+		Name:        obj.Name,
+		ContentType: obj.ContentType,
+		Size:        len(obj.Data),
+		URL:         apiPrefix + "/documents/" + docID + "/attachments/" + obj.ID,
+	})
+}
+
+// readAttachment reads the uploaded file from the multipart body and checks
+// its size and type. It writes the error response and returns false if the
+// upload is not acceptable.
+func (s *Server) readAttachment(w http.ResponseWriter, r *http.Request) (blob.Object, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxAttachmentBytes+multipartOverheadBytes)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "expected a multipart/form-data body")
+
+		return blob.Object{}, false
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			writeUploadError(w, err)
+
+			return blob.Object{}, false
+		}
+
+		if part.FormName() != attachmentFormField {
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, s.maxAttachmentBytes+1))
+		if err != nil {
+			writeUploadError(w, err)
+
+			return blob.Object{}, false
+		}
+
+		if int64(len(data)) > s.maxAttachmentBytes {
+			writeError(w, http.StatusRequestEntityTooLarge, "attachment too large")
+
+			return blob.Object{}, false
+		}
+
+		contentType := http.DetectContentType(data)
+		if !slices.Contains(attachmentTypes, contentType) {
+			writeError(w, http.StatusUnsupportedMediaType, "unsupported attachment type "+contentType)
+
+			return blob.Object{}, false
+		}
+
+		return blob.Object{Name: part.FileName(), ContentType: contentType, Data: data}, true
+	}
+}
+
+// writeUploadError reports a failure to read the multipart body.
+func writeUploadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &tooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, "attachment too large")
+	case errors.Is(err, io.EOF):
+		writeError(w, http.StatusBadRequest, "missing "+attachmentFormField+" field")
+	default:
+		writeError(w, http.StatusBadRequest, "invalid multipart body: "+err.Error())
+	}
+}
+
+// handleGetAttachment handles GET /v1/documents/{id}/attachments/{attachmentId}.
+func (s *Server) handleGetAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	docID := r.PathValue("docID")
+
+	if err := s.requireDocument(r.Context(), docID, UserIDFromContext(r.Context()), acl.ActionRead); err != nil {
+		s.writeAttachmentError(w, r, err)
+
+		return
+	}
+
+	obj, err := s.blobs.Get(docID, r.PathValue("attachmentID"))
+	if err != nil {
+		s.writeAttachmentError(w, r, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", obj.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(obj.Data)
+}
+
+// requireDocument checks that the user may perform the action on the
+// document and that it exists.
+func (s *Server) requireDocument(ctx context.Context, docID, userID string, action acl.Action) error {
+	if s.permStore != nil {
+		checker := acl.NewChecker(s.permStore)
+		if err := checker.RequirePermission(docID, userID, action); err != nil {
+			return err
+		}
+	}
+
+	exists, err := s.store.DocumentExists(ctx, docID)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return storage.ErrDocumentNotFound
+	}
+
+	return nil
+}
+
+// writeAttachmentError maps a permission, storage or blob error to a response.
+func (s *Server) writeAttachmentError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, acl.ErrAccessDenied):
+		writeError(w, http.StatusForbidden, "access denied")
+	case errors.Is(err, storage.ErrDocumentNotFound):
+		writeError(w, http.StatusNotFound, "document not found")
+	case errors.Is(err, blob.ErrNotFound):
+		writeError(w, http.StatusNotFound, "attachment not found")
+	default:
+		s.logger.ErrorContext(r.Context(), "attachment request failed", logging.DocID(r.PathValue("docID")), logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
@@ -0,0 +1,229 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/blob"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// pngData starts with the PNG signature, which is all content sniffing needs.
+var pngData = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// failingBlobStore is a blob.Store whose Put always fails.
+type failingBlobStore struct {
+	*blob.MemoryStore
+}
+
+func (failingBlobStore) Put(blob.Object) error {
+	return errors.New("blobs unavailable")
+}
+
+// formPart is one part of a multipart upload. Parts without a file name are
+// sent as plain form fields.
+type formPart struct {
+	field    string
+	fileName string
+	data     []byte
+}
+
+func upload(t *testing.T, h http.Handler, userID, target string, parts ...formPart) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body bytes.Buffer
+
+	mw := multipart.NewWriter(&body)
+
+	for _, part := range parts {
+		var (
+			w   io.Writer
+			err error
+		)
+
+		if part.fileName == "" {
+			w, err = mw.CreateFormField(part.field)
+		} else {
+			w, err = mw.CreateFormFile(part.field, part.fileName)
+		}
+
+		require.NoError(t, err)
+
+		_, err = w.Write(part.data)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, target, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("X-User-Id", userID)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func newAttachmentServer(store storage.Store, permStore acl.Store, blobs blob.Store, maxBytes int64) http.Handler {
+	return handler.NewServer(handler.ServerConfig{
+		Manager:            collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore}),
+		Store:              store,
+		PermStore:          permStore,
+		Blobs:              blobs,
+		MaxAttachmentBytes: maxBytes,
+	}).Handler()
+}
+
+func TestHandleAttachments(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Owner))
+	require.NoError(t, permStore.Grant("doc1", "bob", acl.Viewer))
+
+	blobs := blob.NewMemoryStore()
+	h := newAttachmentServer(store, permStore, blobs, 0)
+
+	rec := upload(t, h, "alice", "/v1/documents/doc1/attachments",
+		formPart{field: "caption", data: []byte("ignored")},
+		formPart{field: "file", fileName: "chart.png", data: pngData},
+	)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	var resp apitypes.AttachmentResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+
+	if resp.Name != "chart.png" || resp.ContentType != "image/png" || resp.Size != len(pngData) {
+		t.Errorf("unexpected attachment %+v", resp)
+	}
+
+	require.Equal(t, "/v1/documents/doc1/attachments/"+resp.ID, resp.URL)
+
+	// Readers of the document can download it
+	rec = serveAs(h, "bob", http.MethodGet, resp.URL, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, pngData, rec.Body.Bytes())
+	require.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	require.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+
+	// Deleting the document removes its attachments
+	require.Equal(t, http.StatusNoContent, serveAs(h, "alice", http.MethodDelete, "/v1/documents/doc1", "").Code)
+
+	_, err := blobs.Get("doc1", resp.ID)
+	require.ErrorIs(t, err, blob.ErrNotFound)
+}
+
+func TestHandleAttachments_Errors(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Editor))
+	require.NoError(t, permStore.Grant("doc1", "bob", acl.Viewer))
+
+	acls := newAttachmentServer(store, permStore, blob.NewMemoryStore(), 64)
+	brokenBlobs := newAttachmentServer(store, nil, failingBlobStore{MemoryStore: blob.NewMemoryStore()}, 0)
+	brokenStore := newAttachmentServer(failingExistsStore{MemoryStore: store}, nil, blob.NewMemoryStore(), 0)
+
+	png := formPart{field: "file", fileName: "chart.png", data: pngData}
+	oversized := formPart{field: "padding", data: bytes.Repeat([]byte("x"), 128<<10)}
+
+	uploads := []struct {
+		name    string
+		handler http.Handler
+		userID  string
+		target  string
+		parts   []formPart
+		status  int
+	}{
+		{"no write access", acls, "bob", "/v1/documents/doc1/attachments", []formPart{png}, 403},
+		{"missing document", brokenBlobs, "alice", "/v1/documents/missing/attachments", []formPart{png}, 404},
+		{"missing file", acls, "alice", "/v1/documents/doc1/attachments", []formPart{{field: "x"}}, 400},
+		{
+			"unsupported type", acls, "alice", "/v1/documents/doc1/attachments",
+			[]formPart{{field: "file", fileName: "notes.txt", data: []byte("plain text")}}, 415,
+		},
+		{
+			"attachment too large", acls, "alice", "/v1/documents/doc1/attachments",
+			[]formPart{{field: "file", fileName: "big.png", data: append(pngData, make([]byte, 64)...)}}, 413,
+		},
+		{"body too large", acls, "alice", "/v1/documents/doc1/attachments", []formPart{oversized, png}, 413},
+		{"store fails", brokenBlobs, "alice", "/v1/documents/doc1/attachments", []formPart{png}, 500},
+		{"existence check fails", brokenStore, "alice", "/v1/documents/doc1/attachments", []formPart{png}, 500},
+	}
+
+	for _, tt := range uploads {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if rec := upload(t, tt.handler, tt.userID, tt.target, tt.parts...); rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	requests := []struct {
+		name    string
+		handler http.Handler
+		userID  string
+		method  string
+		target  string
+		body    string
+		status  int
+	}{
+		{"not multipart", acls, "alice", http.MethodPost, "/v1/documents/doc1/attachments", `{}`, 400},
+		{"upload with other methods", acls, "alice", http.MethodGet, "/v1/documents/doc1/attachments", "", 405},
+		{"download with other methods", acls, "alice", http.MethodPut, "/v1/documents/doc1/attachments/a1", "", 405},
+		{"no read access", acls, "mallory", http.MethodGet, "/v1/documents/doc1/attachments/a1", "", 403},
+		{"unknown attachment", acls, "bob", http.MethodGet, "/v1/documents/doc1/attachments/a1", "", 404},
+	}
+
+	for _, tt := range requests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if rec := serveAs(tt.handler, tt.userID, tt.method, tt.target, tt.body); rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("malformed multipart", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/documents/doc1/attachments", strings.NewReader("garbage"))
+		req.Header.Set("Content-Type", "multipart/form-data; boundary=xyz")
+		req.Header.Set("X-User-Id", "alice")
+
+		rec := httptest.NewRecorder()
+		acls.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	})
+
+	t.Run("disabled without blob store", func(t *testing.T) {
+		t.Parallel()
+
+		h := newAttachmentServer(store, nil, nil, 0)
+
+		rec := upload(t, h, "alice", "/v1/documents/doc1/attachments", png)
+		require.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/webhook"
+)
+
+// batchItemError is a per-document failure with the status and message the
+// single-document request would report.
+type batchItemError struct {
+	status  int
+	message string
+}
+
+func (e *batchItemError) Error() string {
+	return e.message
+}
+
+// handleBatchCreate handles POST /v1/documents/batch.
+// Each document is created with its content and shares independently, and
+// the response reports the outcome for every requested document. Documents
+// another node owns are created by that node.
+func (s *Server) handleBatchCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	var req apitypes.BatchCreateRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	ids := make([]string, len(req.Documents))
+	for i, doc := range req.Documents {
+		ids[i] = doc.ID
+	}
+
+	forwarded := s.forwardBatch(r, ids, func(indices []int) any {
+		sub := apitypes.BatchCreateRequest{Documents: make([]apitypes.BatchCreateDocument, len(indices))}
+		for j, i := range indices {
+			sub.Documents[j] = req.Documents[i]
+		}
+
+		return sub
+	})
+
+	userID := UserIDFromContext(r.Context())
+	resp := apitypes.BatchCreateResponse{Results: make([]apitypes.BatchResult, 0, len(req.Documents))}
+
+	for i, doc := range req.Documents {
+		if result, ok := forwarded[i]; ok {
+			resp.Results = append(resp.Results, result)
+
+			continue
+		}
+
+		result := apitypes.BatchResult{ID: doc.ID, Status: http.StatusCreated}
+
+		if err := s.createSharedDocument(r.Context(), doc, userID); err != nil {
+			status, message := createErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				s.logger.ErrorContext(r.Context(), "batch create failed", logging.DocID(doc.ID), logging.Err(err))
+			}
+
+			result.Status = status
+			result.Error = &apitypes.ErrorResponse{
+				Code:    apitypes.ErrorCodeForStatus(status),
+				Message: message,
+			}
+		} else {
+			s.publishEvent(webhook.EventDocumentCreated, doc.ID, userID)
+		}
+
+		resp.Results = append(resp.Results, result)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// createSharedDocument creates one document of a batch and grants its shares
+// and the creator's Owner role. If any grant fails, the document and the
+// grants made so far are removed again.
+func (s *Server) createSharedDocument(ctx context.Context, doc apitypes.BatchCreateDocument, userID string) error {
+	roles, err := s.shareRoles(ctx, doc.Shares)
+	if err != nil {
+		return err
+	}
+
+	if err := s.createDocument(ctx, doc.ID, doc.Content); err != nil {
+		return err
+	}
+
+	if s.permStore == nil {
+		return nil
+	}
+
+	// The creator is granted last so a share can't demote them
+	grants := make([]acl.Permission, 0, len(doc.Shares)+1)
+	for i, share := range doc.Shares {
+		grants = append(grants, acl.Permission{DocID: doc.ID, UserID: share.UserID, Role: roles[i]})
+	}
+
+	if userID != "" {
+		grants = append(grants, acl.Permission{DocID: doc.ID, UserID: userID, Role: acl.Owner})
+	}
+
+	for i, grant := range grants {
+		if err := s.permStore.Grant(grant.DocID, grant.UserID, grant.Role); err != nil {
+			for _, granted := range grants[:i] {
+				_ = s.permStore.Revoke(granted.DocID, granted.UserID)
+			}
+
+			_ = s.store.DeleteDocument(context.WithoutCancel(ctx), doc.ID)
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// shareRoles parses the roles of a document's shares. Sharing needs the
+// share scope when the request is authenticated with an API key.
+func (s *Server) shareRoles(ctx context.Context, shares []apitypes.DocumentShare) ([]acl.Role, error) {
+	if len(shares) == 0 {
+		return nil, nil
+	}
+
+	if key, ok := apiKeyFromContext(ctx); ok && !key.Allows(acl.ActionShare) {
+		return nil, &batchItemError{
+			status:  http.StatusForbidden,
+			message: "API key scope does not permit " + acl.ActionShare.String(),
+		}
+	}
+
+	roles := make([]acl.Role, 0, len(shares))
+
+	for i, share := range shares {
+		role, err := acl.ParseRole(share.Role)
+		if err != nil {
+			return nil, &batchItemError{
+				status:  http.StatusBadRequest,
+				message: fmt.Sprintf("shares[%d].role: must be one of viewer, editor, owner", i),
+			}
+		}
+
+		roles = append(roles, role)
+	}
+
+	return roles, nil
+}
+
+// createErrorStatus maps a createSharedDocument error to an HTTP status and message.
+func createErrorStatus(err error) (int, string) {
+	var itemErr *batchItemError
+
+	switch {
+	case errors.As(err, &itemErr):
+		return itemErr.status, itemErr.message
+	case errors.Is(err, storage.ErrDocumentExists):
+		return http.StatusConflict, "document already exists"
+	default:
+		return http.StatusInternalServerError, "internal server error"
+	}
+}
+
+// handleBatchDelete handles POST /v1/documents/batch-delete.
+// Each document is permission-checked and deleted independently, and the
+// response reports the outcome for every requested ID. Documents another
+// node owns are deleted by that node.
+func (s *Server) handleBatchDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	var req apitypes.BatchDeleteRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	forwarded := s.forwardBatch(r, req.IDs, func(indices []int) any {
+		sub := apitypes.BatchDeleteRequest{IDs: make([]string, len(indices))}
+		for j, i := range indices {
+			sub.IDs[j] = req.IDs[i]
+		}
+
+		return sub
+	})
+
+	userID := UserIDFromContext(r.Context())
+	resp := apitypes.BatchDeleteResponse{Results: make([]apitypes.BatchResult, 0, len(req.IDs))}
+
+	for i, docID := range req.IDs {
+		if result, ok := forwarded[i]; ok {
+			resp.Results = append(resp.Results, result)
+
+			continue
+		}
+
+		result := apitypes.BatchResult{ID: docID, Status: http.StatusNoContent}
+
+		if err := s.deleteDocument(r.Context(), docID, userID); err != nil {
+			status, message := deleteErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				s.logger.ErrorContext(r.Context(), "batch delete failed", logging.DocID(docID), logging.Err(err))
+			}
+
+			result.Status = status
+			result.Error = &apitypes.ErrorResponse{
+				Code:    apitypes.ErrorCodeForStatus(status),
+				Message: message,
+			}
+		}
+
+		resp.Results = append(resp.Results, result)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
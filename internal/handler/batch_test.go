@@ -0,0 +1,400 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apikey"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleBatchDelete(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	permStore := acl.NewMemoryStore()
+	hub := ws.NewHub()
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore, Hub: hub})
+
+	server := handler.NewServer(handler.ServerConfig{
+		Manager:   manager,
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+	})
+
+	for _, docID := range []string{"mine", "theirs", "open"} {
+		require.NoError(t, store.CreateDocument(t.Context(), docID))
+	}
+
+	require.NoError(t, permStore.Grant("mine", "alice", acl.Owner))
+	require.NoError(t, permStore.Grant("theirs", "bob", acl.Owner))
+	require.NoError(t, permStore.Grant("theirs", "alice", acl.Editor))
+	require.NoError(t, permStore.Grant("open", "alice", acl.Owner))
+
+	// An active session is closed along with the document
+	_, err := manager.GetOrCreateSession(t.Context(), "open")
+	require.NoError(t, err)
+
+	body := `{"ids": ["mine", "theirs", "missing", "open"]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/documents/batch-delete", strings.NewReader(body))
+	req.Header.Set("X-User-Id", "alice")
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp apitypes.BatchDeleteResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Len(t, resp.Results, 4)
+
+	want := []struct {
+		id     string
+		status int
+		code   string
+	}{
+		{"mine", http.StatusNoContent, ""},
+		{"theirs", http.StatusForbidden, apitypes.ErrorCodeAccessDenied},
+		{"missing", http.StatusForbidden, apitypes.ErrorCodeAccessDenied},
+		{"open", http.StatusNoContent, ""},
+	}
+
+	for i, w := range want {
+		got := resp.Results[i]
+		if got.ID != w.id || got.Status != w.status {
+			t.Errorf("result %d: expected %s/%d, got %s/%d", i, w.id, w.status, got.ID, got.Status)
+		}
+
+		if w.code == "" && got.Error != nil {
+			t.Errorf("result %d: expected no error, got %+v", i, got.Error)
+		}
+
+		if w.code != "" && (got.Error == nil || got.Error.Code != w.code) {
+			t.Errorf("result %d: expected error code %q, got %+v", i, w.code, got.Error)
+		}
+	}
+
+	for docID, want := range map[string]bool{"mine": false, "theirs": true, "open": false} {
+		if exists, _ := store.DocumentExists(t.Context(), docID); exists != want {
+			t.Errorf("document %q exists = %v, want %v", docID, exists, want)
+		}
+	}
+
+	if manager.GetSession("open") != nil {
+		t.Error("expected session to be closed")
+	}
+}
+
+func TestHandleBatchDelete_Errors(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	server := handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store}),
+		Store:   store,
+	})
+
+	tooMany := `{"ids": [` + strings.TrimSuffix(strings.Repeat(`"d",`, apitypes.MaxBatchSize+1), ",") + `]}`
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{"wrong method", http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"invalid body", http.MethodPost, `{`, http.StatusBadRequest},
+		{"no ids", http.MethodPost, `{"ids": []}`, http.StatusBadRequest},
+		{"invalid id", http.MethodPost, `{"ids": ["a/b"]}`, http.StatusBadRequest},
+		{"too many ids", http.MethodPost, tooMany, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(tt.method, "/v1/documents/batch-delete", strings.NewReader(tt.body))
+			req.Header.Set("X-User-Id", "alice")
+
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleBatchDelete_StorageError(t *testing.T) {
+	t.Parallel()
+
+	store := failingDeleteStore{MemoryStore: storage.NewMemoryStore()}
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	server := handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store}),
+		Store:   store,
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/documents/batch-delete", strings.NewReader(`{"ids": ["doc1"]}`))
+	req.Header.Set("X-User-Id", "alice")
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp apitypes.BatchDeleteResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Len(t, resp.Results, 1)
+
+	if resp.Results[0].Status != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", resp.Results[0].Status)
+	}
+}
+
+func TestHandleBatchDelete_RequiresDeleteScope(t *testing.T) {
+	t.Parallel()
+
+	env := newAPIKeyTestEnv(t)
+
+	_, secret, err := env.apiKeys.Issue("alice", "writer", []apikey.Scope{apikey.ScopeWrite})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/documents/batch-delete", strings.NewReader(`{"ids": ["doc1"]}`))
+	req.Header.Set("X-Api-Key", secret)
+
+	if rec := env.serve(req); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a key without the delete scope, got %d", rec.Code)
+	}
+}
+
+func TestHandleBatchCreate(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	permStore := acl.NewMemoryStore()
+	hub := ws.NewHub()
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore, Hub: hub})
+
+	server := handler.NewServer(handler.ServerConfig{
+		Manager:   manager,
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+	})
+
+	require.NoError(t, store.CreateDocument(t.Context(), "taken"))
+
+	body := `{"documents": [
+		{"id": "notes", "content": "hello", "shares": [{"userId": "bob", "role": "editor"}]},
+		{"id": "taken"},
+		{"id": "bad-role", "shares": [{"userId": "bob", "role": "admin"}]},
+		{"id": "self", "shares": [{"userId": "alice", "role": "viewer"}]}
+	]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/documents/batch", strings.NewReader(body))
+	req.Header.Set("X-User-Id", "alice")
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp apitypes.BatchCreateResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Len(t, resp.Results, 4)
+
+	want := []struct {
+		id     string
+		status int
+		code   string
+	}{
+		{"notes", http.StatusCreated, ""},
+		{"taken", http.StatusConflict, apitypes.ErrorCodeConflict},
+		{"bad-role", http.StatusBadRequest, apitypes.ErrorCodeInvalidRequest},
+		{"self", http.StatusCreated, ""},
+	}
+
+	for i, w := range want {
+		got := resp.Results[i]
+		if got.ID != w.id || got.Status != w.status {
+			t.Errorf("result %d: expected %s/%d, got %s/%d", i, w.id, w.status, got.ID, got.Status)
+		}
+
+		if w.code == "" && got.Error != nil {
+			t.Errorf("result %d: expected no error, got %+v", i, got.Error)
+		}
+
+		if w.code != "" && (got.Error == nil || got.Error.Code != w.code) {
+			t.Errorf("result %d: expected error code %q, got %+v", i, w.code, got.Error)
+		}
+	}
+
+	snapshot, err := store.LoadSnapshot(t.Context(), "notes")
+	require.NoError(t, err)
+	require.Equal(t, "hello", snapshot.Content)
+
+	roles := []struct {
+		docID, userID string
+		role          acl.Role
+	}{
+		{"notes", "alice", acl.Owner},
+		{"notes", "bob", acl.Editor},
+		{"self", "alice", acl.Owner}, // A share can't demote the creator
+	}
+
+	for _, r := range roles {
+		if role, err := permStore.GetRole(r.docID, r.userID); err != nil || role != r.role {
+			t.Errorf("%s on %s: expected %v, got %v (%v)", r.userID, r.docID, r.role, role, err)
+		}
+	}
+
+	if exists, _ := store.DocumentExists(t.Context(), "bad-role"); exists {
+		t.Error("expected document with an invalid share to not be created")
+	}
+}
+
+func TestHandleBatchCreate_Errors(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	server := handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store}),
+		Store:   store,
+	})
+
+	tooMany := `{"documents": [` + strings.TrimSuffix(strings.Repeat(`{"id": "d"},`, apitypes.MaxBatchSize+1), ",") + `]}`
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{"wrong method", http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"invalid body", http.MethodPost, `{`, http.StatusBadRequest},
+		{"no documents", http.MethodPost, `{"documents": []}`, http.StatusBadRequest},
+		{"invalid id", http.MethodPost, `{"documents": [{"id": "a/b"}]}`, http.StatusBadRequest},
+		{"too many documents", http.MethodPost, tooMany, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(tt.method, "/v1/documents/batch", strings.NewReader(tt.body))
+			req.Header.Set("X-User-Id", "alice")
+
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleBatchCreate_RollsBack(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		store     storage.Store
+		permStore acl.Store
+	}{
+		{"content fails", &failingSnapshotStore{MemoryStore: storage.NewMemoryStore()}, acl.NewMemoryStore()},
+		{"share fails", storage.NewMemoryStore(), failingGrantStore{MemoryStore: acl.NewMemoryStore(), userID: "mallory"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := handler.NewServer(handler.ServerConfig{
+				Manager:   collab.NewManager(collab.ManagerConfig{Store: tt.store}),
+				Store:     tt.store,
+				PermStore: tt.permStore,
+			})
+
+			body := `{"documents": [{"id": "doc1", "content": "hi", "shares": [
+				{"userId": "bob", "role": "viewer"},
+				{"userId": "mallory", "role": "viewer"}
+			]}]}`
+			req := httptest.NewRequest(http.MethodPost, "/v1/documents/batch", strings.NewReader(body))
+			req.Header.Set("X-User-Id", "alice")
+
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			var resp apitypes.BatchCreateResponse
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+			require.Len(t, resp.Results, 1)
+
+			if resp.Results[0].Status != http.StatusInternalServerError {
+				t.Errorf("expected status 500, got %d", resp.Results[0].Status)
+			}
+
+			if exists, _ := tt.store.DocumentExists(t.Context(), "doc1"); exists {
+				t.Error("expected document to be rolled back")
+			}
+
+			if _, err := tt.permStore.GetRole("doc1", "bob"); !errors.Is(err, acl.ErrPermissionNotFound) {
+				t.Errorf("expected share to be rolled back, got %v", err)
+			}
+		})
+	}
+}
+
+func TestHandleBatchCreate_RequiresShareScope(t *testing.T) {
+	t.Parallel()
+
+	env := newAPIKeyTestEnv(t)
+
+	_, secret, err := env.apiKeys.Issue("alice", "importer", []apikey.Scope{apikey.ScopeWrite})
+	require.NoError(t, err)
+
+	body := `{"documents": [{"id": "plain"}, {"id": "shared", "shares": [{"userId": "bob", "role": "viewer"}]}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/documents/batch", strings.NewReader(body))
+	req.Header.Set("X-Api-Key", secret)
+
+	rec := env.serve(req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp apitypes.BatchCreateResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Len(t, resp.Results, 2)
+
+	if resp.Results[0].Status != http.StatusCreated || resp.Results[1].Status != http.StatusForbidden {
+		t.Errorf("expected 201 and 403, got %d and %d", resp.Results[0].Status, resp.Results[1].Status)
+	}
+}
+
+// failingGrantStore is an acl.MemoryStore whose Grant fails for one user.
+type failingGrantStore struct {
+	*acl.MemoryStore
+
+	userID string
+}
+
+func (f failingGrantStore) Grant(docID, userID string, role acl.Role) error {
+	if userID == f.userID {
+		return errors.New("grant failed")
+	}
+
+	return f.MemoryStore.Grant(docID, userID, role)
+}
@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/bot"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// handleBots routes GET and POST requests for /v1/bots.
+func (s *Server) handleBots(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.handleListBots(w, r)
+	case http.MethodPost:
+		s.handleCreateBot(w, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleCreateBot handles POST /v1/bots.
+func (s *Server) handleCreateBot(w http.ResponseWriter, r *http.Request) {
+	var req apitypes.CreateBotRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	b, err := s.bots.Register(botOwner(r.Context()), req.Name)
+	if err != nil {
+		s.writeBotError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, s.toBot(b))
+}
+
+// handleListBots handles GET /v1/bots.
+func (s *Server) handleListBots(w http.ResponseWriter, r *http.Request) {
+	bots, err := s.bots.List(botOwner(r.Context()))
+	if err != nil {
+		s.writeBotError(w, r, err)
+
+		return
+	}
+
+	resp := apitypes.ListBotsResponse{Bots: make([]apitypes.Bot, 0, len(bots))}
+	for _, b := range bots {
+		resp.Bots = append(resp.Bots, s.toBot(b))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleBotByID handles GET and DELETE /v1/bots/{botID}.
+func (s *Server) handleBotByID(w http.ResponseWriter, r *http.Request) {
+	owner, botID := botOwner(r.Context()), r.PathValue("botID")
+
+	switch r.Method {
+	case http.MethodGet:
+		b, err := s.bots.Get(owner, botID)
+		if err != nil {
+			s.writeBotError(w, r, err)
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, s.toBot(b))
+	case http.MethodDelete:
+		if err := s.bots.Delete(owner, botID); err != nil {
+			s.writeBotError(w, r, err)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleBotDocument handles PUT and DELETE /v1/bots/{botID}/documents/{docID},
+// which join a bot to a document and make it leave.
+func (s *Server) handleBotDocument(w http.ResponseWriter, r *http.Request) {
+	owner, botID, docID := botOwner(r.Context()), r.PathValue("botID"), r.PathValue("docID")
+
+	var err error
+
+	switch r.Method {
+	case http.MethodPut:
+		err = s.bots.Join(r.Context(), owner, botID, docID)
+	case http.MethodDelete:
+		err = s.bots.Leave(owner, botID, docID)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	if err != nil {
+		s.writeBotError(w, r, err)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleBotEdit handles POST /v1/bots/{botID}/documents/{docID}/edits.
+func (s *Server) handleBotEdit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	var req apitypes.BotEditRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	revision, err := s.bots.Edit(r.Context(), botOwner(r.Context()), r.PathValue("botID"), r.PathValue("docID"),
+		bot.Edit{Position: req.Position, Delete: req.Delete, Text: req.Text})
+	if err != nil {
+		s.writeBotError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apitypes.BotEditResponse{Revision: revision})
+}
+
+// botOwner returns the user whose bots a request manages. API keys act for
+// the user who created them.
+func botOwner(ctx context.Context) string {
+	if key, ok := apiKeyFromContext(ctx); ok {
+		return key.OwnerID
+	}
+
+	return UserIDFromContext(ctx)
+}
+
+// writeBotError maps a bot service error to an HTTP response.
+func (s *Server) writeBotError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, bot.ErrBotNotFound):
+		writeError(w, http.StatusNotFound, "bot not found")
+	case errors.Is(err, storage.ErrDocumentNotFound):
+		writeError(w, http.StatusNotFound, "document not found")
+	case errors.Is(err, acl.ErrAccessDenied):
+		writeError(w, http.StatusForbidden, "access denied")
+	case errors.Is(err, bot.ErrBotExists):
+		writeError(w, http.StatusConflict, "a bot with this name already exists")
+	case errors.Is(err, bot.ErrNotJoined):
+		writeError(w, http.StatusConflict, "bot has not joined the document")
+	case errors.Is(err, collab.ErrDocumentArchived):
+		writeError(w, http.StatusConflict, "document is archived")
+	case errors.Is(err, bot.ErrInvalidEdit):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, bot.ErrRateLimited):
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusTooManyRequests, "bot edit rate exceeded")
+	default:
+		s.logger.ErrorContext(r.Context(), "bot request failed", logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
+
+// toBot converts a bot into its API representation.
+func (s *Server) toBot(b bot.Bot) apitypes.Bot {
+	return apitypes.Bot{
+		ID:        b.ID,
+		Name:      b.Name,
+		Principal: b.Principal(),
+		Documents: s.bots.Documents(b.ID),
+		CreatedAt: b.CreatedAt,
+	}
+}
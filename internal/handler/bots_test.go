@@ -0,0 +1,226 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/bot"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// botTestEnv wires a server with bots enabled and a document "doc1" owned
+// by alice.
+type botTestEnv struct {
+	permStore *acl.MemoryStore
+	hub       *ws.Hub
+	handler   http.Handler
+}
+
+func newBotTestEnv(t *testing.T, cfg bot.Config) *botTestEnv {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Owner))
+
+	hub := ws.NewHub()
+
+	manager := collab.NewManager(collab.ManagerConfig{
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+	})
+
+	if cfg.Store == nil {
+		cfg.Store = bot.NewMemoryStore()
+	}
+
+	cfg.Manager, cfg.Hub = manager, hub
+
+	server := handler.NewServer(handler.ServerConfig{
+		Manager:   manager,
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+		Bots:      bot.NewService(cfg),
+	})
+
+	return &botTestEnv{permStore: permStore, hub: hub, handler: server.Handler()}
+}
+
+func (e *botTestEnv) do(method, path, userID, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-User-Id", userID)
+
+	rec := httptest.NewRecorder()
+	e.handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// createBot registers a bot for alice with editor access to doc1.
+func (e *botTestEnv) createBot(t *testing.T, name string) apitypes.Bot {
+	t.Helper()
+
+	rec := e.do(http.MethodPost, "/v1/bots", "alice", `{"name": "`+name+`"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	var b apitypes.Bot
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&b))
+	require.NoError(t, e.permStore.Grant("doc1", b.Principal, acl.Editor))
+
+	return b
+}
+
+func TestHandleBots(t *testing.T) {
+	t.Parallel()
+
+	env := newBotTestEnv(t, bot.Config{})
+	b := env.createBot(t, "notes")
+	require.Equal(t, "bot:alice/notes", b.Principal)
+
+	rec := env.do(http.MethodPost, "/v1/bots", "alice", `{"name": "notes"}`)
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = env.do(http.MethodPost, "/v1/bots", "alice", `{"name": "no spaces"}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = env.do(http.MethodPut, "/v1/bots/"+b.ID+"/documents/doc1", "alice", "")
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	require.Equal(t, []ws.Participant{{UserID: b.Principal, Bot: true}}, env.hub.Participants("doc1"))
+
+	rec = env.do(http.MethodGet, "/v1/bots", "alice", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var list apitypes.ListBotsResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&list))
+	require.Len(t, list.Bots, 1)
+	require.Equal(t, []string{"doc1"}, list.Bots[0].Documents)
+
+	// Bots belong to the user who created them
+	rec = env.do(http.MethodGet, "/v1/bots/"+b.ID, "bob", "")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = env.do(http.MethodDelete, "/v1/bots/"+b.ID, "alice", "")
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Empty(t, env.hub.Participants("doc1"))
+
+	rec = env.do(http.MethodGet, "/v1/bots/"+b.ID, "alice", "")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandleBotEdit(t *testing.T) {
+	t.Parallel()
+
+	env := newBotTestEnv(t, bot.Config{Rate: 0.001, Burst: 10})
+	b := env.createBot(t, "notes")
+	edits := "/v1/bots/" + b.ID + "/documents/doc1/edits"
+
+	rec := env.do(http.MethodPost, edits, "alice", `{"text": "hello"}`)
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = env.do(http.MethodPut, "/v1/bots/"+b.ID+"/documents/doc1", "alice", "")
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = env.do(http.MethodPost, edits, "alice", `{"text": "hello"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp apitypes.BotEditResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, 5, resp.Revision)
+
+	rec = env.do(http.MethodPost, edits, "alice", `{"position": 9, "text": "!"}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = env.do(http.MethodPost, edits, "alice", `{"position": 0, "delete": 1, "text": "jello"}`)
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	var errResp apitypes.ErrorResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&errResp))
+	require.Equal(t, apitypes.ErrorCodeRateLimited, errResp.Code)
+
+	rec = env.do(http.MethodGet, "/v1/documents/doc1", "alice", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"hello"`)
+}
+
+func TestBotsCannotAuthenticate(t *testing.T) {
+	t.Parallel()
+
+	env := newBotTestEnv(t, bot.Config{})
+	b := env.createBot(t, "notes")
+
+	rec := env.do(http.MethodGet, "/v1/documents/doc1", b.Principal, "")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+// failingBotStore is a bot.Store that can't be read.
+type failingBotStore struct {
+	*bot.MemoryStore
+}
+
+func (failingBotStore) ListByOwner(string) ([]bot.Bot, error) {
+	return nil, errors.New("bots unavailable")
+}
+
+func TestHandleBots_Errors(t *testing.T) {
+	t.Parallel()
+
+	env := newBotTestEnv(t, bot.Config{})
+	b := env.createBot(t, "notes")
+
+	// Registered without access to doc1
+	rec := env.do(http.MethodPost, "/v1/bots", "alice", `{"name": "outsider"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	var outsider apitypes.Bot
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&outsider))
+
+	failing := newBotTestEnv(t, bot.Config{Store: failingBotStore{MemoryStore: bot.NewMemoryStore()}})
+
+	tests := []struct {
+		name   string
+		env    *botTestEnv
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"list method", env, http.MethodPatch, "/v1/bots", "", http.StatusMethodNotAllowed},
+		{"invalid bot", env, http.MethodPost, "/v1/bots", `{"name": 1}`, http.StatusBadRequest},
+		{"bot method", env, http.MethodPut, "/v1/bots/" + b.ID, "", http.StatusMethodNotAllowed},
+		{"delete unknown bot", env, http.MethodDelete, "/v1/bots/nope", "", http.StatusNotFound},
+		{"document method", env, http.MethodPost, "/v1/bots/" + b.ID + "/documents/doc1", "", http.StatusMethodNotAllowed},
+		{"join missing document", env, http.MethodPut, "/v1/bots/" + b.ID + "/documents/nope", "", http.StatusNotFound},
+		{
+			"join without access", env, http.MethodPut, "/v1/bots/" + outsider.ID + "/documents/doc1", "",
+			http.StatusForbidden,
+		},
+		{"leave unjoined", env, http.MethodDelete, "/v1/bots/" + b.ID + "/documents/doc1", "", http.StatusConflict},
+		{"edit method", env, http.MethodGet, "/v1/bots/" + b.ID + "/documents/doc1/edits", "", http.StatusMethodNotAllowed},
+		{"invalid edit", env, http.MethodPost, "/v1/bots/" + b.ID + "/documents/doc1/edits", "[", http.StatusBadRequest},
+		{"store fails", failing, http.MethodGet, "/v1/bots", "", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := tt.env.do(tt.method, tt.path, "alice", tt.body)
+			require.Equal(t, tt.status, rec.Code, rec.Body.String())
+		})
+	}
+}
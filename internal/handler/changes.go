@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// Long-poll wait limits for the changes endpoint.
+const (
+	defaultChangesTimeout = 30 * time.Second
+	maxChangesTimeout     = 60 * time.Second
+)
+
+// handleChanges handles GET /v1/documents/{id}/changes?since=rev&timeout=30s.
+// It returns the operations applied after since, waiting up to timeout for
+// the first one if there are none yet.
+func (s *Server) handleChanges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	query := r.URL.Query()
+
+	since, err := strconv.Atoi(query.Get("since"))
+	if err != nil || since < 0 {
+		writeError(w, http.StatusBadRequest, "invalid since revision")
+
+		return
+	}
+
+	timeout := defaultChangesTimeout
+	if raw := query.Get("timeout"); raw != "" {
+		timeout, err = time.ParseDuration(raw)
+		if err != nil || timeout < 0 {
+			writeError(w, http.StatusBadRequest, "invalid timeout")
+
+			return
+		}
+
+		timeout = min(timeout, maxChangesTimeout)
+	}
+
+	// Let the wait outlast the server's write timeout
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + 10*time.Second))
+
+	docID := r.PathValue("docID")
+
+	ops, revision, err := s.waitForChanges(r, docID, since, timeout)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrDocumentNotFound):
+			writeError(w, http.StatusNotFound, "document not found")
+		case errors.Is(err, acl.ErrAccessDenied):
+			writeError(w, http.StatusForbidden, "access denied")
+		case errors.Is(err, storage.ErrRevisionNotFound):
+			writeError(w, http.StatusNotFound, "revision not found")
+		case errors.Is(err, storage.ErrRevisionCompacted):
+			writeError(w, http.StatusGone, "revision no longer available")
+		default:
+			writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+
+		return
+	}
+
+	resp := apitypes.ChangesResponse{
+		ID:         docID,
+		Revision:   revision,
+		Operations: make([]apitypes.Operation, 0, len(ops)),
+	}
+
+	for _, op := range ops {
+		resp.Operations = append(resp.Operations, toAPIOperation(op))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// waitForChanges waits on the document's session. If the session is closed
+// while waiting, as when an admin closes it, the wait continues once on a
+// fresh session.
+func (s *Server) waitForChanges(
+	r *http.Request, docID string, since int, timeout time.Duration,
+) ([]ot.SequencedOperation, int, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	userID := UserIDFromContext(r.Context())
+
+	var (
+		ops      []ot.SequencedOperation
+		revision int
+		err      error
+	)
+
+	for range 2 {
+		var session *collab.Session
+
+		// Loading isn't bounded by the poll timeout, which may be zero
+		session, err = s.manager.GetOrCreateSession(r.Context(), docID)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		ops, revision, err = session.Changes(ctx, userID, since)
+		if !errors.Is(err, collab.ErrSessionClosed) {
+			break
+		}
+	}
+
+	return ops, revision, err
+}
+
+// toAPIOperation converts a sequenced operation to its API representation.
+func toAPIOperation(op ot.SequencedOperation) apitypes.Operation {
+	opType := "insert"
+
+	switch {
+	case op.IsDelete():
+		opType = "delete"
+	case op.IsFormat():
+		opType = "format"
+	}
+
+	resp := apitypes.Operation{
+		Revision:  op.Revision,
+		Type:      opType,
+		Position:  op.Position,
+		Char:      op.Char,
+		Attribute: op.Attribute,
+		Value:     op.Value,
+		UserID:    op.UserID,
+	}
+	if !op.Timestamp.IsZero() {
+		resp.Timestamp = &op.Timestamp
+	}
+
+	return resp
+}
@@ -0,0 +1,228 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+type changesEnv struct {
+	handler http.Handler
+	manager *collab.Manager
+}
+
+// newChangesEnv serves doc1 at revision 2, with a history of one operation.
+func newChangesEnv(t *testing.T) changesEnv {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Editor))
+
+	hub := ws.NewHub()
+	manager := collab.NewManager(collab.ManagerConfig{
+		Store:       store,
+		PermStore:   permStore,
+		Hub:         hub,
+		HistorySize: 1,
+	})
+
+	server := handler.NewServer(handler.ServerConfig{
+		Manager:   manager,
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+	})
+
+	env := changesEnv{handler: server.Handler(), manager: manager}
+	env.apply(t, "a", 0)
+	env.apply(t, "b", 1)
+
+	return env
+}
+
+func (e changesEnv) apply(t *testing.T, char string, revision int) {
+	t.Helper()
+
+	session, err := e.manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	_, err = session.ApplyOperation("c1", "alice", ot.NewInsert(char, revision, "alice"), revision)
+	require.NoError(t, err)
+}
+
+func (e changesEnv) poll(method, target, userID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("X-User-Id", userID)
+
+	rec := httptest.NewRecorder()
+	e.handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func decodeChanges(t *testing.T, rec *httptest.ResponseRecorder) apitypes.ChangesResponse {
+	t.Helper()
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp apitypes.ChangesResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+
+	return resp
+}
+
+// withoutTimestamps checks every operation has a timestamp, then clears them
+// so the rest can be compared.
+func withoutTimestamps(t *testing.T, ops []apitypes.Operation) []apitypes.Operation {
+	t.Helper()
+
+	for i := range ops {
+		require.NotNil(t, ops[i].Timestamp)
+		ops[i].Timestamp = nil
+	}
+
+	return ops
+}
+
+func TestHandleChanges(t *testing.T) {
+	t.Parallel()
+
+	t.Run("returns operations since a revision", func(t *testing.T) {
+		t.Parallel()
+
+		env := newChangesEnv(t)
+
+		resp := decodeChanges(t, env.poll(http.MethodGet, "/v1/documents/doc1/changes?since=0", "alice"))
+		resp.Operations = withoutTimestamps(t, resp.Operations)
+		require.Equal(t, apitypes.ChangesResponse{
+			ID:       "doc1",
+			Revision: 2,
+			Operations: []apitypes.Operation{
+				{Revision: 1, Type: "insert", Position: 0, Char: "a", UserID: "alice"},
+				{Revision: 2, Type: "insert", Position: 1, Char: "b", UserID: "alice"},
+			},
+		}, resp)
+	})
+
+	t.Run("reports deletes", func(t *testing.T) {
+		t.Parallel()
+
+		env := newChangesEnv(t)
+
+		session, err := env.manager.GetOrCreateSession(t.Context(), "doc1")
+		require.NoError(t, err)
+
+		_, err = session.ApplyOperation("c1", "alice", ot.NewDelete(0, "alice"), 2)
+		require.NoError(t, err)
+
+		resp := decodeChanges(t, env.poll(http.MethodGet, "/v1/documents/doc1/changes?since=2", "alice"))
+		require.Equal(t, []apitypes.Operation{{Revision: 3, Type: "delete", Position: 0, UserID: "alice"}},
+			withoutTimestamps(t, resp.Operations))
+	})
+
+	t.Run("waits for the next operation", func(t *testing.T) {
+		t.Parallel()
+
+		env := newChangesEnv(t)
+		done := make(chan *httptest.ResponseRecorder, 1)
+
+		go func() {
+			done <- env.poll(http.MethodGet, "/v1/documents/doc1/changes?since=2&timeout=5s", "alice")
+		}()
+
+		env.apply(t, "c", 2)
+
+		resp := decodeChanges(t, <-done)
+		if resp.Revision != 3 || len(resp.Operations) != 1 || resp.Operations[0].Char != "c" {
+			t.Errorf("unexpected changes: %+v", resp)
+		}
+	})
+
+	t.Run("keeps waiting when the session is closed", func(t *testing.T) {
+		t.Parallel()
+
+		env := newChangesEnv(t)
+		done := make(chan *httptest.ResponseRecorder, 1)
+
+		go func() {
+			done <- env.poll(http.MethodGet, "/v1/documents/doc1/changes?since=2&timeout=5s", "alice")
+		}()
+
+		require.NoError(t, env.manager.CloseSession("doc1"))
+		env.apply(t, "c", 2)
+
+		resp := decodeChanges(t, <-done)
+		if resp.Revision != 3 || len(resp.Operations) != 1 {
+			t.Errorf("unexpected changes: %+v", resp)
+		}
+	})
+
+	t.Run("returns no operations after the timeout", func(t *testing.T) {
+		t.Parallel()
+
+		env := newChangesEnv(t)
+
+		resp := decodeChanges(t, env.poll(http.MethodGet, "/v1/documents/doc1/changes?since=2&timeout=10ms", "alice"))
+		if resp.Revision != 2 || resp.Operations == nil || len(resp.Operations) != 0 {
+			t.Errorf("expected an empty operations list at revision 2, got %+v", resp)
+		}
+	})
+
+	t.Run("compacted revision", func(t *testing.T) {
+		t.Parallel()
+
+		env := newChangesEnv(t)
+
+		// Snapshotting prunes stored operations older than the history
+		session, err := env.manager.GetOrCreateSession(t.Context(), "doc1")
+		require.NoError(t, err)
+		require.NoError(t, session.Snapshot(t.Context()))
+
+		if rec := env.poll(http.MethodGet, "/v1/documents/doc1/changes?since=0", "alice"); rec.Code != http.StatusGone {
+			t.Errorf("expected status 410, got %d", rec.Code)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		userID string
+		status int
+	}{
+		{"missing since", http.MethodGet, "/v1/documents/doc1/changes", "alice", http.StatusBadRequest},
+		{"negative since", http.MethodGet, "/v1/documents/doc1/changes?since=-1", "alice", http.StatusBadRequest},
+		{"invalid timeout", http.MethodGet, "/v1/documents/doc1/changes?since=0&timeout=soon", "alice", 400},
+		{"negative timeout", http.MethodGet, "/v1/documents/doc1/changes?since=0&timeout=-1s", "alice", 400},
+		{"revision ahead", http.MethodGet, "/v1/documents/doc1/changes?since=5&timeout=0s", "alice", 404},
+		{"no read access", http.MethodGet, "/v1/documents/doc1/changes?since=0", "mallory", http.StatusForbidden},
+		{"missing document", http.MethodGet, "/v1/documents/missing/changes?since=0", "alice", 404},
+		{"other methods", http.MethodPost, "/v1/documents/doc1/changes?since=0", "alice", 405},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			env := newChangesEnv(t)
+
+			rec := env.poll(tt.method, tt.target, tt.userID)
+			if rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
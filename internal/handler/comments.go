@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/comment"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// errAnchorOutOfRange is returned when a comment's anchor ends past the end
+// of the document.
+var errAnchorOutOfRange = errors.New("anchor is past the end of the document")
+
+// handleComments handles GET and POST /v1/documents/{id}/comments.
+// Listing needs read access to the document and commenting needs write
+// access.
+func (s *Server) handleComments(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.handleListComments(w, r)
+	case http.MethodPost:
+		s.handleCreateComment(w, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) handleListComments(w http.ResponseWriter, r *http.Request) {
+	docID := r.PathValue("docID")
+
+	if err := s.requireDocument(r.Context(), docID, UserIDFromContext(r.Context()), acl.ActionRead); err != nil {
+		s.writeCommentError(w, r, err)
+
+		return
+	}
+
+	comments, err := s.comments.List(docID)
+	if err != nil {
+		s.writeCommentError(w, r, err)
+
+		return
+	}
+
+	resp := apitypes.ListCommentsResponse{Comments: make([]apitypes.Comment, 0, len(comments))}
+	for _, c := range comments {
+		resp.Comments = append(resp.Comments, toAPIComment(c))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleCreateComment(w http.ResponseWriter, r *http.Request) {
+	var req apitypes.CreateCommentRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	c, err := s.createComment(r.Context(), r.PathValue("docID"), UserIDFromContext(r.Context()), req)
+	if err != nil {
+		s.writeCommentError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, toAPIComment(c))
+}
+
+// createComment checks that the user can edit the document and that the
+// anchor lies within it as of the request's revision, then adds the comment
+// anchored to the document as it is now.
+func (s *Server) createComment(
+	ctx context.Context, docID, userID string, req apitypes.CreateCommentRequest,
+) (comment.Comment, error) {
+	if err := s.requireDocument(ctx, docID, userID, acl.ActionWrite); err != nil {
+		return comment.Comment{}, err
+	}
+
+	session, err := s.manager.GetOrCreateSession(ctx, docID)
+	if err != nil {
+		return comment.Comment{}, err
+	}
+
+	content, err := session.GetStateAt(ctx, userID, req.Revision)
+	if err != nil {
+		return comment.Comment{}, err
+	}
+
+	if req.End > utf8.RuneCountInString(content) {
+		return comment.Comment{}, errAnchorOutOfRange
+	}
+
+	history := func(ctx context.Context, sinceRevision int) ([]ot.SequencedOperation, error) {
+		ops, _, err := session.OperationsSince(ctx, userID, sinceRevision)
+
+		return ops, err
+	}
+
+	return s.comments.Create(ctx, docID, userID, req.Body,
+		comment.Anchor{Start: req.Start, End: req.End}, req.Revision, history)
+}
+
+// handleResolveComment handles POST /v1/documents/{id}/comments/{commentId}/resolve.
+// It needs write access to the document, and resolving a comment twice is
+// a no-op.
+func (s *Server) handleResolveComment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	docID := r.PathValue("docID")
+	userID := UserIDFromContext(r.Context())
+
+	if err := s.requireDocument(r.Context(), docID, userID, acl.ActionWrite); err != nil {
+		s.writeCommentError(w, r, err)
+
+		return
+	}
+
+	c, err := s.comments.Resolve(docID, r.PathValue("commentID"), userID)
+	if err != nil {
+		s.writeCommentError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toAPIComment(c))
+}
+
+// writeCommentError maps a permission, storage or comment error to a response.
+func (s *Server) writeCommentError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, acl.ErrAccessDenied):
+		writeError(w, http.StatusForbidden, "access denied")
+	case errors.Is(err, storage.ErrDocumentNotFound):
+		writeError(w, http.StatusNotFound, "document not found")
+	case errors.Is(err, comment.ErrNotFound):
+		writeError(w, http.StatusNotFound, "comment not found")
+	case errors.Is(err, storage.ErrRevisionNotFound):
+		writeError(w, http.StatusNotFound, "revision not found")
+	case errors.Is(err, storage.ErrRevisionCompacted):
+		writeError(w, http.StatusGone, "revision no longer available")
+	case errors.Is(err, errAnchorOutOfRange):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		s.logger.ErrorContext(r.Context(), "comment request failed", logging.DocID(r.PathValue("docID")), logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
+
+// toAPIComment converts a comment to its API representation.
+func toAPIComment(c comment.Comment) apitypes.Comment {
+	resp := apitypes.Comment{
+		ID:         c.ID,
+		Body:       c.Body,
+		AuthorID:   c.AuthorID,
+		Start:      c.Anchor.Start,
+		End:        c.Anchor.End,
+		Revision:   c.Revision,
+		CreatedAt:  c.CreatedAt,
+		ResolvedBy: c.ResolvedBy,
+	}
+
+	if c.Resolved() {
+		resp.ResolvedAt = &c.ResolvedAt
+	}
+
+	return resp
+}
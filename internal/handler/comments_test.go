@@ -0,0 +1,171 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/comment"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// newCommentServer serves doc1, owned by alice and readable by bob, with
+// comments enabled. Alice is also granted missing, which isn't stored. It
+// returns the manager so tests can edit doc1.
+func newCommentServer(t *testing.T, comments *comment.Service) (http.Handler, *collab.Manager) {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Owner))
+	require.NoError(t, permStore.Grant("doc1", "bob", acl.Viewer))
+	require.NoError(t, permStore.Grant("missing", "alice", acl.Owner))
+
+	cfg := collab.ManagerConfig{Store: store, PermStore: permStore}
+	if comments != nil {
+		cfg.Anchors = comments
+	}
+
+	manager := collab.NewManager(cfg)
+
+	return handler.NewServer(handler.ServerConfig{
+		Manager:   manager,
+		Store:     store,
+		PermStore: permStore,
+		Comments:  comments,
+	}).Handler(), manager
+}
+
+// typeText has alice insert text at position as of revision.
+func typeText(t *testing.T, manager *collab.Manager, text string, position, revision int) {
+	t.Helper()
+
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	for i, char := range text {
+		_, err := session.ApplyOperation("c1", "alice", ot.NewInsert(string(char), position+i, "alice"), revision+i)
+		require.NoError(t, err)
+	}
+}
+
+func TestHandleComments(t *testing.T) {
+	t.Parallel()
+
+	comments := comment.NewService(comment.NewMemoryStore())
+	h, manager := newCommentServer(t, comments)
+
+	typeText(t, manager, "hello", 0, 0)
+
+	// A comment on "ell"
+	rec := serveAs(h, "alice", http.MethodPost, "/v1/documents/doc1/comments",
+		`{"body": "spelling?", "start": 1, "end": 4, "revision": 5}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	var created apitypes.Comment
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	require.Equal(t, "alice", created.AuthorID)
+	require.Nil(t, created.ResolvedAt)
+
+	// A comment on "o" made as of revision 5, after "X" was typed before it
+	typeText(t, manager, "X", 0, 5)
+
+	rec = serveAs(h, "alice", http.MethodPost, "/v1/documents/doc1/comments",
+		`{"body": "and here", "start": 4, "end": 5, "revision": 5}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	var late apitypes.Comment
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&late))
+	require.Equal(t, []int{5, 6, 6}, []int{late.Start, late.End, late.Revision})
+
+	// Readers see both, anchored to the text they were made on
+	rec = serveAs(h, "bob", http.MethodGet, "/v1/documents/doc1/comments", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var list apitypes.ListCommentsResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&list))
+	require.Len(t, list.Comments, 2)
+	require.Equal(t, created.ID, list.Comments[0].ID)
+	require.Equal(t, []int{2, 5, 6}, []int{list.Comments[0].Start, list.Comments[0].End, list.Comments[0].Revision})
+
+	// Resolving needs write access
+	target := "/v1/documents/doc1/comments/" + created.ID + "/resolve"
+	require.Equal(t, http.StatusForbidden, serveAs(h, "bob", http.MethodPost, target, "").Code)
+
+	rec = serveAs(h, "alice", http.MethodPost, target, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resolved apitypes.Comment
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resolved))
+	require.NotNil(t, resolved.ResolvedAt)
+	require.Equal(t, "alice", resolved.ResolvedBy)
+
+	// Deleting the document removes its comments
+	require.Equal(t, http.StatusNoContent, serveAs(h, "alice", http.MethodDelete, "/v1/documents/doc1", "").Code)
+
+	remaining, err := comments.List("doc1")
+	require.NoError(t, err)
+	require.Empty(t, remaining)
+}
+
+func TestHandleComments_Errors(t *testing.T) {
+	t.Parallel()
+
+	h, manager := newCommentServer(t, comment.NewService(comment.NewMemoryStore()))
+	typeText(t, manager, "hi", 0, 0)
+
+	disabled, _ := newCommentServer(t, nil)
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		userID  string
+		method  string
+		target  string
+		body    string
+		status  int
+	}{
+		{"invalid JSON", h, "alice", http.MethodPost, "/v1/documents/doc1/comments", `{`, 400},
+		{"blank body", h, "alice", http.MethodPost, "/v1/documents/doc1/comments", `{"body": " "}`, 400},
+		{
+			"anchor past the end", h, "alice", http.MethodPost, "/v1/documents/doc1/comments",
+			`{"body": "x", "start": 1, "end": 3, "revision": 2}`, 400,
+		},
+		{
+			"anchor past the end at its revision", h, "alice", http.MethodPost, "/v1/documents/doc1/comments",
+			`{"body": "x", "start": 0, "end": 2, "revision": 1}`, 400,
+		},
+		{
+			"unknown revision", h, "alice", http.MethodPost, "/v1/documents/doc1/comments",
+			`{"body": "x", "start": 0, "end": 0, "revision": 9}`, 404,
+		},
+		{
+			"no write access", h, "bob", http.MethodPost, "/v1/documents/doc1/comments",
+			`{"body": "x", "start": 0, "end": 0, "revision": 0}`, 403,
+		},
+		{"no read access", h, "mallory", http.MethodGet, "/v1/documents/doc1/comments", "", 403},
+		{"missing document", h, "alice", http.MethodGet, "/v1/documents/missing/comments", "", 404},
+		{"unknown comment", h, "alice", http.MethodPost, "/v1/documents/doc1/comments/c1/resolve", "", 404},
+		{"other methods", h, "alice", http.MethodPut, "/v1/documents/doc1/comments", "", 405},
+		{"resolve with other methods", h, "alice", http.MethodGet, "/v1/documents/doc1/comments/c1/resolve", "", 405},
+		{"disabled without comments", disabled, "alice", http.MethodGet, "/v1/documents/doc1/comments", "", 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if rec := serveAs(tt.handler, tt.userID, tt.method, tt.target, tt.body); rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/serroba/online-docs/internal/logging"
+)
+
+// compressionThreshold is the smallest response body worth compressing.
+const compressionThreshold = 1024
+
+// compressibleTypes lists the media types that are compressed. Event streams
+// are left alone so that each event reaches the client when it is flushed.
+var compressibleTypes = map[string]bool{
+	"application/json": true,
+	"text/plain":       true,
+	"text/markdown":    true,
+	"text/html":        true,
+}
+
+// contentCodings lists the content codings compressMiddleware applies.
+var contentCodings = []string{"gzip", "deflate"}
+
+// compressMiddleware compresses large responses with gzip or deflate when the
+// client accepts it, tagging them with the coding, see encodedETag.
+// WebSocket upgrades pass through untouched.
+func (s *Server) compressMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := negotiateEncoding(r)
+		if encoding == "" || strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		next.ServeHTTP(cw, r)
+
+		if err := cw.Close(); err != nil {
+			s.logger.ErrorContext(r.Context(), "failed to finish compressed response", logging.Err(err))
+		}
+	})
+}
+
+// negotiateEncoding picks gzip or deflate from the Accept-Encoding header,
+// preferring gzip on ties. Explicitly listed codings override "*". It returns
+// "" when neither is acceptable.
+func negotiateEncoding(r *http.Request) string {
+	explicit := map[string]float64{}
+	wildcard := 0.0
+
+	for entry := range strings.SplitSeq(headerList(r, "Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(entry), ";")
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+
+		switch name = strings.ToLower(strings.TrimSpace(name)); name {
+		case "*":
+			wildcard = q
+		case "x-gzip":
+			explicit["gzip"] = q
+		default:
+			explicit[name] = q
+		}
+	}
+
+	quality := func(encoding string) float64 {
+		if q, ok := explicit[encoding]; ok {
+			return q
+		}
+
+		return wildcard
+	}
+
+	gzipQ, deflateQ := quality("gzip"), quality("deflate")
+
+	switch {
+	case gzipQ > 0 && gzipQ >= deflateQ:
+		return "gzip"
+	case deflateQ > 0:
+		return "deflate"
+	default:
+		return ""
+	}
+}
+
+// flushWriteCloser is an encoder that can push buffered output downstream.
+type flushWriteCloser interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressWriter buffers the start of a response until it knows whether the
+// body is large and compressible enough, then either compresses or passes it
+// through unchanged.
+type compressWriter struct {
+	http.ResponseWriter
+
+	encoding string
+	status   int
+	buf      []byte
+	decided  bool
+	encoder  flushWriteCloser // nil when passing through
+}
+
+// WriteHeader records the status until the compression decision is made.
+// Informational responses are sent straight away.
+func (c *compressWriter) WriteHeader(status int) {
+	if c.decided || status < http.StatusOK {
+		c.ResponseWriter.WriteHeader(status)
+
+		return
+	}
+
+	if c.status == 0 {
+		c.status = status
+	}
+}
+
+func (c *compressWriter) Write(b []byte) (int, error) {
+	if c.decided {
+		return c.write(b)
+	}
+
+	c.buf = append(c.buf, b...)
+	if len(c.buf) < compressionThreshold {
+		return len(b), nil
+	}
+
+	if err := c.decide(); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// write sends b through the encoder, if any.
+func (c *compressWriter) write(b []byte) (int, error) {
+	if c.encoder != nil {
+		return c.encoder.Write(b)
+	}
+
+	return c.ResponseWriter.Write(b)
+}
+
+// decide chooses whether to compress, writes the header, and flushes the
+// buffered body.
+func (c *compressWriter) decide() error {
+	c.decided = true
+
+	status := c.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	if c.shouldCompress(status) {
+		header := c.Header()
+		header.Set("Content-Encoding", c.encoding)
+		header.Add("Vary", "Accept-Encoding")
+		header.Del("Content-Length")
+
+		if etag := header.Get("ETag"); etag != "" {
+			header.Set("ETag", encodedETag(etag, c.encoding))
+		}
+
+		if c.encoding == "gzip" {
+			c.encoder = gzip.NewWriter(c.ResponseWriter)
+		} else {
+			c.encoder = zlib.NewWriter(c.ResponseWriter)
+		}
+	}
+
+	c.ResponseWriter.WriteHeader(status)
+
+	buf := c.buf
+	c.buf = nil
+
+	if len(buf) == 0 {
+		return nil
+	}
+
+	_, err := c.write(buf)
+
+	return err
+}
+
+// shouldCompress reports whether the buffered response qualifies.
+func (c *compressWriter) shouldCompress(status int) bool {
+	if len(c.buf) < compressionThreshold || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+
+	header := c.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+
+	return err == nil && compressibleTypes[mediaType]
+}
+
+// Flush sends everything written so far to the client.
+func (c *compressWriter) Flush() {
+	if !c.decided {
+		if err := c.decide(); err != nil {
+			return
+		}
+	}
+
+	if c.encoder != nil {
+		if err := c.encoder.Flush(); err != nil {
+			return
+		}
+	}
+
+	_ = http.NewResponseController(c.ResponseWriter).Flush()
+}
+
+// Close finishes the response, writing any buffered body.
+func (c *compressWriter) Close() error {
+	if !c.decided {
+		if err := c.decide(); err != nil {
+			return err
+		}
+	}
+
+	if c.encoder != nil {
+		return c.encoder.Close()
+	}
+
+	return nil
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
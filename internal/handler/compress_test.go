@@ -0,0 +1,243 @@
+package handler_test
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompression(t *testing.T) {
+	t.Parallel()
+
+	large := strings.Repeat("lorem ipsum ", 200)
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "large"))
+	require.NoError(t, store.SaveSnapshot(t.Context(), "large", 1, large))
+	require.NoError(t, store.CreateDocument(t.Context(), "small"))
+
+	hub := ws.NewHub()
+	server := handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub}),
+		Store:   store,
+		Hub:     hub,
+	})
+
+	tests := []struct {
+		name           string
+		target         string
+		acceptEncoding string
+		accept         string
+		encoding       string
+	}{
+		{name: "gzip for large JSON", target: "/v1/documents/large", acceptEncoding: "gzip", encoding: "gzip"},
+		{name: "deflate for large JSON", target: "/v1/documents/large", acceptEncoding: "deflate", encoding: "deflate"},
+		{name: "prefers gzip on ties", target: "/v1/documents/large", acceptEncoding: "deflate, gzip", encoding: "gzip"},
+		{name: "honors quality", target: "/v1/documents/large", acceptEncoding: "gzip;q=0.5, deflate", encoding: "deflate"},
+		{
+			name:           "explicit refusal overrides wildcard",
+			target:         "/v1/documents/large",
+			acceptEncoding: "gzip;q=0, *",
+			encoding:       "deflate",
+		},
+		{
+			name:           "compresses raw text",
+			target:         "/v1/documents/large",
+			acceptEncoding: "gzip",
+			accept:         "text/plain",
+			encoding:       "gzip",
+		},
+		{name: "skips small responses", target: "/v1/documents/small", acceptEncoding: "gzip"},
+		{name: "skips without Accept-Encoding", target: "/v1/documents/large"},
+		{name: "skips unsupported encodings", target: "/v1/documents/large", acceptEncoding: "br"},
+		{name: "skips malformed quality", target: "/v1/documents/large", acceptEncoding: "gzip;q=x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Header.Set("X-User-Id", "alice")
+
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			if got := rec.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Fatalf("expected Content-Encoding %q, got %q", tt.encoding, got)
+			}
+
+			// The compressed bytes have their own strong tag
+			if tt.encoding != "" {
+				require.Equal(t, `"1-`+tt.encoding+`"`, rec.Header().Get("ETag"))
+			} else {
+				require.NotContains(t, rec.Header().Get("ETag"), "-")
+			}
+
+			body := decodeBody(t, tt.encoding, rec.Body)
+
+			if tt.accept == "text/plain" {
+				if string(body) != large {
+					t.Error("expected decompressed body to be the raw content")
+				}
+
+				return
+			}
+
+			var resp apitypes.GetDocumentResponse
+			require.NoError(t, json.Unmarshal(body, &resp))
+
+			if tt.encoding != "" && resp.Content != large {
+				t.Error("expected decompressed body to contain the document")
+			}
+		})
+	}
+
+	t.Run("adds Vary when compressing", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/documents/large", nil)
+		req.Header.Set("X-User-Id", "alice")
+		req.Header.Set("Accept-Encoding", "gzip")
+
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+
+		if got := rec.Header().Values("Vary"); !strings.Contains(strings.Join(got, ","), "Accept-Encoding") {
+			t.Errorf("expected Vary to include Accept-Encoding, got %v", got)
+		}
+	})
+
+	t.Run("passes bodiless responses through", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/documents/large", nil)
+		req.Header.Set("X-User-Id", "alice")
+		req.Header.Set("Accept-Encoding", "gzip")
+		req.Header.Set("If-None-Match", `"1"`)
+
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotModified || rec.Header().Get("Content-Encoding") != "" {
+			t.Errorf("expected uncompressed 304, got %d with encoding %q", rec.Code, rec.Header().Get("Content-Encoding"))
+		}
+	})
+}
+
+func TestCompression_ETagPreconditions(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "large"))
+	require.NoError(t, store.SaveSnapshot(t.Context(), "large", 1, strings.Repeat("lorem ipsum ", 200)))
+
+	hub := ws.NewHub()
+	h := handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub}),
+		Store:   store,
+		Hub:     hub,
+	}).Handler()
+
+	// A client that cached the compressed representation sends its tag back
+	for _, coding := range []string{"gzip", "deflate"} {
+		headers := map[string]string{"Accept-Encoding": coding, "If-None-Match": `"1-` + coding + `"`}
+		rec := serveWith(h, http.MethodGet, "/v1/documents/large", "", headers)
+		require.Equal(t, http.StatusNotModified, rec.Code, coding)
+	}
+
+	rec := serveWith(h, http.MethodGet, "/v1/documents/large", "", map[string]string{"If-None-Match": `"1-br"`})
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serveWith(h, http.MethodPatch, "/v1/documents/large", `{"properties": {"a": "b"}}`,
+		map[string]string{"If-Match": `"1-deflate"`})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = putContent(h, "alice", "large", `"1-gzip"`, "short")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = serveWith(h, http.MethodDelete, "/v1/documents/large", "", map[string]string{"If-Match": `"1-gzip"`})
+	require.Equal(t, http.StatusPreconditionFailed, rec.Code)
+}
+
+func TestCompression_StreamsEventsUncompressed(t *testing.T) {
+	t.Parallel()
+
+	h, _, _ := newGraphQLServer(t)
+	postGraphQL(t, h, `mutation { createDocument(id: "doc1", content: "hi") { id } }`,
+		map[string]string{"X-User-Id": "alice"})
+
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	body := `{"query": "subscription { operations(documentId: \"doc1\") { revision } }"}`
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/v1/graphql", strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("X-User-Id", "alice")
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	// Headers only arrive while the stream is open if the flush got through
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	if got := resp.Header.Get("Content-Encoding"); got != "" {
+		t.Errorf("expected uncompressed event stream, got %q", got)
+	}
+}
+
+// decodeBody decompresses a response body according to its encoding.
+func decodeBody(t *testing.T, encoding string, body io.Reader) []byte {
+	t.Helper()
+
+	var (
+		reader io.Reader
+		err    error
+	)
+
+	switch encoding {
+	case "gzip":
+		reader, err = gzip.NewReader(body)
+	case "deflate":
+		reader, err = zlib.NewReader(body)
+	default:
+		reader = body
+	}
+
+	require.NoError(t, err)
+
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+
+	return data
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// handleDocumentContent handles PUT /v1/documents/{id}/content.
+// It replaces the document's text with the body's, provided the If-Match
+// header names the current revision, by applying the edits between them
+// through the document's session like a client's. The edits have no client,
+// so every client receives them.
+func (s *Server) handleDocumentContent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	if r.Header.Get("If-Match") == "" {
+		writeError(w, http.StatusPreconditionRequired, "If-Match with the document's revision is required")
+
+		return
+	}
+
+	base, ok := ifMatchRevision(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "If-Match must be a single revision entity tag")
+
+		return
+	}
+
+	var req apitypes.ReplaceContentRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	docID := r.PathValue("docID")
+
+	revision, err := s.replaceContent(r.Context(), docID, UserIDFromContext(r.Context()), base, req.Content)
+	if errors.Is(err, collab.ErrRevisionMismatch) {
+		w.Header().Set("ETag", revisionETag(revision))
+		w.Header().Set(headerDocumentRevision, strconv.Itoa(revision))
+		writeError(w, http.StatusConflict, fmt.Sprintf("document is at revision %d", revision))
+
+		return
+	}
+
+	if err != nil {
+		s.writeContentError(w, r, err)
+
+		return
+	}
+
+	w.Header().Set("ETag", revisionETag(revision))
+	w.Header().Set(headerDocumentRevision, strconv.Itoa(revision))
+	writeJSON(w, http.StatusOK, apitypes.ReplaceContentResponse{Revision: revision})
+}
+
+// ifMatchRevision parses an If-Match header holding one revision entity tag,
+// or one document entity tag, whose title and properties don't matter here,
+// see documentETag.
+func ifMatchRevision(r *http.Request) (int, bool) {
+	tag := decodedETag(strings.TrimSpace(headerList(r, "If-Match")))
+
+	unquoted, ok := strings.CutPrefix(tag, `"`)
+	if !ok {
+		return 0, false
+	}
+
+	unquoted, ok = strings.CutSuffix(unquoted, `"`)
+	if !ok {
+		return 0, false
+	}
+
+	unquoted, metadata, hasMetadata := strings.Cut(unquoted, "-")
+	if hasMetadata && metadata == "" {
+		return 0, false
+	}
+
+	revision, err := strconv.Atoi(unquoted)
+	if err != nil || revision < 0 || strconv.Itoa(revision) != unquoted {
+		return 0, false
+	}
+
+	return revision, true
+}
+
+// replaceContent checks that the user can edit the document, then applies
+// the edits turning its text into content, provided it is at revision base,
+// and returns the revision they bring it to. The session checks the
+// revision and applies the edits in one step, so no other edit comes
+// between them. If the document is at another revision, it returns that
+// revision with collab.ErrRevisionMismatch.
+func (s *Server) replaceContent(ctx context.Context, docID, userID string, base int, content string) (int, error) {
+	if err := s.requireDocument(ctx, docID, userID, acl.ActionWrite); err != nil {
+		return 0, err
+	}
+
+	session, err := s.manager.GetOrCreateSession(ctx, docID)
+	if err != nil {
+		return 0, err
+	}
+
+	return session.ApplyIfRevision("", userID, base, func(current string) []ot.Operation {
+		return ot.Diff(current, content, userID)
+	})
+}
+
+// writeContentError maps a permission, storage or session error from
+// replacing a document's text to a response.
+func (s *Server) writeContentError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, acl.ErrAccessDenied):
+		writeError(w, http.StatusForbidden, "write access denied")
+	case errors.Is(err, storage.ErrDocumentNotFound):
+		writeError(w, http.StatusNotFound, "document not found")
+	case errors.Is(err, collab.ErrDocumentArchived):
+		writeError(w, http.StatusConflict, "document is archived")
+	default:
+		s.logger.ErrorContext(r.Context(), "failed to replace document content",
+			logging.DocID(r.PathValue("docID")), logging.UserID(UserIDFromContext(r.Context())), logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
@@ -0,0 +1,153 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// putContent has userID replace docID's text with content, if it is at the
+// revision ifMatch names.
+func putContent(h http.Handler, userID, docID, ifMatch, content string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(apitypes.ReplaceContentRequest{Content: content})
+
+	req := httptest.NewRequest(http.MethodPut, "/v1/documents/"+docID+"/content", strings.NewReader(string(body)))
+	req.Header.Set("X-User-Id", userID)
+
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestReplaceContent(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "archived"))
+	require.NoError(t, store.SetArchived(t.Context(), "archived", true))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Editor))
+	require.NoError(t, permStore.Grant("doc1", "bob", acl.Viewer))
+	require.NoError(t, permStore.Grant("archived", "alice", acl.Editor))
+	require.NoError(t, permStore.Grant("missing", "alice", acl.Editor))
+
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore})
+	h := handler.NewServer(handler.ServerConfig{Manager: manager, Store: store, PermStore: permStore}).Handler()
+
+	rec := putContent(h, "alice", "doc1", `"0"`, "hello world")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, `"11"`, rec.Header().Get("ETag"))
+
+	var resp apitypes.ReplaceContentResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, 11, resp.Revision)
+
+	// Only the changed text is edited
+	rec = putContent(h, "alice", "doc1", `"11"`, "hello there world")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, "17", rec.Header().Get("X-Document-Revision"))
+
+	// An update based on an old revision is refused with the current one
+	rec = putContent(h, "alice", "doc1", `"11"`, "goodbye")
+	require.Equal(t, http.StatusConflict, rec.Code, rec.Body.String())
+	require.Equal(t, `"17"`, rec.Header().Get("ETag"))
+	require.Equal(t, "17", rec.Header().Get("X-Document-Revision"))
+
+	// Replacing the text with itself changes nothing
+	rec = putContent(h, "alice", "doc1", `"17"`, "hello there world")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, `"17"`, rec.Header().Get("ETag"))
+
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	content, revision, err := session.GetState("alice")
+	require.NoError(t, err)
+	require.Equal(t, "hello there world", content)
+	require.Equal(t, 17, revision)
+
+	tests := []struct {
+		name    string
+		userID  string
+		docID   string
+		ifMatch string
+		want    int
+	}{
+		{"no If-Match", "alice", "doc1", "", http.StatusPreconditionRequired},
+		{"weak If-Match", "alice", "doc1", `W/"17"`, http.StatusBadRequest},
+		{"unquoted If-Match", "alice", "doc1", "17", http.StatusBadRequest},
+		{"any If-Match", "alice", "doc1", "*", http.StatusBadRequest},
+		{"several If-Match", "alice", "doc1", `"16", "17"`, http.StatusBadRequest},
+		{"viewer", "bob", "doc1", `"17"`, http.StatusForbidden},
+		{"stranger", "mallory", "doc1", `"0"`, http.StatusForbidden},
+		{"archived", "alice", "archived", `"0"`, http.StatusConflict},
+		{"missing document", "alice", "missing", `"0"`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := putContent(h, tt.userID, tt.docID, tt.ifMatch, "x")
+			require.Equal(t, tt.want, rec.Code, rec.Body.String())
+		})
+	}
+
+	rec = serveAs(h, "alice", http.MethodPost, "/v1/documents/doc1/content", `{"content": "x"}`)
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestReplaceContent_Concurrent(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	manager := collab.NewManager(collab.ManagerConfig{Store: store})
+	h := handler.NewServer(handler.ServerConfig{Manager: manager, Store: store}).Handler()
+
+	// Every update is based on revision 0, so only the first applies
+	codes := make(chan int, 10)
+
+	var wg sync.WaitGroup
+
+	for i := range cap(codes) {
+		wg.Go(func() {
+			codes <- putContent(h, "alice", "doc1", `"0"`, strings.Repeat("x", i+1)).Code
+		})
+	}
+
+	wg.Wait()
+	close(codes)
+
+	counts := make(map[int]int)
+	for code := range codes {
+		counts[code]++
+	}
+
+	require.Equal(t, map[int]int{http.StatusOK: 1, http.StatusConflict: cap(codes) - 1}, counts)
+
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	content, revision, err := session.GetState("alice")
+	require.NoError(t, err)
+	require.Equal(t, strings.Repeat("x", revision), content)
+}
@@ -1,10 +1,19 @@
 package handler
 
-import "context"
+import (
+	"context"
+
+	"github.com/serroba/online-docs/internal/apikey"
+	"github.com/serroba/online-docs/internal/logging"
+)
 
 type contextKey string
 
-const userIDKey contextKey = "userID"
+const (
+	userIDKey      contextKey = "userID"
+	apiKeyKey      contextKey = "apiKey"
+	accessEntryKey contextKey = "accessEntry"
+)
 
 // UserIDFromContext extracts the user ID from the context.
 // Returns empty string if not present.
@@ -19,6 +28,41 @@ func UserIDFromContext(ctx context.Context) string {
 }
 
 // withUserID returns a new context with the user ID set.
+// The user is also recorded for the access log.
 func withUserID(ctx context.Context, userID string) context.Context {
+	if entry, ok := ctx.Value(accessEntryKey).(*accessEntry); ok {
+		entry.userID = userID
+	}
+
 	return context.WithValue(ctx, userIDKey, userID)
 }
+
+// RequestIDFromContext extracts the request ID from the context.
+// Returns empty string if not present.
+func RequestIDFromContext(ctx context.Context) string {
+	return logging.RequestID(ctx)
+}
+
+// withRequestID returns a new context with the request ID set. Loggers
+// built by the logging package include it in every record.
+func withRequestID(ctx context.Context, requestID string) context.Context {
+	return logging.WithRequestID(ctx, requestID)
+}
+
+// withAccessEntry returns a new context carrying the access log entry.
+func withAccessEntry(ctx context.Context, entry *accessEntry) context.Context {
+	return context.WithValue(ctx, accessEntryKey, entry)
+}
+
+// apiKeyFromContext returns the API key that authenticated the request.
+// Returns false for requests authenticated as a human user.
+func apiKeyFromContext(ctx context.Context) (apikey.Key, bool) {
+	key, ok := ctx.Value(apiKeyKey).(apikey.Key)
+
+	return key, ok
+}
+
+// withAPIKey returns a new context with the API key set.
+func withAPIKey(ctx context.Context, key apikey.Key) context.Context {
+	return context.WithValue(ctx, apiKeyKey, key)
+}
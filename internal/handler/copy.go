@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/webhook"
+)
+
+// handleCopyDocument handles POST /v1/documents/{id}/copy.
+// It creates a document holding the source's current text, seeded as its
+// revision 0 snapshot, and makes the caller its owner. With copyPermissions,
+// the copy is also shared with the users the source is shared with, in the
+// same roles. Copying needs read access to the source, and copying its
+// permissions needs share access.
+func (s *Server) handleCopyDocument(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	var req apitypes.CopyDocumentRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	if req.ID == "" {
+		req.ID = uuid.New().String()
+	}
+
+	sourceID := r.PathValue("docID")
+	userID := UserIDFromContext(r.Context())
+
+	doc, err := s.copySource(r.Context(), sourceID, req.ID, userID, req.CopyPermissions)
+	if err == nil {
+		err = s.createSharedDocument(r.Context(), doc, userID)
+	}
+
+	if err != nil {
+		s.writeCopyError(w, r, err)
+
+		return
+	}
+
+	s.publishEvent(webhook.EventDocumentCreated, doc.ID, userID)
+
+	writeJSON(w, http.StatusCreated, apitypes.CreateDocumentResponse{ID: doc.ID})
+}
+
+// copySource describes a copy of the source document with ID docID: its
+// current text and, if copyPermissions is set, its shares with users other
+// than the caller. Groups, share links, bots and service accounts aren't
+// given the copy, as they were given access to the source alone.
+func (s *Server) copySource(
+	ctx context.Context, sourceID, docID, userID string, copyPermissions bool,
+) (apitypes.BatchCreateDocument, error) {
+	action := acl.ActionRead
+	if copyPermissions {
+		action = acl.ActionShare
+	}
+
+	if err := s.requireDocument(ctx, sourceID, userID, action); err != nil {
+		return apitypes.BatchCreateDocument{}, err
+	}
+
+	session, err := s.manager.GetOrCreateSession(ctx, sourceID)
+	if err != nil {
+		return apitypes.BatchCreateDocument{}, err
+	}
+
+	content, _, err := session.GetState(userID)
+	if err != nil {
+		return apitypes.BatchCreateDocument{}, err
+	}
+
+	doc := apitypes.BatchCreateDocument{ID: docID, Content: content}
+
+	if !copyPermissions || s.permStore == nil {
+		return doc, nil
+	}
+
+	perms, err := s.permStore.ListPermissions(sourceID)
+	if err != nil {
+		return apitypes.BatchCreateDocument{}, err
+	}
+
+	for _, perm := range perms {
+		if _, reserved := reservedPrincipal(perm.UserID); !reserved && perm.UserID != userID {
+			doc.Shares = append(doc.Shares, apitypes.DocumentShare{UserID: perm.UserID, Role: perm.Role.String()})
+		}
+	}
+
+	return doc, nil
+}
+
+// writeCopyError maps an error from reading the source or creating the copy
+// to a response.
+func (s *Server) writeCopyError(w http.ResponseWriter, r *http.Request, err error) {
+	var itemErr *batchItemError
+
+	switch {
+	case errors.As(err, &itemErr):
+		writeError(w, itemErr.status, itemErr.message)
+	case errors.Is(err, acl.ErrAccessDenied):
+		writeError(w, http.StatusForbidden, "access denied")
+	case errors.Is(err, storage.ErrDocumentNotFound):
+		writeError(w, http.StatusNotFound, "document not found")
+	case errors.Is(err, storage.ErrDocumentExists):
+		writeError(w, http.StatusConflict, "document already exists")
+	default:
+		s.logger.ErrorContext(r.Context(), "failed to copy document",
+			logging.DocID(r.PathValue("docID")), logging.UserID(UserIDFromContext(r.Context())), logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
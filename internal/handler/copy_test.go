@@ -0,0 +1,106 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyDocument(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "taken"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Owner))
+	require.NoError(t, permStore.Grant("doc1", "bob", acl.Viewer))
+	require.NoError(t, permStore.Grant("doc1", "carol", acl.Editor))
+	require.NoError(t, permStore.Grant("doc1", acl.GroupPrincipal("g1"), acl.Editor))
+	require.NoError(t, permStore.Grant("doc1", acl.LinkPrincipalPrefix+"l1", acl.Viewer))
+	require.NoError(t, permStore.Grant("missing", "alice", acl.Owner))
+
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore})
+	h := handler.NewServer(handler.ServerConfig{Manager: manager, Store: store, PermStore: permStore}).Handler()
+
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	for i, char := range "hi" {
+		_, err := session.ApplyOperation("c1", "alice", ot.NewInsert(string(char), i, "alice"), i)
+		require.NoError(t, err)
+	}
+
+	// A viewer's copy is theirs alone, and has the text as it is now
+	rec := serveAs(h, "bob", http.MethodPost, "/v1/documents/doc1/copy", `{"id": "copy1"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	var created apitypes.CreateDocumentResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	require.Equal(t, "copy1", created.ID)
+
+	copied, err := manager.GetOrCreateSession(t.Context(), "copy1")
+	require.NoError(t, err)
+
+	content, revision, err := copied.GetState("bob")
+	require.NoError(t, err)
+	require.Equal(t, "hi", content)
+	require.Zero(t, revision)
+
+	perms, err := permStore.ListPermissions("copy1")
+	require.NoError(t, err)
+	require.Equal(t, []acl.Permission{{DocID: "copy1", UserID: "bob", Role: acl.Owner}}, perms)
+
+	// Copying the permissions shares the copy with the document's users,
+	// but not its groups or links
+	rec = serveAs(h, "alice", http.MethodPost, "/v1/documents/doc1/copy", `{"copyPermissions": true}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	require.NotEmpty(t, created.ID)
+
+	perms, err = permStore.ListPermissions(created.ID)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []acl.Permission{
+		{DocID: created.ID, UserID: "alice", Role: acl.Owner},
+		{DocID: created.ID, UserID: "bob", Role: acl.Viewer},
+		{DocID: created.ID, UserID: "carol", Role: acl.Editor},
+	}, perms)
+
+	tests := []struct {
+		name   string
+		userID string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"existing ID", "alice", http.MethodPost, "/v1/documents/doc1/copy", `{"id": "taken"}`, http.StatusConflict},
+		{"invalid ID", "alice", http.MethodPost, "/v1/documents/doc1/copy", `{"id": "a/b"}`, http.StatusBadRequest},
+		{"invalid body", "alice", http.MethodPost, "/v1/documents/doc1/copy", `{`, http.StatusBadRequest},
+		{"no read access", "mallory", http.MethodPost, "/v1/documents/doc1/copy", `{}`, http.StatusForbidden},
+		{
+			"permissions without share access", "carol", http.MethodPost, "/v1/documents/doc1/copy",
+			`{"copyPermissions": true}`, http.StatusForbidden,
+		},
+		{"missing document", "alice", http.MethodPost, "/v1/documents/missing/copy", `{}`, http.StatusNotFound},
+		{"wrong method", "alice", http.MethodGet, "/v1/documents/doc1/copy", "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := serveAs(h, tt.userID, tt.method, tt.target, tt.body)
+			require.Equal(t, tt.want, rec.Code, rec.Body.String())
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// defaultMaxBodyBytes caps request bodies when ServerConfig.MaxBodyBytes is unset.
+const defaultMaxBodyBytes = 1 << 20
+
+// decodeJSON strictly decodes the request body into dst. Bodies over the size
+// limit get 413; unknown fields, trailing data and malformed JSON get 400. It
+// reports whether decoding succeeded, writing the error response if not.
+func (s *Server) decodeJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.maxBodyBytes))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err == nil {
+		err = checkEOF(dec)
+	}
+
+	if err == nil {
+		return true
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+
+		return false
+	}
+
+	writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+
+	return false
+}
+
+// checkEOF returns an error unless the decoder has no more input.
+func checkEOF(dec *json.Decoder) error {
+	err := dec.Decode(&struct{}{})
+	switch {
+	case errors.Is(err, io.EOF):
+		return nil
+	case err != nil:
+		return err
+	default:
+		return errors.New("unexpected data after JSON body")
+	}
+}
@@ -0,0 +1,151 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/graphqlapi"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestBodyDecoding(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	hub := ws.NewHub()
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub})
+
+	server := handler.NewServer(handler.ServerConfig{
+		Manager: manager,
+		Store:   store,
+		Hub:     hub,
+		GraphQL: graphqlapi.NewHandler(graphqlapi.Config{
+			Manager: manager,
+			Store:   store,
+			Hub:     hub,
+		}),
+		MaxBodyBytes: 64,
+	})
+
+	oversized := `{"id": "` + strings.Repeat("a", 100) + `"}`
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		status int
+		code   string
+	}{
+		{
+			name:   "accepts a valid body",
+			target: "/v1/documents",
+			body:   `{"id": "doc1"}`,
+			status: http.StatusCreated,
+		},
+		{
+			name:   "rejects unknown fields",
+			target: "/v1/documents",
+			body:   `{"id": "doc2", "title": "x"}`,
+			status: http.StatusBadRequest,
+			code:   apitypes.ErrorCodeInvalidRequest,
+		},
+		{
+			name:   "rejects trailing data",
+			target: "/v1/documents",
+			body:   `{"id": "doc3"} {"id": "doc4"}`,
+			status: http.StatusBadRequest,
+			code:   apitypes.ErrorCodeInvalidRequest,
+		},
+		{
+			name:   "rejects trailing garbage",
+			target: "/v1/documents",
+			body:   `{"id": "doc5"} }`,
+			status: http.StatusBadRequest,
+			code:   apitypes.ErrorCodeInvalidRequest,
+		},
+		{
+			name:   "rejects malformed JSON",
+			target: "/v1/documents",
+			body:   `{"id":`,
+			status: http.StatusBadRequest,
+			code:   apitypes.ErrorCodeInvalidRequest,
+		},
+		{
+			name:   "rejects oversized bodies",
+			target: "/v1/documents",
+			body:   oversized,
+			status: http.StatusRequestEntityTooLarge,
+			code:   apitypes.ErrorCodePayloadTooLarge,
+		},
+		{
+			name:   "rejects oversized trailing data",
+			target: "/v1/documents",
+			body:   `{"id": "doc6"}` + strings.Repeat(" ", 100),
+			status: http.StatusRequestEntityTooLarge,
+			code:   apitypes.ErrorCodePayloadTooLarge,
+		},
+		{
+			name:   "rejects oversized GraphQL bodies",
+			target: "/v1/graphql",
+			body:   `{"query": "` + strings.Repeat(" ", 100) + `{ document(id: \"doc1\") { id } }"}`,
+			status: http.StatusRequestEntityTooLarge,
+			code:   apitypes.ErrorCodePayloadTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("X-User-Id", "alice")
+
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, req)
+
+			require.Equal(t, tt.status, rec.Code, rec.Body.String())
+
+			if tt.code == "" {
+				return
+			}
+
+			var resp apitypes.ErrorResponse
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+
+			if resp.Code != tt.code {
+				t.Errorf("expected code %q, got %q", tt.code, resp.Code)
+			}
+		})
+	}
+}
+
+func TestRequestBodyDecoding_DefaultLimit(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	hub := ws.NewHub()
+	server := handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub}),
+		Store:   store,
+		Hub:     hub,
+	})
+
+	body := `{"id": "doc1", "content": "` + strings.Repeat("a", 1<<20) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/documents", strings.NewReader(body))
+	req.Header.Set("X-User-Id", "alice")
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413, got %d", rec.Code)
+	}
+}
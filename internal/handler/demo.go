@@ -0,0 +1,33 @@
+package handler
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/serroba/online-docs/internal/logging"
+)
+
+// demoPage is a single-page editor that speaks the WebSocket protocol, for
+// trying the server from a browser.
+//
+//go:embed demo.html
+var demoPage []byte
+
+// handleDemo handles GET / by serving the demo editor.
+func (s *Server) handleDemo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if _, err := w.Write(demoPage); err != nil {
+		s.logger.ErrorContext(r.Context(), "failed to write demo page", logging.Err(err))
+	}
+}
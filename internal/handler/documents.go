@@ -1,173 +1,447 @@
 package handler
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
-	"log"
 	"net/http"
-	"strings"
+	"strconv"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/logging"
 	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/webhook"
 )
 
-// CreateDocumentRequest is the request body for creating a document.
-type CreateDocumentRequest struct {
-	ID string `json:"id"`
-}
-
-// CreateDocumentResponse is the response body for creating a document.
-type CreateDocumentResponse struct {
-	ID string `json:"id"`
-}
+// errInvalidRevision is returned when the revision query parameter is malformed.
+var errInvalidRevision = errors.New("invalid revision")
 
-// GetDocumentResponse is the response body for getting a document.
-type GetDocumentResponse struct {
-	ID       string `json:"id"`
-	Content  string `json:"content"`
-	Revision int    `json:"revision"`
-}
+// errPreconditionFailed is returned when an If-Match or If-None-Match
+// precondition does not hold for the current revision.
+var errPreconditionFailed = errors.New("precondition failed")
 
-// handleCreateDocument handles POST /documents.
+// handleCreateDocument handles POST /v1/documents.
 func (s *Server) handleCreateDocument(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
 
 		return
 	}
 
-	var req CreateDocumentRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
-
+	var req apitypes.CreateDocumentRequest
+	if !s.decodeJSON(w, r, &req) {
 		return
 	}
 
-	if req.ID == "" {
-		http.Error(w, "document ID is required", http.StatusBadRequest)
+	if err := req.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 
 		return
 	}
 
-	if err := s.store.CreateDocument(req.ID); err != nil {
+	if req.ID == "" {
+		req.ID = uuid.New().String()
+	}
+
+	if err := s.createDocument(r.Context(), req.ID, req.Content); err != nil {
 		if errors.Is(err, storage.ErrDocumentExists) {
-			http.Error(w, "document already exists", http.StatusConflict)
+			writeError(w, http.StatusConflict, "document already exists")
 
 			return
 		}
 
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	s.finishCreate(w, r, req.ID, req.Slug)
+}
 
+// finishCreate sets a newly created document's slug, if any, makes the
+// creator its owner and writes the response.
+func (s *Server) finishCreate(w http.ResponseWriter, r *http.Request, docID, slug string) {
+	if slug != "" && !s.setSlug(w, r, docID, slug) {
 		return
 	}
 
 	// Grant the creator Owner role if ACL store is configured
 	userID := UserIDFromContext(r.Context())
 	if s.permStore != nil && userID != "" {
-		if err := s.permStore.Grant(req.ID, userID, acl.Owner); err != nil {
-			log.Printf("failed to grant owner role for document %q to user %q: %v", req.ID, userID, err)
+		if err := s.permStore.Grant(docID, userID, acl.Owner); err != nil {
+			s.logger.ErrorContext(r.Context(), "failed to grant owner role",
+				logging.DocID(docID), logging.UserID(userID), logging.Err(err))
 		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	s.publishEvent(webhook.EventDocumentCreated, docID, userID)
 
-	if err := json.NewEncoder(w).Encode(CreateDocumentResponse(req)); err != nil {
-		log.Printf("failed to encode response: %v", err)
-	}
+	writeJSON(w, http.StatusCreated, apitypes.CreateDocumentResponse{ID: docID, Slug: slug})
 }
 
-// handleGetDocument handles GET /documents/{id}.
-func (s *Server) handleGetDocument(w http.ResponseWriter, r *http.Request) {
-	docID := extractDocID(r.URL.Path, "/documents/")
-	if docID == "" {
-		http.Error(w, "document ID is required", http.StatusBadRequest)
+// setSlug gives a newly created document its slug. It removes the document,
+// writes the error response and returns false if the slug can't be set.
+func (s *Server) setSlug(w http.ResponseWriter, r *http.Request, docID, slug string) bool {
+	err := s.store.SetSlug(r.Context(), docID, slug)
+	if err == nil {
+		return true
+	}
 
-		return
+	_ = s.store.DeleteDocument(context.WithoutCancel(r.Context()), docID)
+
+	if errors.Is(err, storage.ErrSlugTaken) {
+		writeError(w, http.StatusConflict, "slug already taken")
+
+		return false
+	}
+
+	s.logger.ErrorContext(r.Context(), "failed to set slug", logging.DocID(docID), logging.Err(err))
+	writeError(w, http.StatusInternalServerError, "internal server error")
+
+	return false
+}
+
+// createDocument creates a document with its initial content, seeded as the
+// revision 0 snapshot in the same write.
+func (s *Server) createDocument(ctx context.Context, docID, content string) error {
+	if content == "" {
+		return s.store.CreateDocument(ctx, docID)
 	}
 
+	return s.store.CreateDocumentFromSnapshot(ctx, docID, content)
+}
+
+// handleGetDocument handles GET /v1/documents/{id}.
+func (s *Server) handleGetDocument(w http.ResponseWriter, r *http.Request) {
+	docID := r.PathValue("docID")
+
 	userID := UserIDFromContext(r.Context())
 
 	// Get or create a session to retrieve current state
-	session, err := s.manager.GetOrCreateSession(docID)
+	session, err := s.manager.GetOrCreateSession(r.Context(), docID)
 	if err != nil {
 		if errors.Is(err, storage.ErrDocumentNotFound) {
-			http.Error(w, "document not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, "document not found")
 
 			return
 		}
 
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "internal server error")
 
 		return
 	}
 
-	content, revision, err := session.GetState(userID)
+	content, revision, err := documentState(r, session, userID)
 	if err != nil {
-		if errors.Is(err, acl.ErrAccessDenied) {
-			http.Error(w, "access denied", http.StatusForbidden)
+		switch {
+		case errors.Is(err, errInvalidRevision):
+			writeError(w, http.StatusBadRequest, "invalid revision")
+		case errors.Is(err, acl.ErrAccessDenied):
+			writeError(w, http.StatusForbidden, "access denied")
+		case errors.Is(err, storage.ErrRevisionNotFound):
+			writeError(w, http.StatusNotFound, "revision not found")
+		case errors.Is(err, storage.ErrRevisionCompacted):
+			writeError(w, http.StatusGone, "revision no longer available")
+		default:
+			writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+
+		return
+	}
+
+	// Raw text and Markdown skip the JSON envelope, and its title and
+	// properties
+	format := negotiateFormat(r)
+	etag := revisionETag(revision)
+
+	var meta storage.Metadata
+
+	if format == formatJSON {
+		if meta, err = s.store.LoadMetadata(r.Context(), docID); err != nil {
+			s.writeMetadataError(w, r, err)
 
 			return
 		}
 
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		etag = documentETag(revision, meta)
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set(headerDocumentRevision, strconv.Itoa(revision))
+	w.Header().Add("Vary", "Accept")
+
+	if status := checkPreconditions(r, etag); status != 0 {
+		writePreconditionFailure(w, status)
 
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	if format != formatJSON {
+		w.Header().Set("Content-Type", format.ContentType())
+
+		if _, err := w.Write([]byte(content)); err != nil {
+			s.logger.ErrorContext(r.Context(), "failed to write document", logging.Err(err))
+		}
 
-	if err := json.NewEncoder(w).Encode(GetDocumentResponse{
-		ID:       docID,
-		Content:  content,
-		Revision: revision,
-	}); err != nil {
-		log.Printf("failed to encode response: %v", err)
+		return
 	}
+
+	writeJSON(w, http.StatusOK, apitypes.GetDocumentResponse{
+		ID:         docID,
+		Title:      meta.Title,
+		Content:    content,
+		Revision:   revision,
+		CreatedAt:  meta.CreatedAt,
+		UpdatedAt:  lastModified(meta),
+		Properties: meta.Properties,
+	})
 }
 
-// handleDeleteDocument handles DELETE /documents/{id}.
-func (s *Server) handleDeleteDocument(w http.ResponseWriter, r *http.Request) {
-	docID := extractDocID(r.URL.Path, "/documents/")
-	if docID == "" {
-		http.Error(w, "document ID is required", http.StatusBadRequest)
+// handleUpdateDocument handles PATCH /v1/documents/{id}, renaming the
+// document or replacing its properties. It needs write access, and archived
+// documents can't be changed. If-Match or If-None-Match are evaluated
+// against the document's current entity tag, see documentETag, and the
+// store only writes the change if the title and properties are still those
+// the tag was checked against.
+func (s *Server) handleUpdateDocument(w http.ResponseWriter, r *http.Request) {
+	docID := r.PathValue("docID")
+
+	if s.permStore != nil {
+		checker := acl.NewChecker(s.permStore)
+		if err := checker.RequirePermission(docID, UserIDFromContext(r.Context()), acl.ActionWrite); err != nil {
+			s.writeMetadataError(w, r, err)
 
+			return
+		}
+	}
+
+	var req apitypes.UpdateDocumentRequest
+	if !s.decodeJSON(w, r, &req) {
 		return
 	}
 
-	userID := UserIDFromContext(r.Context())
+	if err := req.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 
-	// Check delete permission if ACL is configured
-	if s.permStore != nil {
-		checker := acl.NewChecker(s.permStore)
-		if err := checker.RequirePermission(docID, userID, acl.ActionDelete); err != nil {
-			if errors.Is(err, acl.ErrAccessDenied) {
-				http.Error(w, "access denied", http.StatusForbidden)
+		return
+	}
+
+	meta, err := s.store.LoadMetadata(r.Context(), docID)
+	if err != nil {
+		s.writeMetadataError(w, r, err)
+
+		return
+	}
+
+	if !meta.ArchivedAt.IsZero() {
+		writeError(w, http.StatusConflict, "document is archived")
+
+		return
+	}
+
+	update := storage.DetailsUpdate{Title: req.Title, Properties: req.Properties}
+
+	if r.Header.Get("If-Match") != "" || r.Header.Get("If-None-Match") != "" {
+		revision, err := s.latestRevision(r.Context(), docID)
+		if err != nil {
+			s.writeMetadataError(w, r, err)
+
+			return
+		}
+
+		if status := checkPreconditions(r, documentETag(revision, meta)); status != 0 {
+			writePreconditionFailure(w, status)
+
+			return
+		}
+
+		// Another update between the check and the write would change the tag
+		update.Based = &storage.Details{Title: meta.Title, Properties: meta.Properties}
+	}
+
+	err = s.store.UpdateDetails(r.Context(), docID, update)
+	if errors.Is(err, storage.ErrDetailsChanged) {
+		writePreconditionFailure(w, http.StatusPreconditionFailed)
+
+		return
+	}
+
+	if err != nil {
+		s.writeMetadataError(w, r, err)
+
+		return
+	}
+
+	meta, err = s.store.LoadMetadata(r.Context(), docID)
+	if err != nil {
+		s.writeMetadataError(w, r, err)
+
+		return
+	}
+
+	revision, err := s.latestRevision(r.Context(), docID)
+	if err != nil {
+		s.writeMetadataError(w, r, err)
+
+		return
+	}
+
+	w.Header().Set("ETag", documentETag(revision, meta))
+	writeJSON(w, http.StatusOK, apitypes.DocumentMetadataResponse{
+		ID:         docID,
+		Title:      meta.Title,
+		CreatedAt:  meta.CreatedAt,
+		UpdatedAt:  lastModified(meta),
+		Properties: meta.Properties,
+	})
+}
+
+// latestRevision returns the document's latest revision, from its session
+// if one is open, since edits are applied there before they're stored.
+func (s *Server) latestRevision(ctx context.Context, docID string) (int, error) {
+	if session := s.manager.GetSession(docID); session != nil {
+		return session.Revision(), nil
+	}
+
+	return s.store.LatestRevision(ctx, docID)
+}
+
+// writeMetadataError maps a permission or storage error from reading or
+// updating a document's metadata to a response.
+func (s *Server) writeMetadataError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, acl.ErrAccessDenied):
+		writeError(w, http.StatusForbidden, "access denied")
+	case errors.Is(err, storage.ErrDocumentNotFound):
+		writeError(w, http.StatusNotFound, "document not found")
+	default:
+		s.logger.ErrorContext(r.Context(), "document metadata request failed",
+			logging.DocID(r.PathValue("docID")), logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
+
+// lastModified returns when the document was last edited, or created if it
+// never was.
+func lastModified(meta storage.Metadata) time.Time {
+	if meta.LastEditedAt.IsZero() {
+		return meta.CreatedAt
+	}
+
+	return meta.LastEditedAt
+}
 
-				return
-			}
+// handleHeadDocument handles HEAD /v1/documents/{id}.
+// It reports the current revision and modification time without loading
+// the content, so clients can cheaply check whether a cached copy is stale.
+func (s *Server) handleHeadDocument(w http.ResponseWriter, r *http.Request) {
+	docID := r.PathValue("docID")
 
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+	session, err := s.manager.GetOrCreateSession(r.Context(), docID)
+	if err != nil {
+		if errors.Is(err, storage.ErrDocumentNotFound) {
+			w.WriteHeader(http.StatusNotFound)
 
 			return
 		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
 	}
 
-	// Close any active session first
-	if err := s.manager.CloseSession(docID); err != nil {
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+	stats, err := session.DocumentStats(UserIDFromContext(r.Context()))
+	if err != nil {
+		if errors.Is(err, acl.ErrAccessDenied) {
+			w.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
 
 		return
 	}
 
-	if err := s.store.DeleteDocument(docID); err != nil {
+	meta, err := s.store.LoadMetadata(r.Context(), docID)
+	if err != nil {
 		if errors.Is(err, storage.ErrDocumentNotFound) {
-			http.Error(w, "document not found", http.StatusNotFound)
+			w.WriteHeader(http.StatusNotFound)
 
 			return
 		}
 
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	modified := lastModified(meta)
+
+	// The tag is the one GET returns for the same Accept header
+	etag := revisionETag(stats.Revision)
+	if negotiateFormat(r) == formatJSON {
+		etag = documentETag(stats.Revision, meta)
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set(headerDocumentRevision, strconv.Itoa(stats.Revision))
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+
+	if status := checkPreconditions(r, etag); status != 0 {
+		w.WriteHeader(status)
+
+		return
+	}
+
+	if notModifiedSince(r, modified) {
+		w.WriteHeader(http.StatusNotModified)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// documentState returns the current state, or the state at the revision
+// given by the optional ?revision= query parameter.
+func documentState(r *http.Request, session *collab.Session, userID string) (string, int, error) {
+	raw := r.URL.Query().Get("revision")
+	if raw == "" {
+		return session.GetState(userID)
+	}
+
+	revision, err := strconv.Atoi(raw)
+	if err != nil || revision < 0 {
+		return "", 0, errInvalidRevision
+	}
+
+	content, err := session.GetStateAt(r.Context(), userID, revision)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return content, revision, nil
+}
+
+// handleDeleteDocument handles DELETE /v1/documents/{id}.
+func (s *Server) handleDeleteDocument(w http.ResponseWriter, r *http.Request) {
+	docID := r.PathValue("docID")
+
+	userID := UserIDFromContext(r.Context())
+
+	err := s.checkDeletePreconditions(r, docID, userID)
+	if err == nil {
+		err = s.deleteDocument(r.Context(), docID, userID)
+	}
+
+	if err != nil {
+		status, message := deleteErrorStatus(err)
+		writeError(w, status, message)
 
 		return
 	}
@@ -175,11 +449,82 @@ func (s *Server) handleDeleteDocument(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// extractDocID extracts the document ID from a URL path.
-func extractDocID(path, prefix string) string {
-	if !strings.HasPrefix(path, prefix) {
-		return ""
+// checkDeletePreconditions evaluates If-Match and If-None-Match against the
+// document's latest entity tags, for its JSON and raw representations.
+// Permission is checked first so that callers without delete access cannot
+// probe revisions.
+func (s *Server) checkDeletePreconditions(r *http.Request, docID, userID string) error {
+	if r.Header.Get("If-Match") == "" && r.Header.Get("If-None-Match") == "" {
+		return nil
+	}
+
+	if s.permStore != nil {
+		checker := acl.NewChecker(s.permStore)
+		if err := checker.RequirePermission(docID, userID, acl.ActionDelete); err != nil {
+			return err
+		}
+	}
+
+	revision, err := s.latestRevision(r.Context(), docID)
+	if err != nil {
+		return err
+	}
+
+	meta, err := s.store.LoadMetadata(r.Context(), docID)
+	if err != nil {
+		return err
+	}
+
+	if checkPreconditions(r, documentETag(revision, meta), revisionETag(revision)) != 0 {
+		return errPreconditionFailed
+	}
+
+	return nil
+}
+
+// deleteDocument checks delete permission, closes any active session, and
+// removes the document along with its attachments.
+func (s *Server) deleteDocument(ctx context.Context, docID, userID string) error {
+	// Check delete permission if ACL is configured
+	if s.permStore != nil {
+		checker := acl.NewChecker(s.permStore)
+		if err := checker.RequirePermission(docID, userID, acl.ActionDelete); err != nil {
+			return err
+		}
+	}
+
+	if err := s.manager.DeleteDocument(ctx, docID); err != nil {
+		return err
+	}
+
+	// The document is gone either way, so a failed cleanup is only logged
+	if s.blobs != nil {
+		if err := s.blobs.DeleteAll(docID); err != nil {
+			s.logger.ErrorContext(ctx, "failed to delete attachments", logging.DocID(docID), logging.Err(err))
+		}
+	}
+
+	if s.comments != nil {
+		if err := s.comments.DeleteAll(docID); err != nil {
+			s.logger.ErrorContext(ctx, "failed to delete comments", logging.DocID(docID), logging.Err(err))
+		}
 	}
 
-	return strings.TrimPrefix(path, prefix)
+	s.publishEvent(webhook.EventDocumentDeleted, docID, userID)
+
+	return nil
+}
+
+// deleteErrorStatus maps a deleteDocument error to an HTTP status and message.
+func deleteErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, acl.ErrAccessDenied):
+		return http.StatusForbidden, "access denied"
+	case errors.Is(err, storage.ErrDocumentNotFound):
+		return http.StatusNotFound, "document not found"
+	case errors.Is(err, errPreconditionFailed):
+		return http.StatusPreconditionFailed, "precondition failed"
+	default:
+		return http.StatusInternalServerError, "internal server error"
+	}
 }
@@ -2,14 +2,20 @@ package handler_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
 	"github.com/serroba/online-docs/internal/collab"
 	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/ot"
 	"github.com/serroba/online-docs/internal/storage"
 	"github.com/serroba/online-docs/internal/ws"
 	"github.com/stretchr/testify/require"
@@ -38,7 +44,7 @@ func TestHandleCreateDocument(t *testing.T) {
 		})
 
 		body, _ := json.Marshal(map[string]string{"id": "doc1"})
-		req := httptest.NewRequest(http.MethodPost, "/documents", bytes.NewReader(body))
+		req := httptest.NewRequest(http.MethodPost, "/v1/documents", bytes.NewReader(body))
 		req.Header.Set("X-User-Id", "user1")
 
 		rec := httptest.NewRecorder()
@@ -56,7 +62,7 @@ func TestHandleCreateDocument(t *testing.T) {
 		}
 
 		// Verify document exists
-		exists, _ := store.DocumentExists("doc1")
+		exists, _ := store.DocumentExists(t.Context(), "doc1")
 		if !exists {
 			t.Error("expected document to exist")
 		}
@@ -70,11 +76,86 @@ func TestHandleCreateDocument(t *testing.T) {
 		}
 	})
 
+	t.Run("creates document with initial content", func(t *testing.T) {
+		t.Parallel()
+
+		store := storage.NewMemoryStore()
+		hub := ws.NewHub()
+		manager := collab.NewManager(collab.ManagerConfig{
+			Store: store,
+			Hub:   hub,
+		})
+
+		server := handler.NewServer(handler.ServerConfig{
+			Manager: manager,
+			Store:   store,
+			Hub:     hub,
+		})
+
+		body, _ := json.Marshal(map[string]string{"id": "doc1", "content": "hello"})
+		req := httptest.NewRequest(http.MethodPost, "/v1/documents", bytes.NewReader(body))
+		req.Header.Set("X-User-Id", "user1")
+
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d", rec.Code)
+		}
+
+		session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+		require.NoError(t, err)
+
+		content, revision, err := session.GetState("user1")
+		require.NoError(t, err)
+
+		if content != "hello" {
+			t.Errorf("expected content 'hello', got %q", content)
+		}
+
+		if revision != 0 {
+			t.Errorf("expected revision 0, got %d", revision)
+		}
+	})
+
+	t.Run("leaves no document when seeding content fails", func(t *testing.T) {
+		t.Parallel()
+
+		store := &failingSnapshotStore{MemoryStore: storage.NewMemoryStore()}
+		hub := ws.NewHub()
+		manager := collab.NewManager(collab.ManagerConfig{
+			Store: store,
+			Hub:   hub,
+		})
+
+		server := handler.NewServer(handler.ServerConfig{
+			Manager: manager,
+			Store:   store,
+			Hub:     hub,
+		})
+
+		body, _ := json.Marshal(map[string]string{"id": "doc1", "content": "hello"})
+		req := httptest.NewRequest(http.MethodPost, "/v1/documents", bytes.NewReader(body))
+		req.Header.Set("X-User-Id", "user1")
+
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("expected status 500, got %d", rec.Code)
+		}
+
+		exists, _ := store.DocumentExists(t.Context(), "doc1")
+		if exists {
+			t.Error("expected no document")
+		}
+	})
+
 	t.Run("returns 409 for duplicate document", func(t *testing.T) {
 		t.Parallel()
 
 		store := storage.NewMemoryStore()
-		require.NoError(t, store.CreateDocument("doc1"))
+		require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 		hub := ws.NewHub()
 		manager := collab.NewManager(collab.ManagerConfig{
@@ -89,7 +170,7 @@ func TestHandleCreateDocument(t *testing.T) {
 		})
 
 		body, _ := json.Marshal(map[string]string{"id": "doc1"})
-		req := httptest.NewRequest(http.MethodPost, "/documents", bytes.NewReader(body))
+		req := httptest.NewRequest(http.MethodPost, "/v1/documents", bytes.NewReader(body))
 		req.Header.Set("X-User-Id", "user1")
 
 		rec := httptest.NewRecorder()
@@ -100,7 +181,7 @@ func TestHandleCreateDocument(t *testing.T) {
 		}
 	})
 
-	t.Run("returns 400 for empty ID", func(t *testing.T) {
+	t.Run("returns 400 for reserved ID", func(t *testing.T) {
 		t.Parallel()
 
 		store := storage.NewMemoryStore()
@@ -116,8 +197,8 @@ func TestHandleCreateDocument(t *testing.T) {
 			Hub:     hub,
 		})
 
-		body, _ := json.Marshal(map[string]string{"id": ""})
-		req := httptest.NewRequest(http.MethodPost, "/documents", bytes.NewReader(body))
+		body, _ := json.Marshal(map[string]string{"id": "batch"})
+		req := httptest.NewRequest(http.MethodPost, "/v1/documents", bytes.NewReader(body))
 		req.Header.Set("X-User-Id", "user1")
 
 		rec := httptest.NewRecorder()
@@ -126,6 +207,17 @@ func TestHandleCreateDocument(t *testing.T) {
 		if rec.Code != http.StatusBadRequest {
 			t.Errorf("expected status 400, got %d", rec.Code)
 		}
+
+		var resp apitypes.ErrorResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+
+		if resp.Code != apitypes.ErrorCodeInvalidRequest {
+			t.Errorf("expected code %q, got %q", apitypes.ErrorCodeInvalidRequest, resp.Code)
+		}
+
+		if resp.Message != "id: is reserved" {
+			t.Errorf("unexpected message %q", resp.Message)
+		}
 	})
 
 	t.Run("returns 405 for wrong method", func(t *testing.T) {
@@ -144,7 +236,7 @@ func TestHandleCreateDocument(t *testing.T) {
 			Hub:     hub,
 		})
 
-		req := httptest.NewRequest(http.MethodGet, "/documents", nil)
+		req := httptest.NewRequest(http.MethodPatch, "/v1/documents", nil)
 		req.Header.Set("X-User-Id", "user1")
 
 		rec := httptest.NewRecorder()
@@ -171,7 +263,7 @@ func TestHandleCreateDocument(t *testing.T) {
 			Hub:     hub,
 		})
 
-		req := httptest.NewRequest(http.MethodPost, "/documents", bytes.NewReader([]byte("invalid json")))
+		req := httptest.NewRequest(http.MethodPost, "/v1/documents", bytes.NewReader([]byte("invalid json")))
 		req.Header.Set("X-User-Id", "user1")
 
 		rec := httptest.NewRecorder()
@@ -190,7 +282,7 @@ func TestHandleGetDocument(t *testing.T) {
 		t.Parallel()
 
 		store := storage.NewMemoryStore()
-		require.NoError(t, store.CreateDocument("doc1"))
+		require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 		hub := ws.NewHub()
 		manager := collab.NewManager(collab.ManagerConfig{
@@ -204,7 +296,7 @@ func TestHandleGetDocument(t *testing.T) {
 			Hub:     hub,
 		})
 
-		req := httptest.NewRequest(http.MethodGet, "/documents/doc1", nil)
+		req := httptest.NewRequest(http.MethodGet, "/v1/documents/doc1", nil)
 		req.Header.Set("X-User-Id", "user1")
 
 		rec := httptest.NewRecorder()
@@ -238,7 +330,7 @@ func TestHandleGetDocument(t *testing.T) {
 			Hub:     hub,
 		})
 
-		req := httptest.NewRequest(http.MethodGet, "/documents/nonexistent", nil)
+		req := httptest.NewRequest(http.MethodGet, "/v1/documents/nonexistent", nil)
 		req.Header.Set("X-User-Id", "user1")
 
 		rec := httptest.NewRecorder()
@@ -253,7 +345,7 @@ func TestHandleGetDocument(t *testing.T) {
 		t.Parallel()
 
 		store := storage.NewMemoryStore()
-		require.NoError(t, store.CreateDocument("doc1"))
+		require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 		permStore := acl.NewMemoryStore()
 		hub := ws.NewHub()
@@ -270,7 +362,7 @@ func TestHandleGetDocument(t *testing.T) {
 			Hub:       hub,
 		})
 
-		req := httptest.NewRequest(http.MethodGet, "/documents/doc1", nil)
+		req := httptest.NewRequest(http.MethodGet, "/v1/documents/doc1", nil)
 		req.Header.Set("X-User-Id", "unauthorized")
 
 		rec := httptest.NewRecorder()
@@ -281,7 +373,7 @@ func TestHandleGetDocument(t *testing.T) {
 		}
 	})
 
-	t.Run("returns 400 for empty document ID", func(t *testing.T) {
+	t.Run("returns 404 for empty document ID", func(t *testing.T) {
 		t.Parallel()
 
 		store := storage.NewMemoryStore()
@@ -297,16 +389,191 @@ func TestHandleGetDocument(t *testing.T) {
 			Hub:     hub,
 		})
 
-		req := httptest.NewRequest(http.MethodGet, "/documents/", nil)
+		req := httptest.NewRequest(http.MethodGet, "/v1/documents/", nil)
 		req.Header.Set("X-User-Id", "user1")
 
 		rec := httptest.NewRecorder()
 		server.Handler().ServeHTTP(rec, req)
 
-		if rec.Code != http.StatusBadRequest {
-			t.Errorf("expected status 400, got %d", rec.Code)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rec.Code)
+		}
+	})
+}
+
+func TestHandleGetDocument_AtRevision(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.SaveSnapshot(t.Context(), "doc1", 2, "ab"))
+	require.NoError(t, store.AppendOperation(t.Context(), "doc1", ot.SequencedOperation{
+		Operation: ot.NewInsert("c", 2, "user1"),
+		Revision:  3,
+	}))
+	require.NoError(t, store.AppendOperation(t.Context(), "doc1", ot.SequencedOperation{
+		Operation: ot.NewInsert("d", 3, "user1"),
+		Revision:  4,
+	}))
+
+	hub := ws.NewHub()
+	manager := collab.NewManager(collab.ManagerConfig{
+		Store: store,
+		Hub:   hub,
+	})
+
+	server := handler.NewServer(handler.ServerConfig{
+		Manager: manager,
+		Store:   store,
+		Hub:     hub,
+	})
+
+	t.Run("returns content at revision", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/documents/doc1?revision=3", nil)
+		req.Header.Set("X-User-Id", "user1")
+
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rec.Code)
+		}
+
+		var resp apitypes.GetDocumentResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+
+		if resp.Content != "abc" {
+			t.Errorf("expected content 'abc', got %q", resp.Content)
+		}
+
+		if resp.Revision != 3 {
+			t.Errorf("expected revision 3, got %d", resp.Revision)
 		}
 	})
+
+	tests := []struct {
+		name     string
+		revision string
+		status   int
+	}{
+		{name: "returns 410 for compacted revision", revision: "1", status: http.StatusGone},
+		{name: "returns 404 for future revision", revision: "9", status: http.StatusNotFound},
+		{name: "returns 400 for malformed revision", revision: "abc", status: http.StatusBadRequest},
+		{name: "returns 400 for negative revision", revision: "-1", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/documents/doc1?revision="+tt.revision, nil)
+			req.Header.Set("X-User-Id", "user1")
+
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rec.Code)
+			}
+		})
+	}
+}
+
+func TestHandleUpdateDocument(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	h, _ := newStatsServer(t, store)
+
+	rec := serveAs(h, "alice", http.MethodPatch, "/v1/documents/doc1",
+		`{"title": "Roadmap", "properties": {"team": "docs", "status": "draft"}}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var updated apitypes.DocumentMetadataResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&updated))
+	require.Equal(t, "Roadmap", updated.Title)
+	require.Equal(t, map[string]string{"team": "docs", "status": "draft"}, updated.Properties)
+	require.False(t, updated.CreatedAt.IsZero())
+	require.Equal(t, updated.CreatedAt, updated.UpdatedAt)
+
+	// Renaming keeps the properties, and the document carries both
+	rec = serveAs(h, "alice", http.MethodPatch, "/v1/documents/doc1", `{"title": "Q1 Roadmap"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = serveAs(h, "bob", http.MethodGet, "/v1/documents/doc1", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var doc apitypes.GetDocumentResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&doc))
+	require.Equal(t, "Q1 Roadmap", doc.Title)
+	require.Equal(t, map[string]string{"team": "docs", "status": "draft"}, doc.Properties)
+	require.Equal(t, updated.CreatedAt, doc.CreatedAt)
+
+	// An empty object removes the properties
+	rec = serveAs(h, "alice", http.MethodPatch, "/v1/documents/doc1", `{"properties": {}}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var cleared apitypes.DocumentMetadataResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&cleared))
+	require.Equal(t, "Q1 Roadmap", cleared.Title)
+	require.Nil(t, cleared.Properties)
+}
+
+func TestHandleUpdateDocument_Errors(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc2"))
+	require.NoError(t, store.CreateDocument(t.Context(), "archived"))
+	require.NoError(t, store.SetArchived(t.Context(), "archived", true))
+
+	acls, _ := newStatsServer(t, store)
+
+	noACL := handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store}),
+		Store:   store,
+	}).Handler()
+
+	brokenMetadata := failingMetadataStore{MemoryStore: storage.NewMemoryStore()}
+	require.NoError(t, brokenMetadata.CreateDocument(t.Context(), "doc1"))
+
+	failing := handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: brokenMetadata}),
+		Store:   brokenMetadata,
+	}).Handler()
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		userID  string
+		target  string
+		body    string
+		status  int
+	}{
+		{"no write access", acls, "mallory", "/v1/documents/doc1", `{"title": "Mine"}`, http.StatusForbidden},
+		{"nothing to update", acls, "alice", "/v1/documents/doc1", `{}`, http.StatusBadRequest},
+		{"invalid title", acls, "alice", "/v1/documents/doc1", `{"title": "a\nb"}`, http.StatusBadRequest},
+		{"invalid key", acls, "alice", "/v1/documents/doc1", `{"properties": {"a b": "c"}}`, http.StatusBadRequest},
+		{"invalid body", acls, "alice", "/v1/documents/doc1", `{"title": 1}`, http.StatusBadRequest},
+		{"missing document", noACL, "alice", "/v1/documents/missing", `{"title": "Plan"}`, http.StatusNotFound},
+		{"archived", noACL, "alice", "/v1/documents/archived", `{"title": "Plan"}`, http.StatusConflict},
+		{"metadata fails", failing, "alice", "/v1/documents/doc1", `{"title": "Plan"}`, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if rec := serveAs(tt.handler, tt.userID, http.MethodPatch, tt.target, tt.body); rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
 }
 
 func TestHandleDeleteDocument(t *testing.T) {
@@ -316,7 +583,7 @@ func TestHandleDeleteDocument(t *testing.T) {
 		t.Parallel()
 
 		store := storage.NewMemoryStore()
-		require.NoError(t, store.CreateDocument("doc1"))
+		require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 		hub := ws.NewHub()
 		manager := collab.NewManager(collab.ManagerConfig{
@@ -330,7 +597,7 @@ func TestHandleDeleteDocument(t *testing.T) {
 			Hub:     hub,
 		})
 
-		req := httptest.NewRequest(http.MethodDelete, "/documents/doc1", nil)
+		req := httptest.NewRequest(http.MethodDelete, "/v1/documents/doc1", nil)
 		req.Header.Set("X-User-Id", "user1")
 
 		rec := httptest.NewRecorder()
@@ -341,7 +608,7 @@ func TestHandleDeleteDocument(t *testing.T) {
 		}
 
 		// Verify document was deleted
-		exists, _ := store.DocumentExists("doc1")
+		exists, _ := store.DocumentExists(t.Context(), "doc1")
 		if exists {
 			t.Error("expected document to be deleted")
 		}
@@ -363,7 +630,7 @@ func TestHandleDeleteDocument(t *testing.T) {
 			Hub:     hub,
 		})
 
-		req := httptest.NewRequest(http.MethodDelete, "/documents/nonexistent", nil)
+		req := httptest.NewRequest(http.MethodDelete, "/v1/documents/nonexistent", nil)
 		req.Header.Set("X-User-Id", "user1")
 
 		rec := httptest.NewRecorder()
@@ -378,7 +645,7 @@ func TestHandleDeleteDocument(t *testing.T) {
 		t.Parallel()
 
 		store := storage.NewMemoryStore()
-		require.NoError(t, store.CreateDocument("doc1"))
+		require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 		permStore := acl.NewMemoryStore()
 		require.NoError(t, permStore.Grant("doc1", "owner", acl.Owner))
@@ -397,7 +664,7 @@ func TestHandleDeleteDocument(t *testing.T) {
 			Hub:       hub,
 		})
 
-		req := httptest.NewRequest(http.MethodDelete, "/documents/doc1", nil)
+		req := httptest.NewRequest(http.MethodDelete, "/v1/documents/doc1", nil)
 		req.Header.Set("X-User-Id", "notowner")
 
 		rec := httptest.NewRecorder()
@@ -408,7 +675,7 @@ func TestHandleDeleteDocument(t *testing.T) {
 		}
 	})
 
-	t.Run("returns 400 for empty document ID", func(t *testing.T) {
+	t.Run("returns 404 for empty document ID", func(t *testing.T) {
 		t.Parallel()
 
 		store := storage.NewMemoryStore()
@@ -424,14 +691,178 @@ func TestHandleDeleteDocument(t *testing.T) {
 			Hub:     hub,
 		})
 
-		req := httptest.NewRequest(http.MethodDelete, "/documents/", nil)
+		req := httptest.NewRequest(http.MethodDelete, "/v1/documents/", nil)
 		req.Header.Set("X-User-Id", "user1")
 
 		rec := httptest.NewRecorder()
 		server.Handler().ServeHTTP(rec, req)
 
-		if rec.Code != http.StatusBadRequest {
-			t.Errorf("expected status 400, got %d", rec.Code)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rec.Code)
 		}
 	})
 }
+
+// failingSnapshotStore is a MemoryStore that always fails to save
+// snapshots, including when seeding a new document with one.
+type failingSnapshotStore struct {
+	*storage.MemoryStore
+}
+
+func (f *failingSnapshotStore) SaveSnapshot(_ context.Context, _ string, _ int, _ string) error {
+	return errors.New("snapshot failed")
+}
+
+func (f *failingSnapshotStore) SaveFormattedSnapshot(_ context.Context, _ string, _ int, _ string, _ []ot.Mark) error {
+	return errors.New("snapshot failed")
+}
+
+func (f *failingSnapshotStore) CreateDocumentFromSnapshot(_ context.Context, _, _ string) error {
+	return errors.New("snapshot failed")
+}
+
+func TestHandleDeleteDocument_StorageErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		store     storage.Store
+		permStore acl.Store
+	}{
+		{"permission lookup fails", storage.NewMemoryStore(), failingRoleStore{MemoryStore: acl.NewMemoryStore()}},
+		{"delete fails", failingDeleteStore{MemoryStore: storage.NewMemoryStore()}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.NoError(t, tt.store.CreateDocument(t.Context(), "doc1"))
+
+			server := handler.NewServer(handler.ServerConfig{
+				Manager:   collab.NewManager(collab.ManagerConfig{Store: tt.store}),
+				Store:     tt.store,
+				PermStore: tt.permStore,
+			})
+
+			req := httptest.NewRequest(http.MethodDelete, "/v1/documents/doc1", nil)
+			req.Header.Set("X-User-Id", "user1")
+
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusInternalServerError {
+				t.Errorf("expected status 500, got %d", rec.Code)
+			}
+		})
+	}
+}
+
+// failingRoleStore is an acl.MemoryStore whose GetRole always fails.
+type failingRoleStore struct {
+	*acl.MemoryStore
+}
+
+func (failingRoleStore) GetRole(string, string) (acl.Role, error) {
+	return acl.Viewer, errors.New("acl unavailable")
+}
+
+// failingDeleteStore is a MemoryStore whose DeleteDocument always fails.
+type failingDeleteStore struct {
+	*storage.MemoryStore
+}
+
+func (failingDeleteStore) DeleteDocument(context.Context, string) error {
+	return errors.New("delete failed")
+}
+
+// failingDetailsStore is a MemoryStore whose UpdateDetails always fails.
+type failingDetailsStore struct {
+	*storage.MemoryStore
+}
+
+func (failingDetailsStore) UpdateDetails(context.Context, string, storage.DetailsUpdate) error {
+	return errors.New("update failed")
+}
+
+// failingRevisionStore is a MemoryStore whose LatestRevision always fails.
+type failingRevisionStore struct {
+	*storage.MemoryStore
+}
+
+func (failingRevisionStore) LatestRevision(context.Context, string) (int, error) {
+	return 0, errors.New("revision unavailable")
+}
+
+func TestHandleDocument_StoreErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		store   storage.Store
+		method  string
+		ifMatch string
+		body    string
+	}{
+		{
+			"update fails", failingDetailsStore{MemoryStore: storage.NewMemoryStore()},
+			http.MethodPatch, "", `{"title": "Plan"}`,
+		},
+		{
+			"revision fails before the update", failingRevisionStore{MemoryStore: storage.NewMemoryStore()},
+			http.MethodPatch, `"0"`, `{"title": "Plan"}`,
+		},
+		{
+			"revision fails after the update", failingRevisionStore{MemoryStore: storage.NewMemoryStore()},
+			http.MethodPatch, "", `{"title": "Plan"}`,
+		},
+		{"metadata fails", failingMetadataStore{MemoryStore: storage.NewMemoryStore()}, http.MethodGet, "", ""},
+		{"metadata fails for HEAD", failingMetadataStore{MemoryStore: storage.NewMemoryStore()}, http.MethodHead, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.NoError(t, tt.store.CreateDocument(t.Context(), "doc1"))
+
+			server := handler.NewServer(handler.ServerConfig{
+				Manager: collab.NewManager(collab.ManagerConfig{Store: tt.store}),
+				Store:   tt.store,
+				Logger:  slog.New(slog.DiscardHandler),
+			})
+
+			req := httptest.NewRequest(tt.method, "/v1/documents/doc1", strings.NewReader(tt.body))
+			req.Header.Set("X-User-Id", "alice")
+
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, req)
+			require.Equal(t, http.StatusInternalServerError, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestHandleCreateDocument_GrantFails(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	permStore := failingGrantStore{MemoryStore: acl.NewMemoryStore(), userID: "alice"}
+
+	var logs bytes.Buffer
+
+	server := handler.NewServer(handler.ServerConfig{
+		Manager:   collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore}),
+		Store:     store,
+		PermStore: permStore,
+		Logger:    slog.New(slog.NewTextHandler(&logs, nil)),
+	})
+
+	// The document is created without an owner, which only the logs report
+	rec := serveAs(server.Handler(), "alice", http.MethodPost, "/v1/documents", `{"id": "doc1"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	require.Contains(t, logs.String(), `msg="failed to grant owner role"`)
+}
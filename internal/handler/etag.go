@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// headerDocumentRevision reports the revision a response describes.
+const headerDocumentRevision = "X-Document-Revision"
+
+// revisionETag returns the strong entity tag for a document at a revision.
+func revisionETag(revision int) string {
+	return `"` + strconv.Itoa(revision) + `"`
+}
+
+// documentETag returns the strong entity tag for a document's JSON
+// representation, which holds its title and properties besides its content,
+// so the tag changes with them too. Without either, it's the revision's tag.
+func documentETag(revision int, meta storage.Metadata) string {
+	if meta.Title == "" && len(meta.Properties) == 0 {
+		return revisionETag(revision)
+	}
+
+	hash := fnv.New32a()
+	fmt.Fprintf(hash, "%q", meta.Title)
+
+	for _, key := range slices.Sorted(maps.Keys(meta.Properties)) {
+		fmt.Fprintf(hash, "%q%q", key, meta.Properties[key])
+	}
+
+	return fmt.Sprintf(`"%d-%08x"`, revision, hash.Sum32())
+}
+
+// encodedETag returns the entity tag of etag's representation compressed
+// with coding. A strong tag must differ between the compressed and plain
+// bytes, so the coding is appended to the opaque tag, e.g. "5-gzip".
+func encodedETag(etag, coding string) string {
+	opaque, ok := strings.CutSuffix(etag, `"`)
+	if !ok {
+		return etag
+	}
+
+	return opaque + "-" + coding + `"`
+}
+
+// decodedETag strips the suffix encodedETag appends, returning the tag of
+// the plain representation.
+func decodedETag(etag string) string {
+	for _, coding := range contentCodings {
+		if opaque, ok := strings.CutSuffix(etag, "-"+coding+`"`); ok {
+			return opaque + `"`
+		}
+	}
+
+	return etag
+}
+
+// checkPreconditions evaluates the If-Match and If-None-Match headers against
+// the current entity tags, one for each representation the request may have
+// read. It returns the status code to respond with when a precondition
+// fails, or zero when the request may proceed.
+func checkPreconditions(r *http.Request, etags ...string) int {
+	if ifMatch := headerList(r, "If-Match"); ifMatch != "" && !anyETagListed(ifMatch, etags, false) {
+		return http.StatusPreconditionFailed
+	}
+
+	if ifNoneMatch := headerList(r, "If-None-Match"); ifNoneMatch != "" && anyETagListed(ifNoneMatch, etags, true) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			return http.StatusNotModified
+		}
+
+		return http.StatusPreconditionFailed
+	}
+
+	return 0
+}
+
+// notModifiedSince reports whether the If-Modified-Since header is at or after
+// lastModified. The header is ignored when If-None-Match is present.
+func notModifiedSince(r *http.Request, lastModified time.Time) bool {
+	if r.Header.Get("If-None-Match") != "" {
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+
+	// HTTP dates have one-second precision
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+// headerList joins every value of a list-valued header.
+func headerList(r *http.Request, name string) string {
+	return strings.Join(r.Header.Values(name), ",")
+}
+
+// anyETagListed reports whether the entity tag list contains any of etags.
+func anyETagListed(list string, etags []string, weak bool) bool {
+	return slices.ContainsFunc(etags, func(etag string) bool { return etagListMatches(list, etag, weak) })
+}
+
+// etagListMatches reports whether a comma-separated entity tag list contains
+// etag. A "*" matches any tag. Weak comparison ignores the W/ prefix; strong
+// comparison never matches a weak tag. The tags of compressed
+// representations match the plain one's, see encodedETag.
+func etagListMatches(list, etag string, weak bool) bool {
+	for candidate := range strings.SplitSeq(list, ",") {
+		candidate = decodedETag(strings.TrimSpace(candidate))
+
+		if candidate == "*" {
+			return true
+		}
+
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writePreconditionFailure writes the response for a failed precondition.
+func writePreconditionFailure(w http.ResponseWriter, status int) {
+	if status == http.StatusNotModified {
+		w.WriteHeader(http.StatusNotModified)
+
+		return
+	}
+
+	writeError(w, status, "precondition failed")
+}
@@ -0,0 +1,376 @@
+package handler_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+func newETagServer(t *testing.T) (http.Handler, *storage.MemoryStore) {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.SaveSnapshot(t.Context(), "doc1", 3, "abc"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "owner", acl.Owner))
+	require.NoError(t, permStore.Grant("doc1", "viewer", acl.Viewer))
+
+	hub := ws.NewHub()
+	manager := collab.NewManager(collab.ManagerConfig{
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+	})
+
+	server := handler.NewServer(handler.ServerConfig{
+		Manager:   manager,
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+	})
+
+	return server.Handler(), store
+}
+
+func TestDocumentETag_Reads(t *testing.T) {
+	t.Parallel()
+
+	h, _ := newETagServer(t)
+
+	tests := []struct {
+		name    string
+		target  string
+		headers map[string]string
+		status  int
+		etag    string
+	}{
+		{name: "returns etag", target: "/v1/documents/doc1", status: http.StatusOK, etag: `"3"`},
+		{name: "returns etag for past revision", target: "/v1/documents/doc1?revision=3", status: http.StatusOK, etag: `"3"`},
+		{
+			name:    "returns 304 when If-None-Match matches",
+			target:  "/v1/documents/doc1",
+			headers: map[string]string{"If-None-Match": `"1", "3"`},
+			status:  http.StatusNotModified,
+			etag:    `"3"`,
+		},
+		{
+			name:    "weak If-None-Match matches",
+			target:  "/v1/documents/doc1",
+			headers: map[string]string{"If-None-Match": `W/"3"`},
+			status:  http.StatusNotModified,
+			etag:    `"3"`,
+		},
+		{
+			name:    "returns content when If-None-Match differs",
+			target:  "/v1/documents/doc1",
+			headers: map[string]string{"If-None-Match": `"2"`},
+			status:  http.StatusOK,
+			etag:    `"3"`,
+		},
+		{
+			name:    "returns 412 when If-Match differs",
+			target:  "/v1/documents/doc1",
+			headers: map[string]string{"If-Match": `"2"`},
+			status:  http.StatusPreconditionFailed,
+			etag:    `"3"`,
+		},
+		{
+			name:    "strong If-Match ignores weak tags",
+			target:  "/v1/documents/doc1",
+			headers: map[string]string{"If-Match": `W/"3"`},
+			status:  http.StatusPreconditionFailed,
+			etag:    `"3"`,
+		},
+		{
+			name:    "If-Match wildcard matches",
+			target:  "/v1/documents/doc1",
+			headers: map[string]string{"If-Match": "*"},
+			status:  http.StatusOK,
+			etag:    `"3"`,
+		},
+		{
+			name:    "export returns 304 when If-None-Match matches",
+			target:  "/v1/documents/doc1/export?format=md",
+			headers: map[string]string{"If-None-Match": `"3"`},
+			status:  http.StatusNotModified,
+			etag:    `"3"`,
+		},
+		{
+			name:    "export returns 412 when If-Match differs",
+			target:  "/v1/documents/doc1/export",
+			headers: map[string]string{"If-Match": `"2"`},
+			status:  http.StatusPreconditionFailed,
+			etag:    `"3"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Header.Set("X-User-Id", "viewer")
+
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rec.Code)
+			}
+
+			if got := rec.Header().Get("ETag"); got != tt.etag {
+				t.Errorf("expected ETag %s, got %q", tt.etag, got)
+			}
+
+			if got := rec.Header().Get("X-Document-Revision"); tt.target == "/v1/documents/doc1" && got != "3" {
+				t.Errorf("expected X-Document-Revision 3, got %q", got)
+			}
+
+			if rec.Code == http.StatusNotModified && rec.Body.Len() != 0 {
+				t.Errorf("expected empty body for 304, got %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+// serveWith has the owner make a request with the given headers.
+func serveWith(h http.Handler, method, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("X-User-Id", "owner")
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestDocumentETag_Metadata(t *testing.T) {
+	t.Parallel()
+
+	h, store := newETagServer(t)
+
+	require.NoError(t, store.SetTitle(t.Context(), "doc1", "Roadmap"))
+
+	// The JSON representation's tag covers the title, the raw text's doesn't
+	rec := serveWith(h, http.MethodGet, "/v1/documents/doc1", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	titled := rec.Header().Get("ETag")
+	require.True(t, strings.HasPrefix(titled, `"3-`), titled)
+
+	rec = serveWith(h, http.MethodHead, "/v1/documents/doc1", "", map[string]string{"If-None-Match": titled})
+	require.Equal(t, http.StatusNotModified, rec.Code)
+
+	rec = serveWith(h, http.MethodGet, "/v1/documents/doc1", "", map[string]string{"Accept": "text/plain"})
+	require.Equal(t, `"3"`, rec.Header().Get("ETag"))
+
+	// Renaming changes it, so a stale copy is neither served as current nor
+	// overwritten
+	rec = serveWith(h, http.MethodPatch, "/v1/documents/doc1", `{"title": "Plan"}`, map[string]string{"If-Match": titled})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	renamed := rec.Header().Get("ETag")
+	require.NotEqual(t, titled, renamed)
+
+	rec = serveWith(h, http.MethodGet, "/v1/documents/doc1", "", map[string]string{"If-None-Match": titled})
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, renamed, rec.Header().Get("ETag"))
+
+	for _, headers := range []map[string]string{{"If-Match": titled}, {"If-Match": `"3"`}, {"If-None-Match": "*"}} {
+		rec = serveWith(h, http.MethodPatch, "/v1/documents/doc1", `{"title": "Stale"}`, headers)
+		require.Equal(t, http.StatusPreconditionFailed, rec.Code, headers)
+	}
+
+	meta, err := store.LoadMetadata(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.Equal(t, "Plan", meta.Title)
+
+	// Edits based on the document's tag only need its revision to be current
+	rec = putContent(h, "owner", "doc1", renamed, "abcd")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = serveWith(h, http.MethodGet, "/v1/documents/doc1", "", nil)
+	current := rec.Header().Get("ETag")
+	require.True(t, strings.HasPrefix(current, `"4-`), current)
+
+	rec = serveWith(h, http.MethodDelete, "/v1/documents/doc1", "", map[string]string{"If-Match": current})
+	require.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+// renamingStore renames every document just before its details are updated,
+// as another request would between the handler's checks and the write.
+type renamingStore struct {
+	*storage.MemoryStore
+}
+
+func (s renamingStore) UpdateDetails(ctx context.Context, docID string, update storage.DetailsUpdate) error {
+	if err := s.SetTitle(ctx, docID, "Sneaky"); err != nil {
+		return err
+	}
+
+	return s.MemoryStore.UpdateDetails(ctx, docID, update)
+}
+
+func TestDocumentETag_MetadataRace(t *testing.T) {
+	t.Parallel()
+
+	t.Run("changed before the write", func(t *testing.T) {
+		t.Parallel()
+
+		store := renamingStore{MemoryStore: storage.NewMemoryStore()}
+		require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+		h := handler.NewServer(handler.ServerConfig{
+			Manager: collab.NewManager(collab.ManagerConfig{Store: store}),
+			Store:   store,
+		}).Handler()
+
+		rec := serveWith(h, http.MethodGet, "/v1/documents/doc1", "", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		headers := map[string]string{"If-Match": rec.Header().Get("ETag")}
+		rec = serveWith(h, http.MethodPatch, "/v1/documents/doc1", `{"title": "Plan"}`, headers)
+		require.Equal(t, http.StatusPreconditionFailed, rec.Code, rec.Body.String())
+
+		meta, err := store.LoadMetadata(t.Context(), "doc1")
+		require.NoError(t, err)
+		require.Equal(t, "Sneaky", meta.Title)
+
+		// Unconditional updates don't care
+		rec = serveWith(h, http.MethodPatch, "/v1/documents/doc1", `{"title": "Plan"}`, nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	})
+
+	t.Run("concurrent updates", func(t *testing.T) {
+		t.Parallel()
+
+		h, store := newETagServer(t)
+
+		rec := serveWith(h, http.MethodGet, "/v1/documents/doc1", "", nil)
+		headers := map[string]string{"If-Match": rec.Header().Get("ETag")}
+
+		var (
+			wg     sync.WaitGroup
+			mu     sync.Mutex
+			status = map[int]int{}
+		)
+
+		for i := range 10 {
+			wg.Go(func() {
+				body := fmt.Sprintf(`{"title": "Plan %d"}`, i)
+				rec := serveWith(h, http.MethodPatch, "/v1/documents/doc1", body, headers)
+
+				mu.Lock()
+				status[rec.Code]++
+				mu.Unlock()
+			})
+		}
+
+		wg.Wait()
+		require.Equal(t, map[int]int{http.StatusOK: 1, http.StatusPreconditionFailed: 9}, status)
+
+		meta, err := store.LoadMetadata(t.Context(), "doc1")
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(meta.Title, "Plan "), meta.Title)
+	})
+}
+
+func TestDocumentETag_Delete(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		userID  string
+		headers map[string]string
+		status  int
+	}{
+		{name: "deletes when If-Match matches", userID: "owner", headers: map[string]string{"If-Match": `"3"`}, status: 204},
+		{name: "deletes on If-Match wildcard", userID: "owner", headers: map[string]string{"If-Match": "*"}, status: 204},
+		{name: "rejects stale If-Match", userID: "owner", headers: map[string]string{"If-Match": `"2"`}, status: 412},
+		{
+			name:    "rejects If-None-Match wildcard on existing document",
+			userID:  "owner",
+			headers: map[string]string{"If-None-Match": "*"},
+			status:  http.StatusPreconditionFailed,
+		},
+		{
+			name:    "checks permission before preconditions",
+			userID:  "viewer",
+			headers: map[string]string{"If-Match": `"2"`},
+			status:  http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h, store := newETagServer(t)
+
+			req := httptest.NewRequest(http.MethodDelete, "/v1/documents/doc1", nil)
+			req.Header.Set("X-User-Id", tt.userID)
+
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rec.Code)
+			}
+
+			exists, err := store.DocumentExists(t.Context(), "doc1")
+			require.NoError(t, err)
+
+			if exists == (tt.status == http.StatusNoContent) {
+				t.Errorf("unexpected document existence %v after status %d", exists, rec.Code)
+			}
+		})
+	}
+
+	t.Run("returns 404 for missing document", func(t *testing.T) {
+		t.Parallel()
+
+		store := storage.NewMemoryStore()
+		hub := ws.NewHub()
+		server := handler.NewServer(handler.ServerConfig{
+			Manager: collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub}),
+			Store:   store,
+			Hub:     hub,
+		})
+
+		req := httptest.NewRequest(http.MethodDelete, "/v1/documents/missing", nil)
+		req.Header.Set("X-User-Id", "owner")
+		req.Header.Set("If-Match", "*")
+
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/webhook"
+)
+
+// eventsHeartbeat is how often an idle event stream sends a comment so that
+// proxies don't close it.
+const eventsHeartbeat = 30 * time.Second
+
+// handleEvents handles GET /v1/events.
+// It streams events on every document the caller can read as server-sent
+// events, until the client disconnects or the server shuts down.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	events, cancel := s.webhooks.Subscribe(UserIDFromContext(r.Context()))
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	// The stream outlives the server's write timeout; send headers right
+	// away so clients see it open
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+	_ = rc.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		}
+
+		_ = rc.Flush()
+	}
+}
+
+// writeEvent writes a document event in server-sent event format.
+func writeEvent(w http.ResponseWriter, event webhook.Event) error {
+	data, err := json.Marshal(apitypes.DocumentEvent{
+		ID:         event.ID,
+		Type:       string(event.Type),
+		DocumentID: event.DocID,
+		Revision:   event.Revision,
+		UserID:     event.UserID,
+		Role:       event.Role,
+		OccurredAt: event.OccurredAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+
+	return err
+}
@@ -0,0 +1,114 @@
+package handler_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/webhook"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleEvents(t *testing.T) {
+	t.Parallel()
+
+	h, webhooks := newWebhookServer(t, webhook.NewMemoryStore())
+
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/v1/events", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-User-Id", "alice")
+
+	// Headers arrive once the subscription is in place
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// Alice can't read carol's document, so only her own shows up
+	require.Equal(t, http.StatusCreated, serveAs(h, "carol", http.MethodPost, "/v1/documents", `{"id": "private"}`).Code)
+	require.Equal(t, http.StatusCreated, serveAs(h, "alice", http.MethodPost, "/v1/documents", `{"id": "doc1"}`).Code)
+
+	reader := bufio.NewReader(resp.Body)
+
+	lines := make([]string, 0, 3)
+	for range 3 {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+
+	require.True(t, strings.HasPrefix(lines[0], "id: "), lines[0])
+	require.Equal(t, "event: document.created", lines[1])
+
+	var event apitypes.DocumentEvent
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &event))
+
+	if event.DocumentID != "doc1" || event.UserID != "alice" || event.ID != strings.TrimPrefix(lines[0], "id: ") {
+		t.Errorf("unexpected event: %+v", event)
+	}
+
+	// Closing the service ends the stream
+	webhooks.Close()
+
+	for {
+		if _, err := reader.ReadString('\n'); err != nil {
+			break
+		}
+	}
+}
+
+func TestHandleEvents_Routes(t *testing.T) {
+	t.Parallel()
+
+	t.Run("rejects other methods", func(t *testing.T) {
+		t.Parallel()
+
+		h, _ := newWebhookServer(t, webhook.NewMemoryStore())
+
+		if rec := serveAs(h, "alice", http.MethodPost, "/v1/events", ""); rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("expected status 405, got %d", rec.Code)
+		}
+	})
+
+	t.Run("requires authentication", func(t *testing.T) {
+		t.Parallel()
+
+		h, _ := newWebhookServer(t, webhook.NewMemoryStore())
+
+		if rec := serveAs(h, "", http.MethodGet, "/v1/events", ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected status 401, got %d", rec.Code)
+		}
+	})
+
+	t.Run("disabled without webhooks", func(t *testing.T) {
+		t.Parallel()
+
+		store := storage.NewMemoryStore()
+		server := handler.NewServer(handler.ServerConfig{
+			Manager: collab.NewManager(collab.ManagerConfig{Store: store}),
+			Store:   store,
+		})
+
+		if rec := serveAs(server.Handler(), "alice", http.MethodGet, "/v1/events", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/export"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// handleExportDocument handles GET /v1/documents/{id}/export?format=txt|md|html.
+func (s *Server) handleExportDocument(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	docID := r.PathValue("docID")
+
+	format, err := export.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "unsupported export format")
+
+		return
+	}
+
+	userID := UserIDFromContext(r.Context())
+
+	session, err := s.manager.GetOrCreateSession(r.Context(), docID)
+	if err != nil {
+		if errors.Is(err, storage.ErrDocumentNotFound) {
+			writeError(w, http.StatusNotFound, "document not found")
+
+			return
+		}
+
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	content, revision, err := session.GetState(userID)
+	if err != nil {
+		if errors.Is(err, acl.ErrAccessDenied) {
+			writeError(w, http.StatusForbidden, "access denied")
+
+			return
+		}
+
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	etag := revisionETag(revision)
+	w.Header().Set("ETag", etag)
+
+	if status := checkPreconditions(r, etag); status != 0 {
+		writePreconditionFailure(w, status)
+
+		return
+	}
+
+	body, err := export.Render(format, docID, content)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": format.Filename(docID),
+	}))
+
+	if _, err := w.Write(body); err != nil {
+		s.logger.ErrorContext(r.Context(), "failed to write export", logging.Err(err))
+	}
+}
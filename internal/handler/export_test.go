@@ -0,0 +1,174 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleExportDocument(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.SaveSnapshot(t.Context(), "doc1", 1, "a < b"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "user1", acl.Viewer))
+
+	hub := ws.NewHub()
+	manager := collab.NewManager(collab.ManagerConfig{
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+	})
+
+	server := handler.NewServer(handler.ServerConfig{
+		Manager:   manager,
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+	})
+
+	serve := func(method, target, userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("X-User-Id", userID)
+
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	t.Run("exports plain text by default", func(t *testing.T) {
+		t.Parallel()
+
+		rec := serve(http.MethodGet, "/v1/documents/doc1/export", "user1")
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rec.Code)
+		}
+
+		if ct := rec.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+			t.Errorf("unexpected Content-Type %q", ct)
+		}
+
+		if cd := rec.Header().Get("Content-Disposition"); cd != `attachment; filename=doc1.txt` {
+			t.Errorf("unexpected Content-Disposition %q", cd)
+		}
+
+		if rec.Body.String() != "a < b" {
+			t.Errorf("unexpected body %q", rec.Body.String())
+		}
+	})
+
+	t.Run("exports html", func(t *testing.T) {
+		t.Parallel()
+
+		rec := serve(http.MethodGet, "/v1/documents/doc1/export?format=html", "user1")
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rec.Code)
+		}
+
+		if ct := rec.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+			t.Errorf("unexpected Content-Type %q", ct)
+		}
+
+		if !strings.Contains(rec.Body.String(), "<p>a &lt; b</p>") {
+			t.Errorf("expected escaped paragraph, got %q", rec.Body.String())
+		}
+	})
+
+	t.Run("exports markdown", func(t *testing.T) {
+		t.Parallel()
+
+		rec := serve(http.MethodGet, "/v1/documents/doc1/export?format=md", "user1")
+
+		if cd := rec.Header().Get("Content-Disposition"); cd != `attachment; filename=doc1.md` {
+			t.Errorf("unexpected Content-Disposition %q", cd)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		userID string
+		status int
+	}{
+		{
+			name: "returns 400 for unsupported format", method: http.MethodGet,
+			target: "/v1/documents/doc1/export?format=pdf", userID: "user1", status: http.StatusBadRequest,
+		},
+		{
+			name: "returns 404 for missing document", method: http.MethodGet,
+			target: "/v1/documents/missing/export", userID: "user1", status: http.StatusNotFound,
+		},
+		{
+			name: "returns 403 without read access", method: http.MethodGet,
+			target: "/v1/documents/doc1/export", userID: "stranger", status: http.StatusForbidden,
+		},
+		{
+			name: "returns 405 for wrong method", method: http.MethodPost,
+			target: "/v1/documents/doc1/export", userID: "user1", status: http.StatusMethodNotAllowed,
+		},
+		{
+			name: "returns 404 for unknown sub-resource", method: http.MethodGet,
+			target: "/v1/documents/doc1/unknown", userID: "user1", status: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := serve(tt.method, tt.target, tt.userID)
+
+			if rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rec.Code)
+			}
+		})
+	}
+}
+
+func TestHandleExportDocument_StorageError(t *testing.T) {
+	t.Parallel()
+
+	store := &failingLoadStore{MemoryStore: storage.NewMemoryStore()}
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	server := handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store}),
+		Store:   store,
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/documents/doc1/export", nil)
+	req.Header.Set("X-User-Id", "user1")
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", rec.Code)
+	}
+}
+
+// failingLoadStore is a MemoryStore whose LoadSnapshot always fails.
+type failingLoadStore struct {
+	*storage.MemoryStore
+}
+
+func (f *failingLoadStore) LoadSnapshot(_ context.Context, _ string) (storage.Snapshot, error) {
+	return storage.Snapshot{}, errors.New("load failed")
+}
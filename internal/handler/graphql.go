@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/serroba/online-docs/internal/graphqlapi"
+)
+
+// handleGraphQL handles POST /v1/graphql.
+// It passes the authenticated caller on to the GraphQL resolvers and caps
+// the request body at the configured size limit.
+func (s *Server) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	caller := graphqlapi.Caller{UserID: UserIDFromContext(r.Context())}
+	if key, ok := apiKeyFromContext(r.Context()); ok {
+		caller.Key = &key
+	}
+
+	r = r.WithContext(graphqlapi.WithCaller(r.Context(), caller))
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxBodyBytes)
+
+	s.graphql.ServeHTTP(w, r)
+}
@@ -0,0 +1,132 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apikey"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/graphqlapi"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+type graphQLResponse struct {
+	Data   map[string]any `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+func newGraphQLServer(t *testing.T) (http.Handler, *acl.MemoryStore, *apikey.Service) {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	permStore := acl.NewMemoryStore()
+	hub := ws.NewHub()
+	apiKeys := apikey.NewService(apikey.NewMemoryStore())
+
+	manager := collab.NewManager(collab.ManagerConfig{
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+	})
+
+	server := handler.NewServer(handler.ServerConfig{
+		Manager:   manager,
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+		APIKeys:   apiKeys,
+		GraphQL: graphqlapi.NewHandler(graphqlapi.Config{
+			Manager:   manager,
+			Store:     store,
+			PermStore: permStore,
+			Hub:       hub,
+		}),
+	})
+
+	return server.Handler(), permStore, apiKeys
+}
+
+func postGraphQL(t *testing.T, h http.Handler, query string, headers map[string]string) graphQLResponse {
+	t.Helper()
+
+	body, err := json.Marshal(map[string]string{"query": query})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/graphql", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp graphQLResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+
+	return resp
+}
+
+func TestHandleGraphQL(t *testing.T) {
+	t.Parallel()
+
+	h, permStore, apiKeys := newGraphQLServer(t)
+
+	created := postGraphQL(t, h, `mutation { createDocument(id: "doc1", content: "hi") { id } }`,
+		map[string]string{"X-User-Id": "alice"})
+	require.Empty(t, created.Errors)
+
+	key, secret, err := apiKeys.Issue("alice", "reader", []apikey.Scope{apikey.ScopeRead})
+	require.NoError(t, err)
+	require.NoError(t, permStore.Grant("doc1", key.Principal(), acl.Owner))
+
+	t.Run("read scoped key can query", func(t *testing.T) {
+		t.Parallel()
+
+		resp := postGraphQL(t, h, `{ document(id: "doc1") { content } }`, map[string]string{"X-Api-Key": secret})
+		require.Empty(t, resp.Errors)
+
+		doc, ok := resp.Data["document"].(map[string]any)
+		require.True(t, ok)
+
+		if doc["content"] != "hi" {
+			t.Errorf("expected content %q, got %v", "hi", doc["content"])
+		}
+	})
+
+	t.Run("read scoped key cannot mutate", func(t *testing.T) {
+		t.Parallel()
+
+		resp := postGraphQL(t, h, `mutation { deleteDocument(id: "doc1") }`, map[string]string{"X-Api-Key": secret})
+		require.Len(t, resp.Errors, 1)
+
+		if resp.Errors[0].Extensions["code"] != "access_denied" {
+			t.Errorf("expected access_denied, got %v", resp.Errors[0].Extensions["code"])
+		}
+	})
+
+	t.Run("requires authentication", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/graphql", strings.NewReader(`{"query": "{ __typename }"}`))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected status %d, got %d", http.StatusUnauthorized, rec.Code)
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/logging"
+)
+
+// handleGroups routes GET and POST requests for /v1/groups.
+func (s *Server) handleGroups(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.handleListGroups(w, r)
+	case http.MethodPost:
+		s.handleCreateGroup(w, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleCreateGroup handles POST /v1/groups. The caller owns the group and
+// is its first member.
+func (s *Server) handleCreateGroup(w http.ResponseWriter, r *http.Request) {
+	var req apitypes.CreateGroupRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	group, err := s.groups.Create(req.Name, UserIDFromContext(r.Context()))
+	if err != nil {
+		s.writeGroupError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, toAPIGroup(group))
+}
+
+// handleListGroups handles GET /v1/groups, listing the groups the caller
+// owns or belongs to.
+func (s *Server) handleListGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := s.groups.List(UserIDFromContext(r.Context()))
+	if err != nil {
+		s.writeGroupError(w, r, err)
+
+		return
+	}
+
+	resp := apitypes.ListGroupsResponse{Groups: make([]apitypes.Group, 0, len(groups))}
+	for _, group := range groups {
+		resp.Groups = append(resp.Groups, toAPIGroup(group))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleGroupByID handles GET and DELETE /v1/groups/{groupID}. The group's
+// owner and members can see it, and only its owner can delete it.
+func (s *Server) handleGroupByID(w http.ResponseWriter, r *http.Request) {
+	userID, groupID := UserIDFromContext(r.Context()), r.PathValue("groupID")
+
+	switch r.Method {
+	case http.MethodGet:
+		group, err := s.groups.Get(groupID, userID)
+		if err != nil {
+			s.writeGroupError(w, r, err)
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, toAPIGroup(group))
+	case http.MethodDelete:
+		if err := s.groups.Delete(groupID, userID); err != nil {
+			s.writeGroupError(w, r, err)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleGroupMember handles PUT and DELETE /v1/groups/{groupID}/members/{userID},
+// which add a member to a group and remove them. The group's owner manages
+// its members, and members may remove themselves.
+func (s *Server) handleGroupMember(w http.ResponseWriter, r *http.Request) {
+	callerID, groupID, memberID := UserIDFromContext(r.Context()), r.PathValue("groupID"), r.PathValue("userID")
+
+	var (
+		group acl.Group
+		err   error
+	)
+
+	switch r.Method {
+	case http.MethodPut:
+		group, err = s.groups.AddMember(groupID, callerID, memberID)
+	case http.MethodDelete:
+		group, err = s.groups.RemoveMember(groupID, callerID, memberID)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	if err != nil {
+		s.writeGroupError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toAPIGroup(group))
+}
+
+// writeGroupError maps a group service error to an HTTP response.
+func (s *Server) writeGroupError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, acl.ErrGroupNotFound):
+		writeError(w, http.StatusNotFound, "group not found")
+	case errors.Is(err, acl.ErrMemberNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, acl.ErrAccessDenied):
+		writeError(w, http.StatusForbidden, "only the group's owner can change it")
+	case errors.Is(err, acl.ErrInvalidMember):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		s.logger.ErrorContext(r.Context(), "group request failed", logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
+
+// toAPIGroup converts a group into its API representation.
+func toAPIGroup(group acl.Group) apitypes.Group {
+	members := group.Members
+	if members == nil {
+		members = []string{}
+	}
+
+	return apitypes.Group{
+		ID:        group.ID,
+		Name:      group.Name,
+		Principal: group.Principal(),
+		OwnerID:   group.OwnerID,
+		Members:   members,
+		CreatedAt: group.CreatedAt,
+	}
+}
@@ -0,0 +1,163 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// newGroupServer serves doc1, owned by alice, with groups enabled.
+func newGroupServer(t *testing.T) http.Handler {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	groupStore := acl.NewMemoryGroupStore()
+	permStore := acl.NewGroupedStore(acl.NewMemoryStore(), groupStore)
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Owner))
+
+	return handler.NewServer(handler.ServerConfig{
+		Manager:   collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore}),
+		Store:     store,
+		PermStore: permStore,
+		Groups:    acl.NewGroups(groupStore),
+	}).Handler()
+}
+
+// decodeGroup decodes a group from a response body.
+func decodeGroup(t *testing.T, body []byte) apitypes.Group {
+	t.Helper()
+
+	var group apitypes.Group
+	require.NoError(t, json.Unmarshal(body, &group))
+
+	return group
+}
+
+func TestGroupRoutes(t *testing.T) {
+	t.Parallel()
+
+	h := newGroupServer(t)
+
+	rec := serveAs(h, "alice", http.MethodPost, "/v1/groups", `{"name": "Engineering"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	group := decodeGroup(t, rec.Body.Bytes())
+	require.Equal(t, "Engineering", group.Name)
+	require.Equal(t, "group:"+group.ID, group.Principal)
+	require.Equal(t, []string{"alice"}, group.Members)
+
+	target := "/v1/groups/" + group.ID
+
+	rec = serveAs(h, "alice", http.MethodPut, target+"/members/bob", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, []string{"alice", "bob"}, decodeGroup(t, rec.Body.Bytes()).Members)
+
+	// Sharing a document with the group shares it with its members
+	rec = serveAs(h, "bob", http.MethodGet, "/v1/documents/doc1", "")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = serveAs(h, "alice", http.MethodPut, "/v1/documents/doc1/permissions/"+group.Principal, `{"role": "editor"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = serveAs(h, "bob", http.MethodGet, "/v1/documents/doc1", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = serveAs(h, "bob", http.MethodGet, "/v1/documents", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var docs apitypes.ListUserDocumentsResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&docs))
+	require.Equal(t, []apitypes.DocumentSummary{{ID: "doc1", Role: "editor"}}, docs.Documents)
+
+	// Members see the group, but only its owner changes it
+	rec = serveAs(h, "bob", http.MethodGet, "/v1/groups", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var list apitypes.ListGroupsResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&list))
+	require.Len(t, list.Groups, 1)
+	require.Equal(t, group.ID, list.Groups[0].ID)
+
+	require.Equal(t, http.StatusForbidden, serveAs(h, "bob", http.MethodPut, target+"/members/carol", "").Code)
+	require.Equal(t, http.StatusForbidden, serveAs(h, "bob", http.MethodDelete, target, "").Code)
+
+	// Leaving the group gives up its roles
+	rec = serveAs(h, "bob", http.MethodDelete, target+"/members/bob", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, []string{"alice"}, decodeGroup(t, rec.Body.Bytes()).Members)
+
+	rec = serveAs(h, "bob", http.MethodGet, "/v1/documents/doc1", "")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	// A group owning the document doesn't let its last owner step down
+	rec = serveAs(h, "alice", http.MethodPut, "/v1/documents/doc1/permissions/"+group.Principal, `{"role": "owner"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = serveAs(h, "alice", http.MethodDelete, "/v1/documents/doc1/permissions/alice", "")
+	require.Equal(t, http.StatusConflict, rec.Code, rec.Body.String())
+
+	rec = serveAs(h, "alice", http.MethodDelete, target, "")
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	require.Equal(t, http.StatusNotFound, serveAs(h, "alice", http.MethodGet, target, "").Code)
+}
+
+func TestGroupRoutes_Errors(t *testing.T) {
+	t.Parallel()
+
+	h := newGroupServer(t)
+
+	rec := serveAs(h, "alice", http.MethodPost, "/v1/groups", `{"name": "Engineering"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	target := "/v1/groups/" + decodeGroup(t, rec.Body.Bytes()).ID
+
+	disabled := handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: storage.NewMemoryStore()}),
+		Store:   storage.NewMemoryStore(),
+	}).Handler()
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		userID  string
+		method  string
+		target  string
+		body    string
+		status  int
+	}{
+		{"blank name", h, "alice", http.MethodPost, "/v1/groups", `{"name": " "}`, 400},
+		{"invalid JSON", h, "alice", http.MethodPost, "/v1/groups", `{`, 400},
+		{"outsider", h, "carol", http.MethodGet, target, "", 404},
+		{"unknown group", h, "alice", http.MethodGet, "/v1/groups/unknown", "", 404},
+		{"group as member", h, "alice", http.MethodPut, target + "/members/group:other", "", 400},
+		{"link as member", h, "alice", http.MethodPut, target + "/members/link:other", "", 400},
+		{"not a member", h, "alice", http.MethodDelete, target + "/members/carol", "", 404},
+		{
+			"sharing with an unknown group", h, "alice", http.MethodPut,
+			"/v1/documents/doc1/permissions/group:unknown", `{"role": "viewer"}`, 404,
+		},
+		{"other methods", h, "alice", http.MethodPut, "/v1/groups", "", 405},
+		{"other methods on a group", h, "alice", http.MethodPost, target, "", 405},
+		{"other methods on a member", h, "alice", http.MethodGet, target + "/members/alice", "", 405},
+		{"disabled without groups", disabled, "alice", http.MethodGet, "/v1/groups", "", 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if rec := serveAs(tt.handler, tt.userID, tt.method, tt.target, tt.body); rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/serroba/online-docs/internal/apitypes"
+)
+
+// Probe routes, unversioned because orchestrators are configured with them.
+const (
+	healthPath = "/healthz"
+	readyPath  = "/readyz"
+)
+
+// startupRetryAfter is the Retry-After, in seconds, sent while starting up.
+const startupRetryAfter = "5"
+
+// handleHealth handles GET /healthz. The process is alive as long as it
+// answers, so this succeeds even while startup tasks are running.
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apitypes.HealthResponse{Status: "ok"})
+}
+
+// handleReady handles GET /readyz, reporting 503 and the pending startup
+// tasks until the server can take traffic.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	if s.ready() {
+		writeJSON(w, http.StatusOK, apitypes.HealthResponse{Status: "ready"})
+
+		return
+	}
+
+	w.Header().Set("Retry-After", startupRetryAfter)
+	writeJSON(w, http.StatusServiceUnavailable, apitypes.HealthResponse{
+		Status:  "starting",
+		Pending: s.readiness.Pending(),
+	})
+}
+
+// ready reports whether startup has finished. Servers without a readiness
+// tracker are always ready.
+func (s *Server) ready() bool {
+	return s.readiness == nil || s.readiness.Ready()
+}
+
+// readinessMiddleware answers 503 to everything but the probes until startup
+// has finished, so no document is opened before its history was checked.
+func (s *Server) readinessMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.ready() || r.URL.Path == healthPath || r.URL.Path == readyPath {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		w.Header().Set("Retry-After", startupRetryAfter)
+		writeJSON(w, http.StatusServiceUnavailable, apitypes.ErrorResponse{
+			Code:    apitypes.ErrorCodeUnavailable,
+			Message: "server is starting",
+		})
+	})
+}
@@ -0,0 +1,71 @@
+package handler_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/health"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func newHealthServer(t *testing.T, readiness *health.Readiness) http.Handler {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	return handler.NewServer(handler.ServerConfig{
+		Manager:   collab.NewManager(collab.ManagerConfig{Store: store}),
+		Store:     store,
+		Readiness: readiness,
+	}).Handler()
+}
+
+func TestReadiness_GatesRequestsUntilStarted(t *testing.T) {
+	t.Parallel()
+
+	readiness := health.NewReadiness(health.TaskStore, health.TaskIntegrity)
+	h := newHealthServer(t, readiness)
+
+	rec := serveAs(h, "", http.MethodGet, "/healthz", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"status": "ok"}`, rec.Body.String())
+
+	rec = serveAs(h, "", http.MethodGet, "/readyz", "")
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Equal(t, "5", rec.Header().Get("Retry-After"))
+	require.JSONEq(t, `{"status": "starting", "pending": ["store", "integrity"]}`, rec.Body.String())
+
+	rec = serveAs(h, "alice", http.MethodGet, "/v1/documents/doc1", "")
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.JSONEq(t, `{"code": "unavailable", "message": "server is starting"}`, rec.Body.String())
+
+	readiness.Done(health.TaskStore)
+	readiness.Done(health.TaskIntegrity)
+
+	rec = serveAs(h, "", http.MethodGet, "/readyz", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"status": "ready"}`, rec.Body.String())
+
+	rec = serveAs(h, "alice", http.MethodGet, "/v1/documents/doc1", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
+
+func TestReadiness_ReadyWithoutTracker(t *testing.T) {
+	t.Parallel()
+
+	h := newHealthServer(t, nil)
+
+	if rec := serveAs(h, "", http.MethodGet, "/readyz", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rec.Code)
+	}
+
+	for _, target := range []string{"/healthz", "/readyz"} {
+		if rec := serveAs(h, "", http.MethodPost, target, ""); rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("expected POST %s to return 405, got %d", target, rec.Code)
+		}
+	}
+}
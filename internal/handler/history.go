@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// handleHistory handles GET /v1/documents/{id}/history.
+// It lists who made each revision still in the operation log and when,
+// newest first, a page at a time.
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	limit, after, err := parsePage(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	// The cursor holds the oldest revision of the previous page
+	before := 0
+	if after != "" {
+		if before, err = strconv.Atoi(after); err != nil || before <= 0 {
+			writeError(w, http.StatusBadRequest, errInvalidCursor.Error())
+
+			return
+		}
+	}
+
+	docID := r.PathValue("docID")
+
+	resp, err := s.history(r.Context(), docID, UserIDFromContext(r.Context()), before, limit)
+	if err != nil {
+		switch {
+		case errors.Is(err, acl.ErrAccessDenied):
+			writeError(w, http.StatusForbidden, "access denied")
+		case errors.Is(err, storage.ErrDocumentNotFound):
+			writeError(w, http.StatusNotFound, "document not found")
+		default:
+			s.logger.ErrorContext(r.Context(), "failed to load history", logging.DocID(docID), logging.Err(err))
+			writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// history returns a page of the document's history: up to limit operations
+// before the given revision, or the latest ones if it's zero.
+func (s *Server) history(
+	ctx context.Context, docID, userID string, before, limit int,
+) (apitypes.HistoryResponse, error) {
+	if s.permStore != nil {
+		checker := acl.NewChecker(s.permStore)
+		if err := checker.RequirePermission(docID, userID, acl.ActionRead); err != nil {
+			return apitypes.HistoryResponse{}, err
+		}
+	}
+
+	oldest := 0
+
+	snapshot, err := s.store.LoadSnapshot(ctx, docID)
+
+	switch {
+	case errors.Is(err, storage.ErrSnapshotNotFound):
+	case err != nil:
+		return apitypes.HistoryResponse{}, err
+	default:
+		oldest = snapshot.Revision
+	}
+
+	ops, err := s.store.LoadOperations(ctx, docID, oldest)
+	if err != nil {
+		return apitypes.HistoryResponse{}, err
+	}
+
+	// A snapshot taken since may have pruned more
+	if len(ops) > 0 {
+		oldest = max(oldest, ops[0].Revision-1)
+	}
+
+	resp := apitypes.HistoryResponse{ID: docID, OldestRevision: oldest, Operations: []apitypes.Operation{}}
+
+	for i := len(ops) - 1; i >= 0; i-- {
+		if before > 0 && ops[i].Revision >= before {
+			continue
+		}
+
+		// One more than fits shows there's another page
+		if len(resp.Operations) == limit {
+			resp.NextCursor = encodeCursor(strconv.Itoa(resp.Operations[limit-1].Revision))
+
+			break
+		}
+
+		resp.Operations = append(resp.Operations, toAPIOperation(ops[i]))
+	}
+
+	return resp, nil
+}
+
+// handleRevision handles GET /v1/documents/{id}/revisions/{revision}.
+// It returns the document's content as of the revision along with the
+// operation that produced it, if that's still in the operation log.
+func (s *Server) handleRevision(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	revision, err := strconv.Atoi(r.PathValue("revision"))
+	if err != nil || revision < 0 {
+		writeError(w, http.StatusBadRequest, "invalid revision")
+
+		return
+	}
+
+	docID := r.PathValue("docID")
+
+	resp, err := s.revision(r.Context(), docID, UserIDFromContext(r.Context()), revision)
+	if err != nil {
+		switch {
+		case errors.Is(err, acl.ErrAccessDenied):
+			writeError(w, http.StatusForbidden, "access denied")
+		case errors.Is(err, storage.ErrDocumentNotFound):
+			writeError(w, http.StatusNotFound, "document not found")
+		case errors.Is(err, storage.ErrRevisionNotFound):
+			writeError(w, http.StatusNotFound, "revision not found")
+		case errors.Is(err, storage.ErrRevisionCompacted):
+			writeError(w, http.StatusGone, "revision no longer available")
+		default:
+			s.logger.ErrorContext(r.Context(), "failed to load revision", logging.DocID(docID), logging.Err(err))
+			writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// revision rebuilds the document as of revision and looks up the operation
+// that produced it.
+func (s *Server) revision(
+	ctx context.Context, docID, userID string, revision int,
+) (apitypes.RevisionResponse, error) {
+	session, err := s.manager.GetOrCreateSession(ctx, docID)
+	if err != nil {
+		return apitypes.RevisionResponse{}, err
+	}
+
+	content, err := session.GetStateAt(ctx, userID, revision)
+	if err != nil {
+		return apitypes.RevisionResponse{}, err
+	}
+
+	resp := apitypes.RevisionResponse{ID: docID, Revision: revision, Content: content}
+
+	if revision == 0 {
+		return resp, nil
+	}
+
+	// The latest revisions may not be stored yet, and a snapshot may have
+	// pruned the operation since the content was rebuilt
+	ops, err := s.store.LoadOperations(ctx, docID, revision-1)
+	if err != nil {
+		return apitypes.RevisionResponse{}, err
+	}
+
+	if len(ops) > 0 && ops[0].Revision == revision {
+		op := toAPIOperation(ops[0])
+		resp.Operation = &op
+	}
+
+	return resp, nil
+}
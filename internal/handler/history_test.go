@@ -0,0 +1,188 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// newHistoryServer returns a server for a document alice typed "abcd" into,
+// with a snapshot at revision 1, and bob can't read.
+func newHistoryServer(t *testing.T) http.Handler {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Editor))
+
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore})
+
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	for i, char := range []string{"a", "b", "c", "d"} {
+		_, err = session.ApplyOperation("c1", "alice", ot.NewInsert(char, i, "alice"), i)
+		require.NoError(t, err)
+
+		if i == 0 {
+			require.NoError(t, session.Snapshot(t.Context()))
+		}
+	}
+
+	return handler.NewServer(handler.ServerConfig{Manager: manager, Store: store, PermStore: permStore}).Handler()
+}
+
+func decodeJSONBody[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var v T
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&v))
+
+	return v
+}
+
+func TestHistory(t *testing.T) {
+	t.Parallel()
+
+	h := newHistoryServer(t)
+
+	rec := serveAs(h, "alice", http.MethodGet, "/v1/documents/doc1/history?limit=2", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	page := decodeJSONBody[apitypes.HistoryResponse](t, rec)
+	require.Equal(t, 1, page.OldestRevision)
+	require.Len(t, page.Operations, 2)
+	require.Equal(t, 4, page.Operations[0].Revision)
+	require.Equal(t, "alice", page.Operations[0].UserID)
+	require.NotNil(t, page.Operations[0].Timestamp)
+	require.Equal(t, 3, page.Operations[1].Revision)
+	require.NotEmpty(t, page.NextCursor)
+
+	// Revisions up to the snapshot were compacted away
+	rec = serveAs(h, "alice", http.MethodGet, "/v1/documents/doc1/history?limit=2&cursor="+page.NextCursor, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	page = decodeJSONBody[apitypes.HistoryResponse](t, rec)
+	require.Len(t, page.Operations, 1)
+	require.Equal(t, 2, page.Operations[0].Revision)
+	require.Empty(t, page.NextCursor)
+
+	tests := []struct {
+		name   string
+		userID string
+		target string
+		want   int
+	}{
+		{"invalid limit", "alice", "/v1/documents/doc1/history?limit=0", http.StatusBadRequest},
+		{"invalid cursor", "alice", "/v1/documents/doc1/history?cursor=eA", http.StatusBadRequest},
+		{"denied", "bob", "/v1/documents/doc1/history", http.StatusForbidden},
+		{"missing document", "alice", "/v1/documents/missing/history", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := serveAs(h, tt.userID, http.MethodGet, tt.target, "")
+			require.Equal(t, tt.want, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestRevision(t *testing.T) {
+	t.Parallel()
+
+	h := newHistoryServer(t)
+
+	rec := serveAs(h, "alice", http.MethodGet, "/v1/documents/doc1/revisions/3", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	resp := decodeJSONBody[apitypes.RevisionResponse](t, rec)
+	require.Equal(t, "abc", resp.Content)
+	require.Equal(t, 3, resp.Revision)
+	require.NotNil(t, resp.Operation)
+	require.Equal(t, "c", resp.Operation.Char)
+	require.NotNil(t, resp.Operation.Timestamp)
+
+	// The snapshot's revision has content but no operation
+	rec = serveAs(h, "alice", http.MethodGet, "/v1/documents/doc1/revisions/1", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	resp = decodeJSONBody[apitypes.RevisionResponse](t, rec)
+	require.Equal(t, "a", resp.Content)
+	require.Nil(t, resp.Operation)
+
+	tests := []struct {
+		name   string
+		userID string
+		target string
+		want   int
+	}{
+		{"compacted", "alice", "/v1/documents/doc1/revisions/0", http.StatusGone},
+		{"future", "alice", "/v1/documents/doc1/revisions/5", http.StatusNotFound},
+		{"invalid", "alice", "/v1/documents/doc1/revisions/x", http.StatusBadRequest},
+		{"denied", "bob", "/v1/documents/doc1/revisions/2", http.StatusForbidden},
+		{"missing document", "alice", "/v1/documents/missing/revisions/1", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := serveAs(h, tt.userID, http.MethodGet, tt.target, "")
+			require.Equal(t, tt.want, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestHistory_Errors(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	noACL := handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store}),
+		Store:   store,
+	}).Handler()
+
+	broken := &failingLoadStore{MemoryStore: storage.NewMemoryStore()}
+	require.NoError(t, broken.CreateDocument(t.Context(), "doc1"))
+
+	failing := handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: broken}),
+		Store:   broken,
+	}).Handler()
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		method  string
+		target  string
+		want    int
+	}{
+		{"history method", noACL, http.MethodPost, "/v1/documents/doc1/history", http.StatusMethodNotAllowed},
+		{"revision method", noACL, http.MethodPost, "/v1/documents/doc1/revisions/1", http.StatusMethodNotAllowed},
+		{"missing document", noACL, http.MethodGet, "/v1/documents/missing/history", http.StatusNotFound},
+		{"history fails", failing, http.MethodGet, "/v1/documents/doc1/history", http.StatusInternalServerError},
+		{"revision fails", failing, http.MethodGet, "/v1/documents/doc1/revisions/1", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := serveAs(tt.handler, "alice", tt.method, tt.target, "")
+			require.Equal(t, tt.want, rec.Code, rec.Body.String())
+		})
+	}
+}
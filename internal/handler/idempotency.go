@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/serroba/online-docs/internal/idempotency"
+	"github.com/serroba/online-docs/internal/logging"
+)
+
+// headerIdempotencyKey carries the client's key for a retryable request.
+const headerIdempotencyKey = "Idempotency-Key"
+
+// headerIdempotentReplayed marks responses replayed from an earlier request.
+const headerIdempotentReplayed = "Idempotent-Replayed"
+
+// idempotent makes POST requests carrying an Idempotency-Key safe to retry.
+// The first response for a user's key is recorded and replayed to later
+// requests with the same key and body, so a retry after a timeout doesn't
+// repeat the work. Server errors aren't recorded, letting the client retry.
+func (s *Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(headerIdempotencyKey)
+		if s.idempotency == nil || key == "" || r.Method != http.MethodPost {
+			next(w, r)
+
+			return
+		}
+
+		if !validRequestID(key) {
+			writeError(w, http.StatusBadRequest, "invalid idempotency key")
+
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxBodyBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+
+				return
+			}
+
+			writeError(w, http.StatusBadRequest, "invalid request body")
+
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Keys are per user, and bound to the request they were first used for
+		storeKey := UserIDFromContext(r.Context()) + "\n" + key
+		fingerprint := sha256.Sum256(append([]byte(r.URL.Path+"\n"), body...))
+
+		resp, done, err := s.idempotency.Begin(storeKey, hex.EncodeToString(fingerprint[:]))
+		if err != nil {
+			writeIdempotencyError(w, err)
+
+			return
+		}
+
+		if done {
+			w.Header().Set("Content-Type", resp.ContentType)
+			w.Header().Set(headerIdempotentReplayed, "true")
+			w.WriteHeader(resp.Status)
+			_, _ = w.Write(resp.Body)
+
+			return
+		}
+
+		// A handler that panics leaves no response to record, so the key is
+		// released for the client to retry
+		returned := false
+
+		defer func() {
+			if returned {
+				return
+			}
+
+			if err := s.idempotency.Abandon(storeKey); err != nil {
+				s.logger.ErrorContext(r.Context(), "failed to release idempotency key", logging.Err(err))
+			}
+		}()
+
+		rec := &replayRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+
+		returned = true
+
+		if rec.status >= http.StatusInternalServerError {
+			err = s.idempotency.Abandon(storeKey)
+		} else {
+			err = s.idempotency.Complete(storeKey, idempotency.Response{
+				Status:      rec.status,
+				ContentType: rec.Header().Get("Content-Type"),
+				Body:        rec.body.Bytes(),
+			})
+		}
+
+		if err != nil {
+			s.logger.ErrorContext(r.Context(), "failed to record idempotent response", logging.Err(err))
+		}
+	}
+}
+
+// writeIdempotencyError maps an idempotency store error to a response.
+func writeIdempotencyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, idempotency.ErrInProgress):
+		writeError(w, http.StatusConflict, "a request with this idempotency key is in progress")
+	case errors.Is(err, idempotency.ErrKeyReused):
+		writeError(w, http.StatusConflict, "idempotency key was used for a different request")
+	default:
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
+
+// replayRecorder passes a response through while keeping a copy to replay.
+type replayRecorder struct {
+	http.ResponseWriter
+
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *replayRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *replayRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+
+	return r.ResponseWriter.Write(b)
+}
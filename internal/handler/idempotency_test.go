@@ -0,0 +1,204 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/idempotency"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// stubIdempotencyStore is an idempotency.Store whose Begin always fails.
+type stubIdempotencyStore struct {
+	err error
+}
+
+func (s stubIdempotencyStore) Begin(string, string) (idempotency.Response, bool, error) {
+	return idempotency.Response{}, false, s.err
+}
+
+func (stubIdempotencyStore) Complete(string, idempotency.Response) error { return nil }
+
+func (stubIdempotencyStore) Abandon(string) error { return nil }
+
+// panickingCreateStore panics the first time a document is created.
+type panickingCreateStore struct {
+	*storage.MemoryStore
+
+	panicked atomic.Bool
+}
+
+func (s *panickingCreateStore) CreateDocument(ctx context.Context, docID string) error {
+	if !s.panicked.Swap(true) {
+		panic("create failed")
+	}
+
+	return s.MemoryStore.CreateDocument(ctx, docID)
+}
+
+func newIdempotentServer(store storage.Store, keys idempotency.Store) http.Handler {
+	hub := ws.NewHub()
+	server := handler.NewServer(handler.ServerConfig{
+		Manager:      collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub}),
+		Store:        store,
+		Hub:          hub,
+		Idempotency:  keys,
+		MaxBodyBytes: 64,
+	})
+
+	return server.Handler()
+}
+
+func postWithKey(h http.Handler, userID, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/documents", strings.NewReader(body))
+	req.Header.Set("X-User-Id", userID)
+
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	t.Run("replays the first response", func(t *testing.T) {
+		t.Parallel()
+
+		h := newIdempotentServer(storage.NewMemoryStore(), idempotency.NewMemoryStore(time.Hour))
+
+		first := postWithKey(h, "alice", "retry-1", `{"id": "doc1"}`)
+		require.Equal(t, http.StatusCreated, first.Code, first.Body.String())
+
+		// Without the key, creating the same document again would conflict
+		retry := postWithKey(h, "alice", "retry-1", `{"id": "doc1"}`)
+		require.Equal(t, http.StatusCreated, retry.Code, retry.Body.String())
+
+		if retry.Body.String() != first.Body.String() {
+			t.Errorf("expected replayed body %q, got %q", first.Body.String(), retry.Body.String())
+		}
+
+		if retry.Header().Get("Idempotent-Replayed") != "true" {
+			t.Error("expected Idempotent-Replayed header on the retry")
+		}
+
+		if first.Header().Get("Idempotent-Replayed") != "" {
+			t.Error("expected no Idempotent-Replayed header on the first response")
+		}
+	})
+
+	t.Run("scopes keys to the user", func(t *testing.T) {
+		t.Parallel()
+
+		h := newIdempotentServer(storage.NewMemoryStore(), idempotency.NewMemoryStore(time.Hour))
+
+		require.Equal(t, http.StatusCreated, postWithKey(h, "alice", "k", `{"id": "doc1"}`).Code)
+
+		rec := postWithKey(h, "bob", "k", `{"id": "doc1"}`)
+		if rec.Code != http.StatusConflict || rec.Header().Get("Idempotent-Replayed") != "" {
+			t.Errorf("expected bob's request to run and conflict, got %d", rec.Code)
+		}
+	})
+
+	t.Run("rejects reuse with a different body", func(t *testing.T) {
+		t.Parallel()
+
+		h := newIdempotentServer(storage.NewMemoryStore(), idempotency.NewMemoryStore(time.Hour))
+
+		require.Equal(t, http.StatusCreated, postWithKey(h, "alice", "k", `{"id": "doc1"}`).Code)
+
+		rec := postWithKey(h, "alice", "k", `{"id": "doc2"}`)
+		require.Equal(t, http.StatusConflict, rec.Code)
+
+		var resp apitypes.ErrorResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+
+		if !strings.Contains(resp.Message, "different request") {
+			t.Errorf("unexpected message %q", resp.Message)
+		}
+	})
+
+	t.Run("records client errors", func(t *testing.T) {
+		t.Parallel()
+
+		h := newIdempotentServer(storage.NewMemoryStore(), idempotency.NewMemoryStore(time.Hour))
+
+		require.Equal(t, http.StatusBadRequest, postWithKey(h, "alice", "k", `{"id": "a/b"}`).Code)
+
+		rec := postWithKey(h, "alice", "k", `{"id": "a/b"}`)
+		if rec.Code != http.StatusBadRequest || rec.Header().Get("Idempotent-Replayed") != "true" {
+			t.Errorf("expected replayed 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("lets server errors be retried", func(t *testing.T) {
+		t.Parallel()
+
+		store := &failingSnapshotStore{MemoryStore: storage.NewMemoryStore()}
+		h := newIdempotentServer(store, idempotency.NewMemoryStore(time.Hour))
+
+		for range 2 {
+			rec := postWithKey(h, "alice", "k", `{"id": "doc1", "content": "x"}`)
+			if rec.Code != http.StatusInternalServerError || rec.Header().Get("Idempotent-Replayed") != "" {
+				t.Errorf("expected a fresh 500, got %d", rec.Code)
+			}
+		}
+	})
+
+	t.Run("releases the key when the handler panics", func(t *testing.T) {
+		t.Parallel()
+
+		store := &panickingCreateStore{MemoryStore: storage.NewMemoryStore()}
+		h := newIdempotentServer(store, idempotency.NewMemoryStore(time.Hour))
+
+		rec := postWithKey(h, "alice", "k", `{"id": "doc1"}`)
+		require.Equal(t, http.StatusInternalServerError, rec.Code)
+
+		rec = postWithKey(h, "alice", "k", `{"id": "doc1"}`)
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+		require.Empty(t, rec.Header().Get("Idempotent-Replayed"))
+	})
+
+	tests := []struct {
+		name   string
+		keys   idempotency.Store
+		key    string
+		body   string
+		status int
+	}{
+		{"request in progress", stubIdempotencyStore{idempotency.ErrInProgress}, "k", `{"id": "doc1"}`, 409},
+		{"store failure", stubIdempotencyStore{errors.New("unavailable")}, "k", `{"id": "doc1"}`, 500},
+		{"invalid key", idempotency.NewMemoryStore(time.Hour), "bad key", `{"id": "doc1"}`, 400},
+		{"oversized body", idempotency.NewMemoryStore(time.Hour), "k", `{"id": "` + strings.Repeat("a", 100) + `"}`, 413},
+		{"ignored without a key", stubIdempotencyStore{errors.New("unused")}, "", `{"id": "doc1"}`, 201},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h := newIdempotentServer(storage.NewMemoryStore(), tt.keys)
+
+			rec := postWithKey(h, "alice", tt.key, tt.body)
+			if rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
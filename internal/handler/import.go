@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/importer"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// maxImportBytes caps the size of an imported file.
+const maxImportBytes = 10 << 20
+
+// handleImportDocument handles POST /v1/documents/import, which creates a
+// document from an uploaded Markdown, Word or text file. The file is sent
+// as the "file" field of a multipart form, and its format is told by its
+// name. Optional "id" and "slug" fields work as when creating a document.
+func (s *Server) handleImportDocument(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes+multipartOverheadBytes)
+
+	if err := r.ParseMultipartForm(maxImportBytes); err != nil {
+		writeImportError(w, err)
+
+		return
+	}
+
+	req := apitypes.CreateDocumentRequest{ID: r.FormValue("id"), Slug: r.FormValue("slug")}
+	if err := req.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	content, ok := readImport(w, r)
+	if !ok {
+		return
+	}
+
+	if req.ID == "" {
+		req.ID = uuid.New().String()
+	}
+
+	if err := s.createDocument(r.Context(), req.ID, content); err != nil {
+		if errors.Is(err, storage.ErrDocumentExists) {
+			writeError(w, http.StatusConflict, "document already exists")
+
+			return
+		}
+
+		s.logger.ErrorContext(r.Context(), "import failed", logging.DocID(req.ID), logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	s.finishCreate(w, r, req.ID, req.Slug)
+}
+
+// readImport converts the uploaded file into document content. It writes
+// the error response and returns false if the file can't be imported.
+func readImport(w http.ResponseWriter, r *http.Request) (string, bool) {
+	file, header, err := r.FormFile(attachmentFormField)
+	if err != nil {
+		writeImportError(w, err)
+
+		return "", false
+	}
+	defer func() { _ = file.Close() }()
+
+	format, err := importer.FormatOf(header.Filename)
+	if err != nil {
+		writeError(w, http.StatusUnsupportedMediaType, "unsupported file type; import .md, .docx or .txt files")
+
+		return "", false
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeImportError(w, err)
+
+		return "", false
+	}
+
+	content, err := importer.Convert(format, data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return "", false
+	}
+
+	return content, true
+}
+
+// writeImportError reports a failure to read the multipart body.
+func writeImportError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &tooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, "file too large")
+	case errors.Is(err, http.ErrMissingFile):
+		writeError(w, http.StatusBadRequest, "missing "+attachmentFormField+" field")
+	default:
+		writeError(w, http.StatusBadRequest, "invalid multipart body: "+err.Error())
+	}
+}
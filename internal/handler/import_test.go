@@ -0,0 +1,112 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/blob"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleImportDocument(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	permStore := acl.NewMemoryStore()
+	h := newAttachmentServer(store, permStore, blob.NewMemoryStore(), 0)
+
+	rec := upload(t, h, "alice", "/v1/documents/import",
+		formPart{field: "file", fileName: "minutes.md", data: []byte("# Minutes\n\n- **Ship** the [beta](https://x.io)")},
+		formPart{field: "id", data: []byte("minutes")},
+		formPart{field: "slug", data: []byte("weekly-minutes")},
+	)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	var resp apitypes.CreateDocumentResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, apitypes.CreateDocumentResponse{ID: "minutes", Slug: "weekly-minutes"}, resp)
+
+	// The content is the revision 0 snapshot, and the importer owns the document
+	rec = serveAs(h, "alice", http.MethodGet, "/v1/documents/minutes", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var doc apitypes.GetDocumentResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&doc))
+	require.Equal(t, "Minutes\n\n- Ship the beta", doc.Content)
+	require.Zero(t, doc.Revision)
+
+	role, err := permStore.GetRole("minutes", "alice")
+	require.NoError(t, err)
+	require.Equal(t, acl.Owner, role)
+
+	// Without an ID, one is generated
+	rec = upload(t, h, "alice", "/v1/documents/import", formPart{field: "file", fileName: "notes.txt", data: []byte("hi")})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.NotEmpty(t, resp.ID)
+}
+
+func TestHandleImportDocument_Errors(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "taken"))
+
+	h := newAttachmentServer(store, nil, blob.NewMemoryStore(), 0)
+
+	tests := []struct {
+		name  string
+		parts []formPart
+		want  int
+	}{
+		{
+			name:  "missing file",
+			parts: []formPart{{field: "id", data: []byte("doc1")}},
+			want:  http.StatusBadRequest,
+		},
+		{
+			name:  "unsupported type",
+			parts: []formPart{{field: "file", fileName: "notes.pdf", data: []byte("%PDF-1.4")}},
+			want:  http.StatusUnsupportedMediaType,
+		},
+		{
+			name:  "invalid docx",
+			parts: []formPart{{field: "file", fileName: "notes.docx", data: []byte("not a zip")}},
+			want:  http.StatusBadRequest,
+		},
+		{
+			name:  "invalid id",
+			parts: []formPart{{field: "id", data: []byte("import")}, {field: "file", fileName: "a.md", data: []byte("a")}},
+			want:  http.StatusBadRequest,
+		},
+		{
+			name:  "existing document",
+			parts: []formPart{{field: "id", data: []byte("taken")}, {field: "file", fileName: "a.md", data: []byte("a")}},
+			want:  http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := upload(t, h, "alice", "/v1/documents/import", tt.parts...)
+			require.Equal(t, tt.want, rec.Code, rec.Body.String())
+		})
+	}
+
+	rec := serveAs(h, "alice", http.MethodPost, "/v1/documents/import", `{"content": "hi"}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serveAs(h, "alice", http.MethodGet, "/v1/documents/import", "")
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	failing := newAttachmentServer(&failingSnapshotStore{MemoryStore: storage.NewMemoryStore()}, nil,
+		blob.NewMemoryStore(), 0)
+	rec = upload(t, failing, "alice", "/v1/documents/import", formPart{field: "file", fileName: "a.md", data: []byte("a")})
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+}
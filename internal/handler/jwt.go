@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/serroba/online-docs/internal/jwt"
+	"github.com/serroba/online-docs/internal/logging"
+)
+
+// bearerSubprotocol announces a bearer token in the WebSocket subprotocols
+// offered on the handshake, the token being the next one offered.
+const bearerSubprotocol = "bearer"
+
+// invalidTokenErrors are the verification failures caused by the token
+// rather than the server.
+var invalidTokenErrors = []error{
+	jwt.ErrMalformedToken,
+	jwt.ErrUnsupportedAlgorithm,
+	jwt.ErrInvalidSignature,
+	jwt.ErrKeyNotFound,
+	jwt.ErrTokenExpired,
+	jwt.ErrTokenNotYetValid,
+	jwt.ErrInvalidIssuer,
+	jwt.ErrInvalidAudience,
+	jwt.ErrMissingSubject,
+}
+
+// isJWT reports whether a bearer token is a JWT rather than an access token
+// issued by /auth/login.
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// authenticateJWT verifies a JWT from the identity provider and takes its
+// subject as the user ID.
+func (s *Server) authenticateJWT(w http.ResponseWriter, r *http.Request, token string, next http.Handler) {
+	claims, err := s.jwt.Verify(r.Context(), token)
+	if err != nil {
+		if slices.ContainsFunc(invalidTokenErrors, func(target error) bool { return errors.Is(err, target) }) {
+			writeError(w, http.StatusUnauthorized, "invalid or expired access token")
+
+			return
+		}
+
+		s.logger.ErrorContext(r.Context(), "failed to verify JWT", logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	// The provider's users can't pass for the server's own principals
+	if msg, reserved := reservedPrincipal(claims.Subject); reserved {
+		writeError(w, http.StatusUnauthorized, msg)
+
+		return
+	}
+
+	next.ServeHTTP(w, r.WithContext(withUserID(r.Context(), claims.Subject)))
+}
+
+// subprotocolToken returns the bearer token offered among the WebSocket
+// subprotocols of an upgrade request, for browsers, which can't set headers
+// on the handshake but can offer subprotocols.
+func subprotocolToken(r *http.Request) (string, bool) {
+	protocols := websocket.Subprotocols(r)
+
+	i := slices.Index(protocols, bearerSubprotocol)
+	if i < 0 || i+1 >= len(protocols) || protocols[i+1] == "" {
+		return "", false
+	}
+
+	return protocols[i+1], true
+}
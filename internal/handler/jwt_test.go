@@ -0,0 +1,180 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/auth"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/jwt"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+var jwtSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// newJWTServer returns a handler accepting JWTs signed with jwtSecret for the
+// "docs" audience, where alice owns doc1.
+func newJWTServer(t *testing.T, tokens *auth.TokenManager) http.Handler {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Owner))
+
+	hub := ws.NewHub()
+
+	return handler.NewServer(handler.ServerConfig{
+		Manager:   collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore, Hub: hub}),
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+		Tokens:    tokens,
+		JWT: jwt.NewVerifier(jwt.VerifierConfig{
+			Keys:     jwt.NewStaticKeySet(jwtSecret),
+			Audience: "docs",
+		}),
+	}).Handler()
+}
+
+// signJWT returns a token for subject, signed with key, expiring after ttl.
+func signJWT(t *testing.T, key []byte, subject string, ttl time.Duration) string {
+	t.Helper()
+
+	token, err := jwt.Sign(jwt.HS256, "", key, jwt.Claims{
+		Subject:   subject,
+		Audience:  jwt.Audience{"docs"},
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+	})
+	require.NoError(t, err)
+
+	return token
+}
+
+func TestJWT(t *testing.T) {
+	t.Parallel()
+
+	h := newJWTServer(t, nil)
+
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{"valid token", http.Header{"Authorization": {"Bearer " + signJWT(t, jwtSecret, "alice", time.Hour)}}, http.StatusOK},
+		{
+			"other user",
+			http.Header{"Authorization": {"Bearer " + signJWT(t, jwtSecret, "bob", time.Hour)}},
+			http.StatusForbidden,
+		},
+		{"header isn't trusted", http.Header{"X-User-Id": {"alice"}}, http.StatusUnauthorized},
+		{
+			"expired",
+			http.Header{"Authorization": {"Bearer " + signJWT(t, jwtSecret, "alice", -time.Hour)}},
+			http.StatusUnauthorized,
+		},
+		{
+			"wrong key",
+			http.Header{"Authorization": {"Bearer " + signJWT(t, []byte("another secret"), "alice", time.Hour)}},
+			http.StatusUnauthorized,
+		},
+		{
+			"service account subject",
+			http.Header{"Authorization": {"Bearer " + signJWT(t, jwtSecret, "service:key1", time.Hour)}},
+			http.StatusUnauthorized,
+		},
+		{
+			"group subject",
+			http.Header{"Authorization": {"Bearer " + signJWT(t, jwtSecret, acl.GroupPrincipal("g1"), time.Hour)}},
+			http.StatusUnauthorized,
+		},
+		{"malformed", http.Header{"Authorization": {"Bearer not-a-jwt"}}, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/documents/doc1", nil)
+			req.Header = tt.header
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			require.Equal(t, tt.status, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestJWT_WithAccessTokens(t *testing.T) {
+	t.Parallel()
+
+	h := newJWTServer(t, auth.NewTokenManager(auth.NewMemoryTokenStore(), 0, 0))
+
+	// A JWT can be exchanged for an access token, and both authenticate
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+	req.Header.Set("Authorization", "Bearer "+signJWT(t, jwtSecret, "alice", time.Hour))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	tokens := decodeTokens(t, rec)
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/documents/doc1", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
+
+func TestJWT_WebSocketHandshake(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(newJWTServer(t, nil))
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/ws?docId=doc1"
+	token := signJWT(t, jwtSecret, "alice", time.Hour)
+
+	tests := []struct {
+		name     string
+		url      string
+		dialer   *websocket.Dialer
+		protocol string
+	}{
+		{"query parameter", url + "&access_token=" + token, websocket.DefaultDialer, ""},
+		{"subprotocol", url, &websocket.Dialer{Subprotocols: []string{"bearer", token}}, "bearer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			conn, resp, err := tt.dialer.Dial(tt.url, nil)
+			require.NoError(t, err)
+
+			_ = resp.Body.Close()
+			t.Cleanup(func() { _ = conn.Close() })
+
+			// Browsers drop connections that don't select an offered subprotocol
+			require.Equal(t, tt.protocol, conn.Subprotocol())
+			require.Equal(t, ws.MessageTypeState, readEdit(t, conn).Type)
+		})
+	}
+
+	// Without a token the handshake is refused
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"X-User-Id": {"alice"}})
+	require.ErrorIs(t, err, websocket.ErrBadHandshake)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	_ = resp.Body.Close()
+}
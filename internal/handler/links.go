@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/logging"
+)
+
+// linkTokenParam is the query parameter carrying a share link's token.
+const linkTokenParam = "token"
+
+// handleCreateShareLink handles POST /v1/documents/{id}/links.
+// Owners mint a token giving anyone who holds it a role on the document.
+func (s *Server) handleCreateShareLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	docID := r.PathValue("docID")
+	userID := UserIDFromContext(r.Context())
+
+	if err := s.requireDocument(r.Context(), docID, userID, acl.ActionShare); err != nil {
+		s.writePermissionsError(w, r, err)
+
+		return
+	}
+
+	var req apitypes.CreateShareLinkRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	role, _ := acl.ParseRole(req.Role) // Checked by Validate
+
+	var expiresAt time.Time
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
+
+	link, token, err := s.shareLinks.Create(docID, role, userID, expiresAt)
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "failed to create share link", logging.DocID(docID), logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, apitypes.CreateShareLinkResponse{Link: toShareLink(link), Token: token})
+}
+
+// authenticateLink resolves a share link token into the link's principal.
+// A link only authenticates requests for its own document.
+func (s *Server) authenticateLink(w http.ResponseWriter, r *http.Request, token string, next http.Handler) {
+	link, err := s.shareLinks.Resolve(token)
+	if err != nil {
+		if errors.Is(err, acl.ErrInvalidLink) {
+			writeError(w, http.StatusUnauthorized, err.Error())
+
+			return
+		}
+
+		s.logger.ErrorContext(r.Context(), "failed to resolve share link", logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	docID := pathDocID(r)
+	if docID == "" {
+		docID = queryDocID(r)
+	}
+
+	if docID != link.DocID {
+		writeError(w, http.StatusForbidden, "share link is for another document")
+
+		return
+	}
+
+	next.ServeHTTP(w, r.WithContext(withUserID(r.Context(), link.Principal())))
+}
+
+// toShareLink converts a share link into its API representation.
+func toShareLink(link acl.ShareLink) apitypes.ShareLink {
+	resp := apitypes.ShareLink{
+		ID:        link.ID,
+		Role:      link.Role.String(),
+		CreatedBy: link.CreatedBy,
+		CreatedAt: link.CreatedAt,
+	}
+
+	if !link.ExpiresAt.IsZero() {
+		resp.ExpiresAt = &link.ExpiresAt
+	}
+
+	return resp
+}
@@ -0,0 +1,179 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// newLinksServer returns a handler for doc1 and doc2, both owned by alice,
+// with bob as an editor of doc1, and the links its share links are kept in.
+func newLinksServer(t *testing.T) (http.Handler, *acl.Links) {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc2"))
+
+	linkStore := acl.NewMemoryLinkStore()
+	permStore := acl.NewLinkedStore(acl.NewMemoryStore(), linkStore)
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Owner))
+	require.NoError(t, permStore.Grant("doc1", "bob", acl.Editor))
+	require.NoError(t, permStore.Grant("doc2", "alice", acl.Owner))
+
+	links := acl.NewLinks(linkStore)
+
+	return handler.NewServer(handler.ServerConfig{
+		Manager:    collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore}),
+		Store:      store,
+		PermStore:  permStore,
+		ShareLinks: links,
+	}).Handler(), links
+}
+
+func TestCreateShareLink(t *testing.T) {
+	t.Parallel()
+
+	h, _ := newLinksServer(t)
+
+	rec := serveAs(h, "alice", http.MethodPost, "/v1/documents/doc1/links", `{"role": "editor"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	var created apitypes.CreateShareLinkResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	require.NotEmpty(t, created.Token)
+	require.Equal(t, "editor", created.Link.Role)
+	require.Equal(t, "alice", created.Link.CreatedBy)
+	require.Nil(t, created.Link.ExpiresAt)
+
+	// Anyone holding the token can edit the document, without logging in
+	rec = serveAs(h, "", http.MethodPut, "/v1/documents/doc1/tags?token="+created.Token, `{"tags": ["shared"]}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	rec = serveAs(h, "alice", http.MethodPost, "/v1/documents/doc1/links",
+		`{"role": "viewer", "expiresAt": "`+expiresAt+`"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	require.NotNil(t, created.Link.ExpiresAt)
+
+	pastExpiry := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name   string
+		userID string
+		body   string
+		status int
+	}{
+		{"editors can't share", "bob", `{"role": "viewer"}`, http.StatusForbidden},
+		{"owner links", "alice", `{"role": "owner"}`, http.StatusBadRequest},
+		{"expired", "alice", `{"role": "viewer", "expiresAt": "` + pastExpiry + `"}`, http.StatusBadRequest},
+		{"invalid body", "alice", `{"role": 1}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := serveAs(h, tt.userID, http.MethodPost, "/v1/documents/doc1/links", tt.body)
+			require.Equal(t, tt.status, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestShareLinkAccess(t *testing.T) {
+	t.Parallel()
+
+	h, links := newLinksServer(t)
+
+	_, viewer, err := links.Create("doc1", acl.Viewer, "alice", time.Time{})
+	require.NoError(t, err)
+
+	_, expired, err := links.Create("doc1", acl.Editor, "alice", time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		userID string
+		method string
+		target string
+		token  string
+		body   string
+		status int
+	}{
+		{"read", "", http.MethodGet, "/v1/documents/doc1", viewer, "", http.StatusOK},
+		{"write as viewer", "", http.MethodPut, "/v1/documents/doc1/tags", viewer, `{"tags": []}`, http.StatusForbidden},
+		{"list permissions", "", http.MethodGet, "/v1/documents/doc1/permissions", viewer, "", http.StatusOK},
+		{"other document", "", http.MethodGet, "/v1/documents/doc2", viewer, "", http.StatusForbidden},
+		{"other routes", "", http.MethodGet, "/v1/documents", viewer, "", http.StatusForbidden},
+		{"expired", "", http.MethodGet, "/v1/documents/doc1", expired, "", http.StatusUnauthorized},
+		{"unknown", "", http.MethodGet, "/v1/documents/doc1", "odl_unknown", "", http.StatusUnauthorized},
+		{"assumed principal", "link:x", http.MethodGet, "/v1/documents/doc1", "", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			target := tt.target
+			if tt.token != "" {
+				target += "?token=" + url.QueryEscape(tt.token)
+			}
+
+			rec := serveAs(h, tt.userID, tt.method, target, tt.body)
+			require.Equal(t, tt.status, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+// failingLinkStore is a LinkStore that can't be used.
+type failingLinkStore struct {
+	*acl.MemoryLinkStore
+}
+
+func (failingLinkStore) Save(acl.ShareLink, string) error {
+	return errors.New("links unavailable")
+}
+
+func (failingLinkStore) GetByHash(string) (acl.ShareLink, error) {
+	return acl.ShareLink{}, errors.New("links unavailable")
+}
+
+func TestShareLinks_Errors(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	linkStore := failingLinkStore{MemoryLinkStore: acl.NewMemoryLinkStore()}
+	permStore := acl.NewLinkedStore(acl.NewMemoryStore(), linkStore)
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Owner))
+
+	h := handler.NewServer(handler.ServerConfig{
+		Manager:    collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore}),
+		Store:      store,
+		PermStore:  permStore,
+		ShareLinks: acl.NewLinks(linkStore),
+	}).Handler()
+
+	rec := serveAs(h, "alice", http.MethodGet, "/v1/documents/doc1/links", "")
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = serveAs(h, "alice", http.MethodPost, "/v1/documents/doc1/links", `{"role": "viewer"}`)
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	rec = serveAs(h, "", http.MethodGet, "/v1/documents/doc1?token=odl_abc", "")
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+}
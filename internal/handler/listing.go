@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// Page sizes of document listings.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100 // Larger limits are lowered to this
+)
+
+// Errors for malformed listing query parameters.
+var (
+	errInvalidLimit    = errors.New("limit must be a positive integer")
+	errInvalidCursor   = errors.New("invalid cursor")
+	errInvalidStarred  = errors.New("starred must be true or false")
+	errInvalidArchived = errors.New("archived must be true or false")
+)
+
+// listQuery is a parsed document listing request.
+type listQuery struct {
+	limit int
+	after string // The ID of the last document of the previous page
+
+	role     acl.Role
+	filtered bool // Whether only documents with role are listed
+
+	tag       string // Only documents with this tag are listed, if set
+	starred   bool
+	byStarred bool // Whether only documents the user has or hasn't starred are listed
+	archived  bool // Whether archived documents are listed too
+}
+
+// handleListUserDocuments handles GET /v1/documents.
+// It lists the documents the caller has a role on, sorted by ID, a page at
+// a time. Without access control every document is listed, as owned.
+// Archived documents are left out unless archived=true is given.
+func (s *Server) handleListUserDocuments(w http.ResponseWriter, r *http.Request) {
+	query, err := parseListQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	userID := UserIDFromContext(r.Context())
+
+	page, err := s.listUserDocuments(r.Context(), userID, query)
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "failed to list documents", logging.UserID(userID), logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// parseListQuery reads the limit, cursor, role, tag, starred and archived
+// query parameters.
+func parseListQuery(r *http.Request) (listQuery, error) {
+	params := r.URL.Query()
+
+	limit, after, err := parsePage(params)
+	if err != nil {
+		return listQuery{}, err
+	}
+
+	query := listQuery{limit: limit, after: after, tag: params.Get("tag")}
+
+	if raw := params.Get("role"); raw != "" {
+		role, err := acl.ParseRole(raw)
+		if err != nil {
+			return listQuery{}, err
+		}
+
+		query.role = role
+		query.filtered = true
+	}
+
+	if raw := params.Get("starred"); raw != "" {
+		starred, err := strconv.ParseBool(raw)
+		if err != nil {
+			return listQuery{}, errInvalidStarred
+		}
+
+		query.starred = starred
+		query.byStarred = true
+	}
+
+	if raw := params.Get("archived"); raw != "" {
+		archived, err := strconv.ParseBool(raw)
+		if err != nil {
+			return listQuery{}, errInvalidArchived
+		}
+
+		query.archived = archived
+	}
+
+	return query, nil
+}
+
+// parsePage reads the limit and cursor query parameters of a listing that's
+// returned a page at a time. The cursor holds where the previous page ended,
+// see encodeCursor; after is empty on the first page.
+func parsePage(params url.Values) (limit int, after string, err error) {
+	limit = defaultPageSize
+
+	if raw := params.Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return 0, "", errInvalidLimit
+		}
+
+		limit = min(limit, maxPageSize)
+	}
+
+	if raw := params.Get("cursor"); raw != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(raw)
+		if err != nil || len(decoded) == 0 {
+			return 0, "", errInvalidCursor
+		}
+
+		after = string(decoded)
+	}
+
+	return limit, after, nil
+}
+
+// encodeCursor returns the cursor of the page after the one ending at last.
+func encodeCursor(last string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(last))
+}
+
+// listUserDocuments returns the page of the user's documents that query
+// asks for. Documents deleted since they were shared are left out.
+func (s *Server) listUserDocuments(
+	ctx context.Context, userID string, query listQuery,
+) (apitypes.ListUserDocumentsResponse, error) {
+	perms, err := s.userPermissions(ctx, userID)
+	if err != nil {
+		return apitypes.ListUserDocumentsResponse{}, err
+	}
+
+	starred, err := s.starredSet(userID)
+	if err != nil {
+		return apitypes.ListUserDocumentsResponse{}, err
+	}
+
+	page := apitypes.ListUserDocumentsResponse{Documents: []apitypes.DocumentSummary{}}
+
+	for _, perm := range perms {
+		if perm.DocID <= query.after || query.filtered && perm.Role != query.role ||
+			query.byStarred && starred[perm.DocID] != query.starred {
+			continue
+		}
+
+		meta, err := s.store.LoadMetadata(ctx, perm.DocID)
+		if errors.Is(err, storage.ErrDocumentNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return apitypes.ListUserDocumentsResponse{}, err
+		}
+
+		archived := !meta.ArchivedAt.IsZero()
+		if archived && !query.archived || query.tag != "" && !slices.Contains(meta.Tags, query.tag) {
+			continue
+		}
+
+		// One more than fits shows there's another page
+		if len(page.Documents) == query.limit {
+			page.NextCursor = encodeCursor(page.Documents[len(page.Documents)-1].ID)
+
+			break
+		}
+
+		page.Documents = append(page.Documents, apitypes.DocumentSummary{
+			ID:        perm.DocID,
+			Role:      perm.Role.String(),
+			IsStarred: starred[perm.DocID],
+			Archived:  archived,
+		})
+	}
+
+	return page, nil
+}
+
+// starredSet returns the documents the user has starred, or none without
+// a preferences store.
+func (s *Server) starredSet(userID string) (map[string]bool, error) {
+	if s.preferences == nil {
+		return nil, nil
+	}
+
+	docIDs, err := s.preferences.ListStarred(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	starred := make(map[string]bool, len(docIDs))
+	for _, docID := range docIDs {
+		starred[docID] = true
+	}
+
+	return starred, nil
+}
+
+// userPermissions returns the user's roles on documents, sorted by document
+// ID. Without access control everyone owns every document.
+func (s *Server) userPermissions(ctx context.Context, userID string) ([]acl.Permission, error) {
+	if s.permStore != nil {
+		return s.permStore.ListDocuments(userID)
+	}
+
+	docIDs, err := s.store.ListDocuments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	perms := make([]acl.Permission, 0, len(docIDs))
+	for _, docID := range docIDs {
+		perms = append(perms, acl.Permission{DocID: docID, UserID: userID, Role: acl.Owner})
+	}
+
+	return perms, nil
+}
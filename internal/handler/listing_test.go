@@ -0,0 +1,172 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/preferences"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func newListingServer(store storage.Store, permStore acl.Store) http.Handler {
+	return handler.NewServer(handler.ServerConfig{
+		Manager:   collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore}),
+		Store:     store,
+		PermStore: permStore,
+	}).Handler()
+}
+
+func listDocuments(t *testing.T, h http.Handler, userID, query string) apitypes.ListUserDocumentsResponse {
+	t.Helper()
+
+	rec := serveAs(h, userID, http.MethodGet, "/v1/documents"+query, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	return decodeListing(t, rec)
+}
+
+func decodeListing(t *testing.T, rec *httptest.ResponseRecorder) apitypes.ListUserDocumentsResponse {
+	t.Helper()
+
+	var resp apitypes.ListUserDocumentsResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+
+	return resp
+}
+
+func TestListDocuments(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	permStore := acl.NewMemoryStore()
+
+	for docID, role := range map[string]acl.Role{"a": acl.Owner, "b": acl.Viewer, "c": acl.Editor, "d": acl.Owner} {
+		require.NoError(t, store.CreateDocument(t.Context(), docID))
+		require.NoError(t, permStore.Grant(docID, "alice", role))
+	}
+
+	require.NoError(t, store.CreateDocument(t.Context(), "private"))
+	require.NoError(t, permStore.Grant("private", "bob", acl.Owner))
+
+	// Shares of deleted documents are left out
+	require.NoError(t, permStore.Grant("deleted", "alice", acl.Owner))
+
+	h := newListingServer(store, permStore)
+
+	page := listDocuments(t, h, "alice", "?limit=2")
+	require.Equal(t, []apitypes.DocumentSummary{{ID: "a", Role: "owner"}, {ID: "b", Role: "viewer"}}, page.Documents)
+	require.NotEmpty(t, page.NextCursor)
+
+	page = listDocuments(t, h, "alice", "?limit=2&cursor="+page.NextCursor)
+	require.Equal(t, []apitypes.DocumentSummary{{ID: "c", Role: "editor"}, {ID: "d", Role: "owner"}}, page.Documents)
+	require.Empty(t, page.NextCursor)
+
+	page = listDocuments(t, h, "alice", "?role=owner")
+	require.Equal(t, []apitypes.DocumentSummary{{ID: "a", Role: "owner"}, {ID: "d", Role: "owner"}}, page.Documents)
+
+	page = listDocuments(t, h, "carol", "")
+	require.NotNil(t, page.Documents)
+	require.Empty(t, page.Documents)
+}
+
+func TestListDocuments_Filters(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	starred := preferences.NewMemoryStore()
+
+	for _, docID := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, store.CreateDocument(t.Context(), docID))
+	}
+
+	require.NoError(t, store.SetTags(t.Context(), "a", []string{"budget", "q1"}))
+	require.NoError(t, store.SetTags(t.Context(), "c", []string{"budget"}))
+	require.NoError(t, store.SetArchived(t.Context(), "d", true))
+	require.NoError(t, starred.Star("alice", "b"))
+	require.NoError(t, starred.Star("alice", "d"))
+
+	h := handler.NewServer(handler.ServerConfig{
+		Manager:     collab.NewManager(collab.ManagerConfig{Store: store}),
+		Store:       store,
+		Preferences: starred,
+	}).Handler()
+
+	// Archived documents are left out by default
+	page := listDocuments(t, h, "alice", "")
+	require.Equal(t, []apitypes.DocumentSummary{
+		{ID: "a", Role: "owner"},
+		{ID: "b", Role: "owner", IsStarred: true},
+		{ID: "c", Role: "owner"},
+	}, page.Documents)
+
+	page = listDocuments(t, h, "alice", "?archived=true")
+	require.Len(t, page.Documents, 4)
+	require.Equal(t, apitypes.DocumentSummary{ID: "d", Role: "owner", IsStarred: true, Archived: true}, page.Documents[3])
+
+	page = listDocuments(t, h, "alice", "?tag=budget")
+	require.Equal(t, []apitypes.DocumentSummary{{ID: "a", Role: "owner"}, {ID: "c", Role: "owner"}}, page.Documents)
+
+	page = listDocuments(t, h, "alice", "?starred=true")
+	require.Equal(t, []apitypes.DocumentSummary{{ID: "b", Role: "owner", IsStarred: true}}, page.Documents)
+
+	page = listDocuments(t, h, "alice", "?starred=false&tag=q1")
+	require.Equal(t, []apitypes.DocumentSummary{{ID: "a", Role: "owner"}}, page.Documents)
+
+	// Pages are filled with matching documents
+	page = listDocuments(t, h, "alice", "?limit=1&tag=budget")
+	require.Equal(t, []apitypes.DocumentSummary{{ID: "a", Role: "owner"}}, page.Documents)
+	require.NotEmpty(t, page.NextCursor)
+
+	page = listDocuments(t, h, "alice", "?limit=1&tag=budget&cursor="+page.NextCursor)
+	require.Equal(t, []apitypes.DocumentSummary{{ID: "c", Role: "owner"}}, page.Documents)
+	require.Empty(t, page.NextCursor)
+}
+
+func TestListDocuments_WithoutAccessControl(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "b"))
+	require.NoError(t, store.CreateDocument(t.Context(), "a"))
+
+	h := newListingServer(store, nil)
+
+	// Everyone owns every document
+	page := listDocuments(t, h, "alice", "")
+	require.Equal(t, []apitypes.DocumentSummary{{ID: "a", Role: "owner"}, {ID: "b", Role: "owner"}}, page.Documents)
+
+	page = listDocuments(t, h, "alice", "?role=viewer")
+	require.Empty(t, page.Documents)
+}
+
+func TestListDocuments_InvalidQuery(t *testing.T) {
+	t.Parallel()
+
+	h := newListingServer(storage.NewMemoryStore(), acl.NewMemoryStore())
+
+	for _, query := range []string{"?limit=0", "?limit=x", "?cursor=!!", "?role=admin", "?starred=x", "?archived=x"} {
+		rec := serveAs(h, "alice", http.MethodGet, "/v1/documents"+query, "")
+		require.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+
+	rec := serveAs(h, "alice", http.MethodPut, "/v1/documents", "")
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestListDocuments_StoreError(t *testing.T) {
+	t.Parallel()
+
+	store := failingMetadataStore{MemoryStore: storage.NewMemoryStore()}
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("a", "alice", acl.Owner))
+
+	rec := serveAs(newListingServer(store, permStore), "alice", http.MethodGet, "/v1/documents", "")
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+}
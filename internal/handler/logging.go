@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/serroba/online-docs/internal/logging"
+)
+
+const headerRequestID = "X-Request-Id"
+
+// maxRequestIDLength bounds client-supplied request IDs.
+const maxRequestIDLength = 128
+
+// requestIDMiddleware propagates the caller's X-Request-Id or generates one.
+// The ID is echoed in the response and attached to the request context.
+func (s *Server) requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(headerRequestID)
+		if !validRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+
+		w.Header().Set(headerRequestID, requestID)
+		next.ServeHTTP(w, r.WithContext(withRequestID(r.Context(), requestID)))
+	})
+}
+
+// validRequestID reports whether a client-supplied ID is safe to log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+// accessLogMiddleware writes one log line per request once it completes.
+// WebSocket connections are logged when they close.
+func (s *Server) accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &accessEntry{}
+		rec := &statusRecorder{ResponseWriter: w}
+
+		req := r.WithContext(withAccessEntry(r.Context(), entry))
+		next.ServeHTTP(rec, req)
+
+		// The mux records the matched path values on req
+		s.logger.InfoContext(r.Context(), "access",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.statusCode(),
+			"bytes", rec.bytes,
+			"duration", time.Since(start),
+			logging.UserID(entry.userID),
+			logging.DocID(requestDocID(req)),
+		)
+	})
+}
+
+// requestDocID returns the document a request targets, if any.
+func requestDocID(r *http.Request) string {
+	if r.URL.Path == webSocketPath {
+		return r.URL.Query().Get("docId")
+	}
+
+	return r.PathValue("docID")
+}
+
+// accessEntry collects request details that are only known to inner handlers.
+type accessEntry struct {
+	userID string
+}
+
+// statusRecorder captures the status code and size of a response.
+// It implements http.Hijacker so WebSocket upgrades keep working.
+type statusRecorder struct {
+	http.ResponseWriter
+
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+
+	return n, err
+}
+
+// Hijack hands the connection over to the caller, as for a WebSocket upgrade.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		r.status = http.StatusSwitchingProtocols
+	}
+
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *statusRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+
+	return r.status
+}
@@ -0,0 +1,186 @@
+package handler_test
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use by a logger.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+func newLoggingServer(t *testing.T) (http.Handler, *syncBuffer) {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	hub := ws.NewHub()
+	logs := &syncBuffer{}
+
+	logger, err := logging.New(logs, logging.FormatText, slog.LevelInfo)
+	require.NoError(t, err)
+
+	server := handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub}),
+		Store:   store,
+		Hub:     hub,
+		Logger:  logger,
+	})
+
+	return server.Handler(), logs
+}
+
+func TestRequestID(t *testing.T) {
+	t.Parallel()
+
+	h, _ := newLoggingServer(t)
+
+	t.Run("generates an ID when missing", func(t *testing.T) {
+		t.Parallel()
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/openapi.json", nil))
+
+		if rec.Header().Get("X-Request-Id") == "" {
+			t.Error("expected generated X-Request-Id")
+		}
+	})
+
+	t.Run("propagates the caller's ID", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/openapi.json", nil)
+		req.Header.Set("X-Request-Id", "abc-123")
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("X-Request-Id"); got != "abc-123" {
+			t.Errorf("expected abc-123, got %q", got)
+		}
+	})
+
+	t.Run("replaces invalid IDs", func(t *testing.T) {
+		t.Parallel()
+
+		for _, id := range []string{"has space", strings.Repeat("x", 129)} {
+			req := httptest.NewRequest(http.MethodGet, "/v1/openapi.json", nil)
+			req.Header.Set("X-Request-Id", id)
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("X-Request-Id"); got == id || got == "" {
+				t.Errorf("expected a generated ID instead of %q, got %q", id, got)
+			}
+		}
+	})
+}
+
+func TestRequestIDFromContext(t *testing.T) {
+	t.Parallel()
+
+	if id := handler.RequestIDFromContext(t.Context()); id != "" {
+		t.Errorf("expected empty request ID, got %q", id)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	t.Parallel()
+
+	h, logs := newLoggingServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/documents/doc1", nil)
+	req.Header.Set("X-User-Id", "alice")
+	req.Header.Set("X-Request-Id", "req-1")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	line := logs.String()
+	for _, want := range []string{"msg=access", "component=http", "request_id=req-1", "method=GET",
+		"path=/v1/documents/doc1", "status=200", "user_id=alice", "doc_id=doc1", "duration="} {
+		if !strings.Contains(line, want) {
+			t.Errorf("access log %q is missing %q", line, want)
+		}
+	}
+}
+
+func TestAccessLog_RecordsErrorStatus(t *testing.T) {
+	t.Parallel()
+
+	h, logs := newLoggingServer(t)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/documents/doc1", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	if !strings.Contains(logs.String(), "status=401") {
+		t.Errorf("expected status=401 in %q", logs.String())
+	}
+}
+
+func TestAccessLog_WebSocket(t *testing.T) {
+	t.Parallel()
+
+	h, logs := newLoggingServer(t)
+
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/ws?docId=doc1"
+	header := http.Header{"X-User-Id": {"alice"}, "X-Request-Id": {"ws-1"}}
+
+	conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+	require.NoError(t, err)
+
+	_ = resp.Body.Close()
+
+	if got := resp.Header.Get("X-Request-Id"); got != "ws-1" {
+		t.Errorf("expected request ID in upgrade response, got %q", got)
+	}
+
+	require.NoError(t, conn.Close())
+
+	require.Eventually(t, func() bool {
+		return strings.Contains(logs.String(), "status=101")
+	}, time.Second, 10*time.Millisecond)
+
+	for _, want := range []string{`msg="websocket connected"`, "doc_id=doc1", "user_id=alice", "request_id=ws-1"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs %q are missing %q", logs.String(), want)
+		}
+	}
+}
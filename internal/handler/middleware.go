@@ -1,16 +1,66 @@
 package handler
 
-import "net/http"
+import (
+	"net/http"
+	"strings"
 
-const headerUserID = "X-User-Id"
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apikey"
+	"github.com/serroba/online-docs/internal/bot"
+)
 
-// authMiddleware extracts the user ID from the X-User-ID header
-// and adds it to the request context.
+const (
+	headerUserID = "X-User-Id"
+	headerAPIKey = "X-Api-Key"
+)
+
+// authMiddleware authenticates the request and adds the user ID to the context.
+// Service accounts authenticate with the X-Api-Key header; holders of a share
+// link with its token in the query; human users with an access token, a JWT
+// from the identity provider, a login session cookie or, when neither OIDC nor
+// JWTs are configured, the X-User-ID header.
 func (s *Server) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if secret := r.Header.Get(headerAPIKey); secret != "" && s.apiKeys != nil {
+			s.authenticateAPIKey(w, r, secret, next)
+
+			return
+		}
+
+		if token := r.URL.Query().Get(linkTokenParam); token != "" && s.shareLinks != nil {
+			s.authenticateLink(w, r, token, next)
+
+			return
+		}
+
+		if token, ok := s.bearerToken(r); ok {
+			s.authenticateToken(w, r, token, next)
+
+			return
+		}
+
+		if userID, ok := s.sessionUserID(r); ok {
+			next.ServeHTTP(w, r.WithContext(withUserID(r.Context(), userID)))
+
+			return
+		}
+
+		// Without a gateway in front, the header can't be trusted
+		if s.oidc != nil || s.jwt != nil {
+			writeError(w, http.StatusUnauthorized, "login required")
+
+			return
+		}
+
 		userID := r.Header.Get(headerUserID)
 		if userID == "" {
-			http.Error(w, "missing X-User-ID header", http.StatusUnauthorized)
+			writeError(w, http.StatusUnauthorized, "missing X-User-ID header")
+
+			return
+		}
+
+		if msg, reserved := reservedPrincipal(userID); reserved {
+			writeError(w, http.StatusUnauthorized, msg)
 
 			return
 		}
@@ -19,3 +69,66 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// reservedPrincipal reports whether a user ID claimed by the caller belongs
+// to a principal that authenticates some other way, and why it's refused.
+func reservedPrincipal(userID string) (string, bool) {
+	switch {
+	case strings.HasPrefix(userID, apikey.PrincipalPrefix):
+		// Service identities may only be assumed with a valid API key
+		return "service accounts must authenticate with an API key", true
+	case strings.HasPrefix(userID, acl.LinkPrincipalPrefix):
+		// Link principals may only be assumed with the link's token
+		return "share links must authenticate with their token", true
+	case strings.HasPrefix(userID, bot.PrincipalPrefix):
+		// Bots only edit through the bots API, on behalf of their owner
+		return "bots cannot authenticate", true
+	case strings.HasPrefix(userID, acl.GroupPrincipalPrefix):
+		// Group grants apply to members, never to a caller naming the group
+		return "groups cannot authenticate", true
+	default:
+		return "", false
+	}
+}
+
+// authenticateAPIKey resolves an API key secret and checks its scopes
+// against the action implied by the request method.
+func (s *Server) authenticateAPIKey(w http.ResponseWriter, r *http.Request, secret string, next http.Handler) {
+	key, err := s.apiKeys.Authenticate(secret)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "invalid API key")
+
+		return
+	}
+
+	action := actionForRequest(r)
+	if !key.Allows(action) {
+		writeError(w, http.StatusForbidden, "API key scope does not permit "+action.String())
+
+		return
+	}
+
+	ctx := withAPIKey(withUserID(r.Context(), key.Principal()), key)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// actionForRequest maps a request to the ACL action it performs.
+// GraphQL requests only need read access here; mutations check their
+// own scopes. Batch deletes are POSTs but need the delete scope.
+func actionForRequest(r *http.Request) acl.Action {
+	switch r.URL.Path {
+	case graphQLPath:
+		return acl.ActionRead
+	case batchDeletePath:
+		return acl.ActionDelete
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return acl.ActionRead
+	case http.MethodDelete:
+		return acl.ActionDelete
+	default:
+		return acl.ActionWrite
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/serroba/online-docs/internal/acl"
 	"github.com/serroba/online-docs/internal/collab"
 	"github.com/serroba/online-docs/internal/handler"
 	"github.com/serroba/online-docs/internal/storage"
@@ -32,7 +33,7 @@ func TestAuthMiddleware(t *testing.T) {
 	t.Run("returns 401 when X-User-Id header is missing", func(t *testing.T) {
 		t.Parallel()
 
-		req := httptest.NewRequest(http.MethodPost, "/documents", nil)
+		req := httptest.NewRequest(http.MethodPost, "/v1/documents", nil)
 		rec := httptest.NewRecorder()
 
 		handler.ServeHTTP(rec, req)
@@ -45,7 +46,7 @@ func TestAuthMiddleware(t *testing.T) {
 	t.Run("passes request when X-User-Id header is present", func(t *testing.T) {
 		t.Parallel()
 
-		req := httptest.NewRequest(http.MethodGet, "/documents/nonexistent", nil)
+		req := httptest.NewRequest(http.MethodGet, "/v1/documents/nonexistent", nil)
 		req.Header.Set("X-User-Id", "user123")
 
 		rec := httptest.NewRecorder()
@@ -57,4 +58,19 @@ func TestAuthMiddleware(t *testing.T) {
 			t.Errorf("expected status 404, got %d", rec.Code)
 		}
 	})
+
+	t.Run("returns 401 when X-User-Id names a group", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/documents/nonexistent", nil)
+		req.Header.Set("X-User-Id", acl.GroupPrincipal("g1"))
+
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected status 401, got %d", rec.Code)
+		}
+	})
 }
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/serroba/online-docs/internal/export"
+)
+
+// formatJSON marks the default JSON envelope in content negotiation.
+const formatJSON export.Format = ""
+
+// acceptedFormats maps media ranges to the document representation served for them.
+var acceptedFormats = map[string]export.Format{
+	"application/json": formatJSON,
+	"application/*":    formatJSON,
+	"*/*":              formatJSON,
+	"text/plain":       export.FormatText,
+	"text/markdown":    export.FormatMarkdown,
+	"text/*":           export.FormatText,
+}
+
+// negotiateFormat picks the document representation for the Accept header.
+// It returns formatJSON unless the client prefers raw text or Markdown; the
+// highest quality wins and ties go to the earlier entry.
+func negotiateFormat(r *http.Request) export.Format {
+	best := formatJSON
+	bestQ := 0.0
+
+	for entry := range strings.SplitSeq(headerList(r, "Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(entry))
+		if err != nil {
+			continue
+		}
+
+		format, ok := acceptedFormats[mediaType]
+		if !ok {
+			continue
+		}
+
+		q := 1.0
+		if raw, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(raw, 64); err != nil {
+				continue
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+
+	return best
+}
@@ -0,0 +1,92 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleGetDocument_ContentNegotiation(t *testing.T) {
+	t.Parallel()
+
+	h, _ := newETagServer(t)
+
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+		body        string
+	}{
+		{name: "defaults to JSON", contentType: "application/json"},
+		{name: "any type returns JSON", accept: "*/*", contentType: "application/json"},
+		{name: "plain text", accept: "text/plain", contentType: "text/plain; charset=utf-8", body: "abc"},
+		{name: "markdown", accept: "text/markdown", contentType: "text/markdown; charset=utf-8", body: "abc"},
+		{name: "text wildcard", accept: "text/*", contentType: "text/plain; charset=utf-8", body: "abc"},
+		{
+			name:        "highest quality wins",
+			accept:      "application/json;q=0.5, text/markdown;q=0.9",
+			contentType: "text/markdown; charset=utf-8",
+			body:        "abc",
+		},
+		{
+			name:        "earlier entry wins a tie",
+			accept:      "text/plain, application/json",
+			contentType: "text/plain; charset=utf-8",
+			body:        "abc",
+		},
+		{name: "zero quality is not acceptable", accept: "text/plain;q=0", contentType: "application/json"},
+		{name: "unsupported type falls back to JSON", accept: "image/png", contentType: "application/json"},
+		{name: "malformed entries are skipped", accept: "text/plain;q=x, ;;", contentType: "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/documents/doc1", nil)
+			req.Header.Set("X-User-Id", "viewer")
+
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", rec.Code)
+			}
+
+			if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("expected Content-Type %q, got %q", tt.contentType, got)
+			}
+
+			if got := rec.Header().Get("Vary"); got != "Accept" {
+				t.Errorf("expected Vary Accept, got %q", got)
+			}
+
+			if tt.body != "" && rec.Body.String() != tt.body {
+				t.Errorf("expected body %q, got %q", tt.body, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("errors stay JSON", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/documents/doc1?revision=9", nil)
+		req.Header.Set("X-User-Id", "viewer")
+		req.Header.Set("Accept", "text/plain")
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rec.Code)
+		}
+
+		if got := rec.Header().Get("Content-Type"); got != "application/json" {
+			t.Errorf("expected Content-Type application/json, got %q", got)
+		}
+	})
+}
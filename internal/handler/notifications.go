@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/preferences"
+)
+
+// handleNotifications handles GET and PUT /v1/notifications, the caller's
+// notification settings.
+func (s *Server) handleNotifications(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
+
+	switch r.Method {
+	case http.MethodGet:
+		settings, err := s.preferences.Notifications(userID)
+		if err != nil {
+			s.logger.ErrorContext(r.Context(), "failed to load notification settings",
+				logging.UserID(userID), logging.Err(err))
+			writeError(w, http.StatusInternalServerError, "internal server error")
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, apitypes.NotificationSettings(settings))
+	case http.MethodPut:
+		var req apitypes.NotificationSettings
+		if !s.decodeJSON(w, r, &req) {
+			return
+		}
+
+		if err := req.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+
+			return
+		}
+
+		if err := s.preferences.SetNotifications(userID, preferences.Notifications(req)); err != nil {
+			s.logger.ErrorContext(r.Context(), "failed to save notification settings",
+				logging.UserID(userID), logging.Err(err))
+			writeError(w, http.StatusInternalServerError, "internal server error")
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, req)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
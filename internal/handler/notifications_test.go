@@ -0,0 +1,57 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/preferences"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleNotifications(t *testing.T) {
+	t.Parallel()
+
+	prefs := preferences.NewMemoryStore()
+	h := newStarServer(storage.NewMemoryStore(), acl.NewMemoryStore(), prefs)
+
+	get := func(userID string) apitypes.NotificationSettings {
+		rec := serveAs(h, userID, http.MethodGet, "/v1/notifications", "")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var settings apitypes.NotificationSettings
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&settings))
+
+		return settings
+	}
+
+	require.Equal(t, apitypes.NotificationSettings{}, get("alice"))
+
+	rec := serveAs(h, "alice", http.MethodPut, "/v1/notifications", `{"email": "alice@example.com", "shares": true}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	want := apitypes.NotificationSettings{Email: "alice@example.com", Shares: true}
+	require.Equal(t, want, get("alice"))
+	require.Equal(t, apitypes.NotificationSettings{}, get("bob"))
+
+	stored, err := prefs.Notifications("alice")
+	require.NoError(t, err)
+	require.Equal(t, preferences.Notifications{Email: "alice@example.com", Shares: true}, stored)
+
+	rec = serveAs(h, "alice", http.MethodPut, "/v1/notifications", `{"email": "not an address"}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Equal(t, want, get("alice"))
+
+	rec = serveAs(h, "alice", http.MethodPut, "/v1/notifications", "")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serveAs(h, "alice", http.MethodDelete, "/v1/notifications", "")
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = serveAs(newStarServer(storage.NewMemoryStore(), acl.NewMemoryStore(), failingPreferencesStore{}),
+		"alice", http.MethodGet, "/v1/notifications", "")
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+}
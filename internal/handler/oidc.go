@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/serroba/online-docs/internal/auth"
+)
+
+const (
+	sessionCookie   = "docs_session"
+	oidcStateCookie = "docs_oidc_state"
+)
+
+// oidcStateMaxAge bounds how long a login may take at the provider.
+const oidcStateMaxAge = 10 * 60
+
+// handleOIDCLogin handles GET /auth/oidc/login.
+// It redirects the browser to the provider with a fresh state and nonce.
+func (s *Server) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	state, err := auth.RandomToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	nonce, err := auth.RandomToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state + "." + nonce,
+		Path:     "/auth/oidc",
+		MaxAge:   oidcStateMaxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, s.oidc.AuthCodeURL(state, nonce), http.StatusFound)
+}
+
+// handleOIDCCallback handles GET /auth/oidc/callback.
+// It exchanges the code, starts a session, and sets the session cookie.
+func (s *Server) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "missing login state")
+
+		return
+	}
+
+	state, nonce, _ := strings.Cut(cookie.Value, ".")
+	if state == "" || r.URL.Query().Get("state") != state {
+		writeError(w, http.StatusBadRequest, "login state mismatch")
+
+		return
+	}
+
+	// The state cookie is single-use
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/auth/oidc", MaxAge: -1})
+
+	identity, err := s.oidc.Exchange(r.Context(), r.URL.Query().Get("code"), nonce)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "login failed")
+
+		return
+	}
+
+	session, err := s.sessions.Create(identity.UserID())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    session.ID,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// handleLogout handles POST /auth/logout.
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		_ = s.sessions.Revoke(cookie.Value)
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sessionUserID returns the user of a valid session cookie, if any.
+func (s *Server) sessionUserID(r *http.Request) (string, bool) {
+	if s.sessions == nil {
+		return "", false
+	}
+
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", false
+	}
+
+	session, err := s.sessions.Resolve(cookie.Value)
+	if err != nil {
+		return "", false
+	}
+
+	return session.UserID, true
+}
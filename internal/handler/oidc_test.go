@@ -0,0 +1,292 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/auth"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/oidc"
+	"github.com/serroba/online-docs/internal/oidc/oidctest"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// oidcTestEnv wires a server with OpenID Connect login enabled.
+type oidcTestEnv struct {
+	provider *oidctest.Server
+	sessions *auth.SessionManager
+	handler  http.Handler
+}
+
+func newOIDCTestEnv(t *testing.T) *oidcTestEnv {
+	t.Helper()
+
+	provider, err := oidctest.NewServer()
+	require.NoError(t, err)
+	t.Cleanup(provider.Close)
+
+	client, err := oidc.Discover(context.Background(), oidc.Config{
+		IssuerURL:   provider.URL,
+		ClientID:    oidctest.ClientID,
+		RedirectURL: "http://docs.example/auth/oidc/callback",
+	})
+	require.NoError(t, err)
+
+	store := storage.NewMemoryStore()
+	permStore := acl.NewMemoryStore()
+	hub := ws.NewHub()
+	sessions := auth.NewSessionManager(auth.NewMemorySessionStore(), auth.DefaultSessionTTL)
+
+	manager := collab.NewManager(collab.ManagerConfig{
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+	})
+
+	server := handler.NewServer(handler.ServerConfig{
+		Manager:   manager,
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+		OIDC:      client,
+		Sessions:  sessions,
+	})
+
+	return &oidcTestEnv{
+		provider: provider,
+		sessions: sessions,
+		handler:  server.Handler(),
+	}
+}
+
+func (e *oidcTestEnv) serve(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	e.handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// login runs the full login flow and returns the session cookie.
+func (e *oidcTestEnv) login(t *testing.T, subject string) *http.Cookie {
+	t.Helper()
+
+	rec := e.serve(httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil))
+	require.Equal(t, http.StatusFound, rec.Code)
+
+	location, err := url.Parse(rec.Header().Get("Location"))
+	require.NoError(t, err)
+
+	stateCookie := findCookie(rec.Result().Cookies(), "docs_oidc_state")
+	require.NotNil(t, stateCookie)
+
+	code := e.provider.IssueCode(subject, location.Query().Get("nonce"))
+	callback := "/auth/oidc/callback?code=" + code + "&state=" + location.Query().Get("state")
+
+	req := httptest.NewRequest(http.MethodGet, callback, nil)
+	req.AddCookie(stateCookie)
+
+	rec = e.serve(req)
+	require.Equal(t, http.StatusFound, rec.Code)
+
+	session := findCookie(rec.Result().Cookies(), "docs_session")
+	require.NotNil(t, session)
+
+	return session
+}
+
+func findCookie(cookies []*http.Cookie, name string) *http.Cookie {
+	for _, c := range cookies {
+		if c.Name == name && c.MaxAge >= 0 {
+			return c
+		}
+	}
+
+	return nil
+}
+
+func TestOIDC_LoginRedirectsToProvider(t *testing.T) {
+	t.Parallel()
+
+	env := newOIDCTestEnv(t)
+
+	rec := env.serve(httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil))
+	require.Equal(t, http.StatusFound, rec.Code)
+
+	location := rec.Header().Get("Location")
+	if !strings.HasPrefix(location, env.provider.URL) {
+		t.Errorf("expected redirect to provider, got %s", location)
+	}
+
+	cookie := findCookie(rec.Result().Cookies(), "docs_oidc_state")
+	require.NotNil(t, cookie)
+
+	if !cookie.HttpOnly {
+		t.Error("expected state cookie to be HttpOnly")
+	}
+}
+
+func TestOIDC_LoginCreatesSession(t *testing.T) {
+	t.Parallel()
+
+	env := newOIDCTestEnv(t)
+	session := env.login(t, "alice")
+
+	if !session.HttpOnly {
+		t.Error("expected session cookie to be HttpOnly")
+	}
+
+	// The session authenticates API requests as the OIDC subject
+	body := strings.NewReader(`{"id":"doc1"}`)
+	req := httptest.NewRequest(http.MethodPost, "/v1/documents", body)
+	req.AddCookie(session)
+
+	rec := env.serve(req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/documents/doc1", nil)
+	req.AddCookie(session)
+
+	rec = env.serve(req)
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestOIDC_IgnoresUserIDHeader(t *testing.T) {
+	t.Parallel()
+
+	env := newOIDCTestEnv(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/documents/doc1", nil)
+	req.Header.Set("X-User-Id", "alice")
+
+	rec := env.serve(req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d", rec.Code)
+	}
+}
+
+func TestOIDC_InvalidSessionCookie(t *testing.T) {
+	t.Parallel()
+
+	env := newOIDCTestEnv(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/documents/doc1", nil)
+	req.AddCookie(&http.Cookie{Name: "docs_session", Value: "bogus"})
+
+	rec := env.serve(req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d", rec.Code)
+	}
+}
+
+func TestOIDC_CallbackErrors(t *testing.T) {
+	t.Parallel()
+
+	env := newOIDCTestEnv(t)
+
+	tests := []struct {
+		name   string
+		query  string
+		cookie *http.Cookie
+		want   int
+	}{
+		{name: "missing state cookie", query: "?code=x&state=s", want: http.StatusBadRequest},
+		{
+			name:   "state mismatch",
+			query:  "?code=x&state=other",
+			cookie: &http.Cookie{Name: "docs_oidc_state", Value: "s.n"},
+			want:   http.StatusBadRequest,
+		},
+		{
+			name:   "invalid code",
+			query:  "?code=unknown&state=s",
+			cookie: &http.Cookie{Name: "docs_oidc_state", Value: "s.n"},
+			want:   http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback"+tt.query, nil)
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+
+			rec := env.serve(req)
+			if rec.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestOIDC_CallbackNonceMismatch(t *testing.T) {
+	t.Parallel()
+
+	env := newOIDCTestEnv(t)
+	code := env.provider.IssueCode("alice", "other-nonce")
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?code="+code+"&state=s", nil)
+	req.AddCookie(&http.Cookie{Name: "docs_oidc_state", Value: "s.n"})
+
+	rec := env.serve(req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d", rec.Code)
+	}
+}
+
+func TestOIDC_Logout(t *testing.T) {
+	t.Parallel()
+
+	env := newOIDCTestEnv(t)
+	session := env.login(t, "alice")
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.AddCookie(session)
+
+	rec := env.serve(req)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	if _, err := env.sessions.Resolve(session.Value); err == nil {
+		t.Error("expected session to be revoked")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/documents/doc1", nil)
+	req.AddCookie(session)
+
+	rec = env.serve(req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401 after logout, got %d", rec.Code)
+	}
+}
+
+func TestOIDC_MethodNotAllowed(t *testing.T) {
+	t.Parallel()
+
+	env := newOIDCTestEnv(t)
+
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/auth/oidc/login"},
+		{http.MethodPost, "/auth/oidc/callback"},
+		{http.MethodGet, "/auth/logout"},
+	}
+
+	for _, tt := range tests {
+		rec := env.serve(httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s: expected status 405, got %d", tt.method, tt.path, rec.Code)
+		}
+	}
+}
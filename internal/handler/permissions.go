@@ -0,0 +1,265 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+)
+
+// errLastOwner is returned when a change would leave a document without an owner.
+var errLastOwner = errors.New("document must keep an owner")
+
+// handlePermissions routes GET and POST requests for
+// /v1/documents/{id}/permissions.
+func (s *Server) handlePermissions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.handleListPermissions(w, r)
+	case http.MethodPost:
+		s.handleGrantPermission(w, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleListPermissions handles GET /v1/documents/{id}/permissions.
+// Anyone who can read the document can see who else has access.
+func (s *Server) handleListPermissions(w http.ResponseWriter, r *http.Request) {
+	docID := r.PathValue("docID")
+
+	if err := s.requireDocument(r.Context(), docID, UserIDFromContext(r.Context()), acl.ActionRead); err != nil {
+		s.writePermissionsError(w, r, err)
+
+		return
+	}
+
+	s.writePermissions(w, r, docID)
+}
+
+// handleGrantPermission handles POST /v1/documents/{id}/permissions.
+// It shares the document with the user named in the body, like PUT on the
+// user's permission.
+func (s *Server) handleGrantPermission(w http.ResponseWriter, r *http.Request) {
+	docID := r.PathValue("docID")
+
+	if err := s.requireDocument(r.Context(), docID, UserIDFromContext(r.Context()), acl.ActionShare); err != nil {
+		s.writePermissionsError(w, r, err)
+
+		return
+	}
+
+	var req apitypes.GrantPermissionRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if req.UserID == "" {
+		writeError(w, http.StatusBadRequest, "userId: must not be empty")
+
+		return
+	}
+
+	s.setPermission(w, r, docID, req.UserID, req.Role)
+}
+
+// handlePermission handles PUT and DELETE /v1/documents/{id}/permissions/{userId}.
+// Granting and revoking roles needs the share permission, which only owners have.
+func (s *Server) handlePermission(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	docID := r.PathValue("docID")
+	userID := r.PathValue("userID")
+
+	if err := s.requireDocument(r.Context(), docID, UserIDFromContext(r.Context()), acl.ActionShare); err != nil {
+		s.writePermissionsError(w, r, err)
+
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := s.revokePermission(docID, userID); err != nil {
+			s.writePermissionsError(w, r, err)
+
+			return
+		}
+
+		s.announcePermission(docID, userID, "")
+		w.WriteHeader(http.StatusNoContent)
+
+		return
+	}
+
+	var req apitypes.SetPermissionRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	s.setPermission(w, r, docID, userID, req.Role)
+}
+
+// setPermission grants the user the named role and writes the document's
+// permissions.
+func (s *Server) setPermission(w http.ResponseWriter, r *http.Request, docID, userID, roleName string) {
+	role, err := acl.ParseRole(roleName)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "role: must be viewer, editor or owner")
+
+		return
+	}
+
+	if err := s.requireGroup(userID); err != nil {
+		s.writePermissionsError(w, r, err)
+
+		return
+	}
+
+	if err := s.grantPermission(docID, userID, role); err != nil {
+		s.writePermissionsError(w, r, err)
+
+		return
+	}
+
+	s.announcePermission(docID, userID, role.String())
+	s.writePermissions(w, r, docID)
+}
+
+// requireGroup returns acl.ErrGroupNotFound if the user ID is the principal
+// of a group that doesn't exist.
+func (s *Server) requireGroup(userID string) error {
+	groupID, ok := strings.CutPrefix(userID, acl.GroupPrincipalPrefix)
+	if !ok || s.groups == nil {
+		return nil
+	}
+
+	exists, err := s.groups.Exists(groupID)
+	if err == nil && !exists {
+		err = acl.ErrGroupNotFound
+	}
+
+	return err
+}
+
+// announcePermission tells the document's WebSocket clients that the user's
+// role changed; an empty role means it was revoked. The user's own clients
+// find out without waiting for an edit to be refused.
+func (s *Server) announcePermission(docID, userID, role string) {
+	if s.hub == nil {
+		return
+	}
+
+	s.hub.Broadcast(docID, ws.Message{
+		Type:    ws.MessageTypePermissionChanged,
+		Payload: ws.PermissionChangedPayload{DocID: docID, UserID: userID, Role: role},
+	}, "")
+}
+
+// grantPermission gives the user a role, refusing to demote the last owner.
+func (s *Server) grantPermission(docID, userID string, role acl.Role) error {
+	if role != acl.Owner {
+		if err := s.requireOtherOwner(docID, userID); err != nil {
+			return err
+		}
+	}
+
+	return s.permStore.Grant(docID, userID, role)
+}
+
+// revokePermission removes the user's role, refusing to remove the last owner.
+func (s *Server) revokePermission(docID, userID string) error {
+	if err := s.requireOtherOwner(docID, userID); err != nil {
+		return err
+	}
+
+	return s.permStore.Revoke(docID, userID)
+}
+
+// requireOtherOwner returns errLastOwner if the user is the document's only
+// owner. Groups don't count, as they may have no members.
+func (s *Server) requireOtherOwner(docID, userID string) error {
+	perms, err := s.permStore.ListPermissions(docID)
+	if err != nil {
+		return err
+	}
+
+	isOwner, others := false, 0
+
+	for _, perm := range perms {
+		if perm.Role != acl.Owner || strings.HasPrefix(perm.UserID, acl.GroupPrincipalPrefix) {
+			continue
+		}
+
+		if perm.UserID == userID {
+			isOwner = true
+		} else {
+			others++
+		}
+	}
+
+	if isOwner && others == 0 {
+		return errLastOwner
+	}
+
+	return nil
+}
+
+// writePermissions writes the document's permissions, sorted by user ID.
+func (s *Server) writePermissions(w http.ResponseWriter, r *http.Request, docID string) {
+	shares, err := s.documentShares(docID)
+	if err != nil {
+		s.writePermissionsError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apitypes.PermissionsResponse{ID: docID, Permissions: shares})
+}
+
+// documentShares lists the document's permissions in their API representation.
+func (s *Server) documentShares(docID string) ([]apitypes.DocumentShare, error) {
+	perms, err := s.permStore.ListPermissions(docID)
+	if err != nil {
+		return nil, err
+	}
+
+	shares := make([]apitypes.DocumentShare, 0, len(perms))
+	for _, perm := range perms {
+		shares = append(shares, apitypes.DocumentShare{UserID: perm.UserID, Role: perm.Role.String()})
+	}
+
+	slices.SortFunc(shares, func(a, b apitypes.DocumentShare) int {
+		return strings.Compare(a.UserID, b.UserID)
+	})
+
+	return shares, nil
+}
+
+// writePermissionsError maps a permission or storage error to a response.
+func (s *Server) writePermissionsError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, acl.ErrAccessDenied):
+		writeError(w, http.StatusForbidden, "access denied")
+	case errors.Is(err, acl.ErrPermissionNotFound):
+		writeError(w, http.StatusNotFound, "permission not found")
+	case errors.Is(err, storage.ErrDocumentNotFound):
+		writeError(w, http.StatusNotFound, "document not found")
+	case errors.Is(err, errLastOwner):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, acl.ErrGroupNotFound):
+		writeError(w, http.StatusNotFound, "group not found")
+	default:
+		s.logger.ErrorContext(r.Context(), "permissions request failed",
+			logging.DocID(r.PathValue("docID")), logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
@@ -0,0 +1,174 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// newPermissionsServer returns a handler for doc1, owned by alice with bob as an editor.
+func newPermissionsServer(t *testing.T, permStore acl.Store) http.Handler {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Owner))
+	require.NoError(t, permStore.Grant("doc1", "bob", acl.Editor))
+
+	return handler.NewServer(handler.ServerConfig{
+		Manager:   collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore}),
+		Store:     store,
+		PermStore: permStore,
+	}).Handler()
+}
+
+func TestHandlePermissions(t *testing.T) {
+	t.Parallel()
+
+	h := newPermissionsServer(t, acl.NewMemoryStore())
+
+	rec := serveAs(h, "bob", http.MethodGet, "/v1/documents/doc1/permissions", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.JSONEq(t, `{"id": "doc1", "permissions": [
+		{"userId": "alice", "role": "owner"},
+		{"userId": "bob", "role": "editor"}
+	]}`, rec.Body.String())
+
+	rec = serveAs(h, "alice", http.MethodPut, "/v1/documents/doc1/permissions/carol", `{"role": "viewer"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.JSONEq(t, `{"id": "doc1", "permissions": [
+		{"userId": "alice", "role": "owner"},
+		{"userId": "bob", "role": "editor"},
+		{"userId": "carol", "role": "viewer"}
+	]}`, rec.Body.String())
+
+	rec = serveAs(h, "alice", http.MethodPost, "/v1/documents/doc1/permissions", `{"userId": "dave", "role": "editor"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.JSONEq(t, `{"id": "doc1", "permissions": [
+		{"userId": "alice", "role": "owner"},
+		{"userId": "bob", "role": "editor"},
+		{"userId": "carol", "role": "viewer"},
+		{"userId": "dave", "role": "editor"}
+	]}`, rec.Body.String())
+
+	rec = serveAs(h, "alice", http.MethodDelete, "/v1/documents/doc1/permissions/bob", "")
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+	rec = serveAs(h, "bob", http.MethodGet, "/v1/documents/doc1/permissions", "")
+	require.Equal(t, http.StatusForbidden, rec.Code, "revoked users lose access")
+
+	// Alice can step down once someone else owns the document
+	rec = serveAs(h, "alice", http.MethodPut, "/v1/documents/doc1/permissions/carol", `{"role": "owner"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = serveAs(h, "alice", http.MethodPut, "/v1/documents/doc1/permissions/alice", `{"role": "editor"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.JSONEq(t, `{"id": "doc1", "permissions": [
+		{"userId": "alice", "role": "editor"},
+		{"userId": "carol", "role": "owner"},
+		{"userId": "dave", "role": "editor"}
+	]}`, rec.Body.String())
+}
+
+func TestHandlePermissions_Announce(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Owner))
+	require.NoError(t, permStore.Grant("doc1", "bob", acl.Editor))
+
+	hub := ws.NewHub()
+	h := handler.NewServer(handler.ServerConfig{
+		Manager:   collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore, Hub: hub}),
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+	}).Handler()
+
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/ws?docId=doc1"
+
+	conn, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"X-User-Id": {"bob"}})
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	t.Cleanup(func() { _ = conn.Close() })
+
+	require.Equal(t, ws.MessageTypeState, readEdit(t, conn).Type)
+
+	rec := serveAs(h, "alice", http.MethodPost, "/v1/documents/doc1/permissions", `{"userId": "carol", "role": "viewer"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	msg := readEdit(t, conn)
+	require.Equal(t, ws.MessageTypePermissionChanged, msg.Type)
+	require.Equal(t, map[string]any{"docId": "doc1", "userId": "carol", "role": "viewer"}, msg.Payload)
+
+	// Bob finds out about losing access without an edit being refused
+	rec = serveAs(h, "alice", http.MethodDelete, "/v1/documents/doc1/permissions/bob", "")
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+	msg = readEdit(t, conn)
+	require.Equal(t, ws.MessageTypePermissionChanged, msg.Type)
+	require.Equal(t, map[string]any{"docId": "doc1", "userId": "bob"}, msg.Payload)
+}
+
+func TestHandlePermissions_Errors(t *testing.T) {
+	t.Parallel()
+
+	h := newPermissionsServer(t, acl.NewMemoryStore())
+	brokenACL := newPermissionsServer(t, failingRoleStore{MemoryStore: acl.NewMemoryStore()})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		userID  string
+		method  string
+		target  string
+		body    string
+		status  int
+	}{
+		{"no read access", h, "mallory", http.MethodGet, "/v1/documents/doc1/permissions", "", http.StatusForbidden},
+		{"editors can't share", h, "bob", http.MethodPut, "/v1/documents/doc1/permissions/carol", `{"role": "viewer"}`, 403},
+		{"editors can't revoke", h, "bob", http.MethodDelete, "/v1/documents/doc1/permissions/alice", "", 403},
+		{"invalid role", h, "alice", http.MethodPut, "/v1/documents/doc1/permissions/carol", `{"role": "admin"}`, 400},
+		{"invalid body", h, "alice", http.MethodPut, "/v1/documents/doc1/permissions/carol", `{"role": 1}`, 400},
+		{"revoke unknown user", h, "alice", http.MethodDelete, "/v1/documents/doc1/permissions/carol", "", 404},
+		{"demote last owner", h, "alice", http.MethodPut, "/v1/documents/doc1/permissions/alice", `{"role": "viewer"}`, 409},
+		{"revoke last owner", h, "alice", http.MethodDelete, "/v1/documents/doc1/permissions/alice", "", 409},
+		{
+			"editors can't add", h, "bob", http.MethodPost, "/v1/documents/doc1/permissions",
+			`{"userId": "carol", "role": "viewer"}`, 403,
+		},
+		{"add without user", h, "alice", http.MethodPost, "/v1/documents/doc1/permissions", `{"role": "viewer"}`, 400},
+		{
+			"add invalid role", h, "alice", http.MethodPost, "/v1/documents/doc1/permissions",
+			`{"userId": "carol", "role": "x"}`, 400,
+		},
+		{"list other methods", h, "alice", http.MethodDelete, "/v1/documents/doc1/permissions", "", 405},
+		{"grant other methods", h, "alice", http.MethodGet, "/v1/documents/doc1/permissions/bob", "", 405},
+		{"permission lookup fails", brokenACL, "alice", http.MethodGet, "/v1/documents/doc1/permissions", "", 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if rec := serveAs(tt.handler, tt.userID, tt.method, tt.target, tt.body); rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
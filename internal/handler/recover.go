@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"runtime/debug"
+)
+
+// recoverMiddleware answers requests whose handler panics with 500 instead of
+// letting the panic reach net/http, which would drop the connection without
+// a response. It sits inside the compression and access log, so both see the
+// error response, and still re-raises http.ErrAbortHandler, which handlers use
+// to abort a response on purpose.
+func (s *Server) recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+
+			if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(v)
+			}
+
+			s.logPanic(r.Context(), "handler panicked", v)
+
+			// A response that has started, or a hijacked connection, can't be replaced
+			if rec.status == 0 {
+				writeError(w, http.StatusInternalServerError, "internal server error")
+			}
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// logPanic logs a recovered panic value with the stack that raised it.
+func (s *Server) logPanic(ctx context.Context, msg string, v any, args ...any) {
+	args = append(args, "panic", v, "stack", string(debug.Stack()))
+	s.logger.ErrorContext(ctx, msg, args...)
+}
@@ -0,0 +1,128 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// panickingStore panics instead of reading the tags of documents, or
+// appending operations to them.
+type panickingStore struct {
+	*storage.MemoryStore
+}
+
+func (panickingStore) SetTags(context.Context, string, []string) error {
+	panic("tags are broken")
+}
+
+func (panickingStore) AppendOperations(context.Context, string, []ot.SequencedOperation) error {
+	panic("operations are broken")
+}
+
+func newPanickingServer(t *testing.T) (*httptest.Server, *syncBuffer) {
+	t.Helper()
+
+	store := panickingStore{storage.NewMemoryStore()}
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	hub := ws.NewHub()
+	logs := &syncBuffer{}
+
+	logger, err := logging.New(logs, logging.FormatText, slog.LevelInfo)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub}),
+		Store:   store,
+		Hub:     hub,
+		Logger:  logger,
+	}).Handler())
+	t.Cleanup(server.Close)
+
+	return server, logs
+}
+
+func TestRecover_HTTP(t *testing.T) {
+	t.Parallel()
+
+	server, logs := newPanickingServer(t)
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPut, server.URL+"/v1/documents/doc1/tags",
+		strings.NewReader(`{"tags":["draft"]}`))
+	require.NoError(t, err)
+	req.Header.Set("X-User-Id", "alice")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	var body apitypes.ErrorResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, apitypes.ErrorCodeInternalError, body.Code)
+
+	for _, want := range []string{`msg="handler panicked"`, `panic="tags are broken"`, "stack=", "status=500"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs %q are missing %q", logs.String(), want)
+		}
+	}
+
+	// The server keeps serving
+	resp = get(t, server.URL+"/v1/documents/doc1", http.Header{})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestRecover_WebSocket(t *testing.T) {
+	t.Parallel()
+
+	server, logs := newPanickingServer(t)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/ws?docId=doc1"
+
+	conn, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"X-User-Id": {"alice"}})
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	t.Cleanup(func() { _ = conn.Close() })
+
+	var state ws.Message
+	require.NoError(t, conn.ReadJSON(&state))
+
+	require.NoError(t, conn.WriteJSON(map[string]any{
+		"type":    "operation",
+		"payload": map[string]any{"type": 0, "position": 0, "char": "x", "revision": 0},
+	}))
+
+	// The client is told, then disconnected
+	var msg struct {
+		Type    ws.MessageType  `json:"type"`
+		Payload ws.ErrorPayload `json:"payload"`
+	}
+	require.NoError(t, conn.ReadJSON(&msg))
+	require.Equal(t, ws.MessageTypeError, msg.Type)
+	require.Equal(t, ws.ErrorCodeInternalError, msg.Payload.Code)
+
+	_, _, err = conn.ReadMessage()
+	require.Error(t, err)
+
+	for _, want := range []string{`msg="websocket message handler panicked"`, `panic="operations are broken"`, "stack="} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs %q are missing %q", logs.String(), want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/logging"
+)
+
+// writeJSON writes v as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("failed to encode response", logging.Err(err))
+	}
+}
+
+// writeError writes an ErrorResponse with the code matching the status.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, apitypes.ErrorResponse{
+		Code:    apitypes.ErrorCodeForStatus(status),
+		Message: message,
+	})
+}
@@ -0,0 +1,270 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/logging"
+)
+
+// headerForwardedBy marks a request one node has proxied to a document's
+// owner. Such requests are never proxied again, so nodes that disagree about
+// the ring's members can't pass a request around in circles.
+const headerForwardedBy = "X-Forwarded-By-Node"
+
+// ownerProxies creates a reverse proxy to each of the ring's other nodes.
+func (s *Server) ownerProxies(nodeURL string) map[string]*httputil.ReverseProxy {
+	proxies := make(map[string]*httputil.ReverseProxy)
+
+	for _, node := range s.ring.Nodes() {
+		target, err := url.Parse(node)
+		if err != nil || node == nodeURL {
+			continue
+		}
+
+		proxies[node] = &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.SetURL(target)
+				pr.SetXForwarded()
+				pr.Out.Header.Set(headerForwardedBy, nodeURL)
+				pr.Out.Header.Set(headerRequestID, RequestIDFromContext(pr.In.Context()))
+
+				// Responses are compressed on the way out of this node
+				pr.Out.Header.Del("Accept-Encoding")
+			},
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				s.logger.ErrorContext(r.Context(), "failed to reach document owner", "owner", node, logging.Err(err))
+				writeError(w, http.StatusBadGateway, "document owner unavailable")
+			},
+		}
+	}
+
+	return proxies
+}
+
+// routeToOwner serves requests for documents this node owns and proxies the
+// rest to their owner, so only one node runs a document's session. docID
+// extracts the document from the request.
+func (s *Server) routeToOwner(docID func(*http.Request) string, next http.Handler) http.Handler {
+	if s.ring == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := docID(r)
+		if id == "" {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		// Only other nodes have a proxy
+		owner := s.ring.Owner(id)
+
+		proxy, ok := s.proxies[owner]
+		if !ok {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		if from := r.Header.Get(headerForwardedBy); from != "" {
+			s.logger.WarnContext(r.Context(), "nodes disagree about document owner",
+				logging.DocID(id), "owner", owner, "from", from)
+			writeError(w, http.StatusMisdirectedRequest, "document is owned by another node")
+
+			return
+		}
+
+		proxy.ServeHTTP(w, r)
+	})
+}
+
+// ownedElsewhere reports whether another node of the ring owns the document.
+func (s *Server) ownedElsewhere(docID string) bool {
+	if s.ring == nil {
+		return false
+	}
+
+	// Only other nodes have a proxy
+	_, ok := s.proxies[s.ring.Owner(docID)]
+
+	return ok
+}
+
+// forwardBatch sends the items of a batch request that other nodes own to
+// their owners, one batch per owner, and returns those items' results by
+// index. subset builds the request body holding the items at the indices.
+func (s *Server) forwardBatch(
+	r *http.Request, ids []string, subset func(indices []int) any,
+) map[int]apitypes.BatchResult {
+	byOwner := make(map[string][]int)
+
+	for i, id := range ids {
+		if s.ownedElsewhere(id) {
+			owner := s.ring.Owner(id)
+			byOwner[owner] = append(byOwner[owner], i)
+		}
+	}
+
+	results := make(map[int]apitypes.BatchResult)
+
+	for owner, indices := range byOwner {
+		ownerIDs := make([]string, len(indices))
+		for j, i := range indices {
+			ownerIDs[j] = ids[i]
+		}
+
+		for j, result := range s.forwardItems(r, owner, ownerIDs, subset(indices)) {
+			results[indices[j]] = result
+		}
+	}
+
+	return results
+}
+
+// forwardItems sends one batch to the owner of its documents and returns
+// the result of each. If the owner fails the whole batch, every document
+// reports its error.
+func (s *Server) forwardItems(r *http.Request, owner string, ids []string, body any) []apitypes.BatchResult {
+	if from := r.Header.Get(headerForwardedBy); from != "" {
+		s.logger.WarnContext(r.Context(), "nodes disagree about document owner", "owner", owner, "from", from)
+
+		return failedItems(ids, http.StatusMisdirectedRequest, apitypes.ErrorResponse{
+			Code:    apitypes.ErrorCodeMisdirectedRequest,
+			Message: "document is owned by another node",
+		})
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "failed to encode forwarded batch", logging.Err(err))
+
+		return failedItems(ids, http.StatusInternalServerError, apitypes.ErrorResponse{
+			Code:    apitypes.ErrorCodeInternalError,
+			Message: "internal server error",
+		})
+	}
+
+	out := r.Clone(r.Context())
+	out.Body = io.NopCloser(bytes.NewReader(data))
+	out.ContentLength = int64(len(data))
+	out.TransferEncoding = nil
+
+	// Retries replay the whole batch from this node
+	out.Header.Del(headerIdempotencyKey)
+
+	resp := &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+	s.proxies[owner].ServeHTTP(resp, out)
+
+	// Batch create and delete responses have the same shape
+	var batch apitypes.BatchDeleteResponse
+	if resp.status == http.StatusOK && json.Unmarshal(resp.body.Bytes(), &batch) == nil && len(batch.Results) == len(ids) {
+		return batch.Results
+	}
+
+	status := resp.status
+	if status == http.StatusOK {
+		status = http.StatusBadGateway
+	}
+
+	var failure apitypes.ErrorResponse
+	if json.Unmarshal(resp.body.Bytes(), &failure) != nil || failure.Code == "" {
+		failure = apitypes.ErrorResponse{Code: apitypes.ErrorCodeForStatus(status), Message: "document owner unavailable"}
+	}
+
+	return failedItems(ids, status, failure)
+}
+
+// failedItems reports the same error for each document of a batch.
+func failedItems(ids []string, status int, failure apitypes.ErrorResponse) []apitypes.BatchResult {
+	results := make([]apitypes.BatchResult, len(ids))
+	for i, id := range ids {
+		results[i] = apitypes.BatchResult{ID: id, Status: status, Error: &failure}
+	}
+
+	return results
+}
+
+// bufferedResponse holds a response in memory, so that a batch can merge
+// the responses of the owners it was forwarded to.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	b.status = status
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+// documentRoute authenticates requests to a /v1/documents/{docID} route on
+// the document's owner.
+func (s *Server) documentRoute(h http.HandlerFunc) http.Handler {
+	return s.routeToOwner(pathDocID, s.authMiddleware(h))
+}
+
+// pathDocID returns the document ID of /v1/documents/{docID} routes.
+func pathDocID(r *http.Request) string {
+	return r.PathValue("docID")
+}
+
+// queryDocID returns the document ID of the WebSocket and ShareDB routes.
+func queryDocID(r *http.Request) string {
+	return r.URL.Query().Get("docId")
+}
+
+// importDocID returns the "id" field of a document import. The body is read
+// ahead to find it and put back for the handler, or for the owner.
+func importDocID(r *http.Request) string {
+	if r.Method != http.MethodPost {
+		return ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxImportBytes+multipartOverheadBytes))
+	r.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), r.Body), Closer: r.Body}
+
+	if err != nil {
+		return ""
+	}
+
+	peek := r.Clone(r.Context())
+	peek.Body = io.NopCloser(bytes.NewReader(body))
+
+	form, err := peek.MultipartReader()
+	if err != nil {
+		return ""
+	}
+
+	for {
+		part, err := form.NextPart()
+		if err != nil {
+			return ""
+		}
+
+		if part.FormName() == "id" {
+			id, _ := io.ReadAll(io.LimitReader(part, apitypes.MaxDocumentIDLength))
+
+			return string(id)
+		}
+	}
+}
+
+// readCloser closes a request body that's been partly read ahead.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
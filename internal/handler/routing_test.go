@@ -0,0 +1,319 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/cluster"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// clusterNode is one instance of a routed cluster. All nodes share a store.
+type clusterNode struct {
+	url     string
+	manager *collab.Manager
+	server  *httptest.Server
+}
+
+// newCluster starts a node for each of n listeners, all on the same ring.
+func newCluster(t *testing.T, store storage.Store, n int) []clusterNode {
+	t.Helper()
+
+	nodes := make([]clusterNode, n)
+	urls := make([]string, n)
+
+	for i := range nodes {
+		nodes[i].server = httptest.NewUnstartedServer(nil)
+		nodes[i].url = "http://" + nodes[i].server.Listener.Addr().String()
+		urls[i] = nodes[i].url
+	}
+
+	ring := cluster.NewRing(urls...)
+
+	for i := range nodes {
+		hub := ws.NewHub()
+		nodes[i].manager = collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub})
+		nodes[i].server.Config.Handler = handler.NewServer(handler.ServerConfig{
+			Manager: nodes[i].manager,
+			Store:   store,
+			Hub:     hub,
+			Ring:    ring,
+			NodeURL: nodes[i].url,
+		}).Handler()
+
+		nodes[i].server.Start()
+		t.Cleanup(nodes[i].server.Close)
+	}
+
+	return nodes
+}
+
+// docOwnedBy creates a document that the ring assigns to owner.
+func docOwnedBy(t *testing.T, store storage.Store, nodes []clusterNode, owner int) string {
+	t.Helper()
+
+	docID := idOwnedBy(nodes, owner, "doc")
+	require.NoError(t, store.CreateDocument(t.Context(), docID))
+
+	return docID
+}
+
+// idOwnedBy returns the first ID with the prefix that the ring assigns to owner.
+func idOwnedBy(nodes []clusterNode, owner int, prefix string) string {
+	urls := make([]string, len(nodes))
+	for i, node := range nodes {
+		urls[i] = node.url
+	}
+
+	ring := cluster.NewRing(urls...)
+
+	for i := 0; ; i++ {
+		id := prefix + strconv.Itoa(i)
+		if ring.Owner(id) == nodes[owner].url {
+			return id
+		}
+	}
+}
+
+func get(t *testing.T, target string, header http.Header) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+	require.NoError(t, err)
+
+	req.Header = header
+	req.Header.Set("X-User-Id", "alice")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+
+	return resp
+}
+
+func post(t *testing.T, target string, header http.Header, body any) *http.Response {
+	t.Helper()
+
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, target, bytes.NewReader(data))
+	require.NoError(t, err)
+
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-Id", "alice")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+
+	return resp
+}
+
+// batchStatuses returns the status of each document of a batch response.
+func batchStatuses(t *testing.T, resp *http.Response) []int {
+	t.Helper()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var batch apitypes.BatchDeleteResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&batch))
+
+	statuses := make([]int, len(batch.Results))
+	for i, result := range batch.Results {
+		statuses[i] = result.Status
+	}
+
+	return statuses
+}
+
+func TestRouting_ProxiesToOwner(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	nodes := newCluster(t, store, 2)
+	docID := docOwnedBy(t, store, nodes, 1)
+
+	resp := get(t, nodes[0].url+"/v1/documents/"+docID, http.Header{"X-Request-Id": {"req-1"}})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "req-1", resp.Header.Get("X-Request-Id"))
+
+	// Only the owner opened a session
+	require.Nil(t, nodes[0].manager.GetSession(docID))
+	require.NotNil(t, nodes[1].manager.GetSession(docID))
+
+	// The owner serves its own documents
+	resp = get(t, nodes[1].url+"/v1/documents/"+docID, http.Header{})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestRouting_WebSocket(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	nodes := newCluster(t, store, 2)
+	docID := docOwnedBy(t, store, nodes, 1)
+
+	// Clients of both nodes edit the document through the owner's session
+	var conns []*websocket.Conn
+
+	for _, node := range nodes {
+		url := "ws" + strings.TrimPrefix(node.url, "http") + "/v1/ws?docId=" + docID
+
+		conn, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"X-User-Id": {"alice"}})
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		t.Cleanup(func() { _ = conn.Close() })
+
+		var state ws.Message
+		require.NoError(t, conn.ReadJSON(&state))
+		require.Equal(t, ws.MessageTypeState, state.Type)
+
+		conns = append(conns, conn)
+	}
+
+	require.NoError(t, conns[0].WriteJSON(map[string]any{
+		"type":    "operation",
+		"payload": map[string]any{"type": 0, "position": 0, "char": "x", "revision": 0},
+	}))
+
+	require.Equal(t, ws.MessageTypeAck, readEdit(t, conns[0]).Type)
+	require.Equal(t, ws.MessageTypeBroadcast, readEdit(t, conns[1]).Type)
+
+	require.Nil(t, nodes[0].manager.GetSession(docID))
+	require.Equal(t, 1, nodes[1].manager.GetSession(docID).Revision())
+}
+
+func TestRouting_Errors(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	nodes := newCluster(t, store, 3)
+	docID := docOwnedBy(t, store, nodes, 1)
+	unreachable := docOwnedBy(t, store, nodes, 2)
+
+	// A node never proxies a request that was already proxied
+	resp := get(t, nodes[0].url+"/v1/documents/"+docID, http.Header{"X-Forwarded-By-Node": {nodes[2].url}})
+	require.Equal(t, http.StatusMisdirectedRequest, resp.StatusCode)
+
+	var body apitypes.ErrorResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, apitypes.ErrorCodeMisdirectedRequest, body.Code)
+
+	nodes[2].server.Close()
+
+	resp = get(t, nodes[0].url+"/v1/documents/"+unreachable, http.Header{})
+	require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+
+	// WebSockets without a document are rejected locally
+	resp = get(t, nodes[0].url+"/v1/ws", http.Header{})
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestRouting_Batch(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	nodes := newCluster(t, store, 3)
+	local, remote, down := idOwnedBy(nodes, 0, "a"), idOwnedBy(nodes, 1, "b"), idOwnedBy(nodes, 2, "c")
+
+	nodes[2].server.Close()
+
+	// Each document is created by its owner, in the requested order
+	resp := post(t, nodes[0].url+"/v1/documents/batch", http.Header{}, apitypes.BatchCreateRequest{
+		Documents: []apitypes.BatchCreateDocument{{ID: remote, Content: "hi"}, {ID: down}, {ID: local}},
+	})
+	require.Equal(t, []int{http.StatusCreated, http.StatusBadGateway, http.StatusCreated}, batchStatuses(t, resp))
+
+	resp = get(t, nodes[1].url+"/v1/documents/"+remote, http.Header{})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotNil(t, nodes[1].manager.GetSession(remote))
+
+	// A batch that was already proxied isn't proxied again
+	resp = post(t, nodes[0].url+"/v1/documents/batch-delete", http.Header{"X-Forwarded-By-Node": {nodes[1].url}},
+		apitypes.BatchDeleteRequest{IDs: []string{remote}})
+	require.Equal(t, []int{http.StatusMisdirectedRequest}, batchStatuses(t, resp))
+
+	// The owner deletes the document and closes its session
+	resp = post(t, nodes[0].url+"/v1/documents/batch-delete", http.Header{},
+		apitypes.BatchDeleteRequest{IDs: []string{local, remote}})
+	require.Equal(t, []int{http.StatusNoContent, http.StatusNoContent}, batchStatuses(t, resp))
+	require.Nil(t, nodes[1].manager.GetSession(remote))
+}
+
+func TestRouting_Import(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	nodes := newCluster(t, store, 3)
+	remote, down := idOwnedBy(nodes, 1, "b"), idOwnedBy(nodes, 2, "c")
+
+	nodes[2].server.Close()
+
+	file := formPart{field: "file", fileName: "notes.txt", data: []byte("hi")}
+	h := nodes[0].server.Config.Handler
+
+	// The ID may follow the file
+	rec := upload(t, h, "alice", "/v1/documents/import", file, formPart{field: "id", data: []byte(remote)})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	resp := get(t, nodes[1].url+"/v1/documents/"+remote, http.Header{})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var doc apitypes.GetDocumentResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&doc))
+	require.Equal(t, "hi", doc.Content)
+
+	rec = upload(t, h, "alice", "/v1/documents/import", formPart{field: "id", data: []byte(down)}, file)
+	require.Equal(t, http.StatusBadGateway, rec.Code)
+
+	// Generated IDs are created where the file was uploaded
+	rec = upload(t, h, "alice", "/v1/documents/import", file)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+}
+
+func TestRouting_ShareDB(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	nodes := newCluster(t, store, 2)
+	local, remote := docOwnedBy(t, store, nodes, 0), docOwnedBy(t, store, nodes, 1)
+
+	// The connection is served by the owner of its docId
+	url := "ws" + strings.TrimPrefix(nodes[0].url, "http") + "/v1/sharedb?docId=" + remote
+
+	conn, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"X-User-Id": {"alice"}})
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	t.Cleanup(func() { _ = conn.Close() })
+
+	var msg map[string]any
+	require.NoError(t, conn.ReadJSON(&msg))
+	require.Equal(t, "init", msg["a"])
+
+	require.NoError(t, conn.WriteJSON(map[string]any{"a": "s", "c": "text", "d": remote}))
+	require.NoError(t, conn.ReadJSON(&msg))
+	require.NotContains(t, msg, "error")
+	require.NotNil(t, nodes[1].manager.GetSession(remote))
+
+	// Documents of other nodes are refused on it
+	require.NoError(t, conn.WriteJSON(map[string]any{"a": "s", "c": "text", "d": local}))
+	require.NoError(t, conn.ReadJSON(&msg))
+
+	failure, _ := msg["error"].(map[string]any)
+	require.Equal(t, "ERR_MISDIRECTED_REQUEST", failure["code"])
+	require.Nil(t, nodes[1].manager.GetSession(local))
+	require.Nil(t, nodes[0].manager.GetSession(local))
+}
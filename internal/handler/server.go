@@ -1,22 +1,70 @@
 package handler
 
 import (
+	"log/slog"
 	"net/http"
+	"net/http/httputil"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apikey"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/auth"
+	"github.com/serroba/online-docs/internal/blob"
+	"github.com/serroba/online-docs/internal/bot"
+	"github.com/serroba/online-docs/internal/cluster"
 	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/comment"
+	"github.com/serroba/online-docs/internal/graphqlapi"
+	"github.com/serroba/online-docs/internal/health"
+	"github.com/serroba/online-docs/internal/idempotency"
+	"github.com/serroba/online-docs/internal/jwt"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/oidc"
+	"github.com/serroba/online-docs/internal/preferences"
+	"github.com/serroba/online-docs/internal/sharedb"
 	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/webhook"
 	"github.com/serroba/online-docs/internal/ws"
+	"github.com/serroba/online-docs/internal/yjs"
 )
 
 // Server handles HTTP requests for the collaboration API.
 type Server struct {
-	manager   *collab.Manager
-	store     storage.Store
-	permStore acl.Store
-	hub       *ws.Hub
-	upgrader  websocket.Upgrader
+	manager     *collab.Manager
+	store       storage.Store
+	permStore   acl.Store
+	hub         *ws.Hub
+	faults      *ws.FaultInjector
+	apiKeys     *apikey.Service
+	shareLinks  *acl.Links
+	bots        *bot.Service
+	oidc        *oidc.Provider
+	jwt         *jwt.Verifier
+	sessions    *auth.SessionManager
+	tokens      *auth.TokenManager
+	graphql     *graphqlapi.Handler
+	yjs         *yjs.Bridge
+	sharedb     *sharedb.Adapter
+	webhooks    *webhook.Service
+	idempotency idempotency.Store
+	preferences preferences.Store
+	blobs       blob.Store
+	comments    *comment.Service
+	groups      *acl.Groups
+	admins      map[string]struct{}
+	readiness   *health.Readiness
+	ring        *cluster.Ring
+	proxies     map[string]*httputil.ReverseProxy // To the ring's other nodes, by URL
+	logger      *slog.Logger
+	upgrader    websocket.Upgrader
+
+	maxBodyBytes       int64
+	maxAttachmentBytes int64
+	requestTimeout     time.Duration
+	operationRate      float64
+	operationBurst     int
 }
 
 // ServerConfig holds configuration for creating a server.
@@ -25,45 +73,339 @@ type ServerConfig struct {
 	Store     storage.Store
 	PermStore acl.Store
 	Hub       *ws.Hub
+	APIKeys   *apikey.Service // Optional: enables service account API keys
+	Bots      *bot.Service    // Optional: enables server-side bots
+
+	// ShareLinks enables share links. Their holders only get the link's
+	// role if PermStore is an acl.LinkedStore over the same links.
+	ShareLinks *acl.Links
+
+	// Groups enables groups. Their members only get the roles granted to
+	// them if PermStore is an acl.GroupedStore over the same groups.
+	Groups *acl.Groups
+
+	// OIDC enables login through an OpenID provider. When set, the
+	// X-User-Id header is no longer trusted and users authenticate
+	// with the session cookie issued after login.
+	OIDC     *oidc.Provider
+	Sessions *auth.SessionManager // Required when OIDC is set
+
+	// JWT accepts bearer tokens signed by an external identity provider,
+	// taking their subject as the user ID. When set, the X-User-Id header
+	// is no longer trusted.
+	JWT *jwt.Verifier
+
+	// Tokens enables /auth/login, which exchanges the caller's
+	// authentication for access and refresh tokens.
+	Tokens *auth.TokenManager
+
+	GraphQL     *graphqlapi.Handler // Optional: enables the /graphql endpoint
+	Webhooks    *webhook.Service    // Optional: enables /webhooks, /events and document event delivery
+	Admins      []string            // Optional: user IDs allowed to use the /admin endpoints
+	Idempotency idempotency.Store   // Optional: enables Idempotency-Key on document creation
+	Preferences preferences.Store   // Optional: enables starring documents and notification settings
+	Blobs       blob.Store          // Optional: enables document attachments
+	Comments    *comment.Service    // Optional: enables comments on documents
+	Logger      *slog.Logger        // Optional: defaults to slog.Default()
+
+	// Readiness holds back every request but the probes until its startup
+	// tasks are done. Without it the server is ready at once.
+	Readiness *health.Readiness
+
+	MaxBodyBytes       int64 // Optional: request body size limit, defaults to 1 MiB
+	MaxAttachmentBytes int64 // Optional: attachment size limit, defaults to 10 MiB
+
+	// RequestTimeout bounds how long a request may take, defaulting to 30
+	// seconds. WebSockets, event streams and change polling are exempt.
+	RequestTimeout time.Duration
+
+	// OperationRate and OperationBurst limit each WebSocket client to
+	// OperationBurst operation and operation batch messages at once and
+	// OperationRate a second after that. Messages over the limit are
+	// rejected with ws.ErrorCodeRateLimited. Zero disables the limit.
+	OperationRate  float64
+	OperationBurst int
+
+	// AllowedOrigins lists the origins browsers may open WebSockets from.
+	// "*" or an empty list allows any origin.
+	AllowedOrigins []string
+
+	// Faults injects network faults into every WebSocket, for testing how
+	// clients cope with a bad network. Never set it in production.
+	Faults *ws.FaultInjector
+
+	// Ring assigns documents to nodes, which are named by their base URL.
+	// When set, requests for documents owned by a node other than NodeURL
+	// are proxied to it, so only one node runs each document's session.
+	Ring    *cluster.Ring
+	NodeURL string
 }
 
 // NewServer creates a new API server.
 func NewServer(cfg ServerConfig) *Server {
-	return &Server{
-		manager:   cfg.Manager,
-		store:     cfg.Store,
-		permStore: cfg.PermStore,
-		hub:       cfg.Hub,
+	maxBodyBytes := cfg.MaxBodyBytes
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = defaultMaxBodyBytes
+	}
+
+	maxAttachmentBytes := cfg.MaxAttachmentBytes
+	if maxAttachmentBytes <= 0 {
+		maxAttachmentBytes = defaultMaxAttachmentBytes
+	}
+
+	requestTimeout := cfg.RequestTimeout
+	if requestTimeout <= 0 {
+		requestTimeout = defaultRequestTimeout
+	}
+
+	admins := make(map[string]struct{}, len(cfg.Admins))
+	for _, userID := range cfg.Admins {
+		admins[userID] = struct{}{}
+	}
+
+	s := &Server{
+		manager:     cfg.Manager,
+		store:       cfg.Store,
+		permStore:   cfg.PermStore,
+		hub:         cfg.Hub,
+		faults:      cfg.Faults,
+		apiKeys:     cfg.APIKeys,
+		shareLinks:  cfg.ShareLinks,
+		bots:        cfg.Bots,
+		oidc:        cfg.OIDC,
+		jwt:         cfg.JWT,
+		sessions:    cfg.Sessions,
+		tokens:      cfg.Tokens,
+		graphql:     cfg.GraphQL,
+		webhooks:    cfg.Webhooks,
+		idempotency: cfg.Idempotency,
+		preferences: cfg.Preferences,
+		blobs:       cfg.Blobs,
+		comments:    cfg.Comments,
+		groups:      cfg.Groups,
+		admins:      admins,
+		readiness:   cfg.Readiness,
+		ring:        cfg.Ring,
+		logger:      logging.Component(cfg.Logger, "http"),
+
+		maxBodyBytes:       maxBodyBytes,
+		maxAttachmentBytes: maxAttachmentBytes,
+		requestTimeout:     requestTimeout,
+		operationRate:      cfg.OperationRate,
+		operationBurst:     cfg.OperationBurst,
 		upgrader: websocket.Upgrader{
-			CheckOrigin: func(_ *http.Request) bool {
-				return true // Allow all origins for demo
-			},
+			CheckOrigin:  checkOrigin(cfg.AllowedOrigins),
+			Subprotocols: []string{bearerSubprotocol},
 		},
 	}
+
+	s.yjs = yjs.NewBridge(yjs.BridgeConfig{Open: s.openYjsSession, Logger: cfg.Logger})
+	s.sharedb = sharedb.NewAdapter(sharedb.AdapterConfig{Open: s.openShareDBSession, Logger: cfg.Logger})
+
+	if s.ring != nil {
+		s.proxies = s.ownerProxies(cfg.NodeURL)
+	}
+
+	return s
 }
 
+// apiPrefix versions the REST, GraphQL and WebSocket routes.
+const apiPrefix = "/v1"
+
+// Routes that middleware and logging need to recognize.
+const (
+	graphQLPath     = apiPrefix + "/graphql"
+	webSocketPath   = apiPrefix + "/ws"
+	yjsPath         = apiPrefix + "/yjs/{docID}"
+	shareDBPath     = apiPrefix + "/sharedb"
+	batchDeletePath = apiPrefix + "/documents/batch-delete"
+)
+
 // Handler returns an http.Handler with all routes configured.
 func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
 
 	// Document endpoints (require auth)
-	mux.Handle("/documents", s.authMiddleware(http.HandlerFunc(s.handleCreateDocument)))
-	mux.Handle("/documents/", s.authMiddleware(http.HandlerFunc(s.handleDocumentByID)))
+	mux.Handle(apiPrefix+"/documents", s.authMiddleware(s.idempotent(s.handleDocuments)))
+	mux.Handle(apiPrefix+"/documents/batch", s.authMiddleware(s.idempotent(s.handleBatchCreate)))
+	mux.Handle(apiPrefix+"/documents/import",
+		s.routeToOwner(importDocID, s.authMiddleware(http.HandlerFunc(s.handleImportDocument))))
+	mux.Handle(batchDeletePath, s.authMiddleware(http.HandlerFunc(s.handleBatchDelete)))
+	mux.Handle(apiPrefix+"/documents/{docID}", s.documentRoute(s.handleDocument))
+	mux.Handle(apiPrefix+"/documents/{docID}/content", s.documentRoute(s.handleDocumentContent))
+	mux.Handle(apiPrefix+"/documents/{docID}/copy", s.documentRoute(s.idempotent(s.handleCopyDocument)))
+	mux.Handle(apiPrefix+"/documents/{docID}/export", s.documentRoute(s.handleExportDocument))
+	mux.Handle(apiPrefix+"/documents/{docID}/stats", s.documentRoute(s.handleDocumentStats))
+	mux.Handle(apiPrefix+"/documents/{docID}/changes", s.documentRoute(s.handleChanges))
+	mux.Handle(apiPrefix+"/documents/{docID}/history", s.documentRoute(s.handleHistory))
+	mux.Handle(apiPrefix+"/documents/{docID}/revisions/{revision}", s.documentRoute(s.handleRevision))
+	mux.Handle(apiPrefix+"/documents/{docID}/tags", s.documentRoute(s.handleTags))
+	mux.Handle(apiPrefix+"/documents/{docID}/archive", s.documentRoute(s.handleArchive))
+	mux.Handle(apiPrefix+"/documents/{docID}/undo", s.documentRoute(s.handleUndo))
+	mux.Handle(apiPrefix+"/documents/{docID}/redo", s.documentRoute(s.handleRedo))
+	mux.Handle(apiPrefix+"/slugs/{slug}", s.authMiddleware(http.HandlerFunc(s.handleResolveSlug)))
+
+	// Document sharing (requires auth, only when configured)
+	if s.permStore != nil {
+		mux.Handle(apiPrefix+"/documents/{docID}/permissions", s.documentRoute(s.handlePermissions))
+		mux.Handle(apiPrefix+"/documents/{docID}/permissions/{userID}", s.documentRoute(s.handlePermission))
+	}
+
+	// Share links (requires auth, only when configured)
+	if s.permStore != nil && s.shareLinks != nil {
+		mux.Handle(apiPrefix+"/documents/{docID}/links", s.documentRoute(s.handleCreateShareLink))
+	}
+
+	// API key management (requires auth, only when configured)
+	if s.apiKeys != nil {
+		mux.Handle(apiPrefix+"/apikeys", s.authMiddleware(http.HandlerFunc(s.handleAPIKeys)))
+		mux.Handle(apiPrefix+"/apikeys/{keyID}", s.authMiddleware(http.HandlerFunc(s.handleAPIKeyByID)))
+	}
+
+	// Groups of users sharing roles (requires auth, only when configured)
+	if s.groups != nil {
+		mux.Handle(apiPrefix+"/groups", s.authMiddleware(http.HandlerFunc(s.handleGroups)))
+		mux.Handle(apiPrefix+"/groups/{groupID}", s.authMiddleware(http.HandlerFunc(s.handleGroupByID)))
+		mux.Handle(apiPrefix+"/groups/{groupID}/members/{userID}", s.authMiddleware(http.HandlerFunc(s.handleGroupMember)))
+	}
+
+	// Server-side bots (requires auth, only when configured)
+	if s.bots != nil {
+		mux.Handle(apiPrefix+"/bots", s.authMiddleware(http.HandlerFunc(s.handleBots)))
+		mux.Handle(apiPrefix+"/bots/{botID}", s.authMiddleware(http.HandlerFunc(s.handleBotByID)))
+		mux.Handle(apiPrefix+"/bots/{botID}/documents/{docID}", s.documentRoute(s.handleBotDocument))
+		mux.Handle(apiPrefix+"/bots/{botID}/documents/{docID}/edits", s.documentRoute(s.handleBotEdit))
+	}
+
+	// Starred documents and notification settings (requires auth, only when configured)
+	if s.preferences != nil {
+		mux.Handle(apiPrefix+"/documents/{docID}/star", s.documentRoute(s.handleStar))
+		mux.Handle(apiPrefix+"/starred", s.authMiddleware(http.HandlerFunc(s.handleListStarred)))
+		mux.Handle(apiPrefix+"/notifications", s.authMiddleware(http.HandlerFunc(s.handleNotifications)))
+	}
+
+	// Document attachments (requires auth, only when configured)
+	if s.blobs != nil {
+		mux.Handle(apiPrefix+"/documents/{docID}/attachments", s.documentRoute(s.handleUploadAttachment))
+		mux.Handle(apiPrefix+"/documents/{docID}/attachments/{attachmentID}", s.documentRoute(s.handleGetAttachment))
+	}
+
+	// Document comments (requires auth, only when configured)
+	if s.comments != nil {
+		mux.Handle(apiPrefix+"/documents/{docID}/comments", s.documentRoute(s.handleComments))
+		mux.Handle(apiPrefix+"/documents/{docID}/comments/{commentID}/resolve", s.documentRoute(s.handleResolveComment))
+	}
+
+	// Webhook registry and event stream (requires auth, only when configured)
+	if s.webhooks != nil {
+		mux.Handle(apiPrefix+"/webhooks", s.authMiddleware(http.HandlerFunc(s.handleWebhooks)))
+		mux.Handle(apiPrefix+"/webhooks/{hookID}", s.authMiddleware(http.HandlerFunc(s.handleWebhookByID)))
+		mux.Handle(apiPrefix+"/events", s.authMiddleware(http.HandlerFunc(s.handleEvents)))
+	}
+
+	// Session administration (requires an admin user, only when configured)
+	if len(s.admins) > 0 {
+		mux.Handle(apiPrefix+"/admin/summary", s.adminOnly(s.handleSummary))
+		mux.Handle(apiPrefix+"/admin/documents", s.adminOnly(s.handleListDocuments))
+		mux.Handle(apiPrefix+"/admin/sessions", s.adminOnly(s.handleListSessions))
+		mux.Handle(apiPrefix+"/admin/sessions/{docID}", s.adminOnly(s.handleCloseSession))
+		mux.Handle(apiPrefix+"/admin/sessions/{docID}/snapshot", s.adminOnly(s.handleSnapshotSession))
+	}
+
+	// OpenID Connect login (public, only when configured). These stay
+	// unversioned because the callback URL is registered with the provider.
+	if s.oidc != nil {
+		mux.HandleFunc("/auth/oidc/login", s.handleOIDCLogin)
+		mux.HandleFunc("/auth/oidc/callback", s.handleOIDCCallback)
+		mux.HandleFunc("/auth/logout", s.handleLogout)
+	}
+
+	// Access and refresh tokens (only when configured). Logging in needs an
+	// authenticated caller; refreshing and revoking present a token instead.
+	if s.tokens != nil {
+		mux.Handle("/auth/login", s.authMiddleware(http.HandlerFunc(s.handleLogin)))
+		mux.HandleFunc("/auth/refresh", s.handleRefreshToken)
+		mux.HandleFunc("/auth/revoke", s.handleRevokeToken)
+	}
+
+	// GraphQL endpoint (requires auth, only when configured)
+	if s.graphql != nil {
+		mux.Handle(graphQLPath, s.authMiddleware(http.HandlerFunc(s.handleGraphQL)))
+	}
+
+	// Liveness and readiness probes (public)
+	mux.HandleFunc(healthPath, handleHealth)
+	mux.HandleFunc(readyPath, s.handleReady)
+
+	// API description (public)
+	mux.HandleFunc(apiPrefix+"/openapi.json", s.handleOpenAPISpec)
 
 	// WebSocket endpoint (requires auth)
-	mux.Handle("/ws", s.authMiddleware(http.HandlerFunc(s.handleWebSocket)))
+	mux.Handle(webSocketPath, s.routeToOwner(queryDocID, s.authMiddleware(http.HandlerFunc(s.handleWebSocket))))
+
+	// y-websocket endpoint for Yjs editors (requires auth)
+	mux.Handle(yjsPath, s.documentRoute(s.handleYjs))
 
-	return mux
+	// ShareDB endpoint for ShareDB clients (requires auth); a docId query
+	// parameter connects to that document's owner
+	mux.Handle(shareDBPath, s.routeToOwner(queryDocID, s.authMiddleware(http.HandlerFunc(s.handleShareDB))))
+
+	// Demo editor (public); the page authenticates its own API calls
+	mux.HandleFunc("/{$}", s.handleDemo)
+
+	// Everything else, including unknown sub-resources
+	mux.HandleFunc("/", handleNotFound)
+
+	handler := s.accessLogMiddleware(s.compressMiddleware(s.recoverMiddleware(
+		deadlineMiddleware(s.readinessMiddleware(mux)))))
+
+	return s.requestIDMiddleware(s.timeoutMiddleware(mux, handler))
+}
+
+// handleNotFound answers requests that match no route.
+func handleNotFound(w http.ResponseWriter, _ *http.Request) {
+	writeError(w, http.StatusNotFound, "not found")
 }
 
-// handleDocumentByID routes GET and DELETE requests for /documents/{id}.
-func (s *Server) handleDocumentByID(w http.ResponseWriter, r *http.Request) {
+// handleDocuments routes GET and POST requests for /v1/documents.
+func (s *Server) handleDocuments(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.handleListUserDocuments(w, r)
+	case http.MethodPost:
+		s.handleCreateDocument(w, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleDocument routes GET, HEAD and DELETE requests for /v1/documents/{id}.
+func (s *Server) handleDocument(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		s.handleGetDocument(w, r)
+	case http.MethodHead:
+		s.handleHeadDocument(w, r)
+	case http.MethodPatch:
+		s.handleUpdateDocument(w, r)
 	case http.MethodDelete:
 		s.handleDeleteDocument(w, r)
 	default:
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleOpenAPISpec handles GET /v1/openapi.json.
+func (s *Server) handleOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, err := w.Write(apitypes.OpenAPISpec); err != nil {
+		s.logger.ErrorContext(r.Context(), "failed to write OpenAPI spec", logging.Err(err))
 	}
 }
@@ -1,10 +1,12 @@
 package handler_test
 
 import (
+	"bytes"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/serroba/online-docs/internal/apitypes"
 	"github.com/serroba/online-docs/internal/collab"
 	"github.com/serroba/online-docs/internal/handler"
 	"github.com/serroba/online-docs/internal/storage"
@@ -57,7 +59,7 @@ func TestServerHandler(t *testing.T) {
 	t.Run("documents endpoint requires auth", func(t *testing.T) {
 		t.Parallel()
 
-		req := httptest.NewRequest(http.MethodPost, "/documents", nil)
+		req := httptest.NewRequest(http.MethodPost, "/v1/documents", nil)
 		rec := httptest.NewRecorder()
 
 		handler.ServeHTTP(rec, req)
@@ -70,7 +72,7 @@ func TestServerHandler(t *testing.T) {
 	t.Run("ws endpoint requires auth", func(t *testing.T) {
 		t.Parallel()
 
-		req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		req := httptest.NewRequest(http.MethodGet, "/v1/ws", nil)
 		rec := httptest.NewRecorder()
 
 		handler.ServeHTTP(rec, req)
@@ -83,7 +85,7 @@ func TestServerHandler(t *testing.T) {
 	t.Run("routes PUT to method not allowed", func(t *testing.T) {
 		t.Parallel()
 
-		req := httptest.NewRequest(http.MethodPut, "/documents/test", nil)
+		req := httptest.NewRequest(http.MethodPut, "/v1/documents/test", nil)
 		req.Header.Set("X-User-Id", "user1")
 
 		rec := httptest.NewRecorder()
@@ -94,4 +96,78 @@ func TestServerHandler(t *testing.T) {
 			t.Errorf("expected 405, got %d", rec.Code)
 		}
 	})
+
+	unknown := []string{"/documents/test", "/v1/documents/test/comments", "/v2/documents"}
+	for _, target := range unknown {
+		t.Run("unknown route "+target+" returns JSON 404", func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			req.Header.Set("X-User-Id", "user1")
+
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("expected 404, got %d", rec.Code)
+			}
+
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("expected JSON error, got Content-Type %q", got)
+			}
+		})
+	}
+}
+
+func TestHandleOpenAPISpec(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	hub := ws.NewHub()
+	manager := collab.NewManager(collab.ManagerConfig{
+		Store: store,
+		Hub:   hub,
+	})
+
+	server := handler.NewServer(handler.ServerConfig{
+		Manager: manager,
+		Store:   store,
+		Hub:     hub,
+	})
+
+	t.Run("serves spec without auth", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/openapi.json", nil)
+		rec := httptest.NewRecorder()
+
+		server.Handler().ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("expected application/json, got %q", ct)
+		}
+
+		if !bytes.Equal(rec.Body.Bytes(), apitypes.OpenAPISpec) {
+			t.Error("expected body to be the embedded OpenAPI spec")
+		}
+	})
+
+	t.Run("rejects other methods", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/openapi.json", nil)
+		rec := httptest.NewRecorder()
+
+		server.Handler().ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("expected 405, got %d", rec.Code)
+		}
+	})
+
 }
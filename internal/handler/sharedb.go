@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/serroba/online-docs/internal/cluster"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/sharedb"
+)
+
+// handleShareDB handles GET /v1/sharedb, which speaks the ShareDB protocol
+// to ShareDB clients. Permissions are checked per document as they use them.
+// A connection is routed to the owner of its docId query parameter, if any,
+// and can only use the documents that node owns.
+func (s *Server) handleShareDB(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	ctx := r.Context()
+	userID := UserIDFromContext(ctx)
+
+	// The upgrade writes its own response, so echo the request ID explicitly
+	conn, err := s.upgrader.Upgrade(w, r, http.Header{headerRequestID: {RequestIDFromContext(ctx)}})
+	if err != nil {
+		s.logger.WarnContext(ctx, "sharedb upgrade failed", logging.Err(err))
+
+		return
+	}
+
+	s.logger.InfoContext(ctx, "sharedb client connected", logging.UserID(userID))
+
+	canWrite := func(docID string) bool { return s.canWrite(docID, userID, r) }
+
+	if err := s.sharedb.Serve(conn, userID, canWrite); err != nil {
+		s.logger.WarnContext(ctx, "sharedb client disconnected", logging.UserID(userID), logging.Err(err))
+	}
+}
+
+// openShareDBSession opens a document's session for the ShareDB adapter.
+// Documents another node owns are refused, as their sessions run there.
+func (s *Server) openShareDBSession(ctx context.Context, docID string) (sharedb.Session, error) {
+	if s.ownedElsewhere(docID) {
+		return nil, cluster.ErrNotOwner
+	}
+
+	session, err := s.manager.GetOrCreateSession(ctx, docID)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
@@ -0,0 +1,85 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShareDB(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Owner))
+	require.NoError(t, permStore.Grant("doc1", "bob", acl.Viewer))
+
+	hub := ws.NewHub()
+	h := handler.NewServer(handler.ServerConfig{
+		Manager:   collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore, Hub: hub}),
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+	}).Handler()
+
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/sharedb"
+
+	conn, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"X-User-Id": {"alice"}})
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	t.Cleanup(func() { _ = conn.Close() })
+
+	var msg map[string]any
+
+	require.NoError(t, conn.ReadJSON(&msg))
+	require.Equal(t, "init", msg["a"])
+
+	require.NoError(t, conn.WriteJSON(map[string]any{"a": "s", "c": "text", "d": "doc1"}))
+
+	var reply map[string]any
+
+	require.NoError(t, conn.ReadJSON(&reply))
+	require.Equal(t, map[string]any{
+		"a": "s", "c": "text", "d": "doc1",
+		"data": map[string]any{"v": 0.0, "data": "", "type": "http://sharejs.org/types/textv1"},
+	}, reply)
+	// Missing documents are refused
+	require.NoError(t, conn.WriteJSON(map[string]any{"a": "s", "c": "text", "d": "missing"}))
+	require.NoError(t, conn.ReadJSON(&reply))
+	require.Contains(t, reply, "error")
+
+	// Viewers can subscribe but not submit ops
+	viewer, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"X-User-Id": {"bob"}})
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	t.Cleanup(func() { _ = viewer.Close() })
+
+	require.NoError(t, viewer.ReadJSON(&msg))
+	require.NoError(t, viewer.WriteJSON(map[string]any{"a": "s", "c": "text", "d": "doc1"}))
+	require.NoError(t, viewer.ReadJSON(&reply))
+	require.NoError(t, viewer.WriteJSON(map[string]any{"a": "op", "c": "text", "d": "doc1", "v": 0, "op": []any{"x"}}))
+	require.NoError(t, viewer.ReadJSON(&reply))
+	require.Equal(t, "ERR_OP_SUBMIT_REJECTED", reply["error"].(map[string]any)["code"]) //nolint:forcetypeassert // Fails the test
+
+	rec := serveWith(h, http.MethodPost, "/v1/sharedb", "", nil)
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = serveWith(h, http.MethodGet, "/v1/sharedb", "", nil)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
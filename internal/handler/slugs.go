@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// handleResolveSlug handles GET /v1/slugs/{slug}, returning the ID of the
+// document with that slug. The caller needs read access to the document.
+func (s *Server) handleResolveSlug(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	slug := r.PathValue("slug")
+
+	docID, err := s.store.ResolveSlug(r.Context(), slug)
+	if err == nil && s.permStore != nil {
+		checker := acl.NewChecker(s.permStore)
+		err = checker.RequirePermission(docID, UserIDFromContext(r.Context()), acl.ActionRead)
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrSlugNotFound):
+			writeError(w, http.StatusNotFound, "slug not found")
+		case errors.Is(err, acl.ErrAccessDenied):
+			writeError(w, http.StatusForbidden, "access denied")
+		default:
+			s.logger.ErrorContext(r.Context(), "failed to resolve slug", "slug", slug, logging.Err(err))
+			writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apitypes.SlugResponse{ID: docID, Slug: slug})
+}
@@ -0,0 +1,159 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// failingSlugStore is a MemoryStore whose slug methods always fail.
+type failingSlugStore struct {
+	*storage.MemoryStore
+}
+
+func (failingSlugStore) SetSlug(context.Context, string, string) error {
+	return errors.New("slugs unavailable")
+}
+
+func (failingSlugStore) ResolveSlug(context.Context, string) (string, error) {
+	return "", errors.New("slugs unavailable")
+}
+
+func newSlugServer(store storage.Store, permStore acl.Store) http.Handler {
+	return handler.NewServer(handler.ServerConfig{
+		Manager:   collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore}),
+		Store:     store,
+		PermStore: permStore,
+	}).Handler()
+}
+
+func TestHandleCreateDocument_GeneratedID(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	permStore := acl.NewMemoryStore()
+	h := newSlugServer(store, permStore)
+
+	rec := serveAs(h, "alice", http.MethodPost, "/v1/documents", `{"slug": "q1-plan", "content": "hello"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	var created apitypes.CreateDocumentResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	require.Equal(t, "q1-plan", created.Slug)
+
+	if _, err := uuid.Parse(created.ID); err != nil {
+		t.Errorf("expected a UUID document ID, got %q", created.ID)
+	}
+
+	role, err := permStore.GetRole(created.ID, "alice")
+	require.NoError(t, err)
+	require.Equal(t, acl.Owner, role)
+
+	rec = serveAs(h, "alice", http.MethodGet, "/v1/slugs/q1-plan", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resolved apitypes.SlugResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resolved))
+	require.Equal(t, apitypes.SlugResponse{ID: created.ID, Slug: "q1-plan"}, resolved)
+
+	// Each generated ID is unique
+	rec = serveAs(h, "alice", http.MethodPost, "/v1/documents", `{}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	var other apitypes.CreateDocumentResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&other))
+	require.NotEqual(t, created.ID, other.ID)
+	require.Empty(t, other.Slug)
+}
+
+func TestHandleCreateDocument_SlugErrors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("taken slug", func(t *testing.T) {
+		t.Parallel()
+
+		store := storage.NewMemoryStore()
+		require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+		require.NoError(t, store.SetSlug(t.Context(), "doc1", "q1-plan"))
+
+		h := newSlugServer(store, nil)
+
+		rec := serveAs(h, "alice", http.MethodPost, "/v1/documents", `{"id": "doc2", "slug": "q1-plan"}`)
+		require.Equal(t, http.StatusConflict, rec.Code, rec.Body.String())
+
+		exists, err := store.DocumentExists(t.Context(), "doc2")
+		require.NoError(t, err)
+		require.False(t, exists, "expected document to be removed")
+	})
+
+	t.Run("invalid slug", func(t *testing.T) {
+		t.Parallel()
+
+		h := newSlugServer(storage.NewMemoryStore(), nil)
+
+		rec := serveAs(h, "alice", http.MethodPost, "/v1/documents", `{"slug": "Q1 plan"}`)
+		require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	})
+
+	t.Run("slug fails", func(t *testing.T) {
+		t.Parallel()
+
+		store := failingSlugStore{MemoryStore: storage.NewMemoryStore()}
+		h := newSlugServer(store, nil)
+
+		rec := serveAs(h, "alice", http.MethodPost, "/v1/documents", `{"id": "doc1", "slug": "q1-plan"}`)
+		require.Equal(t, http.StatusInternalServerError, rec.Code, rec.Body.String())
+
+		exists, err := store.DocumentExists(t.Context(), "doc1")
+		require.NoError(t, err)
+		require.False(t, exists, "expected document to be removed")
+	})
+}
+
+func TestHandleResolveSlug_Errors(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.SetSlug(t.Context(), "doc1", "q1-plan"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Viewer))
+
+	acls := newSlugServer(store, permStore)
+	broken := newSlugServer(failingSlugStore{MemoryStore: store}, nil)
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		userID  string
+		method  string
+		target  string
+		status  int
+	}{
+		{"no read access", acls, "mallory", http.MethodGet, "/v1/slugs/q1-plan", http.StatusForbidden},
+		{"unknown slug", acls, "alice", http.MethodGet, "/v1/slugs/missing", http.StatusNotFound},
+		{"other methods", acls, "alice", http.MethodPost, "/v1/slugs/q1-plan", http.StatusMethodNotAllowed},
+		{"lookup fails", broken, "alice", http.MethodGet, "/v1/slugs/q1-plan", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if rec := serveAs(tt.handler, tt.userID, tt.method, tt.target, ""); rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
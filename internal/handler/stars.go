@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// handleStar handles GET, PUT and DELETE /v1/documents/{id}/star.
+// Users can star any document they can read.
+func (s *Server) handleStar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	docID := r.PathValue("docID")
+	userID := UserIDFromContext(r.Context())
+
+	starred, err := s.updateStar(r.Context(), r.Method, docID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, acl.ErrAccessDenied):
+			writeError(w, http.StatusForbidden, "access denied")
+		case errors.Is(err, storage.ErrDocumentNotFound):
+			writeError(w, http.StatusNotFound, "document not found")
+		default:
+			s.logger.ErrorContext(r.Context(), "star request failed", logging.DocID(docID), logging.Err(err))
+			writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apitypes.StarResponse{ID: docID, IsStarred: starred})
+}
+
+// updateStar checks that the user can read the document, then applies the
+// request method to the star and returns whether the document is starred.
+func (s *Server) updateStar(ctx context.Context, method, docID, userID string) (bool, error) {
+	if err := s.requireDocument(ctx, docID, userID, acl.ActionRead); err != nil {
+		return false, err
+	}
+
+	switch method {
+	case http.MethodPut:
+		return true, s.preferences.Star(userID, docID)
+	case http.MethodDelete:
+		return false, s.preferences.Unstar(userID, docID)
+	default:
+		return s.preferences.IsStarred(userID, docID)
+	}
+}
+
+// handleListStarred handles GET /v1/starred.
+// Documents that were deleted or are no longer readable are left out.
+func (s *Server) handleListStarred(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	userID := UserIDFromContext(r.Context())
+
+	docIDs, err := s.starredDocuments(r.Context(), userID)
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "failed to list starred documents", logging.UserID(userID), logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apitypes.ListStarredResponse{IDs: docIDs})
+}
+
+// starredDocuments returns the user's starred documents that still exist and
+// that the user can still read.
+func (s *Server) starredDocuments(ctx context.Context, userID string) ([]string, error) {
+	starred, err := s.preferences.ListStarred(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var checker *acl.Checker
+	if s.permStore != nil {
+		checker = acl.NewChecker(s.permStore)
+	}
+
+	docIDs := make([]string, 0, len(starred))
+
+	for _, docID := range starred {
+		exists, err := s.store.DocumentExists(ctx, docID)
+		if err != nil {
+			return nil, err
+		}
+
+		if !exists {
+			continue
+		}
+
+		if checker != nil {
+			allowed, err := checker.CanPerform(docID, userID, acl.ActionRead)
+			if err != nil {
+				return nil, err
+			}
+
+			if !allowed {
+				continue
+			}
+		}
+
+		docIDs = append(docIDs, docID)
+	}
+
+	return docIDs, nil
+}
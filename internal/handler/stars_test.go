@@ -0,0 +1,201 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/preferences"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+var errPreferences = errors.New("preferences unavailable")
+
+// failingPreferencesStore is a preferences.Store whose methods always fail.
+type failingPreferencesStore struct{}
+
+func (failingPreferencesStore) Star(string, string) error { return errPreferences }
+
+func (failingPreferencesStore) Unstar(string, string) error { return errPreferences }
+
+func (failingPreferencesStore) IsStarred(string, string) (bool, error) { return false, errPreferences }
+
+func (failingPreferencesStore) ListStarred(string) ([]string, error) { return nil, errPreferences }
+
+func (failingPreferencesStore) Notifications(string) (preferences.Notifications, error) {
+	return preferences.Notifications{}, errPreferences
+}
+
+func (failingPreferencesStore) SetNotifications(string, preferences.Notifications) error {
+	return errPreferences
+}
+
+// failingExistsStore is a MemoryStore whose DocumentExists always fails.
+type failingExistsStore struct {
+	*storage.MemoryStore
+}
+
+func (failingExistsStore) DocumentExists(context.Context, string) (bool, error) {
+	return false, errors.New("storage unavailable")
+}
+
+func newStarServer(store storage.Store, permStore acl.Store, prefs preferences.Store) http.Handler {
+	return handler.NewServer(handler.ServerConfig{
+		Manager:     collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore}),
+		Store:       store,
+		PermStore:   permStore,
+		Preferences: prefs,
+	}).Handler()
+}
+
+func decodeStar(t *testing.T, rec *httptest.ResponseRecorder) apitypes.StarResponse {
+	t.Helper()
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp apitypes.StarResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+
+	return resp
+}
+
+func listStarred(t *testing.T, h http.Handler, userID string) []string {
+	t.Helper()
+
+	rec := serveAs(h, userID, http.MethodGet, "/v1/starred", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp apitypes.ListStarredResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+
+	return resp.IDs
+}
+
+func TestHandleStar(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Viewer))
+
+	h := newStarServer(store, permStore, preferences.NewMemoryStore())
+
+	steps := []struct {
+		method  string
+		starred bool
+	}{
+		{http.MethodGet, false},
+		{http.MethodPut, true},
+		{http.MethodGet, true},
+		{http.MethodPut, true},
+	}
+
+	for _, step := range steps {
+		resp := decodeStar(t, serveAs(h, "alice", step.method, "/v1/documents/doc1/star", ""))
+		if resp.ID != "doc1" || resp.IsStarred != step.starred {
+			t.Errorf("%s: expected isStarred %v, got %+v", step.method, step.starred, resp)
+		}
+	}
+
+	require.Equal(t, []string{"doc1"}, listStarred(t, h, "alice"))
+
+	resp := decodeStar(t, serveAs(h, "alice", http.MethodDelete, "/v1/documents/doc1/star", ""))
+	if resp.IsStarred {
+		t.Errorf("expected document to be unstarred, got %+v", resp)
+	}
+
+	require.Empty(t, listStarred(t, h, "alice"))
+}
+
+func TestHandleListStarred_SkipsUnavailableDocuments(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	permStore := acl.NewMemoryStore()
+	prefs := preferences.NewMemoryStore()
+
+	for _, docID := range []string{"kept", "deleted", "unshared"} {
+		require.NoError(t, store.CreateDocument(t.Context(), docID))
+		require.NoError(t, permStore.Grant(docID, "alice", acl.Viewer))
+		require.NoError(t, prefs.Star("alice", docID))
+	}
+
+	require.NoError(t, store.DeleteDocument(t.Context(), "deleted"))
+	require.NoError(t, permStore.Revoke("unshared", "alice"))
+
+	h := newStarServer(store, permStore, prefs)
+
+	require.Equal(t, []string{"kept"}, listStarred(t, h, "alice"))
+}
+
+func TestHandleStar_Errors(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Viewer))
+
+	starred := preferences.NewMemoryStore()
+	require.NoError(t, starred.Star("alice", "doc1"))
+
+	acls := newStarServer(store, permStore, preferences.NewMemoryStore())
+	noACL := newStarServer(store, nil, preferences.NewMemoryStore())
+	brokenPrefs := newStarServer(store, nil, failingPreferencesStore{})
+	brokenStore := newStarServer(failingExistsStore{MemoryStore: store}, nil, starred)
+	brokenACL := newStarServer(store, failingRoleStore{MemoryStore: acl.NewMemoryStore()}, starred)
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		userID  string
+		method  string
+		target  string
+		status  int
+	}{
+		{"no read access", acls, "mallory", http.MethodPut, "/v1/documents/doc1/star", http.StatusForbidden},
+		{"missing document", noACL, "alice", http.MethodPut, "/v1/documents/missing/star", http.StatusNotFound},
+		{"other methods", acls, "alice", http.MethodPost, "/v1/documents/doc1/star", http.StatusMethodNotAllowed},
+		{"list with other methods", acls, "alice", http.MethodPost, "/v1/starred", http.StatusMethodNotAllowed},
+		{"star fails", brokenPrefs, "alice", http.MethodPut, "/v1/documents/doc1/star", http.StatusInternalServerError},
+		{"unstar fails", brokenPrefs, "alice", http.MethodDelete, "/v1/documents/doc1/star", http.StatusInternalServerError},
+		{"lookup fails", brokenPrefs, "alice", http.MethodGet, "/v1/documents/doc1/star", http.StatusInternalServerError},
+		{"list fails", brokenPrefs, "alice", http.MethodGet, "/v1/starred", http.StatusInternalServerError},
+		{"existence check fails", brokenStore, "alice", http.MethodGet, "/v1/documents/doc1/star", 500},
+		{"list existence check fails", brokenStore, "alice", http.MethodGet, "/v1/starred", http.StatusInternalServerError},
+		{"list permission check fails", brokenACL, "alice", http.MethodGet, "/v1/starred", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if rec := serveAs(tt.handler, tt.userID, tt.method, tt.target, ""); rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("disabled without preferences", func(t *testing.T) {
+		t.Parallel()
+
+		h := newStarServer(store, nil, nil)
+
+		for _, target := range []string{"/v1/documents/doc1/star", "/v1/starred"} {
+			if rec := serveAs(h, "alice", http.MethodGet, target, ""); rec.Code != http.StatusNotFound {
+				t.Errorf("%s: expected status 404, got %d", target, rec.Code)
+			}
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// handleDocumentStats handles GET /v1/documents/{id}/stats.
+// Counts come from the live session and edit history from the store's
+// metadata, so neither requires scanning the content or operation log.
+func (s *Server) handleDocumentStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	docID := r.PathValue("docID")
+
+	session, err := s.manager.GetOrCreateSession(r.Context(), docID)
+	if err != nil {
+		if errors.Is(err, storage.ErrDocumentNotFound) {
+			writeError(w, http.StatusNotFound, "document not found")
+
+			return
+		}
+
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	stats, err := session.DocumentStats(UserIDFromContext(r.Context()))
+	if err != nil {
+		if errors.Is(err, acl.ErrAccessDenied) {
+			writeError(w, http.StatusForbidden, "access denied")
+
+			return
+		}
+
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	meta, err := s.store.LoadMetadata(r.Context(), docID)
+	if err != nil {
+		if errors.Is(err, storage.ErrDocumentNotFound) {
+			writeError(w, http.StatusNotFound, "document not found")
+
+			return
+		}
+
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	resp := apitypes.DocumentStatsResponse{
+		ID:            docID,
+		Revision:      stats.Revision,
+		Characters:    stats.Characters,
+		Words:         stats.Words,
+		Collaborators: meta.Editors,
+		CreatedAt:     meta.CreatedAt,
+		LastEditedBy:  meta.LastEditedBy,
+	}
+
+	if !meta.LastEditedAt.IsZero() {
+		resp.LastEditedAt = &meta.LastEditedAt
+	}
+
+	if !meta.ArchivedAt.IsZero() {
+		resp.ArchivedAt = &meta.ArchivedAt
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
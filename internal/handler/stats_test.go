@@ -0,0 +1,391 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// failingMetadataStore is a MemoryStore whose LoadMetadata always fails.
+type failingMetadataStore struct {
+	*storage.MemoryStore
+}
+
+func (failingMetadataStore) LoadMetadata(context.Context, string) (storage.Metadata, error) {
+	return storage.Metadata{}, errors.New("metadata unavailable")
+}
+
+func newStatsServer(t *testing.T, store storage.Store) (http.Handler, *collab.Manager) {
+	t.Helper()
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Editor))
+	require.NoError(t, permStore.Grant("doc1", "bob", acl.Editor))
+
+	hub := ws.NewHub()
+	manager := collab.NewManager(collab.ManagerConfig{
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+	})
+
+	server := handler.NewServer(handler.ServerConfig{
+		Manager:   manager,
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+	})
+
+	return server.Handler(), manager
+}
+
+func TestHandleDocumentStats(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.SaveSnapshot(t.Context(), "doc1", 0, "hello"))
+
+	h, manager := newStatsServer(t, store)
+
+	serve := func(method, target, userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("X-User-Id", userID)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	// Before any edit, counts come from the loaded snapshot
+	rec := serve(http.MethodGet, "/v1/documents/doc1/stats", "alice")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp apitypes.DocumentStatsResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+
+	if resp.Characters != 5 || resp.Words != 1 || resp.Revision != 0 || resp.Collaborators != 0 {
+		t.Errorf("unexpected stats: %+v", resp)
+	}
+
+	if resp.LastEditedAt != nil || resp.LastEditedBy != "" {
+		t.Errorf("expected no last edit, got %+v", resp)
+	}
+
+	// Edits update the counts and the edit metadata
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	_, err = session.ApplyOperation("c1", "alice", ot.NewInsert(" world", 5, "alice"), 0)
+	require.NoError(t, err)
+
+	_, err = session.ApplyOperation("c2", "bob", ot.NewInsert("!", 11, "bob"), 1)
+	require.NoError(t, err)
+
+	rec = serve(http.MethodGet, "/v1/documents/doc1/stats", "alice")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	resp = apitypes.DocumentStatsResponse{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+
+	require.NotNil(t, resp.LastEditedAt)
+	require.Equal(t, apitypes.DocumentStatsResponse{
+		ID:            "doc1",
+		Revision:      2,
+		Characters:    12,
+		Words:         2,
+		Collaborators: 2,
+		CreatedAt:     resp.CreatedAt,
+		LastEditedAt:  resp.LastEditedAt,
+		LastEditedBy:  "bob",
+	}, resp)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		userID string
+		status int
+	}{
+		{"denies users without access", http.MethodGet, "/v1/documents/doc1/stats", "mallory", http.StatusForbidden},
+		{"returns 404 for missing document", http.MethodGet, "/v1/documents/missing/stats", "alice", 404},
+		{"rejects other methods", http.MethodPost, "/v1/documents/doc1/stats", "alice", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := serve(tt.method, tt.target, tt.userID)
+			if rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rec.Code)
+			}
+		})
+	}
+}
+
+func TestHandleDocumentStats_StorageErrors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("metadata error", func(t *testing.T) {
+		t.Parallel()
+
+		store := failingMetadataStore{storage.NewMemoryStore()}
+		require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+		h, _ := newStatsServer(t, store)
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/documents/doc1/stats", nil)
+		req.Header.Set("X-User-Id", "alice")
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("expected status 500, got %d", rec.Code)
+		}
+	})
+
+	t.Run("metadata error once the session is open", func(t *testing.T) {
+		t.Parallel()
+
+		store := storage.NewMemoryStore()
+		require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+		require.NoError(t, store.CreateDocument(t.Context(), "doc2"))
+
+		broken := failingMetadataStore{MemoryStore: store}
+		permStore := acl.NewMemoryStore()
+		require.NoError(t, permStore.Grant("doc1", "alice", acl.Editor))
+		require.NoError(t, permStore.Grant("doc2", "alice", acl.Editor))
+
+		// The sessions are open already, so only the metadata read fails
+		manager := collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore})
+		for _, docID := range []string{"doc1", "doc2"} {
+			_, err := manager.GetOrCreateSession(t.Context(), docID)
+			require.NoError(t, err)
+		}
+
+		h := handler.NewServer(handler.ServerConfig{Manager: manager, Store: broken, PermStore: permStore}).Handler()
+
+		rec := serveAs(h, "alice", http.MethodGet, "/v1/documents/doc1/stats", "")
+		require.Equal(t, http.StatusInternalServerError, rec.Code, rec.Body.String())
+
+		// A document deleted from under its session is gone
+		h = handler.NewServer(handler.ServerConfig{Manager: manager, Store: store, PermStore: permStore}).Handler()
+		require.NoError(t, store.DeleteDocument(t.Context(), "doc2"))
+
+		rec = serveAs(h, "alice", http.MethodGet, "/v1/documents/doc2/stats", "")
+		require.Equal(t, http.StatusNotFound, rec.Code, rec.Body.String())
+	})
+
+	t.Run("session load error", func(t *testing.T) {
+		t.Parallel()
+
+		store := &failingLoadStore{MemoryStore: storage.NewMemoryStore()}
+		require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+		h, _ := newStatsServer(t, store)
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/documents/doc1/stats", nil)
+		req.Header.Set("X-User-Id", "alice")
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("expected status 500, got %d", rec.Code)
+		}
+	})
+}
+
+func serveHead(h http.Handler, target, userID string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodHead, target, nil)
+	req.Header.Set("X-User-Id", userID)
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestHandleHeadDocument(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	h, manager := newStatsServer(t, store)
+
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	_, err = session.ApplyOperation("c1", "alice", ot.NewInsert("a", 0, "alice"), 0)
+	require.NoError(t, err)
+
+	meta, err := store.LoadMetadata(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	lastModified := meta.LastEditedAt.UTC().Format(http.TimeFormat)
+
+	rec := serveHead(h, "/v1/documents/doc1", "alice", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	if rec.Body.Len() != 0 {
+		t.Errorf("expected no body, got %q", rec.Body.String())
+	}
+
+	headers := map[string]string{"ETag": `"1"`, "X-Document-Revision": "1", "Last-Modified": lastModified}
+	for name, want := range headers {
+		if got := rec.Header().Get(name); got != want {
+			t.Errorf("expected %s %q, got %q", name, want, got)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"matching If-None-Match", map[string]string{"If-None-Match": `"1"`}, http.StatusNotModified},
+		{"stale If-None-Match", map[string]string{"If-None-Match": `"0"`}, http.StatusOK},
+		{"If-Modified-Since at last edit", map[string]string{"If-Modified-Since": lastModified}, http.StatusNotModified},
+		{
+			"If-Modified-Since before last edit",
+			map[string]string{"If-Modified-Since": meta.LastEditedAt.Add(-time.Hour).UTC().Format(http.TimeFormat)},
+			http.StatusOK,
+		},
+		{"invalid If-Modified-Since", map[string]string{"If-Modified-Since": "yesterday"}, http.StatusOK},
+		{
+			"If-None-Match overrides If-Modified-Since",
+			map[string]string{"If-None-Match": `"0"`, "If-Modified-Since": lastModified},
+			http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if rec := serveHead(h, "/v1/documents/doc1", "alice", tt.headers); rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rec.Code)
+			}
+		})
+	}
+}
+
+func TestHandleHeadDocument_NewDocument(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	h, _ := newStatsServer(t, store)
+
+	meta, err := store.LoadMetadata(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	// Without edits, the creation time is the modification time
+	rec := serveHead(h, "/v1/documents/doc1", "alice", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, meta.CreatedAt.UTC().Format(http.TimeFormat), rec.Header().Get("Last-Modified"))
+	require.Equal(t, "0", rec.Header().Get("X-Document-Revision"))
+}
+
+func TestHandleHeadDocument_Errors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		store  storage.Store
+		userID string
+		status int
+	}{
+		{"no read access", storage.NewMemoryStore(), "mallory", http.StatusForbidden},
+		{
+			"metadata fails",
+			failingMetadataStore{MemoryStore: storage.NewMemoryStore()},
+			"alice",
+			http.StatusInternalServerError,
+		},
+		{"load fails", &failingLoadStore{MemoryStore: storage.NewMemoryStore()}, "alice", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.NoError(t, tt.store.CreateDocument(t.Context(), "doc1"))
+
+			h, _ := newStatsServer(t, tt.store)
+
+			if rec := serveHead(h, "/v1/documents/doc1", tt.userID, nil); rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rec.Code)
+			}
+		})
+	}
+
+	t.Run("missing document", func(t *testing.T) {
+		t.Parallel()
+
+		h, _ := newStatsServer(t, storage.NewMemoryStore())
+
+		if rec := serveHead(h, "/v1/documents/missing", "alice", nil); rec.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rec.Code)
+		}
+	})
+
+	t.Run("document deleted behind an open session", func(t *testing.T) {
+		t.Parallel()
+
+		store := storage.NewMemoryStore()
+		require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+		h, manager := newStatsServer(t, store)
+
+		_, err := manager.GetOrCreateSession(t.Context(), "doc1")
+		require.NoError(t, err)
+		require.NoError(t, store.DeleteDocument(t.Context(), "doc1"))
+
+		if rec := serveHead(h, "/v1/documents/doc1", "alice", nil); rec.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rec.Code)
+		}
+	})
+
+	t.Run("permission lookup fails", func(t *testing.T) {
+		t.Parallel()
+
+		store := storage.NewMemoryStore()
+		require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+		server := handler.NewServer(handler.ServerConfig{
+			Manager: collab.NewManager(collab.ManagerConfig{
+				Store:     store,
+				PermStore: failingRoleStore{MemoryStore: acl.NewMemoryStore()},
+			}),
+			Store: store,
+		})
+
+		rec := serveHead(server.Handler(), "/v1/documents/doc1", "alice", nil)
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("expected status 500, got %d", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// handleTags handles GET and PUT /v1/documents/{id}/tags.
+// Reading tags needs read access; replacing them needs write access.
+func (s *Server) handleTags(w http.ResponseWriter, r *http.Request) {
+	var action acl.Action
+
+	switch r.Method {
+	case http.MethodGet:
+		action = acl.ActionRead
+	case http.MethodPut:
+		action = acl.ActionWrite
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	docID := r.PathValue("docID")
+
+	if s.permStore != nil {
+		checker := acl.NewChecker(s.permStore)
+		if err := checker.RequirePermission(docID, UserIDFromContext(r.Context()), action); err != nil {
+			s.writeTagsError(w, r, err)
+
+			return
+		}
+	}
+
+	if r.Method == http.MethodPut && !s.setTags(w, r, docID) {
+		return
+	}
+
+	meta, err := s.store.LoadMetadata(r.Context(), docID)
+	if err != nil {
+		s.writeTagsError(w, r, err)
+
+		return
+	}
+
+	tags := meta.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	writeJSON(w, http.StatusOK, apitypes.TagsResponse{ID: docID, Tags: tags})
+}
+
+// setTags decodes a SetTagsRequest and stores the tags. It writes the error
+// response and returns false if the request can't be applied.
+func (s *Server) setTags(w http.ResponseWriter, r *http.Request, docID string) bool {
+	var req apitypes.SetTagsRequest
+	if !s.decodeJSON(w, r, &req) {
+		return false
+	}
+
+	if err := req.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return false
+	}
+
+	if err := s.store.SetTags(r.Context(), docID, req.Tags); err != nil {
+		s.writeTagsError(w, r, err)
+
+		return false
+	}
+
+	return true
+}
+
+// writeTagsError maps a permission or storage error to a response.
+func (s *Server) writeTagsError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, acl.ErrAccessDenied):
+		writeError(w, http.StatusForbidden, "access denied")
+	case errors.Is(err, storage.ErrDocumentNotFound):
+		writeError(w, http.StatusNotFound, "document not found")
+	default:
+		s.logger.ErrorContext(r.Context(), "tags request failed", logging.DocID(r.PathValue("docID")), logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
@@ -0,0 +1,101 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleTags(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	h, _ := newStatsServer(t, store)
+
+	// A new document has an empty list, not null
+	rec := serveAs(h, "bob", http.MethodGet, "/v1/documents/doc1/tags", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"id": "doc1", "tags": []}`, rec.Body.String())
+
+	rec = serveAs(h, "alice", http.MethodPut, "/v1/documents/doc1/tags", `{"tags": ["q1", "finance", "q1"]}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	want := apitypes.TagsResponse{ID: "doc1", Tags: []string{"finance", "q1"}}
+
+	var resp apitypes.TagsResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, want, resp)
+
+	rec = serveAs(h, "bob", http.MethodGet, "/v1/documents/doc1/tags", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, want, resp)
+}
+
+func TestHandleTags_Errors(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc2"))
+
+	acls, _ := newStatsServer(t, store)
+
+	noACL := handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store}),
+		Store:   store,
+	}).Handler()
+
+	brokenMetadata := failingMetadataStore{MemoryStore: storage.NewMemoryStore()}
+	require.NoError(t, brokenMetadata.CreateDocument(t.Context(), "doc1"))
+
+	failing := handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: brokenMetadata}),
+		Store:   brokenMetadata,
+	}).Handler()
+
+	brokenACL := handler.NewServer(handler.ServerConfig{
+		Manager:   collab.NewManager(collab.ManagerConfig{Store: store}),
+		Store:     store,
+		PermStore: failingRoleStore{MemoryStore: acl.NewMemoryStore()},
+	}).Handler()
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		userID  string
+		method  string
+		target  string
+		body    string
+		status  int
+	}{
+		{"no read access", acls, "mallory", http.MethodGet, "/v1/documents/doc1/tags", "", http.StatusForbidden},
+		{"no write access", acls, "mallory", http.MethodPut, "/v1/documents/doc1/tags", `{"tags": []}`, 403},
+		{"invalid tag", acls, "alice", http.MethodPut, "/v1/documents/doc1/tags", `{"tags": ["a b"]}`, 400},
+		{"invalid body", acls, "alice", http.MethodPut, "/v1/documents/doc1/tags", `{"tags": "a"}`, 400},
+		{"other methods", acls, "alice", http.MethodPost, "/v1/documents/doc1/tags", "", 405},
+		{"missing document", noACL, "alice", http.MethodGet, "/v1/documents/missing/tags", "", 404},
+		{"set on missing document", noACL, "alice", http.MethodPut, "/v1/documents/missing/tags", `{"tags": []}`, 404},
+		{"metadata fails", failing, "alice", http.MethodGet, "/v1/documents/doc1/tags", "", 500},
+		{"permission lookup fails", brokenACL, "alice", http.MethodGet, "/v1/documents/doc2/tags", "", 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if rec := serveAs(tt.handler, tt.userID, tt.method, tt.target, tt.body); rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// defaultRequestTimeout bounds requests when ServerConfig.RequestTimeout is unset.
+const defaultRequestTimeout = 30 * time.Second
+
+// longLivedPatterns are routes that hold the connection open by design and
+// manage their own lifetime, so the request timeout doesn't apply to them.
+var longLivedPatterns = map[string]bool{
+	webSocketPath:                            true,
+	yjsPath:                                  true,
+	shareDBPath:                              true,
+	apiPrefix + "/events":                    true,
+	apiPrefix + "/documents/{docID}/changes": true,
+}
+
+// timeoutMiddleware gives each request a deadline. Handlers pass the request
+// context down to the session manager and store, so a slow document load is
+// abandoned once the deadline passes or the client goes away.
+func (s *Server) timeoutMiddleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if longLived(mux, r) {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), s.requestTimeout)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// deadlineMiddleware makes requests that fail because they ran out of time
+// report 503 instead of 500. It wraps the mux directly, so the access log and
+// compression see the replacement response. Long-lived requests have no
+// deadline and keep the original writer, which WebSocket upgrades need.
+func deadlineMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); !ok {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		next.ServeHTTP(&deadlineWriter{ResponseWriter: w, ctx: r.Context()}, r)
+	})
+}
+
+// longLived reports whether r streams its response or waits for changes.
+// GraphQL subscriptions share their route with ordinary queries.
+func longLived(mux *http.ServeMux, r *http.Request) bool {
+	if _, pattern := mux.Handler(r); longLivedPatterns[pattern] {
+		return true
+	}
+
+	return r.URL.Path == graphQLPath && r.Header.Get("Accept") == "text/event-stream"
+}
+
+// deadlineWriter replaces internal errors caused by the request deadline with
+// 503, discarding the handler's own error body.
+type deadlineWriter struct {
+	http.ResponseWriter
+
+	ctx      context.Context
+	timedOut bool
+}
+
+func (d *deadlineWriter) WriteHeader(status int) {
+	if status == http.StatusInternalServerError && errors.Is(d.ctx.Err(), context.DeadlineExceeded) {
+		d.timedOut = true
+		writeError(d.ResponseWriter, http.StatusServiceUnavailable, "request timed out")
+
+		return
+	}
+
+	d.ResponseWriter.WriteHeader(status)
+}
+
+func (d *deadlineWriter) Write(b []byte) (int, error) {
+	if d.timedOut {
+		return len(b), nil
+	}
+
+	return d.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (d *deadlineWriter) Unwrap() http.ResponseWriter {
+	return d.ResponseWriter
+}
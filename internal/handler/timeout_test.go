@@ -0,0 +1,87 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// slowStore is a MemoryStore whose LoadSnapshot takes delay to answer, or
+// fails with the context's error if it's done first.
+type slowStore struct {
+	*storage.MemoryStore
+
+	delay time.Duration
+}
+
+func (s slowStore) LoadSnapshot(ctx context.Context, docID string) (storage.Snapshot, error) {
+	select {
+	case <-ctx.Done():
+		return storage.Snapshot{}, ctx.Err()
+	case <-time.After(s.delay):
+		return s.MemoryStore.LoadSnapshot(ctx, docID)
+	}
+}
+
+func newTimeoutServer(t *testing.T, timeout time.Duration) http.Handler {
+	t.Helper()
+
+	store := slowStore{MemoryStore: storage.NewMemoryStore(), delay: 50 * time.Millisecond}
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	hub := ws.NewHub()
+	server := handler.NewServer(handler.ServerConfig{
+		Manager:        collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub}),
+		Store:          store,
+		Hub:            hub,
+		RequestTimeout: timeout,
+	})
+
+	return server.Handler()
+}
+
+func TestRequestTimeout(t *testing.T) {
+	t.Parallel()
+
+	h := newTimeoutServer(t, 10*time.Millisecond)
+
+	rec := serveAs(h, "alice", http.MethodGet, "/v1/documents/doc1", "")
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code, rec.Body.String())
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var resp apitypes.ErrorResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, apitypes.ErrorResponse{Code: apitypes.ErrorCodeTimeout, Message: "request timed out"}, resp)
+
+	// HEAD responses carry the status alone
+	rec = serveAs(h, "alice", http.MethodHead, "/v1/documents/doc1", "")
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestRequestTimeout_LongLivedRoutes(t *testing.T) {
+	t.Parallel()
+
+	h := newTimeoutServer(t, 10*time.Millisecond)
+
+	// Change polling outlasts the request timeout
+	rec := serveAs(h, "alice", http.MethodGet, "/v1/documents/doc1/changes?since=0&timeout=0s", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
+
+func TestRequestTimeout_WithinLimit(t *testing.T) {
+	t.Parallel()
+
+	h := newTimeoutServer(t, 0)
+
+	rec := serveAs(h, "alice", http.MethodGet, "/v1/documents/doc1", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
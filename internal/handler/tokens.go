@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/auth"
+	"github.com/serroba/online-docs/internal/logging"
+)
+
+// accessTokenParam carries the access token on WebSocket upgrades, since
+// browsers can't set headers on those requests.
+const accessTokenParam = "access_token"
+
+// handleLogin handles POST /auth/login. It exchanges the caller's current
+// authentication for an access token and a refresh token. Service accounts
+// keep using their API keys, which carry scopes that tokens don't.
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	if _, ok := apiKeyFromContext(r.Context()); ok {
+		writeError(w, http.StatusForbidden, "service accounts must authenticate with an API key")
+
+		return
+	}
+
+	pair, err := s.tokens.Issue(UserIDFromContext(r.Context()))
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "failed to issue tokens", logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	writeTokens(w, pair)
+}
+
+// handleRefreshToken handles POST /auth/refresh, rotating a refresh token
+// into a new token pair.
+func (s *Server) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	var req apitypes.RefreshTokenRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	pair, err := s.tokens.Refresh(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrTokenExpired) {
+			writeError(w, http.StatusUnauthorized, "invalid or expired refresh token")
+
+			return
+		}
+
+		s.logger.ErrorContext(r.Context(), "failed to refresh tokens", logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	writeTokens(w, pair)
+}
+
+// handleRevokeToken handles POST /auth/revoke. Revoking either token of a
+// pair ends the login it came from. Unknown tokens are ignored, so clients
+// can always treat revocation as done.
+func (s *Server) handleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	var req apitypes.RevokeTokenRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	if err := s.tokens.Revoke(req.Token); err != nil && !errors.Is(err, auth.ErrInvalidToken) {
+		s.logger.ErrorContext(r.Context(), "failed to revoke token", logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeTokens writes a token pair. Responses with tokens must not be cached.
+func writeTokens(w http.ResponseWriter, pair auth.TokenPair) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, apitypes.TokenResponse{
+		TokenType:        "Bearer",
+		AccessToken:      pair.AccessToken,
+		ExpiresAt:        pair.AccessExpiresAt,
+		RefreshToken:     pair.RefreshToken,
+		RefreshExpiresAt: pair.RefreshExpiresAt,
+	})
+}
+
+// bearerToken returns the access token or JWT from the Authorization header
+// or, on WebSocket upgrades, the access_token query parameter or the bearer
+// subprotocol.
+func (s *Server) bearerToken(r *http.Request) (string, bool) {
+	if s.tokens == nil && s.jwt == nil {
+		return "", false
+	}
+
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token != "" {
+		return token, true
+	}
+
+	if r.URL.Path == webSocketPath || r.URL.Path == shareDBPath || r.Pattern == yjsPath {
+		if token := r.URL.Query().Get(accessTokenParam); token != "" {
+			return token, true
+		}
+
+		return subprotocolToken(r)
+	}
+
+	return "", false
+}
+
+// authenticateToken resolves an access token or JWT to its user.
+func (s *Server) authenticateToken(w http.ResponseWriter, r *http.Request, token string, next http.Handler) {
+	if s.jwt != nil && (s.tokens == nil || isJWT(token)) {
+		s.authenticateJWT(w, r, token, next)
+
+		return
+	}
+
+	userID, err := s.tokens.Authenticate(token)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrTokenExpired) {
+			writeError(w, http.StatusUnauthorized, "invalid or expired access token")
+
+			return
+		}
+
+		s.logger.ErrorContext(r.Context(), "failed to authenticate access token", logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	next.ServeHTTP(w, r.WithContext(withUserID(r.Context(), userID)))
+}
@@ -0,0 +1,216 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apikey"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/auth"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+var errTokens = errors.New("tokens unavailable")
+
+// failingTokenStore is an auth.TokenStore whose methods always fail.
+type failingTokenStore struct{}
+
+func (failingTokenStore) Save(auth.Grant) error { return errTokens }
+
+func (failingTokenStore) GetByTokenHash(string) (auth.Grant, error) { return auth.Grant{}, errTokens }
+
+func (failingTokenStore) Delete(string) error { return errTokens }
+
+type tokenTestEnv struct {
+	handler http.Handler
+	apiKeys *apikey.Service
+}
+
+func newTokenTestEnv(t *testing.T, tokens *auth.TokenManager) *tokenTestEnv {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Owner))
+
+	hub := ws.NewHub()
+	apiKeys := apikey.NewService(apikey.NewMemoryStore())
+
+	server := handler.NewServer(handler.ServerConfig{
+		Manager:   collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore, Hub: hub}),
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+		APIKeys:   apiKeys,
+		Tokens:    tokens,
+	})
+
+	return &tokenTestEnv{handler: server.Handler(), apiKeys: apiKeys}
+}
+
+func (e *tokenTestEnv) post(target, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	rec := httptest.NewRecorder()
+	e.handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func (e *tokenTestEnv) getDocument(accessToken string) int {
+	req := httptest.NewRequest(http.MethodGet, "/v1/documents/doc1", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	rec := httptest.NewRecorder()
+	e.handler.ServeHTTP(rec, req)
+
+	return rec.Code
+}
+
+func decodeTokens(t *testing.T, rec *httptest.ResponseRecorder) apitypes.TokenResponse {
+	t.Helper()
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+
+	var resp apitypes.TokenResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, "Bearer", resp.TokenType)
+
+	return resp
+}
+
+func TestTokens(t *testing.T) {
+	t.Parallel()
+
+	env := newTokenTestEnv(t, auth.NewTokenManager(auth.NewMemoryTokenStore(), 0, 0))
+
+	login := decodeTokens(t, env.post("/auth/login", "", http.Header{"X-User-Id": {"alice"}}))
+	require.Equal(t, http.StatusOK, env.getDocument(login.AccessToken))
+
+	refreshed := decodeTokens(t, env.post("/auth/refresh", `{"refreshToken": "`+login.RefreshToken+`"}`, nil))
+	require.Equal(t, http.StatusOK, env.getDocument(refreshed.AccessToken))
+	require.Equal(t, http.StatusUnauthorized, env.getDocument(login.AccessToken))
+
+	rec := env.post("/auth/revoke", `{"token": "`+refreshed.RefreshToken+`"}`, nil)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Equal(t, http.StatusUnauthorized, env.getDocument(refreshed.AccessToken))
+
+	// Revoking again is harmless
+	rec = env.post("/auth/revoke", `{"token": "`+refreshed.RefreshToken+`"}`, nil)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+func TestTokens_WebSocketHandshake(t *testing.T) {
+	t.Parallel()
+
+	env := newTokenTestEnv(t, auth.NewTokenManager(auth.NewMemoryTokenStore(), 0, 0))
+	tokens := decodeTokens(t, env.post("/auth/login", "", http.Header{"X-User-Id": {"alice"}}))
+
+	server := httptest.NewServer(env.handler)
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/ws?docId=doc1&access_token=" + tokens.AccessToken
+
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+
+	_ = resp.Body.Close()
+
+	var msg ws.Message
+	require.NoError(t, conn.ReadJSON(&msg))
+	require.Equal(t, ws.MessageTypeState, msg.Type)
+	require.NoError(t, conn.Close())
+
+	// The query parameter is only accepted on the WebSocket endpoint
+	req := httptest.NewRequest(http.MethodGet, "/v1/documents/doc1?access_token="+tokens.AccessToken, nil)
+	rec := httptest.NewRecorder()
+	env.handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestTokens_Errors(t *testing.T) {
+	t.Parallel()
+
+	env := newTokenTestEnv(t, auth.NewTokenManager(auth.NewMemoryTokenStore(), 0, 0))
+	broken := newTokenTestEnv(t, auth.NewTokenManager(failingTokenStore{}, 0, 0))
+
+	_, secret, err := env.apiKeys.Issue("alice", "bot", []apikey.Scope{apikey.ScopeWrite})
+	require.NoError(t, err)
+
+	alice := http.Header{"X-User-Id": {"alice"}}
+
+	tests := []struct {
+		name   string
+		env    *tokenTestEnv
+		target string
+		body   string
+		header http.Header
+		status int
+	}{
+		{"login without authentication", env, "/auth/login", "", nil, http.StatusUnauthorized},
+		{"login with an API key", env, "/auth/login", "", http.Header{"X-Api-Key": {secret}}, http.StatusForbidden},
+		{"login fails", broken, "/auth/login", "", alice, http.StatusInternalServerError},
+		{"unknown refresh token", env, "/auth/refresh", `{"refreshToken": "odr_x"}`, nil, http.StatusUnauthorized},
+		{"refresh without token", env, "/auth/refresh", `{}`, nil, http.StatusBadRequest},
+		{"refresh with invalid body", env, "/auth/refresh", `{"refresh": "x"}`, nil, http.StatusBadRequest},
+		{"refresh fails", broken, "/auth/refresh", `{"refreshToken": "odr_x"}`, nil, http.StatusInternalServerError},
+		{"revoke without token", env, "/auth/revoke", `{}`, nil, http.StatusBadRequest},
+		{"revoke with invalid body", env, "/auth/revoke", `[]`, nil, http.StatusBadRequest},
+		{"revoke fails", broken, "/auth/revoke", `{"token": "oda_x"}`, nil, http.StatusInternalServerError},
+		{
+			"invalid access token", env, "/v1/documents", `{}`,
+			http.Header{"Authorization": {"Bearer oda_x"}, "X-User-Id": {"alice"}}, http.StatusUnauthorized,
+		},
+		{
+			"access token lookup fails", broken, "/v1/documents", `{}`,
+			http.Header{"Authorization": {"Bearer oda_x"}}, http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if rec := tt.env.post(tt.target, tt.body, tt.header); rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	for _, target := range []string{"/auth/login", "/auth/refresh", "/auth/revoke"} {
+		if rec := serveAs(env.handler, "alice", http.MethodGet, target, ""); rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("GET %s: expected status 405, got %d", target, rec.Code)
+		}
+	}
+
+	t.Run("disabled without token manager", func(t *testing.T) {
+		t.Parallel()
+
+		h := newTokenTestEnv(t, nil)
+
+		rec := h.post("/auth/login", "", alice)
+		require.Equal(t, http.StatusNotFound, rec.Code)
+
+		// Bearer tokens are ignored, so the X-User-Id header still applies
+		header := http.Header{"Authorization": {"Bearer oda_x"}, "X-User-Id": {"alice"}}
+
+		rec = h.post("/v1/documents", `{"id": "doc2"}`, header)
+		require.Equal(t, http.StatusCreated, rec.Code)
+	})
+}
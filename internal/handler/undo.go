@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// handleUndo handles POST /v1/documents/{id}/undo.
+// It reverts the caller's latest edit, keeping everyone else's.
+func (s *Server) handleUndo(w http.ResponseWriter, r *http.Request) {
+	s.handleRevert(w, r, (*collab.Session).Undo)
+}
+
+// handleRedo handles POST /v1/documents/{id}/redo.
+// It reverts the caller's latest undo.
+func (s *Server) handleRedo(w http.ResponseWriter, r *http.Request) {
+	s.handleRevert(w, r, (*collab.Session).Redo)
+}
+
+// handleRevert applies revert to the document's session on behalf of the
+// caller. The operation has no client, so every client receives it.
+func (s *Server) handleRevert(
+	w http.ResponseWriter, r *http.Request, revert func(session *collab.Session, clientID, userID string) (int, error),
+) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	docID := r.PathValue("docID")
+	userID := UserIDFromContext(r.Context())
+
+	session, err := s.manager.GetOrCreateSession(r.Context(), docID)
+	if err == nil {
+		var revision int
+
+		revision, err = revert(session, "", userID)
+		if err == nil {
+			writeJSON(w, http.StatusOK, apitypes.RevertResponse{Revision: revision})
+
+			return
+		}
+	}
+
+	switch {
+	case errors.Is(err, storage.ErrDocumentNotFound):
+		writeError(w, http.StatusNotFound, "document not found")
+	case errors.Is(err, acl.ErrAccessDenied):
+		writeError(w, http.StatusForbidden, "write access denied")
+	case errors.Is(err, collab.ErrDocumentArchived):
+		writeError(w, http.StatusConflict, "document is archived")
+	case errors.Is(err, collab.ErrNothingToUndo), errors.Is(err, collab.ErrNothingToRedo):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		s.logger.ErrorContext(r.Context(), "failed to revert edit",
+			logging.DocID(docID), logging.UserID(userID), logging.Err(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
@@ -0,0 +1,82 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUndoRedo(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "archived"))
+	require.NoError(t, store.SetArchived(t.Context(), "archived", true))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Editor))
+	require.NoError(t, permStore.Grant("doc1", "bob", acl.Viewer))
+	require.NoError(t, permStore.Grant("archived", "alice", acl.Editor))
+
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore})
+	h := handler.NewServer(handler.ServerConfig{Manager: manager, Store: store, PermStore: permStore}).Handler()
+
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	_, err = session.ApplyOperation("c1", "alice", ot.NewInsert("a", 0, "alice"), 0)
+	require.NoError(t, err)
+
+	rec := serveAs(h, "alice", http.MethodPost, "/v1/documents/doc1/undo", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp apitypes.RevertResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, 2, resp.Revision)
+
+	content, _, err := session.GetState("alice")
+	require.NoError(t, err)
+	require.Empty(t, content)
+
+	rec = serveAs(h, "alice", http.MethodPost, "/v1/documents/doc1/undo", "")
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = serveAs(h, "alice", http.MethodPost, "/v1/documents/doc1/redo", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	content, _, err = session.GetState("alice")
+	require.NoError(t, err)
+	require.Equal(t, "a", content)
+
+	tests := []struct {
+		name   string
+		userID string
+		method string
+		target string
+		want   int
+	}{
+		{"nothing to redo", "alice", http.MethodPost, "/v1/documents/doc1/redo", http.StatusConflict},
+		{"viewer", "bob", http.MethodPost, "/v1/documents/doc1/undo", http.StatusForbidden},
+		{"archived", "alice", http.MethodPost, "/v1/documents/archived/undo", http.StatusConflict},
+		{"missing document", "alice", http.MethodPost, "/v1/documents/missing/undo", http.StatusNotFound},
+		{"wrong method", "alice", http.MethodGet, "/v1/documents/doc1/undo", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := serveAs(h, tt.userID, tt.method, tt.target, "")
+			require.Equal(t, tt.want, rec.Code, rec.Body.String())
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/webhook"
+)
+
+// handleWebhooks routes GET and POST requests for /v1/webhooks.
+func (s *Server) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.handleListWebhooks(w, r)
+	case http.MethodPost:
+		s.handleCreateWebhook(w, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleWebhookByID handles DELETE /v1/webhooks/{id}.
+func (s *Server) handleWebhookByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	if err := s.webhooks.Remove(UserIDFromContext(r.Context()), r.PathValue("hookID")); err != nil {
+		if errors.Is(err, webhook.ErrWebhookNotFound) {
+			writeError(w, http.StatusNotFound, "webhook not found")
+
+			return
+		}
+
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCreateWebhook handles POST /v1/webhooks.
+func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req apitypes.CreateWebhookRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	events := make([]webhook.EventType, 0, len(req.Events))
+
+	for _, name := range req.Events {
+		event, err := webhook.ParseEventType(name)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "unknown event "+name)
+
+			return
+		}
+
+		events = append(events, event)
+	}
+
+	hook, err := s.webhooks.Register(UserIDFromContext(r.Context()), req.URL, events)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, apitypes.CreateWebhookResponse{
+		Webhook: toWebhook(hook),
+		Secret:  hook.Secret,
+	})
+}
+
+// handleListWebhooks handles GET /v1/webhooks.
+func (s *Server) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := s.webhooks.List(UserIDFromContext(r.Context()))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal server error")
+
+		return
+	}
+
+	resp := apitypes.ListWebhooksResponse{Webhooks: make([]apitypes.Webhook, 0, len(hooks))}
+	for _, hook := range hooks {
+		resp.Webhooks = append(resp.Webhooks, toWebhook(hook))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// publishEvent notifies webhooks of a document lifecycle event.
+func (s *Server) publishEvent(eventType webhook.EventType, docID, userID string) {
+	if s.webhooks == nil {
+		return
+	}
+
+	s.webhooks.Publish(webhook.Event{Type: eventType, DocID: docID, UserID: userID})
+}
+
+// toWebhook converts a webhook into its API representation.
+func toWebhook(hook webhook.Webhook) apitypes.Webhook {
+	events := make([]string, 0, len(hook.Events))
+	for _, event := range hook.Events {
+		events = append(events, string(event))
+	}
+
+	return apitypes.Webhook{
+		ID:        hook.ID,
+		URL:       hook.URL,
+		Events:    events,
+		CreatedAt: hook.CreatedAt,
+	}
+}
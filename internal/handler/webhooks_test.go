@@ -0,0 +1,183 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apitypes"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/webhook"
+	"github.com/stretchr/testify/require"
+)
+
+func newWebhookServer(t *testing.T, store webhook.Store) (http.Handler, *webhook.Service) {
+	t.Helper()
+
+	docs := storage.NewMemoryStore()
+	permStore := acl.NewMemoryStore()
+	webhooks := webhook.NewService(webhook.Config{
+		Store:     store,
+		PermStore: permStore,
+		Logger:    slog.New(slog.DiscardHandler),
+	})
+	t.Cleanup(webhooks.Close)
+
+	server := handler.NewServer(handler.ServerConfig{
+		Manager:   collab.NewManager(collab.ManagerConfig{Store: docs, PermStore: permStore}),
+		Store:     docs,
+		PermStore: permStore,
+		Webhooks:  webhooks,
+	})
+
+	return server.Handler(), webhooks
+}
+
+func serveAs(h http.Handler, userID, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("X-User-Id", userID)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestWebhookRoutes(t *testing.T) {
+	t.Parallel()
+
+	h, _ := newWebhookServer(t, webhook.NewMemoryStore())
+
+	rec := serveAs(h, "alice", http.MethodPost, "/v1/webhooks",
+		`{"url": "https://example.com/hook", "events": ["document.created", "document.shared"]}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	var created apitypes.CreateWebhookResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+
+	if !strings.HasPrefix(created.Secret, "whsec_") {
+		t.Errorf("expected signing secret, got %q", created.Secret)
+	}
+
+	if len(created.Webhook.Events) != 2 {
+		t.Errorf("expected 2 events, got %v", created.Webhook.Events)
+	}
+
+	rec = serveAs(h, "alice", http.MethodGet, "/v1/webhooks", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var list apitypes.ListWebhooksResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&list))
+	require.Len(t, list.Webhooks, 1)
+
+	if strings.Contains(rec.Body.String(), created.Secret) {
+		t.Error("expected listing not to expose the secret")
+	}
+
+	rec = serveAs(h, "bob", http.MethodDelete, "/v1/webhooks/"+created.Webhook.ID, "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 deleting another user's webhook, got %d", rec.Code)
+	}
+
+	rec = serveAs(h, "alice", http.MethodDelete, "/v1/webhooks/"+created.Webhook.ID, "")
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+}
+
+func TestWebhookRoutes_Errors(t *testing.T) {
+	t.Parallel()
+
+	h, _ := newWebhookServer(t, webhook.NewMemoryStore())
+	failing, _ := newWebhookServer(t, failingWebhookStore{})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		method  string
+		target  string
+		body    string
+		status  int
+	}{
+		{"invalid body", h, http.MethodPost, "/v1/webhooks", `{`, http.StatusBadRequest},
+		{"invalid url", h, http.MethodPost, "/v1/webhooks", `{"url": "ftp://example.com"}`, http.StatusBadRequest},
+		{"unknown event", h, http.MethodPost, "/v1/webhooks", `{"url": "https://a.test", "events": ["x"]}`, 400},
+		{"method not allowed", h, http.MethodPut, "/v1/webhooks", "", http.StatusMethodNotAllowed},
+		{"delete method not allowed", h, http.MethodGet, "/v1/webhooks/h1", "", http.StatusMethodNotAllowed},
+		{"missing id", h, http.MethodDelete, "/v1/webhooks/", "", http.StatusNotFound},
+		{"create store error", failing, http.MethodPost, "/v1/webhooks", `{"url": "https://a.test"}`, 500},
+		{"list store error", failing, http.MethodGet, "/v1/webhooks", "", http.StatusInternalServerError},
+		{"delete store error", failing, http.MethodDelete, "/v1/webhooks/h1", "", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := serveAs(tt.handler, "alice", tt.method, tt.target, tt.body)
+			if rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestDocumentEvents(t *testing.T) {
+	t.Parallel()
+
+	events := make(chan webhook.Event, 2)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhook.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err == nil {
+			events <- event
+		}
+	}))
+	t.Cleanup(endpoint.Close)
+
+	h, webhooks := newWebhookServer(t, webhook.NewMemoryStore())
+
+	_, err := webhooks.Register("alice", endpoint.URL, nil)
+	require.NoError(t, err)
+
+	rec := serveAs(h, "alice", http.MethodPost, "/v1/documents", `{"id": "doc1"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	event := <-events
+	if event.Type != webhook.EventDocumentCreated || event.DocID != "doc1" || event.UserID != "alice" {
+		t.Errorf("unexpected created event %+v", event)
+	}
+
+	rec = serveAs(h, "alice", http.MethodDelete, "/v1/documents/doc1", "")
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	event = <-events
+	if event.Type != webhook.EventDocumentDeleted || event.DocID != "doc1" {
+		t.Errorf("unexpected deleted event %+v", event)
+	}
+}
+
+// failingWebhookStore is a webhook.Store whose operations always fail.
+type failingWebhookStore struct{}
+
+var errWebhookStore = errors.New("webhook store unavailable")
+
+func (failingWebhookStore) Save(webhook.Webhook) error { return errWebhookStore }
+
+func (failingWebhookStore) Get(string) (webhook.Webhook, error) {
+	return webhook.Webhook{}, errWebhookStore
+}
+
+func (failingWebhookStore) Delete(string) error { return errWebhookStore }
+
+func (failingWebhookStore) ListByOwner(string) ([]webhook.Webhook, error) {
+	return nil, errWebhookStore
+}
+
+func (failingWebhookStore) ListAll() ([]webhook.Webhook, error) { return nil, errWebhookStore }
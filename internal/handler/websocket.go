@@ -1,28 +1,32 @@
 package handler
 
 import (
+	"context"
 	"errors"
-	"log"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/logging"
 	"github.com/serroba/online-docs/internal/ot"
 	"github.com/serroba/online-docs/internal/storage"
 	"github.com/serroba/online-docs/internal/ws"
 )
 
-// handleWebSocket handles GET /ws?docId={id}.
+// handleWebSocket handles GET /v1/ws?docId={id}.
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
 
 		return
 	}
 
 	docID := r.URL.Query().Get("docId")
 	if docID == "" {
-		http.Error(w, "docId query parameter is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "docId query parameter is required")
 
 		return
 	}
@@ -36,29 +40,48 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 
 	defer cleanup()
 
-	session, err := s.initializeSession(client, docID, userID)
+	session, err := s.initializeSession(r.Context(), client, docID, userID)
 	if err != nil {
 		return
 	}
 
-	s.handleMessages(client, session, docID, userID)
+	// API keys without the write scope may only observe the document
+	if key, ok := apiKeyFromContext(r.Context()); ok && !key.Allows(acl.ActionWrite) {
+		session = readOnlySession{sessionInterface: session}
+	}
+
+	// Only clients that got the state show up to the others
+	s.hub.Announce(client)
+
+	s.handleMessages(r.Context(), client, session, docID, userID)
 }
 
 // setupWebSocketClient upgrades the connection and creates a client.
 func (s *Server) setupWebSocketClient(
 	w http.ResponseWriter, r *http.Request, docID, userID string,
 ) (*ws.Client, func(), error) {
-	conn, err := s.upgrader.Upgrade(w, r, nil)
+	// The upgrade writes its own response, so echo the request ID explicitly
+	conn, err := s.upgrader.Upgrade(w, r, http.Header{headerRequestID: {RequestIDFromContext(r.Context())}})
 	if err != nil {
-		log.Printf("websocket upgrade error: %v", err)
+		s.logger.WarnContext(r.Context(), "websocket upgrade failed", logging.Err(err))
 
 		return nil, nil, err
 	}
 
+	// Messages are capped like request bodies; a larger one closes the connection
+	conn.SetReadLimit(s.maxBodyBytes)
+
+	var clientConn ws.Conn = conn
+	if s.faults != nil {
+		clientConn = s.faults.Wrap(conn)
+	}
+
 	clientID := uuid.New().String()
-	client := ws.NewClient(clientID, userID, conn)
+	client := ws.NewClient(clientID, userID, clientConn)
 	s.hub.Register(client)
 	s.hub.Subscribe(client, docID)
+	s.logger.InfoContext(r.Context(), "websocket connected",
+		logging.ClientID(clientID), logging.UserID(userID), logging.DocID(docID))
 
 	cleanup := func() {
 		s.hub.Unregister(client)
@@ -69,8 +92,10 @@ func (s *Server) setupWebSocketClient(
 }
 
 // initializeSession gets or creates a session and sends initial state.
-func (s *Server) initializeSession(client *ws.Client, docID, userID string) (sessionInterface, error) {
-	session, err := s.manager.GetOrCreateSession(docID)
+func (s *Server) initializeSession(
+	ctx context.Context, client *ws.Client, docID, userID string,
+) (sessionInterface, error) {
+	session, err := s.manager.GetOrCreateSession(ctx, docID)
 	if err != nil {
 		if errors.Is(err, storage.ErrDocumentNotFound) {
 			_ = client.SendError(ws.ErrorCodeInvalidMessage, "document not found")
@@ -81,7 +106,7 @@ func (s *Server) initializeSession(client *ws.Client, docID, userID string) (ses
 		return nil, err
 	}
 
-	content, revision, err := session.GetState(userID)
+	content, formatting, revision, err := session.GetFormattedState(userID)
 	if err != nil {
 		if errors.Is(err, acl.ErrAccessDenied) {
 			_ = client.SendError(ws.ErrorCodeAccessDenied, "access denied")
@@ -93,12 +118,8 @@ func (s *Server) initializeSession(client *ws.Client, docID, userID string) (ses
 	}
 
 	if err := client.Send(ws.Message{
-		Type: ws.MessageTypeState,
-		Payload: ws.StatePayload{
-			DocID:    docID,
-			Content:  content,
-			Revision: revision,
-		},
+		Type:    ws.MessageTypeState,
+		Payload: s.statePayload(ctx, docID, content, formatting, revision),
 	}); err != nil {
 		return nil, err
 	}
@@ -106,28 +127,101 @@ func (s *Server) initializeSession(client *ws.Client, docID, userID string) (ses
 	return session, nil
 }
 
-// handleMessages processes incoming messages from a client.
-func (s *Server) handleMessages(client *ws.Client, session sessionInterface, docID, userID string) {
+// handleMessages processes incoming messages from a client, one at a time
+// and in the order they arrive, until it disconnects or handling a message
+// panics. Edits beyond the client's rate limit, which charges a batch for
+// each of its operations, and edits whose seq doesn't increase, are
+// rejected without being applied.
+func (s *Server) handleMessages(
+	ctx context.Context, client *ws.Client, session sessionInterface, docID, userID string,
+) {
+	limiter := ws.NewRateLimiter(s.operationRate, s.operationBurst)
+	lastSeq := 0 // Of the last edit taken
+
 	for {
 		msg, err := client.Receive()
 		if err != nil {
 			return
 		}
 
-		switch msg.Type {
-		case ws.MessageTypeOperation:
-			s.handleOperation(client, session, userID, msg)
-		case ws.MessageTypeSync:
-			s.handleSync(client, session, docID, userID)
-		case ws.MessageTypeAck, ws.MessageTypeBroadcast, ws.MessageTypeState, ws.MessageTypeError:
-			// Server-to-client messages - ignore if received from client
-			_ = client.SendError(ws.ErrorCodeInvalidMessage, "unexpected message type")
+		seq, edits := editSeq(msg)
+		if edits > 0 && !limiter.AllowN(edits) {
+			_ = client.SendEditError(seq, ws.ErrorCodeRateLimited, "operation rate exceeded, slow down")
+
+			continue
+		}
+
+		if seq != 0 {
+			if seq <= lastSeq {
+				_ = client.SendEditError(seq, ws.ErrorCodeInvalidMessage,
+					fmt.Sprintf("seq %d is not after %d; the edit was sent twice or out of order", seq, lastSeq))
+
+				continue
+			}
+
+			lastSeq = seq
+		}
+
+		if !s.handleMessage(ctx, client, session, docID, userID, msg) {
+			return
+		}
+	}
+}
+
+// editSeq returns the seq the client numbered msg with, if any, and how
+// many edits it holds: one for an operation and each of a batch's, at least
+// one, and none for other messages.
+func editSeq(msg ws.Message) (int, int) {
+	switch payload := msg.Payload.(type) {
+	case ws.OperationPayload:
+		return payload.Seq, 1
+	case ws.OperationBatchPayload:
+		return payload.Seq, max(len(payload.Operations), 1)
+	default:
+		if msg.Type == ws.MessageTypeOperation || msg.Type == ws.MessageTypeOperationBatch {
+			return 0, 1
 		}
+
+		return 0, 0
 	}
 }
 
+// handleMessage processes one message. If that panics, the client gets an
+// error frame and handleMessage returns false, so the connection is closed
+// rather than left serving a session in an unknown state.
+func (s *Server) handleMessage(
+	ctx context.Context, client *ws.Client, session sessionInterface, docID, userID string, msg ws.Message,
+) (ok bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			s.logPanic(ctx, "websocket message handler panicked", v, logging.ClientID(client.ID))
+			_ = client.SendError(ws.ErrorCodeInternalError, "internal server error")
+			ok = false
+		}
+	}()
+
+	switch msg.Type {
+	case ws.MessageTypeOperation:
+		s.handleOperation(ctx, client, session, userID, msg)
+	case ws.MessageTypeOperationBatch:
+		s.handleOperationBatch(ctx, client, session, userID, msg)
+	case ws.MessageTypeSync:
+		s.handleSync(ctx, client, session, docID, userID, msg)
+	case ws.MessageTypeCursor:
+		s.handleCursor(client, session, userID, msg)
+	case ws.MessageTypeAck, ws.MessageTypeBroadcast, ws.MessageTypeState, ws.MessageTypeCatchUp,
+		ws.MessageTypeError, ws.MessageTypePresence, ws.MessageTypeClosing, ws.MessageTypePermissionChanged:
+		// Server-to-client messages - ignore if received from client
+		_ = client.SendError(ws.ErrorCodeInvalidMessage, "unexpected message type")
+	}
+
+	return true
+}
+
 // handleOperation processes an operation message.
-func (s *Server) handleOperation(client *ws.Client, session sessionInterface, userID string, msg ws.Message) {
+func (s *Server) handleOperation(
+	ctx context.Context, client *ws.Client, session sessionInterface, userID string, msg ws.Message,
+) {
 	payload, ok := msg.Payload.(ws.OperationPayload)
 	if !ok {
 		_ = client.SendError(ws.ErrorCodeInvalidMessage, "invalid operation payload")
@@ -135,25 +229,79 @@ func (s *Server) handleOperation(client *ws.Client, session sessionInterface, us
 		return
 	}
 
-	var op ot.Operation
+	op, ok := newOperation(payload.OpType, payload.Position, payload.Char, payload.Attribute, payload.Value, userID)
+	if !ok {
+		_ = client.SendEditError(payload.Seq, ws.ErrorCodeInvalidMessage, "invalid operation type")
 
-	switch payload.OpType {
+		return
+	}
+
+	revision, err := session.ApplyOperation(client.ID, userID, op, payload.BaseRevision)
+	s.sendAck(ctx, client, payload.Seq, revision, err)
+}
+
+// handleOperationBatch processes an operation batch message. The batch is
+// acknowledged once, with the revision of its last operation.
+func (s *Server) handleOperationBatch(
+	ctx context.Context, client *ws.Client, session sessionInterface, userID string, msg ws.Message,
+) {
+	payload, ok := msg.Payload.(ws.OperationBatchPayload)
+	if !ok || len(payload.Operations) == 0 {
+		_ = client.SendEditError(payload.Seq, ws.ErrorCodeInvalidMessage, "invalid operation batch payload")
+
+		return
+	}
+
+	if len(payload.Operations) > ws.MaxBatchOperations {
+		_ = client.SendEditError(payload.Seq, ws.ErrorCodeInvalidMessage,
+			fmt.Sprintf("a batch may hold at most %d operations", ws.MaxBatchOperations))
+
+		return
+	}
+
+	ops := make([]ot.Operation, len(payload.Operations))
+
+	for i, batchOp := range payload.Operations {
+		ops[i], ok = newOperation(batchOp.OpType, batchOp.Position, batchOp.Char, batchOp.Attribute, batchOp.Value, userID)
+		if !ok {
+			_ = client.SendEditError(payload.Seq, ws.ErrorCodeInvalidMessage, "invalid operation type")
+
+			return
+		}
+	}
+
+	revision, err := session.ApplyBatch(client.ID, userID, ops, payload.BaseRevision)
+	s.sendAck(ctx, client, payload.Seq, revision, err)
+}
+
+// newOperation builds the operation a message describes, and reports
+// whether its type is valid. A format must name the attribute it sets.
+func newOperation(opType, position int, char, attribute, value, userID string) (ot.Operation, bool) {
+	switch opType {
 	case int(ot.Insert):
-		op = ot.NewInsert(payload.Char, payload.Position, userID)
+		return ot.NewInsert(char, position, userID), true
 	case int(ot.Delete):
-		op = ot.NewDelete(payload.Position, userID)
+		return ot.NewDelete(position, userID), true
+	case int(ot.Format):
+		return ot.NewFormat(position, attribute, value, userID), attribute != ""
 	default:
-		_ = client.SendError(ws.ErrorCodeInvalidMessage, "invalid operation type")
-
-		return
+		return ot.Operation{}, false
 	}
+}
 
-	revision, err := session.ApplyOperation(client.ID, userID, op, payload.BaseRevision)
+// sendAck acknowledges an applied edit numbered seq, or reports why it
+// wasn't applied.
+func (s *Server) sendAck(ctx context.Context, client *ws.Client, seq, revision int, err error) {
 	if err != nil {
-		if errors.Is(err, acl.ErrAccessDenied) {
-			_ = client.SendError(ws.ErrorCodeAccessDenied, "write access denied")
-		} else {
-			_ = client.SendError(ws.ErrorCodeInternalError, err.Error())
+		switch {
+		case errors.Is(err, acl.ErrAccessDenied):
+			_ = client.SendEditError(seq, ws.ErrorCodeAccessDenied, "write access denied")
+		case errors.Is(err, collab.ErrDocumentArchived):
+			_ = client.SendEditError(seq, ws.ErrorCodeDocumentArchived, "document is archived")
+		default:
+			s.logger.WarnContext(ctx, "operation rejected", logging.ClientID(client.ID),
+				logging.UserID(client.UserID), logging.DocID(client.DocID()), logging.Err(err))
+			_ = client.SendEditError(seq, ws.ErrorCodeInternalError, err.Error())
 		}
 
 		return
@@ -163,13 +311,24 @@ func (s *Server) handleOperation(client *ws.Client, session sessionInterface, us
 		Type: ws.MessageTypeAck,
 		Payload: ws.AckPayload{
 			Revision: revision,
+			Seq:      seq,
 		},
 	})
 }
 
-// handleSync sends the current document state to the client.
-func (s *Server) handleSync(client *ws.Client, session sessionInterface, docID, userID string) {
-	content, revision, err := session.GetState(userID)
+// handleSync sends the current document state to the client, or only the
+// operations it missed if it gave its last known revision and they're
+// still available.
+func (s *Server) handleSync(
+	ctx context.Context, client *ws.Client, session sessionInterface, docID, userID string, msg ws.Message,
+) {
+	if payload, ok := msg.Payload.(ws.SyncPayload); ok && payload.Revision != nil {
+		if s.sendCatchUp(ctx, client, session, docID, userID, *payload.Revision) {
+			return
+		}
+	}
+
+	content, formatting, revision, err := session.GetFormattedState(userID)
 	if err != nil {
 		if errors.Is(err, acl.ErrAccessDenied) {
 			_ = client.SendError(ws.ErrorCodeAccessDenied, "access denied")
@@ -181,17 +340,153 @@ func (s *Server) handleSync(client *ws.Client, session sessionInterface, docID,
 	}
 
 	_ = client.Send(ws.Message{
-		Type: ws.MessageTypeState,
-		Payload: ws.StatePayload{
-			DocID:    docID,
-			Content:  content,
-			Revision: revision,
-		},
+		Type:    ws.MessageTypeState,
+		Payload: s.statePayload(ctx, docID, content, formatting, revision),
 	})
 }
 
+// sendCatchUp sends the client the operations applied since revision. It
+// returns false, having sent nothing, if they aren't available, so the
+// client should be sent the full state instead.
+func (s *Server) sendCatchUp(
+	ctx context.Context, client *ws.Client, session sessionInterface, docID, userID string, revision int,
+) bool {
+	ops, current, err := session.OperationsSince(ctx, userID, revision)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrRevisionNotFound), errors.Is(err, storage.ErrRevisionCompacted):
+			return false
+		case errors.Is(err, acl.ErrAccessDenied):
+			_ = client.SendError(ws.ErrorCodeAccessDenied, "access denied")
+		default:
+			s.logger.ErrorContext(ctx, "failed to load operations for catch-up",
+				logging.ClientID(client.ID), logging.Revision(revision), logging.Err(err))
+			_ = client.SendError(ws.ErrorCodeInternalError, "failed to get document operations")
+		}
+
+		return true
+	}
+
+	missed := make([]ws.CatchUpOperation, len(ops))
+	for i, op := range ops {
+		missed[i] = ws.CatchUpOperation{
+			Revision:  op.Revision,
+			OpType:    int(op.Type),
+			Position:  op.Position,
+			Char:      op.Char,
+			Attribute: op.Attribute,
+			Value:     op.Value,
+			UserID:    op.UserID,
+		}
+	}
+
+	_ = client.Send(ws.Message{
+		Type:    ws.MessageTypeCatchUp,
+		Payload: ws.CatchUpPayload{DocID: docID, Revision: current, Operations: missed},
+	})
+
+	return true
+}
+
+// statePayload describes the document's state with its formatting, title
+// and properties. The state is still worth sending if the title and
+// properties can't be loaded, so they're left out then.
+func (s *Server) statePayload(
+	ctx context.Context, docID, content string, formatting []ot.Mark, revision int,
+) ws.StatePayload {
+	payload := ws.StatePayload{DocID: docID, Content: content, Revision: revision}
+
+	for _, mark := range formatting {
+		payload.Formatting = append(payload.Formatting, ws.Mark{
+			Start: mark.Start, End: mark.End, Attributes: mark.Attributes,
+		})
+	}
+
+	meta, err := s.store.LoadMetadata(ctx, docID)
+	if err != nil {
+		s.logger.WarnContext(ctx, "failed to load document metadata", logging.DocID(docID), logging.Err(err))
+
+		return payload
+	}
+
+	payload.Title = meta.Title
+	payload.Properties = meta.Properties
+
+	return payload
+}
+
+// handleCursor moves the client's cursor past the operations applied since
+// the revision it refers to and shares it with the document's other clients.
+func (s *Server) handleCursor(client *ws.Client, session sessionInterface, userID string, msg ws.Message) {
+	payload, ok := msg.Payload.(ws.CursorPayload)
+	if !ok {
+		_ = client.SendError(ws.ErrorCodeInvalidMessage, "invalid cursor payload")
+
+		return
+	}
+
+	if payload.Position < 0 || payload.Anchor < 0 {
+		_ = client.SendError(ws.ErrorCodeInvalidMessage, "cursor positions must not be negative")
+
+		return
+	}
+
+	positions, revision, err := session.RebasePositions(userID, payload.Revision, payload.Position, payload.Anchor)
+	if err != nil {
+		switch {
+		case errors.Is(err, acl.ErrAccessDenied):
+			_ = client.SendError(ws.ErrorCodeAccessDenied, "access denied")
+		case errors.Is(err, storage.ErrRevisionNotFound), errors.Is(err, ot.ErrRevisionTooOld):
+			_ = client.SendError(ws.ErrorCodeInvalidMessage, "cursor revision is unavailable, sync and resend")
+		default:
+			_ = client.SendError(ws.ErrorCodeInternalError, "failed to move cursor")
+		}
+
+		return
+	}
+
+	s.hub.MoveCursor(client, ws.Cursor{Position: positions[0], Anchor: positions[1]}, revision)
+}
+
 // sessionInterface allows mocking the session for testing.
 type sessionInterface interface {
 	ApplyOperation(clientID, userID string, op ot.Operation, baseRevision int) (int, error)
-	GetState(userID string) (string, int, error)
+	ApplyBatch(clientID, userID string, ops []ot.Operation, baseRevision int) (int, error)
+	GetFormattedState(userID string) (string, []ot.Mark, int, error)
+	RebasePositions(userID string, revision int, positions ...int) ([]int, int, error)
+	OperationsSince(ctx context.Context, userID string, sinceRevision int) ([]ot.SequencedOperation, int, error)
+}
+
+// readOnlySession rejects all operations while allowing state reads.
+type readOnlySession struct {
+	sessionInterface
+}
+
+// ApplyOperation always denies write access.
+func (readOnlySession) ApplyOperation(_, _ string, _ ot.Operation, _ int) (int, error) {
+	return 0, acl.ErrAccessDenied
+}
+
+// ApplyBatch always denies write access.
+func (readOnlySession) ApplyBatch(_, _ string, _ []ot.Operation, _ int) (int, error) {
+	return 0, acl.ErrAccessDenied
+}
+
+// checkOrigin returns the upgrader's origin check. Requests without an Origin
+// header don't come from a browser and are always allowed.
+func checkOrigin(allowed []string) func(*http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || len(allowed) == 0 {
+			return true
+		}
+
+		for _, o := range allowed {
+			if o == "*" || strings.EqualFold(o, origin) {
+				return true
+			}
+		}
+
+		return false
+	}
 }
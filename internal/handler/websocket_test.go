@@ -0,0 +1,631 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSocket_AllowedOrigins(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	hub := ws.NewHub()
+	server := httptest.NewServer(handler.NewServer(handler.ServerConfig{
+		Manager:        collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub}),
+		Store:          store,
+		Hub:            hub,
+		AllowedOrigins: []string{"https://docs.example.com"},
+	}).Handler())
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/ws?docId=doc1"
+
+	tests := []struct {
+		name   string
+		origin string
+		status int
+	}{
+		{name: "allowed origin", origin: "https://docs.example.com", status: http.StatusSwitchingProtocols},
+		{name: "origin case is ignored", origin: "https://DOCS.example.com", status: http.StatusSwitchingProtocols},
+		{name: "no origin", status: http.StatusSwitchingProtocols},
+		{name: "other origin", origin: "https://evil.example.com", status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			header := http.Header{"X-User-Id": {"alice"}}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+
+			conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+			if conn != nil {
+				_ = conn.Close()
+			}
+
+			require.NotNil(t, resp, err)
+			_ = resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+// readEdit reads the next message from the server that isn't about presence.
+func readEdit(t *testing.T, conn *websocket.Conn) ws.Message {
+	t.Helper()
+
+	for {
+		msg, payload := readMessage(t, conn)
+		if msg.Type == ws.MessageTypePresence {
+			continue
+		}
+
+		if len(payload) > 0 {
+			var v any
+			require.NoError(t, json.Unmarshal(payload, &v))
+			msg.Payload = v
+		}
+
+		return msg
+	}
+}
+
+// readPresence reads the server's messages up to the next presence message.
+func readPresence(t *testing.T, conn *websocket.Conn) ws.PresencePayload {
+	t.Helper()
+
+	for {
+		msg, payload := readMessage(t, conn)
+		if msg.Type != ws.MessageTypePresence {
+			continue
+		}
+
+		var presence ws.PresencePayload
+		require.NoError(t, json.Unmarshal(payload, &presence))
+
+		return presence
+	}
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) (ws.Message, json.RawMessage) {
+	t.Helper()
+
+	var raw struct {
+		Type    ws.MessageType  `json:"type"`
+		Payload json.RawMessage `json:"payload"`
+	}
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	require.NoError(t, conn.ReadJSON(&raw))
+
+	return ws.Message{Type: raw.Type}, raw.Payload
+}
+
+func TestWebSocket_Presence(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	hub := ws.NewHub()
+	server := httptest.NewServer(handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub}),
+		Store:   store,
+		Hub:     hub,
+	}).Handler())
+	t.Cleanup(server.Close)
+
+	connect := func(userID string) *websocket.Conn {
+		url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/ws?docId=doc1"
+
+		conn, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"X-User-Id": {userID}})
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		t.Cleanup(func() { _ = conn.Close() })
+
+		require.Equal(t, ws.MessageTypeState, readEdit(t, conn).Type)
+
+		return conn
+	}
+
+	send := func(conn *websocket.Conn, msgType ws.MessageType, payload any) {
+		require.NoError(t, conn.WriteJSON(ws.Message{Type: msgType, Payload: payload}))
+	}
+
+	// Alice types "a"
+	alice := connect("alice")
+	send(alice, ws.MessageTypeOperation, ws.OperationPayload{DocID: "doc1", Position: 0, Char: "a"})
+	require.Equal(t, ws.MessageTypeAck, readEdit(t, alice).Type)
+
+	// Bob joins and sees Alice, who sees him
+	bob := connect("bob")
+	joined := readPresence(t, bob)
+	require.Equal(t, ws.PresenceJoin, joined.Event)
+	require.Equal(t, "alice", joined.UserID)
+	require.Nil(t, joined.Cursor)
+
+	joined = readPresence(t, alice)
+	require.Equal(t, ws.PresenceJoin, joined.Event)
+	require.Equal(t, "bob", joined.UserID)
+
+	// Bob types "b" before it, making "ba"
+	send(bob, ws.MessageTypeOperation, ws.OperationPayload{DocID: "doc1", BaseRevision: 1, Position: 0, Char: "b"})
+	require.Equal(t, ws.MessageTypeAck, readEdit(t, bob).Type)
+	require.Equal(t, ws.MessageTypeBroadcast, readEdit(t, alice).Type)
+
+	// Alice's caret after her "a" as of revision 1 is past Bob's edit
+	send(alice, ws.MessageTypeCursor, ws.CursorPayload{DocID: "doc1", Revision: 1, Position: 1, Anchor: 1})
+
+	moved := readPresence(t, bob)
+	require.Equal(t, ws.PresenceCursor, moved.Event)
+	require.Equal(t, &ws.Cursor{Position: 2, Anchor: 2}, moved.Cursor)
+	require.Equal(t, 2, moved.Revision)
+
+	// Carol joins and sees both, with Alice's caret
+	carol := connect("carol")
+	first, second := readPresence(t, carol), readPresence(t, carol)
+	require.Equal(t, "alice", first.UserID)
+	require.Equal(t, &ws.Cursor{Position: 2, Anchor: 2}, first.Cursor)
+	require.Equal(t, "bob", second.UserID)
+	require.Equal(t, "carol", readPresence(t, alice).UserID)
+	require.Equal(t, "carol", readPresence(t, bob).UserID)
+
+	// Carol leaves
+	require.NoError(t, carol.Close())
+
+	left := readPresence(t, alice)
+	require.Equal(t, ws.PresenceLeave, left.Event)
+	require.Equal(t, "carol", left.UserID)
+
+	// Cursors must refer to a revision the server has
+	send(alice, ws.MessageTypeCursor, ws.CursorPayload{DocID: "doc1", Revision: 9})
+
+	msg := readEdit(t, alice)
+	require.Equal(t, ws.MessageTypeError, msg.Type)
+	require.Equal(t, ws.ErrorCodeInvalidMessage, msg.Payload.(map[string]any)["code"]) //nolint:forcetypeassert // Fails the test
+}
+
+func TestWebSocket_OperationBatch(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	hub := ws.NewHub()
+	server := httptest.NewServer(handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub}),
+		Store:   store,
+		Hub:     hub,
+	}).Handler())
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/ws?docId=doc1"
+
+	conn, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"X-User-Id": {"alice"}})
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	t.Cleanup(func() { _ = conn.Close() })
+
+	require.Equal(t, ws.MessageTypeState, readEdit(t, conn).Type)
+
+	// The batch is acknowledged once, with the revision of its last operation
+	require.NoError(t, conn.WriteJSON(ws.Message{Type: ws.MessageTypeOperationBatch, Payload: ws.OperationBatchPayload{
+		DocID:      "doc1",
+		Operations: []ws.BatchOperation{{Position: 0, Char: "h"}, {Position: 1, Char: "i"}},
+	}}))
+
+	msg := readEdit(t, conn)
+	require.Equal(t, ws.MessageTypeAck, msg.Type)
+	require.InDelta(t, 2, msg.Payload.(map[string]any)["revision"], 0) //nolint:forcetypeassert // Fails the test
+
+	// Empty and oversized batches and unknown operation types are rejected
+	for _, ops := range [][]ws.BatchOperation{nil, {{OpType: 7}}, make([]ws.BatchOperation, ws.MaxBatchOperations+1)} {
+		require.NoError(t, conn.WriteJSON(ws.Message{Type: ws.MessageTypeOperationBatch, Payload: ws.OperationBatchPayload{
+			DocID: "doc1", BaseRevision: 2, Operations: ops,
+		}}))
+
+		msg = readEdit(t, conn)
+		require.Equal(t, ws.MessageTypeError, msg.Type)
+		require.Equal(t, ws.ErrorCodeInvalidMessage, msg.Payload.(map[string]any)["code"]) //nolint:forcetypeassert // Fails the test
+	}
+
+	ops, err := store.LoadOperations(t.Context(), "doc1", 0)
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+}
+
+func TestWebSocket_ReadLimit(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	hub := ws.NewHub()
+	server := httptest.NewServer(handler.NewServer(handler.ServerConfig{
+		Manager:      collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub}),
+		Store:        store,
+		Hub:          hub,
+		MaxBodyBytes: 1024,
+	}).Handler())
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/ws?docId=doc1"
+
+	conn, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"X-User-Id": {"alice"}})
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	t.Cleanup(func() { _ = conn.Close() })
+
+	require.Equal(t, ws.MessageTypeState, readEdit(t, conn).Type)
+
+	// A message larger than a request body may be closes the connection
+	require.NoError(t, conn.WriteJSON(ws.Message{Type: ws.MessageTypeOperation, Payload: ws.OperationPayload{
+		DocID: "doc1", Position: 0, Char: strings.Repeat("x", 2048),
+	}}))
+
+	_, _, err = conn.ReadMessage()
+	require.True(t, websocket.IsCloseError(err, websocket.CloseMessageTooBig), err)
+}
+
+func TestWebSocket_OperationRateLimit(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	hub := ws.NewHub()
+	server := httptest.NewServer(handler.NewServer(handler.ServerConfig{
+		Manager:        collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub}),
+		Store:          store,
+		Hub:            hub,
+		OperationRate:  0.001,
+		OperationBurst: 4,
+	}).Handler())
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/ws?docId=doc1"
+
+	conn, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"X-User-Id": {"alice"}})
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	t.Cleanup(func() { _ = conn.Close() })
+
+	require.Equal(t, ws.MessageTypeState, readEdit(t, conn).Type)
+
+	// An operation and each operation of a batch take from the burst
+	require.NoError(t, conn.WriteJSON(ws.Message{Type: ws.MessageTypeOperation, Payload: ws.OperationPayload{
+		DocID: "doc1", Position: 0, Char: "h",
+	}}))
+	require.Equal(t, ws.MessageTypeAck, readEdit(t, conn).Type)
+
+	require.NoError(t, conn.WriteJSON(ws.Message{Type: ws.MessageTypeOperationBatch, Payload: ws.OperationBatchPayload{
+		DocID: "doc1", BaseRevision: 1, Operations: []ws.BatchOperation{{Position: 1, Char: "i"}, {Position: 2, Char: "!"}},
+	}}))
+	require.Equal(t, ws.MessageTypeAck, readEdit(t, conn).Type)
+
+	// A batch larger than what's left is rejected whole, and then so is the
+	// next edit, but the client may still sync
+	require.NoError(t, conn.WriteJSON(ws.Message{Type: ws.MessageTypeOperationBatch, Payload: ws.OperationBatchPayload{
+		DocID: "doc1", BaseRevision: 3, Operations: []ws.BatchOperation{{Position: 0, Char: "x"}, {Position: 1, Char: "y"}},
+	}}))
+
+	msg := readEdit(t, conn)
+	require.Equal(t, ws.MessageTypeError, msg.Type)
+	require.Equal(t, ws.ErrorCodeRateLimited, msg.Payload.(map[string]any)["code"]) //nolint:forcetypeassert // Fails the test
+
+	require.NoError(t, conn.WriteJSON(ws.Message{Type: ws.MessageTypeOperation, Payload: ws.OperationPayload{
+		DocID: "doc1", BaseRevision: 3, Position: 0, Char: "x",
+	}}))
+	require.Equal(t, ws.MessageTypeAck, readEdit(t, conn).Type)
+
+	require.NoError(t, conn.WriteJSON(ws.Message{Type: ws.MessageTypeOperation, Payload: ws.OperationPayload{
+		DocID: "doc1", BaseRevision: 4, Position: 0, Char: "x",
+	}}))
+
+	msg = readEdit(t, conn)
+	require.Equal(t, ws.MessageTypeError, msg.Type)
+	require.Equal(t, ws.ErrorCodeRateLimited, msg.Payload.(map[string]any)["code"]) //nolint:forcetypeassert // Fails the test
+
+	require.NoError(t, conn.WriteJSON(ws.Message{Type: ws.MessageTypeSync, Payload: ws.SyncPayload{DocID: "doc1"}}))
+
+	msg = readEdit(t, conn)
+	require.Equal(t, ws.MessageTypeState, msg.Type)
+	require.Equal(t, "xhi!", msg.Payload.(map[string]any)["content"]) //nolint:forcetypeassert // Fails the test
+}
+
+func TestWebSocket_OperationSeq(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	hub := ws.NewHub()
+	server := httptest.NewServer(handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub}),
+		Store:   store,
+		Hub:     hub,
+	}).Handler())
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/ws?docId=doc1"
+
+	conn, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"X-User-Id": {"alice"}})
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	t.Cleanup(func() { _ = conn.Close() })
+
+	require.Equal(t, ws.MessageTypeState, readEdit(t, conn).Type)
+
+	// Edits sent without waiting are answered in order, each with its seq
+	require.NoError(t, conn.WriteJSON(ws.Message{Type: ws.MessageTypeOperation, Payload: ws.OperationPayload{
+		DocID: "doc1", Position: 0, Char: "h", Seq: 1,
+	}}))
+	require.NoError(t, conn.WriteJSON(ws.Message{Type: ws.MessageTypeOperationBatch, Payload: ws.OperationBatchPayload{
+		DocID: "doc1", BaseRevision: 1, Operations: []ws.BatchOperation{{Position: 1, Char: "i"}}, Seq: 2,
+	}}))
+	require.NoError(t, conn.WriteJSON(ws.Message{Type: ws.MessageTypeOperation, Payload: ws.OperationPayload{
+		DocID: "doc1", BaseRevision: 1, Position: 0, Char: "x", OpType: 7, Seq: 3,
+	}}))
+
+	for _, want := range []struct {
+		msgType ws.MessageType
+		seq     float64
+	}{{ws.MessageTypeAck, 1}, {ws.MessageTypeAck, 2}, {ws.MessageTypeError, 3}} {
+		msg := readEdit(t, conn)
+		require.Equal(t, want.msgType, msg.Type)
+		require.InDelta(t, want.seq, msg.Payload.(map[string]any)["seq"], 0) //nolint:forcetypeassert // Fails the test
+	}
+
+	// An edit sent again, or after a later one, is rejected without being applied
+	for _, seq := range []int{2, 3} {
+		require.NoError(t, conn.WriteJSON(ws.Message{Type: ws.MessageTypeOperation, Payload: ws.OperationPayload{
+			DocID: "doc1", BaseRevision: 2, Position: 2, Char: "!", Seq: seq,
+		}}))
+
+		msg := readEdit(t, conn)
+		require.Equal(t, ws.MessageTypeError, msg.Type)
+
+		payload := msg.Payload.(map[string]any) //nolint:forcetypeassert // Fails the test
+		require.Equal(t, ws.ErrorCodeInvalidMessage, payload["code"])
+		require.InDelta(t, seq, payload["seq"], 0)
+	}
+
+	// Edits without a seq aren't checked
+	require.NoError(t, conn.WriteJSON(ws.Message{Type: ws.MessageTypeOperation, Payload: ws.OperationPayload{
+		DocID: "doc1", BaseRevision: 2, Position: 2, Char: "!",
+	}}))
+	require.Equal(t, ws.MessageTypeAck, readEdit(t, conn).Type)
+
+	ops, err := store.LoadOperations(t.Context(), "doc1", 0)
+	require.NoError(t, err)
+	require.Len(t, ops, 3)
+}
+
+func TestWebSocket_StateMetadata(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.SetTitle(t.Context(), "doc1", "Roadmap"))
+	require.NoError(t, store.SetProperties(t.Context(), "doc1", map[string]string{"team": "docs"}))
+
+	hub := ws.NewHub()
+	server := httptest.NewServer(handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub}),
+		Store:   store,
+		Hub:     hub,
+	}).Handler())
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/ws?docId=doc1"
+
+	conn, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"X-User-Id": {"alice"}})
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	t.Cleanup(func() { _ = conn.Close() })
+
+	msg := readEdit(t, conn)
+	require.Equal(t, ws.MessageTypeState, msg.Type)
+	require.Equal(t, map[string]any{
+		"docId":      "doc1",
+		"content":    "",
+		"revision":   float64(0),
+		"title":      "Roadmap",
+		"properties": map[string]any{"team": "docs"},
+	}, msg.Payload)
+
+	// A sync picks up a rename
+	require.NoError(t, store.SetTitle(t.Context(), "doc1", "Q1 Roadmap"))
+	require.NoError(t, conn.WriteJSON(ws.Message{Type: ws.MessageTypeSync, Payload: ws.SyncPayload{DocID: "doc1"}}))
+
+	msg = readEdit(t, conn)
+	require.Equal(t, ws.MessageTypeState, msg.Type)
+	require.Equal(t, "Q1 Roadmap", msg.Payload.(map[string]any)["title"]) //nolint:forcetypeassert // Fails the test
+}
+
+func TestWebSocket_SyncCatchUp(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	hub := ws.NewHub()
+	server := httptest.NewServer(handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub}),
+		Store:   store,
+		Hub:     hub,
+	}).Handler())
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/ws?docId=doc1"
+
+	conn, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"X-User-Id": {"alice"}})
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	t.Cleanup(func() { _ = conn.Close() })
+
+	require.Equal(t, ws.MessageTypeState, readEdit(t, conn).Type)
+
+	require.NoError(t, conn.WriteJSON(ws.Message{Type: ws.MessageTypeOperationBatch, Payload: ws.OperationBatchPayload{
+		DocID:      "doc1",
+		Operations: []ws.BatchOperation{{Position: 0, Char: "h"}, {Position: 1, Char: "i"}},
+	}}))
+	require.Equal(t, ws.MessageTypeAck, readEdit(t, conn).Type)
+
+	sync := func(revision int) (ws.Message, json.RawMessage) {
+		require.NoError(t, conn.WriteJSON(ws.Message{
+			Type:    ws.MessageTypeSync,
+			Payload: ws.SyncPayload{DocID: "doc1", Revision: &revision},
+		}))
+
+		return readMessage(t, conn)
+	}
+
+	// A client that knows revision 1 is sent only what it missed
+	msg, payload := sync(1)
+	require.Equal(t, ws.MessageTypeCatchUp, msg.Type)
+
+	var catchUp ws.CatchUpPayload
+	require.NoError(t, json.Unmarshal(payload, &catchUp))
+	require.Equal(t, ws.CatchUpPayload{
+		DocID:      "doc1",
+		Revision:   2,
+		Operations: []ws.CatchUpOperation{{Revision: 2, OpType: 0, Position: 1, Char: "i", UserID: "alice"}},
+	}, catchUp)
+
+	msg, payload = sync(2)
+	require.Equal(t, ws.MessageTypeCatchUp, msg.Type)
+	require.NoError(t, json.Unmarshal(payload, &catchUp))
+	require.Empty(t, catchUp.Operations)
+
+	// A revision the server doesn't know gets the full state
+	msg, payload = sync(7)
+	require.Equal(t, ws.MessageTypeState, msg.Type)
+
+	var state ws.StatePayload
+	require.NoError(t, json.Unmarshal(payload, &state))
+	require.Equal(t, "hi", state.Content)
+	require.Equal(t, 2, state.Revision)
+}
+
+func TestWebSocket_Format(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	hub := ws.NewHub()
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub})
+	server := httptest.NewServer(handler.NewServer(handler.ServerConfig{
+		Manager: manager,
+		Store:   store,
+		Hub:     hub,
+	}).Handler())
+	t.Cleanup(server.Close)
+
+	connect := func(userID string) (*websocket.Conn, ws.StatePayload) {
+		url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/ws?docId=doc1"
+
+		conn, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"X-User-Id": {userID}})
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		t.Cleanup(func() { _ = conn.Close() })
+
+		msg, payload := readMessage(t, conn)
+		require.Equal(t, ws.MessageTypeState, msg.Type)
+
+		var state ws.StatePayload
+		require.NoError(t, json.Unmarshal(payload, &state))
+
+		return conn, state
+	}
+
+	alice, _ := connect("alice")
+	bob, _ := connect("bob")
+
+	require.NoError(t, alice.WriteJSON(ws.Message{Type: ws.MessageTypeOperationBatch, Payload: ws.OperationBatchPayload{
+		DocID:      "doc1",
+		Operations: []ws.BatchOperation{{Position: 0, Char: "h"}, {Position: 1, Char: "i"}},
+	}}))
+	require.Equal(t, ws.MessageTypeAck, readEdit(t, alice).Type)
+	require.Equal(t, ws.MessageTypeBroadcast, readEdit(t, bob).Type)
+	require.Equal(t, ws.MessageTypeBroadcast, readEdit(t, bob).Type)
+
+	// Alice makes the "h" bold, and Bob is sent the attribute
+	require.NoError(t, alice.WriteJSON(ws.Message{Type: ws.MessageTypeOperation, Payload: ws.OperationPayload{
+		DocID: "doc1", BaseRevision: 2, OpType: int(ot.Format), Position: 0, Attribute: "bold", Value: "true",
+	}}))
+	require.Equal(t, ws.MessageTypeAck, readEdit(t, alice).Type)
+
+	msg := readEdit(t, bob)
+	require.Equal(t, ws.MessageTypeBroadcast, msg.Type)
+	require.Equal(t, map[string]any{
+		"docId":     "doc1",
+		"revision":  float64(3),
+		"opType":    float64(ot.Format),
+		"position":  float64(0),
+		"attribute": "bold",
+		"value":     "true",
+		"userId":    "alice",
+	}, msg.Payload)
+
+	// A format must name its attribute
+	require.NoError(t, alice.WriteJSON(ws.Message{Type: ws.MessageTypeOperation, Payload: ws.OperationPayload{
+		DocID: "doc1", BaseRevision: 3, OpType: int(ot.Format), Position: 0,
+	}}))
+
+	msg = readEdit(t, alice)
+	require.Equal(t, ws.MessageTypeError, msg.Type)
+	require.Equal(t, ws.ErrorCodeInvalidMessage, msg.Payload.(map[string]any)["code"]) //nolint:forcetypeassert // Fails the test
+
+	// A batch formats a range
+	require.NoError(t, alice.WriteJSON(ws.Message{Type: ws.MessageTypeOperationBatch, Payload: ws.OperationBatchPayload{
+		DocID:        "doc1",
+		BaseRevision: 3,
+		Operations: []ws.BatchOperation{
+			{OpType: int(ot.Format), Position: 0, Attribute: "italic", Value: "true"},
+			{OpType: int(ot.Format), Position: 1, Attribute: "italic", Value: "true"},
+		},
+	}}))
+	require.Equal(t, ws.MessageTypeAck, readEdit(t, alice).Type)
+
+	ops, err := store.LoadOperations(t.Context(), "doc1", 2)
+	require.NoError(t, err)
+	require.Len(t, ops, 3)
+	require.Equal(t, ot.NewFormat(0, "bold", "true", "alice"), ops[0].Operation)
+
+	// The formatting outlives the session, in its final snapshot
+	require.NoError(t, manager.CloseSession("doc1"))
+
+	snapshot, err := store.LoadSnapshot(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.Equal(t, 5, snapshot.Revision)
+
+	want := []ws.Mark{
+		{Start: 0, End: 1, Attributes: map[string]string{"bold": "true", "italic": "true"}},
+		{Start: 1, End: 2, Attributes: map[string]string{"italic": "true"}},
+	}
+
+	_, state := connect("carol")
+	require.Equal(t, "hi", state.Content)
+	require.Equal(t, want, state.Formatting)
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/yjs"
+)
+
+// handleYjs handles GET /v1/yjs/{docID}, which speaks the y-websocket
+// protocol to Yjs editors bound to the document's "content" text.
+func (s *Server) handleYjs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		return
+	}
+
+	ctx := r.Context()
+	docID := r.PathValue("docID")
+	userID := UserIDFromContext(ctx)
+
+	// Check access before upgrading, so failures get a proper status
+	session, err := s.manager.GetOrCreateSession(ctx, docID)
+	if err == nil {
+		_, _, err = session.GetState(userID)
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrDocumentNotFound):
+			writeError(w, http.StatusNotFound, "document not found")
+		case errors.Is(err, acl.ErrAccessDenied):
+			writeError(w, http.StatusForbidden, "access denied")
+		default:
+			s.logger.ErrorContext(ctx, "failed to load document", logging.DocID(docID), logging.Err(err))
+			writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+
+		return
+	}
+
+	readOnly := session.Archived() || !s.canWrite(docID, userID, r)
+
+	// The upgrade writes its own response, so echo the request ID explicitly
+	conn, err := s.upgrader.Upgrade(w, r, http.Header{headerRequestID: {RequestIDFromContext(ctx)}})
+	if err != nil {
+		s.logger.WarnContext(ctx, "yjs upgrade failed", logging.Err(err))
+
+		return
+	}
+
+	s.logger.InfoContext(ctx, "yjs client connected",
+		logging.UserID(userID), logging.DocID(docID), "read_only", readOnly)
+
+	if err := s.yjs.Serve(docID, conn, userID, readOnly); err != nil {
+		s.logger.WarnContext(ctx, "yjs client disconnected",
+			logging.UserID(userID), logging.DocID(docID), logging.Err(err))
+	}
+}
+
+// canWrite reports whether the request may edit the document. Permission
+// lookups that fail count as read-only.
+func (s *Server) canWrite(docID, userID string, r *http.Request) bool {
+	if key, ok := apiKeyFromContext(r.Context()); ok && !key.Allows(acl.ActionWrite) {
+		return false
+	}
+
+	if s.permStore == nil {
+		return true
+	}
+
+	allowed, err := acl.NewChecker(s.permStore).CanPerform(docID, userID, acl.ActionWrite)
+
+	return err == nil && allowed
+}
+
+// openYjsSession opens a document's session for the Yjs bridge.
+func (s *Server) openYjsSession(ctx context.Context, docID string) (yjs.Session, error) {
+	session, err := s.manager.GetOrCreateSession(ctx, docID)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
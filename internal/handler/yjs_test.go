@@ -0,0 +1,118 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestYjs(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Owner))
+	require.NoError(t, permStore.Grant("doc1", "bob", acl.Viewer))
+
+	hub := ws.NewHub()
+	server := httptest.NewServer(handler.NewServer(handler.ServerConfig{
+		Manager:   collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore, Hub: hub}),
+		Store:     store,
+		PermStore: permStore,
+		Hub:       hub,
+	}).Handler())
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/yjs/"
+	header := http.Header{"X-User-Id": {"alice"}}
+
+	t.Run("connects", func(t *testing.T) {
+		t.Parallel()
+
+		conn, resp, err := websocket.DefaultDialer.Dial(url+"doc1", header)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+
+		t.Cleanup(func() { _ = conn.Close() })
+
+		// The server starts by sending its state vector
+		kind, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+		require.Equal(t, websocket.BinaryMessage, kind)
+		require.Equal(t, []byte{0, 0}, data[:2])
+	})
+
+	t.Run("connects read-only", func(t *testing.T) {
+		t.Parallel()
+
+		conn, resp, err := websocket.DefaultDialer.Dial(url+"doc1", http.Header{"X-User-Id": {"bob"}})
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+
+		t.Cleanup(func() { _ = conn.Close() })
+
+		_, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+		require.Equal(t, []byte{0, 0}, data[:2])
+	})
+
+	failing := failingMetadataStore{MemoryStore: storage.NewMemoryStore()}
+	require.NoError(t, failing.CreateDocument(t.Context(), "doc1"))
+
+	broken := httptest.NewServer(handler.NewServer(handler.ServerConfig{
+		Manager: collab.NewManager(collab.ManagerConfig{Store: failing, Hub: hub}),
+		Store:   failing,
+		Hub:     hub,
+	}).Handler())
+	t.Cleanup(broken.Close)
+
+	tests := []struct {
+		name   string
+		url    string
+		userID string
+		status int
+	}{
+		{"document not found", url + "missing", "alice", http.StatusNotFound},
+		{"access denied", url + "doc1", "mallory", http.StatusForbidden},
+		{"load fails", "ws" + strings.TrimPrefix(broken.URL, "http") + "/v1/yjs/doc1", "alice", 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, resp, err := websocket.DefaultDialer.Dial(tt.url, http.Header{"X-User-Id": {tt.userID}})
+			require.Error(t, err)
+			require.NotNil(t, resp)
+			_ = resp.Body.Close()
+			require.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+
+	t.Run("needs a websocket", func(t *testing.T) {
+		t.Parallel()
+
+		h := handler.NewServer(handler.ServerConfig{
+			Manager: collab.NewManager(collab.ManagerConfig{Store: store, Hub: hub}),
+			Store:   store,
+			Hub:     hub,
+		}).Handler()
+
+		rec := serveWith(h, http.MethodPost, "/v1/yjs/doc1", "", nil)
+		require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+		rec = serveWith(h, http.MethodGet, "/v1/yjs/doc1", "", nil)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,52 @@
+// Package health tracks whether the server has finished starting up, so
+// that load balancers and orchestrators only send it traffic once it can
+// serve documents without first replaying their history.
+package health
+
+import (
+	"slices"
+	"sync"
+)
+
+// Startup tasks run by the server before it reports ready.
+const (
+	TaskStore     = "store"     // The document store answered
+	TaskIntegrity = "integrity" // Every document's history was checked
+	TaskPreload   = "preload"   // Hot documents were opened
+)
+
+// Readiness records which startup tasks are still pending. It is ready
+// once every task it was created with is done.
+type Readiness struct {
+	mu      sync.RWMutex
+	pending []string
+}
+
+// NewReadiness creates a tracker waiting for the given tasks.
+func NewReadiness(tasks ...string) *Readiness {
+	return &Readiness{pending: slices.Clone(tasks)}
+}
+
+// Done marks a task as finished. Unknown or finished tasks are ignored.
+func (r *Readiness) Done(task string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pending = slices.DeleteFunc(r.pending, func(t string) bool { return t == task })
+}
+
+// Ready reports whether every task is done.
+func (r *Readiness) Ready() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.pending) == 0
+}
+
+// Pending returns the tasks that aren't done yet, in the order they were given.
+func (r *Readiness) Pending() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return slices.Clone(r.pending)
+}
@@ -0,0 +1,33 @@
+package health_test
+
+import (
+	"testing"
+
+	"github.com/serroba/online-docs/internal/health"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadiness(t *testing.T) {
+	t.Parallel()
+
+	r := health.NewReadiness(health.TaskStore, health.TaskIntegrity, health.TaskPreload)
+	require.False(t, r.Ready())
+	require.Equal(t, []string{"store", "integrity", "preload"}, r.Pending())
+
+	r.Done(health.TaskIntegrity)
+	r.Done("unknown")
+	require.False(t, r.Ready())
+	require.Equal(t, []string{"store", "preload"}, r.Pending())
+
+	r.Done(health.TaskStore)
+	r.Done(health.TaskPreload)
+	r.Done(health.TaskPreload)
+	require.True(t, r.Ready())
+	require.Empty(t, r.Pending())
+}
+
+func TestReadiness_NoTasks(t *testing.T) {
+	t.Parallel()
+
+	require.True(t, health.NewReadiness().Ready())
+}
@@ -0,0 +1,111 @@
+package idempotency
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultTTL is how long recorded responses are kept by default.
+const DefaultTTL = 24 * time.Hour
+
+// entry is a claimed key, with its response once the request completes.
+type entry struct {
+	fingerprint string
+	resp        *Response // nil while in progress
+	expires     time.Time
+}
+
+// MemoryStore is an in-memory implementation of the Store interface.
+// Keys expire a TTL after they were claimed.
+type MemoryStore struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	entries   map[string]*entry
+	nextPrune time.Time
+}
+
+// NewMemoryStore creates a new in-memory idempotency store whose keys
+// expire after ttl, or DefaultTTL if ttl is not positive.
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	return &MemoryStore{
+		ttl:     ttl,
+		entries: make(map[string]*entry),
+	}
+}
+
+// Begin claims a key for the request identified by fingerprint.
+func (m *MemoryStore) Begin(key, fingerprint string) (Response, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.prune(now)
+
+	if e, exists := m.entries[key]; exists && now.Before(e.expires) {
+		switch {
+		case e.fingerprint != fingerprint:
+			return Response{}, false, ErrKeyReused
+		case e.resp == nil:
+			return Response{}, false, ErrInProgress
+		default:
+			return *e.resp, true, nil
+		}
+	}
+
+	m.entries[key] = &entry{fingerprint: fingerprint, expires: now.Add(m.ttl)}
+
+	return Response{}, false, nil
+}
+
+// Complete records the response for a claimed key.
+func (m *MemoryStore) Complete(key string, resp Response) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, exists := m.entries[key]
+	if !exists || e.resp != nil {
+		return ErrNotClaimed
+	}
+
+	e.resp = &resp
+
+	return nil
+}
+
+// Abandon releases a claimed key without recording a response.
+func (m *MemoryStore) Abandon(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, exists := m.entries[key]
+	if !exists || e.resp != nil {
+		return ErrNotClaimed
+	}
+
+	delete(m.entries, key)
+
+	return nil
+}
+
+// prune drops expired entries, at most once per TTL so that Begin stays
+// cheap. Must be called with mu held.
+func (m *MemoryStore) prune(now time.Time) {
+	if now.Before(m.nextPrune) {
+		return
+	}
+
+	for key, e := range m.entries {
+		if !now.Before(e.expires) {
+			delete(m.entries, key)
+		}
+	}
+
+	m.nextPrune = now.Add(m.ttl)
+}
+
+// Ensure MemoryStore implements Store.
+var _ Store = (*MemoryStore)(nil)
@@ -0,0 +1,102 @@
+package idempotency_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/idempotency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore_ReplaysCompletedRequests(t *testing.T) {
+	t.Parallel()
+
+	store := idempotency.NewMemoryStore(0)
+
+	_, done, err := store.Begin("k1", "fp")
+	require.NoError(t, err)
+
+	if done {
+		t.Fatal("expected a fresh key")
+	}
+
+	if _, _, err := store.Begin("k1", "fp"); !errors.Is(err, idempotency.ErrInProgress) {
+		t.Errorf("expected ErrInProgress, got %v", err)
+	}
+
+	want := idempotency.Response{Status: 201, ContentType: "application/json", Body: []byte(`{"id":"doc1"}`)}
+	require.NoError(t, store.Complete("k1", want))
+
+	got, done, err := store.Begin("k1", "fp")
+	require.NoError(t, err)
+
+	if !done || got.Status != want.Status || string(got.Body) != string(want.Body) {
+		t.Errorf("expected replay of %+v, got %+v (done=%v)", want, got, done)
+	}
+
+	if _, _, err := store.Begin("k1", "other"); !errors.Is(err, idempotency.ErrKeyReused) {
+		t.Errorf("expected ErrKeyReused, got %v", err)
+	}
+}
+
+func TestMemoryStore_Abandon(t *testing.T) {
+	t.Parallel()
+
+	store := idempotency.NewMemoryStore(time.Hour)
+
+	_, _, err := store.Begin("k1", "fp")
+	require.NoError(t, err)
+	require.NoError(t, store.Abandon("k1"))
+
+	// An abandoned key can be claimed again, even by a different request
+	_, done, err := store.Begin("k1", "other")
+	require.NoError(t, err)
+
+	if done {
+		t.Error("expected abandoned key to start fresh")
+	}
+}
+
+func TestMemoryStore_NotClaimed(t *testing.T) {
+	t.Parallel()
+
+	store := idempotency.NewMemoryStore(time.Hour)
+
+	if err := store.Complete("missing", idempotency.Response{}); !errors.Is(err, idempotency.ErrNotClaimed) {
+		t.Errorf("Complete: expected ErrNotClaimed, got %v", err)
+	}
+
+	if err := store.Abandon("missing"); !errors.Is(err, idempotency.ErrNotClaimed) {
+		t.Errorf("Abandon: expected ErrNotClaimed, got %v", err)
+	}
+
+	_, _, err := store.Begin("k1", "fp")
+	require.NoError(t, err)
+	require.NoError(t, store.Complete("k1", idempotency.Response{Status: 201}))
+
+	if err := store.Complete("k1", idempotency.Response{}); !errors.Is(err, idempotency.ErrNotClaimed) {
+		t.Errorf("Complete twice: expected ErrNotClaimed, got %v", err)
+	}
+
+	if err := store.Abandon("k1"); !errors.Is(err, idempotency.ErrNotClaimed) {
+		t.Errorf("Abandon completed: expected ErrNotClaimed, got %v", err)
+	}
+}
+
+func TestMemoryStore_Expiry(t *testing.T) {
+	t.Parallel()
+
+	store := idempotency.NewMemoryStore(20 * time.Millisecond)
+
+	_, _, err := store.Begin("k1", "fp")
+	require.NoError(t, err)
+	require.NoError(t, store.Complete("k1", idempotency.Response{Status: 201}))
+
+	// Once the TTL passes, the key is forgotten and can be reused
+	require.Eventually(t, func() bool {
+		_, done, err := store.Begin("k1", "other")
+
+		return err == nil && !done
+	}, time.Second, 5*time.Millisecond)
+}
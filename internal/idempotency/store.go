@@ -0,0 +1,38 @@
+// Package idempotency records the outcome of requests sent with an
+// Idempotency-Key so that client retries replay it instead of repeating
+// the work.
+package idempotency
+
+import "errors"
+
+// Common errors.
+var (
+	ErrInProgress = errors.New("a request with this idempotency key is in progress")
+	ErrKeyReused  = errors.New("idempotency key was used for a different request")
+	ErrNotClaimed = errors.New("idempotency key is not claimed")
+)
+
+// Response is a recorded HTTP response.
+type Response struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// Store defines the interface for recording idempotent requests.
+type Store interface {
+	// Begin claims a key for the request identified by fingerprint.
+	// If a request with the same key already completed, its response is
+	// returned with done set to true. Returns ErrInProgress while another
+	// request holds the key and ErrKeyReused if the fingerprint differs.
+	Begin(key, fingerprint string) (resp Response, done bool, err error)
+
+	// Complete records the response for a claimed key.
+	// Returns ErrNotClaimed if the key isn't claimed.
+	Complete(key string, resp Response) error
+
+	// Abandon releases a claimed key without recording a response, so the
+	// request can be retried.
+	// Returns ErrNotClaimed if the key isn't claimed.
+	Abandon(key string) error
+}
@@ -0,0 +1,99 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// wordNamespace is the XML namespace of a Word document's body.
+const wordNamespace = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+
+// maxDocumentXML caps the size of a Word document's body once decompressed,
+// so a small upload can't expand without limit.
+const maxDocumentXML = 64 << 20
+
+// docxText extracts the text of a Word document's body, a line per
+// paragraph. Deleted tracked changes are left out, and inserted ones kept.
+func docxText(data []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidFile, err)
+	}
+
+	f, err := archive.Open("word/document.xml")
+	if err != nil {
+		return "", fmt.Errorf("%w: not a Word document", ErrInvalidFile)
+	}
+	defer func() { _ = f.Close() }()
+
+	limited := &io.LimitedReader{R: f, N: maxDocumentXML}
+
+	var b strings.Builder
+
+	dec := xml.NewDecoder(limited)
+
+	// Tabs and breaks only count inside runs; paragraph properties list
+	// tab stops with the same element
+	inRun, inText := false, false
+
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			if limited.N <= 0 {
+				return "", fmt.Errorf("%w: document is too large", ErrInvalidFile)
+			}
+
+			return "", fmt.Errorf("%w: %w", ErrInvalidFile, err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if tok.Name.Space != wordNamespace {
+				continue
+			}
+
+			switch tok.Name.Local {
+			case "r":
+				inRun = true
+			case "t":
+				inText = true
+			case "tab":
+				if inRun {
+					b.WriteByte('\t')
+				}
+			case "br", "cr":
+				if inRun {
+					b.WriteByte('\n')
+				}
+			}
+		case xml.EndElement:
+			if tok.Name.Space != wordNamespace {
+				continue
+			}
+
+			switch tok.Name.Local {
+			case "r":
+				inRun = false
+			case "t":
+				inText = false
+			case "p":
+				b.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				b.Write(tok)
+			}
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
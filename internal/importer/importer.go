@@ -0,0 +1,72 @@
+// Package importer converts uploaded files into document content. Documents
+// hold plain text, so formatting is dropped and only the text is kept.
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// Errors returned by Convert and FormatOf.
+var (
+	ErrUnsupportedFormat = errors.New("unsupported import format")
+	ErrInvalidFile       = errors.New("invalid file")
+)
+
+// Format identifies an import file format.
+type Format string
+
+const (
+	FormatText     Format = "txt"
+	FormatMarkdown Format = "md"
+	FormatDOCX     Format = "docx"
+)
+
+// FormatOf returns the format of a file from its name's extension.
+func FormatOf(filename string) (Format, error) {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".txt", ".text":
+		return FormatText, nil
+	case ".md", ".markdown":
+		return FormatMarkdown, nil
+	case ".docx":
+		return FormatDOCX, nil
+	default:
+		return "", ErrUnsupportedFormat
+	}
+}
+
+// Convert extracts the text of a file in the given format. It returns
+// ErrInvalidFile if the file can't be read as that format.
+func Convert(f Format, data []byte) (string, error) {
+	switch f {
+	case FormatText:
+		return decodeText(data)
+	case FormatMarkdown:
+		text, err := decodeText(data)
+		if err != nil {
+			return "", err
+		}
+
+		return markdownText(text), nil
+	case FormatDOCX:
+		return docxText(data)
+	default:
+		return "", ErrUnsupportedFormat
+	}
+}
+
+// decodeText checks that data is UTF-8 text and normalizes its line endings,
+// dropping a leading byte order mark.
+func decodeText(data []byte) (string, error) {
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("%w: text is not UTF-8", ErrInvalidFile)
+	}
+
+	text := strings.TrimPrefix(string(data), "\ufeff")
+
+	return strings.ReplaceAll(text, "\r\n", "\n"), nil
+}
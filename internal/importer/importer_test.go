@@ -0,0 +1,154 @@
+package importer_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/importer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatOf(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		filename string
+		want     importer.Format
+		wantErr  bool
+	}{
+		{filename: "notes.txt", want: importer.FormatText},
+		{filename: "README.md", want: importer.FormatMarkdown},
+		{filename: "plan.Markdown", want: importer.FormatMarkdown},
+		{filename: "Minutes.DOCX", want: importer.FormatDOCX},
+		{filename: "minutes.doc", wantErr: true},
+		{filename: "notes", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := importer.FormatOf(tt.filename)
+			if tt.wantErr {
+				require.ErrorIs(t, err, importer.ErrUnsupportedFormat)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestConvert_Text(t *testing.T) {
+	t.Parallel()
+
+	got, err := importer.Convert(importer.FormatText, []byte("\ufeffHello,\r\n*world*"))
+	require.NoError(t, err)
+	require.Equal(t, "Hello,\n*world*", got)
+
+	_, err = importer.Convert(importer.FormatText, []byte{0xff, 0xfe})
+	require.ErrorIs(t, err, importer.ErrInvalidFile)
+}
+
+func TestConvert_Markdown(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		markdown string
+		want     string
+	}{
+		{name: "headings", markdown: "# Title #\n\nSub\n---\n## Section", want: "Title\n\nSub\nSection"},
+		{name: "emphasis", markdown: "**bold**, *it*, __b__, _i_ and ~~gone~~", want: "bold, it, b, i and gone"},
+		{name: "not emphasis", markdown: "snake_case_name, 2 * 3 * 4 and a *b", want: "snake_case_name, 2 * 3 * 4 and a *b"},
+		{name: "code span", markdown: "run `go test ./...` or ``a `b` c``", want: "run go test ./... or a `b` c"},
+		{name: "links", markdown: "see [the *docs*](https://example.com) and [ref][1]", want: "see the docs and ref"},
+		{name: "image", markdown: "![a diagram](diagram.png)", want: "a diagram"},
+		{name: "brackets", markdown: "- [ ] todo [sic]", want: "- [ ] todo [sic]"},
+		{name: "escapes", markdown: `\*not emphasis\* \# and C:\path`, want: `*not emphasis* # and C:\path`},
+		{name: "lists", markdown: "* one\n  + two\n1. three", want: "- one\n  - two\n1. three"},
+		{name: "quote", markdown: "> quoted\n> > nested", want: "quoted\nnested"},
+		{name: "rules", markdown: "above\n\n* * *\n\nbelow", want: "above\n\n\nbelow"},
+		{name: "reference definition", markdown: "text\n[1]: https://example.com", want: "text"},
+		{name: "table", markdown: "| a | b |\n|---|:-:|\n| 1 | 2 |", want: "| a | b |\n| 1 | 2 |"},
+		{
+			name:     "code block",
+			markdown: "before\n```go\nx := *p # _y_\n```\nafter\n~~~~\n```\n~~~~",
+			want:     "before\nx := *p # _y_\nafter\n```",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := importer.Convert(importer.FormatMarkdown, []byte(tt.markdown))
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// docx builds a Word document with the given body.
+func docx(t *testing.T, body string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	archive := zip.NewWriter(&buf)
+
+	f, err := archive.Create("word/document.xml")
+	require.NoError(t, err)
+
+	_, err = f.Write([]byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+		body + `</w:body></w:document>`))
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+
+	return buf.Bytes()
+}
+
+func TestConvert_DOCX(t *testing.T) {
+	t.Parallel()
+
+	body := `<w:p><w:pPr><w:tabs><w:tab w:val="left" w:pos="720"/></w:tabs></w:pPr>` +
+		`<w:r><w:t>Meeting</w:t></w:r><w:r><w:t xml:space="preserve"> notes &amp; actions</w:t></w:r></w:p>` +
+		`<w:p/>` +
+		`<w:p><w:r><w:t>a</w:t><w:tab/><w:t>b</w:t><w:br/><w:t>c</w:t></w:r></w:p>` +
+		`<w:p><w:del><w:r><w:delText>old</w:delText></w:r></w:del><w:ins><w:r><w:t>new</w:t></w:r></w:ins></w:p>`
+
+	got, err := importer.Convert(importer.FormatDOCX, docx(t, body))
+	require.NoError(t, err)
+	require.Equal(t, "Meeting notes & actions\n\na\tb\nc\nnew", got)
+}
+
+func TestConvert_DOCXInvalid(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	archive := zip.NewWriter(&buf)
+	_, err := archive.Create("content.xml")
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+
+	tests := map[string][]byte{
+		"not a zip":         []byte("hello"),
+		"not word":          buf.Bytes(),
+		"malformed xml":     docx(t, "<w:p>"),
+		"unclosed elements": docx(t, "<w:p><w:r><w:t>text</w:r></w:p>"),
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := importer.Convert(importer.FormatDOCX, data)
+			require.ErrorIs(t, err, importer.ErrInvalidFile)
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package importer
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// headingPrefix and headingSuffix are the markers of an ATX heading.
+	headingPrefix = regexp.MustCompile(`^ {0,3}#{1,6}(\s+|$)`)
+	headingSuffix = regexp.MustCompile(`\s+#+\s*$`)
+
+	// bulletPrefix is the marker of a bullet list item, with its indent.
+	bulletPrefix = regexp.MustCompile(`^(\s*)[*+-]\s+`)
+
+	// referenceDefinition is a line defining a link reference, which isn't
+	// rendered.
+	referenceDefinition = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:\s*\S`)
+)
+
+// markdownText strips the Markdown syntax from text, keeping what a reader
+// of the rendered document sees. Bullets are kept as "- ", since list
+// markers mean something in plain text too, and code blocks are kept as
+// they are.
+func markdownText(text string) string {
+	lines := strings.Split(text, "\n")
+	out := make([]string, 0, len(lines))
+	fence := "" // The fence of the code block being copied, if any
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			} else {
+				out = append(out, line)
+			}
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, trimmed[:1]))]
+		case isRule(trimmed) || isTableRule(trimmed) || referenceDefinition.MatchString(line):
+		default:
+			out = append(out, blockText(line))
+		}
+	}
+
+	return strings.Join(out, "\n")
+}
+
+// isRule reports whether a line is a thematic break, or the underline of a
+// setext heading, both of which render as something other than text.
+func isRule(line string) bool {
+	line = strings.ReplaceAll(line, " ", "")
+	if len(line) < 3 && !strings.HasPrefix(line, "=") {
+		return false
+	}
+
+	return strings.Trim(line, line[:1]) == "" && strings.Contains("-*_=", line[:1])
+}
+
+// isTableRule reports whether a line separates a table's header from its
+// rows.
+func isTableRule(line string) bool {
+	return strings.Contains(line, "|") && strings.Contains(line, "-") && strings.Trim(line, "|-: ") == ""
+}
+
+// blockText strips the block markers from a line, then its inline markup.
+func blockText(line string) string {
+	for {
+		rest := strings.TrimLeft(line, " ")
+		if !strings.HasPrefix(rest, ">") {
+			break
+		}
+
+		line = strings.TrimPrefix(rest[1:], " ")
+	}
+
+	if loc := headingPrefix.FindStringIndex(line); loc != nil {
+		line = headingSuffix.ReplaceAllString(line[loc[1]:], "")
+	}
+
+	if m := bulletPrefix.FindStringSubmatchIndex(line); m != nil {
+		return line[:m[3]] + "- " + inlineText(line[m[1]:])
+	}
+
+	return inlineText(line)
+}
+
+// inlineText strips the inline markup from text: emphasis, code spans,
+// links, images and backslash escapes.
+func inlineText(text string) string {
+	var b strings.Builder
+
+	closers := make(map[int]bool) // Emphasis delimiters closing ones already dropped
+
+	for i := 0; i < len(text); {
+		c := text[i]
+
+		switch {
+		case closers[i]:
+			i += delimiterRun(text, i)
+		case c == '\\' && i+1 < len(text) && isPunct(text[i+1]):
+			b.WriteByte(text[i+1])
+			i += 2
+		case c == '`':
+			n := delimiterRun(text, i)
+
+			end := strings.Index(text[i+n:], text[i:i+n])
+			if end < 0 {
+				b.WriteString(text[i : i+n])
+				i += n
+
+				continue
+			}
+
+			b.WriteString(text[i+n : i+n+end])
+			i += n + end + n
+		case c == '[' || (c == '!' && strings.HasPrefix(text[i+1:], "[")):
+			start := i
+			if c == '!' {
+				start++
+			}
+
+			label, n, ok := link(text[start:])
+			if !ok {
+				b.WriteByte(c)
+				i++
+
+				continue
+			}
+
+			b.WriteString(inlineText(label))
+			i = start + n
+		case c == '*' || c == '_' || c == '~':
+			n := delimiterRun(text, i)
+
+			if end := closingDelimiter(text, i, n); end >= 0 {
+				closers[end] = true
+			} else {
+				b.WriteString(text[i : i+n])
+			}
+
+			i += n
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	return b.String()
+}
+
+// delimiterRun returns the length of the run of the same character at i.
+func delimiterRun(text string, i int) int {
+	n := 1
+	for i+n < len(text) && text[i+n] == text[i] {
+		n++
+	}
+
+	return n
+}
+
+// closingDelimiter returns where the emphasis opened by the n delimiters at
+// i closes, or -1 if they don't open emphasis. Underscores inside words,
+// and single tildes, are text.
+func closingDelimiter(text string, i, n int) int {
+	c := text[i]
+	if c == '~' && n != 2 {
+		return -1
+	}
+
+	opens := i+n < len(text) && text[i+n] != ' ' && (c != '_' || i == 0 || !isWordByte(text[i-1]))
+	if !opens {
+		return -1
+	}
+
+	for j := i + n + 1; j < len(text); j++ {
+		if text[j] == '\\' {
+			j++
+
+			continue
+		}
+
+		if text[j] != c {
+			continue
+		}
+
+		run := delimiterRun(text, j)
+		after := j + run
+
+		closes := run == n && text[j-1] != ' ' && (c != '_' || after == len(text) || !isWordByte(text[after]))
+		if closes {
+			return j
+		}
+
+		j = after - 1
+	}
+
+	return -1
+}
+
+// link parses a link or image at the start of text, such as
+// "[label](url)" or "[label][ref]", returning its label and length.
+func link(text string) (string, int, bool) {
+	depth := 0
+
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth > 0 {
+				continue
+			}
+
+			label := text[1:i]
+
+			rest := text[i+1:]
+			if len(rest) == 0 || (rest[0] != '(' && rest[0] != '[') {
+				return "", 0, false
+			}
+
+			closing := byte(')')
+			if rest[0] == '[' {
+				closing = ']'
+			}
+
+			end := strings.IndexByte(rest, closing)
+			if end < 0 {
+				return "", 0, false
+			}
+
+			return label, i + 1 + end + 1, true
+		}
+	}
+
+	return "", 0, false
+}
+
+// isPunct reports whether c is ASCII punctuation, which a backslash escapes.
+func isPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+// isWordByte reports whether c is part of a word, for telling underscores
+// in identifiers apart from emphasis. Bytes of multi-byte characters count
+// as letters.
+func isWordByte(c byte) bool {
+	return c >= 0x80 || c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
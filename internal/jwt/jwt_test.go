@@ -0,0 +1,207 @@
+package jwt_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+func validClaims() jwt.Claims {
+	return jwt.Claims{
+		Issuer:    "https://issuer.example",
+		Subject:   "user-123",
+		Audience:  jwt.Audience{"docs"},
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		algorithm string
+		signKey   any
+		verifyKey any
+	}{
+		{algorithm: jwt.RS256, signKey: rsaKey, verifyKey: &rsaKey.PublicKey},
+		{algorithm: jwt.ES256, signKey: ecKey, verifyKey: &ecKey.PublicKey},
+		{algorithm: jwt.HS256, signKey: []byte("secret"), verifyKey: []byte("secret")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			t.Parallel()
+
+			token, err := jwt.Sign(tt.algorithm, "kid1", tt.signKey, validClaims())
+			require.NoError(t, err)
+
+			verifier := jwt.NewVerifier(jwt.VerifierConfig{
+				Keys:     jwt.NewStaticKeySet(tt.verifyKey),
+				Issuer:   "https://issuer.example",
+				Audience: "docs",
+			})
+
+			claims, err := verifier.Verify(context.Background(), token)
+			require.NoError(t, err)
+
+			if claims.Subject != "user-123" {
+				t.Errorf("expected subject 'user-123', got %q", claims.Subject)
+			}
+		})
+	}
+}
+
+func TestVerify_InvalidSignature(t *testing.T) {
+	t.Parallel()
+
+	token, err := jwt.Sign(jwt.HS256, "", []byte("secret"), validClaims())
+	require.NoError(t, err)
+
+	verifier := jwt.NewVerifier(jwt.VerifierConfig{Keys: jwt.NewStaticKeySet([]byte("other"))})
+
+	if _, err := verifier.Verify(context.Background(), token); !errors.Is(err, jwt.ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestVerify_KeyTypeMismatch(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	token, err := jwt.Sign(jwt.RS256, "", rsaKey, validClaims())
+	require.NoError(t, err)
+
+	verifier := jwt.NewVerifier(jwt.VerifierConfig{Keys: jwt.NewStaticKeySet([]byte("secret"))})
+
+	if _, err := verifier.Verify(context.Background(), token); err == nil {
+		t.Error("expected error for mismatched key type")
+	}
+}
+
+func TestVerify_Claims(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		mutate func(c *jwt.Claims)
+		want   error
+	}{
+		{
+			name: "expired", mutate: func(c *jwt.Claims) { c.ExpiresAt = now.Add(-time.Hour).Unix() },
+			want: jwt.ErrTokenExpired,
+		},
+		{
+			name: "not yet valid", mutate: func(c *jwt.Claims) { c.NotBefore = now.Add(time.Hour).Unix() },
+			want: jwt.ErrTokenNotYetValid,
+		},
+		{name: "wrong issuer", mutate: func(c *jwt.Claims) { c.Issuer = "evil" }, want: jwt.ErrInvalidIssuer},
+		{name: "wrong audience", mutate: func(c *jwt.Claims) { c.Audience = nil }, want: jwt.ErrInvalidAudience},
+		{name: "missing subject", mutate: func(c *jwt.Claims) { c.Subject = "" }, want: jwt.ErrMissingSubject},
+	}
+
+	verifier := jwt.NewVerifier(jwt.VerifierConfig{
+		Keys:     jwt.NewStaticKeySet(secret),
+		Issuer:   "https://issuer.example",
+		Audience: "docs",
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			claims := validClaims()
+			tt.mutate(&claims)
+
+			token, err := jwt.Sign(jwt.HS256, "", secret, claims)
+			require.NoError(t, err)
+
+			if _, err := verifier.Verify(context.Background(), token); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestVerify_Malformed(t *testing.T) {
+	t.Parallel()
+
+	verifier := jwt.NewVerifier(jwt.VerifierConfig{Keys: jwt.NewStaticKeySet([]byte("secret"))})
+
+	for _, token := range []string{"", "a.b", "!!!.e30.sig", "eyJhbGciOiJIUzI1NiJ9.e30.!!!"} {
+		if _, err := verifier.Verify(context.Background(), token); !errors.Is(err, jwt.ErrMalformedToken) {
+			t.Errorf("Verify(%q): expected ErrMalformedToken, got %v", token, err)
+		}
+	}
+}
+
+func TestVerify_UnsupportedAlgorithm(t *testing.T) {
+	t.Parallel()
+
+	// {"alg":"none"}.{"sub":"x"}.
+	token := "eyJhbGciOiJub25lIn0.eyJzdWIiOiJ4In0.c2ln"
+	verifier := jwt.NewVerifier(jwt.VerifierConfig{Keys: jwt.NewStaticKeySet([]byte("secret"))})
+
+	if _, err := verifier.Verify(context.Background(), token); !errors.Is(err, jwt.ErrUnsupportedAlgorithm) {
+		t.Errorf("expected ErrUnsupportedAlgorithm, got %v", err)
+	}
+}
+
+func TestSign_Errors(t *testing.T) {
+	t.Parallel()
+
+	if _, err := jwt.Sign("none", "", nil, validClaims()); !errors.Is(err, jwt.ErrUnsupportedAlgorithm) {
+		t.Errorf("expected ErrUnsupportedAlgorithm, got %v", err)
+	}
+
+	for _, alg := range []string{jwt.RS256, jwt.ES256, jwt.HS256} {
+		if _, err := jwt.Sign(alg, "", "wrong key type", validClaims()); !errors.Is(err, jwt.ErrKeyNotFound) {
+			t.Errorf("%s: expected ErrKeyNotFound, got %v", alg, err)
+		}
+	}
+
+	if _, err := jwt.Sign(jwt.HS256, "", []byte("k"), func() {}); err == nil {
+		t.Error("expected error for unencodable claims")
+	}
+}
+
+func TestAudience_UnmarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	var claims jwt.Claims
+
+	require.NoError(t, json.Unmarshal([]byte(`{"aud": "docs"}`), &claims))
+
+	if !claims.Audience.Contains("docs") {
+		t.Errorf("expected single audience, got %v", claims.Audience)
+	}
+
+	require.NoError(t, json.Unmarshal([]byte(`{"aud": ["a", "docs"]}`), &claims))
+
+	if !claims.Audience.Contains("docs") || len(claims.Audience) != 2 {
+		t.Errorf("expected audience list, got %v", claims.Audience)
+	}
+
+	if err := json.Unmarshal([]byte(`{"aud": 5}`), &claims); err == nil {
+		t.Error("expected error for invalid audience")
+	}
+}
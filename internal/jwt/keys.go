@@ -0,0 +1,201 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// KeySet resolves the key used to verify a token signature.
+// Keys are *rsa.PublicKey for RS256, *ecdsa.PublicKey for ES256,
+// and []byte for HS256.
+type KeySet interface {
+	Key(ctx context.Context, keyID, algorithm string) (any, error)
+}
+
+// StaticKeySet is a KeySet with a fixed key for every key ID.
+type StaticKeySet struct {
+	key any
+}
+
+// NewStaticKeySet creates a key set that always returns key.
+func NewStaticKeySet(key any) *StaticKeySet {
+	return &StaticKeySet{key: key}
+}
+
+// Key returns the static key.
+func (s *StaticKeySet) Key(_ context.Context, _, _ string) (any, error) {
+	return s.key, nil
+}
+
+// jwksRefreshInterval limits how often unknown key IDs trigger a refetch.
+const jwksRefreshInterval = time.Minute
+
+// RemoteKeySet fetches keys from a JSON Web Key Set URL.
+// Keys are cached and refetched when an unknown key ID is seen.
+type RemoteKeySet struct {
+	url    string
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]any
+	fetchedAt time.Time
+}
+
+// NewRemoteKeySet creates a key set backed by a JWKS endpoint.
+// A nil client uses http.DefaultClient.
+func NewRemoteKeySet(url string, client *http.Client) *RemoteKeySet {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &RemoteKeySet{
+		url:    url,
+		client: client,
+		keys:   make(map[string]any),
+	}
+}
+
+// Key returns the key with the given ID, fetching the key set if needed.
+func (r *RemoteKeySet) Key(ctx context.Context, keyID, _ string) (any, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if key, ok := r.keys[keyID]; ok {
+		return key, nil
+	}
+
+	if !r.fetchedAt.IsZero() && time.Since(r.fetchedAt) < jwksRefreshInterval {
+		return nil, ErrKeyNotFound
+	}
+
+	if err := r.fetch(ctx); err != nil {
+		return nil, err
+	}
+
+	key, ok := r.keys[keyID]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	return key, nil
+}
+
+// fetch downloads and parses the key set.
+func (r *RemoteKeySet) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching key set: unexpected status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("decoding key set: %w", err)
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+
+	for _, jwk := range set.Keys {
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue // Skip keys we can't use
+		}
+
+		keys[jwk.KeyID] = key
+	}
+
+	r.keys = keys
+	r.fetchedAt = time.Now()
+
+	return nil
+}
+
+// jsonWebKey is a public key in JWK format.
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Curve   string `json:"crv,omitempty"`
+	N       string `json:"n,omitempty"`
+	E       string `json:"e,omitempty"`
+	X       string `json:"x,omitempty"`
+	Y       string `json:"y,omitempty"`
+}
+
+// publicKey converts the JWK into a Go public key.
+func (k jsonWebKey) publicKey() (any, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Curve != "P-256" {
+			return nil, ErrUnsupportedAlgorithm
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+}
+
+// decodeBigInt decodes a base64url-encoded big-endian integer.
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
+
+// EncodeRSAPublicKey returns the JWKS JSON for an RSA public key.
+// Useful for serving test or development key sets.
+func EncodeRSAPublicKey(keyID string, key *rsa.PublicKey) ([]byte, error) {
+	return json.Marshal(map[string][]jsonWebKey{
+		"keys": {{
+			KeyType: "RSA",
+			KeyID:   keyID,
+			N:       base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+}
@@ -0,0 +1,164 @@
+package jwt_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteKeySet(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	jwks, err := jwt.EncodeRSAPublicKey("kid1", &key.PublicKey)
+	require.NoError(t, err)
+
+	var fetches atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fetches.Add(1)
+
+		_, _ = w.Write(jwks)
+	}))
+	t.Cleanup(server.Close)
+
+	keySet := jwt.NewRemoteKeySet(server.URL, nil)
+
+	token, err := jwt.Sign(jwt.RS256, "kid1", key, validClaims())
+	require.NoError(t, err)
+
+	verifier := jwt.NewVerifier(jwt.VerifierConfig{Keys: keySet})
+
+	_, err = verifier.Verify(context.Background(), token)
+	require.NoError(t, err)
+
+	// Cached key doesn't refetch
+	_, err = verifier.Verify(context.Background(), token)
+	require.NoError(t, err)
+
+	// Unknown key IDs don't refetch within the refresh interval
+	if _, err := keySet.Key(context.Background(), "unknown", jwt.RS256); !errors.Is(err, jwt.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("expected 1 fetch, got %d", n)
+	}
+}
+
+func TestRemoteKeySet_ECKey(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	x := base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32)))
+	y := base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32)))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"keys": [{"kty": "EC", "kid": "ec1", "crv": "P-256", "x": %q, "y": %q}]}`, x, y)
+	}))
+	t.Cleanup(server.Close)
+
+	token, err := jwt.Sign(jwt.ES256, "ec1", key, validClaims())
+	require.NoError(t, err)
+
+	verifier := jwt.NewVerifier(jwt.VerifierConfig{Keys: jwt.NewRemoteKeySet(server.URL, nil)})
+
+	_, err = verifier.Verify(context.Background(), token)
+	require.NoError(t, err)
+}
+
+func TestRemoteKeySet_SkipsMalformedKeys(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"keys": [
+			{"kty": "RSA", "kid": "a", "n": "!", "e": "AQAB"},
+			{"kty": "RSA", "kid": "b", "n": "AQAB", "e": "!"},
+			{"kty": "EC", "kid": "c", "crv": "P-256", "x": "!", "y": "AQAB"},
+			{"kty": "EC", "kid": "d", "crv": "P-256", "x": "AQAB", "y": "!"}
+		]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	keySet := jwt.NewRemoteKeySet(server.URL, nil)
+
+	for _, kid := range []string{"a", "b", "c", "d"} {
+		if _, err := keySet.Key(context.Background(), kid, jwt.RS256); !errors.Is(err, jwt.ErrKeyNotFound) {
+			t.Errorf("key %s: expected ErrKeyNotFound, got %v", kid, err)
+		}
+	}
+}
+
+func TestRemoteKeySet_UnknownKeyOnFirstFetch(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"keys": [{"kty": "oct", "kid": "x"}, {"kty": "EC", "kid": "y", "crv": "P-521"}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	keySet := jwt.NewRemoteKeySet(server.URL, server.Client())
+
+	if _, err := keySet.Key(context.Background(), "x", jwt.RS256); !errors.Is(err, jwt.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestRemoteKeySet_FetchErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{
+			name: "bad status",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+		},
+		{
+			name: "bad body",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte("not json"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(tt.handler)
+			t.Cleanup(server.Close)
+
+			keySet := jwt.NewRemoteKeySet(server.URL, nil)
+
+			if _, err := keySet.Key(context.Background(), "kid", jwt.RS256); err == nil {
+				t.Error("expected fetch error")
+			}
+		})
+	}
+
+	keySet := jwt.NewRemoteKeySet("http://127.0.0.1:0/unreachable", nil)
+
+	if _, err := keySet.Key(context.Background(), "kid", jwt.RS256); err == nil {
+		t.Error("expected connection error")
+	}
+}
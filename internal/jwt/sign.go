@@ -0,0 +1,85 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+)
+
+// Sign creates a compact token for the claims.
+// The key must be *rsa.PrivateKey for RS256, *ecdsa.PrivateKey for ES256,
+// or []byte for HS256.
+func Sign(algorithm, keyID string, key any, claims any) (string, error) {
+	header, err := json.Marshal(Header{Algorithm: algorithm, KeyID: keyID, Type: "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+
+	signature, err := sign(algorithm, key, signingInput)
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// sign computes the signature of the signing input.
+func sign(algorithm string, key any, signingInput string) ([]byte, error) {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	switch algorithm {
+	case RS256:
+		priv, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, ErrKeyNotFound
+		}
+
+		return rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, digest[:])
+	case ES256:
+		priv, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, ErrKeyNotFound
+		}
+
+		r, s, err := ecdsa.Sign(rand.Reader, priv, digest[:])
+		if err != nil {
+			return nil, err
+		}
+
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+
+		return signature, nil
+	case HS256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return nil, ErrKeyNotFound
+		}
+
+		return signHMAC(secret, signingInput), nil
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+}
+
+// signHMAC returns the HMAC-SHA256 of the signing input.
+func signHMAC(secret []byte, signingInput string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,163 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// VerifierConfig holds configuration for creating a verifier.
+type VerifierConfig struct {
+	Keys     KeySet
+	Issuer   string        // Required "iss" value; empty skips the check
+	Audience string        // Required "aud" entry; empty skips the check
+	Leeway   time.Duration // Allowed clock skew for exp/nbf
+	Now      func() time.Time
+}
+
+// Verifier validates token signatures and claims.
+type Verifier struct {
+	keys     KeySet
+	issuer   string
+	audience string
+	leeway   time.Duration
+	now      func() time.Time
+}
+
+// NewVerifier creates a new token verifier.
+func NewVerifier(cfg VerifierConfig) *Verifier {
+	now := cfg.Now
+	if now == nil {
+		now = time.Now
+	}
+
+	return &Verifier{
+		keys:     cfg.Keys,
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+		leeway:   cfg.Leeway,
+		now:      now,
+	}
+}
+
+// Verify checks the token signature and standard claims, and returns the claims.
+func (v *Verifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrMalformedToken
+	}
+
+	var header Header
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Claims{}, err
+	}
+
+	key, err := v.keys.Key(ctx, header.KeyID, header.Algorithm)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, ErrMalformedToken
+	}
+
+	if err := verifySignature(header.Algorithm, key, parts[0]+"."+parts[1], signature); err != nil {
+		return Claims{}, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, err
+	}
+
+	if err := v.validateClaims(claims); err != nil {
+		return Claims{}, err
+	}
+
+	return claims, nil
+}
+
+// validateClaims checks the time, issuer, audience, and subject claims.
+func (v *Verifier) validateClaims(claims Claims) error {
+	now := v.now()
+
+	switch {
+	case claims.ExpiresAt != 0 && now.After(time.Unix(claims.ExpiresAt, 0).Add(v.leeway)):
+		return ErrTokenExpired
+	case claims.NotBefore != 0 && now.Before(time.Unix(claims.NotBefore, 0).Add(-v.leeway)):
+		return ErrTokenNotYetValid
+	case v.issuer != "" && claims.Issuer != v.issuer:
+		return ErrInvalidIssuer
+	case v.audience != "" && !claims.Audience.Contains(v.audience):
+		return ErrInvalidAudience
+	case claims.Subject == "":
+		return ErrMissingSubject
+	default:
+		return nil
+	}
+}
+
+// verifySignature checks the signature of the signing input.
+func verifySignature(algorithm string, key any, signingInput string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	switch algorithm {
+	case RS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrKeyNotFound
+		}
+
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) != nil {
+			return ErrInvalidSignature
+		}
+	case ES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return ErrInvalidSignature
+		}
+
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return ErrInvalidSignature
+		}
+	case HS256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return ErrKeyNotFound
+		}
+
+		if !hmac.Equal(signHMAC(secret, signingInput), signature) {
+			return ErrInvalidSignature
+		}
+	default:
+		return ErrUnsupportedAlgorithm
+	}
+
+	return nil
+}
+
+// decodeSegment decodes a base64url JSON token segment.
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return ErrMalformedToken
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return ErrMalformedToken
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+// Package lease grants one server instance at a time the right to open a
+// document's session. Leases expire unless renewed, so the document fails
+// over to another instance when its holder dies, and every grant carries a
+// fencing token so the store can reject writes from a holder that lost it.
+package lease
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// DefaultTTL is how long a lease lasts without renewal by default.
+const DefaultTTL = 15 * time.Second
+
+// Common errors.
+var (
+	ErrHeld = errors.New("lease is held by another instance")
+	ErrLost = errors.New("lease was lost")
+)
+
+// Lease is one grant of a document's lease.
+type Lease struct {
+	DocID string
+	Token uint64 // Fencing token, higher than that of every earlier grant for the document
+}
+
+// Locker defines the interface for granting document leases.
+type Locker interface {
+	// Acquire grants the document's lease to the caller.
+	// Returns ErrHeld if another holder's lease hasn't expired.
+	Acquire(ctx context.Context, docID string) (Lease, error)
+
+	// Renew extends the lease by another TTL.
+	// Returns ErrLost if it expired or was granted to someone else.
+	Renew(ctx context.Context, lease Lease) error
+
+	// Release gives up the lease, so it can be granted again at once.
+	// Releasing a lease that was lost does nothing.
+	Release(ctx context.Context, lease Lease) error
+
+	// TTL returns how long a lease lasts without renewal.
+	TTL() time.Duration
+}
@@ -0,0 +1,114 @@
+package lease_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/serroba/online-docs/internal/lease"
+	"github.com/stretchr/testify/require"
+)
+
+// lockers returns a locker of each kind whose leases last ttl, with a
+// function that lets time pass for it.
+func lockers(t *testing.T, ttl time.Duration) map[string]struct {
+	locker  lease.Locker
+	advance func()
+} {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	return map[string]struct {
+		locker  lease.Locker
+		advance func()
+	}{
+		"memory": {locker: lease.NewMemoryLocker(ttl), advance: func() { time.Sleep(ttl) }},
+		"redis": {
+			locker:  lease.NewRedisLocker(lease.RedisConfig{Client: client, TTL: ttl}),
+			advance: func() { server.FastForward(ttl) },
+		},
+	}
+}
+
+func TestLocker(t *testing.T) {
+	t.Parallel()
+
+	for name, tt := range lockers(t, 50*time.Millisecond) {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := t.Context()
+			locker := tt.locker
+			require.Equal(t, 50*time.Millisecond, locker.TTL())
+
+			first, err := locker.Acquire(ctx, "doc1")
+			require.NoError(t, err)
+			require.Equal(t, lease.Lease{DocID: "doc1", Token: 1}, first)
+
+			_, err = locker.Acquire(ctx, "doc1")
+			require.ErrorIs(t, err, lease.ErrHeld)
+
+			// Documents are leased independently
+			other, err := locker.Acquire(ctx, "doc2")
+			require.NoError(t, err)
+			require.Equal(t, uint64(1), other.Token)
+
+			require.NoError(t, locker.Renew(ctx, first))
+
+			// Released leases are granted again at once, with a higher token
+			require.NoError(t, locker.Release(ctx, first))
+
+			second, err := locker.Acquire(ctx, "doc1")
+			require.NoError(t, err)
+			require.Equal(t, uint64(2), second.Token)
+
+			// The old holder can neither renew nor release the new lease
+			require.ErrorIs(t, locker.Renew(ctx, first), lease.ErrLost)
+			require.NoError(t, locker.Release(ctx, first))
+
+			_, err = locker.Acquire(ctx, "doc1")
+			require.ErrorIs(t, err, lease.ErrHeld)
+
+			// Expired leases fail over
+			tt.advance()
+			require.ErrorIs(t, locker.Renew(ctx, second), lease.ErrLost)
+
+			third, err := locker.Acquire(ctx, "doc1")
+			require.NoError(t, err)
+			require.Equal(t, uint64(3), third.Token)
+		})
+	}
+}
+
+func TestNewLocker_Defaults(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, lease.DefaultTTL, lease.NewMemoryLocker(0).TTL())
+	require.Equal(t, lease.DefaultTTL, lease.NewRedisLocker(lease.RedisConfig{}).TTL())
+}
+
+func TestRedisLocker_Errors(t *testing.T) {
+	t.Parallel()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+
+	locker := lease.NewRedisLocker(lease.RedisConfig{Client: client, Prefix: "test:"})
+
+	held, err := locker.Acquire(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.True(t, server.Exists("test:{doc1}:holder"))
+
+	server.Close()
+
+	_, err = locker.Acquire(t.Context(), "doc2")
+	require.Error(t, err)
+	require.NotErrorIs(t, err, lease.ErrHeld)
+	require.Error(t, locker.Renew(t.Context(), held))
+	require.NotErrorIs(t, locker.Renew(t.Context(), held), lease.ErrLost)
+}
@@ -0,0 +1,88 @@
+package lease
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// grant is the current lease of a document.
+type grant struct {
+	token   uint64
+	expires time.Time
+}
+
+// MemoryLocker is an in-memory implementation of the Locker interface.
+// It only coordinates managers within one process, so it's useful for
+// testing and development.
+type MemoryLocker struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	grants map[string]grant
+	tokens map[string]uint64 // Last token issued, by document ID
+}
+
+// NewMemoryLocker creates a new in-memory locker whose leases expire after
+// ttl, or DefaultTTL if ttl is not positive.
+func NewMemoryLocker(ttl time.Duration) *MemoryLocker {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	return &MemoryLocker{
+		ttl:    ttl,
+		grants: make(map[string]grant),
+		tokens: make(map[string]uint64),
+	}
+}
+
+// Acquire grants the document's lease to the caller.
+func (m *MemoryLocker) Acquire(_ context.Context, docID string) (Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	if g, held := m.grants[docID]; held && now.Before(g.expires) {
+		return Lease{}, ErrHeld
+	}
+
+	m.tokens[docID]++
+	m.grants[docID] = grant{token: m.tokens[docID], expires: now.Add(m.ttl)}
+
+	return Lease{DocID: docID, Token: m.tokens[docID]}, nil
+}
+
+// Renew extends the lease by another TTL.
+func (m *MemoryLocker) Renew(_ context.Context, lease Lease) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	g, held := m.grants[lease.DocID]
+	if !held || g.token != lease.Token || !now.Before(g.expires) {
+		return ErrLost
+	}
+
+	m.grants[lease.DocID] = grant{token: g.token, expires: now.Add(m.ttl)}
+
+	return nil
+}
+
+// Release gives up the lease.
+func (m *MemoryLocker) Release(_ context.Context, lease Lease) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if g, held := m.grants[lease.DocID]; held && g.token == lease.Token {
+		delete(m.grants, lease.DocID)
+	}
+
+	return nil
+}
+
+// TTL returns how long a lease lasts without renewal.
+func (m *MemoryLocker) TTL() time.Duration {
+	return m.ttl
+}
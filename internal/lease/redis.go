@@ -0,0 +1,115 @@
+package lease
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultRedisPrefix starts the names of each document's Redis keys.
+const DefaultRedisPrefix = "docs:lease:"
+
+// The scripts run atomically, so no other instance can take the lease
+// between checking its holder and changing it. KEYS[1] holds the current
+// holder's token and KEYS[2] the last token issued.
+var (
+	acquireScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return 0
+end
+local token = redis.call("INCR", KEYS[2])
+redis.call("SET", KEYS[1], token, "PX", ARGV[1])
+return token
+`)
+
+	renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+	releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+)
+
+// RedisLocker grants leases through Redis, so it coordinates every instance
+// using the same server. It implements Locker.
+type RedisLocker struct {
+	client redis.UniversalClient
+	ttl    time.Duration
+	prefix string
+}
+
+// RedisConfig holds configuration for creating a Redis locker.
+type RedisConfig struct {
+	Client redis.UniversalClient
+	TTL    time.Duration // Optional: defaults to DefaultTTL
+	Prefix string        // Optional: key name prefix, defaults to DefaultRedisPrefix
+}
+
+// NewRedisLocker creates a locker that keeps its leases in Redis.
+func NewRedisLocker(cfg RedisConfig) *RedisLocker {
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = DefaultRedisPrefix
+	}
+
+	return &RedisLocker{client: cfg.Client, ttl: ttl, prefix: prefix}
+}
+
+// Acquire grants the document's lease to the caller.
+func (l *RedisLocker) Acquire(ctx context.Context, docID string) (Lease, error) {
+	token, err := acquireScript.Run(ctx, l.client, l.keys(docID), l.ttl.Milliseconds()).Uint64()
+	if err != nil {
+		return Lease{}, err
+	}
+
+	if token == 0 {
+		return Lease{}, ErrHeld
+	}
+
+	return Lease{DocID: docID, Token: token}, nil
+}
+
+// Renew extends the lease by another TTL.
+func (l *RedisLocker) Renew(ctx context.Context, lease Lease) error {
+	renewed, err := renewScript.Run(ctx, l.client, l.keys(lease.DocID), lease.Token, l.ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+
+	if renewed == 0 {
+		return ErrLost
+	}
+
+	return nil
+}
+
+// Release gives up the lease.
+func (l *RedisLocker) Release(ctx context.Context, lease Lease) error {
+	return releaseScript.Run(ctx, l.client, l.keys(lease.DocID), lease.Token).Err()
+}
+
+// TTL returns how long a lease lasts without renewal.
+func (l *RedisLocker) TTL() time.Duration {
+	return l.ttl
+}
+
+// keys returns the document's holder and token counter keys. Their hash tag
+// puts both in the same Redis Cluster slot, as scripts require.
+func (l *RedisLocker) keys(docID string) []string {
+	tag := l.prefix + "{" + docID + "}"
+
+	return []string{tag + ":holder", tag + ":token"}
+}
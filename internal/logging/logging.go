@@ -0,0 +1,128 @@
+// Package logging builds the structured logger shared by the server's
+// components and defines the attributes they log with.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Output formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Attribute keys shared across components.
+const (
+	KeyComponent = "component"
+	KeyDocID     = "doc_id"
+	KeyUserID    = "user_id"
+	KeyClientID  = "client_id"
+	KeyRevision  = "revision"
+	KeyRequestID = "request_id"
+	KeyError     = "error"
+)
+
+// New returns a logger writing records at or above level to w in the given
+// format. Records logged with a context carrying a request ID include it.
+func New(w io.Writer, format string, level slog.Level) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+
+	var h slog.Handler
+
+	switch format {
+	case FormatText:
+		h = slog.NewTextHandler(w, opts)
+	case FormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+
+	return slog.New(contextHandler{Handler: h}), nil
+}
+
+// ParseLevel parses a level name such as "debug" or "warn".
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+
+	return level, nil
+}
+
+// Component returns logger tagged with the component name. A nil logger
+// means the default one.
+func Component(logger *slog.Logger, name string) *slog.Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return logger.With(KeyComponent, name)
+}
+
+// DocID returns the attribute for a document ID.
+func DocID(docID string) slog.Attr {
+	return slog.String(KeyDocID, docID)
+}
+
+// UserID returns the attribute for a user ID.
+func UserID(userID string) slog.Attr {
+	return slog.String(KeyUserID, userID)
+}
+
+// ClientID returns the attribute for a WebSocket client ID.
+func ClientID(clientID string) slog.Attr {
+	return slog.String(KeyClientID, clientID)
+}
+
+// Revision returns the attribute for a document revision.
+func Revision(revision int) slog.Attr {
+	return slog.Int(KeyRevision, revision)
+}
+
+// Err returns the attribute for an error.
+func Err(err error) slog.Attr {
+	return slog.Any(KeyError, err)
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a new context carrying the request ID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID carried by ctx, or an empty string.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+
+	return requestID
+}
+
+// contextHandler adds the request ID from the record's context.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if requestID := RequestID(ctx); requestID != "" {
+		r.AddAttrs(slog.String(KeyRequestID, requestID))
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithGroup(name)}
+}
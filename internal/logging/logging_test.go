@@ -0,0 +1,91 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_JSON(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	logger, err := logging.New(&buf, logging.FormatJSON, slog.LevelInfo)
+	require.NoError(t, err)
+
+	ctx := logging.WithRequestID(t.Context(), "req-1")
+	logging.Component(logger, "collab").ErrorContext(ctx, "snapshot failed",
+		logging.DocID("doc1"), logging.UserID("alice"), logging.ClientID("c1"), logging.Revision(7),
+		logging.Err(errors.New("disk full")))
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	require.Equal(t, "ERROR", record["level"])
+	require.Equal(t, "snapshot failed", record["msg"])
+	require.Equal(t, "collab", record["component"])
+	require.Equal(t, "doc1", record["doc_id"])
+	require.Equal(t, "alice", record["user_id"])
+	require.Equal(t, "c1", record["client_id"])
+	require.InDelta(t, 7, record["revision"], 0)
+	require.Equal(t, "req-1", record["request_id"])
+	require.Equal(t, "disk full", record["error"])
+}
+
+func TestNew_Text(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	logger, err := logging.New(&buf, logging.FormatText, slog.LevelWarn)
+	require.NoError(t, err)
+
+	logger.Info("hidden")
+	logger.WithGroup("g").Warn("shown", "k", "v")
+	logger.WarnContext(t.Context(), "no request")
+
+	out := buf.String()
+	require.NotContains(t, out, "hidden")
+	require.Contains(t, out, "msg=shown g.k=v")
+	require.NotContains(t, out, "request_id")
+}
+
+func TestNew_UnknownFormat(t *testing.T) {
+	t.Parallel()
+
+	_, err := logging.New(&bytes.Buffer{}, "xml", slog.LevelInfo)
+	require.ErrorContains(t, err, `unknown log format "xml"`)
+}
+
+func TestParseLevel(t *testing.T) {
+	t.Parallel()
+
+	for name, want := range map[string]slog.Level{
+		"debug": slog.LevelDebug, "INFO": slog.LevelInfo, " warn ": slog.LevelWarn, "error": slog.LevelError,
+	} {
+		got, err := logging.ParseLevel(name)
+		require.NoError(t, err)
+		require.Equal(t, want, got, name)
+	}
+
+	_, err := logging.ParseLevel("loud")
+	require.ErrorContains(t, err, `unknown log level "loud"`)
+}
+
+func TestComponent_DefaultLogger(t *testing.T) {
+	t.Parallel()
+
+	require.NotNil(t, logging.Component(nil, "ws"))
+}
+
+func TestRequestID(t *testing.T) {
+	t.Parallel()
+
+	require.Empty(t, logging.RequestID(t.Context()))
+	require.Equal(t, "abc", logging.RequestID(logging.WithRequestID(t.Context(), "abc")))
+}
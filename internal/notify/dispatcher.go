@@ -0,0 +1,149 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apikey"
+	"github.com/serroba/online-docs/internal/bot"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/preferences"
+	"github.com/serroba/online-docs/internal/webhook"
+	"github.com/serroba/online-docs/internal/ws"
+)
+
+// DispatcherConfig holds the dependencies of a Dispatcher.
+type DispatcherConfig struct {
+	Notifier    Notifier
+	Preferences preferences.Store // Decides what each user is notified of
+	PermStore   acl.Store         // Finds who to tell about edits
+
+	// Hub holds back activity notifications for users connected to the
+	// document, who see the edits as they happen. Optional.
+	Hub *ws.Hub
+
+	Logger *slog.Logger // Optional: defaults to slog.Default()
+}
+
+// Dispatcher turns document events into notifications for the users they
+// concern and hands those users have asked for to a Notifier. It listens
+// to the webhook service for shares and edits; other subsystems call Send.
+type Dispatcher struct {
+	notifier  Notifier
+	prefs     preferences.Store
+	permStore acl.Store
+	hub       *ws.Hub
+	logger    *slog.Logger
+}
+
+// NewDispatcher creates a dispatcher.
+func NewDispatcher(cfg DispatcherConfig) *Dispatcher {
+	return &Dispatcher{
+		notifier:  cfg.Notifier,
+		prefs:     cfg.Preferences,
+		permStore: cfg.PermStore,
+		hub:       cfg.Hub,
+		logger:    logging.Component(cfg.Logger, "notify"),
+	}
+}
+
+// HandleEvent notifies the user a document was shared with, and the users
+// with a role on an edited document who aren't connected to it.
+func (d *Dispatcher) HandleEvent(event webhook.Event) {
+	ctx := context.Background()
+
+	switch event.Type {
+	case webhook.EventDocumentShared:
+		d.Send(ctx, Notification{
+			Kind:       KindShare,
+			UserID:     event.UserID,
+			DocID:      event.DocID,
+			Role:       event.Role,
+			OccurredAt: event.OccurredAt,
+		})
+	case webhook.EventDocumentUpdated:
+		for _, userID := range d.away(event.DocID, event.UserID) {
+			d.Send(ctx, Notification{
+				Kind:       KindActivity,
+				UserID:     userID,
+				DocID:      event.DocID,
+				ActorID:    event.UserID,
+				OccurredAt: event.OccurredAt,
+			})
+		}
+	case webhook.EventDocumentCreated, webhook.EventDocumentDeleted:
+	}
+}
+
+// away returns the users with a role on a document, besides the editor,
+// who aren't connected to it.
+func (d *Dispatcher) away(docID, editorID string) []string {
+	perms, err := d.permStore.ListPermissions(docID)
+	if err != nil {
+		d.logger.Error("failed to list permissions", logging.DocID(docID), logging.Err(err))
+
+		return nil
+	}
+
+	connected := make(map[string]bool)
+
+	if d.hub != nil {
+		for _, participant := range d.hub.Participants(docID) {
+			connected[participant.UserID] = true
+		}
+	}
+
+	var userIDs []string
+
+	for _, perm := range perms {
+		if perm.UserID != editorID && !connected[perm.UserID] {
+			userIDs = append(userIDs, perm.UserID)
+		}
+	}
+
+	return userIDs
+}
+
+// Send hands a notification to the notifier if its recipient has an email
+// address and wants notifications of its kind. Failures are logged.
+func (d *Dispatcher) Send(ctx context.Context, n Notification) {
+	// Service accounts and bots have no one to tell
+	if strings.HasPrefix(n.UserID, apikey.PrincipalPrefix) || strings.HasPrefix(n.UserID, bot.PrincipalPrefix) {
+		return
+	}
+
+	settings, err := d.prefs.Notifications(n.UserID)
+	if err != nil {
+		d.logger.ErrorContext(ctx, "failed to load notification settings", logging.UserID(n.UserID), logging.Err(err))
+
+		return
+	}
+
+	if settings.Email == "" || !wants(settings, n.Kind) {
+		return
+	}
+
+	if err := d.notifier.Notify(ctx, n); err != nil {
+		d.logger.ErrorContext(ctx, "failed to notify",
+			"kind", n.Kind, logging.UserID(n.UserID), logging.DocID(n.DocID), logging.Err(err))
+	}
+}
+
+// wants reports whether settings ask for notifications of a kind.
+func wants(settings preferences.Notifications, kind Kind) bool {
+	switch kind {
+	case KindMention:
+		return settings.Mentions
+	case KindShare:
+		return settings.Shares
+	case KindActivity:
+		return settings.Activity
+	default:
+		return false
+	}
+}
+
+// Ensure Dispatcher implements webhook.Listener.
+var _ webhook.Listener = (*Dispatcher)(nil)
@@ -0,0 +1,127 @@
+package notify_test
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/notify"
+	"github.com/serroba/online-docs/internal/preferences"
+	"github.com/serroba/online-docs/internal/webhook"
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingNotifier records the notifications it's given.
+type recordingNotifier struct {
+	mu            sync.Mutex
+	notifications []notify.Notification
+}
+
+func (r *recordingNotifier) Notify(_ context.Context, n notify.Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.notifications = append(r.notifications, n)
+
+	return nil
+}
+
+func (r *recordingNotifier) recipients() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	userIDs := make([]string, 0, len(r.notifications))
+	for _, n := range r.notifications {
+		userIDs = append(userIDs, n.UserID)
+	}
+
+	return userIDs
+}
+
+func TestDispatcher(t *testing.T) {
+	t.Parallel()
+
+	everything := preferences.Notifications{Email: "x@example.com", Mentions: true, Shares: true, Activity: true}
+
+	prefs := preferences.NewMemoryStore()
+	require.NoError(t, prefs.SetNotifications("alice", everything))
+	require.NoError(t, prefs.SetNotifications("bob", everything))
+	require.NoError(t, prefs.SetNotifications("carol", everything))
+	require.NoError(t, prefs.SetNotifications("dave", preferences.Notifications{Email: "dave@example.com", Shares: true}))
+	require.NoError(t, prefs.SetNotifications("erin", preferences.Notifications{Activity: true}))
+
+	permStore := acl.NewMemoryStore()
+	for userID, role := range map[string]acl.Role{
+		"alice": acl.Owner, "bob": acl.Editor, "carol": acl.Viewer, "dave": acl.Viewer, "erin": acl.Viewer,
+		"service:alice/ci": acl.Editor,
+	} {
+		require.NoError(t, permStore.Grant("doc1", userID, role))
+	}
+
+	// Carol is looking at the document
+	hub := ws.NewHub()
+	carol := ws.NewClient("c1", "carol", nil)
+	hub.Register(carol)
+	hub.Subscribe(carol, "doc1")
+
+	tests := map[string]struct {
+		event webhook.Event
+		want  []string
+	}{
+		"edits notify those away with activity on": {
+			event: webhook.Event{Type: webhook.EventDocumentUpdated, DocID: "doc1", UserID: "bob", Revision: 3},
+			want:  []string{"alice"},
+		},
+		"shares notify the user shared with": {
+			event: webhook.Event{Type: webhook.EventDocumentShared, DocID: "doc1", UserID: "dave", Role: "viewer"},
+			want:  []string{"dave"},
+		},
+		"shares respect settings": {
+			event: webhook.Event{Type: webhook.EventDocumentShared, DocID: "doc1", UserID: "erin", Role: "viewer"},
+		},
+		"service accounts aren't notified": {
+			event: webhook.Event{Type: webhook.EventDocumentShared, DocID: "doc1", UserID: "service:alice/ci"},
+		},
+		"other events are ignored": {
+			event: webhook.Event{Type: webhook.EventDocumentDeleted, DocID: "doc1", UserID: "alice"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			notifier := &recordingNotifier{}
+			dispatcher := notify.NewDispatcher(notify.DispatcherConfig{
+				Notifier:    notifier,
+				Preferences: prefs,
+				PermStore:   permStore,
+				Hub:         hub,
+				Logger:      slog.New(slog.DiscardHandler),
+			})
+
+			dispatcher.HandleEvent(tt.event)
+			require.ElementsMatch(t, tt.want, notifier.recipients())
+		})
+	}
+}
+
+func TestDispatcher_Send(t *testing.T) {
+	t.Parallel()
+
+	prefs := preferences.NewMemoryStore()
+	require.NoError(t, prefs.SetNotifications("alice", preferences.Notifications{Email: "a@example.com", Mentions: true}))
+
+	notifier := &recordingNotifier{}
+	dispatcher := notify.NewDispatcher(notify.DispatcherConfig{Notifier: notifier, Preferences: prefs})
+
+	dispatcher.Send(t.Context(), notify.Notification{Kind: notify.KindMention, UserID: "alice", ActorID: "bob"})
+	dispatcher.Send(t.Context(), notify.Notification{Kind: notify.KindActivity, UserID: "alice", ActorID: "bob"})
+	dispatcher.Send(t.Context(), notify.Notification{Kind: notify.KindMention, UserID: "bob", ActorID: "alice"})
+
+	require.Len(t, notifier.notifications, 1)
+	require.Equal(t, notify.KindMention, notifier.notifications[0].Kind)
+}
@@ -0,0 +1,34 @@
+// Package notify tells users about activity on their documents while they
+// aren't connected, through a pluggable Notifier such as email.
+package notify
+
+import (
+	"context"
+	"time"
+)
+
+// Kind identifies what a notification is about.
+type Kind string
+
+const (
+	KindMention  Kind = "mention"  // Someone mentioned the user
+	KindShare    Kind = "share"    // A document was shared with the user
+	KindActivity Kind = "activity" // Someone edited a document the user has a role on
+)
+
+// Notification is a single event a user is told about.
+type Notification struct {
+	Kind       Kind
+	UserID     string // Recipient
+	DocID      string
+	ActorID    string // Who mentioned the user or edited; may be empty
+	Role       string // Set for shares: the role granted
+	Text       string // Set for mentions: the text mentioning the user
+	OccurredAt time.Time
+}
+
+// Notifier delivers notifications. Implementations may batch them, so
+// a nil error means a notification was accepted rather than delivered.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
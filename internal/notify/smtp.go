@@ -0,0 +1,285 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/smtp"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/preferences"
+)
+
+// DefaultBatchWindow is how long notifications are collected before each
+// user is sent one email with all of theirs.
+const DefaultBatchWindow = time.Minute
+
+// ErrClosed is returned by Notify once the notifier is closed.
+var ErrClosed = errors.New("notify: notifier is closed")
+
+// DefaultTemplate renders a batch of notifications. Templates define a
+// "subject" and a "body", executed with a Digest.
+const DefaultTemplate = `{{define "subject"}}Activity on your documents{{end}}
+{{- define "body"}}Hi {{.UserID}},
+{{- range .Mentions}}
+{{with .ActorID}}{{.}}{{else}}Someone{{end}} mentioned you in {{.DocID}}{{with .Text}}: {{.}}{{end}}
+{{- end}}
+{{- range .Shares}}
+{{.DocID}} was shared with you as {{.Role}}.
+{{- end}}
+{{- range .Activity}}
+{{with .Editors}}{{join . ", "}}{{else}}Someone{{end}} made {{.Changes}}
+{{- if eq .Changes 1}} change{{else}} changes{{end}} to {{.DocID}}.
+{{- end}}
+{{end}}`
+
+// Digest is the data a template renders: a user's notifications since the
+// last batch, with edits to each document summed up.
+type Digest struct {
+	UserID   string
+	Mentions []Notification
+	Shares   []Notification
+	Activity []Activity
+}
+
+// Activity sums up the edits to a document in a batch.
+type Activity struct {
+	DocID   string
+	Editors []string // Sorted
+	Changes int
+}
+
+// SMTPConfig holds the settings of an SMTPNotifier.
+type SMTPConfig struct {
+	Addr     string // Server address, such as "smtp.example.com:587"
+	From     string // Sender address
+	Username string // Optional: authenticates with PLAIN auth when set
+	Password string
+
+	Preferences preferences.Store // Looks up each user's email address
+
+	BatchWindow time.Duration // Optional: defaults to DefaultBatchWindow
+	Template    string        // Optional: defaults to DefaultTemplate
+	Logger      *slog.Logger  // Optional: defaults to slog.Default()
+}
+
+// SMTPNotifier emails notifications. Each user's notifications are batched
+// for a window and sent as a single message.
+type SMTPNotifier struct {
+	addr     string
+	from     string
+	auth     smtp.Auth
+	prefs    preferences.Store
+	template *template.Template
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	pending map[string][]Notification // user ID -> notifications since the last batch
+	closed  bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewSMTPNotifier creates a notifier and starts sending a batch every
+// window. Close sends the last one.
+func NewSMTPNotifier(cfg SMTPConfig) (*SMTPNotifier, error) {
+	source := cfg.Template
+	if source == "" {
+		source = DefaultTemplate
+	}
+
+	tmpl, err := template.New("notification").Funcs(template.FuncMap{"join": strings.Join}).Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("parse template: %w", err)
+	}
+
+	for _, name := range []string{"subject", "body"} {
+		if tmpl.Lookup(name) == nil {
+			return nil, fmt.Errorf("parse template: %q is not defined", name)
+		}
+	}
+
+	window := cfg.BatchWindow
+	if window <= 0 {
+		window = DefaultBatchWindow
+	}
+
+	n := &SMTPNotifier{
+		addr:     cfg.Addr,
+		from:     cfg.From,
+		prefs:    cfg.Preferences,
+		template: tmpl,
+		logger:   logging.Component(cfg.Logger, "notify"),
+		pending:  make(map[string][]Notification),
+		done:     make(chan struct{}),
+	}
+
+	if cfg.Username != "" {
+		host, _, _ := net.SplitHostPort(cfg.Addr)
+		n.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+	}
+
+	n.wg.Go(func() {
+		ticker := time.NewTicker(window)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				n.Flush()
+			case <-n.done:
+				return
+			}
+		}
+	})
+
+	return n, nil
+}
+
+// Notify queues a notification for the next batch.
+func (n *SMTPNotifier) Notify(_ context.Context, notification Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.closed {
+		return ErrClosed
+	}
+
+	if notification.OccurredAt.IsZero() {
+		notification.OccurredAt = time.Now()
+	}
+
+	n.pending[notification.UserID] = append(n.pending[notification.UserID], notification)
+
+	return nil
+}
+
+// Flush sends the pending batch now. Failures are logged and the batch is
+// dropped, so a broken server doesn't pile up mail.
+func (n *SMTPNotifier) Flush() {
+	n.mu.Lock()
+	pending := n.pending
+	n.pending = make(map[string][]Notification)
+	n.mu.Unlock()
+
+	for userID, notifications := range pending {
+		if err := n.send(userID, notifications); err != nil {
+			n.logger.Error("failed to send notifications",
+				logging.UserID(userID), "notifications", len(notifications), logging.Err(err))
+		}
+	}
+}
+
+// Close stops batching and sends what's pending.
+func (n *SMTPNotifier) Close() {
+	n.mu.Lock()
+	wasClosed := n.closed
+	n.closed = true
+	n.mu.Unlock()
+
+	if wasClosed {
+		return
+	}
+
+	close(n.done)
+	n.wg.Wait()
+	n.Flush()
+}
+
+// send emails a user's notifications to the address in their settings.
+func (n *SMTPNotifier) send(userID string, notifications []Notification) error {
+	settings, err := n.prefs.Notifications(userID)
+	if err != nil {
+		return err
+	}
+
+	// The user turned notifications off since they were queued
+	if settings.Email == "" {
+		return nil
+	}
+
+	msg, err := n.message(settings.Email, NewDigest(userID, notifications))
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(n.addr, n.auth, n.from, []string{settings.Email}, msg)
+}
+
+// message renders a digest as an email to the address.
+func (n *SMTPNotifier) message(to string, digest Digest) ([]byte, error) {
+	var subject, body bytes.Buffer
+
+	if err := n.template.ExecuteTemplate(&subject, "subject", digest); err != nil {
+		return nil, err
+	}
+
+	if err := n.template.ExecuteTemplate(&body, "body", digest); err != nil {
+		return nil, err
+	}
+
+	// Keep rendered values from adding headers
+	line := strings.Join(strings.Fields(subject.String()), " ")
+
+	var msg bytes.Buffer
+
+	fmt.Fprintf(&msg, "From: %s\r\n", n.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", line))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body.String(), "\n", "\r\n"))
+
+	return msg.Bytes(), nil
+}
+
+// NewDigest groups a user's notifications by kind, summing up the edits
+// to each document.
+func NewDigest(userID string, notifications []Notification) Digest {
+	digest := Digest{UserID: userID}
+	activity := make(map[string]*Activity)
+
+	for _, notification := range notifications {
+		switch notification.Kind {
+		case KindMention:
+			digest.Mentions = append(digest.Mentions, notification)
+		case KindShare:
+			digest.Shares = append(digest.Shares, notification)
+		case KindActivity:
+			a, ok := activity[notification.DocID]
+			if !ok {
+				a = &Activity{DocID: notification.DocID}
+				activity[notification.DocID] = a
+			}
+
+			a.Changes++
+
+			if notification.ActorID != "" && !slices.Contains(a.Editors, notification.ActorID) {
+				a.Editors = append(a.Editors, notification.ActorID)
+			}
+		}
+	}
+
+	for _, a := range activity {
+		slices.Sort(a.Editors)
+		digest.Activity = append(digest.Activity, *a)
+	}
+
+	slices.SortFunc(digest.Activity, func(a, b Activity) int { return strings.Compare(a.DocID, b.DocID) })
+
+	return digest
+}
+
+// Ensure SMTPNotifier implements Notifier.
+var _ Notifier = (*SMTPNotifier)(nil)
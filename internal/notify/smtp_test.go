@@ -0,0 +1,202 @@
+package notify_test
+
+import (
+	"log/slog"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/notify"
+	"github.com/serroba/online-docs/internal/preferences"
+	"github.com/stretchr/testify/require"
+)
+
+// mail is a message received by the test SMTP server.
+type mail struct {
+	to   string
+	data string // With line endings normalized to \n
+}
+
+// newSMTPServer starts an SMTP server that accepts every message and
+// returns its address and the messages it receives.
+func newSMTPServer(t *testing.T) (string, <-chan mail) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	mails := make(chan mail, 16)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go serveSMTP(textproto.NewConn(conn), mails)
+		}
+	}()
+
+	return listener.Addr().String(), mails
+}
+
+func serveSMTP(conn *textproto.Conn, mails chan<- mail) {
+	defer conn.Close()
+
+	var received mail
+
+	_ = conn.PrintfLine("220 localhost ready")
+
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO", "MAIL", "RSET", "NOOP":
+			_ = conn.PrintfLine("250 OK")
+		case "RCPT":
+			received.to = strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			_ = conn.PrintfLine("250 OK")
+		case "DATA":
+			_ = conn.PrintfLine("354 go ahead")
+
+			data, err := conn.ReadDotBytes()
+			if err != nil {
+				return
+			}
+
+			received.data = string(data)
+			mails <- received
+
+			_ = conn.PrintfLine("250 OK")
+		case "QUIT":
+			_ = conn.PrintfLine("221 bye")
+
+			return
+		default:
+			_ = conn.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+func newSMTPNotifier(t *testing.T, addr string, prefs preferences.Store) *notify.SMTPNotifier {
+	t.Helper()
+
+	notifier, err := notify.NewSMTPNotifier(notify.SMTPConfig{
+		Addr:        addr,
+		From:        "docs@example.com",
+		Preferences: prefs,
+		BatchWindow: time.Hour, // Tests flush by hand
+		Logger:      slog.New(slog.DiscardHandler),
+	})
+	require.NoError(t, err)
+	t.Cleanup(notifier.Close)
+
+	return notifier
+}
+
+func TestSMTPNotifier_Batches(t *testing.T) {
+	t.Parallel()
+
+	addr, mails := newSMTPServer(t)
+
+	prefs := preferences.NewMemoryStore()
+	require.NoError(t, prefs.SetNotifications("alice", preferences.Notifications{Email: "alice@example.com"}))
+
+	notifier := newSMTPNotifier(t, addr, prefs)
+
+	for _, n := range []notify.Notification{
+		{Kind: notify.KindActivity, UserID: "alice", DocID: "plan", ActorID: "carol"},
+		{Kind: notify.KindShare, UserID: "alice", DocID: "budget", Role: "editor"},
+		{Kind: notify.KindActivity, UserID: "alice", DocID: "plan", ActorID: "bob"},
+		{Kind: notify.KindActivity, UserID: "alice", DocID: "plan", ActorID: "carol"},
+		{Kind: notify.KindMention, UserID: "alice", DocID: "plan", ActorID: "bob", Text: "@alice can you check?"},
+		{Kind: notify.KindActivity, UserID: "alice", DocID: "notes", ActorID: "bob"},
+	} {
+		require.NoError(t, notifier.Notify(t.Context(), n))
+	}
+
+	notifier.Flush()
+
+	received := <-mails
+	require.Equal(t, "alice@example.com", received.to)
+	require.Contains(t, received.data, "To: alice@example.com\n")
+	require.Contains(t, received.data, "Subject: Activity on your documents\n")
+
+	_, body, _ := strings.Cut(received.data, "\n\n")
+	require.Equal(t, "Hi alice,\n"+
+		"bob mentioned you in plan: @alice can you check?\n"+
+		"budget was shared with you as editor.\n"+
+		"bob made 1 change to notes.\n"+
+		"bob, carol made 3 changes to plan.\n", body)
+
+	// Everything went out in the one message
+	notifier.Flush()
+
+	select {
+	case extra := <-mails:
+		t.Errorf("expected no more mail, got %+v", extra)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSMTPNotifier_Close(t *testing.T) {
+	t.Parallel()
+
+	addr, mails := newSMTPServer(t)
+
+	prefs := preferences.NewMemoryStore()
+	require.NoError(t, prefs.SetNotifications("alice", preferences.Notifications{Email: "alice@example.com"}))
+
+	notifier := newSMTPNotifier(t, addr, prefs)
+	require.NoError(t, notifier.Notify(t.Context(), notify.Notification{Kind: notify.KindShare, UserID: "bob"}))
+	require.NoError(t, notifier.Notify(t.Context(), notify.Notification{Kind: notify.KindShare, UserID: "alice"}))
+
+	// Closing sends what's pending, skipping users without an address
+	notifier.Close()
+	require.Equal(t, "alice@example.com", (<-mails).to)
+	require.Empty(t, mails)
+
+	err := notifier.Notify(t.Context(), notify.Notification{Kind: notify.KindShare, UserID: "alice"})
+	require.ErrorIs(t, err, notify.ErrClosed)
+}
+
+func TestSMTPNotifier_Template(t *testing.T) {
+	t.Parallel()
+
+	addr, mails := newSMTPServer(t)
+
+	prefs := preferences.NewMemoryStore()
+	require.NoError(t, prefs.SetNotifications("alice", preferences.Notifications{Email: "alice@example.com"}))
+
+	notifier, err := notify.NewSMTPNotifier(notify.SMTPConfig{
+		Addr:        addr,
+		From:        "docs@example.com",
+		Preferences: prefs,
+		Template: `{{define "subject"}}{{len .Shares}} new
+Bcc: mallory@example.com{{end}}{{define "body"}}{{range .Shares}}{{.DocID}}{{end}}{{end}}`,
+	})
+	require.NoError(t, err)
+
+	share := notify.Notification{Kind: notify.KindShare, UserID: "alice", DocID: "d"}
+	require.NoError(t, notifier.Notify(t.Context(), share))
+	notifier.Close()
+
+	received := <-mails
+	require.Contains(t, received.data, "Subject: 1 new Bcc: mallory@example.com\n")
+	require.True(t, strings.HasSuffix(received.data, "\n\nd\n"), received.data)
+
+	_, err = notify.NewSMTPNotifier(notify.SMTPConfig{Template: `{{define "body"}}{{end}}`})
+	require.ErrorContains(t, err, `"subject" is not defined`)
+
+	_, err = notify.NewSMTPNotifier(notify.SMTPConfig{Template: `{{if}}`})
+	require.ErrorContains(t, err, "parse template")
+}
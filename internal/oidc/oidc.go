@@ -0,0 +1,186 @@
+// Package oidc implements the OpenID Connect authorization code flow.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/serroba/online-docs/internal/jwt"
+)
+
+// Common errors.
+var (
+	ErrMissingIDToken = errors.New("token response has no id_token")
+	ErrNonceMismatch  = errors.New("id_token nonce mismatch")
+	ErrIssuerMismatch = errors.New("discovery issuer mismatch")
+)
+
+// clockLeeway is the allowed clock skew when validating ID tokens.
+const clockLeeway = time.Minute
+
+// Config holds the client registration for an OpenID provider.
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string     // Extra scopes; "openid" is always requested
+	HTTPClient   *http.Client // Optional: defaults to http.DefaultClient
+}
+
+// Identity is the authenticated end user.
+type Identity struct {
+	Subject string
+	Email   string
+	Name    string
+}
+
+// UserID returns the stable user ID used by the ACL layer.
+// The subject is unique and never reassigned by the provider.
+func (i Identity) UserID() string {
+	return i.Subject
+}
+
+// Provider is a discovered OpenID provider.
+type Provider struct {
+	cfg           Config
+	client        *http.Client
+	authEndpoint  string
+	tokenEndpoint string
+	verifier      *jwt.Verifier
+}
+
+// discoveryDocument is the subset of provider metadata we use.
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Discover fetches the provider metadata from the issuer's well-known URL.
+func Discover(ctx context.Context, cfg Config) (*Provider, error) {
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	wellKnown := strings.TrimSuffix(cfg.IssuerURL, "/") + "/.well-known/openid-configuration"
+
+	var doc discoveryDocument
+	if err := getJSON(ctx, client, wellKnown, &doc); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+
+	if doc.Issuer != cfg.IssuerURL {
+		return nil, ErrIssuerMismatch
+	}
+
+	return &Provider{
+		cfg:           cfg,
+		client:        client,
+		authEndpoint:  doc.AuthorizationEndpoint,
+		tokenEndpoint: doc.TokenEndpoint,
+		verifier: jwt.NewVerifier(jwt.VerifierConfig{
+			Keys:     jwt.NewRemoteKeySet(doc.JWKSURI, client),
+			Issuer:   doc.Issuer,
+			Audience: cfg.ClientID,
+			Leeway:   clockLeeway,
+		}),
+	}, nil
+}
+
+// AuthCodeURL returns the URL that starts the login at the provider.
+func (p *Provider) AuthCodeURL(state, nonce string) string {
+	scopes := append([]string{"openid"}, p.cfg.Scopes...)
+
+	params := url.Values{
+		"response_type": {"code"},
+		"client_id":     {p.cfg.ClientID},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"scope":         {strings.Join(scopes, " ")},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+
+	separator := "?"
+	if strings.Contains(p.authEndpoint, "?") {
+		separator = "&"
+	}
+
+	return p.authEndpoint + separator + params.Encode()
+}
+
+// Exchange redeems an authorization code and verifies the returned ID token.
+func (p *Provider) Exchange(ctx context.Context, code, nonce string) (Identity, error) {
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {p.cfg.RedirectURL},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := doJSON(p.client, req, &token); err != nil {
+		return Identity{}, fmt.Errorf("oidc token exchange: %w", err)
+	}
+
+	if token.IDToken == "" {
+		return Identity{}, ErrMissingIDToken
+	}
+
+	claims, err := p.verifier.Verify(ctx, token.IDToken)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if claims.Nonce != nonce {
+		return Identity{}, ErrNonceMismatch
+	}
+
+	return Identity{
+		Subject: claims.Subject,
+		Email:   claims.Email,
+		Name:    claims.Name,
+	}, nil
+}
+
+// getJSON fetches a URL and decodes the JSON response.
+func getJSON(ctx context.Context, client *http.Client, target string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+
+	return doJSON(client, req, v)
+}
+
+// doJSON sends a request and decodes a successful JSON response.
+func doJSON(client *http.Client, req *http.Request, v any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,205 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/oidc"
+	"github.com/serroba/online-docs/internal/oidc/oidctest"
+	"github.com/stretchr/testify/require"
+)
+
+func newProvider(t *testing.T) (*oidc.Provider, *oidctest.Server) {
+	t.Helper()
+
+	server, err := oidctest.NewServer()
+	require.NoError(t, err)
+	t.Cleanup(server.Close)
+
+	provider, err := oidc.Discover(context.Background(), oidc.Config{
+		IssuerURL:    server.URL,
+		ClientID:     oidctest.ClientID,
+		ClientSecret: "secret",
+		RedirectURL:  "http://app.example/callback",
+		Scopes:       []string{"email"},
+	})
+	require.NoError(t, err)
+
+	return provider, server
+}
+
+func TestProvider_AuthCodeURL(t *testing.T) {
+	t.Parallel()
+
+	provider, server := newProvider(t)
+
+	raw := provider.AuthCodeURL("state1", "nonce1")
+
+	u, err := url.Parse(raw)
+	require.NoError(t, err)
+
+	if u.Scheme+"://"+u.Host+u.Path != server.URL+"/authorize" {
+		t.Errorf("unexpected authorization endpoint %q", raw)
+	}
+
+	query := u.Query()
+
+	expected := map[string]string{
+		"response_type": "code",
+		"client_id":     oidctest.ClientID,
+		"redirect_uri":  "http://app.example/callback",
+		"scope":         "openid email",
+		"state":         "state1",
+		"nonce":         "nonce1",
+	}
+
+	for key, want := range expected {
+		if got := query.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestProvider_Exchange(t *testing.T) {
+	t.Parallel()
+
+	provider, server := newProvider(t)
+
+	identity, err := provider.Exchange(context.Background(), server.IssueCode("user-1", "n1"), "n1")
+	require.NoError(t, err)
+
+	if identity.UserID() != "user-1" {
+		t.Errorf("expected user ID 'user-1', got %q", identity.UserID())
+	}
+
+	if identity.Email != "user-1@example.com" {
+		t.Errorf("unexpected email %q", identity.Email)
+	}
+}
+
+func TestProvider_Exchange_NonceMismatch(t *testing.T) {
+	t.Parallel()
+
+	provider, server := newProvider(t)
+
+	_, err := provider.Exchange(context.Background(), server.IssueCode("user-1", "n1"), "other")
+	if !errors.Is(err, oidc.ErrNonceMismatch) {
+		t.Errorf("expected ErrNonceMismatch, got %v", err)
+	}
+}
+
+func TestProvider_Exchange_InvalidCode(t *testing.T) {
+	t.Parallel()
+
+	provider, _ := newProvider(t)
+
+	if _, err := provider.Exchange(context.Background(), "bogus", "n1"); err == nil {
+		t.Error("expected error for unknown code")
+	}
+}
+
+func TestProvider_Exchange_MissingIDToken(t *testing.T) {
+	t.Parallel()
+
+	issuer := newStaticIssuer(t, `{"access_token": "x"}`)
+
+	provider, err := oidc.Discover(context.Background(), oidc.Config{IssuerURL: issuer.URL, ClientID: "c"})
+	require.NoError(t, err)
+
+	if _, err := provider.Exchange(context.Background(), "code", "n"); !errors.Is(err, oidc.ErrMissingIDToken) {
+		t.Errorf("expected ErrMissingIDToken, got %v", err)
+	}
+}
+
+func TestProvider_Exchange_InvalidIDToken(t *testing.T) {
+	t.Parallel()
+
+	issuer := newStaticIssuer(t, `{"id_token": "not.a.token"}`)
+
+	provider, err := oidc.Discover(context.Background(), oidc.Config{IssuerURL: issuer.URL, ClientID: "c"})
+	require.NoError(t, err)
+
+	if _, err := provider.Exchange(context.Background(), "code", "n"); err == nil {
+		t.Error("expected error for invalid id_token")
+	}
+}
+
+func TestDiscover_Errors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("unreachable issuer", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := oidc.Discover(context.Background(), oidc.Config{IssuerURL: "http://127.0.0.1:0"})
+		if err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("bad status", func(t *testing.T) {
+		t.Parallel()
+
+		server := httptest.NewServer(http.NotFoundHandler())
+		t.Cleanup(server.Close)
+
+		if _, err := oidc.Discover(context.Background(), oidc.Config{IssuerURL: server.URL}); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("issuer mismatch", func(t *testing.T) {
+		t.Parallel()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(`{"issuer": "https://other.example"}`))
+		}))
+		t.Cleanup(server.Close)
+
+		_, err := oidc.Discover(context.Background(), oidc.Config{IssuerURL: server.URL})
+		if !errors.Is(err, oidc.ErrIssuerMismatch) {
+			t.Errorf("expected ErrIssuerMismatch, got %v", err)
+		}
+	})
+}
+
+// newStaticIssuer serves discovery metadata and a fixed token response.
+func newStaticIssuer(t *testing.T, tokenResponse string) *httptest.Server {
+	t.Helper()
+
+	var server *httptest.Server
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			_, _ = w.Write([]byte(tokenResponse))
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"issuer": "` + server.URL + `", "authorization_endpoint": "` +
+			server.URL + `/authorize?tenant=1", "token_endpoint": "` + server.URL + `/token", "jwks_uri": "` +
+			server.URL + `/jwks"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestProvider_AuthCodeURL_ExistingQuery(t *testing.T) {
+	t.Parallel()
+
+	issuer := newStaticIssuer(t, `{}`)
+
+	provider, err := oidc.Discover(context.Background(), oidc.Config{IssuerURL: issuer.URL, ClientID: "c"})
+	require.NoError(t, err)
+
+	u, err := url.Parse(provider.AuthCodeURL("s", "n"))
+	require.NoError(t, err)
+
+	if u.Query().Get("tenant") != "1" || u.Query().Get("state") != "s" {
+		t.Errorf("expected existing query to be preserved, got %q", u.RawQuery)
+	}
+}
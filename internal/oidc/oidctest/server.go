@@ -0,0 +1,126 @@
+// Package oidctest provides a fake OpenID provider for tests.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/serroba/online-docs/internal/jwt"
+)
+
+// ClientID is the client ID the fake provider issues tokens for.
+const ClientID = "test-client"
+
+// keyID identifies the provider's signing key.
+const keyID = "test-key"
+
+// Server is a fake OpenID provider backed by httptest.Server.
+type Server struct {
+	*httptest.Server
+
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]jwt.Claims
+	next  int
+}
+
+// NewServer starts a fake provider. Callers must Close it.
+func NewServer() (*Server, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		key:   key,
+		codes: make(map[string]jwt.Claims),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.handleDiscovery)
+	mux.HandleFunc("/jwks", s.handleJWKS)
+	mux.HandleFunc("/token", s.handleToken)
+
+	s.Server = httptest.NewServer(mux)
+
+	return s, nil
+}
+
+// IssueCode registers an authorization code that exchanges for an ID token
+// with the given subject and nonce.
+func (s *Server) IssueCode(subject, nonce string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.next++
+	code := "code-" + strconv.Itoa(s.next)
+	s.codes[code] = jwt.Claims{
+		Issuer:    s.URL,
+		Subject:   subject,
+		Audience:  jwt.Audience{ClientID},
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		IssuedAt:  time.Now().Unix(),
+		Nonce:     nonce,
+		Email:     subject + "@example.com",
+	}
+
+	return code
+}
+
+func (s *Server) handleDiscovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]string{
+		"issuer":                 s.URL,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) handleJWKS(w http.ResponseWriter, _ *http.Request) {
+	jwks, err := jwt.EncodeRSAPublicKey(keyID, &s.key.PublicKey)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	_, _ = w.Write(jwks)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	claims, ok := s.codes[r.FormValue("code")]
+	delete(s.codes, r.FormValue("code"))
+	s.mu.Unlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	idToken, err := jwt.Sign(jwt.RS256, keyID, s.key, claims)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	writeJSON(w, map[string]string{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,17 @@
+package ot
+
+// TransformPosition returns where a position in the document ends up once op
+// is applied. An insert at the position itself pushes it right only if push
+// is set, as for the insert's author, whose caret follows what they type.
+func TransformPosition(position int, op Operation, push bool) int {
+	switch {
+	case op.IsNoop():
+		return position
+	case op.IsInsert() && (op.Position < position || op.Position == position && push):
+		return position + 1
+	case op.IsDelete() && op.Position < position:
+		return position - 1
+	default:
+		return position
+	}
+}
@@ -0,0 +1,38 @@
+package ot_test
+
+import (
+	"testing"
+
+	"github.com/serroba/online-docs/internal/ot"
+)
+
+func TestTransformPosition(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		position int
+		op       ot.Operation
+		push     bool
+		want     int
+	}{
+		{name: "insert before", position: 3, op: ot.NewInsert("x", 1, "bob"), want: 4},
+		{name: "insert after", position: 3, op: ot.NewInsert("x", 5, "bob"), want: 3},
+		{name: "insert at the position", position: 3, op: ot.NewInsert("x", 3, "bob"), want: 3},
+		{name: "own insert at the position", position: 3, op: ot.NewInsert("x", 3, "bob"), push: true, want: 4},
+		{name: "delete before", position: 3, op: ot.NewDelete(1, "bob"), want: 2},
+		{name: "delete at the position", position: 3, op: ot.NewDelete(3, "bob"), want: 3},
+		{name: "delete after", position: 3, op: ot.NewDelete(4, "bob"), want: 3},
+		{name: "noop", position: 3, op: ot.NewDelete(-1, "bob"), want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := ot.TransformPosition(tt.position, tt.op, tt.push); got != tt.want {
+				t.Errorf("TransformPosition(%d) = %d, want %d", tt.position, got, tt.want)
+			}
+		})
+	}
+}
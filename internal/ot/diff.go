@@ -0,0 +1,34 @@
+package ot
+
+// Diff returns userID's operations turning from into to: deletes of what
+// lies between their common prefix and suffix, then inserts of what takes its
+// place. Each operation is based on the one before it, so they apply as a
+// batch.
+func Diff(from, to, userID string) []Operation {
+	source, target := []rune(from), []rune(to)
+
+	prefix := 0
+	for prefix < len(source) && prefix < len(target) && source[prefix] == target[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(source)-prefix && suffix < len(target)-prefix &&
+		source[len(source)-1-suffix] == target[len(target)-1-suffix] {
+		suffix++
+	}
+
+	removed := source[prefix : len(source)-suffix]
+	added := target[prefix : len(target)-suffix]
+	ops := make([]Operation, 0, len(removed)+len(added))
+
+	for range removed {
+		ops = append(ops, NewDelete(prefix, userID))
+	}
+
+	for i, char := range added {
+		ops = append(ops, NewInsert(string(char), prefix+i, userID))
+	}
+
+	return ops
+}
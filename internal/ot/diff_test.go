@@ -0,0 +1,57 @@
+package ot_test
+
+import (
+	"testing"
+
+	"github.com/serroba/online-docs/internal/ot"
+)
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		from string
+		to   string
+		ops  int
+	}{
+		{"unchanged", "hello", "hello", 0},
+		{"both empty", "", "", 0},
+		{"from empty", "", "hi", 2},
+		{"to empty", "hi", "", 2},
+		{"append", "hello", "hello!", 1},
+		{"prepend", "ello", "hello", 1},
+		{"replace the middle", "hello world", "hello there world", 6},
+		{"replace a word", "the cat sat", "the dog sat", 6},
+		{"repeated characters", "aaa", "aaaa", 1},
+		{"multibyte", "héllo wörld", "héllo, wörld", 1},
+		{"everything", "abc", "xyz", 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ops := ot.Diff(tt.from, tt.to, "u1")
+			if len(ops) != tt.ops {
+				t.Errorf("expected %d operations, got %d", tt.ops, len(ops))
+			}
+
+			doc := ot.NewDocument(tt.from)
+
+			for _, op := range ops {
+				if op.UserID != "u1" {
+					t.Errorf("expected operations by u1, got %q", op.UserID)
+				}
+
+				if err := doc.Apply(op); err != nil {
+					t.Fatalf("applying %+v: %v", op, err)
+				}
+			}
+
+			if doc.Content() != tt.to {
+				t.Errorf("expected %q, got %q", tt.to, doc.Content())
+			}
+		})
+	}
+}
@@ -2,23 +2,121 @@ package ot
 
 import (
 	"errors"
+	"maps"
+	"slices"
+	"strings"
 	"sync"
+	"unicode"
 )
 
 // ErrInvalidPosition is returned when an operation targets an invalid position.
 var ErrInvalidPosition = errors.New("invalid position")
 
+// ErrInvalidAttribute is returned when a format operation names no attribute.
+var ErrInvalidAttribute = errors.New("invalid attribute")
+
+// Attributes are the formatting of a character, such as "bold" set to "true"
+// or "link" set to a URL. They are never modified once set on a character,
+// so characters with the same formatting can share them.
+type Attributes map[string]string
+
+// Span is a run of text with the same formatting.
+type Span struct {
+	Text       string
+	Attributes Attributes // Nil for plain text
+}
+
+// Mark is the formatting of the characters from Start up to End.
+type Mark struct {
+	Start      int
+	End        int
+	Attributes Attributes
+}
+
 // Document represents the current state of a collaborative document.
 // It is safe for concurrent use.
 type Document struct {
 	mu      sync.RWMutex
 	content []rune
+	marks   []Attributes // Formatting of each character, nil until something is formatted, see applyFormat
+	words   int          // Maintained incrementally as operations are applied
 }
 
 // NewDocument creates a new document with the given initial content.
 func NewDocument(initial string) *Document {
+	content := []rune(initial)
+
+	return &Document{
+		content: content,
+		words:   countWords(content),
+	}
+}
+
+// NewAttributedDocument creates a new document with the given formatted
+// initial content, as returned by Spans.
+func NewAttributedDocument(spans []Span) *Document {
+	var (
+		content []rune
+		marks   []Attributes
+	)
+
+	for _, span := range spans {
+		chars := []rune(span.Text)
+		attrs := cloneAttributes(span.Attributes)
+
+		content = append(content, chars...)
+
+		for range chars {
+			marks = append(marks, attrs)
+		}
+	}
+
+	return &Document{
+		content: content,
+		marks:   marks,
+		words:   countWords(content),
+	}
+}
+
+// NewFormattedDocument creates a new document with the given initial content
+// and formatting, as returned by Marks. Returns ErrInvalidPosition if a mark
+// lies outside the content.
+func NewFormattedDocument(initial string, marks []Mark) (*Document, error) {
+	d := NewDocument(initial)
+
+	if len(marks) == 0 {
+		return d, nil
+	}
+
+	d.marks = make([]Attributes, len(d.content))
+
+	for _, mark := range marks {
+		if mark.Start < 0 || mark.Start > mark.End || mark.End > len(d.content) {
+			return nil, ErrInvalidPosition
+		}
+
+		attrs := cloneAttributes(mark.Attributes)
+
+		for i := mark.Start; i < mark.End; i++ {
+			d.marks[i] = attrs
+		}
+	}
+
+	return d, nil
+}
+
+// Clone returns a copy of the document, which operations can be applied to
+// without changing the original.
+func (d *Document) Clone() *Document {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	// Applying operations replaces the content rather than changing it, so
+	// the copy can share it
 	return &Document{
-		content: []rune(initial),
+		content: d.content,
+		marks:   slices.Clone(d.marks),
+		words:   d.words,
 	}
 }
 
@@ -38,6 +136,8 @@ func (d *Document) Apply(op Operation) error {
 		return d.applyInsert(op)
 	case Delete:
 		return d.applyDelete(op)
+	case Format:
+		return d.applyFormat(op)
 	default:
 		return errors.New("unknown operation type")
 	}
@@ -51,13 +151,26 @@ func (d *Document) applyInsert(op Operation) error {
 
 	chars := []rune(op.Char)
 
-	// Insert at position
+	// Only word boundaries next to the insertion can change
+	left, right := d.neighbors(op.Position-1, op.Position)
+	d.words += countWords(join(left, chars, right)) - countWords(join(left, right))
+
+	// Insert at position, into a new slice so ones returned by Runes stay valid
 	newContent := make([]rune, 0, len(d.content)+len(chars))
 	newContent = append(newContent, d.content[:op.Position]...)
 	newContent = append(newContent, chars...)
 	newContent = append(newContent, d.content[op.Position:]...)
 	d.content = newContent
 
+	// Inserted characters are plain, whatever surrounds them
+	if d.marks != nil {
+		newMarks := make([]Attributes, 0, len(d.marks)+len(chars))
+		newMarks = append(newMarks, d.marks[:op.Position]...)
+		newMarks = append(newMarks, make([]Attributes, len(chars))...)
+		newMarks = append(newMarks, d.marks[op.Position:]...)
+		d.marks = newMarks
+	}
+
 	return nil
 }
 
@@ -67,12 +180,62 @@ func (d *Document) applyDelete(op Operation) error {
 		return ErrInvalidPosition
 	}
 
-	// Delete at position
+	// Only word boundaries next to the deleted character can change
+	left, right := d.neighbors(op.Position-1, op.Position+1)
+	deleted := d.content[op.Position : op.Position+1]
+	d.words += countWords(join(left, right)) - countWords(join(left, deleted, right))
+
+	// Delete at position, into a new slice so ones returned by Runes stay valid
 	newContent := make([]rune, 0, len(d.content)-1)
 	newContent = append(newContent, d.content[:op.Position]...)
 	newContent = append(newContent, d.content[op.Position+1:]...)
 	d.content = newContent
 
+	if d.marks != nil {
+		newMarks := make([]Attributes, 0, len(d.marks)-1)
+		newMarks = append(newMarks, d.marks[:op.Position]...)
+		newMarks = append(newMarks, d.marks[op.Position+1:]...)
+		d.marks = newMarks
+	}
+
+	return nil
+}
+
+// applyFormat sets or removes an attribute of the character at the specified
+// position.
+func (d *Document) applyFormat(op Operation) error {
+	if op.Position < 0 || op.Position >= len(d.content) {
+		return ErrInvalidPosition
+	}
+
+	if op.Attribute == "" {
+		return ErrInvalidAttribute
+	}
+
+	// Marks are never shared with callers, so only the character's own
+	// attributes are replaced, since other characters may share them
+	if d.marks == nil {
+		d.marks = make([]Attributes, len(d.content))
+	}
+
+	attrs := cloneAttributes(d.marks[op.Position])
+
+	if op.Value == "" {
+		delete(attrs, op.Attribute)
+	} else {
+		if attrs == nil {
+			attrs = make(Attributes)
+		}
+
+		attrs[op.Attribute] = op.Value
+	}
+
+	if len(attrs) == 0 {
+		attrs = nil
+	}
+
+	d.marks[op.Position] = attrs
+
 	return nil
 }
 
@@ -84,6 +247,95 @@ func (d *Document) Content() string {
 	return string(d.content)
 }
 
+// Runes returns the document's content without copying it. The slice must
+// not be modified. Applying operations replaces it rather than changing it,
+// so it keeps the content as of the call.
+func (d *Document) Runes() []rune {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.content
+}
+
+// Spans returns the document's content split into runs of text with the same
+// formatting, nil if the document is empty. Passing them to
+// NewAttributedDocument recreates the document.
+func (d *Document) Spans() []Span {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var (
+		spans []Span
+		text  strings.Builder
+		attrs Attributes
+	)
+
+	for i, c := range d.content {
+		mark := d.markAt(i)
+		if i > 0 && !maps.Equal(mark, attrs) {
+			spans = append(spans, Span{Text: text.String(), Attributes: cloneAttributes(attrs)})
+			text.Reset()
+		}
+
+		attrs = mark
+
+		text.WriteRune(c)
+	}
+
+	if text.Len() > 0 {
+		spans = append(spans, Span{Text: text.String(), Attributes: cloneAttributes(attrs)})
+	}
+
+	return spans
+}
+
+// Marks returns the document's formatting as the runs of formatted
+// characters, in order, nil if the document is plain text. Passing them to
+// NewFormattedDocument with the content recreates the document.
+func (d *Document) Marks() []Mark {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var marks []Mark
+
+	for i := range d.content {
+		attrs := d.markAt(i)
+
+		switch {
+		case len(attrs) == 0:
+		case len(marks) > 0 && marks[len(marks)-1].End == i && maps.Equal(marks[len(marks)-1].Attributes, attrs):
+			marks[len(marks)-1].End++
+		default:
+			marks = append(marks, Mark{Start: i, End: i + 1, Attributes: cloneAttributes(attrs)})
+		}
+	}
+
+	return marks
+}
+
+// AttributesAt returns the formatting of the character at position, nil if
+// it is plain or the position is outside the document.
+func (d *Document) AttributesAt(position int) Attributes {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if position < 0 || position >= len(d.content) {
+		return nil
+	}
+
+	return cloneAttributes(d.markAt(position))
+}
+
+// markAt returns the attributes of the character at position, which must be
+// inside the document.
+func (d *Document) markAt(position int) Attributes {
+	if d.marks == nil {
+		return nil
+	}
+
+	return d.marks[position]
+}
+
 // Len returns the number of characters in the document.
 func (d *Document) Len() int {
 	d.mu.RLock()
@@ -91,3 +343,65 @@ func (d *Document) Len() int {
 
 	return len(d.content)
 }
+
+// WordCount returns the number of whitespace-separated words in the document.
+func (d *Document) WordCount() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.words
+}
+
+// neighbors returns the characters at the two positions, each empty when the
+// position is outside the document.
+func (d *Document) neighbors(left, right int) ([]rune, []rune) {
+	var l, r []rune
+
+	if left >= 0 && left < len(d.content) {
+		l = d.content[left : left+1]
+	}
+
+	if right >= 0 && right < len(d.content) {
+		r = d.content[right : right+1]
+	}
+
+	return l, r
+}
+
+// cloneAttributes returns a copy of attrs, nil if it is empty.
+func cloneAttributes(attrs Attributes) Attributes {
+	if len(attrs) == 0 {
+		return nil
+	}
+
+	return maps.Clone(attrs)
+}
+
+// join concatenates rune slices into a new slice.
+func join(parts ...[]rune) []rune {
+	var out []rune
+
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+
+	return out
+}
+
+// countWords counts maximal runs of non-whitespace characters.
+func countWords(content []rune) int {
+	words := 0
+	inWord := false
+
+	for _, c := range content {
+		switch {
+		case unicode.IsSpace(c):
+			inWord = false
+		case !inWord:
+			inWord = true
+			words++
+		}
+	}
+
+	return words
+}
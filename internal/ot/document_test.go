@@ -2,6 +2,9 @@ package ot_test
 
 import (
 	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
 
@@ -53,6 +56,30 @@ func TestDocument_NewDocument_Unicode(t *testing.T) {
 	}
 }
 
+func TestDocument_Runes(t *testing.T) {
+	t.Parallel()
+
+	doc := ot.NewDocument("abc")
+	before := doc.Runes()
+
+	if err := doc.Apply(ot.NewInsert("x", 1, "u1")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := doc.Apply(ot.NewDelete(0, "u1")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Earlier content is left as it was
+	if string(before) != "abc" {
+		t.Errorf("expected earlier runes 'abc', got %q", string(before))
+	}
+
+	if string(doc.Runes()) != "xbc" {
+		t.Errorf("expected runes 'xbc', got %q", string(doc.Runes()))
+	}
+}
+
 func TestDocument_Apply_InsertAtBeginning(t *testing.T) {
 	t.Parallel()
 
@@ -386,3 +413,281 @@ func TestDocument_IntegrationWithQueue(t *testing.T) {
 		t.Errorf("expected HEXLO, got %q", doc.Content())
 	}
 }
+
+func TestDocument_WordCount(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		initial string
+		op      ot.Operation
+		want    int
+	}{
+		{name: "counts initial words", initial: " hello  world\n", op: ot.NewInsert("", -1, "u"), want: 2},
+		{name: "insert extends a word", initial: "helo", op: ot.NewInsert("l", 2, "u"), want: 1},
+		{name: "insert starts a word", initial: "a c", op: ot.NewInsert(" b", 1, "u"), want: 3},
+		{name: "space splits a word", initial: "ab", op: ot.NewInsert(" ", 1, "u"), want: 2},
+		{name: "deleting a space joins words", initial: "a b", op: ot.NewDelete(1, "u"), want: 1},
+		{name: "deleting a lone character removes a word", initial: "a b c", op: ot.NewDelete(2, "u"), want: 2},
+		{name: "deleting inside a word keeps it", initial: "abc", op: ot.NewDelete(1, "u"), want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			doc := ot.NewDocument(tt.initial)
+			if err := doc.Apply(tt.op); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := doc.WordCount(); got != tt.want {
+				t.Errorf("expected %d words in %q, got %d", tt.want, doc.Content(), got)
+			}
+		})
+	}
+}
+
+func TestDocument_WordCount_MatchesRecount(t *testing.T) {
+	t.Parallel()
+
+	alphabet := []string{"a", "b", " ", "\n", "é"}
+	doc := ot.NewDocument("")
+
+	// Walk a deterministic but irregular sequence of inserts and deletes
+	for i := range 2000 {
+		op := ot.NewInsert(alphabet[i*7%len(alphabet)], i*7919%(doc.Len()+1), "u")
+		if doc.Len() > 0 && i%3 == 0 {
+			op = ot.NewDelete(i*104729%doc.Len(), "u")
+		}
+
+		if err := doc.Apply(op); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if want := len(strings.Fields(doc.Content())); doc.WordCount() != want {
+			t.Fatalf("expected %d words in %q, got %d", want, doc.Content(), doc.WordCount())
+		}
+	}
+}
+
+func TestDocument_Apply_Format(t *testing.T) {
+	t.Parallel()
+
+	doc := ot.NewDocument("Hello world")
+
+	// Bold "Hello", then link "world" and unbold the "o" of "Hello"
+	ops := ot.NewFormatRange(0, 5, "bold", "true", "alice")
+	ops = append(ops, ot.NewFormatRange(6, 5, "link", "https://example.com", "alice")...)
+	ops = append(ops, ot.NewFormat(4, "bold", "", "alice"))
+
+	for _, op := range ops {
+		if err := doc.Apply(op); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	expected := []ot.Span{
+		{Text: "Hell", Attributes: ot.Attributes{"bold": "true"}},
+		{Text: "o "},
+		{Text: "world", Attributes: ot.Attributes{"link": "https://example.com"}},
+	}
+	if spans := doc.Spans(); !reflect.DeepEqual(spans, expected) {
+		t.Errorf("expected %+v, got %+v", expected, spans)
+	}
+
+	// Formatting leaves the text alone
+	if doc.Content() != "Hello world" || doc.WordCount() != 2 {
+		t.Errorf("expected unchanged content, got %q", doc.Content())
+	}
+}
+
+func TestDocument_Apply_FormatThenEdit(t *testing.T) {
+	t.Parallel()
+
+	doc := ot.NewDocument("abc")
+
+	for _, op := range []ot.Operation{
+		ot.NewFormat(1, "italic", "true", "alice"),
+		ot.NewInsert("x", 1, "alice"), // Plain, even next to italic text
+		ot.NewDelete(0, "alice"),
+	} {
+		if err := doc.Apply(op); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	expected := []ot.Span{
+		{Text: "x"},
+		{Text: "b", Attributes: ot.Attributes{"italic": "true"}},
+		{Text: "c"},
+	}
+	if spans := doc.Spans(); !reflect.DeepEqual(spans, expected) {
+		t.Errorf("expected %+v, got %+v", expected, spans)
+	}
+
+	if attrs := doc.AttributesAt(1); attrs["italic"] != "true" {
+		t.Errorf("expected italic at 1, got %v", attrs)
+	}
+
+	if attrs := doc.AttributesAt(3); attrs != nil {
+		t.Errorf("expected no attributes outside the document, got %v", attrs)
+	}
+}
+
+func TestDocument_Apply_FormatInvalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		op       ot.Operation
+		expected error
+	}{
+		{"past end", ot.NewFormat(5, "bold", "true", "alice"), ot.ErrInvalidPosition},
+		{"no attribute", ot.NewFormat(0, "", "true", "alice"), ot.ErrInvalidAttribute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			doc := ot.NewDocument(testDocHello)
+
+			if err := doc.Apply(tt.op); !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+
+			if doc.Spans()[0].Attributes != nil {
+				t.Errorf("expected plain text, got %+v", doc.Spans())
+			}
+		})
+	}
+}
+
+func TestDocument_Spans_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	spans := []ot.Span{
+		{Text: "Read "},
+		{Text: "the docs", Attributes: ot.Attributes{"link": "https://example.com", "bold": "true"}},
+		{Text: " 🌍"},
+	}
+
+	doc := ot.NewAttributedDocument(spans)
+
+	if doc.Content() != "Read the docs 🌍" {
+		t.Errorf("unexpected content %q", doc.Content())
+	}
+
+	if got := doc.Spans(); !reflect.DeepEqual(got, spans) {
+		t.Errorf("expected %+v, got %+v", spans, got)
+	}
+
+	// The document keeps its own copy of the attributes
+	spans[1].Attributes["bold"] = "false"
+
+	if attrs := doc.AttributesAt(5); attrs["bold"] != "true" {
+		t.Errorf("expected bold to stay set, got %v", attrs)
+	}
+
+	if spans := ot.NewDocument("").Spans(); spans != nil {
+		t.Errorf("expected no spans for an empty document, got %+v", spans)
+	}
+}
+
+func TestDocument_Marks_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	doc := ot.NewDocument("Read the docs")
+
+	ops := ot.NewFormatRange(5, 8, "bold", "true", "u1")
+	ops = append(ops, ot.NewFormatRange(9, 4, "link", "https://example.com", "u1")...)
+
+	for _, op := range ops {
+		if err := doc.Apply(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []ot.Mark{
+		{Start: 5, End: 9, Attributes: ot.Attributes{"bold": "true"}},
+		{Start: 9, End: 13, Attributes: ot.Attributes{"bold": "true", "link": "https://example.com"}},
+	}
+
+	marks := doc.Marks()
+	if !reflect.DeepEqual(marks, want) {
+		t.Fatalf("expected %+v, got %+v", want, marks)
+	}
+
+	rebuilt, err := ot.NewFormattedDocument(doc.Content(), marks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(rebuilt.Spans(), doc.Spans()) {
+		t.Errorf("expected %+v, got %+v", doc.Spans(), rebuilt.Spans())
+	}
+
+	if marks := ot.NewDocument("plain").Marks(); marks != nil {
+		t.Errorf("expected no marks for plain text, got %+v", marks)
+	}
+
+	for _, mark := range []ot.Mark{{Start: -1, End: 1}, {Start: 2, End: 1}, {Start: 0, End: 14}} {
+		if _, err := ot.NewFormattedDocument("Read the docs", []ot.Mark{mark}); !errors.Is(err, ot.ErrInvalidPosition) {
+			t.Errorf("expected ErrInvalidPosition for %+v, got %v", mark, err)
+		}
+	}
+}
+
+func TestDocument_Clone(t *testing.T) {
+	t.Parallel()
+
+	doc := ot.NewDocument("hello world")
+	if err := doc.Apply(ot.NewFormat(0, "bold", "true", "u1")); err != nil {
+		t.Fatal(err)
+	}
+
+	clone := doc.Clone()
+
+	for _, op := range []ot.Operation{ot.NewDelete(0, "u1"), ot.NewFormat(0, "italic", "true", "u1")} {
+		if err := clone.Apply(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if doc.Content() != "hello world" || doc.WordCount() != 2 {
+		t.Errorf("expected the original unchanged, got %q", doc.Content())
+	}
+
+	if attrs := doc.AttributesAt(0); !reflect.DeepEqual(attrs, ot.Attributes{"bold": "true"}) {
+		t.Errorf("expected the original's formatting unchanged, got %v", attrs)
+	}
+
+	if clone.Content() != "ello world" {
+		t.Errorf("unexpected clone content %q", clone.Content())
+	}
+
+	if attrs := clone.AttributesAt(0); !reflect.DeepEqual(attrs, ot.Attributes{"italic": "true"}) {
+		t.Errorf("unexpected clone formatting %v", attrs)
+	}
+}
+
+func BenchmarkDocument_Apply(b *testing.B) {
+	for _, size := range []int{1_000, 100_000} {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			doc := ot.NewDocument(strings.Repeat("a", size))
+			middle := size / 2
+
+			// Insert and delete in turn, so the content stays the same size
+			for b.Loop() {
+				if err := doc.Apply(ot.NewInsert("b", middle, "u1")); err != nil {
+					b.Fatal(err)
+				}
+
+				if err := doc.Apply(ot.NewDelete(middle, "u1")); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -6,14 +6,17 @@ type OpType int
 const (
 	Insert OpType = iota
 	Delete
+	Format
 )
 
 // Operation represents a single edit operation in the document.
 type Operation struct {
-	Type     OpType
-	Position int    // Character position in the document
-	Char     string // Character to insert (empty for delete)
-	UserID   string // Used for tie-breaking concurrent inserts at same position
+	Type      OpType
+	Position  int    // Character position in the document
+	Char      string // Character to insert (empty for delete)
+	UserID    string // Used for tie-breaking concurrent inserts at same position
+	Attribute string // Attribute to set on the character (format only)
+	Value     string // Attribute's new value, empty to remove it (format only)
 }
 
 // NewInsert creates an insert operation.
@@ -35,6 +38,31 @@ func NewDelete(position int, userID string) Operation {
 	}
 }
 
+// NewFormat creates a format operation setting an attribute of the character
+// at position to value, or removing the attribute if value is empty.
+func NewFormat(position int, attribute, value, userID string) Operation {
+	return Operation{
+		Type:      Format,
+		Position:  position,
+		UserID:    userID,
+		Attribute: attribute,
+		Value:     value,
+	}
+}
+
+// NewFormatRange creates the format operations setting an attribute over
+// length characters starting at position. Formatting is per character, like
+// edits, so text inserted into the range concurrently stays as it was typed.
+func NewFormatRange(position, length int, attribute, value, userID string) []Operation {
+	ops := make([]Operation, 0, length)
+
+	for i := range length {
+		ops = append(ops, NewFormat(position+i, attribute, value, userID))
+	}
+
+	return ops
+}
+
 // IsInsert returns true if this is an insert operation.
 func (o Operation) IsInsert() bool {
 	return o.Type == Insert
@@ -45,6 +73,11 @@ func (o Operation) IsDelete() bool {
 	return o.Type == Delete
 }
 
+// IsFormat returns true if this is a format operation.
+func (o Operation) IsFormat() bool {
+	return o.Type == Format
+}
+
 // IsNoop returns true if the operation has become a no-op (position -1).
 func (o Operation) IsNoop() bool {
 	return o.Position < 0
@@ -1,17 +1,22 @@
 package ot
 
 import (
+	"cmp"
 	"errors"
+	"slices"
 	"sync"
+	"time"
 )
 
 // ErrRevisionTooOld is returned when the client's base revision is too far behind.
 var ErrRevisionTooOld = errors.New("base revision too old, history unavailable")
 
-// SequencedOperation wraps an operation with its assigned revision.
+// SequencedOperation wraps an operation with its assigned revision and the
+// time it was assigned.
 type SequencedOperation struct {
 	Operation
-	Revision int
+	Revision  int
+	Timestamp time.Time // When it was sequenced; zero if that wasn't recorded
 }
 
 // Queue manages the sequencing and transformation of concurrent operations.
@@ -50,6 +55,16 @@ func (q *Queue) SetRevision(rev int) {
 	q.revision = rev
 }
 
+// SetHistory replaces the history (used when taking a session over from
+// another process). Only the most recent operations that fit are kept.
+func (q *Queue) SetHistory(history []SequencedOperation) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	history = history[max(0, len(history)-q.historySize):]
+	q.history = append(make([]SequencedOperation, 0, q.historySize), history...)
+}
+
 // HistorySize returns the maximum history size.
 func (q *Queue) HistorySize() int {
 	return q.historySize
@@ -62,31 +77,15 @@ func (q *Queue) Apply(op Operation, baseRevision int) (SequencedOperation, error
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
-	// Validate base revision
-	if baseRevision > q.revision {
-		return SequencedOperation{}, errors.New("base revision is in the future")
-	}
-
-	// Check if we have enough history to transform
-	// We need all operations after baseRevision to be in history
-	if baseRevision < q.revision && len(q.history) > 0 {
-		oldestAvailable := q.history[0].Revision
-
-		// If client is based on revision older than our oldest history entry - 1,
-		// we can't properly transform
-		if baseRevision < oldestAvailable-1 {
-			return SequencedOperation{}, ErrRevisionTooOld
-		}
+	if err := q.checkBase(baseRevision); err != nil {
+		return SequencedOperation{}, err
 	}
 
 	// Transform against all operations since baseRevision
 	transformed := op
 
-	for _, histOp := range q.history {
-		if histOp.Revision > baseRevision {
-			// Transform our operation against this historical operation
-			transformed, _ = Transform(transformed, histOp.Operation)
-		}
+	for _, histOp := range q.history[q.after(baseRevision):] {
+		transformed, _ = Transform(transformed, histOp.Operation)
 	}
 
 	// Assign new revision
@@ -95,6 +94,7 @@ func (q *Queue) Apply(op Operation, baseRevision int) (SequencedOperation, error
 	result := SequencedOperation{
 		Operation: transformed,
 		Revision:  q.revision,
+		Timestamp: time.Now(),
 	}
 
 	// Add to history
@@ -103,6 +103,61 @@ func (q *Queue) Apply(op Operation, baseRevision int) (SequencedOperation, error
 	return result, nil
 }
 
+// TransformBatch transforms a batch of operations against any that have
+// occurred since baseRevision. The first operation is based on baseRevision
+// and each of the others on the one before it; the results apply in order
+// at the current revision. The queue is left unchanged.
+func (q *Queue) TransformBatch(ops []Operation, baseRevision int) ([]Operation, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if err := q.checkBase(baseRevision); err != nil {
+		return nil, err
+	}
+
+	concurrent := make([]Operation, 0, q.revision-baseRevision)
+	for _, histOp := range q.history[q.after(baseRevision):] {
+		concurrent = append(concurrent, histOp.Operation)
+	}
+
+	// Each operation also moves the concurrent ones past it, so they're
+	// based on the same state as the next
+	transformed := make([]Operation, len(ops))
+
+	for i, op := range ops {
+		for j, other := range concurrent {
+			op, concurrent[j] = Transform(op, other)
+		}
+
+		transformed[i] = op
+	}
+
+	return transformed, nil
+}
+
+// checkBase returns why operations based on baseRevision can't be
+// transformed, if they can't. Must be called with mu held.
+func (q *Queue) checkBase(baseRevision int) error {
+	// Validate base revision
+	if baseRevision > q.revision {
+		return errors.New("base revision is in the future")
+	}
+
+	// Check if we have enough history to transform
+	// We need all operations after baseRevision to be in history
+	if baseRevision < q.revision && len(q.history) > 0 {
+		oldestAvailable := q.history[0].Revision
+
+		// If client is based on revision older than our oldest history entry - 1,
+		// we can't properly transform
+		if baseRevision < oldestAvailable-1 {
+			return ErrRevisionTooOld
+		}
+	}
+
+	return nil
+}
+
 // addToHistory adds an operation to history, pruning old entries if needed.
 func (q *Queue) addToHistory(op SequencedOperation) {
 	q.history = append(q.history, op)
@@ -119,13 +174,24 @@ func (q *Queue) History(sinceRevision int) []SequencedOperation {
 	q.mu.RLock()
 	defer q.mu.RUnlock()
 
-	var result []SequencedOperation
+	ops := q.history[q.after(sinceRevision):]
+	if len(ops) == 0 {
+		return nil
+	}
+
+	return slices.Clone(ops)
+}
 
-	for _, op := range q.history {
-		if op.Revision > sinceRevision {
-			result = append(result, op)
-		}
+// after returns the index of the first history entry after revision. The
+// history is ordered by revision, so clients just behind the head don't
+// cost a scan of all of it. Must be called with mu held.
+func (q *Queue) after(revision int) int {
+	i, found := slices.BinarySearchFunc(q.history, revision, func(op SequencedOperation, rev int) int {
+		return cmp.Compare(op.Revision, rev)
+	})
+	if found {
+		i++
 	}
 
-	return result
+	return i
 }
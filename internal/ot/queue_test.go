@@ -2,6 +2,7 @@ package ot_test
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 	"testing"
 
@@ -34,6 +35,33 @@ func TestQueue_SetRevision(t *testing.T) {
 	}
 }
 
+func TestQueue_SetHistory(t *testing.T) {
+	t.Parallel()
+
+	// A queue taking over at revision 3, after alice inserted "a", "b" and "c"
+	q := ot.NewQueue(2)
+	q.SetRevision(3)
+	q.SetHistory([]ot.SequencedOperation{
+		{Operation: ot.NewInsert("a", 0, "alice"), Revision: 1},
+		{Operation: ot.NewInsert("b", 1, "alice"), Revision: 2},
+		{Operation: ot.NewInsert("c", 2, "alice"), Revision: 3},
+	})
+
+	if history := q.History(0); len(history) != 2 || history[0].Revision != 2 {
+		t.Fatalf("expected the two most recent operations, got %v", history)
+	}
+
+	// Bob inserted after "a" before seeing "b" and "c", so his insert moves past them
+	result, err := q.Apply(ot.NewInsert("x", 1, "bob"), 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Position != 3 || result.Revision != 4 {
+		t.Errorf("expected insert at 3 as revision 4, got %d at revision %d", result.Position, result.Revision)
+	}
+}
+
 func TestQueue_HistorySize(t *testing.T) {
 	t.Parallel()
 
@@ -292,6 +320,44 @@ func TestQueue_History_Empty(t *testing.T) {
 	}
 }
 
+func TestQueue_History_AfterPruning(t *testing.T) {
+	t.Parallel()
+
+	// Revisions 6 to 10 are retained
+	q := ot.NewQueue(5)
+
+	for i := range 10 {
+		_, _ = q.Apply(ot.NewInsert("x", i, "user"), i)
+	}
+
+	tests := []struct {
+		since int
+		first int // Revision of the first operation returned, 0 for none
+		count int
+	}{
+		{since: 0, first: 6, count: 5},
+		{since: 5, first: 6, count: 5},
+		{since: 6, first: 7, count: 4},
+		{since: 9, first: 10, count: 1},
+		{since: 10, count: 0},
+		{since: 12, count: 0},
+	}
+
+	for _, tt := range tests {
+		history := q.History(tt.since)
+
+		if len(history) != tt.count {
+			t.Errorf("History(%d): expected %d operations, got %d", tt.since, tt.count, len(history))
+
+			continue
+		}
+
+		if tt.count > 0 && history[0].Revision != tt.first {
+			t.Errorf("History(%d): expected to start at revision %d, got %d", tt.since, tt.first, history[0].Revision)
+		}
+	}
+}
+
 func TestQueue_ConcurrentAccess(t *testing.T) {
 	t.Parallel()
 
@@ -346,3 +412,87 @@ func TestQueue_HistoryPruning(t *testing.T) {
 		t.Errorf("expected oldest revision 6, got %d", history[0].Revision)
 	}
 }
+
+func BenchmarkQueue_Apply(b *testing.B) {
+	// Each operation is based on the oldest revision still in history, so
+	// it's transformed against all of it
+	for _, depth := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("history=%d", depth), func(b *testing.B) {
+			q := ot.NewQueue(depth)
+
+			for i := range depth {
+				_, err := q.Apply(ot.NewInsert("a", i, "u1"), q.Revision())
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			for b.Loop() {
+				_, err := q.Apply(ot.NewInsert("b", 0, "u2"), q.Revision()-depth+1)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestQueue_TransformBatch(t *testing.T) {
+	t.Parallel()
+
+	q := ot.NewQueue(100)
+
+	// On "abc", Alice inserts "X" at the start
+	if _, err := q.Apply(ot.NewInsert("X", 0, "alice"), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Bob, who hasn't seen it, appends "12" and then deletes the "a"
+	batch := []ot.Operation{
+		ot.NewInsert("1", 3, "bob"),
+		ot.NewInsert("2", 4, "bob"),
+		ot.NewDelete(0, "bob"),
+	}
+
+	got, err := q.TransformBatch(batch, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []ot.Operation{
+		ot.NewInsert("1", 4, "bob"),
+		ot.NewInsert("2", 5, "bob"),
+		ot.NewDelete(1, "bob"),
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("operation %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+
+	if q.Revision() != 1 {
+		t.Errorf("expected the queue to stay at revision 1, got %d", q.Revision())
+	}
+
+	if _, err := q.TransformBatch(batch, 2); err == nil {
+		t.Error("expected an error for a future base revision")
+	}
+}
+
+func TestQueue_TransformBatch_TooOld(t *testing.T) {
+	t.Parallel()
+
+	q := ot.NewQueue(2)
+
+	for i := range 4 {
+		if _, err := q.Apply(ot.NewInsert("a", i, "alice"), i); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	_, err := q.TransformBatch([]ot.Operation{ot.NewInsert("b", 0, "bob")}, 0)
+	if !errors.Is(err, ot.ErrRevisionTooOld) {
+		t.Errorf("expected ErrRevisionTooOld, got %v", err)
+	}
+}
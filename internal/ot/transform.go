@@ -7,6 +7,15 @@ package ot
 // Returns: op1' (op1 transformed against op2), op2' (op2 transformed against op1).
 func Transform(op1, op2 Operation) (Operation, Operation) {
 	switch {
+	case op1.IsNoop() || op2.IsNoop():
+		// A no-op changes nothing, so neither side needs adjusting
+		return op1, op2
+	case op1.IsFormat() && op2.IsFormat():
+		return transformFormatFormat(op1, op2)
+	case op1.IsFormat():
+		return transformFormat(op1, op2), op2
+	case op2.IsFormat():
+		return op1, transformFormat(op2, op1)
 	case op1.IsInsert() && op2.IsInsert():
 		return transformInsertInsert(op1, op2)
 	case op1.IsDelete() && op2.IsDelete():
@@ -84,3 +93,44 @@ func transformInsertDelete(ins, del Operation) (Operation, Operation) {
 
 	return insPrime, delPrime
 }
+
+// transformFormat transforms a format against a concurrent insert or delete.
+// The edit needs no adjusting, since formatting doesn't move characters.
+func transformFormat(format, edit Operation) Operation {
+	formatPrime := format
+
+	switch {
+	case edit.IsInsert() && edit.Position <= format.Position:
+		// Inserted at or before the formatted character, shift right
+		formatPrime.Position++
+	case edit.IsDelete() && edit.Position < format.Position:
+		// Deleted before the formatted character, shift left
+		formatPrime.Position--
+	case edit.IsDelete() && edit.Position == format.Position:
+		// The formatted character is gone
+		formatPrime.Position = -1 // Mark as no-op
+	}
+
+	return formatPrime
+}
+
+// transformFormatFormat handles two concurrent formats. They only conflict
+// when setting the same attribute of the same character to different values.
+func transformFormatFormat(op1, op2 Operation) (Operation, Operation) {
+	op1Prime := op1
+	op2Prime := op2
+
+	if op1.Position != op2.Position || op1.Attribute != op2.Attribute || op1.Value == op2.Value {
+		return op1Prime, op2Prime
+	}
+
+	// Lower UserID wins, then lower value, and the other is dropped so
+	// whichever is applied last doesn't overwrite it
+	if op1.UserID < op2.UserID || op1.UserID == op2.UserID && op1.Value < op2.Value {
+		op2Prime.Position = -1 // Mark as no-op
+	} else {
+		op1Prime.Position = -1 // Mark as no-op
+	}
+
+	return op1Prime, op2Prime
+}
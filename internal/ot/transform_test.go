@@ -1,6 +1,7 @@
 package ot_test
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/serroba/online-docs/internal/ot"
@@ -104,6 +105,25 @@ func TestTransform_DeleteVsDelete_SamePosition(t *testing.T) {
 	}
 }
 
+func TestTransform_AgainstNoop(t *testing.T) {
+	t.Parallel()
+
+	// A delete that lost a race stays in history as a no-op
+	noop := ot.NewDelete(-1, "bob")
+
+	for _, op := range []ot.Operation{ot.NewInsert("a", 3, "alice"), ot.NewDelete(3, "alice")} {
+		opPrime, noopPrime := ot.Transform(op, noop)
+
+		if opPrime.Position != 3 {
+			t.Errorf("%v should stay at 3, got %d", op.Type, opPrime.Position)
+		}
+
+		if !noopPrime.IsNoop() {
+			t.Errorf("no-op should stay a no-op, got position %d", noopPrime.Position)
+		}
+	}
+}
+
 func TestTransform_InsertVsDelete_InsertBefore(t *testing.T) {
 	t.Parallel()
 
@@ -207,6 +227,136 @@ func TestTransform_HelloExample(t *testing.T) {
 	}
 }
 
+func TestTransform_FormatVsEdit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		edit     ot.Operation
+		expected int
+	}{
+		{"insert before", ot.NewInsert("x", 1, "bob"), 3},
+		{"insert at", ot.NewInsert("x", 2, "bob"), 3},
+		{"insert after", ot.NewInsert("x", 3, "bob"), 2},
+		{"delete before", ot.NewDelete(1, "bob"), 1},
+		{"delete at", ot.NewDelete(2, "bob"), -1},
+		{"delete after", ot.NewDelete(3, "bob"), 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			format := ot.NewFormat(2, "bold", "true", "alice")
+
+			formatPrime, editPrime := ot.Transform(format, tt.edit)
+			if formatPrime.Position != tt.expected {
+				t.Errorf("format should move to %d, got %d", tt.expected, formatPrime.Position)
+			}
+
+			if editPrime != tt.edit {
+				t.Errorf("edit should be unchanged, got %+v", editPrime)
+			}
+
+			// Same result with the operations the other way round
+			editPrime, formatPrime = ot.Transform(tt.edit, format)
+			if formatPrime.Position != tt.expected || editPrime != tt.edit {
+				t.Errorf("transform isn't symmetric: %+v, %+v", editPrime, formatPrime)
+			}
+		})
+	}
+}
+
+func TestTransform_FormatVsFormat(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		op1, op2     ot.Operation
+		noop1, noop2 bool
+	}{
+		{
+			"different positions",
+			ot.NewFormat(1, "bold", "true", "alice"), ot.NewFormat(2, "bold", "", "bob"),
+			false, false,
+		},
+		{
+			"different attributes",
+			ot.NewFormat(1, "bold", "true", "alice"), ot.NewFormat(1, "italic", "true", "bob"),
+			false, false,
+		},
+		{
+			"same value",
+			ot.NewFormat(1, "bold", "true", "alice"), ot.NewFormat(1, "bold", "true", "bob"),
+			false, false,
+		},
+		{
+			"lower user wins",
+			ot.NewFormat(1, "link", "https://b", "bob"), ot.NewFormat(1, "link", "https://a", "alice"),
+			true, false,
+		},
+		{
+			"same user, lower value wins",
+			ot.NewFormat(1, "link", "https://a", "alice"), ot.NewFormat(1, "link", "https://b", "alice"),
+			false, true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			op1Prime, op2Prime := ot.Transform(tt.op1, tt.op2)
+			if op1Prime.IsNoop() != tt.noop1 {
+				t.Errorf("op1 should be a no-op: %v, got %+v", tt.noop1, op1Prime)
+			}
+
+			if op2Prime.IsNoop() != tt.noop2 {
+				t.Errorf("op2 should be a no-op: %v, got %+v", tt.noop2, op2Prime)
+			}
+		})
+	}
+}
+
+func TestTransform_FormatConvergence(t *testing.T) {
+	t.Parallel()
+
+	ops := []ot.Operation{
+		ot.NewInsert("X", 0, "alice"),
+		ot.NewInsert("X", 2, "alice"),
+		ot.NewInsert("X", 5, "alice"),
+		ot.NewDelete(0, "alice"),
+		ot.NewDelete(2, "alice"),
+		ot.NewFormat(0, "bold", "true", "alice"),
+		ot.NewFormat(2, "bold", "true", "alice"),
+		ot.NewFormat(2, "bold", "", "alice"),
+		ot.NewFormat(2, "italic", "true", "alice"),
+	}
+
+	for _, op1 := range ops {
+		for _, op2 := range ops {
+			op2.UserID = "bob"
+
+			op1Prime, op2Prime := ot.Transform(op1, op2)
+
+			// Path 1: Apply op1 first, then transformed op2
+			doc1 := ot.NewDocument(testDocHello)
+			_ = doc1.Apply(op1)
+			_ = doc1.Apply(op2Prime)
+
+			// Path 2: Apply op2 first, then transformed op1
+			doc2 := ot.NewDocument(testDocHello)
+			_ = doc2.Apply(op2)
+			_ = doc2.Apply(op1Prime)
+
+			if !reflect.DeepEqual(doc1.Spans(), doc2.Spans()) {
+				t.Errorf("documents diverged for %+v and %+v\nPath1: %+v\nPath2: %+v",
+					op1, op2, doc1.Spans(), doc2.Spans())
+			}
+		}
+	}
+}
+
 // Helper functions to simulate document operations.
 func applyInsert(doc string, pos int, char string) string {
 	if pos < 0 || pos > len(doc) {
@@ -223,3 +373,25 @@ func applyDelete(doc string, pos int) string {
 
 	return doc[:pos] + doc[pos+1:]
 }
+
+func BenchmarkTransform(b *testing.B) {
+	benchmarks := []struct {
+		name     string
+		op1, op2 ot.Operation
+	}{
+		{"insert-insert", ot.NewInsert("a", 5, "u1"), ot.NewInsert("b", 3, "u2")},
+		{"insert-delete", ot.NewInsert("a", 5, "u1"), ot.NewDelete(3, "u2")},
+		{"delete-insert", ot.NewDelete(5, "u1"), ot.NewInsert("b", 3, "u2")},
+		{"delete-delete", ot.NewDelete(5, "u1"), ot.NewDelete(3, "u2")},
+		{"format-insert", ot.NewFormat(5, "bold", "true", "u1"), ot.NewInsert("b", 3, "u2")},
+		{"format-format", ot.NewFormat(5, "bold", "true", "u1"), ot.NewFormat(5, "bold", "", "u2")},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for b.Loop() {
+				ot.Transform(bm.op1, bm.op2)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package preferences
+
+import (
+	"slices"
+	"sync"
+)
+
+// MemoryStore is an in-memory implementation of the Store interface.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	starred       map[string]map[string]struct{} // user ID -> starred document IDs
+	notifications map[string]Notifications       // user ID -> settings
+}
+
+// NewMemoryStore creates a new in-memory preferences store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		starred:       make(map[string]map[string]struct{}),
+		notifications: make(map[string]Notifications),
+	}
+}
+
+// Star marks a document as starred by a user.
+func (m *MemoryStore) Star(userID, docID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	docs, exists := m.starred[userID]
+	if !exists {
+		docs = make(map[string]struct{})
+		m.starred[userID] = docs
+	}
+
+	docs[docID] = struct{}{}
+
+	return nil
+}
+
+// Unstar removes a user's star from a document.
+func (m *MemoryStore) Unstar(userID, docID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	docs := m.starred[userID]
+	delete(docs, docID)
+
+	if len(docs) == 0 {
+		delete(m.starred, userID)
+	}
+
+	return nil
+}
+
+// IsStarred reports whether a user has starred a document.
+func (m *MemoryStore) IsStarred(userID, docID string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, starred := m.starred[userID][docID]
+
+	return starred, nil
+}
+
+// ListStarred returns the IDs of the documents a user has starred, sorted.
+func (m *MemoryStore) ListStarred(userID string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	docIDs := make([]string, 0, len(m.starred[userID]))
+	for docID := range m.starred[userID] {
+		docIDs = append(docIDs, docID)
+	}
+
+	slices.Sort(docIDs)
+
+	return docIDs, nil
+}
+
+// Notifications returns a user's notification settings.
+func (m *MemoryStore) Notifications(userID string) (Notifications, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.notifications[userID], nil
+}
+
+// SetNotifications replaces a user's notification settings.
+func (m *MemoryStore) SetNotifications(userID string, settings Notifications) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if settings == (Notifications{}) {
+		delete(m.notifications, userID)
+	} else {
+		m.notifications[userID] = settings
+	}
+
+	return nil
+}
+
+// Ensure MemoryStore implements Store.
+var _ Store = (*MemoryStore)(nil)
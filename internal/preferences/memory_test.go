@@ -0,0 +1,79 @@
+package preferences_test
+
+import (
+	"testing"
+
+	"github.com/serroba/online-docs/internal/preferences"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore_Star(t *testing.T) {
+	t.Parallel()
+
+	store := preferences.NewMemoryStore()
+
+	require.NoError(t, store.Star("alice", "doc2"))
+	require.NoError(t, store.Star("alice", "doc1"))
+	require.NoError(t, store.Star("alice", "doc1")) // Starring twice is harmless
+	require.NoError(t, store.Star("bob", "doc3"))
+
+	starred, err := store.IsStarred("alice", "doc1")
+	require.NoError(t, err)
+	require.True(t, starred)
+
+	// Stars are per user
+	starred, err = store.IsStarred("bob", "doc1")
+	require.NoError(t, err)
+	require.False(t, starred)
+
+	docIDs, err := store.ListStarred("alice")
+	require.NoError(t, err)
+	require.Equal(t, []string{"doc1", "doc2"}, docIDs)
+}
+
+func TestMemoryStore_Unstar(t *testing.T) {
+	t.Parallel()
+
+	store := preferences.NewMemoryStore()
+	require.NoError(t, store.Star("alice", "doc1"))
+
+	require.NoError(t, store.Unstar("alice", "doc1"))
+	require.NoError(t, store.Unstar("alice", "doc1")) // Unstarring twice is harmless
+	require.NoError(t, store.Unstar("bob", "doc1"))
+
+	starred, err := store.IsStarred("alice", "doc1")
+	require.NoError(t, err)
+
+	if starred {
+		t.Error("expected doc1 to be unstarred")
+	}
+
+	docIDs, err := store.ListStarred("alice")
+	require.NoError(t, err)
+
+	if docIDs == nil || len(docIDs) != 0 {
+		t.Errorf("expected an empty list, got %#v", docIDs)
+	}
+}
+
+func TestMemoryStore_Notifications(t *testing.T) {
+	t.Parallel()
+
+	store := preferences.NewMemoryStore()
+
+	settings, err := store.Notifications("alice")
+	require.NoError(t, err)
+	require.Equal(t, preferences.Notifications{}, settings)
+
+	want := preferences.Notifications{Email: "alice@example.com", Shares: true}
+	require.NoError(t, store.SetNotifications("alice", want))
+
+	settings, err = store.Notifications("alice")
+	require.NoError(t, err)
+	require.Equal(t, want, settings)
+
+	// Settings are per user
+	settings, err = store.Notifications("bob")
+	require.NoError(t, err)
+	require.Equal(t, preferences.Notifications{}, settings)
+}
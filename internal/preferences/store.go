@@ -0,0 +1,35 @@
+// Package preferences persists per-user settings, such as the documents a
+// user has starred and how they want to be notified.
+package preferences
+
+// Notifications are a user's notification settings. The zero value sends
+// nothing.
+type Notifications struct {
+	Email    string // Address to send notifications to; empty disables them
+	Mentions bool   // Notify when someone mentions the user
+	Shares   bool   // Notify when a document is shared with the user
+	Activity bool   // Notify when others edit the user's documents while they're away
+}
+
+// Store defines the interface for persisting user preferences.
+type Store interface {
+	// Star marks a document as starred by a user. Starring it again is a no-op.
+	Star(userID, docID string) error
+
+	// Unstar removes a user's star from a document. Unstarring a document
+	// that isn't starred is a no-op.
+	Unstar(userID, docID string) error
+
+	// IsStarred reports whether a user has starred a document.
+	IsStarred(userID, docID string) (bool, error)
+
+	// ListStarred returns the IDs of the documents a user has starred, sorted.
+	ListStarred(userID string) ([]string, error)
+
+	// Notifications returns a user's notification settings, or the zero
+	// value if they haven't set any.
+	Notifications(userID string) (Notifications, error)
+
+	// SetNotifications replaces a user's notification settings.
+	SetNotifications(userID string, settings Notifications) error
+}
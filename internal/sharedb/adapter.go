@@ -0,0 +1,442 @@
+// Package sharedb lets ShareDB clients edit documents over the ShareDB wire
+// protocol. Each document is served as a string of the "text" type, or as a
+// json0 object with the content in a string field, depending on the
+// collection it's requested from.
+//
+// ShareDB numbers a document's versions by op, while a session numbers its
+// revisions by character operation. So the adapter keeps a ShareDB copy of
+// each document in use, with its own version and recent ops, and edits the
+// document's session as one more client.
+package sharedb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/cluster"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// defaultLinger is how long a room outlives its last subscriber by default.
+const defaultLinger = time.Minute
+
+// peerBuffer is how many messages may wait for a client before it's
+// disconnected for falling behind.
+const peerBuffer = 256
+
+// Errors replied to requests, besides ErrMalformed and ErrNotApplied.
+var (
+	ErrUnsupported       = errors.New("not supported")
+	ErrUnknownCollection = errors.New("unknown collection")
+	ErrRejected          = errors.New("op rejected")
+	ErrVersionTooNew     = errors.New("version is newer than the document's")
+	ErrVersionUnknown    = errors.New("ops since the version are no longer available")
+)
+
+// errorCodes maps errors to the codes replied to ShareDB clients, which
+// are ShareDB's own where it has one.
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrMalformed, "ERR_MESSAGE_BADLY_FORMED"},
+	{ErrUnsupported, "ERR_MESSAGE_BADLY_FORMED"},
+	{ErrUnknownCollection, "ERR_UNKNOWN_COLLECTION"},
+	{ErrNotApplied, "ERR_OT_OP_NOT_APPLIED"},
+	{ErrRejected, "ERR_OP_SUBMIT_REJECTED"},
+	{collab.ErrDocumentArchived, "ERR_OP_SUBMIT_REJECTED"},
+	{ErrVersionTooNew, "ERR_OP_VERSION_NEWER_THAN_CURRENT_SNAPSHOT"},
+	{ErrVersionUnknown, "ERR_SUBMIT_TRANSFORM_OPS_NOT_FOUND"},
+	{storage.ErrDocumentNotFound, "ERR_DOC_DOES_NOT_EXIST"},
+	{acl.ErrAccessDenied, "ERR_ACCESS_DENIED"},
+	{cluster.ErrNotOwner, "ERR_MISDIRECTED_REQUEST"},
+}
+
+// Conn is a WebSocket connection, such as a *websocket.Conn.
+type Conn interface {
+	ReadMessage() (int, []byte, error)
+	WriteMessage(messageType int, data []byte) error
+	Close() error
+}
+
+// Session is the part of a *collab.Session the adapter uses.
+type Session interface {
+	ApplyOperation(clientID, userID string, op ot.Operation, baseRevision int) (int, error)
+	GetState(userID string) (string, int, error)
+	Changes(ctx context.Context, userID string, sinceRevision int) ([]ot.SequencedOperation, int, error)
+	Archived() bool
+}
+
+// AdapterConfig holds configuration for creating an adapter.
+type AdapterConfig struct {
+	// Open returns a document's session, as collab.Manager.GetOrCreateSession does.
+	Open func(ctx context.Context, docID string) (Session, error)
+
+	// Linger is how long a document's ShareDB copy is kept once its last
+	// subscriber leaves, so clients that reconnect can catch up from their
+	// version. Defaults to a minute.
+	Linger time.Duration
+
+	// History is how many ops of each copy are kept for clients catching
+	// up or submitting ops based on older versions. Defaults to 1000.
+	History int
+
+	Logger *slog.Logger // Optional: defaults to slog.Default()
+}
+
+// Adapter serves ShareDB clients. The clients of each document share a
+// room, which edits the document's session as a single client.
+type Adapter struct {
+	open    func(ctx context.Context, docID string) (Session, error)
+	linger  time.Duration
+	history int
+	logger  *slog.Logger
+
+	mu    sync.Mutex
+	rooms map[string]*room // By document ID
+}
+
+// NewAdapter creates an adapter.
+func NewAdapter(cfg AdapterConfig) *Adapter {
+	linger := cfg.Linger
+	if linger <= 0 {
+		linger = defaultLinger
+	}
+
+	history := cfg.History
+	if history <= 0 {
+		history = 1000
+	}
+
+	return &Adapter{
+		open:    cfg.Open,
+		linger:  linger,
+		history: history,
+		logger:  logging.Component(cfg.Logger, "sharedb"),
+		rooms:   make(map[string]*room),
+	}
+}
+
+// Serve speaks the ShareDB protocol on conn until the client disconnects.
+// canWrite reports whether the user may edit a document; the adapter checks
+// that they may read it. It returns an error if the client sends a message
+// that isn't JSON, after closing the connection.
+func (a *Adapter) Serve(conn Conn, userID string, canWrite func(docID string) bool) error {
+	p := &peer{
+		conn:     conn,
+		userID:   userID,
+		canWrite: canWrite,
+		src:      uuid.New().String(),
+		rooms:    make(map[*room]bool),
+		out:      make(chan frame, peerBuffer),
+		done:     make(chan struct{}),
+	}
+	go p.write()
+
+	defer a.leave(p)
+
+	p.send(&message{
+		Action:        actionInit,
+		Protocol:      protocolMajor,
+		ProtocolMinor: protocolMinor,
+		ID:            mustMarshal(p.src),
+		Type:          formats[JSONCollection].typeURI,
+	})
+
+	for {
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			p.close()
+
+			return nil
+		}
+
+		if kind != websocket.TextMessage {
+			continue
+		}
+
+		var req message
+		if err := json.Unmarshal(data, &req); err != nil {
+			err = fmt.Errorf("%w: %w", ErrMalformed, err)
+			p.fail(err)
+
+			return err
+		}
+
+		if err := a.handle(p, &req); err != nil {
+			p.reply(&req, a.replyError(err))
+		}
+	}
+}
+
+// Rooms returns the number of documents with a room.
+func (a *Adapter) Rooms() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return len(a.rooms)
+}
+
+// handle handles a request, returning the error to reply with if it fails.
+func (a *Adapter) handle(p *peer, req *message) error {
+	switch req.Action {
+	case actionHandshake:
+		// Clients reconnecting keep their ID, so ops they resend are known
+		var id string
+		if json.Unmarshal(req.ID, &id) == nil && id != "" {
+			p.src = id
+		}
+
+		p.send(&message{
+			Action:        actionHandshake,
+			Protocol:      protocolMajor,
+			ProtocolMinor: protocolMinor,
+			ID:            mustMarshal(p.src),
+			Type:          formats[JSONCollection].typeURI,
+		})
+
+		return nil
+	case actionFetch, actionSubscribe, actionUnsub, actionOp:
+		if _, ok := formats[req.Collection]; !ok {
+			return fmt.Errorf("%w: %q", ErrUnknownCollection, req.Collection)
+		}
+
+		if req.DocID == "" {
+			return fmt.Errorf("%w: missing document ID", ErrMalformed)
+		}
+	default:
+		return fmt.Errorf("%w: action %q", ErrUnsupported, req.Action)
+	}
+
+	if req.Action == actionUnsub {
+		a.unsubscribe(p, req.Collection, req.DocID)
+		p.reply(req, nil)
+
+		return nil
+	}
+
+	r, session, err := a.join(p, req.DocID)
+	if err != nil {
+		return err
+	}
+
+	switch req.Action {
+	case actionFetch:
+		return r.fetch(p, req, false)
+	case actionSubscribe:
+		return r.fetch(p, req, true)
+	default:
+		return r.submit(p, req, session)
+	}
+}
+
+// join returns a document's room, opening it if needed, after checking the
+// user may read the document.
+func (a *Adapter) join(p *peer, docID string) (*room, Session, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	session, err := a.open(context.Background(), docID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, _, err := session.GetState(p.userID); err != nil {
+		return nil, nil, err
+	}
+
+	r, ok := a.rooms[docID]
+	if !ok {
+		r = newRoom(a, docID)
+	}
+
+	if err := r.attach(p.userID); err != nil {
+		return nil, nil, err
+	}
+
+	a.rooms[docID] = r
+
+	return r, session, nil
+}
+
+// unsubscribe ends a client's subscription to a document.
+func (a *Adapter) unsubscribe(p *peer, collection, docID string) {
+	a.mu.Lock()
+	r := a.rooms[docID]
+	a.mu.Unlock()
+
+	if r != nil {
+		r.unsubscribe(p, collection)
+	}
+}
+
+// leave ends a client's subscriptions once it disconnects.
+func (a *Adapter) leave(p *peer) {
+	p.mu.Lock()
+	rooms := make([]*room, 0, len(p.rooms))
+
+	for r := range p.rooms {
+		rooms = append(rooms, r)
+	}
+	p.mu.Unlock()
+
+	for _, r := range rooms {
+		r.leave(p)
+	}
+}
+
+// expire drops a room that has had no subscribers for the linger period.
+func (a *Adapter) expire(r *room, gen int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !r.expire(gen) {
+		return
+	}
+
+	if a.rooms[r.docID] == r {
+		delete(a.rooms, r.docID)
+	}
+}
+
+// replyError returns the error replied for err, logging unexpected ones.
+func (a *Adapter) replyError(err error) *replyError {
+	for _, e := range errorCodes {
+		if errors.Is(err, e.err) {
+			return &replyError{Code: e.code, Message: err.Error()}
+		}
+	}
+
+	a.logger.Error("sharedb request failed", logging.Err(err))
+
+	return &replyError{Code: "ERR_INTERNAL", Message: "internal server error"}
+}
+
+// mustMarshal encodes a value that can always be encoded.
+func mustMarshal(v any) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+
+	return data
+}
+
+// frame is a WebSocket message waiting to be written.
+type frame struct {
+	kind int
+	data []byte
+}
+
+// peer is a connected ShareDB client.
+type peer struct {
+	conn     Conn
+	userID   string
+	canWrite func(docID string) bool
+	src      string // The client's ID, which its ops carry
+	out      chan frame
+	done     chan struct{} // Closed with the connection
+	once     sync.Once
+
+	mu    sync.Mutex
+	rooms map[*room]bool // Rooms it subscribed to
+}
+
+// send queues a message, disconnecting the client if too many are waiting
+// already.
+func (p *peer) send(msg *message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		panic(err) // Messages hold nothing that can't be encoded
+	}
+
+	p.enqueue(frame{kind: websocket.TextMessage, data: data})
+}
+
+// enqueue queues a message.
+func (p *peer) enqueue(f frame) {
+	select {
+	case p.out <- f:
+	case <-p.done:
+	default:
+		p.close()
+	}
+}
+
+// track records whether the client subscribed to a room.
+func (p *peer) track(r *room, subscribed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if subscribed {
+		p.rooms[r] = true
+	} else {
+		delete(p.rooms, r)
+	}
+}
+
+// reply answers a request, echoing it with the error if it failed.
+func (p *peer) reply(req *message, err *replyError) {
+	if err != nil {
+		failed := *req
+		failed.Error = err
+		p.send(&failed)
+
+		return
+	}
+
+	p.send(&message{Action: req.Action, Collection: req.Collection, DocID: req.DocID})
+}
+
+// write writes queued messages until the connection closes.
+func (p *peer) write() {
+	for {
+		select {
+		case f := <-p.out:
+			if err := p.conn.WriteMessage(f.kind, f.data); err != nil || f.kind == websocket.CloseMessage {
+				p.close()
+
+				return
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// fail closes the connection with a close frame explaining err.
+func (p *peer) fail(err error) {
+	// Close reasons are limited to 123 bytes
+	reason := err.Error()
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+
+	data := websocket.FormatCloseMessage(websocket.CloseUnsupportedData, reason)
+	p.enqueue(frame{kind: websocket.CloseMessage, data: data})
+
+	select {
+	case <-p.done:
+	case <-time.After(time.Second):
+		p.close()
+	}
+}
+
+// close closes the connection.
+func (p *peer) close() {
+	p.once.Do(func() {
+		close(p.done)
+		_ = p.conn.Close()
+	})
+}
@@ -0,0 +1,830 @@
+package sharedb_test
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/gorilla/websocket"
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/cluster"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/sharedb"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+var errConnClosed = errors.New("connection closed")
+
+// fakeConn is an in-memory WebSocket connection. The test writes what the
+// adapter reads to in, and reads what the adapter writes from out.
+type fakeConn struct {
+	in     chan []byte
+	out    chan []byte
+	closed chan struct{}
+	once   sync.Once
+
+	mu        sync.Mutex
+	closeCode int
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{in: make(chan []byte, 64), out: make(chan []byte, 1024), closed: make(chan struct{})}
+}
+
+func (c *fakeConn) ReadMessage() (int, []byte, error) {
+	select {
+	case data := <-c.in:
+		return websocket.TextMessage, data, nil
+	case <-c.closed:
+		return 0, nil, errConnClosed
+	}
+}
+
+func (c *fakeConn) WriteMessage(messageType int, data []byte) error {
+	select {
+	case <-c.closed:
+		return errConnClosed
+	default:
+	}
+
+	if messageType == websocket.CloseMessage {
+		c.mu.Lock()
+		c.closeCode = int(binary.BigEndian.Uint16(data))
+		c.mu.Unlock()
+
+		return nil
+	}
+
+	c.out <- data
+
+	return nil
+}
+
+func (c *fakeConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+
+	return nil
+}
+
+// code returns the close code the adapter sent, if any.
+func (c *fakeConn) code() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.closeCode
+}
+
+// client is a ShareDB client connected to an adapter.
+type client struct {
+	t      *testing.T
+	conn   *fakeConn
+	served chan error
+}
+
+// dial connects a client and reads the init message.
+func dial(t *testing.T, adapter *sharedb.Adapter, userID string, canWrite bool) *client {
+	t.Helper()
+
+	c := &client{t: t, conn: newFakeConn(), served: make(chan error, 1)}
+
+	go func() {
+		c.served <- adapter.Serve(c.conn, userID, func(string) bool { return canWrite })
+	}()
+
+	t.Cleanup(func() { _ = c.conn.Close() })
+
+	msg := c.recv()
+	require.Equal(t, "init", msg["a"])
+	require.EqualValues(t, 1, msg["protocol"])
+
+	return c
+}
+
+// send sends a message given as JSON.
+func (c *client) send(format string, args ...any) {
+	c.conn.in <- fmt.Appendf(nil, format, args...)
+}
+
+// recv returns the next message.
+func (c *client) recv() map[string]any {
+	c.t.Helper()
+
+	select {
+	case data := <-c.conn.out:
+		var msg map[string]any
+		require.NoError(c.t, json.Unmarshal(data, &msg))
+
+		return msg
+	case <-time.After(5 * time.Second):
+		require.FailNow(c.t, "no message received")
+
+		return nil
+	}
+}
+
+// expect reads the next message, which must match want, ignoring the source
+// of ops when want has none.
+func (c *client) expect(want string) {
+	c.t.Helper()
+
+	msg := c.recv()
+
+	var wanted map[string]any
+	require.NoError(c.t, json.Unmarshal([]byte(want), &wanted))
+
+	if _, ok := wanted["src"]; !ok {
+		delete(msg, "src")
+		delete(msg, "seq")
+	}
+
+	got, err := json.Marshal(msg)
+	require.NoError(c.t, err)
+	require.JSONEq(c.t, want, string(got))
+}
+
+// newAdapter returns an adapter serving doc1 of a memory store, holding the
+// content given, and the document's session manager.
+func newAdapter(t *testing.T, content string) (*sharedb.Adapter, *collab.Manager) {
+	t.Helper()
+
+	return newAdapterConfig(t, content, sharedb.AdapterConfig{})
+}
+
+// newAdapterConfig is newAdapter with the configuration given, besides Open.
+func newAdapterConfig(t *testing.T, content string, cfg sharedb.AdapterConfig) (*sharedb.Adapter, *collab.Manager) {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	manager := collab.NewManager(collab.ManagerConfig{Store: store})
+	t.Cleanup(func() { _ = manager.CloseAll() })
+
+	insert(t, manager, content, 0)
+
+	cfg.Open = func(ctx context.Context, docID string) (sharedb.Session, error) {
+		return manager.GetOrCreateSession(ctx, docID)
+	}
+
+	return sharedb.NewAdapter(cfg), manager
+}
+
+// insert inserts text through the session, as a WebSocket client would.
+func insert(t *testing.T, manager *collab.Manager, text string, position int) {
+	t.Helper()
+
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	for i, r := range []rune(text) {
+		_, err = session.ApplyOperation("ws", "bob", ot.NewInsert(string(r), position+i, "bob"), session.Revision())
+		require.NoError(t, err)
+	}
+}
+
+// waitForContent waits for doc1 to hold the content given.
+func waitForContent(t *testing.T, manager *collab.Manager, want string) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		session, err := manager.GetOrCreateSession(context.Background(), "doc1")
+		if err != nil {
+			return false
+		}
+
+		text, _, err := session.GetState("alice")
+
+		return err == nil && text == want
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+func TestAdapter_Handshake(t *testing.T) {
+	t.Parallel()
+
+	adapter, _ := newAdapter(t, "")
+	c := dial(t, adapter, "alice", true)
+
+	// Reconnecting clients keep their ID
+	c.send(`{"a":"hs","id":"client-1","protocol":1,"protocolMinor":1}`)
+	c.expect(`{"a":"hs","id":"client-1","protocol":1,"protocolMinor":1,"type":"http://sharejs.org/types/JSONv0"}`)
+}
+
+func TestAdapter_Subscribe(t *testing.T) {
+	t.Parallel()
+
+	adapter, _ := newAdapter(t, "hello")
+	c := dial(t, adapter, "alice", true)
+
+	c.send(`{"a":"s","c":"text","d":"doc1"}`)
+	c.expect(`{"a":"s","c":"text","d":"doc1","data":{"v":5,"data":"hello","type":"http://sharejs.org/types/textv1"}}`)
+
+	c.send(`{"a":"f","c":"json0","d":"doc1"}`)
+	c.expect(`{"a":"f","c":"json0","d":"doc1",
+		"data":{"v":5,"data":{"content":"hello"},"type":"http://sharejs.org/types/JSONv0"}}`)
+
+	require.Equal(t, 1, adapter.Rooms())
+}
+
+func TestAdapter_Submit(t *testing.T) {
+	t.Parallel()
+
+	adapter, manager := newAdapter(t, "hello")
+	text := dial(t, adapter, "alice", true)
+	json0 := dial(t, adapter, "bob", true)
+
+	text.send(`{"a":"s","c":"text","d":"doc1"}`)
+	text.recv()
+	json0.send(`{"a":"s","c":"json0","d":"doc1"}`)
+	json0.recv()
+
+	text.send(`{"a":"op","c":"text","d":"doc1","v":5,"src":"a","seq":1,"op":[5," world"]}`)
+	text.expect(`{"a":"op","c":"text","d":"doc1","v":5,"src":"a","seq":1}`)
+	json0.expect(`{"a":"op","c":"json0","d":"doc1","v":5,"src":"a","seq":1,"op":[{"p":["content",5],"si":" world"}]}`)
+
+	json0.send(`{"a":"op","c":"json0","d":"doc1","v":6,"src":"b","seq":1,
+		"op":[{"p":["content",0],"sd":"hello"},{"p":["content",0],"si":"goodbye"}]}`)
+	json0.expect(`{"a":"op","c":"json0","d":"doc1","v":6,"src":"b","seq":1}`)
+	text.expect(`{"a":"op","c":"text","d":"doc1","v":6,"src":"b","seq":1,"op":["goodbye",{"d":5}]}`)
+
+	waitForContent(t, manager, "goodbye world")
+}
+
+func TestAdapter_Submit_Concurrent(t *testing.T) {
+	t.Parallel()
+
+	adapter, manager := newAdapter(t, "ab")
+	alice := dial(t, adapter, "alice", true)
+	bob := dial(t, adapter, "bob", true)
+
+	for _, c := range []*client{alice, bob} {
+		c.send(`{"a":"s","c":"text","d":"doc1"}`)
+		c.recv()
+	}
+
+	alice.send(`{"a":"op","c":"text","d":"doc1","v":2,"src":"a","seq":1,"op":[1,"x"]}`)
+	alice.expect(`{"a":"op","c":"text","d":"doc1","v":2,"src":"a","seq":1}`)
+
+	// Bob's op was based on version 2 too, and its insert goes first
+	bob.send(`{"a":"op","c":"text","d":"doc1","v":2,"src":"b","seq":1,"op":[1,"y",{"d":1}]}`)
+	bob.expect(`{"a":"op","c":"text","d":"doc1","v":2,"src":"a","seq":1,"op":[1,"x"]}`)
+	bob.expect(`{"a":"op","c":"text","d":"doc1","v":3,"src":"b","seq":1}`)
+	alice.expect(`{"a":"op","c":"text","d":"doc1","v":3,"src":"b","seq":1,"op":[1,"y",1,{"d":1}]}`)
+
+	waitForContent(t, manager, "ayx")
+
+	// An op resent after reconnecting is acknowledged again, but not applied
+	bob.send(`{"a":"op","c":"text","d":"doc1","v":2,"src":"b","seq":1,"op":[1,"y",{"d":1}]}`)
+	bob.expect(`{"a":"op","c":"text","d":"doc1","v":3,"src":"b","seq":1}`)
+}
+
+func TestAdapter_SessionEdits(t *testing.T) {
+	t.Parallel()
+
+	adapter, manager := newAdapter(t, "")
+	c := dial(t, adapter, "alice", true)
+
+	c.send(`{"a":"s","c":"text","d":"doc1"}`)
+	c.recv()
+
+	insert(t, manager, "h🌍", 0)
+	c.expect(`{"a":"op","c":"text","d":"doc1","v":0,"op":["h"]}`)
+	c.expect(`{"a":"op","c":"text","d":"doc1","v":1,"op":[1,"🌍"]}`)
+
+	// Clients catch up from the version they have
+	late := dial(t, adapter, "bob", true)
+	late.send(`{"a":"s","c":"text","d":"doc1","v":1}`)
+	late.expect(`{"a":"op","c":"text","d":"doc1","v":1,"op":[1,"🌍"]}`)
+	late.expect(`{"a":"s","c":"text","d":"doc1"}`)
+}
+
+func TestAdapter_Errors(t *testing.T) {
+	t.Parallel()
+
+	adapter, _ := newAdapter(t, "hi🌍")
+
+	tests := []struct {
+		name     string
+		canWrite bool
+		request  string
+		code     string
+	}{
+		{
+			name:    "unknown collection",
+			request: `{"a":"s","c":"docs","d":"doc1"}`,
+			code:    "ERR_UNKNOWN_COLLECTION",
+		},
+		{
+			name:    "unsupported action",
+			request: `{"a":"qs","id":1,"c":"text","q":{}}`,
+			code:    "ERR_MESSAGE_BADLY_FORMED",
+		},
+		{
+			name:    "missing document",
+			request: `{"a":"s","c":"text","d":"doc2"}`,
+			code:    "ERR_DOC_DOES_NOT_EXIST",
+		},
+		{
+			name:    "version too new",
+			request: `{"a":"s","c":"text","d":"doc1","v":9}`,
+			code:    "ERR_OP_VERSION_NEWER_THAN_CURRENT_SNAPSHOT",
+		},
+		{
+			name:    "version too old",
+			request: `{"a":"s","c":"text","d":"doc1","v":1}`,
+			code:    "ERR_SUBMIT_TRANSFORM_OPS_NOT_FOUND",
+		},
+		{
+			name:    "read only",
+			request: `{"a":"op","c":"text","d":"doc1","v":3,"src":"a","seq":1,"op":["x"]}`,
+			code:    "ERR_OP_SUBMIT_REJECTED",
+		},
+		{
+			name:     "create",
+			canWrite: true,
+			request:  `{"a":"op","c":"text","d":"doc1","v":0,"src":"a","seq":1,"create":{"type":"text","data":""}}`,
+			code:     "ERR_OP_SUBMIT_REJECTED",
+		},
+		{
+			name:     "invalid op",
+			canWrite: true,
+			request:  `{"a":"op","c":"text","d":"doc1","v":3,"src":"a","seq":1,"op":[0,"x"]}`,
+			code:     "ERR_MESSAGE_BADLY_FORMED",
+		},
+		{
+			name:     "other json0 path",
+			canWrite: true,
+			request:  `{"a":"op","c":"json0","d":"doc1","v":3,"src":"a","seq":1,"op":[{"p":["title",0],"si":"x"}]}`,
+			code:     "ERR_MESSAGE_BADLY_FORMED",
+		},
+		{
+			name:     "past the end",
+			canWrite: true,
+			request:  `{"a":"op","c":"text","d":"doc1","v":3,"src":"a","seq":1,"op":[3,{"d":2}]}`,
+			code:     "ERR_OT_OP_NOT_APPLIED",
+		},
+		{
+			name:     "splits a character",
+			canWrite: true,
+			request:  `{"a":"op","c":"text","d":"doc1","v":3,"src":"a","seq":1,"op":[3,"x"]}`,
+			code:     "ERR_OT_OP_NOT_APPLIED",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := dial(t, adapter, "alice", tt.canWrite)
+			c.send(`%s`, tt.request)
+
+			msg := c.recv()
+			require.Equal(t, tt.code, msg["error"].(map[string]any)["code"], msg) //nolint:forcetypeassert // Fails the test
+		})
+	}
+}
+
+func TestAdapter_InvalidJSON(t *testing.T) {
+	t.Parallel()
+
+	adapter, _ := newAdapter(t, "")
+	c := dial(t, adapter, "alice", true)
+
+	c.send(`{"a":`)
+
+	require.ErrorIs(t, <-c.served, sharedb.ErrMalformed)
+	require.Equal(t, websocket.CloseUnsupportedData, c.conn.code())
+}
+
+func TestAdapter_ErrorReplies(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Owner))
+
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore})
+	t.Cleanup(func() { _ = manager.CloseAll() })
+
+	adapter := sharedb.NewAdapter(sharedb.AdapterConfig{
+		Open: func(ctx context.Context, docID string) (sharedb.Session, error) {
+			switch docID {
+			case "foreign":
+				return nil, cluster.ErrNotOwner
+			case "broken":
+				return nil, errors.New("disk on fire")
+			}
+
+			return manager.GetOrCreateSession(ctx, docID)
+		},
+	})
+
+	tests := []struct {
+		name    string
+		userID  string
+		request string
+		code    string
+	}{
+		{"no access", "mallory", `{"a":"s","c":"text","d":"doc1"}`, "ERR_ACCESS_DENIED"},
+		{"another node's document", "alice", `{"a":"s","c":"text","d":"foreign"}`, "ERR_MISDIRECTED_REQUEST"},
+		{"unexpected error", "alice", `{"a":"f","c":"text","d":"broken"}`, "ERR_INTERNAL"},
+		{"missing document ID", "alice", `{"a":"s","c":"text"}`, "ERR_MESSAGE_BADLY_FORMED"},
+		{"delete", "alice", `{"a":"op","c":"text","d":"doc1","v":0,"src":"a","seq":1,"del":true}`, "ERR_OP_SUBMIT_REJECTED"},
+		{"op without a version", "alice", `{"a":"op","c":"text","d":"doc1","src":"a","seq":1,"op":["x"]}`,
+			"ERR_MESSAGE_BADLY_FORMED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := dial(t, adapter, tt.userID, true)
+			c.send(`%s`, tt.request)
+
+			msg := c.recv()
+			require.Equal(t, tt.code, msg["error"].(map[string]any)["code"], msg) //nolint:forcetypeassert // Fails the test
+		})
+	}
+}
+
+func TestAdapter_Archived(t *testing.T) {
+	t.Parallel()
+
+	adapter, manager := newAdapter(t, "hi")
+	require.NoError(t, manager.SetArchived(t.Context(), "doc1", true))
+
+	c := dial(t, adapter, "alice", true)
+
+	// Archived documents can be read, not edited
+	c.send(`{"a":"f","c":"text","d":"doc1"}`)
+	c.expect(`{"a":"f","c":"text","d":"doc1","data":{"v":2,"data":"hi","type":"http://sharejs.org/types/textv1"}}`)
+
+	c.send(`{"a":"op","c":"text","d":"doc1","v":2,"src":"a","seq":1,"op":["x"]}`)
+
+	msg := c.recv()
+	require.Equal(t, "ERR_OP_SUBMIT_REJECTED", msg["error"].(map[string]any)["code"], msg) //nolint:forcetypeassert // Fails the test
+}
+
+func TestAdapter_Unsubscribe(t *testing.T) {
+	t.Parallel()
+
+	adapter, manager := newAdapterConfig(t, "hello", sharedb.AdapterConfig{Linger: 20 * time.Millisecond})
+	c := dial(t, adapter, "alice", true)
+	other := dial(t, adapter, "bob", true)
+
+	for _, client := range []*client{c, other} {
+		client.send(`{"a":"s","c":"text","d":"doc1"}`)
+		client.recv()
+	}
+
+	c.send(`{"a":"u","c":"text","d":"doc1"}`)
+	c.expect(`{"a":"u","c":"text","d":"doc1"}`)
+
+	// Only the client still subscribed gets the op
+	insert(t, manager, "!", 5)
+	other.expect(`{"a":"op","c":"text","d":"doc1","v":5,"op":[5,"!"]}`)
+
+	c.send(`{"a":"f","c":"text","d":"doc1"}`)
+	c.expect(`{"a":"f","c":"text","d":"doc1","data":{"v":6,"data":"hello!","type":"http://sharejs.org/types/textv1"}}`)
+
+	// Once nobody is subscribed the room expires after lingering
+	other.send(`{"a":"u","c":"text","d":"doc1"}`)
+	other.expect(`{"a":"u","c":"text","d":"doc1"}`)
+	require.Eventually(t, func() bool { return adapter.Rooms() == 0 }, 5*time.Second, 5*time.Millisecond)
+
+	// Unsubscribing from a document without a room is acknowledged all the same
+	c.send(`{"a":"u","c":"text","d":"doc1"}`)
+	c.expect(`{"a":"u","c":"text","d":"doc1"}`)
+
+	// A new room starts from the document's state
+	c.send(`{"a":"s","c":"text","d":"doc1"}`)
+	c.expect(`{"a":"s","c":"text","d":"doc1","data":{"v":6,"data":"hello!","type":"http://sharejs.org/types/textv1"}}`)
+	require.Equal(t, 1, adapter.Rooms())
+}
+
+func TestAdapter_SessionClosed(t *testing.T) {
+	t.Parallel()
+
+	adapter, manager := newAdapter(t, "hello")
+	c := dial(t, adapter, "alice", true)
+
+	c.send(`{"a":"s","c":"text","d":"doc1"}`)
+	c.recv()
+
+	// Subscribers are disconnected when the session closes
+	require.NoError(t, manager.CloseSession("doc1"))
+	require.NoError(t, <-c.served)
+
+	// The room keeps its copy, so a client reconnecting catches up from its
+	// version, with what changed meanwhile as one op
+	insert(t, manager, "!", 5)
+
+	late := dial(t, adapter, "alice", true)
+	late.send(`{"a":"s","c":"text","d":"doc1","v":5}`)
+	late.expect(`{"a":"op","c":"text","d":"doc1","v":5,"op":[5,"!"]}`)
+	late.expect(`{"a":"s","c":"text","d":"doc1"}`)
+}
+
+func TestAdapter_AccessLost(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Owner))
+	require.NoError(t, permStore.Grant("doc1", "bob", acl.Viewer))
+
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore})
+	t.Cleanup(func() { _ = manager.CloseAll() })
+
+	adapter := sharedb.NewAdapter(sharedb.AdapterConfig{
+		Open: func(ctx context.Context, docID string) (sharedb.Session, error) {
+			return manager.GetOrCreateSession(ctx, docID)
+		},
+	})
+
+	alice := dial(t, adapter, "alice", true)
+	alice.send(`{"a":"s","c":"text","d":"doc1"}`)
+	alice.recv()
+
+	// The adapter trusts canWrite, so bob's op is applied to the copy before
+	// the session refuses it
+	bob := dial(t, adapter, "bob", true)
+	bob.send(`{"a":"s","c":"text","d":"doc1"}`)
+	bob.recv()
+	bob.send(`{"a":"op","c":"text","d":"doc1","v":0,"src":"b","seq":1,"op":["x"]}`)
+	alice.expect(`{"a":"op","c":"text","d":"doc1","v":0,"src":"b","seq":1,"op":["x"]}`)
+
+	// Bob is disconnected, maybe before the ack reaches him, and the copy
+	// is brought back in line
+	require.NoError(t, <-bob.served)
+	alice.expect(`{"a":"op","c":"text","d":"doc1","v":1,"op":[{"d":1}]}`)
+	waitForContent(t, manager, "")
+}
+
+// observer is a subscribed client keeping the content at each version,
+// from the ops it receives.
+type observer struct {
+	*client
+
+	collection string
+	versions   [][]uint16
+}
+
+// subscribe subscribes a client, which then observes the document.
+func subscribe(c *client, collection string) *observer {
+	c.send(`{"a":"s","c":%q,"d":"doc1"}`, collection)
+
+	msg := c.recv()
+	data := msg["data"].(map[string]any) //nolint:forcetypeassert // Fails the test
+
+	text, ok := data["data"].(string)
+	if !ok {
+		text = data["data"].(map[string]any)["content"].(string) //nolint:forcetypeassert // Fails the test
+	}
+
+	o := &observer{client: c, collection: collection}
+	for range int(data["v"].(float64)) { //nolint:forcetypeassert // Fails the test
+		o.versions = append(o.versions, nil) // Not known
+	}
+
+	o.versions = append(o.versions, utf16.Encode([]rune(text)))
+
+	return o
+}
+
+// version returns the latest version.
+func (o *observer) version() int {
+	return len(o.versions) - 1
+}
+
+// text returns the content at the latest version.
+func (o *observer) text() string {
+	return string(utf16.Decode(o.versions[o.version()]))
+}
+
+// apply applies the next op received, which must be at the latest version.
+func (o *observer) apply() {
+	o.t.Helper()
+
+	msg := o.recv()
+	require.Equal(o.t, "op", msg["a"], msg)
+	require.EqualValues(o.t, o.version(), msg["v"], msg)
+
+	content := o.versions[o.version()]
+	op := msg["op"].([]any) //nolint:forcetypeassert // Fails the test
+
+	if o.collection == sharedb.TextCollection {
+		content = applyText(content, op)
+	} else {
+		content = applyJSON0(content, op)
+	}
+
+	o.versions = append(o.versions, content)
+}
+
+// applyText applies an op of the "text" type.
+func applyText(content []uint16, op []any) []uint16 {
+	result := make([]uint16, 0, len(content))
+	at := 0
+
+	for _, part := range op {
+		switch c := part.(type) {
+		case float64:
+			result = append(result, content[at:at+int(c)]...)
+			at += int(c)
+		case string:
+			result = append(result, utf16.Encode([]rune(c))...)
+		case map[string]any:
+			at += int(c["d"].(float64)) //nolint:forcetypeassert // Fails the test
+		}
+	}
+
+	return append(result, content[at:]...)
+}
+
+// applyJSON0 applies a json0 op of string edits.
+func applyJSON0(content []uint16, op []any) []uint16 {
+	for _, part := range op {
+		c := part.(map[string]any)             //nolint:forcetypeassert // Fails the test
+		at := int(c["p"].([]any)[1].(float64)) //nolint:forcetypeassert // Fails the test
+		result := slices.Clone(content[:at])
+
+		if si, ok := c["si"].(string); ok {
+			result = append(result, utf16.Encode([]rune(si))...)
+			content = append(result, content[at:]...)
+
+			continue
+		}
+
+		sd := utf16.Encode([]rune(c["sd"].(string))) //nolint:forcetypeassert // Fails the test
+		content = append(result, content[at+len(sd):]...)
+	}
+
+	return content
+}
+
+func TestAdapter_Converges(t *testing.T) {
+	t.Parallel()
+
+	adapter, manager := newAdapter(t, "start")
+	text := subscribe(dial(t, adapter, "alice", true), sharedb.TextCollection)
+	json0 := subscribe(dial(t, adapter, "bob", true), sharedb.JSONCollection)
+	writer := dial(t, adapter, "carol", true)
+
+	rng := rand.New(rand.NewPCG(1, 0)) //nolint:gosec // Reproducible, not secret
+
+	for seq := 1; seq <= 200; seq++ {
+		// Edit a recent version, which the writer may not know is outdated
+		base := max(text.version()-rng.IntN(5), 5)
+		op := randomOp(rng, text.versions[base])
+
+		writer.send(`{"a":"op","c":"text","d":"doc1","v":%d,"src":"w","seq":%d,"op":%s}`, base, seq, op)
+
+		for {
+			msg := writer.recv()
+			require.Nil(t, msg["error"], msg)
+			if msg["op"] == nil {
+				require.Equal(t, float64(seq), msg["seq"], msg)
+
+				break
+			}
+		}
+
+		text.apply()
+		json0.apply()
+
+		if rng.IntN(10) == 0 {
+			insert(t, manager, "s", 0)
+			text.apply()
+			json0.apply()
+		}
+	}
+
+	require.Equal(t, text.text(), json0.text())
+	waitForContent(t, manager, text.text())
+}
+
+// randomOp returns a "text" op inserting or deleting a few characters of
+// content, never splitting one.
+func randomOp(rng *rand.Rand, content []uint16) string {
+	runes := utf16.Decode(content)
+	at := rng.IntN(len(runes) + 1)
+
+	skip := ""
+	if at > 0 {
+		skip = fmt.Sprintf("%d,", len(utf16.Encode(runes[:at])))
+	}
+
+	if at < len(runes) && rng.IntN(2) == 0 {
+		n := len(utf16.Encode(runes[at : at+1+rng.IntN(min(3, len(runes)-at))]))
+
+		return fmt.Sprintf(`[%s{"d":%d}]`, skip, n)
+	}
+
+	chars := []string{"a", "b", "🌍"}
+
+	return fmt.Sprintf(`[%s%q]`, skip, chars[rng.IntN(len(chars))]+chars[rng.IntN(len(chars))])
+}
+
+func TestAdapter_Submit_JSON0Components(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		op   string
+		want string
+	}{
+		{"inserts", `{"p":["content",0],"si":"a"},{"p":["content",1],"si":"b"}`, "abhello"},
+		{"deletes", `{"p":["content",0],"sd":"h"},{"p":["content",0],"sd":"e"}`, "llo"},
+		{"insert after a delete", `{"p":["content",0],"sd":"h"},{"p":["content",1],"si":"x"}`, "exllo"},
+		{"delete of an insert", `{"p":["content",0],"si":"ab"},{"p":["content",1],"sd":"b"}`, "ahello"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			adapter, manager := newAdapter(t, "hello")
+			c := dial(t, adapter, "alice", true)
+
+			c.send(`{"a":"op","c":"json0","d":"doc1","v":5,"src":"a","seq":1,"op":[%s]}`, tt.op)
+			c.expect(`{"a":"op","c":"json0","d":"doc1","v":5,"src":"a","seq":1}`)
+
+			waitForContent(t, manager, tt.want)
+		})
+	}
+}
+
+// flakySession is a session whose edits inserting "!" fail, and whose state
+// can't be read once broken is set.
+type flakySession struct {
+	sharedb.Session
+
+	broken atomic.Bool
+}
+
+func (s *flakySession) ApplyOperation(clientID, userID string, op ot.Operation, baseRevision int) (int, error) {
+	if op.Char == "!" {
+		return 0, errors.New("disk on fire")
+	}
+
+	return s.Session.ApplyOperation(clientID, userID, op, baseRevision)
+}
+
+func (s *flakySession) GetState(userID string) (string, int, error) {
+	if s.broken.Load() {
+		return "", 0, errors.New("disk on fire")
+	}
+
+	return s.Session.GetState(userID)
+}
+
+func TestAdapter_SessionFailures(t *testing.T) {
+	t.Parallel()
+
+	_, manager := newAdapter(t, "hi")
+
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	flaky := &flakySession{Session: session}
+	adapter := sharedb.NewAdapter(sharedb.AdapterConfig{
+		Open:   func(context.Context, string) (sharedb.Session, error) { return flaky, nil },
+		Logger: slog.New(slog.DiscardHandler),
+	})
+
+	c := dial(t, adapter, "alice", true)
+	c.send(`{"a":"s","c":"text","d":"doc1"}`)
+	c.expect(`{"a":"s","c":"text","d":"doc1","data":{"v":2,"data":"hi","type":"http://sharejs.org/types/textv1"}}`)
+
+	// The edit is acknowledged, then undone once the session fails it
+	c.send(`{"a":"op","c":"text","d":"doc1","v":2,"src":"a","seq":1,"op":[2,"!"]}`)
+	c.expect(`{"a":"op","c":"text","d":"doc1","v":2,"src":"a","seq":1}`)
+	c.expect(`{"a":"op","c":"text","d":"doc1","v":3,"op":[2,{"d":1}]}`)
+
+	// A room that can't read the document's state can't open
+	flaky.broken.Store(true)
+
+	fresh := dial(t, sharedb.NewAdapter(sharedb.AdapterConfig{
+		Open: func(context.Context, string) (sharedb.Session, error) { return flaky, nil },
+	}), "alice", true)
+	fresh.send(`{"a":"s","c":"text","d":"doc1"}`)
+
+	msg := fresh.recv()
+	require.Equal(t, "ERR_INTERNAL", msg["error"].(map[string]any)["code"], msg) //nolint:forcetypeassert // Fails the test
+}
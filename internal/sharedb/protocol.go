@@ -0,0 +1,267 @@
+package sharedb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// ErrMalformed is returned for messages and ops that can't be decoded.
+var ErrMalformed = errors.New("malformed message")
+
+// Collections documents are served in. ShareDB clients get their documents
+// from a collection; here, it picks the type the content is shown as.
+const (
+	// TextCollection serves a document as a string of the "text" type,
+	// which clients register from the ot-text package.
+	TextCollection = "text"
+
+	// JSONCollection serves a document as a json0 object with the content
+	// in its ContentField string.
+	JSONCollection = "json0"
+
+	// ContentField is the field of json0 documents holding their content.
+	ContentField = "content"
+)
+
+// Actions of ShareDB messages that are supported.
+const (
+	actionInit      = "init"
+	actionHandshake = "hs"
+	actionFetch     = "f"
+	actionSubscribe = "s"
+	actionUnsub     = "u"
+	actionOp        = "op"
+)
+
+// Version of the ShareDB protocol spoken.
+const (
+	protocolMajor = 1
+	protocolMinor = 1
+)
+
+// message is a ShareDB message, in either direction.
+type message struct {
+	Action        string          `json:"a"`
+	ID            json.RawMessage `json:"id,omitempty"`
+	Protocol      int             `json:"protocol,omitempty"`
+	ProtocolMinor int             `json:"protocolMinor,omitempty"`
+	Type          string          `json:"type,omitempty"`
+	Collection    string          `json:"c,omitempty"`
+	DocID         string          `json:"d,omitempty"`
+	Version       *int            `json:"v,omitempty"`
+	Source        string          `json:"src,omitempty"`
+	Seq           int             `json:"seq,omitempty"`
+	Op            json.RawMessage `json:"op,omitempty"`
+	Create        json.RawMessage `json:"create,omitempty"`
+	Del           bool            `json:"del,omitempty"`
+	Data          *snapshot       `json:"data,omitempty"`
+	Error         *replyError     `json:"error,omitempty"`
+}
+
+// snapshot is a document's content at a version.
+type snapshot struct {
+	Version int    `json:"v"`
+	Data    any    `json:"data"`
+	Type    string `json:"type"`
+}
+
+// replyError is the error a request failed with.
+type replyError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// format is how a collection shows documents to clients.
+type format struct {
+	typeURI string
+	data    func(content string) any
+	decode  func(raw json.RawMessage) (textOp, error)
+	encode  func(op textOp) any
+}
+
+// formats holds the format of each collection.
+var formats = map[string]format{
+	TextCollection: {
+		typeURI: "http://sharejs.org/types/textv1",
+		data:    func(content string) any { return content },
+		decode:  decodeText,
+		encode:  encodeText,
+	},
+	JSONCollection: {
+		typeURI: "http://sharejs.org/types/JSONv0",
+		data:    func(content string) any { return map[string]string{ContentField: content} },
+		decode:  decodeJSON0,
+		encode:  encodeJSON0,
+	},
+}
+
+// decodeText decodes an op of the "text" type: an array of skip counts,
+// inserted strings and {"d": count} deletes.
+func decodeText(raw json.RawMessage) (textOp, error) {
+	var parts []json.RawMessage
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+
+	var op textOp
+
+	for _, part := range parts {
+		var (
+			skip   int
+			insert string
+			del    struct {
+				D json.RawMessage `json:"d"`
+			}
+		)
+
+		switch {
+		case json.Unmarshal(part, &skip) == nil && skip > 0:
+			op = op.push(component{skip: skip})
+		case json.Unmarshal(part, &insert) == nil && insert != "":
+			op = op.push(component{ins: utf16.Encode([]rune(insert))})
+		case json.Unmarshal(part, &del) == nil && del.D != nil:
+			n, err := deleteLength(del.D)
+			if err != nil {
+				return nil, err
+			}
+
+			op = op.push(component{del: make([]uint16, n)})
+		default:
+			return nil, fmt.Errorf("%w: invalid component %s", ErrMalformed, part)
+		}
+	}
+
+	return op.trim(), nil
+}
+
+// deleteLength returns the length of a delete, given as a count or as the
+// deleted string.
+func deleteLength(raw json.RawMessage) (int, error) {
+	var (
+		n    int
+		text string
+	)
+
+	switch {
+	case json.Unmarshal(raw, &n) == nil && n > 0:
+		return n, nil
+	case json.Unmarshal(raw, &text) == nil && text != "":
+		return len(utf16.Encode([]rune(text))), nil
+	default:
+		return 0, fmt.Errorf("%w: invalid delete %s", ErrMalformed, raw)
+	}
+}
+
+// encodeText encodes an op as the "text" type.
+func encodeText(op textOp) any {
+	parts := make([]any, 0, len(op))
+
+	for _, c := range op {
+		switch {
+		case c.isSkip():
+			parts = append(parts, c.skip)
+		case c.isInsert():
+			parts = append(parts, string(utf16.Decode(c.ins)))
+		default:
+			parts = append(parts, map[string]int{"d": len(c.del)})
+		}
+	}
+
+	return parts
+}
+
+// json0Component is a json0 string insert or delete.
+type json0Component struct {
+	Path   []any   `json:"p"`
+	Insert *string `json:"si,omitempty"`
+	Delete *string `json:"sd,omitempty"`
+}
+
+// decodeJSON0 decodes a json0 op made of string inserts and deletes in the
+// content field. Its components apply in turn.
+func decodeJSON0(raw json.RawMessage) (textOp, error) {
+	var parts []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+
+	var op textOp
+
+	for _, part := range parts {
+		c, err := decodeJSON0Component(part)
+		if err != nil {
+			return nil, err
+		}
+
+		op = compose(op, c)
+	}
+
+	return op, nil
+}
+
+// decodeJSON0Component decodes one component of a json0 op.
+func decodeJSON0Component(part map[string]json.RawMessage) (textOp, error) {
+	var (
+		field  string
+		offset int
+		text   string
+	)
+
+	var path []json.RawMessage
+
+	if err := json.Unmarshal(part["p"], &path); err != nil || len(path) != 2 ||
+		json.Unmarshal(path[0], &field) != nil || field != ContentField ||
+		json.Unmarshal(path[1], &offset) != nil || offset < 0 {
+		return nil, fmt.Errorf("%w: only string edits of %q are supported", ErrMalformed, ContentField)
+	}
+
+	insert, isInsert := part["si"]
+	del, isDelete := part["sd"]
+
+	if len(part) != 2 || isInsert == isDelete {
+		return nil, fmt.Errorf("%w: only si and sd components are supported", ErrMalformed)
+	}
+
+	value := insert
+	if isDelete {
+		value = del
+	}
+
+	if err := json.Unmarshal(value, &text); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+
+	units := utf16.Encode([]rune(text))
+	op := textOp{}.push(component{skip: offset})
+
+	if isInsert {
+		return op.push(component{ins: units}).trim(), nil
+	}
+
+	return op.push(component{del: make([]uint16, len(units))}).trim(), nil
+}
+
+// encodeJSON0 encodes an op as json0 components, which needs the text it
+// deletes.
+func encodeJSON0(op textOp) any {
+	parts := make([]json0Component, 0, len(op))
+	at := 0
+
+	for _, c := range op {
+		switch {
+		case c.isSkip():
+			at += c.skip
+		case c.isInsert():
+			text := string(utf16.Decode(c.ins))
+			parts = append(parts, json0Component{Path: []any{ContentField, at}, Insert: &text})
+			at += len(c.ins)
+		default:
+			text := string(utf16.Decode(c.del))
+			parts = append(parts, json0Component{Path: []any{ContentField, at}, Delete: &text})
+		}
+	}
+
+	return parts
+}
@@ -0,0 +1,561 @@
+package sharedb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"github.com/google/uuid"
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// room is a document's ShareDB copy, shared by the clients using it. It
+// acts as one client of the document's session: ops from ShareDB clients
+// are applied to the copy at once and queued as operations, which are sent
+// one at a time like the WebSocket clients do. Operations from the session
+// are transformed past the queued ones and applied to the copy as ops of
+// their own.
+//
+// When the session closes, the room disconnects its subscribers but keeps
+// the copy, so that clients reconnecting within the linger period can catch
+// up from their version.
+type room struct {
+	adapter *Adapter
+	docID   string
+	id      string // Client ID of the room's operations, and source of its ops
+	logger  *slog.Logger
+
+	mu       sync.Mutex
+	content  []uint16
+	version  int
+	log      []entry // The latest ops, the last at version-1
+	seq      int     // Of the room's own ops
+	loaded   bool    // content was loaded from the session
+	revision int     // Latest session revision applied to content
+	pending  []edit  // Not yet acknowledged, in order; the first may be in flight
+	reader   string  // User whose permissions the session's changes are read with
+	subs     map[subscription]bool
+	running  bool               // Attached to a session
+	cancel   context.CancelFunc // Stops run, while running
+	wake     context.CancelFunc // Interrupts run waiting for changes
+	idle     *time.Timer        // Expires the room, while it has no subscribers
+	idleGen  int                // Tells idle apart from timers stopped late
+	expired  bool
+}
+
+// subscription is a client's subscription to the document in a collection.
+type subscription struct {
+	peer       *peer
+	collection string
+}
+
+// entry is an applied op and the client that submitted it.
+type entry struct {
+	src string
+	seq int
+	op  textOp
+}
+
+// edit is an operation from a ShareDB client.
+type edit struct {
+	op     ot.Operation
+	userID string
+}
+
+// newRoom creates a room, which attach fills in.
+func newRoom(a *Adapter, docID string) *room {
+	return &room{
+		adapter: a,
+		docID:   docID,
+		id:      uuid.New().String(),
+		logger:  a.logger.With(logging.DocID(docID)),
+		subs:    make(map[subscription]bool),
+	}
+}
+
+// attach opens the document's session, unless the room has one, and brings
+// the copy up to date with it. It keeps the room until the request that
+// joined it is done, see release.
+func (r *room) attach(userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.idle != nil {
+		r.idle.Stop()
+		r.idle = nil
+	}
+
+	if r.running {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	session, err := r.adapter.open(ctx, r.docID)
+	if err != nil {
+		cancel()
+		r.release()
+
+		return err
+	}
+
+	content, revision, err := session.GetState(userID)
+	if err != nil {
+		cancel()
+		r.release()
+
+		return err
+	}
+
+	text := utf16.Encode([]rune(content))
+
+	if r.loaded {
+		r.serverOp(diff(r.content, text))
+	} else {
+		r.content, r.version, r.loaded = text, revision, true
+	}
+
+	r.revision = revision
+	r.pending = nil
+	r.reader = userID
+	r.running = true
+	r.cancel = cancel
+
+	go r.run(ctx, session)
+
+	return nil
+}
+
+// release lets the room expire if it has no subscribers. The caller must
+// hold r.mu.
+func (r *room) release() {
+	if len(r.subs) > 0 || r.idle != nil || r.expired {
+		return
+	}
+
+	r.idleGen++
+	gen := r.idleGen
+	r.idle = time.AfterFunc(r.adapter.linger, func() { r.adapter.expire(r, gen) })
+}
+
+// expire stops the room if it still has no subscribers, and reports whether
+// it did. gen is that of the timer expiring it.
+func (r *room) expire(gen int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.idle == nil || gen != r.idleGen || len(r.subs) > 0 || r.expired {
+		return false
+	}
+
+	r.expired = true
+
+	if r.running {
+		r.cancel()
+	}
+
+	return true
+}
+
+// fetch answers a fetch or subscribe request with the document's snapshot,
+// or, if the request has a version, with the ops since then.
+func (r *room) fetch(p *peer, req *message, subscribe bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.release()
+
+	var data *snapshot
+
+	if req.Version == nil {
+		data = &snapshot{
+			Version: r.version,
+			Data:    formats[req.Collection].data(string(utf16.Decode(r.content))),
+			Type:    formats[req.Collection].typeURI,
+		}
+	} else {
+		entries, err := r.since(*req.Version)
+		if err != nil {
+			return err
+		}
+
+		for i, e := range entries {
+			p.send(r.opMessage(req.Collection, *req.Version+i, e))
+		}
+	}
+
+	if subscribe {
+		r.subs[subscription{peer: p, collection: req.Collection}] = true
+		p.track(r, true)
+	}
+
+	p.send(&message{Action: req.Action, Collection: req.Collection, DocID: req.DocID, Data: data})
+
+	return nil
+}
+
+// unsubscribe ends a client's subscription in a collection.
+func (r *room) unsubscribe(p *peer, collection string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.release()
+
+	delete(r.subs, subscription{peer: p, collection: collection})
+
+	for s := range r.subs {
+		if s.peer == p {
+			return
+		}
+	}
+
+	p.track(r, false)
+}
+
+// leave ends the subscriptions of a client that disconnected.
+func (r *room) leave(p *peer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.release()
+
+	for s := range r.subs {
+		if s.peer == p {
+			delete(r.subs, s)
+		}
+	}
+}
+
+// submit applies an op from a client, once transformed past the ops it
+// hadn't seen, and acknowledges it. An op the client submitted already,
+// before reconnecting, is only acknowledged again.
+func (r *room) submit(p *peer, req *message, session Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.release()
+
+	switch {
+	case req.Create != nil:
+		return fmt.Errorf("%w: documents are created over the REST API", ErrRejected)
+	case req.Del:
+		return fmt.Errorf("%w: documents are deleted over the REST API", ErrRejected)
+	case req.Version == nil || req.Op == nil:
+		return fmt.Errorf("%w: op without a version", ErrMalformed)
+	case !p.canWrite(r.docID):
+		return fmt.Errorf("%w: no write access", ErrRejected)
+	case session.Archived():
+		return collab.ErrDocumentArchived
+	}
+
+	op, err := formats[req.Collection].decode(req.Op)
+	if err != nil {
+		return err
+	}
+
+	base := *req.Version
+
+	entries, err := r.since(base)
+	if err != nil {
+		return err
+	}
+
+	sub := subscription{peer: p, collection: req.Collection}
+
+	version := -1
+
+	for i, e := range entries {
+		if e.src == req.Source && e.seq == req.Seq {
+			version = base + i
+		}
+	}
+
+	// Clients that aren't subscribed get the ops they missed first
+	if !r.subs[sub] {
+		for i, e := range entries {
+			if base+i != version {
+				p.send(r.opMessage(req.Collection, base+i, e))
+			}
+		}
+	}
+
+	if version < 0 {
+		for _, e := range entries {
+			op = transform(op, e.op, true)
+		}
+
+		if version, err = r.commit(op, req.Source, req.Seq, p.userID, sub); err != nil {
+			return err
+		}
+	}
+
+	p.send(&message{
+		Action:     actionOp,
+		Collection: req.Collection,
+		DocID:      req.DocID,
+		Version:    &version,
+		Source:     req.Source,
+		Seq:        req.Seq,
+	})
+
+	return nil
+}
+
+// since returns the ops from a version on. The caller must hold r.mu.
+func (r *room) since(version int) ([]entry, error) {
+	switch {
+	case version > r.version:
+		return nil, fmt.Errorf("%w: %d > %d", ErrVersionTooNew, version, r.version)
+	case version < r.version-len(r.log):
+		return nil, fmt.Errorf("%w: %d", ErrVersionUnknown, version)
+	}
+
+	return r.log[len(r.log)-(r.version-version):], nil
+}
+
+// commit applies an op at the current version and sends it to the
+// subscribers but except. An op from a user is queued as operations for
+// the session. It returns the version the op was applied at. The caller
+// must hold r.mu.
+func (r *room) commit(op textOp, src string, seq int, userID string, except subscription) (int, error) {
+	content, applied, err := op.apply(r.content)
+	if err != nil {
+		return 0, err
+	}
+
+	if userID != "" {
+		for _, o := range applied.operations(r.content, userID) {
+			r.pending = append(r.pending, edit{op: o, userID: userID})
+		}
+
+		if r.wake != nil {
+			r.wake()
+		}
+	}
+
+	e := entry{src: src, seq: seq, op: applied}
+	version := r.version
+
+	r.content = content
+	r.version++
+	r.log = append(r.log, e)
+
+	if len(r.log) > r.adapter.history {
+		r.log = r.log[len(r.log)-r.adapter.history:]
+	}
+
+	for s := range r.subs {
+		if s != except {
+			s.peer.send(r.opMessage(s.collection, version, e))
+		}
+	}
+
+	return version, nil
+}
+
+// serverOp commits an op made by the room itself. The caller must hold
+// r.mu.
+func (r *room) serverOp(op textOp) {
+	r.seq++
+
+	if _, err := r.commit(op, r.id, r.seq, "", subscription{}); err != nil {
+		// The room makes its ops for its own copy, so they always apply
+		panic(err)
+	}
+}
+
+// opMessage returns the message sending an op in a collection's format.
+func (r *room) opMessage(collection string, version int, e entry) *message {
+	return &message{
+		Action:     actionOp,
+		Collection: collection,
+		DocID:      r.docID,
+		Version:    &version,
+		Source:     e.src,
+		Seq:        e.seq,
+		Op:         mustMarshal(formats[collection].encode(e.op)),
+	}
+}
+
+// run applies the queued operations to the session and the session's
+// operations to the copy until ctx is done, or the session closes or fails.
+func (r *room) run(ctx context.Context, session Session) {
+	for ctx.Err() == nil {
+		if err := r.step(ctx, session); err != nil {
+			if ctx.Err() == nil {
+				r.detach(err)
+			}
+
+			return
+		}
+	}
+}
+
+// step sends the next queued operation and applies the operations up to its
+// revision, or, with none queued, waits for operations from the session.
+func (r *room) step(ctx context.Context, session Session) error {
+	r.mu.Lock()
+
+	if len(r.pending) == 0 {
+		waitCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		r.wake = cancel
+		since, reader := r.revision, r.reader
+		r.mu.Unlock()
+
+		ops, _, err := session.Changes(waitCtx, reader, since)
+
+		r.mu.Lock()
+		r.wake = nil
+		r.mu.Unlock()
+
+		if err != nil {
+			return r.recover(session, err, reader)
+		}
+
+		return r.receive(session, ops, 0)
+	}
+
+	next, base := r.pending[0], r.revision
+	r.mu.Unlock()
+
+	revision, err := session.ApplyOperation(r.id, next.userID, next.op, base)
+	if err != nil {
+		return r.recover(session, err, next.userID)
+	}
+
+	for {
+		r.mu.Lock()
+		since, reader := r.revision, r.reader
+		r.mu.Unlock()
+
+		if since >= revision {
+			return nil
+		}
+
+		ops, _, err := session.Changes(ctx, reader, since)
+		if err != nil {
+			return r.recover(session, err, reader)
+		}
+
+		if err := r.receive(session, ops, revision); err != nil {
+			return err
+		}
+	}
+}
+
+// receive applies operations from the session in revision order. The one at
+// revision ack is the first queued operation, which is dropped from the
+// queue; the others are transformed past the queued ones.
+func (r *room) receive(session Session, ops []ot.SequencedOperation, ack int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, op := range ops {
+		if op.Revision <= r.revision {
+			continue
+		}
+
+		r.revision = op.Revision
+
+		if op.Revision == ack {
+			r.pending = r.pending[1:]
+
+			continue
+		}
+
+		remote := op.Operation
+		for i := range r.pending {
+			r.pending[i].op, remote = ot.Transform(r.pending[i].op, remote)
+		}
+
+		change, err := fromOperation(remote, r.content)
+		if err != nil {
+			r.logger.Error("sharedb copy diverged from the document", logging.Revision(op.Revision), logging.Err(err))
+
+			return r.resync(session)
+		}
+
+		r.serverOp(change)
+	}
+
+	return nil
+}
+
+// recover handles an error from the session. Operations that were rejected
+// are undone by resyncing; users who lost access are disconnected. It
+// returns an error if the room can't go on.
+func (r *room) recover(session Session, err error, userID string) error {
+	switch {
+	case errors.Is(err, collab.ErrSessionClosed), errors.Is(err, storage.ErrDocumentNotFound):
+		return err
+	case errors.Is(err, acl.ErrAccessDenied):
+		if !r.disconnect(userID) {
+			return err
+		}
+	case errors.Is(err, storage.ErrRevisionCompacted):
+	default:
+		r.logger.Warn("sharedb edit failed, resyncing", logging.UserID(userID), logging.Err(err))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.resync(session)
+}
+
+// resync drops the queued operations and brings the copy in line with the
+// document, with an op of the room's own. The caller must hold r.mu.
+func (r *room) resync(session Session) error {
+	content, revision, err := session.GetState(r.reader)
+	if err != nil {
+		return err
+	}
+
+	r.pending = nil
+	r.revision = revision
+	r.serverOp(diff(r.content, utf16.Encode([]rune(content))))
+
+	return nil
+}
+
+// disconnect closes the connections of a user who lost access. If the room
+// read the session's changes as them, it reads them as another subscriber
+// from now on, and reports whether there is one.
+func (r *room) disconnect(userID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for s := range r.subs {
+		if s.peer.userID == userID {
+			s.peer.close()
+		} else if r.reader == userID {
+			r.reader = s.peer.userID
+		}
+	}
+
+	return r.reader != userID
+}
+
+// detach disconnects the subscribers after the session closed or failed.
+// The copy is kept for clients that reconnect, see room.
+func (r *room) detach(err error) {
+	if !errors.Is(err, collab.ErrSessionClosed) {
+		r.logger.Warn("sharedb room detached from session", logging.Err(err))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.running = false
+	r.cancel()
+
+	for s := range r.subs {
+		s.peer.close()
+	}
+}
@@ -0,0 +1,370 @@
+package sharedb
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"unicode/utf16"
+
+	"github.com/serroba/online-docs/internal/ot"
+)
+
+// ErrNotApplied is returned for ops that don't fit the text they're applied
+// to, such as ones reaching past its end or splitting a character.
+var ErrNotApplied = errors.New("op does not apply to the document")
+
+// component is one part of a textOp: a skip over, an insert of, or a
+// delete of, a number of UTF-16 code units. Like ShareDB's text types,
+// textOp counts code units, as JavaScript strings do.
+type component struct {
+	skip int      // Units kept, for a skip
+	ins  []uint16 // Units inserted, for an insert
+	del  []uint16 // Units deleted, for a delete; zeros until the op is applied
+}
+
+func (c component) isSkip() bool   { return c.skip > 0 }
+func (c component) isInsert() bool { return len(c.ins) > 0 }
+func (c component) isDelete() bool { return len(c.del) > 0 }
+
+// length returns the number of units the component covers.
+func (c component) length() int {
+	return c.skip + len(c.ins) + len(c.del)
+}
+
+// slice returns the part of the component from one unit to another.
+func (c component) slice(from, to int) component {
+	switch {
+	case c.isSkip():
+		return component{skip: to - from}
+	case c.isInsert():
+		return component{ins: c.ins[from:to]}
+	default:
+		return component{del: c.del[from:to]}
+	}
+}
+
+// textOp is an edit of the whole text, in the form of ShareDB's "text"
+// type: its components apply in turn from the start of the text, which is
+// kept past the last one.
+type textOp []component
+
+// push appends a component, merging it into the last one if they're of the
+// same kind.
+func (op textOp) push(c component) textOp {
+	if c.length() == 0 {
+		return op
+	}
+
+	if n := len(op); n > 0 {
+		last := &op[n-1]
+
+		switch {
+		case c.isSkip() && last.isSkip():
+			last.skip += c.skip
+
+			return op
+		case c.isInsert() && last.isInsert():
+			last.ins = append(slices.Clip(last.ins), c.ins...)
+
+			return op
+		case c.isDelete() && last.isDelete():
+			last.del = append(slices.Clip(last.del), c.del...)
+
+			return op
+		}
+	}
+
+	return append(op, c)
+}
+
+// trim drops a trailing skip, which changes nothing.
+func (op textOp) trim() textOp {
+	if n := len(op); n > 0 && op[n-1].isSkip() {
+		return op[:n-1]
+	}
+
+	return op
+}
+
+// taker reads an op a component, or part of one, at a time.
+type taker struct {
+	op     textOp
+	i      int // Component being read
+	offset int // Units of it read already
+}
+
+// take returns the next n units of the op, or fewer if the current
+// component ends first. Components for which whole returns true are
+// returned whole, as is the rest of the current one if n < 0. Past the end
+// of the op, it returns a skip of n units, or false if n < 0.
+func (t *taker) take(n int, whole func(component) bool) (component, bool) {
+	if t.i == len(t.op) {
+		return component{skip: n}, n >= 0
+	}
+
+	c := t.op[t.i]
+
+	size := c.length() - t.offset
+	if n >= 0 && size > n && (whole == nil || !whole(c)) {
+		size = n
+	}
+
+	part := c.slice(t.offset, t.offset+size)
+
+	t.offset += size
+	if t.offset == c.length() {
+		t.i++
+		t.offset = 0
+	}
+
+	return part, true
+}
+
+// peek returns the current component, or a zero one past the end.
+func (t *taker) peek() component {
+	if t.i == len(t.op) {
+		return component{}
+	}
+
+	return t.op[t.i]
+}
+
+// transform returns op changed to apply after other, where both applied to
+// the same text. If both insert at the same place, op's insert goes first
+// if left is set.
+func transform(op, other textOp, left bool) textOp {
+	var result textOp
+
+	t := &taker{op: op}
+
+	for _, c := range other {
+		switch {
+		case c.isSkip():
+			for n := c.skip; n > 0; {
+				part, _ := t.take(n, component.isInsert)
+				result = result.push(part)
+
+				if !part.isInsert() {
+					n -= part.length()
+				}
+			}
+		case c.isInsert():
+			if left && t.peek().isInsert() {
+				part, _ := t.take(-1, nil)
+				result = result.push(part)
+			}
+
+			result = result.push(component{skip: len(c.ins)})
+		default:
+			for n := len(c.del); n > 0; {
+				part, _ := t.take(n, component.isInsert)
+				if part.isInsert() {
+					result = result.push(part)
+				} else {
+					// Text deleted by both is deleted by other already
+					n -= part.length()
+				}
+			}
+		}
+	}
+
+	for part, ok := t.take(-1, nil); ok; part, ok = t.take(-1, nil) {
+		result = result.push(part)
+	}
+
+	return result.trim()
+}
+
+// compose returns an op with the effect of first followed by second.
+func compose(first, second textOp) textOp {
+	var result textOp
+
+	t := &taker{op: first}
+
+	for _, c := range second {
+		switch {
+		case c.isSkip():
+			for n := c.skip; n > 0; {
+				part, _ := t.take(n, component.isDelete)
+				result = result.push(part)
+
+				if !part.isDelete() {
+					n -= part.length()
+				}
+			}
+		case c.isInsert():
+			result = result.push(c)
+		default:
+			for deleted := c.del; len(deleted) > 0; {
+				part, _ := t.take(len(deleted), component.isDelete)
+
+				switch {
+				case part.isSkip():
+					result = result.push(component{del: deleted[:part.skip]})
+					deleted = deleted[part.skip:]
+				case part.isInsert():
+					// Inserted by first, so neither needs to mention it
+					deleted = deleted[len(part.ins):]
+				default:
+					result = result.push(part)
+				}
+			}
+		}
+	}
+
+	for part, ok := t.take(-1, nil); ok; part, ok = t.take(-1, nil) {
+		result = result.push(part)
+	}
+
+	return result.trim()
+}
+
+// apply applies the op to text. It returns the new text and the op with the
+// text it deletes filled in.
+func (op textOp) apply(text []uint16) ([]uint16, textOp, error) {
+	result := make([]uint16, 0, len(text))
+	applied := make(textOp, 0, len(op))
+	at := 0
+
+	for _, c := range op {
+		if at+c.skip+len(c.del) > len(text) {
+			return nil, nil, fmt.Errorf("%w: it reaches past the end", ErrNotApplied)
+		}
+
+		switch {
+		case c.isSkip():
+			result = append(result, text[at:at+c.skip]...)
+			at += c.skip
+		case c.isDelete():
+			c = component{del: slices.Clone(text[at : at+len(c.del)])}
+			at += len(c.del)
+		}
+
+		if splitsPair(text, at) {
+			return nil, nil, fmt.Errorf("%w: it splits a character", ErrNotApplied)
+		}
+
+		result = append(result, c.ins...)
+		applied = append(applied, c)
+	}
+
+	return append(result, text[at:]...), applied, nil
+}
+
+// operations returns the character operations with the effect of the op on
+// text, which it must apply to.
+func (op textOp) operations(text []uint16, userID string) []ot.Operation {
+	var ops []ot.Operation
+
+	at, position := 0, 0 // In units and characters
+
+	for _, c := range op {
+		switch {
+		case c.isSkip():
+			position += countRunes(text[at : at+c.skip])
+			at += c.skip
+		case c.isInsert():
+			for _, r := range utf16.Decode(c.ins) {
+				ops = append(ops, ot.NewInsert(string(r), position, userID))
+				position++
+			}
+		default:
+			for range countRunes(c.del) {
+				ops = append(ops, ot.NewDelete(position, userID))
+			}
+
+			at += len(c.del)
+		}
+	}
+
+	return ops
+}
+
+// fromOperation returns the op with the effect of a character operation on
+// text. Formats don't change plain text, so they have none.
+func fromOperation(op ot.Operation, text []uint16) (textOp, error) {
+	if op.IsNoop() || op.IsFormat() {
+		return nil, nil
+	}
+
+	at := 0
+
+	for range op.Position {
+		if at == len(text) {
+			return nil, fmt.Errorf("%w: position %d is past the end", ErrNotApplied, op.Position)
+		}
+
+		at += runeWidth(text, at)
+	}
+
+	result := textOp{}.push(component{skip: at})
+
+	if op.IsInsert() {
+		return result.push(component{ins: utf16.Encode([]rune(op.Char))}), nil
+	}
+
+	if at == len(text) {
+		return nil, fmt.Errorf("%w: position %d is past the end", ErrNotApplied, op.Position)
+	}
+
+	return result.push(component{del: make([]uint16, runeWidth(text, at))}), nil
+}
+
+// diff returns an op turning one text into another, replacing what lies
+// between their common prefix and suffix.
+func diff(from, to []uint16) textOp {
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		prefix++
+	}
+
+	if splitsPair(from, prefix) {
+		prefix--
+	}
+
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix && from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+
+	if splitsPair(from, len(from)-suffix) {
+		suffix--
+	}
+
+	return textOp{}.
+		push(component{skip: prefix}).
+		push(component{ins: to[prefix : len(to)-suffix]}).
+		push(component{del: make([]uint16, len(from)-suffix-prefix)})
+}
+
+// splitsPair reports whether a position in text falls between the halves of
+// a surrogate pair.
+func splitsPair(text []uint16, at int) bool {
+	return at > 0 && at < len(text) && isHigh(text[at-1]) && isLow(text[at])
+}
+
+// runeWidth returns the number of units of the character at a position.
+func runeWidth(text []uint16, at int) int {
+	if at+1 < len(text) && isHigh(text[at]) && isLow(text[at+1]) {
+		return 2
+	}
+
+	return 1
+}
+
+// countRunes returns the number of characters in units that don't split
+// any.
+func countRunes(units []uint16) int {
+	n := len(units)
+
+	for _, u := range units {
+		if isLow(u) {
+			n--
+		}
+	}
+
+	return n
+}
+
+func isHigh(u uint16) bool { return u >= 0xd800 && u < 0xdc00 }
+func isLow(u uint16) bool  { return u >= 0xdc00 && u < 0xe000 }
@@ -0,0 +1,688 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/serroba/online-docs/internal/ot"
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltOpenTimeout is how long OpenBoltStore waits for another process to
+// release the file.
+const boltOpenTimeout = time.Second
+
+// Names of buckets and keys in the file. Each document has a bucket in
+// boltDocuments holding its metadata, snapshot, handoff, and buckets of
+// its operations and editors.
+var (
+	boltDocuments = []byte("documents")
+	boltSlugs     = []byte("slugs") // slug -> docID
+	boltMeta      = []byte("meta")
+	boltSnapshot  = []byte("snapshot")
+	boltHandoff   = []byte("handoff")
+	boltOps       = []byte("ops") // Big-endian revision -> operation, so keys sort by revision
+	boltEditors   = []byte("editors")
+)
+
+// boltMetadata is the stored form of a document's metadata.
+type boltMetadata struct {
+	CreatedAt    time.Time
+	LastEditedAt time.Time
+	LastEditedBy string
+	Tags         []string
+	ArchivedAt   time.Time
+	Slug         string
+	Title        string            `json:",omitempty"`
+	Properties   map[string]string `json:",omitempty"`
+	Fence        uint64            // Highest fencing token a write was made with
+}
+
+// boltOperation is the stored form of an operation. Its revision is the key.
+type boltOperation struct {
+	ot.Operation
+
+	Timestamp time.Time `json:",omitzero"`
+}
+
+// BoltStore is a Store that keeps documents in a single file with bbolt,
+// for single-node deployments that don't want to run a database. Each
+// write is a transaction that's synced to disk before it returns, so after
+// a crash every document is as it was after its last completed write.
+//
+// Only one process can open the file at a time.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltStore opens the store in the file at path, creating it if needed.
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltDocuments, boltSlugs} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+
+		return nil, err
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+// Close closes the file.
+func (b *BoltStore) Close() error {
+	return b.db.Close()
+}
+
+// view runs fn in a read-only transaction with the document's bucket.
+func (b *BoltStore) view(ctx context.Context, docID string, fn func(doc *bolt.Bucket) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return b.db.View(func(tx *bolt.Tx) error {
+		doc := tx.Bucket(boltDocuments).Bucket([]byte(docID))
+		if doc == nil {
+			return ErrDocumentNotFound
+		}
+
+		return fn(doc)
+	})
+}
+
+// update runs fn in a read-write transaction with the document's bucket
+// and metadata, saving the metadata afterwards. With fenced set it first
+// checks the fencing token carried by ctx, recording it if it's the
+// highest yet. Nothing is written if fn fails.
+func (b *BoltStore) update(
+	ctx context.Context, docID string, fenced bool,
+	fn func(tx *bolt.Tx, doc *bolt.Bucket, meta *boltMetadata) error,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		doc := tx.Bucket(boltDocuments).Bucket([]byte(docID))
+		if doc == nil {
+			return ErrDocumentNotFound
+		}
+
+		var meta boltMetadata
+		if err := json.Unmarshal(doc.Get(boltMeta), &meta); err != nil {
+			return err
+		}
+
+		if token, ok := FencingToken(ctx); ok && fenced {
+			if token < meta.Fence {
+				return ErrFenced
+			}
+
+			meta.Fence = token
+		}
+
+		if err := fn(tx, doc, &meta); err != nil {
+			return err
+		}
+
+		return putJSON(doc, boltMeta, meta)
+	})
+}
+
+// putJSON stores v in the bucket as JSON.
+func putJSON(bucket *bolt.Bucket, key []byte, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return bucket.Put(key, data)
+}
+
+// revisionKey returns the key of the operation at revision.
+func revisionKey(revision int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(max(revision, 0))) //nolint:gosec // Not negative
+}
+
+// CreateDocument creates a new document with the given ID.
+func (b *BoltStore) CreateDocument(ctx context.Context, docID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		_, err := createBoltDocument(tx, docID)
+
+		return err
+	})
+}
+
+// CreateDocumentFromSnapshot creates a new document starting from a
+// revision 0 snapshot of content.
+func (b *BoltStore) CreateDocumentFromSnapshot(ctx context.Context, docID, content string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		doc, err := createBoltDocument(tx, docID)
+		if err != nil {
+			return err
+		}
+
+		return replaceBoltSnapshot(doc, Snapshot{DocID: docID, Content: content})
+	})
+}
+
+// createBoltDocument adds the document's bucket, with its operations and
+// editors buckets and its metadata.
+func createBoltDocument(tx *bolt.Tx, docID string) (*bolt.Bucket, error) {
+	doc, err := tx.Bucket(boltDocuments).CreateBucket([]byte(docID))
+	if errors.Is(err, bolt.ErrBucketExists) {
+		return nil, ErrDocumentExists
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range [][]byte{boltOps, boltEditors} {
+		if _, err := doc.CreateBucket(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, putJSON(doc, boltMeta, boltMetadata{CreatedAt: time.Now()})
+}
+
+// DocumentExists checks if a document exists.
+func (b *BoltStore) DocumentExists(ctx context.Context, docID string) (bool, error) {
+	err := b.view(ctx, docID, func(*bolt.Bucket) error { return nil })
+	if errors.Is(err, ErrDocumentNotFound) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// SaveSnapshot persists a snapshot of the document at the given revision,
+// pruning the operations it covers.
+func (b *BoltStore) SaveSnapshot(ctx context.Context, docID string, revision int, content string) error {
+	return b.SaveFormattedSnapshot(ctx, docID, revision, content, nil)
+}
+
+// SaveFormattedSnapshot persists a snapshot of the document at the given
+// revision with its formatting, pruning the operations it covers.
+func (b *BoltStore) SaveFormattedSnapshot(
+	ctx context.Context, docID string, revision int, content string, formatting []ot.Mark,
+) error {
+	return b.update(ctx, docID, true, func(_ *bolt.Tx, doc *bolt.Bucket, _ *boltMetadata) error {
+		return replaceBoltSnapshot(doc, Snapshot{DocID: docID, Revision: revision, Content: content, Formatting: formatting})
+	})
+}
+
+// replaceBoltSnapshot stores the document's snapshot, as of now, and prunes
+// the operations it covers.
+func replaceBoltSnapshot(doc *bolt.Bucket, snapshot Snapshot) error {
+	snapshot.CreatedAt = time.Now()
+	if err := putJSON(doc, boltSnapshot, snapshot); err != nil {
+		return err
+	}
+
+	ops := doc.Bucket(boltOps)
+	last := revisionKey(snapshot.Revision)
+
+	// Keys are collected first, as deleting moves the cursor
+	var covered [][]byte
+
+	c := ops.Cursor()
+	for k, _ := c.First(); k != nil && bytes.Compare(k, last) <= 0; k, _ = c.Next() {
+		covered = append(covered, slices.Clone(k))
+	}
+
+	for _, k := range covered {
+		if err := ops.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadSnapshot retrieves the latest snapshot for a document.
+func (b *BoltStore) LoadSnapshot(ctx context.Context, docID string) (Snapshot, error) {
+	var snapshot Snapshot
+
+	err := b.view(ctx, docID, func(doc *bolt.Bucket) error {
+		data := doc.Get(boltSnapshot)
+		if data == nil {
+			return ErrSnapshotNotFound
+		}
+
+		return json.Unmarshal(data, &snapshot)
+	})
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	return snapshot, nil
+}
+
+// SaveHandoff stores the state of a session being handed over.
+func (b *BoltStore) SaveHandoff(ctx context.Context, handoff Handoff) error {
+	handoff.CreatedAt = time.Now()
+
+	return b.update(ctx, handoff.DocID, true, func(_ *bolt.Tx, doc *bolt.Bucket, _ *boltMetadata) error {
+		return putJSON(doc, boltHandoff, handoff)
+	})
+}
+
+// TakeHandoff returns and removes the document's handoff.
+func (b *BoltStore) TakeHandoff(ctx context.Context, docID string) (Handoff, error) {
+	var handoff Handoff
+
+	err := b.update(ctx, docID, false, func(_ *bolt.Tx, doc *bolt.Bucket, _ *boltMetadata) error {
+		data := doc.Get(boltHandoff)
+		if data == nil {
+			return ErrHandoffNotFound
+		}
+
+		if err := json.Unmarshal(data, &handoff); err != nil {
+			return err
+		}
+
+		return doc.Delete(boltHandoff)
+	})
+	if err != nil {
+		return Handoff{}, err
+	}
+
+	return handoff, nil
+}
+
+// AppendOperation adds an operation to the document's operation log.
+func (b *BoltStore) AppendOperation(ctx context.Context, docID string, op ot.SequencedOperation) error {
+	return b.AppendOperations(ctx, docID, []ot.SequencedOperation{op})
+}
+
+// AppendOperations adds operations to the document's operation log in one
+// transaction. Operations already in the log are left as they are, so a
+// batch that's retried after a crash isn't stored twice.
+func (b *BoltStore) AppendOperations(ctx context.Context, docID string, ops []ot.SequencedOperation) error {
+	return b.update(ctx, docID, true, func(_ *bolt.Tx, doc *bolt.Bucket, meta *boltMetadata) error {
+		log, editors := doc.Bucket(boltOps), doc.Bucket(boltEditors)
+
+		for _, op := range ops {
+			key := revisionKey(op.Revision)
+			if log.Get(key) != nil {
+				continue
+			}
+
+			if err := putJSON(log, key, boltOperation{Operation: op.Operation, Timestamp: op.Timestamp}); err != nil {
+				return err
+			}
+
+			// Keys can't be empty, and operations without a user have no
+			// editor to count
+			if op.UserID != "" {
+				if err := editors.Put([]byte(op.UserID), []byte{}); err != nil {
+					return err
+				}
+			}
+
+			meta.LastEditedAt = time.Now()
+			meta.LastEditedBy = op.UserID
+		}
+
+		return nil
+	})
+}
+
+// LoadOperations retrieves all operations after the given revision.
+func (b *BoltStore) LoadOperations(
+	ctx context.Context, docID string, sinceRevision int,
+) ([]ot.SequencedOperation, error) {
+	var ops []ot.SequencedOperation
+
+	err := b.view(ctx, docID, func(doc *bolt.Bucket) error {
+		c := doc.Bucket(boltOps).Cursor()
+
+		for k, v := c.Seek(revisionKey(sinceRevision + 1)); k != nil; k, v = c.Next() {
+			op, err := decodeBoltOperation(k, v)
+			if err != nil {
+				return err
+			}
+
+			ops = append(ops, op)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ops, nil
+}
+
+// decodeBoltOperation decodes an entry of a document's operation log.
+func decodeBoltOperation(key, value []byte) (ot.SequencedOperation, error) {
+	var stored boltOperation
+	if err := json.Unmarshal(value, &stored); err != nil {
+		return ot.SequencedOperation{}, err
+	}
+
+	return ot.SequencedOperation{
+		Operation: stored.Operation,
+		Revision:  int(binary.BigEndian.Uint64(key)), //nolint:gosec // Stored from an int
+		Timestamp: stored.Timestamp,
+	}, nil
+}
+
+// LatestRevision returns the highest revision number for a document.
+func (b *BoltStore) LatestRevision(ctx context.Context, docID string) (int, error) {
+	var revision int
+
+	err := b.view(ctx, docID, func(doc *bolt.Bucket) error {
+		// Operations are usually newer than the snapshot, but can be stored
+		// after a snapshot that already covers them
+		if k, _ := doc.Bucket(boltOps).Cursor().Last(); k != nil {
+			revision = int(binary.BigEndian.Uint64(k)) //nolint:gosec // Stored from an int
+		}
+
+		data := doc.Get(boltSnapshot)
+		if data == nil {
+			return nil
+		}
+
+		var snapshot Snapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return err
+		}
+
+		revision = max(revision, snapshot.Revision)
+
+		return nil
+	})
+
+	return revision, err
+}
+
+// LoadMetadata returns the document's edit metadata.
+func (b *BoltStore) LoadMetadata(ctx context.Context, docID string) (Metadata, error) {
+	var metadata Metadata
+
+	err := b.view(ctx, docID, func(doc *bolt.Bucket) error {
+		var meta boltMetadata
+		if err := json.Unmarshal(doc.Get(boltMeta), &meta); err != nil {
+			return err
+		}
+
+		metadata = Metadata{
+			DocID:        docID,
+			CreatedAt:    meta.CreatedAt,
+			LastEditedAt: meta.LastEditedAt,
+			LastEditedBy: meta.LastEditedBy,
+			Editors:      doc.Bucket(boltEditors).Stats().KeyN,
+			Tags:         meta.Tags,
+			ArchivedAt:   meta.ArchivedAt,
+			Slug:         meta.Slug,
+			Title:        meta.Title,
+			Properties:   meta.Properties,
+		}
+
+		return nil
+	})
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	return metadata, nil
+}
+
+// SetTags replaces the document's tags, stored sorted and without duplicates.
+func (b *BoltStore) SetTags(ctx context.Context, docID string, tags []string) error {
+	tags = slices.Clone(tags)
+	slices.Sort(tags)
+
+	return b.update(ctx, docID, false, func(_ *bolt.Tx, _ *bolt.Bucket, meta *boltMetadata) error {
+		meta.Tags = slices.Compact(tags)
+
+		return nil
+	})
+}
+
+// SetTitle renames the document.
+func (b *BoltStore) SetTitle(ctx context.Context, docID, title string) error {
+	return b.update(ctx, docID, false, func(_ *bolt.Tx, _ *bolt.Bucket, meta *boltMetadata) error {
+		meta.Title = title
+
+		return nil
+	})
+}
+
+// SetProperties replaces the document's key/value properties.
+func (b *BoltStore) SetProperties(ctx context.Context, docID string, properties map[string]string) error {
+	return b.update(ctx, docID, false, func(_ *bolt.Tx, _ *bolt.Bucket, meta *boltMetadata) error {
+		meta.Properties = properties
+
+		return nil
+	})
+}
+
+// UpdateDetails sets the document's title and properties, provided they're
+// those the update is based on.
+func (b *BoltStore) UpdateDetails(ctx context.Context, docID string, update DetailsUpdate) error {
+	return b.update(ctx, docID, false, func(_ *bolt.Tx, _ *bolt.Bucket, meta *boltMetadata) error {
+		if !update.matches(meta.Title, meta.Properties) {
+			return ErrDetailsChanged
+		}
+
+		if update.Title != nil {
+			meta.Title = *update.Title
+		}
+
+		if update.Properties != nil {
+			meta.Properties = update.Properties
+		}
+
+		return nil
+	})
+}
+
+// SetArchived archives or unarchives a document.
+func (b *BoltStore) SetArchived(ctx context.Context, docID string, archived bool) error {
+	return b.update(ctx, docID, false, func(_ *bolt.Tx, _ *bolt.Bucket, meta *boltMetadata) error {
+		switch {
+		case !archived:
+			meta.ArchivedAt = time.Time{}
+		case meta.ArchivedAt.IsZero():
+			meta.ArchivedAt = time.Now()
+		}
+
+		return nil
+	})
+}
+
+// SetSlug gives the document a unique human-readable alias.
+func (b *BoltStore) SetSlug(ctx context.Context, docID, slug string) error {
+	return b.update(ctx, docID, false, func(tx *bolt.Tx, _ *bolt.Bucket, meta *boltMetadata) error {
+		slugs := tx.Bucket(boltSlugs)
+
+		if owner := slugs.Get([]byte(slug)); owner != nil && string(owner) != docID {
+			return ErrSlugTaken
+		}
+
+		if err := deleteSlug(slugs, meta.Slug); err != nil {
+			return err
+		}
+
+		if slug != "" {
+			if err := slugs.Put([]byte(slug), []byte(docID)); err != nil {
+				return err
+			}
+		}
+
+		meta.Slug = slug
+
+		return nil
+	})
+}
+
+// deleteSlug frees a slug, if it's set.
+func deleteSlug(slugs *bolt.Bucket, slug string) error {
+	if slug == "" {
+		return nil
+	}
+
+	return slugs.Delete([]byte(slug))
+}
+
+// ResolveSlug returns the ID of the document with the given slug.
+func (b *BoltStore) ResolveSlug(ctx context.Context, slug string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	var docID string
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		owner := tx.Bucket(boltSlugs).Get([]byte(slug))
+		if owner == nil {
+			return ErrSlugNotFound
+		}
+
+		docID = string(owner)
+
+		return nil
+	})
+
+	return docID, err
+}
+
+// Usage reports how many documents are stored and their approximate size,
+// counted the same way as MemoryStore. It reads every operation, so it's
+// meant for occasional reporting.
+func (b *BoltStore) Usage(ctx context.Context) (Usage, error) {
+	if err := ctx.Err(); err != nil {
+		return Usage{}, err
+	}
+
+	var usage Usage
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		docs := tx.Bucket(boltDocuments)
+
+		return docs.ForEachBucket(func(docID []byte) error {
+			doc := docs.Bucket(docID)
+			usage.Documents++
+
+			if data := doc.Get(boltSnapshot); data != nil {
+				var snapshot Snapshot
+				if err := json.Unmarshal(data, &snapshot); err != nil {
+					return err
+				}
+
+				usage.Bytes += int64(len(snapshot.Content))
+			}
+
+			return doc.Bucket(boltOps).ForEach(func(k, v []byte) error {
+				op, err := decodeBoltOperation(k, v)
+				if err != nil {
+					return err
+				}
+
+				usage.Bytes += int64(operationBytes + len(op.Char) + len(op.UserID))
+
+				return nil
+			})
+		})
+	})
+
+	return usage, err
+}
+
+// DeleteDocument removes a document and all its data.
+func (b *BoltStore) DeleteDocument(ctx context.Context, docID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		docs := tx.Bucket(boltDocuments)
+
+		doc := docs.Bucket([]byte(docID))
+		if doc == nil {
+			return ErrDocumentNotFound
+		}
+
+		var meta boltMetadata
+		if err := json.Unmarshal(doc.Get(boltMeta), &meta); err != nil {
+			return err
+		}
+
+		if err := deleteSlug(tx.Bucket(boltSlugs), meta.Slug); err != nil {
+			return err
+		}
+
+		return docs.DeleteBucket([]byte(docID))
+	})
+}
+
+// ListDocuments returns the IDs of all documents, sorted.
+func (b *BoltStore) ListDocuments(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var docIDs []string
+
+	// Keys are kept sorted bytewise, like MemoryStore sorts them
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltDocuments).ForEachBucket(func(docID []byte) error {
+			docIDs = append(docIDs, string(docID))
+
+			return nil
+		})
+	})
+
+	return docIDs, err
+}
+
+// ResetDocument replaces the document's history with a snapshot at revision.
+func (b *BoltStore) ResetDocument(ctx context.Context, docID string, revision int, content string) error {
+	return b.update(ctx, docID, false, func(_ *bolt.Tx, doc *bolt.Bucket, _ *boltMetadata) error {
+		if err := doc.DeleteBucket(boltOps); err != nil {
+			return err
+		}
+
+		if _, err := doc.CreateBucket(boltOps); err != nil {
+			return err
+		}
+
+		if err := doc.Delete(boltHandoff); err != nil {
+			return err
+		}
+
+		return replaceBoltSnapshot(doc, Snapshot{DocID: docID, Revision: revision, Content: content})
+	})
+}
+
+// Ensure BoltStore implements Store.
+var _ Store = (*BoltStore)(nil)
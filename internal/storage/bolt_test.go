@@ -0,0 +1,191 @@
+package storage_test
+
+import (
+	"context"
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func openBoltStore(t *testing.T, path string) *storage.BoltStore {
+	t.Helper()
+
+	store, err := storage.OpenBoltStore(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+
+	return store
+}
+
+func TestBoltStore_Conformance(t *testing.T) {
+	t.Parallel()
+
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		return openBoltStore(t, filepath.Join(t.TempDir(), "docs.db"))
+	})
+}
+
+func TestBoltStore_Reopen(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "docs.db")
+	ctx := t.Context()
+
+	store, err := storage.OpenBoltStore(path)
+	require.NoError(t, err)
+
+	ops := []ot.SequencedOperation{
+		{Operation: ot.NewInsert("a", 0, "alice"), Revision: 1},
+		{Operation: ot.NewInsert("b", 1, "bob"), Revision: 2},
+		{Operation: ot.NewInsert("c", 2, "alice"), Revision: 3},
+	}
+
+	require.NoError(t, store.CreateDocument(ctx, "doc1"))
+	require.NoError(t, store.AppendOperations(ctx, "doc1", ops[:2]))
+	require.NoError(t, store.SaveSnapshot(ctx, "doc1", 1, "a"))
+	require.NoError(t, store.AppendOperation(storage.WithFencingToken(ctx, 5), "doc1", ops[2]))
+	require.NoError(t, store.SetSlug(ctx, "doc1", "plan"))
+	require.NoError(t, store.Close())
+
+	// Everything written before closing is there after reopening
+	store = openBoltStore(t, path)
+
+	snapshot, err := store.LoadSnapshot(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, 1, snapshot.Revision)
+	require.Equal(t, "a", snapshot.Content)
+
+	loaded, err := store.LoadOperations(ctx, "doc1", snapshot.Revision)
+	require.NoError(t, err)
+	require.Equal(t, ops[1:], loaded)
+
+	metadata, err := store.LoadMetadata(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, 2, metadata.Editors)
+	require.Equal(t, "plan", metadata.Slug)
+
+	docID, err := store.ResolveSlug(ctx, "plan")
+	require.NoError(t, err)
+	require.Equal(t, "doc1", docID)
+
+	// So is the fencing token
+	require.ErrorIs(t, store.SaveSnapshot(storage.WithFencingToken(ctx, 4), "doc1", 3, "abc"), storage.ErrFenced)
+}
+
+func TestBoltStore_AppendTwice(t *testing.T) {
+	t.Parallel()
+
+	store := openBoltStore(t, filepath.Join(t.TempDir(), "docs.db"))
+	ctx := t.Context()
+
+	require.NoError(t, store.CreateDocument(ctx, "doc1"))
+
+	ops := []ot.SequencedOperation{
+		{Operation: ot.NewInsert("a", 0, "alice"), Revision: 1},
+		{Operation: ot.NewInsert("b", 1, "alice"), Revision: 2},
+	}
+	require.NoError(t, store.AppendOperations(ctx, "doc1", ops))
+
+	// A batch retried after a crash isn't stored twice
+	require.NoError(t, store.AppendOperations(ctx, "doc1", ops[1:]))
+
+	loaded, err := store.LoadOperations(ctx, "doc1", 0)
+	require.NoError(t, err)
+	require.Equal(t, ops, loaded)
+}
+
+func TestBoltStore_Locked(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "docs.db")
+	openBoltStore(t, path)
+
+	// Only one process may use the file
+	_, err := storage.OpenBoltStore(path)
+	require.Error(t, err)
+}
+
+func TestBoltStore_Canceled(t *testing.T) {
+	t.Parallel()
+
+	store := openBoltStore(t, filepath.Join(t.TempDir(), "docs.db"))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	require.ErrorIs(t, store.CreateDocument(ctx, "doc1"), context.Canceled)
+	require.ErrorIs(t, store.CreateDocumentFromSnapshot(ctx, "doc1", "a"), context.Canceled)
+
+	exists, err := store.DocumentExists(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	_, err = store.LoadMetadata(ctx, "doc1")
+	require.ErrorIs(t, err, context.Canceled)
+	require.ErrorIs(t, store.SetSlug(ctx, "doc1", "plan"), context.Canceled)
+	require.ErrorIs(t, store.DeleteDocument(ctx, "doc1"), context.Canceled)
+
+	_, err = store.ResolveSlug(ctx, "plan")
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = store.Usage(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = store.ListDocuments(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestBoltStore_Corrupt(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "docs.db")
+	ctx := t.Context()
+
+	store, err := storage.OpenBoltStore(path)
+	require.NoError(t, err)
+	require.NoError(t, store.CreateDocument(ctx, "doc1"))
+	require.NoError(t, store.Close())
+
+	// Records that don't decode, as a damaged file or a newer version might hold
+	db, err := bolt.Open(path, 0o600, nil)
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		doc := tx.Bucket([]byte("documents")).Bucket([]byte("doc1"))
+
+		for _, key := range []string{"meta", "snapshot", "handoff"} {
+			if err := doc.Put([]byte(key), []byte("{")); err != nil {
+				return err
+			}
+		}
+
+		return doc.Bucket([]byte("ops")).Put(binary.BigEndian.AppendUint64(nil, 1), []byte("{"))
+	}))
+	require.NoError(t, db.Close())
+
+	store = openBoltStore(t, path)
+
+	_, err = store.LoadMetadata(ctx, "doc1")
+	require.Error(t, err)
+	require.Error(t, store.SetSlug(ctx, "doc1", "plan"))
+	require.Error(t, store.DeleteDocument(ctx, "doc1"))
+
+	_, err = store.LatestRevision(ctx, "doc1")
+	require.Error(t, err)
+
+	_, err = store.LoadOperations(ctx, "doc1", 0)
+	require.Error(t, err)
+
+	_, err = store.TakeHandoff(ctx, "doc1")
+	require.Error(t, err)
+
+	_, err = store.Usage(ctx)
+	require.Error(t, err)
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/serroba/online-docs/internal/ot"
+)
+
+// CompactionPolicy determines which documents a background compaction
+// snapshots, pruning the operations the snapshot covers. It complements
+// SnapshotPolicy, which only counts operations applied by open sessions,
+// so documents edited a little at a time, or not since a restart, don't
+// keep their operations forever. A zero policy compacts nothing.
+type CompactionPolicy struct {
+	// MaxOperations compacts documents with at least this many operations
+	// after their latest snapshot; 0 disables the limit.
+	MaxOperations int
+
+	// MaxAge compacts documents whose oldest operation after their latest
+	// snapshot is at least this old; 0 disables the limit. Operations
+	// stored without a timestamp never count as old.
+	MaxAge time.Duration
+}
+
+// Enabled reports whether the policy compacts any document.
+func (p CompactionPolicy) Enabled() bool {
+	return p.MaxOperations > 0 || p.MaxAge > 0
+}
+
+// Due reports whether a document whose latest snapshot is followed by ops,
+// ordered by revision, should be compacted at now.
+func (p CompactionPolicy) Due(ops []ot.SequencedOperation, now time.Time) bool {
+	if len(ops) == 0 {
+		return false
+	}
+
+	if p.MaxOperations > 0 && len(ops) >= p.MaxOperations {
+		return true
+	}
+
+	oldest := ops[0].Timestamp
+
+	return p.MaxAge > 0 && !oldest.IsZero() && now.Sub(oldest) >= p.MaxAge
+}
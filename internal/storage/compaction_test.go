@@ -0,0 +1,50 @@
+package storage_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+func TestCompactionPolicy_Due(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	// ops returns n operations, the first sequenced at oldest
+	ops := func(n int, oldest time.Time) []ot.SequencedOperation {
+		result := make([]ot.SequencedOperation, n)
+		for i := range result {
+			result[i] = ot.SequencedOperation{Revision: i + 1, Timestamp: oldest}
+		}
+
+		return result
+	}
+
+	tests := []struct {
+		name   string
+		policy storage.CompactionPolicy
+		ops    []ot.SequencedOperation
+		want   bool
+	}{
+		{"no operations", storage.CompactionPolicy{MaxOperations: 1, MaxAge: time.Second}, nil, false},
+		{"too many", storage.CompactionPolicy{MaxOperations: 3}, ops(3, now), true},
+		{"few enough", storage.CompactionPolicy{MaxOperations: 3}, ops(2, now), false},
+		{"too old", storage.CompactionPolicy{MaxAge: time.Hour}, ops(1, now.Add(-time.Hour)), true},
+		{"recent enough", storage.CompactionPolicy{MaxAge: time.Hour}, ops(1, now.Add(-time.Minute)), false},
+		{"no timestamp", storage.CompactionPolicy{MaxAge: time.Hour}, ops(1, time.Time{}), false},
+		{"disabled", storage.CompactionPolicy{}, ops(100, now.Add(-time.Hour)), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.policy.Due(tt.ops, now); got != tt.want {
+				t.Errorf("Due() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
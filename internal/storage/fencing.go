@@ -0,0 +1,21 @@
+package storage
+
+import "context"
+
+// fencingKey is the context key for fencing tokens.
+type fencingKey struct{}
+
+// WithFencingToken returns a copy of ctx carrying the fencing token of the
+// caller's document lease. Writes made with it are rejected with ErrFenced
+// once the store has accepted a write with a higher token for the document,
+// so a session that lost its lease can't overwrite its successor's work.
+func WithFencingToken(ctx context.Context, token uint64) context.Context {
+	return context.WithValue(ctx, fencingKey{}, token)
+}
+
+// FencingToken returns the fencing token carried by ctx, if any.
+func FencingToken(ctx context.Context) (uint64, bool) {
+	token, ok := ctx.Value(fencingKey{}).(uint64)
+
+	return token, ok
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// Damage describes where a document's history stops replaying.
+type Damage struct {
+	DocID    string
+	Revision int    // Last revision that replays cleanly
+	Content  string // Content as of Revision
+	Err      error  // Why replay stopped, such as ErrRevisionGap
+}
+
+// Verify replays the document's whole history, checking that the operations
+// after its snapshot have consecutive revisions and apply cleanly. If they
+// don't, it reports where replay breaks and returns true. Failing to read the
+// history is an error rather than damage.
+func (l *DocumentLoader) Verify(ctx context.Context, docID string, applyOp ApplyFunc) (Damage, bool, error) {
+	doc, revision, err := l.base(ctx, docID)
+	if err != nil {
+		return Damage{}, false, err
+	}
+
+	ops, err := l.store.LoadOperations(ctx, docID, revision)
+	if err != nil {
+		return Damage{}, false, err
+	}
+
+	damage := func(err error) (Damage, bool, error) {
+		return Damage{DocID: docID, Revision: revision, Content: doc.Content(), Err: err}, true, nil
+	}
+
+	for _, op := range ops {
+		if err := ctx.Err(); err != nil {
+			return Damage{}, false, err
+		}
+
+		if op.Revision != revision+1 {
+			return damage(fmt.Errorf("%w: revision %d follows %d", ErrRevisionGap, op.Revision, revision))
+		}
+
+		if err := applyOp(doc, newOperation(op)); err != nil {
+			return damage(fmt.Errorf("revision %d: %w", op.Revision, err))
+		}
+
+		revision = op.Revision
+	}
+
+	return Damage{}, false, nil
+}
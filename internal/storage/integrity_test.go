@@ -0,0 +1,119 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+var errBadOperation = errors.New("bad operation")
+
+// strictApplyOp appends inserted text, failing on "!".
+func strictApplyOp(doc *ot.Document, op storage.Operation) error {
+	if op.Char == "!" {
+		return errBadOperation
+	}
+
+	return doc.Apply(ot.NewInsert(op.Char, doc.Len(), ""))
+}
+
+func appendOps(t *testing.T, store storage.Store, docID string, chars map[int]string) {
+	t.Helper()
+
+	for revision := 1; revision <= 10; revision++ {
+		if char, ok := chars[revision]; ok {
+			op := ot.SequencedOperation{Operation: ot.NewInsert(char, 0, "user"), Revision: revision}
+			require.NoError(t, store.AppendOperation(t.Context(), docID, op))
+		}
+	}
+}
+
+func TestDocumentLoader_Verify(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	loader := storage.NewDocumentLoader(store)
+
+	for _, docID := range []string{"intact", "gap", "broken", "snapshotted"} {
+		require.NoError(t, store.CreateDocument(t.Context(), docID))
+	}
+
+	appendOps(t, store, "intact", map[int]string{1: "a", 2: "b"})
+	appendOps(t, store, "gap", map[int]string{1: "a", 2: "b", 4: "d"})
+	appendOps(t, store, "broken", map[int]string{1: "a", 2: "!", 3: "c"})
+	require.NoError(t, store.SaveSnapshot(t.Context(), "snapshotted", 5, "hello"))
+	appendOps(t, store, "snapshotted", map[int]string{6: "!"})
+
+	_, damaged, err := loader.Verify(t.Context(), "intact", strictApplyOp)
+	require.NoError(t, err)
+	require.False(t, damaged)
+
+	damage, damaged, err := loader.Verify(t.Context(), "gap", strictApplyOp)
+	require.NoError(t, err)
+	require.True(t, damaged)
+	require.ErrorIs(t, damage.Err, storage.ErrRevisionGap)
+	require.Equal(t, storage.Damage{DocID: "gap", Revision: 2, Content: "ab", Err: damage.Err}, damage)
+
+	damage, damaged, err = loader.Verify(t.Context(), "broken", strictApplyOp)
+	require.NoError(t, err)
+	require.True(t, damaged)
+	require.ErrorIs(t, damage.Err, errBadOperation)
+	require.Equal(t, 1, damage.Revision)
+
+	// Replay starts from the snapshot
+	damage, damaged, err = loader.Verify(t.Context(), "snapshotted", strictApplyOp)
+	require.NoError(t, err)
+	require.True(t, damaged)
+	require.Equal(t, 5, damage.Revision)
+	require.Equal(t, "hello", damage.Content)
+
+	_, _, err = loader.Verify(t.Context(), "missing", strictApplyOp)
+	require.ErrorIs(t, err, storage.ErrDocumentNotFound)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	_, _, err = loader.Verify(ctx, "intact", strictApplyOp)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestDocumentLoader_Verify_StoreErrors(t *testing.T) {
+	t.Parallel()
+
+	storeErr := errors.New("store unavailable")
+
+	for _, store := range []*errorStore{{loadSnapshotErr: storeErr}, {loadOpsErr: storeErr}} {
+		_, _, err := storage.NewDocumentLoader(store).Verify(t.Context(), "doc1", strictApplyOp)
+		require.ErrorIs(t, err, storeErr)
+	}
+}
+
+func TestMemoryStore_ResetDocument(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc2"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	appendOps(t, store, "doc1", map[int]string{1: "a", 2: "b", 4: "d"})
+
+	ids, err := store.ListDocuments(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, []string{"doc1", "doc2"}, ids)
+
+	require.NoError(t, store.ResetDocument(t.Context(), "doc1", 2, "ab"))
+
+	result, err := storage.NewDocumentLoader(store).Load(t.Context(), "doc1", strictApplyOp)
+	require.NoError(t, err)
+	require.Equal(t, "ab", result.Content)
+	require.Equal(t, 2, result.Revision)
+
+	revision, err := store.LatestRevision(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.Equal(t, 2, revision)
+
+	require.ErrorIs(t, store.ResetDocument(t.Context(), "missing", 0, ""), storage.ErrDocumentNotFound)
+}
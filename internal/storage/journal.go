@@ -0,0 +1,754 @@
+package storage
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/serroba/online-docs/internal/ot"
+)
+
+// Kinds of journal records.
+const (
+	journalCreate     = "create"
+	journalSnapshot   = "snapshot"
+	journalOperations = "operations"
+	journalReset      = "reset"
+	journalDelete     = "delete"
+	journalTags       = "tags"
+	journalTitle      = "title"
+	journalProperties = "properties"
+	journalArchived   = "archived"
+	journalSlug       = "slug"
+	journalHandoff    = "handoff"
+	journalTake       = "take"
+	journalAbort      = "abort" // The write recorded as Seq failed
+)
+
+// journalMetadata are the kinds of records setting a document's metadata,
+// in the order they're replayed.
+var journalMetadata = []string{journalTags, journalTitle, journalProperties, journalArchived}
+
+// journalCompactSize is the least size the journal must grow to before it's
+// compacted while open. It's compacted whenever it has doubled since the
+// last compaction.
+const journalCompactSize = 64 << 20
+
+// journalRecord is a line of the journal file.
+type journalRecord struct {
+	Kind       string
+	DocID      string
+	Seq        int                     `json:",omitempty"` // Written while its write is pending
+	Revision   int                     `json:",omitempty"`
+	Content    string                  `json:",omitempty"`
+	Formatting []ot.Mark               `json:",omitempty"`
+	Ops        []ot.SequencedOperation `json:",omitempty"`
+	Tags       []string                `json:",omitempty"`
+	Properties map[string]string       `json:",omitempty"`
+	Archived   bool                    `json:",omitempty"`
+	Handoff    *Handoff                `json:",omitempty"`
+}
+
+// Journal is a Store that writes ahead every change to a document in an
+// append-only file, synced to disk before the change is handed to the store
+// it wraps, so an operation is durable by the time its sender is
+// acknowledged even when that store keeps documents in memory. Opening a
+// journal replays it into the store, restoring what a crash or restart lost.
+//
+// A change the wrapped store rejects is followed by an abort record, so it
+// isn't replayed. The journal is compacted as it's opened, and again
+// whenever it has doubled in size while open.
+type Journal struct {
+	Store
+
+	path string
+
+	mu        sync.Mutex // Serializes appends to file
+	file      *os.File
+	size      int64               // Length of the records written so far
+	compactAt int64               // Size at which the journal is next compacted
+	seq       int                 // Seq of the last record written
+	pending   map[int]int64       // Offsets of records whose writes are in progress, by Seq
+	handoffs  map[string]struct{} // Documents with a journaled handoff
+}
+
+// OpenJournal replays the journal at path into store, creating the file if
+// needed, and returns a Journal writing store's changes ahead to it. A
+// record cut short by a crash at the end of the file is dropped, as its
+// write never reached the store. The journal is compacted as it's opened,
+// keeping for each document only its latest snapshot, the operations after
+// it, its metadata and any handoff.
+func OpenJournal(ctx context.Context, store Store, path string) (*Journal, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	recs, err := parseJournal(path, data)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := foldJournal(recs)
+
+	for _, doc := range docs {
+		if err := doc.replay(ctx, store); err != nil {
+			return nil, fmt.Errorf("replay journal for %s: %w", doc.id, err)
+		}
+	}
+
+	if err := replaySlugs(ctx, store, docs); err != nil {
+		return nil, err
+	}
+
+	j := &Journal{
+		Store:    store,
+		path:     path,
+		pending:  make(map[int]int64),
+		handoffs: make(map[string]struct{}),
+	}
+
+	for _, doc := range docs {
+		if doc.handoff != nil {
+			j.handoffs[doc.id] = struct{}{}
+		}
+	}
+
+	if err := j.rewrite(docs, nil); err != nil {
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// Close closes the journal's file. It doesn't close the wrapped store.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.file.Close()
+}
+
+// Compact rewrites the journal with just the records that recreate its
+// documents. Records of writes still in progress are kept as they are.
+func (j *Journal) Compact() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.compact()
+}
+
+// CreateDocument records the document and creates it.
+func (j *Journal) CreateDocument(ctx context.Context, docID string) error {
+	return j.write(journalRecord{Kind: journalCreate, DocID: docID}, func() error {
+		return j.Store.CreateDocument(ctx, docID)
+	})
+}
+
+// CreateDocumentFromSnapshot records the document with its snapshot and
+// creates it.
+func (j *Journal) CreateDocumentFromSnapshot(ctx context.Context, docID, content string) error {
+	return j.write(journalRecord{Kind: journalCreate, DocID: docID, Content: content}, func() error {
+		return j.Store.CreateDocumentFromSnapshot(ctx, docID, content)
+	})
+}
+
+// SaveSnapshot records the snapshot and saves it.
+func (j *Journal) SaveSnapshot(ctx context.Context, docID string, revision int, content string) error {
+	return j.SaveFormattedSnapshot(ctx, docID, revision, content, nil)
+}
+
+// SaveFormattedSnapshot records the snapshot with its formatting and saves it.
+func (j *Journal) SaveFormattedSnapshot(
+	ctx context.Context, docID string, revision int, content string, formatting []ot.Mark,
+) error {
+	rec := journalRecord{Kind: journalSnapshot, DocID: docID, Revision: revision, Content: content, Formatting: formatting}
+
+	return j.write(rec, func() error {
+		return j.Store.SaveFormattedSnapshot(ctx, docID, revision, content, formatting)
+	})
+}
+
+// AppendOperation records the operation and appends it.
+func (j *Journal) AppendOperation(ctx context.Context, docID string, op ot.SequencedOperation) error {
+	return j.AppendOperations(ctx, docID, []ot.SequencedOperation{op})
+}
+
+// AppendOperations records the operations in one write and appends them.
+func (j *Journal) AppendOperations(ctx context.Context, docID string, ops []ot.SequencedOperation) error {
+	return j.write(journalRecord{Kind: journalOperations, DocID: docID, Ops: ops}, func() error {
+		return j.Store.AppendOperations(ctx, docID, ops)
+	})
+}
+
+// ResetDocument records the reset and resets the document.
+func (j *Journal) ResetDocument(ctx context.Context, docID string, revision int, content string) error {
+	rec := journalRecord{Kind: journalReset, DocID: docID, Revision: revision, Content: content}
+
+	return j.write(rec, func() error {
+		return j.Store.ResetDocument(ctx, docID, revision, content)
+	})
+}
+
+// DeleteDocument records the deletion and deletes the document.
+func (j *Journal) DeleteDocument(ctx context.Context, docID string) error {
+	return j.write(journalRecord{Kind: journalDelete, DocID: docID}, func() error {
+		return j.Store.DeleteDocument(ctx, docID)
+	})
+}
+
+// SetTags records the tags and sets them.
+func (j *Journal) SetTags(ctx context.Context, docID string, tags []string) error {
+	return j.write(journalRecord{Kind: journalTags, DocID: docID, Tags: tags}, func() error {
+		return j.Store.SetTags(ctx, docID, tags)
+	})
+}
+
+// SetTitle records the title and sets it.
+func (j *Journal) SetTitle(ctx context.Context, docID, title string) error {
+	return j.write(journalRecord{Kind: journalTitle, DocID: docID, Content: title}, func() error {
+		return j.Store.SetTitle(ctx, docID, title)
+	})
+}
+
+// SetProperties records the properties and sets them.
+func (j *Journal) SetProperties(ctx context.Context, docID string, properties map[string]string) error {
+	return j.write(journalRecord{Kind: journalProperties, DocID: docID, Properties: properties}, func() error {
+		return j.Store.SetProperties(ctx, docID, properties)
+	})
+}
+
+// UpdateDetails records the title and properties the update sets, as a
+// title record and a properties record, and updates them. If the update
+// fails, both records are aborted.
+func (j *Journal) UpdateDetails(ctx context.Context, docID string, update DetailsUpdate) error {
+	apply := func() error { return j.Store.UpdateDetails(ctx, docID, update) }
+
+	if update.Properties != nil {
+		rec := journalRecord{Kind: journalProperties, DocID: docID, Properties: update.Properties}
+		next := apply
+		apply = func() error { return j.write(rec, next) }
+	}
+
+	if update.Title != nil {
+		rec := journalRecord{Kind: journalTitle, DocID: docID, Content: *update.Title}
+		next := apply
+		apply = func() error { return j.write(rec, next) }
+	}
+
+	return apply()
+}
+
+// SetArchived records the archive flag and sets it.
+func (j *Journal) SetArchived(ctx context.Context, docID string, archived bool) error {
+	return j.write(journalRecord{Kind: journalArchived, DocID: docID, Archived: archived}, func() error {
+		return j.Store.SetArchived(ctx, docID, archived)
+	})
+}
+
+// SetSlug records the slug and sets it.
+func (j *Journal) SetSlug(ctx context.Context, docID, slug string) error {
+	return j.write(journalRecord{Kind: journalSlug, DocID: docID, Content: slug}, func() error {
+		return j.Store.SetSlug(ctx, docID, slug)
+	})
+}
+
+// SaveHandoff records the handoff and saves it.
+func (j *Journal) SaveHandoff(ctx context.Context, handoff Handoff) error {
+	return j.write(journalRecord{Kind: journalHandoff, DocID: handoff.DocID, Handoff: &handoff}, func() error {
+		return j.Store.SaveHandoff(ctx, handoff)
+	})
+}
+
+// TakeHandoff records that the handoff was taken and takes it. Documents
+// without a journaled handoff are looked up without writing a record, as
+// there's nothing to replay.
+func (j *Journal) TakeHandoff(ctx context.Context, docID string) (Handoff, error) {
+	j.mu.Lock()
+	_, journaled := j.handoffs[docID]
+	j.mu.Unlock()
+
+	if !journaled {
+		return j.Store.TakeHandoff(ctx, docID)
+	}
+
+	var handoff Handoff
+
+	err := j.write(journalRecord{Kind: journalTake, DocID: docID}, func() error {
+		var err error
+
+		handoff, err = j.Store.TakeHandoff(ctx, docID)
+
+		return err
+	})
+
+	return handoff, err
+}
+
+// write records rec, then makes the change with apply. If apply fails, an
+// abort record keeps the change from being replayed.
+func (j *Journal) write(rec journalRecord, apply func() error) error {
+	seq, err := j.record(rec)
+	if err != nil {
+		return err
+	}
+
+	return j.finish(seq, apply())
+}
+
+// record appends rec to the file as a pending write and syncs it to disk,
+// returning its Seq.
+func (j *Journal) record(rec journalRecord) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	rec.Seq = j.seq + 1
+
+	offset := j.size
+	if err := j.append(rec); err != nil {
+		return 0, err
+	}
+
+	j.seq = rec.Seq
+	j.pending[rec.Seq] = offset
+
+	switch rec.Kind {
+	case journalHandoff:
+		j.handoffs[rec.DocID] = struct{}{}
+	case journalCreate, journalReset, journalDelete, journalTake:
+		delete(j.handoffs, rec.DocID)
+	}
+
+	return rec.Seq, nil
+}
+
+// finish ends the pending write seq, which failed with err if it isn't nil,
+// and compacts the journal once it has grown enough.
+func (j *Journal) finish(seq int, err error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	delete(j.pending, seq)
+
+	if err != nil {
+		if abortErr := j.append(journalRecord{Kind: journalAbort, Seq: seq}); abortErr != nil {
+			return errors.Join(err, abortErr)
+		}
+
+		return err
+	}
+
+	if j.size >= j.compactAt {
+		// The write succeeded, so a failed compaction is only retried later
+		if compactErr := j.compact(); compactErr != nil {
+			j.compactAt = 2 * j.size
+		}
+	}
+
+	return nil
+}
+
+// append writes rec to the file and syncs it. Must be called with mu held.
+func (j *Journal) append(rec journalRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	n, err := j.file.Write(append(line, '\n'))
+	if err == nil {
+		err = j.file.Sync()
+	}
+
+	if err != nil {
+		// Drop what was written, so later records don't follow a torn one
+		_ = j.file.Truncate(j.size)
+
+		return fmt.Errorf("write journal: %w", err)
+	}
+
+	j.size += int64(n)
+
+	return nil
+}
+
+// compact rewrites the journal, folding the records before the first
+// pending one and keeping the rest as they are. Must be called with mu held.
+func (j *Journal) compact() error {
+	data, err := os.ReadFile(j.path)
+	if err != nil {
+		return fmt.Errorf("compact journal: %w", err)
+	}
+
+	data = data[:j.size]
+
+	cut := j.size
+	for _, offset := range j.pending {
+		cut = min(cut, offset)
+	}
+
+	prefix, err := parseJournal(j.path, data[:cut])
+	if err != nil {
+		return err
+	}
+
+	tail, err := parseJournal(j.path, data[cut:])
+	if err != nil {
+		return err
+	}
+
+	// Writes before cut can be aborted after it
+	for _, rec := range tail {
+		if rec.Kind == journalAbort {
+			prefix = slices.DeleteFunc(prefix, func(r journalRecord) bool { return r.Seq == rec.Seq })
+		}
+	}
+
+	return j.rewrite(foldJournal(prefix), data[cut:])
+}
+
+// rewrite replaces the journal with the records that recreate docs,
+// followed by tail, and reopens it. The new file is synced before it
+// replaces the old one, so a crash leaves one or the other. Must be called
+// with mu held, or before the journal is shared.
+func (j *Journal) rewrite(docs []*journalDocument, tail []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }() // Fails once renamed
+
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+
+	for _, doc := range docs {
+		for _, rec := range doc.records() {
+			if err := encoder.Encode(rec); err != nil {
+				_ = tmp.Close()
+
+				return err
+			}
+		}
+	}
+
+	folded := int64(buf.Len())
+	buf.Write(tail)
+
+	_, err = tmp.Write(buf.Bytes())
+
+	if err := errors.Join(err, tmp.Sync(), tmp.Close()); err != nil {
+		return fmt.Errorf("compact journal: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), j.path); err != nil {
+		return fmt.Errorf("compact journal: %w", err)
+	}
+
+	if err := syncDir(filepath.Dir(j.path)); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if j.file != nil {
+		_ = j.file.Close()
+	}
+
+	// Pending records moved by as much as the records before them shrank
+	shift := folded - (j.size - int64(len(tail)))
+	for seq, offset := range j.pending {
+		j.pending[seq] = offset + shift
+	}
+
+	j.file = file
+	j.size = folded + int64(len(tail))
+	j.compactAt = max(journalCompactSize, 2*j.size)
+
+	return nil
+}
+
+// journalDocument is what the journal holds for a document once its
+// records are folded.
+type journalDocument struct {
+	id       string
+	created  bool                     // Whether the document was created while journaled
+	base     *journalRecord           // Latest snapshot or reset, if any
+	ops      []ot.SequencedOperation  // Operations after base, ordered by revision
+	metadata map[string]journalRecord // Latest record of each kind of metadata set
+	slug     *journalRecord           // Latest slug set, if any
+	handoff  *journalRecord           // Handoff not yet taken, if any
+}
+
+// apply folds a record for the document into it.
+func (d *journalDocument) apply(rec journalRecord) {
+	switch rec.Kind {
+	case journalCreate:
+		*d = journalDocument{id: d.id, created: true}
+
+		if rec.Content != "" {
+			// Created from a snapshot
+			d.base = &journalRecord{Kind: journalSnapshot, DocID: d.id, Content: rec.Content}
+		}
+	case journalSnapshot:
+		// A snapshot can be saved concurrently with an older one
+		if d.base != nil && d.base.Revision > rec.Revision {
+			return
+		}
+
+		d.base = &rec
+		d.ops = slices.DeleteFunc(d.ops, func(op ot.SequencedOperation) bool { return op.Revision <= rec.Revision })
+	case journalReset:
+		d.base = &rec
+		d.ops = nil
+		d.handoff = nil
+	case journalOperations:
+		for _, op := range rec.Ops {
+			if d.base == nil || op.Revision > d.base.Revision {
+				d.ops = append(d.ops, op)
+			}
+		}
+	case journalTags, journalTitle, journalProperties, journalArchived:
+		if d.metadata == nil {
+			d.metadata = make(map[string]journalRecord)
+		}
+
+		d.metadata[rec.Kind] = rec
+	case journalSlug:
+		d.slug = &rec
+	case journalHandoff:
+		d.handoff = &rec
+	case journalTake:
+		d.handoff = nil
+	}
+}
+
+// replay brings store's copy of the document up to date with the journal.
+// Snapshots and operations the store already holds are skipped, so a
+// durable store isn't set back. Slugs are replayed by replaySlugs.
+func (d *journalDocument) replay(ctx context.Context, store Store) error {
+	if d.created {
+		if err := store.CreateDocument(ctx, d.id); err != nil && !errors.Is(err, ErrDocumentExists) {
+			return err
+		}
+	}
+
+	latest, err := store.LatestRevision(ctx, d.id)
+	if errors.Is(err, ErrDocumentNotFound) {
+		// Removed from the store while it wasn't journaled
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case d.base == nil:
+	case d.base.Kind == journalReset:
+		if err := store.ResetDocument(ctx, d.id, d.base.Revision, d.base.Content); err != nil {
+			return err
+		}
+
+		latest = d.base.Revision
+	case d.base.Revision >= latest:
+		err := store.SaveFormattedSnapshot(ctx, d.id, d.base.Revision, d.base.Content, d.base.Formatting)
+		if err != nil {
+			return err
+		}
+
+		latest = d.base.Revision
+	}
+
+	ops := slices.DeleteFunc(slices.Clone(d.ops), func(op ot.SequencedOperation) bool { return op.Revision <= latest })
+	if len(ops) > 0 {
+		if err := store.AppendOperations(ctx, d.id, ops); err != nil {
+			return err
+		}
+	}
+
+	if err := d.replayMetadata(ctx, store); err != nil {
+		return err
+	}
+
+	if d.handoff != nil {
+		return store.SaveHandoff(ctx, *d.handoff.Handoff)
+	}
+
+	return nil
+}
+
+// replayMetadata sets the document's metadata to what was last journaled.
+func (d *journalDocument) replayMetadata(ctx context.Context, store Store) error {
+	for _, kind := range journalMetadata {
+		rec, ok := d.metadata[kind]
+		if !ok {
+			continue
+		}
+
+		var err error
+
+		switch kind {
+		case journalTags:
+			err = store.SetTags(ctx, d.id, rec.Tags)
+		case journalTitle:
+			err = store.SetTitle(ctx, d.id, rec.Content)
+		case journalProperties:
+			err = store.SetProperties(ctx, d.id, rec.Properties)
+		case journalArchived:
+			err = store.SetArchived(ctx, d.id, rec.Archived)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// replaySlugs sets the slugs last journaled for docs. Slugs are removed
+// before any are given, as one may have moved between documents.
+func replaySlugs(ctx context.Context, store Store, docs []*journalDocument) error {
+	for _, clearing := range []bool{true, false} {
+		for _, doc := range docs {
+			if doc.slug == nil || (doc.slug.Content == "") != clearing {
+				continue
+			}
+
+			err := store.SetSlug(ctx, doc.id, doc.slug.Content)
+			if err != nil && !errors.Is(err, ErrDocumentNotFound) {
+				return fmt.Errorf("replay journal for %s: %w", doc.id, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// records returns the records that recreate the document.
+func (d *journalDocument) records() []journalRecord {
+	var recs []journalRecord
+
+	if d.created {
+		recs = append(recs, journalRecord{Kind: journalCreate, DocID: d.id})
+	}
+
+	if d.base != nil {
+		recs = append(recs, *d.base)
+	}
+
+	if len(d.ops) > 0 {
+		recs = append(recs, journalRecord{Kind: journalOperations, DocID: d.id, Ops: d.ops})
+	}
+
+	for _, kind := range journalMetadata {
+		if rec, ok := d.metadata[kind]; ok {
+			recs = append(recs, rec)
+		}
+	}
+
+	for _, rec := range []*journalRecord{d.slug, d.handoff} {
+		if rec != nil {
+			recs = append(recs, *rec)
+		}
+	}
+
+	// Folded records aren't pending, so they need no Seq
+	for i := range recs {
+		recs[i].Seq = 0
+	}
+
+	return recs
+}
+
+// parseJournal parses the records of the journal at path, read as data.
+// Anything after the last newline is a record a crash cut short, and is
+// dropped.
+func parseJournal(path string, data []byte) ([]journalRecord, error) {
+	var recs []journalRecord
+
+	for n := 1; ; n++ {
+		line, rest, found := bytes.Cut(data, []byte{'\n'})
+		if !found {
+			return recs, nil
+		}
+
+		var rec journalRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, fmt.Errorf("journal %s line %d: %w", path, n, err)
+		}
+
+		recs = append(recs, rec)
+		data = rest
+	}
+}
+
+// foldJournal folds recs into the documents they hold, in the order they
+// first appear. Records of writes that were aborted are skipped.
+func foldJournal(recs []journalRecord) []*journalDocument {
+	aborted := make(map[int]bool)
+
+	for _, rec := range recs {
+		if rec.Kind == journalAbort {
+			aborted[rec.Seq] = true
+		}
+	}
+
+	var (
+		order []*journalDocument
+		docs  = make(map[string]*journalDocument)
+	)
+
+	for _, rec := range recs {
+		if rec.Kind == journalAbort || (rec.Seq != 0 && aborted[rec.Seq]) {
+			continue
+		}
+
+		doc := docs[rec.DocID]
+		if doc == nil {
+			doc = &journalDocument{id: rec.DocID}
+			docs[rec.DocID] = doc
+			order = append(order, doc)
+		}
+
+		if rec.Kind == journalDelete {
+			delete(docs, rec.DocID)
+			order = slices.DeleteFunc(order, func(d *journalDocument) bool { return d == doc })
+
+			continue
+		}
+
+		doc.apply(rec)
+	}
+
+	for _, doc := range order {
+		slices.SortStableFunc(doc.ops, func(a, b ot.SequencedOperation) int { return cmp.Compare(a.Revision, b.Revision) })
+	}
+
+	return order
+}
+
+// syncDir syncs a directory, making a rename in it durable.
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = dir.Close() }()
+
+	return dir.Sync()
+}
+
+// Ensure Journal implements Store.
+var _ Store = (*Journal)(nil)
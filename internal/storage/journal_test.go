@@ -0,0 +1,477 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+func openJournal(t *testing.T, store storage.Store, path string) *storage.Journal {
+	t.Helper()
+
+	journal, err := storage.OpenJournal(t.Context(), store, path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = journal.Close() })
+
+	return journal
+}
+
+func TestJournal_Conformance(t *testing.T) {
+	t.Parallel()
+
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		return openJournal(t, storage.NewMemoryStore(), filepath.Join(t.TempDir(), "docs.journal"))
+	})
+}
+
+func TestJournal_Replay(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "docs.journal")
+	ctx := t.Context()
+
+	journal, err := storage.OpenJournal(ctx, storage.NewMemoryStore(), path)
+	require.NoError(t, err)
+
+	ops := []ot.SequencedOperation{
+		{Operation: ot.NewInsert("a", 0, "alice"), Revision: 1},
+		{Operation: ot.NewInsert("b", 1, "bob"), Revision: 2},
+		{Operation: ot.NewInsert("c", 2, "alice"), Revision: 3},
+	}
+
+	formatting := []ot.Mark{{Start: 0, End: 1, Attributes: ot.Attributes{"bold": "true"}}}
+
+	require.NoError(t, journal.CreateDocument(ctx, "doc1"))
+	require.NoError(t, journal.AppendOperations(ctx, "doc1", ops[:2]))
+	require.NoError(t, journal.SaveFormattedSnapshot(ctx, "doc1", 2, "ab", formatting))
+	require.NoError(t, journal.AppendOperation(ctx, "doc1", ops[2]))
+	require.NoError(t, journal.CreateDocument(ctx, "doc2"))
+	require.NoError(t, journal.ResetDocument(ctx, "doc2", 7, "reset"))
+	require.NoError(t, journal.CreateDocument(ctx, "doc3"))
+	require.NoError(t, journal.DeleteDocument(ctx, "doc3"))
+	require.NoError(t, journal.CreateDocumentFromSnapshot(ctx, "doc4", "copied"))
+	require.NoError(t, journal.Close())
+
+	// A write cut short by a crash is dropped
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"Kind":"operations","DocID":"doc1","Ops":[{"Ty`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	// Everything acknowledged before the crash is replayed into an empty store
+	store := storage.NewMemoryStore()
+	journal = openJournal(t, store, path)
+
+	docIDs, err := store.ListDocuments(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"doc1", "doc2", "doc4"}, docIDs)
+
+	snapshot, err := store.LoadSnapshot(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, 2, snapshot.Revision)
+	require.Equal(t, "ab", snapshot.Content)
+	require.Equal(t, formatting, snapshot.Formatting)
+
+	loaded, err := store.LoadOperations(ctx, "doc1", 2)
+	require.NoError(t, err)
+	require.Equal(t, ops[2:], loaded)
+
+	snapshot, err = store.LoadSnapshot(ctx, "doc2")
+	require.NoError(t, err)
+	require.Equal(t, 7, snapshot.Revision)
+	require.Equal(t, "reset", snapshot.Content)
+
+	snapshot, err = store.LoadSnapshot(ctx, "doc4")
+	require.NoError(t, err)
+	require.Equal(t, 0, snapshot.Revision)
+	require.Equal(t, "copied", snapshot.Content)
+
+	// The reopened journal keeps recording, after the compacted records
+	require.NoError(t, journal.AppendOperation(ctx, "doc2",
+		ot.SequencedOperation{Operation: ot.NewInsert("!", 5, "alice"), Revision: 8}))
+	require.NoError(t, journal.Close())
+
+	store = storage.NewMemoryStore()
+	openJournal(t, store, path)
+
+	revision, err := store.LatestRevision(ctx, "doc2")
+	require.NoError(t, err)
+	require.Equal(t, 8, revision)
+}
+
+func TestJournal_ReplayKeepsNewerState(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "docs.journal")
+	ctx := t.Context()
+
+	// A durable store already holds what the journal recorded, and more
+	store := openBoltStore(t, filepath.Join(t.TempDir(), "docs.db"))
+	journal, err := storage.OpenJournal(ctx, store, path)
+	require.NoError(t, err)
+
+	require.NoError(t, journal.CreateDocument(ctx, "doc1"))
+	require.NoError(t, journal.SaveSnapshot(ctx, "doc1", 1, "a"))
+	require.NoError(t, journal.Close())
+	require.NoError(t, store.SaveSnapshot(ctx, "doc1", 4, "abcd"))
+
+	openJournal(t, store, path)
+
+	snapshot, err := store.LoadSnapshot(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, 4, snapshot.Revision)
+	require.Equal(t, "abcd", snapshot.Content)
+}
+
+func TestJournal_Corrupt(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "docs.journal")
+	require.NoError(t, os.WriteFile(path, []byte("not json\n"+`{"Kind":"create","DocID":"doc1"}`+"\n"), 0o600))
+
+	// Only the last record can be torn; anything else needs looking at
+	_, err := storage.OpenJournal(t.Context(), storage.NewMemoryStore(), path)
+	require.ErrorContains(t, err, "line 1")
+}
+
+// failingReplayStore is a MemoryStore whose method named fail errors, and
+// which forgets the document "gone".
+type failingReplayStore struct {
+	*storage.MemoryStore
+
+	fail string
+}
+
+func (s failingReplayStore) err(method string) error {
+	if s.fail == method {
+		return errors.New(method + " failed")
+	}
+
+	return nil
+}
+
+func (s failingReplayStore) CreateDocument(ctx context.Context, docID string) error {
+	return errors.Join(s.err("CreateDocument"), s.MemoryStore.CreateDocument(ctx, docID))
+}
+
+func (s failingReplayStore) LatestRevision(ctx context.Context, docID string) (int, error) {
+	if docID == "gone" {
+		return 0, storage.ErrDocumentNotFound
+	}
+
+	if err := s.err("LatestRevision"); err != nil {
+		return 0, err
+	}
+
+	return s.MemoryStore.LatestRevision(ctx, docID)
+}
+
+func (s failingReplayStore) ResetDocument(ctx context.Context, docID string, revision int, content string) error {
+	return errors.Join(s.err("ResetDocument"), s.MemoryStore.ResetDocument(ctx, docID, revision, content))
+}
+
+func (s failingReplayStore) SaveFormattedSnapshot(
+	ctx context.Context, docID string, revision int, content string, formatting []ot.Mark,
+) error {
+	if err := s.err("SaveFormattedSnapshot"); err != nil {
+		return err
+	}
+
+	return s.MemoryStore.SaveFormattedSnapshot(ctx, docID, revision, content, formatting)
+}
+
+func (s failingReplayStore) AppendOperations(ctx context.Context, docID string, ops []ot.SequencedOperation) error {
+	return errors.Join(s.err("AppendOperations"), s.MemoryStore.AppendOperations(ctx, docID, ops))
+}
+
+func (s failingReplayStore) SetTags(ctx context.Context, docID string, tags []string) error {
+	return errors.Join(s.err("SetTags"), s.MemoryStore.SetTags(ctx, docID, tags))
+}
+
+func (s failingReplayStore) SaveHandoff(ctx context.Context, handoff storage.Handoff) error {
+	return errors.Join(s.err("SaveHandoff"), s.MemoryStore.SaveHandoff(ctx, handoff))
+}
+
+func (s failingReplayStore) SetSlug(ctx context.Context, docID, slug string) error {
+	return errors.Join(s.err("SetSlug"), s.MemoryStore.SetSlug(ctx, docID, slug))
+}
+
+func TestJournal_ReplayFails(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "docs.journal")
+	ctx := t.Context()
+
+	journal := openJournal(t, storage.NewMemoryStore(), path)
+
+	for _, docID := range []string{"doc1", "doc2", "gone"} {
+		require.NoError(t, journal.CreateDocument(ctx, docID))
+	}
+
+	require.NoError(t, journal.SaveSnapshot(ctx, "doc1", 1, "a"))
+	require.NoError(t, journal.AppendOperation(ctx, "doc1",
+		ot.SequencedOperation{Operation: ot.NewInsert("b", 1, "alice"), Revision: 2}))
+	require.NoError(t, journal.SetTags(ctx, "doc1", []string{"plans"}))
+	require.NoError(t, journal.SetSlug(ctx, "doc1", "plans"))
+	require.NoError(t, journal.SaveHandoff(ctx, storage.Handoff{DocID: "doc1", Revision: 2, Content: "ab"}))
+	require.NoError(t, journal.ResetDocument(ctx, "doc2", 3, "reset"))
+	require.NoError(t, journal.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	methods := []string{
+		"CreateDocument", "LatestRevision", "ResetDocument", "SaveFormattedSnapshot", "AppendOperations", "SetTags",
+		"SaveHandoff", "SetSlug",
+	}
+
+	for _, method := range methods {
+		t.Run(method, func(t *testing.T) {
+			t.Parallel()
+
+			// Each replay compacts the journal, so each gets its own copy
+			copied := filepath.Join(t.TempDir(), "docs.journal")
+			require.NoError(t, os.WriteFile(copied, data, 0o600))
+
+			store := failingReplayStore{MemoryStore: storage.NewMemoryStore(), fail: method}
+			_, err := storage.OpenJournal(ctx, store, copied)
+			require.ErrorContains(t, err, method+" failed")
+			require.ErrorContains(t, err, "replay journal for doc")
+		})
+	}
+
+	// Documents the store no longer has are skipped
+	store := failingReplayStore{MemoryStore: storage.NewMemoryStore()}
+	openJournal(t, store, path)
+
+	exists, err := store.DocumentExists(ctx, "doc2")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	_, err = storage.OpenJournal(ctx, storage.NewMemoryStore(), t.TempDir())
+	require.Error(t, err)
+}
+
+func TestJournal_Closed(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "docs.journal")
+	store := storage.NewMemoryStore()
+
+	journal, err := storage.OpenJournal(t.Context(), store, path)
+	require.NoError(t, err)
+	require.NoError(t, journal.Close())
+
+	// Nothing is written to the store that isn't journaled first
+	require.ErrorContains(t, journal.CreateDocument(t.Context(), "doc1"), "write journal")
+
+	exists, err := store.DocumentExists(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// Compacting reads the file it rewrites
+	require.NoError(t, os.Remove(path))
+	require.ErrorContains(t, journal.Compact(), "compact journal")
+}
+
+func TestJournal_ReplayMetadata(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "docs.journal")
+	ctx := t.Context()
+
+	journal, err := storage.OpenJournal(ctx, storage.NewMemoryStore(), path)
+	require.NoError(t, err)
+
+	require.NoError(t, journal.CreateDocument(ctx, "doc1"))
+	require.NoError(t, journal.CreateDocument(ctx, "doc2"))
+	require.NoError(t, journal.SetTags(ctx, "doc1", []string{"plans"}))
+	require.NoError(t, journal.SetTitle(ctx, "doc1", "Plans"))
+	require.NoError(t, journal.SetProperties(ctx, "doc1", map[string]string{"team": "docs"}))
+	require.NoError(t, journal.SetArchived(ctx, "doc1", true))
+	require.NoError(t, journal.SaveHandoff(ctx, storage.Handoff{DocID: "doc1", Revision: 0}))
+
+	// A slug moved to another document is replayed on the last one
+	require.NoError(t, journal.SetSlug(ctx, "doc2", "plans"))
+	require.NoError(t, journal.SetSlug(ctx, "doc2", ""))
+	require.NoError(t, journal.SetSlug(ctx, "doc1", "plans"))
+	require.NoError(t, journal.SaveHandoff(ctx, storage.Handoff{DocID: "doc2", Revision: 0}))
+	_, err = journal.TakeHandoff(ctx, "doc2")
+	require.NoError(t, err)
+	require.NoError(t, journal.Close())
+
+	store := storage.NewMemoryStore()
+	openJournal(t, store, path)
+
+	meta, err := store.LoadMetadata(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"plans"}, meta.Tags)
+	require.Equal(t, "Plans", meta.Title)
+	require.Equal(t, map[string]string{"team": "docs"}, meta.Properties)
+	require.False(t, meta.ArchivedAt.IsZero())
+
+	docID, err := store.ResolveSlug(ctx, "plans")
+	require.NoError(t, err)
+	require.Equal(t, "doc1", docID)
+
+	_, err = store.TakeHandoff(ctx, "doc1")
+	require.NoError(t, err)
+
+	_, err = store.TakeHandoff(ctx, "doc2")
+	require.ErrorIs(t, err, storage.ErrHandoffNotFound)
+}
+
+func TestJournal_ReplayDetails(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "docs.journal")
+	ctx := t.Context()
+
+	journal, err := storage.OpenJournal(ctx, storage.NewMemoryStore(), path)
+	require.NoError(t, err)
+
+	title := "Plans"
+	require.NoError(t, journal.CreateDocument(ctx, "doc1"))
+	require.NoError(t, journal.UpdateDetails(ctx, "doc1", storage.DetailsUpdate{
+		Title: &title, Properties: map[string]string{"team": "docs"}, Based: &storage.Details{},
+	}))
+
+	// A refused update isn't replayed
+	stale := "Stale"
+	err = journal.UpdateDetails(ctx, "doc1", storage.DetailsUpdate{
+		Title: &stale, Properties: map[string]string{}, Based: &storage.Details{},
+	})
+	require.ErrorIs(t, err, storage.ErrDetailsChanged)
+	require.NoError(t, journal.Close())
+
+	store := storage.NewMemoryStore()
+	openJournal(t, store, path)
+
+	meta, err := store.LoadMetadata(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, "Plans", meta.Title)
+	require.Equal(t, map[string]string{"team": "docs"}, meta.Properties)
+}
+
+// aheadStore is a MemoryStore that checks the journal at path holds a
+// write's record before the write reaches it, and rejects operations.
+type aheadStore struct {
+	*storage.MemoryStore
+
+	t    *testing.T
+	path string
+}
+
+func (s aheadStore) AppendOperations(ctx context.Context, docID string, ops []ot.SequencedOperation) error {
+	data, err := os.ReadFile(s.path)
+	require.NoError(s.t, err)
+	require.Contains(s.t, string(data), `"Kind":"operations","DocID":"`+docID+`"`)
+
+	return errors.New("disk full")
+}
+
+func TestJournal_WritesAhead(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "docs.journal")
+	ctx := t.Context()
+
+	journal := openJournal(t, aheadStore{MemoryStore: storage.NewMemoryStore(), t: t, path: path}, path)
+	require.NoError(t, journal.CreateDocument(ctx, "doc1"))
+
+	err := journal.AppendOperation(ctx, "doc1",
+		ot.SequencedOperation{Operation: ot.NewInsert("a", 0, "alice"), Revision: 1})
+	require.ErrorContains(t, err, "disk full")
+	require.NoError(t, journal.Close())
+
+	// The rejected write isn't replayed
+	store := storage.NewMemoryStore()
+	openJournal(t, store, path)
+
+	revision, err := store.LatestRevision(ctx, "doc1")
+	require.NoError(t, err)
+	require.Zero(t, revision)
+}
+
+// blockingStore is a MemoryStore whose AppendOperations waits for an error
+// to return from release, signaling started once it's called.
+type blockingStore struct {
+	*storage.MemoryStore
+
+	started chan struct{}
+	release chan error
+}
+
+func (s blockingStore) AppendOperations(context.Context, string, []ot.SequencedOperation) error {
+	close(s.started)
+
+	return <-s.release
+}
+
+func TestJournal_Compact(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "docs.journal")
+	ctx := t.Context()
+
+	store := blockingStore{
+		MemoryStore: storage.NewMemoryStore(),
+		started:     make(chan struct{}),
+		release:     make(chan error),
+	}
+	journal := openJournal(t, store, path)
+
+	require.NoError(t, journal.CreateDocument(ctx, "doc1"))
+	require.NoError(t, journal.CreateDocument(ctx, "doc2"))
+
+	for i := range 10 {
+		require.NoError(t, journal.SaveSnapshot(ctx, "doc1", i, strings.Repeat("a", i)))
+	}
+
+	// A write in progress while the journal is compacted can still be aborted
+	errs := make(chan error)
+
+	go func() {
+		errs <- journal.AppendOperation(ctx, "doc2",
+			ot.SequencedOperation{Operation: ot.NewInsert("b", 0, "bob"), Revision: 1})
+	}()
+
+	<-store.started
+
+	before, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, journal.Compact())
+
+	after, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Less(t, after.Size(), before.Size())
+
+	store.release <- errors.New("disk full")
+	require.ErrorContains(t, <-errs, "disk full")
+	require.NoError(t, journal.SetTitle(ctx, "doc2", "Notes"))
+	require.NoError(t, journal.Close())
+
+	replayed := storage.NewMemoryStore()
+	openJournal(t, replayed, path)
+
+	snapshot, err := replayed.LoadSnapshot(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, 9, snapshot.Revision)
+
+	revision, err := replayed.LatestRevision(ctx, "doc2")
+	require.NoError(t, err)
+	require.Zero(t, revision)
+
+	meta, err := replayed.LoadMetadata(ctx, "doc2")
+	require.NoError(t, err)
+	require.Equal(t, "Notes", meta.Title)
+}
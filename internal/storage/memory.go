@@ -1,6 +1,11 @@
 package storage
 
 import (
+	"context"
+	"hash/maphash"
+	"maps"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
@@ -9,96 +14,247 @@ import (
 
 // documentData holds all persisted data for a single document.
 type documentData struct {
+	mu      sync.RWMutex
+	deleted bool // Set once removed, for callers that looked the document up before
+
 	snapshot   *Snapshot
-	operations []ot.SequencedOperation
+	operations []ot.SequencedOperation // Ordered by revision
+	handoff    *Handoff
+
+	createdAt    time.Time
+	lastEditedAt time.Time
+	lastEditedBy string
+	editors      map[string]struct{}
+	tags         []string
+	archivedAt   time.Time
+	slug         string
+	title        string
+	properties   map[string]string
+	fence        uint64 // Highest fencing token a write was made with
+}
+
+// memoryShards is how many maps documents are spread over, so creating and
+// deleting documents only contends with lookups in the same shard.
+const memoryShards = 32
+
+// memoryShard holds a subset of the documents.
+type memoryShard struct {
+	mu   sync.RWMutex
+	docs map[string]*documentData
 }
 
 // MemoryStore is an in-memory implementation of the Store interface.
 // Useful for testing and development.
+// Its operations never block, so it only reads fencing tokens from contexts.
+//
+// Each document has its own lock, so heavy traffic on one document doesn't
+// hold up others. Locks are taken in the order shard, slugs, document.
 type MemoryStore struct {
-	mu   sync.RWMutex
-	docs map[string]*documentData
+	seed   maphash.Seed
+	shards [memoryShards]memoryShard
+
+	slugsMu sync.RWMutex
+	slugs   map[string]string // slug -> docID
 }
 
 // NewMemoryStore creates a new in-memory store.
 func NewMemoryStore() *MemoryStore {
-	return &MemoryStore{
-		docs: make(map[string]*documentData),
+	m := &MemoryStore{
+		seed:  maphash.MakeSeed(),
+		slugs: make(map[string]string),
+	}
+
+	for i := range m.shards {
+		m.shards[i].docs = make(map[string]*documentData)
+	}
+
+	return m
+}
+
+// shard returns the shard holding docID.
+func (m *MemoryStore) shard(docID string) *memoryShard {
+	return &m.shards[maphash.String(m.seed, docID)%memoryShards]
+}
+
+// lookup returns the document, or ErrDocumentNotFound. The caller must lock
+// it and check deleted, in case it's removed in between.
+func (m *MemoryStore) lookup(docID string) (*documentData, error) {
+	shard := m.shard(docID)
+
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	doc, exists := shard.docs[docID]
+	if !exists {
+		return nil, ErrDocumentNotFound
 	}
+
+	return doc, nil
+}
+
+// read looks the document up and read-locks it. The caller must unlock it.
+func (m *MemoryStore) read(docID string) (*documentData, error) {
+	doc, err := m.lookup(docID)
+	if err != nil {
+		return nil, err
+	}
+
+	doc.mu.RLock()
+
+	if doc.deleted {
+		doc.mu.RUnlock()
+
+		return nil, ErrDocumentNotFound
+	}
+
+	return doc, nil
+}
+
+// write looks the document up and locks it. The caller must unlock it.
+func (m *MemoryStore) write(docID string) (*documentData, error) {
+	doc, err := m.lookup(docID)
+	if err != nil {
+		return nil, err
+	}
+
+	doc.mu.Lock()
+
+	if doc.deleted {
+		doc.mu.Unlock()
+
+		return nil, ErrDocumentNotFound
+	}
+
+	return doc, nil
 }
 
 // CreateDocument creates a new document with the given ID.
-func (m *MemoryStore) CreateDocument(docID string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+func (m *MemoryStore) CreateDocument(_ context.Context, docID string) error {
+	return m.create(docID, nil)
+}
+
+// CreateDocumentFromSnapshot creates a new document starting from a
+// revision 0 snapshot of content.
+func (m *MemoryStore) CreateDocumentFromSnapshot(_ context.Context, docID, content string) error {
+	return m.create(docID, &Snapshot{DocID: docID, Content: content, CreatedAt: time.Now()})
+}
+
+// create adds a document starting from snapshot, which may be nil.
+func (m *MemoryStore) create(docID string, snapshot *Snapshot) error {
+	shard := m.shard(docID)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
 
-	if _, exists := m.docs[docID]; exists {
+	if _, exists := shard.docs[docID]; exists {
 		return ErrDocumentExists
 	}
 
-	m.docs[docID] = &documentData{
+	shard.docs[docID] = &documentData{
+		snapshot:   snapshot,
 		operations: make([]ot.SequencedOperation, 0),
+		createdAt:  time.Now(),
+		editors:    make(map[string]struct{}),
 	}
 
 	return nil
 }
 
 // DocumentExists checks if a document exists.
-func (m *MemoryStore) DocumentExists(docID string) (bool, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+func (m *MemoryStore) DocumentExists(_ context.Context, docID string) (bool, error) {
+	_, err := m.lookup(docID)
 
-	_, exists := m.docs[docID]
-
-	return exists, nil
+	return err == nil, nil
 }
 
 // SaveSnapshot persists a snapshot of the document at the given revision.
-func (m *MemoryStore) SaveSnapshot(docID string, revision int, content string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+func (m *MemoryStore) SaveSnapshot(ctx context.Context, docID string, revision int, content string) error {
+	return m.SaveFormattedSnapshot(ctx, docID, revision, content, nil)
+}
 
-	doc, exists := m.docs[docID]
-	if !exists {
-		return ErrDocumentNotFound
+// SaveFormattedSnapshot persists a snapshot of the document at the given
+// revision, with its formatting.
+func (m *MemoryStore) SaveFormattedSnapshot(
+	ctx context.Context, docID string, revision int, content string, formatting []ot.Mark,
+) error {
+	doc, err := m.write(docID)
+	if err != nil {
+		return err
+	}
+	defer doc.mu.Unlock()
+
+	if err := doc.checkFence(ctx); err != nil {
+		return err
 	}
 
 	doc.snapshot = &Snapshot{
-		DocID:     docID,
-		Revision:  revision,
-		Content:   content,
-		CreatedAt: time.Now(),
+		DocID:      docID,
+		Revision:   revision,
+		Content:    content,
+		Formatting: slices.Clone(formatting),
+		CreatedAt:  time.Now(),
 	}
 
-	// Prune operations that are now covered by the snapshot
-	m.pruneOperations(doc, revision)
+	// Prune operations that are now covered by the snapshot, copying the
+	// rest so the pruned ones can be freed
+	doc.operations = slices.Clone(doc.operations[doc.after(revision):])
 
 	return nil
 }
 
-// pruneOperations removes operations that are at or before the snapshot revision.
-func (m *MemoryStore) pruneOperations(doc *documentData, snapshotRevision int) {
-	var kept []ot.SequencedOperation
+// after returns the index of the first operation after revision. Must be
+// called with mu held.
+func (d *documentData) after(revision int) int {
+	return sort.Search(len(d.operations), func(i int) bool {
+		return d.operations[i].Revision > revision
+	})
+}
 
-	for _, op := range doc.operations {
-		if op.Revision > snapshotRevision {
-			kept = append(kept, op)
-		}
+// SaveHandoff stores the state of a session being handed over.
+func (m *MemoryStore) SaveHandoff(ctx context.Context, handoff Handoff) error {
+	doc, err := m.write(handoff.DocID)
+	if err != nil {
+		return err
 	}
+	defer doc.mu.Unlock()
 
-	doc.operations = kept
+	if err := doc.checkFence(ctx); err != nil {
+		return err
+	}
+
+	handoff.History = slices.Clone(handoff.History)
+	handoff.CreatedAt = time.Now()
+	doc.handoff = &handoff
+
+	return nil
 }
 
-// LoadSnapshot retrieves the latest snapshot for a document.
-func (m *MemoryStore) LoadSnapshot(docID string) (Snapshot, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// TakeHandoff returns and removes the document's handoff.
+func (m *MemoryStore) TakeHandoff(_ context.Context, docID string) (Handoff, error) {
+	doc, err := m.write(docID)
+	if err != nil {
+		return Handoff{}, err
+	}
+	defer doc.mu.Unlock()
 
-	doc, exists := m.docs[docID]
-	if !exists {
-		return Snapshot{}, ErrDocumentNotFound
+	if doc.handoff == nil {
+		return Handoff{}, ErrHandoffNotFound
 	}
 
+	handoff := *doc.handoff
+	doc.handoff = nil
+
+	return handoff, nil
+}
+
+// LoadSnapshot retrieves the latest snapshot for a document.
+func (m *MemoryStore) LoadSnapshot(_ context.Context, docID string) (Snapshot, error) {
+	doc, err := m.read(docID)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer doc.mu.RUnlock()
+
 	if doc.snapshot == nil {
 		return Snapshot{}, ErrSnapshotNotFound
 	}
@@ -107,74 +263,369 @@ func (m *MemoryStore) LoadSnapshot(docID string) (Snapshot, error) {
 }
 
 // AppendOperation adds an operation to the document's operation log.
-func (m *MemoryStore) AppendOperation(docID string, op ot.SequencedOperation) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+func (m *MemoryStore) AppendOperation(ctx context.Context, docID string, op ot.SequencedOperation) error {
+	return m.AppendOperations(ctx, docID, []ot.SequencedOperation{op})
+}
 
-	doc, exists := m.docs[docID]
-	if !exists {
-		return ErrDocumentNotFound
+// AppendOperations adds operations to the document's operation log in one write.
+func (m *MemoryStore) AppendOperations(ctx context.Context, docID string, ops []ot.SequencedOperation) error {
+	doc, err := m.write(docID)
+	if err != nil {
+		return err
+	}
+	defer doc.mu.Unlock()
+
+	if err := doc.checkFence(ctx); err != nil {
+		return err
 	}
 
-	doc.operations = append(doc.operations, op)
+	for _, op := range ops {
+		// Operations normally arrive in order, so this appends
+		doc.operations = slices.Insert(doc.operations, doc.after(op.Revision), op)
+		doc.lastEditedAt = time.Now()
+		doc.lastEditedBy = op.UserID
+		doc.editors[op.UserID] = struct{}{}
+	}
+
+	return nil
+}
+
+// checkFence rejects writes whose fencing token is lower than one already
+// seen for the document, and records the token otherwise. Writes without a
+// token aren't fenced.
+func (d *documentData) checkFence(ctx context.Context) error {
+	token, ok := FencingToken(ctx)
+	if !ok {
+		return nil
+	}
+
+	if token < d.fence {
+		return ErrFenced
+	}
+
+	d.fence = token
 
 	return nil
 }
 
 // LoadOperations retrieves all operations after the given revision.
-func (m *MemoryStore) LoadOperations(docID string, sinceRevision int) ([]ot.SequencedOperation, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+func (m *MemoryStore) LoadOperations(
+	_ context.Context, docID string, sinceRevision int,
+) ([]ot.SequencedOperation, error) {
+	doc, err := m.read(docID)
+	if err != nil {
+		return nil, err
+	}
+	defer doc.mu.RUnlock()
 
-	doc, exists := m.docs[docID]
-	if !exists {
-		return nil, ErrDocumentNotFound
+	ops := doc.operations[doc.after(sinceRevision):]
+	if len(ops) == 0 {
+		return nil, nil
+	}
+
+	return slices.Clone(ops), nil
+}
+
+// LatestRevision returns the highest revision number for a document.
+func (m *MemoryStore) LatestRevision(_ context.Context, docID string) (int, error) {
+	doc, err := m.read(docID)
+	if err != nil {
+		return 0, err
+	}
+	defer doc.mu.RUnlock()
+
+	var revision int
+
+	// Operations are usually newer than the snapshot, but can be stored after
+	// a snapshot that already covers them
+	if len(doc.operations) > 0 {
+		revision = doc.operations[len(doc.operations)-1].Revision
+	}
+
+	if doc.snapshot != nil {
+		revision = max(revision, doc.snapshot.Revision)
+	}
+
+	return revision, nil
+}
+
+// LoadMetadata returns the document's edit metadata.
+func (m *MemoryStore) LoadMetadata(_ context.Context, docID string) (Metadata, error) {
+	doc, err := m.read(docID)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer doc.mu.RUnlock()
+
+	return Metadata{
+		DocID:        docID,
+		CreatedAt:    doc.createdAt,
+		LastEditedAt: doc.lastEditedAt,
+		LastEditedBy: doc.lastEditedBy,
+		Editors:      len(doc.editors),
+		Tags:         slices.Clone(doc.tags),
+		ArchivedAt:   doc.archivedAt,
+		Slug:         doc.slug,
+		Title:        doc.title,
+		Properties:   maps.Clone(doc.properties),
+	}, nil
+}
+
+// SetTags replaces the document's tags, stored sorted and without duplicates.
+func (m *MemoryStore) SetTags(_ context.Context, docID string, tags []string) error {
+	doc, err := m.write(docID)
+	if err != nil {
+		return err
+	}
+	defer doc.mu.Unlock()
+
+	tags = slices.Clone(tags)
+	slices.Sort(tags)
+	doc.tags = slices.Compact(tags)
+
+	return nil
+}
+
+// SetTitle renames the document.
+func (m *MemoryStore) SetTitle(_ context.Context, docID, title string) error {
+	doc, err := m.write(docID)
+	if err != nil {
+		return err
+	}
+	defer doc.mu.Unlock()
+
+	doc.title = title
+
+	return nil
+}
+
+// SetProperties replaces the document's key/value properties.
+func (m *MemoryStore) SetProperties(_ context.Context, docID string, properties map[string]string) error {
+	doc, err := m.write(docID)
+	if err != nil {
+		return err
 	}
+	defer doc.mu.Unlock()
 
-	var result []ot.SequencedOperation
+	if len(properties) == 0 {
+		properties = nil
+	}
 
-	for _, op := range doc.operations {
-		if op.Revision > sinceRevision {
-			result = append(result, op)
+	doc.properties = maps.Clone(properties)
+
+	return nil
+}
+
+// UpdateDetails sets the document's title and properties, provided they're
+// those the update is based on.
+func (m *MemoryStore) UpdateDetails(_ context.Context, docID string, update DetailsUpdate) error {
+	doc, err := m.write(docID)
+	if err != nil {
+		return err
+	}
+	defer doc.mu.Unlock()
+
+	if !update.matches(doc.title, doc.properties) {
+		return ErrDetailsChanged
+	}
+
+	if update.Title != nil {
+		doc.title = *update.Title
+	}
+
+	if update.Properties != nil {
+		doc.properties = nil
+		if len(update.Properties) > 0 {
+			doc.properties = maps.Clone(update.Properties)
 		}
 	}
 
-	return result, nil
+	return nil
 }
 
-// LatestRevision returns the highest revision number for a document.
-func (m *MemoryStore) LatestRevision(docID string) (int, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// SetArchived archives or unarchives a document.
+func (m *MemoryStore) SetArchived(_ context.Context, docID string, archived bool) error {
+	doc, err := m.write(docID)
+	if err != nil {
+		return err
+	}
+	defer doc.mu.Unlock()
+
+	switch {
+	case !archived:
+		doc.archivedAt = time.Time{}
+	case doc.archivedAt.IsZero():
+		doc.archivedAt = time.Now()
+	}
+
+	return nil
+}
+
+// SetSlug gives the document a unique human-readable alias.
+func (m *MemoryStore) SetSlug(_ context.Context, docID, slug string) error {
+	doc, err := m.lookup(docID)
+	if err != nil {
+		return err
+	}
+
+	m.slugsMu.Lock()
+	defer m.slugsMu.Unlock()
+
+	doc.mu.Lock()
+	defer doc.mu.Unlock()
+
+	if doc.deleted {
+		return ErrDocumentNotFound
+	}
+
+	if owner, taken := m.slugs[slug]; taken && owner != docID {
+		return ErrSlugTaken
+	}
+
+	delete(m.slugs, doc.slug)
+
+	if slug != "" {
+		m.slugs[slug] = docID
+	}
+
+	doc.slug = slug
+
+	return nil
+}
 
-	doc, exists := m.docs[docID]
+// ResolveSlug returns the ID of the document with the given slug.
+func (m *MemoryStore) ResolveSlug(_ context.Context, slug string) (string, error) {
+	m.slugsMu.RLock()
+	defer m.slugsMu.RUnlock()
+
+	docID, exists := m.slugs[slug]
 	if !exists {
-		return 0, ErrDocumentNotFound
+		return "", ErrSlugNotFound
 	}
 
-	// Check operations first (they're newer than snapshot)
-	if len(doc.operations) > 0 {
-		return doc.operations[len(doc.operations)-1].Revision, nil
+	return docID, nil
+}
+
+// operationBytes approximates the size of a stored operation, excluding its
+// strings.
+const operationBytes = 40
+
+// Usage reports how many documents are stored and their approximate size.
+func (m *MemoryStore) Usage(_ context.Context) (Usage, error) {
+	var usage Usage
+
+	for _, doc := range m.documents() {
+		doc.mu.RLock()
+
+		if !doc.deleted {
+			usage.Documents++
+			usage.Bytes += doc.bytes()
+		}
+
+		doc.mu.RUnlock()
 	}
 
-	// Fall back to snapshot revision
-	if doc.snapshot != nil {
-		return doc.snapshot.Revision, nil
+	return usage, nil
+}
+
+// bytes approximates the size of the document's snapshot and operation log.
+// Must be called with mu held.
+func (d *documentData) bytes() int64 {
+	var n int64
+
+	if d.snapshot != nil {
+		n += int64(len(d.snapshot.Content))
 	}
 
-	return 0, nil
+	for _, op := range d.operations {
+		n += int64(operationBytes + len(op.Char) + len(op.UserID))
+	}
+
+	return n
+}
+
+// documents returns every document, locking one shard at a time.
+func (m *MemoryStore) documents() []*documentData {
+	var docs []*documentData
+
+	for i := range m.shards {
+		shard := &m.shards[i]
+
+		shard.mu.RLock()
+
+		for _, doc := range shard.docs {
+			docs = append(docs, doc)
+		}
+
+		shard.mu.RUnlock()
+	}
+
+	return docs
 }
 
 // DeleteDocument removes a document and all its data.
-func (m *MemoryStore) DeleteDocument(docID string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+func (m *MemoryStore) DeleteDocument(_ context.Context, docID string) error {
+	shard := m.shard(docID)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
 
-	if _, exists := m.docs[docID]; !exists {
+	doc, exists := shard.docs[docID]
+	if !exists {
 		return ErrDocumentNotFound
 	}
 
-	delete(m.docs, docID)
+	m.slugsMu.Lock()
+	defer m.slugsMu.Unlock()
+
+	doc.mu.Lock()
+	defer doc.mu.Unlock()
+
+	doc.deleted = true
+
+	delete(m.slugs, doc.slug)
+	delete(shard.docs, docID)
+
+	return nil
+}
+
+// ListDocuments returns the IDs of all documents, sorted.
+func (m *MemoryStore) ListDocuments(_ context.Context) ([]string, error) {
+	var docIDs []string
+
+	for i := range m.shards {
+		shard := &m.shards[i]
+
+		shard.mu.RLock()
+
+		for docID := range shard.docs {
+			docIDs = append(docIDs, docID)
+		}
+
+		shard.mu.RUnlock()
+	}
+
+	slices.Sort(docIDs)
+
+	return docIDs, nil
+}
+
+// ResetDocument replaces the document's history with a snapshot at revision.
+func (m *MemoryStore) ResetDocument(_ context.Context, docID string, revision int, content string) error {
+	doc, err := m.write(docID)
+	if err != nil {
+		return err
+	}
+	defer doc.mu.Unlock()
+
+	doc.snapshot = &Snapshot{
+		DocID:     docID,
+		Revision:  revision,
+		Content:   content,
+		CreatedAt: time.Now(),
+	}
+	doc.operations = make([]ot.SequencedOperation, 0)
+	doc.handoff = nil
 
 	return nil
 }
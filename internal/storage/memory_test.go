@@ -2,25 +2,34 @@ package storage_test
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 	"sync"
 	"testing"
 
 	"github.com/serroba/online-docs/internal/ot"
 	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/storage/storagetest"
 	"github.com/stretchr/testify/require"
 )
 
+func TestMemoryStore_Conformance(t *testing.T) {
+	t.Parallel()
+
+	storagetest.Run(t, func(*testing.T) storage.Store { return storage.NewMemoryStore() })
+}
+
 func TestMemoryStore_CreateDocument(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
 
-	err := store.CreateDocument("doc1")
+	err := store.CreateDocument(t.Context(), "doc1")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	exists, err := store.DocumentExists("doc1")
+	exists, err := store.DocumentExists(t.Context(), "doc1")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -35,9 +44,9 @@ func TestMemoryStore_CreateDocument_AlreadyExists(t *testing.T) {
 
 	store := storage.NewMemoryStore()
 
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
-	err := store.CreateDocument("doc1")
+	err := store.CreateDocument(t.Context(), "doc1")
 	if !errors.Is(err, storage.ErrDocumentExists) {
 		t.Errorf("expected ErrDocumentExists, got %v", err)
 	}
@@ -48,7 +57,7 @@ func TestMemoryStore_DocumentExists_NotFound(t *testing.T) {
 
 	store := storage.NewMemoryStore()
 
-	exists, err := store.DocumentExists("nonexistent")
+	exists, err := store.DocumentExists(t.Context(), "nonexistent")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -62,14 +71,14 @@ func TestMemoryStore_SaveAndLoadSnapshot(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
-	err := store.SaveSnapshot("doc1", 10, "hello world")
+	err := store.SaveSnapshot(t.Context(), "doc1", 10, "hello world")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	snapshot, err := store.LoadSnapshot("doc1")
+	snapshot, err := store.LoadSnapshot(t.Context(), "doc1")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -96,7 +105,7 @@ func TestMemoryStore_SaveSnapshot_DocumentNotFound(t *testing.T) {
 
 	store := storage.NewMemoryStore()
 
-	err := store.SaveSnapshot("nonexistent", 10, "content")
+	err := store.SaveSnapshot(t.Context(), "nonexistent", 10, "content")
 	if !errors.Is(err, storage.ErrDocumentNotFound) {
 		t.Errorf("expected ErrDocumentNotFound, got %v", err)
 	}
@@ -107,7 +116,7 @@ func TestMemoryStore_LoadSnapshot_DocumentNotFound(t *testing.T) {
 
 	store := storage.NewMemoryStore()
 
-	_, err := store.LoadSnapshot("nonexistent")
+	_, err := store.LoadSnapshot(t.Context(), "nonexistent")
 	if !errors.Is(err, storage.ErrDocumentNotFound) {
 		t.Errorf("expected ErrDocumentNotFound, got %v", err)
 	}
@@ -117,9 +126,9 @@ func TestMemoryStore_LoadSnapshot_NoSnapshot(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
-	_, err := store.LoadSnapshot("doc1")
+	_, err := store.LoadSnapshot(t.Context(), "doc1")
 	if !errors.Is(err, storage.ErrSnapshotNotFound) {
 		t.Errorf("expected ErrSnapshotNotFound, got %v", err)
 	}
@@ -129,7 +138,7 @@ func TestMemoryStore_AppendAndLoadOperations(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	ops := []ot.SequencedOperation{
 		{Operation: ot.NewInsert("a", 0, "user"), Revision: 1},
@@ -138,13 +147,13 @@ func TestMemoryStore_AppendAndLoadOperations(t *testing.T) {
 	}
 
 	for _, op := range ops {
-		err := store.AppendOperation("doc1", op)
+		err := store.AppendOperation(t.Context(), "doc1", op)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
 	}
 
-	loaded, err := store.LoadOperations("doc1", 0)
+	loaded, err := store.LoadOperations(t.Context(), "doc1", 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -164,17 +173,88 @@ func TestMemoryStore_AppendOperation_DocumentNotFound(t *testing.T) {
 		Revision:  1,
 	}
 
-	err := store.AppendOperation("nonexistent", op)
+	err := store.AppendOperation(t.Context(), "nonexistent", op)
 	if !errors.Is(err, storage.ErrDocumentNotFound) {
 		t.Errorf("expected ErrDocumentNotFound, got %v", err)
 	}
 }
 
+func TestMemoryStore_FencingToken(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	stale := storage.WithFencingToken(t.Context(), 1)
+	current := storage.WithFencingToken(t.Context(), 2)
+
+	token, ok := storage.FencingToken(current)
+	require.True(t, ok)
+	require.Equal(t, uint64(2), token)
+
+	_, ok = storage.FencingToken(t.Context())
+	require.False(t, ok)
+
+	op := ot.SequencedOperation{Operation: ot.NewInsert("a", 0, "user"), Revision: 1}
+	require.NoError(t, store.AppendOperation(stale, "doc1", op))
+	require.NoError(t, store.AppendOperation(current, "doc1", op))
+
+	// Once a newer holder wrote, the old one is fenced off
+	require.ErrorIs(t, store.AppendOperation(stale, "doc1", op), storage.ErrFenced)
+	require.ErrorIs(t, store.SaveSnapshot(stale, "doc1", 1, "a"), storage.ErrFenced)
+	require.NoError(t, store.SaveSnapshot(current, "doc1", 1, "a"))
+	require.ErrorIs(t, store.SaveHandoff(stale, storage.Handoff{DocID: "doc1", Revision: 1}), storage.ErrFenced)
+
+	// Writes without a token aren't fenced
+	require.NoError(t, store.AppendOperation(t.Context(), "doc1", op))
+}
+
+func TestMemoryStore_Handoff(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	_, err := store.TakeHandoff(t.Context(), "doc1")
+	require.ErrorIs(t, err, storage.ErrHandoffNotFound)
+
+	history := []ot.SequencedOperation{
+		{Operation: ot.NewInsert("a", 0, "user"), Revision: 1},
+		{Operation: ot.NewInsert("b", 1, "user"), Revision: 2},
+	}
+	require.NoError(t, store.SaveHandoff(t.Context(), storage.Handoff{
+		DocID: "doc1", Revision: 2, Content: "ab", History: history,
+	}))
+
+	handoff, err := store.TakeHandoff(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.Equal(t, 2, handoff.Revision)
+	require.Equal(t, "ab", handoff.Content)
+	require.Equal(t, history, handoff.History)
+	require.False(t, handoff.CreatedAt.IsZero())
+
+	// A handoff is restored at most once
+	_, err = store.TakeHandoff(t.Context(), "doc1")
+	require.ErrorIs(t, err, storage.ErrHandoffNotFound)
+
+	// Resetting the history discards it
+	require.NoError(t, store.SaveHandoff(t.Context(), storage.Handoff{DocID: "doc1", Revision: 2, Content: "ab"}))
+	require.NoError(t, store.ResetDocument(t.Context(), "doc1", 2, "ab"))
+
+	_, err = store.TakeHandoff(t.Context(), "doc1")
+	require.ErrorIs(t, err, storage.ErrHandoffNotFound)
+
+	require.ErrorIs(t, store.SaveHandoff(t.Context(), storage.Handoff{DocID: "missing"}), storage.ErrDocumentNotFound)
+
+	_, err = store.TakeHandoff(t.Context(), "missing")
+	require.ErrorIs(t, err, storage.ErrDocumentNotFound)
+}
+
 func TestMemoryStore_LoadOperations_SinceRevision(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	for i := 1; i <= 5; i++ {
 		op := ot.SequencedOperation{
@@ -182,10 +262,10 @@ func TestMemoryStore_LoadOperations_SinceRevision(t *testing.T) {
 			Revision:  i,
 		}
 
-		require.NoError(t, store.AppendOperation("doc1", op))
+		require.NoError(t, store.AppendOperation(t.Context(), "doc1", op))
 	}
 
-	loaded, err := store.LoadOperations("doc1", 3)
+	loaded, err := store.LoadOperations(t.Context(), "doc1", 3)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -203,12 +283,46 @@ func TestMemoryStore_LoadOperations_SinceRevision(t *testing.T) {
 	}
 }
 
+func TestMemoryStore_LoadOperations_OutOfOrder(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	for _, revision := range []int{3, 1, 5, 2, 4} {
+		op := ot.SequencedOperation{Operation: ot.NewInsert("x", 0, "user"), Revision: revision}
+		require.NoError(t, store.AppendOperation(t.Context(), "doc1", op))
+	}
+
+	tests := []struct {
+		since int
+		want  []int
+	}{
+		{0, []int{1, 2, 3, 4, 5}},
+		{2, []int{3, 4, 5}},
+		{5, nil},
+		{9, nil},
+	}
+
+	for _, tt := range tests {
+		loaded, err := store.LoadOperations(t.Context(), "doc1", tt.since)
+		require.NoError(t, err)
+
+		var revisions []int
+		for _, op := range loaded {
+			revisions = append(revisions, op.Revision)
+		}
+
+		require.Equal(t, tt.want, revisions, "since %d", tt.since)
+	}
+}
+
 func TestMemoryStore_LoadOperations_DocumentNotFound(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
 
-	_, err := store.LoadOperations("nonexistent", 0)
+	_, err := store.LoadOperations(t.Context(), "nonexistent", 0)
 	if !errors.Is(err, storage.ErrDocumentNotFound) {
 		t.Errorf("expected ErrDocumentNotFound, got %v", err)
 	}
@@ -218,10 +332,10 @@ func TestMemoryStore_LatestRevision(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	// Initially 0 (document exists but no ops)
-	rev, err := store.LatestRevision("doc1")
+	rev, err := store.LatestRevision(t.Context(), "doc1")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -237,10 +351,10 @@ func TestMemoryStore_LatestRevision(t *testing.T) {
 			Revision:  i,
 		}
 
-		require.NoError(t, store.AppendOperation("doc1", op))
+		require.NoError(t, store.AppendOperation(t.Context(), "doc1", op))
 	}
 
-	rev, err = store.LatestRevision("doc1")
+	rev, err = store.LatestRevision(t.Context(), "doc1")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -250,12 +364,61 @@ func TestMemoryStore_LatestRevision(t *testing.T) {
 	}
 }
 
+func TestMemoryStore_AppendOperations(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	ops := []ot.SequencedOperation{
+		{Operation: ot.NewInsert("a", 0, "alice"), Revision: 1},
+		{Operation: ot.NewInsert("b", 1, "bob"), Revision: 2},
+	}
+	require.NoError(t, store.AppendOperations(storage.WithFencingToken(t.Context(), 2), "doc1", ops))
+
+	loaded, err := store.LoadOperations(t.Context(), "doc1", 0)
+	require.NoError(t, err)
+	require.Equal(t, ops, loaded)
+
+	meta, err := store.LoadMetadata(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.Equal(t, "bob", meta.LastEditedBy)
+	require.Equal(t, 2, meta.Editors)
+
+	// A stale batch is rejected as a whole
+	stale := []ot.SequencedOperation{{Operation: ot.NewInsert("c", 2, "alice"), Revision: 3}}
+	err = store.AppendOperations(storage.WithFencingToken(t.Context(), 1), "doc1", stale)
+	require.ErrorIs(t, err, storage.ErrFenced)
+
+	revision, err := store.LatestRevision(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.Equal(t, 2, revision)
+
+	require.ErrorIs(t, store.AppendOperations(t.Context(), "missing", ops), storage.ErrDocumentNotFound)
+}
+
+func TestMemoryStore_LatestRevision_AfterSnapshot(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.SaveSnapshot(t.Context(), "doc1", 5, "hello"))
+
+	// An operation the snapshot already covers doesn't lower the revision
+	op := ot.SequencedOperation{Operation: ot.NewInsert("o", 4, "user"), Revision: 5}
+	require.NoError(t, store.AppendOperation(t.Context(), "doc1", op))
+
+	revision, err := store.LatestRevision(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.Equal(t, 5, revision)
+}
+
 func TestMemoryStore_LatestRevision_DocumentNotFound(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
 
-	_, err := store.LatestRevision("nonexistent")
+	_, err := store.LatestRevision(t.Context(), "nonexistent")
 	if !errors.Is(err, storage.ErrDocumentNotFound) {
 		t.Errorf("expected ErrDocumentNotFound, got %v", err)
 	}
@@ -265,10 +428,10 @@ func TestMemoryStore_LatestRevision_FromSnapshot(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
-	require.NoError(t, store.SaveSnapshot("doc1", 10, "content"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.SaveSnapshot(t.Context(), "doc1", 10, "content"))
 
-	rev, err := store.LatestRevision("doc1")
+	rev, err := store.LatestRevision(t.Context(), "doc1")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -282,7 +445,7 @@ func TestMemoryStore_SnapshotPrunesOperations(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	for i := 1; i <= 5; i++ {
 		op := ot.SequencedOperation{
@@ -290,12 +453,12 @@ func TestMemoryStore_SnapshotPrunesOperations(t *testing.T) {
 			Revision:  i,
 		}
 
-		require.NoError(t, store.AppendOperation("doc1", op))
+		require.NoError(t, store.AppendOperation(t.Context(), "doc1", op))
 	}
 
-	require.NoError(t, store.SaveSnapshot("doc1", 3, "xxx"))
+	require.NoError(t, store.SaveSnapshot(t.Context(), "doc1", 3, "xxx"))
 
-	ops, _ := store.LoadOperations("doc1", 0)
+	ops, _ := store.LoadOperations(t.Context(), "doc1", 0)
 
 	if len(ops) != 2 {
 		t.Errorf("expected 2 operations after prune, got %d", len(ops))
@@ -310,21 +473,21 @@ func TestMemoryStore_MultipleDocuments(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
-	require.NoError(t, store.CreateDocument("doc2"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc2"))
 
-	require.NoError(t, store.AppendOperation("doc1", ot.SequencedOperation{
+	require.NoError(t, store.AppendOperation(t.Context(), "doc1", ot.SequencedOperation{
 		Operation: ot.NewInsert("a", 0, "user"),
 		Revision:  1,
 	}))
 
-	require.NoError(t, store.AppendOperation("doc2", ot.SequencedOperation{
+	require.NoError(t, store.AppendOperation(t.Context(), "doc2", ot.SequencedOperation{
 		Operation: ot.NewInsert("b", 0, "user"),
 		Revision:  1,
 	}))
 
-	ops1, _ := store.LoadOperations("doc1", 0)
-	ops2, _ := store.LoadOperations("doc2", 0)
+	ops1, _ := store.LoadOperations(t.Context(), "doc1", 0)
+	ops2, _ := store.LoadOperations(t.Context(), "doc2", 0)
 
 	if len(ops1) != 1 || len(ops2) != 1 {
 		t.Errorf("expected 1 op each, got %d and %d", len(ops1), len(ops2))
@@ -343,7 +506,7 @@ func TestMemoryStore_ConcurrentAccess(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	var wg sync.WaitGroup
 
@@ -359,29 +522,84 @@ func TestMemoryStore_ConcurrentAccess(t *testing.T) {
 			}
 
 			// Note: Using _ here since require is not goroutine-safe
-			_ = store.AppendOperation("doc1", op)
+			_ = store.AppendOperation(t.Context(), "doc1", op)
 		}(i + 1)
 	}
 
 	wg.Wait()
 
-	ops, _ := store.LoadOperations("doc1", 0)
+	ops, _ := store.LoadOperations(t.Context(), "doc1", 0)
 
 	if len(ops) != 10 {
 		t.Errorf("expected 10 operations, got %d", len(ops))
 	}
 }
 
+func TestMemoryStore_ConcurrentDocuments(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+
+	var wg sync.WaitGroup
+
+	// Each document is created, edited, renamed and deleted while the others
+	// are listed and measured
+	for i := range 20 {
+		docID := fmt.Sprintf("doc%d", i)
+
+		wg.Go(func() {
+			_ = store.CreateDocument(t.Context(), docID)
+
+			for revision := 1; revision <= 50; revision++ {
+				op := ot.SequencedOperation{Operation: ot.NewInsert("x", 0, "user"), Revision: revision}
+				_ = store.AppendOperation(t.Context(), docID, op)
+				_, _ = store.LoadOperations(t.Context(), docID, revision-1)
+			}
+
+			_ = store.SetSlug(t.Context(), docID, "slug-"+docID)
+			_ = store.SaveSnapshot(t.Context(), docID, 50, strings.Repeat("x", 50))
+
+			if i%2 == 0 {
+				_ = store.DeleteDocument(t.Context(), docID)
+			}
+		})
+
+		wg.Go(func() {
+			_, _ = store.ListDocuments(t.Context())
+			_, _ = store.Usage(t.Context())
+			_, _ = store.ResolveSlug(t.Context(), "slug-"+docID)
+		})
+	}
+
+	wg.Wait()
+
+	docIDs, err := store.ListDocuments(t.Context())
+	require.NoError(t, err)
+	require.Len(t, docIDs, 10)
+
+	usage, err := store.Usage(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, storage.Usage{Documents: 10, Bytes: 500}, usage)
+
+	// Deleted documents free their slug
+	_, err = store.ResolveSlug(t.Context(), "slug-doc0")
+	require.ErrorIs(t, err, storage.ErrSlugNotFound)
+
+	docID, err := store.ResolveSlug(t.Context(), "slug-doc1")
+	require.NoError(t, err)
+	require.Equal(t, "doc1", docID)
+}
+
 func TestMemoryStore_SnapshotOverwrite(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
-	require.NoError(t, store.SaveSnapshot("doc1", 5, "first"))
-	require.NoError(t, store.SaveSnapshot("doc1", 10, "second"))
+	require.NoError(t, store.SaveSnapshot(t.Context(), "doc1", 5, "first"))
+	require.NoError(t, store.SaveSnapshot(t.Context(), "doc1", 10, "second"))
 
-	snapshot, _ := store.LoadSnapshot("doc1")
+	snapshot, _ := store.LoadSnapshot(t.Context(), "doc1")
 
 	if snapshot.Revision != 10 {
 		t.Errorf("expected revision 10, got %d", snapshot.Revision)
@@ -392,14 +610,194 @@ func TestMemoryStore_SnapshotOverwrite(t *testing.T) {
 	}
 }
 
+func TestMemoryStore_LoadMetadata(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+
+	_, err := store.LoadMetadata(t.Context(), "doc1")
+	require.ErrorIs(t, err, storage.ErrDocumentNotFound)
+
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	meta, err := store.LoadMetadata(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	if meta.DocID != "doc1" || meta.CreatedAt.IsZero() {
+		t.Errorf("expected document ID and creation time, got %+v", meta)
+	}
+
+	if !meta.LastEditedAt.IsZero() || meta.LastEditedBy != "" || meta.Editors != 0 {
+		t.Errorf("expected no edits yet, got %+v", meta)
+	}
+
+	for i, userID := range []string{"alice", "bob", "alice"} {
+		require.NoError(t, store.AppendOperation(t.Context(), "doc1", ot.SequencedOperation{
+			Operation: ot.NewInsert("x", i, userID),
+			Revision:  i + 1,
+		}))
+	}
+
+	// Compaction drops the operations but keeps the metadata
+	require.NoError(t, store.SaveSnapshot(t.Context(), "doc1", 3, "xxx"))
+
+	meta, err = store.LoadMetadata(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	if meta.LastEditedBy != "alice" || meta.Editors != 2 {
+		t.Errorf("expected last edit by alice and 2 editors, got %+v", meta)
+	}
+
+	if meta.LastEditedAt.Before(meta.CreatedAt) {
+		t.Errorf("expected last edit after creation, got %+v", meta)
+	}
+}
+
+func TestMemoryStore_SetTags(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.ErrorIs(t, store.SetTags(t.Context(), "doc1", []string{"a"}), storage.ErrDocumentNotFound)
+
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	tags := []string{"q1", "finance", "q1"}
+	require.NoError(t, store.SetTags(t.Context(), "doc1", tags))
+
+	// The store keeps its own copy
+	tags[0] = "changed"
+
+	meta, err := store.LoadMetadata(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"finance", "q1"}, meta.Tags)
+
+	meta.Tags[0] = "changed"
+
+	meta, err = store.LoadMetadata(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"finance", "q1"}, meta.Tags)
+
+	require.NoError(t, store.SetTags(t.Context(), "doc1", nil))
+
+	meta, err = store.LoadMetadata(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	if len(meta.Tags) != 0 {
+		t.Errorf("expected tags to be cleared, got %v", meta.Tags)
+	}
+}
+
+func TestMemoryStore_SetArchived(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.ErrorIs(t, store.SetArchived(t.Context(), "doc1", true), storage.ErrDocumentNotFound)
+
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.SetArchived(t.Context(), "doc1", true))
+
+	meta, err := store.LoadMetadata(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	archivedAt := meta.ArchivedAt
+	if archivedAt.IsZero() {
+		t.Fatal("expected an archive time")
+	}
+
+	// Archiving again keeps the original time
+	require.NoError(t, store.SetArchived(t.Context(), "doc1", true))
+
+	meta, err = store.LoadMetadata(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.Equal(t, archivedAt, meta.ArchivedAt)
+
+	require.NoError(t, store.SetArchived(t.Context(), "doc1", false))
+
+	meta, err = store.LoadMetadata(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	if !meta.ArchivedAt.IsZero() {
+		t.Errorf("expected no archive time after unarchiving, got %v", meta.ArchivedAt)
+	}
+}
+
+func TestMemoryStore_SetSlug(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.ErrorIs(t, store.SetSlug(t.Context(), "doc1", "q1-plan"), storage.ErrDocumentNotFound)
+
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc2"))
+	require.NoError(t, store.SetSlug(t.Context(), "doc1", "q1-plan"))
+	require.NoError(t, store.SetSlug(t.Context(), "doc1", "q1-plan"))
+	require.ErrorIs(t, store.SetSlug(t.Context(), "doc2", "q1-plan"), storage.ErrSlugTaken)
+
+	docID, err := store.ResolveSlug(t.Context(), "q1-plan")
+	require.NoError(t, err)
+	require.Equal(t, "doc1", docID)
+
+	meta, err := store.LoadMetadata(t.Context(), "doc1")
+	require.NoError(t, err)
+	require.Equal(t, "q1-plan", meta.Slug)
+
+	// Renaming frees the old slug
+	require.NoError(t, store.SetSlug(t.Context(), "doc1", "q2-plan"))
+
+	_, err = store.ResolveSlug(t.Context(), "q1-plan")
+	require.ErrorIs(t, err, storage.ErrSlugNotFound)
+	require.NoError(t, store.SetSlug(t.Context(), "doc2", "q1-plan"))
+
+	// Deleting frees the slug too
+	require.NoError(t, store.DeleteDocument(t.Context(), "doc1"))
+
+	_, err = store.ResolveSlug(t.Context(), "q2-plan")
+	require.ErrorIs(t, err, storage.ErrSlugNotFound)
+
+	require.NoError(t, store.SetSlug(t.Context(), "doc2", ""))
+
+	_, err = store.ResolveSlug(t.Context(), "q1-plan")
+	require.ErrorIs(t, err, storage.ErrSlugNotFound)
+}
+
+func TestMemoryStore_Usage(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+
+	usage, err := store.Usage(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, storage.Usage{}, usage)
+
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc2"))
+	require.NoError(t, store.SaveSnapshot(t.Context(), "doc1", 0, "hello"))
+	require.NoError(t, store.AppendOperation(t.Context(), "doc1", ot.SequencedOperation{
+		Operation: ot.Operation{Type: ot.Insert, Position: 5, Char: "!", UserID: "alice"},
+		Revision:  1,
+	}))
+
+	usage, err = store.Usage(t.Context())
+	require.NoError(t, err)
+
+	if usage.Documents != 2 {
+		t.Errorf("expected 2 documents, got %d", usage.Documents)
+	}
+
+	// The snapshot content plus one operation
+	if usage.Bytes <= int64(len("hello!alice")) {
+		t.Errorf("expected more than the raw content and operation strings, got %d bytes", usage.Bytes)
+	}
+}
+
 func TestMemoryStore_DeleteDocument(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	// Verify document exists
-	exists, err := store.DocumentExists("doc1")
+	exists, err := store.DocumentExists(t.Context(), "doc1")
 	require.NoError(t, err)
 
 	if !exists {
@@ -407,11 +805,11 @@ func TestMemoryStore_DeleteDocument(t *testing.T) {
 	}
 
 	// Delete the document
-	err = store.DeleteDocument("doc1")
+	err = store.DeleteDocument(t.Context(), "doc1")
 	require.NoError(t, err)
 
 	// Verify document no longer exists
-	exists, err = store.DocumentExists("doc1")
+	exists, err = store.DocumentExists(t.Context(), "doc1")
 	require.NoError(t, err)
 
 	if exists {
@@ -424,7 +822,7 @@ func TestMemoryStore_DeleteDocument_NotFound(t *testing.T) {
 
 	store := storage.NewMemoryStore()
 
-	err := store.DeleteDocument("nonexistent")
+	err := store.DeleteDocument(t.Context(), "nonexistent")
 
 	if !errors.Is(err, storage.ErrDocumentNotFound) {
 		t.Errorf("expected ErrDocumentNotFound, got %v", err)
@@ -435,26 +833,26 @@ func TestMemoryStore_DeleteDocument_WithData(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	// Add some data
-	require.NoError(t, store.SaveSnapshot("doc1", 5, "hello"))
-	require.NoError(t, store.AppendOperation("doc1", ot.SequencedOperation{
+	require.NoError(t, store.SaveSnapshot(t.Context(), "doc1", 5, "hello"))
+	require.NoError(t, store.AppendOperation(t.Context(), "doc1", ot.SequencedOperation{
 		Operation: ot.Operation{Type: ot.Insert, Position: 5, Char: "!"},
 		Revision:  6,
 	}))
 
 	// Delete should remove all data
-	require.NoError(t, store.DeleteDocument("doc1"))
+	require.NoError(t, store.DeleteDocument(t.Context(), "doc1"))
 
 	// Verify document is gone
-	exists, _ := store.DocumentExists("doc1")
+	exists, _ := store.DocumentExists(t.Context(), "doc1")
 	if exists {
 		t.Error("expected document to be deleted")
 	}
 
 	// Verify operations are gone
-	_, err := store.LoadOperations("doc1", 0)
+	_, err := store.LoadOperations(t.Context(), "doc1", 0)
 	if !errors.Is(err, storage.ErrDocumentNotFound) {
 		t.Errorf("expected ErrDocumentNotFound for operations, got %v", err)
 	}
@@ -468,7 +866,7 @@ func TestMemoryStore_DeleteDocument_Concurrent(t *testing.T) {
 	// Create multiple documents
 	for i := range 10 {
 		docID := string(rune('a' + i))
-		require.NoError(t, store.CreateDocument(docID))
+		require.NoError(t, store.CreateDocument(t.Context(), docID))
 	}
 
 	var wg sync.WaitGroup
@@ -481,7 +879,7 @@ func TestMemoryStore_DeleteDocument_Concurrent(t *testing.T) {
 			defer wg.Done()
 
 			docID := string(rune('a' + n))
-			_ = store.DeleteDocument(docID)
+			_ = store.DeleteDocument(t.Context(), docID)
 		}(i)
 	}
 
@@ -491,7 +889,7 @@ func TestMemoryStore_DeleteDocument_Concurrent(t *testing.T) {
 	for i := range 10 {
 		docID := string(rune('a' + i))
 
-		exists, _ := store.DocumentExists(docID)
+		exists, _ := store.DocumentExists(t.Context(), docID)
 		if exists {
 			t.Errorf("expected document %s to be deleted", docID)
 		}
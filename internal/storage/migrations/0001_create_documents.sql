@@ -0,0 +1,44 @@
+-- Documents, their latest snapshot and the operations after it.
+
+CREATE TABLE documents (
+    id             text PRIMARY KEY,
+    created_at     timestamptz NOT NULL DEFAULT now(),
+    last_edited_at timestamptz,
+    last_edited_by text NOT NULL DEFAULT '',
+    tags           text[] NOT NULL DEFAULT '{}',
+    archived_at    timestamptz,
+    slug           text UNIQUE,
+    fence          bigint NOT NULL DEFAULT 0 -- Highest fencing token a write was made with
+);
+
+CREATE TABLE snapshots (
+    doc_id     text PRIMARY KEY REFERENCES documents (id) ON DELETE CASCADE,
+    revision   integer NOT NULL,
+    content    text NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE operations (
+    doc_id   text NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+    revision integer NOT NULL,
+    op_type  smallint NOT NULL,
+    position integer NOT NULL,
+    char     text NOT NULL,
+    user_id  text NOT NULL,
+    PRIMARY KEY (doc_id, revision)
+);
+
+-- Everyone who has edited a document, kept when snapshots prune operations
+CREATE TABLE editors (
+    doc_id  text NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+    user_id text NOT NULL,
+    PRIMARY KEY (doc_id, user_id)
+);
+
+CREATE TABLE handoffs (
+    doc_id     text PRIMARY KEY REFERENCES documents (id) ON DELETE CASCADE,
+    revision   integer NOT NULL,
+    content    text NOT NULL,
+    history    jsonb NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,4 @@
+-- When each operation was sequenced, for the document's history. Operations
+-- stored before this have none.
+
+ALTER TABLE operations ADD COLUMN applied_at timestamptz;
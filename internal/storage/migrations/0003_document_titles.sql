@@ -0,0 +1,5 @@
+-- A name for each document, and arbitrary key/value properties.
+
+ALTER TABLE documents
+    ADD COLUMN title      text NOT NULL DEFAULT '',
+    ADD COLUMN properties jsonb NOT NULL DEFAULT '{}';
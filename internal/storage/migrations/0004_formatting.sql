@@ -0,0 +1,8 @@
+-- The attribute each format operation sets, and the formatting of each
+-- snapshot's content. Operations and snapshots stored before this are plain.
+
+ALTER TABLE operations
+    ADD COLUMN attribute text NOT NULL DEFAULT '',
+    ADD COLUMN value     text NOT NULL DEFAULT '';
+
+ALTER TABLE snapshots ADD COLUMN formatting jsonb;
@@ -0,0 +1,108 @@
+package storage_test
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+// newPostgresStore returns a migrated store in a schema of its own in the
+// database at $POSTGRES_TEST_URL, skipping the test if it isn't set.
+func newPostgresStore(t *testing.T) *storage.PostgresStore {
+	t.Helper()
+
+	dsn := os.Getenv("POSTGRES_TEST_URL")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_URL isn't set")
+	}
+
+	conn, err := pgx.Connect(t.Context(), dsn)
+	require.NoError(t, err)
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	_, err = conn.Exec(t.Context(), "CREATE SCHEMA "+schema)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_, _ = conn.Exec(t.Context(), "DROP SCHEMA "+schema+" CASCADE")
+		_ = conn.Close(t.Context())
+	})
+
+	u, err := url.Parse(dsn)
+	require.NoError(t, err)
+
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+
+	store, err := storage.NewPostgresStore(t.Context(), u.String())
+	require.NoError(t, err)
+	t.Cleanup(store.Close)
+
+	require.NoError(t, store.Migrate(t.Context()))
+
+	return store
+}
+
+func TestMigrations(t *testing.T) {
+	t.Parallel()
+
+	migrations, err := storage.Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	// Versions count up from 1, so none is skipped on databases that have
+	// the ones after it
+	for i, m := range migrations {
+		require.Equal(t, i+1, m.Version, m.Name)
+		require.True(t, strings.HasSuffix(m.Name, ".sql"), m.Name)
+		require.NotEmpty(t, strings.TrimSpace(m.SQL), m.Name)
+	}
+}
+
+func TestPostgresStore_Migrate(t *testing.T) {
+	t.Parallel()
+
+	store := newPostgresStore(t)
+
+	// Migrating again finds nothing to do
+	require.NoError(t, store.Migrate(t.Context()))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+}
+
+func TestPostgresStore_Conformance(t *testing.T) {
+	t.Parallel()
+
+	storagetest.Run(t, func(t *testing.T) storage.Store { return newPostgresStore(t) })
+}
+
+func TestPostgresStore_AppendTwice(t *testing.T) {
+	t.Parallel()
+
+	store := newPostgresStore(t)
+	ctx := t.Context()
+
+	require.NoError(t, store.CreateDocument(ctx, "doc1"))
+
+	ops := []ot.SequencedOperation{
+		{Operation: ot.NewInsert("a", 0, "alice"), Revision: 1},
+		{Operation: ot.NewInsert("b", 1, "alice"), Revision: 2},
+	}
+	require.NoError(t, store.AppendOperations(ctx, "doc1", ops))
+
+	// A retried batch isn't stored twice
+	require.NoError(t, store.AppendOperations(ctx, "doc1", ops[1:]))
+
+	loaded, err := store.LoadOperations(ctx, "doc1", 0)
+	require.NoError(t, err)
+	require.Equal(t, ops, loaded)
+}
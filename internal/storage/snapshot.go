@@ -1,8 +1,13 @@
 package storage
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"math"
 	"sync"
+
+	"github.com/serroba/online-docs/internal/ot"
 )
 
 // SnapshotPolicy determines when to create snapshots.
@@ -60,38 +65,61 @@ func NewDocumentLoader(store Store) *DocumentLoader {
 
 // LoadResult contains the result of loading a document.
 type LoadResult struct {
-	Content  string // Reconstructed document content
-	Revision int    // Current revision
-	IsNew    bool   // True if document didn't exist
+	Content    string    // Reconstructed document content
+	Formatting []ot.Mark // Runs of formatted characters in Content, nil if it's plain text
+	Revision   int       // Current revision
+	IsNew      bool      // True if document didn't exist
 }
 
-// ApplyFunc is a function that applies an operation to content.
-type ApplyFunc func(content string, op Operation) (string, error)
+// ApplyFunc is a function that applies an operation to a document.
+type ApplyFunc func(doc *ot.Document, op Operation) error
 
 // Load reconstructs a document's state from storage.
-// It loads the latest snapshot and replays any operations since.
-func (l *DocumentLoader) Load(docID string, applyOp ApplyFunc) (LoadResult, error) {
-	// Try to load snapshot
-	snapshot, err := l.store.LoadSnapshot(docID)
+// It loads the latest snapshot and replays any operations since, stopping
+// with the context's error if ctx is done first.
+func (l *DocumentLoader) Load(ctx context.Context, docID string, applyOp ApplyFunc) (LoadResult, error) {
+	return l.replay(ctx, docID, math.MaxInt, applyOp)
+}
 
-	var content string
+// LoadAt reconstructs a document's content as of the given revision.
+// It starts from the latest snapshot and replays operations up to that revision.
+// Returns ErrRevisionCompacted if the revision predates the latest snapshot,
+// or ErrRevisionNotFound if the revision has not been reached yet.
+func (l *DocumentLoader) LoadAt(
+	ctx context.Context, docID string, revision int, applyOp ApplyFunc,
+) (LoadResult, error) {
+	if revision < 0 {
+		return LoadResult{}, ErrRevisionNotFound
+	}
 
-	var startRevision int
+	result, err := l.replay(ctx, docID, revision, applyOp)
+	if err != nil {
+		return LoadResult{}, err
+	}
 
-	switch {
-	case errors.Is(err, ErrSnapshotNotFound):
-		// No snapshot - start from empty
-		content = ""
-		startRevision = 0
-	case err != nil:
+	if result.Revision != revision {
+		return LoadResult{}, ErrRevisionNotFound
+	}
+
+	return result, nil
+}
+
+// replay loads the latest snapshot and applies operations up to untilRevision.
+func (l *DocumentLoader) replay(
+	ctx context.Context, docID string, untilRevision int, applyOp ApplyFunc,
+) (LoadResult, error) {
+	doc, startRevision, err := l.base(ctx, docID)
+	if err != nil {
 		return LoadResult{}, err
-	default:
-		content = snapshot.Content
-		startRevision = snapshot.Revision
+	}
+
+	// Operations before the snapshot have been pruned
+	if startRevision > untilRevision {
+		return LoadResult{}, ErrRevisionCompacted
 	}
 
 	// Load operations since snapshot
-	ops, err := l.store.LoadOperations(docID, startRevision)
+	ops, err := l.store.LoadOperations(ctx, docID, startRevision)
 	if err != nil {
 		return LoadResult{}, err
 	}
@@ -100,12 +128,16 @@ func (l *DocumentLoader) Load(docID string, applyOp ApplyFunc) (LoadResult, erro
 	currentRevision := startRevision
 
 	for _, op := range ops {
-		content, err = applyOp(content, Operation{
-			Type:     int(op.Type),
-			Position: op.Position,
-			Char:     op.Char,
-		})
-		if err != nil {
+		if op.Revision > untilRevision {
+			break
+		}
+
+		// Stop replaying long histories once the caller has gone
+		if err := ctx.Err(); err != nil {
+			return LoadResult{}, err
+		}
+
+		if err := applyOp(doc, newOperation(op)); err != nil {
 			return LoadResult{}, err
 		}
 
@@ -113,15 +145,49 @@ func (l *DocumentLoader) Load(docID string, applyOp ApplyFunc) (LoadResult, erro
 	}
 
 	return LoadResult{
-		Content:  content,
-		Revision: currentRevision,
-		IsNew:    startRevision == 0 && len(ops) == 0,
+		Content:    doc.Content(),
+		Formatting: doc.Marks(),
+		Revision:   currentRevision,
+		IsNew:      startRevision == 0 && len(ops) == 0,
 	}, nil
 }
 
-// Operation mirrors ot.Operation for the loader to avoid circular imports.
+// base returns the document and revision of the latest snapshot, which replay
+// starts from, or an empty document if there is none.
+func (l *DocumentLoader) base(ctx context.Context, docID string) (*ot.Document, int, error) {
+	snapshot, err := l.store.LoadSnapshot(ctx, docID)
+
+	switch {
+	case errors.Is(err, ErrSnapshotNotFound):
+		return ot.NewDocument(""), 0, nil
+	case err != nil:
+		return nil, 0, err
+	}
+
+	doc, err := ot.NewFormattedDocument(snapshot.Content, snapshot.Formatting)
+	if err != nil {
+		return nil, 0, fmt.Errorf("snapshot of %s at revision %d: %w", docID, snapshot.Revision, err)
+	}
+
+	return doc, snapshot.Revision, nil
+}
+
+// Operation is a stored operation as the loader hands it to an ApplyFunc.
 type Operation struct {
-	Type     int
-	Position int
-	Char     string
+	Type      int
+	Position  int
+	Char      string
+	Attribute string // Attribute a format operation sets
+	Value     string // Value it sets the attribute to, empty to clear it
+}
+
+// newOperation converts a stored operation for an ApplyFunc.
+func newOperation(op ot.SequencedOperation) Operation {
+	return Operation{
+		Type:      int(op.Type),
+		Position:  op.Position,
+		Char:      op.Char,
+		Attribute: op.Attribute,
+		Value:     op.Value,
+	}
 }
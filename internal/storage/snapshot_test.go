@@ -1,7 +1,9 @@
 package storage_test
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/serroba/online-docs/internal/ot"
@@ -120,11 +122,11 @@ func TestDocumentLoader_LoadEmpty(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	loader := storage.NewDocumentLoader(store)
 
-	result, err := loader.Load("doc1", mockApplyOp)
+	result, err := loader.Load(t.Context(), "doc1", mockApplyOp)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -146,12 +148,12 @@ func TestDocumentLoader_LoadFromSnapshot(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
-	require.NoError(t, store.SaveSnapshot("doc1", 10, "hello"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.SaveSnapshot(t.Context(), "doc1", 10, "hello"))
 
 	loader := storage.NewDocumentLoader(store)
 
-	result, err := loader.Load("doc1", mockApplyOp)
+	result, err := loader.Load(t.Context(), "doc1", mockApplyOp)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -173,24 +175,24 @@ func TestDocumentLoader_LoadWithReplay(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	// Snapshot at revision 2 with content "ab"
-	require.NoError(t, store.SaveSnapshot("doc1", 2, "ab"))
+	require.NoError(t, store.SaveSnapshot(t.Context(), "doc1", 2, "ab"))
 
 	// Operations since snapshot
-	require.NoError(t, store.AppendOperation("doc1", ot.SequencedOperation{
+	require.NoError(t, store.AppendOperation(t.Context(), "doc1", ot.SequencedOperation{
 		Operation: ot.NewInsert("c", 2, "user"),
 		Revision:  3,
 	}))
-	require.NoError(t, store.AppendOperation("doc1", ot.SequencedOperation{
+	require.NoError(t, store.AppendOperation(t.Context(), "doc1", ot.SequencedOperation{
 		Operation: ot.NewInsert("d", 3, "user"),
 		Revision:  4,
 	}))
 
 	loader := storage.NewDocumentLoader(store)
 
-	result, err := loader.Load("doc1", mockApplyOp)
+	result, err := loader.Load(t.Context(), "doc1", mockApplyOp)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -205,25 +207,56 @@ func TestDocumentLoader_LoadWithReplay(t *testing.T) {
 	}
 }
 
+func TestDocumentLoader_LoadFormatting(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	// Snapshot at revision 1 with a bold "a", then an italic "b"
+	bold := []ot.Mark{{Start: 0, End: 1, Attributes: ot.Attributes{"bold": "true"}}}
+	require.NoError(t, store.SaveFormattedSnapshot(t.Context(), "doc1", 1, "ab", bold))
+	require.NoError(t, store.AppendOperation(t.Context(), "doc1", ot.SequencedOperation{
+		Operation: ot.NewFormat(1, "italic", "true", "user"),
+		Revision:  2,
+	}))
+
+	result, err := storage.NewDocumentLoader(store).Load(t.Context(), "doc1", mockApplyOp)
+	require.NoError(t, err)
+
+	want := []ot.Mark{
+		{Start: 0, End: 1, Attributes: ot.Attributes{"bold": "true"}},
+		{Start: 1, End: 2, Attributes: ot.Attributes{"italic": "true"}},
+	}
+	require.Equal(t, want, result.Formatting)
+
+	// A snapshot whose formatting doesn't fit its content can't be loaded
+	outside := []ot.Mark{{Start: 1, End: 5, Attributes: ot.Attributes{"bold": "true"}}}
+	require.NoError(t, store.SaveFormattedSnapshot(t.Context(), "doc1", 2, "ab", outside))
+
+	_, err = storage.NewDocumentLoader(store).Load(t.Context(), "doc1", mockApplyOp)
+	require.ErrorIs(t, err, ot.ErrInvalidPosition)
+}
+
 func TestDocumentLoader_LoadOperationsOnly(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
 
 	// No snapshot, just operations
-	require.NoError(t, store.AppendOperation("doc1", ot.SequencedOperation{
+	require.NoError(t, store.AppendOperation(t.Context(), "doc1", ot.SequencedOperation{
 		Operation: ot.NewInsert("a", 0, "user"),
 		Revision:  1,
 	}))
-	require.NoError(t, store.AppendOperation("doc1", ot.SequencedOperation{
+	require.NoError(t, store.AppendOperation(t.Context(), "doc1", ot.SequencedOperation{
 		Operation: ot.NewInsert("b", 1, "user"),
 		Revision:  2,
 	}))
 
 	loader := storage.NewDocumentLoader(store)
 
-	result, err := loader.Load("doc1", mockApplyOp)
+	result, err := loader.Load(t.Context(), "doc1", mockApplyOp)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -249,7 +282,7 @@ func TestDocumentLoader_LoadOperationsError(t *testing.T) {
 	}
 	loader := storage.NewDocumentLoader(store)
 
-	_, err := loader.Load("doc1", mockApplyOp)
+	_, err := loader.Load(t.Context(), "doc1", mockApplyOp)
 	if err == nil {
 		t.Error("expected error from LoadOperations")
 	}
@@ -259,19 +292,19 @@ func TestDocumentLoader_ApplyOpError(t *testing.T) {
 	t.Parallel()
 
 	store := storage.NewMemoryStore()
-	require.NoError(t, store.CreateDocument("doc1"))
-	require.NoError(t, store.AppendOperation("doc1", ot.SequencedOperation{
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.AppendOperation(t.Context(), "doc1", ot.SequencedOperation{
 		Operation: ot.NewInsert("a", 0, "user"),
 		Revision:  1,
 	}))
 
 	loader := storage.NewDocumentLoader(store)
 
-	failingApply := func(_ string, _ storage.Operation) (string, error) {
-		return "", errors.New("apply failed")
+	failingApply := func(_ *ot.Document, _ storage.Operation) error {
+		return errors.New("apply failed")
 	}
 
-	_, err := loader.Load("doc1", failingApply)
+	_, err := loader.Load(t.Context(), "doc1", failingApply)
 	if err == nil {
 		t.Error("expected error from applyOp")
 	}
@@ -285,7 +318,111 @@ func TestDocumentLoader_LoadSnapshotError(t *testing.T) {
 	}
 	loader := storage.NewDocumentLoader(store)
 
-	_, err := loader.Load("doc1", mockApplyOp)
+	_, err := loader.Load(t.Context(), "doc1", mockApplyOp)
+	if err == nil {
+		t.Error("expected error from LoadSnapshot")
+	}
+}
+
+func TestDocumentLoader_LoadCanceled(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.AppendOperation(t.Context(), "doc1", ot.SequencedOperation{
+		Operation: ot.Operation{Type: ot.Insert, Position: 0, Char: "a"},
+		Revision:  1,
+	}))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	_, err := storage.NewDocumentLoader(store).Load(ctx, "doc1", mockApplyOp)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestDocumentLoader_LoadAt(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+	require.NoError(t, store.SaveSnapshot(t.Context(), "doc1", 2, "ab"))
+	require.NoError(t, store.AppendOperation(t.Context(), "doc1", ot.SequencedOperation{
+		Operation: ot.NewInsert("c", 2, "user"),
+		Revision:  3,
+	}))
+	require.NoError(t, store.AppendOperation(t.Context(), "doc1", ot.SequencedOperation{
+		Operation: ot.NewInsert("d", 3, "user"),
+		Revision:  4,
+	}))
+
+	loader := storage.NewDocumentLoader(store)
+
+	t.Run("replays up to the requested revision", func(t *testing.T) {
+		t.Parallel()
+
+		result, err := loader.LoadAt(t.Context(), "doc1", 3, mockApplyOp)
+		require.NoError(t, err)
+
+		if result.Content != "abc" {
+			t.Errorf("expected content 'abc', got %q", result.Content)
+		}
+
+		if result.Revision != 3 {
+			t.Errorf("expected revision 3, got %d", result.Revision)
+		}
+	})
+
+	t.Run("returns snapshot content at snapshot revision", func(t *testing.T) {
+		t.Parallel()
+
+		result, err := loader.LoadAt(t.Context(), "doc1", 2, mockApplyOp)
+		require.NoError(t, err)
+
+		if result.Content != "ab" {
+			t.Errorf("expected content 'ab', got %q", result.Content)
+		}
+	})
+
+	t.Run("returns ErrRevisionCompacted before snapshot", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := loader.LoadAt(t.Context(), "doc1", 1, mockApplyOp)
+		if !errors.Is(err, storage.ErrRevisionCompacted) {
+			t.Errorf("expected ErrRevisionCompacted, got %v", err)
+		}
+	})
+
+	t.Run("returns ErrRevisionNotFound beyond head", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := loader.LoadAt(t.Context(), "doc1", 5, mockApplyOp)
+		if !errors.Is(err, storage.ErrRevisionNotFound) {
+			t.Errorf("expected ErrRevisionNotFound, got %v", err)
+		}
+	})
+
+	t.Run("returns ErrRevisionNotFound for negative revision", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := loader.LoadAt(t.Context(), "doc1", -1, mockApplyOp)
+		if !errors.Is(err, storage.ErrRevisionNotFound) {
+			t.Errorf("expected ErrRevisionNotFound, got %v", err)
+		}
+	})
+}
+
+func TestDocumentLoader_LoadAtError(t *testing.T) {
+	t.Parallel()
+
+	store := &errorStore{
+		loadSnapshotErr: errors.New("snapshot error"),
+	}
+	loader := storage.NewDocumentLoader(store)
+
+	_, err := loader.LoadAt(t.Context(), "doc1", 1, mockApplyOp)
 	if err == nil {
 		t.Error("expected error from LoadSnapshot")
 	}
@@ -297,19 +434,27 @@ type errorStore struct {
 	loadOpsErr      error
 }
 
-func (e *errorStore) CreateDocument(_ string) error {
+func (e *errorStore) CreateDocument(_ context.Context, _ string) error {
+	return nil
+}
+
+func (e *errorStore) CreateDocumentFromSnapshot(_ context.Context, _, _ string) error {
 	return nil
 }
 
-func (e *errorStore) DocumentExists(_ string) (bool, error) {
+func (e *errorStore) DocumentExists(_ context.Context, _ string) (bool, error) {
 	return true, nil
 }
 
-func (e *errorStore) SaveSnapshot(_ string, _ int, _ string) error {
+func (e *errorStore) SaveSnapshot(_ context.Context, _ string, _ int, _ string) error {
 	return nil
 }
 
-func (e *errorStore) LoadSnapshot(_ string) (storage.Snapshot, error) {
+func (e *errorStore) SaveFormattedSnapshot(_ context.Context, _ string, _ int, _ string, _ []ot.Mark) error {
+	return nil
+}
+
+func (e *errorStore) LoadSnapshot(_ context.Context, _ string) (storage.Snapshot, error) {
 	if e.loadSnapshotErr != nil {
 		return storage.Snapshot{}, e.loadSnapshotErr
 	}
@@ -317,40 +462,111 @@ func (e *errorStore) LoadSnapshot(_ string) (storage.Snapshot, error) {
 	return storage.Snapshot{}, storage.ErrSnapshotNotFound
 }
 
-func (e *errorStore) AppendOperation(_ string, _ ot.SequencedOperation) error {
+func (e *errorStore) SaveHandoff(_ context.Context, _ storage.Handoff) error {
+	return nil
+}
+
+func (e *errorStore) TakeHandoff(_ context.Context, _ string) (storage.Handoff, error) {
+	return storage.Handoff{}, storage.ErrHandoffNotFound
+}
+
+func (e *errorStore) AppendOperation(_ context.Context, _ string, _ ot.SequencedOperation) error {
+	return nil
+}
+
+func (e *errorStore) AppendOperations(_ context.Context, _ string, _ []ot.SequencedOperation) error {
 	return nil
 }
 
-func (e *errorStore) LoadOperations(_ string, _ int) ([]ot.SequencedOperation, error) {
+func (e *errorStore) LoadOperations(_ context.Context, _ string, _ int) ([]ot.SequencedOperation, error) {
 	return nil, e.loadOpsErr
 }
 
-func (e *errorStore) LatestRevision(_ string) (int, error) {
+func (e *errorStore) LatestRevision(_ context.Context, _ string) (int, error) {
 	return 0, nil
 }
 
-func (e *errorStore) DeleteDocument(_ string) error {
+func (e *errorStore) LoadMetadata(_ context.Context, docID string) (storage.Metadata, error) {
+	return storage.Metadata{DocID: docID}, nil
+}
+
+func (e *errorStore) SetTags(_ context.Context, _ string, _ []string) error {
 	return nil
 }
 
-// mockApplyOp simulates applying an operation to content.
-func mockApplyOp(content string, op storage.Operation) (string, error) {
-	runes := []rune(content)
+func (e *errorStore) SetTitle(_ context.Context, _, _ string) error {
+	return nil
+}
 
-	if op.Type == int(ot.Insert) {
-		// Insert
-		newRunes := make([]rune, 0, len(runes)+len(op.Char))
-		newRunes = append(newRunes, runes[:op.Position]...)
-		newRunes = append(newRunes, []rune(op.Char)...)
-		newRunes = append(newRunes, runes[op.Position:]...)
+func (e *errorStore) SetProperties(_ context.Context, _ string, _ map[string]string) error {
+	return nil
+}
 
-		return string(newRunes), nil
-	}
+func (e *errorStore) UpdateDetails(_ context.Context, _ string, _ storage.DetailsUpdate) error {
+	return nil
+}
+
+func (e *errorStore) SetArchived(_ context.Context, _ string, _ bool) error {
+	return nil
+}
+
+func (e *errorStore) SetSlug(_ context.Context, _, _ string) error {
+	return nil
+}
+
+func (e *errorStore) ResolveSlug(_ context.Context, _ string) (string, error) {
+	return "", storage.ErrSlugNotFound
+}
+
+func (e *errorStore) Usage(_ context.Context) (storage.Usage, error) {
+	return storage.Usage{}, nil
+}
+
+func (e *errorStore) DeleteDocument(_ context.Context, _ string) error {
+	return nil
+}
+
+func (e *errorStore) ListDocuments(_ context.Context) ([]string, error) {
+	return nil, nil
+}
 
-	// Delete
-	newRunes := make([]rune, 0, len(runes)-1)
-	newRunes = append(newRunes, runes[:op.Position]...)
-	newRunes = append(newRunes, runes[op.Position+1:]...)
+func (e *errorStore) ResetDocument(_ context.Context, _ string, _ int, _ string) error {
+	return nil
+}
 
-	return string(newRunes), nil
+// mockApplyOp simulates applying an operation to content.
+func mockApplyOp(doc *ot.Document, op storage.Operation) error {
+	return doc.Apply(ot.Operation{
+		Type:      ot.OpType(op.Type),
+		Position:  op.Position,
+		Char:      op.Char,
+		Attribute: op.Attribute,
+		Value:     op.Value,
+	})
+}
+
+func BenchmarkDocumentLoader_Load(b *testing.B) {
+	for _, count := range []int{100, 1000} {
+		b.Run(fmt.Sprintf("ops=%d", count), func(b *testing.B) {
+			store := storage.NewMemoryStore()
+			if err := store.CreateDocument(b.Context(), "doc1"); err != nil {
+				b.Fatal(err)
+			}
+
+			for i := range count {
+				op := ot.SequencedOperation{Operation: ot.NewInsert("a", i, "u1"), Revision: i + 1}
+				if err := store.AppendOperation(b.Context(), "doc1", op); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			loader := storage.NewDocumentLoader(store)
+
+			for b.Loop() {
+				if _, err := loader.Load(b.Context(), "doc1", mockApplyOp); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
 }
@@ -0,0 +1,559 @@
+// Package storagetest checks that implementations of storage.Store behave
+// alike, so the server works the same whichever backend it's given.
+package storagetest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// Run runs the conformance tests as subtests of t, in parallel. newStore is
+// called once per subtest and must return an empty store.
+func Run(t *testing.T, newStore func(t *testing.T) storage.Store) {
+	t.Helper()
+
+	tests := []struct {
+		name string
+		test func(t *testing.T, store storage.Store)
+	}{
+		{"Documents", testDocuments},
+		{"Operations", testOperations},
+		{"OutOfOrder", testOutOfOrder},
+		{"Snapshots", testSnapshots},
+		{"Formatting", testFormatting},
+		{"Reset", testReset},
+		{"NotFound", testNotFound},
+		{"FencingToken", testFencingToken},
+		{"Handoff", testHandoff},
+		{"Metadata", testMetadata},
+		{"Details", testDetails},
+		{"Slugs", testSlugs},
+		{"Usage", testUsage},
+		{"Concurrent", testConcurrent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+func testDocuments(t *testing.T, store storage.Store) {
+	ctx := t.Context()
+
+	require.NoError(t, store.CreateDocument(ctx, "doc2"))
+	require.NoError(t, store.CreateDocument(ctx, "Doc1"))
+	require.ErrorIs(t, store.CreateDocument(ctx, "doc2"), storage.ErrDocumentExists)
+
+	exists, err := store.DocumentExists(ctx, "doc2")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	exists, err = store.DocumentExists(ctx, "missing")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	docIDs, err := store.ListDocuments(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Doc1", "doc2"}, docIDs)
+
+	require.NoError(t, store.DeleteDocument(ctx, "doc2"))
+	require.ErrorIs(t, store.DeleteDocument(ctx, "doc2"), storage.ErrDocumentNotFound)
+
+	exists, err = store.DocumentExists(ctx, "doc2")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// A deleted document's ID can be reused, without its old data
+	require.NoError(t, store.CreateDocument(ctx, "doc2"))
+
+	_, err = store.LoadSnapshot(ctx, "doc2")
+	require.ErrorIs(t, err, storage.ErrSnapshotNotFound)
+
+	// A document can start from a snapshot
+	require.NoError(t, store.CreateDocumentFromSnapshot(ctx, "doc3", "hello"))
+	require.ErrorIs(t, store.CreateDocumentFromSnapshot(ctx, "doc3", "hello"), storage.ErrDocumentExists)
+
+	snapshot, err := store.LoadSnapshot(ctx, "doc3")
+	require.NoError(t, err)
+	require.Equal(t, 0, snapshot.Revision)
+	require.Equal(t, "hello", snapshot.Content)
+
+	revision, err := store.LatestRevision(ctx, "doc3")
+	require.NoError(t, err)
+	require.Zero(t, revision)
+}
+
+func testOperations(t *testing.T, store storage.Store) {
+	ctx := t.Context()
+
+	require.NoError(t, store.CreateDocument(ctx, "doc1"))
+
+	revision, err := store.LatestRevision(ctx, "doc1")
+	require.NoError(t, err)
+	require.Zero(t, revision)
+
+	loaded, err := store.LoadOperations(ctx, "doc1", 0)
+	require.NoError(t, err)
+	require.Empty(t, loaded)
+
+	// Timestamps are kept to the microsecond, and may be missing
+	applied := time.Date(2024, 1, 15, 10, 30, 0, 123456000, time.UTC)
+
+	ops := []ot.SequencedOperation{
+		{Operation: ot.NewInsert("h", 0, "alice"), Revision: 1, Timestamp: applied},
+		{Operation: ot.NewInsert("é", 1, "bob"), Revision: 2, Timestamp: applied.Add(time.Second)},
+		{Operation: ot.NewDelete(1, "alice"), Revision: 3},
+		{Operation: ot.NewDelete(-1, "bob"), Revision: 4}, // A no-op
+	}
+	require.NoError(t, store.AppendOperations(ctx, "doc1", ops[:2]))
+	require.NoError(t, store.AppendOperation(ctx, "doc1", ops[2]))
+	require.NoError(t, store.AppendOperations(ctx, "doc1", ops[3:]))
+
+	loaded, err = store.LoadOperations(ctx, "doc1", 0)
+	require.NoError(t, err)
+	require.Equal(t, ops, loaded)
+
+	loaded, err = store.LoadOperations(ctx, "doc1", 2)
+	require.NoError(t, err)
+	require.Equal(t, ops[2:], loaded)
+
+	loaded, err = store.LoadOperations(ctx, "doc1", 4)
+	require.NoError(t, err)
+	require.Empty(t, loaded)
+
+	revision, err = store.LatestRevision(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, 4, revision)
+}
+
+func testOutOfOrder(t *testing.T, store storage.Store) {
+	ctx := t.Context()
+
+	require.NoError(t, store.CreateDocument(ctx, "doc1"))
+
+	for _, revision := range []int{3, 1, 5, 2, 4} {
+		op := ot.SequencedOperation{Operation: ot.NewInsert("x", 0, "user"), Revision: revision}
+		require.NoError(t, store.AppendOperation(ctx, "doc1", op))
+	}
+
+	for since, want := range map[int][]int{0: {1, 2, 3, 4, 5}, 2: {3, 4, 5}, 5: nil, 9: nil} {
+		loaded, err := store.LoadOperations(ctx, "doc1", since)
+		require.NoError(t, err)
+
+		var revisions []int
+		for _, op := range loaded {
+			revisions = append(revisions, op.Revision)
+		}
+
+		require.Equal(t, want, revisions, "since %d", since)
+	}
+}
+
+func testSnapshots(t *testing.T, store storage.Store) {
+	ctx := t.Context()
+
+	require.NoError(t, store.CreateDocument(ctx, "doc1"))
+
+	_, err := store.LoadSnapshot(ctx, "doc1")
+	require.ErrorIs(t, err, storage.ErrSnapshotNotFound)
+
+	ops := []ot.SequencedOperation{
+		{Operation: ot.NewInsert("a", 0, "alice"), Revision: 1},
+		{Operation: ot.NewInsert("b", 1, "alice"), Revision: 2},
+		{Operation: ot.NewInsert("c", 2, "alice"), Revision: 3},
+	}
+	require.NoError(t, store.AppendOperations(ctx, "doc1", ops))
+
+	// A snapshot prunes the operations it covers
+	require.NoError(t, store.SaveSnapshot(ctx, "doc1", 2, "ab"))
+
+	snapshot, err := store.LoadSnapshot(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, "doc1", snapshot.DocID)
+	require.Equal(t, 2, snapshot.Revision)
+	require.Equal(t, "ab", snapshot.Content)
+	require.False(t, snapshot.CreatedAt.IsZero())
+
+	loaded, err := store.LoadOperations(ctx, "doc1", 0)
+	require.NoError(t, err)
+	require.Equal(t, ops[2:], loaded)
+
+	// Operations stored after a snapshot that covers them don't lower the
+	// latest revision
+	require.NoError(t, store.SaveSnapshot(ctx, "doc1", 5, "abcde"))
+	require.NoError(t, store.AppendOperation(ctx, "doc1", ot.SequencedOperation{
+		Operation: ot.NewInsert("e", 4, "alice"), Revision: 5,
+	}))
+
+	revision, err := store.LatestRevision(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, 5, revision)
+
+	// A newer snapshot replaces the old one
+	snapshot, err = store.LoadSnapshot(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, 5, snapshot.Revision)
+	require.Equal(t, "abcde", snapshot.Content)
+}
+
+func testFormatting(t *testing.T, store storage.Store) {
+	ctx := t.Context()
+
+	require.NoError(t, store.CreateDocument(ctx, "doc1"))
+
+	// Formats keep the attribute they set
+	ops := []ot.SequencedOperation{
+		{Operation: ot.NewInsert("ab", 0, "alice"), Revision: 1},
+		{Operation: ot.NewFormat(0, "bold", "true", "alice"), Revision: 2},
+		{Operation: ot.NewFormat(0, "bold", "", "alice"), Revision: 3},
+	}
+	require.NoError(t, store.AppendOperations(ctx, "doc1", ops))
+
+	loaded, err := store.LoadOperations(ctx, "doc1", 0)
+	require.NoError(t, err)
+	require.Equal(t, ops, loaded)
+
+	// So do snapshots
+	formatting := []ot.Mark{{Start: 1, End: 2, Attributes: ot.Attributes{"bold": "true", "color": "red"}}}
+	require.NoError(t, store.SaveFormattedSnapshot(ctx, "doc1", 3, "ab", formatting))
+
+	snapshot, err := store.LoadSnapshot(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, "ab", snapshot.Content)
+	require.Equal(t, formatting, snapshot.Formatting)
+
+	// A plain snapshot replaces the formatting too
+	require.NoError(t, store.SaveSnapshot(ctx, "doc1", 3, "ab"))
+
+	snapshot, err = store.LoadSnapshot(ctx, "doc1")
+	require.NoError(t, err)
+	require.Nil(t, snapshot.Formatting)
+}
+
+func testReset(t *testing.T, store storage.Store) {
+	ctx := t.Context()
+
+	require.NoError(t, store.CreateDocument(ctx, "doc1"))
+	require.NoError(t, store.AppendOperations(ctx, "doc1", []ot.SequencedOperation{
+		{Operation: ot.NewInsert("a", 0, "alice"), Revision: 1},
+		{Operation: ot.NewInsert("b", 1, "alice"), Revision: 2},
+	}))
+	require.NoError(t, store.SaveHandoff(ctx, storage.Handoff{DocID: "doc1", Revision: 2, Content: "ab"}))
+
+	require.NoError(t, store.ResetDocument(ctx, "doc1", 1, "a"))
+
+	snapshot, err := store.LoadSnapshot(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, 1, snapshot.Revision)
+	require.Equal(t, "a", snapshot.Content)
+
+	loaded, err := store.LoadOperations(ctx, "doc1", 0)
+	require.NoError(t, err)
+	require.Empty(t, loaded)
+
+	revision, err := store.LatestRevision(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, 1, revision)
+
+	_, err = store.TakeHandoff(ctx, "doc1")
+	require.ErrorIs(t, err, storage.ErrHandoffNotFound)
+}
+
+func testNotFound(t *testing.T, store storage.Store) {
+	ctx := t.Context()
+	op := ot.SequencedOperation{Operation: ot.NewInsert("a", 0, "alice"), Revision: 1}
+
+	for name, err := range map[string]error{
+		"SaveSnapshot":     store.SaveSnapshot(ctx, "missing", 1, "a"),
+		"SaveHandoff":      store.SaveHandoff(ctx, storage.Handoff{DocID: "missing"}),
+		"AppendOperation":  store.AppendOperation(ctx, "missing", op),
+		"AppendOperations": store.AppendOperations(ctx, "missing", []ot.SequencedOperation{op}),
+		"SetTags":          store.SetTags(ctx, "missing", []string{"a"}),
+		"SetTitle":         store.SetTitle(ctx, "missing", "Plan"),
+		"SetProperties":    store.SetProperties(ctx, "missing", map[string]string{"a": "b"}),
+		"UpdateDetails":    store.UpdateDetails(ctx, "missing", storage.DetailsUpdate{}),
+		"SetArchived":      store.SetArchived(ctx, "missing", true),
+		"SetSlug":          store.SetSlug(ctx, "missing", "plan"),
+		"DeleteDocument":   store.DeleteDocument(ctx, "missing"),
+		"ResetDocument":    store.ResetDocument(ctx, "missing", 1, "a"),
+	} {
+		require.ErrorIs(t, err, storage.ErrDocumentNotFound, name)
+	}
+
+	_, err := store.LoadSnapshot(ctx, "missing")
+	require.ErrorIs(t, err, storage.ErrDocumentNotFound)
+
+	_, err = store.TakeHandoff(ctx, "missing")
+	require.ErrorIs(t, err, storage.ErrDocumentNotFound)
+
+	_, err = store.LoadOperations(ctx, "missing", 0)
+	require.ErrorIs(t, err, storage.ErrDocumentNotFound)
+
+	_, err = store.LatestRevision(ctx, "missing")
+	require.ErrorIs(t, err, storage.ErrDocumentNotFound)
+
+	_, err = store.LoadMetadata(ctx, "missing")
+	require.ErrorIs(t, err, storage.ErrDocumentNotFound)
+}
+
+func testFencingToken(t *testing.T, store storage.Store) {
+	ctx := t.Context()
+
+	require.NoError(t, store.CreateDocument(ctx, "doc1"))
+	require.NoError(t, store.CreateDocument(ctx, "doc2"))
+
+	op := ot.SequencedOperation{Operation: ot.NewInsert("a", 0, "alice"), Revision: 1}
+	require.NoError(t, store.AppendOperation(storage.WithFencingToken(ctx, 2), "doc1", op))
+
+	stale := storage.WithFencingToken(ctx, 1)
+	require.ErrorIs(t, store.AppendOperation(stale, "doc1", op), storage.ErrFenced)
+	require.ErrorIs(t, store.SaveSnapshot(stale, "doc1", 1, "a"), storage.ErrFenced)
+	require.ErrorIs(t, store.SaveHandoff(stale, storage.Handoff{DocID: "doc1"}), storage.ErrFenced)
+
+	// Rejected writes aren't applied
+	_, err := store.LoadSnapshot(ctx, "doc1")
+	require.ErrorIs(t, err, storage.ErrSnapshotNotFound)
+
+	// Unfenced writes, newer tokens and other documents go through
+	require.NoError(t, store.SaveSnapshot(ctx, "doc1", 1, "a"))
+	require.NoError(t, store.SaveSnapshot(storage.WithFencingToken(ctx, 3), "doc1", 1, "a"))
+	require.NoError(t, store.AppendOperation(stale, "doc2", op))
+	require.ErrorIs(t, store.AppendOperation(storage.WithFencingToken(ctx, 2), "doc1", op), storage.ErrFenced)
+}
+
+func testHandoff(t *testing.T, store storage.Store) {
+	ctx := t.Context()
+
+	require.NoError(t, store.CreateDocument(ctx, "doc1"))
+
+	_, err := store.TakeHandoff(ctx, "doc1")
+	require.ErrorIs(t, err, storage.ErrHandoffNotFound)
+
+	history := []ot.SequencedOperation{
+		{Operation: ot.NewInsert("a", 0, "alice"), Revision: 3},
+		{Operation: ot.NewDelete(0, "bob"), Revision: 4},
+	}
+	require.NoError(t, store.SaveHandoff(ctx, storage.Handoff{DocID: "doc1", Revision: 2, Content: "x"}))
+	require.NoError(t, store.SaveHandoff(ctx, storage.Handoff{DocID: "doc1", Revision: 4, Content: "a", History: history}))
+
+	// The latest handoff replaces the earlier one
+	handoff, err := store.TakeHandoff(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, "doc1", handoff.DocID)
+	require.Equal(t, 4, handoff.Revision)
+	require.Equal(t, "a", handoff.Content)
+	require.Equal(t, history, handoff.History)
+	require.False(t, handoff.CreatedAt.IsZero())
+
+	// It's taken at most once
+	_, err = store.TakeHandoff(ctx, "doc1")
+	require.ErrorIs(t, err, storage.ErrHandoffNotFound)
+}
+
+func testMetadata(t *testing.T, store storage.Store) {
+	ctx := t.Context()
+
+	require.NoError(t, store.CreateDocument(ctx, "doc1"))
+
+	metadata, err := store.LoadMetadata(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, "doc1", metadata.DocID)
+	require.False(t, metadata.CreatedAt.IsZero())
+	require.True(t, metadata.LastEditedAt.IsZero())
+	require.Zero(t, metadata.Editors)
+	require.Nil(t, metadata.Tags)
+	require.Empty(t, metadata.Title)
+	require.Nil(t, metadata.Properties)
+
+	require.NoError(t, store.AppendOperations(ctx, "doc1", []ot.SequencedOperation{
+		{Operation: ot.NewInsert("a", 0, "alice"), Revision: 1},
+		{Operation: ot.NewInsert("b", 1, "bob"), Revision: 2},
+		{Operation: ot.NewInsert("c", 2, "alice"), Revision: 3},
+	}))
+	require.NoError(t, store.SetTags(ctx, "doc1", []string{"b", "a", "b"}))
+	require.NoError(t, store.SetArchived(ctx, "doc1", true))
+	require.NoError(t, store.SetTitle(ctx, "doc1", "Roadmap"))
+	require.NoError(t, store.SetProperties(ctx, "doc1", map[string]string{"team": "docs", "status": "draft"}))
+
+	// Snapshots don't forget who edited
+	require.NoError(t, store.SaveSnapshot(ctx, "doc1", 3, "abc"))
+
+	metadata, err = store.LoadMetadata(ctx, "doc1")
+	require.NoError(t, err)
+	require.False(t, metadata.LastEditedAt.IsZero())
+	require.Equal(t, "alice", metadata.LastEditedBy)
+	require.Equal(t, 2, metadata.Editors)
+	require.Equal(t, []string{"a", "b"}, metadata.Tags)
+	require.False(t, metadata.ArchivedAt.IsZero())
+	require.Equal(t, "Roadmap", metadata.Title)
+	require.Equal(t, map[string]string{"team": "docs", "status": "draft"}, metadata.Properties)
+
+	// Archiving again keeps the original time
+	require.NoError(t, store.SetArchived(ctx, "doc1", true))
+
+	again, err := store.LoadMetadata(ctx, "doc1")
+	require.NoError(t, err)
+	require.True(t, metadata.ArchivedAt.Equal(again.ArchivedAt))
+
+	require.NoError(t, store.SetArchived(ctx, "doc1", false))
+	require.NoError(t, store.SetTags(ctx, "doc1", nil))
+	require.NoError(t, store.SetTitle(ctx, "doc1", ""))
+	require.NoError(t, store.SetProperties(ctx, "doc1", map[string]string{}))
+
+	again, err = store.LoadMetadata(ctx, "doc1")
+	require.NoError(t, err)
+	require.True(t, again.ArchivedAt.IsZero())
+	require.Nil(t, again.Tags)
+	require.Empty(t, again.Title)
+	require.Nil(t, again.Properties)
+}
+
+func testDetails(t *testing.T, store storage.Store) {
+	ctx := t.Context()
+
+	require.NoError(t, store.CreateDocument(ctx, "doc1"))
+
+	title := "Roadmap"
+	require.NoError(t, store.UpdateDetails(ctx, "doc1", storage.DetailsUpdate{
+		Title: &title, Based: &storage.Details{},
+	}))
+
+	// An update based on details that changed since is refused
+	properties := map[string]string{"team": "docs"}
+	err := store.UpdateDetails(ctx, "doc1", storage.DetailsUpdate{Properties: properties, Based: &storage.Details{}})
+	require.ErrorIs(t, err, storage.ErrDetailsChanged)
+
+	require.NoError(t, store.UpdateDetails(ctx, "doc1", storage.DetailsUpdate{
+		Properties: properties, Based: &storage.Details{Title: "Roadmap"},
+	}))
+
+	metadata, err := store.LoadMetadata(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, "Roadmap", metadata.Title)
+	require.Equal(t, properties, metadata.Properties)
+
+	// Without a base it applies regardless, and empty properties remove them
+	title = ""
+	require.NoError(t, store.UpdateDetails(ctx, "doc1", storage.DetailsUpdate{
+		Title: &title, Properties: map[string]string{},
+	}))
+
+	metadata, err = store.LoadMetadata(ctx, "doc1")
+	require.NoError(t, err)
+	require.Empty(t, metadata.Title)
+	require.Nil(t, metadata.Properties)
+}
+
+func testSlugs(t *testing.T, store storage.Store) {
+	ctx := t.Context()
+
+	require.NoError(t, store.CreateDocument(ctx, "doc1"))
+	require.NoError(t, store.CreateDocument(ctx, "doc2"))
+
+	_, err := store.ResolveSlug(ctx, "plan")
+	require.ErrorIs(t, err, storage.ErrSlugNotFound)
+
+	require.NoError(t, store.SetSlug(ctx, "doc1", "plan"))
+	require.ErrorIs(t, store.SetSlug(ctx, "doc2", "plan"), storage.ErrSlugTaken)
+
+	// Setting the same slug again is fine
+	require.NoError(t, store.SetSlug(ctx, "doc1", "plan"))
+
+	docID, err := store.ResolveSlug(ctx, "plan")
+	require.NoError(t, err)
+	require.Equal(t, "doc1", docID)
+
+	metadata, err := store.LoadMetadata(ctx, "doc1")
+	require.NoError(t, err)
+	require.Equal(t, "plan", metadata.Slug)
+
+	// Renaming frees the old slug
+	require.NoError(t, store.SetSlug(ctx, "doc1", "roadmap"))
+	require.NoError(t, store.SetSlug(ctx, "doc2", "plan"))
+
+	// So do removing it and deleting the document
+	require.NoError(t, store.SetSlug(ctx, "doc2", ""))
+	require.NoError(t, store.DeleteDocument(ctx, "doc1"))
+
+	for _, slug := range []string{"plan", "roadmap"} {
+		_, err = store.ResolveSlug(ctx, slug)
+		require.ErrorIs(t, err, storage.ErrSlugNotFound, slug)
+	}
+}
+
+func testUsage(t *testing.T, store storage.Store) {
+	ctx := t.Context()
+
+	usage, err := store.Usage(ctx)
+	require.NoError(t, err)
+	require.Equal(t, storage.Usage{}, usage)
+
+	require.NoError(t, store.CreateDocument(ctx, "doc1"))
+	require.NoError(t, store.CreateDocument(ctx, "doc2"))
+	require.NoError(t, store.SaveSnapshot(ctx, "doc1", 5, "hello"))
+	require.NoError(t, store.SaveSnapshot(ctx, "doc2", 5, "hi"))
+
+	usage, err = store.Usage(ctx)
+	require.NoError(t, err)
+	require.Equal(t, storage.Usage{Documents: 2, Bytes: int64(len("hello") + len("hi"))}, usage)
+
+	// Operations count too
+	require.NoError(t, store.AppendOperation(ctx, "doc1", ot.SequencedOperation{
+		Operation: ot.NewInsert("!", 5, "alice"), Revision: 6,
+	}))
+
+	grown, err := store.Usage(ctx)
+	require.NoError(t, err)
+	require.Greater(t, grown.Bytes, usage.Bytes)
+
+	require.NoError(t, store.DeleteDocument(ctx, "doc1"))
+
+	usage, err = store.Usage(ctx)
+	require.NoError(t, err)
+	require.Equal(t, storage.Usage{Documents: 1, Bytes: int64(len("hi"))}, usage)
+}
+
+func testConcurrent(t *testing.T, store storage.Store) {
+	ctx := t.Context()
+
+	const writers, opsPerWriter = 4, 25
+
+	require.NoError(t, store.CreateDocument(ctx, "doc1"))
+
+	var wg sync.WaitGroup
+
+	errs := make(chan error, writers*opsPerWriter)
+
+	for w := range writers {
+		wg.Go(func() {
+			for i := range opsPerWriter {
+				op := ot.SequencedOperation{Operation: ot.NewInsert("x", 0, "user"), Revision: 1 + w*opsPerWriter + i}
+				errs <- store.AppendOperation(ctx, "doc1", op)
+			}
+		})
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	loaded, err := store.LoadOperations(ctx, "doc1", 0)
+	require.NoError(t, err)
+	require.Len(t, loaded, writers*opsPerWriter)
+
+	for i, op := range loaded {
+		require.Equal(t, i+1, op.Revision)
+	}
+}
@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"context"
 	"errors"
+	"maps"
 	"time"
 
 	"github.com/serroba/online-docs/internal/ot"
@@ -9,51 +11,214 @@ import (
 
 // Common errors.
 var (
-	ErrDocumentNotFound = errors.New("document not found")
-	ErrDocumentExists   = errors.New("document already exists")
-	ErrSnapshotNotFound = errors.New("snapshot not found")
+	ErrDocumentNotFound  = errors.New("document not found")
+	ErrDocumentExists    = errors.New("document already exists")
+	ErrSnapshotNotFound  = errors.New("snapshot not found")
+	ErrRevisionNotFound  = errors.New("revision not found")
+	ErrRevisionCompacted = errors.New("revision has been compacted")
+	ErrSlugTaken         = errors.New("slug already taken")
+	ErrSlugNotFound      = errors.New("slug not found")
+	ErrFenced            = errors.New("fencing token is stale")
+	ErrRevisionGap       = errors.New("operation log skips a revision")
+	ErrHandoffNotFound   = errors.New("handoff not found")
+	ErrDetailsChanged    = errors.New("title or properties changed")
 )
 
 // Snapshot represents a point-in-time capture of a document's state.
 type Snapshot struct {
+	DocID      string
+	Revision   int
+	Content    string
+	Formatting []ot.Mark // Runs of formatted characters in Content, nil if it's plain text
+	CreatedAt  time.Time
+}
+
+// Handoff is the state of a live session saved by a process shutting down,
+// so the process taking over the document can keep transforming edits that
+// clients based on revisions before the handoff.
+type Handoff struct {
 	DocID     string
 	Revision  int
 	Content   string
+	History   []ot.SequencedOperation // The session's recent operations, oldest first
 	CreatedAt time.Time
 }
 
+// Metadata describes a document and summarizes who edited it and when.
+// Stores maintain it as operations are appended, so it survives snapshot
+// compaction.
+type Metadata struct {
+	DocID        string
+	CreatedAt    time.Time
+	LastEditedAt time.Time // Zero until the first operation is appended
+	LastEditedBy string
+	Editors      int               // Distinct users who have appended operations
+	Tags         []string          // Labels set with SetTags, sorted
+	ArchivedAt   time.Time         // Zero unless the document is archived
+	Slug         string            // Human-readable alias set with SetSlug
+	Title        string            // Set with SetTitle, empty until the document is named
+	Properties   map[string]string // Arbitrary key/values set with SetProperties, nil if there are none
+}
+
+// Details are a document's title and properties, the metadata its users
+// edit directly.
+type Details struct {
+	Title      string
+	Properties map[string]string // Nil or empty if there are none
+}
+
+// DetailsUpdate changes a document's title, properties or both.
+type DetailsUpdate struct {
+	Title      *string           // Nil keeps the title
+	Properties map[string]string // Nil keeps the properties, empty removes them
+
+	// Based is what the update expects the document to have, so that of
+	// two updates based on the same details only the first applies. Nil
+	// applies it regardless.
+	Based *Details
+}
+
+// matches reports whether the details are those the update is based on.
+func (u DetailsUpdate) matches(title string, properties map[string]string) bool {
+	return u.Based == nil || u.Based.Title == title && maps.Equal(u.Based.Properties, properties)
+}
+
+// Usage summarizes how much a store holds.
+type Usage struct {
+	Documents int
+	Bytes     int64 // Approximate size of snapshots and operation logs
+}
+
+// Migrator is implemented by stores with a schema that must be created or
+// upgraded before they're used.
+type Migrator interface {
+	Migrate(ctx context.Context) error
+}
+
 // Store defines the interface for persisting document state.
 // Implementations can use in-memory storage, databases, or other backends.
+// Every method takes the caller's context, so backends that do I/O can give
+// up once the request is canceled or its deadline passes.
 type Store interface {
 	// CreateDocument creates a new document with the given ID.
 	// Returns ErrDocumentExists if the document already exists.
-	CreateDocument(docID string) error
+	CreateDocument(ctx context.Context, docID string) error
+
+	// CreateDocumentFromSnapshot creates a new document whose history starts
+	// at a revision 0 snapshot of content, in one write, so a document created
+	// with text, such as a copy, never exists without it.
+	// Returns ErrDocumentExists if the document already exists.
+	CreateDocumentFromSnapshot(ctx context.Context, docID, content string) error
 
 	// DocumentExists checks if a document exists.
-	DocumentExists(docID string) (bool, error)
+	DocumentExists(ctx context.Context, docID string) (bool, error)
 
 	// SaveSnapshot persists a snapshot of the document at the given revision.
 	// Returns ErrDocumentNotFound if the document doesn't exist.
-	SaveSnapshot(docID string, revision int, content string) error
+	// Returns ErrFenced if ctx carries a stale fencing token.
+	SaveSnapshot(ctx context.Context, docID string, revision int, content string) error
+
+	// SaveFormattedSnapshot persists a snapshot of the document at the given
+	// revision like SaveSnapshot, with the content's formatting.
+	// Returns ErrDocumentNotFound if the document doesn't exist.
+	// Returns ErrFenced if ctx carries a stale fencing token.
+	SaveFormattedSnapshot(
+		ctx context.Context, docID string, revision int, content string, formatting []ot.Mark,
+	) error
 
 	// LoadSnapshot retrieves the latest snapshot for a document.
 	// Returns ErrDocumentNotFound if the document doesn't exist.
 	// Returns ErrSnapshotNotFound if document exists but has no snapshot.
-	LoadSnapshot(docID string) (Snapshot, error)
+	LoadSnapshot(ctx context.Context, docID string) (Snapshot, error)
+
+	// SaveHandoff stores the state of a session being handed over to another
+	// process, replacing any previous handoff for the document.
+	// Returns ErrDocumentNotFound if the document doesn't exist.
+	// Returns ErrFenced if ctx carries a stale fencing token.
+	SaveHandoff(ctx context.Context, handoff Handoff) error
+
+	// TakeHandoff returns and removes the document's handoff, so it's
+	// restored at most once.
+	// Returns ErrDocumentNotFound if the document doesn't exist.
+	// Returns ErrHandoffNotFound if no handoff was saved.
+	TakeHandoff(ctx context.Context, docID string) (Handoff, error)
 
 	// AppendOperation adds an operation to the document's operation log.
 	// Returns ErrDocumentNotFound if the document doesn't exist.
-	AppendOperation(docID string, op ot.SequencedOperation) error
+	// Returns ErrFenced if ctx carries a stale fencing token.
+	AppendOperation(ctx context.Context, docID string, op ot.SequencedOperation) error
+
+	// AppendOperations adds operations to the document's operation log in one
+	// write, so a batch costs backends that do I/O a single round trip. Either
+	// all of them are appended or none are. A session may snapshot while its
+	// batch is being written, so operations can arrive at or below the latest
+	// snapshot's revision; they must not lower LatestRevision.
+	// Returns ErrDocumentNotFound if the document doesn't exist.
+	// Returns ErrFenced if ctx carries a stale fencing token.
+	AppendOperations(ctx context.Context, docID string, ops []ot.SequencedOperation) error
 
-	// LoadOperations retrieves all operations after the given revision.
+	// LoadOperations retrieves all operations after the given revision,
+	// ordered by revision. It's called with recent revisions on every
+	// catch-up, so backends should find the first operation through an
+	// index on revision rather than by scanning the log.
 	// Returns ErrDocumentNotFound if the document doesn't exist.
-	LoadOperations(docID string, sinceRevision int) ([]ot.SequencedOperation, error)
+	LoadOperations(ctx context.Context, docID string, sinceRevision int) ([]ot.SequencedOperation, error)
 
 	// LatestRevision returns the highest revision number for a document.
 	// Returns ErrDocumentNotFound if the document doesn't exist.
-	LatestRevision(docID string) (int, error)
+	LatestRevision(ctx context.Context, docID string) (int, error)
+
+	// LoadMetadata returns the document's edit metadata.
+	// Returns ErrDocumentNotFound if the document doesn't exist.
+	LoadMetadata(ctx context.Context, docID string) (Metadata, error)
+
+	// SetTags replaces the document's tags.
+	// Returns ErrDocumentNotFound if the document doesn't exist.
+	SetTags(ctx context.Context, docID string, tags []string) error
+
+	// SetTitle renames the document. An empty title removes the name.
+	// Returns ErrDocumentNotFound if the document doesn't exist.
+	SetTitle(ctx context.Context, docID, title string) error
+
+	// SetProperties replaces the document's key/value properties. No
+	// properties removes them all.
+	// Returns ErrDocumentNotFound if the document doesn't exist.
+	SetProperties(ctx context.Context, docID string, properties map[string]string) error
+
+	// UpdateDetails sets the document's title and properties as update
+	// says, checking and writing them in one step.
+	// Returns ErrDocumentNotFound if the document doesn't exist.
+	// Returns ErrDetailsChanged if they aren't those the update is based on.
+	UpdateDetails(ctx context.Context, docID string, update DetailsUpdate) error
+
+	// SetArchived archives or unarchives a document. Archiving an archived
+	// document keeps its original archive time.
+	// Returns ErrDocumentNotFound if the document doesn't exist.
+	SetArchived(ctx context.Context, docID string, archived bool) error
+
+	// SetSlug gives the document a unique human-readable alias, replacing any
+	// previous one. An empty slug removes the alias.
+	// Returns ErrDocumentNotFound if the document doesn't exist.
+	// Returns ErrSlugTaken if another document already uses the slug.
+	SetSlug(ctx context.Context, docID, slug string) error
+
+	// ResolveSlug returns the ID of the document with the given slug.
+	// Returns ErrSlugNotFound if no document uses the slug.
+	ResolveSlug(ctx context.Context, slug string) (string, error)
+
+	// Usage reports how many documents the store holds and their approximate size.
+	Usage(ctx context.Context) (Usage, error)
+
+	// DeleteDocument removes a document and all its data, freeing its slug.
+	// Returns ErrDocumentNotFound if the document doesn't exist.
+	DeleteDocument(ctx context.Context, docID string) error
+
+	// ListDocuments returns the IDs of all documents, sorted.
+	ListDocuments(ctx context.Context) ([]string, error)
 
-	// DeleteDocument removes a document and all its data.
+	// ResetDocument replaces the document's history with a snapshot of
+	// content at revision, discarding every stored operation. It's meant for
+	// repairing a history that can't be replayed.
 	// Returns ErrDocumentNotFound if the document doesn't exist.
-	DeleteDocument(docID string) error
+	ResetDocument(ctx context.Context, docID string, revision int, content string) error
 }
@@ -0,0 +1,179 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/logging"
+)
+
+// Headers sent with every delivery besides SignatureHeader.
+const (
+	EventHeader    = "X-Webhook-Event"
+	DeliveryHeader = "X-Webhook-Delivery" // The event ID
+)
+
+// permanentError marks delivery failures that retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Publish delivers an event to every matching webhook in the background.
+// Deliveries are retried with exponential backoff; concurrent events may
+// arrive out of order, so receivers should order updates by revision.
+func (s *Service) Publish(event Event) {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	s.notify(event)
+
+	for _, listener := range s.listeners {
+		listener.HandleEvent(event)
+	}
+
+	hooks, err := s.store.ListAll()
+	if err != nil {
+		s.logger.Error("failed to list webhooks", "event", event.Type, logging.Err(err))
+
+		return
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		s.logger.Error("failed to encode event", "event", event.Type, logging.Err(err))
+
+		return
+	}
+
+	for _, hook := range hooks {
+		if !hook.Matches(event.Type) || !s.canReceive(hook, event) {
+			continue
+		}
+
+		s.wg.Go(func() {
+			s.deliver(hook, event, body)
+		})
+	}
+}
+
+// Close stops retrying failed deliveries and waits for in-flight attempts.
+// Events published after Close are dropped.
+func (s *Service) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.closeSubscribers()
+	})
+
+	s.wg.Wait()
+}
+
+// canReceive returns true if the webhook owner may see the event.
+func (s *Service) canReceive(hook Webhook, event Event) bool {
+	return s.canSee(hook.OwnerID, event, "webhook "+hook.ID)
+}
+
+// canSee returns true if the user may read the event's document.
+// The recipient describes who is asking, for logging.
+func (s *Service) canSee(userID string, event Event, recipient string) bool {
+	if s.permChecker == nil {
+		return true
+	}
+
+	allowed, err := s.permChecker.CanPerform(event.DocID, userID, acl.ActionRead)
+	if err != nil {
+		s.logger.Error("permission check failed",
+			"recipient", recipient, logging.DocID(event.DocID), logging.Err(err))
+
+		return false
+	}
+
+	return allowed
+}
+
+// deliver POSTs the event body to a webhook, retrying transient failures.
+func (s *Service) deliver(hook Webhook, event Event, body []byte) {
+	delay := s.backoff
+
+	for attempt := 1; ; attempt++ {
+		err := s.send(hook, event, body)
+		if err == nil {
+			return
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) || attempt == s.maxAttempts {
+			s.logger.Warn("giving up on webhook delivery",
+				"webhook_id", hook.ID, "event", event.Type, "event_id", event.ID, logging.DocID(event.DocID),
+				"attempts", attempt, logging.Err(err))
+
+			return
+		}
+
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// send makes a single delivery attempt.
+// The client timeout bounds how long an attempt can take.
+func (s *Service) send(hook Webhook, event Event, body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err: err}
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(event.Type))
+	req.Header.Set(DeliveryHeader, event.ID)
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	err = fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return err
+	default:
+		return &permanentError{err: err}
+	}
+}
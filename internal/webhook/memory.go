@@ -0,0 +1,98 @@
+package webhook
+
+import (
+	"slices"
+	"sync"
+)
+
+// MemoryStore is an in-memory implementation of the Store interface.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	hooks map[string]Webhook // webhook ID -> webhook
+}
+
+// NewMemoryStore creates a new in-memory webhook store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		hooks: make(map[string]Webhook),
+	}
+}
+
+// Save stores a webhook, replacing any webhook with the same ID.
+func (m *MemoryStore) Save(hook Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.hooks[hook.ID] = hook
+
+	return nil
+}
+
+// Get returns a webhook by ID.
+func (m *MemoryStore) Get(hookID string) (Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	hook, exists := m.hooks[hookID]
+	if !exists {
+		return Webhook{}, ErrWebhookNotFound
+	}
+
+	return hook, nil
+}
+
+// Delete removes a webhook.
+func (m *MemoryStore) Delete(hookID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.hooks[hookID]; !exists {
+		return ErrWebhookNotFound
+	}
+
+	delete(m.hooks, hookID)
+
+	return nil
+}
+
+// ListByOwner returns all webhooks registered by a user, oldest first.
+func (m *MemoryStore) ListByOwner(ownerID string) ([]Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []Webhook
+
+	for _, hook := range m.hooks {
+		if hook.OwnerID == ownerID {
+			result = append(result, hook)
+		}
+	}
+
+	sortByCreation(result)
+
+	return result, nil
+}
+
+// ListAll returns every registered webhook, oldest first.
+func (m *MemoryStore) ListAll() ([]Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]Webhook, 0, len(m.hooks))
+	for _, hook := range m.hooks {
+		result = append(result, hook)
+	}
+
+	sortByCreation(result)
+
+	return result, nil
+}
+
+func sortByCreation(hooks []Webhook) {
+	slices.SortFunc(hooks, func(a, b Webhook) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+}
+
+// Ensure MemoryStore implements Store.
+var _ Store = (*MemoryStore)(nil)
@@ -0,0 +1,61 @@
+package webhook_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/webhook"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore_SaveGetDelete(t *testing.T) {
+	t.Parallel()
+
+	store := webhook.NewMemoryStore()
+	require.NoError(t, store.Save(webhook.Webhook{ID: "h1", OwnerID: "alice", URL: "https://example.com/hook"}))
+
+	got, err := store.Get("h1")
+	require.NoError(t, err)
+
+	if got.URL != "https://example.com/hook" {
+		t.Errorf("expected URL https://example.com/hook, got %q", got.URL)
+	}
+
+	require.NoError(t, store.Delete("h1"))
+
+	if _, err := store.Get("h1"); !errors.Is(err, webhook.ErrWebhookNotFound) {
+		t.Errorf("expected ErrWebhookNotFound after delete, got %v", err)
+	}
+
+	if err := store.Delete("h1"); !errors.Is(err, webhook.ErrWebhookNotFound) {
+		t.Errorf("expected ErrWebhookNotFound deleting twice, got %v", err)
+	}
+}
+
+func TestMemoryStore_List(t *testing.T) {
+	t.Parallel()
+
+	store := webhook.NewMemoryStore()
+	now := time.Now()
+
+	require.NoError(t, store.Save(webhook.Webhook{ID: "h2", OwnerID: "alice", CreatedAt: now.Add(time.Second)}))
+	require.NoError(t, store.Save(webhook.Webhook{ID: "h1", OwnerID: "alice", CreatedAt: now}))
+	require.NoError(t, store.Save(webhook.Webhook{ID: "h3", OwnerID: "bob", CreatedAt: now.Add(2 * time.Second)}))
+
+	owned, err := store.ListByOwner("alice")
+	require.NoError(t, err)
+	require.Len(t, owned, 2)
+
+	if owned[0].ID != "h1" || owned[1].ID != "h2" {
+		t.Errorf("expected [h1 h2] oldest first, got [%s %s]", owned[0].ID, owned[1].ID)
+	}
+
+	all, err := store.ListAll()
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+
+	if all[2].ID != "h3" {
+		t.Errorf("expected h3 last, got %s", all[2].ID)
+	}
+}
@@ -0,0 +1,43 @@
+package webhook
+
+import "github.com/serroba/online-docs/internal/acl"
+
+// PermissionStore wraps an acl.Store and publishes document.shared events
+// when roles are granted. The first grant on a document is the creator's
+// ownership rather than a share, so it is not published.
+type PermissionStore struct {
+	acl.Store
+
+	webhooks *Service
+}
+
+// NewPermissionStore wraps store so grants are published to webhooks.
+func NewPermissionStore(store acl.Store, webhooks *Service) *PermissionStore {
+	return &PermissionStore{Store: store, webhooks: webhooks}
+}
+
+// Grant gives a user a role and publishes a document.shared event.
+func (p *PermissionStore) Grant(docID, userID string, role acl.Role) error {
+	existing, err := p.Store.ListPermissions(docID)
+	if err != nil {
+		return err
+	}
+
+	if err := p.Store.Grant(docID, userID, role); err != nil {
+		return err
+	}
+
+	if len(existing) > 0 {
+		p.webhooks.Publish(Event{
+			Type:   EventDocumentShared,
+			DocID:  docID,
+			UserID: userID,
+			Role:   role.String(),
+		})
+	}
+
+	return nil
+}
+
+// Ensure PermissionStore implements acl.Store.
+var _ acl.Store = (*PermissionStore)(nil)
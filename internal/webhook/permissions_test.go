@@ -0,0 +1,64 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/webhook"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermissionStore_PublishesShares(t *testing.T) {
+	t.Parallel()
+
+	receiver := newReceiver(t, nil)
+	roles := acl.NewMemoryStore()
+	service := newTestService(t, roles)
+	permStore := webhook.NewPermissionStore(roles, service)
+
+	_, err := service.Register("alice", receiver.URL, []webhook.EventType{webhook.EventDocumentShared})
+	require.NoError(t, err)
+
+	// The creator's ownership is not a share
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Owner))
+	require.NoError(t, permStore.Grant("doc1", "bob", acl.Editor))
+	service.Close()
+
+	deliveries := receiver.Deliveries()
+	require.Len(t, deliveries, 1)
+
+	var event webhook.Event
+	require.NoError(t, json.Unmarshal(deliveries[0].body, &event))
+
+	if event.UserID != "bob" || event.Role != "editor" || event.DocID != "doc1" {
+		t.Errorf("unexpected share event %+v", event)
+	}
+
+	role, err := permStore.GetRole("doc1", "bob")
+	require.NoError(t, err)
+
+	if role != acl.Editor {
+		t.Errorf("expected grant to reach the wrapped store, got %s", role)
+	}
+}
+
+func TestPermissionStore_ListError(t *testing.T) {
+	t.Parallel()
+
+	permStore := webhook.NewPermissionStore(failingACLStore{MemoryStore: acl.NewMemoryStore()}, newTestService(t, nil))
+
+	if err := permStore.Grant("doc1", "alice", acl.Owner); err == nil {
+		t.Error("expected error when existing permissions can't be listed")
+	}
+}
+
+// failingACLStore is an acl.MemoryStore whose ListPermissions always fails.
+type failingACLStore struct {
+	*acl.MemoryStore
+}
+
+func (failingACLStore) ListPermissions(string) ([]acl.Permission, error) {
+	return nil, errors.New("acl unavailable")
+}
@@ -0,0 +1,143 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/logging"
+)
+
+// secretPrefix identifies webhook signing secrets.
+const secretPrefix = "whsec_"
+
+// Delivery defaults.
+const (
+	DefaultMaxAttempts = 5
+	DefaultBackoff     = time.Second
+	DefaultTimeout     = 10 * time.Second
+)
+
+// Service registers webhooks and delivers events to them.
+type Service struct {
+	store       Store
+	permChecker *acl.Checker
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	listeners   []Listener
+	logger      *slog.Logger
+
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	done      chan struct{} // Closed by Close to stop retries
+
+	subsMu      sync.Mutex
+	subscribers map[*subscriber]struct{}
+}
+
+// Config holds configuration for creating a service.
+type Config struct {
+	Store Store
+
+	// PermStore restricts deliveries to documents the webhook owner can
+	// read. Without it every webhook receives events for all documents.
+	PermStore acl.Store
+
+	Client      *http.Client  // Optional: defaults to a client with DefaultTimeout
+	MaxAttempts int           // Optional: defaults to DefaultMaxAttempts
+	Backoff     time.Duration // Optional: delay before the first retry, doubled after each attempt
+	Listeners   []Listener    // Optional: receive every event in-process
+	Logger      *slog.Logger  // Optional: defaults to slog.Default()
+}
+
+// NewService creates a new webhook service.
+func NewService(cfg Config) *Service {
+	s := &Service{
+		store:       cfg.Store,
+		client:      cfg.Client,
+		maxAttempts: cfg.MaxAttempts,
+		backoff:     cfg.Backoff,
+		listeners:   cfg.Listeners,
+		logger:      logging.Component(cfg.Logger, "webhook"),
+		done:        make(chan struct{}),
+		subscribers: make(map[*subscriber]struct{}),
+	}
+
+	if cfg.PermStore != nil {
+		s.permChecker = acl.NewChecker(cfg.PermStore)
+	}
+
+	if s.client == nil {
+		s.client = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	if s.maxAttempts == 0 {
+		s.maxAttempts = DefaultMaxAttempts
+	}
+
+	if s.backoff == 0 {
+		s.backoff = DefaultBackoff
+	}
+
+	return s
+}
+
+// Register creates a webhook owned by ownerID with a new signing secret.
+// An empty events list subscribes to every event type.
+func (s *Service) Register(ownerID, url string, events []EventType) (Webhook, error) {
+	secret, err := generateSecret()
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	hook := Webhook{
+		ID:        uuid.New().String(),
+		OwnerID:   ownerID,
+		URL:       url,
+		Secret:    secret,
+		Events:    events,
+		CreatedAt: time.Now(),
+	}
+
+	if err := s.store.Save(hook); err != nil {
+		return Webhook{}, err
+	}
+
+	return hook, nil
+}
+
+// Remove deletes a webhook owned by ownerID.
+// Returns ErrWebhookNotFound if the webhook doesn't exist or belongs to someone else.
+func (s *Service) Remove(ownerID, hookID string) error {
+	hook, err := s.store.Get(hookID)
+	if err != nil {
+		return err
+	}
+
+	if hook.OwnerID != ownerID {
+		return ErrWebhookNotFound
+	}
+
+	return s.store.Delete(hookID)
+}
+
+// List returns the webhooks owned by a user.
+func (s *Service) List(ownerID string) ([]Webhook, error) {
+	return s.store.ListByOwner(ownerID)
+}
+
+// generateSecret returns a new random signing secret.
+func generateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return secretPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
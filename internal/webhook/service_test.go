@@ -0,0 +1,358 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/webhook"
+	"github.com/stretchr/testify/require"
+)
+
+// delivery is a request received by a test endpoint.
+type delivery struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver is a test webhook endpoint that records deliveries.
+type receiver struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	statuses   []int // Responses to return in order, then 200
+	deliveries []delivery
+}
+
+func newReceiver(t *testing.T, statuses []int) *receiver {
+	t.Helper()
+
+	r := &receiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.mu.Lock()
+		r.deliveries = append(r.deliveries, delivery{header: req.Header.Clone(), body: body})
+
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		r.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+
+	return r
+}
+
+func (r *receiver) Deliveries() []delivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]delivery(nil), r.deliveries...)
+}
+
+func newTestService(t *testing.T, permStore acl.Store) *webhook.Service {
+	t.Helper()
+
+	service := webhook.NewService(webhook.Config{
+		Store:       webhook.NewMemoryStore(),
+		PermStore:   permStore,
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		Logger:      slog.New(slog.DiscardHandler),
+	})
+	t.Cleanup(service.Close)
+
+	return service
+}
+
+func TestService_RegisterListRemove(t *testing.T) {
+	t.Parallel()
+
+	service := newTestService(t, nil)
+
+	hook, err := service.Register("alice", "https://example.com/hook", nil)
+	require.NoError(t, err)
+
+	if !strings.HasPrefix(hook.Secret, "whsec_") {
+		t.Errorf("expected secret with whsec_ prefix, got %q", hook.Secret)
+	}
+
+	hooks, err := service.List("alice")
+	require.NoError(t, err)
+	require.Len(t, hooks, 1)
+
+	if err := service.Remove("bob", hook.ID); !errors.Is(err, webhook.ErrWebhookNotFound) {
+		t.Errorf("expected ErrWebhookNotFound removing another user's webhook, got %v", err)
+	}
+
+	require.NoError(t, service.Remove("alice", hook.ID))
+
+	if err := service.Remove("alice", hook.ID); !errors.Is(err, webhook.ErrWebhookNotFound) {
+		t.Errorf("expected ErrWebhookNotFound removing twice, got %v", err)
+	}
+}
+
+func TestService_Publish(t *testing.T) {
+	t.Parallel()
+
+	receiver := newReceiver(t, nil)
+	service := newTestService(t, nil)
+
+	hook, err := service.Register("alice", receiver.URL, nil)
+	require.NoError(t, err)
+
+	service.Publish(webhook.Event{Type: webhook.EventDocumentUpdated, DocID: "doc1", Revision: 3, UserID: "bob"})
+	service.Close()
+
+	deliveries := receiver.Deliveries()
+	require.Len(t, deliveries, 1)
+
+	got := deliveries[0]
+	if !webhook.Verify(hook.Secret, got.body, got.header.Get(webhook.SignatureHeader)) {
+		t.Errorf("expected valid signature, got %q", got.header.Get(webhook.SignatureHeader))
+	}
+
+	if got.header.Get(webhook.EventHeader) != "document.updated" {
+		t.Errorf("expected event header document.updated, got %q", got.header.Get(webhook.EventHeader))
+	}
+
+	var event webhook.Event
+	require.NoError(t, json.Unmarshal(got.body, &event))
+
+	if event.ID == "" || event.ID != got.header.Get(webhook.DeliveryHeader) {
+		t.Errorf("expected event ID %q to match delivery header %q", event.ID, got.header.Get(webhook.DeliveryHeader))
+	}
+
+	if event.DocID != "doc1" || event.Revision != 3 || event.UserID != "bob" || event.OccurredAt.IsZero() {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
+
+func TestService_Publish_EventFilter(t *testing.T) {
+	t.Parallel()
+
+	receiver := newReceiver(t, nil)
+	service := newTestService(t, nil)
+
+	_, err := service.Register("alice", receiver.URL, []webhook.EventType{webhook.EventDocumentDeleted})
+	require.NoError(t, err)
+
+	service.Publish(webhook.Event{Type: webhook.EventDocumentCreated, DocID: "doc1"})
+	service.Publish(webhook.Event{Type: webhook.EventDocumentDeleted, DocID: "doc1"})
+	service.Close()
+
+	deliveries := receiver.Deliveries()
+	require.Len(t, deliveries, 1)
+
+	if deliveries[0].header.Get(webhook.EventHeader) != "document.deleted" {
+		t.Errorf("expected only document.deleted, got %q", deliveries[0].header.Get(webhook.EventHeader))
+	}
+}
+
+func TestService_Publish_RequiresReadAccess(t *testing.T) {
+	t.Parallel()
+
+	receiver := newReceiver(t, nil)
+	roles := acl.NewMemoryStore()
+	service := newTestService(t, roles)
+
+	require.NoError(t, roles.Grant("doc1", "alice", acl.Viewer))
+
+	_, err := service.Register("alice", receiver.URL, nil)
+	require.NoError(t, err)
+
+	service.Publish(webhook.Event{Type: webhook.EventDocumentUpdated, DocID: "doc1"})
+	service.Publish(webhook.Event{Type: webhook.EventDocumentUpdated, DocID: "secret-doc"})
+	service.Close()
+
+	deliveries := receiver.Deliveries()
+	require.Len(t, deliveries, 1)
+
+	if !strings.Contains(string(deliveries[0].body), `"documentId":"doc1"`) {
+		t.Errorf("expected only doc1 event, got %s", deliveries[0].body)
+	}
+}
+
+func TestService_Publish_Retries(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		statuses []int
+		want     int // Expected delivery attempts
+	}{
+		{"retries server errors until success", []int{http.StatusInternalServerError, http.StatusBadGateway}, 3},
+		{"retries rate limiting", []int{http.StatusTooManyRequests}, 2},
+		{"gives up after max attempts", []int{500, 500, 500, 500}, 3},
+		{"does not retry client errors", []int{http.StatusGone}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			receiver := newReceiver(t, tt.statuses)
+			service := newTestService(t, nil)
+
+			_, err := service.Register("alice", receiver.URL, nil)
+			require.NoError(t, err)
+
+			service.Publish(webhook.Event{Type: webhook.EventDocumentCreated, DocID: "doc1"})
+			waitFor(t, func() bool { return len(receiver.Deliveries()) >= tt.want })
+			service.Close()
+
+			if got := len(receiver.Deliveries()); got != tt.want {
+				t.Errorf("expected %d attempts, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestService_Close(t *testing.T) {
+	t.Parallel()
+
+	receiver := newReceiver(t, []int{500})
+	service := webhook.NewService(webhook.Config{
+		Store:   webhook.NewMemoryStore(),
+		Backoff: time.Hour,
+		Logger:  slog.New(slog.DiscardHandler),
+	})
+
+	_, err := service.Register("alice", receiver.URL, nil)
+	require.NoError(t, err)
+
+	service.Publish(webhook.Event{Type: webhook.EventDocumentCreated, DocID: "doc1"})
+	waitFor(t, func() bool { return len(receiver.Deliveries()) == 1 })
+
+	// Close must not wait out the retry backoff
+	closed := make(chan struct{})
+
+	go func() {
+		service.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not stop pending retries")
+	}
+
+	service.Publish(webhook.Event{Type: webhook.EventDocumentDeleted, DocID: "doc1"})
+
+	if got := len(receiver.Deliveries()); got != 1 {
+		t.Errorf("expected no deliveries after close, got %d", got)
+	}
+}
+
+func TestService_Publish_Errors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("store error", func(t *testing.T) {
+		t.Parallel()
+
+		service := webhook.NewService(webhook.Config{
+			Store:  failingStore{},
+			Logger: slog.New(slog.DiscardHandler),
+		})
+
+		service.Publish(webhook.Event{Type: webhook.EventDocumentCreated, DocID: "doc1"})
+		service.Close()
+	})
+
+	t.Run("invalid URL", func(t *testing.T) {
+		t.Parallel()
+
+		service := newTestService(t, nil)
+
+		_, err := service.Register("alice", "http://in valid", nil)
+		require.NoError(t, err)
+
+		service.Publish(webhook.Event{Type: webhook.EventDocumentCreated, DocID: "doc1"})
+		service.Close()
+	})
+
+	t.Run("unreachable endpoint", func(t *testing.T) {
+		t.Parallel()
+
+		receiver := newReceiver(t, nil)
+		url := receiver.URL
+		receiver.Close()
+
+		service := newTestService(t, nil)
+
+		_, err := service.Register("alice", url, nil)
+		require.NoError(t, err)
+
+		service.Publish(webhook.Event{Type: webhook.EventDocumentCreated, DocID: "doc1"})
+		service.Close()
+	})
+
+	t.Run("permission check error", func(t *testing.T) {
+		t.Parallel()
+
+		receiver := newReceiver(t, nil)
+		service := newTestService(t, failingACLStore{MemoryStore: acl.NewMemoryStore()})
+
+		_, err := service.Register("alice", receiver.URL, nil)
+		require.NoError(t, err)
+
+		service.Publish(webhook.Event{Type: webhook.EventDocumentCreated, DocID: "doc1"})
+		service.Close()
+
+		if got := len(receiver.Deliveries()); got != 0 {
+			t.Errorf("expected no deliveries, got %d", got)
+		}
+	})
+}
+
+func TestService_Register_StoreError(t *testing.T) {
+	t.Parallel()
+
+	service := webhook.NewService(webhook.Config{Store: failingStore{}})
+
+	if _, err := service.Register("alice", "https://example.com/hook", nil); err == nil {
+		t.Error("expected store error")
+	}
+}
+
+// waitFor polls until cond is true or the test times out.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// failingStore is a webhook.Store whose operations always fail.
+type failingStore struct{}
+
+var errStore = errors.New("webhook store unavailable")
+
+func (failingStore) Save(webhook.Webhook) error { return errStore }
+
+func (failingStore) Get(string) (webhook.Webhook, error) { return webhook.Webhook{}, errStore }
+
+func (failingStore) Delete(string) error { return errStore }
+
+func (failingStore) ListByOwner(string) ([]webhook.Webhook, error) { return nil, errStore }
+
+func (failingStore) ListAll() ([]webhook.Webhook, error) { return nil, errStore }
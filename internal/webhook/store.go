@@ -0,0 +1,29 @@
+package webhook
+
+import "errors"
+
+// Common errors.
+var (
+	ErrWebhookNotFound = errors.New("webhook not found")
+	ErrInvalidEvent    = errors.New("invalid event type")
+)
+
+// Store defines the interface for persisting webhooks.
+type Store interface {
+	// Save stores a webhook, replacing any webhook with the same ID.
+	Save(hook Webhook) error
+
+	// Get returns a webhook by ID.
+	// Returns ErrWebhookNotFound if the webhook doesn't exist.
+	Get(hookID string) (Webhook, error)
+
+	// Delete removes a webhook.
+	// Returns ErrWebhookNotFound if the webhook doesn't exist.
+	Delete(hookID string) error
+
+	// ListByOwner returns all webhooks registered by a user.
+	ListByOwner(ownerID string) ([]Webhook, error)
+
+	// ListAll returns every registered webhook.
+	ListAll() ([]Webhook, error)
+}
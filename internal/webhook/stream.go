@@ -0,0 +1,82 @@
+package webhook
+
+import "github.com/serroba/online-docs/internal/logging"
+
+// subscriberBuffer is how far a subscriber may fall behind before its
+// events are dropped.
+const subscriberBuffer = 64
+
+// Listener receives every published event in-process, whoever may read the
+// document. It's called by Publish, so it must not block.
+type Listener interface {
+	HandleEvent(event Event)
+}
+
+// subscriber receives events in-process, for streaming to a connected user.
+type subscriber struct {
+	userID string
+	events chan Event
+}
+
+// Subscribe streams every published event on documents the user can read,
+// until cancel is called or the service is closed, which closes the channel.
+// Events are dropped rather than holding up publishers when the subscriber
+// falls behind.
+func (s *Service) Subscribe(userID string) (<-chan Event, func()) {
+	sub := &subscriber{userID: userID, events: make(chan Event, subscriberBuffer)}
+
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+
+	select {
+	case <-s.done:
+		close(sub.events)
+
+		return sub.events, func() {}
+	default:
+	}
+
+	s.subscribers[sub] = struct{}{}
+
+	cancel := func() {
+		s.subsMu.Lock()
+		defer s.subsMu.Unlock()
+
+		if _, ok := s.subscribers[sub]; ok {
+			delete(s.subscribers, sub)
+			close(sub.events)
+		}
+	}
+
+	return sub.events, cancel
+}
+
+// notify hands an event to every subscriber allowed to see it.
+func (s *Service) notify(event Event) {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+
+	for sub := range s.subscribers {
+		if !s.canSee(sub.userID, event, "subscriber "+sub.userID) {
+			continue
+		}
+
+		select {
+		case sub.events <- event:
+		default:
+			s.logger.Warn("dropped event for slow subscriber",
+				"event", event.Type, "event_id", event.ID, logging.UserID(sub.userID))
+		}
+	}
+}
+
+// closeSubscribers ends every subscription.
+func (s *Service) closeSubscribers() {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+
+	for sub := range s.subscribers {
+		delete(s.subscribers, sub)
+		close(sub.events)
+	}
+}
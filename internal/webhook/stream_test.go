@@ -0,0 +1,139 @@
+package webhook_test
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/webhook"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Subscribe(t *testing.T) {
+	t.Parallel()
+
+	roles := acl.NewMemoryStore()
+	require.NoError(t, roles.Grant("doc1", "alice", acl.Viewer))
+
+	service := newTestService(t, roles)
+
+	events, cancel := service.Subscribe("alice")
+	defer cancel()
+
+	service.Publish(webhook.Event{Type: webhook.EventDocumentUpdated, DocID: "secret-doc"})
+	service.Publish(webhook.Event{Type: webhook.EventDocumentUpdated, DocID: "doc1", Revision: 3})
+
+	event := <-events
+	if event.DocID != "doc1" || event.Revision != 3 || event.ID == "" || event.OccurredAt.IsZero() {
+		t.Errorf("unexpected event: %+v", event)
+	}
+
+	select {
+	case extra := <-events:
+		t.Errorf("expected no event for an unreadable document, got %+v", extra)
+	default:
+	}
+}
+
+func TestService_Subscribe_Cancel(t *testing.T) {
+	t.Parallel()
+
+	service := newTestService(t, nil)
+
+	events, cancel := service.Subscribe("alice")
+	cancel()
+	cancel() // Cancelling twice is harmless
+
+	if _, ok := <-events; ok {
+		t.Error("expected channel to be closed after cancel")
+	}
+
+	service.Publish(webhook.Event{Type: webhook.EventDocumentCreated, DocID: "doc1"})
+}
+
+func TestService_Subscribe_Close(t *testing.T) {
+	t.Parallel()
+
+	service := newTestService(t, nil)
+
+	events, cancel := service.Subscribe("alice")
+	defer cancel()
+
+	service.Close()
+
+	if _, ok := <-events; ok {
+		t.Error("expected channel to be closed by Close")
+	}
+
+	// Subscribing after Close returns a closed channel
+	late, lateCancel := service.Subscribe("bob")
+	lateCancel()
+
+	if _, ok := <-late; ok {
+		t.Error("expected closed channel after Close")
+	}
+}
+
+func TestService_Subscribe_DropsWhenBehind(t *testing.T) {
+	t.Parallel()
+
+	service := newTestService(t, nil)
+
+	events, cancel := service.Subscribe("alice")
+	defer cancel()
+
+	for range 100 {
+		service.Publish(webhook.Event{Type: webhook.EventDocumentUpdated, DocID: "doc1"})
+	}
+
+	if got := len(events); got != cap(events) {
+		t.Errorf("expected a full buffer of %d events, got %d", cap(events), got)
+	}
+}
+
+func TestService_Subscribe_PermissionError(t *testing.T) {
+	t.Parallel()
+
+	service := newTestService(t, failingACLStore{MemoryStore: acl.NewMemoryStore()})
+
+	events, cancel := service.Subscribe("alice")
+	defer cancel()
+
+	service.Publish(webhook.Event{Type: webhook.EventDocumentCreated, DocID: "doc1"})
+
+	if got := len(events); got != 0 {
+		t.Errorf("expected no events, got %d", got)
+	}
+}
+
+// recordingListener records the events it receives.
+type recordingListener struct {
+	events []webhook.Event
+}
+
+func (l *recordingListener) HandleEvent(event webhook.Event) {
+	l.events = append(l.events, event)
+}
+
+func TestService_Listeners(t *testing.T) {
+	t.Parallel()
+
+	listener := &recordingListener{}
+	service := webhook.NewService(webhook.Config{
+		Store:     webhook.NewMemoryStore(),
+		PermStore: acl.NewMemoryStore(),
+		Listeners: []webhook.Listener{listener},
+		Logger:    slog.New(slog.DiscardHandler),
+	})
+	t.Cleanup(service.Close)
+
+	// Listeners see events on documents nobody was granted
+	service.Publish(webhook.Event{Type: webhook.EventDocumentShared, DocID: "doc1", UserID: "bob"})
+	require.Len(t, listener.events, 1)
+	require.Equal(t, "bob", listener.events[0].UserID)
+	require.NotEmpty(t, listener.events[0].ID)
+
+	service.Close()
+	service.Publish(webhook.Event{Type: webhook.EventDocumentShared, DocID: "doc1", UserID: "carol"})
+	require.Len(t, listener.events, 1)
+}
@@ -0,0 +1,74 @@
+// Package webhook delivers document events to external HTTP endpoints.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"time"
+)
+
+// EventType identifies a kind of document event.
+type EventType string
+
+const (
+	EventDocumentCreated EventType = "document.created"
+	EventDocumentUpdated EventType = "document.updated"
+	EventDocumentShared  EventType = "document.shared"
+	EventDocumentDeleted EventType = "document.deleted"
+)
+
+// ParseEventType converts an event name into an EventType.
+func ParseEventType(name string) (EventType, error) {
+	switch event := EventType(name); event {
+	case EventDocumentCreated, EventDocumentUpdated, EventDocumentShared, EventDocumentDeleted:
+		return event, nil
+	default:
+		return "", ErrInvalidEvent
+	}
+}
+
+// Event is the JSON body POSTed to webhook endpoints.
+type Event struct {
+	ID         string    `json:"id"` // Unique per event, for deduplication
+	Type       EventType `json:"type"`
+	DocID      string    `json:"documentId"`
+	Revision   int       `json:"revision,omitempty"` // Set for document.updated
+	UserID     string    `json:"userId,omitempty"`   // Editor, or the user a document was shared with
+	Role       string    `json:"role,omitempty"`     // Set for document.shared
+	OccurredAt time.Time `json:"occurredAt"`
+}
+
+// Webhook is an endpoint registered to receive document events.
+type Webhook struct {
+	ID        string
+	OwnerID   string // User who registered the webhook
+	URL       string
+	Secret    string      // Key used to sign deliveries
+	Events    []EventType // Empty means all events
+	CreatedAt time.Time
+}
+
+// Matches returns true if the webhook subscribes to the event type.
+func (w Webhook) Matches(event EventType) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, event)
+}
+
+// SignatureHeader carries the HMAC signature of a delivery body.
+const SignatureHeader = "X-Webhook-Signature"
+
+// Sign returns the signature of a delivery body, in the form
+// "sha256=<hex HMAC-SHA256 of body keyed with secret>".
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is a valid signature of body.
+// Receivers should use it to reject forged deliveries.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
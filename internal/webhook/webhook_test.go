@@ -0,0 +1,66 @@
+package webhook_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/webhook"
+)
+
+func TestParseEventType(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"document.created", "document.updated", "document.shared", "document.deleted"} {
+		event, err := webhook.ParseEventType(name)
+		if err != nil || string(event) != name {
+			t.Errorf("ParseEventType(%q) = %q, %v", name, event, err)
+		}
+	}
+
+	if _, err := webhook.ParseEventType("document.viewed"); !errors.Is(err, webhook.ErrInvalidEvent) {
+		t.Errorf("expected ErrInvalidEvent, got %v", err)
+	}
+}
+
+func TestWebhook_Matches(t *testing.T) {
+	t.Parallel()
+
+	all := webhook.Webhook{}
+	if !all.Matches(webhook.EventDocumentShared) {
+		t.Error("expected webhook without filter to match every event")
+	}
+
+	filtered := webhook.Webhook{Events: []webhook.EventType{webhook.EventDocumentCreated}}
+	if !filtered.Matches(webhook.EventDocumentCreated) {
+		t.Error("expected filtered webhook to match its event")
+	}
+
+	if filtered.Matches(webhook.EventDocumentDeleted) {
+		t.Error("expected filtered webhook not to match other events")
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	t.Parallel()
+
+	body := []byte(`{"type":"document.created"}`)
+	signature := webhook.Sign("secret", body)
+
+	// HMAC-SHA256 of the body keyed with "secret"
+	want := "sha256=52a97b80652b293865f16b035a0b85483367f4389dd4935550830745feba85c1"
+	if signature != want {
+		t.Errorf("expected signature %q, got %q", want, signature)
+	}
+
+	if !webhook.Verify("secret", body, signature) {
+		t.Error("expected signature to verify")
+	}
+
+	if webhook.Verify("other", body, signature) {
+		t.Error("expected signature with a different secret to fail")
+	}
+
+	if webhook.Verify("secret", []byte(`{}`), signature) {
+		t.Error("expected signature of a different body to fail")
+	}
+}
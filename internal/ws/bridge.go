@@ -0,0 +1,72 @@
+package ws
+
+import "github.com/serroba/online-docs/internal/logging"
+
+// Bridge carries broadcasts between server instances, so clients of the same
+// document connected to different instances see each other's edits.
+// Implementations hand messages from other instances to Hub.Deliver and must
+// not echo an instance's own broadcasts back to it.
+type Bridge interface {
+	// Publish sends a broadcast for a document to the other instances.
+	Publish(docID string, msg Message) error
+
+	// Subscribe starts receiving a document's broadcasts from other
+	// instances; Unsubscribe stops. The hub subscribes while the document
+	// has local clients.
+	Subscribe(docID string) error
+	Unsubscribe(docID string) error
+}
+
+// SetBridge connects the hub to other instances. Call it before clients
+// are registered.
+func (h *Hub) SetBridge(bridge Bridge) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.bridge = bridge
+}
+
+// Deliver sends a broadcast received from another instance to every local
+// client subscribed to the document.
+func (h *Hub) Deliver(docID string, msg Message) {
+	h.send(docID, msg, "")
+}
+
+// join adds a client to a document, subscribing the bridge when it's the
+// document's first local client. Must be called with mu held.
+func (h *Hub) join(docID, clientID string) {
+	if h.documents[docID] == nil {
+		h.documents[docID] = make(map[string]struct{})
+
+		if h.bridge != nil {
+			if err := h.bridge.Subscribe(docID); err != nil {
+				h.logger.Warn("bridge subscribe failed", logging.DocID(docID), logging.Err(err))
+			}
+		}
+	}
+
+	h.documents[docID][clientID] = struct{}{}
+}
+
+// leave removes a client from a document, unsubscribing the bridge once the
+// document has no local clients left. Must be called with mu held.
+func (h *Hub) leave(docID, clientID string) {
+	clients, ok := h.documents[docID]
+	if !ok {
+		return
+	}
+
+	delete(clients, clientID)
+
+	if len(clients) > 0 {
+		return
+	}
+
+	delete(h.documents, docID)
+
+	if h.bridge != nil {
+		if err := h.bridge.Unsubscribe(docID); err != nil {
+			h.logger.Warn("bridge unsubscribe failed", logging.DocID(docID), logging.Err(err))
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package ws_test
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBridge records the hub's calls.
+type fakeBridge struct {
+	mu        sync.Mutex
+	calls     []string
+	published []ws.Message
+	err       error
+}
+
+func (b *fakeBridge) Publish(docID string, msg ws.Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.calls = append(b.calls, "publish "+docID)
+	b.published = append(b.published, msg)
+
+	return b.err
+}
+
+func (b *fakeBridge) Subscribe(docID string) error {
+	return b.record("subscribe " + docID)
+}
+
+func (b *fakeBridge) Unsubscribe(docID string) error {
+	return b.record("unsubscribe " + docID)
+}
+
+func (b *fakeBridge) record(call string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.calls = append(b.calls, call)
+
+	return b.err
+}
+
+func (b *fakeBridge) Published() []ws.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return slices.Clone(b.published)
+}
+
+func (b *fakeBridge) Calls() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return slices.Clone(b.calls)
+}
+
+func TestHub_Bridge_Subscriptions(t *testing.T) {
+	t.Parallel()
+
+	bridge := &fakeBridge{}
+	hub := ws.NewHub()
+	hub.SetBridge(bridge)
+
+	c1 := ws.NewClient("c1", "alice", newMockConn())
+	c2 := ws.NewClient("c2", "bob", newMockConn())
+	hub.Register(c1)
+	hub.Register(c2)
+
+	// Only the first and last local client of a document change the subscription
+	hub.Subscribe(c1, "doc1")
+	hub.Subscribe(c2, "doc1")
+	hub.Subscribe(c1, "doc2")
+	hub.Unsubscribe(c1, "doc2")
+	hub.Unregister(c2)
+
+	require.Equal(t, []string{"subscribe doc1", "subscribe doc2", "unsubscribe doc2", "unsubscribe doc1"}, bridge.Calls())
+}
+
+func TestHub_Bridge_BroadcastAndDeliver(t *testing.T) {
+	t.Parallel()
+
+	bridge := &fakeBridge{}
+	hub := ws.NewHub()
+	hub.SetBridge(bridge)
+
+	senderConn, otherConn := newMockConn(), newMockConn()
+	sender := ws.NewClient("c1", "alice", senderConn)
+	other := ws.NewClient("c2", "bob", otherConn)
+
+	for _, c := range []*ws.Client{sender, other} {
+		hub.Register(c)
+		hub.Subscribe(c, testDocID)
+	}
+
+	// Local broadcasts also go to other instances
+	hub.BroadcastOperation(testDocID, insertOp(1, 0, "a", "alice"), "alice", "c1")
+	require.Contains(t, bridge.Calls(), "publish "+testDocID)
+	require.Equal(t, ws.MessageTypeBroadcast, bridge.Published()[0].Type)
+
+	require.Eventually(t, func() bool { return len(otherConn.Messages()) == 1 }, time.Second, 5*time.Millisecond)
+
+	// Broadcasts from other instances reach every local client and aren't republished
+	hub.Deliver(testDocID, ws.Message{Type: ws.MessageTypeBroadcast})
+
+	require.Eventually(t, func() bool {
+		return len(senderConn.Messages()) == 1 && len(otherConn.Messages()) == 2
+	}, time.Second, 5*time.Millisecond)
+	require.Len(t, bridge.Published(), 1)
+}
+
+func TestHub_Bridge_Errors(t *testing.T) {
+	t.Parallel()
+
+	bridge := &fakeBridge{err: errors.New("bridge down")}
+	hub := ws.NewHub()
+	hub.SetBridge(bridge)
+
+	conn := newMockConn()
+	client := ws.NewClient("c1", "alice", conn)
+	hub.Register(client)
+
+	// Local delivery keeps working when the bridge fails
+	hub.Subscribe(client, testDocID)
+	hub.Broadcast(testDocID, ws.Message{Type: ws.MessageTypeBroadcast}, "")
+	hub.Unregister(client)
+
+	require.Equal(t, []string{"subscribe " + testDocID, "publish " + testDocID, "unsubscribe " + testDocID},
+		bridge.Calls())
+	require.Eventually(t, func() bool { return len(conn.Messages()) == 1 }, time.Second, 5*time.Millisecond)
+}
@@ -3,6 +3,8 @@ package ws
 import (
 	"encoding/json"
 	"sync"
+
+	"github.com/gorilla/websocket"
 )
 
 // Conn abstracts a WebSocket connection for testability.
@@ -16,10 +18,17 @@ type Conn interface {
 type Client struct {
 	ID     string
 	UserID string
+	Bot    bool // A server-side bot rather than a connection
 	conn   Conn
 
 	mu    sync.Mutex
 	docID string // Currently subscribed document
+
+	// Broadcasts waiting for a Hub worker to write them
+	outMu     sync.Mutex
+	outbox    []*shared
+	scheduled bool // A worker has the client or will pick it up
+	dropped   bool // Disconnected for falling behind
 }
 
 // NewClient creates a new client wrapper.
@@ -33,10 +42,53 @@ func NewClient(id, userID string, conn Conn) *Client {
 
 // Send sends a message to the client.
 func (c *Client) Send(msg Message) error {
+	raw, ok := c.conn.(rawWriter)
+	if !ok {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		return c.conn.WriteJSON(msg)
+	}
+
+	buf, err := encode(msg)
+	if err != nil {
+		return err
+	}
+	defer bufferPool.Put(buf)
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	return c.conn.WriteJSON(msg)
+	return raw.WriteMessage(websocket.TextMessage, buf.Bytes())
+}
+
+// sendShared sends a broadcast, reusing its prepared message or encoding
+// when the connection takes them.
+func (c *Client) sendShared(s *shared) error {
+	switch conn := c.conn.(type) {
+	case preparedWriter:
+		pm, err := s.prepared()
+		if err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		return conn.WritePreparedMessage(pm)
+	case rawWriter:
+		data, err := s.bytes()
+		if err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		return conn.WriteMessage(websocket.TextMessage, data)
+	default:
+		return c.Send(s.msg)
+	}
 }
 
 // SendError sends an error message to the client.
@@ -50,6 +102,19 @@ func (c *Client) SendError(code, message string) error {
 	})
 }
 
+// SendEditError sends an error message rejecting the edit numbered seq,
+// see OperationPayload. A seq of 0 sends a plain error.
+func (c *Client) SendEditError(seq int, code, message string) error {
+	return c.Send(Message{
+		Type: MessageTypeError,
+		Payload: ErrorPayload{
+			Code:    code,
+			Message: message,
+			Seq:     seq,
+		},
+	})
+}
+
 // Receive reads a message from the client.
 func (c *Client) Receive() (Message, error) {
 	var raw struct {
@@ -73,16 +138,28 @@ func (c *Client) Receive() (Message, error) {
 
 		msg.Payload = payload
 	case MessageTypeSync:
-		// Sync has no payload, just the doc ID in a simple struct
-		var payload struct {
-			DocID string `json:"docId"`
+		var payload SyncPayload
+		if err := json.Unmarshal(raw.Payload, &payload); err != nil {
+			return Message{}, err
+		}
+
+		msg.Payload = payload
+	case MessageTypeCursor:
+		var payload CursorPayload
+		if err := json.Unmarshal(raw.Payload, &payload); err != nil {
+			return Message{}, err
 		}
+
+		msg.Payload = payload
+	case MessageTypeOperationBatch:
+		var payload OperationBatchPayload
 		if err := json.Unmarshal(raw.Payload, &payload); err != nil {
 			return Message{}, err
 		}
 
 		msg.Payload = payload
-	case MessageTypeAck, MessageTypeBroadcast, MessageTypeState, MessageTypeError:
+	case MessageTypeAck, MessageTypeBroadcast, MessageTypeState, MessageTypeCatchUp, MessageTypeError,
+		MessageTypePresence, MessageTypeClosing, MessageTypePermissionChanged:
 		// Server-to-client messages - keep raw payload
 		msg.Payload = raw.Payload
 	}
@@ -1,6 +1,7 @@
 package ws_test
 
 import (
+	"slices"
 	"testing"
 
 	"github.com/serroba/online-docs/internal/ws"
@@ -129,6 +130,40 @@ func TestClient_Receive_Operation(t *testing.T) {
 	}
 }
 
+func TestClient_Receive_OperationBatch(t *testing.T) {
+	t.Parallel()
+
+	conn := newMockConn()
+	client := ws.NewClient("c1", "user1", conn)
+
+	conn.incoming <- ws.Message{
+		Type: ws.MessageTypeOperationBatch,
+		Payload: ws.OperationBatchPayload{
+			DocID:        "doc1",
+			BaseRevision: 5,
+			Operations:   []ws.BatchOperation{{Position: 10, Char: "a"}, {OpType: 1, Position: 3}},
+		},
+	}
+
+	msg, err := client.Receive()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	payload, ok := msg.Payload.(ws.OperationBatchPayload)
+	if !ok {
+		t.Fatal("expected OperationBatchPayload")
+	}
+
+	if payload.BaseRevision != 5 {
+		t.Errorf("expected base revision 5, got %d", payload.BaseRevision)
+	}
+
+	if !slices.Equal(payload.Operations, []ws.BatchOperation{{Position: 10, Char: "a"}, {OpType: 1, Position: 3}}) {
+		t.Errorf("unexpected operations %+v", payload.Operations)
+	}
+}
+
 func TestClient_Receive_Sync(t *testing.T) {
 	t.Parallel()
 
@@ -153,6 +188,32 @@ func TestClient_Receive_Sync(t *testing.T) {
 	}
 }
 
+func TestClient_Receive_Cursor(t *testing.T) {
+	t.Parallel()
+
+	conn := newMockConn()
+	client := ws.NewClient("c1", "user1", conn)
+
+	conn.incoming <- ws.Message{
+		Type:    ws.MessageTypeCursor,
+		Payload: ws.CursorPayload{DocID: "doc1", Revision: 4, Position: 7, Anchor: 2},
+	}
+
+	msg, err := client.Receive()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	payload, ok := msg.Payload.(ws.CursorPayload)
+	if !ok {
+		t.Fatal("expected CursorPayload")
+	}
+
+	if payload.Revision != 4 || payload.Position != 7 || payload.Anchor != 2 {
+		t.Errorf("unexpected cursor: %+v", payload)
+	}
+}
+
 func TestClient_Receive_ServerMessage(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,108 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+// rawWriter is implemented by connections that can send an encoded JSON
+// message as is. Broadcasts to them are encoded once for every recipient
+// instead of once per recipient.
+type rawWriter interface {
+	WriteMessage(messageType int, data []byte) error
+}
+
+// preparedWriter is implemented by connections that can send a message
+// prepared once for every recipient, such as *websocket.Conn. Besides the
+// encoding, recipients with the same compression settings share its frame.
+type preparedWriter interface {
+	WritePreparedMessage(pm *websocket.PreparedMessage) error
+}
+
+// bufferPool holds the buffers messages are encoded into.
+var bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// encode encodes msg as WriteJSON would, into a buffer from bufferPool.
+// The caller must put the buffer back once it's written.
+func encode(msg Message) (*bytes.Buffer, error) {
+	buf, _ := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+
+	if err := json.NewEncoder(buf).Encode(msg); err != nil {
+		bufferPool.Put(buf)
+
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// shared is a broadcast queued for several clients. It's encoded by the
+// first client that needs the bytes, and its buffer goes back to the pool
+// once every client has released it. Clients taking prepared messages
+// share one prepared from it instead.
+type shared struct {
+	msg  Message
+	refs atomic.Int32
+
+	once sync.Once
+	buf  *bytes.Buffer
+	err  error
+
+	prepareOnce sync.Once
+	pm          *websocket.PreparedMessage
+	prepareErr  error
+}
+
+// newShared returns a broadcast with one reference, held by the caller.
+func newShared(msg Message) *shared {
+	s := &shared{msg: msg}
+	s.refs.Store(1)
+
+	return s
+}
+
+// retain adds a reference for another recipient.
+func (s *shared) retain() {
+	s.refs.Add(1)
+}
+
+// release drops a reference, recycling the buffer after the last one.
+func (s *shared) release() {
+	if s.refs.Add(-1) == 0 && s.buf != nil {
+		bufferPool.Put(s.buf)
+	}
+}
+
+// bytes returns the encoded message, valid until the caller releases it.
+func (s *shared) bytes() ([]byte, error) {
+	s.once.Do(func() { s.buf, s.err = encode(s.msg) })
+
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	return s.buf.Bytes(), nil
+}
+
+// prepared returns the message prepared for preparedWriter connections.
+func (s *shared) prepared() (*websocket.PreparedMessage, error) {
+	s.prepareOnce.Do(func() {
+		buf, err := encode(s.msg)
+		if err != nil {
+			s.prepareErr = err
+
+			return
+		}
+
+		// The prepared message keeps a copy, so the buffer can go straight back
+		s.pm, s.prepareErr = websocket.NewPreparedMessage(websocket.TextMessage, buf.Bytes())
+		bufferPool.Put(buf)
+	})
+
+	return s.pm, s.prepareErr
+}
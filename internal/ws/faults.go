@@ -0,0 +1,258 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrInjectedDisconnect is returned by a connection a FaultInjector closed.
+var ErrInjectedDisconnect = errors.New("injected disconnect")
+
+// reorderWindow is how long a message held back to be reordered waits for
+// the next one before it's written anyway.
+const reorderWindow = 50 * time.Millisecond
+
+// FaultProfile describes the network faults a FaultInjector injects, for
+// testing how clients cope with a bad network. Probabilities are per
+// message, in both directions unless noted.
+type FaultProfile struct {
+	Seed       uint64
+	Latency    time.Duration // Most delay added to each message; each gets a random share of it
+	Reorder    float64       // Written messages held back and written after the next one, except the first
+	Drop       float64       // Messages lost, taking the connection down with them
+	Disconnect float64       // Connections closed before a message, which is never sent
+}
+
+// ParseFaultProfile parses a profile written as comma-separated settings,
+// such as "seed=7,latency=20ms,reorder=0.1,drop=0.01,disconnect=0.005".
+// Settings left out are zero.
+func ParseFaultProfile(s string) (FaultProfile, error) {
+	var p FaultProfile
+
+	for setting := range strings.SplitSeq(s, ",") {
+		setting = strings.TrimSpace(setting)
+		if setting == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(setting, "=")
+		if !ok {
+			return FaultProfile{}, fmt.Errorf("fault setting %q: expected name=value", setting)
+		}
+
+		var err error
+
+		switch name {
+		case "seed":
+			p.Seed, err = strconv.ParseUint(value, 10, 64)
+		case "latency":
+			p.Latency, err = time.ParseDuration(value)
+			if err == nil && p.Latency < 0 {
+				err = errors.New("must not be negative")
+			}
+		case "reorder":
+			p.Reorder, err = parseProbability(value)
+		case "drop":
+			p.Drop, err = parseProbability(value)
+		case "disconnect":
+			p.Disconnect, err = parseProbability(value)
+		default:
+			return FaultProfile{}, fmt.Errorf("unknown fault setting %q", name)
+		}
+
+		if err != nil {
+			return FaultProfile{}, fmt.Errorf("fault setting %s: %w", name, err)
+		}
+	}
+
+	if p.Drop+p.Disconnect > 1 {
+		return FaultProfile{}, errors.New("fault settings drop and disconnect must not add up to more than 1")
+	}
+
+	return p, nil
+}
+
+func parseProbability(value string) (float64, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 || f > 1 {
+		return 0, fmt.Errorf("invalid probability %q", value)
+	}
+
+	return f, nil
+}
+
+// FaultInjector wraps connections so they suffer the faults of a profile.
+// Each connection draws its faults from its own generator, seeded from the
+// profile's seed and the order it was wrapped in, so the same profile
+// injects the same faults into the same sequence of messages.
+type FaultInjector struct {
+	profile FaultProfile
+	conns   atomic.Uint64 // Connections wrapped so far
+}
+
+// NewFaultInjector creates an injector for profile.
+func NewFaultInjector(profile FaultProfile) *FaultInjector {
+	return &FaultInjector{profile: profile}
+}
+
+// Wrap returns conn with the injector's faults. Writes lose the fast paths
+// of the raw connection, so faults apply to every message.
+func (f *FaultInjector) Wrap(conn Conn) Conn {
+	n := f.conns.Add(1)
+
+	return &faultyConn{
+		conn:    conn,
+		profile: f.profile,
+		rng:     rand.New(rand.NewPCG(f.profile.Seed, 2*n)),   //nolint:gosec // Reproducible, not secret
+		readRng: rand.New(rand.NewPCG(f.profile.Seed, 2*n+1)), //nolint:gosec // Reproducible, not secret
+	}
+}
+
+// faultyConn is a connection suffering a FaultProfile's faults. Reads and
+// writes draw from separate generators, so the faults of one direction
+// don't depend on how the other's interleave with them.
+type faultyConn struct {
+	conn    Conn
+	profile FaultProfile
+	readRng *rand.Rand // Used by the single reader
+
+	mu      sync.Mutex // Serializes writes, including the held message's
+	rng     *rand.Rand
+	written bool            // The first message was written; clients expect it to be the document's state
+	held    json.RawMessage // A message held back to be written after the next one
+	flush   *time.Timer     // Writes held if no other message comes first
+}
+
+func (c *faultyConn) WriteJSON(v any) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.roll(c.rng) {
+	case faultDisconnect:
+		_ = c.conn.Close()
+
+		return ErrInjectedDisconnect
+	case faultDrop:
+		// The message looks sent to the writer; the connection only turns
+		// out to be gone afterwards
+		_ = c.conn.Close()
+
+		return nil
+	case faultNone:
+	}
+
+	c.delay(c.rng)
+
+	if c.written && c.held == nil && c.rng.Float64() < c.profile.Reorder {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		c.held = data
+		c.flush = time.AfterFunc(reorderWindow, c.writeHeld)
+
+		return nil
+	}
+
+	if err := c.conn.WriteJSON(v); err != nil {
+		return err
+	}
+
+	c.written = true
+
+	if c.held != nil {
+		c.flush.Stop()
+
+		return c.writeHeldLocked()
+	}
+
+	return nil
+}
+
+// writeHeld writes the held message once no other message came to overtake
+// it.
+func (c *faultyConn) writeHeld() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_ = c.writeHeldLocked()
+}
+
+// writeHeldLocked writes the held message, if any. The caller must hold
+// c.mu.
+func (c *faultyConn) writeHeldLocked() error {
+	if c.held == nil {
+		return nil
+	}
+
+	data := c.held
+	c.held = nil
+
+	return c.conn.WriteJSON(data)
+}
+
+func (c *faultyConn) ReadJSON(v any) error {
+	f := c.roll(c.readRng)
+	if f == faultDisconnect {
+		_ = c.conn.Close()
+
+		return ErrInjectedDisconnect
+	}
+
+	if err := c.conn.ReadJSON(v); err != nil {
+		return err
+	}
+
+	// The message arrived, but is lost with the connection
+	if f == faultDrop {
+		_ = c.conn.Close()
+
+		return ErrInjectedDisconnect
+	}
+
+	c.delay(c.readRng)
+
+	return nil
+}
+
+func (c *faultyConn) Close() error {
+	return c.conn.Close()
+}
+
+// fault is what happens to a message.
+type fault int
+
+const (
+	faultNone       fault = iota
+	faultDrop             // The message is lost and the connection closed
+	faultDisconnect       // The connection is closed before the message
+)
+
+// roll chooses the fault of the next message.
+func (c *faultyConn) roll(rng *rand.Rand) fault {
+	r := rng.Float64()
+
+	switch {
+	case r < c.profile.Disconnect:
+		return faultDisconnect
+	case r < c.profile.Disconnect+c.profile.Drop:
+		return faultDrop
+	default:
+		return faultNone
+	}
+}
+
+// delay waits for a random share of the profile's latency.
+func (c *faultyConn) delay(rng *rand.Rand) {
+	if c.profile.Latency > 0 {
+		time.Sleep(time.Duration(rng.Int64N(int64(c.profile.Latency) + 1)))
+	}
+}
@@ -0,0 +1,145 @@
+package ws_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFaultProfile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		profile string
+		want    ws.FaultProfile
+		wantErr string
+	}{
+		{name: "empty", profile: ""},
+		{
+			name:    "every setting",
+			profile: "seed=7, latency=20ms, reorder=0.1, drop=0.01, disconnect=0.005",
+			want:    ws.FaultProfile{Seed: 7, Latency: 20 * time.Millisecond, Reorder: 0.1, Drop: 0.01, Disconnect: 0.005},
+		},
+		{name: "no value", profile: "seed", wantErr: "expected name=value"},
+		{name: "unknown setting", profile: "jitter=5ms", wantErr: `unknown fault setting "jitter"`},
+		{name: "bad seed", profile: "seed=-1", wantErr: "fault setting seed"},
+		{name: "negative latency", profile: "latency=-1s", wantErr: "must not be negative"},
+		{name: "bad probability", profile: "reorder=1.5", wantErr: `invalid probability "1.5"`},
+		{name: "certain loss", profile: "drop=0.6,disconnect=0.6", wantErr: "must not add up to more than 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ws.ParseFaultProfile(tt.profile)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// revisions writes acks for revisions 1 to n through a connection with the
+// profile's faults and returns the revisions in the order they arrived.
+func revisions(t *testing.T, profile ws.FaultProfile, n int) []int {
+	t.Helper()
+
+	conn := newMockConn()
+	faulty := ws.NewFaultInjector(profile).Wrap(conn)
+
+	for revision := 1; revision <= n; revision++ {
+		require.NoError(t, faulty.WriteJSON(ws.Message{Type: ws.MessageTypeAck, Payload: ws.AckPayload{Revision: revision}}))
+	}
+
+	// The last message may be held back for a while
+	require.Eventually(t, func() bool { return len(conn.Messages()) == n }, time.Second, 5*time.Millisecond)
+
+	got := make([]int, 0, n)
+	for _, msg := range conn.Messages() {
+		payload, ok := msg.Payload.(map[string]any)
+		require.True(t, ok)
+
+		revision, ok := payload["revision"].(float64)
+		require.True(t, ok)
+
+		got = append(got, int(revision))
+	}
+
+	return got
+}
+
+func TestFaultInjector_Reorder(t *testing.T) {
+	t.Parallel()
+
+	profile := ws.FaultProfile{Seed: 1, Reorder: 0.3}
+
+	got := revisions(t, profile, 50)
+	require.Equal(t, 1, got[0], "the first message is never held back")
+	require.NotEqual(t, revisions(t, ws.FaultProfile{}, 50), got)
+	require.ElementsMatch(t, revisions(t, ws.FaultProfile{}, 50), got)
+
+	// The same profile reorders the same messages
+	require.Equal(t, got, revisions(t, profile, 50))
+	require.NotEqual(t, got, revisions(t, ws.FaultProfile{Seed: 2, Reorder: 0.3}, 50))
+}
+
+func TestFaultInjector_Write(t *testing.T) {
+	t.Parallel()
+
+	msg := ws.Message{Type: ws.MessageTypeAck, Payload: ws.AckPayload{Revision: 1}}
+
+	// A dropped message looks sent, but the connection is gone
+	conn := newMockConn()
+	require.NoError(t, ws.NewFaultInjector(ws.FaultProfile{Drop: 1}).Wrap(conn).WriteJSON(msg))
+	require.Empty(t, conn.Messages())
+	require.True(t, conn.IsClosed())
+
+	conn = newMockConn()
+	err := ws.NewFaultInjector(ws.FaultProfile{Disconnect: 1}).Wrap(conn).WriteJSON(msg)
+	require.ErrorIs(t, err, ws.ErrInjectedDisconnect)
+	require.Empty(t, conn.Messages())
+	require.True(t, conn.IsClosed())
+}
+
+func TestFaultInjector_Read(t *testing.T) {
+	t.Parallel()
+
+	msg := ws.Message{Type: ws.MessageTypeSync, Payload: ws.SyncPayload{DocID: "doc"}}
+
+	// A dropped message is read off the connection and lost with it
+	conn := newMockConn()
+	conn.incoming <- msg
+
+	var got ws.Message
+
+	err := ws.NewFaultInjector(ws.FaultProfile{Drop: 1}).Wrap(conn).ReadJSON(&got)
+	require.ErrorIs(t, err, ws.ErrInjectedDisconnect)
+	require.Empty(t, conn.incoming)
+	require.True(t, conn.IsClosed())
+
+	conn = newMockConn()
+	conn.incoming <- msg
+
+	err = ws.NewFaultInjector(ws.FaultProfile{Disconnect: 1}).Wrap(conn).ReadJSON(&got)
+	require.ErrorIs(t, err, ws.ErrInjectedDisconnect)
+	require.Len(t, conn.incoming, 1)
+	require.True(t, conn.IsClosed())
+
+	// Latency delays messages without losing them
+	conn = newMockConn()
+	conn.incoming <- msg
+
+	faulty := ws.NewFaultInjector(ws.FaultProfile{Latency: 10 * time.Millisecond}).Wrap(conn)
+	require.NoError(t, faulty.ReadJSON(&got))
+	require.Equal(t, ws.MessageTypeSync, got.Type)
+	require.False(t, conn.IsClosed())
+}
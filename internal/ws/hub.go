@@ -1,7 +1,14 @@
 package ws
 
 import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
 	"sync"
+
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/ot"
 )
 
 // Hub manages WebSocket clients and broadcasts operations.
@@ -13,14 +20,36 @@ type Hub struct {
 
 	// documents maps document ID to set of client IDs
 	documents map[string]map[string]struct{}
+
+	// presence maps document ID to the clients announced in it
+	presence map[string]map[string]*presence
+
+	bridge Bridge // Optional: relays broadcasts to other instances
+	pool   pool   // Writes broadcasts to local clients
+	logger *slog.Logger
 }
 
-// NewHub creates a new Hub.
+// NewHub creates a new Hub that logs through slog.Default() until SetLogger
+// is called.
 func NewHub() *Hub {
-	return &Hub{
+	h := &Hub{
 		clients:   make(map[string]*Client),
 		documents: make(map[string]map[string]struct{}),
+		presence:  make(map[string]map[string]*presence),
+		logger:    logging.Component(nil, "ws"),
 	}
+	h.pool.wake = sync.NewCond(&h.pool.mu)
+
+	return h
+}
+
+// SetLogger makes the hub log through logger. Call it before clients are
+// registered.
+func (h *Hub) SetLogger(logger *slog.Logger) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.logger = logging.Component(logger, "ws")
 }
 
 // Register adds a client to the hub.
@@ -32,108 +61,146 @@ func (h *Hub) Register(client *Client) {
 }
 
 // Unregister removes a client from the hub and any document subscriptions.
+// If it was announced, the document's other clients are told it left.
 func (h *Hub) Unregister(client *Client) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
 
 	// Remove from document subscription
 	docID := client.DocID()
-	if docID != "" {
-		if clients, ok := h.documents[docID]; ok {
-			delete(clients, client.ID)
+	announced := false
 
-			if len(clients) == 0 {
-				delete(h.documents, docID)
-			}
-		}
+	if docID != "" {
+		h.leave(docID, client.ID)
+		announced = h.forget(docID, client.ID)
 	}
 
 	delete(h.clients, client.ID)
+	h.mu.Unlock()
+
+	if announced {
+		h.announceLeave(docID, client)
+	}
 }
 
-// Subscribe adds a client to a document's broadcast list.
+// Subscribe adds a client to a document's broadcast list. A client
+// switching documents leaves the previous one.
 func (h *Hub) Subscribe(client *Client, docID string) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
 
 	// Unsubscribe from previous document
 	oldDocID := client.DocID()
-	if oldDocID != "" && oldDocID != docID {
-		if clients, ok := h.documents[oldDocID]; ok {
-			delete(clients, client.ID)
+	announced := false
 
-			if len(clients) == 0 {
-				delete(h.documents, oldDocID)
-			}
-		}
+	if oldDocID != "" && oldDocID != docID {
+		h.leave(oldDocID, client.ID)
+		announced = h.forget(oldDocID, client.ID)
 	}
 
 	// Subscribe to new document
-	if h.documents[docID] == nil {
-		h.documents[docID] = make(map[string]struct{})
-	}
-
-	h.documents[docID][client.ID] = struct{}{}
+	h.join(docID, client.ID)
 	client.SetDocID(docID)
+	h.mu.Unlock()
+
+	if announced {
+		h.announceLeave(oldDocID, client)
+	}
 }
 
 // Unsubscribe removes a client from a document's broadcast list.
 func (h *Hub) Unsubscribe(client *Client, docID string) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
 
-	if clients, ok := h.documents[docID]; ok {
-		delete(clients, client.ID)
-
-		if len(clients) == 0 {
-			delete(h.documents, docID)
-		}
-	}
+	h.leave(docID, client.ID)
+	announced := h.forget(docID, client.ID)
 
 	if client.DocID() == docID {
 		client.SetDocID("")
 	}
+
+	h.mu.Unlock()
+
+	if announced {
+		h.announceLeave(docID, client)
+	}
 }
 
 // Broadcast sends a message to all clients subscribed to a document,
-// except the sender (identified by excludeClientID).
+// except the sender (identified by excludeClientID), and to other instances
+// through the bridge.
 func (h *Hub) Broadcast(docID string, msg Message, excludeClientID string) {
+	h.send(docID, msg, excludeClientID)
+
 	h.mu.RLock()
-	defer h.mu.RUnlock()
+	bridge := h.bridge
+	h.mu.RUnlock()
 
-	clientIDs, ok := h.documents[docID]
-	if !ok {
+	if bridge == nil {
 		return
 	}
 
-	for clientID := range clientIDs {
+	if err := bridge.Publish(docID, msg); err != nil {
+		h.logger.Warn("bridge publish failed", logging.DocID(docID), logging.Err(err))
+	}
+}
+
+// send queues a message for the local clients subscribed to a document,
+// except excludeClientID. It doesn't wait for slow clients; those that fall
+// too far behind are disconnected.
+func (h *Hub) send(docID string, msg Message, excludeClientID string) {
+	var slow []*Client
+
+	// Every recipient shares one encoding of the message
+	queued := newShared(msg)
+	defer queued.release()
+
+	h.mu.RLock()
+
+	// Clients are told who's there when they're announced, and kept up to
+	// date from then on
+	announced := h.presence[docID]
+
+	for clientID := range h.documents[docID] {
 		if clientID == excludeClientID {
 			continue
 		}
 
+		if _, ok := announced[clientID]; !ok && msg.Type == MessageTypePresence {
+			continue
+		}
+
 		client, ok := h.clients[clientID]
 		if !ok {
 			continue
 		}
 
-		// Send in goroutine to avoid blocking on slow clients
-		go func(c *Client) {
-			_ = c.Send(msg)
-		}(client)
+		if !h.enqueue(client, queued) {
+			slow = append(slow, client)
+		}
+	}
+
+	h.mu.RUnlock()
+
+	for _, client := range slow {
+		h.drop(client, docID)
 	}
 }
 
 // BroadcastOperation is a convenience method for broadcasting an operation.
-func (h *Hub) BroadcastOperation(docID string, revision, opType, position int, char, userID, excludeClientID string) {
+// It also moves the document's recorded cursors past it.
+func (h *Hub) BroadcastOperation(docID string, op ot.SequencedOperation, userID, excludeClientID string) {
+	h.shiftCursors(docID, op.Revision, op.Operation, excludeClientID)
+
 	msg := Message{
 		Type: MessageTypeBroadcast,
 		Payload: BroadcastPayload{
-			DocID:    docID,
-			Revision: revision,
-			OpType:   opType,
-			Position: position,
-			Char:     char,
-			UserID:   userID,
+			DocID:     docID,
+			Revision:  op.Revision,
+			OpType:    int(op.Type),
+			Position:  op.Position,
+			Char:      op.Char,
+			Attribute: op.Attribute,
+			Value:     op.Value,
+			UserID:    userID,
 		},
 	}
 
@@ -152,6 +219,130 @@ func (h *Hub) ClientCount(docID string) int {
 	return 0
 }
 
+// Presence returns the sorted, de-duplicated IDs of users subscribed to a document.
+func (h *Hub) Presence(docID string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	users := make([]string, 0, len(h.documents[docID]))
+
+	for clientID := range h.documents[docID] {
+		if client, ok := h.clients[clientID]; ok {
+			users = append(users, client.UserID)
+		}
+	}
+
+	slices.Sort(users)
+
+	return slices.Compact(users)
+}
+
+// Participant is a user or bot subscribed to a document.
+type Participant struct {
+	UserID string
+	Bot    bool
+}
+
+// Participants returns who is subscribed to a document, sorted by user ID
+// and de-duplicated.
+func (h *Hub) Participants(docID string) []Participant {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	participants := make([]Participant, 0, len(h.documents[docID]))
+
+	for clientID := range h.documents[docID] {
+		if client, ok := h.clients[clientID]; ok {
+			participants = append(participants, Participant{UserID: client.UserID, Bot: client.Bot})
+		}
+	}
+
+	slices.SortFunc(participants, func(a, b Participant) int { return strings.Compare(a.UserID, b.UserID) })
+
+	return slices.Compact(participants)
+}
+
+// Disconnect closes the connections of all clients subscribed to a document
+// and returns how many were closed. Their read loops then unregister them.
+func (h *Hub) Disconnect(docID string) int {
+	clients := h.subscribers(docID)
+
+	for _, client := range clients {
+		_ = client.Close()
+	}
+
+	return len(clients)
+}
+
+// DisconnectAll tells every client the server is closing for the given
+// reason, then closes its connection, and returns how many were closed.
+// Connections still being written to when ctx is done are closed anyway.
+func (h *Hub) DisconnectAll(ctx context.Context, reason string) int {
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.clients))
+
+	for _, client := range h.clients {
+		clients = append(clients, client)
+	}
+
+	h.mu.RUnlock()
+
+	return sendAndClose(ctx, clients, Message{Type: MessageTypeClosing, Payload: ClosingPayload{Reason: reason}})
+}
+
+// Evict sends msg to all clients subscribed to a document, telling them why
+// they're disconnected, then closes their connections, and returns how many
+// were closed. Connections still being written to when ctx is done are
+// closed anyway.
+func (h *Hub) Evict(ctx context.Context, docID string, msg Message) int {
+	return sendAndClose(ctx, h.subscribers(docID), msg)
+}
+
+// subscribers returns the clients subscribed to a document.
+func (h *Hub) subscribers(docID string) []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	clients := make([]*Client, 0, len(h.documents[docID]))
+
+	for clientID := range h.documents[docID] {
+		if client, ok := h.clients[clientID]; ok {
+			clients = append(clients, client)
+		}
+	}
+
+	return clients
+}
+
+// sendAndClose sends msg to clients, then closes their connections once
+// it's sent or ctx is done, and returns how many were closed.
+func sendAndClose(ctx context.Context, clients []*Client, msg Message) int {
+	var wg sync.WaitGroup
+
+	for _, client := range clients {
+		wg.Go(func() { _ = client.Send(msg) })
+	}
+
+	sent := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(sent)
+	}()
+
+	select {
+	case <-sent:
+	case <-ctx.Done():
+	}
+
+	// Closing also unblocks the sends still waiting on a slow connection
+	for _, client := range clients {
+		_ = client.Close()
+	}
+
+	return len(clients)
+}
+
 // TotalClients returns the total number of connected clients.
 func (h *Hub) TotalClients() int {
 	h.mu.RLock()
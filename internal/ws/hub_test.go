@@ -2,11 +2,20 @@ package ws_test
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/gorilla/websocket"
+	"github.com/serroba/online-docs/internal/ot"
 	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
 )
 
 const testDocID = "doc1"
@@ -228,6 +237,11 @@ func TestHub_Broadcast(t *testing.T) {
 	}
 }
 
+// insertOp returns an insert applied as the given revision.
+func insertOp(revision, position int, char, userID string) ot.SequencedOperation {
+	return ot.SequencedOperation{Operation: ot.NewInsert(char, position, userID), Revision: revision}
+}
+
 func TestHub_BroadcastOperation(t *testing.T) {
 	t.Parallel()
 
@@ -239,18 +253,31 @@ func TestHub_BroadcastOperation(t *testing.T) {
 	hub.Register(client)
 	hub.Subscribe(client, testDocID)
 
-	hub.BroadcastOperation(testDocID, 5, 0, 10, "a", "user2", "other")
+	hub.BroadcastOperation(testDocID, insertOp(5, 10, "a", "user2"), "user2", "other")
+
+	format := ot.SequencedOperation{Operation: ot.NewFormat(10, "bold", "true", "user2"), Revision: 6}
+	hub.BroadcastOperation(testDocID, format, "user2", "other")
 
 	time.Sleep(10 * time.Millisecond)
 
 	messages := conn.Messages()
-	if len(messages) != 1 {
-		t.Fatalf("expected 1 message, got %d", len(messages))
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(messages))
 	}
 
 	if messages[0].Type != ws.MessageTypeBroadcast {
 		t.Errorf("expected broadcast type, got %s", messages[0].Type)
 	}
+
+	// Formats carry the attribute they set
+	payload, ok := messages[1].Payload.(map[string]any)
+	if !ok {
+		t.Fatalf("expected object payload, got %T", messages[1].Payload)
+	}
+
+	if payload["opType"] != float64(ot.Format) || payload["attribute"] != "bold" || payload["value"] != "true" {
+		t.Errorf("expected bold format, got %v", payload)
+	}
 }
 
 func TestHub_MultipleDocuments(t *testing.T) {
@@ -283,6 +310,146 @@ func TestHub_MultipleDocuments(t *testing.T) {
 	}
 }
 
+func TestHub_Presence(t *testing.T) {
+	t.Parallel()
+
+	hub := ws.NewHub()
+
+	for i, userID := range []string{"bob", "alice", "bob"} {
+		client := ws.NewClient(string(rune('a'+i)), userID, newMockConn())
+		hub.Register(client)
+		hub.Subscribe(client, testDocID)
+	}
+
+	other := ws.NewClient("other", "carol", newMockConn())
+	hub.Register(other)
+	hub.Subscribe(other, "doc2")
+
+	got := hub.Presence(testDocID)
+	if len(got) != 2 || got[0] != "alice" || got[1] != "bob" {
+		t.Errorf("expected [alice bob], got %v", got)
+	}
+
+	if got := hub.Presence("empty"); len(got) != 0 {
+		t.Errorf("expected no users, got %v", got)
+	}
+}
+
+func TestHub_Participants(t *testing.T) {
+	t.Parallel()
+
+	hub := ws.NewHub()
+
+	for i, userID := range []string{"bot:alice/notes", "bob", "bob"} {
+		client := ws.NewClient(string(rune('a'+i)), userID, newMockConn())
+		client.Bot = i == 0
+		hub.Register(client)
+		hub.Subscribe(client, testDocID)
+	}
+
+	want := []ws.Participant{{UserID: "bob"}, {UserID: "bot:alice/notes", Bot: true}}
+	if got := hub.Participants(testDocID); !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestHub_Disconnect(t *testing.T) {
+	t.Parallel()
+
+	hub := ws.NewHub()
+
+	conns := []*mockConn{newMockConn(), newMockConn()}
+	for i, conn := range conns {
+		client := ws.NewClient(string(rune('a'+i)), "alice", conn)
+		hub.Register(client)
+		hub.Subscribe(client, testDocID)
+	}
+
+	otherConn := newMockConn()
+	other := ws.NewClient("other", "bob", otherConn)
+	hub.Register(other)
+	hub.Subscribe(other, "doc2")
+
+	if got := hub.Disconnect(testDocID); got != 2 {
+		t.Errorf("expected 2 disconnected clients, got %d", got)
+	}
+
+	for i, conn := range conns {
+		if !conn.IsClosed() {
+			t.Errorf("expected client %d to be closed", i)
+		}
+	}
+
+	if otherConn.IsClosed() {
+		t.Error("expected client on another document to stay open")
+	}
+
+	if got := hub.Disconnect("empty"); got != 0 {
+		t.Errorf("expected no disconnected clients, got %d", got)
+	}
+}
+
+func TestHub_DisconnectAll(t *testing.T) {
+	t.Parallel()
+
+	hub := ws.NewHub()
+
+	conns := []*mockConn{newMockConn(), newMockConn()}
+	for i, conn := range conns {
+		client := ws.NewClient(string(rune('a'+i)), "alice", conn)
+		hub.Register(client)
+		hub.Subscribe(client, "doc"+string(rune('1'+i)))
+	}
+
+	if got := hub.DisconnectAll(t.Context(), "server shutting down"); got != 2 {
+		t.Errorf("expected 2 disconnected clients, got %d", got)
+	}
+
+	for i, conn := range conns {
+		if !conn.IsClosed() {
+			t.Errorf("expected client %d to be closed", i)
+		}
+
+		msgs := conn.Messages()
+		if len(msgs) != 1 || msgs[0].Type != ws.MessageTypeClosing {
+			t.Errorf("expected client %d to be warned before closing, got %v", i, msgs)
+		}
+	}
+}
+
+func TestHub_Evict(t *testing.T) {
+	t.Parallel()
+
+	hub := ws.NewHub()
+
+	conn := newMockConn()
+	client := ws.NewClient("a", "alice", conn)
+	hub.Register(client)
+	hub.Subscribe(client, testDocID)
+
+	otherConn := newMockConn()
+	other := ws.NewClient("other", "bob", otherConn)
+	hub.Register(other)
+	hub.Subscribe(other, "doc2")
+
+	msg := ws.Message{Type: ws.MessageTypeError, Payload: ws.ErrorPayload{Code: ws.ErrorCodeDocumentArchived}}
+	if got := hub.Evict(t.Context(), testDocID, msg); got != 1 {
+		t.Errorf("expected 1 disconnected client, got %d", got)
+	}
+
+	if !conn.IsClosed() {
+		t.Error("expected client to be closed")
+	}
+
+	if msgs := conn.Messages(); len(msgs) != 1 || msgs[0].Type != ws.MessageTypeError {
+		t.Errorf("expected client to be told why before closing, got %v", msgs)
+	}
+
+	if otherConn.IsClosed() || len(otherConn.Messages()) != 0 {
+		t.Error("expected client on another document to be left alone")
+	}
+}
+
 func TestHub_ConcurrentOperations(t *testing.T) {
 	t.Parallel()
 
@@ -370,3 +537,258 @@ func TestHub_Broadcast_ClientNotInMap(t *testing.T) {
 		t.Errorf("excluded client should not receive, got %d messages", len(conn2.Messages()))
 	}
 }
+
+func TestHub_Broadcast_KeepsOrder(t *testing.T) {
+	t.Parallel()
+
+	hub := ws.NewHub()
+	conn := newMockConn()
+	client := ws.NewClient("c1", "user1", conn)
+
+	hub.Register(client)
+	hub.Subscribe(client, testDocID)
+
+	for i := range 100 {
+		hub.Broadcast(testDocID, ws.Message{Type: ws.MessageTypeBroadcast, Payload: float64(i)}, "")
+	}
+
+	require.Eventually(t, func() bool { return len(conn.Messages()) == 100 }, time.Second, time.Millisecond)
+
+	for i, msg := range conn.Messages() {
+		require.InDelta(t, float64(i), msg.Payload, 0)
+	}
+
+	require.Equal(t, ws.QueueStats{}, hub.QueueStats())
+}
+
+// blockingConn is a connection whose writes wait until it's closed, like a
+// client that stopped reading.
+type blockingConn struct {
+	mockConn
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newBlockingConn() *blockingConn {
+	return &blockingConn{mockConn: *newMockConn(), done: make(chan struct{})}
+}
+
+func (c *blockingConn) WriteJSON(any) error {
+	<-c.done
+
+	return errors.New("connection closed")
+}
+
+func (c *blockingConn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+
+	return c.mockConn.Close()
+}
+
+func TestHub_Broadcast_SlowClient(t *testing.T) {
+	t.Parallel()
+
+	hub := ws.NewHub()
+
+	slowConn := newBlockingConn()
+	slow := ws.NewClient("slow", "user1", slowConn)
+	fastConn := newMockConn()
+	fast := ws.NewClient("fast", "user2", fastConn)
+
+	for _, client := range []*ws.Client{slow, fast} {
+		hub.Register(client)
+		hub.Subscribe(client, testDocID)
+	}
+
+	msg := ws.Message{Type: ws.MessageTypeBroadcast, Payload: "op"}
+
+	for range 10 {
+		hub.Broadcast(testDocID, msg, "")
+	}
+
+	// One message is being written and the rest wait behind it
+	require.Eventually(t, func() bool {
+		return hub.QueueStats() == ws.QueueStats{Queued: 9, MaxDepth: 9}
+	}, time.Second, time.Millisecond)
+
+	// The fast client keeps up while the slow one falls behind
+	for sent := 11; sent <= 1100; sent++ {
+		hub.Broadcast(testDocID, msg, "")
+		require.Eventually(t, func() bool { return len(fastConn.Messages()) == sent }, time.Second, 50*time.Microsecond)
+	}
+
+	require.True(t, slowConn.IsClosed(), "a client whose queue filled up is disconnected")
+	require.False(t, fastConn.IsClosed())
+	require.Eventually(t, func() bool {
+		return hub.QueueStats() == ws.QueueStats{Dropped: 1}
+	}, time.Second, time.Millisecond)
+}
+
+// frameConn is a connection that takes encoded messages, like
+// *websocket.Conn, and records the frames written.
+type frameConn struct {
+	mockConn
+
+	framesMu sync.Mutex
+	frames   []string
+}
+
+func (c *frameConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != 1 {
+		return errors.New("expected a text frame")
+	}
+
+	c.framesMu.Lock()
+	defer c.framesMu.Unlock()
+
+	// The data is only valid during the call, as with *websocket.Conn
+	c.frames = append(c.frames, string(data))
+
+	return nil
+}
+
+func (c *frameConn) Frames() []string {
+	c.framesMu.Lock()
+	defer c.framesMu.Unlock()
+
+	return slices.Clone(c.frames)
+}
+
+func TestHub_Broadcast_EncodedOnce(t *testing.T) {
+	t.Parallel()
+
+	hub := ws.NewHub()
+
+	frames := []*frameConn{{mockConn: *newMockConn()}, {mockConn: *newMockConn()}}
+	plain := newMockConn()
+
+	clients := []*ws.Client{
+		ws.NewClient("c1", "user1", frames[0]),
+		ws.NewClient("c2", "user2", frames[1]),
+		ws.NewClient("c3", "user3", plain),
+	}
+	for _, client := range clients {
+		hub.Register(client)
+		hub.Subscribe(client, testDocID)
+	}
+
+	for i := range 50 {
+		hub.BroadcastOperation(testDocID, insertOp(i+1, i, "x", "alice"), "alice", "")
+	}
+
+	require.Eventually(t, func() bool {
+		return len(frames[0].Frames()) == 50 && len(frames[1].Frames()) == 50 && len(plain.Messages()) == 50
+	}, time.Second, time.Millisecond)
+
+	// Connections taking encoded messages get what WriteJSON would have sent
+	for i, frame := range frames[0].Frames() {
+		want := fmt.Sprintf(`{"type":"broadcast","payload":{"docId":"doc1","revision":%d,"opType":0,"position":%d,`+
+			`"char":"x","userId":"alice"}}`+"\n", i+1, i)
+		require.Equal(t, want, frame)
+	}
+
+	require.Equal(t, frames[0].Frames(), frames[1].Frames())
+	require.Equal(t, ws.MessageTypeBroadcast, plain.Messages()[0].Type)
+
+	// Direct sends are encoded the same way
+	require.NoError(t, clients[0].SendError("invalid_message", "bad"))
+	require.Equal(t, `{"type":"error","payload":{"code":"invalid_message","message":"bad"}}`+"\n",
+		frames[0].Frames()[50])
+}
+
+// dialPair returns the server and client ends of a WebSocket connection.
+func dialPair(t *testing.T) (*websocket.Conn, *websocket.Conn) {
+	t.Helper()
+
+	serverConns := make(chan *websocket.Conn, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+
+			return
+		}
+
+		serverConns <- conn
+	}))
+	t.Cleanup(server.Close)
+
+	client, resp, err := websocket.DefaultDialer.DialContext(t.Context(), "ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	t.Cleanup(func() { _ = client.Close() })
+
+	conn := <-serverConns
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn, client
+}
+
+func TestHub_Broadcast_PreparedMessage(t *testing.T) {
+	t.Parallel()
+
+	hub := ws.NewHub()
+
+	var readers []*websocket.Conn
+
+	for i := range 2 {
+		conn, reader := dialPair(t)
+		readers = append(readers, reader)
+
+		client := ws.NewClient(fmt.Sprintf("c%d", i), "user", conn)
+		hub.Register(client)
+		hub.Subscribe(client, testDocID)
+	}
+
+	hub.BroadcastOperation(testDocID, insertOp(1, 0, "x", "alice"), "alice", "")
+
+	// Every connection gets the frame prepared for the first
+	for _, reader := range readers {
+		require.NoError(t, reader.SetReadDeadline(time.Now().Add(time.Second)))
+
+		messageType, data, err := reader.ReadMessage()
+		require.NoError(t, err)
+		require.Equal(t, websocket.TextMessage, messageType)
+		require.JSONEq(t, `{"type":"broadcast","payload":{"docId":"doc1","revision":1,"opType":0,"position":0,`+
+			`"char":"x","userId":"alice"}}`, string(data))
+	}
+}
+
+// countingConn is a connection that takes encoded messages and marks each
+// one written on a WaitGroup.
+type countingConn struct {
+	mockConn
+
+	written *sync.WaitGroup
+}
+
+func (c *countingConn) WriteMessage(int, []byte) error {
+	c.written.Done()
+
+	return nil
+}
+
+func BenchmarkHub_Broadcast(b *testing.B) {
+	for _, clients := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("clients=%d", clients), func(b *testing.B) {
+			hub := ws.NewHub()
+
+			var written sync.WaitGroup
+
+			for i := range clients {
+				client := ws.NewClient(fmt.Sprintf("c%d", i), "u1", &countingConn{written: &written})
+				hub.Register(client)
+				hub.Subscribe(client, testDocID)
+			}
+
+			// Each iteration waits until every client has been written to
+			for b.Loop() {
+				written.Add(clients)
+				hub.BroadcastOperation(testDocID, insertOp(1, 0, "a", "u2"), "u2", "")
+				written.Wait()
+			}
+		})
+	}
+}
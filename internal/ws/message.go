@@ -5,14 +5,20 @@ type MessageType string
 
 const (
 	// Client to Server messages.
-	MessageTypeOperation MessageType = "operation" // Client submits an edit
-	MessageTypeSync      MessageType = "sync"      // Client requests current state
+	MessageTypeOperation      MessageType = "operation"       // Client submits an edit
+	MessageTypeOperationBatch MessageType = "operation_batch" // Client submits several edits at once
+	MessageTypeSync           MessageType = "sync"            // Client requests current state
+	MessageTypeCursor         MessageType = "cursor"          // Client moves its caret or selection
 
 	// Server to Client messages.
-	MessageTypeAck       MessageType = "ack"       // Server confirms operation applied
-	MessageTypeBroadcast MessageType = "broadcast" // Server pushes operation to clients
-	MessageTypeState     MessageType = "state"     // Server sends full document state
-	MessageTypeError     MessageType = "error"     // Server reports an error
+	MessageTypeAck               MessageType = "ack"                // Server confirms operation applied
+	MessageTypeBroadcast         MessageType = "broadcast"          // Server pushes operation to clients
+	MessageTypeState             MessageType = "state"              // Server sends full document state
+	MessageTypeCatchUp           MessageType = "catch_up"           // Server sends the operations a syncing client missed
+	MessageTypeError             MessageType = "error"              // Server reports an error
+	MessageTypePresence          MessageType = "presence"           // Server reports who joined, left or moved a cursor
+	MessageTypeClosing           MessageType = "closing"            // Server is shutting down and about to disconnect
+	MessageTypePermissionChanged MessageType = "permission_changed" // Server reports a user's role changed
 )
 
 // Message is the envelope for all WebSocket communication.
@@ -22,45 +28,159 @@ type Message struct {
 }
 
 // OperationPayload is sent when a client submits an edit.
+//
+// Edits from a connection are applied one at a time, in the order they
+// arrive. A client may number them with Seq, increasing with each edit sent
+// over the connection; the ack or error answering an edit carries its seq,
+// so clients with several edits in flight can tell which was answered. An
+// edit whose seq isn't above that of the last one the connection took is
+// rejected without being applied, as it was sent twice or out of order.
 type OperationPayload struct {
 	DocID        string `json:"docId"`
 	BaseRevision int    `json:"baseRevision"`
-	OpType       int    `json:"opType"` // 0 = insert, 1 = delete
+	OpType       int    `json:"opType"` // 0 = insert, 1 = delete, 2 = format
 	Position     int    `json:"position"`
 	Char         string `json:"char,omitempty"`
+	Attribute    string `json:"attribute,omitempty"` // Attribute a format sets, such as "bold"
+	Value        string `json:"value,omitempty"`     // Value a format sets it to, empty to clear it
+	Seq          int    `json:"seq,omitempty"`       // Optional: numbers the client's edits
+}
+
+// MaxBatchOperations is the most operations an operation batch may hold.
+const MaxBatchOperations = 100
+
+// OperationBatchPayload is sent when a client submits several edits at once,
+// such as a burst of keystrokes. They're applied in order, all or none, and
+// acknowledged once with the revision of the last.
+type OperationBatchPayload struct {
+	DocID        string           `json:"docId"`
+	BaseRevision int              `json:"baseRevision"`  // The revision the first operation is based on
+	Operations   []BatchOperation `json:"operations"`    // Each is based on the one before
+	Seq          int              `json:"seq,omitempty"` // Optional: numbers the batch among the client's edits
+}
+
+// BatchOperation is one edit of an operation batch.
+type BatchOperation struct {
+	OpType    int    `json:"opType"` // 0 = insert, 1 = delete, 2 = format
+	Position  int    `json:"position"`
+	Char      string `json:"char,omitempty"`
+	Attribute string `json:"attribute,omitempty"` // Attribute a format sets
+	Value     string `json:"value,omitempty"`     // Value a format sets it to, empty to clear it
+}
+
+// SyncPayload is sent when a client requests the document's state. A
+// client that gives the last revision it knows is sent the operations since
+// in a catch-up, or the full state if they're no longer available.
+type SyncPayload struct {
+	DocID    string `json:"docId"`
+	Revision *int   `json:"revision,omitempty"` // Optional: the client's last known revision
+}
+
+// CursorPayload is sent when a client moves its caret or selection.
+type CursorPayload struct {
+	DocID    string `json:"docId"`
+	Revision int    `json:"revision"` // The revision the positions refer to
+	Position int    `json:"position"` // The caret
+	Anchor   int    `json:"anchor"`   // Where the selection starts; equal to position when nothing is selected
 }
 
 // AckPayload confirms an operation was applied.
 type AckPayload struct {
-	Revision int `json:"revision"` // The assigned revision number
+	Revision int `json:"revision"`      // The assigned revision number
+	Seq      int `json:"seq,omitempty"` // The acknowledged edit's seq, if it had one
 }
 
 // BroadcastPayload pushes an operation to other clients.
 type BroadcastPayload struct {
-	DocID    string `json:"docId"`
-	Revision int    `json:"revision"`
-	OpType   int    `json:"opType"`
-	Position int    `json:"position"`
-	Char     string `json:"char,omitempty"`
-	UserID   string `json:"userId"`
+	DocID     string `json:"docId"`
+	Revision  int    `json:"revision"`
+	OpType    int    `json:"opType"`
+	Position  int    `json:"position"`
+	Char      string `json:"char,omitempty"`
+	Attribute string `json:"attribute,omitempty"` // Attribute a format sets
+	Value     string `json:"value,omitempty"`     // Value a format sets it to, empty to clear it
+	UserID    string `json:"userId"`
 }
 
-// StatePayload sends the full document state.
+// StatePayload sends the full document state, with the document's title
+// and properties.
 type StatePayload struct {
-	DocID    string `json:"docId"`
-	Content  string `json:"content"`
-	Revision int    `json:"revision"`
+	DocID      string            `json:"docId"`
+	Content    string            `json:"content"`
+	Formatting []Mark            `json:"formatting,omitempty"` // Runs of formatted characters in Content
+	Revision   int               `json:"revision"`
+	Title      string            `json:"title,omitempty"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// Mark is a run of characters, from Start up to End, with the same
+// formatting.
+type Mark struct {
+	Start      int               `json:"start"`
+	End        int               `json:"end"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// CatchUpPayload sends the operations applied since the revision a syncing
+// client gave, in order. Applying them brings the client to Revision.
+type CatchUpPayload struct {
+	DocID      string             `json:"docId"`
+	Revision   int                `json:"revision"` // The revision after the last operation
+	Operations []CatchUpOperation `json:"operations"`
+}
+
+// CatchUpOperation is an operation a client missed.
+type CatchUpOperation struct {
+	Revision  int    `json:"revision"`
+	OpType    int    `json:"opType"` // 0 = insert, 1 = delete, 2 = format
+	Position  int    `json:"position"`
+	Char      string `json:"char,omitempty"`
+	Attribute string `json:"attribute,omitempty"` // Attribute a format sets
+	Value     string `json:"value,omitempty"`     // Value a format sets it to, empty to clear it
+	UserID    string `json:"userId"`
+}
+
+// PresencePayload reports a change to who is in a document or where their
+// cursor is.
+type PresencePayload struct {
+	DocID    string        `json:"docId"`
+	Event    PresenceEvent `json:"event"`
+	ClientID string        `json:"clientId"`
+	UserID   string        `json:"userId"`
+	Bot      bool          `json:"bot,omitempty"`
+	Cursor   *Cursor       `json:"cursor,omitempty"`   // Absent until the client first moves its cursor
+	Revision int           `json:"revision,omitempty"` // The revision the cursor refers to
 }
 
 // ErrorPayload reports an error to the client.
 type ErrorPayload struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
+	Seq     int    `json:"seq,omitempty"` // The seq of the edit the error rejects, if it had one
+}
+
+// PermissionChangedPayload reports that an owner granted a user a role on
+// the document or revoked theirs. Every client of the document receives it;
+// clients of that user should refresh what they allow, or disconnect once
+// they can no longer read the document.
+type PermissionChangedPayload struct {
+	DocID  string `json:"docId"`
+	UserID string `json:"userId"`
+	Role   string `json:"role,omitempty"` // viewer, editor or owner; absent when revoked
+}
+
+// ClosingPayload warns a client that the server is shutting down, or its
+// document's session is closing, and its connection closes next. Clients
+// should reconnect and resend the edits that weren't acknowledged.
+type ClosingPayload struct {
+	Reason string `json:"reason"`
 }
 
 // Error codes.
 const (
-	ErrorCodeAccessDenied   = "access_denied"
-	ErrorCodeInvalidMessage = "invalid_message"
-	ErrorCodeInternalError  = "internal_error"
+	ErrorCodeAccessDenied     = "access_denied"
+	ErrorCodeDocumentArchived = "document_archived"
+	ErrorCodeInvalidMessage   = "invalid_message"
+	ErrorCodeInternalError    = "internal_error"
+	ErrorCodeRateLimited      = "rate_limited"
 )
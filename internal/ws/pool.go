@@ -0,0 +1,177 @@
+package ws
+
+import (
+	"sync"
+
+	"github.com/serroba/online-docs/internal/logging"
+)
+
+const (
+	// broadcastWorkers is how many goroutines write broadcasts to clients,
+	// however many clients are subscribed.
+	broadcastWorkers = 32
+
+	// clientQueueSize is how many broadcasts may wait for one client. A
+	// client that falls further behind is disconnected, so it resyncs
+	// instead of holding an ever-growing backlog.
+	clientQueueSize = 1024
+)
+
+// QueueStats describes the broadcasts waiting to be written to clients.
+type QueueStats struct {
+	Queued   int   // Messages waiting across all clients
+	MaxDepth int   // Messages waiting for the most backed-up client
+	Dropped  int64 // Clients disconnected because their queue filled up
+}
+
+// pool writes queued broadcasts to clients with a fixed set of workers. A
+// client is handed to one worker at a time, so its messages keep their order.
+type pool struct {
+	start sync.Once
+
+	mu      sync.Mutex
+	wake    *sync.Cond
+	ready   []*Client // Clients with queued messages and no worker yet
+	dropped int64
+}
+
+// enqueue queues msg for the client and schedules it on a worker, retaining
+// it until it's written. It reports false if the client's queue is full.
+// Messages for a client being dropped are discarded.
+func (h *Hub) enqueue(client *Client, msg *shared) bool {
+	h.pool.start.Do(h.startWorkers)
+
+	client.outMu.Lock()
+
+	if client.dropped || len(client.outbox) >= clientQueueSize {
+		dropped := client.dropped
+		client.outMu.Unlock()
+
+		return dropped
+	}
+
+	msg.retain()
+	client.outbox = append(client.outbox, msg)
+	schedule := !client.scheduled
+	client.scheduled = true
+
+	client.outMu.Unlock()
+
+	if schedule {
+		h.pool.mu.Lock()
+		h.pool.ready = append(h.pool.ready, client)
+		h.pool.mu.Unlock()
+		h.pool.wake.Signal()
+	}
+
+	return true
+}
+
+// startWorkers starts the broadcast workers. They run for the life of the
+// process, like the hub.
+func (h *Hub) startWorkers() {
+	for range broadcastWorkers {
+		go h.work()
+	}
+}
+
+// work writes the queued messages of one ready client after another.
+func (h *Hub) work() {
+	for {
+		h.pool.mu.Lock()
+
+		for len(h.pool.ready) == 0 {
+			h.pool.wake.Wait()
+		}
+
+		client := h.pool.ready[0]
+		h.pool.ready[0] = nil
+		h.pool.ready = h.pool.ready[1:]
+
+		h.pool.mu.Unlock()
+
+		h.drain(client)
+	}
+}
+
+// drain writes the client's queued messages until its queue is empty.
+func (h *Hub) drain(client *Client) {
+	for {
+		client.outMu.Lock()
+
+		if len(client.outbox) == 0 {
+			client.outbox = nil
+			client.scheduled = false
+			client.outMu.Unlock()
+
+			return
+		}
+
+		msg := client.outbox[0]
+		client.outbox[0] = nil
+		client.outbox = client.outbox[1:]
+
+		client.outMu.Unlock()
+
+		// A failed send means the connection is closing; its reader cleans up
+		if err := client.sendShared(msg); err != nil {
+			h.logger.Debug("broadcast failed",
+				logging.ClientID(client.ID), logging.UserID(client.UserID), logging.DocID(client.DocID()), logging.Err(err))
+		}
+
+		msg.release()
+	}
+}
+
+// drop disconnects a client whose queue is full. Its reader then unregisters it.
+func (h *Hub) drop(client *Client, docID string) {
+	client.outMu.Lock()
+
+	// Another broadcast already found the queue full
+	if client.dropped {
+		client.outMu.Unlock()
+
+		return
+	}
+
+	for _, msg := range client.outbox {
+		msg.release()
+	}
+
+	client.outbox = nil
+	client.dropped = true
+	client.outMu.Unlock()
+
+	h.pool.mu.Lock()
+	h.pool.dropped++
+	h.pool.mu.Unlock()
+
+	h.logger.Warn("disconnecting slow client",
+		logging.ClientID(client.ID), logging.UserID(client.UserID), logging.DocID(docID), "queued", clientQueueSize)
+
+	_ = client.Close()
+}
+
+// QueueStats returns the current depth of the clients' broadcast queues.
+func (h *Hub) QueueStats() QueueStats {
+	h.mu.RLock()
+
+	var stats QueueStats
+
+	for _, client := range h.clients {
+		client.outMu.Lock()
+		depth := len(client.outbox)
+		client.outMu.Unlock()
+
+		stats.Queued += depth
+		stats.MaxDepth = max(stats.MaxDepth, depth)
+	}
+
+	h.mu.RUnlock()
+
+	h.pool.mu.Lock()
+	stats.Dropped = h.pool.dropped
+	h.pool.mu.Unlock()
+
+	return stats
+}
@@ -0,0 +1,197 @@
+package ws
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/serroba/online-docs/internal/ot"
+)
+
+// PresenceEvent is what a presence message reports.
+type PresenceEvent string
+
+const (
+	PresenceJoin   PresenceEvent = "join"   // A client started editing the document
+	PresenceLeave  PresenceEvent = "leave"  // A client disconnected or switched documents
+	PresenceCursor PresenceEvent = "cursor" // A client moved its caret or selection
+)
+
+// Cursor is a client's caret and selection, as character positions.
+type Cursor struct {
+	Position int `json:"position"` // The caret
+	Anchor   int `json:"anchor"`   // Where the selection starts; equal to position when nothing is selected
+}
+
+// presence is the state of an announced client.
+type presence struct {
+	cursor   *Cursor
+	revision int // The revision the cursor refers to
+}
+
+// Announce makes a subscribed client visible to the other clients of its
+// document: it's queued a join message for each of them, and they're each
+// sent one for it. Announcing a client twice is a no-op.
+func (h *Hub) Announce(client *Client) {
+	h.mu.Lock()
+
+	docID := client.DocID()
+	_, subscribed := h.documents[docID][client.ID]
+	_, announced := h.presence[docID][client.ID]
+
+	if !subscribed || announced {
+		h.mu.Unlock()
+
+		return
+	}
+
+	for _, peer := range h.peers(docID) {
+		msg := newShared(Message{Type: MessageTypePresence, Payload: peer})
+		h.enqueue(client, msg)
+		msg.release()
+	}
+
+	if h.presence[docID] == nil {
+		h.presence[docID] = make(map[string]*presence)
+	}
+
+	h.presence[docID][client.ID] = &presence{}
+	h.mu.Unlock()
+
+	h.Broadcast(docID, presenceMessage(docID, PresenceJoin, client, nil, 0), client.ID)
+}
+
+// MoveCursor records an announced client's cursor, with the revision its
+// positions refer to, and sends it to the other clients of the document.
+func (h *Hub) MoveCursor(client *Client, cursor Cursor, revision int) {
+	h.mu.Lock()
+
+	docID := client.DocID()
+
+	p, ok := h.presence[docID][client.ID]
+	if !ok {
+		h.mu.Unlock()
+
+		return
+	}
+
+	p.cursor = &cursor
+	p.revision = revision
+	h.mu.Unlock()
+
+	h.Broadcast(docID, presenceMessage(docID, PresenceCursor, client, &cursor, revision), client.ID)
+}
+
+// Peers returns the announced clients of a document with their cursors,
+// sorted by user ID and client ID.
+func (h *Hub) Peers(docID string) []PresencePayload {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.peers(docID)
+}
+
+// peers returns the announced clients of a document. Must be called with
+// mu held.
+func (h *Hub) peers(docID string) []PresencePayload {
+	peers := make([]PresencePayload, 0, len(h.presence[docID]))
+
+	for clientID, p := range h.presence[docID] {
+		client, ok := h.clients[clientID]
+		if !ok {
+			continue
+		}
+
+		payload := PresencePayload{
+			DocID:    docID,
+			Event:    PresenceJoin,
+			ClientID: clientID,
+			UserID:   client.UserID,
+			Bot:      client.Bot,
+		}
+
+		if p.cursor != nil {
+			cursor := *p.cursor
+			payload.Cursor = &cursor
+			payload.Revision = p.revision
+		}
+
+		peers = append(peers, payload)
+	}
+
+	slices.SortFunc(peers, func(a, b PresencePayload) int {
+		return cmp.Or(cmp.Compare(a.UserID, b.UserID), cmp.Compare(a.ClientID, b.ClientID))
+	})
+
+	return peers
+}
+
+// shiftCursors moves the recorded cursors of a document past an operation,
+// so clients announced later see them where they are now. Clients already
+// there transform the cursors themselves as they apply the broadcast. The
+// author's own cursor is pushed by its inserts.
+func (h *Hub) shiftCursors(docID string, revision int, op ot.Operation, authorClientID string) {
+	h.mu.RLock()
+	empty := len(h.presence[docID]) == 0
+	h.mu.RUnlock()
+
+	if empty {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for clientID, p := range h.presence[docID] {
+		// Cursors sent after the operation already account for it
+		if p.cursor == nil || p.revision >= revision {
+			continue
+		}
+
+		push := clientID == authorClientID
+		p.cursor.Position = ot.TransformPosition(p.cursor.Position, op, push)
+		p.cursor.Anchor = ot.TransformPosition(p.cursor.Anchor, op, push)
+		p.revision = revision
+	}
+}
+
+// forget removes a client's presence in a document and reports whether it
+// had been announced. Must be called with mu held.
+func (h *Hub) forget(docID, clientID string) bool {
+	clients, ok := h.presence[docID]
+	if !ok {
+		return false
+	}
+
+	if _, ok := clients[clientID]; !ok {
+		return false
+	}
+
+	delete(clients, clientID)
+
+	if len(clients) == 0 {
+		delete(h.presence, docID)
+	}
+
+	return true
+}
+
+// announceLeave tells the other clients of a document that a client left.
+func (h *Hub) announceLeave(docID string, client *Client) {
+	h.Broadcast(docID, presenceMessage(docID, PresenceLeave, client, nil, 0), client.ID)
+}
+
+// presenceMessage returns a presence message about a client.
+func presenceMessage(docID string, event PresenceEvent, client *Client, cursor *Cursor, revision int) Message {
+	return Message{
+		Type: MessageTypePresence,
+		Payload: PresencePayload{
+			DocID:    docID,
+			Event:    event,
+			ClientID: client.ID,
+			UserID:   client.UserID,
+			Bot:      client.Bot,
+			Cursor:   cursor,
+			Revision: revision,
+		},
+	}
+}
@@ -0,0 +1,86 @@
+package ws_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// presenceEvents returns the presence messages a connection was sent, as
+// "event user" strings.
+func presenceEvents(t *testing.T, conn *mockConn) []string {
+	t.Helper()
+
+	var events []string
+
+	for _, msg := range conn.Messages() {
+		if msg.Type != ws.MessageTypePresence {
+			continue
+		}
+
+		data, err := json.Marshal(msg.Payload)
+		require.NoError(t, err)
+
+		var payload ws.PresencePayload
+		require.NoError(t, json.Unmarshal(data, &payload))
+
+		events = append(events, string(payload.Event)+" "+payload.UserID)
+	}
+
+	return events
+}
+
+func TestHub_Announce(t *testing.T) {
+	t.Parallel()
+
+	hub := ws.NewHub()
+	conns := map[string]*mockConn{}
+	clients := map[string]*ws.Client{}
+
+	for _, userID := range []string{"alice", "bob", "carol"} {
+		conns[userID] = newMockConn()
+		clients[userID] = ws.NewClient("c-"+userID, userID, conns[userID])
+		hub.Register(clients[userID])
+		hub.Subscribe(clients[userID], testDocID)
+	}
+
+	hub.Announce(clients["alice"])
+	hub.Announce(clients["bob"])
+	hub.Announce(clients["bob"])
+
+	// Alice hears of Bob, and Bob is told Alice is there. Carol wasn't
+	// announced, so she neither hears of them nor they of her.
+	require.Eventually(t, func() bool {
+		return len(presenceEvents(t, conns["alice"])) == 1
+	}, time.Second, time.Millisecond)
+	require.Equal(t, []string{"join bob"}, presenceEvents(t, conns["alice"]))
+	require.Equal(t, []string{"join alice"}, presenceEvents(t, conns["bob"]))
+	require.Empty(t, presenceEvents(t, conns["carol"]))
+
+	// Cursors are moved past later operations, not earlier ones
+	hub.MoveCursor(clients["alice"], ws.Cursor{Position: 2, Anchor: 4}, 3)
+	hub.BroadcastOperation(testDocID, insertOp(3, 0, "x", "bob"), "bob", "c-bob")
+	hub.BroadcastOperation(testDocID, insertOp(4, 3, "x", "bob"), "bob", "c-bob")
+	hub.MoveCursor(clients["carol"], ws.Cursor{}, 4)
+
+	peers := hub.Peers(testDocID)
+	require.Len(t, peers, 2)
+	require.Equal(t, "alice", peers[0].UserID)
+	require.Equal(t, &ws.Cursor{Position: 2, Anchor: 5}, peers[0].Cursor)
+	require.Equal(t, 4, peers[0].Revision)
+	require.Nil(t, peers[1].Cursor)
+
+	// Leaving is announced however the client goes
+	hub.Unsubscribe(clients["bob"], testDocID)
+	hub.Unregister(clients["carol"])
+	hub.Unregister(clients["alice"])
+
+	require.Eventually(t, func() bool {
+		return len(presenceEvents(t, conns["alice"])) == 2
+	}, time.Second, time.Millisecond)
+	require.Equal(t, []string{"join bob", "leave bob"}, presenceEvents(t, conns["alice"]))
+	require.Empty(t, hub.Peers(testDocID))
+}
@@ -0,0 +1,57 @@
+package ws
+
+import "time"
+
+// RateLimiter is a token bucket limiting how fast a client submits edits.
+// It holds burst tokens, refilled at rate a second, and each edit takes
+// one. It isn't safe for concurrent use; each connection's read loop owns
+// its own. A nil RateLimiter allows everything.
+type RateLimiter struct {
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time // When tokens was last topped up
+}
+
+// NewRateLimiter creates a full limiter allowing burst edits at once and
+// rate a second after that. It returns nil, allowing everything, if either
+// is not positive.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if rate <= 0 || burst <= 0 {
+		return nil
+	}
+
+	return &RateLimiter{
+		rate:   rate,
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Allow tops the bucket up for the time since it was last, then takes a
+// token if there is one.
+func (l *RateLimiter) Allow() bool {
+	return l.AllowN(1)
+}
+
+// AllowN tops the bucket up for the time since it was last, then takes n
+// tokens if there are that many. It takes none otherwise, so more than
+// burst is never allowed.
+func (l *RateLimiter) AllowN(n int) bool {
+	if l == nil {
+		return true
+	}
+
+	now := time.Now()
+	l.tokens = min(float64(l.burst), l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	if l.tokens < float64(n) {
+		return false
+	}
+
+	l.tokens -= float64(n)
+
+	return true
+}
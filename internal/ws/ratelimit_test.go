@@ -0,0 +1,40 @@
+package ws_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/serroba/online-docs/internal/ws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	limiter := ws.NewRateLimiter(20, 3)
+
+	// The burst is allowed at once, then the bucket is empty
+	for range 3 {
+		require.True(t, limiter.Allow())
+	}
+
+	require.False(t, limiter.Allow())
+
+	// It refills at the rate
+	time.Sleep(100 * time.Millisecond)
+	require.True(t, limiter.Allow())
+
+	// Taking several tokens takes none unless there are enough
+	limiter = ws.NewRateLimiter(0.001, 3)
+	require.True(t, limiter.AllowN(2))
+	require.False(t, limiter.AllowN(2))
+	require.True(t, limiter.AllowN(1))
+	require.False(t, limiter.Allow())
+
+	// Without a rate or burst nothing is limited
+	for _, limiter := range []*ws.RateLimiter{ws.NewRateLimiter(0, 3), ws.NewRateLimiter(20, 0)} {
+		for range 10 {
+			require.True(t, limiter.Allow())
+		}
+	}
+}
@@ -0,0 +1,259 @@
+// Package yjs lets Yjs editors edit documents over the y-websocket protocol.
+// It keeps a Yjs copy of each document's content, which it changes with the
+// operations of the document's session, and turns the changes Yjs clients
+// make to it into operations of their own.
+package yjs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/ot"
+)
+
+// TextName is the name of the root Y.Text holding a document's content,
+// which editors bind to with ydoc.getText(TextName).
+const TextName = "content"
+
+// CloseOutOfDate is the close code sent to clients whose copy of the
+// document was loaded from a room that has since closed. Merging it would
+// duplicate the content, so the client must load the document again.
+const CloseOutOfDate = 4000
+
+// defaultLinger is how long a room outlives its last client by default.
+const defaultLinger = time.Minute
+
+// peerBuffer is how many messages may wait for a client before it's
+// disconnected for falling behind.
+const peerBuffer = 256
+
+// errOutOfDate is returned for clients that must reload, see CloseOutOfDate.
+var errOutOfDate = errors.New("document copy is out of date, reload it")
+
+// Conn is a WebSocket connection, such as a *websocket.Conn.
+type Conn interface {
+	ReadMessage() (int, []byte, error)
+	WriteMessage(messageType int, data []byte) error
+	Close() error
+}
+
+// Session is the part of a *collab.Session the bridge uses.
+type Session interface {
+	ApplyOperation(clientID, userID string, op ot.Operation, baseRevision int) (int, error)
+	GetState(userID string) (string, int, error)
+	Changes(ctx context.Context, userID string, sinceRevision int) ([]ot.SequencedOperation, int, error)
+}
+
+// BridgeConfig holds configuration for creating a bridge.
+type BridgeConfig struct {
+	// Open returns a document's session, as collab.Manager.GetOrCreateSession does.
+	Open func(ctx context.Context, docID string) (Session, error)
+
+	// Linger is how long a room is kept once its last client leaves, so
+	// clients that reconnect find the copy they share. Defaults to a minute.
+	Linger time.Duration
+
+	Logger *slog.Logger // Optional: defaults to slog.Default()
+}
+
+// Bridge serves Yjs clients. The clients of each document share a room,
+// which edits the document's session as a single client.
+type Bridge struct {
+	open   func(ctx context.Context, docID string) (Session, error)
+	linger time.Duration
+	logger *slog.Logger
+
+	mu    sync.Mutex
+	rooms map[string]*room // By document ID
+}
+
+// NewBridge creates a bridge.
+func NewBridge(cfg BridgeConfig) *Bridge {
+	linger := cfg.Linger
+	if linger <= 0 {
+		linger = defaultLinger
+	}
+
+	return &Bridge{
+		open:   cfg.Open,
+		linger: linger,
+		logger: logging.Component(cfg.Logger, "yjs"),
+		rooms:  make(map[string]*room),
+	}
+}
+
+// Serve speaks the y-websocket protocol on conn until the client
+// disconnects. The caller checks that userID may read the document. Changes
+// from read-only clients are ignored. It returns an error if the client
+// sends a message that can't be applied, after closing the connection with
+// a close frame explaining why.
+func (b *Bridge) Serve(docID string, conn Conn, userID string, readOnly bool) error {
+	p := &peer{
+		conn:     conn,
+		userID:   userID,
+		readOnly: readOnly,
+		out:      make(chan frame, peerBuffer),
+		done:     make(chan struct{}),
+		clients:  make(map[uint64]bool),
+	}
+	go p.write()
+
+	r, err := b.join(docID, p)
+	if err != nil {
+		p.close()
+
+		return err
+	}
+
+	defer r.leave(p)
+
+	for {
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			p.close()
+
+			return nil
+		}
+
+		if kind != websocket.BinaryMessage {
+			continue
+		}
+
+		if err := r.handle(p, data); err != nil {
+			p.fail(err)
+
+			return err
+		}
+	}
+}
+
+// Rooms returns the number of documents with a room.
+func (b *Bridge) Rooms() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.rooms)
+}
+
+// join adds a client to its document's room, opening the room if needed.
+func (b *Bridge) join(docID string, p *peer) (*room, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	r, ok := b.rooms[docID]
+	if !ok {
+		r = newRoom(b, docID)
+	}
+
+	if err := r.attach(p.userID); err != nil {
+		return nil, err
+	}
+
+	b.rooms[docID] = r
+	r.add(p)
+
+	return r, nil
+}
+
+// expire drops a room that has had no clients for the linger period.
+func (b *Bridge) expire(r *room) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !r.expire() {
+		return
+	}
+
+	if b.rooms[r.docID] == r {
+		delete(b.rooms, r.docID)
+	}
+}
+
+// frame is a WebSocket message waiting to be written.
+type frame struct {
+	kind int
+	data []byte
+}
+
+// peer is a connected Yjs client.
+type peer struct {
+	conn     Conn
+	userID   string
+	readOnly bool
+	out      chan frame
+	done     chan struct{} // Closed with the connection
+	once     sync.Once
+
+	clients map[uint64]bool // Awareness clients it speaks for, guarded by the room's mu
+}
+
+// send queues a binary message, disconnecting the client if too many are
+// waiting already.
+func (p *peer) send(data []byte) {
+	p.enqueue(frame{kind: websocket.BinaryMessage, data: data})
+}
+
+// enqueue queues a message.
+func (p *peer) enqueue(f frame) {
+	select {
+	case p.out <- f:
+	case <-p.done:
+	default:
+		p.close()
+	}
+}
+
+// write writes queued messages until the connection closes.
+func (p *peer) write() {
+	for {
+		select {
+		case f := <-p.out:
+			if err := p.conn.WriteMessage(f.kind, f.data); err != nil || f.kind == websocket.CloseMessage {
+				p.close()
+
+				return
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// fail closes the connection with a close frame explaining err.
+func (p *peer) fail(err error) {
+	code := websocket.CloseInternalServerErr
+
+	switch {
+	case errors.Is(err, errOutOfDate):
+		code = CloseOutOfDate
+	case errors.Is(err, ErrMalformed), errors.Is(err, ErrUnsupported):
+		code = websocket.CloseUnsupportedData
+	}
+
+	// Close reasons are limited to 123 bytes
+	reason := err.Error()
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+
+	p.enqueue(frame{kind: websocket.CloseMessage, data: websocket.FormatCloseMessage(code, reason)})
+
+	select {
+	case <-p.done:
+	case <-time.After(time.Second):
+		p.close()
+	}
+}
+
+// close closes the connection.
+func (p *peer) close() {
+	p.once.Do(func() {
+		close(p.done)
+		_ = p.conn.Close()
+	})
+}
@@ -0,0 +1,552 @@
+package yjs_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/yjs"
+	"github.com/stretchr/testify/require"
+)
+
+var errConnClosed = errors.New("connection closed")
+
+// fakeConn is an in-memory WebSocket connection. The test writes what the
+// bridge reads to in, and reads what the bridge writes from out.
+type fakeConn struct {
+	in     chan []byte
+	out    chan []byte
+	closed chan struct{}
+	once   sync.Once
+
+	mu        sync.Mutex
+	closeCode int
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{in: make(chan []byte, 64), out: make(chan []byte, 1024), closed: make(chan struct{})}
+}
+
+func (c *fakeConn) ReadMessage() (int, []byte, error) {
+	select {
+	case data := <-c.in:
+		return websocket.BinaryMessage, data, nil
+	case <-c.closed:
+		return 0, nil, errConnClosed
+	}
+}
+
+func (c *fakeConn) WriteMessage(messageType int, data []byte) error {
+	select {
+	case <-c.closed:
+		return errConnClosed
+	default:
+	}
+
+	if messageType == websocket.CloseMessage {
+		c.mu.Lock()
+		c.closeCode = int(binary.BigEndian.Uint16(data))
+		c.mu.Unlock()
+
+		return nil
+	}
+
+	c.out <- data
+
+	return nil
+}
+
+func (c *fakeConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+
+	return nil
+}
+
+// code returns the close code the bridge sent, if any.
+func (c *fakeConn) code() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.closeCode
+}
+
+func (c *fakeConn) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// yjsClient is a Yjs editor connected to a bridge.
+type yjsClient struct {
+	t         *testing.T
+	conn      *fakeConn
+	text      *yjs.Text
+	awareness map[uint64]string
+	served    chan error
+}
+
+// connect connects a client with the given copy of the document.
+func connect(t *testing.T, bridge *yjs.Bridge, text *yjs.Text, userID string, readOnly bool) *yjsClient {
+	t.Helper()
+
+	c := &yjsClient{t: t, conn: newFakeConn(), text: text, awareness: make(map[uint64]string), served: make(chan error, 1)}
+
+	go func() { c.served <- bridge.Serve("doc1", c.conn, userID, readOnly) }()
+
+	// Like y-websocket clients, send the state vector on connecting
+	c.sendSync(0, text.StateVector())
+
+	t.Cleanup(func() { _ = c.conn.Close() })
+
+	return c
+}
+
+// sendSync sends a sync message.
+func (c *yjsClient) sendSync(kind uint64, payload []byte) {
+	msg := binary.AppendUvarint([]byte{0}, kind)
+	msg = binary.AppendUvarint(msg, uint64(len(payload)))
+	c.conn.in <- append(msg, payload...)
+}
+
+// sendAwareness shares the client's awareness state.
+func (c *yjsClient) sendAwareness(client, clock uint64, state string) {
+	update := binary.AppendUvarint([]byte{1}, client)
+	update = binary.AppendUvarint(update, clock)
+	update = binary.AppendUvarint(update, uint64(len(state)))
+	update = append(update, state...)
+
+	msg := binary.AppendUvarint([]byte{1}, uint64(len(update)))
+	c.conn.in <- append(msg, update...)
+}
+
+// edit applies an operation locally and sends it.
+func (c *yjsClient) edit(op ot.Operation) {
+	update, err := c.text.Apply(op)
+	require.NoError(c.t, err)
+	c.sendSync(2, update)
+}
+
+// drain handles the messages the bridge sent.
+func (c *yjsClient) drain() {
+	for {
+		select {
+		case msg := <-c.conn.out:
+			c.handle(msg)
+		default:
+			return
+		}
+	}
+}
+
+// handle handles a message as a y-websocket client does.
+func (c *yjsClient) handle(msg []byte) {
+	kind, n := binary.Uvarint(msg)
+	msg = msg[n:]
+
+	if kind == 1 {
+		_, n = binary.Uvarint(msg) // Update length
+		msg = msg[n:]
+
+		count, n := binary.Uvarint(msg)
+		msg = msg[n:]
+
+		for range count {
+			client, n := binary.Uvarint(msg)
+			msg = msg[n:]
+			_, n = binary.Uvarint(msg) // Clock
+			msg = msg[n:]
+			size, n := binary.Uvarint(msg)
+			c.awareness[client] = string(msg[n : n+int(size)])
+			msg = msg[n+int(size):]
+		}
+
+		return
+	}
+
+	step, n := binary.Uvarint(msg)
+	msg = msg[n:]
+	_, n = binary.Uvarint(msg) // Payload length
+	payload := msg[n:]
+
+	if step == 0 {
+		diff, err := c.text.Diff(payload)
+		require.NoError(c.t, err)
+		c.sendSync(1, diff)
+
+		return
+	}
+
+	_, err := c.text.Integrate(payload, "server")
+	require.NoError(c.t, err)
+}
+
+// waitFor handles messages until cond holds, failing after a while.
+func waitFor(t *testing.T, cond func() bool, clients ...*yjsClient) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		for _, c := range clients {
+			c.drain()
+		}
+
+		if cond() {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			require.FailNow(t, "condition not met in time")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// newBridge returns a bridge serving doc1 of a memory store, and the
+// document's session manager.
+func newBridge(t *testing.T, linger time.Duration) (*yjs.Bridge, *collab.Manager) {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	manager := collab.NewManager(collab.ManagerConfig{Store: store})
+	t.Cleanup(func() { _ = manager.CloseAll() })
+
+	bridge := yjs.NewBridge(yjs.BridgeConfig{
+		Open: func(ctx context.Context, docID string) (yjs.Session, error) {
+			return manager.GetOrCreateSession(ctx, docID)
+		},
+		Linger: linger,
+	})
+
+	return bridge, manager
+}
+
+// content returns doc1's content.
+func content(t *testing.T, manager *collab.Manager) string {
+	t.Helper()
+
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	text, _, err := session.GetState("alice")
+	require.NoError(t, err)
+
+	return text
+}
+
+// insert inserts text through the session, as a WebSocket client would.
+func insert(t *testing.T, manager *collab.Manager, text string, position int) {
+	t.Helper()
+
+	session, err := manager.GetOrCreateSession(t.Context(), "doc1")
+	require.NoError(t, err)
+
+	for i, r := range []rune(text) {
+		_, err = session.ApplyOperation("ws", "bob", ot.NewInsert(string(r), position+i, "bob"), session.Revision())
+		require.NoError(t, err)
+	}
+}
+
+func TestBridge_SyncsContent(t *testing.T) {
+	t.Parallel()
+
+	bridge, manager := newBridge(t, 0)
+	insert(t, manager, "hello", 0)
+
+	c := connect(t, bridge, yjs.NewText(yjs.TextName, 10), "alice", false)
+	waitFor(t, func() bool { return c.text.String() == "hello" }, c)
+	require.Equal(t, 1, bridge.Rooms())
+}
+
+func TestBridge_ClientEdits(t *testing.T) {
+	t.Parallel()
+
+	bridge, manager := newBridge(t, 0)
+	a := connect(t, bridge, yjs.NewText(yjs.TextName, 10), "alice", false)
+	b := connect(t, bridge, yjs.NewText(yjs.TextName, 11), "bob", false)
+
+	a.edit(ot.NewInsert("h", 0, "alice"))
+	a.edit(ot.NewInsert("i", 1, "alice"))
+
+	waitFor(t, func() bool { return content(t, manager) == "hi" && b.text.String() == "hi" }, a, b)
+}
+
+func TestBridge_SessionEdits(t *testing.T) {
+	t.Parallel()
+
+	bridge, manager := newBridge(t, 0)
+	c := connect(t, bridge, yjs.NewText(yjs.TextName, 10), "alice", false)
+	waitFor(t, func() bool { return bridge.Rooms() == 1 }, c)
+
+	insert(t, manager, "hey", 0)
+
+	waitFor(t, func() bool { return c.text.String() == "hey" }, c)
+}
+
+func TestBridge_Converges(t *testing.T) {
+	t.Parallel()
+
+	bridge, manager := newBridge(t, 0)
+	insert(t, manager, "base", 0)
+
+	a := connect(t, bridge, yjs.NewText(yjs.TextName, 10), "alice", false)
+	b := connect(t, bridge, yjs.NewText(yjs.TextName, 11), "bob", false)
+	waitFor(t, func() bool { return a.text.String() == "base" && b.text.String() == "base" }, a, b)
+
+	// Everyone edits without waiting for the others' edits
+	for i := range 10 {
+		a.edit(ot.NewInsert("a", i%len([]rune(a.text.String())), "alice"))
+		b.edit(ot.NewDelete(0, "bob"))
+		b.edit(ot.NewInsert("b", len([]rune(b.text.String())), "bob"))
+		insert(t, manager, "o", i)
+	}
+
+	waitFor(t, func() bool {
+		doc := content(t, manager)
+
+		return len(doc) == 4+30-10 && a.text.String() == doc && b.text.String() == doc
+	}, a, b)
+}
+
+func TestBridge_ReadOnly(t *testing.T) {
+	t.Parallel()
+
+	bridge, manager := newBridge(t, 0)
+	viewer := connect(t, bridge, yjs.NewText(yjs.TextName, 10), "alice", true)
+	editor := connect(t, bridge, yjs.NewText(yjs.TextName, 11), "bob", false)
+
+	viewer.edit(ot.NewInsert("x", 0, "alice"))
+	editor.edit(ot.NewInsert("y", 0, "bob"))
+
+	// The viewer gets the editor's change; nobody gets the viewer's
+	waitFor(t, func() bool { return content(t, manager) == "y" && len(viewer.text.String()) == 2 }, viewer, editor)
+	require.Equal(t, "y", editor.text.String())
+}
+
+func TestBridge_Unsupported(t *testing.T) {
+	t.Parallel()
+
+	bridge, _ := newBridge(t, 0)
+	c := connect(t, bridge, yjs.NewText(yjs.TextName, 10), "alice", false)
+
+	c.sendSync(2, formatBold)
+
+	require.ErrorIs(t, <-c.served, yjs.ErrUnsupported)
+	require.Equal(t, websocket.CloseUnsupportedData, c.conn.code())
+}
+
+func TestBridge_OutOfDate(t *testing.T) {
+	t.Parallel()
+
+	bridge, _ := newBridge(t, 0)
+
+	// A copy with changes the bridge has never seen
+	text := yjs.NewText(yjs.TextName, 10)
+	_, err := text.Apply(ot.NewInsert("x", 0, "alice"))
+	require.NoError(t, err)
+
+	c := connect(t, bridge, text, "alice", false)
+
+	require.Error(t, <-c.served)
+	require.Equal(t, yjs.CloseOutOfDate, c.conn.code())
+}
+
+func TestBridge_SessionClosed(t *testing.T) {
+	t.Parallel()
+
+	bridge, manager := newBridge(t, time.Minute)
+	text := yjs.NewText(yjs.TextName, 10)
+	c := connect(t, bridge, text, "alice", false)
+
+	c.edit(ot.NewInsert("x", 0, "alice"))
+	waitFor(t, func() bool { return content(t, manager) == "x" }, c)
+
+	require.NoError(t, manager.CloseSession("doc1"))
+	waitFor(t, c.conn.isClosed, c)
+
+	// The room kept its copy, so the client can reconnect with its own
+	c = connect(t, bridge, text, "alice", false)
+	c.edit(ot.NewInsert("y", 1, "alice"))
+
+	waitFor(t, func() bool { return content(t, manager) == "xy" }, c)
+	require.False(t, c.conn.isClosed())
+}
+
+func TestBridge_Awareness(t *testing.T) {
+	t.Parallel()
+
+	bridge, _ := newBridge(t, 0)
+	a := connect(t, bridge, yjs.NewText(yjs.TextName, 10), "alice", false)
+	b := connect(t, bridge, yjs.NewText(yjs.TextName, 11), "bob", false)
+	waitFor(t, func() bool { return bridge.Rooms() == 1 }, a, b)
+
+	a.sendAwareness(10, 1, `{"user":"alice"}`)
+	waitFor(t, func() bool { return b.awareness[10] == `{"user":"alice"}` }, a, b)
+
+	// Clients joining later get the states shared so far
+	c := connect(t, bridge, yjs.NewText(yjs.TextName, 12), "carol", false)
+	waitFor(t, func() bool { return c.awareness[10] == `{"user":"alice"}` }, c)
+
+	// A client's states are removed when it leaves
+	require.NoError(t, a.conn.Close())
+	waitFor(t, func() bool { return b.awareness[10] == "null" }, b)
+}
+
+func TestBridge_Expires(t *testing.T) {
+	t.Parallel()
+
+	bridge, _ := newBridge(t, 10*time.Millisecond)
+	c := connect(t, bridge, yjs.NewText(yjs.TextName, 10), "alice", false)
+	waitFor(t, func() bool { return bridge.Rooms() == 1 }, c)
+
+	require.NoError(t, c.conn.Close())
+	waitFor(t, func() bool { return bridge.Rooms() == 0 })
+}
+
+func TestBridge_JoinFails(t *testing.T) {
+	t.Parallel()
+
+	errBroken := errors.New("disk on fire")
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Owner))
+
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore})
+	t.Cleanup(func() { _ = manager.CloseAll() })
+
+	tests := []struct {
+		name   string
+		userID string
+		open   func(ctx context.Context, docID string) (yjs.Session, error)
+		want   error
+	}{
+		{
+			name:   "session fails to open",
+			userID: "alice",
+			open:   func(context.Context, string) (yjs.Session, error) { return nil, errBroken },
+			want:   errBroken,
+		},
+		{
+			name:   "no access",
+			userID: "mallory",
+			open: func(ctx context.Context, docID string) (yjs.Session, error) {
+				return manager.GetOrCreateSession(ctx, docID)
+			},
+			want: acl.ErrAccessDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			bridge := yjs.NewBridge(yjs.BridgeConfig{Open: tt.open})
+			c := connect(t, bridge, yjs.NewText(yjs.TextName, 10), tt.userID, false)
+
+			require.ErrorIs(t, <-c.served, tt.want)
+			require.True(t, c.conn.isClosed())
+			require.Zero(t, bridge.Rooms())
+		})
+	}
+}
+
+func TestBridge_Malformed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		msg  []byte
+	}{
+		{"truncated sync", []byte{0}},
+		{"truncated sync payload", []byte{0, 2, 5, 1}},
+		{"unknown sync kind", []byte{0, 7, 0}},
+		{"truncated awareness", []byte{1, 5}},
+		{"invalid awareness", []byte{1, 2, 1, 1}},
+		{"oversized integer", []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			bridge, _ := newBridge(t, 0)
+			c := connect(t, bridge, yjs.NewText(yjs.TextName, 10), "alice", false)
+			c.conn.in <- tt.msg
+
+			require.ErrorIs(t, <-c.served, yjs.ErrMalformed)
+			require.Equal(t, websocket.CloseUnsupportedData, c.conn.code())
+		})
+	}
+}
+
+func TestBridge_QueryAwareness(t *testing.T) {
+	t.Parallel()
+
+	bridge, _ := newBridge(t, 0)
+	a := connect(t, bridge, yjs.NewText(yjs.TextName, 10), "alice", false)
+	b := connect(t, bridge, yjs.NewText(yjs.TextName, 11), "bob", false)
+	waitFor(t, func() bool { return bridge.Rooms() == 1 }, a, b)
+
+	a.sendAwareness(10, 1, `{"user":"alice"}`)
+	waitFor(t, func() bool { return b.awareness[10] == `{"user":"alice"}` }, a, b)
+
+	// Auth messages are ignored, and clients may ask for the states again
+	clear(b.awareness)
+	b.conn.in <- []byte{2, 0}
+	b.conn.in <- []byte{3}
+	waitFor(t, func() bool { return b.awareness[10] == `{"user":"alice"}` }, b)
+	require.False(t, b.conn.isClosed())
+}
+
+func TestBridge_AccessLost(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateDocument(t.Context(), "doc1"))
+
+	permStore := acl.NewMemoryStore()
+	require.NoError(t, permStore.Grant("doc1", "alice", acl.Owner))
+	require.NoError(t, permStore.Grant("doc1", "bob", acl.Viewer))
+
+	manager := collab.NewManager(collab.ManagerConfig{Store: store, PermStore: permStore})
+	t.Cleanup(func() { _ = manager.CloseAll() })
+
+	bridge := yjs.NewBridge(yjs.BridgeConfig{
+		Open: func(ctx context.Context, docID string) (yjs.Session, error) {
+			return manager.GetOrCreateSession(ctx, docID)
+		},
+	})
+
+	// The room reads the session's changes as bob, who joined first
+	bob := connect(t, bridge, yjs.NewText(yjs.TextName, 10), "bob", false)
+	waitFor(t, func() bool { return bridge.Rooms() == 1 }, bob)
+
+	alice := connect(t, bridge, yjs.NewText(yjs.TextName, 11), "alice", false)
+
+	// The bridge trusts readOnly, so bob's change reaches the copy before
+	// the session refuses it; bob is disconnected and the change undone
+	bob.edit(ot.NewInsert("x", 0, "bob"))
+	require.NoError(t, <-bob.served)
+	waitFor(t, func() bool { return alice.text.String() == "" }, alice)
+
+	// The room reads the changes as alice from then on
+	alice.edit(ot.NewInsert("y", 0, "alice"))
+	waitFor(t, func() bool { return content(t, manager) == "y" && alice.text.String() == "y" }, alice)
+}
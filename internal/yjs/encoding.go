@@ -0,0 +1,124 @@
+package yjs
+
+import (
+	"errors"
+	"unicode/utf8"
+)
+
+// ErrMalformed is returned for messages and updates that can't be decoded.
+var ErrMalformed = errors.New("malformed yjs message")
+
+// decoder reads the lib0 encoding Yjs uses. The first error is sticky: later
+// reads return zero values and err reports it.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+// done reports whether all input was read.
+func (d *decoder) done() bool {
+	return len(d.buf) == 0 || d.err != nil
+}
+
+// readByte reads one byte.
+func (d *decoder) readByte() byte {
+	if d.err != nil {
+		return 0
+	}
+
+	if len(d.buf) == 0 {
+		d.err = ErrMalformed
+
+		return 0
+	}
+
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+
+	return b
+}
+
+// readUint reads an unsigned integer, stored 7 bits per byte, least significant
+// first, with the high bit set on all but the last byte.
+func (d *decoder) readUint() uint64 {
+	var n uint64
+
+	for shift := 0; ; shift += 7 {
+		b := d.readByte()
+		if d.err != nil {
+			return 0
+		}
+
+		if shift > 56 {
+			d.err = ErrMalformed
+
+			return 0
+		}
+
+		n |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return n
+		}
+	}
+}
+
+// readBytes reads a length-prefixed byte array.
+func (d *decoder) readBytes() []byte {
+	n := d.readUint()
+	if d.err != nil {
+		return nil
+	}
+
+	if n > uint64(len(d.buf)) {
+		d.err = ErrMalformed
+
+		return nil
+	}
+
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+
+	return b
+}
+
+// readString reads a length-prefixed UTF-8 string.
+func (d *decoder) readString() string {
+	b := d.readBytes()
+	if d.err == nil && !utf8.Valid(b) {
+		d.err = ErrMalformed
+	}
+
+	return string(b)
+}
+
+// encoder writes the lib0 encoding, see decoder.
+type encoder struct {
+	buf []byte
+}
+
+// writeByte writes one byte.
+func (e *encoder) writeByte(b byte) {
+	e.buf = append(e.buf, b)
+}
+
+// writeUint writes an unsigned integer.
+func (e *encoder) writeUint(n uint64) {
+	for n >= 0x80 {
+		e.buf = append(e.buf, byte(n)|0x80)
+		n >>= 7
+	}
+
+	e.buf = append(e.buf, byte(n))
+}
+
+// writeBytes writes a length-prefixed byte array.
+func (e *encoder) writeBytes(b []byte) {
+	e.writeUint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// writeString writes a length-prefixed UTF-8 string.
+func (e *encoder) writeString(s string) {
+	e.writeUint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
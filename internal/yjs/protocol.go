@@ -0,0 +1,87 @@
+package yjs
+
+import (
+	"maps"
+	"slices"
+)
+
+// Message types of the y-websocket protocol.
+const (
+	messageSync           = 0
+	messageAwareness      = 1
+	messageAuth           = 2
+	messageQueryAwareness = 3
+)
+
+// Kinds of sync message. A peer answers step 1, which carries its state
+// vector, with step 2, which carries the changes the other peer is missing.
+const (
+	syncStep1  = 0
+	syncStep2  = 1
+	syncUpdate = 2
+)
+
+// syncMessage frames a sync message.
+func syncMessage(kind uint64, payload []byte) []byte {
+	var e encoder
+
+	e.writeUint(messageSync)
+	e.writeUint(kind)
+	e.writeBytes(payload)
+
+	return e.buf
+}
+
+// awarenessMessage frames an awareness update.
+func awarenessMessage(update []byte) []byte {
+	var e encoder
+
+	e.writeUint(messageAwareness)
+	e.writeBytes(update)
+
+	return e.buf
+}
+
+// awareness is the state a Yjs client shares about itself, such as its
+// user's name and cursor, as JSON. It's "null" once the client leaves.
+type awareness struct {
+	clock uint64
+	state string
+}
+
+// removed reports whether the client has left.
+func (a awareness) removed() bool {
+	return a.state == "null"
+}
+
+// decodeAwareness decodes an awareness update, keyed by client ID.
+func decodeAwareness(data []byte) (map[uint64]awareness, error) {
+	d := &decoder{buf: data}
+	states := make(map[uint64]awareness)
+
+	for n := d.readUint(); n > 0 && d.err == nil; n-- {
+		client := d.readUint()
+		states[client] = awareness{clock: d.readUint(), state: d.readString()}
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return states, nil
+}
+
+// encodeAwareness encodes an awareness update.
+func encodeAwareness(states map[uint64]awareness) []byte {
+	var e encoder
+
+	e.writeUint(uint64(len(states)))
+
+	for _, client := range slices.Sorted(maps.Keys(states)) {
+		e.writeUint(client)
+		e.writeUint(states[client].clock)
+		e.writeString(states[client].state)
+	}
+
+	return e.buf
+}
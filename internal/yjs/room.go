@@ -0,0 +1,485 @@
+package yjs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/storage"
+)
+
+// room shares a document's Yjs copy among its clients. It acts as one client
+// of the document's session: changes from Yjs clients are applied to the
+// text at once and queued as operations, which are sent one at a time like
+// the WebSocket clients do. Operations from the session are transformed
+// past the queued ones, applied to the text and sent to the Yjs clients.
+//
+// When the session closes, the room disconnects its clients but keeps the
+// text, so that clients reconnecting within the linger period can merge
+// their copies with it.
+type room struct {
+	bridge *Bridge
+	docID  string
+	id     string // Client ID of the room's operations
+	logger *slog.Logger
+
+	mu        sync.Mutex
+	text      *Text
+	revision  int    // Latest session revision applied to text
+	pending   []edit // Not yet acknowledged, in order; the first may be in flight
+	reader    string // User whose permissions the session's changes are read with
+	peers     []*peer
+	awareness map[uint64]awareness
+	running   bool               // Attached to a session
+	cancel    context.CancelFunc // Stops run, while running
+	wake      context.CancelFunc // Interrupts run waiting for changes
+	idle      *time.Timer        // Expires the room, while it has no clients
+	expired   bool
+}
+
+// edit is an operation from a Yjs client.
+type edit struct {
+	op     ot.Operation
+	userID string
+}
+
+// newRoom creates a room with an empty text.
+func newRoom(b *Bridge, docID string) *room {
+	return &room{
+		bridge:    b,
+		docID:     docID,
+		id:        uuid.New().String(),
+		logger:    b.logger.With(logging.DocID(docID)),
+		text:      NewText(TextName, uint64(rand.Uint32())), //nolint:gosec // Yjs client IDs needn't be unpredictable
+		awareness: make(map[uint64]awareness),
+	}
+}
+
+// attach opens the document's session, unless the room has one, and brings
+// the text up to date with it.
+func (r *room) attach(userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.running {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	session, err := r.bridge.open(ctx, r.docID)
+	if err != nil {
+		cancel()
+
+		return err
+	}
+
+	content, revision, err := session.GetState(userID)
+	if err != nil {
+		cancel()
+
+		return err
+	}
+
+	r.broadcast(syncMessage(syncUpdate, r.text.Replace(content)), nil)
+	r.revision = revision
+	r.pending = nil
+	r.reader = userID
+	r.running = true
+	r.cancel = cancel
+
+	go r.run(ctx, session)
+
+	return nil
+}
+
+// add adds a client and starts syncing it.
+func (r *room) add(p *peer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.idle != nil {
+		r.idle.Stop()
+		r.idle = nil
+	}
+
+	r.peers = append(r.peers, p)
+
+	// Like the y-websocket server, ask for the client's changes first
+	p.send(syncMessage(syncStep1, r.text.StateVector()))
+
+	if len(r.awareness) > 0 {
+		p.send(awarenessMessage(encodeAwareness(r.awareness)))
+	}
+}
+
+// leave removes a client, and the awareness states it shared. The room
+// expires if no other client joins in the linger period.
+func (r *room) leave(p *peer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.peers = slices.DeleteFunc(r.peers, func(o *peer) bool { return o == p })
+
+	removed := make(map[uint64]awareness)
+
+	for client := range p.clients {
+		if a, ok := r.awareness[client]; ok {
+			removed[client] = awareness{clock: a.clock + 1, state: "null"}
+			delete(r.awareness, client)
+		}
+	}
+
+	if len(removed) > 0 {
+		r.broadcast(awarenessMessage(encodeAwareness(removed)), nil)
+	}
+
+	if len(r.peers) == 0 && r.idle == nil {
+		r.idle = time.AfterFunc(r.bridge.linger, func() { r.bridge.expire(r) })
+	}
+}
+
+// expire stops the room if it still has no clients, and reports whether it
+// did.
+func (r *room) expire() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.peers) > 0 || r.expired {
+		return false
+	}
+
+	r.expired = true
+
+	if r.running {
+		r.cancel()
+	}
+
+	return true
+}
+
+// handle processes a message from a client.
+func (r *room) handle(p *peer, data []byte) error {
+	d := &decoder{buf: data}
+
+	switch d.readUint() {
+	case messageSync:
+		kind := d.readUint()
+		payload := d.readBytes()
+
+		if d.err != nil {
+			return d.err
+		}
+
+		switch kind {
+		case syncStep1:
+			return r.syncStep1(p, payload)
+		case syncStep2, syncUpdate:
+			return r.update(p, payload)
+		default:
+			return ErrMalformed
+		}
+	case messageAwareness:
+		payload := d.readBytes()
+		if d.err != nil {
+			return d.err
+		}
+
+		return r.updateAwareness(p, payload)
+	case messageQueryAwareness:
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		p.send(awarenessMessage(encodeAwareness(r.awareness)))
+	case messageAuth:
+		// Permissions were checked before the connection was accepted
+	}
+
+	return d.err
+}
+
+// syncStep1 answers a client's state vector with the changes it's missing.
+// Clients that have seen changes the text hasn't were connected to an
+// earlier room and must reload.
+func (r *room) syncStep1(p *peer, stateVector []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	known, err := r.text.Knows(stateVector)
+	if err != nil {
+		return err
+	}
+
+	if !known {
+		return errOutOfDate
+	}
+
+	diff, err := r.text.Diff(stateVector)
+	if err != nil {
+		return err
+	}
+
+	p.send(syncMessage(syncStep2, diff))
+
+	return nil
+}
+
+// update applies a client's changes, queues them as operations and relays
+// them to the other clients. Changes from read-only clients are dropped.
+func (r *room) update(p *peer, update []byte) error {
+	if p.readOnly {
+		r.logger.Debug("ignored yjs update from read-only client", logging.UserID(p.userID))
+
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ops, err := r.text.Integrate(update, p.userID)
+	if err != nil {
+		return err
+	}
+
+	for _, op := range ops {
+		r.pending = append(r.pending, edit{op: op, userID: p.userID})
+	}
+
+	if len(ops) > 0 && r.wake != nil {
+		r.wake()
+	}
+
+	r.broadcast(syncMessage(syncUpdate, update), p)
+
+	return nil
+}
+
+// updateAwareness records the awareness states a client shares and relays
+// them to the other clients.
+func (r *room) updateAwareness(p *peer, update []byte) error {
+	states, err := decodeAwareness(update)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for client, a := range states {
+		if current, ok := r.awareness[client]; ok && current.clock > a.clock {
+			continue
+		}
+
+		p.clients[client] = true
+
+		if a.removed() {
+			delete(r.awareness, client)
+		} else {
+			r.awareness[client] = a
+		}
+	}
+
+	r.broadcast(awarenessMessage(update), p)
+
+	return nil
+}
+
+// broadcast sends a message to every client but except. The caller must
+// hold r.mu.
+func (r *room) broadcast(msg []byte, except *peer) {
+	for _, p := range r.peers {
+		if p != except {
+			p.send(msg)
+		}
+	}
+}
+
+// run applies the queued operations to the session and the session's
+// operations to the text until ctx is done, or the session closes or fails.
+func (r *room) run(ctx context.Context, session Session) {
+	for ctx.Err() == nil {
+		if err := r.step(ctx, session); err != nil {
+			if ctx.Err() == nil {
+				r.detach(err)
+			}
+
+			return
+		}
+	}
+}
+
+// step sends the next queued operation and applies the operations up to its
+// revision, or, with none queued, waits for operations from the session.
+func (r *room) step(ctx context.Context, session Session) error {
+	r.mu.Lock()
+
+	if len(r.pending) == 0 {
+		waitCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		r.wake = cancel
+		since, reader := r.revision, r.reader
+		r.mu.Unlock()
+
+		ops, _, err := session.Changes(waitCtx, reader, since)
+
+		r.mu.Lock()
+		r.wake = nil
+		r.mu.Unlock()
+
+		if err != nil {
+			return r.recover(session, err, reader)
+		}
+
+		return r.receive(session, ops, 0)
+	}
+
+	next, base := r.pending[0], r.revision
+	r.mu.Unlock()
+
+	revision, err := session.ApplyOperation(r.id, next.userID, next.op, base)
+	if err != nil {
+		return r.recover(session, err, next.userID)
+	}
+
+	for {
+		r.mu.Lock()
+		since, reader := r.revision, r.reader
+		r.mu.Unlock()
+
+		if since >= revision {
+			return nil
+		}
+
+		ops, _, err := session.Changes(ctx, reader, since)
+		if err != nil {
+			return r.recover(session, err, reader)
+		}
+
+		if err := r.receive(session, ops, revision); err != nil {
+			return err
+		}
+	}
+}
+
+// receive applies operations from the session in revision order. The one at
+// revision ack is the first queued operation, which is dropped from the
+// queue; the others are transformed past the queued ones.
+func (r *room) receive(session Session, ops []ot.SequencedOperation, ack int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, op := range ops {
+		if op.Revision <= r.revision {
+			continue
+		}
+
+		r.revision = op.Revision
+
+		if op.Revision == ack {
+			r.pending = r.pending[1:]
+
+			continue
+		}
+
+		remote := op.Operation
+		for i := range r.pending {
+			r.pending[i].op, remote = ot.Transform(r.pending[i].op, remote)
+		}
+
+		update, err := r.text.Apply(remote)
+		if err != nil {
+			r.logger.Error("yjs copy diverged from the document", logging.Revision(op.Revision), logging.Err(err))
+
+			return r.resync(session)
+		}
+
+		if update != nil {
+			r.broadcast(syncMessage(syncUpdate, update), nil)
+		}
+	}
+
+	return nil
+}
+
+// recover handles an error from the session. Operations that were rejected
+// are undone by resyncing; users who lost access are disconnected. It
+// returns an error if the room can't go on.
+func (r *room) recover(session Session, err error, userID string) error {
+	switch {
+	case errors.Is(err, collab.ErrSessionClosed), errors.Is(err, storage.ErrDocumentNotFound):
+		return err
+	case errors.Is(err, acl.ErrAccessDenied):
+		if !r.disconnect(userID) {
+			return err
+		}
+	case errors.Is(err, storage.ErrRevisionCompacted):
+	default:
+		r.logger.Warn("yjs edit failed, resyncing", logging.UserID(userID), logging.Err(err))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.resync(session)
+}
+
+// resync drops the queued operations and brings the text in line with the
+// document. The caller must hold r.mu.
+func (r *room) resync(session Session) error {
+	content, revision, err := session.GetState(r.reader)
+	if err != nil {
+		return err
+	}
+
+	r.pending = nil
+	r.revision = revision
+	r.broadcast(syncMessage(syncUpdate, r.text.Replace(content)), nil)
+
+	return nil
+}
+
+// disconnect closes the connections of a user who lost access. If the room
+// read the session's changes as them, it reads them as another connected
+// user from now on, and reports whether there is one.
+func (r *room) disconnect(userID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, p := range r.peers {
+		if p.userID == userID {
+			p.close()
+		} else if r.reader == userID {
+			r.reader = p.userID
+		}
+	}
+
+	return r.reader != userID
+}
+
+// detach disconnects the clients after the session closed or failed. The
+// text is kept for clients that reconnect, see room.
+func (r *room) detach(err error) {
+	if !errors.Is(err, collab.ErrSessionClosed) {
+		r.logger.Warn("yjs room detached from session", logging.Err(err))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.running = false
+	r.cancel()
+
+	for _, p := range r.peers {
+		p.close()
+	}
+}
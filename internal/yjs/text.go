@@ -0,0 +1,684 @@
+package yjs
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/serroba/online-docs/internal/ot"
+)
+
+// errPosition is returned for operations outside the text.
+var errPosition = errors.New("position outside the text")
+
+// Text is a Yjs Y.Text holding plain characters. It integrates updates from
+// Yjs clients, reporting the changes they make as operations, and makes
+// changes of its own from operations, returning them as updates.
+//
+// A Text is not safe for concurrent use.
+type Text struct {
+	name   string // Of the root type
+	client uint64 // Yjs client ID of the changes Apply makes
+	start  *item
+
+	clients map[uint64][]*item // Each client's items, in clock order
+
+	// Received items and deletions of characters not seen yet
+	pending        []*item
+	pendingDeletes deleteSet
+}
+
+// NewText creates an empty text, which Yjs clients know as the root type
+// name. Changes made with Apply are attributed to the Yjs client ID client.
+func NewText(name string, client uint64) *Text {
+	return &Text{
+		name:           name,
+		client:         client,
+		clients:        make(map[uint64][]*item),
+		pendingDeletes: make(deleteSet),
+	}
+}
+
+// String returns the visible characters.
+func (t *Text) String() string {
+	var b strings.Builder
+
+	for it := t.start; it != nil; it = it.right {
+		if !it.deleted {
+			b.WriteString(string(utf16.Decode(it.content)))
+		}
+	}
+
+	return b.String()
+}
+
+// StateVector returns the encoded clock of each client seen.
+func (t *Text) StateVector() []byte {
+	return encodeStateVector(t.stateVector())
+}
+
+// stateVector returns the clock of each client seen.
+func (t *Text) stateVector() map[uint64]uint64 {
+	sv := make(map[uint64]uint64, len(t.clients))
+	for client := range t.clients {
+		sv[client] = t.state(client)
+	}
+
+	return sv
+}
+
+// state returns the next clock value of a client, which is 0 for clients
+// not seen yet.
+func (t *Text) state(client uint64) uint64 {
+	items := t.clients[client]
+	if len(items) == 0 {
+		return 0
+	}
+
+	last := items[len(items)-1]
+
+	return last.id.clock + last.length
+}
+
+// Knows reports whether every client in an encoded state vector has made
+// changes the text has seen. Clients that have seen others are working from
+// a copy of the text this one doesn't share.
+func (t *Text) Knows(stateVector []byte) (bool, error) {
+	sv, err := decodeStateVector(stateVector)
+	if err != nil {
+		return false, err
+	}
+
+	for client, clock := range sv {
+		if clock > 0 && t.state(client) == 0 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Diff returns an update with the changes missing from an encoded state
+// vector, and every deletion.
+func (t *Text) Diff(stateVector []byte) ([]byte, error) {
+	sv, err := decodeStateVector(stateVector)
+	if err != nil {
+		return nil, err
+	}
+
+	from := make(map[uint64]uint64)
+
+	for client := range t.clients {
+		if clock := sv[client]; t.state(client) > clock {
+			from[client] = clock
+		}
+	}
+
+	return t.encode(from, t.deleteSet()), nil
+}
+
+// Integrate applies an update from a Yjs client and returns the operations
+// that make the same change to the visible characters, attributed to userID.
+// Parts of the update that follow changes not seen yet are held back until
+// they arrive.
+func (t *Text) Integrate(data []byte, userID string) ([]ot.Operation, error) {
+	u, err := decodeUpdate(data, t.name)
+	if err != nil {
+		return nil, err
+	}
+
+	t.pending = append(t.pending, u.items...)
+	for client, ranges := range u.deletes {
+		t.pendingDeletes[client] = append(t.pendingDeletes[client], ranges...)
+	}
+
+	var ops []ot.Operation
+
+	for progressed := true; progressed; {
+		progressed = false
+		waiting := t.pending[:0]
+
+		for _, it := range t.pending {
+			switch {
+			case it.id.clock+it.length <= t.state(it.id.client):
+				// Seen already
+			case t.ready(it):
+				ops = t.integrate(it, ops, userID)
+				progressed = true
+			default:
+				waiting = append(waiting, it)
+			}
+		}
+
+		clear(t.pending[len(waiting):])
+		t.pending = waiting
+	}
+
+	ops = t.applyDeletes(ops, userID)
+
+	return ops, nil
+}
+
+// ready reports whether the characters an item follows have been seen.
+func (t *Text) ready(it *item) bool {
+	if it.id.clock > t.state(it.id.client) {
+		return false
+	}
+
+	for _, dep := range []*id{it.origin, it.rightOrigin} {
+		if dep != nil && dep.clock >= t.state(dep.client) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// integrate places a received item in the text, as Yjs does, and appends
+// the operations inserting its characters.
+func (t *Text) integrate(it *item, ops []ot.Operation, userID string) []ot.Operation {
+	// Drop the part seen already
+	if offset := t.state(it.id.client) - it.id.clock; offset > 0 {
+		it.id.clock += offset
+		it.length -= offset
+		it.origin = &id{client: it.id.client, clock: it.id.clock - 1}
+
+		if it.content != nil {
+			it.setContent(it.content[offset:])
+		}
+	}
+
+	if it.gc {
+		t.add(it)
+
+		return ops
+	}
+
+	var left, right *item
+
+	if it.origin != nil {
+		left = t.cleanEnd(*it.origin)
+	}
+
+	if it.rightOrigin != nil {
+		right = t.cleanStart(*it.rightOrigin)
+	}
+
+	// Yjs collects items next to collected ranges too
+	if (left != nil && left.gc) || (right != nil && right.gc) {
+		*it = item{id: it.id, length: it.length, gc: true}
+		t.add(it)
+
+		return ops
+	}
+
+	it.left = t.resolve(it, left, right)
+	t.link(it)
+	t.add(it)
+
+	if it.deleted {
+		return ops
+	}
+
+	position := t.position(it)
+	for i, r := range utf16.Decode(it.content) {
+		ops = append(ops, ot.NewInsert(string(r), position+i, userID))
+	}
+
+	return ops
+}
+
+// resolve returns the item a received one goes after, deciding the order of
+// items inserted concurrently between left and right like Yjs does.
+func (t *Text) resolve(it, left, right *item) *item {
+	o := t.start
+	if left != nil {
+		o = left.right
+	}
+
+	if o == right {
+		return left
+	}
+
+	conflicting := make(map[*item]bool)
+	before := make(map[*item]bool)
+
+	for ; o != nil && o != right; o = o.right {
+		before[o] = true
+		conflicting[o] = true
+
+		switch {
+		case sameID(it.origin, o.origin):
+			// Both were inserted after the same character
+			if o.id.client < it.id.client {
+				left = o
+
+				clear(conflicting)
+			} else if sameID(it.rightOrigin, o.rightOrigin) {
+				return left
+			}
+		case o.origin != nil && before[t.find(*o.origin)]:
+			// o was inserted after one of the items passed
+			if !conflicting[t.find(*o.origin)] {
+				left = o
+
+				clear(conflicting)
+			}
+		default:
+			return left
+		}
+	}
+
+	return left
+}
+
+// link places an item after its left neighbor, or first.
+func (t *Text) link(it *item) {
+	if it.left != nil {
+		it.right = it.left.right
+		it.left.right = it
+	} else {
+		it.right = t.start
+		t.start = it
+	}
+
+	if it.right != nil {
+		it.right.left = it
+	}
+}
+
+// add records an item as the next of its client's.
+func (t *Text) add(it *item) {
+	t.clients[it.id.client] = append(t.clients[it.id.client], it)
+}
+
+// applyDeletes deletes the pending ranges of characters that have been
+// seen, and appends the operations deleting the visible ones.
+func (t *Text) applyDeletes(ops []ot.Operation, userID string) []ot.Operation {
+	for client, ranges := range t.pendingDeletes {
+		state := t.state(client)
+		waiting := ranges[:0]
+
+		for _, r := range ranges {
+			end := r.clock + r.length
+			if end > state {
+				waiting = append(waiting, clockRange{clock: max(r.clock, state), length: end - max(r.clock, state)})
+				end = state
+			}
+
+			for clock := r.clock; clock < end; {
+				it := t.cleanStart(id{client: client, clock: clock})
+				if it.id.clock+it.length > end {
+					t.split(it, end-it.id.clock)
+				}
+
+				if !it.deleted && !it.gc {
+					position := t.position(it)
+					for range it.runes {
+						ops = append(ops, ot.NewDelete(position, userID))
+					}
+
+					t.delete(it)
+				}
+
+				clock = it.id.clock + it.length
+			}
+		}
+
+		if len(waiting) == 0 {
+			delete(t.pendingDeletes, client)
+		} else {
+			t.pendingDeletes[client] = waiting
+		}
+	}
+
+	return ops
+}
+
+// Apply makes an operation's change and returns it as an update. Formats
+// don't change plain text, so they return no update.
+func (t *Text) Apply(op ot.Operation) ([]byte, error) {
+	if op.IsNoop() || op.IsFormat() {
+		return nil, nil
+	}
+
+	from := t.state(t.client)
+	deleted := make(deleteSet)
+
+	var err error
+	if op.IsInsert() {
+		err = t.insert(op.Position, op.Char)
+	} else {
+		err = t.remove(op.Position, 1, deleted)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return t.encode(map[uint64]uint64{t.client: from}, deleted), nil
+}
+
+// Replace changes the visible characters to content and returns the change
+// as an update. Only the part between their common prefix and suffix is
+// deleted and inserted again.
+func (t *Text) Replace(content string) []byte {
+	current, target := []rune(t.String()), []rune(content)
+
+	prefix := 0
+	for prefix < min(len(current), len(target)) && current[prefix] == target[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < min(len(current), len(target))-prefix &&
+		current[len(current)-1-suffix] == target[len(target)-1-suffix] {
+		suffix++
+	}
+
+	from := t.state(t.client)
+	deleted := make(deleteSet)
+
+	// Both positions are inside the text, so neither can fail
+	_ = t.remove(prefix, len(current)-prefix-suffix, deleted)
+	_ = t.insert(prefix, string(target[prefix:len(target)-suffix]))
+
+	return t.encode(map[uint64]uint64{t.client: from}, deleted)
+}
+
+// insert adds characters at a position, extending the item to their left
+// when it's the last one the text inserted.
+func (t *Text) insert(position int, s string) error {
+	if s == "" {
+		return nil
+	}
+
+	left, right, err := t.seek(position)
+	if err != nil {
+		return err
+	}
+
+	it := &item{id: id{client: t.client, clock: t.state(t.client)}}
+	it.setContent(utf16.Encode([]rune(s)))
+	it.length = uint64(len(it.content))
+
+	if left != nil {
+		origin := left.last()
+		it.origin = &origin
+	}
+
+	if right != nil {
+		it.rightOrigin = &right.id
+	}
+
+	if left != nil && left.id.client == t.client && left.id.clock+left.length == it.id.clock &&
+		!left.deleted && sameID(left.rightOrigin, it.rightOrigin) {
+		left.content = append(left.content, it.content...)
+		left.runes += it.runes
+		left.length += it.length
+
+		return nil
+	}
+
+	it.left = left
+	t.link(it)
+	t.add(it)
+
+	return nil
+}
+
+// remove deletes count characters at a position, recording the deleted
+// ranges in deleted.
+func (t *Text) remove(position, count int, deleted deleteSet) error {
+	_, it, err := t.seek(position)
+	if err != nil {
+		return err
+	}
+
+	for count > 0 {
+		for it != nil && it.deleted {
+			it = it.right
+		}
+
+		if it == nil {
+			return errPosition
+		}
+
+		if it.runes > count {
+			t.split(it, unitOffset(it.content, count))
+		}
+
+		count -= it.runes
+		deleted.add(it.id.client, it.id.clock, it.length)
+		t.delete(it)
+		it = it.right
+	}
+
+	return nil
+}
+
+// delete marks an item deleted and drops its characters.
+func (t *Text) delete(it *item) {
+	it.deleted = true
+	it.content = nil
+	it.runes = 0
+}
+
+// seek returns the items either side of a position, splitting the one it
+// falls in. Deleted items after the position are to its right.
+func (t *Text) seek(position int) (*item, *item, error) {
+	if position < 0 {
+		return nil, nil, errPosition
+	}
+
+	var left *item
+
+	right := t.start
+	for ; right != nil && position > 0; right = right.right {
+		if !right.deleted {
+			if position < right.runes {
+				t.split(right, unitOffset(right.content, position))
+			}
+
+			position -= right.runes
+		}
+
+		left = right
+	}
+
+	if position > 0 {
+		return nil, nil, errPosition
+	}
+
+	return left, right, nil
+}
+
+// position returns the number of visible characters before an item.
+func (t *Text) position(it *item) int {
+	n := 0
+	for o := t.start; o != it; o = o.right {
+		n += o.runes
+	}
+
+	return n
+}
+
+// find returns the item holding a character that has been seen.
+func (t *Text) find(at id) *item {
+	items := t.clients[at.client]
+
+	i, _ := slices.BinarySearchFunc(items, at.clock, func(it *item, clock uint64) int {
+		switch {
+		case it.id.clock+it.length <= clock:
+			return -1
+		case it.id.clock > clock:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	return items[i]
+}
+
+// cleanStart returns the item starting with a character, splitting the one
+// holding it if needed.
+func (t *Text) cleanStart(at id) *item {
+	it := t.find(at)
+	if at.clock > it.id.clock {
+		return t.split(it, at.clock-it.id.clock)
+	}
+
+	return it
+}
+
+// cleanEnd returns the item ending with a character, splitting the one
+// holding it if needed.
+func (t *Text) cleanEnd(at id) *item {
+	it := t.find(at)
+	if end := at.clock - it.id.clock + 1; end < it.length {
+		t.split(it, end)
+	}
+
+	return it
+}
+
+// split cuts an item in two at an offset of its clock and returns the second
+// part, which follows the first in the text. Surrogate pairs that are cut
+// become replacement characters, as in Yjs.
+func (t *Text) split(it *item, offset uint64) *item {
+	rest := &item{
+		id:          id{client: it.id.client, clock: it.id.clock + offset},
+		length:      it.length - offset,
+		origin:      &id{client: it.id.client, clock: it.id.clock + offset - 1},
+		rightOrigin: it.rightOrigin,
+		deleted:     it.deleted,
+		gc:          it.gc,
+	}
+	it.length = offset
+
+	if it.content != nil {
+		head := slices.Clone(it.content[:offset])
+		tail := slices.Clone(it.content[offset:])
+
+		if last := head[len(head)-1]; last >= 0xd800 && last < 0xdc00 {
+			head[len(head)-1] = utf8.RuneError
+			tail[0] = utf8.RuneError
+		}
+
+		it.setContent(head)
+		rest.setContent(tail)
+	}
+
+	items := t.clients[it.id.client]
+	i := slices.Index(items, it)
+	t.clients[it.id.client] = slices.Insert(items, i+1, rest)
+
+	if !it.gc {
+		rest.left = it
+		rest.right = it.right
+		it.right = rest
+
+		if rest.right != nil {
+			rest.right.left = rest
+		}
+	}
+
+	return rest
+}
+
+// deleteSet returns the ranges of every deleted or collected item.
+func (t *Text) deleteSet() deleteSet {
+	ds := make(deleteSet)
+
+	for client, items := range t.clients {
+		for _, it := range items {
+			if it.deleted || it.gc {
+				ds.add(client, it.id.clock, it.length)
+			}
+		}
+	}
+
+	return ds
+}
+
+// encode returns an update with each client's items from a clock on, and
+// deleted ranges.
+func (t *Text) encode(from map[uint64]uint64, deleted deleteSet) []byte {
+	var e encoder
+
+	maps.DeleteFunc(from, func(client, clock uint64) bool { return t.state(client) <= clock })
+	e.writeUint(uint64(len(from)))
+
+	for _, client := range descending(from) {
+		clock := from[client]
+		items := t.clients[client]
+		first := slices.Index(items, t.find(id{client: client, clock: clock}))
+
+		e.writeUint(uint64(len(items) - first))
+		e.writeUint(client)
+		e.writeUint(clock)
+
+		for _, it := range items[first:] {
+			t.writeItem(&e, it, clock-min(clock, it.id.clock))
+		}
+	}
+
+	writeDeleteSet(&e, deleted)
+
+	return e.buf
+}
+
+// writeItem encodes an item, leaving out the first offset characters.
+func (t *Text) writeItem(e *encoder, it *item, offset uint64) {
+	if it.gc {
+		e.writeByte(refGC)
+		e.writeUint(it.length - offset)
+
+		return
+	}
+
+	origin := it.origin
+	if offset > 0 {
+		origin = &id{client: it.id.client, clock: it.id.clock + offset - 1}
+	}
+
+	info := byte(refString)
+	if it.deleted {
+		info = refDeleted
+	}
+
+	if origin != nil {
+		info |= infoOrigin
+	}
+
+	if it.rightOrigin != nil {
+		info |= infoRightOrigin
+	}
+
+	e.writeByte(info)
+
+	if origin != nil {
+		e.writeUint(origin.client)
+		e.writeUint(origin.clock)
+	}
+
+	if it.rightOrigin != nil {
+		e.writeUint(it.rightOrigin.client)
+		e.writeUint(it.rightOrigin.clock)
+	}
+
+	if origin == nil && it.rightOrigin == nil {
+		e.writeUint(1)
+		e.writeString(t.name)
+	}
+
+	if it.deleted {
+		e.writeUint(it.length - offset)
+	} else {
+		e.writeString(string(utf16.Decode(it.content[offset:])))
+	}
+}
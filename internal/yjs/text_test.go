@@ -0,0 +1,385 @@
+package yjs_test
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/serroba/online-docs/internal/ot"
+	"github.com/serroba/online-docs/internal/yjs"
+	"github.com/stretchr/testify/require"
+)
+
+// insertABC is the update a Yjs client with ID 1 sends after inserting "abc"
+// into an empty root text named "content".
+var insertABC = []byte{
+	1,    // Clients
+	1,    // Structs of client 1
+	1, 0, // Client, first clock
+	4,                                       // Info: string content, no origins
+	1, 7, 'c', 'o', 'n', 't', 'e', 'n', 't', // Parent: root type "content"
+	3, 'a', 'b', 'c', // Content
+	0, // Deleted ranges
+}
+
+// deleteB is the update the same client sends after deleting "b".
+var deleteB = []byte{
+	0,          // Clients
+	1,          // Clients with deleted ranges
+	1, 1, 1, 1, // Client 1: one range, clock 1, length 1
+}
+
+// formatBold is an update that formats text as bold, which isn't supported.
+var formatBold = []byte{
+	1,    // Clients
+	1,    // Structs of client 1
+	1, 0, // Client, first clock
+	6,                                       // Info: format content, no origins
+	1, 7, 'c', 'o', 'n', 't', 'e', 'n', 't', // Parent: root type "content"
+	4, 'b', 'o', 'l', 'd', 4, 't', 'r', 'u', 'e', // Key and JSON value
+	0, // Deleted ranges
+}
+
+// insertABCDE is the update client 1 sends for "abcde", when the server
+// hasn't acknowledged "abc" yet.
+var insertABCDE = []byte{
+	1,    // Clients
+	1,    // Structs of client 1
+	1, 0, // Client, first clock
+	4,                                       // Info: string content, no origins
+	1, 7, 'c', 'o', 'n', 't', 'e', 'n', 't', // Parent: root type "content"
+	5, 'a', 'b', 'c', 'd', 'e', // Content
+	0, // Deleted ranges
+}
+
+// collected is an update from client 2 whose first three characters were
+// garbage collected, followed by one inserted after them by client 3.
+var collected = []byte{
+	2,    // Clients
+	1,    // Structs of client 3
+	3, 0, // Client, first clock
+	0x84, 2, 2, // Info: string content after an origin; client 2, clock 2
+	1, 'x', // Content
+	1,    // Structs of client 2
+	2, 0, // Client, first clock
+	0, 3, // Info: collected range of three characters
+	0, // Deleted ranges
+}
+
+func TestText_Integrate(t *testing.T) {
+	t.Parallel()
+
+	text := yjs.NewText("content", 100)
+
+	ops, err := text.Integrate(insertABC, "alice")
+	require.NoError(t, err)
+	require.Equal(t, []ot.Operation{
+		ot.NewInsert("a", 0, "alice"),
+		ot.NewInsert("b", 1, "alice"),
+		ot.NewInsert("c", 2, "alice"),
+	}, ops)
+	require.Equal(t, "abc", text.String())
+
+	ops, err = text.Integrate(deleteB, "alice")
+	require.NoError(t, err)
+	require.Equal(t, []ot.Operation{ot.NewDelete(1, "alice")}, ops)
+	require.Equal(t, "ac", text.String())
+
+	// Updates seen already change nothing
+	ops, err = text.Integrate(insertABC, "alice")
+	require.NoError(t, err)
+	require.Empty(t, ops)
+	require.Equal(t, "ac", text.String())
+}
+
+func TestText_Integrate_PartlySeen(t *testing.T) {
+	t.Parallel()
+
+	text := yjs.NewText("content", 100)
+
+	_, err := text.Integrate(insertABC, "alice")
+	require.NoError(t, err)
+
+	// Only the characters not seen yet are inserted
+	ops, err := text.Integrate(insertABCDE, "alice")
+	require.NoError(t, err)
+	require.Equal(t, []ot.Operation{ot.NewInsert("d", 3, "alice"), ot.NewInsert("e", 4, "alice")}, ops)
+	require.Equal(t, "abcde", text.String())
+}
+
+func TestText_Integrate_Collected(t *testing.T) {
+	t.Parallel()
+
+	text := yjs.NewText("content", 100)
+
+	// Like Yjs, the text collects what follows a collected range too
+	ops, err := text.Integrate(collected, "alice")
+	require.NoError(t, err)
+	require.Empty(t, ops)
+	require.Empty(t, text.String())
+
+	// Clients are sent the collected ranges, whole or in part
+	client := yjs.NewText("content", 4)
+	diff, err := text.Diff(client.StateVector())
+	require.NoError(t, err)
+	_, err = client.Integrate(diff, "alice")
+	require.NoError(t, err)
+	require.Equal(t, text.StateVector(), client.StateVector())
+
+	partial := yjs.NewText("content", 5)
+	_, err = partial.Integrate([]byte{1, 1, 2, 0, 0, 1, 0}, "alice")
+	require.NoError(t, err)
+
+	diff, err = text.Diff(partial.StateVector())
+	require.NoError(t, err)
+	_, err = partial.Integrate(diff, "alice")
+	require.NoError(t, err)
+	require.Equal(t, text.StateVector(), partial.StateVector())
+}
+
+func TestText_Integrate_OutOfOrder(t *testing.T) {
+	t.Parallel()
+
+	text := yjs.NewText("content", 100)
+
+	// The deletion waits for the characters it deletes
+	ops, err := text.Integrate(deleteB, "alice")
+	require.NoError(t, err)
+	require.Empty(t, ops)
+
+	ops, err = text.Integrate(insertABC, "alice")
+	require.NoError(t, err)
+	require.Len(t, ops, 4)
+	require.Equal(t, "ac", text.String())
+}
+
+func TestText_Integrate_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		update []byte
+		err    error
+	}{
+		{name: "truncated", update: insertABC[:10], err: yjs.ErrMalformed},
+		{name: "empty", update: nil, err: yjs.ErrMalformed},
+		{
+			name:   "other root type",
+			update: []byte{1, 1, 1, 0, 4, 1, 4, 'm', 'e', 't', 'a', 1, 'x', 0},
+			err:    yjs.ErrUnsupported,
+		},
+		{
+			name:   "nested type",
+			update: []byte{1, 1, 1, 0, 4, 0, 2, 0, 1, 'x', 0},
+			err:    yjs.ErrUnsupported,
+		},
+		{
+			name:   "formatting",
+			update: formatBold,
+			err:    yjs.ErrUnsupported,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := yjs.NewText("content", 100).Integrate(tt.update, "alice")
+			require.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestText_Apply(t *testing.T) {
+	t.Parallel()
+
+	server := yjs.NewText("content", 1)
+	client := yjs.NewText("content", 2)
+
+	for _, op := range []ot.Operation{
+		ot.NewInsert("h", 0, "bob"),
+		ot.NewInsert("i", 1, "bob"),
+		ot.NewInsert("🌍", 2, "bob"),
+		ot.NewInsert("!", 3, "bob"),
+		ot.NewDelete(1, "bob"),
+	} {
+		update, err := server.Apply(op)
+		require.NoError(t, err)
+
+		_, err = client.Integrate(update, "bob")
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, "h🌍!", server.String())
+	require.Equal(t, "h🌍!", client.String())
+
+	// Formats leave plain text as it is
+	update, err := server.Apply(ot.NewFormat(0, "bold", "true", "bob"))
+	require.NoError(t, err)
+	require.Nil(t, update)
+	require.Equal(t, "h🌍!", server.String())
+
+	_, err = server.Apply(ot.NewInsert("x", 5, "bob"))
+	require.Error(t, err)
+
+	_, err = server.Apply(ot.NewDelete(3, "bob"))
+	require.Error(t, err)
+}
+
+func TestText_Diff(t *testing.T) {
+	t.Parallel()
+
+	server := yjs.NewText("content", 1)
+	_, err := server.Integrate(insertABC, "alice")
+	require.NoError(t, err)
+	_, err = server.Integrate(deleteB, "alice")
+	require.NoError(t, err)
+	_, err = server.Apply(ot.NewInsert("!", 2, "bob"))
+	require.NoError(t, err)
+
+	// A new client gets everything, including deleted ranges
+	client := yjs.NewText("content", 2)
+	diff, err := server.Diff(client.StateVector())
+	require.NoError(t, err)
+	_, err = client.Integrate(diff, "alice")
+	require.NoError(t, err)
+	require.Equal(t, "ac!", client.String())
+
+	// One that is up to date gets nothing new
+	diff, err = server.Diff(client.StateVector())
+	require.NoError(t, err)
+	ops, err := client.Integrate(diff, "alice")
+	require.NoError(t, err)
+	require.Empty(t, ops)
+
+	_, err = server.Diff([]byte{2, 1})
+	require.ErrorIs(t, err, yjs.ErrMalformed)
+}
+
+func TestText_Replace(t *testing.T) {
+	t.Parallel()
+
+	server := yjs.NewText("content", 1)
+	client := yjs.NewText("content", 2)
+
+	for _, content := range []string{"hello world", "hello there world", "help", "", "again"} {
+		ops, err := client.Integrate(server.Replace(content), "bob")
+		require.NoError(t, err)
+		require.Equal(t, content, server.String())
+		require.Equal(t, content, client.String())
+
+		if content == "help" {
+			// Only the changed middle is sent
+			require.Len(t, ops, len("lo there world")+len("p"))
+		}
+	}
+}
+
+func TestText_Knows(t *testing.T) {
+	t.Parallel()
+
+	server := yjs.NewText("content", 1)
+	_, err := server.Integrate(insertABC, "alice")
+	require.NoError(t, err)
+
+	known, err := server.Knows(server.StateVector())
+	require.NoError(t, err)
+	require.True(t, known)
+
+	known, err = server.Knows(yjs.NewText("content", 3).StateVector())
+	require.NoError(t, err)
+	require.True(t, known)
+
+	// A client that has seen changes of client 7, which the server hasn't
+	other := yjs.NewText("content", 7)
+	_, err = other.Apply(ot.NewInsert("x", 0, "carol"))
+	require.NoError(t, err)
+
+	known, err = server.Knows(other.StateVector())
+	require.NoError(t, err)
+	require.False(t, known)
+
+	_, err = server.Knows([]byte{2, 1})
+	require.ErrorIs(t, err, yjs.ErrMalformed)
+}
+
+// replica is a copy of the text, and the operations it reported applied to
+// a document, which must match it.
+type replica struct {
+	text  *yjs.Text
+	doc   *ot.Document
+	inbox [][]byte
+}
+
+func TestText_Converges(t *testing.T) {
+	t.Parallel()
+
+	for seed := range uint64(20) {
+		rng := rand.New(rand.NewPCG(seed, 0)) //nolint:gosec // Reproducible, not secret
+		replicas := make([]*replica, 3)
+
+		for i := range replicas {
+			replicas[i] = &replica{text: yjs.NewText("content", uint64(i+1)), doc: ot.NewDocument("")}
+		}
+
+		for range 300 {
+			r := replicas[rng.IntN(len(replicas))]
+
+			// Receive some of the updates sent, in any order
+			if len(r.inbox) > 0 && rng.IntN(2) == 0 {
+				i := rng.IntN(len(r.inbox))
+				receive(t, r, r.inbox[i])
+				r.inbox = append(r.inbox[:i], r.inbox[i+1:]...)
+
+				continue
+			}
+
+			op := randomOperation(rng, r.doc.Len())
+			require.NoError(t, r.doc.Apply(op))
+
+			update, err := r.text.Apply(op)
+			require.NoError(t, err)
+			require.Equal(t, r.doc.Content(), r.text.String())
+
+			for _, other := range replicas {
+				if other != r {
+					other.inbox = append(other.inbox, update)
+				}
+			}
+		}
+
+		for _, r := range replicas {
+			for _, update := range r.inbox {
+				receive(t, r, update)
+			}
+		}
+
+		for _, r := range replicas[1:] {
+			require.Equal(t, replicas[0].text.String(), r.text.String(), "seed %d", seed)
+		}
+	}
+}
+
+// receive integrates an update and applies the operations it reports.
+func receive(t *testing.T, r *replica, update []byte) {
+	t.Helper()
+
+	ops, err := r.text.Integrate(update, "peer")
+	require.NoError(t, err)
+
+	for _, op := range ops {
+		require.NoError(t, r.doc.Apply(op))
+	}
+
+	require.Equal(t, r.text.String(), r.doc.Content())
+}
+
+// randomOperation inserts or deletes a character in a document of length n.
+func randomOperation(rng *rand.Rand, n int) ot.Operation {
+	if n > 0 && rng.IntN(3) == 0 {
+		return ot.NewDelete(rng.IntN(n), "peer")
+	}
+
+	chars := []rune("ab🌍")
+
+	return ot.NewInsert(string(chars[rng.IntN(len(chars))]), rng.IntN(n+1), "peer")
+}
@@ -0,0 +1,298 @@
+package yjs
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"unicode/utf16"
+)
+
+// ErrUnsupported is returned for updates that change anything but the
+// bridged text, or put content other than characters in it.
+var ErrUnsupported = errors.New("unsupported yjs content")
+
+// Kinds of struct, as Yjs numbers them in an item's info byte.
+const (
+	refGC      = 0
+	refDeleted = 1
+	refString  = 4
+	refSkip    = 10
+)
+
+// Bits of an item's info byte.
+const (
+	infoRef         = 0x1f
+	infoParentSub   = 0x20
+	infoRightOrigin = 0x40
+	infoOrigin      = 0x80
+)
+
+// id identifies a character by the client that inserted it and the value of
+// the client's clock at the time. Clocks count UTF-16 code units, like
+// JavaScript strings do.
+type id struct {
+	client uint64
+	clock  uint64
+}
+
+// sameID reports whether two optional IDs are equal.
+func sameID(a, b *id) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+// item is a run of characters one client inserted consecutively, or a range
+// of its clock that was garbage collected.
+type item struct {
+	id          id
+	length      uint64   // Clock values the item covers
+	origin      *id      // The character to its left when it was inserted
+	rightOrigin *id      // And the one to its right
+	content     []uint16 // UTF-16 code units, dropped once deleted
+	runes       int      // Characters in content
+	deleted     bool
+	gc          bool // A collected range, which isn't part of the text
+
+	left, right *item // Neighbors in the text, deleted ones included
+}
+
+// last returns the ID of the item's last character.
+func (it *item) last() id {
+	return id{client: it.id.client, clock: it.id.clock + it.length - 1}
+}
+
+// setContent replaces the item's characters.
+func (it *item) setContent(units []uint16) {
+	it.content = units
+	it.runes = countRunes(units)
+}
+
+// countRunes returns the number of characters in UTF-16 code units. Unpaired
+// surrogates count as one each.
+func countRunes(units []uint16) int {
+	n := 0
+
+	for i := 0; i < len(units); i++ {
+		if isPair(units, i) {
+			i++
+		}
+
+		n++
+	}
+
+	return n
+}
+
+// unitOffset returns the index in units of the character at position n.
+func unitOffset(units []uint16, n int) uint64 {
+	i := 0
+
+	for ; n > 0 && i < len(units); n-- {
+		if isPair(units, i) {
+			i++
+		}
+
+		i++
+	}
+
+	return uint64(i)
+}
+
+// isPair reports whether units[i] and units[i+1] form a surrogate pair.
+func isPair(units []uint16, i int) bool {
+	return i+1 < len(units) &&
+		units[i] >= 0xd800 && units[i] < 0xdc00 &&
+		units[i+1] >= 0xdc00 && units[i+1] < 0xe000
+}
+
+// clockRange is a range of one client's clock.
+type clockRange struct {
+	clock  uint64
+	length uint64
+}
+
+// deleteSet lists deleted ranges by client.
+type deleteSet map[uint64][]clockRange
+
+// add records a deleted range.
+func (ds deleteSet) add(client, clock, length uint64) {
+	ds[client] = append(ds[client], clockRange{clock: clock, length: length})
+}
+
+// update is a decoded Yjs update.
+type update struct {
+	items   []*item // By client, in clock order
+	deletes deleteSet
+}
+
+// decodeUpdate decodes an update in Yjs's first encoding. Items must belong
+// to the root text named root and hold characters or deleted content.
+func decodeUpdate(data []byte, root string) (update, error) {
+	d := &decoder{buf: data}
+	u := update{deletes: make(deleteSet)}
+
+	for clients := d.readUint(); clients > 0 && d.err == nil; clients-- {
+		structs := d.readUint()
+		client := d.readUint()
+		clock := d.readUint()
+
+		for ; structs > 0 && d.err == nil; structs-- {
+			it, length, err := decodeStruct(d, id{client: client, clock: clock}, root)
+			if err != nil {
+				return update{}, err
+			}
+
+			if length == 0 && d.err == nil {
+				return update{}, ErrMalformed
+			}
+
+			if it != nil {
+				u.items = append(u.items, it)
+			}
+
+			clock += length
+		}
+	}
+
+	for clients := d.readUint(); clients > 0 && d.err == nil; clients-- {
+		client := d.readUint()
+
+		for deletes := d.readUint(); deletes > 0 && d.err == nil; deletes-- {
+			u.deletes.add(client, d.readUint(), d.readUint())
+		}
+	}
+
+	if d.err != nil {
+		return update{}, d.err
+	}
+
+	return u, nil
+}
+
+// decodeStruct decodes one struct and returns it with the length of clock
+// it covers. Skipped ranges, which the sender doesn't have, return no item.
+func decodeStruct(d *decoder, at id, root string) (*item, uint64, error) {
+	info := d.readByte()
+
+	switch info & infoRef {
+	case refGC:
+		it := &item{id: at, gc: true, length: d.readUint()}
+
+		return it, it.length, nil
+	case refSkip:
+		return nil, d.readUint(), nil
+	}
+
+	it := &item{id: at}
+
+	if info&infoOrigin != 0 {
+		it.origin = &id{client: d.readUint(), clock: d.readUint()}
+	}
+
+	if info&infoRightOrigin != 0 {
+		it.rightOrigin = &id{client: d.readUint(), clock: d.readUint()}
+	}
+
+	// Items inserted between others share their parent
+	if it.origin == nil && it.rightOrigin == nil {
+		if d.readUint() != 1 {
+			return nil, 0, fmt.Errorf("%w: nested type", ErrUnsupported)
+		}
+
+		if name := d.readString(); name != root && d.err == nil {
+			return nil, 0, fmt.Errorf("%w: root type %q", ErrUnsupported, name)
+		}
+
+		if info&infoParentSub != 0 {
+			return nil, 0, fmt.Errorf("%w: map entry", ErrUnsupported)
+		}
+	}
+
+	switch ref := info & infoRef; ref {
+	case refDeleted:
+		it.deleted = true
+		it.length = d.readUint()
+	case refString:
+		it.setContent(utf16.Encode([]rune(d.readString())))
+		it.length = uint64(len(it.content))
+	default:
+		return nil, 0, fmt.Errorf("%w: content type %d", ErrUnsupported, ref)
+	}
+
+	return it, it.length, nil
+}
+
+// decodeStateVector decodes the clock of each client a peer has seen.
+func decodeStateVector(data []byte) (map[uint64]uint64, error) {
+	d := &decoder{buf: data}
+	sv := make(map[uint64]uint64)
+
+	for n := d.readUint(); n > 0 && d.err == nil; n-- {
+		sv[d.readUint()] = d.readUint()
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return sv, nil
+}
+
+// encodeStateVector encodes the clock of each client.
+func encodeStateVector(sv map[uint64]uint64) []byte {
+	var e encoder
+
+	e.writeUint(uint64(len(sv)))
+
+	for _, client := range descending(sv) {
+		e.writeUint(client)
+		e.writeUint(sv[client])
+	}
+
+	return e.buf
+}
+
+// writeDeleteSet encodes deleted ranges, merging adjacent ones.
+func writeDeleteSet(e *encoder, ds deleteSet) {
+	e.writeUint(uint64(len(ds)))
+
+	for _, client := range descending(ds) {
+		ranges := slices.SortedFunc(slices.Values(ds[client]), func(a, b clockRange) int {
+			return cmp.Compare(a.clock, b.clock)
+		})
+
+		merged := ranges[:0]
+
+		for _, r := range ranges {
+			if n := len(merged); n > 0 && merged[n-1].clock+merged[n-1].length >= r.clock {
+				merged[n-1].length = max(merged[n-1].length, r.clock+r.length-merged[n-1].clock)
+
+				continue
+			}
+
+			merged = append(merged, r)
+		}
+
+		e.writeUint(client)
+		e.writeUint(uint64(len(merged)))
+
+		for _, r := range merged {
+			e.writeUint(r.clock)
+			e.writeUint(r.length)
+		}
+	}
+}
+
+// descending returns a map's client IDs from highest to lowest, the order
+// Yjs writes them in.
+func descending[V any](m map[uint64]V) []uint64 {
+	clients := slices.Collect(maps.Keys(m))
+	slices.SortFunc(clients, func(a, b uint64) int { return cmp.Compare(b, a) })
+
+	return clients
+}
@@ -1,54 +1,729 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
 	"github.com/serroba/online-docs/internal/acl"
+	"github.com/serroba/online-docs/internal/apikey"
+	"github.com/serroba/online-docs/internal/auth"
+	"github.com/serroba/online-docs/internal/blob"
+	"github.com/serroba/online-docs/internal/bot"
+	"github.com/serroba/online-docs/internal/certs"
+	"github.com/serroba/online-docs/internal/cluster"
 	"github.com/serroba/online-docs/internal/collab"
+	"github.com/serroba/online-docs/internal/collab/recording"
+	"github.com/serroba/online-docs/internal/comment"
+	"github.com/serroba/online-docs/internal/config"
+	"github.com/serroba/online-docs/internal/graphqlapi"
+	"github.com/serroba/online-docs/internal/grpcapi"
 	"github.com/serroba/online-docs/internal/handler"
+	"github.com/serroba/online-docs/internal/health"
+	"github.com/serroba/online-docs/internal/idempotency"
+	"github.com/serroba/online-docs/internal/jwt"
+	"github.com/serroba/online-docs/internal/lease"
+	"github.com/serroba/online-docs/internal/logging"
+	"github.com/serroba/online-docs/internal/notify"
+	"github.com/serroba/online-docs/internal/oidc"
+	"github.com/serroba/online-docs/internal/preferences"
 	"github.com/serroba/online-docs/internal/storage"
+	"github.com/serroba/online-docs/internal/webhook"
 	"github.com/serroba/online-docs/internal/ws"
+	"golang.org/x/crypto/acme/autocert"
+	"google.golang.org/grpc"
 )
 
 func main() {
+	conf, err := config.Load(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+
+	if err != nil {
+		// The logger isn't configured yet
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	level, _ := logging.ParseLevel(conf.LogLevel) // Checked by config.Load
+
+	logger, err := logging.New(os.Stderr, conf.LogFormat, level)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Components log through the default logger unless given their own
+	slog.SetDefault(logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Initialize stores
-	store := storage.NewMemoryStore()
-	permStore := acl.NewMemoryStore()
+	store, closeStore, err := openStore(ctx, conf)
+	if err != nil {
+		fatal("store setup failed", err)
+	}
+
+	// Share links grant their role to whoever holds the token, and groups
+	// theirs to their members
+	linkStore := acl.NewMemoryLinkStore()
+	groupStore := acl.NewMemoryGroupStore()
+	roles := acl.NewLinkedStore(acl.NewGroupedStore(acl.NewMemoryStore(), groupStore), linkStore)
+	prefs := preferences.NewMemoryStore()
+	apiKeys := apikey.NewService(apikey.NewMemoryStore())
 
 	// Initialize WebSocket hub
 	hub := ws.NewHub()
+	hub.SetLogger(logger)
+
+	// Email users about shares and edits made while they're away
+	listeners, closeNotifier, err := emailNotifications(conf.SMTP, prefs, roles, hub)
+	if err != nil {
+		fatal("notification setup failed", err)
+	}
+
+	// Deliver document events to registered webhooks; grants made through
+	// permStore are published as shares
+	webhooks := webhook.NewService(webhook.Config{
+		Store:     webhook.NewMemoryStore(),
+		PermStore: roles,
+		Listeners: listeners,
+	})
+	permStore := webhook.NewPermissionStore(roles, webhooks)
+
+	// Relay broadcasts to the other instances of a cluster
+	locker, disconnectCluster, err := connectCluster(ctx, conf.Cluster, hub)
+	if err != nil {
+		fatal("cluster setup failed", err)
+	}
+
+	// Comments are anchored to text, so sessions move them as documents change
+	comments := comment.NewService(comment.NewMemoryStore())
 
 	// Initialize session manager
 	manager := collab.NewManager(collab.ManagerConfig{
 		Store:     store,
 		PermStore: permStore,
 		Hub:       hub,
+		Webhooks:  webhooks,
+		Anchors:   comments,
+		Locker:    locker,
+
+		HistorySize:    conf.HistorySize,
+		SnapshotPolicy: snapshotPolicy(conf.SnapshotThreshold),
+		CommitDelay:    conf.CommitDelay,
+		SlowOperation:  conf.SlowOperation,
+		Record:         recordSessions(conf.RecordDir),
+		Logger:         logger,
 	})
 
+	// Requests wait for the store, the integrity check and preloading
+	readiness := health.NewReadiness(health.TaskStore, health.TaskIntegrity, health.TaskPreload)
+
+	// Give each document a single owning node when the cluster is listed
+	var ring *cluster.Ring
+	if len(conf.Cluster.Nodes) > 0 {
+		ring = cluster.NewRing(conf.Cluster.Nodes...)
+		slog.Info("routing documents to their owners", "node", conf.Cluster.NodeURL, "nodes", len(conf.Cluster.Nodes))
+	}
+
 	// Initialize API server
-	server := handler.NewServer(handler.ServerConfig{
-		Manager:   manager,
-		Store:     store,
-		PermStore: permStore,
-		Hub:       hub,
-	})
+	cfg := handler.ServerConfig{
+		Manager:     manager,
+		Store:       store,
+		PermStore:   permStore,
+		Hub:         hub,
+		APIKeys:     apiKeys,
+		ShareLinks:  acl.NewLinks(linkStore),
+		Groups:      acl.NewGroups(groupStore),
+		Bots:        bot.NewService(bot.Config{Store: bot.NewMemoryStore(), Manager: manager, Hub: hub}),
+		Webhooks:    webhooks,
+		Idempotency: idempotency.NewMemoryStore(idempotency.DefaultTTL),
+		Preferences: prefs,
+		Blobs:       blob.NewMemoryStore(),
+		Comments:    comments,
+		Tokens: auth.NewTokenManager(auth.NewMemoryTokenStore(),
+			auth.DefaultAccessTokenTTL, auth.DefaultRefreshTokenTTL),
+		GraphQL: graphqlapi.NewHandler(graphqlapi.Config{
+			Manager:   manager,
+			Store:     store,
+			PermStore: permStore,
+			Hub:       hub,
+			Webhooks:  webhooks,
+			Owns:      ownedBy(ring, conf.Cluster.NodeURL),
+		}),
+		Ring:           ring,
+		NodeURL:        conf.Cluster.NodeURL,
+		Admins:         conf.Admins,
+		Logger:         logger,
+		Readiness:      readiness,
+		RequestTimeout: conf.RequestTimeout,
+		OperationRate:  float64(conf.OperationRate),
+		OperationBurst: conf.OperationBurst,
+		AllowedOrigins: conf.AllowedOrigins,
+	}
+
+	// Enable OpenID Connect login when a provider is configured
+	if conf.OIDC.IssuerURL != "" {
+		provider, err := oidc.Discover(ctx, oidc.Config{
+			IssuerURL:    conf.OIDC.IssuerURL,
+			ClientID:     conf.OIDC.ClientID,
+			ClientSecret: conf.OIDC.ClientSecret,
+			RedirectURL:  conf.OIDC.RedirectURL,
+		})
+		if err != nil {
+			fatal("OIDC discovery failed", err)
+		}
+
+		cfg.OIDC = provider
+		cfg.Sessions = auth.NewSessionManager(auth.NewMemorySessionStore(), auth.DefaultSessionTTL)
+	}
+
+	// Accept JWTs from an identity provider in place of the X-User-Id header
+	if conf.JWT.Enabled() {
+		cfg.JWT = jwtVerifier(conf.JWT)
+	}
+
+	// Degrade WebSockets on purpose when testing clients against a bad network
+	if conf.Faults != "" {
+		profile, _ := ws.ParseFaultProfile(conf.Faults) // Checked by config.Load
+		cfg.Faults = ws.NewFaultInjector(profile)
+		slog.Warn("injecting network faults into WebSockets", "faults", conf.Faults)
+	}
+
+	server := handler.NewServer(cfg)
+
+	// Serve the gRPC API for backend services
+	grpcServer := grpc.NewServer()
+	grpcapi.NewServer(grpcapi.ServerConfig{
+		Manager:       manager,
+		Store:         store,
+		PermStore:     permStore,
+		Hub:           hub,
+		APIKeys:       apiKeys,
+		Webhooks:      webhooks,
+		RequireAPIKey: cfg.OIDC != nil || cfg.JWT != nil,
+		Owns:          ownedBy(ring, conf.Cluster.NodeURL),
+		Logger:        logger,
+	}).Register(grpcServer)
 
 	// Configure HTTP server with timeouts
-	addr := ":8080"
 	httpServer := &http.Server{
-		Addr:              addr,
+		Addr:              conf.HTTPAddr,
 		Handler:           server.Handler(),
-		ReadHeaderTimeout: 10 * time.Second,
-		ReadTimeout:       15 * time.Second,
-		WriteTimeout:      15 * time.Second,
-		IdleTimeout:       60 * time.Second,
+		ReadHeaderTimeout: conf.ReadHeaderTimeout,
+		ReadTimeout:       conf.ReadTimeout,
+		WriteTimeout:      conf.WriteTimeout,
+		IdleTimeout:       conf.IdleTimeout,
+	}
+
+	if err := configureTLS(ctx, conf.TLS, httpServer); err != nil {
+		fatal("TLS setup failed", err)
+	}
+
+	go func() {
+		slog.Info("starting HTTP server", "addr", conf.HTTPAddr, "tls", httpServer.TLSConfig != nil)
+
+		if err := listenAndServe(httpServer); !errors.Is(err, http.ErrServerClosed) {
+			fatal("HTTP server failed", err)
+		}
+	}()
+
+	// Serve the probes while warming up, so orchestrators can see progress
+	warmUp(ctx, readiness, store, manager, conf, ring)
+
+	// gRPC has no readiness gate, so it only starts once warmed up
+	listener, err := net.Listen("tcp", conf.GRPCAddr)
+	if err != nil {
+		fatal("gRPC listen failed", err)
+	}
+
+	go func() {
+		slog.Info("starting gRPC server", "addr", conf.GRPCAddr)
+
+		if err := grpcServer.Serve(listener); err != nil {
+			fatal("gRPC server failed", err)
+		}
+	}()
+
+	if conf.StatsInterval > 0 {
+		go manager.LogStats(ctx, conf.StatsInterval)
+	}
+
+	if conf.Compaction.Interval > 0 {
+		policy := storage.CompactionPolicy{MaxOperations: conf.Compaction.MaxOperations, MaxAge: conf.Compaction.MaxAge}
+		go manager.RunCompaction(ctx, policy, conf.Compaction.Interval, ownedBy(ring, conf.Cluster.NodeURL))
+	}
+
+	<-ctx.Done()
+	stop() // A second signal terminates immediately
+
+	slog.Info("shutting down")
+	shutdown(conf.ShutdownTimeout, httpServer, grpcServer, hub, manager, webhooks)
+	closeNotifier()
+	disconnectCluster()
+	closeStore()
+}
+
+// openStore returns the store conf selects, journaled if conf names a
+// journal file, and a function that closes it.
+func openStore(ctx context.Context, conf config.Config) (storage.Store, func(), error) {
+	store, closeStore, err := openBackingStore(ctx, conf)
+	if err != nil || conf.JournalFile == "" {
+		return store, closeStore, err
+	}
+
+	journal, err := storage.OpenJournal(ctx, store, conf.JournalFile)
+	if err != nil {
+		closeStore()
+
+		return nil, nil, fmt.Errorf("open %s: %w", conf.JournalFile, err)
+	}
+
+	slog.Info("journaling operations", "path", conf.JournalFile)
+
+	return journal, func() {
+		if err := journal.Close(); err != nil {
+			slog.Error("failed to close journal", logging.Err(err))
+		}
+
+		closeStore()
+	}, nil
+}
+
+// openBackingStore returns the store documents are kept in, in memory
+// unless conf names a PostgreSQL database or a data file, and a function
+// that closes it. The PostgreSQL schema is migrated once the database
+// answers, before the store is marked ready.
+func openBackingStore(ctx context.Context, conf config.Config) (storage.Store, func(), error) {
+	switch {
+	case conf.PostgresURL != "":
+		store, err := storage.NewPostgresStore(ctx, conf.PostgresURL)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		slog.Info("storing documents in PostgreSQL")
+
+		return store, store.Close, nil
+	case conf.DataFile != "":
+		store, err := storage.OpenBoltStore(conf.DataFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("open %s: %w", conf.DataFile, err)
+		}
+
+		slog.Info("storing documents in a file", "path", conf.DataFile)
+
+		return store, func() {
+			if err := store.Close(); err != nil {
+				slog.Error("failed to close data file", logging.Err(err))
+			}
+		}, nil
+	default:
+		return storage.NewMemoryStore(), func() {}, nil
+	}
+}
+
+// emailNotifications returns the listener that emails document events to
+// the users they concern when conf names an SMTP server, and a function
+// that sends the last batch.
+func emailNotifications(
+	conf config.SMTP, prefs preferences.Store, roles acl.Store, hub *ws.Hub,
+) ([]webhook.Listener, func(), error) {
+	if conf.Addr == "" {
+		return nil, func() {}, nil
+	}
+
+	var source string
+
+	if conf.Template != "" {
+		data, err := os.ReadFile(conf.Template)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read template: %w", err)
+		}
+
+		source = string(data)
+	}
+
+	notifier, err := notify.NewSMTPNotifier(notify.SMTPConfig{
+		Addr:        conf.Addr,
+		From:        conf.From,
+		Username:    conf.Username,
+		Password:    conf.Password,
+		Preferences: prefs,
+		BatchWindow: conf.BatchWindow,
+		Template:    source,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dispatcher := notify.NewDispatcher(notify.DispatcherConfig{
+		Notifier:    notifier,
+		Preferences: prefs,
+		PermStore:   roles,
+		Hub:         hub,
+	})
+
+	slog.Info("emailing notifications", "smtp", conf.Addr, "batch_window", conf.BatchWindow)
+
+	return []webhook.Listener{dispatcher}, notifier.Close, nil
+}
+
+// connectCluster bridges the hub to other instances through Redis or NATS
+// when conf names a server, and returns the locker that leases documents
+// when conf asks for one. The returned function disconnects.
+func connectCluster(ctx context.Context, conf config.Cluster, hub *ws.Hub) (lease.Locker, func(), error) {
+	switch {
+	case conf.RedisURL != "":
+		return connectRedis(ctx, conf, hub)
+	case conf.NATSURL != "":
+		disconnect, err := connectNATS(conf.NATSURL, hub)
+
+		return nil, disconnect, err
+	default:
+		return nil, func() {}, nil
+	}
+}
+
+func connectRedis(ctx context.Context, conf config.Cluster, hub *ws.Hub) (lease.Locker, func(), error) {
+	opts, err := redis.ParseURL(conf.RedisURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client := redis.NewClient(opts)
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+
+		return nil, nil, fmt.Errorf("connect to Redis at %s: %w", opts.Addr, err)
+	}
+
+	bridge := cluster.NewRedisBridge(cluster.RedisConfig{Client: client, Hub: hub})
+	hub.SetBridge(bridge)
+	slog.Info("relaying broadcasts through Redis", "addr", opts.Addr)
+
+	var locker lease.Locker
+
+	if conf.LeaseTTL > 0 {
+		locker = lease.NewRedisLocker(lease.RedisConfig{Client: client, TTL: conf.LeaseTTL})
+		slog.Info("leasing documents through Redis", "ttl", conf.LeaseTTL)
+	}
+
+	return locker, func() {
+		if err := bridge.Close(); err != nil {
+			slog.Error("failed to close Redis bridge", logging.Err(err))
+		}
+
+		_ = client.Close()
+	}, nil
+}
+
+func connectNATS(natsURL string, hub *ws.Hub) (func(), error) {
+	conn, err := nats.Connect(natsURL, nats.Name("online-docs"))
+	if err != nil {
+		return nil, fmt.Errorf("connect to NATS: %w", err)
 	}
 
-	log.Printf("Starting server on %s", addr)
+	bridge := cluster.NewNATSBridge(cluster.NATSConfig{Conn: conn, Hub: hub})
+	hub.SetBridge(bridge)
+	slog.Info("relaying broadcasts through NATS", "url", conn.ConnectedUrlRedacted())
+
+	return func() {
+		if err := bridge.Close(); err != nil {
+			slog.Error("failed to close NATS bridge", logging.Err(err))
+		}
+
+		conn.Close()
+	}, nil
+}
 
-	if err := httpServer.ListenAndServe(); err != nil {
-		log.Fatalf("Server error: %v", err)
+// storeRetryInterval is how long startup waits between store connection attempts.
+const storeRetryInterval = 2 * time.Second
+
+// warmUp runs the startup tasks in order, marking each done in readiness:
+// it waits for the store to answer, checks every document's history and
+// opens the documents to preload. It returns early once ctx is done.
+func warmUp(
+	ctx context.Context, readiness *health.Readiness,
+	store storage.Store, manager *collab.Manager, conf config.Config, ring *cluster.Ring,
+) {
+	start := time.Now()
+
+	if !waitForStore(ctx, store) {
+		return
 	}
+
+	readiness.Done(health.TaskStore)
+
+	// Find documents whose history doesn't replay before anyone opens them
+	checkIntegrity(ctx, manager, conf.RepairDocuments)
+	readiness.Done(health.TaskIntegrity)
+
+	preload(ctx, manager, conf.PreloadDocuments, ring, conf.Cluster.NodeURL)
+	readiness.Done(health.TaskPreload)
+
+	slog.Info("ready", "duration", time.Since(start))
+}
+
+// waitForStore retries until the store answers, migrating its schema
+// first if it has one, reporting false if ctx is done first.
+func waitForStore(ctx context.Context, store storage.Store) bool {
+	for {
+		err := migrate(ctx, store)
+		if err == nil {
+			_, err = store.Usage(ctx)
+		}
+
+		if err == nil {
+			return true
+		}
+
+		slog.Warn("store unavailable, retrying", "retry_in", storeRetryInterval, logging.Err(err))
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(storeRetryInterval):
+		}
+	}
+}
+
+// migrate brings the store's schema up to date if it has one.
+func migrate(ctx context.Context, store storage.Store) error {
+	migrator, ok := store.(storage.Migrator)
+	if !ok {
+		return nil
+	}
+
+	return migrator.Migrate(ctx)
+}
+
+// preload opens the sessions of the given documents, skipping those another
+// node of the cluster owns. Documents that fail to open are logged and
+// opened again on first use.
+func preload(ctx context.Context, manager *collab.Manager, docIDs []string, ring *cluster.Ring, nodeURL string) {
+	opened := 0
+
+	for _, docID := range docIDs {
+		if ring != nil && ring.Owner(docID) != nodeURL {
+			continue
+		}
+
+		if _, err := manager.GetOrCreateSession(ctx, docID); err != nil {
+			slog.Warn("failed to preload document", logging.DocID(docID), logging.Err(err))
+
+			continue
+		}
+
+		opened++
+	}
+
+	if len(docIDs) > 0 {
+		slog.Info("preloaded documents", "opened", opened)
+	}
+}
+
+// ownedBy reports which documents the node at nodeURL serves, or nil if
+// every node serves every document.
+func ownedBy(ring *cluster.Ring, nodeURL string) func(docID string) bool {
+	if ring == nil {
+		return nil
+	}
+
+	return func(docID string) bool { return ring.Owner(docID) == nodeURL }
+}
+
+// checkIntegrity logs the documents whose history doesn't replay, and
+// whether they were repaired or quarantined.
+func checkIntegrity(ctx context.Context, manager *collab.Manager, repair bool) {
+	findings, err := manager.CheckIntegrity(ctx, repair)
+	if err != nil {
+		slog.Error("integrity check failed", logging.Err(err))
+	}
+
+	for _, f := range findings {
+		slog.Warn("document history is damaged",
+			logging.DocID(f.DocID), "revision", f.Revision, "repaired", f.Repaired, logging.Err(f.Err))
+	}
+
+	slog.Info("integrity check finished", "damaged", len(findings))
+}
+
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, logging.Err(err))
+	os.Exit(1)
+}
+
+// configureTLS enables HTTPS on httpServer when conf asks for it. Certificate
+// files are read again on SIGHUP; autocert renews its certificates itself.
+func configureTLS(ctx context.Context, conf config.TLS, httpServer *http.Server) error {
+	if len(conf.AutocertDomains) > 0 {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(conf.AutocertDomains...),
+			Cache:      autocert.DirCache(conf.AutocertCacheDir),
+		}
+		httpServer.TLSConfig = manager.TLSConfig()
+
+		return nil
+	}
+
+	if conf.CertFile == "" {
+		return nil
+	}
+
+	reloader, err := certs.NewReloader(conf.CertFile, conf.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	httpServer.TLSConfig = reloader.TLSConfig()
+
+	go reloadOnHangup(ctx, reloader)
+
+	return nil
+}
+
+// reloadOnHangup reloads the certificate files each time the process
+// receives SIGHUP, until ctx is done.
+func reloadOnHangup(ctx context.Context, reloader *certs.Reloader) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			if err := reloader.Reload(); err != nil {
+				slog.Error("certificate reload failed, keeping the current one", logging.Err(err))
+
+				continue
+			}
+
+			slog.Info("reloaded TLS certificate")
+		}
+	}
+}
+
+// listenAndServe serves HTTPS when the server has a TLS configuration and
+// plain HTTP otherwise.
+func listenAndServe(httpServer *http.Server) error {
+	if httpServer.TLSConfig != nil {
+		return httpServer.ListenAndServeTLS("", "")
+	}
+
+	return httpServer.ListenAndServe()
+}
+
+// snapshotPolicy returns the automatic snapshot policy, or nil when the
+// threshold disables it.
+func snapshotPolicy(threshold int) *storage.SnapshotPolicy {
+	if threshold == 0 {
+		return nil
+	}
+
+	return storage.NewSnapshotPolicy(threshold)
+}
+
+// recordSessions returns the manager's recorder for each session, recording
+// them to files in dir, or nil when dir isn't set.
+func recordSessions(dir string) func(docID string) collab.Recorder {
+	if dir == "" {
+		return nil
+	}
+
+	return func(docID string) collab.Recorder {
+		recorder, err := recording.Create(dir, docID)
+		if err != nil {
+			slog.Error("recording session failed", logging.DocID(docID), logging.Err(err))
+
+			return nil
+		}
+
+		return recorder
+	}
+}
+
+// shutdown stops accepting connections, warns WebSocket clients before
+// disconnecting them, waits for in-flight requests and streams until
+// timeout, then saves a final snapshot of every open document and finishes
+// webhook deliveries.
+func shutdown(
+	timeout time.Duration,
+	httpServer *http.Server, grpcServer *grpc.Server, hub *ws.Hub, manager *collab.Manager, webhooks *webhook.Service,
+) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// WebSocket connections are hijacked, so Shutdown doesn't wait for them.
+	// Once it has closed the listeners, warn them so they reconnect to the
+	// next process and resend unacknowledged edits, then disconnect them.
+	disconnected := make(chan int, 1)
+	httpServer.RegisterOnShutdown(func() { disconnected <- hub.DisconnectAll(ctx, "server shutting down") })
+
+	if err := httpServer.Shutdown(ctx); err != nil {
+		slog.Error("HTTP shutdown failed", logging.Err(err))
+	}
+
+	slog.Info("disconnected WebSocket clients", "clients", <-disconnected)
+
+	stopGRPC(ctx, grpcServer)
+
+	// The next process restores the sessions' history, so clients that
+	// reconnect to it can resend edits based on revisions from this one
+	if err := manager.HandOffAll(); err != nil {
+		slog.Error("failed to hand off sessions", logging.Err(err))
+	}
+
+	webhooks.Close()
+}
+
+// stopGRPC stops the gRPC server gracefully, cutting off remaining streams
+// once ctx is done.
+func stopGRPC(ctx context.Context, grpcServer *grpc.Server) {
+	stopped := make(chan struct{})
+
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		grpcServer.Stop()
+	}
+}
+
+// jwtVerifier returns the verifier for the JWTs conf describes, signed with
+// its secret or with the keys published at its JWKS URL.
+func jwtVerifier(conf config.JWT) *jwt.Verifier {
+	var keys jwt.KeySet = jwt.NewStaticKeySet([]byte(conf.Secret))
+	if conf.JWKSURL != "" {
+		keys = jwt.NewRemoteKeySet(conf.JWKSURL, nil)
+	}
+
+	return jwt.NewVerifier(jwt.VerifierConfig{
+		Keys:     keys,
+		Issuer:   conf.Issuer,
+		Audience: conf.Audience,
+		Leeway:   time.Minute,
+	})
 }
@@ -0,0 +1,929 @@
+// Code generated by cmd/tsgen from internal/ws and internal/apitypes. DO NOT EDIT.
+
+// WebSocket messages
+
+/**
+ * OperationPayload is sent when a client submits an edit.
+ *
+ * Edits from a connection are applied one at a time, in the order they
+ * arrive. A client may number them with Seq, increasing with each edit sent
+ * over the connection; the ack or error answering an edit carries its seq,
+ * so clients with several edits in flight can tell which was answered. An
+ * edit whose seq isn't above that of the last one the connection took is
+ * rejected without being applied, as it was sent twice or out of order.
+ */
+export interface OperationPayload {
+  docId: string;
+  baseRevision: number;
+  /** 0 = insert, 1 = delete, 2 = format */
+  opType: number;
+  position: number;
+  char?: string;
+  /** Attribute a format sets, such as "bold" */
+  attribute?: string;
+  /** Value a format sets it to, empty to clear it */
+  value?: string;
+  /** Optional: numbers the client's edits */
+  seq?: number;
+}
+
+/**
+ * OperationBatchPayload is sent when a client submits several edits at once,
+ * such as a burst of keystrokes. They're applied in order, all or none, and
+ * acknowledged once with the revision of the last.
+ */
+export interface OperationBatchPayload {
+  docId: string;
+  /** The revision the first operation is based on */
+  baseRevision: number;
+  /** Each is based on the one before */
+  operations: BatchOperation[];
+  /** Optional: numbers the batch among the client's edits */
+  seq?: number;
+}
+
+/**
+ * SyncPayload is sent when a client requests the document's state. A
+ * client that gives the last revision it knows is sent the operations since
+ * in a catch-up, or the full state if they're no longer available.
+ */
+export interface SyncPayload {
+  docId: string;
+  /** Optional: the client's last known revision */
+  revision?: number;
+}
+
+/** CursorPayload is sent when a client moves its caret or selection. */
+export interface CursorPayload {
+  docId: string;
+  /** The revision the positions refer to */
+  revision: number;
+  /** The caret */
+  position: number;
+  /** Where the selection starts; equal to position when nothing is selected */
+  anchor: number;
+}
+
+/** BatchOperation is one edit of an operation batch. */
+export interface BatchOperation {
+  /** 0 = insert, 1 = delete, 2 = format */
+  opType: number;
+  position: number;
+  char?: string;
+  /** Attribute a format sets */
+  attribute?: string;
+  /** Value a format sets it to, empty to clear it */
+  value?: string;
+}
+
+/** ClientPayloads maps each message a client sends to its payload. */
+export interface ClientPayloads {
+  operation: OperationPayload;
+  operation_batch: OperationBatchPayload;
+  sync: SyncPayload;
+  cursor: CursorPayload;
+}
+
+/** AckPayload confirms an operation was applied. */
+export interface AckPayload {
+  /** The assigned revision number */
+  revision: number;
+  /** The acknowledged edit's seq, if it had one */
+  seq?: number;
+}
+
+/** BroadcastPayload pushes an operation to other clients. */
+export interface BroadcastPayload {
+  docId: string;
+  revision: number;
+  opType: number;
+  position: number;
+  char?: string;
+  /** Attribute a format sets */
+  attribute?: string;
+  /** Value a format sets it to, empty to clear it */
+  value?: string;
+  userId: string;
+}
+
+/**
+ * StatePayload sends the full document state, with the document's title
+ * and properties.
+ */
+export interface StatePayload {
+  docId: string;
+  content: string;
+  /** Runs of formatted characters in Content */
+  formatting?: Mark[];
+  revision: number;
+  title?: string;
+  properties?: Record<string, string>;
+}
+
+/**
+ * CatchUpPayload sends the operations applied since the revision a syncing
+ * client gave, in order. Applying them brings the client to Revision.
+ */
+export interface CatchUpPayload {
+  docId: string;
+  /** The revision after the last operation */
+  revision: number;
+  operations: CatchUpOperation[];
+}
+
+/** ErrorPayload reports an error to the client. */
+export interface ErrorPayload {
+  code: string;
+  message: string;
+  /** The seq of the edit the error rejects, if it had one */
+  seq?: number;
+}
+
+/**
+ * PresencePayload reports a change to who is in a document or where their
+ * cursor is.
+ */
+export interface PresencePayload {
+  docId: string;
+  event: string;
+  clientId: string;
+  userId: string;
+  bot?: boolean;
+  /** Absent until the client first moves its cursor */
+  cursor?: Cursor;
+  /** The revision the cursor refers to */
+  revision?: number;
+}
+
+/**
+ * PermissionChangedPayload reports that an owner granted a user a role on
+ * the document or revoked theirs. Every client of the document receives it;
+ * clients of that user should refresh what they allow, or disconnect once
+ * they can no longer read the document.
+ */
+export interface PermissionChangedPayload {
+  docId: string;
+  userId: string;
+  /** viewer, editor or owner; absent when revoked */
+  role?: string;
+}
+
+/**
+ * ClosingPayload warns a client that the server is shutting down, or its
+ * document's session is closing, and its connection closes next. Clients
+ * should reconnect and resend the edits that weren't acknowledged.
+ */
+export interface ClosingPayload {
+  reason: string;
+}
+
+/**
+ * Mark is a run of characters, from Start up to End, with the same
+ * formatting.
+ */
+export interface Mark {
+  start: number;
+  end: number;
+  attributes: Record<string, string>;
+}
+
+/** CatchUpOperation is an operation a client missed. */
+export interface CatchUpOperation {
+  revision: number;
+  /** 0 = insert, 1 = delete, 2 = format */
+  opType: number;
+  position: number;
+  char?: string;
+  /** Attribute a format sets */
+  attribute?: string;
+  /** Value a format sets it to, empty to clear it */
+  value?: string;
+  userId: string;
+}
+
+/** Cursor is a client's caret and selection, as character positions. */
+export interface Cursor {
+  /** The caret */
+  position: number;
+  /** Where the selection starts; equal to position when nothing is selected */
+  anchor: number;
+}
+
+/** ServerPayloads maps each message the server sends to its payload. */
+export interface ServerPayloads {
+  ack: AckPayload;
+  broadcast: BroadcastPayload;
+  state: StatePayload;
+  catch_up: CatchUpPayload;
+  error: ErrorPayload;
+  presence: PresencePayload;
+  permission_changed: PermissionChangedPayload;
+  closing: ClosingPayload;
+}
+
+/** ClientMessage is a message a client sends. */
+export type ClientMessage = { [T in keyof ClientPayloads]: { type: T; payload: ClientPayloads[T] } }[keyof ClientPayloads];
+
+/** ServerMessage is a message the server sends. */
+export type ServerMessage = { [T in keyof ServerPayloads]: { type: T; payload: ServerPayloads[T] } }[keyof ServerPayloads];
+
+/** MessageErrorCode is the code of a WebSocket error message. */
+export type MessageErrorCode = "access_denied" | "document_archived" | "invalid_message" | "internal_error" | "rate_limited";
+
+/** PresenceEvent is what a WebSocket presence message reports. */
+export type PresenceEvent = "join" | "leave" | "cursor";
+
+/** ErrorCode is the code of a failed REST request. */
+export type ErrorCode = "invalid_request" | "unauthorized" | "access_denied" | "not_found" | "method_not_allowed" | "conflict" | "gone" | "precondition_failed" | "payload_too_large" | "unsupported_media_type" | "rate_limited" | "misdirected_request" | "bad_gateway" | "timeout" | "unavailable" | "internal_error";
+
+// REST API
+
+/** CreateDocumentRequest is the request body for creating a document. */
+export interface CreateDocumentRequest {
+  /** Generated by the server when empty */
+  id?: string;
+  /** Optional initial content */
+  content?: string;
+  /** Optional unique human-readable alias */
+  slug?: string;
+}
+
+/** CreateDocumentResponse is the response body for creating a document. */
+export interface CreateDocumentResponse {
+  id: string;
+  slug?: string;
+}
+
+/** CopyDocumentRequest is the request body for copying a document. */
+export interface CopyDocumentRequest {
+  /** Optional: the copy's ID, generated if empty */
+  id?: string;
+  /** Share the copy with the document's users, as an owner */
+  copyPermissions?: boolean;
+}
+
+/** SlugResponse is the response body for resolving a slug. */
+export interface SlugResponse {
+  id: string;
+  slug: string;
+}
+
+/** TokenResponse is the response body for logging in or refreshing tokens. */
+export interface TokenResponse {
+  /** Always "Bearer" */
+  tokenType: string;
+  accessToken: string;
+  expiresAt: string;
+  refreshToken: string;
+  refreshExpiresAt: string;
+}
+
+/** RefreshTokenRequest is the request body for refreshing tokens. */
+export interface RefreshTokenRequest {
+  refreshToken: string;
+}
+
+/** RevokeTokenRequest is the request body for revoking tokens. */
+export interface RevokeTokenRequest {
+  /** Access or refresh token */
+  token: string;
+}
+
+/** GetDocumentResponse is the response body for getting a document. */
+export interface GetDocumentResponse {
+  id: string;
+  title?: string;
+  content: string;
+  revision: number;
+  createdAt: string;
+  /** Last edit, or creation if never edited */
+  updatedAt: string;
+  properties?: Record<string, string>;
+}
+
+/**
+ * UpdateDocumentRequest is the request body for renaming a document or
+ * replacing its properties. Fields left out are unchanged.
+ */
+export interface UpdateDocumentRequest {
+  /** An empty title removes the name */
+  title?: string;
+  /** Replaces all properties; {} removes them */
+  properties?: Record<string, string>;
+}
+
+/**
+ * DocumentMetadataResponse is the response body for updating a document's
+ * title or properties.
+ */
+export interface DocumentMetadataResponse {
+  id: string;
+  title?: string;
+  createdAt: string;
+  /** Last edit, or creation if never edited */
+  updatedAt: string;
+  properties?: Record<string, string>;
+}
+
+/** DocumentStatsResponse is the response body for a document's statistics. */
+export interface DocumentStatsResponse {
+  id: string;
+  revision: number;
+  characters: number;
+  words: number;
+  collaborators: number;
+  createdAt: string;
+  lastEditedAt?: string;
+  lastEditedBy?: string;
+  archivedAt?: string;
+}
+
+/** Operation is a sequenced edit to a document. */
+export interface Operation {
+  revision: number;
+  /** "insert", "delete" or "format" */
+  type: string;
+  position: number;
+  /** Set for inserts */
+  char?: string;
+  /** Set for formats */
+  attribute?: string;
+  /** Set for formats, absent when they clear the attribute */
+  value?: string;
+  userId: string;
+  /** When it was applied; absent if that wasn't recorded */
+  timestamp?: string;
+}
+
+/**
+ * ChangesResponse is the response body for polling a document's changes.
+ * Operations is empty when the wait timed out with nothing new.
+ */
+export interface ChangesResponse {
+  id: string;
+  revision: number;
+  operations: Operation[];
+}
+
+/**
+ * HistoryResponse is the response body for a document's history: the
+ * operations producing each revision still in its log, newest first.
+ */
+export interface HistoryResponse {
+  id: string;
+  /** Earlier revisions were compacted into a snapshot */
+  oldestRevision: number;
+  operations: Operation[];
+  /** Absent on the last page */
+  nextCursor?: string;
+}
+
+/** RevisionResponse is the response body for a document as of a revision. */
+export interface RevisionResponse {
+  id: string;
+  revision: number;
+  content: string;
+  /** The edit producing the revision, unless it was compacted */
+  operation?: Operation;
+}
+
+/** DocumentShare grants a user a role on a document. */
+export interface DocumentShare {
+  userId: string;
+  /** viewer, editor or owner */
+  role: string;
+}
+
+/** PermissionsResponse is the response body for a document's permissions. */
+export interface PermissionsResponse {
+  id: string;
+  /** Sorted by user ID */
+  permissions: DocumentShare[];
+}
+
+/** GrantPermissionRequest is the request body for sharing a document with a user. */
+export interface GrantPermissionRequest {
+  userId: string;
+  /** viewer, editor or owner */
+  role: string;
+}
+
+/** SetPermissionRequest is the request body for granting a user a role. */
+export interface SetPermissionRequest {
+  /** viewer, editor or owner */
+  role: string;
+}
+
+/** CreateShareLinkRequest is the request body for creating a share link. */
+export interface CreateShareLinkRequest {
+  /** viewer or editor */
+  role: string;
+  /** Absent for a link that never expires */
+  expiresAt?: string;
+}
+
+/** ShareLink is a link giving anyone who holds its token a role on a document. */
+export interface ShareLink {
+  id: string;
+  role: string;
+  createdBy: string;
+  createdAt: string;
+  expiresAt?: string;
+}
+
+/**
+ * CreateShareLinkResponse is the response body for creating a share link.
+ * The token is only returned once.
+ */
+export interface CreateShareLinkResponse {
+  link: ShareLink;
+  /** Pass as the token query parameter */
+  token: string;
+}
+
+/** BatchCreateDocument describes one document of a batch create request. */
+export interface BatchCreateDocument {
+  id: string;
+  /** Optional initial content */
+  content?: string;
+  /** Optional initial permissions */
+  shares?: DocumentShare[];
+}
+
+/** BatchCreateRequest is the request body for creating several documents. */
+export interface BatchCreateRequest {
+  documents: BatchCreateDocument[];
+}
+
+/** BatchCreateResponse is the response body for creating several documents. */
+export interface BatchCreateResponse {
+  results: BatchResult[];
+}
+
+/** SetTagsRequest is the request body for replacing a document's tags. */
+export interface SetTagsRequest {
+  tags: string[];
+}
+
+/** TagsResponse is the response body for a document's tags. */
+export interface TagsResponse {
+  id: string;
+  /** Sorted, without duplicates */
+  tags: string[];
+}
+
+/** ArchiveResponse is the response body for a document's archive state. */
+export interface ArchiveResponse {
+  id: string;
+  archived: boolean;
+  archivedAt?: string;
+}
+
+/** RevertResponse is the response body for undoing or redoing an edit. */
+export interface RevertResponse {
+  /** Revision of the operation reverting the edit */
+  revision: number;
+}
+
+/** ReplaceContentRequest is the request body for replacing a document's text. */
+export interface ReplaceContentRequest {
+  content: string;
+}
+
+/** ReplaceContentResponse is the response body for replacing a document's text. */
+export interface ReplaceContentResponse {
+  /** Revision of the last edit made, or the current one if nothing changed */
+  revision: number;
+}
+
+/** AttachmentResponse is the response body for an uploaded attachment. */
+export interface AttachmentResponse {
+  id: string;
+  /** Original file name */
+  name?: string;
+  contentType: string;
+  /** Bytes */
+  size: number;
+  /** Path to download the attachment from */
+  url: string;
+}
+
+/**
+ * CreateCommentRequest is the request body for commenting on a document.
+ * The comment is anchored to the text from Start up to End, in characters,
+ * as of Revision; Start equals End for a comment on a position.
+ */
+export interface CreateCommentRequest {
+  body: string;
+  start: number;
+  end: number;
+  revision: number;
+}
+
+/**
+ * Comment is a comment on a document, anchored to the text from Start up
+ * to End as of Revision.
+ */
+export interface Comment {
+  id: string;
+  body: string;
+  authorId: string;
+  start: number;
+  end: number;
+  revision: number;
+  createdAt: string;
+  /** Absent until the comment is resolved */
+  resolvedAt?: string;
+  resolvedBy?: string;
+}
+
+/**
+ * ListCommentsResponse is the response body for listing a document's
+ * comments, oldest first.
+ */
+export interface ListCommentsResponse {
+  comments: Comment[];
+}
+
+/** DocumentSummary is a document in a listing, with the caller's role on it. */
+export interface DocumentSummary {
+  id: string;
+  /** viewer, editor or owner */
+  role: string;
+  isStarred: boolean;
+  /** Only listed with archived=true */
+  archived?: boolean;
+}
+
+/**
+ * ListUserDocumentsResponse is the response body for listing the caller's
+ * documents.
+ */
+export interface ListUserDocumentsResponse {
+  /** Sorted by ID */
+  documents: DocumentSummary[];
+  /** Passed as cursor for the next page; empty on the last */
+  nextCursor?: string;
+}
+
+/** StarResponse is the response body for a user's star on a document. */
+export interface StarResponse {
+  id: string;
+  isStarred: boolean;
+}
+
+/** ListStarredResponse is the response body for listing starred documents. */
+export interface ListStarredResponse {
+  /** Sorted */
+  ids: string[];
+}
+
+/**
+ * NotificationSettings is the request and response body for a user's
+ * notification settings.
+ */
+export interface NotificationSettings {
+  /** Where to send notifications; empty disables them */
+  email: string;
+  mentions: boolean;
+  shares: boolean;
+  /** Edits by others while the user isn't connected */
+  activity: boolean;
+}
+
+/** BatchDeleteRequest is the request body for deleting several documents. */
+export interface BatchDeleteRequest {
+  ids: string[];
+}
+
+/** BatchResult reports the outcome for one document of a batch request. */
+export interface BatchResult {
+  id: string;
+  /** HTTP status the single-document request would return */
+  status: number;
+  /** Set when the operation failed */
+  error?: ErrorResponse;
+}
+
+/** BatchDeleteResponse is the response body for deleting several documents. */
+export interface BatchDeleteResponse {
+  results: BatchResult[];
+}
+
+/** CreateAPIKeyRequest is the request body for issuing an API key. */
+export interface CreateAPIKeyRequest {
+  /** Service account name */
+  name: string;
+  /** Allowed actions: read, write, share, delete */
+  scopes: string[];
+}
+
+/** APIKey describes an API key without its secret. */
+export interface APIKey {
+  id: string;
+  name: string;
+  /** User ID the key authenticates as */
+  principal: string;
+  scopes: string[];
+  createdAt: string;
+}
+
+/**
+ * CreateAPIKeyResponse is the response body for issuing an API key.
+ * The secret is only returned once.
+ */
+export interface CreateAPIKeyResponse {
+  apiKey: APIKey;
+  secret: string;
+}
+
+/** ListAPIKeysResponse is the response body for listing API keys. */
+export interface ListAPIKeysResponse {
+  apiKeys: APIKey[];
+}
+
+/** CreateWebhookRequest is the request body for registering a webhook. */
+export interface CreateWebhookRequest {
+  /** Endpoint that receives signed POSTs */
+  url: string;
+  /** Event types to deliver; empty means all */
+  events?: string[];
+}
+
+/** Webhook describes a registered webhook without its secret. */
+export interface Webhook {
+  id: string;
+  url: string;
+  events: string[];
+  createdAt: string;
+}
+
+/**
+ * CreateWebhookResponse is the response body for registering a webhook.
+ * The signing secret is only returned once.
+ */
+export interface CreateWebhookResponse {
+  webhook: Webhook;
+  secret: string;
+}
+
+/** ListWebhooksResponse is the response body for listing webhooks. */
+export interface ListWebhooksResponse {
+  webhooks: Webhook[];
+}
+
+/** CreateBotRequest is the request body for registering a bot. */
+export interface CreateBotRequest {
+  name: string;
+}
+
+/** Bot describes a registered bot. */
+export interface Bot {
+  id: string;
+  name: string;
+  /** User ID the bot edits as */
+  principal: string;
+  /** Documents the bot has joined */
+  documents: string[];
+  createdAt: string;
+}
+
+/** ListBotsResponse is the response body for listing bots. */
+export interface ListBotsResponse {
+  bots: Bot[];
+}
+
+/** CreateGroupRequest is the request body for creating a group. */
+export interface CreateGroupRequest {
+  name: string;
+}
+
+/** Group describes a group of users that roles can be granted to together. */
+export interface Group {
+  id: string;
+  name: string;
+  /** User ID to grant the members' roles to */
+  principal: string;
+  /** Manages the members, and needn't be one */
+  ownerId: string;
+  members: string[];
+  createdAt: string;
+}
+
+/** ListGroupsResponse is the response body for listing groups. */
+export interface ListGroupsResponse {
+  groups: Group[];
+}
+
+/**
+ * BotEditRequest is the request body for a bot's edit, which replaces
+ * Delete characters at Position with Text.
+ */
+export interface BotEditRequest {
+  /** Omitted to append at the end */
+  position?: number;
+  delete?: number;
+  text?: string;
+}
+
+/** BotEditResponse is the response body for a bot's edit. */
+export interface BotEditResponse {
+  /** Revision of the edit's last operation */
+  revision: number;
+}
+
+/**
+ * DocumentEvent is a document event streamed from GET /v1/events. It has the
+ * same shape as webhook deliveries.
+ */
+export interface DocumentEvent {
+  id: string;
+  type: string;
+  documentId: string;
+  revision?: number;
+  userId?: string;
+  role?: string;
+  occurredAt: string;
+}
+
+/** AdminSession describes an active editing session. Sizes are estimates. */
+export interface AdminSession {
+  documentId: string;
+  revision: number;
+  clients: number;
+  historyOps: number;
+  /** Sum of the sizes below */
+  memoryBytes: number;
+  /** The document's content */
+  contentBytes: number;
+  /** The retained history */
+  historyBytes: number;
+  /** Operations waiting to be stored */
+  pendingBytes: number;
+  /** Of the operations stored since the session opened */
+  latency: OperationLatency;
+}
+
+/**
+ * OperationLatency summarizes how long a session's operations took, from
+ * reaching the session to being ready to acknowledge.
+ */
+export interface OperationLatency {
+  operations: number;
+  meanMs: StageLatency;
+  /** Each stage's slowest, which may be of different operations */
+  maxMs: StageLatency;
+}
+
+/** StageLatency breaks operation latency down by stage, in milliseconds. */
+export interface StageLatency {
+  /** Waiting for the session, transforming and applying */
+  transform: number;
+  /** Waiting for the operation's batch to be stored */
+  persist: number;
+  /** Queueing for every connected client */
+  broadcast: number;
+  total: number;
+}
+
+/** ListSessionsResponse is the response body for listing active sessions. */
+export interface ListSessionsResponse {
+  sessions: AdminSession[];
+}
+
+/** ListDocumentsResponse is the response body for listing every document. */
+export interface ListDocumentsResponse {
+  /** Sorted */
+  ids: string[];
+}
+
+/**
+ * AdminSummaryResponse is the response body for the server-wide summary.
+ * Rates are averaged over the last minute.
+ */
+export interface AdminSummaryResponse {
+  documents: number;
+  /** Approximate */
+  storageBytes: number;
+  activeSessions: number;
+  /** Estimated memory used by the active sessions */
+  sessionBytes: number;
+  connectedClients: number;
+  opsPerSecond: number;
+  /** Busiest first */
+  hotDocuments: HotDocument[];
+  broadcastQueue: BroadcastQueue;
+  /**
+   * TransformChains is a histogram, since startup, of how many operations
+   * each edit was transformed against. Buckets are ordered by length.
+   */
+  transformChains: ChainBucket[];
+}
+
+/** HotDocument describes one of the busiest active documents. */
+export interface HotDocument {
+  documentId: string;
+  clients: number;
+  opsPerSecond: number;
+}
+
+/**
+ * BroadcastQueue describes the broadcasts waiting to be written to WebSocket
+ * clients.
+ */
+export interface BroadcastQueue {
+  queued: number;
+  /** For the most backed-up client */
+  maxDepth: number;
+  /** Disconnected for falling behind, since startup */
+  droppedClients: number;
+}
+
+/**
+ * ChainBucket counts the edits whose transform chain was at least MinLength
+ * long and shorter than the next bucket's MinLength.
+ */
+export interface ChainBucket {
+  minLength: number;
+  operations: number;
+}
+
+/** HealthResponse is the response body for the liveness and readiness probes. */
+export interface HealthResponse {
+  /** ok, ready or starting */
+  status: string;
+  /** Startup tasks still running */
+  pending?: string[];
+}
+
+/** ErrorResponse is the body returned for all failed requests. */
+export interface ErrorResponse {
+  code: string;
+  message: string;
+}
+
+// Codec
+
+/** FieldKind is the result of typeof for a payload field. */
+type FieldKind = "string" | "number" | "boolean" | "object";
+
+/** serverFields describes each server payload's fields: their kind, and whether they're always present. */
+const serverFields: { [T in keyof ServerPayloads]: Record<string, [FieldKind, boolean]> } = {
+  ack: { revision: ["number", true], seq: ["number", false] },
+  broadcast: { docId: ["string", true], revision: ["number", true], opType: ["number", true], position: ["number", true], char: ["string", false], attribute: ["string", false], value: ["string", false], userId: ["string", true] },
+  state: { docId: ["string", true], content: ["string", true], formatting: ["object", false], revision: ["number", true], title: ["string", false], properties: ["object", false] },
+  catch_up: { docId: ["string", true], revision: ["number", true], operations: ["object", true] },
+  error: { code: ["string", true], message: ["string", true], seq: ["number", false] },
+  presence: { docId: ["string", true], event: ["string", true], clientId: ["string", true], userId: ["string", true], bot: ["boolean", false], cursor: ["object", false], revision: ["number", false] },
+  permission_changed: { docId: ["string", true], userId: ["string", true], role: ["string", false] },
+  closing: { reason: ["string", true] },
+};
+
+/** ProtocolError reports a message from the server that doesn't follow the protocol. */
+export class ProtocolError extends Error {
+  constructor(message: string) {
+    super(message);
+    this.name = "ProtocolError";
+  }
+}
+
+/** encodeMessage serializes a message for the server. */
+export function encodeMessage(msg: ClientMessage): string {
+  return JSON.stringify(msg);
+}
+
+/**
+ * decodeMessage parses a message from the server. It throws a ProtocolError
+ * if the message has an unknown type, or its payload lacks a field or has one
+ * of the wrong kind. Fields it doesn't know are allowed, so older clients keep
+ * working as the protocol grows.
+ */
+export function decodeMessage(data: string): ServerMessage {
+  const msg: unknown = JSON.parse(data);
+  if (typeof msg !== "object" || msg === null) {
+    throw new ProtocolError("message is not an object");
+  }
+
+  const { type, payload } = msg as { type?: unknown; payload?: unknown };
+  if (typeof type !== "string" || !Object.prototype.hasOwnProperty.call(serverFields, type)) {
+    throw new ProtocolError(`unknown message type ${JSON.stringify(type)}`);
+  }
+
+  if (typeof payload !== "object" || payload === null) {
+    throw new ProtocolError(`${type} message has no payload`);
+  }
+
+  const fields = serverFields[type as keyof ServerPayloads];
+  for (const [name, [kind, required]] of Object.entries(fields)) {
+    const value = (payload as Record<string, unknown>)[name];
+    if (value === undefined || value === null) {
+      if (required) {
+        throw new ProtocolError(`${type} payload is missing ${name}`);
+      }
+    } else if (typeof value !== kind) {
+      throw new ProtocolError(`${type} payload field ${name} is a ${typeof value}, not a ${kind}`);
+    }
+  }
+
+  return msg as ServerMessage;
+}